@@ -0,0 +1,74 @@
+# Copyright 2024 The gVisor Authors.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""Generates a small multilayer perceptron in ONNX format.
+
+The weights are random but seeded, so that the model is the same on every
+build. The model maps a batch of 64-element vectors to 10 logits.
+"""
+
+import sys
+
+import numpy as np
+import onnx
+from onnx import helper
+from onnx import numpy_helper
+from onnx import TensorProto
+
+INPUT_SIZE = 64
+HIDDEN_SIZE = 256
+OUTPUT_SIZE = 10
+
+
+def main(path):
+  rng = np.random.default_rng(0)
+
+  def weights(name, *shape):
+    return numpy_helper.from_array(
+        rng.standard_normal(shape).astype(np.float32), name=name)
+
+  graph = helper.make_graph(
+      nodes=[
+          helper.make_node("Gemm", ["input", "w1", "b1"], ["h1"]),
+          helper.make_node("Relu", ["h1"], ["a1"]),
+          helper.make_node("Gemm", ["a1", "w2", "b2"], ["h2"]),
+          helper.make_node("Relu", ["h2"], ["a2"]),
+          helper.make_node("Gemm", ["a2", "w3", "b3"], ["output"]),
+      ],
+      name="mlp",
+      inputs=[
+          helper.make_tensor_value_info("input", TensorProto.FLOAT,
+                                        ["batch", INPUT_SIZE]),
+      ],
+      outputs=[
+          helper.make_tensor_value_info("output", TensorProto.FLOAT,
+                                        ["batch", OUTPUT_SIZE]),
+      ],
+      initializer=[
+          weights("w1", INPUT_SIZE, HIDDEN_SIZE),
+          weights("b1", HIDDEN_SIZE),
+          weights("w2", HIDDEN_SIZE, HIDDEN_SIZE),
+          weights("b2", HIDDEN_SIZE),
+          weights("w3", HIDDEN_SIZE, OUTPUT_SIZE),
+          weights("b3", OUTPUT_SIZE),
+      ],
+  )
+  model = helper.make_model(
+      graph, opset_imports=[helper.make_opsetid("", 13)])
+  onnx.checker.check_model(model)
+  onnx.save(model, path)
+
+
+if __name__ == "__main__":
+  main(sys.argv[1])
@@ -0,0 +1,78 @@
+# Copyright 2024 The gVisor Authors.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""Serves inference requests for an ONNX model over HTTP.
+
+POST /predict takes a JSON body of the form {"instances": [[...], ...]} and
+returns {"predictions": [[...], ...]}. Requests are handled by one thread
+each, sharing a single ONNX Runtime session; the number of intra-op threads
+used by the session is set by the ORT_INTRA_OP_THREADS environment variable.
+"""
+
+import http.server
+import json
+import os
+import sys
+
+import numpy as np
+import onnxruntime as ort
+
+PORT = 8080
+
+
+def main(path):
+  opts = ort.SessionOptions()
+  opts.intra_op_num_threads = int(os.environ.get("ORT_INTRA_OP_THREADS", "0"))
+  session = ort.InferenceSession(
+      path, sess_options=opts, providers=["CPUExecutionProvider"])
+  input_name = session.get_inputs()[0].name
+
+  class Handler(http.server.BaseHTTPRequestHandler):
+    protocol_version = "HTTP/1.1"
+
+    def do_GET(self):
+      # Used as a readiness check.
+      self._reply(200, {"status": "ok"})
+
+    def do_POST(self):
+      if self.path != "/predict":
+        self._reply(404, {"error": "not found"})
+        return
+      length = int(self.headers.get("Content-Length", "0"))
+      try:
+        instances = json.loads(self.rfile.read(length))["instances"]
+        batch = np.asarray(instances, dtype=np.float32)
+        outputs = session.run(None, {input_name: batch})[0]
+      except (KeyError, ValueError) as e:
+        self._reply(400, {"error": str(e)})
+        return
+      self._reply(200, {"predictions": outputs.tolist()})
+
+    def _reply(self, code, body):
+      data = json.dumps(body).encode()
+      self.send_response(code)
+      self.send_header("Content-Type", "application/json")
+      self.send_header("Content-Length", str(len(data)))
+      self.end_headers()
+      self.wfile.write(data)
+
+    def log_message(self, *args):
+      pass
+
+  server = http.server.ThreadingHTTPServer(("", PORT), Handler)
+  server.serve_forever()
+
+
+if __name__ == "__main__":
+  main(sys.argv[1])
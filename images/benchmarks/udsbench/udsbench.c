@@ -0,0 +1,325 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// udsbench measures the latency and throughput of UNIX domain sockets.
+//
+// The server serves clients one at a time until it is killed. Each client
+// first sends a struct params describing the run, then count messages:
+//   - in latency mode, the server echoes each message back;
+//   - in throughput mode, the server acknowledges the last message with a
+//     single byte.
+// When FD passing is enabled, each message of the client carries a file
+// descriptor, which the server closes.
+//
+// Addresses starting with '@' are in the abstract namespace.
+
+#include <errno.h>
+#include <fcntl.h>
+#include <getopt.h>
+#include <stddef.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <sys/socket.h>
+#include <sys/un.h>
+#include <time.h>
+#include <unistd.h>
+
+struct params {
+  uint64_t size;
+  uint64_t count;
+  uint64_t latency;
+  uint64_t fds;
+};
+
+static void fail(const char* what) {
+  perror(what);
+  exit(1);
+}
+
+static socklen_t make_addr(const char* name, struct sockaddr_un* addr) {
+  memset(addr, 0, sizeof(*addr));
+  addr->sun_family = AF_UNIX;
+  size_t len = strlen(name);
+  if (len >= sizeof(addr->sun_path)) {
+    fprintf(stderr, "address too long: %s\n", name);
+    exit(1);
+  }
+  memcpy(addr->sun_path, name, len);
+  if (name[0] == '@') {
+    addr->sun_path[0] = '\0';
+  } else {
+    len++;
+  }
+  return offsetof(struct sockaddr_un, sun_path) + len;
+}
+
+static int bind_addr(int type, const char* name) {
+  int fd = socket(AF_UNIX, type, 0);
+  if (fd < 0) fail("socket");
+  struct sockaddr_un addr;
+  socklen_t len = make_addr(name, &addr);
+  if (name[0] != '@') unlink(name);
+  if (bind(fd, (struct sockaddr*)&addr, len) < 0) fail("bind");
+  return fd;
+}
+
+static int parse_type(const char* type) {
+  if (strcmp(type, "stream") == 0) return SOCK_STREAM;
+  if (strcmp(type, "dgram") == 0) return SOCK_DGRAM;
+  if (strcmp(type, "seqpacket") == 0) return SOCK_SEQPACKET;
+  fprintf(stderr, "invalid socket type: %s\n", type);
+  exit(1);
+}
+
+// send_msg sends len bytes of buf to fd, attaching pass_fd if it is not -1.
+// Stream sockets may send the message in several parts; the FD is only
+// attached to the first one.
+static void send_msg(int fd, const char* buf, size_t len, int pass_fd,
+                     const struct sockaddr_un* to, socklen_t tolen) {
+  char control[CMSG_SPACE(sizeof(int))];
+  while (len > 0) {
+    struct iovec iov = {.iov_base = (void*)buf, .iov_len = len};
+    struct msghdr msg = {
+        .msg_name = (void*)to,
+        .msg_namelen = tolen,
+        .msg_iov = &iov,
+        .msg_iovlen = 1,
+    };
+    if (pass_fd >= 0) {
+      memset(control, 0, sizeof(control));
+      msg.msg_control = control;
+      msg.msg_controllen = sizeof(control);
+      struct cmsghdr* cmsg = CMSG_FIRSTHDR(&msg);
+      cmsg->cmsg_level = SOL_SOCKET;
+      cmsg->cmsg_type = SCM_RIGHTS;
+      cmsg->cmsg_len = CMSG_LEN(sizeof(int));
+      memcpy(CMSG_DATA(cmsg), &pass_fd, sizeof(int));
+    }
+    ssize_t n = sendmsg(fd, &msg, 0);
+    if (n < 0) {
+      if (errno == EINTR) continue;
+      fail("sendmsg");
+    }
+    buf += n;
+    len -= n;
+    pass_fd = -1;
+  }
+}
+
+// recv_msg receives a message of len bytes into buf and closes the FDs passed
+// with it. For stream sockets, it reads until len bytes have been received.
+// It returns 0 if the peer closed the connection before sending anything.
+static size_t recv_msg(int fd, int type, char* buf, size_t len,
+                       struct sockaddr_un* from, socklen_t* fromlen) {
+  char control[CMSG_SPACE(16 * sizeof(int))];
+  size_t got = 0;
+  do {
+    struct iovec iov = {.iov_base = buf + got, .iov_len = len - got};
+    struct msghdr msg = {
+        .msg_name = from,
+        .msg_namelen = fromlen ? *fromlen : 0,
+        .msg_iov = &iov,
+        .msg_iovlen = 1,
+        .msg_control = control,
+        .msg_controllen = sizeof(control),
+    };
+    ssize_t n = recvmsg(fd, &msg, MSG_CMSG_CLOEXEC);
+    if (n < 0) {
+      if (errno == EINTR) continue;
+      fail("recvmsg");
+    }
+    if (fromlen) *fromlen = msg.msg_namelen;
+    for (struct cmsghdr* cmsg = CMSG_FIRSTHDR(&msg); cmsg;
+         cmsg = CMSG_NXTHDR(&msg, cmsg)) {
+      if (cmsg->cmsg_level != SOL_SOCKET || cmsg->cmsg_type != SCM_RIGHTS) {
+        continue;
+      }
+      int nfds = (cmsg->cmsg_len - CMSG_LEN(0)) / sizeof(int);
+      for (int i = 0; i < nfds; i++) {
+        int passed;
+        memcpy(&passed, CMSG_DATA(cmsg) + i * sizeof(int), sizeof(int));
+        close(passed);
+      }
+    }
+    if (n == 0 && type != SOCK_DGRAM) {
+      return got;
+    }
+    got += n;
+    if (type != SOCK_STREAM) {
+      return got;
+    }
+  } while (got < len);
+  return got;
+}
+
+static void serve(int fd, int type) {
+  struct params p;
+  struct sockaddr_un peer;
+  socklen_t peerlen = sizeof(peer);
+  if (recv_msg(fd, type, (char*)&p, sizeof(p), &peer, &peerlen) !=
+      sizeof(p)) {
+    return;
+  }
+  if (type != SOCK_DGRAM) peerlen = 0;
+  char* buf = malloc(p.size ? p.size : 1);
+  if (!buf) fail("malloc");
+  for (uint64_t i = 0; i < p.count; i++) {
+    socklen_t len = sizeof(peer);
+    if (recv_msg(fd, type, buf, p.size, &peer, type == SOCK_DGRAM ? &len : NULL) !=
+        p.size) {
+      fprintf(stderr, "short message %lu\n", (unsigned long)i);
+      break;
+    }
+    if (p.latency) {
+      send_msg(fd, buf, p.size, -1, &peer, peerlen);
+    }
+  }
+  if (!p.latency) {
+    send_msg(fd, "", 1, -1, &peer, peerlen);
+  }
+  free(buf);
+}
+
+static void run_server(const char* addr, int type) {
+  int fd = bind_addr(type, addr);
+  if (type == SOCK_DGRAM) {
+    printf("listening\n");
+    fflush(stdout);
+    for (;;) serve(fd, type);
+  }
+  if (listen(fd, 16) < 0) fail("listen");
+  printf("listening\n");
+  fflush(stdout);
+  for (;;) {
+    int conn = accept(fd, NULL, NULL);
+    if (conn < 0) {
+      if (errno == EINTR) continue;
+      fail("accept");
+    }
+    serve(conn, type);
+    close(conn);
+  }
+}
+
+static uint64_t now_ns(void) {
+  struct timespec ts;
+  clock_gettime(CLOCK_MONOTONIC, &ts);
+  return (uint64_t)ts.tv_sec * 1000000000 + ts.tv_nsec;
+}
+
+static void run_client(const char* addr, int type, struct params* p) {
+  int fd;
+  char local[sizeof(((struct sockaddr_un*)0)->sun_path)];
+  if (type == SOCK_DGRAM) {
+    // Datagram clients need an address for the server to reply to.
+    snprintf(local, sizeof(local), "%s.%d", addr, getpid());
+    fd = bind_addr(type, local);
+  } else {
+    fd = socket(AF_UNIX, type, 0);
+    if (fd < 0) fail("socket");
+  }
+  struct sockaddr_un server;
+  socklen_t serverlen = make_addr(addr, &server);
+  if (connect(fd, (struct sockaddr*)&server, serverlen) < 0) fail("connect");
+
+  int pass_fd = -1;
+  if (p->fds) {
+    pass_fd = open("/dev/null", O_RDONLY);
+    if (pass_fd < 0) fail("open");
+  }
+  char* buf = malloc(p->size ? p->size : 1);
+  if (!buf) fail("malloc");
+  memset(buf, 'x', p->size);
+
+  uint64_t start = now_ns();
+  send_msg(fd, (char*)p, sizeof(*p), -1, NULL, 0);
+  for (uint64_t i = 0; i < p->count; i++) {
+    send_msg(fd, buf, p->size, pass_fd, NULL, 0);
+    if (p->latency && recv_msg(fd, type, buf, p->size, NULL, NULL) != p->size) {
+      fprintf(stderr, "short reply %lu\n", (unsigned long)i);
+      exit(1);
+    }
+  }
+  if (!p->latency && recv_msg(fd, type, buf, 1, NULL, NULL) != 1) {
+    fprintf(stderr, "missing acknowledgement\n");
+    exit(1);
+  }
+  uint64_t elapsed = now_ns() - start;
+
+  printf("messages: %lu\n", (unsigned long)p->count);
+  printf("bytes: %lu\n", (unsigned long)(p->count * p->size));
+  printf("elapsed_ns: %lu\n", (unsigned long)elapsed);
+  if (type == SOCK_DGRAM && local[0] != '@') unlink(local);
+  free(buf);
+}
+
+static void usage(const char* argv0) {
+  fprintf(stderr,
+          "usage: %s server|client --addr=ADDR [--type=stream|dgram|seqpacket]"
+          " [--size=BYTES] [--count=N] [--latency] [--fds]\n",
+          argv0);
+  exit(1);
+}
+
+int main(int argc, char** argv) {
+  const char* addr = NULL;
+  int type = SOCK_STREAM;
+  struct params p = {.size = 64, .count = 1000};
+  static struct option options[] = {
+      {"addr", required_argument, NULL, 'a'},
+      {"type", required_argument, NULL, 't'},
+      {"size", required_argument, NULL, 's'},
+      {"count", required_argument, NULL, 'n'},
+      {"latency", no_argument, NULL, 'l'},
+      {"fds", no_argument, NULL, 'f'},
+      {NULL, 0, NULL, 0},
+  };
+  int c;
+  while ((c = getopt_long(argc, argv, "", options, NULL)) != -1) {
+    switch (c) {
+      case 'a':
+        addr = optarg;
+        break;
+      case 't':
+        type = parse_type(optarg);
+        break;
+      case 's':
+        p.size = strtoull(optarg, NULL, 10);
+        break;
+      case 'n':
+        p.count = strtoull(optarg, NULL, 10);
+        break;
+      case 'l':
+        p.latency = 1;
+        break;
+      case 'f':
+        p.fds = 1;
+        break;
+      default:
+        usage(argv[0]);
+    }
+  }
+  if (optind != argc - 1 || addr == NULL || p.size == 0) usage(argv[0]);
+
+  if (strcmp(argv[optind], "server") == 0) {
+    run_server(addr, type);
+  } else if (strcmp(argv[optind], "client") == 0) {
+    run_client(addr, type, &p);
+  } else {
+    usage(argv[0]);
+  }
+  return 0;
+}
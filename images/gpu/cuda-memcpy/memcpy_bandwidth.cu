@@ -0,0 +1,150 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// memcpy_bandwidth times synchronous cudaMemcpy calls between host and device
+// memory.
+//
+// Usage: memcpy_bandwidth <h2d|d2h> <pinned|pageable> <bytes> <iterations>
+//
+// Pinned host memory is allocated with cudaMallocHost, pageable host memory
+// with malloc. Results are printed as "name: value" lines.
+
+#include <cuda_runtime.h>
+
+#include <algorithm>
+#include <chrono>
+#include <cstdio>
+#include <cstdlib>
+#include <cstring>
+#include <iostream>
+#include <string>
+#include <vector>
+
+#define CHECK_CUDA(expr)                                                     \
+  do {                                                                       \
+    cudaError_t code = (expr);                                               \
+    if (code != cudaSuccess) {                                               \
+      std::cout << "Check failed at " << __FILE__ << ":" << __LINE__ << ": " \
+                << #expr << ": " << cudaGetErrorString(code) << std::endl;   \
+      abort();                                                               \
+    }                                                                        \
+  } while (0)
+
+namespace {
+
+// Copies done before timing starts, so that one-time costs (e.g. the first
+// use of a staging buffer) are not measured.
+constexpr int kWarmupIterations = 3;
+
+using Clock = std::chrono::steady_clock;
+
+double ElapsedMicros(Clock::time_point start, Clock::time_point end) {
+  return std::chrono::duration<double, std::micro>(end - start).count();
+}
+
+// Percentile returns the p'th percentile of sorted.
+double Percentile(const std::vector<double>& sorted, double p) {
+  size_t i = static_cast<size_t>(p * (sorted.size() - 1));
+  return sorted[i];
+}
+
+void Usage(const char* argv0) {
+  std::cerr << "Usage: " << argv0
+            << " <h2d|d2h> <pinned|pageable> <bytes> <iterations>"
+            << std::endl;
+  exit(2);
+}
+
+}  // namespace
+
+int main(int argc, char** argv) {
+  if (argc != 5) {
+    Usage(argv[0]);
+  }
+  const std::string direction = argv[1];
+  const std::string memory = argv[2];
+  const size_t size = strtoull(argv[3], nullptr, 10);
+  const int iterations = atoi(argv[4]);
+  if ((direction != "h2d" && direction != "d2h") ||
+      (memory != "pinned" && memory != "pageable") || size == 0 ||
+      iterations <= 0) {
+    Usage(argv[0]);
+  }
+  const bool pinned = memory == "pinned";
+
+  // Create the context up front so that it is not included in the allocation
+  // time below.
+  CHECK_CUDA(cudaFree(nullptr));
+
+  void* host;
+  auto alloc_start = Clock::now();
+  if (pinned) {
+    CHECK_CUDA(cudaMallocHost(&host, size));
+  } else {
+    host = malloc(size);
+    if (host == nullptr) {
+      std::cout << "malloc(" << size << ") failed" << std::endl;
+      return 1;
+    }
+  }
+  auto alloc_end = Clock::now();
+  // Fault in the host buffer so that page faults are not measured as part of
+  // the copies.
+  memset(host, 0xa5, size);
+
+  void* device;
+  CHECK_CUDA(cudaMalloc(&device, size));
+
+  auto copy = [&]() {
+    if (direction == "h2d") {
+      CHECK_CUDA(cudaMemcpy(device, host, size, cudaMemcpyHostToDevice));
+    } else {
+      CHECK_CUDA(cudaMemcpy(host, device, size, cudaMemcpyDeviceToHost));
+    }
+    // cudaMemcpy from pageable memory may return once the data is staged,
+    // before the DMA to the device completes.
+    CHECK_CUDA(cudaDeviceSynchronize());
+  };
+
+  for (int i = 0; i < kWarmupIterations; i++) {
+    copy();
+  }
+
+  std::vector<double> latencies;
+  latencies.reserve(iterations);
+  auto start = Clock::now();
+  for (int i = 0; i < iterations; i++) {
+    auto copy_start = Clock::now();
+    copy();
+    latencies.push_back(ElapsedMicros(copy_start, Clock::now()));
+  }
+  double total_us = ElapsedMicros(start, Clock::now());
+
+  std::sort(latencies.begin(), latencies.end());
+  printf("bandwidth_bytes_per_sec: %f\n",
+         static_cast<double>(size) * iterations / (total_us / 1e6));
+  printf("latency_median_us: %f\n", Percentile(latencies, 0.5));
+  printf("latency_p99_us: %f\n", Percentile(latencies, 0.99));
+  if (pinned) {
+    printf("host_alloc_us: %f\n", ElapsedMicros(alloc_start, alloc_end));
+  }
+
+  CHECK_CUDA(cudaFree(device));
+  if (pinned) {
+    CHECK_CUDA(cudaFreeHost(host));
+  } else {
+    free(host);
+  }
+  return 0;
+}
@@ -0,0 +1,156 @@
+# Copyright 2024 The gVisor Authors.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""Synthetic-data DistributedDataParallel training benchmark.
+
+Meant to be launched with torchrun, one process per GPU. Rank 0 prints a
+summary that test/benchmarks/tools/pytorch.go parses:
+
+  step_time_ms: <mean time per training step, in milliseconds>
+  samples_per_sec: <training samples processed per second, all ranks>
+  checkpoint_write_bytes_per_sec: <checkpoint write throughput>
+"""
+
+import argparse
+import os
+import tempfile
+import time
+
+import torch
+from torch import nn
+import torch.distributed as dist
+from torch.nn.parallel import DistributedDataParallel
+import torchvision
+
+
+def make_model(name):
+  """Returns the model to train and a function producing an input batch."""
+  if name == "resnet50":
+    model = torchvision.models.resnet50()
+
+    def batch(size, device):
+      x = torch.randn(size, 3, 224, 224, device=device)
+      y = torch.randint(0, 1000, (size,), device=device)
+      return x, y
+
+    return model, batch
+  if name == "transformer":
+    vocab, seq_len, dim = 32000, 256, 512
+    layer = nn.TransformerEncoderLayer(
+        d_model=dim, nhead=8, dim_feedforward=4 * dim, batch_first=True)
+    model = nn.Sequential(
+        nn.Embedding(vocab, dim),
+        nn.TransformerEncoder(layer, num_layers=6),
+        nn.Flatten(0, 1),
+        nn.Linear(dim, vocab),
+    )
+
+    def batch(size, device):
+      x = torch.randint(0, vocab, (size, seq_len), device=device)
+      y = torch.randint(0, vocab, (size * seq_len,), device=device)
+      return x, y
+
+    return model, batch
+  raise ValueError("unknown model %r" % name)
+
+
+def write_checkpoint(model, optimizer, directory):
+  """Saves a checkpoint and returns the number of bytes written."""
+  path = os.path.join(directory, "checkpoint.pt")
+  with open(path, "wb") as f:
+    torch.save({
+        "model": model.state_dict(),
+        "optimizer": optimizer.state_dict(),
+    }, f)
+    f.flush()
+    os.fsync(f.fileno())
+  return os.path.getsize(path)
+
+
+def sync(device):
+  if device.type == "cuda":
+    torch.cuda.synchronize(device)
+
+
+def main():
+  parser = argparse.ArgumentParser()
+  parser.add_argument("--model", default="resnet50")
+  parser.add_argument("--batch-size", type=int, default=32)
+  parser.add_argument("--steps", type=int, default=100)
+  parser.add_argument("--warmup-steps", type=int, default=10)
+  parser.add_argument("--checkpoint-every", type=int, default=0)
+  parser.add_argument("--checkpoint-dir", default="")
+  args = parser.parse_args()
+
+  if torch.cuda.is_available():
+    local_rank = int(os.environ.get("LOCAL_RANK", "0"))
+    device = torch.device("cuda", local_rank)
+    torch.cuda.set_device(device)
+    dist.init_process_group("nccl")
+  else:
+    device = torch.device("cpu")
+    dist.init_process_group("gloo")
+  rank = dist.get_rank()
+  world_size = dist.get_world_size()
+
+  model, make_batch = make_model(args.model)
+  model = model.to(device)
+  ddp = DistributedDataParallel(
+      model, device_ids=[device.index] if device.type == "cuda" else None)
+  optimizer = torch.optim.SGD(ddp.parameters(), lr=0.01, momentum=0.9)
+  loss_fn = nn.CrossEntropyLoss()
+  x, y = make_batch(args.batch_size, device)
+
+  def step():
+    optimizer.zero_grad(set_to_none=True)
+    loss = loss_fn(ddp(x), y)
+    loss.backward()
+    optimizer.step()
+
+  for _ in range(args.warmup_steps):
+    step()
+  sync(device)
+  dist.barrier()
+
+  checkpoint_dir = args.checkpoint_dir or tempfile.mkdtemp()
+  train_time = 0.0
+  checkpoint_time = 0.0
+  checkpoint_bytes = 0
+  for i in range(args.steps):
+    start = time.perf_counter()
+    step()
+    sync(device)
+    train_time += time.perf_counter() - start
+
+    if args.checkpoint_every and (i + 1) % args.checkpoint_every == 0:
+      # Only rank 0 writes, like most training loops do; the others wait for
+      # it so the write is not hidden behind their compute.
+      start = time.perf_counter()
+      if rank == 0:
+        checkpoint_bytes += write_checkpoint(model, optimizer, checkpoint_dir)
+      dist.barrier()
+      checkpoint_time += time.perf_counter() - start
+
+  if rank == 0:
+    print("step_time_ms: %f" % (train_time / args.steps * 1000))
+    print("samples_per_sec: %f" %
+          (args.batch_size * world_size * args.steps / train_time))
+    if checkpoint_time > 0:
+      print("checkpoint_write_bytes_per_sec: %f" %
+            (checkpoint_bytes / checkpoint_time))
+  dist.destroy_process_group()
+
+
+if __name__ == "__main__":
+  main()
@@ -65,6 +65,12 @@ const (
 	PTMX_MINOR = 2
 )
 
+// from Linux include/uapi/drm/drm.h
+const (
+	// DRM_MAJOR is the major device number for DRM devices.
+	DRM_MAJOR = 226
+)
+
 // from Linux include/drm/drm_accel.h
 const (
 	// ACCEL_MAJOR is the major device number for compute accelerator devices.
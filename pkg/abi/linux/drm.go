@@ -0,0 +1,261 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// DRM ioctl type and the first driver-specific ioctl number, from
+// include/uapi/drm/drm.h.
+const (
+	DRM_IOCTL_BASE   = 'd'
+	DRM_COMMAND_BASE = 0x40
+)
+
+// Minor device numbers of DRM render nodes, from drivers/gpu/drm/drm_drv.c.
+const (
+	DRM_RENDER_MINOR_BASE = 128
+	DRM_RENDER_MINOR_MAX  = 255
+)
+
+// DRM core ioctl numbers, from include/uapi/drm/drm.h. DRM ioctls are
+// identified by number rather than by command: the kernel accepts arguments
+// that are smaller or larger than its own definition of the argument struct,
+// so the size encoded in the command varies across uapi versions.
+const (
+	DRM_IOCTL_NR_VERSION        = 0x00
+	DRM_IOCTL_NR_GEM_CLOSE      = 0x09
+	DRM_IOCTL_NR_GET_CAP        = 0x0c
+	DRM_IOCTL_NR_SET_CLIENT_CAP = 0x0d
+)
+
+// virtio-gpu driver ioctl numbers, from include/uapi/drm/virtgpu_drm.h.
+const (
+	DRM_IOCTL_NR_VIRTGPU_MAP                  = DRM_COMMAND_BASE + 0x01
+	DRM_IOCTL_NR_VIRTGPU_EXECBUF              = DRM_COMMAND_BASE + 0x02
+	DRM_IOCTL_NR_VIRTGPU_GETPARAM             = DRM_COMMAND_BASE + 0x03
+	DRM_IOCTL_NR_VIRTGPU_RESOURCE_CREATE      = DRM_COMMAND_BASE + 0x04
+	DRM_IOCTL_NR_VIRTGPU_RESOURCE_INFO        = DRM_COMMAND_BASE + 0x05
+	DRM_IOCTL_NR_VIRTGPU_TRANSFER_FROM_HOST   = DRM_COMMAND_BASE + 0x06
+	DRM_IOCTL_NR_VIRTGPU_TRANSFER_TO_HOST     = DRM_COMMAND_BASE + 0x07
+	DRM_IOCTL_NR_VIRTGPU_WAIT                 = DRM_COMMAND_BASE + 0x08
+	DRM_IOCTL_NR_VIRTGPU_GET_CAPS             = DRM_COMMAND_BASE + 0x09
+	DRM_IOCTL_NR_VIRTGPU_RESOURCE_CREATE_BLOB = DRM_COMMAND_BASE + 0x0a
+	DRM_IOCTL_NR_VIRTGPU_CONTEXT_INIT         = DRM_COMMAND_BASE + 0x0b
+)
+
+// VirtGPUDriverName is the name of the virtio-gpu DRM driver, as returned by
+// DRM_IOCTL_VERSION.
+const VirtGPUDriverName = "virtio_gpu"
+
+// Flags for DRMVirtGPUExecbuffer.Flags, from include/uapi/drm/virtgpu_drm.h.
+const (
+	VIRTGPU_EXECBUF_FENCE_FD_IN  = 0x01
+	VIRTGPU_EXECBUF_FENCE_FD_OUT = 0x02
+	VIRTGPU_EXECBUF_RING_IDX     = 0x04
+)
+
+// DRMVersion is struct drm_version, from include/uapi/drm/drm.h.
+//
+// +marshal
+type DRMVersion struct {
+	VersionMajor      int32
+	VersionMinor      int32
+	VersionPatchlevel int32
+	_                 uint32
+	NameLen           uint64
+	Name              uint64
+	DateLen           uint64
+	Date              uint64
+	DescLen           uint64
+	Desc              uint64
+}
+
+// DRMGemClose is struct drm_gem_close, from include/uapi/drm/drm.h.
+//
+// +marshal
+type DRMGemClose struct {
+	Handle uint32
+	_      uint32
+}
+
+// DRMGetCap is struct drm_get_cap, from include/uapi/drm/drm.h.
+//
+// +marshal
+type DRMGetCap struct {
+	Capability uint64
+	Value      uint64
+}
+
+// DRMSetClientCap is struct drm_set_client_cap, from
+// include/uapi/drm/drm.h.
+//
+// +marshal
+type DRMSetClientCap struct {
+	Capability uint64
+	Value      uint64
+}
+
+// DRMVirtGPUMap is struct drm_virtgpu_map, from
+// include/uapi/drm/virtgpu_drm.h.
+//
+// +marshal
+type DRMVirtGPUMap struct {
+	Offset uint64
+	Handle uint32
+	_      uint32
+}
+
+// DRMVirtGPUExecbuffer is struct drm_virtgpu_execbuffer, from
+// include/uapi/drm/virtgpu_drm.h.
+//
+// +marshal
+type DRMVirtGPUExecbuffer struct {
+	Flags          uint32
+	Size           uint32
+	Command        uint64
+	BoHandles      uint64
+	NumBoHandles   uint32
+	FenceFD        int32
+	RingIdx        uint32
+	SyncobjStride  uint32
+	NumInSyncobjs  uint32
+	NumOutSyncobjs uint32
+	InSyncobjs     uint64
+	OutSyncobjs    uint64
+}
+
+// DRMVirtGPUGetparam is struct drm_virtgpu_getparam, from
+// include/uapi/drm/virtgpu_drm.h. Value is a pointer to an int.
+//
+// +marshal
+type DRMVirtGPUGetparam struct {
+	Param uint64
+	Value uint64
+}
+
+// DRMVirtGPUResourceCreate is struct drm_virtgpu_resource_create, from
+// include/uapi/drm/virtgpu_drm.h.
+//
+// +marshal
+type DRMVirtGPUResourceCreate struct {
+	Target    uint32
+	Format    uint32
+	Bind      uint32
+	Width     uint32
+	Height    uint32
+	Depth     uint32
+	ArraySize uint32
+	LastLevel uint32
+	NrSamples uint32
+	Flags     uint32
+	BoHandle  uint32
+	ResHandle uint32
+	Size      uint32
+	Stride    uint32
+}
+
+// DRMVirtGPUResourceInfo is struct drm_virtgpu_resource_info, from
+// include/uapi/drm/virtgpu_drm.h.
+//
+// +marshal
+type DRMVirtGPUResourceInfo struct {
+	BoHandle  uint32
+	ResHandle uint32
+	Size      uint32
+	BlobMem   uint32
+}
+
+// DRMVirtGPU3DBox is struct drm_virtgpu_3d_box, from
+// include/uapi/drm/virtgpu_drm.h.
+//
+// +marshal
+type DRMVirtGPU3DBox struct {
+	X uint32
+	Y uint32
+	Z uint32
+	W uint32
+	H uint32
+	D uint32
+}
+
+// DRMVirtGPU3DTransfer is struct drm_virtgpu_3d_transfer_to_host and struct
+// drm_virtgpu_3d_transfer_from_host, from include/uapi/drm/virtgpu_drm.h.
+//
+// +marshal
+type DRMVirtGPU3DTransfer struct {
+	BoHandle    uint32
+	Box         DRMVirtGPU3DBox
+	Level       uint32
+	Offset      uint32
+	Stride      uint32
+	LayerStride uint32
+}
+
+// DRMVirtGPU3DWait is struct drm_virtgpu_3d_wait, from
+// include/uapi/drm/virtgpu_drm.h.
+//
+// +marshal
+type DRMVirtGPU3DWait struct {
+	Handle uint32
+	Flags  uint32
+}
+
+// DRMVirtGPUGetCaps is struct drm_virtgpu_get_caps, from
+// include/uapi/drm/virtgpu_drm.h. Addr is a pointer to a buffer of Size
+// bytes.
+//
+// +marshal
+type DRMVirtGPUGetCaps struct {
+	CapSetID  uint32
+	CapSetVer uint32
+	Addr      uint64
+	Size      uint32
+	_         uint32
+}
+
+// DRMVirtGPUResourceCreateBlob is struct drm_virtgpu_resource_create_blob,
+// from include/uapi/drm/virtgpu_drm.h. Cmd is a pointer to a buffer of
+// CmdSize bytes.
+//
+// +marshal
+type DRMVirtGPUResourceCreateBlob struct {
+	BlobMem   uint32
+	BlobFlags uint32
+	BoHandle  uint32
+	ResHandle uint32
+	Size      uint64
+	_         uint32
+	CmdSize   uint32
+	Cmd       uint64
+	BlobID    uint64
+}
+
+// DRMVirtGPUContextInit is struct drm_virtgpu_context_init, from
+// include/uapi/drm/virtgpu_drm.h. CtxSetParams is a pointer to NumParams
+// DRMVirtGPUContextSetParam.
+//
+// +marshal
+type DRMVirtGPUContextInit struct {
+	NumParams    uint32
+	_            uint32
+	CtxSetParams uint64
+}
+
+// DRMVirtGPUContextSetParam is struct drm_virtgpu_context_set_param, from
+// include/uapi/drm/virtgpu_drm.h.
+//
+// +marshal
+type DRMVirtGPUContextSetParam struct {
+	Param uint64
+	Value uint64
+}
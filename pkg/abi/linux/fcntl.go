@@ -36,6 +36,18 @@ const (
 	F_DUPFD_CLOEXEC = 1024 + 6
 	F_SETPIPE_SZ    = 1024 + 7
 	F_GETPIPE_SZ    = 1024 + 8
+	F_GET_RW_HINT   = 1024 + 11
+	F_SET_RW_HINT   = 1024 + 12
+)
+
+// Write life time hints for F_{GET,SET}_RW_HINT.
+const (
+	RWH_WRITE_LIFE_NOT_SET = 0
+	RWH_WRITE_LIFE_NONE    = 1
+	RWH_WRITE_LIFE_SHORT   = 2
+	RWH_WRITE_LIFE_MEDIUM  = 3
+	RWH_WRITE_LIFE_LONG    = 4
+	RWH_WRITE_LIFE_EXTREME = 5
 )
 
 // Commands for F_SETLK.
@@ -278,6 +278,7 @@ const (
 	STATX_ATTR_NODUMP     = 0x00000040
 	STATX_ATTR_ENCRYPTED  = 0x00000800
 	STATX_ATTR_AUTOMOUNT  = 0x00001000
+	STATX_ATTR_VERITY     = 0x00100000
 )
 
 // Statx represents struct statx.
@@ -0,0 +1,107 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// fs-verity ioctls, from include/uapi/linux/fsverity.h.
+const (
+	FS_IOC_ENABLE_VERITY        = 0x40806685 // _IOW('f', 133, struct fsverity_enable_arg)
+	FS_IOC_MEASURE_VERITY       = 0xc0046686 // _IOWR('f', 134, struct fsverity_digest)
+	FS_IOC_READ_VERITY_METADATA = 0xc0286687 // _IOWR('f', 135, struct fsverity_read_metadata_arg)
+)
+
+// fs-verity hash algorithms, from include/uapi/linux/fsverity.h.
+const (
+	FS_VERITY_HASH_ALG_SHA256 = 1
+	FS_VERITY_HASH_ALG_SHA512 = 2
+)
+
+// Metadata types for FS_IOC_READ_VERITY_METADATA, from
+// include/uapi/linux/fsverity.h.
+const (
+	FS_VERITY_METADATA_TYPE_MERKLE_TREE = 1
+	FS_VERITY_METADATA_TYPE_DESCRIPTOR  = 2
+	FS_VERITY_METADATA_TYPE_SIGNATURE   = 3
+)
+
+// FS_VERITY_FL is the inode flag of files with fs-verity enabled, from
+// include/uapi/linux/fs.h.
+const FS_VERITY_FL = 0x00100000
+
+// Limits of fs-verity, from fs/verity/fsverity_private.h and
+// fs/verity/enable.c.
+const (
+	// FS_VERITY_MAX_DIGEST_SIZE is the size of the largest digest of any
+	// supported hash algorithm.
+	FS_VERITY_MAX_DIGEST_SIZE = 64
+
+	// FS_VERITY_MAX_SIGNATURE_SIZE is the size of the largest builtin
+	// signature.
+	FS_VERITY_MAX_SIGNATURE_SIZE = 16128
+)
+
+// FSVerityEnableArg is struct fsverity_enable_arg, from
+// include/uapi/linux/fsverity.h.
+//
+// +marshal
+type FSVerityEnableArg struct {
+	Version       uint32
+	HashAlgorithm uint32
+	BlockSize     uint32
+	SaltSize      uint32
+	SaltPtr       uint64
+	SigSize       uint32
+	Reserved1     uint32
+	SigPtr        uint64
+	Reserved2     [11]uint64
+}
+
+// FSVerityDigest is the fixed-size header of struct fsverity_digest, from
+// include/uapi/linux/fsverity.h. It is followed by DigestSize bytes of
+// digest.
+//
+// +marshal
+type FSVerityDigest struct {
+	DigestAlgorithm uint16
+	DigestSize      uint16
+}
+
+// FSVerityReadMetadataArg is struct fsverity_read_metadata_arg, from
+// include/uapi/linux/fsverity.h.
+//
+// +marshal
+type FSVerityReadMetadataArg struct {
+	MetadataType uint64
+	Offset       uint64
+	Length       uint64
+	BufPtr       uint64
+	_            uint64
+}
+
+// FSVerityDescriptor is struct fsverity_descriptor, from
+// include/linux/fsverity.h. The digest of a file is the digest of its
+// descriptor, with SigSize set to zero.
+//
+// +marshal
+type FSVerityDescriptor struct {
+	Version       uint8
+	HashAlgorithm uint8
+	LogBlockSize  uint8
+	SaltSize      uint8
+	SigSize       uint32 // little endian
+	DataSize      uint64 // little endian
+	RootHash      [64]byte
+	Salt          [32]byte
+	_             [144]byte
+}
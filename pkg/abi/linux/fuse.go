@@ -160,8 +160,20 @@ const (
 	FUSE_WRITEBACK_CACHE  = 1 << 16
 	FUSE_NO_OPEN_SUPPORT  = 1 << 17
 	FUSE_MAX_PAGES        = 1 << 22 // From FUSE 7.28
+	FUSE_INIT_EXT         = 1 << 30 // From FUSE 7.36
 )
 
+// FUSE_INIT flags that only fit in FUSEInitIn.Flags2 and FUSEInitOut.Flags2,
+// which are the upper 32 bits of the flags. Both sides must set FUSE_INIT_EXT
+// for Flags2 to be valid.
+const (
+	FUSE_PASSTHROUGH = 1 << (37 - 32) // From FUSE 7.40
+)
+
+// FUSE_PASSTHROUGH_MAX_STACK_DEPTH is the maximum FUSEInitOut.MaxStackDepth,
+// equivalent to FILESYSTEM_MAX_STACK_DEPTH in Linux.
+const FUSE_PASSTHROUGH_MAX_STACK_DEPTH = 2
+
 // currently supported FUSE protocol version numbers.
 const (
 	FUSE_KERNEL_VERSION       = 7
@@ -192,6 +204,12 @@ type FUSEInitIn struct {
 
 	// Flags of this init request.
 	Flags uint32
+
+	// Flags2 holds the upper 32 bits of the flags of this init request. It
+	// is only valid if Flags includes FUSE_INIT_EXT.
+	Flags2 uint32
+
+	_ [11]uint32
 }
 
 // FUSEInitOut is the reply sent by the daemon to the kernel
@@ -238,7 +256,15 @@ type FUSEInitOut struct {
 
 	_ uint16
 
-	_ [8]uint32
+	// Flags2 holds the upper 32 bits of the flags of this init reply. It is
+	// only valid if Flags includes FUSE_INIT_EXT.
+	Flags2 uint32
+
+	// MaxStackDepth is the maximum stacking depth of backing files used for
+	// FUSE_PASSTHROUGH.
+	MaxStackDepth uint32
+
+	_ [6]uint32
 }
 
 // FUSEStatfsOut is the reply sent by the daemon to the kernel
@@ -473,6 +499,9 @@ const (
 	FOPEN_KEEP_CACHE = 1 << 1
 	// FOPEN_NONSEEKABLE indicates the file cannot be seeked.
 	FOPEN_NONSEEKABLE = 1 << 2
+	// FOPEN_PASSTHROUGH indicates that reads and writes (and mmap) go
+	// directly to the backing file given by FUSEOpenOut.BackingID.
+	FOPEN_PASSTHROUGH = 1 << 7
 )
 
 // FUSEOpenIn is the request sent by the kernel to the daemon,
@@ -497,9 +526,33 @@ type FUSEOpenOut struct {
 	// OpenFlag for the opened files.
 	OpenFlag uint32
 
-	_ uint32
+	// BackingID is the ID of the backing file, registered with
+	// FUSE_DEV_IOC_BACKING_OPEN, if OpenFlag includes FOPEN_PASSTHROUGH.
+	BackingID int32
 }
 
+// FUSEBackingMap is the argument of FUSE_DEV_IOC_BACKING_OPEN.
+//
+// +marshal
+type FUSEBackingMap struct {
+	// FD is the file descriptor of the backing file.
+	FD int32
+
+	// Flags must be zero.
+	Flags uint32
+
+	_ uint64
+}
+
+// FUSE_DEV_IOC_MAGIC is the ioctl type of /dev/fuse ioctls.
+const FUSE_DEV_IOC_MAGIC = 229
+
+// Ioctls on /dev/fuse, from include/uapi/linux/fuse.h.
+var (
+	FUSE_DEV_IOC_BACKING_OPEN  = IOW(FUSE_DEV_IOC_MAGIC, 1, 16) // struct fuse_backing_map
+	FUSE_DEV_IOC_BACKING_CLOSE = IOW(FUSE_DEV_IOC_MAGIC, 2, 4)  // uint32_t
+)
+
 // FUSECreateOut is the reply sent by the daemon to the kernel
 // for FUSECreateMeta.
 //
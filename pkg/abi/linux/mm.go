@@ -83,6 +83,7 @@ const (
 	MADV_NOHUGEPAGE   = 15
 	MADV_DONTDUMP     = 16
 	MADV_DODUMP       = 17
+	MADV_COLLAPSE     = 25
 	MADV_HWPOISON     = 100
 	MADV_SOFT_OFFLINE = 101
 	MADV_NOMAJFAULT   = 200
@@ -96,6 +97,13 @@ const (
 	MS_SYNC       = 1 << 2
 )
 
+// Values for /proc/sys/vm/overcommit_memory.
+const (
+	OVERCOMMIT_GUESS  = 0
+	OVERCOMMIT_ALWAYS = 1
+	OVERCOMMIT_NEVER  = 2
+)
+
 // NumaPolicy is the NUMA memory policy for a memory range. See numa(7).
 //
 // +marshal
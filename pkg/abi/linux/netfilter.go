@@ -424,6 +424,24 @@ type XTNATTargetV2 struct {
 // SizeOfXTNATTargetV2 is the size of an XTNATTargetV2.
 const SizeOfXTNATTargetV2 = SizeOfXTEntryTarget + SizeOfNFNATRange2
 
+// XTTProxyTargetV1 diverts packets to a local transparent socket. It
+// corresponds to struct xt_tproxy_target_info_v1 in
+// include/uapi/linux/netfilter/xt_TPROXY.h.
+// Adding 6 bytes of padding to make the struct 8 byte aligned.
+//
+// +marshal
+type XTTProxyTargetV1 struct {
+	Target    XTEntryTarget
+	MarkMask  uint32
+	MarkValue uint32
+	LAddr     Inet6Addr
+	LPort     uint16 // Network byte order.
+	_         [6]byte
+}
+
+// SizeOfXTTProxyTargetV1 is the size of an XTTProxyTargetV1.
+const SizeOfXTTProxyTargetV1 = 64
+
 // IPTGetinfo is the argument for the IPT_SO_GET_INFO sockopt. It corresponds
 // to struct ipt_getinfo in include/uapi/linux/netfilter_ipv4/ip_tables.h.
 //
@@ -0,0 +1,149 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Connector callback indices and values, from uapi/linux/connector.h.
+const (
+	CN_IDX_PROC = 0x1
+	CN_VAL_PROC = 0x1
+)
+
+// CbID is struct cb_id, from uapi/linux/connector.h.
+//
+// +marshal
+type CbID struct {
+	Idx uint32
+	Val uint32
+}
+
+// CnMsg is struct cn_msg, from uapi/linux/connector.h. It is followed by Len
+// bytes of data.
+//
+// +marshal
+type CnMsg struct {
+	ID    CbID
+	Seq   uint32
+	Ack   uint32
+	Len   uint16
+	Flags uint16
+}
+
+// CnMsgSize is the size of CnMsg.
+const CnMsgSize = 20
+
+// Proc connector multicast operations, from enum proc_cn_mcast_op in
+// uapi/linux/cn_proc.h.
+const (
+	PROC_CN_MCAST_LISTEN = 1
+	PROC_CN_MCAST_IGNORE = 2
+)
+
+// Proc connector event types, from enum proc_cn_event in
+// uapi/linux/cn_proc.h.
+const (
+	PROC_EVENT_NONE     = 0x00000000
+	PROC_EVENT_FORK     = 0x00000001
+	PROC_EVENT_EXEC     = 0x00000002
+	PROC_EVENT_UID      = 0x00000004
+	PROC_EVENT_GID      = 0x00000040
+	PROC_EVENT_SID      = 0x00000080
+	PROC_EVENT_PTRACE   = 0x00000100
+	PROC_EVENT_COMM     = 0x00000200
+	PROC_EVENT_COREDUMP = 0x40000000
+	PROC_EVENT_EXIT     = 0x80000000
+)
+
+// ProcEvent is struct proc_event, from uapi/linux/cn_proc.h.
+//
+// EventData holds the union event_data, which is one of the ProcEvent*Data
+// types below depending on What.
+//
+// +marshal
+type ProcEvent struct {
+	What        uint32
+	CPU         uint32
+	TimestampNS uint64
+	EventData   [24]byte
+}
+
+// ProcEventSize is the size of ProcEvent.
+const ProcEventSize = 40
+
+// ProcEventAckData is struct proc_event.event_data.ack, from
+// uapi/linux/cn_proc.h.
+//
+// +marshal
+type ProcEventAckData struct {
+	Err uint32
+}
+
+// ProcEventForkData is struct fork_proc_event, from uapi/linux/cn_proc.h.
+//
+// +marshal
+type ProcEventForkData struct {
+	ParentPID  int32
+	ParentTGID int32
+	ChildPID   int32
+	ChildTGID  int32
+}
+
+// ProcEventExecData is struct exec_proc_event, from uapi/linux/cn_proc.h.
+//
+// +marshal
+type ProcEventExecData struct {
+	ProcessPID  int32
+	ProcessTGID int32
+}
+
+// ProcEventIDData is struct id_proc_event, from uapi/linux/cn_proc.h. R and E
+// are the real and effective UIDs for PROC_EVENT_UID, and the real and
+// effective GIDs for PROC_EVENT_GID.
+//
+// +marshal
+type ProcEventIDData struct {
+	ProcessPID  int32
+	ProcessTGID int32
+	R           uint32
+	E           uint32
+}
+
+// ProcEventSIDData is struct sid_proc_event, from uapi/linux/cn_proc.h.
+//
+// +marshal
+type ProcEventSIDData struct {
+	ProcessPID  int32
+	ProcessTGID int32
+}
+
+// ProcEventCommData is struct comm_proc_event, from uapi/linux/cn_proc.h.
+//
+// +marshal
+type ProcEventCommData struct {
+	ProcessPID  int32
+	ProcessTGID int32
+	Comm        [16]byte
+}
+
+// ProcEventExitData is struct exit_proc_event, from uapi/linux/cn_proc.h.
+//
+// +marshal
+type ProcEventExitData struct {
+	ProcessPID  int32
+	ProcessTGID int32
+	ExitCode    uint32
+	ExitSignal  uint32
+	ParentPID   int32
+	ParentTGID  int32
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Netlink message types for NETLINK_SOCK_DIAG sockets, from
+// uapi/linux/sock_diag.h and uapi/linux/inet_diag.h.
+const (
+	TCPDIAG_GETSOCK     = 18
+	DCCPDIAG_GETSOCK    = 19
+	SOCK_DIAG_BY_FAMILY = 20
+	SOCK_DESTROY        = 21
+)
+
+// INET_DIAG_NOCOOKIE is the cookie of requests that do not match on the
+// socket cookie, from uapi/linux/inet_diag.h.
+const INET_DIAG_NOCOOKIE = ^uint32(0)
+
+// Attribute types of inet_diag messages, from uapi/linux/inet_diag.h.
+const (
+	INET_DIAG_NONE      = 0
+	INET_DIAG_MEMINFO   = 1
+	INET_DIAG_INFO      = 2
+	INET_DIAG_VEGASINFO = 3
+	INET_DIAG_CONG      = 4
+	INET_DIAG_TOS       = 5
+	INET_DIAG_TCLASS    = 6
+	INET_DIAG_SKMEMINFO = 7
+	INET_DIAG_SHUTDOWN  = 8
+)
+
+// SockDiagReq is struct sock_diag_req, from uapi/linux/sock_diag.h. It is the
+// common prefix of all SOCK_DIAG_BY_FAMILY requests.
+//
+// +marshal
+type SockDiagReq struct {
+	Family   uint8
+	Protocol uint8
+}
+
+// InetDiagSockID is struct inet_diag_sockid, from uapi/linux/inet_diag.h.
+//
+// Ports and addresses are in network byte order. IPv4 addresses are stored in
+// the first 4 bytes of Src and Dst.
+//
+// +marshal
+type InetDiagSockID struct {
+	SPort  uint16
+	DPort  uint16
+	Src    [16]byte
+	Dst    [16]byte
+	If     uint32
+	Cookie [2]uint32
+}
+
+// InetDiagReqV2 is struct inet_diag_req_v2, from uapi/linux/inet_diag.h.
+//
+// +marshal
+type InetDiagReqV2 struct {
+	Family   uint8
+	Protocol uint8
+	Ext      uint8
+	Pad      uint8
+	States   uint32
+	ID       InetDiagSockID
+}
+
+// InetDiagMsg is struct inet_diag_msg, from uapi/linux/inet_diag.h.
+//
+// +marshal
+type InetDiagMsg struct {
+	Family  uint8
+	State   uint8
+	Timer   uint8
+	Retrans uint8
+	ID      InetDiagSockID
+	Expires uint32
+	RQueue  uint32
+	WQueue  uint32
+	UID     uint32
+	Inode   uint32
+}
@@ -0,0 +1,285 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// TCMessage is struct tcmsg, from uapi/linux/rtnetlink.h. It is the header of
+// RTM_*QDISC, RTM_*TCLASS and RTM_*TFILTER messages.
+//
+// +marshal
+type TCMessage struct {
+	Family  uint8
+	_       uint8
+	_       uint16
+	Ifindex int32
+	Handle  uint32
+	Parent  uint32
+	// Info holds the priority and protocol of filters.
+	Info uint32
+}
+
+// TCMessageSize is the size of TCMessage.
+const TCMessageSize = 20
+
+// Traffic control attributes, from uapi/linux/rtnetlink.h.
+const (
+	TCA_UNSPEC  = 0
+	TCA_KIND    = 1
+	TCA_OPTIONS = 2
+	TCA_STATS   = 3
+	TCA_XSTATS  = 4
+	TCA_RATE    = 5
+	TCA_FCNT    = 6
+	TCA_STATS2  = 7
+	TCA_STAB    = 8
+	TCA_PAD     = 9
+	TCA_CHAIN   = 11
+)
+
+// Traffic control handles, from uapi/linux/pkt_sched.h.
+const (
+	TC_H_MAJ_MASK = 0xFFFF0000
+	TC_H_MIN_MASK = 0x0000FFFF
+	TC_H_UNSPEC   = 0
+	TC_H_ROOT     = 0xFFFFFFFF
+	TC_H_INGRESS  = 0xFFFFFFF1
+	TC_H_CLSACT   = TC_H_INGRESS
+
+	TC_H_MIN_INGRESS = 0xFFF2
+	TC_H_MIN_EGRESS  = 0xFFF3
+)
+
+// TC_H_MAJ returns the major number of a traffic control handle.
+func TC_H_MAJ(h uint32) uint32 {
+	return h & TC_H_MAJ_MASK
+}
+
+// TC_H_MIN returns the minor number of a traffic control handle.
+func TC_H_MIN(h uint32) uint32 {
+	return h & TC_H_MIN_MASK
+}
+
+// TC_H_MAKE returns the traffic control handle with the given major and minor
+// numbers.
+func TC_H_MAKE(maj, min uint32) uint32 {
+	return TC_H_MAJ(maj) | TC_H_MIN(min)
+}
+
+// Statistics attributes nested in TCA_STATS2, from uapi/linux/gen_stats.h.
+const (
+	TCA_STATS_UNSPEC     = 0
+	TCA_STATS_BASIC      = 1
+	TCA_STATS_RATE_EST   = 2
+	TCA_STATS_QUEUE      = 3
+	TCA_STATS_APP        = 4
+	TCA_STATS_RATE_EST64 = 5
+	TCA_STATS_PAD        = 6
+	TCA_STATS_BASIC_HW   = 7
+	TCA_STATS_PKT64      = 8
+)
+
+// GnetStatsBasic is struct gnet_stats_basic, from uapi/linux/gen_stats.h.
+//
+// +marshal
+type GnetStatsBasic struct {
+	Bytes   uint64
+	Packets uint32
+	_       uint32
+}
+
+// GnetStatsQueue is struct gnet_stats_queue, from uapi/linux/gen_stats.h.
+//
+// +marshal
+type GnetStatsQueue struct {
+	QLen       uint32
+	Backlog    uint32
+	Drops      uint32
+	Requeues   uint32
+	Overlimits uint32
+}
+
+// TCRateSpec is struct tc_ratespec, from uapi/linux/pkt_sched.h. Rate is in
+// bytes per second.
+//
+// +marshal
+type TCRateSpec struct {
+	CellLog   uint8
+	Linklayer uint8
+	Overhead  uint16
+	CellAlign int16
+	MPU       uint16
+	Rate      uint32
+}
+
+// TBF qdisc attributes, from uapi/linux/pkt_sched.h.
+const (
+	TCA_TBF_UNSPEC  = 0
+	TCA_TBF_PARMS   = 1
+	TCA_TBF_RTAB    = 2
+	TCA_TBF_PTAB    = 3
+	TCA_TBF_RATE64  = 4
+	TCA_TBF_PRATE64 = 5
+	TCA_TBF_BURST   = 6
+	TCA_TBF_PBURST  = 7
+	TCA_TBF_PAD     = 8
+)
+
+// TCTbfQopt is struct tc_tbf_qopt, from uapi/linux/pkt_sched.h. Buffer is in
+// scheduler ticks.
+//
+// +marshal
+type TCTbfQopt struct {
+	Rate     TCRateSpec
+	PeakRate TCRateSpec
+	Limit    uint32
+	Buffer   uint32
+	MTU      uint32
+}
+
+// HTB qdisc and class attributes, from uapi/linux/pkt_sched.h.
+const (
+	TCA_HTB_UNSPEC      = 0
+	TCA_HTB_PARMS       = 1
+	TCA_HTB_INIT        = 2
+	TCA_HTB_CTAB        = 3
+	TCA_HTB_RTAB        = 4
+	TCA_HTB_DIRECT_QLEN = 5
+	TCA_HTB_RATE64      = 6
+	TCA_HTB_CEIL64      = 7
+	TCA_HTB_PAD         = 8
+	TCA_HTB_OFFLOAD     = 9
+)
+
+// TC_HTB_PROTOVER is the HTB protocol version, from uapi/linux/pkt_sched.h.
+const TC_HTB_PROTOVER = 3
+
+// TCHtbOpt is struct tc_htb_opt, from uapi/linux/pkt_sched.h. Buffer and
+// Cbuffer are in scheduler ticks.
+//
+// +marshal
+type TCHtbOpt struct {
+	Rate    TCRateSpec
+	Ceil    TCRateSpec
+	Buffer  uint32
+	Cbuffer uint32
+	Quantum uint32
+	Level   uint32
+	Prio    uint32
+}
+
+// TCHtbGlob is struct tc_htb_glob, from uapi/linux/pkt_sched.h.
+//
+// +marshal
+type TCHtbGlob struct {
+	Version      uint32
+	Rate2Quantum uint32
+	Defcls       uint32
+	Debug        uint32
+	DirectPkts   uint32
+}
+
+// Matchall classifier attributes, from uapi/linux/pkt_cls.h.
+const (
+	TCA_MATCHALL_UNSPEC  = 0
+	TCA_MATCHALL_CLASSID = 1
+	TCA_MATCHALL_ACT     = 2
+	TCA_MATCHALL_FLAGS   = 3
+	TCA_MATCHALL_PCNT    = 4
+	TCA_MATCHALL_PAD     = 5
+)
+
+// Action attributes, from uapi/linux/pkt_cls.h.
+const (
+	TCA_ACT_UNSPEC  = 0
+	TCA_ACT_KIND    = 1
+	TCA_ACT_OPTIONS = 2
+	TCA_ACT_INDEX   = 3
+	TCA_ACT_STATS   = 4
+	TCA_ACT_PAD     = 5
+	TCA_ACT_COOKIE  = 6
+)
+
+// Action results, from uapi/linux/pkt_cls.h.
+const (
+	TC_ACT_UNSPEC     = -1
+	TC_ACT_OK         = 0
+	TC_ACT_RECLASSIFY = 1
+	TC_ACT_SHOT       = 2
+	TC_ACT_PIPE       = 3
+	TC_ACT_STOLEN     = 4
+)
+
+// Police action attributes, from uapi/linux/pkt_cls.h.
+const (
+	TCA_POLICE_UNSPEC     = 0
+	TCA_POLICE_TBF        = 1
+	TCA_POLICE_RATE       = 2
+	TCA_POLICE_PEAKRATE   = 3
+	TCA_POLICE_AVRATE     = 4
+	TCA_POLICE_RESULT     = 5
+	TCA_POLICE_TM         = 6
+	TCA_POLICE_PAD        = 7
+	TCA_POLICE_RATE64     = 8
+	TCA_POLICE_PEAKRATE64 = 9
+)
+
+// TCPolice is struct tc_police, from uapi/linux/pkt_cls.h. Action is the
+// result for packets that exceed the rate. Burst is in scheduler ticks.
+//
+// +marshal
+type TCPolice struct {
+	Index    uint32
+	Action   int32
+	Limit    uint32
+	Burst    uint32
+	MTU      uint32
+	Rate     TCRateSpec
+	PeakRate TCRateSpec
+	Refcnt   int32
+	Bindcnt  int32
+	Capab    uint32
+}
+
+// Mirred action attributes, from uapi/linux/tc_act/tc_mirred.h.
+const (
+	TCA_MIRRED_UNSPEC = 0
+	TCA_MIRRED_TM     = 1
+	TCA_MIRRED_PARMS  = 2
+	TCA_MIRRED_PAD    = 3
+)
+
+// Mirred actions, from uapi/linux/tc_act/tc_mirred.h.
+const (
+	TCA_EGRESS_REDIR   = 1
+	TCA_EGRESS_MIRROR  = 2
+	TCA_INGRESS_REDIR  = 3
+	TCA_INGRESS_MIRROR = 4
+)
+
+// TCMirred is struct tc_mirred, from uapi/linux/tc_act/tc_mirred.h.
+//
+// +marshal
+type TCMirred struct {
+	Index   uint32
+	Capab   uint32
+	Action  int32
+	Refcnt  int32
+	Bindcnt int32
+	Eaction int32
+	Ifindex uint32
+}
+
+// PSCHED_SHIFT is the log2 of the length of a packet scheduler tick in
+// nanoseconds, from include/net/pkt_sched.h.
+const PSCHED_SHIFT = 6
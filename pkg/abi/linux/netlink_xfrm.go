@@ -0,0 +1,237 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Netlink message types for NETLINK_XFRM sockets, from uapi/linux/xfrm.h.
+const (
+	XFRM_MSG_NEWSA       = 0x10
+	XFRM_MSG_DELSA       = 0x11
+	XFRM_MSG_GETSA       = 0x12
+	XFRM_MSG_NEWPOLICY   = 0x13
+	XFRM_MSG_DELPOLICY   = 0x14
+	XFRM_MSG_GETPOLICY   = 0x15
+	XFRM_MSG_ALLOCSPI    = 0x16
+	XFRM_MSG_ACQUIRE     = 0x17
+	XFRM_MSG_EXPIRE      = 0x18
+	XFRM_MSG_UPDPOLICY   = 0x19
+	XFRM_MSG_UPDSA       = 0x1a
+	XFRM_MSG_POLEXPIRE   = 0x1b
+	XFRM_MSG_FLUSHSA     = 0x1c
+	XFRM_MSG_FLUSHPOLICY = 0x1d
+)
+
+// Netlink attribute types for NETLINK_XFRM messages, from
+// uapi/linux/xfrm.h.
+const (
+	XFRMA_UNSPEC        = 0
+	XFRMA_ALG_AUTH      = 1
+	XFRMA_ALG_CRYPT     = 2
+	XFRMA_ALG_COMP      = 3
+	XFRMA_ENCAP         = 4
+	XFRMA_TMPL          = 5
+	XFRMA_SA            = 6
+	XFRMA_POLICY        = 7
+	XFRMA_SEC_CTX       = 8
+	XFRMA_LTIME_VAL     = 9
+	XFRMA_REPLAY_VAL    = 10
+	XFRMA_REPLAY_THRESH = 11
+	XFRMA_ETIMER_THRESH = 12
+	XFRMA_SRCADDR       = 13
+	XFRMA_COADDR        = 14
+	XFRMA_LASTUSED      = 15
+	XFRMA_POLICY_TYPE   = 16
+	XFRMA_MIGRATE       = 17
+	XFRMA_ALG_AEAD      = 18
+)
+
+// IPsec modes, from uapi/linux/xfrm.h.
+const (
+	XFRM_MODE_TRANSPORT = 0
+	XFRM_MODE_TUNNEL    = 1
+)
+
+// Security policy directions and actions, from uapi/linux/xfrm.h.
+const (
+	XFRM_POLICY_IN  = 0
+	XFRM_POLICY_OUT = 1
+	XFRM_POLICY_FWD = 2
+
+	XFRM_POLICY_ALLOW = 0
+	XFRM_POLICY_BLOCK = 1
+)
+
+// XFRM_INF is the value of unlimited lifetimes, from uapi/linux/xfrm.h.
+const XFRM_INF = ^uint64(0)
+
+// XfrmSelector is struct xfrm_selector, from uapi/linux/xfrm.h.
+//
+// Ports are in network byte order. IPv4 addresses are stored in the first 4
+// bytes of Daddr and Saddr.
+//
+// +marshal
+type XfrmSelector struct {
+	Daddr      [16]byte
+	Saddr      [16]byte
+	Dport      uint16
+	DportMask  uint16
+	Sport      uint16
+	SportMask  uint16
+	Family     uint16
+	PrefixlenD uint8
+	PrefixlenS uint8
+	Proto      uint8
+	_          [3]byte
+	Ifindex    int32
+	User       uint32
+}
+
+// XfrmID is struct xfrm_id, from uapi/linux/xfrm.h. SPI is in network byte
+// order.
+//
+// +marshal
+type XfrmID struct {
+	Daddr [16]byte
+	SPI   uint32
+	Proto uint8
+	_     [3]byte
+}
+
+// XfrmLifetimeCfg is struct xfrm_lifetime_cfg, from uapi/linux/xfrm.h.
+//
+// +marshal
+type XfrmLifetimeCfg struct {
+	SoftByteLimit         uint64
+	HardByteLimit         uint64
+	SoftPacketLimit       uint64
+	HardPacketLimit       uint64
+	SoftAddExpiresSeconds uint64
+	HardAddExpiresSeconds uint64
+	SoftUseExpiresSeconds uint64
+	HardUseExpiresSeconds uint64
+}
+
+// XfrmLifetimeCur is struct xfrm_lifetime_cur, from uapi/linux/xfrm.h.
+//
+// +marshal
+type XfrmLifetimeCur struct {
+	Bytes   uint64
+	Packets uint64
+	AddTime uint64
+	UseTime uint64
+}
+
+// XfrmStats is struct xfrm_stats, from uapi/linux/xfrm.h.
+//
+// +marshal
+type XfrmStats struct {
+	ReplayWindow    uint32
+	Replay          uint32
+	IntegrityFailed uint32
+}
+
+// XfrmUsersaInfo is struct xfrm_usersa_info, from uapi/linux/xfrm.h.
+//
+// +marshal
+type XfrmUsersaInfo struct {
+	Sel          XfrmSelector
+	ID           XfrmID
+	Saddr        [16]byte
+	Lft          XfrmLifetimeCfg
+	Curlft       XfrmLifetimeCur
+	Stats        XfrmStats
+	Seq          uint32
+	Reqid        uint32
+	Family       uint16
+	Mode         uint8
+	ReplayWindow uint8
+	Flags        uint8
+	_            [7]byte
+}
+
+// XfrmUsersaID is struct xfrm_usersa_id, from uapi/linux/xfrm.h.
+//
+// +marshal
+type XfrmUsersaID struct {
+	Daddr  [16]byte
+	SPI    uint32
+	Family uint16
+	Proto  uint8
+	_      [1]byte
+}
+
+// XfrmUsersaFlush is struct xfrm_usersa_flush, from uapi/linux/xfrm.h.
+//
+// +marshal
+type XfrmUsersaFlush struct {
+	Proto uint8
+}
+
+// XfrmUserpolicyInfo is struct xfrm_userpolicy_info, from
+// uapi/linux/xfrm.h.
+//
+// +marshal
+type XfrmUserpolicyInfo struct {
+	Sel      XfrmSelector
+	Lft      XfrmLifetimeCfg
+	Curlft   XfrmLifetimeCur
+	Priority uint32
+	Index    uint32
+	Dir      uint8
+	Action   uint8
+	Flags    uint8
+	Share    uint8
+	_        [4]byte
+}
+
+// XfrmUserpolicyID is struct xfrm_userpolicy_id, from uapi/linux/xfrm.h.
+//
+// +marshal
+type XfrmUserpolicyID struct {
+	Sel   XfrmSelector
+	Index uint32
+	Dir   uint8
+	_     [3]byte
+}
+
+// XfrmUserTmpl is struct xfrm_user_tmpl, from uapi/linux/xfrm.h.
+//
+// +marshal
+type XfrmUserTmpl struct {
+	ID       XfrmID
+	Family   uint16
+	_        [2]byte
+	Saddr    [16]byte
+	Reqid    uint32
+	Mode     uint8
+	Share    uint8
+	Optional uint8
+	_        [1]byte
+	Aalgos   uint32
+	Ealgos   uint32
+	Calgos   uint32
+}
+
+// XfrmAlgoAEAD is struct xfrm_algo_aead, from uapi/linux/xfrm.h, without the
+// trailing key. KeyLen and ICVLen are in bits.
+//
+// +marshal
+type XfrmAlgoAEAD struct {
+	Name   [64]byte
+	KeyLen uint32
+	ICVLen uint32
+}
+
+// XfrmAlgoAEADSize is the size of XfrmAlgoAEAD.
+const XfrmAlgoAEADSize = 72
@@ -0,0 +1,137 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// SOL_PACKET socket options, from uapi/linux/if_packet.h.
+const (
+	PACKET_ADD_MEMBERSHIP  = 1
+	PACKET_DROP_MEMBERSHIP = 2
+	PACKET_RECV_OUTPUT     = 3
+	PACKET_RX_RING         = 5
+	PACKET_STATISTICS      = 6
+	PACKET_COPY_THRESH     = 7
+	PACKET_AUXDATA         = 8
+	PACKET_ORIGDEV         = 9
+	PACKET_VERSION         = 10
+	PACKET_HDRLEN          = 11
+	PACKET_RESERVE         = 12
+	PACKET_TX_RING         = 13
+	PACKET_LOSS            = 14
+	PACKET_VNET_HDR        = 15
+	PACKET_TX_TIMESTAMP    = 16
+	PACKET_TIMESTAMP       = 17
+	PACKET_FANOUT          = 18
+	PACKET_TX_HAS_OFF      = 19
+	PACKET_QDISC_BYPASS    = 20
+	PACKET_ROLLOVER_STATS  = 21
+	PACKET_FANOUT_DATA     = 22
+	PACKET_IGNORE_OUTGOING = 23
+)
+
+// Packet membership types, for PACKET_ADD_MEMBERSHIP and
+// PACKET_DROP_MEMBERSHIP.
+const (
+	PACKET_MR_MULTICAST = 0
+	PACKET_MR_PROMISC   = 1
+	PACKET_MR_ALLMULTI  = 2
+	PACKET_MR_UNICAST   = 3
+)
+
+// PacketMreq is struct packet_mreq, from uapi/linux/if_packet.h.
+//
+// +marshal
+type PacketMreq struct {
+	IfIndex int32
+	Type    uint16
+	ALen    uint16
+	Address [8]byte
+}
+
+// SizeOfPacketMreq is the size of a PacketMreq struct.
+var SizeOfPacketMreq = (*PacketMreq)(nil).SizeBytes()
+
+// TPacketStats is struct tpacket_stats, from uapi/linux/if_packet.h.
+//
+// +marshal
+type TPacketStats struct {
+	Packets uint32
+	Drops   uint32
+}
+
+// TPacketReq is struct tpacket_req, from uapi/linux/if_packet.h. It describes
+// the layout of a PACKET_RX_RING or PACKET_TX_RING ring.
+//
+// +marshal
+type TPacketReq struct {
+	BlockSize uint32
+	BlockNr   uint32
+	FrameSize uint32
+	FrameNr   uint32
+}
+
+// SizeOfTPacketReq is the size of a TPacketReq struct.
+var SizeOfTPacketReq = (*TPacketReq)(nil).SizeBytes()
+
+// Packet ring versions, for PACKET_VERSION.
+const (
+	TPACKET_V1 = 0
+	TPACKET_V2 = 1
+	TPACKET_V3 = 2
+)
+
+// Frame status bits, in TPacket2Hdr.Status.
+const (
+	TP_STATUS_KERNEL          = 0
+	TP_STATUS_USER            = 1 << 0
+	TP_STATUS_COPY            = 1 << 1
+	TP_STATUS_LOSING          = 1 << 2
+	TP_STATUS_CSUMNOTREADY    = 1 << 3
+	TP_STATUS_VLAN_VALID      = 1 << 4
+	TP_STATUS_BLK_TMO         = 1 << 5
+	TP_STATUS_VLAN_TPID_VALID = 1 << 6
+	TP_STATUS_CSUM_VALID      = 1 << 7
+	TP_STATUS_TS_SOFTWARE     = 1 << 29
+	TP_STATUS_TS_RAW_HARDWARE = 1 << 31
+)
+
+// TPacket2Hdr is struct tpacket2_hdr, from uapi/linux/if_packet.h. It is the
+// header of each frame in a TPACKET_V2 ring.
+//
+// +marshal
+type TPacket2Hdr struct {
+	Status   uint32
+	Len      uint32
+	Snaplen  uint32
+	Mac      uint16
+	Net      uint16
+	Sec      uint32
+	Nsec     uint32
+	VLANTCI  uint16
+	VLANTPID uint16
+	_        [4]byte
+}
+
+// TPACKET_ALIGNMENT is the alignment of frames, and of the data within them,
+// in a packet ring.
+const TPACKET_ALIGNMENT = 16
+
+// TPacketAlign rounds x up to TPACKET_ALIGNMENT.
+func TPacketAlign(x uint32) uint32 {
+	return (x + TPACKET_ALIGNMENT - 1) &^ (TPACKET_ALIGNMENT - 1)
+}
+
+// TPACKET2_HDRLEN is the size of a TPACKET_V2 frame header, including the
+// struct sockaddr_ll that follows the TPacket2Hdr.
+var TPACKET2_HDRLEN = TPacketAlign(uint32((*TPacket2Hdr)(nil).SizeBytes())) + uint32((*SockAddrLink)(nil).SizeBytes())
@@ -0,0 +1,43 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Personality flags, from include/uapi/linux/personality.h.
+const (
+	UNAME26            = 0x0020000
+	ADDR_NO_RANDOMIZE  = 0x0040000
+	FDPIC_FUNCPTRS     = 0x0080000
+	MMAP_PAGE_ZERO     = 0x0100000
+	ADDR_COMPAT_LAYOUT = 0x0200000
+	READ_IMPLIES_EXEC  = 0x0400000
+	ADDR_LIMIT_32BIT   = 0x0800000
+	SHORT_INODE        = 0x1000000
+	WHOLE_SECONDS      = 0x2000000
+	STICKY_TIMEOUTS    = 0x4000000
+	ADDR_LIMIT_3GB     = 0x8000000
+)
+
+// Personality types, from include/uapi/linux/personality.h.
+const (
+	PER_LINUX   = 0x0000
+	PER_LINUX32 = 0x0008
+
+	// PER_MASK masks the personality type in a personality value.
+	PER_MASK = 0x00ff
+)
+
+// PersonalityQuery is passed to personality(2) to query the personality
+// without changing it.
+const PersonalityQuery = 0xffffffff
@@ -0,0 +1,120 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// PTP clock ioctl type, from include/uapi/linux/ptp_clock.h.
+const PTP_CLK_MAGIC = '='
+
+// PTP clock ioctl numbers, from include/uapi/linux/ptp_clock.h. The "2"
+// variants are identical to the originals except that they reject nonzero
+// reserved fields.
+const (
+	PTP_IOCTL_NR_CLOCK_GETCAPS        = 1
+	PTP_IOCTL_NR_SYS_OFFSET           = 5
+	PTP_IOCTL_NR_SYS_OFFSET_PRECISE   = 8
+	PTP_IOCTL_NR_SYS_OFFSET_EXTENDED  = 9
+	PTP_IOCTL_NR_CLOCK_GETCAPS2       = 10
+	PTP_IOCTL_NR_SYS_OFFSET2          = 14
+	PTP_IOCTL_NR_SYS_OFFSET_PRECISE2  = 17
+	PTP_IOCTL_NR_SYS_OFFSET_EXTENDED2 = 18
+)
+
+// PTP_MAX_SAMPLES is the maximum number of samples that PTP_SYS_OFFSET and
+// PTP_SYS_OFFSET_EXTENDED take, from include/uapi/linux/ptp_clock.h.
+const PTP_MAX_SAMPLES = 25
+
+// PTP clock ioctls, from include/uapi/linux/ptp_clock.h.
+var (
+	PTP_CLOCK_GETCAPS       = IOR(PTP_CLK_MAGIC, PTP_IOCTL_NR_CLOCK_GETCAPS, 80)          // struct ptp_clock_caps
+	PTP_SYS_OFFSET          = IOW(PTP_CLK_MAGIC, PTP_IOCTL_NR_SYS_OFFSET, 832)            // struct ptp_sys_offset
+	PTP_SYS_OFFSET_PRECISE  = IOWR(PTP_CLK_MAGIC, PTP_IOCTL_NR_SYS_OFFSET_PRECISE, 64)    // struct ptp_sys_offset_precise
+	PTP_SYS_OFFSET_EXTENDED = IOWR(PTP_CLK_MAGIC, PTP_IOCTL_NR_SYS_OFFSET_EXTENDED, 1216) // struct ptp_sys_offset_extended
+
+	PTP_CLOCK_GETCAPS2       = IOR(PTP_CLK_MAGIC, PTP_IOCTL_NR_CLOCK_GETCAPS2, 80)          // struct ptp_clock_caps
+	PTP_SYS_OFFSET2          = IOW(PTP_CLK_MAGIC, PTP_IOCTL_NR_SYS_OFFSET2, 832)            // struct ptp_sys_offset
+	PTP_SYS_OFFSET_PRECISE2  = IOWR(PTP_CLK_MAGIC, PTP_IOCTL_NR_SYS_OFFSET_PRECISE2, 64)    // struct ptp_sys_offset_precise
+	PTP_SYS_OFFSET_EXTENDED2 = IOWR(PTP_CLK_MAGIC, PTP_IOCTL_NR_SYS_OFFSET_EXTENDED2, 1216) // struct ptp_sys_offset_extended
+)
+
+// PTPClockTime is struct ptp_clock_time, from
+// include/uapi/linux/ptp_clock.h.
+//
+// +marshal
+type PTPClockTime struct {
+	Sec  int64
+	Nsec uint32
+	_    uint32
+}
+
+// PTPClockTimeFromNsec returns the PTPClockTime for nsec nanoseconds.
+func PTPClockTimeFromNsec(nsec int64) PTPClockTime {
+	ts := NsecToTimespec(nsec)
+	return PTPClockTime{
+		Sec:  ts.Sec,
+		Nsec: uint32(ts.Nsec),
+	}
+}
+
+// PTPClockCaps is struct ptp_clock_caps, from
+// include/uapi/linux/ptp_clock.h.
+//
+// +marshal
+type PTPClockCaps struct {
+	MaxAdj            int32
+	NAlarm            int32
+	NExtTs            int32
+	NPerOut           int32
+	PPS               int32
+	NPins             int32
+	CrossTimestamping int32
+	AdjustPhase       int32
+	MaxPhaseAdj       int32
+	_                 [11]int32
+}
+
+// PTPSysOffset is struct ptp_sys_offset, from
+// include/uapi/linux/ptp_clock.h. Ts holds alternating system and PTP clock
+// timestamps, starting and ending with a system timestamp.
+//
+// +marshal
+type PTPSysOffset struct {
+	NSamples uint32
+	Rsv      [3]uint32
+	Ts       [2*PTP_MAX_SAMPLES + 1]PTPClockTime
+}
+
+// PTPSysOffsetExtended is struct ptp_sys_offset_extended, from
+// include/uapi/linux/ptp_clock.h. Ts holds NSamples rows of (system, PTP
+// clock, system) timestamps; it is flattened since go-marshal does not
+// support multidimensional arrays.
+//
+// +marshal
+type PTPSysOffsetExtended struct {
+	NSamples uint32
+	ClockID  int32
+	Rsv      [2]uint32
+	Ts       [3 * PTP_MAX_SAMPLES]PTPClockTime
+}
+
+// PTPSysOffsetPrecise is struct ptp_sys_offset_precise, from
+// include/uapi/linux/ptp_clock.h.
+//
+// +marshal
+type PTPSysOffsetPrecise struct {
+	Device      PTPClockTime
+	SysRealtime PTPClockTime
+	SysMonoraw  PTPClockTime
+	Rsv         [4]uint32
+}
@@ -40,6 +40,7 @@ const (
 	SECCOMP_RET_TRAP         BPFAction = 0x00030000
 	SECCOMP_RET_ERRNO        BPFAction = 0x00050000
 	SECCOMP_RET_TRACE        BPFAction = 0x7ff00000
+	SECCOMP_RET_LOG          BPFAction = 0x7ffc0000
 	SECCOMP_RET_ALLOW        BPFAction = 0x7fff0000
 )
 
@@ -63,6 +64,8 @@ func (a BPFAction) String() string {
 			return "trace"
 		}
 		return fmt.Sprintf("trace (data=%#x)", data)
+	case SECCOMP_RET_LOG:
+		return "log"
 	case SECCOMP_RET_ALLOW:
 		return "allow"
 	}
@@ -205,6 +205,27 @@ const (
 	SO_TXTIME                = 61
 )
 
+// Indices into SKMemInfo, from uapi/linux/sock_diag.h.
+const (
+	SK_MEMINFO_RMEM_ALLOC  = 0
+	SK_MEMINFO_RCVBUF      = 1
+	SK_MEMINFO_WMEM_ALLOC  = 2
+	SK_MEMINFO_SNDBUF      = 3
+	SK_MEMINFO_FWD_ALLOC   = 4
+	SK_MEMINFO_WMEM_QUEUED = 5
+	SK_MEMINFO_OPTMEM      = 6
+	SK_MEMINFO_BACKLOG     = 7
+	SK_MEMINFO_DROPS       = 8
+
+	SK_MEMINFO_VARS = 9
+)
+
+// SKMemInfo is the socket memory information returned by SO_MEMINFO and the
+// INET_DIAG_SKMEMINFO sock_diag attribute, indexed by SK_MEMINFO_*.
+//
+// +marshal
+type SKMemInfo [SK_MEMINFO_VARS]uint32
+
 // enum socket_state, from uapi/linux/net.h.
 const (
 	SS_FREE          = 0 // Not allocated.
@@ -334,6 +355,7 @@ func (s *SockAddrInet6) implementsSockAddr()   {}
 func (s *SockAddrLink) implementsSockAddr()    {}
 func (s *SockAddrUnix) implementsSockAddr()    {}
 func (s *SockAddrNetlink) implementsSockAddr() {}
+func (s *SockAddrVM) implementsSockAddr()      {}
 
 // Linger is struct linger, from include/linux/socket.h.
 //
@@ -0,0 +1,96 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Flags for Timex.Modes, from include/uapi/linux/timex.h.
+const (
+	ADJ_OFFSET            = 0x0001
+	ADJ_FREQUENCY         = 0x0002
+	ADJ_MAXERROR          = 0x0004
+	ADJ_ESTERROR          = 0x0008
+	ADJ_STATUS            = 0x0010
+	ADJ_TIMECONST         = 0x0020
+	ADJ_TAI               = 0x0080
+	ADJ_SETOFFSET         = 0x0100
+	ADJ_MICRO             = 0x1000
+	ADJ_NANO              = 0x2000
+	ADJ_TICK              = 0x4000
+	ADJ_OFFSET_SINGLESHOT = 0x8001
+	ADJ_OFFSET_SS_READ    = 0xa001
+)
+
+// Flags for Timex.Status, from include/uapi/linux/timex.h.
+const (
+	STA_PLL       = 0x0001
+	STA_PPSFREQ   = 0x0002
+	STA_PPSTIME   = 0x0004
+	STA_FLL       = 0x0008
+	STA_INS       = 0x0010
+	STA_DEL       = 0x0020
+	STA_UNSYNC    = 0x0040
+	STA_FREQHOLD  = 0x0080
+	STA_PPSSIGNAL = 0x0100
+	STA_PPSJITTER = 0x0200
+	STA_PPSWANDER = 0x0400
+	STA_PPSERROR  = 0x0800
+	STA_CLOCKERR  = 0x1000
+	STA_NANO      = 0x2000
+	STA_MODE      = 0x4000
+	STA_CLK       = 0x8000
+)
+
+// Clock states returned by adjtimex(2), from include/uapi/linux/timex.h.
+const (
+	TIME_OK    = 0
+	TIME_INS   = 1
+	TIME_DEL   = 2
+	TIME_OOP   = 3
+	TIME_WAIT  = 4
+	TIME_ERROR = 5
+)
+
+// NTP_PHASE_LIMIT is the maximum error, in microseconds, that the kernel
+// reports for an unsynchronized clock, from include/linux/timex.h.
+const NTP_PHASE_LIMIT = 16000000
+
+// Timex is struct timex, from include/uapi/linux/timex.h.
+//
+// +marshal
+type Timex struct {
+	Modes     uint32
+	_         uint32
+	Offset    int64
+	Freq      int64
+	MaxError  int64
+	EstError  int64
+	Status    int32
+	_         uint32
+	Constant  int64
+	Precision int64
+	Tolerance int64
+	Time      Timeval
+	Tick      int64
+	PPSFreq   int64
+	Jitter    int64
+	Shift     int32
+	_         uint32
+	Stabil    int64
+	JitCnt    int64
+	CalCnt    int64
+	ErrCnt    int64
+	StbCnt    int64
+	TAI       int32
+	_         [11]int32
+}
@@ -0,0 +1,194 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Minor device number for /dev/vfio/vfio, from include/linux/miscdevice.h.
+const (
+	VFIO_MINOR = 196
+)
+
+// VFIO ioctl type and base, from include/uapi/linux/vfio.h.
+const (
+	VFIO_TYPE = ';'
+	VFIO_BASE = 100
+)
+
+// VFIO ioctls, from include/uapi/linux/vfio.h.
+var (
+	VFIO_GET_API_VERSION        = IO(VFIO_TYPE, VFIO_BASE+0)
+	VFIO_CHECK_EXTENSION        = IO(VFIO_TYPE, VFIO_BASE+1)
+	VFIO_SET_IOMMU              = IO(VFIO_TYPE, VFIO_BASE+2)
+	VFIO_GROUP_GET_STATUS       = IO(VFIO_TYPE, VFIO_BASE+3)
+	VFIO_GROUP_SET_CONTAINER    = IO(VFIO_TYPE, VFIO_BASE+4)
+	VFIO_GROUP_UNSET_CONTAINER  = IO(VFIO_TYPE, VFIO_BASE+5)
+	VFIO_GROUP_GET_DEVICE_FD    = IO(VFIO_TYPE, VFIO_BASE+6)
+	VFIO_DEVICE_GET_INFO        = IO(VFIO_TYPE, VFIO_BASE+7)
+	VFIO_DEVICE_GET_REGION_INFO = IO(VFIO_TYPE, VFIO_BASE+8)
+	VFIO_DEVICE_GET_IRQ_INFO    = IO(VFIO_TYPE, VFIO_BASE+9)
+	VFIO_DEVICE_SET_IRQS        = IO(VFIO_TYPE, VFIO_BASE+10)
+	VFIO_DEVICE_RESET           = IO(VFIO_TYPE, VFIO_BASE+11)
+	VFIO_IOMMU_GET_INFO         = IO(VFIO_TYPE, VFIO_BASE+12)
+	VFIO_IOMMU_MAP_DMA          = IO(VFIO_TYPE, VFIO_BASE+13)
+	VFIO_IOMMU_UNMAP_DMA        = IO(VFIO_TYPE, VFIO_BASE+14)
+)
+
+// VFIO API version and extensions, from include/uapi/linux/vfio.h.
+const (
+	VFIO_API_VERSION = 0
+
+	VFIO_TYPE1_IOMMU   = 1
+	VFIO_TYPE1v2_IOMMU = 3
+)
+
+// Flags for VFIOGroupStatus.Flags.
+const (
+	VFIO_GROUP_FLAGS_VIABLE        = 1 << 0
+	VFIO_GROUP_FLAGS_CONTAINER_SET = 1 << 1
+)
+
+// Flags for VFIODeviceInfo.Flags.
+const (
+	VFIO_DEVICE_FLAGS_RESET = 1 << 0
+	VFIO_DEVICE_FLAGS_PCI   = 1 << 1
+)
+
+// Flags for VFIORegionInfo.Flags.
+const (
+	VFIO_REGION_INFO_FLAG_READ  = 1 << 0
+	VFIO_REGION_INFO_FLAG_WRITE = 1 << 1
+	VFIO_REGION_INFO_FLAG_MMAP  = 1 << 2
+	VFIO_REGION_INFO_FLAG_CAPS  = 1 << 3
+)
+
+// Flags for VFIOIrqSet.Flags.
+const (
+	VFIO_IRQ_SET_DATA_NONE      = 1 << 0
+	VFIO_IRQ_SET_DATA_BOOL      = 1 << 1
+	VFIO_IRQ_SET_DATA_EVENTFD   = 1 << 2
+	VFIO_IRQ_SET_ACTION_MASK    = 1 << 3
+	VFIO_IRQ_SET_ACTION_UNMASK  = 1 << 4
+	VFIO_IRQ_SET_ACTION_TRIGGER = 1 << 5
+
+	VFIO_IRQ_SET_DATA_TYPE_MASK   = VFIO_IRQ_SET_DATA_NONE | VFIO_IRQ_SET_DATA_BOOL | VFIO_IRQ_SET_DATA_EVENTFD
+	VFIO_IRQ_SET_ACTION_TYPE_MASK = VFIO_IRQ_SET_ACTION_MASK | VFIO_IRQ_SET_ACTION_UNMASK | VFIO_IRQ_SET_ACTION_TRIGGER
+)
+
+// Flags for VFIOIommuType1DmaMap.Flags.
+const (
+	VFIO_DMA_MAP_FLAG_READ  = 1 << 0
+	VFIO_DMA_MAP_FLAG_WRITE = 1 << 1
+)
+
+// VFIO PCI region indices, from include/uapi/linux/vfio.h.
+const (
+	VFIO_PCI_BAR0_REGION_INDEX   = 0
+	VFIO_PCI_BAR5_REGION_INDEX   = 5
+	VFIO_PCI_ROM_REGION_INDEX    = 6
+	VFIO_PCI_CONFIG_REGION_INDEX = 7
+	VFIO_PCI_VGA_REGION_INDEX    = 8
+	VFIO_PCI_NUM_REGIONS         = 9
+)
+
+// VFIOGroupStatus is struct vfio_group_status, from
+// include/uapi/linux/vfio.h.
+//
+// +marshal
+type VFIOGroupStatus struct {
+	Argsz uint32
+	Flags uint32
+}
+
+// VFIODeviceInfo is struct vfio_device_info, from include/uapi/linux/vfio.h.
+//
+// +marshal
+type VFIODeviceInfo struct {
+	Argsz      uint32
+	Flags      uint32
+	NumRegions uint32
+	NumIrqs    uint32
+	CapOffset  uint32
+	_          uint32
+}
+
+// VFIORegionInfo is struct vfio_region_info, from include/uapi/linux/vfio.h.
+// It may be followed by a chain of capabilities, starting at CapOffset.
+//
+// +marshal
+type VFIORegionInfo struct {
+	Argsz     uint32
+	Flags     uint32
+	Index     uint32
+	CapOffset uint32
+	Size      uint64
+	Offset    uint64
+}
+
+// VFIOIrqInfo is struct vfio_irq_info, from include/uapi/linux/vfio.h.
+//
+// +marshal
+type VFIOIrqInfo struct {
+	Argsz uint32
+	Flags uint32
+	Index uint32
+	Count uint32
+}
+
+// VFIOIrqSet is struct vfio_irq_set, from include/uapi/linux/vfio.h, without
+// its variable-length data.
+//
+// +marshal
+type VFIOIrqSet struct {
+	Argsz uint32
+	Flags uint32
+	Index uint32
+	Start uint32
+	Count uint32
+}
+
+// VFIOIommuType1Info is struct vfio_iommu_type1_info, from
+// include/uapi/linux/vfio.h. It may be followed by a chain of capabilities,
+// starting at CapOffset.
+//
+// +marshal
+type VFIOIommuType1Info struct {
+	Argsz       uint32
+	Flags       uint32
+	IovaPgsizes uint64
+	CapOffset   uint32
+	_           uint32
+}
+
+// VFIOIommuType1DmaMap is struct vfio_iommu_type1_dma_map, from
+// include/uapi/linux/vfio.h.
+//
+// +marshal
+type VFIOIommuType1DmaMap struct {
+	Argsz uint32
+	Flags uint32
+	Vaddr uint64
+	Iova  uint64
+	Size  uint64
+}
+
+// VFIOIommuType1DmaUnmap is struct vfio_iommu_type1_dma_unmap, from
+// include/uapi/linux/vfio.h, without its variable-length data.
+//
+// +marshal
+type VFIOIommuType1DmaUnmap struct {
+	Argsz uint32
+	Flags uint32
+	Iova  uint64
+	Size  uint64
+}
@@ -0,0 +1,59 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Well-known vsock context IDs and ports, from uapi/linux/vm_sockets.h.
+const (
+	VMADDR_CID_ANY        = 0xffffffff
+	VMADDR_CID_HYPERVISOR = 0
+	VMADDR_CID_LOCAL      = 1
+	VMADDR_CID_HOST       = 2
+	VMADDR_PORT_ANY       = 0xffffffff
+)
+
+// Vsock flags, from uapi/linux/vm_sockets.h.
+const (
+	VMADDR_FLAG_TO_HOST = 0x01
+)
+
+// Vsock socket options, from uapi/linux/vm_sockets.h.
+const (
+	SO_VM_SOCKETS_BUFFER_SIZE     = 0
+	SO_VM_SOCKETS_BUFFER_MIN_SIZE = 1
+	SO_VM_SOCKETS_BUFFER_MAX_SIZE = 2
+	SO_VM_SOCKETS_PEER_HOST_VM_ID = 3
+	SO_VM_SOCKETS_TRUSTED         = 5
+	SO_VM_SOCKETS_CONNECT_TIMEOUT = 6
+	SO_VM_SOCKETS_NONBLOCK_TXRX   = 7
+)
+
+// IOCTL_VM_SOCKETS_GET_LOCAL_CID is the ioctl that returns the local context
+// ID, from uapi/linux/vm_sockets.h.
+const IOCTL_VM_SOCKETS_GET_LOCAL_CID = 0x7b9
+
+// SockAddrVM is struct sockaddr_vm, from uapi/linux/vm_sockets.h.
+//
+// +marshal
+type SockAddrVM struct {
+	Family    uint16
+	Reserved1 uint16
+	Port      uint32
+	CID       uint32
+	Flags     uint8
+	Zero      [3]uint8
+}
+
+// SockAddrVMSize is the size of SockAddrVM.
+const SockAddrVMSize = 16
@@ -16,9 +16,11 @@ package nvgpu
 
 // Status codes, from src/common/sdk/nvidia/inc/nvstatuscodes.h.
 const (
+	NV_OK                   = 0x00000000
 	NV_ERR_INVALID_ADDRESS  = 0x0000001e
 	NV_ERR_INVALID_ARGUMENT = 0x0000001f
 	NV_ERR_INVALID_CLASS    = 0x00000022
 	NV_ERR_INVALID_LIMIT    = 0x0000002e
+	NV_ERR_NO_MEMORY        = 0x00000051
 	NV_ERR_NOT_SUPPORTED    = 0x00000056
 )
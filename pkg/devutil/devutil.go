@@ -17,6 +17,7 @@ package devutil
 
 import (
 	"fmt"
+	"strings"
 
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/context"
@@ -92,13 +93,14 @@ func (g *GoferClient) DirentNames(ctx context.Context) ([]string, error) {
 	return names, nil
 }
 
-// OpenAt opens the device file at /dev/{name} on the gofer.
+// OpenAt opens the device file at /dev/{name} on the gofer. name may contain
+// multiple path components, e.g. "vfio/vfio".
 func (g *GoferClient) OpenAt(ctx context.Context, name string, flags uint32) (int, error) {
 	flags &= unix.O_ACCMODE
 	if g.hostFD >= 0 {
 		return unix.Openat(g.hostFD, name, int(flags|unix.O_NOFOLLOW), 0)
 	}
-	childInode, err := g.clientFD.Walk(ctx, name)
+	childInode, err := g.walk(ctx, name)
 	if err != nil {
 		log.Infof("failed to walk %q from dev gofer FD", name)
 		return 0, err
@@ -116,3 +118,27 @@ func (g *GoferClient) OpenAt(ctx context.Context, name string, flags uint32) (in
 	client.CloseFD(ctx, childOpenFD, true /* flush */)
 	return childHostFD, nil
 }
+
+// walk walks to the device file at /dev/{name} on the gofer.
+func (g *GoferClient) walk(ctx context.Context, name string) (lisafs.Inode, error) {
+	names := strings.Split(name, "/")
+	if len(names) == 1 {
+		return g.clientFD.Walk(ctx, name)
+	}
+	status, inodes, err := g.clientFD.WalkMultiple(ctx, names)
+	if err != nil {
+		return lisafs.Inode{}, err
+	}
+	client := g.clientFD.Client()
+	if status != lisafs.WalkSuccess || len(inodes) != len(names) {
+		for i := range inodes {
+			client.CloseFD(ctx, inodes[i].ControlFD, false /* flush */)
+		}
+		return lisafs.Inode{}, unix.ENOENT
+	}
+	// Only the device file's inode is needed.
+	for i := 0; i < len(inodes)-1; i++ {
+		client.CloseFD(ctx, inodes[i].ControlFD, false /* flush */)
+	}
+	return inodes[len(inodes)-1], nil
+}
@@ -88,6 +88,20 @@ func RenameAt(oldDirFD int, oldName string, newDirFD int, newName string) error
 	return nil
 }
 
+// SetWriteHint is a convenience wrapper to make the fcntl(2) syscall with
+// F_SET_RW_HINT, which takes a pointer to the hint.
+func SetWriteHint(fd int, hint uint64) error {
+	if _, _, errno := unix.Syscall(
+		unix.SYS_FCNTL,
+		uintptr(fd),
+		unix.F_SET_RW_HINT,
+		uintptr(unsafe.Pointer(&hint))); errno != 0 {
+
+		return syserr.FromHost(errno).ToError()
+	}
+	return nil
+}
+
 // ParseDirents parses dirents from buf. buf must have been populated by
 // getdents64(2) syscall. It calls the handleDirent callback for each dirent.
 func ParseDirents(buf []byte, handleDirent DirentHandler) {
@@ -46,6 +46,23 @@ func maxChannels() int {
 	return maxChans
 }
 
+// maxChannelsLimit is the largest number of channels per connection that can
+// be configured. It bounds the shared memory used by a connection.
+const maxChannelsLimit = 64
+
+// numChannels returns the number of channels to use given a configured value
+// n, where zero means the default.
+func numChannels(n int) int {
+	if n <= 0 {
+		return maxChannels()
+	}
+	if n > maxChannelsLimit {
+		log.Warningf("lisafs: %d channels requested, limiting to %d", n, maxChannelsLimit)
+		return maxChannelsLimit
+	}
+	return n
+}
+
 // channel implements Communicator and represents the communication endpoint
 // for the client and server and is used to perform fast IPC. Apart from
 // communicating data, a channel is also capable of donating file descriptors.
@@ -54,6 +71,7 @@ type channel struct {
 	dead   bool
 	data   flipcall.Endpoint
 	fdChan fdchannel.Endpoint
+	rpc    rpcTracker
 }
 
 var _ Communicator = (*channel)(nil)
@@ -106,7 +124,7 @@ func (c *Connection) createChannel(maxMessageSize uint32) (*channel, flipcall.Pa
 		return nil, flipcall.PacketWindowDescriptor{}, -1, unix.ENOSYS
 	}
 	// Return ENOMEM to indicate that the server has hit its max channels limit.
-	if len(c.channels) >= maxChannels() {
+	if len(c.channels) >= c.maxChannels {
 		return nil, flipcall.PacketWindowDescriptor{}, -1, unix.ENOMEM
 	}
 	ch := &channel{}
@@ -80,6 +80,7 @@ func NewClient(sock *unet.Socket) (*Client, Inode, int, error) {
 
 	// Start a goroutine to check socket health. This goroutine is also
 	// responsible for client cleanup.
+	registerClient(c)
 	c.watchdogWg.Add(1)
 	go c.watchdog()
 
@@ -112,9 +113,12 @@ func NewClient(sock *unet.Socket) (*Client, Inode, int, error) {
 	return c, mountResp.Root, mountHostFD[0], nil
 }
 
-// StartChannels starts maxChannels() channel communicators.
-func (c *Client) StartChannels() error {
-	maxChans := maxChannels()
+// StartChannels starts up to n channel communicators, or a default number
+// based on GOMAXPROCS if n is zero. The server may create fewer channels than
+// requested. Concurrent RPCs beyond the number of channels are serialized on
+// the main socket.
+func (c *Client) StartChannels(n int) error {
+	maxChans := numChannels(n)
 	c.channelsMu.Lock()
 	c.channels = make([]*channel, 0, maxChans)
 	c.availableChannels = make([]*channel, 0, maxChans)
@@ -194,6 +198,7 @@ func (c *Client) watchdog() {
 
 	// Close main socket.
 	c.sockComm.destroy()
+	unregisterClient(c)
 }
 
 func (c *Client) shutdownActiveChans() {
@@ -334,6 +339,8 @@ func (c *Client) SndRcvMessage(m MID, payloadLen uint32, reqMarshal marshalFunc,
 		return unix.EINVAL
 	}
 
+	incrementRPCCounter(m)
+
 	// Acquire a communicator.
 	comm := c.acquireCommunicator()
 	defer c.releaseCommunicator(comm)
@@ -342,7 +349,10 @@ func (c *Client) SndRcvMessage(m MID, payloadLen uint32, reqMarshal marshalFunc,
 
 	// Marshal the request into comm's payload buffer and make the RPC.
 	reqMarshal(comm.PayloadBuf(payloadLen))
+	rpc := rpcTrackerOf(comm)
+	rpc.begin(m)
 	respM, respPayloadLen, err := comm.SndRcvMessage(m, payloadLen, uint8(wantFDs))
+	rpc.end()
 
 	// Handle FD donation.
 	rcvFDs := comm.ReleaseFDs()
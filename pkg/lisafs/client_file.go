@@ -402,6 +402,46 @@ func (f *ClientFD) Allocate(ctx context.Context, mode, offset, length uint64) er
 	return err
 }
 
+// SyncRange makes the FSyncRange RPC. If FSyncRange is not supported, it falls
+// back to syncing the whole file if flags requires waiting for the write-out to
+// complete.
+func (f *ClientFD) SyncRange(ctx context.Context, offset, length uint64, flags uint32) error {
+	if !f.client.IsSupported(FSyncRange) {
+		if flags&linux.SYNC_FILE_RANGE_WAIT_AFTER == 0 {
+			return nil
+		}
+		return f.Sync(ctx)
+	}
+	req := FSyncRangeReq{
+		FD:     f.fd,
+		Offset: offset,
+		Length: length,
+		Flags:  flags,
+	}
+	var resp FSyncRangeResp
+	ctx.UninterruptibleSleepStart(false)
+	err := f.client.SndRcvMessage(FSyncRange, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	ctx.UninterruptibleSleepFinish(false)
+	return err
+}
+
+// SetWriteHint makes the FSetWriteHint RPC. Write hints are only advisory, so
+// this is a noop if FSetWriteHint is not supported.
+func (f *ClientFD) SetWriteHint(ctx context.Context, hint uint64) error {
+	if !f.client.IsSupported(FSetWriteHint) {
+		return nil
+	}
+	req := FSetWriteHintReq{
+		FD:   f.fd,
+		Hint: hint,
+	}
+	var resp FSetWriteHintResp
+	ctx.UninterruptibleSleepStart(false)
+	err := f.client.SndRcvMessage(FSetWriteHint, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	ctx.UninterruptibleSleepFinish(false)
+	return err
+}
+
 // ReadLinkAt makes the ReadLinkAt RPC.
 func (f *ClientFD) ReadLinkAt(ctx context.Context) (string, error) {
 	req := ReadLinkAtReq{FD: f.fd}
@@ -524,6 +564,24 @@ func (f *ClientFD) Getdents64(ctx context.Context, count int32) ([]Dirent64, err
 	return resp.Dirents, err
 }
 
+// ReadDirFiles makes the ReadDirFiles RPC. It returns the contents of regular
+// files of at most maxFileSize bytes in the directory represented by f, up to
+// maxTotalSize bytes in total. Callers must check that the RPC is supported
+// with Client.IsSupported.
+func (f *ClientFD) ReadDirFiles(ctx context.Context, maxFileSize, maxTotalSize uint32) ([]PackedFile, error) {
+	req := ReadDirFilesReq{
+		DirFD:        f.fd,
+		MaxFileSize:  maxFileSize,
+		MaxTotalSize: maxTotalSize,
+	}
+
+	var resp ReadDirFilesResp
+	ctx.UninterruptibleSleepStart(false)
+	err := f.client.SndRcvMessage(ReadDirFiles, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, nil, req.String, resp.String)
+	ctx.UninterruptibleSleepFinish(false)
+	return resp.Files, err
+}
+
 // ListXattr makes the FListXattr RPC.
 func (f *ClientFD) ListXattr(ctx context.Context, size uint64) ([]string, error) {
 	req := FListXattrReq{
@@ -62,6 +62,10 @@ type Connection struct {
 	// sockComm is the main socket by which this connections is established.
 	sockComm *sockCommunicator
 
+	// maxChannels is the maximum number of channels on this connection. It is
+	// immutable.
+	maxChannels int
+
 	// channelsMu protects channels.
 	channelsMu sync.Mutex
 	// channels keeps track of all open channels.
@@ -73,6 +77,11 @@ type Connection struct {
 	// reqGate counts requests that are still being handled.
 	reqGate sync.Gate
 
+	// admit limits the number of requests being handled concurrently. Each
+	// request being handled holds a token in it. If nil, the number of
+	// concurrent requests is not limited. admit is immutable.
+	admit chan struct{}
+
 	// channelAlloc is used to allocate memory for channels.
 	channelAlloc *flipcall.PacketWindowAllocator
 
@@ -92,16 +101,21 @@ func (s *Server) CreateConnection(sock *unet.Socket, mountPath string, readonly
 		return nil, unix.EINVAL
 	}
 
+	maxChans := numChannels(s.opts.MaxChannels)
 	c := &Connection{
 		sockComm:       newSockComm(sock),
 		server:         s,
 		maxMessageSize: s.impl.MaxMessageSize(),
 		mountPath:      mountPath,
 		readonly:       readonly,
-		channels:       make([]*channel, 0, maxChannels()),
+		maxChannels:    maxChans,
+		channels:       make([]*channel, 0, maxChans),
 		fds:            make(map[FDID]genericFD),
 		nextFDID:       InvalidFDID + 1,
 	}
+	if s.opts.MaxConcurrentRequests > 0 {
+		c.admit = make(chan struct{}, s.opts.MaxConcurrentRequests)
+	}
 
 	alloc, err := flipcall.NewPacketWindowAllocator()
 	if err != nil {
@@ -179,7 +193,13 @@ func (c *Connection) handleMsg(comm Communicator, m MID, payloadLen uint32) (ret
 		// c.close() has been called; the connection is shutting down.
 		return c.respondError(comm, unix.ECONNRESET)
 	}
+	if c.admit != nil {
+		c.admit <- struct{}{}
+	}
 	defer func() {
+		if c.admit != nil {
+			<-c.admit
+		}
 		c.reqGate.Leave()
 
 		// Don't allow a panic to propagate.
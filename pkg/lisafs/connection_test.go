@@ -15,11 +15,14 @@
 package connection_test
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/lisafs"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/unet"
@@ -28,6 +31,7 @@ import (
 const (
 	dynamicMsgID = lisafs.Channel + 1
 	versionMsgID = dynamicMsgID + 1
+	sleepMsgID   = versionMsgID + 1
 )
 
 var handlers = [...]lisafs.RPCHandler{
@@ -36,6 +40,7 @@ var handlers = [...]lisafs.RPCHandler{
 	lisafs.Channel: lisafs.ChannelHandler,
 	dynamicMsgID:   dynamicMsgHandler,
 	versionMsgID:   versionHandler,
+	sleepMsgID:     sleepHandler,
 }
 
 // testServer implements lisafs.ServerImpl.
@@ -76,17 +81,24 @@ func (s *testServer) SupportedMessages() []lisafs.MID {
 		lisafs.Channel,
 		dynamicMsgID,
 		versionMsgID,
+		sleepMsgID,
 	}
 }
 
 func runServerClient(t testing.TB, clientFn func(c *lisafs.Client)) {
+	runServerClientOpts(t, lisafs.ServerOpts{}, 0 /* numChannels */, clientFn)
+}
+
+// runServerClientOpts is runServerClient with the given server options and
+// number of client channels.
+func runServerClientOpts(t testing.TB, opts lisafs.ServerOpts, numChannels int, clientFn func(c *lisafs.Client)) {
 	serverSocket, clientSocket, err := unet.SocketPair(false)
 	if err != nil {
 		t.Fatalf("socketpair got err %v expected nil", err)
 	}
 
 	ts := &testServer{}
-	ts.Init(ts, lisafs.ServerOpts{})
+	ts.Init(ts, opts)
 	ts.SetHandlers(handlers[:])
 	conn, err := ts.CreateConnection(serverSocket, "/" /* mountPath */, false /* readonly */)
 	if err != nil {
@@ -99,7 +111,7 @@ func runServerClient(t testing.TB, clientFn func(c *lisafs.Client)) {
 	if err != nil {
 		t.Fatalf("client creation failed: %v", err)
 	}
-	if err := c.StartChannels(); err != nil {
+	if err := c.StartChannels(numChannels); err != nil {
 		t.Fatalf("failed to start channels: %v", err)
 	}
 
@@ -208,3 +220,109 @@ func BenchmarkSendRecv(b *testing.B) {
 		}
 	})
 }
+
+var (
+	// sleepInflight and sleepMaxInflight track the number of concurrent
+	// executions of sleepHandler.
+	sleepInflight    atomicbitops.Int32
+	sleepMaxInflight atomicbitops.Int32
+)
+
+// sleepHandler sleeps for the number of microseconds in the D field of the
+// request's only element, like an RPC doing blocking I/O.
+func sleepHandler(c *lisafs.Connection, comm lisafs.Communicator, payloadLen uint32) (uint32, error) {
+	var req lisafs.MsgDynamic
+	if _, ok := req.CheckedUnmarshal(comm.PayloadBuf(payloadLen)); !ok || req.N != 1 {
+		return 0, unix.EIO
+	}
+
+	n := sleepInflight.Add(1)
+	for {
+		m := sleepMaxInflight.Load()
+		if n <= m || sleepMaxInflight.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	time.Sleep(time.Duration(req.Arr[0].D) * time.Microsecond)
+	sleepInflight.Add(-1)
+	return 0, nil
+}
+
+// sleep makes count sleep RPCs of d from each of streams goroutines.
+func sleep(c *lisafs.Client, streams, count int, d time.Duration) error {
+	req := lisafs.MsgDynamic{
+		N:   1,
+		Arr: []lisafs.MsgSimple{{D: uint64(d / time.Microsecond)}},
+	}
+	var resp lisafs.EmptyMessage
+	var wg sync.WaitGroup
+	errs := make(chan error, streams)
+	for i := 0; i < streams; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < count; j++ {
+				if err := c.SndRcvMessage(sleepMsgID, uint32(req.SizeBytes()), req.MarshalBytes, resp.CheckedUnmarshal, nil, req.String, resp.String); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// TestMaxConcurrentRequests tests that the server does not handle more
+// requests concurrently than allowed, but handles as many as allowed.
+func TestMaxConcurrentRequests(t *testing.T) {
+	for _, tc := range []struct {
+		maxChannels int
+		maxRequests int
+		want        int32
+	}{
+		{maxChannels: 8, maxRequests: 3, want: 3},
+		{maxChannels: 8, maxRequests: 0, want: 8},
+	} {
+		t.Run(fmt.Sprintf("channels.%d/requests.%d", tc.maxChannels, tc.maxRequests), func(t *testing.T) {
+			opts := lisafs.ServerOpts{
+				MaxChannels:           tc.maxChannels,
+				MaxConcurrentRequests: tc.maxRequests,
+			}
+			runServerClientOpts(t, opts, tc.maxChannels, func(c *lisafs.Client) {
+				sleepMaxInflight.Store(0)
+				// Use as many streams as channels, so that no request
+				// falls back to the socket.
+				if err := sleep(c, tc.maxChannels, 20, 2*time.Millisecond); err != nil {
+					t.Fatalf("sleep RPC failed: %v", err)
+				}
+				if got := sleepMaxInflight.Load(); got > tc.want {
+					t.Errorf("got %d concurrent requests, want at most %d", got, tc.want)
+				} else if got < tc.want {
+					// Not an error, as this depends on scheduling.
+					t.Logf("got %d concurrent requests, want %d", got, tc.want)
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkParallelIO measures the throughput of RPCs that block for 100us,
+// like RPCs doing I/O, from an increasing number of concurrent streams. With
+// enough channels, the throughput scales with the number of streams.
+func BenchmarkParallelIO(b *testing.B) {
+	for _, channels := range []int{0, 32} {
+		for _, streams := range []int{1, 2, 4, 8, 16, 32} {
+			b.Run(fmt.Sprintf("channels.%d/streams.%d", channels, streams), func(b *testing.B) {
+				opts := lisafs.ServerOpts{MaxChannels: channels}
+				runServerClientOpts(b, opts, channels, func(c *lisafs.Client) {
+					b.ResetTimer()
+					if err := sleep(c, streams, (b.N+streams-1)/streams, 100*time.Microsecond); err != nil {
+						b.Fatalf("sleep RPC failed: %v", err)
+					}
+				})
+			})
+		}
+	}
+}
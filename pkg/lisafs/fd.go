@@ -549,6 +549,15 @@ type ControlFDImpl interface {
 	//
 	// On the server, RemoveXattr has a write concurrency guarantee.
 	RemoveXattr(name string) error
+
+	// ReadDirFiles reads the contents of regular files of at most maxFileSize
+	// bytes in the directory represented by this FD, and passes them to
+	// recordFile along with their stat results. recordFile returns false if
+	// the file could not be recorded because the response is full, in which
+	// case ReadDirFiles must stop. Files that can't be read may be skipped.
+	//
+	// On the server, ReadDirFiles has a read concurrency guarantee.
+	ReadDirFiles(maxFileSize uint32, recordFile func(PackedFile) bool) error
 }
 
 // OpenFDImpl contains implementation details for a OpenFD. Implementations of
@@ -599,6 +608,19 @@ type OpenFDImpl interface {
 	// On the server, Allocate has a write concurrency guarantee.
 	Allocate(mode, off, length uint64) error
 
+	// SyncRange is similar to sync_file_range(2). flags is a combination of
+	// linux.SYNC_FILE_RANGE_* flags.
+	//
+	// On the server, SyncRange has a read concurrency guarantee.
+	SyncRange(off, length uint64, flags uint32) error
+
+	// SetWriteHint sets the expected relative write life time of data written
+	// via this open FD, as with fcntl(2) F_SET_RW_HINT. hint is one of
+	// linux.RWH_WRITE_LIFE_*.
+	//
+	// On the server, SetWriteHint has a read concurrency guarantee.
+	SetWriteHint(hint uint64) error
+
 	// Flush can be used to clean up the file state. Behavior is
 	// implementation-specific.
 	//
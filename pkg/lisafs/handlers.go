@@ -46,38 +46,41 @@ const (
 type RPCHandler func(c *Connection, comm Communicator, payloadLen uint32) (uint32, error)
 
 var handlers = [...]RPCHandler{
-	Error:        ErrorHandler,
-	Mount:        MountHandler,
-	Channel:      ChannelHandler,
-	FStat:        FStatHandler,
-	SetStat:      SetStatHandler,
-	Walk:         WalkHandler,
-	WalkStat:     WalkStatHandler,
-	OpenAt:       OpenAtHandler,
-	OpenCreateAt: OpenCreateAtHandler,
-	Close:        CloseHandler,
-	FSync:        FSyncHandler,
-	PWrite:       PWriteHandler,
-	PRead:        PReadHandler,
-	MkdirAt:      MkdirAtHandler,
-	MknodAt:      MknodAtHandler,
-	SymlinkAt:    SymlinkAtHandler,
-	LinkAt:       LinkAtHandler,
-	FStatFS:      FStatFSHandler,
-	FAllocate:    FAllocateHandler,
-	ReadLinkAt:   ReadLinkAtHandler,
-	Flush:        FlushHandler,
-	UnlinkAt:     UnlinkAtHandler,
-	RenameAt:     RenameAtHandler,
-	Getdents64:   Getdents64Handler,
-	FGetXattr:    FGetXattrHandler,
-	FSetXattr:    FSetXattrHandler,
-	FListXattr:   FListXattrHandler,
-	FRemoveXattr: FRemoveXattrHandler,
-	Connect:      ConnectHandler,
-	BindAt:       BindAtHandler,
-	Listen:       ListenHandler,
-	Accept:       AcceptHandler,
+	Error:         ErrorHandler,
+	Mount:         MountHandler,
+	Channel:       ChannelHandler,
+	FStat:         FStatHandler,
+	SetStat:       SetStatHandler,
+	Walk:          WalkHandler,
+	WalkStat:      WalkStatHandler,
+	OpenAt:        OpenAtHandler,
+	OpenCreateAt:  OpenCreateAtHandler,
+	Close:         CloseHandler,
+	FSync:         FSyncHandler,
+	PWrite:        PWriteHandler,
+	PRead:         PReadHandler,
+	MkdirAt:       MkdirAtHandler,
+	MknodAt:       MknodAtHandler,
+	SymlinkAt:     SymlinkAtHandler,
+	LinkAt:        LinkAtHandler,
+	FStatFS:       FStatFSHandler,
+	FAllocate:     FAllocateHandler,
+	ReadLinkAt:    ReadLinkAtHandler,
+	Flush:         FlushHandler,
+	UnlinkAt:      UnlinkAtHandler,
+	RenameAt:      RenameAtHandler,
+	Getdents64:    Getdents64Handler,
+	FGetXattr:     FGetXattrHandler,
+	FSetXattr:     FSetXattrHandler,
+	FListXattr:    FListXattrHandler,
+	FRemoveXattr:  FRemoveXattrHandler,
+	Connect:       ConnectHandler,
+	BindAt:        BindAtHandler,
+	Listen:        ListenHandler,
+	Accept:        AcceptHandler,
+	FSyncRange:    FSyncRangeHandler,
+	FSetWriteHint: FSetWriteHintHandler,
+	ReadDirFiles:  ReadDirFilesHandler,
 }
 
 // ErrorHandler handles Error message.
@@ -981,6 +984,43 @@ func FAllocateHandler(c *Connection, comm Communicator, payloadLen uint32) (uint
 	})
 }
 
+// FSyncRangeHandler handles the FSyncRange RPC.
+func FSyncRangeHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
+	var req FSyncRangeReq
+	if _, ok := req.CheckedUnmarshal(comm.PayloadBuf(payloadLen)); !ok {
+		return 0, unix.EIO
+	}
+
+	fd, err := c.lookupOpenFD(req.FD)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.DecRef(nil)
+
+	// There is no response message for this.
+	return 0, fd.controlFD.safelyRead(func() error {
+		return fd.impl.SyncRange(req.Offset, req.Length, req.Flags)
+	})
+}
+
+// FSetWriteHintHandler handles the FSetWriteHint RPC.
+func FSetWriteHintHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
+	var req FSetWriteHintReq
+	if _, ok := req.CheckedUnmarshal(comm.PayloadBuf(payloadLen)); !ok {
+		return 0, unix.EIO
+	}
+
+	fd, err := c.lookupOpenFD(req.FD)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.DecRef(nil)
+
+	return 0, fd.controlFD.safelyRead(func() error {
+		return fd.impl.SetWriteHint(req.Hint)
+	})
+}
+
 // ReadLinkAtHandler handles the ReadLinkAt RPC.
 func ReadLinkAtHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
 	var req ReadLinkAtReq
@@ -1384,6 +1424,60 @@ func Getdents64Handler(c *Connection, comm Communicator, payloadLen uint32) (uin
 	return payloadBufPos, nil
 }
 
+// ReadDirFilesHandler handles the ReadDirFiles RPC.
+func ReadDirFilesHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
+	var req ReadDirFilesReq
+	if _, ok := req.CheckedUnmarshal(comm.PayloadBuf(payloadLen)); !ok {
+		return 0, unix.EIO
+	}
+
+	fd, err := c.lookupControlFD(req.DirFD)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.DecRef(nil)
+	if !fd.IsDir() {
+		return 0, unix.ENOTDIR
+	}
+
+	// We will manually marshal the response ReadDirFilesResp, as in
+	// Getdents64Handler.
+
+	// numFiles is the number of files marshalled into the payload.
+	var numFiles primitive.Uint16
+	// The payload starts with numFiles, files go right after that.
+	payloadBufPos := uint32(numFiles.SizeBytes())
+	payloadBuf := comm.PayloadBuf(payloadBufPos)
+	var totalSize uint32
+	if err := fd.safelyRead(func() error {
+		if fd.node.isDeleted() {
+			return unix.EINVAL
+		}
+		return fd.impl.ReadDirFiles(req.MaxFileSize, func(f PackedFile) bool {
+			size := uint32(f.SizeBytes())
+			if numFiles == math.MaxUint16 ||
+				uint64(totalSize)+uint64(len(f.Data)) > uint64(req.MaxTotalSize) ||
+				uint64(payloadBufPos)+uint64(size) > uint64(c.maxMessageSize) {
+				return false
+			}
+			if int(payloadBufPos+size) > len(payloadBuf) {
+				payloadBuf = comm.PayloadBuf(payloadBufPos + size)
+			}
+			f.MarshalBytes(payloadBuf[payloadBufPos:])
+			payloadBufPos += size
+			totalSize += uint32(len(f.Data))
+			numFiles++
+			return true
+		})
+	}); err != nil {
+		return 0, err
+	}
+
+	// The number of files goes at the beginning of the payload.
+	numFiles.MarshalUnsafe(payloadBuf)
+	return payloadBufPos, nil
+}
+
 // FGetXattrHandler handles the FGetXattr RPC.
 func FGetXattrHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
 	var req FGetXattrReq
@@ -0,0 +1,118 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lisafs
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// rpcTracker tracks the RPC in flight on a communicator, if any, so that
+// stalled RPCs can be detected.
+type rpcTracker struct {
+	// start is the time at which the RPC in flight was sent, in nanoseconds
+	// since the Unix epoch, or 0 if no RPC is in flight.
+	start atomicbitops.Int64
+
+	// mid is the message ID of the RPC in flight.
+	mid atomicbitops.Uint32
+}
+
+func (t *rpcTracker) begin(m MID) {
+	t.mid.Store(uint32(m))
+	t.start.Store(time.Now().UnixNano())
+}
+
+func (t *rpcTracker) end() {
+	t.start.Store(0)
+}
+
+// InflightRPC describes an RPC that a Client is waiting on.
+type InflightRPC struct {
+	// Comm describes the communicator the RPC was sent on.
+	Comm string
+
+	// MID is the message ID of the RPC.
+	MID MID
+
+	// Start is the time at which the RPC was sent.
+	Start time.Time
+}
+
+// clients tracks all live clients, for InflightRPCs.
+var clients struct {
+	mu sync.Mutex
+	m  map[*Client]struct{}
+}
+
+func registerClient(c *Client) {
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
+	if clients.m == nil {
+		clients.m = make(map[*Client]struct{})
+	}
+	clients.m[c] = struct{}{}
+}
+
+func unregisterClient(c *Client) {
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
+	delete(clients.m, c)
+}
+
+// InflightRPCs returns the RPCs that all clients are currently waiting on.
+func InflightRPCs() []InflightRPC {
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
+	var rpcs []InflightRPC
+	for c := range clients.m {
+		rpcs = c.appendInflightRPCs(rpcs)
+	}
+	return rpcs
+}
+
+// appendInflightRPCs appends the RPCs that c is currently waiting on to rpcs.
+func (c *Client) appendInflightRPCs(rpcs []InflightRPC) []InflightRPC {
+	add := func(comm Communicator, t *rpcTracker) {
+		if start := t.start.Load(); start != 0 {
+			rpcs = append(rpcs, InflightRPC{
+				Comm:  comm.String(),
+				MID:   MID(t.mid.Load()),
+				Start: time.Unix(0, start),
+			})
+		}
+	}
+	add(c.sockComm, &c.sockComm.rpc)
+	c.channelsMu.Lock()
+	for _, ch := range c.channels {
+		add(ch, &ch.rpc)
+	}
+	c.channelsMu.Unlock()
+	return rpcs
+}
+
+// rpcTrackerOf returns the rpcTracker of comm.
+func rpcTrackerOf(comm Communicator) *rpcTracker {
+	switch t := comm.(type) {
+	case *sockCommunicator:
+		return &t.rpc
+	case *channel:
+		return &t.rpc
+	default:
+		return nil
+	}
+}
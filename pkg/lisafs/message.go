@@ -172,6 +172,16 @@ const (
 
 	// Accept is analogous to accept4(2).
 	Accept MID = 31
+
+	// FSyncRange is analogous to sync_file_range(2).
+	FSyncRange MID = 32
+
+	// FSetWriteHint is analogous to fcntl(2) with F_SET_RW_HINT.
+	FSetWriteHint MID = 33
+
+	// ReadDirFiles is analogous to reading the contents of all small regular
+	// files in a directory at once.
+	ReadDirFiles MID = 34
 )
 
 const (
@@ -1236,6 +1246,181 @@ func (*FAllocateResp) String() string {
 	return "FAllocateResp{}"
 }
 
+// FSyncRangeReq is used to request to sync_file_range(2) an FD. This has no
+// response.
+//
+// +marshal boundCheck
+type FSyncRangeReq struct {
+	FD     FDID
+	Offset uint64
+	Length uint64
+	Flags  uint32
+	_      uint32 // Need to make struct packed.
+}
+
+// String implements fmt.Stringer.String.
+func (s *FSyncRangeReq) String() string {
+	return fmt.Sprintf("FSyncRangeReq{FD: %d, Offset: %d, Length: %d, Flags: %#x}", s.FD, s.Offset, s.Length, s.Flags)
+}
+
+// FSyncRangeResp is an empty response to FSyncRangeReq.
+type FSyncRangeResp struct{ EmptyMessage }
+
+// String implements fmt.Stringer.String.
+func (*FSyncRangeResp) String() string {
+	return "FSyncRangeResp{}"
+}
+
+// FSetWriteHintReq is used to request to set the write life time hint of an
+// FD, as with fcntl(2) F_SET_RW_HINT. This has no response.
+//
+// +marshal boundCheck
+type FSetWriteHintReq struct {
+	FD   FDID
+	Hint uint64
+}
+
+// String implements fmt.Stringer.String.
+func (w *FSetWriteHintReq) String() string {
+	return fmt.Sprintf("FSetWriteHintReq{FD: %d, Hint: %d}", w.FD, w.Hint)
+}
+
+// FSetWriteHintResp is an empty response to FSetWriteHintReq.
+type FSetWriteHintResp struct{ EmptyMessage }
+
+// String implements fmt.Stringer.String.
+func (*FSetWriteHintResp) String() string {
+	return "FSetWriteHintResp{}"
+}
+
+// ReadDirFilesReq is used to read the contents of small regular files in the
+// directory represented by DirFD, which must be a control FD.
+//
+// +marshal boundCheck
+type ReadDirFilesReq struct {
+	DirFD FDID
+	// MaxFileSize is the size of the largest file whose contents are returned.
+	MaxFileSize uint32
+	// MaxTotalSize bounds the total size of the returned file contents.
+	MaxTotalSize uint32
+}
+
+// String implements fmt.Stringer.String.
+func (r *ReadDirFilesReq) String() string {
+	return fmt.Sprintf("ReadDirFilesReq{DirFD: %d, MaxFileSize: %d, MaxTotalSize: %d}", r.DirFD, r.MaxFileSize, r.MaxTotalSize)
+}
+
+// PackedFile holds the stat results and the full contents of a regular file
+// returned by ReadDirFiles. In memory, the file contents are preceded by a
+// uint32 denoting their length.
+type PackedFile struct {
+	Stat linux.Statx
+	Name SizedString
+	Data []byte
+}
+
+// String implements fmt.Stringer.String.
+func (f *PackedFile) String() string {
+	return fmt.Sprintf("PackedFile{Stat: %s, Name: %s, Data: [...%d bytes...]}", f.Stat.String(), f.Name, len(f.Data))
+}
+
+// SizeBytes implements marshal.Marshallable.SizeBytes.
+func (f *PackedFile) SizeBytes() int {
+	return f.Stat.SizeBytes() + f.Name.SizeBytes() + (*primitive.Uint32)(nil).SizeBytes() + len(f.Data)
+}
+
+// MarshalBytes implements marshal.Marshallable.MarshalBytes.
+func (f *PackedFile) MarshalBytes(dst []byte) []byte {
+	dst = f.Stat.MarshalUnsafe(dst)
+	dst = f.Name.MarshalBytes(dst)
+	dataLen := primitive.Uint32(len(f.Data))
+	dst = dataLen.MarshalUnsafe(dst)
+	return dst[copy(dst[:dataLen], f.Data):]
+}
+
+// CheckedUnmarshal implements marshal.CheckedMarshallable.CheckedUnmarshal.
+// f.Data is allocated, since src is reused for later messages.
+func (f *PackedFile) CheckedUnmarshal(src []byte) ([]byte, bool) {
+	f.Name = ""
+	f.Data = nil
+	if f.SizeBytes() > len(src) {
+		return src, false
+	}
+	srcRemain := f.Stat.UnmarshalUnsafe(src)
+	srcRemain, ok := f.Name.CheckedUnmarshal(srcRemain)
+	if !ok {
+		return src, false
+	}
+	var dataLen primitive.Uint32
+	if srcRemain, ok = dataLen.CheckedUnmarshal(srcRemain); !ok || uint32(dataLen) > uint32(len(srcRemain)) {
+		return src, false
+	}
+	f.Data = make([]byte, dataLen)
+	return srcRemain[copy(f.Data, srcRemain[:dataLen]):], true
+}
+
+// ReadDirFilesResp is used to communicate ReadDirFiles results. In memory, the
+// files array is preceded by a uint16 denoting the array length.
+type ReadDirFilesResp struct {
+	Files []PackedFile
+}
+
+// String implements fmt.Stringer.String.
+func (r *ReadDirFilesResp) String() string {
+	var b strings.Builder
+	b.WriteString("[")
+	for i := range r.Files {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(r.Files[i].String())
+	}
+	b.WriteString("]")
+	return fmt.Sprintf("ReadDirFilesResp{Files: %s}", b.String())
+}
+
+// SizeBytes implements marshal.Marshallable.SizeBytes.
+func (r *ReadDirFilesResp) SizeBytes() int {
+	ret := (*primitive.Uint16)(nil).SizeBytes()
+	for i := range r.Files {
+		ret += r.Files[i].SizeBytes()
+	}
+	return ret
+}
+
+// MarshalBytes implements marshal.Marshallable.MarshalBytes.
+func (r *ReadDirFilesResp) MarshalBytes(dst []byte) []byte {
+	numFiles := primitive.Uint16(len(r.Files))
+	dst = numFiles.MarshalUnsafe(dst)
+	for i := range r.Files {
+		dst = r.Files[i].MarshalBytes(dst)
+	}
+	return dst
+}
+
+// CheckedUnmarshal implements marshal.CheckedMarshallable.CheckedUnmarshal.
+func (r *ReadDirFilesResp) CheckedUnmarshal(src []byte) ([]byte, bool) {
+	r.Files = r.Files[:0]
+	if r.SizeBytes() > len(src) {
+		return src, false
+	}
+	var numFiles primitive.Uint16
+	srcRemain := numFiles.UnmarshalUnsafe(src)
+	if cap(r.Files) < int(numFiles) {
+		r.Files = make([]PackedFile, numFiles)
+	} else {
+		r.Files = r.Files[:numFiles]
+	}
+
+	var ok bool
+	for i := range r.Files {
+		if srcRemain, ok = r.Files[i].CheckedUnmarshal(srcRemain); !ok {
+			return src, false
+		}
+	}
+	return srcRemain, true
+}
+
 // ReadLinkAtReq is used to readlinkat(2) at the specified FD.
 //
 // +marshal boundCheck
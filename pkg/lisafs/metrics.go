@@ -0,0 +1,95 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lisafs
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/metric"
+)
+
+// rpcNames maps message IDs to the names used in the /gofer/rpcs metric.
+var rpcNames = [...]string{
+	Error:         "Error",
+	Mount:         "Mount",
+	Channel:       "Channel",
+	FStat:         "FStat",
+	SetStat:       "SetStat",
+	Walk:          "Walk",
+	WalkStat:      "WalkStat",
+	OpenAt:        "OpenAt",
+	OpenCreateAt:  "OpenCreateAt",
+	Close:         "Close",
+	FSync:         "FSync",
+	PWrite:        "PWrite",
+	PRead:         "PRead",
+	MkdirAt:       "MkdirAt",
+	MknodAt:       "MknodAt",
+	SymlinkAt:     "SymlinkAt",
+	LinkAt:        "LinkAt",
+	FStatFS:       "FStatFS",
+	FAllocate:     "FAllocate",
+	ReadLinkAt:    "ReadLinkAt",
+	Flush:         "Flush",
+	Connect:       "Connect",
+	UnlinkAt:      "UnlinkAt",
+	RenameAt:      "RenameAt",
+	Getdents64:    "Getdents64",
+	FGetXattr:     "FGetXattr",
+	FSetXattr:     "FSetXattr",
+	FListXattr:    "FListXattr",
+	FRemoveXattr:  "FRemoveXattr",
+	BindAt:        "BindAt",
+	Listen:        "Listen",
+	Accept:        "Accept",
+	FSyncRange:    "FSyncRange",
+	FSetWriteHint: "FSetWriteHint",
+	ReadDirFiles:  "ReadDirFiles",
+}
+
+// String implements fmt.Stringer.String.
+func (m MID) String() string {
+	if int(m) < len(rpcNames) {
+		return rpcNames[m]
+	}
+	return fmt.Sprintf("MID(%d)", uint16(m))
+}
+
+var (
+	// rpcFields maps message IDs to their field value in rpcCounter. As in
+	// kernel.syscallNumbers, each element is a slice so that incrementing
+	// rpcCounter does not allocate.
+	rpcFields [len(rpcNames)][]*metric.FieldValue
+
+	// rpcCounter counts the RPCs made by clients, broken down by message type.
+	rpcCounter *metric.Uint64Metric
+)
+
+func init() {
+	allowedValues := make([]*metric.FieldValue, len(rpcNames))
+	for m, name := range rpcNames {
+		v := &metric.FieldValue{Value: name}
+		allowedValues[m] = v
+		rpcFields[m] = []*metric.FieldValue{v}
+	}
+	rpcCounter = metric.MustCreateNewUint64Metric("/gofer/rpcs", false /* sync */, "Number of lisafs RPCs made to gofers, broken down by message type.", metric.NewField("rpc", allowedValues...))
+}
+
+// incrementRPCCounter increments the /gofer/rpcs metric for m.
+func incrementRPCCounter(m MID) {
+	if int(m) < len(rpcFields) {
+		rpcCounter.Increment(rpcFields[m]...)
+	}
+}
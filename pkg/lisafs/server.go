@@ -62,6 +62,18 @@ type ServerOpts struct {
 	// AllocateOnDeleted is set to true if it's safe to call OpenFDImpl.Allocate
 	// for deleted files.
 	AllocateOnDeleted bool
+
+	// MaxChannels is the maximum number of channels a client can create on
+	// each connection. Each channel is serviced by its own goroutine, so this
+	// is the size of the connection's worker pool. If zero, a default based
+	// on GOMAXPROCS is used.
+	MaxChannels int
+
+	// MaxConcurrentRequests is the maximum number of requests that are handled
+	// concurrently on each connection. Further requests wait until an earlier
+	// one completes. If zero, the number of concurrent requests is only
+	// limited by the number of channels.
+	MaxConcurrentRequests int
 }
 
 // Init must be called before first use of the server.
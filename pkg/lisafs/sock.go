@@ -41,6 +41,7 @@ type sockCommunicator struct {
 	fdTracker
 	sock *unet.Socket
 	buf  []byte
+	rpc  rpcTracker
 }
 
 var _ Communicator = (*sockCommunicator)(nil)
@@ -78,6 +78,7 @@ var localFSTests = map[string]TestFunc{
 	"Mknod":           testMknod,
 	"UDS":             testUDS,
 	"Getdents":        testGetdents,
+	"ReadDirFiles":    testReadDirFiles,
 }
 
 // RunTest runs the passed test function as a subtest.
@@ -104,7 +105,7 @@ func RunTest(t *testing.T, tester Tester, testName string, testFn TestFunc, moun
 	if err != nil {
 		t.Fatalf("client creation failed: %v", err)
 	}
-	if err := c.StartChannels(); err != nil {
+	if err := c.StartChannels(0 /* n */); err != nil {
 		t.Fatalf("failed to start channels: %v", err)
 	}
 
@@ -701,3 +702,75 @@ func testGetdents(ctx context.Context, t *testing.T, tester Tester, root lisafs.
 		}
 	}
 }
+
+func testReadDirFiles(ctx context.Context, t *testing.T, tester Tester, root lisafs.ClientFD) {
+	if !root.Client().IsSupported(lisafs.ReadDirFiles) {
+		t.Skip("ReadDirFiles is not supported")
+	}
+	tempDir, _ := mkdir(ctx, t, root, "tempDir")
+	defer closeFD(ctx, t, tempDir)
+	defer unlinkFile(ctx, t, root, "tempDir", true /* isDir */)
+
+	// Create small files, a file that is too large and a subdirectory.
+	const maxFileSize = 16
+	want := map[string][]byte{
+		"empty": {},
+		"small": []byte("hello"),
+		"max":   bytes.Repeat([]byte{'a'}, maxFileSize),
+	}
+	for name, data := range want {
+		controlFD, _, openFD, hostFD := openCreateFile(ctx, t, tempDir, name)
+		unix.Close(hostFD)
+		if err := writeFD(ctx, t, openFD, 0, data); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		closeFD(ctx, t, openFD)
+		closeFD(ctx, t, controlFD)
+		defer unlinkFile(ctx, t, tempDir, name, false /* isDir */)
+	}
+	controlFD, _, openFD, hostFD := openCreateFile(ctx, t, tempDir, "large")
+	unix.Close(hostFD)
+	if err := writeFD(ctx, t, openFD, 0, bytes.Repeat([]byte{'b'}, maxFileSize+1)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	closeFD(ctx, t, openFD)
+	closeFD(ctx, t, controlFD)
+	defer unlinkFile(ctx, t, tempDir, "large", false /* isDir */)
+	subDir, _ := mkdir(ctx, t, tempDir, "subDir")
+	closeFD(ctx, t, subDir)
+	defer unlinkFile(ctx, t, tempDir, "subDir", true /* isDir */)
+
+	files, err := tempDir.ReadDirFiles(ctx, maxFileSize, 1<<20)
+	if err != nil {
+		t.Fatalf("ReadDirFiles failed: %v", err)
+	}
+	if len(files) != len(want) {
+		t.Errorf("ReadDirFiles returned %d files, want %d", len(files), len(want))
+	}
+	for _, f := range files {
+		data, ok := want[string(f.Name)]
+		if !ok {
+			t.Errorf("ReadDirFiles returned unexpected file %q", f.Name)
+			continue
+		}
+		if !bytes.Equal(f.Data, data) {
+			t.Errorf("ReadDirFiles returned %q for file %q, want %q", f.Data, f.Name, data)
+		}
+		if f.Stat.Size != uint64(len(data)) || f.Stat.Mode&unix.S_IFMT != unix.S_IFREG {
+			t.Errorf("ReadDirFiles returned unexpected stat for file %q: %+v", f.Name, f.Stat)
+		}
+	}
+
+	// The total size of file contents is bounded.
+	files, err = tempDir.ReadDirFiles(ctx, maxFileSize, maxFileSize)
+	if err != nil {
+		t.Fatalf("ReadDirFiles failed: %v", err)
+	}
+	var total int
+	for _, f := range files {
+		total += len(f.Data)
+	}
+	if total > maxFileSize {
+		t.Errorf("ReadDirFiles returned %d bytes, want at most %d", total, maxFileSize)
+	}
+}
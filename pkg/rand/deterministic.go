@@ -0,0 +1,64 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rand
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"io"
+
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// deterministicReader implements a threadsafe io.Reader that returns a
+// pseudorandom stream determined by its seed.
+type deterministicReader struct {
+	mu sync.Mutex
+	s  cipher.Stream
+}
+
+// NewDeterministicReader returns an io.Reader that returns the same
+// pseudorandom stream for the same seed and stream number. Readers with the
+// same seed but different stream numbers return independent streams, so that
+// the order in which different consumers read doesn't affect what each of
+// them reads. The streams are the AES-256-CTR keystream of a key made of the
+// seed and stream number, so they are unpredictable to anyone who doesn't know
+// the seed, but they are only as secret as the seed is.
+//
+// It is intended for the randomness visible to the application in
+// deterministic execution, and must not be used where Reader's randomness is
+// required.
+func NewDeterministicReader(seed, stream uint64) io.Reader {
+	var key [32]byte
+	binary.LittleEndian.PutUint64(key[:], seed)
+	binary.LittleEndian.PutUint64(key[8:], stream)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		// Only possible for invalid key sizes.
+		panic(err)
+	}
+	var iv [aes.BlockSize]byte
+	return &deterministicReader{s: cipher.NewCTR(block, iv[:])}
+}
+
+// Read implements io.Reader.Read.
+func (d *deterministicReader) Read(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	clear(p)
+	d.s.XORKeyStream(p, p)
+	return len(p), nil
+}
@@ -24,6 +24,7 @@ import (
 	"gvisor.dev/gvisor/pkg/cpuid"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/rand"
 	"gvisor.dev/gvisor/pkg/sentry/arch/fpu"
 	"gvisor.dev/gvisor/pkg/sentry/limits"
 )
@@ -188,12 +189,14 @@ type contextInterface interface {
 	// NewMmapLayout returns a layout for a new MM, where MinAddr for the
 	// returned layout must be no lower than min, and MaxAddr for the returned
 	// layout must be no higher than max. Repeated calls to NewMmapLayout may
-	// return different layouts.
-	NewMmapLayout(min, max hostarch.Addr, limits *limits.LimitSet) (MmapLayout, error)
+	// return different layouts, unless personality, the personality(2) of
+	// the task that the MM is created for, includes ADDR_NO_RANDOMIZE. The
+	// layout is randomized using rng.
+	NewMmapLayout(min, max hostarch.Addr, limits *limits.LimitSet, personality uint32, rng *rand.RNG) (MmapLayout, error)
 
 	// PIELoadAddress returns a preferred load address for a
-	// position-independent executable within l.
-	PIELoadAddress(l MmapLayout) hostarch.Addr
+	// position-independent executable within l, randomized using rng.
+	PIELoadAddress(l MmapLayout, rng *rand.RNG) hostarch.Addr
 
 	// Hack around our package dependences being too broken to support the
 	// equivalent of arch_ptrace():
@@ -279,6 +282,11 @@ type MmapLayout struct {
 	// allocations to maintain a proper gap between the stack and
 	// TopDownBase.
 	MaxStackRand uint64
+
+	// If NoRandomize is true, addresses in the layout, the stack and
+	// position-independent executables are not randomized, as for
+	// personality(2) ADDR_NO_RANDOMIZE.
+	NoRandomize bool
 }
 
 // Valid returns true if this layout is valid.
@@ -21,6 +21,7 @@ import (
 	"fmt"
 
 	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/marshal"
 	"gvisor.dev/gvisor/pkg/marshal/primitive"
@@ -140,6 +141,12 @@ func (c *Context64) Stack() uintptr {
 	return uintptr(c.Regs.Sp)
 }
 
+// FramePointer returns the current frame pointer. It is only meaningful in
+// code that maintains frame pointers.
+func (c *Context64) FramePointer() uintptr {
+	return uintptr(c.Regs.Regs[29])
+}
+
 // SetStack sets the current stack pointer.
 func (c *Context64) SetStack(value uintptr) {
 	c.Regs.Sp = uint64(value)
@@ -182,12 +189,12 @@ func (c *Context64) Width() uint {
 }
 
 // mmapRand returns a random adjustment for randomizing an mmap layout.
-func mmapRand(max uint64) hostarch.Addr {
-	return hostarch.Addr(rand.Int63n(int64(max))).RoundDown()
+func mmapRand(rng *rand.RNG, max uint64) hostarch.Addr {
+	return hostarch.Addr(rng.Int63n(int64(max))).RoundDown()
 }
 
 // NewMmapLayout implements Context.NewMmapLayout consistently with Linux.
-func (c *Context64) NewMmapLayout(min, max hostarch.Addr, r *limits.LimitSet) (MmapLayout, error) {
+func (c *Context64) NewMmapLayout(min, max hostarch.Addr, r *limits.LimitSet, personality uint32, rng *rand.RNG) (MmapLayout, error) {
 	min, ok := min.RoundUp()
 	if !ok {
 		return MmapLayout{}, unix.EINVAL
@@ -213,7 +220,7 @@ func (c *Context64) NewMmapLayout(min, max hostarch.Addr, r *limits.LimitSet) (M
 		gap = maxGap
 	}
 	defaultDir := MmapTopDown
-	if stackSize.Cur == limits.Infinity {
+	if stackSize.Cur == limits.Infinity || personality&linux.ADDR_COMPAT_LAYOUT != 0 {
 		defaultDir = MmapBottomUp
 	}
 
@@ -229,7 +236,11 @@ func (c *Context64) NewMmapLayout(min, max hostarch.Addr, r *limits.LimitSet) (M
 		}
 	}
 
-	rnd := mmapRand(uint64(maxRand))
+	noRandomize := personality&linux.ADDR_NO_RANDOMIZE != 0
+	var rnd hostarch.Addr
+	if !noRandomize {
+		rnd = mmapRand(rng, uint64(maxRand))
+	}
 	l := MmapLayout{
 		MinAddr: min,
 		MaxAddr: max,
@@ -242,6 +253,7 @@ func (c *Context64) NewMmapLayout(min, max hostarch.Addr, r *limits.LimitSet) (M
 		// our stack gap. Stack allocations must use that max
 		// randomization to avoiding eating into the gap.
 		MaxStackRand: uint64(maxRand),
+		NoRandomize:  noRandomize,
 	}
 
 	// Final sanity check on the layout.
@@ -253,7 +265,7 @@ func (c *Context64) NewMmapLayout(min, max hostarch.Addr, r *limits.LimitSet) (M
 }
 
 // PIELoadAddress implements Context.PIELoadAddress.
-func (c *Context64) PIELoadAddress(l MmapLayout) hostarch.Addr {
+func (c *Context64) PIELoadAddress(l MmapLayout, rng *rand.RNG) hostarch.Addr {
 	base := preferredPIELoadAddr
 	max, ok := base.AddLength(maxMmapRand64)
 	if !ok {
@@ -268,7 +280,10 @@ func (c *Context64) PIELoadAddress(l MmapLayout) hostarch.Addr {
 		base = l.TopDownBase / 3 * 2
 	}
 
-	return base + mmapRand(maxMmapRand64)
+	if l.NoRandomize {
+		return base
+	}
+	return base + mmapRand(rng, maxMmapRand64)
 }
 
 // PtracePeekUser implements Context.PtracePeekUser.
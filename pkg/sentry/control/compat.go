@@ -0,0 +1,38 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+)
+
+// Compat includes compatibility report related RPC stubs.
+type Compat struct {
+	Kernel *kernel.Kernel
+}
+
+// CompatReport is the compatibility report of a sandbox.
+type CompatReport struct {
+	// Items are the unsupported features that the application used, most
+	// frequently used first.
+	Items []kernel.CompatItem `json:"items"`
+}
+
+// Report returns the features that the application used but that are not,
+// or only partially, supported by the sandbox.
+func (c *Compat) Report(_ *struct{}, out *CompatReport) error {
+	out.Items = c.Kernel.CompatReport()
+	return nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+)
+
+// Crashes includes crash report related RPC stubs.
+type Crashes struct {
+	Kernel *kernel.Kernel
+}
+
+// CrashReports are the crash reports of a sandbox.
+type CrashReports struct {
+	// Syscalls are the reports of sentry panics during syscall handling that
+	// killed the offending task rather than the sandbox, oldest first.
+	Syscalls []kernel.SyscallPanicReport `json:"syscalls"`
+}
+
+// Reports returns the crash reports of the sandbox.
+func (c *Crashes) Reports(_ *struct{}, out *CrashReports) error {
+	out.Syscalls = c.Kernel.SyscallPanicReports()
+	return nil
+}
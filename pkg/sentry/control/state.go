@@ -43,6 +43,16 @@ type SaveOpts struct {
 	// Metadata is the set of metadata to prepend to the state file.
 	Metadata map[string]string `json:"metadata"`
 
+	// Async indicates that the sandbox should keep running after it is saved.
+	// The sandbox is only paused while kernel state is saved; memory is
+	// written out while it runs, using copy-on-write to keep the saved state
+	// consistent.
+	Async bool `json:"async"`
+
+	// Precopied indicates that memory written out by Precopy and not
+	// written to since is omitted from the state.
+	Precopied bool `json:"precopied"`
+
 	// FilePayload contains the destination for the state.
 	urpc.FilePayload
 }
@@ -60,7 +70,18 @@ func (s *State) Save(o *SaveOpts, _ *struct{}) error {
 		Destination: o.FilePayload.Files[0],
 		Key:         o.Key,
 		Metadata:    o.Metadata,
+		Async:       o.Async,
+		Precopied:   o.Precopied,
 		Callback: func(err error) {
+			if o.Async {
+				// The sandbox keeps running.
+				if err == nil {
+					log.Infof("Async save succeeded")
+				} else {
+					log.Warningf("Async save failed: %v", err)
+				}
+				return
+			}
 			if err == nil {
 				log.Infof("Save succeeded: exiting...")
 				s.Kernel.SetSaveSuccess(false /* autosave */)
@@ -73,3 +94,53 @@ func (s *State) Save(o *SaveOpts, _ *struct{}) error {
 	}
 	return saveOpts.Save(s.Kernel.SupervisorContext(), s.Kernel, s.Watchdog)
 }
+
+// PrecopyOpts contains options for the Precopy RPC call.
+type PrecopyOpts struct {
+	// Key is used for the integrity check of the round.
+	Key []byte `json:"key"`
+
+	// Metadata is the round's metadata, including its compression level.
+	Metadata map[string]string `json:"metadata"`
+
+	// FilePayload contains the destination for the round.
+	urpc.FilePayload
+}
+
+// PrecopyResult is the result of the Precopy RPC call.
+type PrecopyResult struct {
+	// Pages is the number of pages written out by the round.
+	Pages uint64 `json:"pages"`
+
+	// DirtyPages is the number of pages written to since they were written
+	// out, which the next round would write out.
+	DirtyPages uint64 `json:"dirty_pages"`
+}
+
+// Precopy writes out a round of memory that has been written to since the
+// last round, while the system keeps running. A Save with Precopied set ends
+// the pre-copy, as does CancelPrecopy.
+func (s *State) Precopy(o *PrecopyOpts, res *PrecopyResult) error {
+	if len(o.FilePayload.Files) != 1 {
+		return ErrInvalidFiles
+	}
+	defer o.FilePayload.Files[0].Close()
+
+	precopyOpts := state.PrecopyOpts{
+		Destination: o.FilePayload.Files[0],
+		Key:         o.Key,
+		Metadata:    o.Metadata,
+	}
+	pages, dirty, err := precopyOpts.Precopy(s.Kernel)
+	if err != nil {
+		return err
+	}
+	*res = PrecopyResult{Pages: pages, DirtyPages: dirty}
+	return nil
+}
+
+// CancelPrecopy ends the pre-copy started by Precopy without saving.
+func (s *State) CancelPrecopy(_, _ *struct{}) error {
+	s.Kernel.CancelPrecopy()
+	return nil
+}
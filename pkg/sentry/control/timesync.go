@@ -0,0 +1,30 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+)
+
+// TimeSync includes time synchronization related RPC stubs.
+type TimeSync struct {
+	Kernel *kernel.Kernel
+}
+
+// State returns the time synchronization and entropy state of the sandbox.
+func (ts *TimeSync) State(_ *struct{}, out *kernel.TimeSyncState) error {
+	*out = ts.Kernel.TimeSyncState()
+	return nil
+}
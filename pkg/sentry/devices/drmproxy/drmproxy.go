@@ -0,0 +1,123 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package drmproxy implements proxying for DRM render nodes backed by the
+// host's virtio-gpu driver. It allows headless rendering workloads in the
+// sandbox, e.g. Mesa's virgl (OpenGL) and venus (Vulkan) drivers, to render
+// on the host GPU exposed to a VM through virtio-gpu.
+//
+// Only the subset of DRM core ioctls needed by render clients and the
+// virtio-gpu driver ioctls are proxied; buffer sharing through PRIME file
+// descriptors and fence file descriptors are not supported. Software
+// rasterizers such as SwiftShader and lavapipe render in application memory
+// and do not need a render node at all.
+package drmproxy
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/devutil"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// RenderNode describes a DRM render node exposed to the sandbox.
+type RenderNode struct {
+	// Name is the render node's file name in /dev/dri, e.g. "renderD128".
+	Name string
+
+	// Minor is the minor device number of /dev/dri/Name in the sandbox.
+	Minor uint32
+}
+
+// Register registers the devices of the given DRM render nodes in vfsObj.
+func Register(vfsObj *vfs.VirtualFilesystem, nodes []RenderNode) error {
+	for _, node := range nodes {
+		if node.Minor < linux.DRM_RENDER_MINOR_BASE || node.Minor > linux.DRM_RENDER_MINOR_MAX {
+			return fmt.Errorf("invalid minor device number %d for DRM render node %q", node.Minor, node.Name)
+		}
+		if err := vfsObj.RegisterDevice(vfs.CharDevice, linux.DRM_MAJOR, node.Minor, &renderDevice{
+			name: node.Name,
+		}, &vfs.RegisterDeviceOptions{
+			GroupName: "drm",
+		}); err != nil {
+			return fmt.Errorf("registering DRM render node %q: %w", node.Name, err)
+		}
+	}
+	return nil
+}
+
+// renderDevice implements vfs.Device for /dev/dri/renderD[0-9]+.
+//
+// +stateify savable
+type renderDevice struct {
+	name string
+}
+
+// Open implements vfs.Device.Open.
+func (dev *renderDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	devClient := devutil.GoferClientFromContext(ctx)
+	if devClient == nil {
+		log.Warningf("devutil.CtxDevGoferClient is not set")
+		return nil, linuxerr.ENOENT
+	}
+	devName := "dri/" + dev.name
+	hostFD, err := devClient.OpenAt(ctx, devName, opts.Flags)
+	if err != nil {
+		ctx.Warningf("drmproxy: failed to open host /dev/%s: %v", devName, err)
+		return nil, err
+	}
+	// Driver-specific ioctls are only understood for virtio-gpu; they may
+	// have entirely different semantics, including pointers that we would
+	// fail to translate, for other drivers.
+	name, err := hostDriverName(int32(hostFD))
+	if err != nil {
+		unix.Close(hostFD)
+		ctx.Warningf("drmproxy: failed to get driver of host /dev/%s: %v", devName, err)
+		return nil, err
+	}
+	if name != linux.VirtGPUDriverName {
+		unix.Close(hostFD)
+		ctx.Warningf("drmproxy: host /dev/%s is driven by unsupported driver %q", devName, name)
+		return nil, linuxerr.ENODEV
+	}
+	fd := &renderFD{
+		hostFD: int32(hostFD),
+	}
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		unix.Close(hostFD)
+		return nil, err
+	}
+	fd.memmapFile.fd = fd
+	return &fd.vfsfd, nil
+}
+
+// hostDriverName returns the name of the driver of the host DRM device file.
+func hostDriverName(hostFD int32) (string, error) {
+	name := make([]byte, 32)
+	version := linux.DRMVersion{
+		NameLen: uint64(len(name)),
+		Name:    addrOf(name),
+	}
+	if _, err := hostIoctl(hostFD, linux.DRM_IOCTL_NR_VERSION, &version, name); err != nil {
+		return "", err
+	}
+	return string(name[:min(version.NameLen, uint64(len(name)))]), nil
+}
@@ -0,0 +1,322 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drmproxy
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+const (
+	// maxVersionStringLen is the maximum length of each string returned by
+	// DRM_IOCTL_VERSION.
+	maxVersionStringLen = 4096
+
+	// maxCapsSize is the maximum size of a capability set returned by
+	// DRM_IOCTL_VIRTGPU_GET_CAPS.
+	maxCapsSize = 64 * 1024
+
+	// maxCommandSize is the maximum size of a command buffer submitted by
+	// DRM_IOCTL_VIRTGPU_EXECBUFFER or DRM_IOCTL_VIRTGPU_RESOURCE_CREATE_BLOB.
+	maxCommandSize = 16 << 20
+
+	// maxBoHandles is the maximum number of buffer objects referenced by a
+	// single DRM_IOCTL_VIRTGPU_EXECBUFFER.
+	maxBoHandles = 64 * 1024
+
+	// maxContextParams is the maximum number of parameters passed to
+	// DRM_IOCTL_VIRTGPU_CONTEXT_INIT.
+	maxContextParams = 64
+)
+
+// renderFD implements vfs.FileDescriptionImpl for /dev/dri/renderD[0-9]+.
+//
+// renderFD is not savable; we do not implement save/restore of host GPU
+// state.
+type renderFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	hostFD     int32
+	memmapFile renderFDMemmapFile
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *renderFD) Release(context.Context) {
+	unix.Close(int(fd.hostFD))
+}
+
+// ioctlArg is the argument of an application DRM ioctl.
+type ioctlArg struct {
+	t      *kernel.Task
+	cmd    uint32
+	argPtr hostarch.Addr
+}
+
+// size returns the number of bytes of the application's argument that
+// correspond to arg, which may be smaller or larger than the application's
+// definition of it.
+func (a *ioctlArg) size(arg marshal.Marshallable) int {
+	return min(int(linux.IOC_SIZE(a.cmd)), arg.SizeBytes())
+}
+
+// copyIn copies in the application's argument into arg. Fields that the
+// application's definition of the argument doesn't include are zeroed, as
+// they are by the host.
+func (a *ioctlArg) copyIn(arg marshal.Marshallable) error {
+	buf := make([]byte, arg.SizeBytes())
+	if (a.cmd>>linux.IOC_DIRSHIFT)&linux.IOC_WRITE != 0 {
+		if _, err := a.t.CopyInBytes(a.argPtr, buf[:a.size(arg)]); err != nil {
+			return err
+		}
+	}
+	arg.UnmarshalUnsafe(buf)
+	return nil
+}
+
+// copyOut copies out arg to the application's argument.
+func (a *ioctlArg) copyOut(arg marshal.Marshallable) error {
+	if (a.cmd>>linux.IOC_DIRSHIFT)&linux.IOC_READ == 0 {
+		return nil
+	}
+	buf := make([]byte, arg.SizeBytes())
+	arg.MarshalUnsafe(buf)
+	_, err := a.t.CopyOutBytes(a.argPtr, buf[:a.size(arg)])
+	return err
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *renderFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	cmd := args[1].Uint()
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+	if (cmd>>linux.IOC_TYPESHIFT)&((1<<linux.IOC_TYPEBITS)-1) != linux.DRM_IOCTL_BASE {
+		return 0, linuxerr.ENOTTY
+	}
+	a := &ioctlArg{
+		t:      t,
+		cmd:    cmd,
+		argPtr: args[2].Pointer(),
+	}
+
+	switch nr := linux.IOC_NR(cmd); nr {
+	case linux.DRM_IOCTL_NR_VERSION:
+		return fd.version(a)
+	case linux.DRM_IOCTL_NR_GEM_CLOSE:
+		return fd.ioctlSimple(a, nr, &linux.DRMGemClose{})
+	case linux.DRM_IOCTL_NR_GET_CAP:
+		return fd.ioctlSimple(a, nr, &linux.DRMGetCap{})
+	case linux.DRM_IOCTL_NR_SET_CLIENT_CAP:
+		return fd.ioctlSimple(a, nr, &linux.DRMSetClientCap{})
+	case linux.DRM_IOCTL_NR_VIRTGPU_MAP:
+		return fd.ioctlSimple(a, nr, &linux.DRMVirtGPUMap{})
+	case linux.DRM_IOCTL_NR_VIRTGPU_EXECBUF:
+		return fd.execbuffer(a)
+	case linux.DRM_IOCTL_NR_VIRTGPU_GETPARAM:
+		return fd.getparam(a)
+	case linux.DRM_IOCTL_NR_VIRTGPU_RESOURCE_CREATE:
+		return fd.ioctlSimple(a, nr, &linux.DRMVirtGPUResourceCreate{})
+	case linux.DRM_IOCTL_NR_VIRTGPU_RESOURCE_INFO:
+		return fd.ioctlSimple(a, nr, &linux.DRMVirtGPUResourceInfo{})
+	case linux.DRM_IOCTL_NR_VIRTGPU_TRANSFER_FROM_HOST, linux.DRM_IOCTL_NR_VIRTGPU_TRANSFER_TO_HOST:
+		return fd.ioctlSimple(a, nr, &linux.DRMVirtGPU3DTransfer{})
+	case linux.DRM_IOCTL_NR_VIRTGPU_WAIT:
+		return fd.ioctlSimple(a, nr, &linux.DRMVirtGPU3DWait{})
+	case linux.DRM_IOCTL_NR_VIRTGPU_GET_CAPS:
+		return fd.getCaps(a)
+	case linux.DRM_IOCTL_NR_VIRTGPU_RESOURCE_CREATE_BLOB:
+		return fd.resourceCreateBlob(a)
+	case linux.DRM_IOCTL_NR_VIRTGPU_CONTEXT_INIT:
+		return fd.contextInit(a)
+	default:
+		return 0, linuxerr.ENOTTY
+	}
+}
+
+// ioctlSimple implements ioctls whose argument contains no pointers or file
+// descriptors, such that it can be passed through to the host as is.
+func (fd *renderFD) ioctlSimple(a *ioctlArg, nr uint32, arg marshal.Marshallable) (uintptr, error) {
+	if err := a.copyIn(arg); err != nil {
+		return 0, err
+	}
+	n, err := hostIoctl(fd.hostFD, nr, arg)
+	if err != nil {
+		return n, err
+	}
+	return n, a.copyOut(arg)
+}
+
+// version implements DRM_IOCTL_VERSION.
+func (fd *renderFD) version(a *ioctlArg) (uintptr, error) {
+	var version linux.DRMVersion
+	if err := a.copyIn(&version); err != nil {
+		return 0, err
+	}
+	appVersion := version
+	name := make([]byte, min(version.NameLen, maxVersionStringLen))
+	date := make([]byte, min(version.DateLen, maxVersionStringLen))
+	desc := make([]byte, min(version.DescLen, maxVersionStringLen))
+	version.NameLen, version.Name = uint64(len(name)), addrOf(name)
+	version.DateLen, version.Date = uint64(len(date)), addrOf(date)
+	version.DescLen, version.Desc = uint64(len(desc)), addrOf(desc)
+	n, err := hostIoctl(fd.hostFD, linux.DRM_IOCTL_NR_VERSION, &version, name, date, desc)
+	if err != nil {
+		return n, err
+	}
+	// As on the host, each string is truncated to the application's buffer
+	// and its full length is returned.
+	for _, s := range []struct {
+		ptr uint64
+		buf []byte
+		len uint64
+	}{
+		{appVersion.Name, name, version.NameLen},
+		{appVersion.Date, date, version.DateLen},
+		{appVersion.Desc, desc, version.DescLen},
+	} {
+		if _, err := a.t.CopyOutBytes(hostarch.Addr(s.ptr), s.buf[:min(s.len, uint64(len(s.buf)))]); err != nil {
+			return n, err
+		}
+	}
+	version.Name, version.Date, version.Desc = appVersion.Name, appVersion.Date, appVersion.Desc
+	return n, a.copyOut(&version)
+}
+
+// getparam implements DRM_IOCTL_VIRTGPU_GETPARAM.
+func (fd *renderFD) getparam(a *ioctlArg) (uintptr, error) {
+	var getparam linux.DRMVirtGPUGetparam
+	if err := a.copyIn(&getparam); err != nil {
+		return 0, err
+	}
+	appValuePtr := getparam.Value
+	value := make([]byte, 4) // int
+	getparam.Value = addrOf(value)
+	n, err := hostIoctl(fd.hostFD, linux.DRM_IOCTL_NR_VIRTGPU_GETPARAM, &getparam, value)
+	if err != nil {
+		return n, err
+	}
+	if _, err := a.t.CopyOutBytes(hostarch.Addr(appValuePtr), value); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// getCaps implements DRM_IOCTL_VIRTGPU_GET_CAPS.
+func (fd *renderFD) getCaps(a *ioctlArg) (uintptr, error) {
+	var getCaps linux.DRMVirtGPUGetCaps
+	if err := a.copyIn(&getCaps); err != nil {
+		return 0, err
+	}
+	if getCaps.Size > maxCapsSize {
+		return 0, linuxerr.EINVAL
+	}
+	appAddr := hostarch.Addr(getCaps.Addr)
+	// The host may copy out fewer bytes than requested; start from the
+	// application's buffer so that the remainder is left unchanged.
+	caps := make([]byte, getCaps.Size)
+	if _, err := a.t.CopyInBytes(appAddr, caps); err != nil {
+		return 0, err
+	}
+	getCaps.Addr = addrOf(caps)
+	n, err := hostIoctl(fd.hostFD, linux.DRM_IOCTL_NR_VIRTGPU_GET_CAPS, &getCaps, caps)
+	if err != nil {
+		return n, err
+	}
+	if _, err := a.t.CopyOutBytes(appAddr, caps); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// execbuffer implements DRM_IOCTL_VIRTGPU_EXECBUFFER.
+func (fd *renderFD) execbuffer(a *ioctlArg) (uintptr, error) {
+	var execbuffer linux.DRMVirtGPUExecbuffer
+	if err := a.copyIn(&execbuffer); err != nil {
+		return 0, err
+	}
+	// Fences are exchanged as host sync files and syncobjs, neither of which
+	// we translate.
+	if execbuffer.Flags&^linux.VIRTGPU_EXECBUF_RING_IDX != 0 || execbuffer.NumInSyncobjs != 0 || execbuffer.NumOutSyncobjs != 0 {
+		return 0, linuxerr.EOPNOTSUPP
+	}
+	if execbuffer.Size > maxCommandSize || execbuffer.NumBoHandles > maxBoHandles {
+		return 0, linuxerr.EINVAL
+	}
+	command := make([]byte, execbuffer.Size)
+	if _, err := a.t.CopyInBytes(hostarch.Addr(execbuffer.Command), command); err != nil {
+		return 0, err
+	}
+	boHandles := make([]byte, 4*execbuffer.NumBoHandles)
+	if _, err := a.t.CopyInBytes(hostarch.Addr(execbuffer.BoHandles), boHandles); err != nil {
+		return 0, err
+	}
+	sentryExecbuffer := execbuffer
+	sentryExecbuffer.Command = addrOf(command)
+	sentryExecbuffer.BoHandles = addrOf(boHandles)
+	return hostIoctl(fd.hostFD, linux.DRM_IOCTL_NR_VIRTGPU_EXECBUF, &sentryExecbuffer, command, boHandles)
+}
+
+// resourceCreateBlob implements DRM_IOCTL_VIRTGPU_RESOURCE_CREATE_BLOB.
+func (fd *renderFD) resourceCreateBlob(a *ioctlArg) (uintptr, error) {
+	var createBlob linux.DRMVirtGPUResourceCreateBlob
+	if err := a.copyIn(&createBlob); err != nil {
+		return 0, err
+	}
+	if createBlob.CmdSize > maxCommandSize {
+		return 0, linuxerr.EINVAL
+	}
+	cmd := make([]byte, createBlob.CmdSize)
+	if _, err := a.t.CopyInBytes(hostarch.Addr(createBlob.Cmd), cmd); err != nil {
+		return 0, err
+	}
+	appCmd := createBlob.Cmd
+	createBlob.Cmd = addrOf(cmd)
+	n, err := hostIoctl(fd.hostFD, linux.DRM_IOCTL_NR_VIRTGPU_RESOURCE_CREATE_BLOB, &createBlob, cmd)
+	if err != nil {
+		return n, err
+	}
+	createBlob.Cmd = appCmd
+	return n, a.copyOut(&createBlob)
+}
+
+// contextInit implements DRM_IOCTL_VIRTGPU_CONTEXT_INIT.
+func (fd *renderFD) contextInit(a *ioctlArg) (uintptr, error) {
+	var contextInit linux.DRMVirtGPUContextInit
+	if err := a.copyIn(&contextInit); err != nil {
+		return 0, err
+	}
+	if contextInit.NumParams > maxContextParams {
+		return 0, linuxerr.EINVAL
+	}
+	// Parameters are pairs of integers and can be passed through as is.
+	buf := make([]byte, int(contextInit.NumParams)*(*linux.DRMVirtGPUContextSetParam)(nil).SizeBytes())
+	if _, err := a.t.CopyInBytes(hostarch.Addr(contextInit.CtxSetParams), buf); err != nil {
+		return 0, err
+	}
+	contextInit.CtxSetParams = addrOf(buf)
+	return hostIoctl(fd.hostFD, linux.DRM_IOCTL_NR_VIRTGPU_CONTEXT_INIT, &contextInit, buf)
+}
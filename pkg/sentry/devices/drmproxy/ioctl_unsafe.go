@@ -0,0 +1,55 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drmproxy
+
+import (
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/marshal"
+)
+
+// addrOf returns the address of buf's first byte, or 0 if buf is empty, for
+// use as a pointer in a host ioctl argument.
+func addrOf(buf []byte) uint64 {
+	if len(buf) == 0 {
+		return 0
+	}
+	return uint64(uintptr(unsafe.Pointer(&buf[0])))
+}
+
+// hostIoctl invokes the DRM ioctl nr on hostFD with argument arg, which is
+// updated with the host's result. bufs are the sentry buffers that arg points
+// to, which must be kept alive until the ioctl returns.
+//
+// The host ioctl command always encodes the size of the sentry's definition
+// of the argument, which the host accepts regardless of its own definition.
+//
+// hostIoctl uses unix.Syscall rather than unix.RawSyscall since DRM ioctls
+// may block, e.g. DRM_IOCTL_VIRTGPU_WAIT.
+func hostIoctl(hostFD int32, nr uint32, arg marshal.Marshallable, bufs ...[]byte) (uintptr, error) {
+	buf := make([]byte, arg.SizeBytes())
+	arg.MarshalUnsafe(buf)
+	cmd := linux.IOWR(linux.DRM_IOCTL_BASE, nr, uint32(len(buf)))
+	n, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(hostFD), uintptr(cmd), uintptr(unsafe.Pointer(&buf[0])))
+	runtime.KeepAlive(bufs)
+	if errno != 0 {
+		return n, errno
+	}
+	arg.UnmarshalUnsafe(buf)
+	return n, nil
+}
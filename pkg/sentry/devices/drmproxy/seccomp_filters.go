@@ -0,0 +1,65 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drmproxy
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/seccomp"
+)
+
+// Filters returns seccomp-bpf filters for this package.
+func Filters() seccomp.SyscallRules {
+	var ioctlRules seccomp.Or
+	for _, ioctl := range []struct {
+		nr  uint32
+		arg marshal.Marshallable
+	}{
+		{linux.DRM_IOCTL_NR_VERSION, &linux.DRMVersion{}},
+		{linux.DRM_IOCTL_NR_GEM_CLOSE, &linux.DRMGemClose{}},
+		{linux.DRM_IOCTL_NR_GET_CAP, &linux.DRMGetCap{}},
+		{linux.DRM_IOCTL_NR_SET_CLIENT_CAP, &linux.DRMSetClientCap{}},
+		{linux.DRM_IOCTL_NR_VIRTGPU_MAP, &linux.DRMVirtGPUMap{}},
+		{linux.DRM_IOCTL_NR_VIRTGPU_EXECBUF, &linux.DRMVirtGPUExecbuffer{}},
+		{linux.DRM_IOCTL_NR_VIRTGPU_GETPARAM, &linux.DRMVirtGPUGetparam{}},
+		{linux.DRM_IOCTL_NR_VIRTGPU_RESOURCE_CREATE, &linux.DRMVirtGPUResourceCreate{}},
+		{linux.DRM_IOCTL_NR_VIRTGPU_RESOURCE_INFO, &linux.DRMVirtGPUResourceInfo{}},
+		{linux.DRM_IOCTL_NR_VIRTGPU_TRANSFER_FROM_HOST, &linux.DRMVirtGPU3DTransfer{}},
+		{linux.DRM_IOCTL_NR_VIRTGPU_TRANSFER_TO_HOST, &linux.DRMVirtGPU3DTransfer{}},
+		{linux.DRM_IOCTL_NR_VIRTGPU_WAIT, &linux.DRMVirtGPU3DWait{}},
+		{linux.DRM_IOCTL_NR_VIRTGPU_GET_CAPS, &linux.DRMVirtGPUGetCaps{}},
+		{linux.DRM_IOCTL_NR_VIRTGPU_RESOURCE_CREATE_BLOB, &linux.DRMVirtGPUResourceCreateBlob{}},
+		{linux.DRM_IOCTL_NR_VIRTGPU_CONTEXT_INIT, &linux.DRMVirtGPUContextInit{}},
+	} {
+		ioctlRules = append(ioctlRules, seccomp.PerArg{
+			seccomp.NonNegativeFD{},
+			seccomp.EqualTo(linux.IOWR(linux.DRM_IOCTL_BASE, ioctl.nr, uint32(ioctl.arg.SizeBytes()))),
+		})
+	}
+	return seccomp.MakeSyscallRules(map[uintptr]seccomp.SyscallRule{
+		unix.SYS_OPENAT: seccomp.PerArg{
+			// All paths that we openat() are absolute, so we pass a dirfd
+			// of -1 (which is invalid for relative paths, but ignored for
+			// absolute paths) to hedge against bugs involving AT_FDCWD or
+			// real dirfds.
+			seccomp.EqualTo(^uintptr(0)),
+			seccomp.AnyValue{},
+			seccomp.MaskedEqual(unix.O_CREAT|unix.O_NOFOLLOW, unix.O_NOFOLLOW),
+			seccomp.AnyValue{},
+		},
+		unix.SYS_IOCTL: ioctlRules,
+	})
+}
@@ -104,10 +104,11 @@ type frontendFD struct {
 }
 
 // Release implements vfs.FileDescriptionImpl.Release.
-func (fd *frontendFD) Release(context.Context) {
+func (fd *frontendFD) Release(ctx context.Context) {
 	fdnotifier.RemoveFD(fd.hostFD)
 	fd.queue.Notify(waiter.EventHUp)
 	unix.Close(int(fd.hostFD))
+	fd.nvp.releaseVidMem(ctx, fd)
 }
 
 // EventRegister implements waiter.Waitable.EventRegister.
@@ -222,7 +222,31 @@ func rmVidHeapControlAllocSize(fi *frontendIoctlState, ioctlParams *nvgpu.NVOS32
 		sentryAllocSizeParams.Address = p64FromPtr(unsafe.Pointer(&addr))
 	}
 
+	// Charge the allocation to the application's misc cgroup before it is
+	// made, so that it can be denied if it would exceed the cgroup's limit.
+	vm, err := chargeVidMem(fi, allocSizeParams.Size)
+	if err != nil {
+		fi.ctx.Debugf("nvproxy: denying video memory allocation of %d bytes: %v", allocSizeParams.Size, err)
+		outIoctlParams := *ioctlParams
+		outIoctlParams.Status = nvgpu.NV_ERR_NO_MEMORY
+		_, err := outIoctlParams.CopyOut(fi.t, fi.ioctlParamsAddr)
+		return 0, err
+	}
+	if vm != nil {
+		fi.fd.nvp.objsMu.Lock()
+	}
 	n, err := frontendIoctlInvoke(fi, &sentryIoctlParams)
+	if vm != nil {
+		if err == nil && sentryIoctlParams.Status == nvgpu.NV_OK {
+			// Transfer the charge to the new memory object, to be
+			// uncharged when it is freed.
+			fi.fd.nvp.objsLive[sentryAllocSizeParams.HMemory] = &vm.object
+			fi.fd.nvp.objsMu.Unlock()
+		} else {
+			fi.fd.nvp.objsMu.Unlock()
+			vm.Release(fi.ctx)
+		}
+	}
 	if err != nil {
 		return n, err
 	}
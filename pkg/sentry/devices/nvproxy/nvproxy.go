@@ -20,12 +20,15 @@ package nvproxy
 
 import (
 	"fmt"
+	"math"
 
 	"gvisor.dev/gvisor/pkg/abi/nvgpu"
 	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/mm"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 )
@@ -110,6 +113,71 @@ func (o *osDescMem) Release(ctx context.Context) {
 	mm.Unpin(o.pinnedRanges)
 }
 
+// vidMem is an objectImpl tracking video memory charged to a misc cgroup.
+//
+// vidMem is not savable since it refers to a frontendFD; it is released
+// before save like all other objects.
+type vidMem struct {
+	object
+
+	// fd is the file through which the memory was allocated. The driver frees
+	// the memory when fd's host file is closed.
+	fd *frontendFD
+
+	// cg is the cgroup charged for the memory, holding a reference.
+	cg kernel.Cgroup
+
+	// size is the charge in bytes.
+	size int64
+}
+
+// chargeVidMem charges size bytes of video memory allocated through fi to the
+// misc cgroup of the calling task. It returns a nil *vidMem if the task is not
+// in a misc cgroup, and an error if the charge would exceed the cgroup's
+// limit.
+func chargeVidMem(fi *frontendIoctlState, size uint64) (*vidMem, error) {
+	rounded, ok := hostarch.PageRoundUp(size)
+	if !ok || rounded > math.MaxInt64 {
+		return nil, linuxerr.ENOMEM
+	}
+	charged, cg, err := fi.t.ChargeFor(fi.t, kernel.CgroupControllerMisc, kernel.CgroupResourceGPUMemory, int64(rounded))
+	if err != nil || !charged {
+		return nil, err
+	}
+	vm := &vidMem{
+		fd:   fi.fd,
+		cg:   cg,
+		size: int64(rounded),
+	}
+	vm.object.init(vm)
+	return vm, nil
+}
+
+// Release implements objectImpl.Release.
+func (vm *vidMem) Release(ctx context.Context) {
+	if err := vm.cg.Charge(nil, vm.cg.Dentry, kernel.CgroupControllerMisc, kernel.CgroupResourceGPUMemory, -vm.size); err != nil {
+		ctx.Warningf("nvproxy: failed to uncharge %d bytes of video memory: %v", vm.size, err)
+	}
+	vm.cg.DecRef(ctx)
+}
+
+// releaseVidMem releases the charges for all video memory allocated through
+// fd, which the driver frees when fd's host file is closed.
+func (nvp *nvproxy) releaseVidMem(ctx context.Context, fd *frontendFD) {
+	var released []*vidMem
+	nvp.objsMu.Lock()
+	for h, o := range nvp.objsLive {
+		if vm, ok := o.impl.(*vidMem); ok && vm.fd == fd {
+			delete(nvp.objsLive, h)
+			released = append(released, vm)
+		}
+	}
+	nvp.objsMu.Unlock()
+	for _, vm := range released {
+		vm.Release(ctx)
+	}
+}
+
 type marshalPtr[T any] interface {
 	*T
 	marshal.Marshallable
@@ -0,0 +1,143 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptpproxy
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// clockFD implements vfs.FileDescriptionImpl for /dev/ptp[0-9]+.
+//
+// clockFD is not savable; the host clock may not exist after restore.
+type clockFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	hostFD int32
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *clockFD) Release(context.Context) {
+	unix.Close(int(fd.hostFD))
+}
+
+// ClockGettime returns the current time of the clock, for clock_gettime(2)
+// with the clock ID derived from the application's file descriptor.
+func (fd *clockFD) ClockGettime(context.Context) (linux.Timespec, error) {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(hostClockID(fd.hostFD), &ts); err != nil {
+		return linux.Timespec{}, err
+	}
+	return linux.Timespec{Sec: ts.Sec, Nsec: ts.Nsec}, nil
+}
+
+// ClockGetres returns the resolution of the clock, for clock_getres(2) with
+// the clock ID derived from the application's file descriptor.
+func (fd *clockFD) ClockGetres(context.Context) (linux.Timespec, error) {
+	var ts unix.Timespec
+	if err := unix.ClockGetres(hostClockID(fd.hostFD), &ts); err != nil {
+		return linux.Timespec{}, err
+	}
+	return linux.Timespec{Sec: ts.Sec, Nsec: ts.Nsec}, nil
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *clockFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	cmd := args[1].Uint()
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+	argPtr := args[2].Pointer()
+
+	switch cmd {
+	case linux.PTP_CLOCK_GETCAPS, linux.PTP_CLOCK_GETCAPS2:
+		return fd.ioctlSimple(t, cmd, argPtr, &linux.PTPClockCaps{})
+	case linux.PTP_SYS_OFFSET, linux.PTP_SYS_OFFSET2:
+		// The system timestamps are read from the host's CLOCK_REALTIME,
+		// which the sandbox's CLOCK_REALTIME tracks.
+		return fd.ioctlSimple(t, cmd, argPtr, &linux.PTPSysOffset{})
+	case linux.PTP_SYS_OFFSET_PRECISE, linux.PTP_SYS_OFFSET_PRECISE2:
+		return fd.sysOffsetPrecise(t, cmd, argPtr)
+	case linux.PTP_SYS_OFFSET_EXTENDED, linux.PTP_SYS_OFFSET_EXTENDED2:
+		return fd.sysOffsetExtended(t, cmd, argPtr)
+	default:
+		return 0, linuxerr.ENOTTY
+	}
+}
+
+// ioctlSimple implements ioctls whose argument contains no pointers or file
+// descriptors, such that it can be passed through to the host as is.
+func (fd *clockFD) ioctlSimple(t *kernel.Task, cmd uint32, argPtr hostarch.Addr, arg marshal.Marshallable) (uintptr, error) {
+	if (cmd>>linux.IOC_DIRSHIFT)&linux.IOC_WRITE != 0 {
+		if _, err := arg.CopyIn(t, argPtr); err != nil {
+			return 0, err
+		}
+	}
+	n, err := hostIoctl(fd.hostFD, cmd, arg)
+	if err != nil {
+		return n, err
+	}
+	_, err = arg.CopyOut(t, argPtr)
+	return n, err
+}
+
+// sysOffsetPrecise implements PTP_SYS_OFFSET_PRECISE.
+func (fd *clockFD) sysOffsetPrecise(t *kernel.Task, cmd uint32, argPtr hostarch.Addr) (uintptr, error) {
+	var precise linux.PTPSysOffsetPrecise
+	if _, err := precise.CopyIn(t, argPtr); err != nil {
+		return 0, err
+	}
+	n, err := hostIoctl(fd.hostFD, cmd, &precise)
+	if err != nil {
+		return n, err
+	}
+	// The host's CLOCK_MONOTONIC_RAW is unrelated to the sandbox's, which is
+	// offset from it; don't leak it.
+	precise.SysMonoraw = linux.PTPClockTime{}
+	_, err = precise.CopyOut(t, argPtr)
+	return n, err
+}
+
+// sysOffsetExtended implements PTP_SYS_OFFSET_EXTENDED.
+func (fd *clockFD) sysOffsetExtended(t *kernel.Task, cmd uint32, argPtr hostarch.Addr) (uintptr, error) {
+	var extended linux.PTPSysOffsetExtended
+	if _, err := extended.CopyIn(t, argPtr); err != nil {
+		return 0, err
+	}
+	// Newer kernels allow system timestamps to be taken from clocks other
+	// than CLOCK_REALTIME, which are offset from the sandbox's as for
+	// PTP_SYS_OFFSET_PRECISE.
+	if extended.ClockID != linux.CLOCK_REALTIME {
+		return 0, linuxerr.EINVAL
+	}
+	n, err := hostIoctl(fd.hostFD, cmd, &extended)
+	if err != nil {
+		return n, err
+	}
+	_, err = extended.CopyOut(t, argPtr)
+	return n, err
+}
@@ -0,0 +1,35 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptpproxy
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/marshal"
+)
+
+// hostIoctl invokes the PTP clock ioctl cmd on hostFD with argument arg,
+// which is updated with the host's result.
+func hostIoctl(hostFD int32, cmd uint32, arg marshal.Marshallable) (uintptr, error) {
+	buf := make([]byte, arg.SizeBytes())
+	arg.MarshalUnsafe(buf)
+	n, _, errno := unix.RawSyscall(unix.SYS_IOCTL, uintptr(hostFD), uintptr(cmd), uintptr(unsafe.Pointer(&buf[0])))
+	if errno != 0 {
+		return n, errno
+	}
+	arg.UnmarshalUnsafe(buf)
+	return n, nil
+}
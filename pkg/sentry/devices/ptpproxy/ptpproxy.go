@@ -0,0 +1,102 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ptpproxy implements read-only proxying for PTP hardware clocks
+// (/dev/ptp*). It allows time synchronization agents in the sandbox, e.g.
+// chrony with a PHC reference clock, to read the host's PTP hardware clocks
+// and their offsets from the system clock, in order to validate the
+// sandbox's time without access to the host.
+//
+// The clocks can be read with clock_gettime(2) and the PTP_CLOCK_GETCAPS and
+// PTP_SYS_OFFSET* ioctls. Ioctls that adjust the clock or configure its
+// pins, alarms and periodic outputs are not supported.
+package ptpproxy
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/devutil"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// Clock describes a PTP hardware clock exposed to the sandbox.
+type Clock struct {
+	// Name is the clock's file name in /dev, e.g. "ptp0".
+	Name string
+
+	// Major and Minor are the device numbers of /dev/Name in the sandbox.
+	// The PTP clock major device number is dynamically assigned on the
+	// host.
+	Major uint32
+	Minor uint32
+}
+
+// Register registers the devices of the given PTP clocks in vfsObj.
+func Register(vfsObj *vfs.VirtualFilesystem, clocks []Clock) error {
+	for _, c := range clocks {
+		if err := vfsObj.RegisterDevice(vfs.CharDevice, c.Major, c.Minor, &clockDevice{
+			name: c.Name,
+		}, &vfs.RegisterDeviceOptions{
+			GroupName: "ptp",
+		}); err != nil {
+			return fmt.Errorf("registering PTP clock %q: %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// clockDevice implements vfs.Device for /dev/ptp[0-9]+.
+//
+// +stateify savable
+type clockDevice struct {
+	name string
+}
+
+// Open implements vfs.Device.Open.
+func (dev *clockDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	devClient := devutil.GoferClientFromContext(ctx)
+	if devClient == nil {
+		log.Warningf("devutil.CtxDevGoferClient is not set")
+		return nil, linuxerr.ENOENT
+	}
+	// The host file is always opened read-only: write access is only
+	// needed to adjust the clock, which we don't support.
+	hostFD, err := devClient.OpenAt(ctx, dev.name, unix.O_RDONLY)
+	if err != nil {
+		ctx.Warningf("ptpproxy: failed to open host /dev/%s: %v", dev.name, err)
+		return nil, err
+	}
+	fd := &clockFD{
+		hostFD: int32(hostFD),
+	}
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		unix.Close(hostFD)
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// hostClockID returns the host clock ID of the dynamic POSIX clock
+// represented by hostFD, as computed by FD_TO_CLOCKID in Linux's
+// include/linux/posix-timers.h.
+func hostClockID(hostFD int32) int32 {
+	return ^hostFD<<3 | linux.CLOCKFD
+}
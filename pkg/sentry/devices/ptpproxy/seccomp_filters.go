@@ -0,0 +1,57 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptpproxy
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/seccomp"
+)
+
+// Filters returns seccomp-bpf filters for this package.
+func Filters() seccomp.SyscallRules {
+	var ioctlRules seccomp.Or
+	for _, cmd := range []uint32{
+		linux.PTP_CLOCK_GETCAPS,
+		linux.PTP_CLOCK_GETCAPS2,
+		linux.PTP_SYS_OFFSET,
+		linux.PTP_SYS_OFFSET2,
+		linux.PTP_SYS_OFFSET_PRECISE,
+		linux.PTP_SYS_OFFSET_PRECISE2,
+		linux.PTP_SYS_OFFSET_EXTENDED,
+		linux.PTP_SYS_OFFSET_EXTENDED2,
+	} {
+		ioctlRules = append(ioctlRules, seccomp.PerArg{
+			seccomp.NonNegativeFD{},
+			seccomp.EqualTo(cmd),
+		})
+	}
+	return seccomp.MakeSyscallRules(map[uintptr]seccomp.SyscallRule{
+		unix.SYS_OPENAT: seccomp.PerArg{
+			// All paths that we openat() are absolute, so we pass a dirfd
+			// of -1 (which is invalid for relative paths, but ignored for
+			// absolute paths) to hedge against bugs involving AT_FDCWD or
+			// real dirfds.
+			seccomp.EqualTo(^uintptr(0)),
+			seccomp.AnyValue{},
+			seccomp.MaskedEqual(unix.O_CREAT|unix.O_NOFOLLOW|unix.O_ACCMODE, unix.O_NOFOLLOW|unix.O_RDONLY),
+			seccomp.AnyValue{},
+		},
+		// clock_gettime(2) is allowed for all clocks by the default
+		// filters.
+		unix.SYS_CLOCK_GETRES: seccomp.MatchAll{},
+		unix.SYS_IOCTL:        ioctlRules,
+	})
+}
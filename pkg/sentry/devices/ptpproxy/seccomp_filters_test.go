@@ -0,0 +1,125 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptpproxy
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/bpf"
+	"gvisor.dev/gvisor/pkg/seccomp"
+)
+
+// TestIoctlAllowlist checks that the filters only allow the read-only PTP
+// clock ioctls on valid file descriptors.
+func TestIoctlAllowlist(t *testing.T) {
+	instrs, _, err := seccomp.BuildProgram([]seccomp.RuleSet{
+		{
+			Rules:  Filters(),
+			Action: linux.SECCOMP_RET_ALLOW,
+		},
+	}, seccomp.ProgramOptions{
+		DefaultAction: linux.SECCOMP_RET_TRAP,
+		BadArchAction: linux.SECCOMP_RET_KILL_THREAD,
+	})
+	if err != nil {
+		t.Fatalf("BuildProgram() got error: %v", err)
+	}
+	p, err := bpf.Compile(instrs, true /* optimize */)
+	if err != nil {
+		t.Fatalf("bpf.Compile got error: %v", err)
+	}
+	buf := make([]byte, (&linux.SeccompData{}).SizeBytes())
+	ioctl := func(fd int32, cmd uint32) linux.BPFAction {
+		data := linux.SeccompData{
+			Nr:   unix.SYS_IOCTL,
+			Arch: seccomp.LINUX_AUDIT_ARCH,
+			Args: [6]uint64{uint64(fd), uint64(cmd)},
+		}
+		got, err := bpf.Exec[bpf.NativeEndian](p, seccomp.DataAsBPFInput(&data, buf))
+		if err != nil {
+			t.Fatalf("bpf.Exec got error: %v", err)
+		}
+		return linux.BPFAction(got)
+	}
+
+	for _, test := range []struct {
+		name string
+		cmd  uint32
+		want linux.BPFAction
+	}{
+		{"PTP_CLOCK_GETCAPS", linux.PTP_CLOCK_GETCAPS, linux.SECCOMP_RET_ALLOW},
+		{"PTP_CLOCK_GETCAPS2", linux.PTP_CLOCK_GETCAPS2, linux.SECCOMP_RET_ALLOW},
+		{"PTP_SYS_OFFSET", linux.PTP_SYS_OFFSET, linux.SECCOMP_RET_ALLOW},
+		{"PTP_SYS_OFFSET2", linux.PTP_SYS_OFFSET2, linux.SECCOMP_RET_ALLOW},
+		{"PTP_SYS_OFFSET_PRECISE", linux.PTP_SYS_OFFSET_PRECISE, linux.SECCOMP_RET_ALLOW},
+		{"PTP_SYS_OFFSET_PRECISE2", linux.PTP_SYS_OFFSET_PRECISE2, linux.SECCOMP_RET_ALLOW},
+		{"PTP_SYS_OFFSET_EXTENDED", linux.PTP_SYS_OFFSET_EXTENDED, linux.SECCOMP_RET_ALLOW},
+		{"PTP_SYS_OFFSET_EXTENDED2", linux.PTP_SYS_OFFSET_EXTENDED2, linux.SECCOMP_RET_ALLOW},
+		// Ioctls that configure the clock, from
+		// include/uapi/linux/ptp_clock.h.
+		{"PTP_EXTTS_REQUEST", linux.IOW(linux.PTP_CLK_MAGIC, 2, 16), linux.SECCOMP_RET_TRAP},
+		{"PTP_PEROUT_REQUEST", linux.IOW(linux.PTP_CLK_MAGIC, 3, 56), linux.SECCOMP_RET_TRAP},
+		{"PTP_ENABLE_PPS", linux.IOW(linux.PTP_CLK_MAGIC, 4, 4), linux.SECCOMP_RET_TRAP},
+		{"PTP_PIN_SETFUNC", linux.IOW(linux.PTP_CLK_MAGIC, 7, 96), linux.SECCOMP_RET_TRAP},
+		{"PTP_MASK_CLEAR_ALL", linux.IO(linux.PTP_CLK_MAGIC, 19), linux.SECCOMP_RET_TRAP},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ioctl(3, test.cmd); got != test.want {
+				t.Errorf("ioctl(3, %#x): got action %v, want %v", test.cmd, got, test.want)
+			}
+		})
+	}
+
+	t.Run("NegativeFD", func(t *testing.T) {
+		if got := ioctl(-1, linux.PTP_CLOCK_GETCAPS); got != linux.SECCOMP_RET_TRAP {
+			t.Errorf("ioctl(-1, PTP_CLOCK_GETCAPS): got action %v, want %v", got, linux.SECCOMP_RET_TRAP)
+		}
+	})
+
+	// clock_adjtime(2) must never be allowed, regardless of the clock.
+	data := linux.SeccompData{
+		Nr:   unix.SYS_CLOCK_ADJTIME,
+		Arch: seccomp.LINUX_AUDIT_ARCH,
+		Args: [6]uint64{uint64(uint32(hostClockID(3)))},
+	}
+	got, err := bpf.Exec[bpf.NativeEndian](p, seccomp.DataAsBPFInput(&data, buf))
+	if err != nil {
+		t.Fatalf("bpf.Exec got error: %v", err)
+	}
+	if linux.BPFAction(got) != linux.SECCOMP_RET_TRAP {
+		t.Errorf("clock_adjtime: got action %v, want %v", linux.BPFAction(got), linux.SECCOMP_RET_TRAP)
+	}
+}
+
+// TestHostClockID checks that hostClockID matches FD_TO_CLOCKID.
+func TestHostClockID(t *testing.T) {
+	for _, test := range []struct {
+		fd   int32
+		want int32
+	}{
+		{fd: 0, want: -5},
+		{fd: 3, want: -29},
+		{fd: 1000, want: -8005},
+	} {
+		if got := hostClockID(test.fd); got != test.want {
+			t.Errorf("hostClockID(%d) = %d, want %d", test.fd, got, test.want)
+		}
+		if got := int32(^(test.want >> 3)); got != test.fd {
+			t.Errorf("CLOCKID_TO_FD(%d) = %d, want %d", test.want, got, test.fd)
+		}
+	}
+}
@@ -34,6 +34,10 @@ func Filters() seccomp.SyscallRules {
 			seccomp.AnyValue{},
 		},
 		unix.SYS_GETDENTS64: seccomp.MatchAll{},
+		// Used to mirror PCI device driver links in sysfs.
+		unix.SYS_READLINKAT: seccomp.PerArg{
+			seccomp.NonNegativeFD{},
+		},
 		unix.SYS_EVENTFD2: seccomp.Or{
 			seccomp.PerArg{
 				seccomp.AnyValue{},
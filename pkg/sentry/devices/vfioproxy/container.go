@@ -0,0 +1,257 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfioproxy
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/cleanup"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/devutil"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// containerDevice implements vfs.Device for /dev/vfio/vfio.
+//
+// +stateify savable
+type containerDevice struct{}
+
+// Open implements vfs.Device.Open.
+func (dev *containerDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	devClient := devutil.GoferClientFromContext(ctx)
+	if devClient == nil {
+		log.Warningf("devutil.CtxDevGoferClient is not set")
+		return nil, linuxerr.ENOENT
+	}
+	hostFD, err := devClient.OpenAt(ctx, containerDeviceName, opts.Flags)
+	if err != nil {
+		ctx.Warningf("vfioproxy: failed to open host /dev/%s: %v", containerDeviceName, err)
+		return nil, err
+	}
+	fd := &containerFD{
+		hostFD:      int32(hostFD),
+		dmaMappings: make(map[uint64]dmaMapping),
+	}
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		unix.Close(hostFD)
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// containerFD implements vfs.FileDescriptionImpl for /dev/vfio/vfio.
+//
+// containerFD is not savable; we do not implement save/restore of host device
+// state.
+type containerFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	hostFD int32
+
+	mu sync.Mutex
+	// dmaMappings maps the IOVA of each DMA mapping established through this
+	// container to the application memory that backs it.
+	//
+	// +checklocks:mu
+	dmaMappings map[uint64]dmaMapping
+}
+
+// dmaMapping is application memory that is mapped for device DMA.
+type dmaMapping struct {
+	size uint64
+	prs  []mm.PinnedRange
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *containerFD) Release(context.Context) {
+	// Closing the host container unmaps all DMA mappings, after which the
+	// memory backing them can be unpinned. groupFDs hold a reference on the
+	// containerFD they are attached to, so the host container can't be
+	// referenced by a group at this point.
+	unix.Close(int(fd.hostFD))
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	for iova, m := range fd.dmaMappings {
+		mm.Unpin(m.prs)
+		delete(fd.dmaMappings, iova)
+	}
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *containerFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	cmd := args[1].Uint()
+	argPtr := args[2].Pointer()
+
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+
+	switch cmd {
+	case linux.VFIO_GET_API_VERSION:
+		return ioctlInvoke(fd.hostFD, cmd, 0)
+	case linux.VFIO_CHECK_EXTENSION:
+		return ioctlInvoke(fd.hostFD, cmd, args[2].Uint64())
+	case linux.VFIO_SET_IOMMU:
+		// Only type1 IOMMUs, which track DMA mappings by IOVA, are supported.
+		switch iommuType := args[2].Uint64(); iommuType {
+		case linux.VFIO_TYPE1_IOMMU, linux.VFIO_TYPE1v2_IOMMU:
+			return ioctlInvoke(fd.hostFD, cmd, iommuType)
+		default:
+			return 0, linuxerr.EINVAL
+		}
+	case linux.VFIO_IOMMU_GET_INFO:
+		return ioctlArgsz(t, fd.hostFD, cmd, argPtr, (*linux.VFIOIommuType1Info)(nil).SizeBytes())
+	case linux.VFIO_IOMMU_MAP_DMA:
+		return fd.mapDMA(ctx, t, argPtr)
+	case linux.VFIO_IOMMU_UNMAP_DMA:
+		return fd.unmapDMA(t, argPtr)
+	default:
+		return 0, linuxerr.ENOTTY
+	}
+}
+
+// mapDMA implements VFIO_IOMMU_MAP_DMA. The application memory to be mapped is
+// pinned and mirrored into the sentry's address space, so that the host can
+// map it in the IOMMU.
+func (fd *containerFD) mapDMA(ctx context.Context, t *kernel.Task, argPtr hostarch.Addr) (uintptr, error) {
+	var dmaMap linux.VFIOIommuType1DmaMap
+	if _, err := dmaMap.CopyIn(t, argPtr); err != nil {
+		return 0, err
+	}
+	if dmaMap.Argsz < uint32(dmaMap.SizeBytes()) {
+		return 0, linuxerr.EINVAL
+	}
+	// Other flags, such as VFIO_DMA_MAP_FLAG_VADDR, change the host virtual
+	// address of existing mappings, which we can't allow.
+	if dmaMap.Flags&^(linux.VFIO_DMA_MAP_FLAG_READ|linux.VFIO_DMA_MAP_FLAG_WRITE) != 0 {
+		return 0, linuxerr.EINVAL
+	}
+	at := hostarch.AccessType{
+		Read:  dmaMap.Flags&linux.VFIO_DMA_MAP_FLAG_READ != 0,
+		Write: dmaMap.Flags&linux.VFIO_DMA_MAP_FLAG_WRITE != 0,
+	}
+	if !at.Any() || dmaMap.Size == 0 {
+		return 0, linuxerr.EINVAL
+	}
+	ar, ok := t.MemoryManager().CheckIORange(hostarch.Addr(dmaMap.Vaddr), int64(dmaMap.Size))
+	if !ok {
+		return 0, linuxerr.EFAULT
+	}
+	if !ar.IsPageAligned() {
+		return 0, linuxerr.EINVAL
+	}
+
+	// Reserve a range in our address space.
+	m, _, errno := unix.RawSyscall6(unix.SYS_MMAP, 0 /* addr */, uintptr(ar.Length()), unix.PROT_NONE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS, ^uintptr(0) /* fd */, 0 /* offset */)
+	if errno != 0 {
+		return 0, errno
+	}
+	// The reserved range is no longer required once the host has mapped the
+	// memory in the IOMMU, since it pins the underlying pages.
+	defer unix.RawSyscall(unix.SYS_MUNMAP, m, uintptr(ar.Length()), 0)
+	// Mirror application mappings into the reserved range.
+	prs, err := t.MemoryManager().Pin(ctx, ar, at, false /* ignorePermissions */)
+	cu := cleanup.Make(func() {
+		mm.Unpin(prs)
+	})
+	defer cu.Clean()
+	if err != nil {
+		return 0, err
+	}
+	sentryAddr := uintptr(m)
+	for _, pr := range prs {
+		ims, err := pr.File.MapInternal(memmap.FileRange{pr.Offset, pr.Offset + uint64(pr.Source.Length())}, at)
+		if err != nil {
+			return 0, err
+		}
+		for !ims.IsEmpty() {
+			im := ims.Head()
+			if _, _, errno := unix.RawSyscall6(unix.SYS_MREMAP, im.Addr(), 0 /* old_size */, uintptr(im.Len()), linux.MREMAP_MAYMOVE|linux.MREMAP_FIXED, sentryAddr, 0); errno != 0 {
+				return 0, errno
+			}
+			sentryAddr += uintptr(im.Len())
+			ims = ims.Tail()
+		}
+	}
+
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	sentryDMAMap := dmaMap
+	sentryDMAMap.Argsz = uint32(sentryDMAMap.SizeBytes())
+	sentryDMAMap.Vaddr = uint64(m)
+	n, err := ioctlInvokePtrArg(fd.hostFD, linux.VFIO_IOMMU_MAP_DMA, &sentryDMAMap)
+	if err != nil {
+		return n, err
+	}
+	cu.Release()
+	fd.dmaMappings[dmaMap.Iova] = dmaMapping{
+		size: dmaMap.Size,
+		prs:  prs,
+	}
+	return n, nil
+}
+
+// unmapDMA implements VFIO_IOMMU_UNMAP_DMA.
+func (fd *containerFD) unmapDMA(t *kernel.Task, argPtr hostarch.Addr) (uintptr, error) {
+	var dmaUnmap linux.VFIOIommuType1DmaUnmap
+	if _, err := dmaUnmap.CopyIn(t, argPtr); err != nil {
+		return 0, err
+	}
+	if dmaUnmap.Argsz < uint32(dmaUnmap.SizeBytes()) {
+		return 0, linuxerr.EINVAL
+	}
+	// Flags, such as VFIO_DMA_UNMAP_FLAG_GET_DIRTY_BITMAP, require data
+	// following the structure that we don't support.
+	if dmaUnmap.Flags != 0 {
+		return 0, linuxerr.EINVAL
+	}
+
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	sentryDMAUnmap := dmaUnmap
+	sentryDMAUnmap.Argsz = uint32(sentryDMAUnmap.SizeBytes())
+	n, err := ioctlInvokePtrArg(fd.hostFD, linux.VFIO_IOMMU_UNMAP_DMA, &sentryDMAUnmap)
+	if err != nil {
+		return n, err
+	}
+	// The host only unmaps whole mappings: those that start in the requested
+	// range. It reports the number of bytes that it unmapped in Size.
+	for iova, m := range fd.dmaMappings {
+		if iova >= dmaUnmap.Iova && iova-dmaUnmap.Iova < dmaUnmap.Size {
+			mm.Unpin(m.prs)
+			delete(fd.dmaMappings, iova)
+		}
+	}
+	dmaUnmap.Size = sentryDMAUnmap.Size
+	if _, err := dmaUnmap.CopyOut(t, argPtr); err != nil {
+		return n, err
+	}
+	return n, nil
+}
@@ -0,0 +1,211 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfioproxy
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/eventfd"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+const (
+	// maxIrqs is the maximum number of interrupts that can be set by a single
+	// VFIO_DEVICE_SET_IRQS, which is the maximum number of MSI-X vectors.
+	maxIrqs = 2048
+
+	// maxRWSize is the maximum number of bytes read or written by a single
+	// pread or pwrite of a device region. Regions are usually accessed with
+	// small reads and writes, e.g. of PCI configuration space registers.
+	maxRWSize = hostarch.PageSize
+)
+
+// deviceFD implements vfs.FileDescriptionImpl for file descriptions returned
+// by VFIO_GROUP_GET_DEVICE_FD.
+//
+// deviceFD is not savable; we do not implement save/restore of host device
+// state.
+type deviceFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	hostFD int32
+	// group is the groupFD that the device was obtained from. A reference is
+	// held on it, which keeps the group attached to its container while the
+	// device may perform DMA.
+	group      *vfs.FileDescription
+	memmapFile deviceFDMemmapFile
+}
+
+// newDeviceFD returns a file description for the given host VFIO device file.
+// On success, the returned file description takes ownership of hostFD.
+func newDeviceFD(ctx context.Context, vfsObj *vfs.VirtualFilesystem, hostFD int32, group *vfs.FileDescription) (*vfs.FileDescription, error) {
+	vd := vfsObj.NewAnonVirtualDentry("[vfio-device]")
+	defer vd.DecRef(ctx)
+	fd := &deviceFD{
+		hostFD: hostFD,
+		group:  group,
+	}
+	if err := fd.vfsfd.Init(fd, linux.O_RDWR, vd.Mount(), vd.Dentry(), &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		return nil, err
+	}
+	group.IncRef()
+	fd.memmapFile.fd = fd
+	return &fd.vfsfd, nil
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *deviceFD) Release(ctx context.Context) {
+	unix.Close(int(fd.hostFD))
+	fd.group.DecRef(ctx)
+}
+
+// PRead implements vfs.FileDescriptionImpl.PRead.
+func (fd *deviceFD) PRead(ctx context.Context, dst usermem.IOSequence, offset int64, opts vfs.ReadOptions) (int64, error) {
+	if offset < 0 {
+		return 0, linuxerr.EINVAL
+	}
+	buf := make([]byte, min(dst.NumBytes(), maxRWSize))
+	n, err := unix.Pread(int(fd.hostFD), buf, offset)
+	if err != nil {
+		return 0, err
+	}
+	cn, err := dst.CopyOut(ctx, buf[:n])
+	return int64(cn), err
+}
+
+// PWrite implements vfs.FileDescriptionImpl.PWrite.
+func (fd *deviceFD) PWrite(ctx context.Context, src usermem.IOSequence, offset int64, opts vfs.WriteOptions) (int64, error) {
+	if offset < 0 {
+		return 0, linuxerr.EINVAL
+	}
+	buf := make([]byte, min(src.NumBytes(), maxRWSize))
+	cn, err := src.CopyIn(ctx, buf)
+	if cn == 0 {
+		return 0, err
+	}
+	n, err := unix.Pwrite(int(fd.hostFD), buf[:cn], offset)
+	if err != nil {
+		return 0, err
+	}
+	return int64(n), nil
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *deviceFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	cmd := args[1].Uint()
+	argPtr := args[2].Pointer()
+
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+
+	switch cmd {
+	case linux.VFIO_DEVICE_GET_INFO:
+		return ioctlArgsz(t, fd.hostFD, cmd, argPtr, (*linux.VFIODeviceInfo)(nil).SizeBytes())
+	case linux.VFIO_DEVICE_GET_REGION_INFO:
+		return ioctlArgsz(t, fd.hostFD, cmd, argPtr, (*linux.VFIORegionInfo)(nil).SizeBytes())
+	case linux.VFIO_DEVICE_GET_IRQ_INFO:
+		return ioctlArgsz(t, fd.hostFD, cmd, argPtr, (*linux.VFIOIrqInfo)(nil).SizeBytes())
+	case linux.VFIO_DEVICE_SET_IRQS:
+		return fd.setIrqs(ctx, t, argPtr)
+	case linux.VFIO_DEVICE_RESET:
+		return ioctlInvoke(fd.hostFD, cmd, 0)
+	default:
+		return 0, linuxerr.ENOTTY
+	}
+}
+
+// setIrqs implements VFIO_DEVICE_SET_IRQS. Interrupts are signaled through
+// eventfds, which are converted to host eventfds.
+func (fd *deviceFD) setIrqs(ctx context.Context, t *kernel.Task, argPtr hostarch.Addr) (uintptr, error) {
+	var irqSet linux.VFIOIrqSet
+	if _, err := irqSet.CopyIn(t, argPtr); err != nil {
+		return 0, err
+	}
+	hdrSize := irqSet.SizeBytes()
+	if irqSet.Argsz < uint32(hdrSize) || irqSet.Count > maxIrqs {
+		return 0, linuxerr.EINVAL
+	}
+	dataPtr := argPtr + hostarch.Addr(hdrSize)
+	var data []byte
+	switch irqSet.Flags & linux.VFIO_IRQ_SET_DATA_TYPE_MASK {
+	case linux.VFIO_IRQ_SET_DATA_NONE:
+	case linux.VFIO_IRQ_SET_DATA_BOOL:
+		data = make([]byte, irqSet.Count)
+		if _, err := t.CopyInBytes(dataPtr, data); err != nil {
+			return 0, err
+		}
+	case linux.VFIO_IRQ_SET_DATA_EVENTFD:
+		fds := make([]int32, irqSet.Count)
+		if _, err := primitive.CopyInt32SliceIn(t, dataPtr, fds); err != nil {
+			return 0, err
+		}
+		data = make([]byte, 4*len(fds))
+		for i, appFD := range fds {
+			hostEventFD := int32(-1) // Disables the interrupt's trigger.
+			if appFD >= 0 {
+				var err error
+				if hostEventFD, err = hostEventFDFromApp(ctx, t, appFD); err != nil {
+					return 0, err
+				}
+			}
+			hostarch.ByteOrder.PutUint32(data[4*i:], uint32(hostEventFD))
+		}
+	default:
+		return 0, linuxerr.EINVAL
+	}
+	if irqSet.Argsz < uint32(hdrSize+len(data)) {
+		return 0, linuxerr.EINVAL
+	}
+
+	sentryIrqSet := irqSet
+	sentryIrqSet.Argsz = uint32(hdrSize + len(data))
+	buf := make([]byte, sentryIrqSet.Argsz)
+	sentryIrqSet.MarshalUnsafe(buf)
+	copy(buf[hdrSize:], data)
+	return ioctlInvokePtrArg(fd.hostFD, linux.VFIO_DEVICE_SET_IRQS, &buf[0])
+}
+
+// hostEventFDFromApp returns the host eventfd backing the application's
+// eventfd appFD.
+func hostEventFDFromApp(ctx context.Context, t *kernel.Task, appFD int32) (int32, error) {
+	file, _ := t.FDTable().Get(appFD)
+	if file == nil {
+		return 0, linuxerr.EBADF
+	}
+	defer file.DecRef(ctx)
+	eventFile, ok := file.Impl().(*eventfd.EventFileDescription)
+	if !ok {
+		return 0, linuxerr.EINVAL
+	}
+	hostFD, err := eventFile.HostFD()
+	if err != nil {
+		return 0, err
+	}
+	return int32(hostFD), nil
+}
@@ -0,0 +1,195 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfioproxy
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/devutil"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// groupDevice implements vfs.Device for /dev/vfio/[0-9]+.
+//
+// +stateify savable
+type groupDevice struct {
+	name string
+}
+
+// Open implements vfs.Device.Open.
+func (dev *groupDevice) Open(ctx context.Context, mnt *vfs.Mount, vfsd *vfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	devClient := devutil.GoferClientFromContext(ctx)
+	if devClient == nil {
+		log.Warningf("devutil.CtxDevGoferClient is not set")
+		return nil, linuxerr.ENOENT
+	}
+	devName := "vfio/" + dev.name
+	hostFD, err := devClient.OpenAt(ctx, devName, opts.Flags)
+	if err != nil {
+		ctx.Warningf("vfioproxy: failed to open host /dev/%s: %v", devName, err)
+		return nil, err
+	}
+	fd := &groupFD{
+		hostFD: int32(hostFD),
+	}
+	if err := fd.vfsfd.Init(fd, opts.Flags, mnt, vfsd, &vfs.FileDescriptionOptions{
+		UseDentryMetadata: true,
+	}); err != nil {
+		unix.Close(hostFD)
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// groupFD implements vfs.FileDescriptionImpl for /dev/vfio/[0-9]+.
+//
+// groupFD is not savable; we do not implement save/restore of host device
+// state.
+type groupFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.NoLockFD
+
+	hostFD int32
+
+	mu sync.Mutex
+	// container is the containerFD that the group is attached to, if any. A
+	// reference is held on it while the group is attached, so that memory
+	// mapped for DMA through the container stays pinned for as long as the
+	// group's devices may access it.
+	//
+	// +checklocks:mu
+	container *vfs.FileDescription
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *groupFD) Release(ctx context.Context) {
+	// deviceFDs hold a reference on their groupFD, so closing the host group
+	// detaches it from its container.
+	unix.Close(int(fd.hostFD))
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if fd.container != nil {
+		fd.container.DecRef(ctx)
+		fd.container = nil
+	}
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *groupFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	cmd := args[1].Uint()
+	argPtr := args[2].Pointer()
+
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+
+	switch cmd {
+	case linux.VFIO_GROUP_GET_STATUS:
+		return ioctlArgsz(t, fd.hostFD, cmd, argPtr, (*linux.VFIOGroupStatus)(nil).SizeBytes())
+	case linux.VFIO_GROUP_SET_CONTAINER:
+		return fd.setContainer(ctx, t, argPtr)
+	case linux.VFIO_GROUP_UNSET_CONTAINER:
+		return fd.unsetContainer(ctx)
+	case linux.VFIO_GROUP_GET_DEVICE_FD:
+		return fd.getDeviceFD(ctx, t, argPtr)
+	default:
+		return 0, linuxerr.ENOTTY
+	}
+}
+
+// setContainer implements VFIO_GROUP_SET_CONTAINER.
+func (fd *groupFD) setContainer(ctx context.Context, t *kernel.Task, argPtr hostarch.Addr) (uintptr, error) {
+	var containerFDNum primitive.Int32
+	if _, err := containerFDNum.CopyIn(t, argPtr); err != nil {
+		return 0, err
+	}
+	file, _ := t.FDTable().Get(int32(containerFDNum))
+	if file == nil {
+		return 0, linuxerr.EBADF
+	}
+	defer file.DecRef(ctx)
+	container, ok := file.Impl().(*containerFD)
+	if !ok {
+		return 0, linuxerr.EINVAL
+	}
+
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if fd.container != nil {
+		return 0, linuxerr.EINVAL
+	}
+	hostContainerFD := container.hostFD
+	n, err := ioctlInvokePtrArg(fd.hostFD, linux.VFIO_GROUP_SET_CONTAINER, &hostContainerFD)
+	if err != nil {
+		return n, err
+	}
+	file.IncRef()
+	fd.container = file
+	return n, nil
+}
+
+// unsetContainer implements VFIO_GROUP_UNSET_CONTAINER.
+func (fd *groupFD) unsetContainer(ctx context.Context) (uintptr, error) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	n, err := ioctlInvoke(fd.hostFD, linux.VFIO_GROUP_UNSET_CONTAINER, 0)
+	if err != nil {
+		return n, err
+	}
+	if fd.container != nil {
+		fd.container.DecRef(ctx)
+		fd.container = nil
+	}
+	return n, nil
+}
+
+// getDeviceFD implements VFIO_GROUP_GET_DEVICE_FD.
+func (fd *groupFD) getDeviceFD(ctx context.Context, t *kernel.Task, argPtr hostarch.Addr) (uintptr, error) {
+	name, err := t.CopyInString(argPtr, linux.NAME_MAX)
+	if err != nil {
+		return 0, err
+	}
+	cname := append([]byte(name), 0)
+	hostDeviceFD, err := ioctlInvokePtrArg(fd.hostFD, linux.VFIO_GROUP_GET_DEVICE_FD, &cname[0])
+	if err != nil {
+		return 0, err
+	}
+	file, err := newDeviceFD(ctx, t.Kernel().VFS(), int32(hostDeviceFD), &fd.vfsfd)
+	if err != nil {
+		unix.Close(int(hostDeviceFD))
+		return 0, err
+	}
+	defer file.DecRef(ctx)
+	// VFIO device files are always close-on-exec.
+	newFD, err := t.NewFDFrom(0, file, kernel.FDFlags{
+		CloseOnExec: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return uintptr(newFD), nil
+}
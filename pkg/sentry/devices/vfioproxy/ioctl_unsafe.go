@@ -0,0 +1,36 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfioproxy
+
+import (
+	"unsafe"
+
+	"golang.org/x/exp/constraints"
+	"golang.org/x/sys/unix"
+)
+
+func ioctlInvokePtrArg[Params any](hostFD int32, cmd uint32, params *Params) (uintptr, error) {
+	return ioctlInvoke[uintptr](hostFD, cmd, uintptr(unsafe.Pointer(params)))
+}
+
+// ioctlInvoke uses unix.Syscall rather than unix.RawSyscall since VFIO ioctls
+// may block for a long time, e.g. while pinning memory or resetting a device.
+func ioctlInvoke[Arg constraints.Integer](hostFD int32, cmd uint32, arg Arg) (uintptr, error) {
+	n, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(hostFD), uintptr(cmd), uintptr(arg))
+	if errno != 0 {
+		return n, errno
+	}
+	return n, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vfioproxy implements proxying for VFIO devices. It allows userspace
+// drivers in the sandbox, such as DPDK, to drive PCI devices bound to the
+// host's vfio-pci driver, e.g. SR-IOV virtual functions of a network card.
+//
+// /dev/vfio/vfio (the VFIO container) and /dev/vfio/$GROUP are backed by the
+// corresponding host files, opened through the dev gofer. Device DMA is
+// confined by the host IOMMU to application memory mapped with
+// VFIO_IOMMU_MAP_DMA, which the sentry keeps pinned for as long as it is
+// mapped.
+package vfioproxy
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+const (
+	// containerDeviceName is the path of the VFIO container device, relative
+	// to /dev.
+	containerDeviceName = "vfio/vfio"
+
+	// maxArgsz is the maximum argsz that is accepted for ioctls whose
+	// argument is passed through to the host as is.
+	maxArgsz = 64 * 1024
+)
+
+// Group describes a VFIO group exposed to the sandbox.
+type Group struct {
+	// Name is the group's file name in /dev/vfio, i.e. its IOMMU group number.
+	Name string
+
+	// Major and Minor are the device numbers of /dev/vfio/Name in the
+	// sandbox. The VFIO group major device number is dynamically assigned
+	// on the host.
+	Major uint32
+	Minor uint32
+}
+
+// Register registers the VFIO container device and the devices of the given
+// VFIO groups in vfsObj.
+func Register(vfsObj *vfs.VirtualFilesystem, groups []Group) error {
+	if err := vfsObj.RegisterDevice(vfs.CharDevice, linux.MISC_MAJOR, linux.VFIO_MINOR, &containerDevice{}, &vfs.RegisterDeviceOptions{
+		GroupName: "misc",
+	}); err != nil {
+		return err
+	}
+	for _, g := range groups {
+		if err := vfsObj.RegisterDevice(vfs.CharDevice, g.Major, g.Minor, &groupDevice{
+			name: g.Name,
+		}, &vfs.RegisterDeviceOptions{
+			GroupName: "vfio",
+		}); err != nil {
+			return fmt.Errorf("registering VFIO group %q: %w", g.Name, err)
+		}
+	}
+	return nil
+}
+
+// ioctlArgsz invokes an ioctl whose argument starts with its own size, argsz,
+// and contains no pointers or file descriptors, such that it can be passed
+// through to the host as is. This is the case for ioctls that return
+// capability chains following a fixed-size structure. minSize is the size of
+// the fixed-size structure, which the host reads before validating argsz.
+func ioctlArgsz(t *kernel.Task, hostFD int32, cmd uint32, argPtr hostarch.Addr, minSize int) (uintptr, error) {
+	var argsz primitive.Uint32
+	if _, err := argsz.CopyIn(t, argPtr); err != nil {
+		return 0, err
+	}
+	if argsz > maxArgsz {
+		return 0, linuxerr.EINVAL
+	}
+	buf := make([]byte, max(int(argsz), minSize))
+	if _, err := t.CopyInBytes(argPtr, buf[:argsz]); err != nil {
+		return 0, err
+	}
+	// The application may have changed argsz concurrently.
+	hostarch.ByteOrder.PutUint32(buf, uint32(argsz))
+	n, err := ioctlInvokePtrArg(hostFD, cmd, &buf[0])
+	if err != nil {
+		return n, err
+	}
+	if _, err := t.CopyOutBytes(argPtr, buf[:argsz]); err != nil {
+		return n, err
+	}
+	return n, nil
+}
@@ -92,11 +92,12 @@ var allControllers = []kernel.CgroupControllerType{
 	kernel.CgroupControllerDevices,
 	kernel.CgroupControllerJob,
 	kernel.CgroupControllerMemory,
+	kernel.CgroupControllerMisc,
 	kernel.CgroupControllerPIDs,
 }
 
 // SupportedMountOptions is the set of supported mount options for cgroupfs.
-var SupportedMountOptions = []string{"all", "cpu", "cpuacct", "cpuset", "devices", "job", "memory", "pids"}
+var SupportedMountOptions = []string{"all", "cpu", "cpuacct", "cpuset", "devices", "job", "memory", "misc", "pids"}
 
 // FilesystemType implements vfs.FilesystemType.
 //
@@ -240,6 +241,10 @@ func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		delete(mopts, "memory")
 		wantControllers = append(wantControllers, kernel.CgroupControllerMemory)
 	}
+	if _, ok := mopts["misc"]; ok {
+		delete(mopts, "misc")
+		wantControllers = append(wantControllers, kernel.CgroupControllerMisc)
+	}
 	if _, ok := mopts["pids"]; ok {
 		delete(mopts, "pids")
 		wantControllers = append(wantControllers, kernel.CgroupControllerPIDs)
@@ -352,6 +357,8 @@ func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 			c = newJobController(fs)
 		case kernel.CgroupControllerMemory:
 			c = newMemoryController(fs, defaults)
+		case kernel.CgroupControllerMisc:
+			c = newRootMiscController(fs)
 		case kernel.CgroupControllerPIDs:
 			c = newRootPIDsController(fs)
 		default:
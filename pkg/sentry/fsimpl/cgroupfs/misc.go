@@ -0,0 +1,271 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgroupfs
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// miscLimitUnlimited is the misc.max value for a resource without a limit.
+const miscLimitUnlimited = math.MaxInt64
+
+// miscResources lists the resources tracked by the misc controller, in the
+// order they are displayed in control files.
+var miscResources = []struct {
+	res  kernel.CgroupResourceType
+	name string
+}{
+	{res: kernel.CgroupResourceGPUMemory, name: "gpu_mem"},
+}
+
+// miscResource is the accounting state of a single resource in a misc cgroup.
+//
+// +stateify savable
+type miscResource struct {
+	// current is the amount of the resource charged to the cgroup and its
+	// descendants.
+	current atomicbitops.Int64
+
+	// max is the limit on current.
+	max atomicbitops.Int64
+
+	// events is the number of times a charge was denied because it would
+	// have exceeded max.
+	events atomicbitops.Int64
+}
+
+// miscController implements the misc cgroup controller, which limits scalar
+// resources that aren't covered by other controllers. See Linux,
+// Documentation/admin-guide/cgroup-v2.rst, "Misc".
+//
+// Unlike the pids controller, charges don't follow tasks. A resource stays
+// charged to the cgroup that allocated it until it is released, even if the
+// allocating task migrates or exits. Charges are hierarchical: charging a
+// cgroup also charges all of its ancestors, and the charge is denied if it
+// would exceed the limit of any of them.
+//
+// +stateify savable
+type miscController struct {
+	controllerCommon
+	controllerStateless
+
+	// isRoot indicates if this is the root cgroup in its hierarchy. Immutable.
+	isRoot bool
+
+	// resources maps each resource in miscResources to its state. The map is
+	// immutable; the values are updated atomically.
+	resources map[kernel.CgroupResourceType]*miscResource
+}
+
+var _ controller = (*miscController)(nil)
+
+func newMiscResources() map[kernel.CgroupResourceType]*miscResource {
+	resources := make(map[kernel.CgroupResourceType]*miscResource, len(miscResources))
+	for _, r := range miscResources {
+		resources[r.res] = &miscResource{
+			max: atomicbitops.FromInt64(miscLimitUnlimited),
+		}
+	}
+	return resources
+}
+
+// newRootMiscController creates the root node for a misc cgroup. Child
+// directories should be created through Clone.
+func newRootMiscController(fs *filesystem) *miscController {
+	c := &miscController{
+		isRoot:    true,
+		resources: newMiscResources(),
+	}
+	c.controllerCommon.init(kernel.CgroupControllerMisc, fs)
+	return c
+}
+
+// Clone implements controller.Clone.
+func (c *miscController) Clone() controller {
+	new := &miscController{
+		resources: newMiscResources(),
+	}
+	new.controllerCommon.cloneFromParent(c)
+	return new
+}
+
+// AddControlFiles implements controller.AddControlFiles.
+func (c *miscController) AddControlFiles(ctx context.Context, creds *auth.Credentials, _ *cgroupInode, contents map[string]kernfs.Inode) {
+	contents["misc.current"] = c.fs.newControllerFile(ctx, creds, &miscCurrentData{c: c}, true)
+	if !c.isRoot {
+		// As in Linux, limits and events aren't available in the root cgroup.
+		contents["misc.max"] = c.fs.newControllerWritableFile(ctx, creds, &miscMaxData{c: c}, true)
+		contents["misc.events"] = c.fs.newControllerFile(ctx, creds, &miscEventsData{c: c}, true)
+	}
+}
+
+func (c *miscController) resource(res kernel.CgroupResourceType) *miscResource {
+	r, ok := c.resources[res]
+	if !ok {
+		panic(fmt.Sprintf("cgroupfs: misc controller invalid resource type %v", res))
+	}
+	return r
+}
+
+// Charge implements controller.Charge.
+//
+// Positive charges fail with EBUSY if they would exceed the limit of c or of
+// any of its ancestors, in which case nothing is charged. The caller is
+// responsible for ensuring negative charges correspond to previous positive
+// charges of the same cgroup.
+func (c *miscController) Charge(t *kernel.Task, d *kernfs.Dentry, res kernel.CgroupResourceType, value int64) error {
+	for cur := c; cur != nil; cur = cur.parentMisc() {
+		r := cur.resource(res)
+		if value < 0 {
+			if r.current.Add(value) < 0 {
+				panic(fmt.Sprintf("cgroupfs: misc controller charge underflow for resource %v, path: %q", res, d.FSLocalPath()))
+			}
+			continue
+		}
+		if !r.tryCharge(value) {
+			r.events.Add(1)
+			// Roll back the charges to the descendants of cur.
+			for undo := c; undo != cur; undo = undo.parentMisc() {
+				undo.resource(res).current.Add(-value)
+			}
+			log.Debugf("cgroupfs: misc controller charge denied due to limit: path: %q, resource: %v, requested: %d, current: %d, max: %d",
+				d.FSLocalPath(), res, value, r.current.Load(), r.max.Load())
+			return linuxerr.EBUSY
+		}
+	}
+	return nil
+}
+
+// tryCharge adds value to r.current if doing so doesn't exceed r.max.
+func (r *miscResource) tryCharge(value int64) bool {
+	for {
+		cur := r.current.Load()
+		if cur+value > r.max.Load() || cur+value < cur {
+			return false
+		}
+		if r.current.CompareAndSwap(cur, cur+value) {
+			return true
+		}
+	}
+}
+
+func (c *miscController) parentMisc() *miscController {
+	if c.parent == nil {
+		return nil
+	}
+	return c.parent.(*miscController)
+}
+
+// +stateify savable
+type miscCurrentData struct {
+	c *miscController
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *miscCurrentData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	for _, r := range miscResources {
+		fmt.Fprintf(buf, "%s %d\n", r.name, d.c.resources[r.res].current.Load())
+	}
+	return nil
+}
+
+// +stateify savable
+type miscEventsData struct {
+	c *miscController
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *miscEventsData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	for _, r := range miscResources {
+		fmt.Fprintf(buf, "%s.max %d\n", r.name, d.c.resources[r.res].events.Load())
+	}
+	return nil
+}
+
+// +stateify savable
+type miscMaxData struct {
+	c *miscController
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *miscMaxData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	for _, r := range miscResources {
+		if limit := d.c.resources[r.res].max.Load(); limit == miscLimitUnlimited {
+			fmt.Fprintf(buf, "%s max\n", r.name)
+		} else {
+			fmt.Fprintf(buf, "%s %d\n", r.name, limit)
+		}
+	}
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *miscMaxData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	return d.WriteBackground(ctx, src)
+}
+
+// WriteBackground implements writableControllerFileImpl.WriteBackground.
+//
+// The written value has the form "<resource> <limit>", where limit is either
+// a number of units or "max".
+func (d *miscMaxData) WriteBackground(ctx context.Context, src usermem.IOSequence) (int64, error) {
+	buf := copyScratchBufferFromContext(ctx, hostarch.PageSize)
+	n, err := src.CopyIn(ctx, buf)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(buf[:n]))
+	if len(fields) != 2 {
+		return 0, linuxerr.EINVAL
+	}
+
+	var r *miscResource
+	for _, mr := range miscResources {
+		if mr.name == fields[0] {
+			r = d.c.resources[mr.res]
+			break
+		}
+	}
+	if r == nil {
+		return 0, linuxerr.EINVAL
+	}
+
+	limit := int64(miscLimitUnlimited)
+	if fields[1] != "max" {
+		limit, err = strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || limit < 0 {
+			return 0, linuxerr.EINVAL
+		}
+	}
+	// As with pids.max, lowering the limit below the current charge doesn't
+	// reclaim anything; it only causes subsequent charges to fail.
+	r.max.Store(limit)
+	return int64(n), nil
+}
@@ -22,6 +22,7 @@ import (
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/waiter"
 )
 
@@ -182,6 +183,25 @@ type connection struct {
 	// noOpen if FUSE server doesn't support open operation.
 	// This flag only influences performance, not correctness of the program.
 	noOpen bool
+
+	// passthrough is true if the server may open files with
+	// FOPEN_PASSTHROUGH, so that their reads and writes go directly to a
+	// backing file.
+	// Negotiated and only set in INIT.
+	passthrough bool
+
+	// maxStackDepth is the maximum stacking depth of backing files.
+	// Negotiated and only set in INIT.
+	maxStackDepth uint32
+
+	// backingFiles maps backing IDs registered with
+	// FUSE_DEV_IOC_BACKING_OPEN to the referenced backing files.
+	// +checklocks:mu
+	backingFiles map[int32]*vfs.FileDescription
+
+	// nextBackingID is the most recently allocated backing ID.
+	// +checklocks:mu
+	nextBackingID int32
 }
 
 func (conn *connection) saveInitializedChan() bool {
@@ -42,7 +42,8 @@ const (
 
 	// The FUSE_INIT_IN flags sent to the daemon.
 	// TODO(gvisor.dev/issue/3199): complete the flags.
-	fuseDefaultInitFlags = linux.FUSE_MAX_PAGES
+	fuseDefaultInitFlags  = linux.FUSE_MAX_PAGES | linux.FUSE_INIT_EXT
+	fuseDefaultInitFlags2 = linux.FUSE_PASSTHROUGH
 
 	// An INIT response needs to be at least this long.
 	minInitSize = 24
@@ -84,6 +85,7 @@ func (conn *connection) InitSend(creds *auth.Credentials, pid uint32) error {
 		// TODO(gvisor.dev/issue/3196): find appropriate way to calculate this
 		MaxReadahead: fuseDefaultMaxReadahead,
 		Flags:        fuseDefaultInitFlags,
+		Flags2:       fuseDefaultInitFlags2,
 	}
 
 	req := conn.NewRequest(creds, pid, 0, linux.FUSE_INIT, &in)
@@ -162,6 +164,15 @@ func (conn *connection) initProcessReply(out *linux.FUSEInitOut, hasSysAdminCap
 			}
 			conn.maxPages = maxPages
 		}
+
+		// As in Linux, passthrough is incompatible with the writeback cache,
+		// and the server must bound the stacking depth of backing files.
+		if out.Flags&linux.FUSE_INIT_EXT != 0 && out.Flags2&linux.FUSE_PASSTHROUGH != 0 &&
+			!conn.writebackCache && out.MaxStackDepth > 0 &&
+			out.MaxStackDepth <= linux.FUSE_PASSTHROUGH_MAX_STACK_DEPTH {
+			conn.passthrough = true
+			conn.maxStackDepth = out.MaxStackDepth
+		}
 	}
 
 	// No support for limits before minor version 13.
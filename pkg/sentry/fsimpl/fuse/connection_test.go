@@ -19,9 +19,11 @@ import (
 	"testing"
 
 	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/marshal/primitive"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
 )
 
 // TestConnectionInitBlock tests if initialization
@@ -105,3 +107,117 @@ func TestConnectionAbort(t *testing.T) {
 	}
 
 }
+
+// TestConnectionInitPassthrough tests FUSE_PASSTHROUGH negotiation in the
+// FUSE_INIT reply.
+func TestConnectionInitPassthrough(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		out   linux.FUSEInitOut
+		want  bool
+		depth uint32
+	}{
+		{
+			name: "Enabled",
+			out: linux.FUSEInitOut{
+				Flags:         linux.FUSE_INIT_EXT,
+				Flags2:        linux.FUSE_PASSTHROUGH,
+				MaxStackDepth: 1,
+			},
+			want:  true,
+			depth: 1,
+		},
+		{
+			name: "NoInitExt",
+			out: linux.FUSEInitOut{
+				Flags2:        linux.FUSE_PASSTHROUGH,
+				MaxStackDepth: 1,
+			},
+		},
+		{
+			name: "NotRequested",
+			out: linux.FUSEInitOut{
+				Flags:         linux.FUSE_INIT_EXT,
+				MaxStackDepth: 1,
+			},
+		},
+		{
+			name: "ZeroStackDepth",
+			out: linux.FUSEInitOut{
+				Flags:  linux.FUSE_INIT_EXT,
+				Flags2: linux.FUSE_PASSTHROUGH,
+			},
+		},
+		{
+			name: "StackTooDeep",
+			out: linux.FUSEInitOut{
+				Flags:         linux.FUSE_INIT_EXT,
+				Flags2:        linux.FUSE_PASSTHROUGH,
+				MaxStackDepth: linux.FUSE_PASSTHROUGH_MAX_STACK_DEPTH + 1,
+			},
+		},
+		{
+			name: "WritebackCache",
+			out: linux.FUSEInitOut{
+				Flags:         linux.FUSE_INIT_EXT | linux.FUSE_WRITEBACK_CACHE,
+				Flags2:        linux.FUSE_PASSTHROUGH,
+				MaxStackDepth: 1,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := setup(t)
+			defer s.Destroy()
+
+			conn, _, err := newTestConnection(s, maxActiveRequestsDefault)
+			if err != nil {
+				t.Fatalf("newTestConnection: %v", err)
+			}
+			tc.out.Major = linux.FUSE_KERNEL_VERSION
+			tc.out.Minor = linux.FUSE_KERNEL_MINOR_VERSION
+			if err := conn.initProcessReply(&tc.out, true /* hasSysAdminCap */); err != nil {
+				t.Fatalf("initProcessReply: %v", err)
+			}
+			if conn.passthrough != tc.want {
+				t.Errorf("got passthrough %t, want %t", conn.passthrough, tc.want)
+			}
+			if got := conn.stackDepth(); got != tc.depth {
+				t.Errorf("got stack depth %d, want %d", got, tc.depth)
+			}
+		})
+	}
+}
+
+func TestConnectionBackingFile(t *testing.T) {
+	s := setup(t)
+	defer s.Destroy()
+
+	conn, fd, err := newTestConnection(s, maxActiveRequestsDefault)
+	if err != nil {
+		t.Fatalf("newTestConnection: %v", err)
+	}
+	if _, err := conn.backingFile(0); !linuxerr.Equals(linuxerr.EINVAL, err) {
+		t.Errorf("backingFile(0) got error %v, want EINVAL", err)
+	}
+	if _, err := conn.backingFile(1); !linuxerr.Equals(linuxerr.ENOENT, err) {
+		t.Errorf("backingFile(1) got error %v, want ENOENT", err)
+	}
+
+	fd.IncRef()
+	conn.mu.Lock()
+	conn.backingFiles = map[int32]*vfs.FileDescription{1: fd}
+	conn.mu.Unlock()
+	backing, err := conn.backingFile(1)
+	if err != nil {
+		t.Fatalf("backingFile(1): %v", err)
+	}
+	if backing != fd {
+		t.Errorf("backingFile(1) got %p, want %p", backing, fd)
+	}
+	backing.DecRef(s.Ctx)
+
+	conn.releaseBackingFiles(s.Ctx)
+	if _, err := conn.backingFile(1); !linuxerr.Equals(linuxerr.ENOENT, err) {
+		t.Errorf("backingFile(1) after releaseBackingFiles got error %v, want ENOENT", err)
+	}
+}
@@ -108,6 +108,9 @@ func (fd *DeviceFD) Release(ctx context.Context) {
 
 		fd.conn.Abort(ctx) // +checklocksforce: fd.conn.fd.mu=fd.mu
 		fd.waitQueue.Notify(waiter.ReadableEvents)
+		// Files already opened in passthrough mode hold their own
+		// references on their backing files.
+		fd.conn.releaseBackingFiles(ctx)
 		fd.conn = nil
 	}
 }
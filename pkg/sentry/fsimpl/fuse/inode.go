@@ -34,9 +34,10 @@ import (
 
 // +stateify savable
 type fileHandle struct {
-	new    bool
-	handle uint64
-	flags  uint32
+	new       bool
+	handle    uint64
+	flags     uint32
+	backingID int32
 }
 
 // inode implements kernfs.Inode.
@@ -291,6 +292,7 @@ func (i *inode) Open(ctx context.Context, rp *vfs.ResolvingPath, d *kernfs.Dentr
 	fd.LockFD.Init(&i.locks)
 	// FOPEN_KEEP_CACHE is the default flag for noOpen.
 	fd.OpenFlag = linux.FOPEN_KEEP_CACHE
+	var backingID int32
 
 	truncateRegFile := opts.Flags&linux.O_TRUNC != 0 && i.filemode().FileType() == linux.S_IFREG
 	if truncateRegFile && (i.fh.new || !i.fs.conn.atomicOTrunc) {
@@ -308,6 +310,7 @@ func (i *inode) Open(ctx context.Context, rp *vfs.ResolvingPath, d *kernfs.Dentr
 	if i.fh.new {
 		fd.OpenFlag = i.fh.flags
 		fd.Fh = i.fh.handle
+		backingID = i.fh.backingID
 		i.fh.new = false
 		// Only send an open request when the FUSE server supports open or is
 		// opening a directory.
@@ -336,6 +339,7 @@ func (i *inode) Open(ctx context.Context, rp *vfs.ResolvingPath, d *kernfs.Dentr
 			}
 			fd.OpenFlag = out.OpenFlag
 			fd.Fh = out.Fh
+			backingID = out.BackingID
 			// Open was successful. Update inode's size if atomicOTrunc && O_TRUNC.
 			if truncateRegFile && i.fs.conn.atomicOTrunc {
 				i.fs.conn.mu.Lock()
@@ -347,7 +351,18 @@ func (i *inode) Open(ctx context.Context, rp *vfs.ResolvingPath, d *kernfs.Dentr
 		}
 	}
 	if i.filemode().IsDir() {
-		fd.OpenFlag &= ^uint32(linux.FOPEN_DIRECT_IO)
+		fd.OpenFlag &= ^uint32(linux.FOPEN_DIRECT_IO | linux.FOPEN_PASSTHROUGH)
+	}
+	if fd.OpenFlag&linux.FOPEN_PASSTHROUGH != 0 {
+		// The server must not ask for passthrough unless it negotiated it.
+		if !i.fs.conn.passthrough {
+			return nil, linuxerr.EINVAL
+		}
+		backing, err := i.fs.conn.backingFile(backingID)
+		if err != nil {
+			return nil, err
+		}
+		fdImpl.(*regularFileFD).passthrough = backing
 	}
 
 	// TODO(gvisor.dev/issue/3234): invalidate mmap after implemented it for FUSE Inode
@@ -360,6 +375,9 @@ func (i *inode) Open(ctx context.Context, rp *vfs.ResolvingPath, d *kernfs.Dentr
 	}
 
 	if err := fd.vfsfd.Init(fdImpl, opts.Flags, rp.Mount(), d.VFSDentry(), fdOptions); err != nil {
+		if regularFD, ok := fdImpl.(*regularFileFD); ok && regularFD.passthrough != nil {
+			regularFD.passthrough.DecRef(ctx)
+		}
 		return nil, err
 	}
 	return &fd.vfsfd, nil
@@ -518,6 +536,7 @@ func (i *inode) newEntry(ctx context.Context, name string, fileType linux.FileMo
 			childI.fh.new = true
 			childI.fh.handle = out.FUSEOpenOut.Fh
 			childI.fh.flags = out.FUSEOpenOut.OpenFlag
+			childI.fh.backingID = out.FUSEOpenOut.BackingID
 		}
 	}
 	return child, nil
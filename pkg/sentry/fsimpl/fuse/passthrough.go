@@ -0,0 +1,197 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuse
+
+import (
+	"math"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *DeviceFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+
+	switch args[1].Uint() {
+	case linux.FUSE_DEV_IOC_BACKING_OPEN:
+		var m linux.FUSEBackingMap
+		if _, err := m.CopyIn(t, args[2].Pointer()); err != nil {
+			return 0, err
+		}
+		id, err := fd.backingOpen(t, &m)
+		return uintptr(id), err
+
+	case linux.FUSE_DEV_IOC_BACKING_CLOSE:
+		var id primitive.Int32
+		if _, err := id.CopyIn(t, args[2].Pointer()); err != nil {
+			return 0, err
+		}
+		return 0, fd.backingClose(t, int32(id))
+
+	default:
+		return 0, linuxerr.ENOTTY
+	}
+}
+
+// backingOpen registers the file given by m as a backing file for
+// FOPEN_PASSTHROUGH and returns its backing ID.
+func (fd *DeviceFD) backingOpen(t *kernel.Task, m *linux.FUSEBackingMap) (int32, error) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if !fd.connected() || !fd.conn.passthrough || !t.HasCapabilityIn(linux.CAP_SYS_ADMIN, t.Kernel().RootUserNamespace()) {
+		return 0, linuxerr.EPERM
+	}
+	if m.Flags != 0 {
+		return 0, linuxerr.EINVAL
+	}
+
+	backing := t.GetFile(m.FD)
+	if backing == nil {
+		return 0, linuxerr.EBADF
+	}
+	// Linux requires backing files to implement read_iter and write_iter;
+	// only regular files do so consistently.
+	stat, err := backing.Stat(t, vfs.StatOptions{Mask: linux.STATX_TYPE})
+	if err != nil {
+		backing.DecRef(t)
+		return 0, err
+	}
+	if stat.Mode&linux.S_IFMT != linux.S_IFREG {
+		backing.DecRef(t)
+		return 0, linuxerr.EINVAL
+	}
+	// Limit stacking of passthrough filesystems, since each level may hold
+	// references on the one below.
+	if fs, ok := backing.Mount().Filesystem().Impl().(*filesystem); ok && fs.conn.stackDepth() >= fd.conn.maxStackDepth {
+		backing.DecRef(t)
+		return 0, linuxerr.ELOOP
+	}
+
+	fd.conn.mu.Lock()
+	defer fd.conn.mu.Unlock()
+	if fd.conn.backingFiles == nil {
+		fd.conn.backingFiles = make(map[int32]*vfs.FileDescription)
+	}
+	// Allocate IDs cyclically, as Linux does, so that a recently closed ID
+	// is not immediately reused.
+	for {
+		fd.conn.nextBackingID++
+		if fd.conn.nextBackingID <= 0 || fd.conn.nextBackingID == math.MaxInt32 {
+			fd.conn.nextBackingID = 1
+		}
+		if _, ok := fd.conn.backingFiles[fd.conn.nextBackingID]; !ok {
+			break
+		}
+	}
+	id := fd.conn.nextBackingID
+	fd.conn.backingFiles[id] = backing
+	return id, nil
+}
+
+// backingClose unregisters the backing file with the given ID. Files already
+// opened with it keep using it.
+func (fd *DeviceFD) backingClose(t *kernel.Task, id int32) error {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if !fd.connected() || !fd.conn.passthrough || !t.HasCapabilityIn(linux.CAP_SYS_ADMIN, t.Kernel().RootUserNamespace()) {
+		return linuxerr.EPERM
+	}
+	if id <= 0 {
+		return linuxerr.EINVAL
+	}
+
+	fd.conn.mu.Lock()
+	backing, ok := fd.conn.backingFiles[id]
+	delete(fd.conn.backingFiles, id)
+	fd.conn.mu.Unlock()
+	if !ok {
+		return linuxerr.ENOENT
+	}
+	backing.DecRef(t)
+	return nil
+}
+
+// stackDepth returns the stacking depth of files on the connection's
+// filesystem, for use as backing files of another FUSE filesystem.
+func (conn *connection) stackDepth() uint32 {
+	if !conn.passthrough {
+		return 0
+	}
+	return conn.maxStackDepth
+}
+
+// backingFile returns the backing file with the given ID, with a reference
+// taken on it.
+func (conn *connection) backingFile(id int32) (*vfs.FileDescription, error) {
+	if id <= 0 {
+		return nil, linuxerr.EINVAL
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	backing, ok := conn.backingFiles[id]
+	if !ok {
+		return nil, linuxerr.ENOENT
+	}
+	backing.IncRef()
+	return backing, nil
+}
+
+// releaseBackingFiles drops the connection's references on all backing files.
+func (conn *connection) releaseBackingFiles(ctx context.Context) {
+	conn.mu.Lock()
+	backingFiles := conn.backingFiles
+	conn.backingFiles = nil
+	conn.mu.Unlock()
+	for _, backing := range backingFiles {
+		backing.DecRef(ctx)
+	}
+}
+
+// passthroughWrite writes src to fd's backing file at offset. It returns the
+// number of bytes written, final offset and error.
+func (fd *regularFileFD) passthroughWrite(ctx context.Context, src usermem.IOSequence, offset int64, opts vfs.WriteOptions) (int64, int64, error) {
+	if fd.vfsfd.StatusFlags()&linux.O_APPEND != 0 {
+		stat, err := fd.passthrough.Stat(ctx, vfs.StatOptions{Mask: linux.STATX_SIZE})
+		if err != nil {
+			return 0, offset, err
+		}
+		offset = int64(stat.Size)
+	}
+	n, err := fd.passthrough.PWrite(ctx, src, offset, opts)
+	offset += n
+	if n > 0 {
+		// As in Linux's fuse_write_update_attr(), keep the cached size in
+		// line with the backing file.
+		inode := fd.inode()
+		inode.attrMu.Lock()
+		if offset > int64(inode.size.Load()) {
+			inode.size.Store(uint64(offset))
+			inode.fs.conn.attributeVersion.Add(1)
+		}
+		inode.touchCMtime()
+		inode.attrMu.Unlock()
+	}
+	return n, offset, err
+}
@@ -56,6 +56,19 @@ type regularFileFD struct {
 	//
 	// Protected by dataMu.
 	data fsutil.FileRangeSet
+
+	// passthrough is the backing file that reads, writes and mappings go to
+	// if the file was opened with FOPEN_PASSTHROUGH, or nil otherwise.
+	// Immutable after Open.
+	passthrough *vfs.FileDescription
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *regularFileFD) Release(ctx context.Context) {
+	fd.fileDescription.Release(ctx)
+	if fd.passthrough != nil {
+		fd.passthrough.DecRef(ctx)
+	}
 }
 
 // Seek implements vfs.FileDescriptionImpl.Allocate.
@@ -121,6 +134,9 @@ func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offs
 	if offset < 0 {
 		return 0, linuxerr.EINVAL
 	}
+	if fd.passthrough != nil {
+		return fd.passthrough.PRead(ctx, dst, offset, opts)
+	}
 
 	// Check that flags are supported.
 	//
@@ -227,6 +243,9 @@ func (fd *regularFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 	if offset < 0 {
 		return 0, offset, linuxerr.EINVAL
 	}
+	if fd.passthrough != nil {
+		return fd.passthroughWrite(ctx, src, offset, opts)
+	}
 
 	// Check that flags are supported.
 	//
@@ -286,6 +305,10 @@ func (fd *regularFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 
 // ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap.
 func (fd *regularFileFD) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
+	if fd.passthrough != nil {
+		// As in Linux, mappings of passthrough files map the backing file.
+		return fd.passthrough.ConfigureMMap(ctx, opts)
+	}
 	return linuxerr.ENOSYS
 }
 
@@ -72,6 +72,20 @@ func (r *fuseInitRes) UnmarshalBytes(src []byte) []byte {
 		out.MaxPages = uint16(hostarch.ByteOrder.Uint16(src[:2]))
 		src = src[2:]
 	}
+	// Skip MapAlignment, introduced in FUSE kernel version 7.31.
+	if len(src) >= 2 {
+		src = src[2:]
+	}
+	// Introduced in FUSE kernel version 7.36.
+	if len(src) >= 4 {
+		out.Flags2 = uint32(hostarch.ByteOrder.Uint32(src[:4]))
+		src = src[4:]
+	}
+	// Introduced in FUSE kernel version 7.40.
+	if len(src) >= 4 {
+		out.MaxStackDepth = uint32(hostarch.ByteOrder.Uint32(src[:4]))
+		src = src[4:]
+	}
 	return src
 }
 
@@ -0,0 +1,137 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+)
+
+// consistencyMode controls when dentries cached by a filesystem are
+// revalidated against the remote filesystem. It only has an effect if
+// InteropModeShared is in effect, since other interop modes never revalidate.
+type consistencyMode uint32
+
+const (
+	// consistencyModeStrict revalidates cached dentries on every access. This
+	// is the default.
+	consistencyModeStrict consistencyMode = iota
+
+	// consistencyModeCloseToOpen trusts cached attributes for up to the
+	// attribute TTL, except that files are always revalidated when opened.
+	// Since InteropModeShared doesn't cache file data, changes made by other
+	// clients are visible to any file opened after they close the file, as
+	// with NFS close-to-open consistency.
+	consistencyModeCloseToOpen
+
+	// consistencyModeRelaxed trusts cached attributes for up to the attribute
+	// TTL for all operations, including open.
+	consistencyModeRelaxed
+)
+
+// Valid values for the "consistency" mount option.
+const (
+	consistencyStrict  = "strict"
+	consistencyCTO     = "cto"
+	consistencyRelaxed = "relaxed"
+)
+
+// defaultAttrTTL is the attribute TTL used by consistencyModeCloseToOpen and
+// consistencyModeRelaxed if the "attr_ttl" mount option isn't set. It matches
+// the default acregmin of Linux NFS mounts.
+const defaultAttrTTL = 3 * time.Second
+
+// consistencyOpts holds options controlling revalidation of cached dentries.
+//
+// +stateify savable
+type consistencyOpts struct {
+	// mode is derived from the "consistency" mount option.
+	mode consistencyMode
+
+	// attrTTL is the time for which attributes fetched from the remote
+	// filesystem are trusted without revalidation, unless mode is
+	// consistencyModeStrict. Zero disables attribute caching.
+	attrTTL time.Duration
+}
+
+// parseConsistencyOpts parses and removes the consistency options in mopts.
+func parseConsistencyOpts(ctx context.Context, mopts map[string]string, interop InteropMode) (consistencyOpts, error) {
+	var opts consistencyOpts
+	if str, ok := mopts[moptConsistency]; ok {
+		delete(mopts, moptConsistency)
+		switch str {
+		case consistencyStrict:
+			opts.mode = consistencyModeStrict
+		case consistencyCTO:
+			opts.mode = consistencyModeCloseToOpen
+		case consistencyRelaxed:
+			opts.mode = consistencyModeRelaxed
+		default:
+			ctx.Warningf("gofer.FilesystemType.GetFilesystem: invalid consistency mode: %s=%s", moptConsistency, str)
+			return consistencyOpts{}, linuxerr.EINVAL
+		}
+	}
+	opts.attrTTL = defaultAttrTTL
+	if str, ok := mopts[moptAttrTTL]; ok {
+		delete(mopts, moptAttrTTL)
+		ttl, err := time.ParseDuration(str)
+		if err != nil || ttl < 0 {
+			ctx.Warningf("gofer.FilesystemType.GetFilesystem: invalid attribute TTL: %s=%s", moptAttrTTL, str)
+			return consistencyOpts{}, linuxerr.EINVAL
+		}
+		opts.attrTTL = ttl
+	}
+	if opts.mode == consistencyModeStrict {
+		opts.attrTTL = 0
+	}
+	if opts.attrTTL != 0 && interop != InteropModeShared {
+		// Other interop modes trust cached attributes indefinitely.
+		ctx.Infof("gofer.FilesystemType.GetFilesystem: ignoring %s, which only applies to %s=%s", moptConsistency, moptCache, cacheRemoteRevalidating)
+		return consistencyOpts{}, nil
+	}
+	return opts, nil
+}
+
+// attrsFresh returns true if d's cached attributes were fetched from the
+// remote filesystem recently enough that they can be used without
+// revalidation.
+func (d *dentry) attrsFresh() bool {
+	ttl := d.fs.opts.consistency.attrTTL
+	if ttl == 0 {
+		return false
+	}
+	refreshed := d.attrsRefreshed.Load()
+	if refreshed == 0 {
+		return false
+	}
+	age := d.fs.clock.Now().Nanoseconds() - refreshed
+	return age >= 0 && age < ttl.Nanoseconds()
+}
+
+// markAttrsFresh records that d's attributes were just fetched from the
+// remote filesystem.
+func (d *dentry) markAttrsFresh() {
+	if d.fs.opts.consistency.attrTTL != 0 {
+		d.attrsRefreshed.Store(d.fs.clock.Now().Nanoseconds())
+	}
+}
+
+// revalidateOnOpen returns true if d must be revalidated when opened even if
+// its cached attributes are fresh.
+func (d *dentry) revalidateOnOpen() bool {
+	return d.fs.opts.consistency.mode != consistencyModeRelaxed
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sentry/contexttest"
+)
+
+func TestParseConsistencyOpts(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		mopts   map[string]string
+		interop InteropMode
+		want    consistencyOpts
+		wantErr bool
+	}{
+		{
+			name:    "none",
+			mopts:   map[string]string{},
+			interop: InteropModeShared,
+		},
+		{
+			name:    "strict ignores ttl",
+			mopts:   map[string]string{moptConsistency: "strict", moptAttrTTL: "10s"},
+			interop: InteropModeShared,
+		},
+		{
+			name:    "cto default ttl",
+			mopts:   map[string]string{moptConsistency: "cto"},
+			interop: InteropModeShared,
+			want:    consistencyOpts{mode: consistencyModeCloseToOpen, attrTTL: defaultAttrTTL},
+		},
+		{
+			name:    "relaxed",
+			mopts:   map[string]string{moptConsistency: "relaxed", moptAttrTTL: "1m"},
+			interop: InteropModeShared,
+			want:    consistencyOpts{mode: consistencyModeRelaxed, attrTTL: time.Minute},
+		},
+		{
+			name:    "zero ttl",
+			mopts:   map[string]string{moptConsistency: "relaxed", moptAttrTTL: "0s"},
+			interop: InteropModeShared,
+			want:    consistencyOpts{mode: consistencyModeRelaxed},
+		},
+		{
+			name:    "exclusive",
+			mopts:   map[string]string{moptConsistency: "relaxed"},
+			interop: InteropModeExclusive,
+		},
+		{
+			name:    "invalid mode",
+			mopts:   map[string]string{moptConsistency: "eventual"},
+			interop: InteropModeShared,
+			wantErr: true,
+		},
+		{
+			name:    "invalid ttl",
+			mopts:   map[string]string{moptConsistency: "cto", moptAttrTTL: "10"},
+			interop: InteropModeShared,
+			wantErr: true,
+		},
+		{
+			name:    "negative ttl",
+			mopts:   map[string]string{moptConsistency: "cto", moptAttrTTL: "-1s"},
+			interop: InteropModeShared,
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := contexttest.Context(t)
+			got, err := parseConsistencyOpts(ctx, tc.mopts, tc.interop)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("parseConsistencyOpts(%v) succeeded, want error", tc.mopts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseConsistencyOpts(%v) failed: %v", tc.mopts, err)
+			}
+			if got != tc.want {
+				t.Errorf("parseConsistencyOpts(%v) = %+v, want %+v", tc.mopts, got, tc.want)
+			}
+			if len(tc.mopts) != 0 {
+				t.Errorf("parseConsistencyOpts left unparsed options: %v", tc.mopts)
+			}
+		})
+	}
+}
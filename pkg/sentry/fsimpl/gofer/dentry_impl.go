@@ -148,6 +148,61 @@ func (d *dentry) updateHandles(ctx context.Context, h handle, readable, writable
 	}
 }
 
+// openHandlesCount returns the number of distinct handles in d's read and
+// write handles.
+//
+// Precondition: d.handleMu must be locked.
+func (d *dentry) openHandlesCount() uint32 {
+	read, write := d.isReadHandleOk(), d.isWriteHandleOk()
+	switch {
+	case read && write:
+		switch dt := d.impl.(type) {
+		case *lisafsDentry:
+			if dt.readFDLisa.ID() == dt.writeFDLisa.ID() {
+				return 1
+			}
+		case *directfsDentry:
+			if d.readFD.RacyLoad() == d.writeFD.RacyLoad() {
+				return 1
+			}
+		default:
+			panic("unknown dentry implementation")
+		}
+		return 2
+	case read || write:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// closeHandles closes d's read and write handles. Unlike d.closeHostFDs(), d
+// remains usable; the handles can be reopened by d.ensureSharedHandle().
+//
+// Preconditions:
+//   - d.handleMu must be locked.
+//   - !d.isSynthetic().
+func (d *dentry) closeHandles(ctx context.Context) {
+	switch dt := d.impl.(type) {
+	case *lisafsDentry:
+		dt.closeHandles(ctx)
+	case *directfsDentry:
+		// The host FDs are closed below.
+	default:
+		panic("unknown dentry implementation")
+	}
+	// We can use RacyLoad() because d.handleMu is locked.
+	if d.readFD.RacyLoad() >= 0 {
+		_ = unix.Close(int(d.readFD.RacyLoad()))
+	}
+	if d.writeFD.RacyLoad() >= 0 && d.readFD.RacyLoad() != d.writeFD.RacyLoad() {
+		_ = unix.Close(int(d.writeFD.RacyLoad()))
+	}
+	d.readFD.Store(-1)
+	d.writeFD.Store(-1)
+	d.mmapFD.Store(-1)
+}
+
 // Preconditions:
 //   - d.handleMu must be locked.
 //   - !d.isSynthetic().
@@ -185,14 +240,19 @@ func (d *dentry) updateMetadataLocked(ctx context.Context, h handle) error {
 	// Need checklocksforce below because checklocks has no way of knowing that
 	// d.impl.(*dentryImpl).dentry == d. It can't know that the right metadataMu
 	// is already locked.
+	var err error
 	switch dt := d.impl.(type) {
 	case *lisafsDentry:
-		return dt.updateMetadataLocked(ctx, h) // +checklocksforce: acquired by precondition.
+		err = dt.updateMetadataLocked(ctx, h) // +checklocksforce: acquired by precondition.
 	case *directfsDentry:
-		return dt.updateMetadataLocked(h) // +checklocksforce: acquired by precondition.
+		err = dt.updateMetadataLocked(h) // +checklocksforce: acquired by precondition.
 	default:
 		panic("unknown dentry implementation")
 	}
+	if err == nil {
+		d.markAttrsFresh()
+	}
+	return err
 }
 
 // Preconditions:
@@ -561,12 +621,21 @@ func (r *revalidateState) doRevalidation(ctx context.Context, vfsObj *vfs.Virtua
 	if r.start.isSynthetic() {
 		return nil
 	}
+	// Skip revalidation if all attributes involved are still fresh.
+	if r.fresh() {
+		return nil
+	}
+	var err error
 	switch r.start.impl.(type) {
 	case *lisafsDentry:
-		return doRevalidationLisafs(ctx, vfsObj, r, ds)
+		err = doRevalidationLisafs(ctx, vfsObj, r, ds)
 	case *directfsDentry:
-		return doRevalidationDirectfs(ctx, vfsObj, r, ds)
+		err = doRevalidationDirectfs(ctx, vfsObj, r, ds)
 	default:
 		panic("unknown dentry implementation")
 	}
+	if err == nil {
+		r.markFresh()
+	}
+	return err
 }
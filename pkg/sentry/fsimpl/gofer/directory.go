@@ -65,6 +65,7 @@ func (d *dentry) cacheNewChildLocked(child *dentry, name string) {
 		d.negativeChildren--
 	}
 	d.children[name] = child
+	d.fs.dcacheStoreLocked(d, name, child)
 }
 
 // Preconditions:
@@ -74,6 +75,9 @@ func (d *dentry) cacheNewChildLocked(child *dentry, name string) {
 //
 // +checklocks:d.childrenMu
 func (d *dentry) cacheNegativeLookupLocked(name string) {
+	if child := d.children[name]; child != nil {
+		d.fs.dcacheRemoveLocked(d, name, child)
+	}
 	// Don't cache negative lookups if InteropModeShared is in effect (since
 	// this makes remote lookup unavoidable), or if d.isSynthetic() (in which
 	// case the only files in the directory are those for which a dentry exists
@@ -0,0 +1,110 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// dcacheKey identifies a positive child dentry in filesystem.dcache.
+type dcacheKey struct {
+	parent *dentry
+	name   string
+}
+
+// dcacheStoreLocked records that child is the cached child of parent with the
+// given name, making it visible to fastWalkLocked.
+//
+// Preconditions: parent.childrenMu must be locked.
+//
+// +checklocks:parent.childrenMu
+func (fs *filesystem) dcacheStoreLocked(parent *dentry, name string, child *dentry) {
+	fs.dcache.Store(dcacheKey{parent, name}, child)
+}
+
+// dcacheRemoveLocked undoes a previous call to dcacheStoreLocked for child. It
+// is a no-op if parent's cached child with the given name is not child.
+//
+// Preconditions: parent.childrenMu must be locked.
+//
+// +checklocks:parent.childrenMu
+func (fs *filesystem) dcacheRemoveLocked(parent *dentry, name string, child *dentry) {
+	fs.dcache.CompareAndSwap(dcacheKey{parent, name}, child, nil)
+}
+
+// cachedSymlinkTarget returns the target of the symlink d if it is present in
+// fs.symlinkCache.
+func (fs *filesystem) cachedSymlinkTarget(d *dentry) (string, bool) {
+	if target := fs.symlinkCache.Load(d); target != nil {
+		return *target, true
+	}
+	return "", false
+}
+
+// fastWalkLocked resolves as many leading components of rp as it can using
+// only dentries and symlink targets that are already cached, without locking
+// any dentry, and returns the dentry at which it stopped. The caller continues
+// resolution from the returned dentry using stepLocked, which handles
+// everything that fastWalkLocked doesn't: uncached and negative children,
+// symlinks whose targets have not yet been read, and all errors other than
+// those returned by vfs.ResolvingPath.
+//
+// This is analogous to Linux's RCU path walk (see
+// Documentation/filesystems/path-lookup.rst). Holding fs.renameMu for reading
+// serves as the read-side critical section: dentries cannot be destroyed, and
+// their parents and names cannot change, while it is held, so every dentry
+// loaded from fs.dcache remains valid for the duration of the walk. Children
+// may be concurrently created or removed, but this is indistinguishable from
+// the walk completing just before or after the change, as with stepLocked.
+//
+// Preconditions:
+//   - fs.renameMu must be locked.
+//   - fs.opts.interop != InteropModeShared, so that cached dentries don't need
+//     revalidation.
+func (fs *filesystem) fastWalkLocked(ctx context.Context, rp resolvingPath, d *dentry) (*dentry, error) {
+	for !rp.done() {
+		if !d.isDir() || d.checkPermissions(rp.Credentials(), vfs.MayExec) != nil {
+			return d, nil
+		}
+		name := rp.Component()
+		if name == "." || name == ".." {
+			// ".." requires checking for mount and chroot boundaries, which
+			// stepLocked already does.
+			return d, nil
+		}
+		child := fs.dcache.Load(dcacheKey{d, name})
+		if child == nil {
+			return d, nil
+		}
+		if err := rp.CheckMount(ctx, &child.vfsd); err != nil {
+			return nil, err
+		}
+		if child.isSymlink() && rp.ShouldFollowSymlink() {
+			target, ok := fs.cachedSymlinkTarget(child)
+			if !ok {
+				return d, nil
+			}
+			child.touchAtime(rp.Mount())
+			if _, err := rp.HandleSymlink(target); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		rp.Advance()
+		d = child
+	}
+	return d, nil
+}
@@ -350,6 +350,12 @@ func (fs *filesystem) walkParentDirLocked(ctx context.Context, vfsRP *vfs.Resolv
 	if err := fs.revalidatePath(ctx, rp, d, ds); err != nil {
 		return nil, err
 	}
+	if fs.opts.interop != InteropModeShared {
+		var err error
+		if d, err = fs.fastWalkLocked(ctx, rp, d); err != nil {
+			return nil, err
+		}
+	}
 	for !rp.done() {
 		d.opMu.RLock()
 		next, followedSymlink, err := fs.stepLocked(ctx, rp, d, true /* mayFollowSymlinks */, ds)
@@ -379,6 +385,12 @@ func (fs *filesystem) resolveLocked(ctx context.Context, vfsRP *vfs.ResolvingPat
 	if err := fs.revalidatePath(ctx, rp, d, ds); err != nil {
 		return nil, err
 	}
+	if fs.opts.interop != InteropModeShared {
+		var err error
+		if d, err = fs.fastWalkLocked(ctx, rp, d); err != nil {
+			return nil, err
+		}
+	}
 	for !rp.done() {
 		d.opMu.RLock()
 		next, followedSymlink, err := fs.stepLocked(ctx, rp, d, true /* mayFollowSymlinks */, ds)
@@ -949,7 +961,7 @@ func (fs *filesystem) OpenAt(ctx context.Context, rp *vfs.ResolvingPath, opts vf
 		if mustCreate {
 			return nil, linuxerr.EEXIST
 		}
-		if !start.cachedMetadataAuthoritative() {
+		if !start.cachedMetadataAuthoritative() && (start.revalidateOnOpen() || !start.attrsFresh()) {
 			// Refresh dentry's attributes before opening.
 			if err := start.updateMetadata(ctx); err != nil {
 				return nil, err
@@ -976,7 +988,7 @@ afterTrailingSymlink:
 	if mayCreate && rp.MustBeDir() {
 		return nil, linuxerr.EISDIR
 	}
-	if err := fs.revalidateOne(ctx, rp.VirtualFilesystem(), parent, rp.Component(), &ds); err != nil {
+	if err := fs.revalidateOpen(ctx, rp.VirtualFilesystem(), parent, rp.Component(), &ds); err != nil {
 		return nil, err
 	}
 	// Determine whether or not we need to create a file.
@@ -1278,7 +1290,9 @@ func (d *dentry) createAndOpenChildLocked(ctx context.Context, rp *vfs.Resolving
 			child.writeFD = atomicbitops.FromInt32(h.fd)
 		}
 		child.updateHandles(ctx, h, readable, writable)
+		child.trackHandlesLocked()
 		child.handleMu.Unlock()
+		d.fs.hostFDCache.maybeEvict(ctx, child)
 	}
 	// Insert the dentry into the tree.
 	d.childrenMu.Lock()
@@ -1499,6 +1513,7 @@ func (fs *filesystem) RenameAt(ctx context.Context, rp *vfs.ResolvingPath, oldPa
 		ds = appendDentry(ds, replaced)
 		// Remove the replaced entry from its parent's cache.
 		delete(newParent.children, newName)
+		fs.dcacheRemoveLocked(newParent, newName, replaced)
 	}
 	oldParent.cacheNegativeLookupLocked(oldName) // +checklocksforce: oldParent.childrenMu is held if oldParent != newParent.
 	if renamed.isSynthetic() {
@@ -1622,6 +1637,7 @@ func (fs *filesystem) SymlinkAt(ctx context.Context, rp *vfs.ResolvingPath, targ
 			// updates the atime on the host.
 			child.haveTarget = true
 			child.target = target
+			fs.symlinkCache.Store(child, &target)
 		}
 		return child, nil
 	}, nil)
@@ -19,6 +19,7 @@
 //
 //	regularFileFD/directoryFD.mu
 //	  filesystem.renameMu
+//	    lisafsDentry.packedFilesMu
 //	    dentry.cachingMu
 //	      dentryCache.mu
 //	      dentry.opMu
@@ -30,6 +31,7 @@
 //	            *** "memmap.Mappable locks taken by Translate" below this point
 //	            dentry.handleMu
 //	              dentry.dataMu
+//	              hostFDCache.mu
 //	          filesystem.inoMu
 //	specialFileFD.mu
 //	  specialFileFD.bufMu
@@ -86,6 +88,15 @@ const (
 	moptOverlayfsStaleRead       = "overlayfs_stale_read"
 	moptDisableFileHandleSharing = "disable_file_handle_sharing"
 	moptDisableFifoOpen          = "disable_fifo_open"
+	moptVerity                   = "verity"
+	moptChannels                 = "channels"
+	moptDirtyRatio               = "dirty_ratio"
+	moptDirtyBackgroundRatio     = "dirty_background_ratio"
+	moptDirtyBytes               = "dirty_bytes"
+	moptDirtyBackgroundBytes     = "dirty_background_bytes"
+	moptConsistency              = "consistency"
+	moptAttrTTL                  = "attr_ttl"
+	moptHostFDLimit              = "host_fd_limit"
 
 	// Directfs options.
 	moptDirectfs = "directfs"
@@ -99,7 +110,17 @@ const (
 )
 
 // SupportedMountOptions is the set of mount options that can be set externally.
-var SupportedMountOptions = []string{moptOverlayfsStaleRead, moptDisableFileHandleSharing}
+var SupportedMountOptions = []string{
+	moptOverlayfsStaleRead,
+	moptDisableFileHandleSharing,
+	moptDirtyRatio,
+	moptDirtyBackgroundRatio,
+	moptDirtyBytes,
+	moptDirtyBackgroundBytes,
+	moptConsistency,
+	moptAttrTTL,
+	moptHostFDLimit,
+}
 
 const (
 	defaultMaxCachedDentries  = 1000
@@ -216,8 +237,26 @@ type filesystem struct {
 	//		it is reachable from its parent).
 	renameMu sync.RWMutex `state:"nosave"`
 
+	// dcache maps (parent, name) pairs to the corresponding positive child
+	// dentries, mirroring all non-nil entries in dentry.children. Unlike
+	// dentry.children, it can be read without locking any dentry, which
+	// allows fastWalkLocked to resolve cached paths locklessly. It is only
+	// mutated with the relevant parent's childrenMu locked, and is rebuilt
+	// lazily after restore.
+	dcache dcacheAtomicPtrMap `state:"nosave"`
+
+	// symlinkCache maps symlink dentries to their cached targets. It holds
+	// the same targets as dentry.target, but can be read without locking
+	// dentry.dataMu. symlinkCache is only populated when InteropModeShared is
+	// not in effect, and is rebuilt lazily after restore.
+	symlinkCache symlinkTargetAtomicPtrMap `state:"nosave"`
+
 	dentryCache *dentryCache
 
+	// hostFDCache limits the number of handles held open for regular files.
+	// It may be shared with other filesystems. hostFDCache is immutable.
+	hostFDCache *hostFDCache `state:"nosave"`
+
 	// syncableDentries contains all non-synthetic dentries. specialFileFDs
 	// contains all open specialFileFDs. These fields are protected by syncMu.
 	syncMu           sync.Mutex `state:"nosave"`
@@ -241,6 +280,20 @@ type filesystem struct {
 
 	// released is nonzero once filesystem.Release has been called.
 	released atomicbitops.Int32
+
+	// dirtyBytes is the total number of bytes of dirty cached data in all
+	// dentries, i.e. the sum of dentry.dirtyBytes.
+	dirtyBytes atomicbitops.Uint64
+
+	// If background writeback is in progress, writebackDone is closed when it
+	// stops; otherwise, writebackDone is nil. writebackDone is protected by
+	// writebackMu.
+	writebackMu   sync.Mutex    `state:"nosave"`
+	writebackDone chan struct{} `state:"nosave"`
+
+	// packedFilesBytes is the total number of bytes of packed file data held
+	// by all dentries, i.e. the sum of lisafsDentry.packedFilesBytes.
+	packedFilesBytes atomicbitops.Uint64 `state:"nosave"`
 }
 
 // +stateify savable
@@ -285,8 +338,29 @@ type filesystemOptions struct {
 	// are disallowed.
 	disableFifoOpen bool
 
+	// If verity is true, reads of regular files with fs-verity enabled on the
+	// host are verified against the file's Merkle tree, and fail with EIO if
+	// the data does not match. This requires a host FD for the file.
+	verity bool
+
+	// channels is the number of channels used to make RPCs to the gofer. If
+	// zero, a default based on GOMAXPROCS is used. RPCs beyond the number of
+	// channels are serialized. The gofer may create fewer channels.
+	channels int
+
 	// directfs holds options for directfs mode.
 	directfs directfsOpts
+
+	// dirty holds limits on the amount of dirty cached file data.
+	dirty dirtyOpts
+
+	// consistency controls revalidation of cached dentries if
+	// InteropModeShared is in effect.
+	consistency consistencyOpts
+
+	// If hostFDLimit is non-negative, it is the size of a hostFDCache used
+	// only by this filesystem. Otherwise, the global hostFDCache is used.
+	hostFDLimit int64
 }
 
 // +stateify savable
@@ -464,6 +538,35 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		fsopts.dfltgid = auth.KGID(dfltgid)
 	}
 
+	// Parse the number of channels to the gofer.
+	if channelsstr, ok := mopts[moptChannels]; ok {
+		delete(mopts, moptChannels)
+		channels, err := strconv.ParseUint(channelsstr, 10, 8)
+		if err != nil {
+			ctx.Warningf("gofer.FilesystemType.GetFilesystem: invalid number of channels: %s=%s", moptChannels, channelsstr)
+			return nil, nil, linuxerr.EINVAL
+		}
+		fsopts.channels = int(channels)
+	}
+
+	// Parse dirty data limits.
+	fsopts.dirty, err = parseDirtyOpts(ctx, mopts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Parse consistency mode and attribute TTL.
+	fsopts.consistency, err = parseConsistencyOpts(ctx, mopts, fsopts.interop)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Parse the host FD limit.
+	fsopts.hostFDLimit, err = parseHostFDLimit(ctx, mopts)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// Handle simple flags.
 	if _, ok := mopts[moptDisableFileHandleSharing]; ok {
 		delete(mopts, moptDisableFileHandleSharing)
@@ -489,6 +592,10 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		delete(mopts, moptDirectfs)
 		fsopts.directfs.enabled = true
 	}
+	if _, ok := mopts[moptVerity]; ok {
+		delete(mopts, moptVerity)
+		fsopts.verity = true
+	}
 	// fsopts.regularFilesUseSpecialFileFD can only be enabled by specifying
 	// "cache=none".
 
@@ -536,6 +643,7 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 	} else {
 		fs.dentryCache = &dentryCache{maxCachedDentries: defaultMaxCachedDentries}
 	}
+	fs.initHostFDCache()
 
 	fs.vfsfs.Init(vfsObj, &fstype, fs)
 
@@ -605,7 +713,7 @@ func (fs *filesystem) initClientAndGetRoot(ctx context.Context) (lisafs.Inode, i
 			rootHostFD = -1
 		}
 		// Use flipcall channels with lisafs because it makes a lot of RPCs.
-		if err := fs.client.StartChannels(); err != nil {
+		if err := fs.client.StartChannels(fs.opts.channels); err != nil {
 			return lisafs.Inode{}, -1, err
 		}
 		rootInode, err = fs.handleAnameLisafs(ctx, rootInode)
@@ -659,6 +767,7 @@ func getFDFromMountOptionsMap(ctx context.Context, mopts map[string]string) (int
 // Release implements vfs.FilesystemImpl.Release.
 func (fs *filesystem) Release(ctx context.Context) {
 	fs.released.Store(1)
+	fs.waitBackgroundWriteback()
 
 	mf := fs.mfp.MemoryFile()
 	fs.syncMu.Lock()
@@ -677,8 +786,10 @@ func (fs *filesystem) Release(ctx context.Context) {
 		// Discard cached pages.
 		d.cache.DropAll(mf)
 		d.dirty.RemoveAll()
+		d.updateDirtyBytesLocked()
 		d.dataMu.Unlock()
 		// Close host FDs if they exist.
+		fs.hostFDCache.remove(d)
 		d.closeHostFDs()
 		d.handleMu.Unlock()
 	}
@@ -713,6 +824,29 @@ func (fs *filesystem) Release(ctx context.Context) {
 	fs.vfsfs.VirtualFilesystem().PutAnonBlockDevMinor(fs.devMinor)
 }
 
+// CheckHealth implements vfs.FilesystemImplHealthExtension.CheckHealth. It
+// makes a StatFS RPC on the root, which requires the gofer to be responsive
+// even if directfs is enabled.
+func (fs *filesystem) CheckHealth(ctx context.Context) error {
+	if fs.released.Load() != 0 || fs.client == nil || fs.root == nil {
+		return nil
+	}
+	var controlFD lisafs.ClientFD
+	switch dt := fs.root.impl.(type) {
+	case *lisafsDentry:
+		controlFD = dt.controlFD
+	case *directfsDentry:
+		controlFD = dt.controlFDLisa
+	default:
+		panic("unknown dentry implementation")
+	}
+	var statFS lisafs.StatFS
+	if err := controlFD.StatFSTo(ctx, &statFS); err != nil {
+		return fmt.Errorf("gofer mount %q: %w", fs.iopts.UniqueID, err)
+	}
+	return nil
+}
+
 // releaseSyntheticRecursiveLocked traverses the tree with root d and decrements
 // the reference count on every synthetic dentry. Synthetic dentries have one
 // reference for existence that should be dropped during filesystem.Release.
@@ -900,6 +1034,13 @@ type dentry struct {
 	// other metadata fields.
 	nlink atomicbitops.Uint32
 
+	// attrsRefreshed is the time, in nanoseconds per filesystem.clock, at
+	// which the dentry's attributes were last fetched from the remote
+	// filesystem. It is only maintained if filesystemOptions.consistency
+	// allows attribute caching; zero means the attributes must be
+	// revalidated.
+	attrsRefreshed atomicbitops.Int64 `state:"nosave"`
+
 	mapsMu sync.Mutex `state:"nosave"`
 
 	// If this dentry represents a regular file, mappings tracks mappings of
@@ -923,7 +1064,9 @@ type dentry struct {
 	//
 	// readFD and writeFD may or may not be the same file descriptor. Once either
 	// transitions from closed (-1) to open, it may be mutated with handleMu
-	// locked, but cannot be closed until the dentry is destroyed.
+	// locked, but cannot be closed until the dentry is destroyed, unless
+	// filesystem.hostFDCache evicts it while no regularFileFD has it pinned
+	// (see dentry.pinHandles()).
 	//
 	// readFD and writeFD may or may not be the same file descriptor. mmapFD is
 	// always either -1 or equal to readFD; if the file has been opened for
@@ -933,6 +1076,36 @@ type dentry struct {
 	writeFD  atomicbitops.Int32 `state:"nosave"`
 	mmapFD   atomicbitops.Int32 `state:"nosave"`
 
+	// If this dentry represents a regular file, evictedHandles is a bitmask
+	// of evictedRead and evictedWrite indicating which of its handles were
+	// closed by filesystem.hostFDCache and must be reopened before use.
+	// evictedHandles is protected by handleMu, but may be read atomically.
+	evictedHandles atomicbitops.Uint32
+
+	// hostFDPins is the number of ongoing operations that prevent this
+	// dentry's handles from being evicted. hostFDPins is accessed using
+	// atomic memory operations.
+	hostFDPins atomicbitops.Int32 `state:"nosave"`
+
+	// hostFDReferenced is set when this dentry's handles are used, and
+	// cleared when filesystem.hostFDCache considers them for eviction.
+	// hostFDReferenced is accessed using atomic memory operations.
+	hostFDReferenced atomicbitops.Uint32 `state:"nosave"`
+
+	// hostFDEntry links dentry into filesystem.hostFDCache.dentries. hostFDs
+	// is the number of handles accounted to this dentry by
+	// filesystem.hostFDCache. Both are protected by filesystem.hostFDCache.mu.
+	hostFDEntry dentryListElem `state:"nosave"`
+	hostFDs     uint32         `state:"nosave"`
+
+	// If this dentry represents a regular file with fs-verity enabled and
+	// filesystem.opts.verity is true, verity holds its Merkle tree, which is
+	// used to verify all reads from readFD. verity is set when readFD is
+	// opened, or when fs-verity is enabled on the file, with handleMu locked;
+	// mmapFD is -1 while verity is set, so that memory mappings are also
+	// verified.
+	verity atomic.Pointer[verityTree] `state:"nosave"`
+
 	dataMu sync.RWMutex `state:"nosave"`
 
 	// If this dentry represents a regular file that is client-cached, cache
@@ -945,6 +1118,15 @@ type dentry struct {
 	// tracks dirty segments in cache. dirty is protected by dataMu.
 	dirty fsutil.DirtySet
 
+	// dirtyBytes is the number of bytes in dirty, accounted in
+	// filesystem.dirtyBytes. dirtyBytes is protected by dataMu, but may be
+	// read without locking it.
+	dirtyBytes atomicbitops.Uint64
+
+	// writableTranslations is incremented whenever Translate returns writable
+	// translations. It is protected by dataMu.
+	writableTranslations uint64
+
 	// pf implements memmap.File for mappings of hostFD.
 	pf dentryPlatformFile
 
@@ -964,6 +1146,11 @@ type dentry struct {
 
 	locks vfs.FileLocks
 
+	// writeHint is the write life time hint set with fcntl(F_SET_RW_HINT), one
+	// of linux.RWH_WRITE_LIFE_*. It is forwarded to the remote file when set,
+	// and only cached here for F_GET_RW_HINT.
+	writeHint atomicbitops.Uint64
+
 	// Inotify watches for this dentry.
 	//
 	// Note that inotify may behave unexpectedly in the presence of hard links,
@@ -1018,6 +1205,7 @@ func (d *dentry) init(impl any) {
 	d.pf.dentry = d
 	d.cacheEntry.d = d
 	d.syncableListEntry.d = d
+	d.hostFDEntry.d = d
 	// Nested impl-inheritance pattern. In memory it looks like:
 	// [[[ vfs.Dentry ] dentry ] dentryImpl ]
 	// All 3 abstractions are allocated in one allocation. We achieve this by
@@ -1027,6 +1215,9 @@ func (d *dentry) init(impl any) {
 	d.impl = impl
 	d.vfsd.Init(d)
 	refs.Register(d)
+	// Dentries are created from attributes just fetched from the remote
+	// filesystem.
+	d.markAttrsFresh()
 }
 
 func (d *dentry) isSynthetic() bool {
@@ -1171,6 +1362,10 @@ func (d *dentry) statTo(stat *linux.Statx) {
 	stat.Mtime = linux.NsecToStatxTimestamp(d.mtime.Load())
 	stat.DevMajor = linux.UNNAMED_MAJOR
 	stat.DevMinor = d.fs.devMinor
+	if d.verity.Load() != nil {
+		stat.AttributesMask |= linux.STATX_ATTR_VERITY
+		stat.Attributes |= linux.STATX_ATTR_VERITY
+	}
 }
 
 // Precondition: fs.renameMu is locked.
@@ -1385,6 +1580,7 @@ func (d *dentry) updateSizeAndUnlockDataMuLocked(newSize uint64) {
 		d.dataMu.Lock()
 		d.cache.Truncate(newSize, d.fs.mfp.MemoryFile())
 		d.dirty.KeepClean(memmap.MappableRange{newSize, oldpgend})
+		d.updateDirtyBytesLocked()
 		d.dataMu.Unlock()
 	}
 }
@@ -1621,6 +1817,7 @@ func (d *dentry) checkCachingLocked(ctx context.Context, renameMuWriteLocked boo
 		if parent := d.parent.Load(); parent != nil {
 			parent.childrenMu.Lock()
 			delete(parent.children, d.name)
+			d.fs.dcacheRemoveLocked(parent, d.name, d)
 			parent.childrenMu.Unlock()
 		}
 		d.destroyLocked(ctx) // +checklocksforce: see above.
@@ -1737,6 +1934,7 @@ func (d *dentry) evictLocked(ctx context.Context) {
 
 			parent.childrenMu.Lock()
 			delete(parent.children, d.name)
+			d.fs.dcacheRemoveLocked(parent, d.name, d)
 			parent.childrenMu.Unlock()
 
 			// We're only deleting the dentry, not the file it
@@ -1773,10 +1971,12 @@ func (d *dentry) destroyDisconnected(ctx context.Context) {
 		mf.MarkAllUnevictable(d)
 		d.cache.DropAll(mf)
 		d.dirty.RemoveAll()
+		d.updateDirtyBytesLocked()
 	}
 	d.dataMu.Unlock()
 
 	// Close any resources held by the implementation.
+	d.fs.hostFDCache.remove(d)
 	d.destroyImpl(ctx)
 
 	// Can use RacyLoad() because handleMu is locked.
@@ -1807,6 +2007,10 @@ func (d *dentry) destroyDisconnected(ctx context.Context) {
 		d.fs.syncMu.Unlock()
 	}
 
+	if d.isSymlink() {
+		d.fs.symlinkCache.Store(d, nil)
+	}
+
 	// Drop references and stop tracking this child.
 	d.refs.Store(-1)
 	refs.Unregister(d)
@@ -1900,6 +2104,23 @@ func (d *dentry) removeXattr(ctx context.Context, creds *auth.Credentials, name
 //   - d.isRegularFile() || d.isDir().
 //   - fs.renameMu is locked.
 func (d *dentry) ensureSharedHandle(ctx context.Context, read, write, trunc bool) error {
+	err := d.ensureSharedHandleOnce(ctx, read, write, trunc)
+	if linuxerr.Equals(linuxerr.EMFILE, err) || linuxerr.Equals(linuxerr.ENFILE, err) {
+		// The sentry or the gofer is out of host FDs. Close handles held for
+		// other files and try again.
+		if d.fs.hostFDCache.shrinkUnderPressure(ctx, d) != 0 {
+			err = d.ensureSharedHandleOnce(ctx, read, write, trunc)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	d.fs.hostFDCache.maybeEvict(ctx, d)
+	return nil
+}
+
+// Preconditions: Same as ensureSharedHandle.
+func (d *dentry) ensureSharedHandleOnce(ctx context.Context, read, write, trunc bool) error {
 	// O_TRUNC unconditionally requires us to obtain a new handle (opened with
 	// O_TRUNC).
 	if !trunc {
@@ -1998,14 +2219,22 @@ func (d *dentry) ensureSharedHandle(ctx context.Context, read, write, trunc bool
 			d.writeFD.Store(h.fd)
 			d.mmapFD.Store(h.fd)
 		} else if openReadable && d.readFD.RacyLoad() < 0 {
+			if d.fs.opts.verity {
+				if err := d.loadVerityLocked(ctx, h.fd); err != nil {
+					d.handleMu.Unlock()
+					h.close(ctx)
+					return err
+				}
+			}
 			readHandleWasOk := d.isReadHandleOk()
 			d.readFD.Store(h.fd)
 			// If the file has not been opened for writing, the new FD may
 			// be used for read-only memory mappings. If the file was
 			// previously opened for reading (without an FD), then existing
 			// translations of the file may use the internal page cache;
-			// invalidate those mappings.
-			if !d.isWriteHandleOk() {
+			// invalidate those mappings. If reads of the file are verified,
+			// memory mappings must use the page cache.
+			if !d.isWriteHandleOk() && d.verity.Load() == nil {
 				invalidateTranslations = readHandleWasOk
 				d.mmapFD.Store(h.fd)
 			}
@@ -2035,6 +2264,7 @@ func (d *dentry) ensureSharedHandle(ctx context.Context, read, write, trunc bool
 	}
 
 	d.updateHandles(ctx, h, openReadable, openWritable)
+	d.trackHandlesLocked()
 	d.handleMu.Unlock()
 
 	if invalidateTranslations {
@@ -2079,6 +2309,7 @@ func (d *dentry) syncCachedFile(ctx context.Context, forFilesystemSync bool) err
 		d.dataMu.Lock()
 		h := d.writeHandle()
 		err := fsutil.SyncDirtyAll(ctx, &d.cache, &d.dirty, d.size.Load(), d.fs.mfp.MemoryFile(), h.writeFromBlocksAt)
+		d.updateDirtyBytesLocked()
 		d.dataMu.Unlock()
 		if err != nil {
 			return err
@@ -2140,7 +2371,7 @@ func (fd *fileDescription) dentry() *dentry {
 func (fd *fileDescription) Stat(ctx context.Context, opts vfs.StatOptions) (linux.Statx, error) {
 	d := fd.dentry()
 	const validMask = uint32(linux.STATX_MODE | linux.STATX_UID | linux.STATX_GID | linux.STATX_ATIME | linux.STATX_MTIME | linux.STATX_CTIME | linux.STATX_SIZE | linux.STATX_BLOCKS | linux.STATX_BTIME)
-	if !d.cachedMetadataAuthoritative() && opts.Mask&validMask != 0 && opts.Sync != linux.AT_STATX_DONT_SYNC {
+	if !d.cachedMetadataAuthoritative() && opts.Mask&validMask != 0 && opts.Sync != linux.AT_STATX_DONT_SYNC && (opts.Sync == linux.AT_STATX_FORCE_SYNC || !d.attrsFresh()) {
 		// Use specialFileFD.handle.fileLisa for the Stat if available, for the
 		// same reason that we try to use open FD in updateMetadataLocked().
 		var err error
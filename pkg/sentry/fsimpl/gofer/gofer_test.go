@@ -32,6 +32,7 @@ func TestDestroyIdempotent(t *testing.T) {
 		clock:    time.RealtimeClockFromContext(ctx),
 		// Test relies on no dentry being held in the cache.
 		dentryCache: &dentryCache{maxCachedDentries: 0},
+		hostFDCache: &hostFDCache{},
 		client:      &lisafs.Client{},
 	}
 
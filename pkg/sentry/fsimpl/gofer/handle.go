@@ -17,6 +17,7 @@ package gofer
 import (
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/fsutil"
 	"gvisor.dev/gvisor/pkg/lisafs"
 	"gvisor.dev/gvisor/pkg/safemem"
 	"gvisor.dev/gvisor/pkg/sentry/hostfd"
@@ -102,6 +103,30 @@ func (h *handle) sync(ctx context.Context) error {
 	return nil
 }
 
+func (h *handle) syncRange(ctx context.Context, offset, nbytes uint64, flags uint32) error {
+	// As in sync, prefer the host FD over an RPC.
+	if h.fd >= 0 {
+		ctx.UninterruptibleSleepStart(false)
+		err := unix.SyncFileRange(int(h.fd), int64(offset), int64(nbytes), int(flags))
+		ctx.UninterruptibleSleepFinish(false)
+		return err
+	}
+	if h.fdLisa.Ok() {
+		return h.fdLisa.SyncRange(ctx, offset, nbytes, flags)
+	}
+	return nil
+}
+
+func (h *handle) setWriteHint(ctx context.Context, hint uint64) error {
+	if h.fd >= 0 {
+		return fsutil.SetWriteHint(int(h.fd), hint)
+	}
+	if h.fdLisa.Ok() {
+		return h.fdLisa.SetWriteHint(ctx, hint)
+	}
+	return nil
+}
+
 type handleReadWriter struct {
 	ctx context.Context
 	h   *handle
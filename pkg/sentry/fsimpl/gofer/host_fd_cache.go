@@ -0,0 +1,353 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"strconv"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/metric"
+	"gvisor.dev/gvisor/pkg/sentry/fsmetric"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// Bits in dentry.evictedHandles.
+const (
+	evictedRead = 1 << iota
+	evictedWrite
+)
+
+// hostFDCache limits the number of handles held open for regular files.
+// Each handle holds a host FD in the sentry, the gofer, or both, so keeping
+// handles open for every file that the application has open can exhaust
+// host FD limits. When the number of handles exceeds the cache's ceiling,
+// the handles of the least recently used files are closed ("evicted"), and
+// reopened the next time they are used.
+//
+// Dentries are kept in approximate LRU order: dentries are moved to the
+// front when their handles are opened, and dentries that were used since
+// they were last considered for eviction get a second chance, as in the
+// CLOCK algorithm. This avoids locking hostFDCache.mu on every I/O.
+//
+// Handles can only be evicted if closing them can't lose state: the file
+// must not be memory-mapped, must not have pages in the page cache, and must
+// not have been deleted.
+type hostFDCache struct {
+	// mu protects the below fields.
+	mu sync.Mutex
+
+	// dentries contains all regular file dentries with open handles, most
+	// recently opened first.
+	dentries dentryList
+
+	// dentriesLen is the number of dentries in dentries.
+	dentriesLen uint64
+
+	// fds is the number of handles held by dentries, i.e. the sum of
+	// dentry.hostFDs.
+	fds uint64
+
+	// maxFDs is the number of handles above which handles are evicted. If
+	// maxFDs is 0, handles are only evicted if opening a handle fails due to
+	// FD exhaustion.
+	maxFDs uint64
+}
+
+// hostFDs is the total number of handles tracked by all hostFDCaches.
+var hostFDs atomicbitops.Int64
+
+func init() {
+	metric.MustRegisterCustomUint64Metric("/gofer/host_fds", false /* cumulative */, false /* sync */, "Number of file handles held open for regular files by gofer filesystems.", func(...*metric.FieldValue) uint64 {
+		return uint64(hostFDs.Load())
+	})
+}
+
+// SetHostFDCacheSize sets the maximum number of handles held open for regular
+// files by gofer mounts that don't set the "host_fd_limit" mount option. If
+// size is 0, handles are only closed when the sandbox runs out of host FDs.
+// If size is negative, the default of half of the sandbox's RLIMIT_NOFILE is
+// used.
+func SetHostFDCacheSize(size int) {
+	if size < 0 {
+		return
+	}
+	globalHostFDCacheMu.Lock()
+	defer globalHostFDCacheMu.Unlock()
+	if globalHostFDCache != nil {
+		log.Warningf("Global host FD cache has already been initialized. Ignoring subsequent attempt.")
+		return
+	}
+	globalHostFDCache = &hostFDCache{maxFDs: uint64(size)}
+}
+
+var (
+	// globalHostFDCache is shared by all gofer mounts that don't set the
+	// "host_fd_limit" mount option. It is protected by globalHostFDCacheMu.
+	globalHostFDCacheMu sync.Mutex
+	globalHostFDCache   *hostFDCache
+)
+
+// getGlobalHostFDCache returns globalHostFDCache, initializing it with the
+// default size if SetHostFDCacheSize wasn't called.
+func getGlobalHostFDCache() *hostFDCache {
+	globalHostFDCacheMu.Lock()
+	defer globalHostFDCacheMu.Unlock()
+	if globalHostFDCache == nil {
+		globalHostFDCache = &hostFDCache{maxFDs: defaultMaxHostFDs}
+	}
+	return globalHostFDCache
+}
+
+// defaultMaxHostFDs is the default size of the global host FD cache. It is
+// computed at startup, since syscall filters may not allow getrlimit(2) by
+// the time filesystems are mounted.
+var defaultMaxHostFDs = getDefaultMaxHostFDs()
+
+// getDefaultMaxHostFDs returns a host FD cache size that leaves half of the
+// sandbox's FDs for other uses.
+func getDefaultMaxHostFDs() uint64 {
+	var rlim unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &rlim); err != nil || rlim.Cur == unix.RLIM_INFINITY {
+		return 0
+	}
+	return rlim.Cur / 2
+}
+
+// parseHostFDLimit parses and removes the "host_fd_limit" option in mopts.
+// It returns a negative value if the option is not set.
+func parseHostFDLimit(ctx context.Context, mopts map[string]string) (int64, error) {
+	str, ok := mopts[moptHostFDLimit]
+	if !ok {
+		return -1, nil
+	}
+	delete(mopts, moptHostFDLimit)
+	limit, err := strconv.ParseUint(str, 10, 32)
+	if err != nil {
+		ctx.Warningf("gofer.FilesystemType.GetFilesystem: invalid host FD limit: %s=%s", moptHostFDLimit, str)
+		return 0, linuxerr.EINVAL
+	}
+	return int64(limit), nil
+}
+
+// initHostFDCache sets fs.hostFDCache according to fs.opts.hostFDLimit.
+func (fs *filesystem) initHostFDCache() {
+	if fs.opts.hostFDLimit >= 0 {
+		fs.hostFDCache = &hostFDCache{maxFDs: uint64(fs.opts.hostFDLimit)}
+	} else {
+		fs.hostFDCache = getGlobalHostFDCache()
+	}
+}
+
+// trackHandlesLocked is called after d's handles are opened.
+//
+// Preconditions: d.handleMu must be locked.
+func (d *dentry) trackHandlesLocked() {
+	evicted := d.evictedHandles.RacyLoad()
+	if d.isReadHandleOk() {
+		evicted &^= evictedRead
+	}
+	if d.isWriteHandleOk() {
+		evicted &^= evictedWrite
+	}
+	d.evictedHandles.Store(evicted)
+	d.fs.hostFDCache.update(d)
+}
+
+// update records the number of handles held by d, and moves d to the front of
+// c.dentries if it holds any.
+//
+// Preconditions: d.handleMu must be locked.
+func (c *hostFDCache) update(d *dentry) {
+	if !d.isRegularFile() {
+		return
+	}
+	fds := d.openHandlesCount()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d.hostFDs != 0 {
+		c.dentries.Remove(&d.hostFDEntry)
+		c.dentriesLen--
+	}
+	if fds != 0 {
+		c.dentries.PushFront(&d.hostFDEntry)
+		c.dentriesLen++
+	}
+	c.fds += uint64(fds) - uint64(d.hostFDs)
+	hostFDs.Add(int64(fds) - int64(d.hostFDs))
+	d.hostFDs = fds
+}
+
+// remove stops tracking the handles of d. It must be called, with
+// d.handleMu locked, before d's handles are closed for any reason other than
+// eviction.
+func (c *hostFDCache) remove(d *dentry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d.hostFDs == 0 {
+		return
+	}
+	c.dentries.Remove(&d.hostFDEntry)
+	c.dentriesLen--
+	c.fds -= uint64(d.hostFDs)
+	hostFDs.Add(-int64(d.hostFDs))
+	d.hostFDs = 0
+}
+
+// contains returns true if c is tracking the handles of d.
+func (c *hostFDCache) contains(d *dentry) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return d.hostFDs != 0
+}
+
+// maybeEvict evicts handles until c's ceiling is met. except is the dentry
+// whose handles were just opened, which is never evicted.
+//
+// Preconditions: Same as shrink.
+func (c *hostFDCache) maybeEvict(ctx context.Context, except *dentry) {
+	c.mu.Lock()
+	over := c.maxFDs != 0 && c.fds > c.maxFDs
+	c.mu.Unlock()
+	if over {
+		c.shrink(ctx, c.maxFDs, except)
+	}
+}
+
+// shrinkUnderPressure evicts half of the handles in c after opening a handle
+// failed with EMFILE or ENFILE. It returns the number of handles closed.
+func (c *hostFDCache) shrinkUnderPressure(ctx context.Context, except *dentry) uint64 {
+	c.mu.Lock()
+	target := c.fds / 2
+	c.mu.Unlock()
+	closed := c.shrink(ctx, target, except)
+	ctx.Debugf("gofer.hostFDCache.shrinkUnderPressure: closed %d handles", closed)
+	return closed
+}
+
+// shrink evicts the handles of the least recently used dentries in c, other
+// than except, until at most target handles remain or every dentry has been
+// considered. It returns the number of handles closed.
+//
+// Preconditions: No dentry.mapsMu, or locks that follow it in the lock
+// order, may be held.
+func (c *hostFDCache) shrink(ctx context.Context, target uint64, except *dentry) uint64 {
+	var closed uint64
+	c.mu.Lock()
+	// Consider each dentry at most twice: once to clear its referenced bit,
+	// and once more to evict it.
+	for budget := 2 * c.dentriesLen; c.fds > target && budget > 0; budget-- {
+		victim := c.dentries.Back().d
+		// Rotate victim to the front, so that dentries whose handles can't be
+		// evicted now are only considered again after all other dentries.
+		c.dentries.Remove(&victim.hostFDEntry)
+		c.dentries.PushFront(&victim.hostFDEntry)
+		if victim == except || victim.hostFDReferenced.Swap(0) != 0 {
+			continue
+		}
+		// victim's locks precede c.mu in the lock order.
+		c.mu.Unlock()
+		closed += victim.evictHandles(ctx)
+		c.mu.Lock()
+	}
+	c.mu.Unlock()
+	return closed
+}
+
+// evictHandles closes d's handles if that is safe, and returns the number of
+// handles closed. The handles are reopened by d.pinHandles(). Note that data
+// written through evicted handles is synced by fsync(2) of the file, which
+// reopens them, but not by sync(2) or syncfs(2).
+func (d *dentry) evictHandles(ctx context.Context) uint64 {
+	if d.hostFDPins.Load() != 0 {
+		return 0
+	}
+	d.mapsMu.Lock()
+	defer d.mapsMu.Unlock()
+	d.handleMu.Lock()
+	defer d.handleMu.Unlock()
+	// Check that d wasn't removed from the cache, e.g. because it was
+	// destroyed, after it was chosen for eviction.
+	c := d.fs.hostFDCache
+	if !c.contains(d) {
+		return 0
+	}
+	// Since pins are taken before locking d.handleMu for reading, checking
+	// for them with d.handleMu locked for writing ensures that either the
+	// pinning caller observes that the handles were evicted, or we observe
+	// the pin.
+	if d.hostFDPins.Load() != 0 || !d.mappings.IsEmpty() || d.verity.Load() != nil || d.isDeleted() {
+		return 0
+	}
+	d.dataMu.Lock()
+	cached := !d.cache.IsEmpty() || !d.dirty.IsEmpty() || !d.pf.fdRefs.IsEmpty()
+	d.dataMu.Unlock()
+	if cached {
+		return 0
+	}
+
+	var evicted uint32
+	if d.isReadHandleOk() {
+		evicted |= evictedRead
+	}
+	if d.isWriteHandleOk() {
+		evicted |= evictedWrite
+	}
+	n := uint64(d.openHandlesCount())
+	c.remove(d)
+	d.closeHandles(ctx)
+	d.evictedHandles.Store(d.evictedHandles.RacyLoad() | evicted)
+	fsmetric.GoferHostFDEvictions.IncrementBy(n)
+	return n
+}
+
+// pinHandles prevents d's handles from being evicted until a matching call to
+// d.unpinHandles(), and reopens them if they were evicted. Callers must pin
+// handles before using them on behalf of a regularFileFD.
+//
+// Preconditions:
+//   - d.isRegularFile().
+//   - fs.renameMu must not be locked.
+func (d *dentry) pinHandles(ctx context.Context) error {
+	d.hostFDPins.Add(1)
+	d.hostFDReferenced.Store(1)
+	d.handleMu.RLock()
+	evicted := d.evictedHandles.Load()
+	d.handleMu.RUnlock()
+	if evicted == 0 {
+		return nil
+	}
+
+	// The handles may fail to reopen, e.g. if the file's permissions changed
+	// since it was opened. This is reported as a failure of the operation
+	// that needed them.
+	d.fs.renameMu.RLock()
+	err := d.ensureSharedHandle(ctx, evicted&evictedRead != 0, evicted&evictedWrite != 0, false /* trunc */)
+	d.fs.renameMu.RUnlock()
+	if err != nil {
+		d.hostFDPins.Add(-1)
+		return err
+	}
+	fsmetric.GoferHostFDReopens.Increment()
+	return nil
+}
+
+// unpinHandles reverses a successful call to d.pinHandles().
+func (d *dentry) unpinHandles() {
+	d.hostFDPins.Add(-1)
+}
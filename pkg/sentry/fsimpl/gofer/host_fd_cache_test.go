@@ -0,0 +1,214 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/sentry/contexttest"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
+)
+
+func TestParseHostFDLimit(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		mopts   map[string]string
+		want    int64
+		wantErr bool
+	}{
+		{
+			name:  "none",
+			mopts: map[string]string{},
+			want:  -1,
+		},
+		{
+			name:  "limit",
+			mopts: map[string]string{moptHostFDLimit: "128"},
+			want:  128,
+		},
+		{
+			name:  "unlimited",
+			mopts: map[string]string{moptHostFDLimit: "0"},
+			want:  0,
+		},
+		{
+			name:    "invalid",
+			mopts:   map[string]string{moptHostFDLimit: "-1"},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := contexttest.Context(t)
+			got, err := parseHostFDLimit(ctx, tc.mopts)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("parseHostFDLimit(%v) = %d, want error", tc.mopts, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseHostFDLimit(%v) failed: %v", tc.mopts, err)
+			}
+			if got != tc.want {
+				t.Errorf("parseHostFDLimit(%v) = %d, want %d", tc.mopts, got, tc.want)
+			}
+			if len(tc.mopts) != 0 {
+				t.Errorf("parseHostFDLimit left options %v", tc.mopts)
+			}
+		})
+	}
+}
+
+// newHostFDCacheTestFS returns a directfs filesystem rooted at a temporary
+// directory containing n regular files, and a dentry for each file.
+func newHostFDCacheTestFS(t *testing.T, maxFDs uint64, n int) (*filesystem, []*dentry) {
+	ctx := contexttest.Context(t)
+	fs := &filesystem{
+		mfp:         pgalloc.MemoryFileProviderFromContext(ctx),
+		inoByKey:    make(map[inoKey]uint64),
+		clock:       time.RealtimeClockFromContext(ctx),
+		dentryCache: &dentryCache{maxCachedDentries: 0},
+		hostFDCache: &hostFDCache{maxFDs: maxFDs},
+	}
+	dir := t.TempDir()
+	dirFD, err := unix.Open(dir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		t.Fatalf("open(%q) failed: %v", dir, err)
+	}
+	root, err := fs.newDirectfsDentry(dirFD)
+	if err != nil {
+		t.Fatalf("fs.newDirectfsDentry() failed: %v", err)
+	}
+	var files []*dentry
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("file%d", i)
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("WriteFile(%q) failed: %v", path, err)
+		}
+		controlFD, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+		if err != nil {
+			t.Fatalf("open(%q) failed: %v", path, err)
+		}
+		d, err := fs.newDirectfsDentry(controlFD)
+		if err != nil {
+			t.Fatalf("fs.newDirectfsDentry() failed: %v", err)
+		}
+		d.parent.Store(root)
+		d.name = name
+		files = append(files, d)
+	}
+	return fs, files
+}
+
+// openTestHandles opens read and write handles for d.
+func openTestHandles(t *testing.T, d *dentry) {
+	ctx := contexttest.Context(t)
+	d.fs.renameMu.RLock()
+	defer d.fs.renameMu.RUnlock()
+	if err := d.ensureSharedHandle(ctx, true /* read */, true /* write */, false /* trunc */); err != nil {
+		t.Fatalf("ensureSharedHandle failed: %v", err)
+	}
+}
+
+func TestHostFDCacheEviction(t *testing.T) {
+	fs, files := newHostFDCacheTestFS(t, 2 /* maxFDs */, 3)
+	for _, d := range files {
+		openTestHandles(t, d)
+	}
+
+	// Opening the third file should have evicted the handles of the least
+	// recently opened file.
+	if got := fs.hostFDCache.fds; got != 2 {
+		t.Errorf("hostFDCache.fds = %d, want 2", got)
+	}
+	if got := files[0].readFD.Load(); got != -1 {
+		t.Errorf("evicted dentry has readFD %d, want -1", got)
+	}
+	if got, want := files[0].evictedHandles.Load(), uint32(evictedRead|evictedWrite); got != want {
+		t.Errorf("evicted dentry has evictedHandles %#x, want %#x", got, want)
+	}
+	for _, d := range files[1:] {
+		if d.readFD.Load() < 0 || d.evictedHandles.Load() != 0 {
+			t.Errorf("dentry %q has readFD %d and evictedHandles %#x, want open handles", d.name, d.readFD.Load(), d.evictedHandles.Load())
+		}
+	}
+}
+
+func TestHostFDCachePinned(t *testing.T) {
+	ctx := contexttest.Context(t)
+	fs, files := newHostFDCacheTestFS(t, 2 /* maxFDs */, 3)
+	openTestHandles(t, files[0])
+	if err := files[0].pinHandles(ctx); err != nil {
+		t.Fatalf("pinHandles failed: %v", err)
+	}
+	files[0].hostFDReferenced.Store(0)
+	openTestHandles(t, files[1])
+	openTestHandles(t, files[2])
+
+	// The pinned dentry must be skipped in favor of the next least recently
+	// opened one.
+	if files[0].readFD.Load() < 0 {
+		t.Errorf("pinned dentry's handles were evicted")
+	}
+	if got := files[1].readFD.Load(); got != -1 {
+		t.Errorf("unpinned dentry has readFD %d, want -1", got)
+	}
+	files[0].unpinHandles()
+
+	// Pinning the evicted dentry reopens its handles, which evicts another
+	// dentry's handles.
+	if err := files[1].pinHandles(ctx); err != nil {
+		t.Fatalf("pinHandles failed: %v", err)
+	}
+	defer files[1].unpinHandles()
+	if files[1].readFD.Load() < 0 || files[1].writeFD.Load() < 0 || files[1].evictedHandles.Load() != 0 {
+		t.Errorf("pinned dentry has readFD %d, writeFD %d and evictedHandles %#x, want reopened handles", files[1].readFD.Load(), files[1].writeFD.Load(), files[1].evictedHandles.Load())
+	}
+	if got := fs.hostFDCache.fds; got != 2 {
+		t.Errorf("hostFDCache.fds = %d, want 2", got)
+	}
+}
+
+func TestHostFDCacheRemove(t *testing.T) {
+	fs, files := newHostFDCacheTestFS(t, 0 /* maxFDs */, 2)
+	for _, d := range files {
+		openTestHandles(t, d)
+	}
+	if got := fs.hostFDCache.fds; got != 2 {
+		t.Fatalf("hostFDCache.fds = %d, want 2", got)
+	}
+
+	d := files[0]
+	d.handleMu.Lock()
+	fs.hostFDCache.remove(d)
+	d.handleMu.Unlock()
+	if got := fs.hostFDCache.fds; got != 1 {
+		t.Errorf("hostFDCache.fds = %d after remove, want 1", got)
+	}
+	// d is no longer tracked, so it can't be evicted.
+	ctx := contexttest.Context(t)
+	if n := d.evictHandles(ctx); n != 0 {
+		t.Errorf("evictHandles closed %d handles of removed dentry, want 0", n)
+	}
+	if got := fs.hostFDCache.shrink(ctx, 0 /* target */, nil /* except */); got != 1 {
+		t.Errorf("shrink closed %d handles, want 1", got)
+	}
+}
@@ -28,6 +28,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/socket/unix/transport"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
 )
 
 func (fs *filesystem) handleAnameLisafs(ctx context.Context, rootInode lisafs.Inode) (lisafs.Inode, error) {
@@ -91,6 +92,33 @@ type lisafsDentry struct {
 	// be closed until the dentry is destroyed. writeFDLisa is protected by
 	// dentry.handleMu.
 	writeFDLisa lisafs.ClientFD `state:"nosave"`
+
+	// packedFilesMu protects the fields below.
+	packedFilesMu sync.Mutex `state:"nosave"`
+
+	// If this dentry represents a directory, smallFileMisses is the number of
+	// reads of small files in the directory that missed the page cache before
+	// the directory's small files were packed. See packed_files.go.
+	//
+	// +checklocks:packedFilesMu
+	smallFileMisses int `state:"nosave"`
+
+	// packedFilesRead is true if the directory's small files were packed with
+	// the ReadDirFiles RPC.
+	//
+	// +checklocks:packedFilesMu
+	packedFilesRead bool `state:"nosave"`
+
+	// packedFiles maps the names of packed files that have not been used yet
+	// to their contents.
+	//
+	// +checklocks:packedFilesMu
+	packedFiles map[string]lisafs.PackedFile `state:"nosave"`
+
+	// packedFilesBytes is the number of bytes of file data in packedFiles.
+	//
+	// +checklocks:packedFilesMu
+	packedFilesBytes uint64 `state:"nosave"`
 }
 
 // newLisafsDentry creates a new dentry representing the given file. The dentry
@@ -207,6 +235,18 @@ func (d *lisafsDentry) updateHandles(ctx context.Context, h handle, readable, wr
 	}
 }
 
+// Precondition: dentry.handleMu must be locked.
+func (d *lisafsDentry) closeHandles(ctx context.Context) {
+	if d.readFDLisa.Ok() && d.readFDLisa.ID() != d.writeFDLisa.ID() {
+		d.readFDLisa.Close(ctx, false /* flush */)
+	}
+	if d.writeFDLisa.Ok() {
+		d.writeFDLisa.Close(ctx, false /* flush */)
+	}
+	d.readFDLisa = lisafs.ClientFD{}
+	d.writeFDLisa = lisafs.ClientFD{}
+}
+
 // Precondition: d.metadataMu must be locked.
 //
 // +checklocks:d.metadataMu
@@ -258,6 +298,7 @@ func chmod(ctx context.Context, controlFD lisafs.ClientFD, mode uint16) error {
 }
 
 func (d *lisafsDentry) destroy(ctx context.Context) {
+	d.releasePackedFiles()
 	if d.readFDLisa.Ok() && d.readFDLisa.ID() != d.writeFDLisa.ID() {
 		d.readFDLisa.Close(ctx, false /* flush */)
 	}
@@ -0,0 +1,179 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/lisafs"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
+)
+
+// Applications such as Python and Node.js interpreters read thousands of small
+// files when they start. Each read of a file that isn't in the page cache
+// costs a round trip to the gofer. Once a directory has seen
+// packedFilesThreshold such reads, the contents of all small regular files in
+// the directory are read with a single ReadDirFiles RPC, and used to fill the
+// page cache of the files when they are read. This only applies to files whose
+// data is cached by the sentry; see dentry.usesPageCache().
+const (
+	// packedFileMaxSize is the maximum size of a file that is packed.
+	packedFileMaxSize = 4096
+
+	// packedFilesThreshold is the number of reads of small files that miss
+	// the page cache in a directory after which the directory's small files
+	// are packed.
+	packedFilesThreshold = 4
+
+	// packedFilesMaxDirBytes is the maximum number of bytes of file data
+	// packed for a single directory.
+	packedFilesMaxDirBytes = 256 << 10
+
+	// packedFilesMaxBytes is the maximum number of bytes of packed file data
+	// that hasn't been used yet in a filesystem.
+	packedFilesMaxBytes = 16 << 20
+)
+
+// maybeFillFromPackedFile fills d's page cache with the contents of d packed
+// by its parent directory, if any, before d is read at offset. It is a no-op
+// unless d is a small regular file whose data is not cached yet.
+func (d *dentry) maybeFillFromPackedFile(ctx context.Context, offset int64) {
+	if _, ok := d.impl.(*lisafsDentry); !ok {
+		return
+	}
+	if offset != 0 || d.size.Load() > packedFileMaxSize || !d.fs.client.IsSupported(lisafs.ReadDirFiles) {
+		return
+	}
+	d.dataMu.RLock()
+	cached := !d.cache.IsEmpty()
+	d.dataMu.RUnlock()
+	if cached {
+		return
+	}
+
+	// Hold renameMu so that d's parent and name are stable, and so that the
+	// parent isn't destroyed while it is in use.
+	d.fs.renameMu.RLock()
+	defer d.fs.renameMu.RUnlock()
+	parent := d.parent.Load()
+	if parent == nil {
+		return
+	}
+	pd, ok := parent.impl.(*lisafsDentry)
+	if !ok || !pd.controlFD.Ok() {
+		return
+	}
+	f, ok := pd.takePackedFile(ctx, d.name)
+	if !ok {
+		return
+	}
+	d.fillFromPackedFile(ctx, &f)
+}
+
+// takePackedFile returns the packed contents of the file with the given name
+// in d, packing the contents of d's small files first if d has seen enough
+// reads of small files that missed the page cache. The returned file is
+// removed from d's packed files.
+func (d *lisafsDentry) takePackedFile(ctx context.Context, name string) (lisafs.PackedFile, bool) {
+	d.packedFilesMu.Lock()
+	defer d.packedFilesMu.Unlock()
+	if !d.packedFilesRead {
+		d.smallFileMisses++
+		if d.smallFileMisses < packedFilesThreshold || d.fs.packedFilesBytes.Load() >= packedFilesMaxBytes {
+			return lisafs.PackedFile{}, false
+		}
+		// Only pack a directory once: the files it contains that are read
+		// after this have been packed or are not worth packing.
+		d.packedFilesRead = true
+		files, err := d.controlFD.ReadDirFiles(ctx, packedFileMaxSize, packedFilesMaxDirBytes)
+		if err != nil {
+			log.Debugf("gofer.lisafsDentry.takePackedFile: ReadDirFiles failed: %v", err)
+			return lisafs.PackedFile{}, false
+		}
+		d.packedFiles = make(map[string]lisafs.PackedFile, len(files))
+		var total uint64
+		for _, f := range files {
+			d.packedFiles[string(f.Name)] = f
+			total += uint64(len(f.Data))
+		}
+		d.packedFilesBytes = total
+		d.fs.packedFilesBytes.Add(total)
+	}
+	f, ok := d.packedFiles[name]
+	if !ok {
+		return lisafs.PackedFile{}, false
+	}
+	delete(d.packedFiles, name)
+	d.packedFilesBytes -= uint64(len(f.Data))
+	d.fs.packedFilesBytes.Add(-uint64(len(f.Data)))
+	return f, true
+}
+
+// releasePackedFiles drops packed files that haven't been used.
+func (d *lisafsDentry) releasePackedFiles() {
+	d.packedFilesMu.Lock()
+	defer d.packedFilesMu.Unlock()
+	d.fs.packedFilesBytes.Add(-d.packedFilesBytes)
+	d.packedFilesBytes = 0
+	d.packedFiles = nil
+}
+
+// packedFileMatches returns true if f holds the contents of the file
+// identified by key, as of when its size and modification time were size and
+// mtime.
+func packedFileMatches(f *lisafs.PackedFile, key inoKey, size uint64, mtime int64) bool {
+	const mask = linux.STATX_INO | linux.STATX_SIZE | linux.STATX_MTIME
+	return f.Stat.Mask&mask == mask &&
+		inoKeyFromStatx(&f.Stat) == key &&
+		f.Stat.Size == size &&
+		uint64(len(f.Data)) == size &&
+		dentryTimestamp(f.Stat.Mtime) == mtime
+}
+
+// fillFromPackedFile fills d's page cache with the contents of f, if f is
+// still consistent with d's cached metadata and d's data is not cached yet.
+func (d *dentry) fillFromPackedFile(ctx context.Context, f *lisafs.PackedFile) {
+	if !d.cachedMetadataAuthoritative() {
+		return
+	}
+	d.metadataMu.Lock()
+	defer d.metadataMu.Unlock()
+	d.handleMu.RLock()
+	defer d.handleMu.RUnlock()
+	mf := d.fs.mfp.MemoryFile()
+	if !d.usesPageCache() || !mf.ShouldCacheEvictable() {
+		return
+	}
+	d.dataMu.Lock()
+	defer d.dataMu.Unlock()
+	size := d.size.RacyLoad()
+	if size == 0 || !d.cache.IsEmpty() || !packedFileMatches(f, d.inoKey, size, d.mtime.RacyLoad()) {
+		return
+	}
+	pgend, _ := hostarch.PageRoundUp(size)
+	mr := memmap.MappableRange{0, pgend}
+	readAt := func(ctx context.Context, dsts safemem.BlockSeq, offset uint64) (uint64, error) {
+		return safemem.CopySeq(dsts, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(f.Data[offset:])))
+	}
+	if _, err := d.cache.Fill(ctx, mr, mr, size, mf, usage.PageCache, pgalloc.AllocateAndWritePopulate, readAt); err != nil {
+		log.Debugf("gofer.dentry.fillFromPackedFile: failed to fill page cache: %v", err)
+	}
+	mf.MarkEvictable(d, pgalloc.EvictableRange{mr.Start, mr.End})
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/lisafs"
+)
+
+func TestPackedFileMatches(t *testing.T) {
+	const (
+		size  = 5
+		mtime = 1_000_000_123
+	)
+	newFile := func() lisafs.PackedFile {
+		return lisafs.PackedFile{
+			Stat: linux.Statx{
+				Mask:     linux.STATX_INO | linux.STATX_SIZE | linux.STATX_MTIME,
+				Ino:      42,
+				DevMajor: 8,
+				DevMinor: 1,
+				Size:     size,
+				Mtime:    linux.StatxTimestamp{Sec: 1, Nsec: 123},
+			},
+			Name: "file",
+			Data: []byte("hello"),
+		}
+	}
+	f := newFile()
+	key := inoKeyFromStatx(&f.Stat)
+	for _, tc := range []struct {
+		name   string
+		modify func(f *lisafs.PackedFile)
+		want   bool
+	}{
+		{
+			name:   "match",
+			modify: func(*lisafs.PackedFile) {},
+			want:   true,
+		},
+		{
+			name:   "missing mask",
+			modify: func(f *lisafs.PackedFile) { f.Stat.Mask &^= linux.STATX_MTIME },
+		},
+		{
+			name:   "other inode",
+			modify: func(f *lisafs.PackedFile) { f.Stat.Ino++ },
+		},
+		{
+			name:   "size changed",
+			modify: func(f *lisafs.PackedFile) { f.Stat.Size++ },
+		},
+		{
+			name:   "short data",
+			modify: func(f *lisafs.PackedFile) { f.Data = f.Data[:size-1] },
+		},
+		{
+			name:   "modified",
+			modify: func(f *lisafs.PackedFile) { f.Stat.Mtime.Nsec++ },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFile()
+			tc.modify(&f)
+			if got := packedFileMatches(&f, key, size, mtime); got != tc.want {
+				t.Errorf("packedFileMatches() = %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
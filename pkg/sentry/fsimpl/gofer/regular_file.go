@@ -20,6 +20,7 @@ import (
 	"math"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
@@ -47,10 +48,20 @@ type regularFileFD struct {
 	// off is the file offset. off is protected by mu.
 	mu  sync.Mutex `state:"nosave"`
 	off int64
+
+	// readahead is the maximum number of bytes beyond what a read requires
+	// that reads through the page cache may fill. It is set by fadvise64(2).
+	readahead atomicbitops.Uint64
+
+	// mmapPinned is non-zero if fd holds a pin on its dentry's handles on
+	// behalf of memory mappings; see ConfigureMMap.
+	mmapPinned atomicbitops.Uint32 `state:"nosave"`
 }
 
 func newRegularFileFD(mnt *vfs.Mount, d *dentry, flags uint32) (*regularFileFD, error) {
-	fd := &regularFileFD{}
+	fd := &regularFileFD{
+		readahead: atomicbitops.FromUint64(defaultReadahead),
+	}
 	fd.LockFD.Init(&d.locks)
 	if err := fd.vfsfd.Init(fd, flags, mnt, &d.vfsd, &vfs.FileDescriptionOptions{
 		AllowDirectIO: true,
@@ -70,6 +81,9 @@ func newRegularFileFD(mnt *vfs.Mount, d *dentry, flags uint32) (*regularFileFD,
 
 // Release implements vfs.FileDescriptionImpl.Release.
 func (fd *regularFileFD) Release(context.Context) {
+	if fd.mmapPinned.Load() != 0 {
+		fd.dentry().unpinHandles()
+	}
 }
 
 // OnClose implements vfs.FileDescriptionImpl.OnClose.
@@ -100,6 +114,10 @@ func (fd *regularFileFD) OnClose(ctx context.Context) error {
 // Allocate implements vfs.FileDescriptionImpl.Allocate.
 func (fd *regularFileFD) Allocate(ctx context.Context, mode, offset, length uint64) error {
 	d := fd.dentry()
+	if err := d.pinHandles(ctx); err != nil {
+		return err
+	}
+	defer d.unpinHandles()
 	return d.doAllocate(ctx, offset, length, func() error {
 		return d.allocate(ctx, mode, offset, length)
 	})
@@ -109,6 +127,10 @@ func (fd *regularFileFD) Allocate(ctx context.Context, mode, offset, length uint
 func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offset int64, opts vfs.ReadOptions) (int64, error) {
 	start := fsmetric.StartReadWait()
 	d := fd.dentry()
+	if err := d.pinHandles(ctx); err != nil {
+		return 0, err
+	}
+	defer d.unpinHandles()
 	defer func() {
 		if d.readFD.Load() >= 0 {
 			fsmetric.GoferReadsHost.Increment()
@@ -156,7 +178,9 @@ func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offs
 			d.touchAtimeLocked(fd.vfsfd.Mount())
 		}
 	} else {
+		d.maybeFillFromPackedFile(ctx, offset)
 		rw := getDentryReadWriter(ctx, d, offset)
+		rw.readahead = fd.readahead.Load()
 		n, readErr = dst.CopyOutFrom(ctx, rw)
 		putDentryReadWriter(rw)
 		if d.fs.opts.interop != InteropModeShared {
@@ -197,6 +221,10 @@ func (fd *regularFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 	}
 
 	d := fd.dentry()
+	if err := d.pinHandles(ctx); err != nil {
+		return 0, offset, err
+	}
+	defer d.unpinHandles()
 
 	d.metadataMu.Lock()
 	defer d.metadataMu.Unlock()
@@ -244,6 +272,11 @@ func (fd *regularFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 	if err != nil {
 		return n, offset + n, err
 	}
+	if n > 0 {
+		// This must be done after CopyInTo returns, since writeback may need to
+		// invalidate memory mappings.
+		d.fs.balanceDirty(ctx, d)
+	}
 	if n > 0 && fd.vfsfd.StatusFlags()&(linux.O_DSYNC|linux.O_SYNC) != 0 {
 		// Note that if any of the following fail, then we can't guarantee that
 		// any data was actually written with the semantics of O_DSYNC or
@@ -326,10 +359,11 @@ func (fd *regularFileFD) Write(ctx context.Context, src usermem.IOSequence, opts
 }
 
 type dentryReadWriter struct {
-	ctx    context.Context
-	d      *dentry
-	off    uint64
-	direct bool
+	ctx       context.Context
+	d         *dentry
+	off       uint64
+	direct    bool
+	readahead uint64
 }
 
 var dentryReadWriterPool = sync.Pool{
@@ -344,6 +378,7 @@ func getDentryReadWriter(ctx context.Context, d *dentry, offset int64) *dentryRe
 	rw.d = d
 	rw.off = uint64(offset)
 	rw.direct = false
+	rw.readahead = defaultReadahead
 	return rw
 }
 
@@ -367,7 +402,7 @@ func (rw *dentryReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error)
 	rw.d.handleMu.RLock()
 	h := rw.d.readHandle()
 	if (rw.d.mmapFD.RacyLoad() >= 0 && !rw.d.fs.opts.forcePageCache) || rw.d.fs.opts.interop == InteropModeShared || rw.direct {
-		n, err := h.readToBlocksAt(rw.ctx, dsts, rw.off)
+		n, err := rw.d.readToBlocksAt(rw.ctx, &h, dsts, rw.off)
 		rw.d.handleMu.RUnlock()
 		rw.off += n
 		return n, err
@@ -435,7 +470,7 @@ func (rw *dentryReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error)
 					End:   gapEnd,
 				}
 				optMR := gap.Range()
-				_, err := rw.d.cache.Fill(rw.ctx, reqMR, maxFillRange(reqMR, optMR), rw.d.size.Load(), mf, usage.PageCache, pgalloc.AllocateAndWritePopulate, h.readToBlocksAt)
+				_, err := rw.d.cache.Fill(rw.ctx, reqMR, readaheadRange(reqMR, optMR, rw.readahead), rw.d.size.Load(), mf, usage.PageCache, pgalloc.AllocateAndWritePopulate, rw.d.readToBlocksAtFunc(&h))
 				mf.MarkEvictable(rw.d, pgalloc.EvictableRange{optMR.Start, optMR.End})
 				seg, gap = rw.d.cache.Find(rw.off)
 				if !seg.Ok() {
@@ -450,7 +485,7 @@ func (rw *dentryReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error)
 			} else {
 				// Read directly from the file.
 				gapDsts := dsts.TakeFirst64(gapMR.Length())
-				n, err := h.readToBlocksAt(rw.ctx, gapDsts, gapMR.Start)
+				n, err := rw.d.readToBlocksAt(rw.ctx, &h, gapDsts, gapMR.Start)
 				done += n
 				rw.off += n
 				dsts = dsts.DropFirst64(n)
@@ -533,7 +568,7 @@ func (rw *dentryReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64, erro
 			done += n
 			rw.off += n
 			srcs = srcs.DropFirst64(n)
-			rw.d.dirty.MarkDirty(segMR)
+			rw.d.markDirtyLocked(segMR, false /* keep */)
 			if err != nil {
 				retErr = err
 				goto exitLoop
@@ -581,6 +616,7 @@ exitLoop:
 			done = 0
 			retErr = err
 		}
+		rw.d.updateDirtyBytesLocked()
 	}
 	rw.d.dataMu.Unlock()
 	rw.d.handleMu.RUnlock()
@@ -596,6 +632,7 @@ func (d *dentry) writeback(ctx context.Context, offset, size int64) error {
 	h := d.writeHandle()
 	d.dataMu.Lock()
 	defer d.dataMu.Unlock()
+	defer d.updateDirtyBytesLocked()
 	// Compute the range of valid bytes (overflow-checked).
 	dentrySize := d.size.Load()
 	if uint64(offset) >= dentrySize {
@@ -611,6 +648,179 @@ func (d *dentry) writeback(ctx context.Context, offset, size int64) error {
 	}, &d.cache, &d.dirty, dentrySize, d.fs.mfp.MemoryFile(), h.writeFromBlocksAt)
 }
 
+// SyncRange implements vfs.FileDescriptionImplSyncRangeExtension.SyncRange.
+func (fd *regularFileFD) SyncRange(ctx context.Context, offset, nbytes int64, flags uint32) error {
+	d := fd.dentry()
+	if err := d.pinHandles(ctx); err != nil {
+		return err
+	}
+	defer d.unpinHandles()
+	if flags&linux.SYNC_FILE_RANGE_WRITE != 0 {
+		// Writing back dirty pages cached by the sentry is synchronous, so
+		// only the remote file's write-out can still be in progress after
+		// this. nbytes == 0 means through the end of the file; d.writeback
+		// clamps the range to the file size.
+		size := nbytes
+		if size == 0 {
+			size = math.MaxInt64
+		}
+		if err := d.writeback(ctx, offset, size); err != nil {
+			return err
+		}
+	}
+	return d.syncRemoteFileRange(ctx, offset, nbytes, flags)
+}
+
+// syncRemoteFileRange forwards sync_file_range(2) to the remote file.
+func (d *dentry) syncRemoteFileRange(ctx context.Context, offset, nbytes int64, flags uint32) error {
+	d.handleMu.RLock()
+	defer d.handleMu.RUnlock()
+	// As in syncRemoteFileLocked, prefer the write handle.
+	h := d.writeHandle()
+	if !d.isWriteHandleOk() {
+		h = d.readHandle()
+	}
+	return h.syncRange(ctx, uint64(offset), uint64(nbytes), flags)
+}
+
+// WriteHint implements vfs.FileDescriptionImplWriteHintExtension.WriteHint.
+func (fd *regularFileFD) WriteHint() uint64 {
+	return fd.dentry().writeHint.Load()
+}
+
+// SetWriteHint implements vfs.FileDescriptionImplWriteHintExtension.SetWriteHint.
+func (fd *regularFileFD) SetWriteHint(ctx context.Context, hint uint64) error {
+	d := fd.dentry()
+	if err := d.pinHandles(ctx); err != nil {
+		return err
+	}
+	defer d.unpinHandles()
+	d.handleMu.RLock()
+	defer d.handleMu.RUnlock()
+	// Write hints apply to the host inode, so any handle will do.
+	h := d.writeHandle()
+	if !d.isWriteHandleOk() {
+		h = d.readHandle()
+	}
+	if err := h.setWriteHint(ctx, hint); err != nil {
+		return err
+	}
+	d.writeHint.Store(hint)
+	return nil
+}
+
+// Advise implements vfs.FileDescriptionImplAdviseExtension.Advise.
+func (fd *regularFileFD) Advise(ctx context.Context, offset, length int64, advice int32) error {
+	switch advice {
+	case linux.POSIX_FADV_NORMAL:
+		fd.readahead.Store(defaultReadahead)
+	case linux.POSIX_FADV_RANDOM:
+		fd.readahead.Store(0)
+	case linux.POSIX_FADV_SEQUENTIAL:
+		fd.readahead.Store(sequentialReadahead)
+	case linux.POSIX_FADV_WILLNEED, linux.POSIX_FADV_DONTNEED:
+		// Like Linux, ignore ranges starting at negative offsets.
+		if offset < 0 {
+			return nil
+		}
+		end := uint64(math.MaxInt64)
+		if rend := offset + length; length != 0 && rend > offset {
+			end = uint64(rend)
+		}
+		mr := memmap.MappableRange{uint64(offset), end}
+		d := fd.dentry()
+		if err := d.pinHandles(ctx); err != nil {
+			return err
+		}
+		defer d.unpinHandles()
+		if advice == linux.POSIX_FADV_WILLNEED {
+			d.willNeed(ctx, mr)
+			return nil
+		}
+		return d.dontNeed(ctx, mr)
+	}
+	return nil
+}
+
+// usesPageCache returns true if reads and writes of d's data go through the
+// sentry's page cache.
+//
+// Preconditions: d.handleMu must be locked.
+func (d *dentry) usesPageCache() bool {
+	return (d.mmapFD.RacyLoad() < 0 || d.fs.opts.forcePageCache) && d.fs.opts.interop != InteropModeShared
+}
+
+// willNeed reads data in mr into the page cache, up to maxWillNeed bytes.
+// Errors are ignored, since the data will be read again when it is needed.
+// Compare Linux's mm/readahead.c:force_page_cache_ra().
+func (d *dentry) willNeed(ctx context.Context, mr memmap.MappableRange) {
+	d.handleMu.RLock()
+	defer d.handleMu.RUnlock()
+	mf := d.fs.mfp.MemoryFile()
+	if !d.usesPageCache() || !mf.ShouldCacheEvictable() {
+		return
+	}
+	d.dataMu.Lock()
+	defer d.dataMu.Unlock()
+	pgend, _ := hostarch.PageRoundUp(d.size.Load())
+	mr.Start = hostarch.PageRoundDown(mr.Start)
+	if mr.End > pgend {
+		mr.End = pgend
+	}
+	if mr.Start >= mr.End {
+		return
+	}
+	if mr.Length() > maxWillNeed {
+		mr.End = mr.Start + maxWillNeed
+	}
+	h := d.readHandle()
+	d.cache.Fill(ctx, mr, mr, d.size.Load(), mf, usage.PageCache, pgalloc.AllocateAndWritePopulate, d.readToBlocksAtFunc(&h))
+	mf.MarkEvictable(d, pgalloc.EvictableRange{mr.Start, mr.End})
+}
+
+// dontNeed writes back dirty data in mr, and then drops pages that are
+// entirely within mr from the page cache, unless they are memory-mapped.
+// Compare Linux's mm/fadvise.c:generic_fadvise() => POSIX_FADV_DONTNEED.
+func (d *dentry) dontNeed(ctx context.Context, mr memmap.MappableRange) error {
+	if err := d.writeback(ctx, int64(mr.Start), int64(mr.Length())); err != nil {
+		return err
+	}
+	// Only drop whole pages.
+	start, ok := hostarch.PageRoundUp(mr.Start)
+	if !ok {
+		return nil
+	}
+	mr = memmap.MappableRange{start, hostarch.PageRoundDown(mr.End)}
+	if mr.Start >= mr.End {
+		return nil
+	}
+
+	mf := d.fs.mfp.MemoryFile()
+	d.mapsMu.Lock()
+	defer d.mapsMu.Unlock()
+	d.dataMu.Lock()
+	defer d.dataMu.Unlock()
+	// Pages that were dirtied again since they were written back above are
+	// kept, as in Linux.
+	var drop []memmap.MappableRange
+	for mgap := d.mappings.LowerBoundGap(mr.Start); mgap.Ok() && mgap.Start() < mr.End; mgap = mgap.NextGap() {
+		mgapMR := mgap.Range().Intersect(mr)
+		if mgapMR.Length() == 0 {
+			continue
+		}
+		for dgap := d.dirty.LowerBoundGap(mgapMR.Start); dgap.Ok() && dgap.Start() < mgapMR.End; dgap = dgap.NextGap() {
+			if cleanMR := dgap.Range().Intersect(mgapMR); cleanMR.Length() != 0 {
+				drop = append(drop, cleanMR)
+			}
+		}
+	}
+	for _, dropMR := range drop {
+		mf.MarkUnevictable(d, pgalloc.EvictableRange{dropMR.Start, dropMR.End})
+		d.cache.Drop(dropMR, mf)
+	}
+	return nil
+}
+
 // Seek implements vfs.FileDescriptionImpl.Seek.
 func (fd *regularFileFD) Seek(ctx context.Context, offset int64, whence int32) (int64, error) {
 	fd.mu.Lock()
@@ -665,12 +875,30 @@ func regularFileSeekLocked(ctx context.Context, d *dentry, fdOffset, offset int6
 
 // Sync implements vfs.FileDescriptionImpl.Sync.
 func (fd *regularFileFD) Sync(ctx context.Context) error {
-	return fd.dentry().syncCachedFile(ctx, false /* forFilesystemSync */)
+	d := fd.dentry()
+	// Sync through reopened handles if they were evicted, since data written
+	// through the evicted handles may not have been synced yet.
+	if err := d.pinHandles(ctx); err != nil {
+		return err
+	}
+	defer d.unpinHandles()
+	return d.syncCachedFile(ctx, false /* forFilesystemSync */)
 }
 
 // ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap.
 func (fd *regularFileFD) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
 	d := fd.dentry()
+	// Memory mappings use d's handles without pinning them. Once a mapping is
+	// added, d's handles can't be evicted until it is removed, but the
+	// mapping is added after ConfigureMMap returns. fd is the mapping's
+	// memmap.MappingIdentity, so keep d's handles pinned until fd is
+	// released.
+	if fd.mmapPinned.CompareAndSwap(0, 1) {
+		if err := d.pinHandles(ctx); err != nil {
+			fd.mmapPinned.Store(0)
+			return err
+		}
+	}
 	// Force sentry page caching at your own risk.
 	if !d.fs.opts.forcePageCache {
 		switch d.fs.opts.interop {
@@ -686,8 +914,9 @@ func (fd *regularFileFD) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpt
 			fallthrough
 		case InteropModeShared:
 			// All mappings require a host FD to be coherent with other
-			// filesystem users.
-			if d.mmapFD.Load() < 0 {
+			// filesystem users. Files with fs-verity enabled are immutable,
+			// so the internal page cache is always coherent for them.
+			if d.mmapFD.Load() < 0 && d.verity.Load() == nil {
 				return linuxerr.ENODEV
 			}
 		default:
@@ -794,7 +1023,7 @@ func (d *dentry) Translate(ctx context.Context, required, optional memmap.Mappab
 
 	mf := d.fs.mfp.MemoryFile()
 	h := d.readHandle()
-	_, cerr := d.cache.Fill(ctx, required, maxFillRange(required, optional), d.size.Load(), mf, usage.PageCache, pgalloc.AllocateAndWritePopulate, h.readToBlocksAt)
+	_, cerr := d.cache.Fill(ctx, required, maxFillRange(required, optional), d.size.Load(), mf, usage.PageCache, pgalloc.AllocateAndWritePopulate, d.readToBlocksAtFunc(&h))
 
 	var ts []memmap.Translation
 	var translatedEnd uint64
@@ -809,7 +1038,8 @@ func (d *dentry) Translate(ctx context.Context, required, optional memmap.Mappab
 		if at.Write {
 			// From this point forward, this memory can be dirtied through the
 			// mapping at any time.
-			d.dirty.KeepDirty(segMR)
+			d.markDirtyLocked(segMR, true /* keep */)
+			d.writableTranslations++
 			perms.Write = true
 		}
 		ts = append(ts, memmap.Translation{
@@ -824,6 +1054,13 @@ func (d *dentry) Translate(ctx context.Context, required, optional memmap.Mappab
 	d.dataMu.Unlock()
 	d.handleMu.RUnlock()
 
+	if at.Write {
+		// Unlike writes, faults can't be throttled, since writeback may need to
+		// invalidate translations of mappings in the faulting
+		// memmap.MappingSpace.
+		d.fs.maybeStartBackgroundWriteback()
+	}
+
 	// Don't return the error returned by c.cache.Fill if it occurred outside
 	// of required.
 	if translatedEnd < required.End && cerr != nil {
@@ -835,8 +1072,30 @@ func (d *dentry) Translate(ctx context.Context, required, optional memmap.Mappab
 	return ts, nil
 }
 
+// Readahead window sizes, in bytes.
+const (
+	// defaultReadahead is the readahead window used by default and for
+	// POSIX_FADV_NORMAL. It was chosen arbitrarily.
+	defaultReadahead = 64 << 10
+
+	// sequentialReadahead is the readahead window used for
+	// POSIX_FADV_SEQUENTIAL. Like Linux, it is twice the default window.
+	sequentialReadahead = 2 * defaultReadahead
+
+	// maxWillNeed is the maximum number of bytes that POSIX_FADV_WILLNEED
+	// reads into the page cache per call. Compare Linux's
+	// mm/readahead.c:force_page_cache_ra(), which limits it to the device's
+	// maximum I/O size.
+	maxWillNeed = 2 << 20
+)
+
 func maxFillRange(required, optional memmap.MappableRange) memmap.MappableRange {
-	const maxReadahead = 64 << 10 // 64 KB, chosen arbitrarily
+	return readaheadRange(required, optional, defaultReadahead)
+}
+
+// readaheadRange returns the range to fill in the page cache to read required,
+// reading ahead up to maxReadahead bytes of optional.
+func readaheadRange(required, optional memmap.MappableRange, maxReadahead uint64) memmap.MappableRange {
 	if required.Length() >= maxReadahead {
 		return required
 	}
@@ -877,6 +1136,7 @@ func (d *dentry) InvalidateUnsavable(ctx context.Context) error {
 	// been returned after we invalidated all existing translations above.
 	d.cache.DropAll(mf)
 	d.dirty.RemoveAll()
+	d.updateDirtyBytesLocked()
 
 	return nil
 }
@@ -892,6 +1152,7 @@ func (d *dentry) Evict(ctx context.Context, er pgalloc.EvictableRange) {
 	h := d.writeHandle()
 	d.dataMu.Lock()
 	defer d.dataMu.Unlock()
+	defer d.updateDirtyBytesLocked()
 
 	// Only allow pages that are no longer memory-mapped to be evicted.
 	for mgap := d.mappings.LowerBoundGap(mr.Start); mgap.Ok() && mgap.Start() < mr.End; mgap = mgap.NextGap() {
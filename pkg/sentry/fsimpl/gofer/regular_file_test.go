@@ -0,0 +1,73 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+)
+
+func TestReadaheadRange(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		required     memmap.MappableRange
+		optional     memmap.MappableRange
+		maxReadahead uint64
+		want         memmap.MappableRange
+	}{
+		{
+			name:         "optional within window",
+			required:     memmap.MappableRange{0x1000, 0x2000},
+			optional:     memmap.MappableRange{0, 0x8000},
+			maxReadahead: defaultReadahead,
+			want:         memmap.MappableRange{0, 0x8000},
+		},
+		{
+			name:         "optional beyond window",
+			required:     memmap.MappableRange{0x1000, 0x2000},
+			optional:     memmap.MappableRange{0, 0x100000},
+			maxReadahead: defaultReadahead,
+			want:         memmap.MappableRange{0x1000, 0x1000 + defaultReadahead},
+		},
+		{
+			name:         "sequential",
+			required:     memmap.MappableRange{0x1000, 0x2000},
+			optional:     memmap.MappableRange{0, 0x100000},
+			maxReadahead: sequentialReadahead,
+			want:         memmap.MappableRange{0x1000, 0x1000 + sequentialReadahead},
+		},
+		{
+			name:         "random",
+			required:     memmap.MappableRange{0x1000, 0x2000},
+			optional:     memmap.MappableRange{0, 0x8000},
+			maxReadahead: 0,
+			want:         memmap.MappableRange{0x1000, 0x2000},
+		},
+		{
+			name:         "required larger than window",
+			required:     memmap.MappableRange{0, 0x20000},
+			optional:     memmap.MappableRange{0, 0x100000},
+			maxReadahead: defaultReadahead,
+			want:         memmap.MappableRange{0, 0x20000},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := readaheadRange(tc.required, tc.optional, tc.maxReadahead); got != tc.want {
+				t.Errorf("readaheadRange(%v, %v, %#x) = %v, want %v", tc.required, tc.optional, tc.maxReadahead, got, tc.want)
+			}
+		})
+	}
+}
@@ -64,6 +64,27 @@ func (fs *filesystem) revalidatePath(ctx context.Context, rpOrig resolvingPath,
 //   - fs.renameMu must be locked.
 //   - parent must have up to date metadata.
 func (fs *filesystem) revalidateOne(ctx context.Context, vfsObj *vfs.VirtualFilesystem, parent *dentry, name string, ds **[]*dentry) error {
+	return fs.revalidateChild(ctx, vfsObj, parent, name, false /* force */, ds)
+}
+
+// revalidateOpen is revalidateOne for the file being opened by OpenAt. Unless
+// relaxed consistency is in effect, the file is revalidated even if its cached
+// attributes are fresh.
+//
+// Preconditions:
+//   - fs.renameMu must be locked.
+//   - parent must have up to date metadata.
+func (fs *filesystem) revalidateOpen(ctx context.Context, vfsObj *vfs.VirtualFilesystem, parent *dentry, name string, ds **[]*dentry) error {
+	return fs.revalidateChild(ctx, vfsObj, parent, name, parent.revalidateOnOpen(), ds)
+}
+
+// revalidateChild implements revalidateOne and revalidateOpen. If force is
+// true, the child is revalidated even if its cached attributes are fresh.
+//
+// Preconditions:
+//   - fs.renameMu must be locked.
+//   - parent must have up to date metadata.
+func (fs *filesystem) revalidateChild(ctx context.Context, vfsObj *vfs.VirtualFilesystem, parent *dentry, name string, force bool, ds **[]*dentry) error {
 	// Skip revalidation for interop mode different than InteropModeShared or
 	// if the parent is synthetic (child must be synthetic too, but it cannot be
 	// replaced without first replacing the parent).
@@ -80,6 +101,7 @@ func (fs *filesystem) revalidateOne(ctx context.Context, vfsObj *vfs.VirtualFile
 
 	state := makeRevalidateState(parent, false /* refreshStart */)
 	defer state.release()
+	state.force = force
 	// Note that child can not be nil, because we don't cache negative entries
 	// when InteropModeShared is in effect.
 	state.add(child)
@@ -238,6 +260,7 @@ func (d *dentry) invalidate(ctx context.Context, vfsObj *vfs.VirtualFilesystem,
 	if child := parent.children[d.name]; child == d {
 		// Invalidate dentry so it gets reloaded next time it's accessed.
 		delete(parent.children, d.name)
+		d.fs.dcacheRemoveLocked(parent, d.name, d)
 	}
 }
 
@@ -270,6 +293,10 @@ type revalidateState struct {
 	// dentry is a child of start and each successive dentry is a child of the
 	// previous.
 	dentries []*dentry
+
+	// force indicates whether dentries should be revalidated even if their
+	// cached attributes are fresh.
+	force bool
 }
 
 func makeRevalidateState(start *dentry, refreshStart bool) *revalidateState {
@@ -301,4 +328,33 @@ func (r *revalidateState) reset(start *dentry, refreshStart bool) {
 	r.refreshStart = refreshStart
 	r.names = r.names[:0]
 	r.dentries = r.dentries[:0]
+	r.force = false
+}
+
+// fresh returns true if the cached attributes of all dentries in r are fresh,
+// such that revalidation can be skipped.
+func (r *revalidateState) fresh() bool {
+	if r.force || r.start.fs.opts.consistency.attrTTL == 0 {
+		return false
+	}
+	if r.refreshStart && !r.start.attrsFresh() {
+		return false
+	}
+	for _, d := range r.dentries {
+		if !d.attrsFresh() {
+			return false
+		}
+	}
+	return true
+}
+
+// markFresh marks the attributes of all dentries in r as fresh after a
+// successful revalidation.
+func (r *revalidateState) markFresh() {
+	if r.refreshStart {
+		r.start.markAttrsFresh()
+	}
+	for _, d := range r.dentries {
+		d.markAttrsFresh()
+	}
 }
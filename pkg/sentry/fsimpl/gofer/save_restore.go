@@ -60,6 +60,9 @@ func (fs *filesystem) PrepareSave(ctx context.Context) error {
 	}
 	fs.syncMu.Unlock()
 
+	// Background writeback isn't stopped with the kernel, so wait for it.
+	fs.waitBackgroundWriteback()
+
 	// Flush local state to the remote filesystem.
 	if err := fs.Sync(ctx); err != nil {
 		return err
@@ -132,6 +135,7 @@ func (d *dentry) afterLoad() {
 	d.readFD = atomicbitops.FromInt32(-1)
 	d.writeFD = atomicbitops.FromInt32(-1)
 	d.mmapFD = atomicbitops.FromInt32(-1)
+	d.hostFDEntry.d = d
 	if d.refs.Load() != -1 {
 		refs.Register(d)
 	}
@@ -183,6 +187,7 @@ func (fs *filesystem) CompleteRestore(ctx context.Context, opts vfs.CompleteRest
 	}
 	fs.opts.fd = fd
 	fs.inoByKey = make(map[inoKey]uint64)
+	fs.initHostFDCache()
 
 	if err := fs.restoreRoot(ctx, &opts); err != nil {
 		return err
@@ -40,6 +40,7 @@ func (d *dentry) readlink(ctx context.Context, mnt *vfs.Mount) (string, error) {
 		if err == nil {
 			d.haveTarget = true
 			d.target = target
+			d.fs.symlinkCache.Store(d, &target)
 		}
 		d.dataMu.Unlock() // +checklocksforce: guaranteed locked from above.
 	}
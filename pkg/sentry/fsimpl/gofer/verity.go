@@ -0,0 +1,455 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// verityReadChunk is the maximum number of bytes read and verified at once by
+// verityTree.readToBlocksAt.
+const verityReadChunk = 256 << 10
+
+// verityTree holds the fs-verity Merkle tree of a file, which is used to
+// verify data read from the host file before it is returned to the
+// application or cached. See
+// https://www.kernel.org/doc/html/latest/filesystems/fsverity.html.
+//
+// verityTree is immutable.
+type verityTree struct {
+	// alg is the hash algorithm, one of linux.FS_VERITY_HASH_ALG_*.
+	alg uint16
+
+	// digest is the fs-verity digest (measurement) of the file.
+	digest []byte
+
+	// blockSize is the Merkle tree block size, which is also the size of
+	// the data blocks that are hashed.
+	blockSize uint64
+
+	// salt is the salt prepended to each hashed block, padded to the block
+	// size of the hash algorithm. salt is empty if the file is unsalted.
+	salt []byte
+
+	// dataSize is the size of the file's data.
+	dataSize uint64
+
+	// leaves holds the hash of each data block, in order.
+	leaves []byte
+}
+
+// verityHash returns a constructor for hashes of the given fs-verity hash
+// algorithm, and the size of the hash algorithm's input blocks.
+func verityHash(alg uint16) (func() hash.Hash, int, bool) {
+	switch alg {
+	case linux.FS_VERITY_HASH_ALG_SHA256:
+		return sha256.New, sha256.BlockSize, true
+	case linux.FS_VERITY_HASH_ALG_SHA512:
+		return sha512.New, sha512.BlockSize, true
+	default:
+		return nil, 0, false
+	}
+}
+
+// hashBlock returns the salted hash of the given Merkle tree or data block.
+func (v *verityTree) hashBlock(block []byte) []byte {
+	newHash, _, _ := verityHash(v.alg)
+	h := newHash()
+	h.Write(v.salt)
+	h.Write(block)
+	return h.Sum(nil)
+}
+
+// loadVerityTree reads and checks the fs-verity metadata of the host file
+// fd. It returns nil if fs-verity is not enabled on the file.
+func loadVerityTree(fd int32) (*verityTree, error) {
+	alg, digest, err := hostMeasureVerity(fd)
+	if err != nil {
+		switch err {
+		case unix.ENODATA, unix.ENOTTY, unix.EOPNOTSUPP:
+			// fs-verity is not enabled on the file, or not supported by the
+			// host filesystem.
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	newHash, hashBlockSize, ok := verityHash(alg)
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash algorithm %d", alg)
+	}
+
+	// The digest of the file is the unsalted hash of its descriptor, which
+	// in turn contains the root hash of the Merkle tree.
+	var desc linux.FSVerityDescriptor
+	descBuf := make([]byte, desc.SizeBytes())
+	if n, err := hostReadVerityMetadata(fd, linux.FS_VERITY_METADATA_TYPE_DESCRIPTOR, 0, descBuf); err != nil {
+		return nil, err
+	} else if n != len(descBuf) {
+		return nil, fmt.Errorf("short descriptor: got %d bytes, want %d", n, len(descBuf))
+	}
+	desc.UnmarshalUnsafe(descBuf)
+	desc.SigSize = 0
+	desc.MarshalUnsafe(descBuf)
+	h := newHash()
+	h.Write(descBuf)
+	if !bytes.Equal(h.Sum(nil), digest) {
+		return nil, fmt.Errorf("descriptor does not match digest %x", digest)
+	}
+	if desc.Version != 1 || uint16(desc.HashAlgorithm) != alg || desc.LogBlockSize < 10 || desc.LogBlockSize > 16 || int(desc.SaltSize) > len(desc.Salt) {
+		return nil, fmt.Errorf("invalid descriptor %+v", desc)
+	}
+
+	v := &verityTree{
+		alg:       alg,
+		digest:    digest,
+		blockSize: 1 << desc.LogBlockSize,
+		dataSize:  desc.DataSize,
+	}
+	if desc.SaltSize != 0 {
+		v.salt = make([]byte, (int(desc.SaltSize)+hashBlockSize-1)/hashBlockSize*hashBlockSize)
+		copy(v.salt, desc.Salt[:desc.SaltSize])
+	}
+	digestSize := len(digest)
+	root := desc.RootHash[:digestSize]
+	if v.dataSize == 0 {
+		// The root hash of an empty file is all zeroes, and there is no
+		// data to verify.
+		return v, nil
+	}
+
+	// levels[i] is the number of blocks in level i of the tree, where level
+	// 0 holds the hashes of the data blocks. If the file has a single data
+	// block, the tree is empty and the root hash is that block's hash.
+	var levels []uint64
+	hashesPerBlock := v.blockSize / uint64(digestSize)
+	for n := (v.dataSize + v.blockSize - 1) / v.blockSize; n > 1; {
+		n = (n + hashesPerBlock - 1) / hashesPerBlock
+		levels = append(levels, n)
+	}
+	var treeSize uint64
+	for _, n := range levels {
+		treeSize += n * v.blockSize
+	}
+	tree := make([]byte, treeSize)
+	for off := 0; off < len(tree); {
+		n, err := hostReadVerityMetadata(fd, linux.FS_VERITY_METADATA_TYPE_MERKLE_TREE, uint64(off), tree[off:])
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("short Merkle tree: got %d bytes, want %d", off, len(tree))
+		}
+		off += n
+	}
+
+	// Levels are stored from the root down. Check each level against the
+	// one above it, starting from the root hash.
+	want := root
+	var off uint64
+	for i := len(levels) - 1; i >= 0; i-- {
+		level := tree[off : off+levels[i]*v.blockSize]
+		for b := uint64(0); b < levels[i]; b++ {
+			if !bytes.Equal(v.hashBlock(level[b*v.blockSize:(b+1)*v.blockSize]), want[b*uint64(digestSize):(b+1)*uint64(digestSize)]) {
+				return nil, fmt.Errorf("Merkle tree block %d of level %d does not match its hash", b, i)
+			}
+		}
+		want = level
+		off += uint64(len(level))
+	}
+	v.leaves = want
+	return v, nil
+}
+
+// readToBlocksAt reads from h into dsts at offset, and returns an error if
+// the data does not match the Merkle tree.
+func (v *verityTree) readToBlocksAt(ctx context.Context, h *handle, dsts safemem.BlockSeq, offset uint64) (uint64, error) {
+	if dsts.IsEmpty() {
+		return 0, nil
+	}
+	if offset >= v.dataSize {
+		return 0, io.EOF
+	}
+	var done uint64
+	for !dsts.IsEmpty() && offset < v.dataSize {
+		end := offset + min(dsts.NumBytes(), verityReadChunk)
+		if end > v.dataSize {
+			end = v.dataSize
+		}
+		// Read whole blocks, zero-padding the last block past the end of
+		// the data as the Merkle tree does.
+		start := offset &^ (v.blockSize - 1)
+		readEnd := min((end+v.blockSize-1)&^(v.blockSize-1), v.dataSize)
+		buf := make([]byte, (readEnd-start+v.blockSize-1)&^(v.blockSize-1))
+		var n uint64
+		for n < readEnd-start {
+			m, err := h.readToBlocksAt(ctx, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buf[n:readEnd-start])), start+n)
+			n += m
+			if err != nil && err != io.EOF {
+				return done, err
+			}
+			if n < readEnd-start && (err == io.EOF || m == 0) {
+				log.Warningf("gofer.verityTree.readToBlocksAt: file is shorter than its fs-verity data size %d", v.dataSize)
+				return done, linuxerr.EIO
+			}
+		}
+		for b := uint64(0); b < uint64(len(buf)); b += v.blockSize {
+			i := (start + b) / v.blockSize * uint64(len(v.digest))
+			if !bytes.Equal(v.hashBlock(buf[b:b+v.blockSize]), v.leaves[i:i+uint64(len(v.digest))]) {
+				log.Warningf("gofer.verityTree.readToBlocksAt: fs-verity verification failed for data block at offset %d", start+b)
+				return done, linuxerr.EIO
+			}
+		}
+		m, err := safemem.CopySeq(dsts, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buf[offset-start:end-start])))
+		done += m
+		offset += m
+		dsts = dsts.DropFirst64(m)
+		if err != nil {
+			return done, err
+		}
+	}
+	return done, nil
+}
+
+// readToBlocksAt reads from h, which is d's read handle, into dsts at offset.
+// If reads of d are verified, it fails if the data does not match the file's
+// Merkle tree.
+//
+// Preconditions: d.handleMu must be locked.
+func (d *dentry) readToBlocksAt(ctx context.Context, h *handle, dsts safemem.BlockSeq, offset uint64) (uint64, error) {
+	if v := d.verity.Load(); v != nil {
+		return v.readToBlocksAt(ctx, h, dsts, offset)
+	}
+	return h.readToBlocksAt(ctx, dsts, offset)
+}
+
+// readToBlocksAtFunc returns d.readToBlocksAt bound to h, for use with
+// fsutil.FileRangeSet.Fill.
+//
+// Preconditions: d.handleMu must be locked.
+func (d *dentry) readToBlocksAtFunc(h *handle) func(context.Context, safemem.BlockSeq, uint64) (uint64, error) {
+	if d.verity.Load() == nil {
+		return h.readToBlocksAt
+	}
+	return func(ctx context.Context, dsts safemem.BlockSeq, offset uint64) (uint64, error) {
+		return d.readToBlocksAt(ctx, h, dsts, offset)
+	}
+}
+
+// loadVerityLocked starts verifying reads of d if it is a regular file with
+// fs-verity enabled and fd is a host FD for it.
+//
+// Preconditions:
+//   - d.handleMu must be locked for writing.
+//   - d.fs.opts.verity is true.
+func (d *dentry) loadVerityLocked(ctx context.Context, fd int32) error {
+	if d.verity.Load() != nil || fd < 0 || !d.isRegularFile() {
+		return nil
+	}
+	v, err := loadVerityTree(fd)
+	if err != nil {
+		ctx.Warningf("gofer.dentry.loadVerityLocked: failed to load fs-verity metadata for %q: %v", genericDebugPathname(d), err)
+		return linuxerr.EIO
+	}
+	if v != nil {
+		d.verity.Store(v)
+	}
+	return nil
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (fd *regularFileFD) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		panic("Ioctl should be called from a task context")
+	}
+
+	d := fd.dentry()
+	if err := d.pinHandles(ctx); err != nil {
+		return 0, err
+	}
+	defer d.unpinHandles()
+
+	switch args[1].Uint() {
+	case linux.FS_IOC_ENABLE_VERITY:
+		return 0, fd.enableVerity(t, args[2].Pointer())
+	case linux.FS_IOC_MEASURE_VERITY:
+		return 0, fd.measureVerity(t, args[2].Pointer())
+	default:
+		return 0, linuxerr.ENOTTY
+	}
+}
+
+// enableVerity implements FS_IOC_ENABLE_VERITY by enabling fs-verity on the
+// host file. This is consistent with Linux's
+// fs/verity/enable.c:fsverity_ioctl_enable().
+func (fd *regularFileFD) enableVerity(t *kernel.Task, addr hostarch.Addr) error {
+	var arg linux.FSVerityEnableArg
+	if _, err := arg.CopyIn(t, addr); err != nil {
+		return err
+	}
+	if arg.Version != 1 || arg.Reserved1 != 0 || arg.Reserved2 != [11]uint64{} {
+		return linuxerr.EINVAL
+	}
+	if arg.BlockSize == 0 || arg.BlockSize&(arg.BlockSize-1) != 0 {
+		return linuxerr.EINVAL
+	}
+	if arg.SaltSize > 32 || arg.SigSize > linux.FS_VERITY_MAX_SIGNATURE_SIZE {
+		return linuxerr.EMSGSIZE
+	}
+	salt := make([]byte, arg.SaltSize)
+	if len(salt) != 0 {
+		if _, err := t.CopyInBytes(hostarch.Addr(arg.SaltPtr), salt); err != nil {
+			return err
+		}
+	}
+	sig := make([]byte, arg.SigSize)
+	if len(sig) != 0 {
+		if _, err := t.CopyInBytes(hostarch.Addr(arg.SigPtr), sig); err != nil {
+			return err
+		}
+	}
+
+	d := fd.dentry()
+	if err := d.checkPermissions(t.Credentials(), vfs.MayWrite); err != nil {
+		return err
+	}
+	if !fd.vfsfd.IsReadable() {
+		return linuxerr.EBADF
+	}
+	if err := fd.vfsfd.Mount().CheckBeginWrite(); err != nil {
+		return err
+	}
+	defer fd.vfsfd.Mount().EndWrite()
+	// The file must not be open for writing, including by this FD. Note that
+	// write handles held by the dentry are only released when the dentry is
+	// evicted, so the host may still fail with ETXTBSY after the file's
+	// writable FDs are closed.
+	if fd.vfsfd.IsWritable() {
+		return linuxerr.ETXTBSY
+	}
+
+	d.handleMu.RLock()
+	hostFD := d.readFD.RacyLoad()
+	if hostFD < 0 {
+		d.handleMu.RUnlock()
+		// Without a host FD, the remote filesystem can't enable fs-verity.
+		return linuxerr.EOPNOTSUPP
+	}
+	t.UninterruptibleSleepStart(false)
+	err := hostEnableVerity(hostFD, &arg, salt, sig)
+	t.UninterruptibleSleepFinish(false)
+	d.handleMu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if d.fs.opts.verity {
+		return d.startVerifying(t)
+	}
+	return nil
+}
+
+// startVerifying starts verifying reads of d after fs-verity was enabled on
+// it. Since reads and memory mappings may have used the host FD directly,
+// cached data is dropped and translations are invalidated.
+func (d *dentry) startVerifying(ctx context.Context) error {
+	d.handleMu.Lock()
+	if err := d.loadVerityLocked(ctx, d.readFD.RacyLoad()); err != nil {
+		d.handleMu.Unlock()
+		return err
+	}
+	if d.verity.Load() == nil {
+		d.handleMu.Unlock()
+		return nil
+	}
+	d.mmapFD.Store(-1)
+	mf := d.fs.mfp.MemoryFile()
+	d.dataMu.Lock()
+	if !d.cache.IsEmpty() {
+		mf.MarkAllUnevictable(d)
+		d.cache.DropAll(mf)
+		d.dirty.RemoveAll()
+		d.updateDirtyBytesLocked()
+	}
+	d.dataMu.Unlock()
+	d.handleMu.Unlock()
+
+	d.mapsMu.Lock()
+	d.mappings.InvalidateAll(memmap.InvalidateOpts{})
+	d.mapsMu.Unlock()
+	return nil
+}
+
+// measureVerity implements FS_IOC_MEASURE_VERITY. If reads of the file are
+// verified, the digest checked by the sentry is returned; otherwise, the
+// request is passed through to the host file.
+func (fd *regularFileFD) measureVerity(t *kernel.Task, addr hostarch.Addr) error {
+	var hdr linux.FSVerityDigest
+	if _, err := hdr.CopyIn(t, addr); err != nil {
+		return err
+	}
+
+	d := fd.dentry()
+	var (
+		alg    uint16
+		digest []byte
+	)
+	if v := d.verity.Load(); v != nil {
+		alg, digest = v.alg, v.digest
+	} else {
+		d.handleMu.RLock()
+		hostFD := d.readFD.RacyLoad()
+		if hostFD < 0 {
+			d.handleMu.RUnlock()
+			return linuxerr.EOPNOTSUPP
+		}
+		var err error
+		alg, digest, err = hostMeasureVerity(hostFD)
+		d.handleMu.RUnlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	if int(hdr.DigestSize) < len(digest) {
+		return linuxerr.EOVERFLOW
+	}
+	hdr.DigestAlgorithm = alg
+	hdr.DigestSize = uint16(len(digest))
+	if _, err := hdr.CopyOut(t, addr); err != nil {
+		return err
+	}
+	_, err := t.CopyOutBytes(addr+hostarch.Addr(hdr.SizeBytes()), digest)
+	return err
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/contexttest"
+)
+
+func TestVerityTreeRead(t *testing.T) {
+	const blockSize = 4096
+	data := make([]byte, 3*blockSize+100)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	f, err := os.CreateTemp(t.TempDir(), "verity")
+	if err != nil {
+		t.Fatalf("CreateTemp failed: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	v := &verityTree{
+		alg:       linux.FS_VERITY_HASH_ALG_SHA256,
+		digest:    make([]byte, 32),
+		blockSize: blockSize,
+		salt:      make([]byte, 64),
+		dataSize:  uint64(len(data)),
+	}
+	copy(v.salt, "salt")
+	for off := 0; off < len(data); off += blockSize {
+		block := make([]byte, blockSize)
+		copy(block, data[off:])
+		v.leaves = append(v.leaves, v.hashBlock(block)...)
+	}
+
+	ctx := contexttest.Context(t)
+	h := handle{fd: int32(f.Fd())}
+	read := func(off, size uint64) ([]byte, error) {
+		buf := make([]byte, size)
+		n, err := v.readToBlocksAt(ctx, &h, safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buf)), off)
+		return buf[:n], err
+	}
+
+	for _, tc := range []struct {
+		off, size uint64
+	}{
+		{0, uint64(len(data))},
+		{1, 10},
+		{blockSize - 1, 2},
+		{2*blockSize + 50, blockSize + 50},
+		{uint64(len(data)) - 1, 100},
+	} {
+		got, err := read(tc.off, tc.size)
+		if err != nil {
+			t.Errorf("read(%d, %d) failed: %v", tc.off, tc.size, err)
+			continue
+		}
+		want := data[tc.off:min(tc.off+tc.size, uint64(len(data)))]
+		if !bytes.Equal(got, want) {
+			t.Errorf("read(%d, %d) returned wrong data", tc.off, tc.size)
+		}
+	}
+
+	// Modify the second block, which must then fail verification while the
+	// other blocks still do not.
+	if _, err := f.WriteAt([]byte{data[blockSize+10] + 1}, blockSize+10); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	if _, err := read(blockSize+20, 10); !linuxerr.Equals(linuxerr.EIO, err) {
+		t.Errorf("read of modified block: got error %v, want EIO", err)
+	}
+	if got, err := read(0, blockSize); err != nil || !bytes.Equal(got, data[:blockSize]) {
+		t.Errorf("read of unmodified block: got error %v, want nil and original data", err)
+	}
+
+	// Truncating the file must also fail verification.
+	if err := f.Truncate(2*blockSize + 10); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	if _, err := read(2*blockSize, 100); !linuxerr.Equals(linuxerr.EIO, err) {
+		t.Errorf("read of truncated block: got error %v, want EIO", err)
+	}
+}
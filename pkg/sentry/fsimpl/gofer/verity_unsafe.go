@@ -0,0 +1,80 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+)
+
+// hostEnableVerity enables fs-verity on the host file fd. salt and sig are
+// the buffers described by arg.
+func hostEnableVerity(fd int32, arg *linux.FSVerityEnableArg, salt, sig []byte) error {
+	a := *arg
+	a.SaltPtr = 0
+	if len(salt) != 0 {
+		a.SaltPtr = uint64(uintptr(unsafe.Pointer(&salt[0])))
+	}
+	a.SigPtr = 0
+	if len(sig) != 0 {
+		a.SigPtr = uint64(uintptr(unsafe.Pointer(&sig[0])))
+	}
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), linux.FS_IOC_ENABLE_VERITY, uintptr(unsafe.Pointer(&a)))
+	runtime.KeepAlive(salt)
+	runtime.KeepAlive(sig)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// hostMeasureVerity returns the hash algorithm and fs-verity digest of the
+// host file fd.
+func hostMeasureVerity(fd int32) (uint16, []byte, error) {
+	var buf struct {
+		hdr    linux.FSVerityDigest
+		digest [linux.FS_VERITY_MAX_DIGEST_SIZE]byte
+	}
+	buf.hdr.DigestSize = linux.FS_VERITY_MAX_DIGEST_SIZE
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), linux.FS_IOC_MEASURE_VERITY, uintptr(unsafe.Pointer(&buf))); errno != 0 {
+		return 0, nil, errno
+	}
+	size := min(int(buf.hdr.DigestSize), len(buf.digest))
+	return buf.hdr.DigestAlgorithm, append([]byte(nil), buf.digest[:size]...), nil
+}
+
+// hostReadVerityMetadata reads fs-verity metadata of the given type from the
+// host file fd, starting at offset, into dst. It returns the number of bytes
+// read, which is 0 at the end of the metadata.
+func hostReadVerityMetadata(fd int32, metadataType, offset uint64, dst []byte) (int, error) {
+	if len(dst) == 0 {
+		return 0, nil
+	}
+	arg := linux.FSVerityReadMetadataArg{
+		MetadataType: metadataType,
+		Offset:       offset,
+		Length:       uint64(len(dst)),
+		BufPtr:       uint64(uintptr(unsafe.Pointer(&dst[0]))),
+	}
+	n, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), linux.FS_IOC_READ_VERITY_METADATA, uintptr(unsafe.Pointer(&arg)))
+	runtime.KeepAlive(dst)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(n), nil
+}
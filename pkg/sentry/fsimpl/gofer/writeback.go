@@ -0,0 +1,327 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"math"
+	"strconv"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/fsutil"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
+)
+
+// dirtyOpts holds limits on the amount of dirty cached file data in a
+// filesystem, mirroring Linux's vm.dirty_* sysctls:
+//
+//   - Once the filesystem holds more than the background threshold of dirty
+//     data, a background writeback goroutine starts writing it back to the
+//     remote filesystem, until the amount of dirty data drops below the
+//     background threshold.
+//
+//   - Writers that dirty data while the filesystem holds more than the dirty
+//     threshold of dirty data are throttled: they write back the file they
+//     wrote to, and then wait for background writeback if the filesystem is
+//     still over the threshold.
+//
+// Each threshold can be set either as a percentage of total memory or as a
+// number of bytes, but not both. Zero values are unset. If no limit is set,
+// dirty data is only written back when required (e.g. by fsync(2), or when
+// cached pages are evicted).
+//
+// +stateify savable
+type dirtyOpts struct {
+	ratio           uint64
+	backgroundRatio uint64
+	bytes           uint64
+	backgroundBytes uint64
+}
+
+// parseDirtyOpts parses and removes dirty data limits from mopts.
+func parseDirtyOpts(ctx context.Context, mopts map[string]string) (dirtyOpts, error) {
+	var opts dirtyOpts
+	for _, o := range []struct {
+		name string
+		max  uint64
+		val  *uint64
+	}{
+		{moptDirtyRatio, 100, &opts.ratio},
+		{moptDirtyBackgroundRatio, 100, &opts.backgroundRatio},
+		{moptDirtyBytes, math.MaxInt64, &opts.bytes},
+		{moptDirtyBackgroundBytes, math.MaxInt64, &opts.backgroundBytes},
+	} {
+		str, ok := mopts[o.name]
+		if !ok {
+			continue
+		}
+		delete(mopts, o.name)
+		val, err := strconv.ParseUint(str, 10, 64)
+		if err != nil || val > o.max {
+			ctx.Warningf("gofer.FilesystemType.GetFilesystem: invalid %s: %s=%s", o.name, o.name, str)
+			return dirtyOpts{}, linuxerr.EINVAL
+		}
+		*o.val = val
+	}
+	if opts.ratio != 0 && opts.bytes != 0 {
+		ctx.Warningf("gofer.FilesystemType.GetFilesystem: %s and %s are mutually exclusive", moptDirtyRatio, moptDirtyBytes)
+		return dirtyOpts{}, linuxerr.EINVAL
+	}
+	if opts.backgroundRatio != 0 && opts.backgroundBytes != 0 {
+		ctx.Warningf("gofer.FilesystemType.GetFilesystem: %s and %s are mutually exclusive", moptDirtyBackgroundRatio, moptDirtyBackgroundBytes)
+		return dirtyOpts{}, linuxerr.EINVAL
+	}
+	return opts, nil
+}
+
+// enabled returns true if any limit is set.
+func (o *dirtyOpts) enabled() bool {
+	return *o != dirtyOpts{}
+}
+
+// thresholds returns the background writeback and throttling thresholds in
+// bytes, given the total memory size. Compare Linux's
+// mm/page-writeback.c:domain_dirty_limits().
+//
+// Preconditions: o.enabled().
+func (o *dirtyOpts) thresholds(totalMem uint64) (background, limit uint64) {
+	switch {
+	case o.bytes != 0:
+		limit = o.bytes
+	case o.ratio != 0:
+		limit = totalMem / 100 * o.ratio
+	default:
+		limit = math.MaxUint64
+	}
+	switch {
+	case o.backgroundBytes != 0:
+		background = o.backgroundBytes
+	case o.backgroundRatio != 0:
+		background = totalMem / 100 * o.backgroundRatio
+	default:
+		background = limit / 2
+	}
+	if background >= limit {
+		background = limit / 2
+	}
+	return background, limit
+}
+
+// dirtyThresholds returns fs' background writeback and throttling thresholds
+// in bytes.
+//
+// Preconditions: fs.opts.dirty.enabled().
+func (fs *filesystem) dirtyThresholds() (background, limit uint64) {
+	return fs.opts.dirty.thresholds(usage.TotalMemory(fs.mfp.MemoryFile().TotalSize(), 0))
+}
+
+// balanceDirty is called after d's cached data has been dirtied by a write. It
+// starts background writeback if fs is above its background threshold, and
+// throttles the caller if fs is above its dirty threshold. Compare Linux's
+// mm/page-writeback.c:balance_dirty_pages().
+//
+// Preconditions: The caller must not hold any memmap.Mappable locks, or
+// memmap.MappingSpace locks, since writeback may invalidate memory mappings.
+func (fs *filesystem) balanceDirty(ctx context.Context, d *dentry) {
+	if !fs.opts.dirty.enabled() {
+		return
+	}
+	background, limit := fs.dirtyThresholds()
+	if fs.dirtyBytes.Load() <= background {
+		return
+	}
+	done := fs.startBackgroundWriteback()
+	if fs.dirtyBytes.Load() <= limit {
+		return
+	}
+	// Make the writer pay for writing back its own file first, then wait for
+	// background writeback to bring fs back below the background threshold if
+	// other files are responsible for the remaining dirty data.
+	if err := d.writebackDirty(ctx); err != nil {
+		log.Warningf("gofer.filesystem.balanceDirty: failed to write back dirty data: %v", err)
+		return
+	}
+	if fs.dirtyBytes.Load() > limit {
+		ctx.UninterruptibleSleepStart(false)
+		<-done
+		ctx.UninterruptibleSleepFinish(false)
+	}
+}
+
+// maybeStartBackgroundWriteback starts background writeback if fs is above its
+// background threshold.
+func (fs *filesystem) maybeStartBackgroundWriteback() {
+	if !fs.opts.dirty.enabled() {
+		return
+	}
+	if background, _ := fs.dirtyThresholds(); fs.dirtyBytes.Load() > background {
+		fs.startBackgroundWriteback()
+	}
+}
+
+// startBackgroundWriteback starts background writeback of fs' dirty data if it
+// is not already in progress. It returns a channel that is closed when
+// background writeback stops.
+func (fs *filesystem) startBackgroundWriteback() <-chan struct{} {
+	fs.writebackMu.Lock()
+	defer fs.writebackMu.Unlock()
+	if fs.writebackDone == nil {
+		fs.writebackDone = make(chan struct{})
+		go fs.backgroundWriteback(fs.writebackDone) // S/R-SAFE: waited for by PrepareSave.
+	}
+	return fs.writebackDone
+}
+
+// waitBackgroundWriteback waits for background writeback, if any, to stop.
+func (fs *filesystem) waitBackgroundWriteback() {
+	fs.writebackMu.Lock()
+	done := fs.writebackDone
+	fs.writebackMu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// backgroundWriteback writes back dirty data in fs until fs is below its
+// background threshold, then closes done.
+func (fs *filesystem) backgroundWriteback(done chan struct{}) {
+	ctx := context.Background()
+	for fs.released.Load() == 0 {
+		background, _ := fs.dirtyThresholds()
+		before := fs.dirtyBytes.Load()
+		if before <= background {
+			break
+		}
+		fs.writebackDirty(ctx, background)
+		if fs.dirtyBytes.Load() >= before {
+			// No progress was made, e.g. because writeback is failing; give up
+			// until the next writer starts background writeback again.
+			break
+		}
+	}
+	fs.writebackMu.Lock()
+	fs.writebackDone = nil
+	fs.writebackMu.Unlock()
+	close(done)
+}
+
+// writebackDirty writes back dirty files in fs until fs has at most target
+// bytes of dirty data.
+func (fs *filesystem) writebackDirty(ctx context.Context, target uint64) {
+	// Snapshot dirty dentries, as in filesystem.Sync.
+	fs.syncMu.Lock()
+	var ds []*dentry
+	for elem := fs.syncableDentries.Front(); elem != nil; elem = elem.Next() {
+		if elem.d.dirtyBytes.Load() != 0 {
+			ds = append(ds, elem.d)
+		}
+	}
+	fs.syncMu.Unlock()
+
+	for _, d := range ds {
+		if fs.dirtyBytes.Load() <= target || fs.released.Load() != 0 {
+			return
+		}
+		if err := d.writebackDirty(ctx); err != nil {
+			log.Warningf("gofer.filesystem.writebackDirty: failed to write back dirty data: %v", err)
+		}
+	}
+}
+
+// writebackDirty writes back all of d's dirty cached data to the remote file.
+// Unlike fsutil.SyncDirtyAll, data that is kept dirty by writable memory
+// mappings is also marked clean, after invalidating writable translations so
+// that subsequent writes through the mappings mark it dirty again. Compare
+// Linux's mm/page-writeback.c:folio_clear_dirty_for_io() =>
+// folio_mkclean().
+func (d *dentry) writebackDirty(ctx context.Context) error {
+	d.mapsMu.Lock()
+	defer d.mapsMu.Unlock()
+
+	// Collect ranges that are kept dirty by writable translations.
+	// d.mappings.Invalidate() can't be called with d.dataMu locked, since
+	// memmap.MappingSpace.Invalidate() locks are ordered before
+	// memmap.Mappable.Translate() locks. This allows Translate to return new
+	// writable translations concurrently, which d.writableTranslations detects.
+	d.dataMu.RLock()
+	var keep []memmap.MappableRange
+	for seg := d.dirty.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		if seg.Value().Keep {
+			keep = append(keep, seg.Range())
+		}
+	}
+	gen := d.writableTranslations
+	d.dataMu.RUnlock()
+	for _, mr := range keep {
+		d.mappings.Invalidate(mr, memmap.InvalidateOpts{})
+	}
+
+	d.handleMu.RLock()
+	defer d.handleMu.RUnlock()
+	if !d.isWriteHandleOk() {
+		return nil
+	}
+	h := d.writeHandle()
+	d.dataMu.Lock()
+	defer d.dataMu.Unlock()
+	defer d.updateDirtyBytesLocked()
+	if err := fsutil.SyncDirtyAll(ctx, &d.cache, &d.dirty, d.size.Load(), d.fs.mfp.MemoryFile(), h.writeFromBlocksAt); err != nil {
+		return err
+	}
+	if d.writableTranslations == gen {
+		// No writable translations have been returned since the ranges were
+		// collected, so they can no longer be dirtied concurrently.
+		for _, mr := range keep {
+			d.dirty.KeepClean(mr)
+		}
+	}
+	return nil
+}
+
+// markDirtyLocked marks mr as dirty in d.dirty, and kept dirty if keep is
+// true, accounting for newly dirty bytes.
+//
+// Preconditions: d.dataMu must be locked for writing.
+func (d *dentry) markDirtyLocked(mr memmap.MappableRange, keep bool) {
+	clean := mr.Length() - d.dirty.SpanRange(mr)
+	if keep {
+		d.dirty.KeepDirty(mr)
+	} else {
+		d.dirty.MarkDirty(mr)
+	}
+	if clean != 0 {
+		d.setDirtyBytesLocked(d.dirtyBytes.RacyLoad() + clean)
+	}
+}
+
+// updateDirtyBytesLocked updates dirty data accounting after offsets in
+// d.dirty may have been marked clean.
+//
+// Preconditions: d.dataMu must be locked for writing.
+func (d *dentry) updateDirtyBytesLocked() {
+	d.setDirtyBytesLocked(d.dirty.Span())
+}
+
+// Preconditions: d.dataMu must be locked for writing.
+func (d *dentry) setDirtyBytesLocked(n uint64) {
+	old := d.dirtyBytes.RacyLoad()
+	if n == old {
+		return
+	}
+	d.dirtyBytes.Store(n)
+	d.fs.dirtyBytes.Add(n - old)
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"math"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/sentry/contexttest"
+)
+
+func TestParseDirtyOpts(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		mopts   map[string]string
+		want    dirtyOpts
+		wantErr bool
+	}{
+		{
+			name:  "none",
+			mopts: map[string]string{},
+		},
+		{
+			name:  "ratios",
+			mopts: map[string]string{moptDirtyRatio: "20", moptDirtyBackgroundRatio: "10"},
+			want:  dirtyOpts{ratio: 20, backgroundRatio: 10},
+		},
+		{
+			name:  "bytes",
+			mopts: map[string]string{moptDirtyBytes: "1048576", moptDirtyBackgroundRatio: "5"},
+			want:  dirtyOpts{bytes: 1 << 20, backgroundRatio: 5},
+		},
+		{
+			name:    "ratio too large",
+			mopts:   map[string]string{moptDirtyRatio: "101"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid number",
+			mopts:   map[string]string{moptDirtyBackgroundBytes: "-1"},
+			wantErr: true,
+		},
+		{
+			name:    "ratio and bytes",
+			mopts:   map[string]string{moptDirtyRatio: "20", moptDirtyBytes: "4096"},
+			wantErr: true,
+		},
+		{
+			name:    "background ratio and bytes",
+			mopts:   map[string]string{moptDirtyBackgroundRatio: "10", moptDirtyBackgroundBytes: "4096"},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := contexttest.Context(t)
+			got, err := parseDirtyOpts(ctx, tc.mopts)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("parseDirtyOpts(%v) succeeded, want error", tc.mopts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDirtyOpts(%v) failed: %v", tc.mopts, err)
+			}
+			if got != tc.want {
+				t.Errorf("parseDirtyOpts(%v) = %+v, want %+v", tc.mopts, got, tc.want)
+			}
+			if len(tc.mopts) != 0 {
+				t.Errorf("parseDirtyOpts left unparsed options: %v", tc.mopts)
+			}
+		})
+	}
+}
+
+func TestDirtyThresholds(t *testing.T) {
+	const totalMem = 1000 << 20
+	for _, tc := range []struct {
+		name           string
+		opts           dirtyOpts
+		wantBackground uint64
+		wantLimit      uint64
+	}{
+		{
+			name:           "ratios",
+			opts:           dirtyOpts{ratio: 20, backgroundRatio: 10},
+			wantBackground: 100 << 20,
+			wantLimit:      200 << 20,
+		},
+		{
+			name:           "bytes",
+			opts:           dirtyOpts{bytes: 64 << 20, backgroundBytes: 16 << 20},
+			wantBackground: 16 << 20,
+			wantLimit:      64 << 20,
+		},
+		{
+			name:           "default background",
+			opts:           dirtyOpts{bytes: 64 << 20},
+			wantBackground: 32 << 20,
+			wantLimit:      64 << 20,
+		},
+		{
+			name:           "background above limit",
+			opts:           dirtyOpts{ratio: 10, backgroundRatio: 50},
+			wantBackground: 50 << 20,
+			wantLimit:      100 << 20,
+		},
+		{
+			name:           "background only",
+			opts:           dirtyOpts{backgroundBytes: 16 << 20},
+			wantBackground: 16 << 20,
+			wantLimit:      math.MaxUint64,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			background, limit := tc.opts.thresholds(totalMem)
+			if background != tc.wantBackground || limit != tc.wantLimit {
+				t.Errorf("thresholds(%d) = (%d, %d), want (%d, %d)", uint64(totalMem), background, limit, tc.wantBackground, tc.wantLimit)
+			}
+		})
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"gvisor.dev/gvisor/pkg/fspath"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/safemem"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
 	"gvisor.dev/gvisor/pkg/sentry/hostfd"
@@ -824,12 +825,36 @@ func (i *inode) readFromBuf(ctx context.Context, dst *usermem.IOSequence) (int64
 }
 
 func readFromHostFD(ctx context.Context, hostFD int, dst usermem.IOSequence, offset int64, flags uint32) (int64, error) {
+	if k := kernel.KernelFromContext(ctx); k != nil && k.Deterministic() {
+		return readFromHostFDDeterministic(ctx, k, hostFD, dst, offset, flags)
+	}
 	reader := hostfd.GetReadWriterAt(int32(hostFD), offset, flags)
 	n, err := dst.CopyOutFrom(ctx, reader)
 	hostfd.PutReadWriterAt(reader)
 	return int64(n), err
 }
 
+// maxDeterministicRead is the maximum number of bytes read from a host file
+// at once in deterministic mode, which buffers reads to record them.
+const maxDeterministicRead = 1 << 20
+
+// readFromHostFDDeterministic is readFromHostFD in deterministic mode, where
+// the data read from the host is an external input.
+func readFromHostFDDeterministic(ctx context.Context, k *kernel.Kernel, hostFD int, dst usermem.IOSequence, offset int64, flags uint32) (int64, error) {
+	in := k.DeterministicRead("host fd", func() kernel.ExternalInput {
+		buf := make([]byte, min(dst.NumBytes(), maxDeterministicRead))
+		reader := hostfd.GetReadWriterAt(int32(hostFD), offset, flags)
+		n, err := reader.ReadToBlocks(safemem.BlockSeqOf(safemem.BlockFromSafeSlice(buf)))
+		hostfd.PutReadWriterAt(reader)
+		return kernel.NewExternalInput(buf[:n], err)
+	})
+	n, err := dst.CopyOut(ctx, in.Data)
+	if err != nil {
+		return int64(n), err
+	}
+	return int64(n), in.Err()
+}
+
 // PWrite implements vfs.FileDescriptionImpl.PWrite.
 func (f *fileDescription) PWrite(ctx context.Context, src usermem.IOSequence, offset int64, opts vfs.WriteOptions) (int64, error) {
 	if !f.inode.seekable {
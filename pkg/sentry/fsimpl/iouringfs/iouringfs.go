@@ -197,6 +197,7 @@ func New(ctx context.Context, vfsObj *vfs.VirtualFilesystem, entries uint32, par
 	iouringfd.ioRings.CqRingEntries = params.CqEntries
 
 	// Write IORings out to shared buffer.
+	iouringfd.prepareWrite()
 	view, err := iouringfd.ioRingsBuf.view(iouringfd.ioRings.SizeBytes())
 	if err != nil {
 		return nil, err
@@ -221,12 +222,13 @@ func (fd *FileDescription) Release(ctx context.Context) {
 }
 
 // mapSharedBuffers caches internal mappings for the ring's shared memory
-// regions.
+// regions. Writes through the mappings must be preceded by a call to
+// fd.prepareWrite.
 func (fd *FileDescription) mapSharedBuffers() error {
 	mf := fd.mfp.MemoryFile()
 
 	// Mapping for the IORings header struct.
-	rb, err := mf.MapInternal(fd.rbmf.fr, hostarch.ReadWrite)
+	rb, err := mf.MapInternalUntracked(fd.rbmf.fr, hostarch.ReadWrite)
 	if err != nil {
 		return err
 	}
@@ -241,8 +243,8 @@ func (fd *FileDescription) mapSharedBuffers() error {
 	cqes := rb.DropFirst(int(cqesOffset))
 	fd.cqesBuf.init(cqes)
 
-	// Mapping for the SQEs array.
-	sqes, err := mf.MapInternal(fd.sqemf.fr, hostarch.ReadWrite)
+	// Mapping for the SQEs array, which is only read by the sentry.
+	sqes, err := mf.MapInternal(fd.sqemf.fr, hostarch.Read)
 	if err != nil {
 		return err
 	}
@@ -252,6 +254,14 @@ func (fd *FileDescription) mapSharedBuffers() error {
 
 }
 
+// prepareWrite must be called before the ring header or CQEs array are
+// written through the mappings cached by mapSharedBuffers, so that writes are
+// not missed by an asynchronous save of the MemoryFile in progress. See
+// pgalloc.MemoryFile.PrepareWrite.
+func (fd *FileDescription) prepareWrite() {
+	fd.mfp.MemoryFile().PrepareWrite(fd.rbmf.fr)
+}
+
 // ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap.
 func (fd *FileDescription) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
 	var mf memmap.Mappable
@@ -406,6 +416,9 @@ func (fd *FileDescription) ProcessSubmissions(t *kernel.Task, toSubmit uint32, m
 		// Dispatch request from unmarshalled entry.
 		cqe := fd.ProcessSubmission(t, &sqe, flags)
 
+		// ProcessSubmission may block, during which a save may have started.
+		fd.prepareWrite()
+
 		// Advance sq head.
 		sqHeadPtr.Add(1)
 
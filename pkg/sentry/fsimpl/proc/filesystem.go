@@ -18,6 +18,7 @@ package proc
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -147,9 +148,69 @@ func newStaticFile(data string) *staticFile {
 }
 
 func (fs *filesystem) newStaticDir(ctx context.Context, creds *auth.Credentials, children map[string]kernfs.Inode) kernfs.Inode {
-	return kernfs.NewStaticDir(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), 0555, children, kernfs.GenericDirectoryFDOptions{
+	inode := &staticDir{}
+	inode.Init(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), 0555, kernfs.GenericDirectoryFDOptions{
 		SeekEnd: kernfs.SeekEndZero,
 	})
+	inode.InitRefs()
+
+	inode.OrderedChildren.Init(kernfs.OrderedChildrenOptions{})
+	links := inode.OrderedChildren.Populate(children)
+	inode.IncLinks(links)
+	for name, child := range children {
+		if d, ok := child.(*staticDir); ok {
+			d.parent = inode
+			d.name = name
+		}
+	}
+	return inode
+}
+
+// staticDir is a static directory that reports lookups of missing entries,
+// e.g. sysctls that are not implemented, in the kernel's compatibility
+// report.
+//
+// +stateify savable
+type staticDir struct {
+	kernfs.StaticDirectory
+
+	// parent is the parent directory, or nil if this is a top-level
+	// directory of /proc. Immutable.
+	parent *staticDir
+
+	// name is the name of the directory in its parent. Immutable.
+	name string
+}
+
+// Lookup implements kernfs.Inode.Lookup.
+func (d *staticDir) Lookup(ctx context.Context, name string) (kernfs.Inode, error) {
+	inode, err := d.StaticDirectory.Lookup(ctx, name)
+	if linuxerr.Equals(linuxerr.ENOENT, err) {
+		recordMissing(ctx, d.path()+"/"+name)
+	}
+	return inode, err
+}
+
+// path returns the absolute path of d in procfs.
+func (d *staticDir) path() string {
+	if d.parent == nil {
+		return "/proc/" + d.name
+	}
+	return d.parent.path() + "/" + d.name
+}
+
+// recordMissing reports the lookup of a procfs path that does not exist in
+// the kernel's compatibility report.
+func recordMissing(ctx context.Context, path string) {
+	k := kernel.KernelFromContext(ctx)
+	if k == nil {
+		return
+	}
+	kind := kernel.CompatProcfs
+	if strings.HasPrefix(path, "/proc/sys/") {
+		kind = kernel.CompatSysctl
+	}
+	k.RecordUnsupported(ctx, kind, path)
 }
 
 // InternalData contains internal data passed in to the procfs mount via
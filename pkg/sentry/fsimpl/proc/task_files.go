@@ -557,6 +557,217 @@ func (fd *memFD) SetStat(context.Context, vfs.SetStatOptions) error {
 // Release implements vfs.FileDescriptionImpl.Release.
 func (fd *memFD) Release(context.Context) {}
 
+var _ kernfs.Inode = (*pagemapInode)(nil)
+
+// pagemapInode implements kernfs.Inode for /proc/[pid]/pagemap.
+//
+// +stateify savable
+type pagemapInode struct {
+	kernfs.InodeAttrs
+	kernfs.InodeNoStatFS
+	kernfs.InodeNoopRefCount
+	kernfs.InodeNotAnonymous
+	kernfs.InodeNotDirectory
+	kernfs.InodeNotSymlink
+	kernfs.InodeWatches
+
+	task  *kernel.Task
+	locks vfs.FileLocks
+}
+
+func (fs *filesystem) newPagemapInode(ctx context.Context, task *kernel.Task, ino uint64, perm linux.FileMode) kernfs.Inode {
+	// Note: credentials are overridden by taskOwnedInode.
+	inode := &pagemapInode{task: task}
+	inode.InodeAttrs.Init(ctx, task.Credentials(), linux.UNNAMED_MAJOR, fs.devMinor, ino, linux.ModeRegular|perm)
+	return &taskOwnedInode{Inode: inode, owner: task}
+}
+
+// Open implements kernfs.Inode.Open.
+func (f *pagemapInode) Open(ctx context.Context, rp *vfs.ResolvingPath, d *kernfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	// Permission to read this file is governed by PTRACE_MODE_READ_FSCREDS.
+	if !kernel.ContextCanTrace(ctx, f.task, false) {
+		return nil, linuxerr.EACCES
+	}
+	if err := checkTaskState(f.task); err != nil {
+		return nil, err
+	}
+	// As in Linux, page frame numbers are only visible to openers with
+	// CAP_SYS_ADMIN in the root user namespace.
+	creds := auth.CredentialsFromContext(ctx)
+	fd := &pagemapFD{
+		inode:   f,
+		showPFN: creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, creds.UserNamespace.Root()),
+	}
+	fd.LockFD.Init(&f.locks)
+	if err := fd.vfsfd.Init(fd, opts.Flags, rp.Mount(), d.VFSDentry(), &vfs.FileDescriptionOptions{}); err != nil {
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// SetStat implements kernfs.Inode.SetStat.
+func (*pagemapInode) SetStat(context.Context, *vfs.Filesystem, *auth.Credentials, vfs.SetStatOptions) error {
+	return linuxerr.EPERM
+}
+
+var _ vfs.FileDescriptionImpl = (*pagemapFD)(nil)
+
+// pagemapFD implements vfs.FileDescriptionImpl for /proc/[pid]/pagemap. The
+// file contains one 64-bit entry per virtual page; see
+// Documentation/admin-guide/mm/pagemap.rst.
+//
+// +stateify savable
+type pagemapFD struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.LockFD
+
+	inode   *pagemapInode
+	showPFN bool
+
+	// mu guards the fields below.
+	mu     sync.Mutex `state:"nosave"`
+	offset int64
+}
+
+// pagemapEntrySize is the size of a /proc/[pid]/pagemap entry in bytes.
+const pagemapEntrySize = 8
+
+// Seek implements vfs.FileDescriptionImpl.Seek.
+func (fd *pagemapFD) Seek(ctx context.Context, offset int64, whence int32) (int64, error) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	switch whence {
+	case linux.SEEK_SET:
+	case linux.SEEK_CUR:
+		offset += fd.offset
+	default:
+		return 0, linuxerr.EINVAL
+	}
+	if offset < 0 {
+		return 0, linuxerr.EINVAL
+	}
+	fd.offset = offset
+	return offset, nil
+}
+
+// PRead implements vfs.FileDescriptionImpl.PRead.
+func (fd *pagemapFD) PRead(ctx context.Context, dst usermem.IOSequence, offset int64, opts vfs.ReadOptions) (int64, error) {
+	if offset%pagemapEntrySize != 0 || dst.NumBytes()%pagemapEntrySize != 0 {
+		return 0, linuxerr.EINVAL
+	}
+	if dst.NumBytes() == 0 {
+		return 0, nil
+	}
+	m, err := getMMIncRef(fd.inode.task)
+	if err != nil {
+		return 0, nil
+	}
+	defer m.DecUsers(ctx)
+
+	// Read in chunks of a page to bound memory usage.
+	var (
+		entries [hostarch.PageSize / pagemapEntrySize]uint64
+		buf     [hostarch.PageSize]byte
+		total   int64
+	)
+	for dst.NumBytes() > 0 {
+		want := len(entries)
+		if n := dst.NumBytes() / pagemapEntrySize; n < int64(want) {
+			want = int(n)
+		}
+		start := hostarch.Addr(uint64(offset) / pagemapEntrySize * hostarch.PageSize)
+		n := m.ReadPagemap(start, entries[:want], fd.showPFN)
+		if n == 0 {
+			break
+		}
+		for i, e := range entries[:n] {
+			hostarch.ByteOrder.PutUint64(buf[i*pagemapEntrySize:], e)
+		}
+		copied, err := dst.CopyOut(ctx, buf[:n*pagemapEntrySize])
+		total += int64(copied)
+		if err != nil {
+			return total, err
+		}
+		dst = dst.DropFirst(copied)
+		offset += int64(copied)
+		if n < want {
+			break
+		}
+	}
+	return total, nil
+}
+
+// Read implements vfs.FileDescriptionImpl.Read.
+func (fd *pagemapFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
+	fd.mu.Lock()
+	n, err := fd.PRead(ctx, dst, fd.offset, opts)
+	fd.offset += n
+	fd.mu.Unlock()
+	return n, err
+}
+
+// Stat implements vfs.FileDescriptionImpl.Stat.
+func (fd *pagemapFD) Stat(ctx context.Context, opts vfs.StatOptions) (linux.Statx, error) {
+	fs := fd.vfsfd.VirtualDentry().Mount().Filesystem()
+	return fd.inode.Stat(ctx, fs, opts)
+}
+
+// SetStat implements vfs.FileDescriptionImpl.SetStat.
+func (fd *pagemapFD) SetStat(context.Context, vfs.SetStatOptions) error {
+	return linuxerr.EPERM
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *pagemapFD) Release(context.Context) {}
+
+// clearRefsData implements vfs.WritableDynamicBytesSource for
+// /proc/[pid]/clear_refs.
+//
+// +stateify savable
+type clearRefsData struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+}
+
+var _ vfs.WritableDynamicBytesSource = (*clearRefsData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *clearRefsData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	// clear_refs is write-only in Linux.
+	return linuxerr.EINVAL
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *clearRefsData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit input size so as not to impact performance if input size is large.
+	src = src.TakeFirst(hostarch.PageSize - 1)
+
+	str, err := usermem.CopyStringIn(ctx, src.IO, src.Addrs.Head().Start, int(src.Addrs.Head().Length()), src.Opts)
+	if err != nil && err != linuxerr.ENAMETOOLONG {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(str), 10, 32)
+	if err != nil {
+		return 0, linuxerr.EINVAL
+	}
+
+	m, err := getMMIncRef(d.task)
+	if err != nil {
+		return 0, linuxerr.ESRCH
+	}
+	defer m.DecUsers(ctx)
+	if err := m.ClearRefs(mm.ClearRefsType(v)); err != nil {
+		return 0, err
+	}
+	return src.NumBytes(), nil
+}
+
 // limitsData implements vfs.DynamicBytesSource for /proc/[pid]/limits.
 //
 // +stateify savable
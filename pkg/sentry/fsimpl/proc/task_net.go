@@ -44,7 +44,8 @@ func (fs *filesystem) newTaskNetDir(ctx context.Context, task *kernel.Task) kern
 
 	var contents map[string]kernfs.Inode
 	var stack inet.Stack
-	if netns := task.GetNetworkNamespace(); netns != nil {
+	netns := task.GetNetworkNamespace()
+	if netns != nil {
 		netns.DecRef(ctx)
 		stack = netns.Stack()
 	}
@@ -55,7 +56,6 @@ func (fs *filesystem) newTaskNetDir(ctx context.Context, task *kernel.Task) kern
 			packet    = "sk       RefCnt Type Proto  Iface R Rmem   User   Inode\n"
 			protocols = "protocol  size sockets  memory press maxhdr  slab module     cl co di ac io in de sh ss gs se re sp bi br ha uh gp em\n"
 			ptype     = "Type Device      Function\n"
-			upd6      = "  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
 		)
 		psched := fmt.Sprintf("%08x %08x %08x %08x\n", uint64(time.Microsecond/time.Nanosecond), 64, 1000000, uint64(time.Second/time.Nanosecond))
 
@@ -79,16 +79,16 @@ func (fs *filesystem) newTaskNetDir(ctx context.Context, task *kernel.Task) kern
 			"psched": fs.newInode(ctx, root, 0444, newStaticFile(psched)),
 			"ptype":  fs.newInode(ctx, root, 0444, newStaticFile(ptype)),
 			"route":  fs.newInode(ctx, root, 0444, &netRouteData{stack: stack}),
-			"tcp":    fs.newInode(ctx, root, 0444, &netTCPData{kernel: k}),
-			"udp":    fs.newInode(ctx, root, 0444, &netUDPData{kernel: k}),
-			"unix":   fs.newInode(ctx, root, 0444, &netUnixData{kernel: k}),
+			"tcp":    fs.newInode(ctx, root, 0444, &netTCPData{kernel: k, netns: netns}),
+			"udp":    fs.newInode(ctx, root, 0444, &netUDPData{kernel: k, netns: netns}),
+			"unix":   fs.newInode(ctx, root, 0444, &netUnixData{kernel: k, netns: netns}),
 		}
 
 		if stack.SupportsIPv6() {
 			contents["if_inet6"] = fs.newInode(ctx, root, 0444, &ifinet6{stack: stack})
 			contents["ipv6_route"] = fs.newInode(ctx, root, 0444, newStaticFile(""))
-			contents["tcp6"] = fs.newInode(ctx, root, 0444, &netTCP6Data{kernel: k})
-			contents["udp6"] = fs.newInode(ctx, root, 0444, newStaticFile(upd6))
+			contents["tcp6"] = fs.newInode(ctx, root, 0444, &netTCP6Data{kernel: k, netns: netns})
+			contents["udp6"] = fs.newInode(ctx, root, 0444, &netUDP6Data{kernel: k, netns: netns})
 		}
 	}
 
@@ -203,6 +203,7 @@ type netUnixData struct {
 	kernfs.DynamicBytesFile
 
 	kernel *kernel.Kernel
+	netns  *inet.Namespace
 }
 
 var _ dynamicInode = (*netUnixData)(nil)
@@ -211,6 +212,9 @@ var _ dynamicInode = (*netUnixData)(nil)
 func (n *netUnixData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	buf.WriteString("Num       RefCount Protocol Flags    Type St Inode Path\n")
 	for _, se := range n.kernel.ListSockets() {
+		if !se.InNetworkNamespace(n.netns) {
+			continue
+		}
 		s := se.Sock
 		if !s.TryIncRef() {
 			// Racing with socket destruction, this is ok.
@@ -349,13 +353,16 @@ func writeInetAddr(w io.Writer, family int, i linux.SockAddr) {
 	}
 }
 
-func commonGenerateTCP(ctx context.Context, buf *bytes.Buffer, k *kernel.Kernel, family int) error {
+func commonGenerateTCP(ctx context.Context, buf *bytes.Buffer, k *kernel.Kernel, netns *inet.Namespace, family int) error {
 	// t may be nil here if our caller is not part of a task goroutine. This can
 	// happen for example if we're here for "sentryctl cat". When t is nil,
 	// degrade gracefully and retrieve what we can.
 	t := kernel.TaskFromContext(ctx)
 
 	for _, se := range k.ListSockets() {
+		if !se.InNetworkNamespace(netns) {
+			continue
+		}
 		s := se.Sock
 		if !s.TryIncRef() {
 			// Racing with socket destruction, this is ok.
@@ -475,13 +482,14 @@ type netTCPData struct {
 	kernfs.DynamicBytesFile
 
 	kernel *kernel.Kernel
+	netns  *inet.Namespace
 }
 
 var _ dynamicInode = (*netTCPData)(nil)
 
 func (d *netTCPData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	buf.WriteString("  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode                                                     \n")
-	return commonGenerateTCP(ctx, buf, d.kernel, linux.AF_INET)
+	return commonGenerateTCP(ctx, buf, d.kernel, d.netns, linux.AF_INET)
 }
 
 // netTCP6Data implements vfs.DynamicBytesSource for /proc/net/tcp6.
@@ -491,13 +499,14 @@ type netTCP6Data struct {
 	kernfs.DynamicBytesFile
 
 	kernel *kernel.Kernel
+	netns  *inet.Namespace
 }
 
 var _ dynamicInode = (*netTCP6Data)(nil)
 
 func (d *netTCP6Data) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	buf.WriteString("  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n")
-	return commonGenerateTCP(ctx, buf, d.kernel, linux.AF_INET6)
+	return commonGenerateTCP(ctx, buf, d.kernel, d.netns, linux.AF_INET6)
 }
 
 // netUDPData implements vfs.DynamicBytesSource for /proc/net/udp.
@@ -507,20 +516,45 @@ type netUDPData struct {
 	kernfs.DynamicBytesFile
 
 	kernel *kernel.Kernel
+	netns  *inet.Namespace
 }
 
 var _ dynamicInode = (*netUDPData)(nil)
 
 // Generate implements vfs.DynamicBytesSource.Generate.
 func (d *netUDPData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	buf.WriteString("  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops             \n")
+	return commonGenerateUDP(ctx, buf, d.kernel, d.netns, linux.AF_INET)
+}
+
+// netUDP6Data implements vfs.DynamicBytesSource for /proc/net/udp6.
+//
+// +stateify savable
+type netUDP6Data struct {
+	kernfs.DynamicBytesFile
+
+	kernel *kernel.Kernel
+	netns  *inet.Namespace
+}
+
+var _ dynamicInode = (*netUDP6Data)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *netUDP6Data) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	buf.WriteString("  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops\n")
+	return commonGenerateUDP(ctx, buf, d.kernel, d.netns, linux.AF_INET6)
+}
+
+func commonGenerateUDP(ctx context.Context, buf *bytes.Buffer, k *kernel.Kernel, netns *inet.Namespace, family int) error {
 	// t may be nil here if our caller is not part of a task goroutine. This can
 	// happen for example if we're here for "sentryctl cat". When t is nil,
 	// degrade gracefully and retrieve what we can.
 	t := kernel.TaskFromContext(ctx)
 
-	buf.WriteString("  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops             \n")
-
-	for _, se := range d.kernel.ListSockets() {
+	for _, se := range k.ListSockets() {
+		if !se.InNetworkNamespace(netns) {
+			continue
+		}
 		s := se.Sock
 		if !s.TryIncRef() {
 			// Racing with socket destruction, this is ok.
@@ -530,34 +564,35 @@ func (d *netUDPData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 		if !ok {
 			panic(fmt.Sprintf("Found non-socket file in socket table: %+v", s))
 		}
-		if family, stype, _ := sops.Type(); family != linux.AF_INET || stype != linux.SOCK_DGRAM {
+		if fa, _, _ := sops.Type(); fa != family || !socket.IsUDP(sops) {
 			s.DecRef(ctx)
-			// Not udp4 socket.
+			// Not a UDP socket of this family.
 			continue
 		}
 
-		// For Linux's implementation, see net/ipv4/udp.c:udp4_format_sock().
+		// For Linux's implementation, see net/ipv4/udp.c:udp4_format_sock()
+		// and net/ipv6/datagram.c:__ip6_dgram_sock_seq_show().
 
 		// Field: sl; entry number.
 		fmt.Fprintf(buf, "%5d: ", se.ID)
 
 		// Field: local_adddress.
-		var localAddr linux.SockAddrInet
+		var localAddr linux.SockAddr
 		if t != nil {
 			if local, _, err := sops.GetSockName(t); err == nil {
-				localAddr = *local.(*linux.SockAddrInet)
+				localAddr = local
 			}
 		}
-		writeInetAddr(buf, linux.AF_INET, &localAddr)
+		writeInetAddr(buf, family, localAddr)
 
 		// Field: rem_address.
-		var remoteAddr linux.SockAddrInet
+		var remoteAddr linux.SockAddr
 		if t != nil {
 			if remote, _, err := sops.GetPeerName(t); err == nil {
-				remoteAddr = *remote.(*linux.SockAddrInet)
+				remoteAddr = remote
 			}
 		}
-		writeInetAddr(buf, linux.AF_INET, &remoteAddr)
+		writeInetAddr(buf, family, remoteAddr)
 
 		// Field: state; socket state.
 		fmt.Fprintf(buf, "%02X ", sops.State())
@@ -602,8 +637,12 @@ func (d *netUDPData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 		// the 'Num' field in /proc/net/unix, see netUnix.ReadSeqFileData.
 		fmt.Fprintf(buf, "%#016p ", (*socket.Socket)(nil))
 
-		// Field: drops; number of dropped packets. Unimplemented.
-		fmt.Fprintf(buf, "%d", 0)
+		// Field: drops; number of dropped packets.
+		var drops uint32
+		if info, ok := socket.MemInfo(sops); ok {
+			drops = info[linux.SK_MEMINFO_DROPS]
+		}
+		fmt.Fprintf(buf, "%d", drops)
 
 		fmt.Fprintf(buf, "\n")
 
@@ -90,6 +90,12 @@ func (fs *filesystem) newTasksInode(ctx context.Context, k *kernel.Kernel, pidns
 		contents["cgroups"] = fs.newInode(ctx, root, 0444, &cgroupsData{})
 	}
 
+	for name, child := range contents {
+		if d, ok := child.(*staticDir); ok {
+			d.name = name
+		}
+	}
+
 	inode := &tasksInode{
 		pidns:                 pidns,
 		fs:                    fs,
@@ -123,6 +129,7 @@ func (i *tasksInode) Lookup(ctx context.Context, name string) (kernfs.Inode, err
 		case threadSelfName:
 			return i.newThreadSelfSymlink(ctx, root), nil
 		}
+		recordMissing(ctx, "/proc/"+name)
 		return nil, linuxerr.ENOENT
 	}
 
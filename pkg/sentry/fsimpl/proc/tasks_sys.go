@@ -25,13 +25,15 @@ import (
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
-	"gvisor.dev/gvisor/pkg/rand"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/guestrand"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
 	"gvisor.dev/gvisor/pkg/usermem"
 )
@@ -53,7 +55,11 @@ func (fs *filesystem) newSysDir(ctx context.Context, root *auth.Credentials, k *
 			"overflowgid":  fs.newInode(ctx, root, 0444, newStaticFile(fmt.Sprintf("%d\n", auth.OverflowGID))),
 			"overflowuid":  fs.newInode(ctx, root, 0444, newStaticFile(fmt.Sprintf("%d\n", auth.OverflowUID))),
 			"random": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
-				"boot_id": fs.newInode(ctx, root, 0444, newStaticFile(randUUID())),
+				"boot_id": fs.newInode(ctx, root, 0444, newStaticFile(randUUID(ctx))),
+				// As of Linux 5.18, the input pool is a fixed-size hash
+				// that is always reported as full.
+				"entropy_avail": fs.newInode(ctx, root, 0444, newStaticFile("256\n")),
+				"poolsize":      fs.newInode(ctx, root, 0444, newStaticFile("256\n")),
 			}),
 			"sem":    fs.newInode(ctx, root, 0444, newStaticFile(fmt.Sprintf("%d\t%d\t%d\t%d\n", linux.SEMMSL, linux.SEMMNS, linux.SEMOPM, linux.SEMMNI))),
 			"shmall": fs.newInode(ctx, root, 0444, ipcData(linux.SHMALL)),
@@ -70,9 +76,10 @@ func (fs *filesystem) newSysDir(ctx context.Context, root *auth.Credentials, k *
 			"nr_open": fs.newInode(ctx, root, 0644, &atomicInt32File{val: &k.MaxFDLimit, min: 8, max: kernel.MaxFdLimit}),
 		}),
 		"vm": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
-			"max_map_count":     fs.newInode(ctx, root, 0444, newStaticFile("2147483647\n")),
+			"max_map_count":     fs.newInode(ctx, root, 0644, &atomicInt32File{val: &k.MaxMapCount, min: 0, max: math.MaxInt32}),
 			"mmap_min_addr":     fs.newInode(ctx, root, 0444, &mmapMinAddrData{k: k}),
-			"overcommit_memory": fs.newInode(ctx, root, 0444, newStaticFile("0\n")),
+			"overcommit_memory": fs.newInode(ctx, root, 0644, &atomicInt32File{val: &k.OvercommitMemory, min: linux.OVERCOMMIT_GUESS, max: linux.OVERCOMMIT_NEVER}),
+			"swappiness":        fs.newInode(ctx, root, 0644, &atomicInt32File{val: &k.Swappiness, min: 0, max: 200}),
 		}),
 		"net": fs.newSysNetDir(ctx, root, k),
 	})
@@ -87,8 +94,14 @@ func (fs *filesystem) newSysNetDir(ctx context.Context, root *auth.Credentials,
 	if stack := k.RootNetworkNamespace().Stack(); stack != nil {
 		contents = map[string]kernfs.Inode{
 			"ipv4": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+				"ip_default_ttl":      fs.newInode(ctx, root, 0644, &defaultTTL{stack: stack, protocol: ipv4.ProtocolNumber}),
 				"ip_forward":          fs.newInode(ctx, root, 0444, &ipForwarding{stack: stack}),
 				"ip_local_port_range": fs.newInode(ctx, root, 0644, &portRange{stack: stack}),
+				"tcp_base_mss":        fs.newInode(ctx, root, 0644, &tcpMTUProbingData{stack: stack, field: tcpBaseMSS}),
+				"tcp_mtu_probe_floor": fs.newInode(ctx, root, 0644, &tcpMTUProbingData{stack: stack, field: tcpMTUProbeFloor}),
+				"tcp_mtu_probing":     fs.newInode(ctx, root, 0644, &tcpMTUProbingData{stack: stack, field: tcpMTUProbingMode}),
+				"tcp_probe_interval":  fs.newInode(ctx, root, 0644, &tcpMTUProbingData{stack: stack, field: tcpProbeInterval}),
+				"tcp_probe_threshold": fs.newInode(ctx, root, 0644, &tcpMTUProbingData{stack: stack, field: tcpProbeThreshold}),
 				"tcp_recovery":        fs.newInode(ctx, root, 0644, &tcpRecoveryData{stack: stack}),
 				"tcp_rmem":            fs.newInode(ctx, root, 0644, &tcpMemData{stack: stack, dir: tcpRMem}),
 				"tcp_sack":            fs.newInode(ctx, root, 0644, &tcpSackData{stack: stack}),
@@ -112,7 +125,6 @@ func (fs *filesystem) newSysNetDir(ctx context.Context, root *auth.Credentials,
 				// Many of the following stub files are features netstack doesn't
 				// support. The unsupported features return "0" to indicate they are
 				// disabled.
-				"tcp_base_mss":              fs.newInode(ctx, root, 0444, newStaticFile("1280")),
 				"tcp_dsack":                 fs.newInode(ctx, root, 0444, newStaticFile("0")),
 				"tcp_early_retrans":         fs.newInode(ctx, root, 0444, newStaticFile("0")),
 				"tcp_fack":                  fs.newInode(ctx, root, 0444, newStaticFile("0")),
@@ -122,10 +134,7 @@ func (fs *filesystem) newSysNetDir(ctx context.Context, root *auth.Credentials,
 				"tcp_keepalive_intvl":       fs.newInode(ctx, root, 0444, newStaticFile("0")),
 				"tcp_keepalive_probes":      fs.newInode(ctx, root, 0444, newStaticFile("0")),
 				"tcp_keepalive_time":        fs.newInode(ctx, root, 0444, newStaticFile("7200")),
-				"tcp_mtu_probing":           fs.newInode(ctx, root, 0444, newStaticFile("0")),
 				"tcp_no_metrics_save":       fs.newInode(ctx, root, 0444, newStaticFile("1")),
-				"tcp_probe_interval":        fs.newInode(ctx, root, 0444, newStaticFile("0")),
-				"tcp_probe_threshold":       fs.newInode(ctx, root, 0444, newStaticFile("0")),
 				"tcp_retries1":              fs.newInode(ctx, root, 0444, newStaticFile("3")),
 				"tcp_retries2":              fs.newInode(ctx, root, 0444, newStaticFile("15")),
 				"tcp_rfc1337":               fs.newInode(ctx, root, 0444, newStaticFile("1")),
@@ -146,6 +155,15 @@ func (fs *filesystem) newSysNetDir(ctx context.Context, root *auth.Credentials,
 				"wmem_max":      fs.newInode(ctx, root, 0444, newStaticFile("212992")),
 			}),
 		}
+		if stack.SupportsIPv6() {
+			contents["ipv6"] = fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+				"conf": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+					"default": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+						"hop_limit": fs.newInode(ctx, root, 0644, &defaultTTL{stack: stack, protocol: header.IPv6ProtocolNumber}),
+					}),
+				}),
+			})
+		}
 	}
 
 	return fs.newStaticDir(ctx, root, contents)
@@ -293,6 +311,96 @@ func (d *tcpRecoveryData) Write(ctx context.Context, _ *vfs.FileDescription, src
 	return n, nil
 }
 
+// tcpMTUProbingField identifies a field of inet.TCPMTUProbing.
+type tcpMTUProbingField int
+
+const (
+	tcpMTUProbingMode tcpMTUProbingField = iota
+	tcpBaseMSS
+	tcpMTUProbeFloor
+	tcpProbeThreshold
+	tcpProbeInterval
+)
+
+// value returns a pointer to the field f of p.
+func (f tcpMTUProbingField) value(p *inet.TCPMTUProbing) *int32 {
+	switch f {
+	case tcpMTUProbingMode:
+		return &p.Mode
+	case tcpBaseMSS:
+		return &p.BaseMSS
+	case tcpMTUProbeFloor:
+		return &p.Floor
+	case tcpProbeThreshold:
+		return &p.Threshold
+	case tcpProbeInterval:
+		return &p.Interval
+	default:
+		panic(fmt.Sprintf("unknown TCP MTU probing field: %d", f))
+	}
+}
+
+// tcpMTUProbingData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/ipv4/tcp_mtu_probing, tcp_base_mss, tcp_mtu_probe_floor,
+// tcp_probe_threshold and tcp_probe_interval.
+//
+// +stateify savable
+type tcpMTUProbingData struct {
+	kernfs.DynamicBytesFile
+
+	field tcpMTUProbingField
+	stack inet.Stack `state:"wait"`
+}
+
+// tcpMTUProbingMu serializes writes to the files backed by tcpMTUProbingData,
+// which each update a single field of the settings.
+var tcpMTUProbingMu sync.Mutex
+
+var _ vfs.WritableDynamicBytesSource = (*tcpMTUProbingData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *tcpMTUProbingData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	probing, err := d.stack.TCPMTUProbing()
+	if err != nil {
+		return err
+	}
+
+	_, err = buf.WriteString(fmt.Sprintf("%d\n", *d.field.value(&probing)))
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *tcpMTUProbingData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit the amount of memory allocated.
+	src = src.TakeFirst(hostarch.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+
+	tcpMTUProbingMu.Lock()
+	defer tcpMTUProbingMu.Unlock()
+	probing, err := d.stack.TCPMTUProbing()
+	if err != nil {
+		return 0, err
+	}
+	*d.field.value(&probing) = v
+	if err := d.stack.SetTCPMTUProbing(probing); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
 // tcpMemData implements vfs.WritableDynamicBytesSource for
 // /proc/sys/net/ipv4/tcp_rmem and /proc/sys/net/ipv4/tcp_wmem.
 //
@@ -433,6 +541,58 @@ func (ipf *ipForwarding) Write(ctx context.Context, _ *vfs.FileDescription, src
 	return n, nil
 }
 
+// defaultTTL implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/ipv4/ip_default_ttl and
+// /proc/sys/net/ipv6/conf/default/hop_limit.
+//
+// +stateify savable
+type defaultTTL struct {
+	kernfs.DynamicBytesFile
+
+	stack    inet.Stack `state:"wait"`
+	protocol tcpip.NetworkProtocolNumber
+}
+
+var _ vfs.WritableDynamicBytesSource = (*defaultTTL)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *defaultTTL) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	ttl, err := d.stack.DefaultTTL(d.protocol)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(buf, "%d\n", ttl)
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *defaultTTL) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit input size so as not to impact performance if input size is large.
+	src = src.TakeFirst(hostarch.PageSize - 1)
+
+	var v int32
+	n, err := usermem.CopyInt32StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+	// Linux limits both to [1, 255].
+	if v < 1 || v > math.MaxUint8 {
+		return 0, linuxerr.EINVAL
+	}
+	if err := d.stack.SetDefaultTTL(d.protocol, uint8(v)); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
 // portRange implements vfs.WritableDynamicBytesSource for
 // /proc/sys/net/ipv4/ip_local_port_range.
 //
@@ -546,9 +706,9 @@ func (f *atomicInt32File) Write(ctx context.Context, _ *vfs.FileDescription, src
 
 // randUUID returns a string containing a randomly-generated UUID followed by a
 // newline.
-func randUUID() string {
+func randUUID(ctx context.Context) string {
 	var uuid [16]byte
-	if _, err := io.ReadFull(rand.Reader, uuid[:]); err != nil {
+	if _, err := io.ReadFull(guestrand.Reader(ctx), uuid[:]); err != nil {
 		panic(fmt.Sprintf("failed to read random bytes for UUID: %v", err))
 	}
 	uuid[8] = (uuid[8] & 0x3f) | 0x80 // RFC 4122 UUID
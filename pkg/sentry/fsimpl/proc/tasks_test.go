@@ -73,6 +73,7 @@ var (
 	taskStaticFiles = map[string]testutil.DirentType{
 		"auxv":          linux.DT_REG,
 		"cgroup":        linux.DT_REG,
+		"clear_refs":    linux.DT_REG,
 		"cwd":           linux.DT_LNK,
 		"cmdline":       linux.DT_REG,
 		"comm":          linux.DT_REG,
@@ -91,6 +92,7 @@ var (
 		"ns":            linux.DT_DIR,
 		"oom_score":     linux.DT_REG,
 		"oom_score_adj": linux.DT_REG,
+		"pagemap":       linux.DT_REG,
 		"root":          linux.DT_LNK,
 		"smaps":         linux.DT_REG,
 		"stat":          linux.DT_REG,
@@ -0,0 +1,295 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sys
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/kernfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// pageIdleChunkSize is the unit in which /sys/kernel/mm/page_idle/bitmap is
+// read and written, from Linux's mm/page_idle.c:BITMAP_CHUNK_SIZE.
+const pageIdleChunkSize = 8
+
+// pageIdleChunkPages is the number of pages described by a chunk.
+const pageIdleChunkPages = pageIdleChunkSize * 8
+
+// pageIdleBatchChunks is the number of chunks read or written at a time, which
+// bounds the memory used by a read or write regardless of its length.
+const pageIdleBatchChunks = 512
+
+func (fs *filesystem) newPageIdleBitmap(ctx context.Context, creds *auth.Credentials) kernfs.Inode {
+	i := &pageIdleInode{}
+	i.InodeAttrs.Init(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), linux.S_IFREG|0600)
+	return i
+}
+
+// pageIdleInode implements kernfs.Inode for /sys/kernel/mm/page_idle/bitmap.
+//
+// Page frame numbers are offsets into the MemoryFile in pages, as reported by
+// /proc/[pid]/pagemap. Bit i of the bitmap is set if page frame i is mapped
+// by some application and none of them has accessed it since the bit was set
+// by a write. See Documentation/admin-guide/mm/idle_page_tracking.rst.
+//
+// +stateify savable
+type pageIdleInode struct {
+	kernfs.InodeAttrs
+	kernfs.InodeNoopRefCount
+	kernfs.InodeNotAnonymous
+	kernfs.InodeNotDirectory
+	kernfs.InodeNotSymlink
+	kernfs.InodeWatches
+	implStatFS
+}
+
+// Open implements kernfs.Inode.Open.
+func (i *pageIdleInode) Open(ctx context.Context, rp *vfs.ResolvingPath, d *kernfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	fd := &pageIdleFD{inode: i}
+	if err := fd.vfsfd.Init(fd, opts.Flags, rp.Mount(), d.VFSDentry(), &vfs.FileDescriptionOptions{}); err != nil {
+		return nil, err
+	}
+	return &fd.vfsfd, nil
+}
+
+// +stateify savable
+type pageIdleFD struct {
+	vfs.FileDescriptionDefaultImpl
+	vfs.NoLockFD
+
+	vfsfd vfs.FileDescription
+	inode *pageIdleInode
+
+	// mu guards the fields below.
+	mu     sync.Mutex `state:"nosave"`
+	offset int64
+}
+
+// Seek implements vfs.FileDescriptionImpl.Seek.
+func (fd *pageIdleFD) Seek(ctx context.Context, offset int64, whence int32) (int64, error) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	switch whence {
+	case linux.SEEK_SET:
+	case linux.SEEK_CUR:
+		offset += fd.offset
+	default:
+		return 0, linuxerr.EINVAL
+	}
+	if offset < 0 {
+		return 0, linuxerr.EINVAL
+	}
+	fd.offset = offset
+	return offset, nil
+}
+
+// getMMs returns all application MemoryManagers, with a user reference held
+// on each. Callers must release them with putMMs.
+func getMMs(ctx context.Context) []*mm.MemoryManager {
+	k := kernel.KernelFromContext(ctx)
+	seen := make(map[*mm.MemoryManager]struct{})
+	var mms []*mm.MemoryManager
+	for _, t := range k.TaskSet().Root.Tasks() {
+		var m *mm.MemoryManager
+		t.WithMuLocked(func(t *kernel.Task) {
+			m = t.MemoryManager()
+		})
+		if m == nil {
+			continue
+		}
+		if _, ok := seen[m]; ok {
+			continue
+		}
+		seen[m] = struct{}{}
+		if !m.IncUsers() {
+			continue
+		}
+		mms = append(mms, m)
+	}
+	return mms
+}
+
+// putMMs releases the references returned by getMMs.
+func putMMs(ctx context.Context, mms []*mm.MemoryManager) {
+	for _, m := range mms {
+		m.DecUsers(ctx)
+	}
+}
+
+// checkPageIdleRange validates an access of length bytes at offset, and
+// returns the page frame range it covers, truncated to the size of the
+// MemoryFile.
+func checkPageIdleRange(ctx context.Context, offset, length int64) (memmap.FileRange, error) {
+	if offset < 0 || offset%pageIdleChunkSize != 0 || length%pageIdleChunkSize != 0 {
+		return memmap.FileRange{}, linuxerr.EINVAL
+	}
+	maxPFN := kernel.KernelFromContext(ctx).MemoryFile().TotalSize() / hostarch.PageSize
+	start := uint64(offset) / pageIdleChunkSize * pageIdleChunkPages
+	end := start + uint64(length)/pageIdleChunkSize*pageIdleChunkPages
+	if end > maxPFN || end < start {
+		end = maxPFN
+	}
+	if start >= end {
+		return memmap.FileRange{}, nil
+	}
+	return memmap.FileRange{start * hostarch.PageSize, end * hostarch.PageSize}, nil
+}
+
+// nextPageIdleBatch returns the part of fr, which starts at a chunk boundary,
+// that is processed by one batch of a read or write, and the number of bitmap
+// words describing it.
+func nextPageIdleBatch(fr memmap.FileRange) (memmap.FileRange, uint64) {
+	batch := fr
+	if limit := uint64(pageIdleBatchChunks * pageIdleChunkPages * hostarch.PageSize); batch.Length() > limit {
+		batch.End = batch.Start + limit
+	}
+	words := (batch.Length()/hostarch.PageSize + pageIdleChunkPages - 1) / pageIdleChunkPages
+	return batch, words
+}
+
+// PRead implements vfs.FileDescriptionImpl.PRead.
+func (fd *pageIdleFD) PRead(ctx context.Context, dst usermem.IOSequence, offset int64, opts vfs.ReadOptions) (int64, error) {
+	fr, err := checkPageIdleRange(ctx, offset, dst.NumBytes())
+	if err != nil || fr.Length() == 0 {
+		return 0, err
+	}
+	mms := getMMs(ctx)
+	defer putMMs(ctx, mms)
+
+	var (
+		mapped   [pageIdleBatchChunks]uint64
+		accessed [pageIdleBatchChunks]uint64
+		buf      [pageIdleBatchChunks * pageIdleChunkSize]byte
+		total    int64
+	)
+	for fr.Length() != 0 {
+		batch, words := nextPageIdleBatch(fr)
+		clear(mapped[:words])
+		clear(accessed[:words])
+		for _, m := range mms {
+			m.ReadIdle(batch, mapped[:words], accessed[:words])
+		}
+		for i := uint64(0); i < words; i++ {
+			hostarch.ByteOrder.PutUint64(buf[i*pageIdleChunkSize:], mapped[i]&^accessed[i])
+		}
+		n, err := dst.CopyOut(ctx, buf[:words*pageIdleChunkSize])
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+		dst = dst.DropFirst(n)
+		fr.Start = batch.End
+	}
+	return total, nil
+}
+
+// Read implements vfs.FileDescriptionImpl.Read.
+func (fd *pageIdleFD) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
+	fd.mu.Lock()
+	n, err := fd.PRead(ctx, dst, fd.offset, opts)
+	fd.offset += n
+	fd.mu.Unlock()
+	return n, err
+}
+
+// PWrite implements vfs.FileDescriptionImpl.PWrite.
+func (fd *pageIdleFD) PWrite(ctx context.Context, src usermem.IOSequence, offset int64, opts vfs.WriteOptions) (int64, error) {
+	fr, err := checkPageIdleRange(ctx, offset, src.NumBytes())
+	if err != nil {
+		return 0, err
+	}
+	if fr.Length() == 0 {
+		if src.NumBytes() == 0 {
+			return 0, nil
+		}
+		return 0, linuxerr.ENXIO
+	}
+	mms := getMMs(ctx)
+	defer putMMs(ctx, mms)
+
+	var (
+		buf   [pageIdleBatchChunks * pageIdleChunkSize]byte
+		idle  []memmap.FileRange
+		total int64
+	)
+	for fr.Length() != 0 {
+		batch, words := nextPageIdleBatch(fr)
+		n, err := src.CopyIn(ctx, buf[:words*pageIdleChunkSize])
+		total += int64(n)
+
+		// Mark runs of set bits as idle, in one pass over each
+		// MemoryManager.
+		idle = idle[:0]
+		for i := 0; i < n/pageIdleChunkSize; i++ {
+			word := hostarch.ByteOrder.Uint64(buf[i*pageIdleChunkSize:])
+			for bit := uint64(0); word != 0; bit, word = bit+1, word>>1 {
+				if word&1 == 0 {
+					continue
+				}
+				start := batch.Start + (uint64(i)*pageIdleChunkPages+bit)*hostarch.PageSize
+				if start >= batch.End {
+					break
+				}
+				if l := len(idle); l > 0 && idle[l-1].End == start {
+					idle[l-1].End += hostarch.PageSize
+				} else {
+					idle = append(idle, memmap.FileRange{start, start + hostarch.PageSize})
+				}
+			}
+		}
+		for _, m := range mms {
+			m.MarkIdle(idle)
+		}
+		if err != nil {
+			return total, err
+		}
+		src = src.DropFirst(n)
+		fr.Start = batch.End
+	}
+	return total, nil
+}
+
+// Write implements vfs.FileDescriptionImpl.Write.
+func (fd *pageIdleFD) Write(ctx context.Context, src usermem.IOSequence, opts vfs.WriteOptions) (int64, error) {
+	fd.mu.Lock()
+	n, err := fd.PWrite(ctx, src, fd.offset, opts)
+	fd.offset += n
+	fd.mu.Unlock()
+	return n, err
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (fd *pageIdleFD) Release(context.Context) {}
+
+// SetStat implements vfs.FileDescriptionImpl.SetStat.
+func (fd *pageIdleFD) SetStat(ctx context.Context, opts vfs.SetStatOptions) error {
+	creds := auth.CredentialsFromContext(ctx)
+	fs := fd.vfsfd.VirtualDentry().Mount().Filesystem()
+	return fd.inode.SetStat(ctx, fs, creds, opts)
+}
+
+// Stat implements vfs.FileDescriptionImpl.Stat.
+func (fd *pageIdleFD) Stat(ctx context.Context, opts vfs.StatOptions) (linux.Statx, error) {
+	return fd.inode.Stat(ctx, fd.vfsfd.Mount().Filesystem(), opts)
+}
@@ -32,6 +32,7 @@ const (
 	pciMainBusDevicePath = "/sys/devices/pci0000:00"
 	accelDevice          = "accel"
 	vfioDevice           = "vfio-dev"
+	vfioPCIDriver        = "vfio-pci"
 )
 
 var (
@@ -151,6 +152,17 @@ func (fs *filesystem) mirrorPCIBusDeviceDir(ctx context.Context, creds *auth.Cre
 					return nil, fmt.Errorf("no IOMMU group is found for device %v", pciDeviceName)
 				}
 				linkContent = fmt.Sprintf("../../../kernel/iommu_groups/%s", iommuGroupNum)
+			case dent == "driver":
+				// Userspace drivers, such as DPDK, check that devices are bound
+				// to vfio-pci. Other drivers are not exposed.
+				target, err := hostReadlink(dir, dent)
+				if err != nil {
+					return nil, err
+				}
+				if path.Base(target) != vfioPCIDriver {
+					continue
+				}
+				linkContent = target
 			default:
 				continue
 			}
@@ -181,6 +193,20 @@ func hostFileMode(path string) (uint32, error) {
 	return stat.Mode & unix.S_IFMT, nil
 }
 
+func hostReadlink(dir, name string) (string, error) {
+	fd, err := unix.Openat(-1, dir, unix.O_RDONLY|unix.O_NOFOLLOW|unix.O_PATH, 0)
+	if err != nil {
+		return "", err
+	}
+	defer unix.Close(fd)
+	buf := make([]byte, unix.PathMax)
+	n, err := unix.Readlinkat(fd, name, buf)
+	if err != nil {
+		return "", err
+	}
+	return string(buf[:n]), nil
+}
+
 func hostDirEntries(path string) ([]string, error) {
 	fd, err := unix.Openat(-1, path, unix.O_RDONLY|unix.O_NOFOLLOW, 0)
 	if err != nil {
@@ -251,6 +251,11 @@ func kernelDir(ctx context.Context, fs *filesystem, creds *auth.Credentials) map
 			"kcov": fs.newKcovFile(ctx, creds),
 		})
 	}
+	children["mm"] = fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+		"page_idle": fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+			"bitmap": fs.newPageIdleBitmap(ctx, creds),
+		}),
+	})
 	return children
 }
 
@@ -226,3 +226,32 @@ func TestEnableTPUProxyPathsV5(t *testing.T) {
 		"0000:00:04.0": linux.DT_LNK,
 	})
 }
+
+func TestVFIOPCIDriverLink(t *testing.T) {
+	// Set up the fs tree that will be mirrored in the sentry.
+	sysfsTestDir := t.TempDir()
+	devicesPath := path.Join(sysfsTestDir, "sys", "devices", "pci0000:00")
+	for dev, driver := range map[string]string{
+		"0000:00:05.0": "vfio-pci",
+		"0000:00:06.0": "ixgbevf",
+	} {
+		devPath := path.Join(devicesPath, dev)
+		if err := os.MkdirAll(devPath, 0755); err != nil {
+			t.Fatalf("Failed to create device directory: %v", err)
+		}
+		if err := os.Symlink(path.Join("..", "..", "..", "bus", "pci", "drivers", driver), path.Join(devPath, "driver")); err != nil {
+			t.Fatalf("Failed to symlink driver directory: %v", err)
+		}
+	}
+
+	s := newTestSystem(t, sysfsTestDir)
+	defer s.Destroy()
+
+	// Only devices bound to vfio-pci expose their driver.
+	pop := s.PathOpAtRoot("/devices/pci0000:00/0000:00:05.0")
+	s.AssertAllDirentTypes(s.ListDirents(pop), map[string]testutil.DirentType{
+		"driver": linux.DT_LNK,
+	})
+	pop = s.PathOpAtRoot("/devices/pci0000:00/0000:00:06.0")
+	s.AssertAllDirentTypes(s.ListDirents(pop), map[string]testutil.DirentType{})
+}
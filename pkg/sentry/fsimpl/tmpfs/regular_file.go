@@ -87,6 +87,10 @@ type regularFile struct {
 	// Readers that do not require consistency (like Stat) may read the
 	// value atomically without holding either lock.
 	size atomicbitops.Uint64
+
+	// writeHint is the write life time hint set with fcntl(F_SET_RW_HINT). It
+	// has no effect on tmpfs, but is reported back by F_GET_RW_HINT.
+	writeHint atomicbitops.Uint64
 }
 
 func (fs *filesystem) newRegularFile(kuid auth.KUID, kgid auth.KGID, mode linux.FileMode, parentDir *directory) *inode {
@@ -571,6 +575,17 @@ func (fd *regularFileFD) Seek(ctx context.Context, offset int64, whence int32) (
 	return offset, nil
 }
 
+// WriteHint implements vfs.FileDescriptionImplWriteHintExtension.WriteHint.
+func (fd *regularFileFD) WriteHint() uint64 {
+	return fd.inode().impl.(*regularFile).writeHint.Load()
+}
+
+// SetWriteHint implements vfs.FileDescriptionImplWriteHintExtension.SetWriteHint.
+func (fd *regularFileFD) SetWriteHint(ctx context.Context, hint uint64) error {
+	fd.inode().impl.(*regularFile).writeHint.Store(hint)
+	return nil
+}
+
 // ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap.
 func (fd *regularFileFD) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
 	file := fd.inode().impl.(*regularFile)
@@ -46,6 +46,12 @@ var (
 	GoferReadWaitHost = metric.MustCreateNewUint64NanosecondsMetric("/gofer/read_wait_host", false /* sync */, "Time waiting on host file reads from a gofer, in nanoseconds.")
 )
 
+// Metrics for the host FD cache of fsimpl/gofer.
+var (
+	GoferHostFDEvictions = metric.MustCreateNewUint64Metric("/gofer/host_fd_evictions", false /* sync */, "Number of file handles closed to stay within the host FD limit of a gofer filesystem.")
+	GoferHostFDReopens   = metric.MustCreateNewUint64Metric("/gofer/host_fd_reopens", false /* sync */, "Number of times file handles closed to stay within the host FD limit of a gofer filesystem were reopened.")
+)
+
 // Metrics that only apply to fs/tmpfs and fsimpl/tmpfs.
 var (
 	TmpfsOpensRO  = metric.MustCreateNewUint64Metric("/in_memory_file/opens_ro", false /* sync */, "Number of times an in-memory file was opened in read-only mode.")
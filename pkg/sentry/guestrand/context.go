@@ -0,0 +1,52 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package guestrand defines a context.Context key for the source of the
+// randomness that is visible to applications, such as the output of
+// getrandom(2) and the address space layout.
+//
+// It is separate from rand.Reader so that deterministic execution can make
+// the application's randomness reproducible without weakening the randomness
+// that the sentry uses for itself.
+package guestrand
+
+import (
+	"io"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/rand"
+)
+
+// contextID is the guestrand package's type for context.Context.Value keys.
+type contextID int
+
+const (
+	// CtxReader is a Context.Value key for an io.Reader that provides the
+	// application's randomness.
+	CtxReader contextID = iota
+)
+
+// Reader returns the source of the application's randomness for ctx. It
+// returns rand.Reader if ctx doesn't provide one.
+func Reader(ctx context.Context) io.Reader {
+	if v := ctx.Value(CtxReader); v != nil {
+		return v.(io.Reader)
+	}
+	return rand.Reader
+}
+
+// RNG returns a rand.RNG reading from Reader(ctx).
+func RNG(ctx context.Context) rand.RNG {
+	return rand.RNGFrom(Reader(ctx))
+}
@@ -24,6 +24,9 @@ type contextID int
 const (
 	// CtxStack is a Context.Value key for a network stack.
 	CtxStack contextID = iota
+
+	// CtxNamespace is a Context.Value key for a network namespace.
+	CtxNamespace
 )
 
 // StackFromContext returns the network stack associated with ctx.
@@ -33,3 +36,35 @@ func StackFromContext(ctx context.Context) Stack {
 	}
 	return nil
 }
+
+// NamespaceFromContext returns the network namespace associated with ctx. It
+// doesn't take a reference on the namespace.
+func NamespaceFromContext(ctx context.Context) *Namespace {
+	if v := ctx.Value(CtxNamespace); v != nil {
+		return v.(*Namespace)
+	}
+	return nil
+}
+
+// ContextWithNamespace returns a copy of ctx whose network namespace and
+// stack are those of ns.
+func ContextWithNamespace(ctx context.Context, ns *Namespace) context.Context {
+	return &namespaceContext{Context: ctx, ns: ns}
+}
+
+type namespaceContext struct {
+	context.Context
+	ns *Namespace
+}
+
+// Value implements context.Context.Value.
+func (ctx *namespaceContext) Value(key any) any {
+	switch key {
+	case CtxNamespace:
+		return ctx.ns
+	case CtxStack:
+		return ctx.ns.Stack()
+	default:
+		return ctx.Context.Value(key)
+	}
+}
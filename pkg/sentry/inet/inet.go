@@ -75,6 +75,13 @@ type Stack interface {
 	// SetTCPRecovery attempts to change TCP loss detection algorithm.
 	SetTCPRecovery(recovery TCPLossRecovery) error
 
+	// TCPMTUProbing returns the settings of TCP path MTU probing.
+	TCPMTUProbing() (TCPMTUProbing, error)
+
+	// SetTCPMTUProbing attempts to change the settings of TCP path MTU
+	// probing.
+	SetTCPMTUProbing(probing TCPMTUProbing) error
+
 	// Statistics reports stack statistics.
 	Statistics(stat any, arg string) error
 
@@ -111,6 +118,14 @@ type Stack interface {
 	// (inclusive).
 	SetPortRange(start uint16, end uint16) error
 
+	// DefaultTTL returns the TTL (IPv4) or hop limit (IPv6) of packets sent
+	// with protocol by sockets that don't set one.
+	DefaultTTL(protocol tcpip.NetworkProtocolNumber) (uint8, error)
+
+	// SetDefaultTTL sets the TTL (IPv4) or hop limit (IPv6) of packets sent
+	// with protocol by sockets that don't set one.
+	SetDefaultTTL(protocol tcpip.NetworkProtocolNumber, ttl uint8) error
+
 	// GROTimeout returns the GRO timeout.
 	GROTimeout(NICID int32) (time.Duration, error)
 
@@ -246,3 +261,24 @@ const (
 	TCP_RACK_STATIC_REO_WND
 	TCP_RACK_NO_DUPTHRESH
 )
+
+// TCPMTUProbing contains the settings of TCP packetization layer path MTU
+// discovery, which are exposed in /proc/sys/net/ipv4.
+type TCPMTUProbing struct {
+	// Mode is the value of tcp_mtu_probing: 0 to disable probing, 1 to
+	// enable it when an ICMP blackhole is detected, and 2 to always enable
+	// it.
+	Mode int32
+
+	// BaseMSS is the value of tcp_base_mss.
+	BaseMSS int32
+
+	// Floor is the value of tcp_mtu_probe_floor.
+	Floor int32
+
+	// Threshold is the value of tcp_probe_threshold.
+	Threshold int32
+
+	// Interval is the value of tcp_probe_interval, in seconds.
+	Interval int32
+}
@@ -33,7 +33,9 @@ type TestStack struct {
 	TCPSendBufSize    TCPBufferSize
 	TCPSACKFlag       bool
 	Recovery          TCPLossRecovery
+	MTUProbing        TCPMTUProbing
 	IPForwarding      bool
+	DefaultTTLs       map[tcpip.NetworkProtocolNumber]uint8
 }
 
 // NewTestStack returns a TestStack with no network interfaces. The value of
@@ -139,6 +141,17 @@ func (s *TestStack) SetTCPRecovery(recovery TCPLossRecovery) error {
 	return nil
 }
 
+// TCPMTUProbing implements Stack.
+func (s *TestStack) TCPMTUProbing() (TCPMTUProbing, error) {
+	return s.MTUProbing, nil
+}
+
+// SetTCPMTUProbing implements Stack.
+func (s *TestStack) SetTCPMTUProbing(probing TCPMTUProbing) error {
+	s.MTUProbing = probing
+	return nil
+}
+
 // Statistics implements Stack.
 func (s *TestStack) Statistics(stat any, arg string) error {
 	return nil
@@ -186,6 +199,24 @@ func (*TestStack) SetPortRange(start uint16, end uint16) error {
 	return nil
 }
 
+// DefaultTTL implements Stack.
+func (s *TestStack) DefaultTTL(protocol tcpip.NetworkProtocolNumber) (uint8, error) {
+	if ttl, ok := s.DefaultTTLs[protocol]; ok {
+		return ttl, nil
+	}
+	// Use the default Linux value per include/net/ip.h:IPDEFTTL.
+	return 64, nil
+}
+
+// SetDefaultTTL implements Stack.
+func (s *TestStack) SetDefaultTTL(protocol tcpip.NetworkProtocolNumber, ttl uint8) error {
+	if s.DefaultTTLs == nil {
+		s.DefaultTTLs = make(map[tcpip.NetworkProtocolNumber]uint8)
+	}
+	s.DefaultTTLs[protocol] = ttl
+	return nil
+}
+
 // GROTimeout implements Stack.
 func (*TestStack) GROTimeout(NICID int32) (time.Duration, error) {
 	// No-op.
@@ -45,11 +45,12 @@ const (
 	CgroupControllerDevices = CgroupControllerType("devices")
 	CgroupControllerJob     = CgroupControllerType("job")
 	CgroupControllerMemory  = CgroupControllerType("memory")
+	CgroupControllerMisc    = CgroupControllerType("misc")
 	CgroupControllerPIDs    = CgroupControllerType("pids")
 )
 
 // CgroupCtrls is the list of cgroup controllers.
-var CgroupCtrls = []CgroupControllerType{"cpu", "cpuacct", "cpuset", "devices", "job", "memory", "pids"}
+var CgroupCtrls = []CgroupControllerType{"cpu", "cpuacct", "cpuset", "devices", "job", "memory", "misc", "pids"}
 
 // ParseCgroupController parses a string as a CgroupControllerType.
 func ParseCgroupController(val string) (CgroupControllerType, error) {
@@ -66,6 +67,8 @@ func ParseCgroupController(val string) (CgroupControllerType, error) {
 		return CgroupControllerJob, nil
 	case "memory":
 		return CgroupControllerMemory, nil
+	case "misc":
+		return CgroupControllerMisc, nil
 	case "pids":
 		return CgroupControllerPIDs, nil
 	default:
@@ -77,10 +80,14 @@ func ParseCgroupController(val string) (CgroupControllerType, error) {
 // controller.
 type CgroupResourceType int
 
-// Resources for the cpuacct controller.
+// Resources tracked by cgroup controllers.
 const (
 	// CgroupResourcePID represents a charge for pids.current.
 	CgroupResourcePID CgroupResourceType = iota
+
+	// CgroupResourceGPUMemory represents a charge for GPU memory, in bytes,
+	// tracked by the misc controller.
+	CgroupResourceGPUMemory
 )
 
 // CgroupController is the common interface to cgroup controllers available to
@@ -130,6 +137,16 @@ func (c *Cgroup) decRef() {
 	c.Dentry.DecRef(context.Background())
 }
 
+// hasController returns whether ctl is attached to c's hierarchy.
+func (c *Cgroup) hasController(ctl CgroupControllerType) bool {
+	for _, cc := range c.Controllers() {
+		if cc.Type() == ctl {
+			return true
+		}
+	}
+	return false
+}
+
 // Path returns the absolute path of c, relative to its hierarchy root.
 func (c *Cgroup) Path() string {
 	return c.FSLocalPath()
@@ -0,0 +1,246 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// CompatKind is the kind of feature described by a CompatItem.
+type CompatKind string
+
+// Kinds of CompatItems.
+const (
+	CompatSyscall CompatKind = "syscall"
+	CompatIoctl   CompatKind = "ioctl"
+	CompatProcfs  CompatKind = "procfs"
+	CompatSysctl  CompatKind = "sysctl"
+)
+
+const (
+	// compatMaxItems bounds the number of distinct items in the compatibility
+	// report, so that probing many ioctl numbers or procfs paths cannot grow
+	// it without bound. Uses of further items are not reported.
+	compatMaxItems = 4096
+
+	// compatMaxSamples is the number of samples kept for each item.
+	compatMaxSamples = 3
+
+	// compatMaxStackDepth is the maximum number of frames in a sample stack.
+	compatMaxStackDepth = 16
+)
+
+// CompatItem is a feature that the sentry does not implement, or only
+// partially implements, and that the application used.
+type CompatItem struct {
+	// Kind is the kind of feature.
+	Kind CompatKind `json:"kind"`
+
+	// Name identifies the feature within its kind: a syscall name, an ioctl
+	// request number or a path.
+	Name string `json:"name"`
+
+	// Support is the level of support for the feature, "Unimplemented" or
+	// "Partial Support".
+	Support string `json:"support"`
+
+	// Count is the number of times the feature was used.
+	Count uint64 `json:"count"`
+
+	// Samples are the contexts of the first few uses of the feature.
+	Samples []CompatSample `json:"samples,omitempty"`
+}
+
+// CompatSample is the context of a single use of a CompatItem.
+type CompatSample struct {
+	// TID is the thread ID of the task, in the root PID namespace.
+	TID ThreadID `json:"tid"`
+
+	// Comm is the name of the task.
+	Comm string `json:"comm"`
+
+	// Args are the syscall arguments, for syscalls and ioctls.
+	Args []string `json:"args,omitempty"`
+
+	// Path is the path of the file, for ioctls.
+	Path string `json:"path,omitempty"`
+
+	// Stack is the application call stack, innermost frame first. It is
+	// recovered by following frame pointers, so it stops at the first
+	// function that does not maintain one.
+	Stack []string `json:"stack"`
+}
+
+type compatKey struct {
+	kind CompatKind
+	name string
+}
+
+// compatReport accumulates the items of the compatibility report.
+type compatReport struct {
+	mu sync.Mutex
+
+	// +checklocks:mu
+	items map[compatKey]*CompatItem
+}
+
+// RecordUnsupported records a use of an unimplemented feature by the task in
+// ctx, if any, for the compatibility report.
+func (k *Kernel) RecordUnsupported(ctx context.Context, kind CompatKind, name string) {
+	k.recordCompat(ctx, kind, name, SupportUnimplemented, nil)
+}
+
+// recordCompat records a use of a feature with the given support level in
+// the compatibility report. args are the syscall arguments, if any.
+func (k *Kernel) recordCompat(ctx context.Context, kind CompatKind, name string, support SyscallSupportLevel, args *arch.SyscallArguments) {
+	key := compatKey{kind: kind, name: name}
+	r := &k.compat
+	r.mu.Lock()
+	item, ok := r.items[key]
+	if !ok {
+		if len(r.items) >= compatMaxItems {
+			r.mu.Unlock()
+			return
+		}
+		if r.items == nil {
+			r.items = make(map[compatKey]*CompatItem)
+		}
+		item = &CompatItem{Kind: kind, Name: name, Support: support.String()}
+		r.items[key] = item
+	}
+	item.Count++
+	wantSample := len(item.Samples) < compatMaxSamples
+	r.mu.Unlock()
+
+	t := TaskFromContext(ctx)
+	if !wantSample || t == nil {
+		return
+	}
+	// Collecting the sample copies from application memory, which may block,
+	// so it must happen without r.mu held.
+	sample := t.compatSample(kind, args)
+	r.mu.Lock()
+	if len(item.Samples) < compatMaxSamples {
+		item.Samples = append(item.Samples, sample)
+	}
+	r.mu.Unlock()
+}
+
+// CompatReport returns the items of the compatibility report, most used
+// first.
+func (k *Kernel) CompatReport() []CompatItem {
+	r := &k.compat
+	r.mu.Lock()
+	items := make([]CompatItem, 0, len(r.items))
+	for _, item := range r.items {
+		c := *item
+		c.Samples = append([]CompatSample(nil), item.Samples...)
+		items = append(items, c)
+	}
+	r.mu.Unlock()
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		if items[i].Kind != items[j].Kind {
+			return items[i].Kind < items[j].Kind
+		}
+		return items[i].Name < items[j].Name
+	})
+	return items
+}
+
+// EnableCompatReportPartial makes all syscalls that are only partially
+// implemented report their uses in the compatibility report. Unimplemented
+// features are always reported.
+func EnableCompatReportPartial() {
+	for _, table := range SyscallTables() {
+		partial := make(map[uintptr]bool)
+		for sysno, sc := range table.Table {
+			if sc.SupportLevel == SupportPartial {
+				partial[sysno] = true
+			}
+		}
+		table.FeatureEnable.Enable(CompatReportEnable, partial, false)
+	}
+}
+
+// RecordUnimplementedSyscall records a use of an unimplemented syscall by t
+// for the compatibility report, distinguishing unimplemented ioctls by their
+// request number.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) RecordUnimplementedSyscall(sysno uintptr) {
+	args := t.Arch().SyscallArgs()
+	kind, name := CompatSyscall, t.SyscallTable().LookupName(sysno)
+	if name == "ioctl" {
+		kind, name = CompatIoctl, fmt.Sprintf("%#x", args[1].Uint())
+	}
+	t.k.recordCompat(t, kind, name, SupportUnimplemented, &args)
+}
+
+// compatSample returns the context of t's current use of a feature of the
+// given kind. args are the syscall arguments, if any.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) compatSample(kind CompatKind, args *arch.SyscallArguments) CompatSample {
+	s := CompatSample{
+		TID:  t.k.tasks.Root.IDOfTask(t),
+		Comm: t.Name(),
+	}
+	if args != nil {
+		s.Args = make([]string, len(args))
+		for i, arg := range args {
+			s.Args[i] = fmt.Sprintf("%#x", arg.Uint64())
+		}
+		if kind == CompatIoctl {
+			if file := t.GetFile(args[0].Int()); file != nil {
+				root := t.FSContext().RootDirectory()
+				s.Path, _ = t.k.VFS().PathnameWithDeleted(t, root, file.VirtualDentry())
+				root.DecRef(t)
+				file.DecRef(t)
+			}
+		}
+	}
+
+	// On both amd64 and arm64, a frame starts with the caller's frame pointer
+	// followed by the return address.
+	s.Stack = append(s.Stack, fmt.Sprintf("%#x", t.Arch().IP()))
+	fp := hostarch.Addr(t.Arch().FramePointer())
+	var frame [16]byte
+	for len(s.Stack) < compatMaxStackDepth && fp != 0 {
+		if _, err := t.CopyInBytes(fp, frame[:]); err != nil {
+			break
+		}
+		next := hostarch.Addr(hostarch.ByteOrder.Uint64(frame[:8]))
+		ret := hostarch.ByteOrder.Uint64(frame[8:])
+		if ret == 0 {
+			break
+		}
+		s.Stack = append(s.Stack, fmt.Sprintf("%#x", ret))
+		// Stacks grow down, so callers' frames are at higher addresses.
+		if next <= fp {
+			break
+		}
+		fp = next
+	}
+	return s
+}
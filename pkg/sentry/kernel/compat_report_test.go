@@ -0,0 +1,67 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/context"
+)
+
+func TestCompatReport(t *testing.T) {
+	ctx := context.Background()
+	k := &Kernel{}
+	for i := 0; i < 3; i++ {
+		k.RecordUnsupported(ctx, CompatSysctl, "/proc/sys/kernel/foo")
+	}
+	k.RecordUnsupported(ctx, CompatProcfs, "/proc/foo")
+	k.RecordUnsupported(ctx, CompatIoctl, "0x5401")
+	k.recordCompat(ctx, CompatSyscall, "clone", SupportPartial, nil)
+
+	got := k.CompatReport()
+	want := []CompatItem{
+		{Kind: CompatSysctl, Name: "/proc/sys/kernel/foo", Support: "Unimplemented", Count: 3},
+		{Kind: CompatIoctl, Name: "0x5401", Support: "Unimplemented", Count: 1},
+		{Kind: CompatProcfs, Name: "/proc/foo", Support: "Unimplemented", Count: 1},
+		{Kind: CompatSyscall, Name: "clone", Support: "Partial Support", Count: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("CompatReport() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Kind != want[i].Kind || got[i].Name != want[i].Name || got[i].Support != want[i].Support || got[i].Count != want[i].Count {
+			t.Errorf("CompatReport()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCompatReportMaxItems(t *testing.T) {
+	ctx := context.Background()
+	k := &Kernel{}
+	for i := 0; i < compatMaxItems+10; i++ {
+		k.RecordUnsupported(ctx, CompatIoctl, fmt.Sprintf("%#x", i))
+	}
+	// Items that are already in the report are still counted.
+	k.RecordUnsupported(ctx, CompatIoctl, "0x0")
+
+	got := k.CompatReport()
+	if len(got) != compatMaxItems {
+		t.Fatalf("got %d items, want %d", len(got), compatMaxItems)
+	}
+	if got[0].Name != "0x0" || got[0].Count != 2 {
+		t.Errorf("got first item %+v, want 0x0 with count 2", got[0])
+	}
+}
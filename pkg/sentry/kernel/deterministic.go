@@ -0,0 +1,839 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/errors"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/rand"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// Deterministic execution
+//
+// In deterministic mode, tasks run one at a time: a task must hold the
+// scheduler's run token to execute application code or system calls, and only
+// gives it up when it blocks, stops, exits or makes a system call. The next
+// holder is chosen round-robin by thread ID among the tasks that can run,
+// which includes blocked tasks whose wakeup is already pending. Since every
+// wakeup caused by the previous holder is pending by the time it gives up the
+// token, the choice only depends on the application's execution.
+//
+// Time is provided by sentrytime.VirtualClocks, which advance by a fixed
+// quantum each time a task is scheduled, and skip to the next timer expiration
+// when all tasks are blocked. The randomness visible to the application (see
+// package guestrand) is provided by a generator seeded with
+// DeterministicOptions.Seed; the sentry's own randomness is unaffected.
+//
+// Wakeups that originate outside of the tasks (e.g. host I/O, network packets
+// and netstack's own goroutines) arrive at nondeterministic times. The
+// scheduler's decisions can therefore be recorded to a schedule log, and
+// replayed to reproduce an execution exactly. Inputs from outside of the
+// sandbox are recorded in the same log, and replayed instead of being read
+// again:
+//
+//   - Synchronous inputs are read by the task holding the run token, e.g. from
+//     host files and sockets or the host's time. See Kernel.DeterministicRead.
+//
+//   - Asynchronous inputs, e.g. network packets, arrive at any time. They are
+//     queued, and only delivered to the sandbox while no task runs. See
+//     Kernel.DeterministicSource.
+//
+// During replay, the host may not make a blocked task ready at the step where
+// it was in the recorded execution, since the host inputs are replayed. The
+// scheduler then wakes the task itself, which retries the operation it was
+// blocked on and reads the recorded input.
+//
+// Known limitations: a task that runs application code without making system
+// calls starves all other tasks; CPU clocks and rdtsc are not virtualized;
+// inputs that aren't routed through the scheduler, e.g. the contents of
+// gofer-backed files, must be the same for replay; and save/restore is not
+// supported.
+
+// DefaultDeterministicQuantum is the default amount of virtual time that
+// elapses each time a task is scheduled in deterministic mode.
+const DefaultDeterministicQuantum = 10 * time.Microsecond
+
+const (
+	// detSettleDelay is how long the scheduler waits, once no task can run,
+	// for wakeups from outside of the tasks before skipping virtual time to
+	// the next timer expiration.
+	detSettleDelay = time.Millisecond
+
+	// detStallTimeout is how long the scheduler waits without progress
+	// before reporting a stall.
+	detStallTimeout = 5 * time.Second
+)
+
+// DeterministicOptions configures deterministic execution, see
+// InitKernelArgs.Deterministic.
+type DeterministicOptions struct {
+	// Quantum is the virtual time that elapses each time a task is scheduled.
+	// If 0, DefaultDeterministicQuantum is used.
+	Quantum time.Duration
+
+	// Seed seeds the randomness visible to the application, which is
+	// rand.NewDeterministicReader(Seed, 0). Callers may use other stream
+	// numbers for other randomness that must be reproducible.
+	Seed uint64
+
+	// Record, if not nil, receives the schedule log events following the
+	// header, which the caller must write with WriteScheduleLogHeader.
+	Record io.Writer
+
+	// Replay, if not empty, are the events of a schedule log to replay. Once
+	// they are exhausted, or if the execution diverges from them, the
+	// scheduler continues without replay.
+	Replay []ScheduleEvent
+}
+
+// scheduleLogVersion is the version of the schedule log format.
+const scheduleLogVersion = 2
+
+// ScheduleLogHeader is the first record of a schedule log. It holds the
+// inputs of a deterministic execution other than the schedule itself, which
+// must be the same for its replay.
+type ScheduleLogHeader struct {
+	// Version is the version of the log format.
+	Version int `json:"version"`
+
+	// Seed is the random number generator's seed.
+	Seed uint64 `json:"seed"`
+
+	// RealtimeNS is the initial value of CLOCK_REALTIME in nanoseconds.
+	RealtimeNS int64 `json:"realtimeNS"`
+}
+
+// ScheduleEvent is a record of a schedule log following its header.
+type ScheduleEvent struct {
+	// Step is the number of times a task was scheduled before the event.
+	Step uint64 `json:"step"`
+
+	// TID, if not 0, is the thread ID in the root PID namespace of the task
+	// that was scheduled. Scheduling decisions are only recorded if they
+	// didn't let the task that made a system call continue.
+	TID ThreadID `json:"tid,omitempty"`
+
+	// AdvanceNS, if not 0, is the virtual monotonic time that the clocks
+	// skipped to because no task could run.
+	AdvanceNS int64 `json:"advanceNS,omitempty"`
+
+	// Input, if not empty, is the source of an external input that was read
+	// by the task holding the run token, or delivered asynchronously if Async
+	// is true. Result is the input.
+	Input  string         `json:"input,omitempty"`
+	Async  bool           `json:"async,omitempty"`
+	Result *ExternalInput `json:"result,omitempty"`
+}
+
+// ExternalInput is an input to a deterministic execution from outside of the
+// sandbox. The meaning of its fields is defined by its source.
+type ExternalInput struct {
+	// Data is the data that was read, e.g. from a host file.
+	Data []byte `json:"data,omitempty"`
+
+	// Aux holds additional variable-length results, e.g. a socket address.
+	Aux [][]byte `json:"aux,omitempty"`
+
+	// Args holds scalar results, e.g. flags.
+	Args []int64 `json:"args,omitempty"`
+
+	// Errno and EOF are the error returned by the read, see Err.
+	Errno unix.Errno `json:"errno,omitempty"`
+	EOF   bool       `json:"eof,omitempty"`
+}
+
+// NewExternalInput returns an ExternalInput for data read with error err,
+// which should be nil, io.EOF, a unix.Errno or a linuxerr error. Other errors
+// are recorded as EIO.
+func NewExternalInput(data []byte, err error) ExternalInput {
+	in := ExternalInput{Data: data}
+	switch e := err.(type) {
+	case nil:
+	case unix.Errno:
+		in.Errno = e
+	case *errors.Error:
+		in.Errno = linuxerr.ToUnix(e)
+	default:
+		if err == io.EOF {
+			in.EOF = true
+		} else {
+			in.Errno = unix.EIO
+		}
+	}
+	return in
+}
+
+// Err returns the error recorded in in. linuxerr errors are returned as the
+// equivalent unix.Errno, which linuxerr.Equals treats the same.
+func (in *ExternalInput) Err() error {
+	switch {
+	case in.EOF:
+		return io.EOF
+	case in.Errno != 0:
+		return in.Errno
+	default:
+		return nil
+	}
+}
+
+// WriteScheduleLogHeader writes the header of a schedule log to w, which may
+// then be passed as DeterministicOptions.Record.
+func WriteScheduleLogHeader(w io.Writer, h ScheduleLogHeader) error {
+	h.Version = scheduleLogVersion
+	return json.NewEncoder(w).Encode(&h)
+}
+
+// ReadScheduleLog reads a schedule log written by a sandbox in deterministic
+// mode.
+func ReadScheduleLog(r io.Reader) (ScheduleLogHeader, []ScheduleEvent, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var h ScheduleLogHeader
+	if err := dec.Decode(&h); err != nil {
+		return h, nil, fmt.Errorf("reading schedule log header: %w", err)
+	}
+	if h.Version != scheduleLogVersion {
+		return h, nil, fmt.Errorf("unsupported schedule log version %d, want %d", h.Version, scheduleLogVersion)
+	}
+	var events []ScheduleEvent
+	for dec.More() {
+		var e ScheduleEvent
+		if err := dec.Decode(&e); err != nil {
+			return h, nil, fmt.Errorf("reading schedule log event %d: %w", len(events), err)
+		}
+		if e.Input != "" && e.Result == nil {
+			return h, nil, fmt.Errorf("schedule log event %d has input %q without a result", len(events), e.Input)
+		}
+		events = append(events, e)
+	}
+	return h, events, nil
+}
+
+// detTask is a task's state in a detScheduler.
+type detTask struct {
+	t   *Task
+	tid ThreadID
+
+	// grant receives a value when the task is given the run token.
+	grant chan struct{}
+
+	// wake receives a value when the scheduler wakes the task from Task.block
+	// during replay, see detScheduler.wakeLocked.
+	wake chan struct{}
+
+	// released is the number of calls to release without a matching call to
+	// acquire. Only the outermost pair gives up and waits for the run token,
+	// since e.g. a task may block in an uninterruptible sleep.
+	released int
+
+	// requesting is true if the task is waiting for the run token.
+	requesting bool
+
+	// If blocked is true, the task is blocked in Task.block on c and timerC,
+	// and may be given the run token once they are readable.
+	blocked bool
+	c       <-chan struct{}
+	timerC  <-chan struct{}
+}
+
+// runnable returns true if dt may be given the run token.
+//
+// Preconditions: detScheduler.mu must be locked.
+func (dt *detTask) runnable() bool {
+	if dt.requesting {
+		return true
+	}
+	// Task.block's channels are buffered, so a pending wakeup is visible
+	// without consuming it.
+	return dt.blocked && (len(dt.c) != 0 || len(dt.timerC) != 0 || len(dt.wake) != 0 || len(dt.t.interruptChan) != 0)
+}
+
+// detInput is an asynchronous external input waiting to be delivered.
+type detInput struct {
+	source string
+	in     ExternalInput
+}
+
+// detScheduler schedules tasks in deterministic mode.
+type detScheduler struct {
+	tk      *Timekeeper
+	quantum time.Duration
+
+	// rand provides the application's randomness. It is immutable.
+	rand io.Reader
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// holder is the task holding the run token, or nil if no task holds
+	// it. It is detIdle while the scheduler is skipping virtual time or
+	// delivering inputs.
+	holder *detTask
+
+	// tasks are all started tasks, sorted by tid.
+	tasks []*detTask
+
+	// byTask maps tasks to their entry in tasks.
+	byTask map[*Task]*detTask
+
+	// step is the number of times the run token was given to a task.
+	step uint64
+
+	// last is the tid of the task that was last given the run token.
+	last ThreadID
+
+	// idleTimerArmed is true if idleTimer is armed.
+	idleTimerArmed bool
+	idleTimer      *time.Timer
+
+	// sources maps the names of asynchronous input sources to the functions
+	// that deliver their inputs, see Kernel.DeterministicSource.
+	sources map[string]func(ExternalInput)
+
+	// pending are the asynchronous inputs waiting to be delivered.
+	pending []detInput
+
+	// record receives schedule events, if not nil.
+	record *json.Encoder
+
+	// replay are the remaining events to replay.
+	replay []ScheduleEvent
+}
+
+// detIdle is detScheduler.holder while the scheduler skips virtual time or
+// delivers inputs.
+var detIdle = &detTask{}
+
+// newDetScheduler returns a detScheduler for tasks using tk's virtual clocks.
+func newDetScheduler(tk *Timekeeper, opts *DeterministicOptions) (*detScheduler, error) {
+	if tk.virtual == nil {
+		return nil, fmt.Errorf("deterministic execution requires virtual clocks")
+	}
+	s := &detScheduler{
+		tk:      tk,
+		quantum: opts.Quantum,
+		rand:    rand.NewDeterministicReader(opts.Seed, 0),
+		byTask:  make(map[*Task]*detTask),
+		sources: make(map[string]func(ExternalInput)),
+		replay:  opts.Replay,
+	}
+	if s.quantum == 0 {
+		s.quantum = DefaultDeterministicQuantum
+	}
+	if opts.Record != nil {
+		s.record = json.NewEncoder(opts.Record)
+	}
+	s.idleTimer = time.AfterFunc(time.Duration(1<<63-1), s.idle)
+	s.idleTimer.Stop()
+	go s.watch() // S/R-SAFE: deterministic mode doesn't support save/restore.
+	return s, nil
+}
+
+// add registers t, which has thread ID tid in the root PID namespace, as
+// waiting for the run token. It is called by Task.Start rather than by t's
+// task goroutine, so that t can be scheduled regardless of when its task
+// goroutine starts; the task goroutine then calls acquire.
+func (s *detScheduler) add(t *Task, tid ThreadID) {
+	dt := &detTask{
+		t:     t,
+		tid:   tid,
+		grant: make(chan struct{}, 1),
+		wake:  make(chan struct{}, 1),
+		// Paired with the task goroutine's call to acquire.
+		released:   1,
+		requesting: true,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := sort.Search(len(s.tasks), func(i int) bool { return s.tasks[i].tid >= dt.tid })
+	s.tasks = append(s.tasks, nil)
+	copy(s.tasks[i+1:], s.tasks[i:])
+	s.tasks[i] = dt
+	s.byTask[t] = dt
+}
+
+// exit unregisters t, releasing the run token if it holds it. It is called by
+// t's task goroutine when it exits.
+func (s *detScheduler) exit(t *Task) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dt := s.byTask[t]
+	delete(s.byTask, t)
+	for i, odt := range s.tasks {
+		if odt == dt {
+			s.tasks = append(s.tasks[:i], s.tasks[i+1:]...)
+			break
+		}
+	}
+	if s.holder == dt {
+		s.deliverLocked()
+		s.holder = nil
+		s.scheduleLocked(nil)
+	}
+}
+
+// release gives up the run token held by t. If c or timerC are not nil, t is
+// about to block on them in Task.block, and may be given the run token again
+// as soon as they are readable. Task.block must also return when the returned
+// channel is readable.
+func (s *detScheduler) release(t *Task, c, timerC <-chan struct{}) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dt := s.byTask[t]
+	dt.released++
+	if dt.released > 1 {
+		return dt.wake
+	}
+	// Discard a wakeup that raced with another one, so that it doesn't end
+	// the next Task.block early.
+	select {
+	case <-dt.wake:
+	default:
+	}
+	if s.holder == dt {
+		s.deliverLocked()
+	}
+	s.holder = nil
+	if c != nil || timerC != nil {
+		dt.blocked = true
+		dt.c = c
+		dt.timerC = timerC
+	}
+	s.scheduleLocked(nil)
+	return dt.wake
+}
+
+// acquire waits until t, which gave up the run token with release, is given
+// the run token again.
+func (s *detScheduler) acquire(t *Task) {
+	s.mu.Lock()
+	dt := s.byTask[t]
+	dt.released--
+	if dt.released > 0 {
+		s.mu.Unlock()
+		return
+	}
+	if s.holder != dt {
+		// Not already given the run token while blocked.
+		dt.blocked = false
+		dt.c = nil
+		dt.timerC = nil
+		dt.requesting = true
+		if s.holder == nil {
+			if len(s.replay) != 0 {
+				s.scheduleLocked(nil)
+			} else {
+				// t was woken from outside of the tasks; wait for other
+				// such wakeups before choosing the next task.
+				s.armIdleTimerLocked()
+			}
+		}
+	}
+	s.mu.Unlock()
+	s.wait(dt)
+}
+
+// yield gives other tasks a chance to run. t must hold the run token.
+func (s *detScheduler) yield(t *Task) {
+	s.mu.Lock()
+	dt := s.byTask[t]
+	s.deliverLocked()
+	dt.requesting = true
+	s.holder = nil
+	s.scheduleLocked(dt)
+	s.mu.Unlock()
+	s.wait(dt)
+}
+
+// wait waits for dt to be given the run token, and advances time for its
+// execution.
+func (s *detScheduler) wait(dt *detTask) {
+	<-dt.grant
+	// dt has exclusive use of the clocks, so this delivers expirations at
+	// the same point of every execution.
+	s.tk.advanceVirtual(s.quantum)
+}
+
+// read returns the synchronous input from source that is read by the task
+// holding the run token, which is read by calling read unless it is replayed.
+func (s *detScheduler) read(source string, read func() ExternalInput) ExternalInput {
+	s.mu.Lock()
+	if len(s.replay) != 0 {
+		e := s.replay[0]
+		if e.Input == source && !e.Async && e.Step == s.step {
+			s.replay = s.replay[1:]
+			s.mu.Unlock()
+			return *e.Result
+		}
+		s.divergeLocked(fmt.Sprintf("unexpected input from %s", source))
+	}
+	// The caller holds the run token, so s.step doesn't change.
+	s.mu.Unlock()
+	in := read()
+	s.mu.Lock()
+	s.recordLocked(ScheduleEvent{Step: s.step, Input: source, Result: &in})
+	s.mu.Unlock()
+	return in
+}
+
+// addSource registers deliver as the function that delivers the asynchronous
+// inputs from source.
+func (s *detScheduler) addSource(source string, deliver func(ExternalInput)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sources[source] = deliver
+}
+
+// queue queues an asynchronous input from source for delivery. Live inputs
+// are discarded during replay, since the recorded inputs are delivered
+// instead.
+func (s *detScheduler) queue(source string, in ExternalInput) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.replay) != 0 {
+		return
+	}
+	s.pending = append(s.pending, detInput{source: source, in: in})
+	if s.holder == nil {
+		s.armIdleTimerLocked()
+	}
+}
+
+// deliverLocked delivers the asynchronous inputs that are due, with s.mu
+// unlocked while each is delivered. It returns true if it delivered any.
+//
+// Preconditions:
+//   - s.mu must be locked.
+//   - s.holder must not be nil, so that no task runs during delivery.
+func (s *detScheduler) deliverLocked() bool {
+	delivered := false
+	for {
+		var in detInput
+		if len(s.replay) != 0 {
+			e := s.replay[0]
+			if !e.Async || e.Step != s.step {
+				return delivered
+			}
+			if _, ok := s.sources[e.Input]; !ok {
+				s.divergeLocked(fmt.Sprintf("unknown input source %s", e.Input))
+				return delivered
+			}
+			s.replay = s.replay[1:]
+			in = detInput{source: e.Input, in: *e.Result}
+		} else {
+			if len(s.pending) == 0 {
+				return delivered
+			}
+			in = s.pending[0]
+			s.pending = s.pending[1:]
+			s.recordLocked(ScheduleEvent{Step: s.step, Input: in.source, Async: true, Result: &in.in})
+		}
+		deliver := s.sources[in.source]
+		s.mu.Unlock()
+		deliver(in.in)
+		s.mu.Lock()
+		delivered = true
+	}
+}
+
+// scheduleLocked gives the run token to the next task, if any can run.
+// yielder is the task that gave up the run token in yield, if any.
+//
+// Preconditions:
+//   - s.mu must be locked.
+//   - s.holder must be nil.
+func (s *detScheduler) scheduleLocked(yielder *detTask) {
+	if len(s.replay) != 0 {
+		s.replayLocked(yielder)
+		return
+	}
+	var next *detTask
+	for _, dt := range s.tasks {
+		if !dt.runnable() {
+			continue
+		}
+		if next == nil {
+			// Wrap around if no task after s.last can run.
+			next = dt
+		}
+		if dt.tid > s.last {
+			next = dt
+			break
+		}
+	}
+	if next == nil {
+		s.armIdleTimerLocked()
+		return
+	}
+	s.grantLocked(next, yielder)
+}
+
+// replayLocked gives the run token to the task recorded in s.replay.
+//
+// Preconditions: As for scheduleLocked, and s.replay must not be empty.
+func (s *detScheduler) replayLocked(yielder *detTask) {
+	e := s.replay[0]
+	if e.Step < s.step || (e.Step == s.step && e.Input != "" && !e.Async) {
+		s.divergeLocked(fmt.Sprintf("event for step %d not replayed", e.Step))
+		s.scheduleLocked(yielder)
+		return
+	}
+	if e.Step > s.step {
+		// The recorded execution let the task that made a system call
+		// continue.
+		if yielder != nil {
+			s.grantLocked(yielder, yielder)
+		}
+		// Otherwise, wait for the task of the next event to be woken up.
+		return
+	}
+	if e.AdvanceNS != 0 || e.Async {
+		// The recorded execution was idle here.
+		s.armIdleTimerLocked()
+		return
+	}
+	for _, dt := range s.tasks {
+		if dt.tid == e.TID {
+			if dt.runnable() {
+				s.replay = s.replay[1:]
+				s.grantLocked(dt, yielder)
+			} else {
+				// Wait for it to be woken up, or wake it if that doesn't
+				// happen.
+				s.armIdleTimerLocked()
+			}
+			return
+		}
+	}
+	// The task may not have started yet.
+}
+
+// wakeLocked wakes the task with the given tid if it is blocked in
+// Task.block on an event that didn't occur. This is used during replay, since
+// the event may have been caused by a recorded input that is replayed without
+// making the host ready.
+//
+// Preconditions: s.mu must be locked.
+func (s *detScheduler) wakeLocked(tid ThreadID) {
+	for _, dt := range s.tasks {
+		if dt.tid != tid {
+			continue
+		}
+		// Tasks that only wait for a timer are woken by virtual time.
+		if dt.blocked && dt.c != nil && !dt.runnable() {
+			dt.wake <- struct{}{}
+		}
+		return
+	}
+}
+
+// divergeLocked stops replay, which no longer matches the execution.
+//
+// Preconditions: s.mu must be locked.
+func (s *detScheduler) divergeLocked(reason string) {
+	log.Warningf("Deterministic: execution diverged from the replayed schedule at step %d (%s), continuing without replay", s.step, reason)
+	s.replay = nil
+}
+
+// grantLocked gives the run token to dt.
+//
+// Preconditions: s.mu must be locked.
+func (s *detScheduler) grantLocked(dt, yielder *detTask) {
+	if dt != yielder {
+		s.recordLocked(ScheduleEvent{Step: s.step, TID: dt.tid})
+	}
+	s.holder = dt
+	s.step++
+	s.last = dt.tid
+	dt.requesting = false
+	dt.blocked = false
+	dt.c = nil
+	dt.timerC = nil
+	dt.grant <- struct{}{}
+}
+
+// recordLocked writes e to the schedule log, if any.
+//
+// Preconditions: s.mu must be locked.
+func (s *detScheduler) recordLocked(e ScheduleEvent) {
+	if s.record == nil {
+		return
+	}
+	if err := s.record.Encode(&e); err != nil {
+		log.Warningf("Deterministic: failed to write the schedule log, no longer recording: %v", err)
+		s.record = nil
+	}
+}
+
+// armIdleTimerLocked arms s.idleTimer, if it isn't armed already.
+//
+// Preconditions: s.mu must be locked.
+func (s *detScheduler) armIdleTimerLocked() {
+	if s.idleTimerArmed {
+		return
+	}
+	s.idleTimerArmed = true
+	s.idleTimer.Reset(detSettleDelay)
+}
+
+// idle is called by s.idleTimer when no task held the run token for
+// detSettleDelay. It delivers pending inputs, then gives the run token to the
+// next task that can run, or if none can, skips virtual time to the next
+// timer expiration.
+func (s *detScheduler) idle() {
+	s.mu.Lock()
+	s.idleTimerArmed = false
+	if s.holder != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.holder = detIdle
+	delivered := s.deliverLocked()
+	s.holder = nil
+	if delivered && len(s.replay) == 0 {
+		// Wait for the wakeups caused by the inputs before choosing the
+		// next task.
+		s.armIdleTimerLocked()
+		s.mu.Unlock()
+		return
+	}
+	var (
+		to int64
+		ok bool
+	)
+	if len(s.replay) != 0 {
+		e := s.replay[0]
+		switch {
+		case e.Step == s.step && e.AdvanceNS != 0:
+			s.replay = s.replay[1:]
+			to, ok = e.AdvanceNS, true
+		case e.Step == s.step && e.TID != 0:
+			s.wakeLocked(e.TID)
+		}
+	} else {
+		for _, dt := range s.tasks {
+			if dt.runnable() {
+				s.scheduleLocked(nil)
+				s.mu.Unlock()
+				return
+			}
+		}
+		to, ok = s.tk.virtual.NextDeadline()
+	}
+	if !ok {
+		// Wait for a wakeup from outside of the tasks.
+		s.scheduleLocked(nil)
+		s.mu.Unlock()
+		return
+	}
+	s.recordLocked(ScheduleEvent{Step: s.step, AdvanceNS: to})
+	// Prevent tasks from running while timers are notified.
+	s.holder = detIdle
+	s.mu.Unlock()
+
+	s.tk.advanceVirtualTo(to)
+
+	s.mu.Lock()
+	s.holder = nil
+	s.scheduleLocked(nil)
+	s.mu.Unlock()
+}
+
+// watch reports stalls, and stops replay if it is stuck waiting for a task
+// that doesn't wake up.
+func (s *detScheduler) watch() {
+	var lastStep uint64
+	for range time.Tick(detStallTimeout) {
+		s.mu.Lock()
+		if s.step == lastStep {
+			s.checkStallLocked()
+		}
+		lastStep = s.step
+		s.mu.Unlock()
+	}
+}
+
+// checkStallLocked is called when no task was scheduled for detStallTimeout.
+//
+// Preconditions: s.mu must be locked.
+func (s *detScheduler) checkStallLocked() {
+	waiting := 0
+	for _, dt := range s.tasks {
+		if dt != s.holder && dt.runnable() {
+			waiting++
+		}
+	}
+	switch {
+	case s.holder == nil && len(s.replay) != 0 && waiting != 0:
+		s.divergeLocked(fmt.Sprintf("event for step %d isn't reached", s.replay[0].Step))
+		s.scheduleLocked(nil)
+	case s.holder != nil && s.holder != detIdle && waiting != 0:
+		log.Warningf("Deterministic: task %d has run for over %v without yielding, %d tasks are waiting", s.holder.tid, detStallTimeout, waiting)
+	}
+}
+
+// Deterministic returns true if k runs in deterministic mode, see
+// InitKernelArgs.Deterministic.
+func (k *Kernel) Deterministic() bool {
+	return k.det != nil
+}
+
+// GuestRand returns the source of the application's randomness, see package
+// guestrand.
+func (k *Kernel) GuestRand() io.Reader {
+	if k.det != nil {
+		return k.det.rand
+	}
+	return rand.Reader
+}
+
+// DeterministicRead returns the input from source that is read by calling
+// read. In deterministic mode, the input is recorded to the schedule log, or
+// replayed from it without calling read.
+//
+// It must be called by a task goroutine, since it relies on the task holding
+// the run token to order the input with respect to the execution.
+func (k *Kernel) DeterministicRead(source string, read func() ExternalInput) ExternalInput {
+	if k.det == nil {
+		return read()
+	}
+	return k.det.read(source, read)
+}
+
+// DeterministicSource returns a function that delivers the inputs from source,
+// which arrive asynchronously, by calling deliver. In deterministic mode,
+// inputs are only delivered while no task runs, and are recorded to the
+// schedule log, or replayed from it in place of the inputs that arrive.
+//
+// source must be unique in k, and the same in the recorded and replayed
+// executions.
+func (k *Kernel) DeterministicSource(source string, deliver func(ExternalInput)) func(ExternalInput) {
+	if k.det == nil {
+		return deliver
+	}
+	k.det.addSource(source, deliver)
+	return func(in ExternalInput) {
+		k.det.queue(source, in)
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	sentrytime "gvisor.dev/gvisor/pkg/sentry/time"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// detTestRounds is the number of rounds of each task in detTestWorkload.
+const detTestRounds = 5
+
+// detTestWorkload runs fake tasks on a detScheduler. The tasks only interact
+// with the scheduler, as Task.run and Task.block do, and log what they do
+// while holding the run token.
+type detTestWorkload struct {
+	s *detScheduler
+
+	mu  sync.Mutex
+	log []string
+}
+
+func newDetTestWorkload(t *testing.T, opts *DeterministicOptions) *detTestWorkload {
+	tk := &Timekeeper{virtual: sentrytime.NewVirtualClocks(0)}
+	s, err := newDetScheduler(tk, opts)
+	if err != nil {
+		t.Fatalf("newDetScheduler failed: %v", err)
+	}
+	return &detTestWorkload{s: s}
+}
+
+func (w *detTestWorkload) logf(format string, args ...any) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.log = append(w.log, fmt.Sprintf(format, args...))
+}
+
+// block blocks t until c is readable, as Task.block does. Like Task.block, it
+// may return early if the scheduler wakes t.
+func (w *detTestWorkload) block(t *Task, c chan struct{}) {
+	wake := w.s.release(t, c, nil)
+	select {
+	case <-c:
+	case <-wake:
+	}
+	w.s.acquire(t)
+}
+
+// run runs the workload and returns the log of the tasks' actions. In the
+// workload, tasks 1 and 3 make system calls a random number of times and wake
+// each other in turns, while task 2 reads detTestRounds inputs from outside
+// of the sandbox, blocking until more are ready if there are none. send is
+// called before the tasks start to send the inputs.
+func (w *detTestWorkload) run(send func(inputs chan<- int64, ready chan<- struct{})) []string {
+	var (
+		t1, t2, t3 Task
+		wg         sync.WaitGroup
+		c1         = make(chan struct{}, 1)
+		c3         = make(chan struct{}, 1)
+		inputs     = make(chan int64, detTestRounds)
+		ready      = make(chan struct{}, 1)
+	)
+	goTask := func(t *Task, tid ThreadID, body func()) {
+		w.s.add(t, tid)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.s.acquire(t)
+			body()
+			w.s.exit(t)
+		}()
+	}
+	syscalls := func(t *Task, tid ThreadID) {
+		var b [1]byte
+		if _, err := io.ReadFull(w.s.rand, b[:]); err != nil {
+			panic(err)
+		}
+		for i := 0; i < int(b[0]%4); i++ {
+			w.logf("%d: syscall", tid)
+			w.s.yield(t)
+		}
+	}
+
+	send(inputs, ready)
+	goTask(&t1, 1, func() {
+		for i := 0; i < detTestRounds; i++ {
+			syscalls(&t1, 1)
+			w.logf("1: wake 3")
+			c3 <- struct{}{}
+			w.block(&t1, c1)
+		}
+	})
+	goTask(&t2, 2, func() {
+		for i := 0; i < detTestRounds; {
+			in := w.s.read("test", func() ExternalInput {
+				select {
+				case v := <-inputs:
+					return ExternalInput{Args: []int64{v}}
+				default:
+					return NewExternalInput(nil, unix.EAGAIN)
+				}
+			})
+			if in.Err() != nil {
+				w.block(&t2, ready)
+				continue
+			}
+			w.logf("2: input %d", in.Args[0])
+			i++
+		}
+	})
+	goTask(&t3, 3, func() {
+		for i := 0; i < detTestRounds; i++ {
+			w.block(&t3, c3)
+			syscalls(&t3, 3)
+			w.logf("3: wake 1")
+			c1 <- struct{}{}
+		}
+	})
+	wg.Wait()
+	return w.log
+}
+
+// sendImmediately makes all inputs ready before the tasks start.
+func sendImmediately(inputs chan<- int64, ready chan<- struct{}) {
+	for i := int64(0); i < detTestRounds; i++ {
+		inputs <- i
+	}
+	ready <- struct{}{}
+}
+
+// sendAtRandomTimes makes the inputs ready one by one at random times.
+func sendAtRandomTimes(inputs chan<- int64, ready chan<- struct{}) {
+	go func() {
+		for i := int64(0); i < detTestRounds; i++ {
+			time.Sleep(time.Duration(rand.Intn(3000)) * time.Microsecond)
+			inputs <- i
+			select {
+			case ready <- struct{}{}:
+			default:
+			}
+		}
+	}()
+}
+
+// sendNothing doesn't send any inputs.
+func sendNothing(chan<- int64, chan<- struct{}) {}
+
+// TestDeterministicScheduleSameSeed checks that executions with the same seed
+// and no inputs arriving asynchronously have the same schedule.
+func TestDeterministicScheduleSameSeed(t *testing.T) {
+	run := func(seed uint64) (string, []string) {
+		var record bytes.Buffer
+		w := newDetTestWorkload(t, &DeterministicOptions{Seed: seed, Record: &record})
+		log := w.run(sendImmediately)
+		return record.String(), log
+	}
+	for seed := uint64(1); seed <= 3; seed++ {
+		schedule1, log1 := run(seed)
+		schedule2, log2 := run(seed)
+		if schedule1 != schedule2 {
+			t.Errorf("seed %d: got different schedules:\n%s\nand:\n%s", seed, schedule1, schedule2)
+		}
+		if !reflect.DeepEqual(log1, log2) {
+			t.Errorf("seed %d: got different executions:\n%q\nand:\n%q", seed, log1, log2)
+		}
+	}
+}
+
+// TestDeterministicReplay checks that replaying the schedule log of an
+// execution whose inputs arrived at random times reproduces it, without the
+// inputs arriving again.
+func TestDeterministicReplay(t *testing.T) {
+	for i := 0; i < 5; i++ {
+		var record bytes.Buffer
+		if err := WriteScheduleLogHeader(&record, ScheduleLogHeader{Seed: 1}); err != nil {
+			t.Fatalf("WriteScheduleLogHeader failed: %v", err)
+		}
+		w := newDetTestWorkload(t, &DeterministicOptions{Seed: 1, Record: &record})
+		want := w.run(sendAtRandomTimes)
+
+		h, events, err := ReadScheduleLog(&record)
+		if err != nil {
+			t.Fatalf("ReadScheduleLog failed: %v", err)
+		}
+		w = newDetTestWorkload(t, &DeterministicOptions{Seed: h.Seed, Replay: events})
+		if got := w.run(sendNothing); !reflect.DeepEqual(got, want) {
+			t.Errorf("replay got execution:\n%q\nwant:\n%q", got, want)
+		}
+	}
+}
+
+// TestDeterministicGuestRand checks that the application's randomness only
+// depends on the seed.
+func TestDeterministicGuestRand(t *testing.T) {
+	read := func(seed uint64) []byte {
+		k := &Kernel{det: newDetTestWorkload(t, &DeterministicOptions{Seed: seed}).s}
+		b := make([]byte, 32)
+		if _, err := io.ReadFull(k.GuestRand(), b); err != nil {
+			t.Fatalf("ReadFull failed: %v", err)
+		}
+		return b
+	}
+	if a, b := read(1), read(1); !bytes.Equal(a, b) {
+		t.Errorf("same seed returned different randomness: %x != %x", a, b)
+	}
+	if a, b := read(1), read(2); bytes.Equal(a, b) {
+		t.Errorf("different seeds returned the same randomness: %x", a)
+	}
+}
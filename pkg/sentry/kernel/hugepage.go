@@ -0,0 +1,68 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+)
+
+const (
+	// hugepageCollapseTicks is the number of CPU clock ticks between
+	// background huge page collapse scans, like Linux's
+	// /sys/kernel/mm/transparent_hugepage/khugepaged/scan_sleep_millisecs.
+	hugepageCollapseTicks = uint64(10 * time.Second / linux.ClockTick)
+
+	// hugepageCollapseBudget is the number of huge page-sized ranges examined
+	// in each MemoryManager per scan. Linux's equivalent,
+	// /sys/kernel/mm/transparent_hugepage/khugepaged/pages_to_scan, is shared
+	// by all processes and defaults to 8 huge pages.
+	hugepageCollapseBudget = 64
+)
+
+// scheduleHugepageCollapse arranges for a running task in each of tgs to
+// perform background huge page collapse on its MemoryManager, if enabled.
+// Only thread groups with tasks running application code are scanned, since
+// memory that isn't being used doesn't benefit from huge pages.
+//
+// Scans run as task work, rather than on the CPU clock ticker's goroutine, so
+// that they are serialized with save/restore like other memory management
+// operations, and are charged to the task's memory cgroup.
+func (k *Kernel) scheduleHugepageCollapse(tgs []*ThreadGroup) {
+	k.tasks.mu.RLock()
+	defer k.tasks.mu.RUnlock()
+	for _, tg := range tgs {
+		for t := tg.tasks.Front(); t != nil; t = t.Next() {
+			if t.TaskGoroutineSchedInfo().State == TaskGoroutineRunningApp {
+				t.RegisterWork(hugepageCollapseWork{})
+				break
+			}
+		}
+	}
+}
+
+// hugepageCollapseWork is a TaskWorker that performs background huge page
+// collapse on the task's MemoryManager.
+//
+// +stateify savable
+type hugepageCollapseWork struct{}
+
+// TaskWork implements TaskWorker.TaskWork.
+func (hugepageCollapseWork) TaskWork(t *Task) {
+	if mm := t.MemoryManager(); mm != nil {
+		mm.CollapseHugepages(t, t.k.hugepageCollapse, hugepageCollapseBudget)
+	}
+}
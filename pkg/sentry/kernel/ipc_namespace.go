@@ -143,6 +143,31 @@ func (t *Task) IPCNamespace() *IPCNamespace {
 	return t.ipcns
 }
 
+// SemUndoList returns the task's SysV semaphore adjust-on-exit values,
+// allocating them if needed.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) SemUndoList() *semaphore.UndoList {
+	if t.semUndo == nil {
+		t.semUndo = semaphore.NewUndoList()
+	}
+	return t.semUndo
+}
+
+// releaseSemUndoList drops the task's reference on its SysV semaphore
+// adjust-on-exit values. If this is the last reference, the adjustments are
+// applied.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) releaseSemUndoList() {
+	if t.semUndo == nil {
+		return
+	}
+	pid := t.k.tasks.Root.IDOfThreadGroup(t.tg)
+	t.semUndo.DecRef(t, int32(pid))
+	t.semUndo = nil
+}
+
 // GetIPCNamespace takes a reference on the task IPC namespace and
 // returns it. It will return nil if the task isn't alive.
 func (t *Task) GetIPCNamespace() *IPCNamespace {
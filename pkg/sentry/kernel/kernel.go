@@ -34,6 +34,8 @@ package kernel
 import (
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"path/filepath"
 	"time"
 
@@ -54,6 +56,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/sockfs"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/timerfd"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/tmpfs"
+	"gvisor.dev/gvisor/pkg/sentry/guestrand"
 	"gvisor.dev/gvisor/pkg/sentry/hostcpu"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
@@ -139,6 +142,10 @@ type Kernel struct {
 	// mf provides application memory.
 	mf *pgalloc.MemoryFile `state:"nosave"`
 
+	// precopy is the pre-copy of mf in progress, if any. precopy is protected
+	// by extMu.
+	precopy *pgalloc.Precopy `state:"nosave"`
+
 	// See InitKernelArgs for the meaning of these fields.
 	featureSet           cpuid.FeatureSet
 	timekeeper           *Timekeeper
@@ -237,6 +244,10 @@ type Kernel struct {
 	// netlinkPorts manages allocation of netlink socket port IDs.
 	netlinkPorts *port.Manager
 
+	// procEvents holds listeners for process events reported by the
+	// NETLINK_CONNECTOR process events connector.
+	procEvents procEventListeners
+
 	// saveStatus is nil if the sandbox has not been saved, errSaved or
 	// errAutoSaved if it has been saved successfully, or the error causing the
 	// sandbox to exit during save.
@@ -262,6 +273,30 @@ type Kernel struct {
 	// syscall.
 	unimplementedSyscallEmitter eventchannel.Emitter `state:"nosave"`
 
+	// compat accumulates the compatibility report, which is not preserved
+	// across save/restore.
+	compat compatReport `state:"nosave"`
+
+	// recoverSyscallPanics is InitKernelArgs.RecoverSyscallPanics. It is
+	// immutable after Init.
+	recoverSyscallPanics bool
+
+	// hugepageCollapse is InitKernelArgs.HugepageCollapse. It is immutable
+	// after Init.
+	hugepageCollapse mm.HugepageCollapseMode
+
+	// hostTimeSync is InitKernelArgs.HostTimeSync. It is immutable after
+	// Init.
+	hostTimeSync bool
+
+	// det schedules tasks if InitKernelArgs.Deterministic is set, and is nil
+	// otherwise. It is immutable after Init.
+	det *detScheduler `state:"nosave"`
+
+	// syscallPanics holds the crash reports of recovered syscall panics,
+	// which are not preserved across save/restore.
+	syscallPanics syscallPanics `state:"nosave"`
+
 	// SpecialOpts contains special kernel options.
 	SpecialOpts
 
@@ -329,6 +364,18 @@ type Kernel struct {
 	// used by processes.
 	MaxFDLimit atomicbitops.Int32
 
+	// MaxMapCount is the maximum number of memory mappings that a process may
+	// have, as set by /proc/sys/vm/max_map_count.
+	MaxMapCount atomicbitops.Int32
+
+	// OvercommitMemory is the value of /proc/sys/vm/overcommit_memory. The
+	// sentry doesn't limit committed memory, so it is only reported back.
+	OvercommitMemory atomicbitops.Int32
+
+	// Swappiness is the value of /proc/sys/vm/swappiness. The sentry doesn't
+	// swap, so it is only reported back.
+	Swappiness atomicbitops.Int32
+
 	// devGofers maps container ID to its device gofer client.
 	devGofers   map[string]*devutil.GoferClient `state:"nosave"`
 	devGofersMu sync.Mutex                      `state:"nosave"`
@@ -381,6 +428,24 @@ type InitKernelArgs struct {
 	// used by processes.  If it is zero, the limit will be set to
 	// unlimited.
 	MaxFDLimit int32
+
+	// RecoverSyscallPanics causes sentry panics during syscall handling to
+	// kill the offending task with SIGSYS rather than the whole sandbox.
+	// Crash reports are available from Kernel.SyscallPanicReports.
+	RecoverSyscallPanics bool
+
+	// HugepageCollapse controls which application memory is collapsed into
+	// huge pages in the background, like Linux's khugepaged.
+	HugepageCollapse mm.HugepageCollapseMode
+
+	// HostTimeSync allows the sandbox to read the host's NTP synchronization
+	// state, which is reported by adjtimex(2) and Kernel.TimeSyncState.
+	HostTimeSync bool
+
+	// Deterministic, if not nil, enables deterministic execution, in which
+	// tasks run one at a time in a reproducible order on virtual clocks. It
+	// requires Timekeeper to use sentrytime.VirtualClocks.
+	Deterministic *DeterministicOptions
 }
 
 // Init initialize the Kernel with no tasks.
@@ -438,6 +503,20 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 		args.MaxFDLimit = MaxFdLimit
 	}
 	k.MaxFDLimit.Store(args.MaxFDLimit)
+	k.recoverSyscallPanics = args.RecoverSyscallPanics
+	k.hugepageCollapse = args.HugepageCollapse
+	k.hostTimeSync = args.HostTimeSync
+	if args.Deterministic != nil {
+		det, err := newDetScheduler(args.Timekeeper, args.Deterministic)
+		if err != nil {
+			return err
+		}
+		k.det = det
+	}
+	// Unlike Linux's default of 65530, don't limit the number of mappings
+	// unless the application asks for it.
+	k.MaxMapCount.Store(math.MaxInt32)
+	k.Swappiness.Store(60)
 
 	ctx := k.SupervisorContext()
 	if err := k.vfs.Init(ctx); err != nil {
@@ -558,6 +637,38 @@ func loadPrivateMFs(ctx context.Context, r wire.Reader) error {
 //
 // Preconditions: The kernel must be paused throughout the call to SaveTo.
 func (k *Kernel) SaveTo(ctx context.Context, w wire.Writer) error {
+	_, err := k.saveTo(ctx, w, false /* async */, false /* precopied */)
+	return err
+}
+
+// SaveToPrecopied is equivalent to SaveTo, except that application memory
+// written out by PrecopyRound and not written to since is omitted from the
+// saved state. It must be restored from the rounds' output by passing it to
+// LoadFrom in the pgalloc.CtxPrecopied value of its context. SaveToPrecopied
+// ends the pre-copy. If no pre-copy is in progress, SaveToPrecopied is
+// equivalent to SaveTo.
+//
+// Preconditions: The kernel must be paused throughout the call to
+// SaveToPrecopied.
+func (k *Kernel) SaveToPrecopied(ctx context.Context, w wire.Writer) error {
+	_, err := k.saveTo(ctx, w, false /* async */, true /* precopied */)
+	return err
+}
+
+// SaveToAsync saves the state of k to w. Unlike SaveTo, SaveToAsync only
+// saves kernel state and captures the set of memory pages to save before it
+// returns. The contents of those pages are written to w by the returned
+// function, which may be called after the kernel is resumed and must be
+// called exactly once. Writes to application memory in the meantime do not
+// affect the saved state.
+//
+// Preconditions: The kernel must be paused throughout the call to
+// SaveToAsync.
+func (k *Kernel) SaveToAsync(ctx context.Context, w wire.Writer) (func() error, error) {
+	return k.saveTo(ctx, w, true /* async */, false /* precopied */)
+}
+
+func (k *Kernel) saveTo(ctx context.Context, w wire.Writer, async, precopied bool) (func() error, error) {
 	saveStart := time.Now()
 
 	// Do not allow other Kernel methods to affect it while it's being saved.
@@ -574,7 +685,7 @@ func (k *Kernel) SaveTo(ctx context.Context, w wire.Writer) error {
 
 	// Discard unsavable mappings, such as those for host file descriptors.
 	if err := k.invalidateUnsavableMappings(ctx); err != nil {
-		return fmt.Errorf("failed to invalidate unsavable mappings: %v", err)
+		return nil, fmt.Errorf("failed to invalidate unsavable mappings: %v", err)
 	}
 
 	// Capture all private memory files.
@@ -584,7 +695,7 @@ func (k *Kernel) SaveTo(ctx context.Context, w wire.Writer) error {
 	// invalidateUnsavableMappings(), since dropping memory mappings may
 	// affect filesystem state (e.g. page cache reference counts).
 	if err := k.vfs.PrepareSave(vfsCtx); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Save the CPUID FeatureSet before the rest of the kernel so we can
@@ -594,7 +705,7 @@ func (k *Kernel) SaveTo(ctx context.Context, w wire.Writer) error {
 	// N.B. This will also be saved along with the full kernel save below.
 	cpuidStart := time.Now()
 	if _, err := state.Save(ctx, w, &k.featureSet); err != nil {
-		return err
+		return nil, err
 	}
 	log.Infof("CPUID save took [%s].", time.Since(cpuidStart))
 
@@ -613,44 +724,186 @@ func (k *Kernel) SaveTo(ctx context.Context, w wire.Writer) error {
 	kernelStart := time.Now()
 	stats, err := state.Save(ctx, w, k)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	log.Infof("Kernel save stats: %s", stats.String())
 	log.Infof("Kernel save took [%s].", time.Since(kernelStart))
 
+	if async {
+		writeMemory, err := k.startAsyncMemorySave(ctx, w, mfsToSave)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("Save took [%s] before memory files are written out.", time.Since(saveStart))
+		return writeMemory, nil
+	}
+
 	// Save the memory files' state.
 	memoryStart := time.Now()
-	if err := k.mf.SaveTo(ctx, w); err != nil {
-		return err
+	if precopied && k.precopy != nil {
+		p := k.precopy
+		k.precopy = nil
+		if err := p.SaveTo(ctx, w); err != nil {
+			return nil, err
+		}
+	} else if err := k.mf.SaveTo(ctx, w); err != nil {
+		return nil, err
 	}
 	if err := savePrivateMFs(ctx, w, mfsToSave); err != nil {
-		return err
+		return nil, err
 	}
 	log.Infof("Memory files save took [%s].", time.Since(memoryStart))
 
 	log.Infof("Overall save took [%s].", time.Since(saveStart))
 
-	return nil
+	return nil, nil
+}
+
+// startAsyncMemorySave starts asynchronous saves of k.mf and the private
+// memory files in mfsToSave, and returns a function that writes them to w in
+// the format written by SaveTo.
+//
+// Preconditions: The kernel must be paused.
+func (k *Kernel) startAsyncMemorySave(ctx context.Context, w wire.Writer, mfsToSave map[string]*pgalloc.MemoryFile) (func() error, error) {
+	var meta privateMemoryFileMetadata
+	mfs := []*pgalloc.MemoryFile{k.mf}
+	for fsID, mf := range mfsToSave {
+		meta.owners = append(meta.owners, fsID)
+		mfs = append(mfs, mf)
+	}
+	var saves []*pgalloc.AsyncSave
+	release := func() {
+		for _, s := range saves {
+			s.Release()
+		}
+	}
+	for _, mf := range mfs {
+		s, err := mf.StartAsyncSave(ctx)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		saves = append(saves, s)
+	}
+
+	// Existing AddressSpace mappings may allow writes to pages that are being
+	// saved. Remove them so that writes fault and are prepared for.
+	k.forEachMemoryManager(func(memMgr *mm.MemoryManager) error {
+		memMgr.PrepareAsyncSave()
+		return nil
+	})
+
+	return func() error {
+		defer release()
+		memoryStart := time.Now()
+		if err := saves[0].WriteTo(w); err != nil {
+			return err
+		}
+		// Private memory files follow their metadata, as in savePrivateMFs.
+		if _, err := state.Save(ctx, w, &meta); err != nil {
+			return err
+		}
+		for _, s := range saves[1:] {
+			if err := s.WriteTo(w); err != nil {
+				return err
+			}
+		}
+		log.Infof("Memory files save took [%s].", time.Since(memoryStart))
+		return nil
+	}, nil
+}
+
+// PrecopyRound writes the contents of application memory that has been
+// written to since the last call to PrecopyRound, or all of it on the first
+// call, to w in the format read by pgalloc.ReadPrecopyRound. The kernel is
+// paused only while the round begins, so most of the memory is copied while
+// the application keeps running. PrecopyRound returns the number of pages
+// written to w, and the number of pages that have been written to since
+// then, which is the size of the next round.
+//
+// The pre-copy started by the first call to PrecopyRound ends with
+// SaveToPrecopied or CancelPrecopy.
+func (k *Kernel) PrecopyRound(w io.Writer) (uint64, uint64, error) {
+	k.Pause()
+	round, p, err := k.beginPrecopyRound()
+	k.Unpause()
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := round.WriteTo(w); err != nil {
+		return 0, 0, err
+	}
+	return round.Pages(), p.DirtyPages(), nil
+}
+
+// Preconditions: The kernel must be paused.
+func (k *Kernel) beginPrecopyRound() (*pgalloc.PrecopyRound, *pgalloc.Precopy, error) {
+	k.extMu.Lock()
+	defer k.extMu.Unlock()
+	if k.precopy == nil {
+		p, err := k.mf.StartPrecopy()
+		if err != nil {
+			return nil, nil, err
+		}
+		k.precopy = p
+	}
+	round, err := k.precopy.BeginRound()
+	if err != nil {
+		return nil, nil, err
+	}
+	// As in startAsyncMemorySave, remove existing AddressSpace mappings so
+	// that writes to pre-copied pages fault and are prepared for.
+	k.forEachMemoryManager(func(memMgr *mm.MemoryManager) error {
+		memMgr.PrepareAsyncSave()
+		return nil
+	})
+	return round, k.precopy, nil
+}
+
+// CancelPrecopy ends the pre-copy started by PrecopyRound, if any, without
+// saving.
+func (k *Kernel) CancelPrecopy() {
+	k.extMu.Lock()
+	defer k.extMu.Unlock()
+	if k.precopy != nil {
+		k.precopy.Release()
+		k.precopy = nil
+	}
 }
 
 // Preconditions: The kernel must be paused.
 func (k *Kernel) invalidateUnsavableMappings(ctx context.Context) error {
-	invalidated := make(map[*mm.MemoryManager]struct{})
+	return k.forEachMemoryManager(func(memMgr *mm.MemoryManager) error {
+		return memMgr.InvalidateUnsavable(ctx)
+	})
+}
+
+// forEachMemoryManager invokes fn once on each MemoryManager used by tasks in
+// k, stopping at the first error.
+//
+// Preconditions: The kernel must be paused.
+func (k *Kernel) forEachMemoryManager(fn func(*mm.MemoryManager) error) error {
+	visited := make(map[*mm.MemoryManager]struct{})
+	visit := func(memMgr *mm.MemoryManager) error {
+		if memMgr == nil {
+			return nil
+		}
+		if _, ok := visited[memMgr]; ok {
+			return nil
+		}
+		visited[memMgr] = struct{}{}
+		return fn(memMgr)
+	}
 	k.tasks.mu.RLock()
 	defer k.tasks.mu.RUnlock()
 	for t := range k.tasks.Root.tids {
 		// We can skip locking Task.mu here since the kernel is paused.
-		if memMgr := t.image.MemoryManager; memMgr != nil {
-			if _, ok := invalidated[memMgr]; !ok {
-				if err := memMgr.InvalidateUnsavable(ctx); err != nil {
-					return err
-				}
-				invalidated[memMgr] = struct{}{}
-			}
+		if err := visit(t.image.MemoryManager); err != nil {
+			return err
 		}
 		// I really wish we just had a sync.Map of all MMs...
 		if r, ok := t.runState.(*runSyscallAfterExecStop); ok {
-			if err := r.image.MemoryManager.InvalidateUnsavable(ctx); err != nil {
+			if err := visit(r.image.MemoryManager); err != nil {
 				return err
 			}
 		}
@@ -865,6 +1118,8 @@ func (ctx *createProcessContext) Value(key any) any {
 		return mntns
 	case devutil.CtxDevGoferClient:
 		return ctx.kernel.getDevGoferClient(ctx.args.ContainerID)
+	case guestrand.CtxReader:
+		return ctx.kernel.GuestRand()
 	case inet.CtxStack:
 		return ctx.kernel.RootNetworkNamespace().Stack()
 	case ktime.CtxRealtimeClock:
@@ -1539,6 +1794,26 @@ type SocketRecord struct {
 	k    *Kernel
 	Sock *vfs.FileDescription
 	ID   uint64 // Socket table entry number.
+
+	// NetworkNamespace is the network namespace the socket was created in.
+	// The socket table doesn't hold a reference on it. It may be nil for
+	// sockets that don't belong to any task.
+	NetworkNamespace *inet.Namespace
+}
+
+// InNetworkNamespace returns true if the socket should be visible from
+// netns, e.g. in /proc/net. Sockets that weren't created in any network
+// namespace are visible from all of them, as are all sockets if netns is nil.
+func (s *SocketRecord) InNetworkNamespace(netns *inet.Namespace) bool {
+	return netns == nil || s.NetworkNamespace == nil || s.NetworkNamespace == netns
+}
+
+// Cookie returns the socket's cookie, a nonzero 64-bit identifier that is
+// unique for the lifetime of the kernel, as returned by SO_COOKIE and
+// reported by sock_diag.
+func (s *SocketRecord) Cookie() uint64 {
+	// As in Linux, 0 is never a valid cookie.
+	return s.ID + 1
 }
 
 // RecordSocket adds a socket to the system-wide socket table for
@@ -1547,8 +1822,8 @@ type SocketRecord struct {
 // Precondition: Caller must hold a reference to sock.
 //
 // Note that the socket table will not hold a reference on the
-// vfs.FileDescription.
-func (k *Kernel) RecordSocket(sock *vfs.FileDescription) {
+// vfs.FileDescription or on netns.
+func (k *Kernel) RecordSocket(sock *vfs.FileDescription, netns *inet.Namespace) {
 	k.extMu.Lock()
 	if _, ok := k.sockets[sock]; ok {
 		panic(fmt.Sprintf("Socket %p added twice", sock))
@@ -1556,9 +1831,10 @@ func (k *Kernel) RecordSocket(sock *vfs.FileDescription) {
 	id := k.nextSocketRecord
 	k.nextSocketRecord++
 	s := &SocketRecord{
-		k:    k,
-		ID:   id,
-		Sock: sock,
+		k:                k,
+		ID:               id,
+		Sock:             sock,
+		NetworkNamespace: netns,
 	}
 	k.sockets[sock] = s
 	k.extMu.Unlock()
@@ -1571,6 +1847,18 @@ func (k *Kernel) DeleteSocket(sock *vfs.FileDescription) {
 	k.extMu.Unlock()
 }
 
+// SocketCookie returns the cookie of sock, as returned by
+// SocketRecord.Cookie, or false if sock is not in the socket table.
+func (k *Kernel) SocketCookie(sock *vfs.FileDescription) (uint64, bool) {
+	k.extMu.Lock()
+	defer k.extMu.Unlock()
+	s, ok := k.sockets[sock]
+	if !ok {
+		return 0, false
+	}
+	return s.Cookie(), true
+}
+
 // ListSockets returns a snapshot of all sockets.
 //
 // Callers of ListSockets() should use SocketRecord.Sock.TryIncRef()
@@ -1643,6 +1931,8 @@ func (ctx *supervisorContext) Value(key any) any {
 		mntns := ctx.Kernel.GlobalInit().Leader().MountNamespace()
 		mntns.IncRef()
 		return mntns
+	case guestrand.CtxReader:
+		return ctx.Kernel.GuestRand()
 	case inet.CtxStack:
 		return ctx.Kernel.RootNetworkNamespace().Stack()
 	case ktime.CtxRealtimeClock:
@@ -1686,6 +1976,7 @@ func (k *Kernel) EmitUnimplementedEvent(ctx context.Context, sysno uintptr) {
 
 	t := TaskFromContext(ctx)
 	IncrementUnimplementedSyscallCounter(sysno)
+	t.RecordUnimplementedSyscall(sysno)
 	_, _ = k.unimplementedSyscallEmitter.Emit(&uspb.UnimplementedSyscall{
 		Tid:       int32(t.ThreadID()),
 		Registers: t.Arch().StateData().Proto(),
@@ -0,0 +1,220 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// ProcEventListener receives process lifecycle events, as reported by the
+// Linux process events connector (drivers/connector/cn_proc.c).
+type ProcEventListener interface {
+	// HandleProcEvent is called for each process event that occurs while the
+	// listener is registered. Thread IDs in ev are in the root PID namespace.
+	// ev must not be retained after HandleProcEvent returns.
+	//
+	// HandleProcEvent must not block, or call AddProcEventListener or
+	// RemoveProcEventListener.
+	HandleProcEvent(ctx context.Context, ev *linux.ProcEvent)
+}
+
+// procEventListeners holds the set of registered ProcEventListeners.
+//
+// +stateify savable
+type procEventListeners struct {
+	mu sync.Mutex `state:"nosave"`
+
+	// listeners is the set of registered listeners.
+	//
+	// +checklocks:mu
+	listeners []ProcEventListener
+
+	// num is len(listeners). It may be read without holding mu, so that
+	// events are not constructed when there is nobody to deliver them to.
+	num atomicbitops.Int32
+}
+
+// AddProcEventListener registers l to receive process events.
+func (k *Kernel) AddProcEventListener(l ProcEventListener) {
+	k.procEvents.mu.Lock()
+	defer k.procEvents.mu.Unlock()
+	k.procEvents.listeners = append(k.procEvents.listeners, l)
+	k.procEvents.num.Store(int32(len(k.procEvents.listeners)))
+}
+
+// RemoveProcEventListener unregisters l, which must have been previously
+// registered by AddProcEventListener.
+func (k *Kernel) RemoveProcEventListener(l ProcEventListener) {
+	k.procEvents.mu.Lock()
+	defer k.procEvents.mu.Unlock()
+	for i, other := range k.procEvents.listeners {
+		if other == l {
+			k.procEvents.listeners = append(k.procEvents.listeners[:i], k.procEvents.listeners[i+1:]...)
+			break
+		}
+	}
+	k.procEvents.num.Store(int32(len(k.procEvents.listeners)))
+}
+
+// procEventsEnabled returns true if any ProcEventListeners are registered.
+func (k *Kernel) procEventsEnabled() bool {
+	return k.procEvents.num.Load() != 0
+}
+
+// sendProcEvent delivers a process event of the given type, with the given
+// event data, to all registered ProcEventListeners.
+func (t *Task) sendProcEvent(what uint32, data marshal.Marshallable) {
+	ev := linux.ProcEvent{
+		What:        what,
+		CPU:         uint32(t.CPU()),
+		TimestampNS: uint64(t.k.MonotonicClock().Now().Nanoseconds()),
+	}
+	data.MarshalBytes(ev.EventData[:])
+
+	t.k.procEvents.mu.Lock()
+	defer t.k.procEvents.mu.Unlock()
+	for _, l := range t.k.procEvents.listeners {
+		l.HandleProcEvent(t, &ev)
+	}
+}
+
+// procForkEvent sends a PROC_EVENT_FORK event for the new task nt.
+func (t *Task) procForkEvent(nt *Task) {
+	if !t.k.procEventsEnabled() {
+		return
+	}
+	ts := t.k.tasks
+	ts.mu.RLock()
+	data := linux.ProcEventForkData{
+		ChildPID:  int32(ts.Root.tids[nt]),
+		ChildTGID: int32(ts.Root.tgids[nt.tg]),
+	}
+	if parent := nt.parent; parent != nil {
+		data.ParentPID = int32(ts.Root.tids[parent])
+		data.ParentTGID = int32(ts.Root.tgids[parent.tg])
+	}
+	ts.mu.RUnlock()
+	t.sendProcEvent(linux.PROC_EVENT_FORK, &data)
+}
+
+// procExecEvent sends a PROC_EVENT_EXEC event for t.
+func (t *Task) procExecEvent() {
+	if !t.k.procEventsEnabled() {
+		return
+	}
+	ts := t.k.tasks
+	ts.mu.RLock()
+	data := linux.ProcEventExecData{
+		ProcessPID:  int32(ts.Root.tids[t]),
+		ProcessTGID: int32(ts.Root.tgids[t.tg]),
+	}
+	ts.mu.RUnlock()
+	t.sendProcEvent(linux.PROC_EVENT_EXEC, &data)
+}
+
+// procIDEvent sends a PROC_EVENT_UID or PROC_EVENT_GID event for t if its
+// real or effective UIDs or GIDs differ from those in oldCreds. It is
+// intended to be deferred by functions that change t's credentials, before
+// they lock t.mu.
+func (t *Task) procIDEvent(oldCreds *auth.Credentials) {
+	if !t.k.procEventsEnabled() {
+		return
+	}
+	creds := t.Credentials()
+	if creds.RealKUID != oldCreds.RealKUID || creds.EffectiveKUID != oldCreds.EffectiveKUID {
+		t.sendProcEvent(linux.PROC_EVENT_UID, &linux.ProcEventIDData{
+			ProcessPID:  int32(t.k.tasks.Root.IDOfTask(t)),
+			ProcessTGID: int32(t.k.tasks.Root.IDOfThreadGroup(t.tg)),
+			R:           uint32(creds.RealKUID),
+			E:           uint32(creds.EffectiveKUID),
+		})
+	}
+	if creds.RealKGID != oldCreds.RealKGID || creds.EffectiveKGID != oldCreds.EffectiveKGID {
+		t.sendProcEvent(linux.PROC_EVENT_GID, &linux.ProcEventIDData{
+			ProcessPID:  int32(t.k.tasks.Root.IDOfTask(t)),
+			ProcessTGID: int32(t.k.tasks.Root.IDOfThreadGroup(t.tg)),
+			R:           uint32(creds.RealKGID),
+			E:           uint32(creds.EffectiveKGID),
+		})
+	}
+}
+
+// procSIDEvent sends a PROC_EVENT_SID event for t.
+func (t *Task) procSIDEvent() {
+	if !t.k.procEventsEnabled() {
+		return
+	}
+	ts := t.k.tasks
+	ts.mu.RLock()
+	data := linux.ProcEventSIDData{
+		ProcessPID:  int32(ts.Root.tids[t]),
+		ProcessTGID: int32(ts.Root.tgids[t.tg]),
+	}
+	ts.mu.RUnlock()
+	t.sendProcEvent(linux.PROC_EVENT_SID, &data)
+}
+
+// procCommEvent sends a PROC_EVENT_COMM event for t, which has been renamed
+// to name.
+func (t *Task) procCommEvent(name string) {
+	if !t.k.procEventsEnabled() {
+		return
+	}
+	ts := t.k.tasks
+	ts.mu.RLock()
+	data := linux.ProcEventCommData{
+		ProcessPID:  int32(ts.Root.tids[t]),
+		ProcessTGID: int32(ts.Root.tgids[t.tg]),
+	}
+	ts.mu.RUnlock()
+	// comm is always NUL-terminated.
+	copy(data.Comm[:len(data.Comm)-1], name)
+	t.sendProcEvent(linux.PROC_EVENT_COMM, &data)
+}
+
+// procExitEvent sends a PROC_EVENT_EXIT event for t.
+//
+// Preconditions: t.exitStatus must be set.
+func (t *Task) procExitEvent() {
+	if !t.k.procEventsEnabled() {
+		return
+	}
+	ts := t.k.tasks
+	ts.mu.RLock()
+	data := linux.ProcEventExitData{
+		ProcessPID:  int32(ts.Root.tids[t]),
+		ProcessTGID: int32(ts.Root.tgids[t.tg]),
+		// Linux reports an exit signal of -1 for tasks other than the
+		// thread group leader.
+		ExitSignal: ^uint32(0),
+	}
+	if parent := t.parent; parent != nil {
+		data.ParentPID = int32(ts.Root.tids[parent])
+		data.ParentTGID = int32(ts.Root.tgids[parent.tg])
+	}
+	if t == t.tg.leader {
+		data.ExitSignal = uint32(t.tg.terminationSignal)
+	}
+	t.tg.signalHandlers.mu.Lock()
+	data.ExitCode = uint32(t.exitStatus)
+	t.tg.signalHandlers.mu.Unlock()
+	ts.mu.RUnlock()
+	t.sendProcEvent(linux.PROC_EVENT_EXIT, &data)
+}
@@ -17,6 +17,7 @@ package kernel
 import (
 	"fmt"
 	"reflect"
+	"time"
 
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -24,6 +25,7 @@ import (
 	"gvisor.dev/gvisor/pkg/bpf"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 )
 
@@ -36,6 +38,21 @@ const (
 	uncacheableBPFAction = linux.SECCOMP_RET_ACTION_FULL
 )
 
+// seccompLogger logs syscalls allowed by SECCOMP_RET_LOG. Linux rate limits
+// these through the audit subsystem.
+var seccompLogger = log.BasicRateLimitedLogger(time.Second)
+
+// seccompActionLess returns true if action a takes precedence over action b,
+// i.e. if a is less permissive than b.
+//
+// "The ordering ensures that a min_t() over composed return values always
+// selects the least permissive choice." - include/uapi/linux/seccomp.h. The
+// comparison is signed, such that SECCOMP_RET_KILL_PROCESS is the least
+// permissive action.
+func seccompActionLess(a, b linux.BPFAction) bool {
+	return int32(a&linux.SECCOMP_RET_ACTION_FULL) < int32(b&linux.SECCOMP_RET_ACTION_FULL)
+}
+
 // taskSeccomp holds seccomp-related data for a `Task`.
 //
 // +stateify savable
@@ -95,7 +112,7 @@ func seccompSiginfo(t *Task, errno, sysno int32, ip hostarch.Addr) *linux.Signal
 // Preconditions: The caller must be running on the task goroutine.
 func (t *Task) checkSeccompSyscall(sysno int32, args arch.SyscallArguments, ip hostarch.Addr) linux.BPFAction {
 	result := linux.BPFAction(t.evaluateSyscallFilters(sysno, args, ip))
-	action := result & linux.SECCOMP_RET_ACTION
+	action := result & linux.SECCOMP_RET_ACTION_FULL
 	switch action {
 	case linux.SECCOMP_RET_TRAP:
 		// "Results in the kernel sending a SIGSYS signal to the triggering
@@ -127,6 +144,17 @@ func (t *Task) checkSeccompSyscall(sysno int32, args arch.SyscallArguments, ip h
 	case linux.SECCOMP_RET_ALLOW:
 		// "Results in the system call being executed."
 
+	case linux.SECCOMP_RET_LOG:
+		// "Results in the system call being executed after the filter return
+		// action is logged."
+		seccompLogger.Infof("seccomp: PID %d executing syscall %d allowed by SECCOMP_RET_LOG", t.ThreadGroup().ID(), sysno)
+		return linux.SECCOMP_RET_ALLOW
+
+	case linux.SECCOMP_RET_KILL_PROCESS:
+		// "Results in the entire process exiting immediately without executing
+		// the system call. The exit status of the task will be SIGSYS, not
+		// SIGKILL."
+
 	case linux.SECCOMP_RET_KILL_THREAD:
 		// "Results in the task exiting immediately without executing the
 		// system call. The exit status of the task will be SIGSYS, not
@@ -183,10 +211,8 @@ func (t *Task) evaluateSyscallFilters(sysno int32, args arch.SyscallArguments, i
 		// calls, then additional filters can be added; they are run in order
 		// until the first non-allow result is seen." prctl(2) is incorrect.)
 		//
-		// "The ordering ensures that a min_t() over composed return values
-		// always selects the least permissive choice." -
-		// include/uapi/linux/seccomp.h
-		if (thisRet & linux.SECCOMP_RET_ACTION) < (ret & linux.SECCOMP_RET_ACTION) {
+		// See seccompActionLess.
+		if seccompActionLess(linux.BPFAction(thisRet), linux.BPFAction(ret)) {
 			ret = thisRet
 		}
 	}
@@ -252,7 +278,7 @@ func (ts *taskSeccomp) populateCache(t *Task) {
 				sysnoIsCacheable = false
 				break
 			}
-			if (linux.BPFAction(result) & linux.SECCOMP_RET_ACTION) < (ret & linux.SECCOMP_RET_ACTION) {
+			if seccompActionLess(linux.BPFAction(result), ret) {
 				ret = linux.BPFAction(result)
 			}
 		}
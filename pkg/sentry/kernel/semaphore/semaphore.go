@@ -40,6 +40,12 @@ const (
 
 	// Maximum number of semaphores in all semaphore sets.
 	semsTotalMax = linux.SEMMNS
+
+	// Maximum adjust-on-exit value.
+	adjMax = linux.SEMAEM
+
+	// Number of shards used for lookups by ID. Must be a power of two.
+	registryShards = 16
 )
 
 // Registry maintains a set of semaphores that can be found by key or ID.
@@ -55,6 +61,27 @@ type Registry struct {
 	// indexes maintains a mapping between a set's index in virtual array and
 	// its identifier.
 	indexes map[int32]ipc.ID
+
+	// ids is the inverse of indexes.
+	ids map[ipc.ID]int32
+
+	// totalSems is the number of semaphores in all sets of the registry.
+	totalSems int
+
+	// shards hold the sets of the registry by ID, allowing lookups from
+	// semop(2) and semctl(2) to proceed without contending on mu. Sets are
+	// added and removed with both mu and the shard's lock held.
+	shards [registryShards]registryShard
+}
+
+// registryShard is a subset of the sets in a Registry.
+//
+// +stateify savable
+type registryShard struct {
+	mu sync.Mutex `state:"nosave"`
+
+	// sets maps IDs to sets. Protected by mu.
+	sets map[ipc.ID]*Set
 }
 
 // Set represents a set of semaphores that can be operated atomically.
@@ -79,6 +106,10 @@ type Set struct {
 	// dead is set to true when the set is removed and can't be reached anymore.
 	// All waiters must wake up and fail when set is dead.
 	dead bool
+
+	// undos holds the adjust-on-exit entries of all UndoLists that refer to
+	// this set.
+	undos map[*undo]struct{}
 }
 
 // sem represents a single semaphore from a set.
@@ -105,10 +136,19 @@ type waiter struct {
 
 // NewRegistry creates a new semaphore set registry.
 func NewRegistry(userNS *auth.UserNamespace) *Registry {
-	return &Registry{
+	r := &Registry{
 		reg:     ipc.NewRegistry(userNS),
 		indexes: make(map[int32]ipc.ID),
+		ids:     make(map[ipc.ID]int32),
+	}
+	for i := range r.shards {
+		r.shards[i].sets = make(map[ipc.ID]*Set)
 	}
+	return r
+}
+
+func (r *Registry) shard(id ipc.ID) *registryShard {
+	return &r.shards[uint32(id)&(registryShards-1)]
 }
 
 // FindOrCreate searches for a semaphore set that matches 'key'. If not found,
@@ -152,7 +192,7 @@ func (r *Registry) FindOrCreate(ctx context.Context, key ipc.Key, nsems int32, m
 	if r.reg.ObjectCount() >= setsMax {
 		return nil, linuxerr.ENOSPC
 	}
-	if r.totalSems() > int(semsTotalMax-nsems) {
+	if r.totalSems > int(semsTotalMax-nsems) {
 		return nil, linuxerr.ENOSPC
 	}
 
@@ -185,7 +225,7 @@ func (r *Registry) SemInfo() *linux.SemInfo {
 
 	info := r.IPCInfo()
 	info.SemUsz = uint32(r.reg.ObjectCount())
-	info.SemAem = uint32(r.totalSems())
+	info.SemAem = uint32(r.totalSems)
 
 	return info
 }
@@ -213,14 +253,22 @@ func (r *Registry) Remove(id ipc.ID, creds *auth.Credentials) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	index, found := r.findIndexByID(id)
+	index, found := r.ids[id]
 	if !found {
 		return linuxerr.EINVAL
 	}
+	set := r.reg.FindByID(id).(*Set)
+	if err := r.reg.Remove(id, creds); err != nil {
+		return err
+	}
 	delete(r.indexes, index)
+	delete(r.ids, id)
+	r.totalSems -= set.Size()
 
-	r.reg.Remove(id, creds)
-
+	sh := r.shard(id)
+	sh.mu.Lock()
+	delete(sh.sets, id)
+	sh.mu.Unlock()
 	return nil
 }
 
@@ -234,6 +282,7 @@ func (r *Registry) newSetLocked(ctx context.Context, key ipc.Key, creator *auth.
 		obj:        ipc.NewObject(r.reg.UserNS, ipc.Key(key), creator, creator, mode),
 		changeTime: ktime.NowFromContext(ctx),
 		sems:       make([]sem, nsems),
+		undos:      make(map[*undo]struct{}),
 	}
 
 	err := r.reg.Register(set)
@@ -247,19 +296,23 @@ func (r *Registry) newSetLocked(ctx context.Context, key ipc.Key, creator *auth.
 		return nil, linuxerr.ENOSPC
 	}
 	r.indexes[index] = set.obj.ID
+	r.ids[set.obj.ID] = index
+	r.totalSems += int(nsems)
+
+	sh := r.shard(set.obj.ID)
+	sh.mu.Lock()
+	sh.sets[set.obj.ID] = set
+	sh.mu.Unlock()
 
 	return set, nil
 }
 
 // FindByID looks up a set given an ID.
 func (r *Registry) FindByID(id ipc.ID) *Set {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	mech := r.reg.FindByID(id)
-	if mech == nil {
-		return nil
-	}
-	return mech.(*Set)
+	sh := r.shard(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return sh.sets[id]
 }
 
 // FindByIndex looks up a set given an index.
@@ -274,15 +327,6 @@ func (r *Registry) FindByIndex(index int32) *Set {
 	return r.reg.FindByID(id).(*Set)
 }
 
-func (r *Registry) findIndexByID(id ipc.ID) (int32, bool) {
-	for k, v := range r.indexes {
-		if v == id {
-			return k, true
-		}
-	}
-	return 0, false
-}
-
 func (r *Registry) findFirstAvailableIndex() (int32, bool) {
 	for index := int32(0); index < setsMax; index++ {
 		if _, present := r.indexes[index]; !present {
@@ -292,16 +336,6 @@ func (r *Registry) findFirstAvailableIndex() (int32, bool) {
 	return 0, false
 }
 
-func (r *Registry) totalSems() int {
-	totalSems := 0
-	r.reg.ForAllObjects(
-		func(o ipc.Mechanism) {
-			totalSems += o.(*Set).Size()
-		},
-	)
-	return totalSems
-}
-
 // ID returns semaphore's ID.
 func (s *Set) ID() ipc.ID {
 	return s.obj.ID
@@ -403,7 +437,11 @@ func (s *Set) SetVal(ctx context.Context, num int32, val int16, creds *auth.Cred
 		return linuxerr.ERANGE
 	}
 
-	// TODO(gvisor.dev/issue/137): Clear undo entries in all processes.
+	// "When a semaphore value is set via SETVAL, the corresponding semadj
+	// value in all processes is cleared." - semop(2)
+	for u := range s.undos {
+		u.adj[num] = 0
+	}
 	sem.value = val
 	sem.pid = pid
 	s.changeTime = ktime.NowFromContext(ctx)
@@ -434,10 +472,14 @@ func (s *Set) SetValAll(ctx context.Context, vals []uint16, creds *auth.Credenti
 		return linuxerr.EACCES
 	}
 
+	// As with SETVAL, adjust-on-exit values are cleared in all processes.
+	for u := range s.undos {
+		for i := range u.adj {
+			u.adj[i] = 0
+		}
+	}
 	for i, val := range vals {
 		sem := &s.sems[i]
-
-		// TODO(gvisor.dev/issue/137): Clear undo entries in all processes.
 		sem.value = int16(val)
 		sem.pid = pid
 		sem.wakeWaiters()
@@ -538,20 +580,58 @@ func (s *Set) CountNegativeWaiters(num int32, creds *auth.Credentials) (uint16,
 //
 // On failure, it may return an error (retries are hopeless) or it may return
 // a channel that can be waited on before attempting again.
-func (s *Set) ExecuteOps(ctx context.Context, ops []linux.Sembuf, creds *auth.Credentials, pid int32) (chan struct{}, int32, error) {
+//
+// undos holds the adjust-on-exit values of the caller. It may only be nil if
+// no operation has SEM_UNDO set.
+func (s *Set) ExecuteOps(ctx context.Context, ops []linux.Sembuf, creds *auth.Credentials, pid int32, undos *UndoList) (chan struct{}, int32, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if err := s.checkOpsLocked(ops, creds); err != nil {
+		return nil, 0, err
+	}
+
+	var u *undo
+	for _, op := range ops {
+		if op.SemFlg&linux.SEM_UNDO != 0 {
+			// Only create adjustments once the caller is known to be allowed
+			// to operate on the set. UndoList.mu is ordered before s.mu, so
+			// the checks must be repeated once s.mu is reacquired.
+			s.mu.Unlock()
+			var err error
+			u, err = undos.undoFor(s)
+			s.mu.Lock()
+			if err != nil {
+				return nil, 0, err
+			}
+			if err := s.checkOpsLocked(ops, creds); err != nil {
+				return nil, 0, err
+			}
+			break
+		}
+	}
+
+	ch, num, err := s.executeOps(ctx, ops, pid, u)
+	if err != nil {
+		return nil, 0, err
+	}
+	return ch, num, nil
+}
+
+// checkOpsLocked checks that ops may be applied to the set by creds.
+//
+// Preconditions: s.mu must be held.
+func (s *Set) checkOpsLocked(ops []linux.Sembuf, creds *auth.Credentials) error {
 	// Did it race with a removal operation?
 	if s.dead {
-		return nil, 0, linuxerr.EIDRM
+		return linuxerr.EIDRM
 	}
 
 	// Validate the operations.
 	readOnly := true
 	for _, op := range ops {
 		if s.findSem(int32(op.SemNum)) == nil {
-			return nil, 0, linuxerr.EFBIG
+			return linuxerr.EFBIG
 		}
 		if op.SemOp != 0 {
 			readOnly = false
@@ -563,75 +643,90 @@ func (s *Set) ExecuteOps(ctx context.Context, ops []linux.Sembuf, creds *auth.Cr
 		ats = vfs.MayWrite
 	}
 	if !s.obj.CheckPermissions(creds, ats) {
-		return nil, 0, linuxerr.EACCES
-	}
-
-	ch, num, err := s.executeOps(ctx, ops, pid)
-	if err != nil {
-		return nil, 0, err
+		return linuxerr.EACCES
 	}
-	return ch, num, nil
+	return nil
 }
 
-func (s *Set) executeOps(ctx context.Context, ops []linux.Sembuf, pid int32) (chan struct{}, int32, error) {
-	// Changes to semaphores go to this slice temporarily until they all succeed.
-	tmpVals := make([]int16, len(s.sems))
-	for i := range s.sems {
-		tmpVals[i] = s.sems[i].value
-	}
-
-	for _, op := range ops {
+// executeOps applies ops to the set. Operations are applied in place and
+// reverted if any of them can't be completed, which avoids copying the
+// values of the entire set for every call.
+//
+// Preconditions: s.mu must be held.
+func (s *Set) executeOps(ctx context.Context, ops []linux.Sembuf, pid int32, u *undo) (chan struct{}, int32, error) {
+	for i, op := range ops {
 		sem := &s.sems[op.SemNum]
-		if op.SemOp == 0 {
+		block := false
+		var err error
+		switch {
+		case op.SemOp == 0:
 			// Handle 'wait for zero' operation.
-			if tmpVals[op.SemNum] != 0 {
-				// Semaphore isn't 0, must wait.
-				if op.SemFlg&linux.IPC_NOWAIT != 0 {
-					return nil, 0, linuxerr.ErrWouldBlock
-				}
-
-				w := newWaiter(op.SemOp)
-				sem.waiters.PushBack(w)
-				return w.ch, int32(op.SemNum), nil
-			}
-		} else {
-			if op.SemOp < 0 {
-				// Handle 'wait' operation.
-				if -op.SemOp > valueMax {
-					return nil, 0, linuxerr.ERANGE
-				}
-				if -op.SemOp > tmpVals[op.SemNum] {
-					// Not enough resources, must wait.
-					if op.SemFlg&linux.IPC_NOWAIT != 0 {
-						return nil, 0, linuxerr.ErrWouldBlock
-					}
-
-					w := newWaiter(op.SemOp)
-					sem.waiters.PushBack(w)
-					return w.ch, int32(op.SemNum), nil
-				}
+			block = sem.value != 0
+		case op.SemOp < 0:
+			// Handle 'wait' operation.
+			if -op.SemOp > valueMax {
+				err = linuxerr.ERANGE
 			} else {
-				// op.SemOp > 0: Handle 'signal' operation.
-				if tmpVals[op.SemNum] > valueMax-op.SemOp {
-					return nil, 0, linuxerr.ERANGE
-				}
+				block = -op.SemOp > sem.value
+			}
+		default:
+			// op.SemOp > 0: Handle 'signal' operation.
+			if sem.value > valueMax-op.SemOp {
+				err = linuxerr.ERANGE
+			}
+		}
+		undo := u != nil && op.SemFlg&linux.SEM_UNDO != 0
+		if err == nil && !block && undo {
+			// The adjustment must remain representable, see
+			// Linux, ipc/sem.c:perform_atomic_semop().
+			if adj := int32(u.adj[op.SemNum]) - int32(op.SemOp); adj < -adjMax-1 || adj > adjMax {
+				err = linuxerr.ERANGE
+			}
+		}
+
+		if err != nil || block {
+			s.revertOps(ops[:i], u)
+			if err != nil {
+				return nil, 0, err
+			}
+			if op.SemFlg&linux.IPC_NOWAIT != 0 {
+				return nil, 0, linuxerr.ErrWouldBlock
 			}
+			w := newWaiter(op.SemOp)
+			sem.waiters.PushBack(w)
+			return w.ch, int32(op.SemNum), nil
+		}
 
-			tmpVals[op.SemNum] += op.SemOp
+		sem.value += op.SemOp
+		if undo {
+			u.adj[op.SemNum] -= op.SemOp
 		}
 	}
 
-	// All operations succeeded, apply them.
-	// TODO(gvisor.dev/issue/137): handle undo operations.
-	for i, v := range tmpVals {
-		s.sems[i].value = v
-		s.sems[i].wakeWaiters()
-		s.sems[i].pid = pid
+	// All operations succeeded. Only semaphores that were operated on can
+	// have waiters that are now able to proceed.
+	for _, op := range ops {
+		sem := &s.sems[op.SemNum]
+		sem.pid = pid
+		sem.wakeWaiters()
 	}
 	s.opTime = ktime.NowFromContext(ctx)
 	return nil, 0, nil
 }
 
+// revertOps reverts ops, which have all been applied by executeOps.
+//
+// Preconditions: s.mu must be held.
+func (s *Set) revertOps(ops []linux.Sembuf, u *undo) {
+	for i := len(ops) - 1; i >= 0; i-- {
+		op := ops[i]
+		s.sems[op.SemNum].value -= op.SemOp
+		if u != nil && op.SemFlg&linux.SEM_UNDO != 0 {
+			u.adj[op.SemNum] += op.SemOp
+		}
+	}
+}
+
 // AbortWait notifies that a waiter is giving up and will not wait on the
 // channel anymore.
 func (s *Set) AbortWait(num int32, ch chan struct{}) {
@@ -26,7 +26,7 @@ import (
 )
 
 func executeOps(ctx context.Context, t *testing.T, set *Set, ops []linux.Sembuf, block bool) chan struct{} {
-	ch, _, err := set.executeOps(ctx, ops, 123)
+	ch, _, err := set.executeOps(ctx, ops, 123, nil)
 	if err != nil {
 		t.Fatalf("ExecuteOps(ops) failed, err: %v, ops: %+v", err, ops)
 	}
@@ -124,13 +124,13 @@ func TestNoWait(t *testing.T) {
 
 	ops[0].SemOp = -2
 	ops[0].SemFlg = linux.IPC_NOWAIT
-	if _, _, err := set.executeOps(ctx, ops, 123); err != linuxerr.ErrWouldBlock {
+	if _, _, err := set.executeOps(ctx, ops, 123, nil); err != linuxerr.ErrWouldBlock {
 		t.Fatalf("ExecuteOps(ops) wrong result, got: %v, expected: %v", err, linuxerr.ErrWouldBlock)
 	}
 
 	ops[0].SemOp = 0
 	ops[0].SemFlg = linux.IPC_NOWAIT
-	if _, _, err := set.executeOps(ctx, ops, 123); err != linuxerr.ErrWouldBlock {
+	if _, _, err := set.executeOps(ctx, ops, 123, nil); err != linuxerr.ErrWouldBlock {
 		t.Fatalf("ExecuteOps(ops) wrong result, got: %v, expected: %v", err, linuxerr.ErrWouldBlock)
 	}
 }
@@ -172,3 +172,86 @@ func TestUnregister(t *testing.T) {
 		}
 	}
 }
+
+func TestRevertOnBlock(t *testing.T) {
+	ctx := contexttest.Context(t)
+	set := &Set{obj: &ipc.Object{ID: 123}, sems: make([]sem, 2)}
+	ops := []linux.Sembuf{
+		{SemNum: 0, SemOp: 1},
+		{SemNum: 1, SemOp: -1},
+	}
+	executeOps(ctx, t, set, ops, true)
+	if got := set.sems[0].value; got != 0 {
+		t.Fatalf("sems[0].value got: %d, expected: 0", got)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	ctx := contexttest.Context(t)
+	r := NewRegistry(auth.NewRootUserNamespace())
+	set, err := r.FindOrCreate(ctx, 123, 2, linux.FileMode(0600), true, true, true)
+	if err != nil {
+		t.Fatalf("FindOrCreate() failed, err: %v", err)
+	}
+	creds := auth.CredentialsFromContext(ctx)
+
+	undos := NewUndoList()
+	ops := []linux.Sembuf{
+		{SemNum: 0, SemOp: 3, SemFlg: linux.SEM_UNDO},
+		{SemNum: 1, SemOp: 2, SemFlg: linux.SEM_UNDO},
+	}
+	if _, _, err := set.ExecuteOps(ctx, ops, creds, 1, undos); err != nil {
+		t.Fatalf("ExecuteOps(ops) failed, err: %v", err)
+	}
+
+	// SETVAL clears the adjustment of semaphore 1 only.
+	if err := set.SetVal(ctx, 1, 5, creds, 1); err != nil {
+		t.Fatalf("SetVal() failed, err: %v", err)
+	}
+
+	// Another process decrements semaphore 0 below the adjustment, so that
+	// applying it must clamp the value to zero.
+	ops = []linux.Sembuf{{SemNum: 0, SemOp: -2}}
+	if _, _, err := set.ExecuteOps(ctx, ops, creds, 2, nil); err != nil {
+		t.Fatalf("ExecuteOps(ops) failed, err: %v", err)
+	}
+
+	undos.DecRef(ctx, 1)
+	vals, err := set.GetValAll(creds)
+	if err != nil {
+		t.Fatalf("GetValAll() failed, err: %v", err)
+	}
+	if vals[0] != 0 || vals[1] != 5 {
+		t.Fatalf("GetValAll() got: %v, expected: [0 5]", vals)
+	}
+	if len(set.undos) != 0 {
+		t.Fatalf("set still references %d undo entries", len(set.undos))
+	}
+}
+
+func TestUndoRange(t *testing.T) {
+	ctx := contexttest.Context(t)
+	r := NewRegistry(auth.NewRootUserNamespace())
+	set, err := r.FindOrCreate(ctx, 123, 1, linux.FileMode(0600), true, true, true)
+	if err != nil {
+		t.Fatalf("FindOrCreate() failed, err: %v", err)
+	}
+	creds := auth.CredentialsFromContext(ctx)
+
+	undos := NewUndoList()
+	defer undos.DecRef(ctx, 1)
+	ops := []linux.Sembuf{{SemOp: valueMax, SemFlg: linux.SEM_UNDO}}
+	if _, _, err := set.ExecuteOps(ctx, ops, creds, 1, undos); err != nil {
+		t.Fatalf("ExecuteOps(ops) failed, err: %v", err)
+	}
+	ops = []linux.Sembuf{{SemOp: -valueMax}}
+	if _, _, err := set.ExecuteOps(ctx, ops, creds, 1, undos); err != nil {
+		t.Fatalf("ExecuteOps(ops) failed, err: %v", err)
+	}
+	// The adjustment is already -SEMVMX; another SEM_UNDO increment of 2 would
+	// take it out of range.
+	ops = []linux.Sembuf{{SemOp: 2, SemFlg: linux.SEM_UNDO}}
+	if _, _, err := set.ExecuteOps(ctx, ops, creds, 1, undos); !linuxerr.Equals(linuxerr.ERANGE, err) {
+		t.Fatalf("ExecuteOps(ops) got: %v, expected: %v", err, linuxerr.ERANGE)
+	}
+}
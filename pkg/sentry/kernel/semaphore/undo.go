@@ -0,0 +1,139 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package semaphore
+
+import (
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// UndoList holds the adjust-on-exit ("semadj") values of a process for
+// operations performed with SEM_UNDO. It is shared between tasks created
+// with CLONE_SYSVSEM, and the adjustments are applied when the last
+// reference is dropped.
+//
+// Lock order: UndoList.mu -> Set.mu.
+//
+// +stateify savable
+type UndoList struct {
+	UndoListRefs
+
+	// mu protects undos.
+	mu sync.Mutex `state:"nosave"`
+
+	// undos maps sets to the adjustments for that set.
+	undos map[*Set]*undo
+}
+
+// undo holds the adjustments of an UndoList for a single set.
+//
+// +stateify savable
+type undo struct {
+	// set is the set being adjusted. Immutable.
+	set *Set
+
+	// adj holds the adjustment of each semaphore in set. Protected by set.mu.
+	adj []int16
+}
+
+// NewUndoList returns a new, empty UndoList with a single reference.
+func NewUndoList() *UndoList {
+	l := &UndoList{
+		undos: make(map[*Set]*undo),
+	}
+	l.InitRefs()
+	return l
+}
+
+// undoFor returns the adjustments of l for s, creating them if needed.
+func (l *UndoList) undoFor(s *Set) (*undo, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if u, ok := l.undos[s]; ok {
+		return u, nil
+	}
+
+	// Drop entries for sets that have been removed, so that a process
+	// repeatedly creating and removing sets doesn't accumulate them.
+	for set := range l.undos {
+		set.mu.Lock()
+		dead := set.dead
+		set.mu.Unlock()
+		if dead {
+			delete(l.undos, set)
+		}
+	}
+
+	u := &undo{
+		set: s,
+		adj: make([]int16, s.Size()),
+	}
+	s.mu.Lock()
+	if s.dead {
+		s.mu.Unlock()
+		return nil, linuxerr.EIDRM
+	}
+	if s.undos == nil {
+		s.undos = make(map[*undo]struct{})
+	}
+	s.undos[u] = struct{}{}
+	s.mu.Unlock()
+	l.undos[s] = u
+	return u, nil
+}
+
+// DecRef drops a reference on l. When the last reference is dropped, all
+// adjustments are applied on behalf of the process identified by pid.
+func (l *UndoList) DecRef(ctx context.Context, pid int32) {
+	l.UndoListRefs.DecRef(func() {
+		l.release(ctx, pid)
+	})
+}
+
+// release applies all adjustments of l. See Linux, ipc/sem.c:exit_sem().
+func (l *UndoList) release(ctx context.Context, pid int32) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for s, u := range l.undos {
+		s.mu.Lock()
+		delete(s.undos, u)
+		if !s.dead {
+			for i, adj := range u.adj {
+				if adj == 0 {
+					continue
+				}
+				sem := &s.sems[i]
+				// "If the adjustment would cause the semaphore value to go
+				// out of range, it is clamped." Linux does not block or fail
+				// here, since the process is exiting.
+				val := int32(sem.value) + int32(adj)
+				if val < 0 {
+					val = 0
+				}
+				if val > valueMax {
+					val = valueMax
+				}
+				sem.value = int16(val)
+				sem.pid = pid
+				sem.wakeWaiters()
+			}
+		}
+		s.mu.Unlock()
+	}
+	l.undos = nil
+}
@@ -258,10 +258,15 @@ func (pg *ProcessGroup) SendSignal(info *linux.SignalInfo) error {
 // leader, or a ProcessGroup already exists for the ThreadGroup's ID.
 func (tg *ThreadGroup) CreateSession() (SessionID, error) {
 	tg.pidns.owner.mu.Lock()
-	defer tg.pidns.owner.mu.Unlock()
 	tg.signalHandlers.mu.Lock()
-	defer tg.signalHandlers.mu.Unlock()
-	return tg.createSession()
+	sid, err := tg.createSession()
+	leader := tg.leader
+	tg.signalHandlers.mu.Unlock()
+	tg.pidns.owner.mu.Unlock()
+	if err == nil {
+		leader.procSIDEvent()
+	}
+	return sid, err
 }
 
 // createSession creates a new session for a threadgroup.
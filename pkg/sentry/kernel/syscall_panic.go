@@ -0,0 +1,185 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/metric"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// syscallPanicMaxReports bounds the number of crash reports kept by the
+// kernel. Further panics are counted, but not reported.
+const syscallPanicMaxReports = 64
+
+var syscallPanicCounter = metric.MustCreateNewUint64Metric(
+	"/kernel/syscall_panics", true /* sync */, "The number of sentry panics during syscall handling that were recovered from.")
+
+// SyscallPanicReport is the crash report of a sentry panic that occurred
+// while handling a syscall, and that the sandbox survived.
+type SyscallPanicReport struct {
+	// Time is when the panic occurred.
+	Time time.Time `json:"time"`
+
+	// ContainerID is the ID of the container that the task belongs to.
+	ContainerID string `json:"containerID"`
+
+	// TID is the thread ID of the task, in the root PID namespace.
+	TID ThreadID `json:"tid"`
+
+	// Comm is the name of the task.
+	Comm string `json:"comm"`
+
+	// Sysno and Syscall are the number and name of the syscall.
+	Sysno   uintptr `json:"sysno"`
+	Syscall string  `json:"syscall"`
+
+	// Args are the syscall arguments.
+	Args [6]uint64 `json:"args"`
+
+	// Panic is the value that the sentry panicked with.
+	Panic string `json:"panic"`
+
+	// Stack is the sentry stack trace at the time of the panic.
+	Stack string `json:"stack"`
+}
+
+// syscallPanics holds the crash reports of recovered syscall panics.
+type syscallPanics struct {
+	mu sync.Mutex
+
+	// +checklocks:mu
+	reports []SyscallPanicReport
+}
+
+// SyscallPanicReports returns the crash reports of the sentry panics that
+// were recovered from, oldest first. Panics are only recovered from if
+// InitKernelArgs.RecoverSyscallPanics was set.
+func (k *Kernel) SyscallPanicReports() []SyscallPanicReport {
+	k.syscallPanics.mu.Lock()
+	defer k.syscallPanics.mu.Unlock()
+	return append([]SyscallPanicReport(nil), k.syscallPanics.reports...)
+}
+
+// syscallPanicLockTimeout bounds how long recovering from a panic waits for
+// each of the locks that it requires. A lock that can't be acquired in that
+// time was most likely left locked by the panicking syscall.
+const syscallPanicLockTimeout = 5 * time.Second
+
+// syscallPanicLockPollInterval is how often recovering from a panic tries to
+// acquire each of the locks that it requires.
+const syscallPanicLockPollInterval = time.Millisecond
+
+// callSyscallRecovering calls fn, the implementation of sysno in s, recovering
+// from panics in it. If fn panics, a crash report is recorded, the task is
+// sent SIGSYS and the syscall fails with EFAULT.
+//
+// Recovering is best effort: locks that fn held without deferring their
+// release stay locked, and any sentry state that fn was modifying may be left
+// inconsistent. The SIGSYS is forced, i.e. it is unblocked and its default
+// action is restored, so that it kills the affected process before it
+// observes such state, while the rest of the sandbox keeps running. If fn
+// left locked any of the locks required to deliver the signal, recovering
+// would deadlock, so the panic is propagated instead.
+func (t *Task) callSyscallRecovering(s *SyscallTable, fn SyscallFn, sysno uintptr, args arch.SyscallArguments) (rval uintptr, ctrl *SyscallControl, err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		stack := debug.Stack()
+		for _, l := range []struct {
+			name string
+			mu   locker
+		}{
+			{"TaskSet.mu", &t.k.tasks.mu},
+			{"SignalHandlers.mu", &t.tg.signalHandlers.mu},
+			{"Task.mu", &t.mu},
+		} {
+			if !lockableWithin(l.mu, syscallPanicLockTimeout) {
+				log.Warningf("Not recovering from sentry panic in syscall %d, which left %s locked:\n%s", sysno, l.name, stack)
+				panic(r)
+			}
+		}
+		t.recordSyscallPanic(s, sysno, args, r, stack)
+		t.forceSignal(linux.SIGSYS, true /* unconditional */)
+		t.SendSignal(SignalInfoPriv(linux.SIGSYS))
+		rval, ctrl, err = 0, nil, linuxerr.EFAULT
+	}()
+	return fn(t, sysno, args)
+}
+
+// TestOnlyCallSyscallRecovering calls the implementation of sysno in s as a
+// syscall of t, recovering from panics in it as if
+// InitKernelArgs.RecoverSyscallPanics was set.
+func (t *Task) TestOnlyCallSyscallRecovering(s *SyscallTable, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	rval, _, err := t.callSyscallRecovering(s, s.Lookup(sysno), sysno, args)
+	return rval, err
+}
+
+// locker is implemented by the sentry's mutexes.
+type locker interface {
+	TryLock() bool
+	Unlock()
+}
+
+// lockableWithin returns true if mu can be locked within timeout. mu is
+// unlocked again before lockableWithin returns true. Since mu may never be
+// unlocked, it is polled rather than waited for.
+func lockableWithin(mu locker, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if mu.TryLock() {
+			mu.Unlock()
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(syscallPanicLockPollInterval)
+	}
+}
+
+func (t *Task) recordSyscallPanic(s *SyscallTable, sysno uintptr, args arch.SyscallArguments, r any, stack []byte) {
+	syscallPanicCounter.Increment()
+	report := SyscallPanicReport{
+		Time:        time.Now(),
+		ContainerID: t.ContainerID(),
+		TID:         t.k.tasks.Root.IDOfTask(t),
+		Comm:        t.Name(),
+		Sysno:       sysno,
+		Syscall:     s.LookupName(sysno),
+		Panic:       fmt.Sprint(r),
+		Stack:       string(stack),
+	}
+	for i := range report.Args {
+		report.Args[i] = args[i].Uint64()
+	}
+	log.Warningf("Recovered from sentry panic in syscall %s (%d) of task %d (%q) in container %q: %s\n%s", report.Syscall, sysno, report.TID, report.Comm, report.ContainerID, report.Panic, report.Stack)
+
+	p := &t.k.syscallPanics
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.reports) < syscallPanicMaxReports {
+		p.reports = append(p.reports, report)
+	}
+}
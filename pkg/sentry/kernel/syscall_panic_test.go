@@ -0,0 +1,34 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+func TestLockableWithin(t *testing.T) {
+	var mu sync.Mutex
+	if !lockableWithin(&mu, time.Minute) {
+		t.Errorf("lockableWithin returned false for an unlocked mutex")
+	}
+	mu.Lock()
+	if lockableWithin(&mu, 10*time.Millisecond) {
+		t.Errorf("lockableWithin returned true for a locked mutex")
+	}
+	mu.Unlock()
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel_test
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/testutil"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/tmpfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+func TestSyscallPanicSendsSIGSYS(t *testing.T) {
+	k, err := testutil.Boot()
+	if err != nil {
+		t.Fatalf("Error creating kernel: %v", err)
+	}
+	ctx := k.SupervisorContext()
+	creds := auth.CredentialsFromContext(ctx)
+	mntns, err := k.VFS().NewMountNamespace(ctx, creds, "", tmpfs.Name, &vfs.MountOptions{}, k)
+	if err != nil {
+		t.Fatalf("NewMountNamespace(): %v", err)
+	}
+	defer mntns.DecRef(ctx)
+	root := mntns.Root(ctx)
+	defer root.DecRef(ctx)
+	newTask := func(name string) *kernel.Task {
+		tg := k.NewThreadGroup(k.RootPIDNamespace(), kernel.NewSignalHandlers(), linux.SIGCHLD, k.GlobalInit().Limits())
+		task, err := testutil.CreateTask(ctx, name, tg, mntns, root, root)
+		if err != nil {
+			t.Fatalf("CreateTask(%q): %v", name, err)
+		}
+		return task
+	}
+	task := newTask("panicker")
+
+	// The SIGSYS must be delivered even if the task blocks and ignores it.
+	task.SetSignalMask(linux.SignalSetOf(linux.SIGSYS))
+	if _, err := task.ThreadGroup().SetSigAction(linux.SIGSYS, &linux.SigAction{Handler: linux.SIG_IGN}); err != nil {
+		t.Fatalf("SetSigAction(SIGSYS, SIG_IGN): %v", err)
+	}
+
+	const sysno = 0
+	table := &kernel.SyscallTable{
+		Table: map[uintptr]kernel.Syscall{
+			sysno: {
+				Name: "panicking",
+				Fn: func(*kernel.Task, uintptr, arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+					panic("injected panic")
+				},
+			},
+		},
+	}
+	table.Init()
+	if _, err := task.TestOnlyCallSyscallRecovering(table, sysno, arch.SyscallArguments{}); !linuxerr.Equals(linuxerr.EFAULT, err) {
+		t.Errorf("panicking syscall returned error %v, want EFAULT", err)
+	}
+
+	if task.PendingSignals()&linux.SignalSetOf(linux.SIGSYS) == 0 {
+		t.Errorf("SIGSYS is not pending after a panicking syscall, pending signals: %v", task.PendingSignals())
+	}
+	if task.SignalMask()&linux.SignalSetOf(linux.SIGSYS) != 0 {
+		t.Errorf("SIGSYS is still blocked after a panicking syscall")
+	}
+	reports := k.SyscallPanicReports()
+	if len(reports) != 1 {
+		t.Fatalf("got %d crash reports, want 1", len(reports))
+	}
+	if r := reports[0]; r.Syscall != "panicking" || r.Panic != "injected panic" || r.Comm != "panicker" {
+		t.Errorf("got crash report for syscall %q in task %q with panic %q, want syscall %q in task %q with panic %q", r.Syscall, r.Comm, r.Panic, "panicking", "panicker", "injected panic")
+	}
+
+	// The rest of the sandbox keeps working.
+	newTask("survivor")
+}
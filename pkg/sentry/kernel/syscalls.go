@@ -121,6 +121,14 @@ const (
 
 	// SecCheckRawExit represents raw/exit syscall seccheck event.
 	SecCheckRawExit
+
+	// CompatReportEnable records uses of the syscall in the compatibility
+	// report.
+	CompatReportEnable
+
+	// SyscallMetricsEnable counts uses of the syscall in the /syscalls
+	// metric.
+	SyscallMetricsEnable
 )
 
 // StraceEnableBits combines both strace log and event flags.
@@ -344,19 +352,24 @@ func (s *SyscallTable) MaxSysno() (max uintptr) {
 var allSyscallTables []*SyscallTable
 
 var (
-	// unimplementedSyscallCounterInit ensures the following fields are only initialized once.
-	unimplementedSyscallCounterInit sync.Once
+	// syscallCountersInit ensures the following fields are only initialized once.
+	syscallCountersInit sync.Once
 
-	// unimplementedSyscallNumbers maps syscall numbers to their string representation.
-	// Used such that incrementing unimplementedSyscallCounter does not require allocating memory.
+	// syscallNumbers maps syscall numbers to their string representation.
+	// Used such that incrementing syscall counters does not require allocating memory.
 	// Each element in the mapped slices are of length 1, as there is only one field for the
-	// unimplemented syscall counter metric. Allocating a slice is necessary as it is passed as a
+	// syscall counter metrics. Allocating a slice is necessary as it is passed as a
 	// variadic argument to the metric library.
-	unimplementedSyscallNumbers map[uintptr][]*metric.FieldValue
+	syscallNumbers map[uintptr][]*metric.FieldValue
 
 	// unimplementedSyscallCounter tracks the number of times each unimplemented syscall has been
 	// called by the sandboxed application.
 	unimplementedSyscallCounter *metric.Uint64Metric
+
+	// syscallNumberCounter tracks the number of times each syscall has been
+	// called by the sandboxed application. It is only incremented for syscalls
+	// that have SyscallMetricsEnable set, see EnableSyscallMetrics.
+	syscallNumberCounter *metric.Uint64Metric
 )
 
 // SyscallTables returns a read-only slice of registered SyscallTables.
@@ -383,16 +396,17 @@ func RegisterSyscallTable(s *SyscallTable) {
 		panic(fmt.Sprintf("Duplicate SyscallTable registered for OS %v Arch %v", s.OS, s.Arch))
 	}
 	allSyscallTables = append(allSyscallTables, s)
-	unimplementedSyscallCounterInit.Do(func() {
+	syscallCountersInit.Do(func() {
 		allowedValues := make([]*metric.FieldValue, sentry.MaxSyscallNum+2)
-		unimplementedSyscallNumbers = make(map[uintptr][]*metric.FieldValue, len(allowedValues))
+		syscallNumbers = make(map[uintptr][]*metric.FieldValue, len(allowedValues))
 		for i := uintptr(0); i <= sentry.MaxSyscallNum; i++ {
 			s := &metric.FieldValue{strconv.Itoa(int(i))}
 			allowedValues[i] = s
-			unimplementedSyscallNumbers[i] = []*metric.FieldValue{s}
+			syscallNumbers[i] = []*metric.FieldValue{s}
 		}
 		allowedValues[len(allowedValues)-1] = outOfRangeSyscallNumber[0]
 		unimplementedSyscallCounter = metric.MustCreateNewUint64Metric("/unimplemented_syscalls", true, "Number of times the application tried to call an unimplemented syscall, broken down by syscall number", metric.NewField("sysno", allowedValues...))
+		syscallNumberCounter = metric.MustCreateNewUint64Metric("/syscalls", true, "Number of times the application called each syscall, broken down by syscall number. Only collected if syscall metrics are enabled", metric.NewField("sysno", allowedValues...))
 	})
 	s.Init()
 }
@@ -492,9 +506,27 @@ type SyscallInfo struct {
 //
 //go:nosplit
 func IncrementUnimplementedSyscallCounter(sysno uintptr) {
-	s, found := unimplementedSyscallNumbers[sysno]
+	s, found := syscallNumbers[sysno]
 	if !found {
 		s = outOfRangeSyscallNumber
 	}
 	unimplementedSyscallCounter.Increment(s...)
 }
+
+// EnableSyscallMetrics makes all syscalls, implemented or not, count their
+// uses in the /syscalls metric.
+func EnableSyscallMetrics() {
+	for _, table := range SyscallTables() {
+		table.FeatureEnable.EnableAll(SyscallMetricsEnable)
+	}
+}
+
+// incrementSyscallCounter increments the /syscalls metric for the given
+// syscall number.
+func incrementSyscallCounter(sysno uintptr) {
+	s, found := syscallNumbers[sysno]
+	if !found {
+		s = outOfRangeSyscallNumber
+	}
+	syscallNumberCounter.Increment(s...)
+}
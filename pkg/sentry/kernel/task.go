@@ -18,6 +18,7 @@ import (
 	gocontext "context"
 	"runtime/trace"
 	"sync/atomic"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/atomicbitops"
@@ -28,6 +29,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/futex"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/semaphore"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
@@ -102,6 +104,12 @@ type Task struct {
 	goschedSeq sync.SeqCount `state:"nosave"`
 	gosched    TaskGoroutineSchedInfo
 
+	// switchOverhead is platform overhead reported by t.p that is too small to
+	// have been added to gosched.OverheadTicks yet.
+	//
+	// switchOverhead is exclusive to the task goroutine.
+	switchOverhead time.Duration
+
 	// yieldCount is the number of times the task goroutine has called
 	// Task.InterruptibleSleepStart, Task.UninterruptibleSleepStart, or
 	// Task.Yield(), voluntarily ceasing execution.
@@ -440,6 +448,12 @@ type Task struct {
 	// ipcns is protected by mu. ipcns is owned by the task goroutine.
 	ipcns *IPCNamespace
 
+	// semUndo holds the task's SysV semaphore adjust-on-exit values. It is
+	// shared with tasks created with CLONE_SYSVSEM, and allocated lazily.
+	//
+	// semUndo is owned by the task goroutine.
+	semUndo *semaphore.UndoList
+
 	// mountNamespace is the task's mount namespace.
 	//
 	// It is protected by mu. It is owned by the task goroutine.
@@ -613,6 +627,12 @@ var (
 	// handle.
 	faultCounter = metric.SentryProfiling.MustCreateNewUint64Metric(
 		"/task/faults", false, "The number of faults the sentry has handled.")
+
+	// signalInterruptsSkippedCounter is a metric that tracks how many signal
+	// notifications didn't need to interrupt the receiving task's platform
+	// context.
+	signalInterruptsSkippedCounter = metric.SentryProfiling.MustCreateNewUint64Metric(
+		"/task/signal_interrupts_skipped", false, "The number of signal notifications that didn't interrupt the receiver's platform context.")
 )
 
 func (t *Task) savePtraceTracer() *Task {
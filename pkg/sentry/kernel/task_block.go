@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/goid"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/waiter"
@@ -149,6 +150,12 @@ func (t *Task) block(C <-chan struct{}, timerChan <-chan struct{}) error {
 	t.prepareSleep()
 	defer t.completeSleep()
 
+	var detWake <-chan struct{}
+	if det := t.k.det; det != nil {
+		detWake = det.release(t, C, timerChan)
+		defer det.acquire(t)
+	}
+
 	// If the request is not completed, but the timer has already expired,
 	// then ensure that we run through a scheduler cycle. This is because
 	// we may see applications relying on timer slack to yield the thread.
@@ -179,6 +186,12 @@ func (t *Task) block(C <-chan struct{}, timerChan <-chan struct{}) error {
 		region.End()
 		// We've timed out.
 		return linuxerr.ETIMEDOUT
+
+	case <-detWake:
+		region.End()
+		// Woken by the deterministic scheduler to replay a wakeup; the
+		// caller retries the operation that it was blocked on.
+		return nil
 	}
 }
 
@@ -212,6 +225,9 @@ func (t *Task) UninterruptibleSleepStart(deactivate bool) {
 	t.assertTaskGoroutine()
 	if deactivate {
 		t.Deactivate()
+		if det := t.k.det; det != nil {
+			det.release(t, nil, nil)
+		}
 	}
 	t.accountTaskGoroutineEnter(TaskGoroutineBlockedUninterruptible)
 }
@@ -220,6 +236,9 @@ func (t *Task) UninterruptibleSleepStart(deactivate bool) {
 func (t *Task) UninterruptibleSleepFinish(activate bool) {
 	t.accountTaskGoroutineLeave(TaskGoroutineBlockedUninterruptible)
 	if activate {
+		if det := t.k.det; det != nil {
+			det.acquire(t)
+		}
 		t.Activate()
 	}
 }
@@ -246,6 +265,36 @@ func (t *Task) interrupt() {
 	t.p.Interrupt()
 }
 
+// interruptForSignalLocked is like interrupt, but is used to notify t of a
+// new pending signal. Applications that receive signals at a high rate, e.g.
+// the Go runtime preempting goroutines or JVMs reaching safepoints under a
+// profiler, mostly signal tasks that have already been notified or that are
+// signaling themselves; interrupting the platform context in these cases
+// only costs an additional switch to the application and back.
+//
+// Preconditions: The signal mutex must be locked.
+func (t *Task) interruptForSignalLocked() {
+	select {
+	case t.interruptChan <- struct{}{}:
+	default:
+		// t was interrupted and hasn't handled it yet. Whoever interrupted
+		// t either interrupted its platform context too, or is its task
+		// goroutine, which checks for interrupts before switching to the
+		// application. runInterrupt dequeues pending signals and unsets the
+		// interrupt in a single signal mutex critical section, so the new
+		// signal will be handled along with the pending interrupt.
+		signalInterruptsSkippedCounter.Increment()
+		return
+	}
+	if goid.Get() == t.goid.Load() {
+		// t's task goroutine can't be in platform.Context.Switch(), and it
+		// checks for interrupts before calling it again.
+		signalInterruptsSkippedCounter.Increment()
+		return
+	}
+	t.p.Interrupt()
+}
+
 // interruptSelf is like Interrupt, but can only be called by the task
 // goroutine.
 func (t *Task) interruptSelf() {
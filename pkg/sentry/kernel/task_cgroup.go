@@ -270,6 +270,9 @@ func (t *Task) chargeLocked(target *Task, ctl CgroupControllerType, res CgroupRe
 	// Due to the uniqueness of controllers on hierarchies, at most one cgroup
 	// in t.cgroups will match.
 	for c := range t.cgroups {
+		if !c.hasController(ctl) {
+			continue
+		}
 		err := c.Charge(target, c.Dentry, ctl, res, value)
 		if err == nil {
 			c.IncRef()
@@ -266,6 +266,13 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 		UserCounters:     uc,
 		SessionKeyring:   sessionKeyring,
 	}
+	if args.Flags&linux.CLONE_SYSVSEM != 0 {
+		// "If CLONE_SYSVSEM is set, then the child and the calling process
+		// share a single list of System V semaphore adjustment (semadj)
+		// values." - clone(2)
+		cfg.SemUndoList = t.SemUndoList()
+		cfg.SemUndoList.IncRef()
+	}
 	if args.Flags&linux.CLONE_THREAD == 0 {
 		cfg.Parent = t
 	} else {
@@ -319,6 +326,7 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 			return 0, nil, err
 		}
 	}
+	t.procForkEvent(nt)
 
 	// "If fork/clone and execve are allowed by @prog, any child processes will
 	// be constrained to the same filters and system call ABI as the parent." -
@@ -606,6 +614,12 @@ func (t *Task) Unshare(flags int32) error {
 		}
 		t.childPIDNamespace = t.tg.pidns.NewChild(t.UserNamespace())
 	}
+	if flags&(linux.CLONE_SYSVSEM|linux.CLONE_NEWIPC) != 0 {
+		// Unsharing the semaphore adjustment list (which CLONE_NEWIPC
+		// implies) detaches from it, as if the task exited. See Linux,
+		// kernel/fork.c:ksys_unshare().
+		t.releaseSemUndoList()
+	}
 	if flags&linux.CLONE_NEWNET != 0 {
 		if !haveCapSysAdmin {
 			return linuxerr.EPERM
@@ -21,12 +21,14 @@ import (
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/cpuid"
 	"gvisor.dev/gvisor/pkg/devutil"
+	"gvisor.dev/gvisor/pkg/sentry/guestrand"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/ipc"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/shm"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/limits"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 	"gvisor.dev/gvisor/pkg/sentry/unimpl"
@@ -106,6 +108,10 @@ func (t *Task) contextValue(key any, isTaskGoroutine bool) any {
 		return t.mountNamespace
 	case devutil.CtxDevGoferClient:
 		return t.k.getDevGoferClient(t.containerID)
+	case guestrand.CtxReader:
+		return t.k.GuestRand()
+	case inet.CtxNamespace:
+		return t.NetworkNamespace()
 	case inet.CtxStack:
 		return t.NetworkContext()
 	case ktime.CtxRealtimeClock:
@@ -116,6 +122,8 @@ func (t *Task) contextValue(key any, isTaskGoroutine bool) any {
 		return func(sig linux.Signal) error {
 			return t.SendSignal(SignalInfoNoInfo(sig, t, t))
 		}
+	case mm.CtxMaxMapCount:
+		return t.k.MaxMapCount.Load()
 	case pgalloc.CtxMemoryCgroupID:
 		return t.memCgID.Load()
 	case pgalloc.CtxMemoryFile:
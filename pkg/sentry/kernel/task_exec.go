@@ -255,6 +255,7 @@ func (r *runSyscallAfterExecStop) execute(t *Task) taskRunState {
 	// NOTE(b/30316266): All locks must be dropped prior to calling Activate.
 	t.MemoryManager().Activate(t)
 
+	t.procExecEvent()
 	t.ptraceExec(oldTID)
 	return (*runSyscallExit)(nil)
 }
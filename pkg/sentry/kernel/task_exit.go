@@ -234,6 +234,7 @@ func (*runExitMain) execute(t *Task) taskRunState {
 			return c.TaskExit(t, fields, info)
 		})
 	}
+	t.procExitEvent()
 
 	lastExiter := t.exitThreadGroup()
 
@@ -280,6 +281,9 @@ func (*runExitMain) execute(t *Task) taskRunState {
 	t.fsContext.DecRef(t)
 	t.fdTable.DecRef(t)
 
+	// Apply SysV semaphore adjustments if this is the last task sharing them.
+	t.releaseSemUndoList()
+
 	// Detach task from all cgroups. This must happen before potentially the
 	// last ref to the cgroupfs mount is dropped below.
 	t.LeaveCgroups()
@@ -50,6 +50,7 @@ func (t *Task) SetUID(uid auth.UID) error {
 		return linuxerr.EINVAL
 	}
 
+	defer t.procIDEvent(t.Credentials())
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
@@ -78,6 +79,7 @@ func (t *Task) SetUID(uid auth.UID) error {
 
 // SetREUID implements the semantics of setreuid(2).
 func (t *Task) SetREUID(r, e auth.UID) error {
+	defer t.procIDEvent(t.Credentials())
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	// "Supplying a value of -1 for either the real or effective user ID forces
@@ -122,6 +124,7 @@ func (t *Task) SetREUID(r, e auth.UID) error {
 
 // SetRESUID implements the semantics of the setresuid(2) syscall.
 func (t *Task) SetRESUID(r, e, s auth.UID) error {
+	defer t.procIDEvent(t.Credentials())
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	// "Unprivileged user processes may change the real UID, effective UID, and
@@ -226,6 +229,7 @@ func (t *Task) SetGID(gid auth.GID) error {
 		return linuxerr.EINVAL
 	}
 
+	defer t.procIDEvent(t.Credentials())
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
@@ -247,6 +251,7 @@ func (t *Task) SetGID(gid auth.GID) error {
 
 // SetREGID implements the semantics of setregid(2).
 func (t *Task) SetREGID(r, e auth.GID) error {
+	defer t.procIDEvent(t.Credentials())
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
@@ -285,6 +290,7 @@ func (t *Task) SetREGID(r, e auth.GID) error {
 func (t *Task) SetRESGID(r, e, s auth.GID) error {
 	var err error
 
+	defer t.procIDEvent(t.Credentials())
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
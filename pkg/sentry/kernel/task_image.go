@@ -17,6 +17,7 @@ package kernel
 import (
 	"fmt"
 
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/abi/linux/errno"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/hostarch"
@@ -50,6 +51,10 @@ type TaskImage struct {
 
 	// st is the task's syscall table.
 	st *SyscallTable `state:".(syscallTableInfo)"`
+
+	// personality is the task's execution domain and flags, set by the
+	// personality(2) system call. personality is protected by Task.mu.
+	personality uint32
 }
 
 // release releases all resources held by the TaskImage. release is called by
@@ -71,9 +76,10 @@ func (image *TaskImage) release(ctx context.Context) {
 // of the original's.
 func (image *TaskImage) Fork(ctx context.Context, k *Kernel, shareAddressSpace bool) (*TaskImage, error) {
 	newImage := &TaskImage{
-		Name: image.Name,
-		Arch: image.Arch.Fork(),
-		st:   image.st,
+		Name:        image.Name,
+		Arch:        image.Arch.Fork(),
+		st:          image.st,
+		personality: image.personality,
 	}
 	if shareAddressSpace {
 		newImage.MemoryManager = image.MemoryManager
@@ -164,5 +170,29 @@ func (k *Kernel) LoadTaskImage(ctx context.Context, args loader.LoadArgs) (*Task
 		MemoryManager: m,
 		fu:            k.futexes.Fork(),
 		st:            st,
+		personality:   args.Personality,
 	}, nil
 }
+
+// Personality returns t's personality(2).
+func (t *Task) Personality() uint32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.image.personality
+}
+
+// SetPersonality changes t's personality(2).
+func (t *Task) SetPersonality(personality uint32) {
+	t.mu.Lock()
+	t.image.personality = personality
+	t.mu.Unlock()
+}
+
+// ExecPersonality returns the personality(2) of a task after it executes a
+// binary, given its personality before. Since all binaries are 64-bit,
+// READ_IMPLIES_EXEC is cleared, as in Linux. Compare Linux's
+// arch/x86/kernel/process_64.c:set_personality_64bit() and
+// arch/arm64/include/asm/elf.h:SET_PERSONALITY().
+func ExecPersonality(personality uint32) uint32 {
+	return personality &^ linux.READ_IMPLIES_EXEC
+}
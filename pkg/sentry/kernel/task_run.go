@@ -83,6 +83,11 @@ func (t *Task) run(threadID uintptr) {
 	// interrupted.
 	t.interruptSelf()
 
+	if det := t.k.det; det != nil {
+		// Paired with the call to det.add in Task.Start.
+		det.acquire(t)
+	}
+
 	for {
 		// Explanation for this ordering:
 		//
@@ -97,6 +102,9 @@ func (t *Task) run(threadID uintptr) {
 		t.doStop()
 		t.runState = t.runState.execute(t)
 		if t.runState == nil {
+			if det := t.k.det; det != nil {
+				det.exit(t)
+			}
 			t.accountTaskGoroutineEnter(TaskGoroutineNonexistent)
 			t.goroutineStopped.Done()
 			t.tg.liveGoroutines.Done()
@@ -119,6 +127,12 @@ func (t *Task) doStop() {
 	if t.stopCount.Load() == 0 {
 		return
 	}
+	if det := t.k.det; det != nil {
+		// Deferred first, so that the run token is reacquired after
+		// everything below is undone.
+		det.release(t, nil, nil)
+		defer det.acquire(t)
+	}
 	t.Deactivate()
 	// NOTE(b/30316266): t.Activate() must be called without any locks held, so
 	// this defer must precede the defer for unlocking the signal mutex.
@@ -226,6 +240,13 @@ func (app *runApp) execute(t *Task) taskRunState {
 		t.rseqInterrupt()
 	}
 
+	// Signals that t sends to itself don't interrupt its platform context
+	// (see Task.interruptForSignalLocked), so check for them once nothing else
+	// can send any before switching to the application.
+	if t.interrupted() {
+		return (*runInterrupt)(nil)
+	}
+
 	// Check if we need to enable single-stepping. Tracers expect that the
 	// kernel preserves the value of the single-step flag set by PTRACE_SETREGS
 	// whether or not PTRACE_SINGLESTEP/PTRACE_SYSEMU_SINGLESTEP is used (this
@@ -251,6 +272,9 @@ func (app *runApp) execute(t *Task) taskRunState {
 	t.accountTaskGoroutineEnter(TaskGoroutineRunningApp)
 	info, at, err := t.p.Switch(t, t.MemoryManager(), t.Arch(), t.rseqCPU)
 	t.accountTaskGoroutineLeave(TaskGoroutineRunningApp)
+	if r, ok := t.p.(platform.SwitchCostReporter); ok {
+		t.accountSwitchOverhead(r.SwitchOverhead())
+	}
 	region.End()
 
 	if clearSinglestep {
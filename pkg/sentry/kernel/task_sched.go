@@ -27,6 +27,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/limits"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
 )
 
@@ -84,6 +85,15 @@ type TaskGoroutineSchedInfo struct {
 	// SysTicks is the amount of time the task goroutine has spent executing in
 	// the sentry, in units of linux.ClockTick.
 	SysTicks uint64
+
+	// OverheadTicks is the amount of time, in units of linux.ClockTick, that
+	// the platform reported spending outside of application code while the
+	// task goroutine was in state TaskGoroutineRunningApp, and that hasn't yet
+	// been moved from UserTicks to SysTicks. Since time in
+	// TaskGoroutineRunningApp is only accounted in whole ticks, overhead is
+	// charged against the ticks that elapse next in TaskGoroutineRunningApp,
+	// which keeps both UserTicks and SysTicks monotonic.
+	OverheadTicks uint64
 }
 
 // userTicksAt returns the extrapolated value of ts.UserTicks after
@@ -96,8 +106,11 @@ type TaskGoroutineSchedInfo struct {
 // making the observed stats non-monotonic.
 func (ts *TaskGoroutineSchedInfo) userTicksAt(now uint64) uint64 {
 	if ts.Timestamp < now && ts.State == TaskGoroutineRunningApp {
-		// Update stats to reflect execution since the last update.
-		return ts.UserTicks + (now - ts.Timestamp)
+		// Update stats to reflect execution since the last update, less
+		// platform overhead.
+		if elapsed := now - ts.Timestamp; elapsed > ts.OverheadTicks {
+			return ts.UserTicks + (elapsed - ts.OverheadTicks)
+		}
 	}
 	return ts.UserTicks
 }
@@ -107,8 +120,13 @@ func (ts *TaskGoroutineSchedInfo) userTicksAt(now uint64) uint64 {
 //
 // Preconditions: As for userTicksAt.
 func (ts *TaskGoroutineSchedInfo) sysTicksAt(now uint64) uint64 {
-	if ts.Timestamp < now && ts.State == TaskGoroutineRunningSys {
-		return ts.SysTicks + (now - ts.Timestamp)
+	if ts.Timestamp < now {
+		switch ts.State {
+		case TaskGoroutineRunningSys:
+			return ts.SysTicks + (now - ts.Timestamp)
+		case TaskGoroutineRunningApp:
+			return ts.SysTicks + min(now-ts.Timestamp, ts.OverheadTicks)
+		}
 	}
 	return ts.SysTicks
 }
@@ -149,13 +167,39 @@ func (t *Task) accountTaskGoroutineLeave(state TaskGoroutineState) {
 	t.goschedSeq.BeginWrite()
 	// This function is very hot; avoid defer.
 	if state == TaskGoroutineRunningApp {
-		t.gosched.UserTicks += now - t.gosched.Timestamp
+		elapsed := now - t.gosched.Timestamp
+		overhead := min(elapsed, t.gosched.OverheadTicks)
+		t.gosched.UserTicks += elapsed - overhead
+		t.gosched.SysTicks += overhead
+		t.gosched.OverheadTicks -= overhead
 	}
 	t.gosched.Timestamp = now
 	t.gosched.State = TaskGoroutineRunningSys
 	t.goschedSeq.EndWrite()
 }
 
+// accountSwitchOverhead records that the last call to platform.Context.Switch
+// spent d outside of application code, so that this time is accounted as
+// system rather than user time.
+//
+// Preconditions:
+//   - The caller must be running on the task goroutine.
+//   - t.gosched.State == TaskGoroutineRunningSys.
+func (t *Task) accountSwitchOverhead(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t.switchOverhead += d
+	if t.switchOverhead < linux.ClockTick {
+		return
+	}
+	ticks := uint64(t.switchOverhead / linux.ClockTick)
+	t.switchOverhead %= linux.ClockTick
+	t.goschedSeq.BeginWrite()
+	t.gosched.OverheadTicks += ticks
+	t.goschedSeq.EndWrite()
+}
+
 // Preconditions: The caller must be running on the task goroutine.
 func (t *Task) accountTaskGoroutineRunning() {
 	now := t.k.CPUClockNow()
@@ -452,6 +496,10 @@ func (k *Kernel) runCPUClockTicker() {
 
 		k.cpuClockMu.Unlock()
 
+		if k.hugepageCollapse != mm.HugepageCollapseNever && now%hugepageCollapseTicks == 0 {
+			k.scheduleHugepageCollapse(tgs)
+		}
+
 		// Retain tgs between calls to Notify to reduce allocations.
 		for i := range tgs {
 			tgs[i] = nil
@@ -468,13 +468,13 @@ func (t *Task) sendSignalTimerLocked(info *linux.SignalInfo, group bool, timer *
 	// ineligible, or a racing sibling task may dequeue the signal first.
 	if t.canReceiveSignalLocked(sig) {
 		t.Debugf("Notified of signal %d", sig)
-		t.interrupt()
+		t.interruptForSignalLocked()
 		return nil
 	}
 	if group {
 		if nt := t.tg.findSignalReceiverLocked(sig); nt != nil {
 			nt.Debugf("Notified of group signal %d", sig)
-			nt.interrupt()
+			nt.interruptForSignalLocked()
 			return nil
 		}
 	}
@@ -26,6 +26,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/futex"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/semaphore"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 )
@@ -81,6 +82,12 @@ type TaskConfig struct {
 	// IPCNamespace is the IPCNamespace of the new task.
 	IPCNamespace *IPCNamespace
 
+	// SemUndoList holds the SysV semaphore adjust-on-exit values shared with
+	// the new task. It may be nil. If not nil, a reference must be held on
+	// SemUndoList, which is transferred to TaskSet.NewTask whether or not it
+	// succeeds.
+	SemUndoList *semaphore.UndoList
+
 	// MountNamespace is the MountNamespace of the new task.
 	MountNamespace *vfs.MountNamespace
 
@@ -120,6 +127,10 @@ func (ts *TaskSet) NewTask(ctx context.Context, cfg *TaskConfig) (*Task, error)
 		cfg.UTSNamespace.DecRef(ctx)
 		cfg.IPCNamespace.DecRef(ctx)
 		cfg.NetworkNamespace.DecRef(ctx)
+		if cfg.SemUndoList != nil {
+			// The caller still holds a reference, so this can't be the last.
+			cfg.SemUndoList.DecRef(ctx, 0)
+		}
 		if cfg.MountNamespace != nil {
 			cfg.MountNamespace.DecRef(ctx)
 		}
@@ -163,6 +174,7 @@ func (ts *TaskSet) newTask(ctx context.Context, cfg *TaskConfig) (*Task, error)
 		niceness:       cfg.Niceness,
 		utsns:          cfg.UTSNamespace,
 		ipcns:          cfg.IPCNamespace,
+		semUndo:        cfg.SemUndoList,
 		mountNamespace: cfg.MountNamespace,
 		rseqCPU:        -1,
 		rseqAddr:       cfg.RSeqAddr,
@@ -388,6 +400,10 @@ func (t *Task) Start(tid ThreadID) {
 	// Task is now running in system mode.
 	t.accountTaskGoroutineLeave(TaskGoroutineNonexistent)
 
+	if det := t.k.det; det != nil {
+		det.add(t, tid)
+	}
+
 	// Use the task's TID in the root PID namespace to make it visible in stack dumps.
 	go t.run(uintptr(tid)) // S/R-SAFE: synchronizes with saving through stops
 }
@@ -127,6 +127,14 @@ func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval u
 		})
 	}
 
+	if bits.IsOn32(fe, CompatReportEnable) {
+		t.k.recordCompat(t, CompatSyscall, s.LookupName(sysno), SupportPartial, &args)
+	}
+
+	if bits.IsOn32(fe, SyscallMetricsEnable) {
+		incrementSyscallCounter(sysno)
+	}
+
 	if bits.IsOn32(fe, ExternalBeforeEnable) && (s.ExternalFilterBefore == nil || s.ExternalFilterBefore(t, sysno, args)) {
 		t.invokeExternal()
 		// Ensure we check for stops, then invoke the syscall again.
@@ -137,7 +145,9 @@ func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval u
 		if trace.IsEnabled() {
 			region = trace.StartRegion(t.traceContext, s.LookupName(sysno))
 		}
-		if fn != nil {
+		if fn != nil && t.k.recoverSyscallPanics {
+			rval, ctrl, err = t.callSyscallRecovering(s, fn, sysno, args)
+		} else if fn != nil {
 			// Call our syscall implementation.
 			rval, ctrl, err = fn(t, sysno, args)
 		} else {
@@ -210,6 +220,12 @@ func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval u
 //
 // The syscall path is very hot; avoid defer.
 func (t *Task) doSyscall() taskRunState {
+	if det := t.k.det; det != nil {
+		// System calls are the points at which tasks may be preempted in
+		// deterministic mode.
+		det.yield(t)
+	}
+
 	// Save value of the register which is clobbered in the following
 	// t.Arch().SetReturn(-ENOSYS) operation. This is dedicated to arm64.
 	//
@@ -245,6 +261,10 @@ func (t *Task) doSyscall() taskRunState {
 			t.Debugf("Syscall %d: killed by seccomp", sysno)
 			t.PrepareExit(linux.WaitStatusTerminationSignal(linux.SIGSYS))
 			return (*runExit)(nil)
+		case linux.SECCOMP_RET_KILL_PROCESS:
+			t.Debugf("Syscall %d: process killed by seccomp", sysno)
+			t.PrepareGroupExit(linux.WaitStatusTerminationSignal(linux.SIGSYS))
+			return (*runExit)(nil)
 		case linux.SECCOMP_RET_TRACE:
 			t.Debugf("Syscall %d: stopping for PTRACE_EVENT_SECCOMP", sysno)
 			return (*runSyscallAfterPtraceEventSeccomp)(nil)
@@ -396,6 +416,10 @@ func (t *Task) doVsyscall(addr hostarch.Addr, sysno uintptr) taskRunState {
 			t.Debugf("vsyscall %d: killed by seccomp", sysno)
 			t.PrepareExit(linux.WaitStatusTerminationSignal(linux.SIGSYS))
 			return (*runExit)(nil)
+		case linux.SECCOMP_RET_KILL_PROCESS:
+			t.Debugf("vsyscall %d: process killed by seccomp", sysno)
+			t.PrepareGroupExit(linux.WaitStatusTerminationSignal(linux.SIGSYS))
+			return (*runExit)(nil)
 		default:
 			panic(fmt.Sprintf("Unknown seccomp result %d", r))
 		}
@@ -17,7 +17,11 @@ package kernel
 import (
 	"testing"
 
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/goid"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
+	"gvisor.dev/gvisor/pkg/sentry/platform"
 )
 
 func TestTaskCPU(t *testing.T) {
@@ -73,3 +77,128 @@ func TestTaskCPU(t *testing.T) {
 	}
 
 }
+
+func TestSwitchOverheadAccounting(t *testing.T) {
+	task := &Task{}
+	task.gosched = TaskGoroutineSchedInfo{
+		Timestamp: 10,
+		State:     TaskGoroutineRunningSys,
+	}
+
+	// Overhead is only accounted in whole ticks.
+	task.accountSwitchOverhead(linux.ClockTick / 2)
+	if got := task.gosched.OverheadTicks; got != 0 {
+		t.Errorf("OverheadTicks after half a tick = %d, want 0", got)
+	}
+	task.accountSwitchOverhead(5*linux.ClockTick/2 + 1)
+	if got := task.gosched.OverheadTicks; got != 3 {
+		t.Errorf("OverheadTicks after 3 ticks = %d, want 3", got)
+	}
+	if got := task.switchOverhead; got != 1 {
+		t.Errorf("switchOverhead = %v, want 1ns", got)
+	}
+
+	// While running application code, overhead is charged to system time
+	// before any further user time.
+	task.gosched.State = TaskGoroutineRunningApp
+	for _, test := range []struct {
+		now  uint64
+		user uint64
+		sys  uint64
+	}{
+		{now: 10, user: 0, sys: 0},
+		{now: 12, user: 0, sys: 2},
+		{now: 13, user: 0, sys: 3},
+		{now: 17, user: 4, sys: 3},
+	} {
+		if user, sys := task.gosched.userTicksAt(test.now), task.gosched.sysTicksAt(test.now); user != test.user || sys != test.sys {
+			t.Errorf("ticks at %d: got user %d sys %d, want user %d sys %d", test.now, user, sys, test.user, test.sys)
+		}
+	}
+}
+
+// interruptCountingContext is a platform.Context that counts calls to
+// Interrupt. Its other methods must not be called.
+type interruptCountingContext struct {
+	platform.Context
+	interrupts atomicbitops.Int32
+}
+
+// Interrupt implements platform.Context.Interrupt.
+func (c *interruptCountingContext) Interrupt() {
+	c.interrupts.Add(1)
+}
+
+func TestInterruptForSignal(t *testing.T) {
+	newTask := func() (*Task, *interruptCountingContext) {
+		c := &interruptCountingContext{}
+		return &Task{
+			interruptChan: make(chan struct{}, 1),
+			p:             c,
+		}, c
+	}
+	// onOtherGoroutine runs f on a goroutine other than the task goroutine,
+	// as when another task sends a signal.
+	onOtherGoroutine := func(f func()) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			f()
+		}()
+		<-done
+	}
+
+	t.Run("Other", func(t *testing.T) {
+		task, c := newTask()
+		task.goid.Store(goid.Get())
+		onOtherGoroutine(task.interruptForSignalLocked)
+		if !task.interrupted() {
+			t.Errorf("task wasn't interrupted")
+		}
+		if got := c.interrupts.Load(); got != 1 {
+			t.Errorf("got %d platform interrupts, want 1", got)
+		}
+	})
+
+	t.Run("Self", func(t *testing.T) {
+		// The task goroutine can't be switched to the application, and checks
+		// for interrupts before it is, so the platform context must not be
+		// interrupted.
+		task, c := newTask()
+		task.goid.Store(goid.Get())
+		task.interruptForSignalLocked()
+		if !task.interrupted() {
+			t.Errorf("task wasn't interrupted")
+		}
+		if got := c.interrupts.Load(); got != 0 {
+			t.Errorf("got %d platform interrupts, want 0", got)
+		}
+	})
+
+	t.Run("AlreadyInterrupted", func(t *testing.T) {
+		// The first signal interrupts the platform context. The second
+		// arrives before the task handles the first, and is handled along
+		// with it.
+		task, c := newTask()
+		task.goid.Store(goid.Get())
+		onOtherGoroutine(task.interruptForSignalLocked)
+		onOtherGoroutine(task.interruptForSignalLocked)
+		if !task.interrupted() {
+			t.Errorf("task wasn't interrupted")
+		}
+		if got := c.interrupts.Load(); got != 1 {
+			t.Errorf("got %d platform interrupts, want 1", got)
+		}
+
+		// Once the task handled the interrupt, the next signal interrupts the
+		// platform context again.
+		task.unsetInterrupted()
+		onOtherGoroutine(task.interruptForSignalLocked)
+		if !task.interrupted() {
+			t.Errorf("task wasn't interrupted after handling the previous interrupt")
+		}
+		if got := c.interrupts.Load(); got != 2 {
+			t.Errorf("got %d platform interrupts, want 2", got)
+		}
+	})
+}
@@ -246,6 +246,20 @@ type Clock interface {
 	waiter.Waitable
 }
 
+// SyncEventsClock is implemented by Clocks that may require Timers to handle
+// their events synchronously.
+type SyncEventsClock interface {
+	Clock
+
+	// SyncEvents returns true if Timers must check for expirations in the
+	// goroutine that generates the Clock's events, before the event
+	// notification returns, rather than asynchronously in the Timer
+	// goroutine. This allows Clocks that elapse at the request of their
+	// user, rather than with wall time, to order expirations with respect
+	// to their user's execution.
+	SyncEvents() bool
+}
+
 // WallRateClock implements Clock.WallTimeUntil for Clocks that elapse at the
 // same rate as wall time.
 type WallRateClock struct{}
@@ -480,7 +494,14 @@ func (t *Timer) init() {
 	// If t.kicker is nil, the Timer goroutine can't be running, so we can't
 	// race with it.
 	t.kicker = time.NewTimer(0)
-	t.entry, t.events = waiter.NewChannelEntry(timerTickEvents)
+	if sc, ok := t.clock.(SyncEventsClock); ok && sc.SyncEvents() {
+		// t.events is then only used to instruct the Timer goroutine to
+		// exit.
+		t.entry = waiter.NewFunctionEntry(timerTickEvents, func(waiter.EventMask) { t.Tick() })
+		t.events = make(chan struct{})
+	} else {
+		t.entry, t.events = waiter.NewChannelEntry(timerTickEvents)
+	}
 	if err := t.clock.EventRegister(&t.entry); err != nil {
 		panic(err)
 	}
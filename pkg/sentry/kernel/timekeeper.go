@@ -16,6 +16,7 @@ package kernel
 
 import (
 	"fmt"
+	"math"
 	"time"
 
 	"gvisor.dev/gvisor/pkg/atomicbitops"
@@ -26,6 +27,7 @@ import (
 	sentrytime "gvisor.dev/gvisor/pkg/sentry/time"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/waiter"
 )
 
 // Timekeeper manages all of the kernel clocks.
@@ -40,6 +42,17 @@ type Timekeeper struct {
 	// It is set only once, by SetClocks.
 	clocks sentrytime.Clocks `state:"nosave"`
 
+	// virtual is clocks if they are sentrytime.VirtualClocks, which are only
+	// used for deterministic execution. It is set only once, by SetClocks.
+	virtual *sentrytime.VirtualClocks `state:"nosave"`
+
+	// virtualTimersMu protects virtualTimers.
+	virtualTimersMu sync.Mutex `state:"nosave"`
+
+	// virtualTimers are the entries registered with realtimeClock and
+	// monotonicClock if virtual is set, in registration order.
+	virtualTimers []*waiter.Entry `state:"nosave"`
+
 	// realtimeClock is a ktime.Clock based on timekeeper's Realtime.
 	realtimeClock *timekeeperClock
 
@@ -129,6 +142,9 @@ func (t *Timekeeper) SetClocks(c sentrytime.Clocks) {
 	}
 
 	t.clocks = c
+	if vc, ok := c.(*sentrytime.VirtualClocks); ok {
+		t.virtual = vc
+	}
 
 	// Compute the offset of the monotonic clock from the base Clocks.
 	//
@@ -327,6 +343,61 @@ func (t *Timekeeper) GetTime(c sentrytime.ClockID) (int64, error) {
 	return now, err
 }
 
+// clockErrorer is implemented by sentrytime.Clocks that estimate their error
+// relative to the host clocks they track.
+type clockErrorer interface {
+	Error(c sentrytime.ClockID) (sentrytime.ReferenceNS, bool)
+}
+
+// ClockError returns the estimated error of the given clock relative to the
+// host clock it tracks. ok is false if the error is unknown, either because
+// the clock is not calibrated yet or because the clock source doesn't
+// estimate its error.
+func (t *Timekeeper) ClockError(c sentrytime.ClockID) (d time.Duration, ok bool) {
+	if t.clocks == nil {
+		return 0, false
+	}
+	ce, ok := t.clocks.(clockErrorer)
+	if !ok {
+		return 0, false
+	}
+	errorNS, ok := ce.Error(c)
+	return time.Duration(errorNS), ok
+}
+
+// advanceVirtual advances the virtual clocks by d, delivering any timer
+// expirations before it returns.
+//
+// Preconditions: The Timekeeper uses sentrytime.VirtualClocks.
+func (t *Timekeeper) advanceVirtual(d time.Duration) {
+	if t.virtual.Advance(d) {
+		t.notifyVirtualTimers()
+	}
+}
+
+// advanceVirtualTo advances the virtual monotonic clock to ns, as returned by
+// sentrytime.VirtualClocks.NextDeadline, delivering any timer expirations
+// before it returns.
+//
+// Preconditions: The Timekeeper uses sentrytime.VirtualClocks.
+func (t *Timekeeper) advanceVirtualTo(ns int64) {
+	if t.virtual.AdvanceTo(ns) {
+		t.notifyVirtualTimers()
+	}
+}
+
+// notifyVirtualTimers instructs all timers on the virtual clocks to check for
+// expirations. Since the clocks' events are synchronous, this happens before
+// notifyVirtualTimers returns.
+func (t *Timekeeper) notifyVirtualTimers() {
+	t.virtualTimersMu.Lock()
+	entries := append([]*waiter.Entry(nil), t.virtualTimers...)
+	t.virtualTimersMu.Unlock()
+	for _, e := range entries {
+		e.NotifyEvent(ktime.ClockEventSet)
+	}
+}
+
 // BootTime returns the system boot real time.
 func (t *Timekeeper) BootTime() ktime.Time {
 	return t.bootTime
@@ -339,15 +410,10 @@ func (t *Timekeeper) BootTime() ktime.Time {
 type timekeeperClock struct {
 	tk *Timekeeper
 	c  sentrytime.ClockID
-
-	// Implements ktime.Clock.WallTimeUntil.
-	ktime.WallRateClock `state:"nosave"`
-
-	// Implements waiter.Waitable. (We have no ability to detect
-	// discontinuities from external changes to CLOCK_REALTIME).
-	ktime.NoClockEvents `state:"nosave"`
 }
 
+var _ ktime.SyncEventsClock = (*timekeeperClock)(nil)
+
 // Now implements ktime.Clock.Now.
 func (tc *timekeeperClock) Now() ktime.Time {
 	now, err := tc.tk.GetTime(tc.c)
@@ -356,3 +422,57 @@ func (tc *timekeeperClock) Now() ktime.Time {
 	}
 	return ktime.FromNanoseconds(now)
 }
+
+// WallTimeUntil implements ktime.Clock.WallTimeUntil.
+func (tc *timekeeperClock) WallTimeUntil(t, now ktime.Time) time.Duration {
+	vc := tc.tk.virtual
+	if vc == nil {
+		return t.Sub(now)
+	}
+	// Virtual time doesn't elapse with wall time. Instead, the clocks
+	// notify timers synchronously when they reach t.
+	ns := t.Nanoseconds()
+	if tc.c == sentrytime.Monotonic {
+		ns -= tc.tk.monotonicOffset
+	}
+	vc.AddDeadline(tc.c, ns)
+	return time.Duration(math.MaxInt64)
+}
+
+// SyncEvents implements ktime.SyncEventsClock.SyncEvents.
+func (tc *timekeeperClock) SyncEvents() bool {
+	return tc.tk.virtual != nil
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (*timekeeperClock) Readiness(mask waiter.EventMask) waiter.EventMask {
+	return 0
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (tc *timekeeperClock) EventRegister(e *waiter.Entry) error {
+	// Only virtual clocks generate events. (We have no ability to detect
+	// discontinuities from external changes to CLOCK_REALTIME).
+	if tc.tk.virtual == nil {
+		return nil
+	}
+	tc.tk.virtualTimersMu.Lock()
+	defer tc.tk.virtualTimersMu.Unlock()
+	tc.tk.virtualTimers = append(tc.tk.virtualTimers, e)
+	return nil
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (tc *timekeeperClock) EventUnregister(e *waiter.Entry) {
+	if tc.tk.virtual == nil {
+		return
+	}
+	tc.tk.virtualTimersMu.Lock()
+	defer tc.tk.virtualTimersMu.Unlock()
+	for i, te := range tc.tk.virtualTimers {
+		if te == e {
+			tc.tk.virtualTimers = append(tc.tk.virtualTimers[:i], tc.tk.virtualTimers[i+1:]...)
+			return
+		}
+	}
+}
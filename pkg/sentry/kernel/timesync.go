@@ -0,0 +1,176 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	sentrytime "gvisor.dev/gvisor/pkg/sentry/time"
+)
+
+// TimeSyncState describes how closely the sandbox's clocks track true time,
+// and whether the sandbox's random number source is seeded.
+type TimeSyncState struct {
+	// RealtimeErrorNS and MonotonicErrorNS are the estimated errors of the
+	// sandbox's CLOCK_REALTIME and CLOCK_MONOTONIC relative to the host's,
+	// in nanoseconds, or -1 if unknown.
+	RealtimeErrorNS  int64 `json:"realtimeErrorNS"`
+	MonotonicErrorNS int64 `json:"monotonicErrorNS"`
+
+	// HostTimeSync is true if the host's NTP synchronization state is
+	// available to the sandbox. The fields below are only valid if it is
+	// true.
+	HostTimeSync bool `json:"hostTimeSync"`
+
+	// HostSynchronized is true if the host kernel considers its clock
+	// synchronized to a time source.
+	HostSynchronized bool `json:"hostSynchronized"`
+
+	// HostMaxErrorNS and HostEstErrorNS are the maximum and estimated errors
+	// of the host's CLOCK_REALTIME, as reported by adjtimex(2), in
+	// nanoseconds.
+	HostMaxErrorNS int64 `json:"hostMaxErrorNS"`
+	HostEstErrorNS int64 `json:"hostEstErrorNS"`
+
+	// MaxErrorNS bounds the error of the sandbox's CLOCK_REALTIME relative to
+	// true time, in nanoseconds, or is -1 if unknown.
+	MaxErrorNS int64 `json:"maxErrorNS"`
+
+	// EntropyReady is true if the host's random number generator, from which
+	// the sandbox's is seeded, is initialized, such that getrandom(2) doesn't
+	// block.
+	EntropyReady bool `json:"entropyReady"`
+}
+
+// TimeSyncState returns the kernel's time synchronization state.
+func (k *Kernel) TimeSyncState() TimeSyncState {
+	s := TimeSyncState{
+		RealtimeErrorNS:  -1,
+		MonotonicErrorNS: -1,
+		MaxErrorNS:       -1,
+		HostTimeSync:     k.hostTimeSync,
+	}
+	if d, ok := k.timekeeper.ClockError(sentrytime.Realtime); ok {
+		s.RealtimeErrorNS = d.Nanoseconds()
+	}
+	if d, ok := k.timekeeper.ClockError(sentrytime.Monotonic); ok {
+		s.MonotonicErrorNS = d.Nanoseconds()
+	}
+	if k.hostTimeSync {
+		if tx, state, err := hostTimex(); err == nil {
+			s.HostSynchronized = timexSynchronized(&tx, state)
+			s.HostMaxErrorNS = tx.Maxerror * int64(time.Microsecond)
+			s.HostEstErrorNS = tx.Esterror * int64(time.Microsecond)
+			if s.HostSynchronized && s.RealtimeErrorNS >= 0 {
+				s.MaxErrorNS = s.HostMaxErrorNS + s.RealtimeErrorNS
+			}
+		}
+	}
+	var b [1]byte
+	_, err := unix.Getrandom(b[:], unix.GRND_NONBLOCK)
+	s.EntropyReady = err == nil
+	return s
+}
+
+// Timex returns the NTP state of the sandbox's CLOCK_REALTIME, as read by
+// adjtimex(2), and the clock state that adjtimex(2) returns.
+//
+// If the host's state is unavailable, the clock is reported as
+// unsynchronized, which is true from the sandbox's perspective: it has no
+// way to discipline its clock.
+func (k *Kernel) Timex() (linux.Timex, int32) {
+	var tx linux.Timex
+	now := k.RealtimeClock().Now().Nanoseconds()
+	tx.Time = linux.NsecToTimeval(now)
+	if k.hostTimeSync {
+		if htx, state, err := k.taskHostTimex(); err == nil {
+			tx.Offset = htx.Offset
+			tx.Freq = htx.Freq
+			tx.MaxError = htx.Maxerror
+			tx.EstError = htx.Esterror
+			tx.Status = htx.Status
+			tx.Constant = htx.Constant
+			tx.Precision = htx.Precision
+			tx.Tolerance = htx.Tolerance
+			tx.Tick = htx.Tick
+			tx.TAI = htx.Tai
+			if tx.Status&linux.STA_NANO != 0 {
+				// Time.Usec holds nanoseconds.
+				tx.Time = linux.Timeval{Sec: now / 1e9, Usec: now % 1e9}
+			}
+			// Account for the sandbox clock's own error, rounded up to
+			// microseconds.
+			if d, ok := k.timekeeper.ClockError(sentrytime.Realtime); ok {
+				us := int64((d + time.Microsecond - 1) / time.Microsecond)
+				tx.MaxError += us
+				tx.EstError += us
+			}
+			return tx, int32(state)
+		}
+	}
+	tx.Status = linux.STA_UNSYNC
+	tx.MaxError = linux.NTP_PHASE_LIMIT
+	tx.EstError = linux.NTP_PHASE_LIMIT
+	tx.Constant = 2
+	tx.Precision = 1
+	tx.Tolerance = 32768000
+	tx.Tick = int64(linux.ClockTick / time.Microsecond)
+	return tx, linux.TIME_ERROR
+}
+
+// hostTimex reads the host's NTP state without modifying it.
+func hostTimex() (unix.Timex, int, error) {
+	var tx unix.Timex
+	state, err := unix.Adjtimex(&tx)
+	return tx, state, err
+}
+
+// taskHostTimex is hostTimex for a task goroutine. In deterministic mode, the
+// host's state is an external input.
+func (k *Kernel) taskHostTimex() (unix.Timex, int, error) {
+	if !k.Deterministic() {
+		return hostTimex()
+	}
+	in := k.DeterministicRead("host timex", func() ExternalInput {
+		tx, state, err := hostTimex()
+		in := NewExternalInput(nil, err)
+		in.Args = []int64{int64(state), tx.Offset, tx.Freq, tx.Maxerror, tx.Esterror, int64(tx.Status), tx.Constant, tx.Precision, tx.Tolerance, tx.Tick, int64(tx.Tai)}
+		return in
+	})
+	if err := in.Err(); err != nil {
+		return unix.Timex{}, 0, err
+	}
+	a := in.Args
+	return unix.Timex{
+		Offset:    a[1],
+		Freq:      a[2],
+		Maxerror:  a[3],
+		Esterror:  a[4],
+		Status:    int32(a[5]),
+		Constant:  a[6],
+		Precision: a[7],
+		Tolerance: a[8],
+		Tick:      a[9],
+		Tai:       int32(a[10]),
+	}, int(a[0]), nil
+}
+
+// timexSynchronized returns true if tx and state, as returned by
+// adjtimex(2), describe a synchronized clock.
+func timexSynchronized(tx *unix.Timex, state int) bool {
+	return state != linux.TIME_ERROR && tx.Status&linux.STA_UNSYNC == 0
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	sentrytime "gvisor.dev/gvisor/pkg/sentry/time"
+)
+
+// mockErrorClocks is a mockClocks that also reports fixed clock errors.
+type mockErrorClocks struct {
+	mockClocks
+	monotonicError int64
+	realtimeError  int64
+}
+
+// Error implements clockErrorer.Error.
+func (c *mockErrorClocks) Error(id sentrytime.ClockID) (sentrytime.ReferenceNS, bool) {
+	switch id {
+	case sentrytime.Monotonic:
+		return sentrytime.ReferenceNS(c.monotonicError), true
+	case sentrytime.Realtime:
+		return sentrytime.ReferenceNS(c.realtimeError), true
+	default:
+		return 0, false
+	}
+}
+
+// timeSyncTestKernel returns a Kernel whose clocks are c.
+func timeSyncTestKernel(t *testing.T, c sentrytime.Clocks, hostTimeSync bool) *Kernel {
+	tk := stateTestClocklessTimekeeper(t)
+	tk.realtimeClock = &timekeeperClock{tk: tk, c: sentrytime.Realtime}
+	tk.monotonicClock = &timekeeperClock{tk: tk, c: sentrytime.Monotonic}
+	tk.SetClocks(c)
+	t.Cleanup(tk.Destroy)
+	return &Kernel{
+		timekeeper:   tk,
+		hostTimeSync: hostTimeSync,
+	}
+}
+
+func TestTimexSynchronized(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		status int32
+		state  int
+		want   bool
+	}{
+		{name: "Synchronized", status: linux.STA_PLL, state: linux.TIME_OK, want: true},
+		{name: "Unsync", status: linux.STA_PLL | linux.STA_UNSYNC, state: linux.TIME_OK, want: false},
+		{name: "TimeError", status: linux.STA_PLL, state: linux.TIME_ERROR, want: false},
+		{name: "Both", status: linux.STA_UNSYNC, state: linux.TIME_ERROR, want: false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tx := unix.Timex{Status: test.status}
+			if got := timexSynchronized(&tx, test.state); got != test.want {
+				t.Errorf("timexSynchronized(status=%#x, state=%d) = %t, want %t", test.status, test.state, got, test.want)
+			}
+		})
+	}
+}
+
+func TestTimeSyncStateUnknownError(t *testing.T) {
+	k := timeSyncTestKernel(t, &mockClocks{}, false /* hostTimeSync */)
+	s := k.TimeSyncState()
+	if s.RealtimeErrorNS != -1 || s.MonotonicErrorNS != -1 {
+		t.Errorf("got clock errors (%d, %d), want (-1, -1)", s.RealtimeErrorNS, s.MonotonicErrorNS)
+	}
+	if s.HostTimeSync || s.HostSynchronized {
+		t.Errorf("got HostTimeSync=%t HostSynchronized=%t, want false", s.HostTimeSync, s.HostSynchronized)
+	}
+	if s.MaxErrorNS != -1 {
+		t.Errorf("got MaxErrorNS %d, want -1", s.MaxErrorNS)
+	}
+}
+
+func TestTimeSyncStateClockError(t *testing.T) {
+	k := timeSyncTestKernel(t, &mockErrorClocks{
+		monotonicError: 2000,
+		realtimeError:  3000,
+	}, false /* hostTimeSync */)
+	s := k.TimeSyncState()
+	if s.RealtimeErrorNS != 3000 || s.MonotonicErrorNS != 2000 {
+		t.Errorf("got clock errors (%d, %d), want (3000, 2000)", s.RealtimeErrorNS, s.MonotonicErrorNS)
+	}
+	// Without the host's state, the error relative to true time is unknown.
+	if s.MaxErrorNS != -1 {
+		t.Errorf("got MaxErrorNS %d, want -1", s.MaxErrorNS)
+	}
+}
+
+func TestTimeSyncStateHost(t *testing.T) {
+	if _, _, err := hostTimex(); err != nil {
+		t.Skipf("adjtimex(2) is unavailable: %v", err)
+	}
+	k := timeSyncTestKernel(t, &mockErrorClocks{realtimeError: 3000}, true /* hostTimeSync */)
+	s := k.TimeSyncState()
+	if !s.HostTimeSync {
+		t.Errorf("got HostTimeSync=false, want true")
+	}
+	if s.HostSynchronized {
+		if want := s.HostMaxErrorNS + 3000; s.MaxErrorNS != want {
+			t.Errorf("got MaxErrorNS %d, want %d", s.MaxErrorNS, want)
+		}
+	} else if s.MaxErrorNS != -1 {
+		t.Errorf("got MaxErrorNS %d for an unsynchronized host, want -1", s.MaxErrorNS)
+	}
+}
+
+func TestTimexUnsynchronized(t *testing.T) {
+	k := timeSyncTestKernel(t, &mockErrorClocks{
+		mockClocks:    mockClocks{realtime: 1500123456},
+		realtimeError: 3000,
+	}, false /* hostTimeSync */)
+	tx, state := k.Timex()
+	if state != linux.TIME_ERROR {
+		t.Errorf("got state %d, want TIME_ERROR", state)
+	}
+	if tx.Status&linux.STA_UNSYNC == 0 {
+		t.Errorf("got status %#x, want STA_UNSYNC", tx.Status)
+	}
+	if tx.MaxError != linux.NTP_PHASE_LIMIT || tx.EstError != linux.NTP_PHASE_LIMIT {
+		t.Errorf("got errors (%d, %d), want (%d, %d)", tx.MaxError, tx.EstError, linux.NTP_PHASE_LIMIT, linux.NTP_PHASE_LIMIT)
+	}
+	if want := (linux.Timeval{Sec: 1, Usec: 500123}); tx.Time != want {
+		t.Errorf("got time %+v, want %+v", tx.Time, want)
+	}
+}
+
+func TestTimexHost(t *testing.T) {
+	before, _, err := hostTimex()
+	if err != nil {
+		t.Skipf("adjtimex(2) is unavailable: %v", err)
+	}
+	k := timeSyncTestKernel(t, &mockErrorClocks{realtimeError: 1500}, true /* hostTimeSync */)
+	tx, _ := k.Timex()
+	after, _, err := hostTimex()
+	if err != nil {
+		t.Fatalf("adjtimex(2) failed: %v", err)
+	}
+	if tx.Tick != after.Tick {
+		t.Errorf("got Tick %d, want host's %d", tx.Tick, after.Tick)
+	}
+	// The host's maximum error grows until its clock is disciplined again,
+	// which may happen between the reads.
+	if before.Maxerror > after.Maxerror {
+		t.Skipf("host maximum error decreased from %d to %d", before.Maxerror, after.Maxerror)
+	}
+	// The sandbox clock's error is rounded up to 2us.
+	if tx.MaxError < before.Maxerror+2 || tx.MaxError > after.Maxerror+2 {
+		t.Errorf("got MaxError %d, want in [%d, %d]", tx.MaxError, before.Maxerror+2, after.Maxerror+2)
+	}
+}
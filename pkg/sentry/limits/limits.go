@@ -221,13 +221,15 @@ func (l *LimitSet) Set(t LimitType, v Limit, privileged bool) (Limit, error) {
 	// If a limit is already set, make sure the new limit doesn't
 	// exceed the previous max limit.
 	if _, ok := l.data[t]; ok {
+		// As in Linux, an invalid limit is reported before a lack of
+		// privilege.
+		if v.Cur > v.Max {
+			return Limit{}, unix.EINVAL
+		}
 		// Unprivileged users can only lower their hard limits.
 		if l.data[t].Max < v.Max && !privileged {
 			return Limit{}, unix.EPERM
 		}
-		if v.Cur > v.Max {
-			return Limit{}, unix.EINVAL
-		}
 	}
 	old := l.data[t]
 	l.data[t] = v
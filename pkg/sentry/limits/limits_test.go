@@ -31,6 +31,7 @@ func TestSet(t *testing.T) {
 		{limit: Limit{Cur: 20, Max: 60}, privileged: false, expectedErr: unix.EPERM},
 		{limit: Limit{Cur: 60, Max: 50}, privileged: false, expectedErr: unix.EINVAL},
 		{limit: Limit{Cur: 11, Max: 10}, privileged: false, expectedErr: unix.EINVAL},
+		{limit: Limit{Cur: 70, Max: 60}, privileged: false, expectedErr: unix.EINVAL},
 		{limit: Limit{Cur: 20, Max: 60}, privileged: true, expectedErr: nil},
 	}
 
@@ -28,6 +28,7 @@ import (
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/guestrand"
 	"gvisor.dev/gvisor/pkg/sentry/limits"
 	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/mm"
@@ -571,10 +572,12 @@ func loadParsedELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDescrip
 //
 // It does not load the ELF interpreter, or return any auxv entries.
 //
+// personality is the personality(2) of the task that f is loaded for.
+//
 // Preconditions:
 //   - f is an ELF file.
 //   - f is the first ELF loaded into m.
-func loadInitialELF(ctx context.Context, m *mm.MemoryManager, fs cpuid.FeatureSet, fd *vfs.FileDescription) (loadedELF, *arch.Context64, error) {
+func loadInitialELF(ctx context.Context, m *mm.MemoryManager, fs cpuid.FeatureSet, fd *vfs.FileDescription, personality uint32) (loadedELF, *arch.Context64, error) {
 	info, err := parseHeader(ctx, fd)
 	if err != nil {
 		ctx.Infof("Failed to parse initial ELF: %v", err)
@@ -591,7 +594,7 @@ func loadInitialELF(ctx context.Context, m *mm.MemoryManager, fs cpuid.FeatureSe
 	// mapping anything.
 	ac := arch.New(info.arch)
 
-	l, err := m.SetMmapLayout(ac, limits.FromContext(ctx))
+	l, err := m.SetMmapLayout(ctx, ac, limits.FromContext(ctx), personality)
 	if err != nil {
 		ctx.Warningf("Failed to set mmap layout: %v", err)
 		return loadedELF{}, nil, err
@@ -600,7 +603,8 @@ func loadInitialELF(ctx context.Context, m *mm.MemoryManager, fs cpuid.FeatureSe
 	// PIELoadAddress tries to move the ELF out of the way of the default
 	// mmap base to ensure that the initial brk has sufficient space to
 	// grow.
-	le, err := loadParsedELF(ctx, m, fd, info, ac.PIELoadAddress(l))
+	rng := guestrand.RNG(ctx)
+	le, err := loadParsedELF(ctx, m, fd, info, ac.PIELoadAddress(l, &rng))
 	return le, ac, err
 }
 
@@ -642,7 +646,7 @@ func loadInterpreterELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDe
 //
 // Preconditions: args.File is an ELF file.
 func loadELF(ctx context.Context, args LoadArgs) (loadedELF, *arch.Context64, error) {
-	bin, ac, err := loadInitialELF(ctx, args.MemoryManager, args.Features, args.File)
+	bin, ac, err := loadInitialELF(ctx, args.MemoryManager, args.Features, args.File, args.Personality)
 	if err != nil {
 		ctx.Infof("Error loading binary: %v", err)
 		return loadedELF{}, nil, err
@@ -19,6 +19,7 @@ import (
 
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 )
 
@@ -204,6 +205,19 @@ func (mm *MemoryManager) mapASLocked(pseg pmaIterator, ar hostarch.AddrRange, pr
 		if pma.needCOW {
 			perms.Write = false
 		}
+		if perms.Write {
+			if mf, ok := pma.file.(*pgalloc.MemoryFile); ok && mf.WriteProtected(pseg.fileRangeOf(pmaMapAR)) {
+				// Some pages are still being saved, and writes to them must
+				// fault so that prepareWriteLocked can preserve them. Map
+				// only the required pages writable if possible, and
+				// otherwise map pmaMapAR read-only.
+				if reqAR := pmaAR.Intersect(ar); !mf.WriteProtected(pseg.fileRangeOf(reqAR)) {
+					pmaMapAR = reqAR
+				} else {
+					perms.Write = false
+				}
+			}
+		}
 		if perms.Any() { // MapFile precondition
 			if err := mm.as.MapFile(pmaMapAR.Start, pma.file, pseg.fileRangeOf(pmaMapAR), perms, precommit); err != nil {
 				return err
@@ -0,0 +1,39 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mm
+
+import (
+	"math"
+
+	"gvisor.dev/gvisor/pkg/context"
+)
+
+// contextID is this package's type for context.Context.Value keys.
+type contextID int
+
+const (
+	// CtxMaxMapCount is a Context.Value key for the maximum number of vmas
+	// that a MemoryManager may contain, as set by /proc/sys/vm/max_map_count.
+	CtxMaxMapCount contextID = iota
+)
+
+// maxMapCountFromContext returns the maximum number of vmas allowed by ctx. If
+// ctx doesn't provide one, the number of vmas is not limited.
+func maxMapCountFromContext(ctx context.Context) int {
+	if v := ctx.Value(CtxMaxMapCount); v != nil {
+		return int(v.(int32))
+	}
+	return math.MaxInt32
+}
@@ -0,0 +1,309 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mm
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
+)
+
+// Private anonymous memory is allocated in huge page-sized units where
+// possible (see privateAllocUnit), and such allocations are huge page-aligned
+// in the MemoryFile and placed in chunks that the host is asked to back with
+// huge pages (see pgalloc.AllocOpts.Huge). But a huge page-aligned range of
+// application memory can still end up mapped by several smaller pmas, e.g.
+// because it was faulted in at the edge of a vma that later grew, or because
+// copy-on-write was broken for only part of it. Collapsing such a range
+// replaces its pmas with a single pma of huge page-aligned memory, like
+// Linux's khugepaged. This is done synchronously by madvise(MADV_COLLAPSE)
+// (see Collapse), and in the background by CollapseHugepages.
+
+// HugepageCollapseMode controls which vmas CollapseHugepages collapses, like
+// Linux's /sys/kernel/mm/transparent_hugepage/enabled.
+type HugepageCollapseMode int
+
+const (
+	// HugepageCollapseNever disables background collapse.
+	HugepageCollapseNever HugepageCollapseMode = iota
+
+	// HugepageCollapseMadvise collapses vmas advised with MADV_HUGEPAGE.
+	HugepageCollapseMadvise
+
+	// HugepageCollapseAlways collapses all private anonymous vmas, except
+	// those advised with MADV_NOHUGEPAGE.
+	HugepageCollapseAlways
+)
+
+// minBackgroundCollapseResident is the minimum number of resident bytes in a
+// huge page-sized range for CollapseHugepages to collapse it, so that
+// background collapse at most doubles the RSS of sparsely used memory. This is
+// the equivalent of Linux's
+// /sys/kernel/mm/transparent_hugepage/khugepaged/max_ptes_none, but more
+// conservative than its default, since the sentry can't reclaim the zero
+// pages it introduces.
+const minBackgroundCollapseResident = hostarch.HugePageSize / 2
+
+// canCollapse returns true if the vma's memory may be collapsed into huge
+// pages.
+func (v *vma) canCollapse() bool {
+	// Linux can also collapse shmem and read-only file mappings, which would
+	// require support from memmap.Mappables.
+	return v.mappable == nil && v.hugepage != linux.MADV_NOHUGEPAGE
+}
+
+// isHuge returns true if pseg maps all of hr, a huge page-aligned range of
+// length hostarch.HugePageSize, to huge page-aligned memory, which is
+// therefore eligible to be backed by a single host huge page.
+func (pseg pmaIterator) isHuge(hr hostarch.AddrRange) bool {
+	return pseg.Range().IsSupersetOf(hr) && pseg.fileRangeOf(hr).Start%hostarch.HugePageSize == 0
+}
+
+// hugeBytes returns the number of bytes in ar for which pseg.isHuge is true
+// for the huge page-aligned range containing them.
+//
+// Preconditions: pseg.Range().IsSupersetOf(ar).
+func (pseg pmaIterator) hugeBytes(ar hostarch.AddrRange) uint64 {
+	start, ok := ar.Start.HugeRoundUp()
+	end := ar.End.HugeRoundDown()
+	if !ok || start >= end {
+		return 0
+	}
+	// Since pseg maps a contiguous range of memory, either all or none of the
+	// huge page-aligned ranges it maps are mapped to huge page-aligned memory.
+	if !pseg.isHuge(hostarch.AddrRange{start, start + hostarch.HugePageSize}) {
+		return 0
+	}
+	return uint64(end - start)
+}
+
+// SetHugepageAdvice implements the semantics of Linux's madvise(MADV_HUGEPAGE)
+// and madvise(MADV_NOHUGEPAGE), depending on advice.
+func (mm *MemoryManager) SetHugepageAdvice(ctx context.Context, addr hostarch.Addr, length uint64, advice int32) error {
+	ar, ok := addr.ToRange(length)
+	if !ok {
+		return linuxerr.EINVAL
+	}
+
+	mm.mappingMu.Lock()
+	defer mm.mappingMu.Unlock()
+	defer mm.mergeVMAsLocked(ar)
+
+	for vseg := mm.vmas.LowerBoundSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.End; vseg = vseg.NextSegment() {
+		var err error
+		if vseg, err = mm.isolateVMACheckedLocked(ctx, vseg, ar); err != nil {
+			return err
+		}
+		vma := vseg.ValuePtr()
+		vma.hugepage = advice
+	}
+
+	if mm.vmas.SpanRange(ar) != ar.Length() {
+		return linuxerr.ENOMEM
+	}
+	return nil
+}
+
+// Collapse implements the semantics of Linux's madvise(MADV_COLLAPSE).
+func (mm *MemoryManager) Collapse(ctx context.Context, addr hostarch.Addr, length uint64) error {
+	ar, ok := addr.ToRange(length)
+	if !ok {
+		return linuxerr.EINVAL
+	}
+
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+
+	var err error
+	for vseg := mm.vmas.LowerBoundSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.End; vseg = vseg.NextSegment() {
+		if !vseg.ValuePtr().canCollapse() {
+			return linuxerr.EINVAL
+		}
+		// "MADV_COLLAPSE will automatically clamp the provided range to be
+		// hugepage-aligned." - madvise(2)
+		vsegAR := vseg.Range().Intersect(ar)
+		for start := vsegAR.Start.MustHugeRoundUp(); start+hostarch.HugePageSize <= vsegAR.End; start += hostarch.HugePageSize {
+			hr := hostarch.AddrRange{start, start + hostarch.HugePageSize}
+			if pseg := mm.pmas.FindSegment(start); pseg.Ok() && pseg.isHuge(hr) {
+				continue
+			}
+			collapsed, cerr := mm.collapseLocked(ctx, vseg, hr, hostarch.PageSize)
+			if cerr != nil {
+				return cerr
+			}
+			if !collapsed {
+				// Like Linux, skip ranges without resident pages, but report
+				// that not all of ar could be collapsed.
+				err = linuxerr.EINVAL
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// As with other madvise() advice, unmapped parts of ar are ignored but
+	// reported as ENOMEM.
+	if mm.vmas.SpanRange(ar) != ar.Length() {
+		return linuxerr.ENOMEM
+	}
+	return nil
+}
+
+// CollapseHugepages implements background collapse for mm. It examines up to
+// budget huge page-sized ranges of the vmas that mode makes eligible,
+// resuming where the previous call left off, and collapses those in which at
+// least minBackgroundCollapseResident bytes are resident. It returns the
+// number of ranges collapsed.
+func (mm *MemoryManager) CollapseHugepages(ctx context.Context, mode HugepageCollapseMode, budget int) int {
+	if mode == HugepageCollapseNever || budget <= 0 {
+		return 0
+	}
+
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+
+	n := 0
+	for vseg := mm.vmas.LowerBoundSegment(mm.hugepageScanAddr); vseg.Ok(); vseg = vseg.NextSegment() {
+		vma := vseg.ValuePtr()
+		if !vma.canCollapse() || (mode == HugepageCollapseMadvise && vma.hugepage != linux.MADV_HUGEPAGE) {
+			continue
+		}
+		for start := max(vseg.Start(), mm.hugepageScanAddr).MustHugeRoundUp(); start+hostarch.HugePageSize <= vseg.End(); start += hostarch.HugePageSize {
+			if budget == 0 {
+				mm.hugepageScanAddr = start
+				return n
+			}
+			budget--
+			hr := hostarch.AddrRange{start, start + hostarch.HugePageSize}
+			if pseg := mm.pmas.FindSegment(start); pseg.Ok() && pseg.isHuge(hr) {
+				continue
+			}
+			collapsed, err := mm.collapseLocked(ctx, vseg, hr, minBackgroundCollapseResident)
+			if err != nil {
+				// Most likely out of memory; try again next time.
+				mm.hugepageScanAddr = start
+				return n
+			}
+			if collapsed {
+				n++
+			}
+		}
+	}
+	// Start over from the beginning of the address space next time.
+	mm.hugepageScanAddr = 0
+	return n
+}
+
+// collapseLocked replaces the pmas in hr with a single pma of huge
+// page-aligned memory with the same contents, unless fewer than minResident
+// bytes in hr are resident. It returns true if it did so.
+//
+// Preconditions:
+//   - mm.mappingMu must be locked.
+//   - mm.activeMu must be locked for writing.
+//   - hr is huge page-aligned, and hr.Length() == hostarch.HugePageSize.
+//   - vseg.Range().IsSupersetOf(hr).
+//   - vseg.ValuePtr().canCollapse() == true.
+func (mm *MemoryManager) collapseLocked(ctx context.Context, vseg vmaIterator, hr hostarch.AddrRange, minResident uint64) (bool, error) {
+	var resident uint64
+	for pseg := mm.pmas.LowerBoundSegment(hr.Start); pseg.Ok() && pseg.Start() < hr.End; pseg = pseg.NextSegment() {
+		resident += uint64(pseg.Range().Intersect(hr).Length())
+	}
+	if resident < minResident {
+		return false, nil
+	}
+
+	// Copy resident memory into a new huge page. Pages without pmas stay
+	// zero-filled, as they would be when first faulted in.
+	fr, err := mm.mf.Allocate(hostarch.HugePageSize, pgalloc.AllocOpts{
+		Kind:    usage.Anonymous,
+		Mode:    pgalloc.AllocateAndWritePopulate,
+		MemCgID: pgalloc.MemoryCgroupIDFromContext(ctx),
+		Huge:    true,
+	})
+	if err != nil {
+		return false, linuxerr.ENOMEM
+	}
+	if err := mm.copyToHugeLocked(hr, fr); err != nil {
+		mm.mf.DecRef(fr)
+		return false, err
+	}
+	mm.mf.CollapseHuge(fr)
+
+	// AddressSpace mappings must be removed before pma.file.DecRef().
+	mm.unmapASLocked(hr)
+	softDirty := resident < hostarch.HugePageSize
+	pseg := mm.pmas.LowerBoundSegment(hr.Start)
+	for pseg.Ok() && pseg.Start() < hr.End {
+		pseg = mm.pmas.Isolate(pseg, hr)
+		pma := pseg.ValuePtr()
+		softDirty = softDirty || pma.softDirty
+		pma.file.DecRef(pseg.fileRange())
+		mm.removeRSSLocked(pseg.Range())
+		pseg = mm.pmas.Remove(pseg).NextSegment()
+	}
+	vma := vseg.ValuePtr()
+	newpma := pma{
+		file:           mm.mf,
+		off:            fr.Start,
+		translatePerms: hostarch.AnyAccess,
+		maxPerms:       vma.maxPerms,
+		private:        true,
+		softDirty:      softDirty,
+	}
+	newpma.effectivePerms = newpma.trackedPerms(vma.effectivePerms)
+	mm.addRSSLocked(hr)
+	pseg = mm.pmas.Insert(mm.pmas.FindGap(hr.Start), hr, newpma)
+	if vma.mlockMode == memmap.MLockEager && mm.as != nil {
+		// Errors are ignored, since the pma will be mapped again when it is
+		// next faulted on.
+		mm.mapASLocked(pseg, hr, true /* precommit */)
+	}
+	return true, nil
+}
+
+// copyToHugeLocked copies the contents of the pmas in hr to the corresponding
+// offsets in fr.
+//
+// Preconditions:
+//   - mm.activeMu must be locked for writing.
+//   - fr.Length() == uint64(hr.Length()).
+func (mm *MemoryManager) copyToHugeLocked(hr hostarch.AddrRange, fr memmap.FileRange) error {
+	dsts, err := mm.mf.MapInternal(fr, hostarch.Write)
+	if err != nil {
+		return err
+	}
+	for pseg := mm.pmas.LowerBoundSegment(hr.Start); pseg.Ok() && pseg.Start() < hr.End; pseg = pseg.NextSegment() {
+		if err := pseg.getInternalMappingsLocked(); err != nil {
+			return err
+		}
+		psegAR := pseg.Range().Intersect(hr)
+		dst := dsts.DropFirst64(uint64(psegAR.Start - hr.Start)).TakeFirst64(uint64(psegAR.Length()))
+		if _, err := safemem.CopySeq(dst, mm.internalMappingsLocked(pseg, psegAR)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -499,6 +499,10 @@ func (mm *MemoryManager) handleASIOFault(ctx context.Context, addr hostarch.Addr
 	// anymore.
 	mm.activeMu.DowngradeLock()
 
+	if at.Write {
+		mm.prepareWriteLocked(pseg, ar)
+	}
+
 	err = mm.mapASLocked(pseg, ar, false)
 	mm.activeMu.RUnlock()
 	return translateIOError(ctx, err)
@@ -519,6 +523,9 @@ func (mm *MemoryManager) withInternalMappings(ctx context.Context, ar hostarch.A
 	// mm.mappingMu.
 	mm.activeMu.RLock()
 	if pseg := mm.existingPMAsLocked(ar, at, ignorePermissions, true /* needInternalMappings */); pseg.Ok() {
+		if at.Write {
+			mm.prepareWriteLocked(pseg, ar)
+		}
 		n, err := f(mm.internalMappingsLocked(pseg, ar))
 		mm.activeMu.RUnlock()
 		// Do not convert errors returned by f to EFAULT.
@@ -559,6 +566,9 @@ func (mm *MemoryManager) withInternalMappings(ctx context.Context, ar hostarch.A
 	}
 
 	// Do I/O.
+	if at.Write {
+		mm.prepareWriteLocked(pseg, ar)
+	}
 	un, err := f(mm.internalMappingsLocked(pseg, ar))
 	mm.activeMu.RUnlock()
 	n := int64(un)
@@ -595,6 +605,9 @@ func (mm *MemoryManager) withVecInternalMappings(ctx context.Context, ars hostar
 	// mm.mappingMu.
 	mm.activeMu.RLock()
 	if mm.existingVecPMAsLocked(ars, at, ignorePermissions, true /* needInternalMappings */) {
+		if at.Write {
+			mm.vecPrepareWriteLocked(ars)
+		}
 		n, err := f(mm.vecInternalMappingsLocked(ars))
 		mm.activeMu.RUnlock()
 		// Do not convert errors returned by f to EFAULT.
@@ -626,6 +639,9 @@ func (mm *MemoryManager) withVecInternalMappings(ctx context.Context, ars hostar
 	}
 
 	// Do I/O.
+	if at.Write {
+		mm.vecPrepareWriteLocked(imars)
+	}
 	un, err := f(mm.vecInternalMappingsLocked(imars))
 	mm.activeMu.RUnlock()
 	n := int64(un)
@@ -21,6 +21,7 @@ import (
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/guestrand"
 	"gvisor.dev/gvisor/pkg/sentry/limits"
 	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
@@ -42,11 +43,14 @@ func NewMemoryManager(p platform.Platform, mfp pgalloc.MemoryFileProvider, sleep
 	}
 }
 
-// SetMmapLayout initializes mm's layout from the given arch.Context64.
+// SetMmapLayout initializes mm's layout from the given arch.Context64, for a
+// task with the given personality(2). The layout is randomized using the
+// application's randomness from ctx.
 //
 // Preconditions: mm contains no mappings and is not used concurrently.
-func (mm *MemoryManager) SetMmapLayout(ac *arch.Context64, r *limits.LimitSet) (arch.MmapLayout, error) {
-	layout, err := ac.NewMmapLayout(mm.p.MinUserAddress(), mm.p.MaxUserAddress(), r)
+func (mm *MemoryManager) SetMmapLayout(ctx context.Context, ac *arch.Context64, r *limits.LimitSet, personality uint32) (arch.MmapLayout, error) {
+	rng := guestrand.RNG(ctx)
+	layout, err := ac.NewMmapLayout(mm.p.MinUserAddress(), mm.p.MaxUserAddress(), r, personality, &rng)
 	if err != nil {
 		return arch.MmapLayout{}, err
 	}
@@ -126,7 +130,7 @@ func (mm *MemoryManager) Fork(ctx context.Context) (*MemoryManager, error) {
 			vma.id.IncRef()
 		}
 		vma.mlockMode = memmap.MLockNone
-		dstvgap = mm2.vmas.Insert(dstvgap, vmaAR, vma).NextGap()
+		dstvgap = mm2.insertVMALocked(dstvgap, vmaAR, vma).NextGap()
 		// We don't need to update mm2.usageAS since we copied it from mm
 		// above.
 	}
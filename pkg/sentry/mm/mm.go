@@ -94,6 +94,11 @@ type MemoryManager struct {
 	// vmas is protected by mappingMu.
 	vmas vmaSet
 
+	// vmaCount is the number of vmas in vmas, like mm_struct::map_count.
+	//
+	// vmaCount is protected by mappingMu.
+	vmaCount int
+
 	// brk is the mm's brk, which is manipulated using the brk(2) system call.
 	// The brk is initially set up by the loader which maps an executable
 	// binary into the mm.
@@ -159,6 +164,12 @@ type MemoryManager struct {
 	// maxRSS is protected by activeMu.
 	maxRSS uint64
 
+	// hugepageScanAddr is the address at which the next call to
+	// CollapseHugepages resumes scanning.
+	//
+	// hugepageScanAddr is protected by activeMu.
+	hugepageScanAddr hostarch.Addr
+
 	// as is the platform.AddressSpace that pmas are mapped into. active is the
 	// number of contexts that require as to be non-nil; if active == 0, as may
 	// be nil.
@@ -298,6 +309,11 @@ type vma struct {
 	// dontfork is the MADV_DONTFORK setting for this vma configured by madvise().
 	dontfork bool
 
+	// hugepage is the transparent huge page setting for this vma configured
+	// by madvise(): linux.MADV_HUGEPAGE, linux.MADV_NOHUGEPAGE, or 0 if
+	// neither has been set.
+	hugepage int32
+
 	mlockMode memmap.MLockMode
 
 	// numaPolicy is the NUMA policy for this vma set by mbind().
@@ -332,6 +348,7 @@ func (v *vma) copy() vma {
 		private:        v.private,
 		growsDown:      v.growsDown,
 		dontfork:       v.dontfork,
+		hugepage:       v.hugepage,
 		mlockMode:      v.mlockMode,
 		numaPolicy:     v.numaPolicy,
 		numaNodemask:   v.numaNodemask,
@@ -361,7 +378,9 @@ type pma struct {
 	// accesses. maxPerms is the permissions allowed for ignorePermissions
 	// accesses. These are vma.effectivePerms and vma.maxPerms respectively,
 	// masked by pma.translatePerms and with Write disallowed if pma.needCOW is
-	// true.
+	// true. In addition, effectivePerms disallows Write if pma.softDirty is
+	// false, and disallows all accesses if pma.idle is true; see
+	// pma.trackedPerms.
 	//
 	// These are stored in the pma so that the IO implementation can avoid
 	// iterating mm.vmas when pmas already exist.
@@ -381,6 +400,16 @@ type pma struct {
 	// corresponding vma's memmap.Mappable.Translate.
 	private bool
 
+	// softDirty is true if the pma may have been written to since soft-dirty
+	// bits were last cleared by writing 4 to /proc/[pid]/clear_refs. New pmas
+	// are soft-dirty.
+	softDirty bool
+
+	// idle is true if the pma has not been accessed since it was marked idle,
+	// either through /proc/[pid]/clear_refs or through
+	// /sys/kernel/mm/page_idle/bitmap.
+	idle bool
+
 	// If internalMappings is not empty, it is the cached return value of
 	// file.MapInternal for the memmap.FileRange mapped by this pma.
 	internalMappings safemem.BlockSeq `state:"nosave"`
@@ -17,6 +17,7 @@ package mm
 import (
 	"testing"
 
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
@@ -109,7 +110,7 @@ func TestDataASUpdates(t *testing.T) {
 		t.Fatalf("dataAS believes %v bytes are mapped; %v bytes are actually mapped", mm.dataAS, realDataAS)
 	}
 
-	mm.MProtect(addr+hostarch.PageSize, hostarch.PageSize, hostarch.Read, false)
+	mm.MProtect(ctx, addr+hostarch.PageSize, hostarch.PageSize, hostarch.Read, false /* growsDown */, false /* readImpliesExec */)
 	realDataAS = mm.realDataAS()
 	if mm.dataAS != realDataAS {
 		t.Fatalf("dataAS believes %v bytes are mapped; %v bytes are actually mapped", mm.dataAS, realDataAS)
@@ -139,6 +140,109 @@ func TestBrkDataLimitUpdates(t *testing.T) {
 	}
 }
 
+func TestMaxMapCount(t *testing.T) {
+	ctx := contexttest.Context(t)
+	ctx.(*contexttest.TestContext).RegisterValue(CtxMaxMapCount, int32(2))
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   5 * hostarch.PageSize,
+		Private:  true,
+		Perms:    hostarch.ReadWrite,
+		MaxPerms: hostarch.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+
+	// Splitting the only vma reaches the limit.
+	if err := mm.MUnmap(ctx, addr+hostarch.PageSize, hostarch.PageSize); err != nil {
+		t.Fatalf("MUnmap got err %v want nil", err)
+	}
+	// Splitting another vma would exceed it.
+	if err := mm.MUnmap(ctx, addr+3*hostarch.PageSize, hostarch.PageSize); !linuxerr.Equals(linuxerr.ENOMEM, err) {
+		t.Fatalf("MUnmap got err %v want ENOMEM", err)
+	}
+	// Unmapping a whole vma doesn't split anything.
+	if err := mm.MUnmap(ctx, addr, hostarch.PageSize); err != nil {
+		t.Fatalf("MUnmap got err %v want nil", err)
+	}
+
+	// Like Linux, mmap fails only once the limit has been exceeded.
+	opts := memmap.MMapOpts{
+		Length:   hostarch.PageSize,
+		Private:  true,
+		Perms:    hostarch.Read,
+		MaxPerms: hostarch.AnyAccess,
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := mm.MMap(ctx, opts); err != nil {
+			t.Fatalf("MMap #%d got err %v want nil", i, err)
+		}
+		opts.Perms = hostarch.Write
+	}
+	if got := mm.vmaCount; got != 3 {
+		t.Fatalf("got %d vmas, want 3", got)
+	}
+	if _, err := mm.MMap(ctx, opts); !linuxerr.Equals(linuxerr.ENOMEM, err) {
+		t.Fatalf("MMap got err %v want ENOMEM", err)
+	}
+}
+
+func TestMaxMapCountSplit(t *testing.T) {
+	ctx := contexttest.Context(t)
+	ctx.(*contexttest.TestContext).RegisterValue(CtxMaxMapCount, int32(2))
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   4 * hostarch.PageSize,
+		Private:  true,
+		Perms:    hostarch.ReadWrite,
+		MaxPerms: hostarch.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+
+	// Splitting the vma in three would exceed the limit.
+	if err := mm.MProtect(ctx, addr+hostarch.PageSize, hostarch.PageSize, hostarch.Read, false /* growsDown */, false /* readImpliesExec */); !linuxerr.Equals(linuxerr.ENOMEM, err) {
+		t.Fatalf("MProtect got err %v want ENOMEM", err)
+	}
+	if err := mm.SetNumaPolicy(ctx, addr+hostarch.PageSize, hostarch.PageSize, linux.MPOL_BIND, 1); !linuxerr.Equals(linuxerr.ENOMEM, err) {
+		t.Fatalf("SetNumaPolicy got err %v want ENOMEM", err)
+	}
+	if err := mm.SetDontFork(ctx, addr+hostarch.PageSize, hostarch.PageSize, true); !linuxerr.Equals(linuxerr.ENOMEM, err) {
+		t.Fatalf("SetDontFork got err %v want ENOMEM", err)
+	}
+	if got := mm.vmaCount; got != 1 {
+		t.Fatalf("got %d vmas, want 1", got)
+	}
+
+	// Splitting it in two reaches the limit.
+	if err := mm.MProtect(ctx, addr, hostarch.PageSize, hostarch.Read, false /* growsDown */, false /* readImpliesExec */); err != nil {
+		t.Fatalf("MProtect got err %v want nil", err)
+	}
+	if got := mm.vmaCount; got != 2 {
+		t.Fatalf("got %d vmas, want 2", got)
+	}
+	// Splitting off another page would exceed it.
+	if err := mm.MProtect(ctx, addr+3*hostarch.PageSize, hostarch.PageSize, hostarch.Read, false /* growsDown */, false /* readImpliesExec */); !linuxerr.Equals(linuxerr.ENOMEM, err) {
+		t.Fatalf("MProtect got err %v want ENOMEM", err)
+	}
+	// Merging the vmas back together makes room again.
+	if err := mm.MProtect(ctx, addr, hostarch.PageSize, hostarch.ReadWrite, false /* growsDown */, false /* readImpliesExec */); err != nil {
+		t.Fatalf("MProtect got err %v want nil", err)
+	}
+	if got := mm.vmaCount; got != 1 {
+		t.Fatalf("got %d vmas, want 1", got)
+	}
+	if err := mm.MProtect(ctx, addr+3*hostarch.PageSize, hostarch.PageSize, hostarch.Read, false /* growsDown */, false /* readImpliesExec */); err != nil {
+		t.Fatalf("MProtect got err %v want nil", err)
+	}
+}
+
 // TestIOAfterUnmap ensures that IO fails after unmap.
 func TestIOAfterUnmap(t *testing.T) {
 	ctx := contexttest.Context(t)
@@ -205,7 +309,7 @@ func TestIOAfterMProtect(t *testing.T) {
 		t.Errorf("CopyOut got %d want 1", n)
 	}
 
-	err = mm.MProtect(addr, hostarch.PageSize, hostarch.Read, false)
+	err = mm.MProtect(ctx, addr, hostarch.PageSize, hostarch.Read, false /* growsDown */, false /* readImpliesExec */)
 	if err != nil {
 		t.Errorf("MProtect got err %v want nil", err)
 	}
@@ -233,6 +337,47 @@ func TestIOAfterMProtect(t *testing.T) {
 
 // TestAIOPrepareAfterDestroy tests that AIOContext should not be able to be
 // prepared after destruction.
+func TestMProtectReadImpliesExec(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	// Map two adjacent pages, only the first of which may be executable.
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   2 * hostarch.PageSize,
+		Private:  true,
+		MaxPerms: hostarch.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	if _, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   hostarch.PageSize,
+		Addr:     addr + hostarch.PageSize,
+		Fixed:    true,
+		Unmap:    true,
+		Private:  true,
+		MaxPerms: hostarch.ReadWrite,
+	}); err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+
+	if err := mm.MProtect(ctx, addr, 2*hostarch.PageSize, hostarch.Read, false /* growsDown */, true /* readImpliesExec */); err != nil {
+		t.Fatalf("MProtect got err %v want nil", err)
+	}
+	for _, tc := range []struct {
+		addr hostarch.Addr
+		want hostarch.AccessType
+	}{
+		{addr, hostarch.ReadExecute},
+		{addr + hostarch.PageSize, hostarch.Read},
+	} {
+		if got := mm.vmas.FindSegment(tc.addr).ValuePtr().realPerms; got != tc.want {
+			t.Errorf("vma at %#x has permissions %s, want %s", tc.addr, got, tc.want)
+		}
+	}
+}
+
 func TestAIOPrepareAfterDestroy(t *testing.T) {
 	ctx := contexttest.Context(t)
 	mm := testMemoryManager(ctx)
@@ -273,3 +418,74 @@ func TestAIOLookupAfterDestroy(t *testing.T) {
 		t.Errorf("AIOContext found even after AIOContext manager is destroyed")
 	}
 }
+
+// isHugeRange returns true if hr is mapped by a single pma of huge
+// page-aligned memory.
+func (mm *MemoryManager) isHugeRange(hr hostarch.AddrRange) bool {
+	mm.activeMu.RLock()
+	defer mm.activeMu.RUnlock()
+	pseg := mm.pmas.FindSegment(hr.Start)
+	return pseg.Ok() && pseg.isHuge(hr)
+}
+
+// TestCollapse tests madvise(MADV_COLLAPSE) of fragmented memory.
+func TestCollapse(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   2 * hostarch.HugePageSize,
+		Private:  true,
+		Perms:    hostarch.ReadWrite,
+		MaxPerms: hostarch.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	if !addr.IsHugePageAligned() {
+		t.Fatalf("MMap got unaligned address %#x", addr)
+	}
+	hr := hostarch.AddrRange{addr, addr + hostarch.HugePageSize}
+
+	// Fault in the first huge page, then replace its second page with a
+	// separate allocation.
+	if _, err := mm.CopyOut(ctx, addr, []byte{1}, usermem.IOOpts{}); err != nil {
+		t.Fatalf("CopyOut got err %v want nil", err)
+	}
+	if err := mm.Decommit(addr+hostarch.PageSize, hostarch.PageSize); err != nil {
+		t.Fatalf("Decommit got err %v want nil", err)
+	}
+	if _, err := mm.CopyOut(ctx, addr+hostarch.PageSize, []byte{2}, usermem.IOOpts{}); err != nil {
+		t.Fatalf("CopyOut got err %v want nil", err)
+	}
+	if mm.isHugeRange(hr) {
+		t.Fatalf("%v is huge before collapse", hr)
+	}
+
+	// The second huge page has no resident pages, so it can't be collapsed.
+	if err := mm.Collapse(ctx, addr, 2*hostarch.HugePageSize); !linuxerr.Equals(linuxerr.EINVAL, err) {
+		t.Errorf("Collapse got err %v want EINVAL", err)
+	}
+	if !mm.isHugeRange(hr) {
+		t.Errorf("%v is not huge after collapse", hr)
+	}
+	b := make([]byte, 2)
+	if _, err := mm.CopyIn(ctx, addr, b[:1], usermem.IOOpts{}); err != nil {
+		t.Fatalf("CopyIn got err %v want nil", err)
+	}
+	if _, err := mm.CopyIn(ctx, addr+hostarch.PageSize, b[1:], usermem.IOOpts{}); err != nil {
+		t.Fatalf("CopyIn got err %v want nil", err)
+	}
+	if b[0] != 1 || b[1] != 2 {
+		t.Errorf("CopyIn after collapse got %v want [1 2]", b)
+	}
+
+	// Memory advised with MADV_NOHUGEPAGE can't be collapsed.
+	if err := mm.SetHugepageAdvice(ctx, addr, hostarch.HugePageSize, linux.MADV_NOHUGEPAGE); err != nil {
+		t.Fatalf("SetHugepageAdvice got err %v want nil", err)
+	}
+	if err := mm.Collapse(ctx, addr, hostarch.HugePageSize); !linuxerr.Equals(linuxerr.EINVAL, err) {
+		t.Errorf("Collapse got err %v want EINVAL", err)
+	}
+}
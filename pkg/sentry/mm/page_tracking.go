@@ -0,0 +1,249 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mm
+
+import (
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+)
+
+// Soft-dirty and idle page tracking work like copy-on-write: when pages are
+// marked clean or idle, the permissions of their pmas are narrowed (see
+// pma.trackedPerms) and their AddressSpace mappings are removed, so that the
+// next access of the corresponding kind faults, is recorded in the pma by
+// getPMAsLocked, and restores the pma's permissions.
+
+// ClearRefsType is a command written to /proc/[pid]/clear_refs, from Linux's
+// fs/proc/task_mmu.c:enum clear_refs_types.
+type ClearRefsType int
+
+// Possible values for ClearRefsType.
+const (
+	// ClearRefsAll marks all pages idle.
+	ClearRefsAll ClearRefsType = 1 + iota
+
+	// ClearRefsAnon marks anonymous pages idle.
+	ClearRefsAnon
+
+	// ClearRefsMapped marks file-backed pages idle.
+	ClearRefsMapped
+
+	// ClearRefsSoftDirty clears the soft-dirty bit of all pages.
+	ClearRefsSoftDirty
+
+	// ClearRefsMMHiwaterRSS resets the peak resident set size to the current
+	// resident set size.
+	ClearRefsMMHiwaterRSS
+)
+
+// Bits in /proc/[pid]/pagemap entries, from Linux's fs/proc/task_mmu.c and
+// Documentation/admin-guide/mm/pagemap.rst.
+const (
+	pagemapPFNMask   = 1<<55 - 1
+	pagemapSoftDirty = 1 << 55
+	pagemapExclusive = 1 << 56
+	pagemapFile      = 1 << 61
+	pagemapPresent   = 1 << 63
+)
+
+// trackedPerms returns perms, the permissions otherwise allowed for
+// non-ignorePermissions accesses to the pma, without the accesses that must
+// fault to be recorded for soft-dirty or idle page tracking.
+func (p *pma) trackedPerms(perms hostarch.AccessType) hostarch.AccessType {
+	if p.idle {
+		return hostarch.NoAccess
+	}
+	if p.needCOW || !p.softDirty {
+		perms.Write = false
+	}
+	return perms
+}
+
+// tracksAccess returns true if an access of type at to the pma must be
+// recorded for soft-dirty or idle page tracking.
+func (p *pma) tracksAccess(at hostarch.AccessType) bool {
+	return (p.idle && at.Any()) || (at.Write && !p.softDirty)
+}
+
+// ClearRefs implements writes of typ to /proc/[pid]/clear_refs.
+func (mm *MemoryManager) ClearRefs(typ ClearRefsType) error {
+	switch typ {
+	case ClearRefsAll, ClearRefsAnon, ClearRefsMapped, ClearRefsSoftDirty, ClearRefsMMHiwaterRSS:
+	default:
+		return linuxerr.EINVAL
+	}
+
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+
+	if typ == ClearRefsMMHiwaterRSS {
+		mm.maxRSS = mm.curRSS
+		return nil
+	}
+	for pseg := mm.pmas.FirstSegment(); pseg.Ok(); pseg = pseg.NextSegment() {
+		pma := pseg.ValuePtr()
+		switch typ {
+		case ClearRefsSoftDirty:
+			pma.softDirty = false
+		case ClearRefsAnon:
+			if !pma.private {
+				continue
+			}
+			pma.idle = true
+		case ClearRefsMapped:
+			if pma.private {
+				continue
+			}
+			pma.idle = true
+		default:
+			pma.idle = true
+		}
+		pma.effectivePerms = pma.trackedPerms(pma.effectivePerms)
+	}
+	ar := mm.applicationAddrRange()
+	mm.pmas.MergeInsideRange(ar)
+	mm.unmapASLocked(ar)
+	return nil
+}
+
+// ReadPagemap fills entries with the /proc/[pid]/pagemap entries for the
+// pages starting at start, and returns the number of entries filled, which is
+// less than len(entries) if the end of the application address space is
+// reached. Page frame numbers are only reported if showPFN is true, and only
+// for pages of the MemoryFile, for which they are the page's offset in the
+// MemoryFile in pages.
+//
+// Preconditions: start is page-aligned.
+func (mm *MemoryManager) ReadPagemap(start hostarch.Addr, entries []uint64, showPFN bool) int {
+	maxAddr := mm.layout.MaxAddr
+	if start >= maxAddr {
+		return 0
+	}
+	if n := uint64(maxAddr-start) / hostarch.PageSize; n < uint64(len(entries)) {
+		entries = entries[:n]
+	}
+	for i := range entries {
+		entries[i] = 0
+	}
+	ar := hostarch.AddrRange{start, start + hostarch.Addr(len(entries))*hostarch.PageSize}
+
+	mm.activeMu.RLock()
+	defer mm.activeMu.RUnlock()
+	for pseg := mm.pmas.LowerBoundSegment(ar.Start); pseg.Ok() && pseg.Start() < ar.End; pseg = pseg.NextSegment() {
+		pma := pseg.ValuePtr()
+		flags := uint64(pagemapPresent)
+		if pma.softDirty {
+			flags |= pagemapSoftDirty
+		}
+		if !pma.private {
+			flags |= pagemapFile
+		} else if !pma.needCOW {
+			flags |= pagemapExclusive
+		}
+		pfn := showPFN && pma.file == memmap.File(mm.mf)
+		psegAR := pseg.Range().Intersect(ar)
+		for addr := psegAR.Start; addr < psegAR.End; addr += hostarch.PageSize {
+			entry := flags
+			if pfn {
+				entry |= (pma.off + uint64(addr-pseg.Start())) / hostarch.PageSize & pagemapPFNMask
+			}
+			entries[(addr-ar.Start)/hostarch.PageSize] = entry
+		}
+	}
+	return len(entries)
+}
+
+// MarkIdle implements writes to /sys/kernel/mm/page_idle/bitmap: it marks
+// the pages of the MemoryFile in frs that are mapped by mm as idle.
+//
+// Preconditions: frs are page-aligned, sorted and non-overlapping.
+func (mm *MemoryManager) MarkIdle(frs []memmap.FileRange) {
+	if len(frs) == 0 {
+		return
+	}
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+
+	marked := false
+	for pseg := mm.pmas.FirstSegment(); pseg.Ok(); pseg = pseg.NextSegment() {
+		pma := pseg.ValuePtr()
+		if pma.idle || pma.file != memmap.File(mm.mf) {
+			continue
+		}
+		pfr := pseg.fileRange()
+		// Find the first range that ends after the start of the pma.
+		i := sort.Search(len(frs), func(i int) bool { return frs[i].End > pfr.Start })
+		if i == len(frs) || !frs[i].Overlaps(pfr) {
+			continue
+		}
+		isect := pfr.Intersect(frs[i])
+		ar := hostarch.AddrRange{
+			pseg.Start() + hostarch.Addr(isect.Start-pfr.Start),
+			pseg.Start() + hostarch.Addr(isect.End-pfr.Start),
+		}
+		// Isolate leaves the rest of the pma, which may overlap the next
+		// range, as the next segment.
+		pseg = mm.pmas.Isolate(pseg, ar)
+		pma = pseg.ValuePtr()
+		pma.idle = true
+		pma.effectivePerms = hostarch.NoAccess
+		mm.unmapASLocked(ar)
+		marked = true
+	}
+	if marked {
+		// Isolate splits pmas, and adjacent pages marked idle by different
+		// ranges or in different calls can share a pma again.
+		mm.pmas.MergeInsideRange(mm.applicationAddrRange())
+	}
+}
+
+// ReadIdle implements reads of /sys/kernel/mm/page_idle/bitmap. For each page
+// of the MemoryFile in fr that is mapped by mm, it sets the page's bit in
+// mapped and, if mm has accessed the page since it was marked idle, in
+// accessed. Bit i of the bitmaps, counting from the least significant bit of
+// the first word, corresponds to the ith page of fr.
+//
+// Preconditions: fr is page-aligned. mapped and accessed have at least one
+// bit per page of fr.
+func (mm *MemoryManager) ReadIdle(fr memmap.FileRange, mapped, accessed []uint64) {
+	mm.activeMu.RLock()
+	defer mm.activeMu.RUnlock()
+
+	for pseg := mm.pmas.FirstSegment(); pseg.Ok(); pseg = pseg.NextSegment() {
+		pma := pseg.ValuePtr()
+		if pma.file != memmap.File(mm.mf) {
+			continue
+		}
+		pfr := pseg.fileRange()
+		if !pfr.Overlaps(fr) {
+			continue
+		}
+		isect := pfr.Intersect(fr)
+		for off := isect.Start; off < isect.End; off += hostarch.PageSize {
+			i := (off - fr.Start) / hostarch.PageSize
+			mapped[i/64] |= 1 << (i % 64)
+			if !pma.idle {
+				accessed[i/64] |= 1 << (i % 64)
+			}
+		}
+	}
+}
@@ -206,7 +206,7 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 	}
 
 	memCgID := pgalloc.MemoryCgroupIDFromContext(ctx)
-	opts := pgalloc.AllocOpts{Kind: usage.Anonymous, Dir: pgalloc.BottomUp, MemCgID: memCgID}
+	opts := pgalloc.AllocOpts{Kind: usage.Anonymous, Dir: pgalloc.BottomUp, MemCgID: memCgID, Huge: true}
 	vma := vseg.ValuePtr()
 	if uintptr(ar.Start) < atomic.LoadUintptr(&vma.lastFault) {
 		// Detect cases where memory is accessed downwards and change memory file
@@ -259,7 +259,8 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 						// Since we just allocated this memory and have the
 						// only reference, the new pma does not need
 						// copy-on-write.
-						private: true,
+						private:   true,
+						softDirty: true,
 					}).NextNonEmpty()
 					pstart = pmaIterator{} // iterators invalidated
 				} else {
@@ -298,6 +299,7 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 							translatePerms: t.Perms,
 							effectivePerms: vma.effectivePerms.Intersect(t.Perms),
 							maxPerms:       vma.maxPerms.Intersect(t.Perms),
+							softDirty:      true,
 						}
 						if vma.private {
 							newpma.effectivePerms.Write = false
@@ -375,6 +377,7 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 						Kind:    usage.Anonymous,
 						Mode:    pgalloc.AllocateAndWritePopulate,
 						MemCgID: memCgID,
+						Huge:    true,
 						Reader:  &safemem.BlockSeqReader{mm.internalMappingsLocked(pseg, copyAR)},
 					})
 					if _, ok := err.(safecopy.BusError); ok {
@@ -410,6 +413,8 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 					oldpma.maxPerms = vma.maxPerms
 					oldpma.needCOW = false
 					oldpma.private = true
+					oldpma.softDirty = true
+					oldpma.idle = false
 					oldpma.internalMappings = safemem.BlockSeq{}
 					// Try to merge the pma with its neighbors.
 					if prev := pseg.PrevSegment(); prev.Ok() {
@@ -476,6 +481,7 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 							translatePerms: t.Perms,
 							effectivePerms: vma.effectivePerms.Intersect(t.Perms),
 							maxPerms:       vma.maxPerms.Intersect(t.Perms),
+							softDirty:      true,
 						}
 						if vma.private {
 							newpma.effectivePerms.Write = false
@@ -498,6 +504,35 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 					} else {
 						pseg = pmaIterator{}
 					}
+				} else if oldpma.tracksAccess(at) {
+					// Record the access for soft-dirty or idle page
+					// tracking, and restore the permissions that were
+					// withdrawn to detect it. Only the pages being accessed
+					// are affected.
+					if !ar.IsSupersetOf(pseg.Range()) {
+						pseg = mm.pmas.Isolate(pseg, ar)
+						pstart = pmaIterator{} // iterators invalidated
+					}
+					oldpma = pseg.ValuePtr()
+					oldpma.idle = false
+					if at.Write {
+						oldpma.softDirty = true
+					}
+					oldpma.effectivePerms = oldpma.trackedPerms(vma.effectivePerms.Intersect(oldpma.translatePerms))
+					// Try to merge the pma with its neighbors.
+					if prev := pseg.PrevSegment(); prev.Ok() {
+						if merged := mm.pmas.Merge(prev, pseg); merged.Ok() {
+							pseg = merged
+							pstart = pmaIterator{} // iterators invalidated
+						}
+					}
+					if next := pseg.NextSegment(); next.Ok() {
+						if merged := mm.pmas.Merge(pseg, next); merged.Ok() {
+							pseg = merged
+							pstart = pmaIterator{} // iterators invalidated
+						}
+					}
+					pseg, pgap = pseg.NextNonEmpty()
 				} else {
 					// We have a usable pma; continue.
 					pseg, pgap = pseg.NextNonEmpty()
@@ -570,7 +605,7 @@ func (mm *MemoryManager) isPMACopyOnWriteLocked(vseg vmaIterator, pseg pmaIterat
 		pma.needCOW = false
 		// pma.private => pma.translatePerms == hostarch.AnyAccess
 		vma := vseg.ValuePtr()
-		pma.effectivePerms = vma.effectivePerms
+		pma.effectivePerms = pma.trackedPerms(vma.effectivePerms)
 		pma.maxPerms = vma.maxPerms
 		return false
 	}
@@ -918,6 +953,37 @@ func (mm *MemoryManager) vecInternalMappingsLocked(ars hostarch.AddrRangeSeq) sa
 	return safemem.BlockSeqFromSlice(ims)
 }
 
+// prepareWriteLocked must be called before writing to addresses in ar through
+// internal mappings or AddressSpace mappings. See
+// pgalloc.MemoryFile.PrepareWrite.
+//
+// Preconditions:
+//   - mm.activeMu must be locked.
+//   - pmas must exist for all addresses in ar.
+//   - ar.Length() != 0.
+//   - pseg.Range().Contains(ar.Start).
+func (mm *MemoryManager) prepareWriteLocked(pseg pmaIterator, ar hostarch.AddrRange) {
+	for ; pseg.Ok() && pseg.Start() < ar.End; pseg = pseg.NextSegment() {
+		if mf, ok := pseg.ValuePtr().file.(*pgalloc.MemoryFile); ok {
+			mf.PrepareWrite(pseg.fileRangeOf(pseg.Range().Intersect(ar)))
+		}
+	}
+}
+
+// vecPrepareWriteLocked is equivalent to prepareWriteLocked for addresses in
+// ars.
+//
+// Preconditions:
+//   - mm.activeMu must be locked.
+//   - pmas must exist for all addresses in ars.
+func (mm *MemoryManager) vecPrepareWriteLocked(ars hostarch.AddrRangeSeq) {
+	for ; !ars.IsEmpty(); ars = ars.Tail() {
+		if ar := ars.Head(); ar.Length() != 0 {
+			mm.prepareWriteLocked(mm.pmas.FindSegment(ar.Start), ar)
+		}
+	}
+}
+
 // addRSSLocked updates the current and maximum resident set size of a
 // MemoryManager to reflect the insertion of a pma at ar.
 //
@@ -960,7 +1026,9 @@ func (pmaSetFunctions) Merge(ar1 hostarch.AddrRange, pma1 pma, ar2 hostarch.Addr
 		pma1.effectivePerms != pma2.effectivePerms ||
 		pma1.maxPerms != pma2.maxPerms ||
 		pma1.needCOW != pma2.needCOW ||
-		pma1.private != pma2.private {
+		pma1.private != pma2.private ||
+		pma1.softDirty != pma2.softDirty ||
+		pma1.idle != pma2.idle {
 		return pma{}, false
 	}
 
@@ -1020,7 +1088,16 @@ func (pseg pmaIterator) getInternalMappingsLocked() error {
 		perms := pma.maxPerms
 		// We will never execute application code through an internal mapping.
 		perms.Execute = false
-		ims, err := pma.file.MapInternal(pseg.fileRange(), perms)
+		var ims safemem.BlockSeq
+		var err error
+		if mf, ok := pma.file.(*pgalloc.MemoryFile); ok {
+			// Writes through internal mappings are preceded by
+			// prepareWriteLocked, so mappings that are only read need not
+			// be prepared for writing.
+			ims, err = mf.MapInternalUntracked(pseg.fileRange(), perms)
+		} else {
+			ims, err = pma.file.MapInternal(pseg.fileRange(), perms)
+		}
 		if err != nil {
 			return err
 		}
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"fmt"
 
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/log"
@@ -184,6 +185,8 @@ func (mm *MemoryManager) vmaSmapsEntryIntoLocked(ctx context.Context, vseg vmaIt
 	mm.activeMu.RLock()
 	var rss uint64
 	var anon uint64
+	var referenced uint64
+	var anonHuge uint64
 	vsegAR := vseg.Range()
 	for pseg := mm.pmas.LowerBoundSegment(vsegAR.Start); pseg.Ok() && pseg.Start() < vsegAR.End; pseg = pseg.NextSegment() {
 		psegAR := pseg.Range().Intersect(vsegAR)
@@ -191,6 +194,10 @@ func (mm *MemoryManager) vmaSmapsEntryIntoLocked(ctx context.Context, vseg vmaIt
 		rss += size
 		if pseg.ValuePtr().private {
 			anon += size
+			anonHuge += pseg.hugeBytes(psegAR)
+		}
+		if !pseg.ValuePtr().idle {
+			referenced += size
 		}
 	}
 	mm.activeMu.RUnlock()
@@ -212,11 +219,13 @@ func (mm *MemoryManager) vmaSmapsEntryIntoLocked(ctx context.Context, vseg vmaIt
 	}
 	fmt.Fprintf(b, "Private_Clean:  %8d kB\n", clean/1024)
 	fmt.Fprintf(b, "Private_Dirty:  %8d kB\n", (rss-clean)/1024)
-	// Pretend that all pages are "referenced" (recently touched).
-	fmt.Fprintf(b, "Referenced:     %8d kB\n", rss/1024)
+	// Pages are "referenced" unless they were marked idle and haven't been
+	// touched since.
+	fmt.Fprintf(b, "Referenced:     %8d kB\n", referenced/1024)
 	fmt.Fprintf(b, "Anonymous:      %8d kB\n", anon/1024)
-	// Hugepages (hugetlb and THP) are not implemented.
-	fmt.Fprintf(b, "AnonHugePages:  %8d kB\n", 0)
+	// Private memory that can be backed by host huge pages is reported as
+	// THP. hugetlb is not implemented.
+	fmt.Fprintf(b, "AnonHugePages:  %8d kB\n", anonHuge/1024)
 	fmt.Fprintf(b, "Shared_Hugetlb: %8d kB\n", 0)
 	fmt.Fprintf(b, "Private_Hugetlb: %7d kB\n", 0)
 	// Swap is not implemented.
@@ -267,5 +276,11 @@ func (mm *MemoryManager) vmaSmapsEntryIntoLocked(ctx context.Context, vseg vmaIt
 	if vma.private && vma.effectivePerms.Write { // VM_ACCOUNT
 		b.WriteString("ac ")
 	}
+	switch vma.hugepage {
+	case linux.MADV_HUGEPAGE: // VM_HUGEPAGE
+		b.WriteString("hg ")
+	case linux.MADV_NOHUGEPAGE: // VM_NOHUGEPAGE
+		b.WriteString("nh ")
+	}
 	b.WriteString("\n")
 }
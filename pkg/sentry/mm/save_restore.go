@@ -35,6 +35,17 @@ func (mm *MemoryManager) InvalidateUnsavable(ctx context.Context) error {
 	return nil
 }
 
+// PrepareAsyncSave removes all of mm's AddressSpace mappings, so that
+// subsequent writes by the application fault and can be prepared for as
+// required by pgalloc.MemoryFile.StartAsyncSave and pgalloc.Precopy.BeginRound.
+// Mappings are reestablished on demand, and are write-protected for pages that
+// are still being saved or have been pre-copied.
+func (mm *MemoryManager) PrepareAsyncSave() {
+	mm.activeMu.Lock()
+	defer mm.activeMu.Unlock()
+	mm.unmapASLocked(mm.applicationAddrRange())
+}
+
 // beforeSave is invoked by stateify.
 func (mm *MemoryManager) beforeSave() {
 	for pseg := mm.pmas.FirstSegment(); pseg.Ok(); pseg = pseg.NextSegment() {
@@ -16,12 +16,12 @@ package mm
 
 import (
 	"fmt"
-	mrand "math/rand"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/guestrand"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/futex"
 	"gvisor.dev/gvisor/pkg/sentry/limits"
@@ -64,6 +64,10 @@ func (mm *MemoryManager) HandleUserFault(ctx context.Context, addr hostarch.Addr
 	// anymore.
 	mm.activeMu.DowngradeLock()
 
+	if at.Write {
+		mm.prepareWriteLocked(pseg, ar)
+	}
+
 	// Map the faulted page into the active AddressSpace.
 	err = mm.mapASLocked(pseg, ar, false)
 	mm.activeMu.RUnlock()
@@ -261,9 +265,12 @@ func (mm *MemoryManager) MapStack(ctx context.Context) (hostarch.AddrRange, erro
 	szaddr := hostarch.Addr(sz)
 	ctx.Debugf("Allocating stack with size of %v bytes", sz)
 
-	// Determine the stack's desired location. Unlike Linux, address
-	// randomization can't be disabled.
-	stackEnd := mm.layout.MaxAddr - hostarch.Addr(mrand.Int63n(int64(mm.layout.MaxStackRand))).RoundDown()
+	// Determine the stack's desired location.
+	stackEnd := mm.layout.MaxAddr
+	if !mm.layout.NoRandomize {
+		rng := guestrand.RNG(ctx)
+		stackEnd -= hostarch.Addr(rng.Int63n(int64(mm.layout.MaxStackRand))).RoundDown()
+	}
 	if stackEnd < szaddr {
 		return hostarch.AddrRange{}, linuxerr.ENOMEM
 	}
@@ -308,6 +315,15 @@ func (mm *MemoryManager) MUnmap(ctx context.Context, addr hostarch.Addr, length
 
 	var droppedIDs []memmap.MappingIdentity
 	mm.mappingMu.Lock()
+	// Unmapping the middle of a vma splits it in two. Allow the number of vmas
+	// to reach vm.max_map_count, but not to exceed it. Compare Linux's
+	// mm/mmap.c:do_vmi_align_munmap().
+	if vseg := mm.vmas.FindSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.Start && ar.End < vseg.End() {
+		if mm.vmaCount >= maxMapCountFromContext(ctx) {
+			mm.mappingMu.Unlock()
+			return linuxerr.ENOMEM
+		}
+	}
 	_, droppedIDs = mm.unmapLocked(ctx, ar, droppedIDs)
 	mm.mappingMu.Unlock()
 
@@ -529,6 +545,13 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr hostarch.Addr, oldS
 		return 0, linuxerr.ENOMEM
 	}
 
+	// Check against vm.max_map_count. Copying or moving may split the vma at
+	// oldAR and add another at newAR; like Linux, leave headroom for both.
+	// Compare Linux's mm/mremap.c:move_vma().
+	if mm.vmaCount >= maxMapCountFromContext(ctx)-3 {
+		return 0, linuxerr.ENOMEM
+	}
+
 	if vma := vseg.ValuePtr(); vma.mappable != nil {
 		// Check that offset+length does not overflow.
 		if vma.off+uint64(newAR.Length()) < vma.off {
@@ -553,7 +576,7 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr hostarch.Addr, oldS
 		if vma.id != nil {
 			vma.id.IncRef()
 		}
-		vseg := mm.vmas.Insert(mm.vmas.FindGap(newAR.Start), newAR, vma)
+		vseg := mm.insertVMALocked(mm.vmas.FindGap(newAR.Start), newAR, vma)
 		mm.usageAS += uint64(newAR.Length())
 		if vma.isPrivateDataLocked() {
 			mm.dataAS += uint64(newAR.Length())
@@ -579,10 +602,10 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr hostarch.Addr, oldS
 	// 2. We can't call vma.mappable.RemoveMapping, because pmas are still at
 	// oldAR, so calling RemoveMapping could cause us to miss an invalidation
 	// overlapping oldAR.
-	vseg = mm.vmas.Isolate(vseg, oldAR)
+	vseg = mm.isolateVMALocked(vseg, oldAR)
 	vma := vseg.ValuePtr().copy()
-	mm.vmas.Remove(vseg)
-	vseg = mm.vmas.Insert(mm.vmas.FindGap(newAR.Start), newAR, vma)
+	mm.removeVMALocked(vseg)
+	vseg = mm.insertVMALocked(mm.vmas.FindGap(newAR.Start), newAR, vma)
 	mm.usageAS = mm.usageAS - uint64(oldAR.Length()) + uint64(newAR.Length())
 	if vma.isPrivateDataLocked() {
 		mm.dataAS = mm.dataAS - uint64(oldAR.Length()) + uint64(newAR.Length())
@@ -611,8 +634,11 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr hostarch.Addr, oldS
 	return newAR.Start, nil
 }
 
-// MProtect implements the semantics of Linux's mprotect(2).
-func (mm *MemoryManager) MProtect(addr hostarch.Addr, length uint64, realPerms hostarch.AccessType, growsDown bool) error {
+// MProtect implements the semantics of Linux's mprotect(2). If
+// readImpliesExec is true, as for tasks with the READ_IMPLIES_EXEC
+// personality, read permission implies execute permission for vmas that can
+// be made executable.
+func (mm *MemoryManager) MProtect(ctx context.Context, addr hostarch.Addr, length uint64, realPerms hostarch.AccessType, growsDown, readImpliesExec bool) error {
 	if addr.RoundDown() != addr {
 		return linuxerr.EINVAL
 	}
@@ -627,7 +653,7 @@ func (mm *MemoryManager) MProtect(addr hostarch.Addr, length uint64, realPerms h
 	if !ok {
 		return linuxerr.ENOMEM
 	}
-	effectivePerms := realPerms.Effective()
+	rier := readImpliesExec && realPerms.Read
 
 	mm.mappingMu.Lock()
 	defer mm.mappingMu.Unlock()
@@ -657,20 +683,30 @@ func (mm *MemoryManager) MProtect(addr hostarch.Addr, length uint64, realPerms h
 	mm.activeMu.Lock()
 	defer mm.activeMu.Unlock()
 	defer func() {
-		mm.vmas.MergeInsideRange(ar)
-		mm.vmas.MergeOutsideRange(ar)
+		mm.mergeVMAsLocked(ar)
 		mm.pmas.MergeInsideRange(ar)
 		mm.pmas.MergeOutsideRange(ar)
 	}()
 	pseg := mm.pmas.LowerBoundSegment(ar.Start)
 	var didUnmapAS bool
 	for {
+		// As in Linux, read permission only implies execute permission for
+		// vmas that may be executable (VM_MAYEXEC).
+		perms := realPerms
+		if rier && vseg.ValuePtr().maxPerms.Execute {
+			perms.Execute = true
+		}
+		effectivePerms := perms.Effective()
+
 		// Check for permission validity before splitting vmas, for consistency
 		// with Linux.
 		if !vseg.ValuePtr().maxPerms.SupersetOf(effectivePerms) {
 			return linuxerr.EACCES
 		}
-		vseg = mm.vmas.Isolate(vseg, ar)
+		var err error
+		if vseg, err = mm.isolateVMACheckedLocked(ctx, vseg, ar); err != nil {
+			return err
+		}
 
 		// Update vma permissions.
 		vma := vseg.ValuePtr()
@@ -679,7 +715,7 @@ func (mm *MemoryManager) MProtect(addr hostarch.Addr, length uint64, realPerms h
 			mm.dataAS -= uint64(vmaLength)
 		}
 
-		vma.realPerms = realPerms
+		vma.realPerms = perms
 		vma.effectivePerms = effectivePerms
 		if vma.isPrivateDataLocked() {
 			mm.dataAS += uint64(vmaLength)
@@ -696,10 +732,7 @@ func (mm *MemoryManager) MProtect(addr hostarch.Addr, length uint64, realPerms h
 					mm.unmapASLocked(ar)
 					didUnmapAS = true
 				}
-				pma.effectivePerms = effectivePerms.Intersect(pma.translatePerms)
-				if pma.needCOW {
-					pma.effectivePerms.Write = false
-				}
+				pma.effectivePerms = pma.trackedPerms(effectivePerms.Intersect(pma.translatePerms))
 			}
 			pseg = pseg.NextSegment()
 		}
@@ -848,14 +881,16 @@ func (mm *MemoryManager) MLock(ctx context.Context, addr hostarch.Addr, length u
 	}
 
 	// Apply the new mlock mode to vmas.
-	var unmapped bool
+	var err error
 	vseg := mm.vmas.FindSegment(ar.Start)
 	for {
 		if !vseg.Ok() {
-			unmapped = true
+			err = linuxerr.ENOMEM
+			break
+		}
+		if vseg, err = mm.isolateVMACheckedLocked(ctx, vseg, ar); err != nil {
 			break
 		}
-		vseg = mm.vmas.Isolate(vseg, ar)
 		vma := vseg.ValuePtr()
 		prevMode := vma.mlockMode
 		vma.mlockMode = mode
@@ -869,11 +904,10 @@ func (mm *MemoryManager) MLock(ctx context.Context, addr hostarch.Addr, length u
 		}
 		vseg, _ = vseg.NextNonEmpty()
 	}
-	mm.vmas.MergeInsideRange(ar)
-	mm.vmas.MergeOutsideRange(ar)
-	if unmapped {
+	mm.mergeVMAsLocked(ar)
+	if err != nil {
 		mm.mappingMu.Unlock()
-		return linuxerr.ENOMEM
+		return err
 	}
 
 	if mode == memmap.MLockEager {
@@ -1017,7 +1051,7 @@ func (mm *MemoryManager) NumaPolicy(addr hostarch.Addr) (linux.NumaPolicy, uint6
 }
 
 // SetNumaPolicy implements the semantics of Linux's mbind().
-func (mm *MemoryManager) SetNumaPolicy(addr hostarch.Addr, length uint64, policy linux.NumaPolicy, nodemask uint64) error {
+func (mm *MemoryManager) SetNumaPolicy(ctx context.Context, addr hostarch.Addr, length uint64, policy linux.NumaPolicy, nodemask uint64) error {
 	if !addr.IsPageAligned() {
 		return linuxerr.EINVAL
 	}
@@ -1033,10 +1067,7 @@ func (mm *MemoryManager) SetNumaPolicy(addr hostarch.Addr, length uint64, policy
 
 	mm.mappingMu.Lock()
 	defer mm.mappingMu.Unlock()
-	defer func() {
-		mm.vmas.MergeInsideRange(ar)
-		mm.vmas.MergeOutsideRange(ar)
-	}()
+	defer mm.mergeVMAsLocked(ar)
 	vseg := mm.vmas.LowerBoundSegment(ar.Start)
 	lastEnd := ar.Start
 	for {
@@ -1045,7 +1076,10 @@ func (mm *MemoryManager) SetNumaPolicy(addr hostarch.Addr, length uint64, policy
 			// range specified [sic] by addr and len." - mbind(2)
 			return linuxerr.EFAULT
 		}
-		vseg = mm.vmas.Isolate(vseg, ar)
+		var err error
+		if vseg, err = mm.isolateVMACheckedLocked(ctx, vseg, ar); err != nil {
+			return err
+		}
 		vma := vseg.ValuePtr()
 		vma.numaPolicy = policy
 		vma.numaNodemask = nodemask
@@ -1058,7 +1092,7 @@ func (mm *MemoryManager) SetNumaPolicy(addr hostarch.Addr, length uint64, policy
 }
 
 // SetDontFork implements the semantics of madvise MADV_DONTFORK.
-func (mm *MemoryManager) SetDontFork(addr hostarch.Addr, length uint64, dontfork bool) error {
+func (mm *MemoryManager) SetDontFork(ctx context.Context, addr hostarch.Addr, length uint64, dontfork bool) error {
 	ar, ok := addr.ToRange(length)
 	if !ok {
 		return linuxerr.EINVAL
@@ -1066,13 +1100,13 @@ func (mm *MemoryManager) SetDontFork(addr hostarch.Addr, length uint64, dontfork
 
 	mm.mappingMu.Lock()
 	defer mm.mappingMu.Unlock()
-	defer func() {
-		mm.vmas.MergeInsideRange(ar)
-		mm.vmas.MergeOutsideRange(ar)
-	}()
+	defer mm.mergeVMAsLocked(ar)
 
 	for vseg := mm.vmas.LowerBoundSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.End; vseg = vseg.NextSegment() {
-		vseg = mm.vmas.Isolate(vseg, ar)
+		var err error
+		if vseg, err = mm.isolateVMACheckedLocked(ctx, vseg, ar); err != nil {
+			return err
+		}
 		vma := vseg.ValuePtr()
 		vma.dontfork = dontfork
 	}
@@ -42,6 +42,11 @@ func (mm *MemoryManager) createVMALocked(ctx context.Context, opts memmap.MMapOp
 		panic(fmt.Sprintf("Non-effective MaxPerms %s cannot be enforced", opts.MaxPerms))
 	}
 
+	// Check against vm.max_map_count. Compare Linux's mm/mmap.c:do_mmap().
+	if mm.vmaCount > maxMapCountFromContext(ctx) {
+		return vmaIterator{}, hostarch.AddrRange{}, droppedIDs, linuxerr.ENOMEM
+	}
+
 	// Find a usable range.
 	addr, err := mm.findAvailableLocked(opts.Length, findAvailableOpts{
 		Addr:     opts.Addr,
@@ -125,7 +130,7 @@ func (mm *MemoryManager) createVMALocked(ctx context.Context, opts memmap.MMapOp
 		hint:           opts.Hint,
 	}
 
-	vseg := mm.vmas.Insert(vgap, ar, v)
+	vseg := mm.insertVMALocked(vgap, ar, v)
 	mm.usageAS += opts.Length
 	if v.isPrivateDataLocked() {
 		mm.dataAS += opts.Length
@@ -398,7 +403,7 @@ func (mm *MemoryManager) removeVMAsLocked(ctx context.Context, ar hostarch.AddrR
 		vseg = vgap.NextSegment()
 	}
 	for vseg.Ok() && vseg.Start() < ar.End {
-		vseg = mm.vmas.Isolate(vseg, ar)
+		vseg = mm.isolateVMALocked(vseg, ar)
 		vmaAR := vseg.Range()
 		vma := vseg.ValuePtr()
 		if vma.mappable != nil {
@@ -414,12 +419,113 @@ func (mm *MemoryManager) removeVMAsLocked(ctx context.Context, ar hostarch.AddrR
 		if vma.mlockMode != memmap.MLockNone {
 			mm.lockedAS -= uint64(vmaAR.Length())
 		}
-		vgap = mm.vmas.Remove(vseg)
+		vgap = mm.removeVMALocked(vseg)
 		vseg = vgap.NextSegment()
 	}
 	return vgap, droppedIDs
 }
 
+// insertVMALocked inserts vma into mm.vmas at ar, merging it with adjacent
+// vmas if possible, and updates mm.vmaCount.
+//
+// Preconditions:
+//   - mm.mappingMu must be locked for writing.
+//   - vgap is the gap in mm.vmas containing ar.
+func (mm *MemoryManager) insertVMALocked(vgap vmaGapIterator, ar hostarch.AddrRange, v vma) vmaIterator {
+	vseg := mm.vmas.Insert(vgap, ar, v)
+	mm.vmaCount++
+	if vseg.Start() < ar.Start {
+		mm.vmaCount--
+	}
+	if vseg.End() > ar.End {
+		mm.vmaCount--
+	}
+	return vseg
+}
+
+// removeVMALocked removes vseg from mm.vmas and updates mm.vmaCount. It does
+// not update any other accounting.
+//
+// Preconditions: mm.mappingMu must be locked for writing.
+func (mm *MemoryManager) removeVMALocked(vseg vmaIterator) vmaGapIterator {
+	mm.vmaCount--
+	return mm.vmas.Remove(vseg)
+}
+
+// isolateVMALocked splits vseg at ar.Start and ar.End as necessary, as for
+// mm.vmas.Isolate, and updates mm.vmaCount.
+//
+// Preconditions:
+//   - mm.mappingMu must be locked for writing.
+//   - vseg.Range().Overlaps(ar).
+func (mm *MemoryManager) isolateVMALocked(vseg vmaIterator, ar hostarch.AddrRange) vmaIterator {
+	mm.vmaCount += vmaSplitsForIsolate(vseg, ar)
+	return mm.vmas.Isolate(vseg, ar)
+}
+
+// isolateVMACheckedLocked is equivalent to isolateVMALocked, except that it
+// returns ENOMEM without splitting vseg if doing so would exceed
+// vm.max_map_count. Compare Linux's mm/mmap.c:split_vma().
+//
+// Preconditions:
+//   - mm.mappingMu must be locked for writing.
+//   - vseg.Range().Overlaps(ar).
+func (mm *MemoryManager) isolateVMACheckedLocked(ctx context.Context, vseg vmaIterator, ar hostarch.AddrRange) (vmaIterator, error) {
+	if splits := vmaSplitsForIsolate(vseg, ar); splits != 0 && mm.vmaCount+splits > maxMapCountFromContext(ctx) {
+		return vseg, linuxerr.ENOMEM
+	}
+	return mm.isolateVMALocked(vseg, ar), nil
+}
+
+// vmaSplitsForIsolate returns the number of vmas that isolating vseg to ar
+// would add to mm.vmas.
+func vmaSplitsForIsolate(vseg vmaIterator, ar hostarch.AddrRange) int {
+	splits := 0
+	if vseg.Range().CanSplitAt(ar.Start) {
+		splits++
+	}
+	if vseg.Range().CanSplitAt(ar.End) {
+		splits++
+	}
+	return splits
+}
+
+// mergeVMAsLocked merges vmas in and adjacent to ar, as for
+// mm.vmas.MergeInsideRange(ar) followed by mm.vmas.MergeOutsideRange(ar), and
+// updates mm.vmaCount.
+//
+// Preconditions: mm.mappingMu must be locked for writing.
+func (mm *MemoryManager) mergeVMAsLocked(ar hostarch.AddrRange) {
+	// Merging only combines vmas that overlap ar with each other and with
+	// their immediate neighbors, so only vmas in bounds can be affected.
+	bounds := ar
+	if vseg := mm.vmas.LowerBoundSegment(ar.Start); vseg.Ok() {
+		if prev := vseg.PrevSegment(); prev.Ok() {
+			bounds.Start = prev.Start()
+		}
+	}
+	if vseg := mm.vmas.UpperBoundSegment(ar.End - 1); vseg.Ok() {
+		if next := vseg.NextSegment(); next.Ok() {
+			bounds.End = next.End()
+		}
+	}
+	before := mm.countVMAsLocked(bounds)
+	mm.vmas.MergeInsideRange(ar)
+	mm.vmas.MergeOutsideRange(ar)
+	mm.vmaCount -= before - mm.countVMAsLocked(bounds)
+}
+
+// countVMAsLocked returns the number of vmas that overlap ar.
+//
+// Preconditions: mm.mappingMu must be locked.
+func (mm *MemoryManager) countVMAsLocked(ar hostarch.AddrRange) int {
+	n := 0
+	for vseg := mm.vmas.LowerBoundSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.End; vseg = vseg.NextSegment() {
+		n++
+	}
+	return n
+}
+
 // canWriteMappableLocked returns true if it is possible for vma.mappable to be
 // written to via this vma, i.e. if it is possible that
 // vma.mappable.Translate(at.Write=true) may be called as a result of this vma.
@@ -469,6 +575,7 @@ func (vmaSetFunctions) Merge(ar1 hostarch.AddrRange, vma1 vma, ar2 hostarch.Addr
 		vma1.numaPolicy != vma2.numaPolicy ||
 		vma1.numaNodemask != vma2.numaNodemask ||
 		vma1.dontfork != vma2.dontfork ||
+		vma1.hugepage != vma2.hugepage ||
 		vma1.id != vma2.id ||
 		vma1.hint != vma2.hint {
 		return vma{}, false
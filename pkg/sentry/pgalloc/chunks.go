@@ -0,0 +1,228 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgalloc
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/metric"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+)
+
+// chunkKind is the kind of allocations a chunk is used for.
+type chunkKind uint8
+
+const (
+	// chunkAny is the kind of unused chunks, and of all chunks if
+	// MemoryFileOpts.AdviseHugepage is false.
+	chunkAny chunkKind = iota
+
+	// chunkSmall is the kind of chunks used for allocations that are not
+	// huge.
+	chunkSmall
+
+	// chunkHuge is the kind of chunks used for huge allocations.
+	chunkHuge
+)
+
+// chunkInfo is the value type of MemoryFile.chunks.
+//
+// +stateify savable
+type chunkInfo struct {
+	// kind is the kind of allocations the chunk is used for. Once a chunk is
+	// used for small or huge allocations, it is never used for the other
+	// kind, even after all of its pages have been freed: the host may still
+	// back it with pages of the previous size.
+	kind chunkKind
+}
+
+// canUse returns true if an allocation of the given kind can be placed in the
+// chunk.
+func (c *chunkInfo) canUse(kind chunkKind) bool {
+	return c.kind == chunkAny || c.kind == kind
+}
+
+// NUMAPolicy is a host NUMA memory policy, as set by mbind(2).
+type NUMAPolicy struct {
+	// Mode is the policy mode: MPOL_DEFAULT, MPOL_PREFERRED, MPOL_BIND or
+	// MPOL_INTERLEAVE.
+	Mode linux.NumaPolicy
+
+	// Nodes is the set of host NUMA nodes that Mode applies to. It must not
+	// be empty unless Mode is MPOL_DEFAULT. MPOL_PREFERRED only uses the
+	// first node.
+	Nodes []int
+}
+
+// nodemask returns p.Nodes as a nodemask for mbind(2).
+func (p *NUMAPolicy) nodemask() []uint64 {
+	var mask []uint64
+	for _, node := range p.Nodes {
+		if p.Mode == linux.MPOL_PREFERRED && len(mask) != 0 {
+			break
+		}
+		for len(mask) <= node/64 {
+			mask = append(mask, 0)
+		}
+		mask[node/64] |= 1 << (node % 64)
+	}
+	return mask
+}
+
+var (
+	// hugeChunkBytes is the number of bytes in chunks used for huge
+	// allocations, in all MemoryFiles.
+	hugeChunkBytes atomicbitops.Uint64
+
+	// hugeAllocatedBytes is the number of bytes allocated from chunks used
+	// for huge allocations, in all MemoryFiles.
+	hugeAllocatedBytes atomicbitops.Uint64
+
+	// hostPolicyFailures counts the number of chunks for which madvise(2) or
+	// mbind(2) failed.
+	hostPolicyFailures = metric.MustCreateNewUint64Metric("/memory/host_policy_failures", false /* sync */, "Number of memory file chunks whose host huge page advice or NUMA policy could not be applied.")
+
+	// hostCollapseUnsupported is set when madvise(MADV_COLLAPSE) fails with
+	// EINVAL, e.g. because the host kernel predates Linux 6.1 or doesn't
+	// allow huge pages for the memory file, so that CollapseHuge stops trying.
+	hostCollapseUnsupported atomicbitops.Bool
+)
+
+func init() {
+	metric.MustRegisterCustomUint64Metric("/memory/hugepage_chunk_bytes", false /* cumulative */, false /* sync */, "Size of the memory file chunks that the host is asked to back with transparent huge pages, in bytes.", func(...*metric.FieldValue) uint64 {
+		return hugeChunkBytes.Load()
+	})
+	metric.MustRegisterCustomUint64Metric("/memory/hugepage_allocated_bytes", false /* cumulative */, false /* sync */, "Amount of memory allocated from memory file chunks that the host is asked to back with transparent huge pages, in bytes.", func(...*metric.FieldValue) uint64 {
+		return hugeAllocatedBytes.Load()
+	})
+}
+
+// setChunkKindLocked marks the chunks spanned by fr as used for allocations of
+// the given kind.
+//
+// Preconditions:
+//   - f.mu must be locked.
+//   - kind != chunkAny.
+//   - All chunks spanned by fr can be used for allocations of the given kind.
+func (f *MemoryFile) setChunkKindLocked(fr memmap.FileRange, kind chunkKind) {
+	f.mappingsMu.Lock()
+	defer f.mappingsMu.Unlock()
+	mappings := f.mappings.Load().([]uintptr)
+	for chunk := int(fr.Start >> chunkShift); chunk <= int((fr.End-1)>>chunkShift); chunk++ {
+		if f.chunks[chunk].kind == kind {
+			continue
+		}
+		f.chunks[chunk].kind = kind
+		if kind == chunkHuge {
+			hugeChunkBytes.Add(chunkSize)
+		}
+		if m := mappings[chunk]; m != 0 {
+			// The chunk was mapped before being used, so
+			// getChunkMapping didn't advise it.
+			f.applyChunkPolicyLocked(chunk, m)
+		}
+	}
+}
+
+// hugeBytesLocked returns the number of bytes in fr that are in chunks used for
+// huge allocations.
+//
+// Preconditions: f.mu or f.mappingsMu must be locked.
+func (f *MemoryFile) hugeBytesLocked(fr memmap.FileRange) uint64 {
+	if !f.opts.AdviseHugepage {
+		return 0
+	}
+	var n uint64
+	for chunk := int(fr.Start >> chunkShift); chunk <= int((fr.End-1)>>chunkShift) && chunk < len(f.chunks); chunk++ {
+		if f.chunks[chunk].kind != chunkHuge {
+			continue
+		}
+		chunkFR := memmap.FileRange{uint64(chunk) << chunkShift, uint64(chunk+1) << chunkShift}
+		n += chunkFR.Intersect(fr).Length()
+	}
+	return n
+}
+
+// applyChunkPolicyLocked applies the host huge page advice and NUMA policy of
+// the chunk to its mapping at address m.
+//
+// Preconditions: f.mappingsMu must be locked.
+func (f *MemoryFile) applyChunkPolicyLocked(chunk int, m uintptr) {
+	if f.opts.NUMAPolicy.Mode != linux.MPOL_DEFAULT {
+		// The policy of shared memory is set on the file rather than on the
+		// mapping, so it also applies to pages faulted in through application
+		// mappings. It only needs to be set once per chunk, but setting it
+		// again when a chunk's kind changes is harmless.
+		if err := mbind(m, chunkSize, &f.opts.NUMAPolicy); err != nil {
+			log.Warningf("Failed to set NUMA policy of MemoryFile chunk %d: %v", chunk, err)
+			hostPolicyFailures.Increment()
+		}
+	}
+	if !f.opts.AdviseHugepage {
+		return
+	}
+	var advice uintptr
+	switch f.chunks[chunk].kind {
+	case chunkSmall:
+		advice = unix.MADV_NOHUGEPAGE
+	case chunkHuge:
+		advice = unix.MADV_HUGEPAGE
+	default:
+		// The chunk's kind will be set when it is first used.
+		return
+	}
+	if _, _, errno := unix.RawSyscall(unix.SYS_MADVISE, m, chunkSize, advice); errno != 0 {
+		log.Warningf("Failed to advise MemoryFile chunk %d with %d: %v", chunk, advice, errno)
+		hostPolicyFailures.Increment()
+	}
+}
+
+// CollapseHuge asks the host to back fr with huge pages now, rather than
+// whenever its khugepaged gets to it. It is best-effort, since fr is usable
+// either way.
+//
+// Preconditions: fr is huge page-aligned, and was allocated with
+// AllocOpts.Huge.
+func (f *MemoryFile) CollapseHuge(fr memmap.FileRange) {
+	if !f.opts.AdviseHugepage || hostCollapseUnsupported.Load() {
+		return
+	}
+	f.forEachMappingSlice(fr, func(bs []byte) {
+		if hostCollapseUnsupported.Load() {
+			return
+		}
+		if err := collapse(bs); err == unix.EINVAL && !hostCollapseUnsupported.Swap(true) {
+			log.Infof("Host does not support MADV_COLLAPSE for the MemoryFile; relying on khugepaged instead")
+		}
+	})
+}
+
+// restoreChunks updates metrics after f.chunks and f.usage have been loaded.
+func (f *MemoryFile) restoreChunks() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.chunks {
+		if c.kind == chunkHuge {
+			hugeChunkBytes.Add(chunkSize)
+		}
+	}
+	for seg := f.usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		if seg.ValuePtr().refs != 0 {
+			hugeAllocatedBytes.Add(f.hugeBytesLocked(seg.Range()))
+		}
+	}
+}
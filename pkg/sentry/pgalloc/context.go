@@ -30,6 +30,10 @@ const (
 
 	// CtxMemoryCgroupID is the memory cgroup id which the task belongs to.
 	CtxMemoryCgroupID
+
+	// CtxPrecopied is a Context.Value key for an io.ReaderAt containing the
+	// pages written out by rounds of a Precopy, used by MemoryFile.LoadFrom.
+	CtxPrecopied
 )
 
 // MemoryFileFromContext returns the MemoryFile used by ctx, or nil if no such
@@ -18,7 +18,8 @@
 // Lock order:
 //
 //	 pgalloc.MemoryFile.mu
-//		pgalloc.MemoryFile.mappingsMu
+//		pgalloc.saveTracker.mu
+//			pgalloc.MemoryFile.mappingsMu
 package pgalloc
 
 import (
@@ -137,6 +138,10 @@ type MemoryFile struct {
 	// fileSize is protected by mu.
 	fileSize int64
 
+	// allocatedBytes is the number of bytes in usage with a non-zero
+	// reference count. allocatedBytes is protected by mu.
+	allocatedBytes uint64
+
 	// Pages from the backing file are mapped into the local address space on
 	// the granularity of large pieces called chunks. mappings is a []uintptr
 	// that stores, for each chunk, the start address of a mapping of that
@@ -155,6 +160,13 @@ type MemoryFile struct {
 	mappingsMu mappingsMutex
 	mappings   atomic.Value
 
+	// chunks stores, for each chunk, the kind of allocations it is used for.
+	// Chunk kinds are only assigned if opts.AdviseHugepage is true.
+	//
+	// chunks is protected by both mu and mappingsMu: mutating it requires
+	// holding both, and reading it requires holding either.
+	chunks []chunkInfo
+
 	// destroyed is set by Destroy to instruct the reclaimer goroutine to
 	// release resources and exit. destroyed is protected by mu.
 	destroyed bool
@@ -168,9 +180,19 @@ type MemoryFile struct {
 	reclaim reclaimSet
 
 	// reclaimCond is signaled (with mu locked) when reclaimable or destroyed
-	// transitions from false to true.
+	// transitions from false to true, or when saving transitions to nil.
 	reclaimCond sync.Cond
 
+	// saving tracks the pages whose contents are still being written out by
+	// an AsyncSave, if any. While saving is not nil, reclaim is deferred, so
+	// that pages being saved are neither decommitted nor reallocated. saving
+	// is only mutated with mu locked, but may be loaded without it.
+	saving atomic.Pointer[saveTracker]
+
+	// precopy tracks writes to the pages of the file for a Precopy, if any.
+	// precopy is only mutated with mu locked, but may be loaded without it.
+	precopy atomic.Pointer[Precopy]
+
 	// evictable maps EvictableMemoryUsers to eviction state.
 	//
 	// evictable is protected by mu.
@@ -212,6 +234,24 @@ type MemoryFileOpts struct {
 
 	// DiskBackedFile indicates that the MemoryFile is backed by a file on disk.
 	DiskBackedFile bool
+
+	// If AdviseHugepage is true, MemoryFile places huge allocations (see
+	// AllocOpts.Huge) in different chunks from other allocations, and
+	// requests that the host back chunks used for huge allocations with
+	// transparent huge pages, using madvise(MADV_HUGEPAGE). Other chunks are
+	// marked MADV_NOHUGEPAGE, so that the host doesn't spend huge pages on
+	// memory that is likely to be fragmented.
+	AdviseHugepage bool
+
+	// NUMAPolicy is the host NUMA memory policy applied to the backing file.
+	// The zero value leaves the host's default policy in effect.
+	NUMAPolicy NUMAPolicy
+
+	// If AllocationLimit is non-zero, allocations fail with ENOMEM if they
+	// would cause more than AllocationLimit bytes to be allocated at once.
+	// Memory that has been freed but not yet reclaimed doesn't count towards
+	// the limit.
+	AllocationLimit uint64
 }
 
 // DelayedEvictionType is the type of MemoryFileOpts.DelayedEviction.
@@ -461,6 +501,12 @@ type AllocOpts struct {
 	// that will fill the allocated memory by invoking host system calls should
 	// pass AllocateOnly.
 	Mode AllocationMode
+	// If Huge is true, the allocated memory is expected to benefit from being
+	// backed by host huge pages, e.g. because it is application memory that
+	// is likely to be accessed as a whole. Allocations of at least
+	// hostarch.HugePageSize bytes are always considered huge. Huge has no
+	// effect unless MemoryFileOpts.AdviseHugepage is true.
+	Huge bool
 	// If Reader is provided, the allocated memory is filled by calling
 	// ReadToBlocks() repeatedly until either length bytes are read or a non-nil
 	// error is returned. It returns the allocated memory, truncated down to the
@@ -547,9 +593,20 @@ func (f *MemoryFile) allocate(length uint64, opts *AllocOpts) (memmap.FileRange,
 	if length >= hostarch.HugePageSize {
 		alignment = hostarch.HugePageSize
 	}
+	kind := chunkAny
+	if f.opts.AdviseHugepage {
+		kind = chunkSmall
+		if opts.Huge || length >= hostarch.HugePageSize {
+			kind = chunkHuge
+		}
+	}
+
+	if limit := f.opts.AllocationLimit; limit != 0 && f.allocatedBytes+length > limit {
+		return memmap.FileRange{}, linuxerr.ENOMEM
+	}
 
 	// Find a range in the underlying file.
-	fr, ok := f.findAvailableRange(length, alignment, opts.Dir)
+	fr, ok := f.findAvailableRange(length, alignment, opts.Dir, kind)
 	if !ok {
 		return memmap.FileRange{}, linuxerr.ENOMEM
 	}
@@ -567,8 +624,17 @@ func (f *MemoryFile) allocate(length uint64, opts *AllocOpts) (memmap.FileRange,
 		newMappings := make([]uintptr, newFileSize>>chunkShift)
 		copy(newMappings, oldMappings)
 		f.mappings.Store(newMappings)
+		newChunks := make([]chunkInfo, newFileSize>>chunkShift)
+		copy(newChunks, f.chunks)
+		f.chunks = newChunks
 		f.mappingsMu.Unlock()
 	}
+	if kind != chunkAny {
+		f.setChunkKindLocked(fr, kind)
+		if kind == chunkHuge {
+			hugeAllocatedBytes.Add(fr.Length())
+		}
+	}
 
 	if f.opts.ManualZeroing {
 		if err := f.manuallyZero(fr); err != nil {
@@ -581,6 +647,7 @@ func (f *MemoryFile) allocate(length uint64, opts *AllocOpts) (memmap.FileRange,
 		refs:    1,
 		memCgID: opts.MemCgID,
 	})
+	f.allocatedBytes += length
 
 	return fr, nil
 }
@@ -594,37 +661,66 @@ func (f *MemoryFile) allocate(length uint64, opts *AllocOpts) (memmap.FileRange,
 // lower addresses). The file is also grown exponentially in order to create
 // space for mappings to be allocated downwards.
 //
+// If kind is not chunkAny, the returned range only spans chunks that are
+// unused or used for allocations of the same kind.
+//
 // Precondition: alignment must be a power of 2.
-func (f *MemoryFile) findAvailableRange(length, alignment uint64, dir Direction) (memmap.FileRange, bool) {
+func (f *MemoryFile) findAvailableRange(length, alignment uint64, dir Direction, kind chunkKind) (memmap.FileRange, bool) {
+	// lastBadChunk returns the index of the last chunk overlapping fr that
+	// can't be used for the allocation, or -1.
+	lastBadChunk := func(fr memmap.FileRange) int {
+		if kind == chunkAny {
+			return -1
+		}
+		// Chunks past the end of f.chunks are unused.
+		last := min(int((fr.End-1)>>chunkShift), len(f.chunks)-1)
+		for chunk := last; chunk >= int(fr.Start>>chunkShift); chunk-- {
+			if !f.chunks[chunk].canUse(kind) {
+				return chunk
+			}
+		}
+		return -1
+	}
 	if dir == BottomUp {
-		return findAvailableRangeBottomUp(&f.usage, length, alignment)
+		return findAvailableRangeBottomUp(&f.usage, length, alignment, lastBadChunk)
 	}
-	return findAvailableRangeTopDown(&f.usage, f.fileSize, length, alignment)
+	return findAvailableRangeTopDown(&f.usage, f.fileSize, length, alignment, lastBadChunk)
 }
 
-func findAvailableRangeTopDown(usage *usageSet, fileSize int64, length, alignment uint64) (memmap.FileRange, bool) {
+func findAvailableRangeTopDown(usage *usageSet, fileSize int64, length, alignment uint64, lastBadChunk func(memmap.FileRange) int) (memmap.FileRange, bool) {
 	alignmentMask := alignment - 1
 
 	// Search for space in existing gaps, starting at the current end of the
 	// file and working backward.
 	lastGap := usage.LastGap()
 	gap := lastGap
+gapLoop:
 	for {
 		end := gap.End()
 		if end > uint64(fileSize) {
 			end = uint64(fileSize)
 		}
 
-		// Try to allocate from the end of this gap, with the start of the
-		// allocated range aligned down to alignment.
-		unalignedStart := end - length
-		if unalignedStart > end {
-			// Negative overflow: this and all preceding gaps are too small to
-			// accommodate length.
-			break
-		}
-		if start := unalignedStart &^ alignmentMask; start >= gap.Start() {
-			return memmap.FileRange{start, start + length}, true
+		for {
+			// Try to allocate from the end of this gap, with the start of the
+			// allocated range aligned down to alignment.
+			unalignedStart := end - length
+			if unalignedStart > end {
+				// Negative overflow: this and all preceding gaps are too small
+				// to accommodate length.
+				break gapLoop
+			}
+			start := unalignedStart &^ alignmentMask
+			if start < gap.Start() {
+				break
+			}
+			fr := memmap.FileRange{start, start + length}
+			chunk := lastBadChunk(fr)
+			if chunk < 0 {
+				return fr, true
+			}
+			// Retry below the chunk that can't be used.
+			end = uint64(chunk) << chunkShift
 		}
 
 		gap = gap.PrevLargeEnoughGap(length)
@@ -659,25 +755,39 @@ func findAvailableRangeTopDown(usage *usageSet, fileSize int64, length, alignmen
 			continue
 		}
 		if start := unalignedStart &^ alignmentMask; start >= min {
-			return memmap.FileRange{start, start + length}, true
+			fr := memmap.FileRange{start, start + length}
+			if lastBadChunk(fr) >= 0 {
+				// Grow the file further, until the allocation only spans new
+				// chunks.
+				continue
+			}
+			return fr, true
 		}
 	}
 }
 
-func findAvailableRangeBottomUp(usage *usageSet, length, alignment uint64) (memmap.FileRange, bool) {
+func findAvailableRangeBottomUp(usage *usageSet, length, alignment uint64, lastBadChunk func(memmap.FileRange) int) (memmap.FileRange, bool) {
 	alignmentMask := alignment - 1
 	for gap := usage.FirstGap(); gap.Ok(); gap = gap.NextLargeEnoughGap(length) {
 		// Align the start address and check if allocation still fits in the gap.
 		start := (gap.Start() + alignmentMask) &^ alignmentMask
-
-		// File offsets are int64s. Since length must be strictly positive, end
-		// cannot legitimately be 0.
-		end := start + length
-		if end < start || int64(end) <= 0 {
-			return memmap.FileRange{}, false
-		}
-		if end <= gap.End() {
-			return memmap.FileRange{start, end}, true
+		for {
+			// File offsets are int64s. Since length must be strictly
+			// positive, end cannot legitimately be 0.
+			end := start + length
+			if end < start || int64(end) <= 0 {
+				return memmap.FileRange{}, false
+			}
+			if end > gap.End() {
+				break
+			}
+			fr := memmap.FileRange{start, end}
+			chunk := lastBadChunk(fr)
+			if chunk < 0 {
+				return fr, true
+			}
+			// Retry above the chunk that can't be used.
+			start = ((uint64(chunk+1) << chunkShift) + alignmentMask) &^ alignmentMask
 		}
 	}
 
@@ -797,6 +907,9 @@ func (f *MemoryFile) Decommit(fr memmap.FileRange) error {
 		panic(fmt.Sprintf("invalid range: %v", fr))
 	}
 
+	// Decommitting pages zeroes them.
+	f.PrepareWrite(fr)
+
 	if f.opts.ManualZeroing {
 		// FALLOC_FL_PUNCH_HOLE may not zero pages if ManualZeroing is in
 		// effect.
@@ -914,6 +1027,10 @@ func (f *MemoryFile) DecRef(fr memmap.FileRange) {
 		if val.refs == 0 {
 			f.reclaim.InsertRange(seg.Range(), reclaimSetValue{})
 			freed = true
+			f.allocatedBytes -= seg.Range().Length()
+			if huge := f.hugeBytesLocked(seg.Range()); huge != 0 {
+				hugeAllocatedBytes.Add(-huge)
+			}
 			// Reclassify memory as System, until it's freed by the reclaim
 			// goroutine.
 			if val.knownCommitted {
@@ -938,7 +1055,29 @@ func (f *MemoryFile) MapInternal(fr memmap.FileRange, at hostarch.AccessType) (s
 	if at.Execute {
 		return safemem.BlockSeq{}, linuxerr.EACCES
 	}
+	if at.Write {
+		f.PrepareWrite(fr)
+	}
+	return f.mapInternal(fr)
+}
+
+// MapInternalUntracked is equivalent to MapInternal, except that it does not
+// call PrepareWrite even if at.Write is true. Callers that write through the
+// returned mappings must call PrepareWrite on the written range before each
+// write. This allows callers that cache internal mappings for both reading
+// and writing to avoid preserving pages that are only read.
+func (f *MemoryFile) MapInternalUntracked(fr memmap.FileRange, at hostarch.AccessType) (safemem.BlockSeq, error) {
+	if !fr.WellFormed() || fr.Length() == 0 {
+		panic(fmt.Sprintf("invalid range: %v", fr))
+	}
+	if at.Execute {
+		return safemem.BlockSeq{}, linuxerr.EACCES
+	}
+	return f.mapInternal(fr)
+}
 
+// Preconditions: fr.Length() != 0.
+func (f *MemoryFile) mapInternal(fr memmap.FileRange) (safemem.BlockSeq, error) {
 	chunks := ((fr.End + chunkMask) >> chunkShift) - (fr.Start >> chunkShift)
 	if chunks == 1 {
 		// Avoid an unnecessary slice allocation.
@@ -1003,6 +1142,7 @@ func (f *MemoryFile) getChunkMapping(chunk int) ([]uintptr, uintptr, error) {
 	if errno != 0 {
 		return nil, 0, errno
 	}
+	f.applyChunkPolicyLocked(chunk, m)
 	atomic.StoreUintptr(&mappings[chunk], m)
 	return mappings, m, nil
 }
@@ -1344,6 +1484,8 @@ func (f *MemoryFile) runReclaim() {
 		if !ok {
 			break
 		}
+		// Decommitting pages zeroes them.
+		f.PrepareWrite(fr)
 
 		if f.opts.ManualZeroing {
 			// If ManualZeroing is in effect, only hugepage-aligned regions may
@@ -1402,6 +1544,12 @@ func (f *MemoryFile) runReclaim() {
 	}
 	// Similarly, invalidate f.mappings. (atomic.Value.Store(nil) panics.)
 	f.mappings.Store([]uintptr{})
+	for _, c := range f.chunks {
+		if c.kind == chunkHuge {
+			hugeChunkBytes.Add(^uint64(chunkSize - 1))
+		}
+	}
+	f.chunks = nil
 	f.mu.Unlock()
 
 	// This must be called without holding f.mu to avoid circular lock
@@ -1424,9 +1572,12 @@ func (f *MemoryFile) findReclaimable() (memmap.FileRange, bool) {
 				return memmap.FileRange{}, false
 			}
 			if f.reclaimable {
-				break
-			}
-			if f.opts.DelayedEviction == DelayedEvictionEnabled && !f.opts.UseHostMemcgPressure {
+				if f.saving.Load() == nil {
+					break
+				}
+				// Pages being saved must not be decommitted or reallocated;
+				// wait for the save to end.
+			} else if f.opts.DelayedEviction == DelayedEvictionEnabled && !f.opts.UseHostMemcgPressure {
 				// No work to do. Evict any pending evictable allocations to
 				// get more reclaimable pages before going to sleep.
 				f.startEvictionsLocked()
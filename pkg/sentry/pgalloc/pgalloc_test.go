@@ -15,10 +15,19 @@
 package pgalloc
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"os"
 	"testing"
+	"time"
 
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/memutil"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
 )
 
 const (
@@ -335,7 +344,7 @@ func TestFindUnallocatedRange(t *testing.T) {
 			if err := f.usage.ImportSlice(test.usage); err != nil {
 				t.Fatalf("Failed to initialize usage from %v: %v", test.usage, err)
 			}
-			if fr, ok := f.findAvailableRange(test.length, test.alignment, test.direction); ok {
+			if fr, ok := f.findAvailableRange(test.length, test.alignment, test.direction, chunkAny); ok {
 				if test.expectFail {
 					t.Fatalf("findAvailableRange(%v, %x, %x, %x, %v): got: %x, want: fail", test.usage, test.fileSize, test.length, test.alignment, test.direction, fr.Start)
 				}
@@ -351,3 +360,351 @@ func TestFindUnallocatedRange(t *testing.T) {
 		})
 	}
 }
+
+func TestFindAvailableRangeChunkKind(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		chunks    []chunkKind
+		kind      chunkKind
+		direction Direction
+		want      uint64
+	}{
+		{
+			name:      "small skips huge chunk",
+			chunks:    []chunkKind{chunkHuge, chunkAny},
+			kind:      chunkSmall,
+			direction: BottomUp,
+			want:      chunkSize,
+		},
+		{
+			name:      "huge skips small chunks",
+			chunks:    []chunkKind{chunkSmall, chunkSmall, chunkHuge},
+			kind:      chunkHuge,
+			direction: BottomUp,
+			want:      2 * chunkSize,
+		},
+		{
+			name:      "huge skips small chunks",
+			chunks:    []chunkKind{chunkHuge, chunkSmall, chunkSmall},
+			kind:      chunkHuge,
+			direction: TopDown,
+			want:      chunkSize - hugepage,
+		},
+		{
+			name:      "small uses unused chunk",
+			chunks:    []chunkKind{chunkHuge, chunkAny, chunkHuge},
+			kind:      chunkSmall,
+			direction: TopDown,
+			want:      2*chunkSize - hugepage,
+		},
+		{
+			name:      "any ignores chunk kinds",
+			chunks:    []chunkKind{chunkHuge, chunkSmall},
+			kind:      chunkAny,
+			direction: BottomUp,
+			want:      0,
+		},
+	} {
+		name := fmt.Sprintf("%s (%v)", test.name, test.direction)
+		t.Run(name, func(t *testing.T) {
+			f := MemoryFile{fileSize: int64(len(test.chunks)) * chunkSize}
+			for _, kind := range test.chunks {
+				f.chunks = append(f.chunks, chunkInfo{kind: kind})
+			}
+			fr, ok := f.findAvailableRange(hugepage, hugepage, test.direction, test.kind)
+			if !ok {
+				t.Fatalf("findAvailableRange(%v, %v): failed, want: %x", test.chunks, test.kind, test.want)
+			}
+			if fr.Start != test.want {
+				t.Errorf("findAvailableRange(%v, %v): got: start=%x, want: %x", test.chunks, test.kind, fr.Start, test.want)
+			}
+		})
+	}
+}
+
+func TestSaveTracker(t *testing.T) {
+	// Each page of mem is initially filled with its index.
+	const pages = 8
+	mem := make([]byte, pages*page)
+	for i := range mem {
+		mem[i] = byte(i / page)
+	}
+	forEachSlice := func(fr memmap.FileRange, fn func([]byte)) error {
+		fn(mem[fr.Start:fr.End])
+		return nil
+	}
+	write := func(tr *saveTracker, fr memmap.FileRange) {
+		tr.prepareWrite(fr, forEachSlice)
+		for i := fr.Start; i < fr.End; i++ {
+			mem[i] = 0xff
+		}
+	}
+	pageRange := func(first, last uint64) memmap.FileRange {
+		return memmap.FileRange{first * page, (last + 1) * page}
+	}
+
+	tr := newSaveTracker([]memmap.FileRange{pageRange(0, 1), pageRange(4, 7)})
+	if tr.protected(pageRange(2, 3)) {
+		t.Errorf("untracked pages 2-3 are protected")
+	}
+	if !tr.protected(pageRange(3, 4)) {
+		t.Errorf("tracked page 4 is not protected")
+	}
+
+	// Write to part of pages 1, 5 and 6, which must be preserved in full.
+	write(tr, memmap.FileRange{1*page + 10, 1*page + 20})
+	write(tr, memmap.FileRange{5*page + 10, 6*page + 1})
+	write(tr, pageRange(2, 2))
+	if tr.protected(pageRange(5, 6)) {
+		t.Errorf("preserved pages 5-6 are protected")
+	}
+	if !tr.protected(pageRange(5, 7)) {
+		t.Errorf("tracked page 7 is not protected")
+	}
+	if got := len(tr.copies); got != 3 {
+		t.Errorf("got %d preserved pages, want 3", got)
+	}
+
+	for _, fr := range []memmap.FileRange{pageRange(0, 1), pageRange(4, 5), pageRange(6, 7)} {
+		dst := make([]byte, fr.Length())
+		if err := tr.capture(fr, dst, forEachSlice); err != nil {
+			t.Fatalf("capture(%v) failed: %v", fr, err)
+		}
+		for i := uint64(0); i < fr.Length(); i += page {
+			want := bytes.Repeat([]byte{byte((fr.Start + i) / page)}, page)
+			if got := dst[i : i+page]; !bytes.Equal(got, want) {
+				t.Errorf("capture(%v): page %d has contents %v..., want %v...", fr, (fr.Start+i)/page, got[:16], want[:16])
+			}
+		}
+		if tr.protected(fr) {
+			t.Errorf("captured pages %v are protected", fr)
+		}
+	}
+	if got := len(tr.copies); got != 0 {
+		t.Errorf("got %d preserved pages after capture, want 0", got)
+	}
+
+	// Writes to pages that have been captured are not preserved.
+	write(tr, pageRange(0, 7))
+	if got := len(tr.copies); got != 0 {
+		t.Errorf("got %d preserved pages after writing captured pages, want 0", got)
+	}
+}
+
+func TestSaveTrackerMaxCopies(t *testing.T) {
+	const pages = 4
+	mem := make([]byte, pages*page)
+	for i := range mem {
+		mem[i] = byte(i / page)
+	}
+	forEachSlice := func(fr memmap.FileRange, fn func([]byte)) error {
+		fn(mem[fr.Start:fr.End])
+		return nil
+	}
+	pageRange := func(first, last uint64) memmap.FileRange {
+		return memmap.FileRange{first * page, (last + 1) * page}
+	}
+
+	tr := newSaveTracker([]memmap.FileRange{pageRange(0, pages-1)})
+	tr.maxCopies = 1
+	tr.prepareWrite(pageRange(3, 3), forEachSlice)
+	mem[3*page] = 0xff
+
+	// Page 1 can't be preserved, so the write must wait for it to be
+	// captured.
+	done := make(chan struct{})
+	go func() {
+		tr.prepareWrite(pageRange(1, 1), forEachSlice)
+		mem[1*page] = 0xff
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatalf("write to page 1 completed before it was captured")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	dst := make([]byte, 2*page)
+	if err := tr.capture(pageRange(0, 1), dst, forEachSlice); err != nil {
+		t.Fatalf("capture failed: %v", err)
+	}
+	<-done
+	if dst[1*page] != 1 {
+		t.Errorf("captured page 1 has contents %#x, want 1", dst[1*page])
+	}
+	dst = make([]byte, 2*page)
+	if err := tr.capture(pageRange(2, 3), dst, forEachSlice); err != nil {
+		t.Fatalf("capture failed: %v", err)
+	}
+	if dst[1*page] != 3 {
+		t.Errorf("captured page 3 has contents %#x, want 3", dst[1*page])
+	}
+}
+
+func TestAllocationLimit(t *testing.T) {
+	fd, err := memutil.CreateMemFD("pgalloc_test", 0)
+	if err != nil {
+		t.Fatalf("CreateMemFD failed: %v", err)
+	}
+	f, err := NewMemoryFile(os.NewFile(uintptr(fd), "pgalloc_test"), MemoryFileOpts{
+		DelayedEviction: DelayedEvictionDisabled,
+		AllocationLimit: 4 * page,
+	})
+	if err != nil {
+		t.Fatalf("NewMemoryFile failed: %v", err)
+	}
+	defer f.Destroy()
+
+	opts := AllocOpts{Kind: usage.Anonymous}
+	fr, err := f.Allocate(3*page, opts)
+	if err != nil {
+		t.Fatalf("Allocate(3 pages) failed: %v", err)
+	}
+	if _, err := f.Allocate(2*page, opts); !linuxerr.Equals(linuxerr.ENOMEM, err) {
+		t.Errorf("Allocate(2 pages) over the limit: got %v, want ENOMEM", err)
+	}
+	last, err := f.Allocate(page, opts)
+	if err != nil {
+		t.Fatalf("Allocate(1 page) up to the limit failed: %v", err)
+	}
+
+	// Freed memory no longer counts towards the limit.
+	f.DecRef(fr)
+	f.DecRef(last)
+	fr, err = f.Allocate(4*page, opts)
+	if err != nil {
+		t.Fatalf("Allocate(4 pages) after freeing failed: %v", err)
+	}
+	f.DecRef(fr)
+}
+
+// precopyStore is an in-memory store of pre-copied pages.
+type precopyStore []byte
+
+// WriteAt implements io.WriterAt.WriteAt.
+func (s *precopyStore) WriteAt(b []byte, off int64) (int, error) {
+	if end := int(off) + len(b); end > len(*s) {
+		*s = append(*s, make([]byte, end-len(*s))...)
+	}
+	return copy((*s)[off:], b), nil
+}
+
+// ReadAt implements io.ReaderAt.ReadAt.
+func (s *precopyStore) ReadAt(b []byte, off int64) (int, error) {
+	if off >= int64(len(*s)) {
+		return 0, io.EOF
+	}
+	n := copy(b, (*s)[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func newTestMemoryFile(t *testing.T) *MemoryFile {
+	t.Helper()
+	fd, err := memutil.CreateMemFD("pgalloc_test", 0)
+	if err != nil {
+		t.Fatalf("CreateMemFD failed: %v", err)
+	}
+	f, err := NewMemoryFile(os.NewFile(uintptr(fd), "pgalloc_test"), MemoryFileOpts{
+		DelayedEviction: DelayedEvictionDisabled,
+	})
+	if err != nil {
+		t.Fatalf("NewMemoryFile failed: %v", err)
+	}
+	t.Cleanup(f.Destroy)
+	return f
+}
+
+func TestPrecopy(t *testing.T) {
+	const pages = 4
+	f := newTestMemoryFile(t)
+	fr, err := f.Allocate(pages*page, AllocOpts{Kind: usage.Anonymous})
+	if err != nil {
+		t.Fatalf("Allocate failed: %v", err)
+	}
+	pageRange := func(pg uint64) memmap.FileRange {
+		return memmap.FileRange{fr.Start + pg*page, fr.Start + (pg+1)*page}
+	}
+	fill := func(pg uint64, val byte) {
+		f.PrepareWrite(pageRange(pg))
+		if err := f.forEachMappingSlice(pageRange(pg), func(s []byte) {
+			for i := range s {
+				s[i] = val
+			}
+		}); err != nil {
+			t.Fatalf("writing page %d failed: %v", pg, err)
+		}
+	}
+	// Page 3 is left zero.
+	for pg := uint64(0); pg < 3; pg++ {
+		fill(pg, byte(pg+1))
+	}
+
+	p, err := f.StartPrecopy()
+	if err != nil {
+		t.Fatalf("StartPrecopy failed: %v", err)
+	}
+	if f.WriteProtected(fr) {
+		t.Errorf("pages are protected before the first round")
+	}
+	r, err := p.BeginRound()
+	if err != nil {
+		t.Fatalf("BeginRound failed: %v", err)
+	}
+	if got := r.Pages(); got < 3 {
+		t.Errorf("round has %d pages, want at least 3", got)
+	}
+	if !f.WriteProtected(pageRange(0)) {
+		t.Errorf("copied page 0 is not protected")
+	}
+	var round bytes.Buffer
+	if err := r.WriteTo(&round); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	var store precopyStore
+	if n, err := ReadPrecopyRound(&round, &store); err != nil || n != r.Pages() {
+		t.Fatalf("ReadPrecopyRound got (%d, %v), want (%d, nil)", n, err, r.Pages())
+	}
+
+	// Writes after the round are tracked, and only the written pages are
+	// saved.
+	fill(1, 0xaa)
+	fill(3, 0xbb)
+	if f.WriteProtected(pageRange(1)) {
+		t.Errorf("written page 1 is protected")
+	}
+	if got := p.DirtyPages(); got != 2 {
+		t.Errorf("got %d dirty pages, want 2", got)
+	}
+	var saved bytes.Buffer
+	if err := p.SaveTo(context.Background(), &saved); err != nil {
+		t.Fatalf("SaveTo failed: %v", err)
+	}
+	if f.precopy.Load() != nil {
+		t.Errorf("SaveTo didn't end the Precopy")
+	}
+	if got, max := saved.Len(), 3*page; got >= max {
+		t.Errorf("saved %d bytes, want less than %d", got, max)
+	}
+
+	// Loading fails without the pre-copied pages.
+	if err := newTestMemoryFile(t).LoadFrom(context.Background(), bytes.NewReader(saved.Bytes())); err == nil {
+		t.Errorf("LoadFrom without pre-copied pages succeeded")
+	}
+	f2 := newTestMemoryFile(t)
+	ctx := context.WithValue(context.Background(), CtxPrecopied, &store)
+	if err := f2.LoadFrom(ctx, &saved); err != nil {
+		t.Fatalf("LoadFrom failed: %v", err)
+	}
+	for pg, want := range []byte{1, 0xaa, 3, 0xbb} {
+		if err := f2.forEachMappingSlice(pageRange(uint64(pg)), func(s []byte) {
+			if !bytes.Equal(s, bytes.Repeat([]byte{want}, len(s))) {
+				t.Errorf("loaded page %d has contents %#x..., want %#x", pg, s[:8], want)
+			}
+		}); err != nil {
+			t.Fatalf("reading loaded page %d failed: %v", pg, err)
+		}
+	}
+}
@@ -39,3 +39,39 @@ func mincore(s []byte, buf []byte) error {
 	}
 	return nil
 }
+
+// mbind sets the NUMA memory policy of the memory mapped at [addr, addr+length)
+// to p.
+func mbind(addr, length uintptr, p *NUMAPolicy) error {
+	mask := p.nodemask()
+	var maskPtr unsafe.Pointer
+	if len(mask) != 0 {
+		maskPtr = unsafe.Pointer(&mask[0])
+	}
+	// The kernel ignores the last bit of maxnode.
+	maxnode := uintptr(len(mask)*64 + 1)
+	if _, _, errno := unix.Syscall6(
+		unix.SYS_MBIND,
+		addr,
+		length,
+		uintptr(p.Mode),
+		uintptr(maskPtr),
+		maxnode,
+		0 /* flags */); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// collapse asks the host to back the memory mapped by s with huge pages using
+// madvise(MADV_COLLAPSE).
+func collapse(s []byte) error {
+	if _, _, errno := unix.Syscall(
+		unix.SYS_MADVISE,
+		uintptr(unsafe.Pointer(&s[0])),
+		uintptr(len(s)),
+		unix.MADV_COLLAPSE); errno != 0 {
+		return errno
+	}
+	return nil
+}
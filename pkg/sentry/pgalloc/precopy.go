@@ -0,0 +1,469 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgalloc
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/state"
+	"gvisor.dev/gvisor/pkg/state/wire"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// Precopy tracks the pages of a MemoryFile whose contents have been written
+// out ahead of a save by rounds of the Precopy, so that the save can omit
+// pages that have not been written to since. This allows most of the contents
+// of a MemoryFile to be copied while it remains in use, e.g. to migrate a
+// sandbox to another host with little downtime. Precopies are created by
+// MemoryFile.StartPrecopy.
+type Precopy struct {
+	f *MemoryFile
+
+	mu sync.Mutex
+
+	// copied contains the pages whose contents have been written out by a
+	// round, or are being written out by a round in progress. copied is
+	// protected by mu.
+	copied pageSet
+
+	// dirty contains the pages that have been passed to PrepareWrite since
+	// the last round began. dirty is protected by mu.
+	dirty pageSet
+
+	// prevDirty contains the pages that were in dirty when the last round
+	// began. Since writers call PrepareWrite before writing, writes to these
+	// pages may have still been in progress while the round wrote them out,
+	// so they are written out again by the next round. prevDirty is
+	// protected by mu.
+	prevDirty pageSet
+}
+
+// StartPrecopy begins tracking writes to f for a Precopy, which must later be
+// ended by Precopy.SaveTo or Precopy.Release.
+func (f *MemoryFile) StartPrecopy() (*Precopy, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.precopy.Load() != nil {
+		return nil, fmt.Errorf("MemoryFile is already being pre-copied")
+	}
+	p := &Precopy{f: f}
+	f.precopy.Store(p)
+	return p, nil
+}
+
+// PrecopyRound is a round of a Precopy, created by Precopy.BeginRound.
+type PrecopyRound struct {
+	p *Precopy
+
+	// ranges are the ranges of pages written out by the round, in increasing
+	// order.
+	ranges []memmap.FileRange
+
+	// pages is the number of pages in ranges.
+	pages uint64
+}
+
+// add appends the page at off to r.ranges.
+func (r *PrecopyRound) add(off uint64) {
+	if n := len(r.ranges); n != 0 && r.ranges[n-1].End == off {
+		r.ranges[n-1].End += hostarch.PageSize
+	} else {
+		r.ranges = append(r.ranges, memmap.FileRange{off, off + hostarch.PageSize})
+	}
+	r.pages++
+}
+
+// BeginRound begins a round of p, which writes out the contents of the
+// allocated pages of f that have been written to since they were last written
+// out by a round, or that have not been written out yet. Pages that are not
+// resident are skipped until they are written to, since reading them would
+// commit them; they are saved by Precopy.SaveTo instead.
+//
+// Until p ends, f detects writes to pages that have been written out by
+// rounds, provided that all writes to f are preceded by calls to
+// PrepareWrite. In particular, f must not be mapped writable into any
+// AddressSpace for ranges that WriteProtected reports as protected once
+// BeginRound returns.
+//
+// Preconditions: f's users must be paused.
+func (p *Precopy) BeginRound() (*PrecopyRound, error) {
+	f := p.f
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r := &PrecopyRound{p: p}
+	// Reused mincore buffer, as in updateUsageLocked.
+	var buf []byte
+	for seg := f.usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		if seg.ValuePtr().refs == 0 {
+			continue
+		}
+		off := seg.Start()
+		var checkErr error
+		if err := f.forEachMappingSlice(seg.Range(), func(s []byte) {
+			if checkErr != nil {
+				return
+			}
+			n := len(s) / hostarch.PageSize
+			if len(buf) < n {
+				buf = make([]byte, n)
+			}
+			if checkErr = mincore(s, buf[:n]); checkErr != nil {
+				return
+			}
+			for i := 0; i < n; i++ {
+				if p.dirty.contains(off) || p.prevDirty.contains(off) || (!p.copied.contains(off) && buf[i]&0x1 != 0) {
+					r.add(off)
+				}
+				off += hostarch.PageSize
+			}
+		}); err != nil {
+			return nil, err
+		}
+		if checkErr != nil {
+			return nil, checkErr
+		}
+	}
+
+	// Pages that have been written to and are no longer allocated may be
+	// reallocated without being written to, so their contents must not be
+	// taken from an earlier round.
+	p.copied.removeAll(p.dirty)
+	p.copied.removeAll(p.prevDirty)
+	for _, fr := range r.ranges {
+		for off := fr.Start; off < fr.End; off += hostarch.PageSize {
+			p.copied.add(off)
+		}
+	}
+	p.prevDirty, p.dirty = p.dirty, nil
+	return r, nil
+}
+
+// Pages returns the number of pages written out by r.
+func (r *PrecopyRound) Pages() uint64 {
+	return r.pages
+}
+
+// WriteTo writes the contents of the pages of r to w, in the format read by
+// ReadPrecopyRound. Unlike BeginRound, WriteTo may be called while f is in
+// use.
+func (r *PrecopyRound) WriteTo(w io.Writer) error {
+	var hdr [16]byte
+	buf := make([]byte, saveChunkSize)
+	for _, fr := range r.ranges {
+		for start := fr.Start; start < fr.End; {
+			end := fr.End
+			if end-start > saveChunkSize {
+				end = start + saveChunkSize
+			}
+			b := buf[:end-start]
+			n := 0
+			if err := r.p.f.forEachMappingSlice(memmap.FileRange{start, end}, func(bs []byte) {
+				n += copy(b[n:], bs)
+			}); err != nil {
+				return err
+			}
+			binary.LittleEndian.PutUint64(hdr[:8], start)
+			binary.LittleEndian.PutUint64(hdr[8:], end-start)
+			if _, err := w.Write(hdr[:]); err != nil {
+				return err
+			}
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+			start = end
+		}
+	}
+	// An empty range ends the round.
+	clear(hdr[:])
+	_, err := w.Write(hdr[:])
+	return err
+}
+
+// ReadPrecopyRound reads a round written by PrecopyRound.WriteTo from r, and
+// writes the contents of its pages to w at their offsets in the MemoryFile. It
+// returns the number of pages read.
+func ReadPrecopyRound(r io.Reader, w io.WriterAt) (uint64, error) {
+	var hdr [16]byte
+	var pages uint64
+	buf := make([]byte, saveChunkSize)
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return pages, err
+		}
+		off := binary.LittleEndian.Uint64(hdr[:8])
+		length := binary.LittleEndian.Uint64(hdr[8:])
+		if length == 0 {
+			return pages, nil
+		}
+		if off%hostarch.PageSize != 0 || length%hostarch.PageSize != 0 || length > saveChunkSize || off > math.MaxInt64-length {
+			return pages, fmt.Errorf("invalid pre-copied pages at offset %#x with length %#x", off, length)
+		}
+		b := buf[:length]
+		if _, err := io.ReadFull(r, b); err != nil {
+			return pages, err
+		}
+		if _, err := w.WriteAt(b, int64(off)); err != nil {
+			return pages, err
+		}
+		pages += length / hostarch.PageSize
+	}
+}
+
+// DirtyPages returns the number of pages that have been written to since they
+// were written out by a round of p, which the next round writes out again.
+func (p *Precopy) DirtyPages() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dirty.countUnion(p.prevDirty)
+}
+
+// precopiedLocked returns true if the contents of the page at off are those
+// written out by a round of p.
+//
+// Preconditions: p.mu must be locked.
+func (p *Precopy) precopiedLocked(off uint64) bool {
+	return p.copied.contains(off) && !p.dirty.contains(off) && !p.prevDirty.contains(off)
+}
+
+// SaveTo is equivalent to MemoryFile.SaveTo, except that the contents of pages
+// that have been written out by rounds of p and have not been written to
+// since are omitted. MemoryFile.LoadFrom reads them from the io.ReaderAt
+// given by the CtxPrecopied value of its context instead, to which they must
+// have been written by ReadPrecopyRound. SaveTo ends p.
+//
+// Preconditions: As for MemoryFile.SaveTo.
+func (p *Precopy) SaveTo(ctx context.Context, w wire.Writer) error {
+	defer p.Release()
+
+	f := p.f
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.prepareSaveLocked(checkCommittedNonZero); err != nil {
+		return err
+	}
+	if err := f.saveMetadataLocked(ctx, w); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var hdr [8]byte
+	for seg := f.usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		if !seg.Value().knownCommitted {
+			continue
+		}
+		// Unlike MemoryFile.SaveTo, write an object header, which indicates
+		// to LoadFrom that the segment consists of runs of pages, each of
+		// which is either pre-copied or follows the header of the run.
+		fr := seg.Range()
+		if err := state.WriteHeader(w, fr.Length(), true); err != nil {
+			return err
+		}
+		for start := fr.Start; start < fr.End; {
+			precopied := p.precopiedLocked(start)
+			end := start + hostarch.PageSize
+			for end < fr.End && p.precopiedLocked(end) == precopied {
+				end += hostarch.PageSize
+			}
+			run := ((end - start) / hostarch.PageSize) << 1
+			if precopied {
+				run |= 1
+			}
+			binary.LittleEndian.PutUint64(hdr[:], run)
+			if _, err := w.Write(hdr[:]); err != nil {
+				return err
+			}
+			if !precopied {
+				var ioErr error
+				if err := f.forEachMappingSlice(memmap.FileRange{start, end}, func(s []byte) {
+					if ioErr != nil {
+						return
+					}
+					_, ioErr = w.Write(s)
+				}); err != nil {
+					return err
+				}
+				if ioErr != nil {
+					return ioErr
+				}
+			}
+			start = end
+		}
+	}
+	return nil
+}
+
+// loadPrecopied loads the pages in fr from r, in the format written by
+// Precopy.SaveTo, and from the pre-copied pages in ctx.
+func (f *MemoryFile) loadPrecopied(ctx context.Context, r io.Reader, fr memmap.FileRange) error {
+	src, ok := ctx.Value(CtxPrecopied).(io.ReaderAt)
+	if !ok {
+		return fmt.Errorf("state omits pre-copied pages, but none were provided")
+	}
+	var hdr [8]byte
+	for start := fr.Start; start < fr.End; {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return err
+		}
+		run := binary.LittleEndian.Uint64(hdr[:])
+		pages, precopied := run>>1, run&1 != 0
+		if pages == 0 || pages > (fr.End-start)/hostarch.PageSize {
+			return fmt.Errorf("invalid run of %d pages at offset %#x in segment %v", pages, start, fr)
+		}
+		end := start + pages*hostarch.PageSize
+		off := start
+		var ioErr error
+		if err := f.forEachMappingSlice(memmap.FileRange{start, end}, func(s []byte) {
+			if ioErr != nil {
+				return
+			}
+			if precopied {
+				_, ioErr = src.ReadAt(s, int64(off))
+			} else {
+				_, ioErr = io.ReadFull(r, s)
+			}
+			off += uint64(len(s))
+		}); err != nil {
+			return err
+		}
+		if ioErr != nil {
+			return ioErr
+		}
+		start = end
+	}
+	return nil
+}
+
+// Release ends p, after which f no longer tracks writes for it. Release may
+// be called more than once.
+func (p *Precopy) Release() {
+	f := p.f
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.precopy.Load() == p {
+		f.precopy.Store(nil)
+	}
+}
+
+// prepareWrite marks the pages in fr as written to.
+func (p *Precopy) prepareWrite(fr memmap.FileRange) {
+	start, end := pageRangeOf(fr)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for off := start; off < end; off += hostarch.PageSize {
+		p.dirty.add(off)
+	}
+}
+
+// protected returns true if fr contains pages that have been written out by
+// a round and not written to since.
+func (p *Precopy) protected(fr memmap.FileRange) bool {
+	start, end := pageRangeOf(fr)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.copied.anyInRangeExcept(start/hostarch.PageSize, end/hostarch.PageSize, p.dirty)
+}
+
+// pageRangeOf returns the bounds of the pages containing fr.
+func pageRangeOf(fr memmap.FileRange) (uint64, uint64) {
+	end, ok := hostarch.PageRoundUp(fr.End)
+	if !ok {
+		end = maxPage
+	}
+	return hostarch.PageRoundDown(fr.Start), end
+}
+
+// pageSet is a set of pages of a MemoryFile, represented as a bitmap indexed
+// by page number. It grows as required.
+type pageSet []uint64
+
+// contains returns true if s contains the page at off.
+func (s pageSet) contains(off uint64) bool {
+	pg := off / hostarch.PageSize
+	w := pg / 64
+	return w < uint64(len(s)) && s[w]&(1<<(pg%64)) != 0
+}
+
+// add adds the page at off to s.
+func (s *pageSet) add(off uint64) {
+	pg := off / hostarch.PageSize
+	w := pg / 64
+	if w >= uint64(len(*s)) {
+		*s = append(*s, make([]uint64, w+1-uint64(len(*s)))...)
+	}
+	(*s)[w] |= 1 << (pg % 64)
+}
+
+// removeAll removes the pages in o from s.
+func (s pageSet) removeAll(o pageSet) {
+	for i := range s {
+		if i >= len(o) {
+			return
+		}
+		s[i] &^= o[i]
+	}
+}
+
+// word returns the w-th word of s.
+func (s pageSet) word(w uint64) uint64 {
+	if w < uint64(len(s)) {
+		return s[w]
+	}
+	return 0
+}
+
+// countUnion returns the number of pages in s or o.
+func (s pageSet) countUnion(o pageSet) uint64 {
+	n := len(s)
+	if len(o) > n {
+		n = len(o)
+	}
+	var count uint64
+	for w := uint64(0); w < uint64(n); w++ {
+		count += uint64(bits.OnesCount64(s.word(w) | o.word(w)))
+	}
+	return count
+}
+
+// anyInRangeExcept returns true if s contains any page with a page number in
+// [start, end) that o does not contain.
+func (s pageSet) anyInRangeExcept(start, end uint64, o pageSet) bool {
+	for pg := start; pg < end; {
+		w := pg / 64
+		if w >= uint64(len(s)) {
+			return false
+		}
+		mask := ^uint64(0) << (pg % 64)
+		if next := (w + 1) * 64; end < next {
+			mask &= ^uint64(0) >> (next - end)
+		}
+		if s[w]&^o.word(w)&mask != 0 {
+			return true
+		}
+		pg = (w + 1) * 64
+	}
+	return false
+}
@@ -20,70 +20,32 @@ import (
 	"fmt"
 	"io"
 	"runtime"
+	"sort"
 
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/state"
 	"gvisor.dev/gvisor/pkg/state/wire"
+	"gvisor.dev/gvisor/pkg/sync"
 )
 
 // SaveTo writes f's state to the given stream.
 func (f *MemoryFile) SaveTo(ctx context.Context, w wire.Writer) error {
-	// Wait for reclaim.
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	for f.reclaimable {
-		f.reclaimCond.Signal()
-		f.mu.Unlock()
-		runtime.Gosched()
-		f.mu.Lock()
-	}
-
-	// Ensure that there are no pending evictions.
-	if len(f.evictable) != 0 {
-		panic(fmt.Sprintf("evictions still pending for %d users; call StartEvictions and WaitForEvictions before SaveTo", len(f.evictable)))
-	}
 
 	// Ensure that all pages that contain data have knownCommitted set, since
 	// we only store knownCommitted pages below.
-	zeroPage := make([]byte, hostarch.PageSize)
-	err := f.updateUsageLocked(0, nil, func(bs []byte, committed []byte) error {
-		for pgoff := 0; pgoff < len(bs); pgoff += hostarch.PageSize {
-			i := pgoff / hostarch.PageSize
-			pg := bs[pgoff : pgoff+hostarch.PageSize]
-			if !bytes.Equal(pg, zeroPage) {
-				committed[i] = 1
-				continue
-			}
-			committed[i] = 0
-			// Reading the page caused it to be committed; decommit it to
-			// reduce memory usage.
-			//
-			// "MADV_REMOVE [...] Free up a given range of pages and its
-			// associated backing store. This is equivalent to punching a hole
-			// in the corresponding byte range of the backing store (see
-			// fallocate(2))." - madvise(2)
-			if err := unix.Madvise(pg, unix.MADV_REMOVE); err != nil {
-				// This doesn't impact the correctness of saved memory, it
-				// just means that we're incrementally more likely to OOM.
-				// Complain, but don't abort saving.
-				log.Warningf("Decommitting page %p while saving failed: %v", pg, err)
-			}
-		}
-		return nil
-	})
-	if err != nil {
+	if err := f.prepareSaveLocked(checkCommittedNonZero); err != nil {
 		return err
 	}
 
 	// Save metadata.
-	if _, err := state.Save(ctx, w, &f.fileSize); err != nil {
-		return err
-	}
-	if _, err := state.Save(ctx, w, &f.usage); err != nil {
+	if err := f.saveMetadataLocked(ctx, w); err != nil {
 		return err
 	}
 
@@ -115,6 +77,388 @@ func (f *MemoryFile) SaveTo(ctx context.Context, w wire.Writer) error {
 	return nil
 }
 
+// saveMetadataLocked writes f's metadata to w.
+//
+// Preconditions: f.mu must be locked.
+// +checklocks:f.mu
+func (f *MemoryFile) saveMetadataLocked(ctx context.Context, w wire.Writer) error {
+	if _, err := state.Save(ctx, w, &f.fileSize); err != nil {
+		return err
+	}
+	if _, err := state.Save(ctx, w, &f.usage); err != nil {
+		return err
+	}
+	_, err := state.Save(ctx, w, &f.chunks)
+	return err
+}
+
+// prepareSaveLocked waits for reclaim, checks that no evictions are pending,
+// and ensures that all pages that checkCommitted reports as committed have
+// knownCommitted set.
+//
+// Preconditions: f.mu must be locked; it may be unlocked and reacquired.
+// +checklocks:f.mu
+func (f *MemoryFile) prepareSaveLocked(checkCommitted func(bs []byte, committed []byte) error) error {
+	if f.saving.Load() != nil {
+		return fmt.Errorf("MemoryFile is already being saved")
+	}
+
+	// Wait for reclaim.
+	for f.reclaimable {
+		f.reclaimCond.Signal()
+		f.mu.Unlock() // +checklocksforce
+		runtime.Gosched()
+		f.mu.Lock()
+	}
+
+	// Ensure that there are no pending evictions.
+	if len(f.evictable) != 0 {
+		panic(fmt.Sprintf("evictions still pending for %d users; call StartEvictions and WaitForEvictions before SaveTo", len(f.evictable)))
+	}
+
+	return f.updateUsageLocked(0, nil, checkCommitted)
+}
+
+// checkCommittedNonZero is a checkCommitted function for updateUsageLocked
+// that considers a page committed if it contains non-zero bytes, and
+// decommits pages that are zero.
+func checkCommittedNonZero(bs []byte, committed []byte) error {
+	zeroPage := make([]byte, hostarch.PageSize)
+	for pgoff := 0; pgoff < len(bs); pgoff += hostarch.PageSize {
+		i := pgoff / hostarch.PageSize
+		pg := bs[pgoff : pgoff+hostarch.PageSize]
+		if !bytes.Equal(pg, zeroPage) {
+			committed[i] = 1
+			continue
+		}
+		committed[i] = 0
+		// Reading the page caused it to be committed; decommit it to
+		// reduce memory usage.
+		//
+		// "MADV_REMOVE [...] Free up a given range of pages and its
+		// associated backing store. This is equivalent to punching a hole
+		// in the corresponding byte range of the backing store (see
+		// fallocate(2))." - madvise(2)
+		if err := unix.Madvise(pg, unix.MADV_REMOVE); err != nil {
+			// This doesn't impact the correctness of saved memory, it
+			// just means that we're incrementally more likely to OOM.
+			// Complain, but don't abort saving.
+			log.Warningf("Decommitting page %p while saving failed: %v", pg, err)
+		}
+	}
+	return nil
+}
+
+// AsyncSave is a save of a MemoryFile whose page contents are written out
+// while the MemoryFile remains in use. AsyncSaves are created by
+// MemoryFile.StartAsyncSave.
+type AsyncSave struct {
+	f *MemoryFile
+
+	// meta is f's serialized metadata at the time the save was started.
+	meta bytes.Buffer
+
+	// t tracks the pages that have not yet been written out.
+	t *saveTracker
+}
+
+// StartAsyncSave begins saving f's state, returning an AsyncSave that must
+// later be written out by AsyncSave.WriteTo or abandoned by
+// AsyncSave.Release.
+//
+// f's metadata and the set of pages to save are captured before
+// StartAsyncSave returns, so it should be called while f's users are paused;
+// page contents are only copied by AsyncSave.WriteTo. In the meantime, f
+// preserves the contents that saved pages had when StartAsyncSave was called,
+// provided that all writes to f are preceded by calls to PrepareWrite. In
+// particular, f must not be mapped writable into any AddressSpace when
+// StartAsyncSave is called, and must not be mapped writable into any
+// AddressSpace for ranges that WriteProtected reports as protected.
+//
+// As in SaveTo, the pages to save are determined by scanning their contents,
+// since pages that are not resident, e.g. because they have been swapped
+// out, may still contain data.
+//
+// Preconditions: As for SaveTo.
+func (f *MemoryFile) StartAsyncSave(ctx context.Context) (*AsyncSave, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.prepareSaveLocked(checkCommittedNonZero); err != nil {
+		return nil, err
+	}
+
+	s := &AsyncSave{f: f}
+	if err := f.saveMetadataLocked(ctx, &s.meta); err != nil {
+		return nil, err
+	}
+	var ranges []memmap.FileRange
+	for seg := f.usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		if seg.Value().knownCommitted {
+			ranges = append(ranges, seg.Range())
+		}
+	}
+	s.t = newSaveTracker(ranges)
+	f.saving.Store(s.t)
+	return s, nil
+}
+
+// WriteTo writes the state of the MemoryFile at the time StartAsyncSave was
+// called to w, in the format written by MemoryFile.SaveTo, and then releases
+// s.
+func (s *AsyncSave) WriteTo(w wire.Writer) error {
+	defer s.Release()
+
+	if _, err := w.Write(s.meta.Bytes()); err != nil {
+		return err
+	}
+	buf := make([]byte, saveChunkSize)
+	for _, fr := range s.t.ranges {
+		// Write a header to distinguish from objects.
+		if err := state.WriteHeader(w, fr.Length(), false); err != nil {
+			return err
+		}
+		for start := fr.Start; start < fr.End; {
+			end := fr.End
+			if end-start > saveChunkSize {
+				end = start + saveChunkSize
+			}
+			b := buf[:end-start]
+			if err := s.t.capture(memmap.FileRange{start, end}, b, s.f.forEachMappingSlice); err != nil {
+				return err
+			}
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+			start = end
+		}
+	}
+	return nil
+}
+
+// Release ends s, after which the MemoryFile no longer preserves the contents
+// of pages that have not been written out by s.WriteTo. Release may be called
+// more than once.
+func (s *AsyncSave) Release() {
+	// Stop tracking pages before locking f.mu, since writers waiting for
+	// pages to be written out may hold it.
+	s.t.release()
+
+	f := s.f
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.saving.Load() != s.t {
+		return
+	}
+	f.saving.Store(nil)
+	// Resume reclaim.
+	f.reclaimCond.Signal()
+}
+
+// PrepareWrite must be called before writing to pages in fr by any means
+// other than mappings returned by MapInternal with at.Write set. While an
+// AsyncSave of f is in progress, it preserves the contents of pages in fr
+// that have not yet been written out. If the AsyncSave has already preserved
+// maxSaveCopies pages, PrepareWrite instead blocks until the pages in fr have
+// been written out, as if the save were not asynchronous. While a Precopy of
+// f is in progress, it marks the pages in fr as written to. Otherwise, it has
+// no effect.
+func (f *MemoryFile) PrepareWrite(fr memmap.FileRange) {
+	if t := f.saving.Load(); t != nil {
+		t.prepareWrite(fr, f.forEachMappingSlice)
+	}
+	if p := f.precopy.Load(); p != nil {
+		p.prepareWrite(fr)
+	}
+}
+
+// WriteProtected returns true if writes to fr must be preceded by a call to
+// PrepareWrite, such that fr must not be mapped writable into an
+// AddressSpace.
+func (f *MemoryFile) WriteProtected(fr memmap.FileRange) bool {
+	if t := f.saving.Load(); t != nil && t.protected(fr) {
+		return true
+	}
+	if p := f.precopy.Load(); p != nil {
+		return p.protected(fr)
+	}
+	return false
+}
+
+// saveChunkSize is the size of the pieces in which AsyncSave.WriteTo copies
+// out page contents. Writers to pages being copied are blocked until the copy
+// is complete.
+const saveChunkSize = 256 * hostarch.PageSize
+
+// maxSaveCopies is the maximum number of pages whose contents an AsyncSave
+// preserves in memory at any time, bounding the memory used by an AsyncSave
+// of a MemoryFile that is written to faster than it is written out.
+const maxSaveCopies = (256 << 20) / hostarch.PageSize
+
+// saveTracker tracks the pages of a MemoryFile whose contents have not yet
+// been written out by an AsyncSave, and preserves the contents of such pages
+// when they are written to.
+type saveTracker struct {
+	mu sync.Mutex
+
+	// ranges are the ranges of pages being saved, in increasing order. ranges
+	// is immutable.
+	ranges []memmap.FileRange
+
+	// next is the offset of the first page whose contents have not been
+	// captured by AsyncSave.WriteTo. Pages in ranges before next are no
+	// longer tracked. next is protected by mu.
+	next uint64
+
+	// copies maps the offsets of tracked pages that have been written to
+	// since the save began to their contents when it began. copies is
+	// protected by mu.
+	copies map[uint64][]byte
+
+	// maxCopies is the maximum length of copies. It is initially
+	// maxSaveCopies, and is immutable.
+	maxCopies int
+
+	// cond is broadcast when next advances, and when tracking stops. It is
+	// used by writers that must wait for pages to be written out because
+	// copies contains maxCopies pages.
+	cond sync.Cond
+
+	// err is the first error encountered while preserving page contents, if
+	// any. If err is not nil, saved page contents may be inconsistent, so
+	// the save must fail. err is protected by mu.
+	err error
+}
+
+func newSaveTracker(ranges []memmap.FileRange) *saveTracker {
+	t := &saveTracker{
+		ranges:    ranges,
+		copies:    make(map[uint64][]byte),
+		maxCopies: maxSaveCopies,
+	}
+	t.cond.L = &t.mu
+	return t
+}
+
+// forEachPendingPageLocked invokes fn on the offset of each tracked page in fr
+// whose contents have not been preserved, in increasing order, until fn
+// returns false.
+//
+// Preconditions: t.mu must be locked.
+func (t *saveTracker) forEachPendingPageLocked(fr memmap.FileRange, fn func(off uint64) bool) {
+	start := hostarch.PageRoundDown(fr.Start)
+	if start < t.next {
+		start = t.next
+	}
+	end, ok := hostarch.PageRoundUp(fr.End)
+	if !ok {
+		end = maxPage
+	}
+	if start >= end {
+		return
+	}
+	fr = memmap.FileRange{start, end}
+	i := sort.Search(len(t.ranges), func(i int) bool {
+		return t.ranges[i].End > fr.Start
+	})
+	for ; i < len(t.ranges) && t.ranges[i].Start < fr.End; i++ {
+		r := t.ranges[i].Intersect(fr)
+		for off := r.Start; off < r.End; off += hostarch.PageSize {
+			if _, ok := t.copies[off]; ok {
+				continue
+			}
+			if !fn(off) {
+				return
+			}
+		}
+	}
+}
+
+// prepareWrite preserves the contents of tracked pages in fr, which are
+// accessed using forEachSlice. If t already preserves t.maxCopies pages,
+// prepareWrite waits for the remaining tracked pages in fr to be written out
+// instead.
+func (t *saveTracker) prepareWrite(fr memmap.FileRange, forEachSlice func(memmap.FileRange, func([]byte)) error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for {
+		full := false
+		t.forEachPendingPageLocked(fr, func(off uint64) bool {
+			if len(t.copies) >= t.maxCopies {
+				full = true
+				return false
+			}
+			pg := make([]byte, hostarch.PageSize)
+			if err := forEachSlice(memmap.FileRange{off, off + hostarch.PageSize}, func(bs []byte) {
+				copy(pg, bs)
+			}); err != nil {
+				if t.err == nil {
+					t.err = fmt.Errorf("failed to preserve page at offset %#x: %w", off, err)
+				}
+				return false
+			}
+			t.copies[off] = pg
+			return true
+		})
+		if !full {
+			return
+		}
+		t.cond.Wait()
+	}
+}
+
+// protected returns true if fr contains tracked pages whose contents have
+// not been preserved.
+func (t *saveTracker) protected(fr memmap.FileRange) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pending := false
+	t.forEachPendingPageLocked(fr, func(uint64) bool {
+		pending = true
+		return false
+	})
+	return pending
+}
+
+// capture copies the contents of the tracked pages in fr at the time the save
+// began into dst, and stops tracking all pages before fr.End.
+//
+// Preconditions:
+//   - fr is page-aligned and contained in one of t.ranges.
+//   - fr.Start >= t.next.
+//   - len(dst) == fr.Length().
+func (t *saveTracker) capture(fr memmap.FileRange, dst []byte, forEachSlice func(memmap.FileRange, func([]byte)) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return t.err
+	}
+	n := 0
+	if err := forEachSlice(fr, func(bs []byte) {
+		n += copy(dst[n:], bs)
+	}); err != nil {
+		return err
+	}
+	for off := fr.Start; off < fr.End; off += hostarch.PageSize {
+		if pg, ok := t.copies[off]; ok {
+			copy(dst[off-fr.Start:], pg)
+			delete(t.copies, off)
+		}
+	}
+	t.next = fr.End
+	t.cond.Broadcast()
+	return nil
+}
+
+// release stops tracking all pages.
+func (t *saveTracker) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.next = maxPage
+	t.copies = nil
+	t.cond.Broadcast()
+}
+
 // LoadFrom loads MemoryFile state from the given stream.
 func (f *MemoryFile) LoadFrom(ctx context.Context, r wire.Reader) error {
 	// Load metadata.
@@ -129,6 +473,19 @@ func (f *MemoryFile) LoadFrom(ctx context.Context, r wire.Reader) error {
 	if _, err := state.Load(ctx, r, &f.usage); err != nil {
 		return err
 	}
+	if _, err := state.Load(ctx, r, &f.chunks); err != nil {
+		return err
+	}
+	if len(f.chunks) != len(newMappings) {
+		return fmt.Errorf("mismatched chunks: expected %d, got %d", len(newMappings), len(f.chunks))
+	}
+	f.restoreChunks()
+	f.allocatedBytes = 0
+	for seg := f.usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		if seg.Value().refs != 0 {
+			f.allocatedBytes += seg.Range().Length()
+		}
+	}
 
 	// Try to map committed chunks concurrently: For any given chunk, either
 	// this loop or the following one will mmap the chunk first and cache it in
@@ -163,27 +520,30 @@ func (f *MemoryFile) LoadFrom(ctx context.Context, r wire.Reader) error {
 		if err != nil {
 			return err
 		}
-		if object {
-			// Not expected.
-			return fmt.Errorf("unexpected object")
-		}
 		if expected := uint64(seg.Range().Length()); length != expected {
 			// Size mismatch.
 			return fmt.Errorf("mismatched segment: expected %d, got %d", expected, length)
 		}
-		// Read data.
-		var ioErr error
-		err = f.forEachMappingSlice(seg.Range(), func(s []byte) {
+		if object {
+			// Written by Precopy.SaveTo.
+			if err := f.loadPrecopied(ctx, r, seg.Range()); err != nil {
+				return err
+			}
+		} else {
+			// Read data.
+			var ioErr error
+			err = f.forEachMappingSlice(seg.Range(), func(s []byte) {
+				if ioErr != nil {
+					return
+				}
+				_, ioErr = io.ReadFull(r, s)
+			})
 			if ioErr != nil {
-				return
+				return ioErr
+			}
+			if err != nil {
+				return err
 			}
-			_, ioErr = io.ReadFull(r, s)
-		})
-		if ioErr != nil {
-			return ioErr
-		}
-		if err != nil {
-			return err
 		}
 
 		// Update accounting for restored pages. We need to do this here since
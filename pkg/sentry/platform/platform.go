@@ -20,6 +20,7 @@ package platform
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -192,6 +193,39 @@ func (DoesNotOwnPageTables) OwnsPageTables() bool {
 	return false
 }
 
+// ContextQueueState is a snapshot of a queue of contexts waiting for the
+// platform to run them, e.g. on a vCPU or a stub thread.
+type ContextQueueState struct {
+	// Name identifies the queue.
+	Name string
+
+	// Queued is the number of contexts waiting in the queue.
+	Queued int
+
+	// Dequeued counts the contexts taken off the queue. It may wrap around.
+	Dequeued uint64
+}
+
+// ContextQueueReporter is implemented by platforms that queue contexts
+// waiting to run, so that stalled vCPUs or stub threads can be detected.
+type ContextQueueReporter interface {
+	// ContextQueues returns the state of the platform's context queues.
+	ContextQueues() []ContextQueueState
+}
+
+// SwitchCostReporter is implemented by Contexts that can tell how much of a
+// call to Context.Switch was spent in the platform rather than executing
+// application code. The Sentry accounts this time as system time of the task;
+// for Contexts that don't implement it, all of Switch is user time.
+type SwitchCostReporter interface {
+	// SwitchOverhead returns the wall time that the last call to Switch spent
+	// outside of application code, e.g. waiting for a stub thread to pick up
+	// the context or handling a fault on the application's behalf.
+	//
+	// Preconditions: The caller must be the goroutine that called Switch.
+	SwitchOverhead() time.Duration
+}
+
 // MemoryManager represents an abstraction above the platform address space
 // which manages memory mappings and their contents.
 type MemoryManager interface {
@@ -94,6 +94,12 @@ func (q *contextQueue) queuedContexts() uint32 {
 	return (atomic.LoadUint32(&q.end) + maxContextQueueEntries - atomic.LoadUint32(&q.start)) % maxContextQueueEntries
 }
 
+// dequeued returns the number of contexts taken off the queue by stub
+// threads, modulo 2^32.
+func (q *contextQueue) dequeued() uint32 {
+	return atomic.LoadUint32(&q.start)
+}
+
 // add puts the the given ctx onto the context queue, and records a state of
 // the subprocess after insertion to see if there are more active stub threads
 // or more waiting contexts.
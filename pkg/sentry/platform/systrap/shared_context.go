@@ -213,6 +213,18 @@ func (sc *sharedContext) getStateChangedTimeDiff() cpuTicks {
 	return cpuTicks(now - changedAt)
 }
 
+// getAppTimeDiff returns the time the stub thread spent on this context
+// between acknowledging it and giving it back to the sentry, i.e. the time it
+// spent running application code.
+func (sc *sharedContext) getAppTimeDiff() cpuTicks {
+	ackedAt := atomic.LoadUint64(&sc.shared.AckedTime)
+	changedAt := atomic.LoadUint64(&sc.shared.StateChangedTime)
+	if ackedAt == ackReset || changedAt == stateChangedReset || changedAt < ackedAt {
+		return 0
+	}
+	return cpuTicks(changedAt - ackedAt)
+}
+
 func (sc *sharedContext) resetLatencyMeasures() {
 	atomic.StoreUint64(&sc.shared.AckedTime, ackReset)
 	atomic.StoreUint64(&sc.shared.StateChangedTime, stateChangedReset)
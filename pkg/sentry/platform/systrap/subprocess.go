@@ -332,6 +332,7 @@ func newSubprocess(create func() (*thread, error), memoryFile *pgalloc.MemoryFil
 		return nil, err
 	}
 	sp.numSysmsgThreads++
+	globalPool.markCreated(sp)
 
 	return sp, nil
 }
@@ -746,7 +747,7 @@ func (s *subprocess) switchToApp(c *context, ac *arch.Context64) (isSyscall bool
 	}
 	ctx.setState(sysmsg.ContextStateNone)
 	s.contextQueue.add(ctx)
-	s.waitOnState(ctx)
+	c.appTicks += s.waitOnState(ctx)
 
 	// Check if there's been an error.
 	threadID := ctx.threadID()
@@ -785,7 +786,9 @@ func (s *subprocess) switchToApp(c *context, ac *arch.Context64) (isSyscall bool
 	return false, false, nil
 }
 
-func (s *subprocess) waitOnState(ctx *sharedContext) {
+// waitOnState waits for a stub thread to run ctx and returns the time the stub
+// thread spent running application code.
+func (s *subprocess) waitOnState(ctx *sharedContext) cpuTicks {
 	ctx.kicked = false
 	slowPath := false
 	if !s.contextQueue.fastPathEnabled() || atomic.LoadUint32(&s.contextQueue.numActiveThreads) == 0 {
@@ -823,8 +826,10 @@ func (s *subprocess) waitOnState(ctx *sharedContext) {
 	}
 
 	ctx.recordLatency()
+	appTicks := ctx.getAppTimeDiff()
 	ctx.resetLatencyMeasures()
 	ctx.enableSentryFastPath()
+	return appTicks
 }
 
 // canKickSysmsgThread returns true if a new thread can be kicked.
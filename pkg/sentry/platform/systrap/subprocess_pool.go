@@ -34,6 +34,24 @@ type subprocessPool struct {
 	// available stores all subprocesses that are available for reuse.
 	// +checklocks:mu
 	available []*subprocess
+	// all stores all subprocesses ever created, whether they are in use or
+	// available for reuse.
+	// +checklocks:mu
+	all []*subprocess
+}
+
+func (p *subprocessPool) markCreated(s *subprocess) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.all = append(p.all, s)
+}
+
+func (p *subprocessPool) allSubprocesses() []*subprocess {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]*subprocess(nil), p.all...)
 }
 
 func (p *subprocessPool) markAvailable(s *subprocess) {
@@ -52,6 +52,7 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	pkgcontext "gvisor.dev/gvisor/pkg/context"
@@ -147,6 +148,14 @@ type context struct {
 	// needToPullFullState indicates that the Sentry doesn't have a full
 	// state of the thread.
 	needToPullFullState bool
+
+	// appTicks is the time stub threads spent running application code
+	// during the current call to Switch.
+	appTicks cpuTicks
+
+	// switchOverhead is the time the last call to Switch spent outside of
+	// application code.
+	switchOverhead time.Duration
 }
 
 // PullFullState implements platform.Context.PullFullState.
@@ -172,6 +181,8 @@ func (c *context) FullStateChanged() {
 func (c *context) Switch(ctx pkgcontext.Context, mm platform.MemoryManager, ac *arch.Context64, cpu int32) (*linux.SignalInfo, hostarch.AccessType, error) {
 	as := mm.AddressSpace()
 	s := as.(*subprocess)
+	c.appTicks = 0
+	defer c.updateSwitchOverhead(cputicks(), time.Now())
 	if err := s.activateContext(c); err != nil {
 		return nil, hostarch.NoAccess, err
 	}
@@ -271,6 +282,28 @@ restart:
 	return &si, at, platform.ErrContextSignal
 }
 
+// updateSwitchOverhead sets c.switchOverhead for a call to Switch that started
+// at startTicks and startTime.
+//
+// c.appTicks and the cputicks timestamps are only used to find the fraction of
+// the call spent outside of application code, which is then applied to the
+// wall time of the call, so that no TSC frequency has to be known.
+func (c *context) updateSwitchOverhead(startTicks int64, startTime time.Time) {
+	wall := time.Since(startTime)
+	total := cputicks() - startTicks
+	app := int64(c.appTicks)
+	if total <= 0 || app >= total {
+		c.switchOverhead = 0
+		return
+	}
+	c.switchOverhead = time.Duration(float64(wall) * float64(total-app) / float64(total))
+}
+
+// SwitchOverhead implements platform.SwitchCostReporter.SwitchOverhead.
+func (c *context) SwitchOverhead() time.Duration {
+	return c.switchOverhead
+}
+
 // Interrupt interrupts the running guest application associated with this context.
 func (c *context) Interrupt() {
 	c.interrupt.NotifyInterrupt()
@@ -377,6 +410,25 @@ func (p *Systrap) NewAddressSpace(any) (platform.AddressSpace, <-chan struct{},
 	return as, nil, err
 }
 
+// ContextQueues implements platform.ContextQueueReporter.ContextQueues.
+//
+// Each subprocess has a queue of contexts waiting for one of its stub threads
+// to run them. Since the queues are shared with stub threads, the returned
+// values are only suitable for diagnostics.
+func (*Systrap) ContextQueues() []platform.ContextQueueState {
+	subprocesses := globalPool.allSubprocesses()
+	states := make([]platform.ContextQueueState, 0, len(subprocesses))
+	for i, s := range subprocesses {
+		q := s.contextQueue
+		states = append(states, platform.ContextQueueState{
+			Name:     fmt.Sprintf("subprocess %d", i),
+			Queued:   int(q.queuedContexts()),
+			Dequeued: uint64(q.dequeued()),
+		})
+	}
+	return states
+}
+
 // NewContext returns an interruptible context.
 func (*Systrap) NewContext(ctx pkgcontext.Context) platform.Context {
 	return &context{
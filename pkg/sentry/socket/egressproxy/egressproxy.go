@@ -0,0 +1,391 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package egressproxy tunnels outbound TCP connections through a SOCKS5 or
+// HTTP CONNECT proxy.
+//
+// The sentry uses it to transparently redirect connect(2) on netstack TCP
+// sockets: the socket is connected to the proxy instead, the proxy handshake
+// is performed on the application's behalf, and the socket is then handed
+// back to the application as if it were connected to the original
+// destination.
+package egressproxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// Kind is the proxy protocol.
+type Kind int
+
+const (
+	// SOCKS5 is a SOCKS version 5 proxy, see RFC 1928.
+	SOCKS5 Kind = iota
+
+	// HTTPConnect is an HTTP proxy supporting the CONNECT method, see RFC
+	// 9110 section 9.3.6.
+	HTTPConnect
+)
+
+// maxResponseHeader is the maximum size of an HTTP CONNECT response header.
+const maxResponseHeader = 16 << 10
+
+// subnet is a range of destination addresses that is not proxied.
+//
+// +stateify savable
+type subnet struct {
+	addr   tcpip.Address
+	prefix int
+}
+
+// contains returns true if a is in s.
+func (s *subnet) contains(a tcpip.Address) bool {
+	if a.Len() != s.addr.Len() {
+		return false
+	}
+	sb, ab := s.addr.AsSlice(), a.AsSlice()
+	bits := s.prefix
+	for i := 0; bits > 0; i++ {
+		mask := byte(0xff)
+		if bits < 8 {
+			mask <<= 8 - bits
+		}
+		if sb[i]&mask != ab[i]&mask {
+			return false
+		}
+		bits -= 8
+	}
+	return true
+}
+
+// Config is an egress proxy configuration.
+//
+// +stateify savable
+type Config struct {
+	kind     Kind
+	addr     tcpip.FullAddress
+	username string
+	password string
+	bypass   []subnet
+}
+
+// Parse parses a proxy URL of the form "socks5://ip:port" or
+// "http://ip:port". The proxy host must be an IP address, since it is
+// resolved before name resolution is available. bypass is a list of CIDR
+// ranges whose destinations are connected to directly.
+//
+// The URL must not contain credentials, since it ends up in command lines and
+// logs. Use SetCredentials instead.
+func Parse(proxyURL string, bypass []string) (*Config, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		// The error quotes the URL, which may contain credentials.
+		return nil, fmt.Errorf("invalid proxy URL")
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("proxy URL must not contain credentials")
+	}
+	c := &Config{}
+	switch u.Scheme {
+	case "socks5":
+		c.kind = SOCKS5
+	case "http":
+		c.kind = HTTPConnect
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, must be socks5 or http", u.Scheme)
+	}
+
+	ip := net.ParseIP(u.Hostname())
+	if ip == nil {
+		return nil, fmt.Errorf("proxy host %q must be an IP address", u.Hostname())
+	}
+	port, err := strconv.ParseUint(u.Port(), 10, 16)
+	if err != nil || port == 0 {
+		return nil, fmt.Errorf("invalid proxy port %q", u.Port())
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	c.addr = tcpip.FullAddress{
+		Addr: tcpip.AddrFromSlice(ip),
+		Port: uint16(port),
+	}
+
+	for _, b := range bypass {
+		_, n, err := net.ParseCIDR(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bypass range %q: %w", b, err)
+		}
+		ip := n.IP
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		prefix, _ := n.Mask.Size()
+		c.bypass = append(c.bypass, subnet{addr: tcpip.AddrFromSlice(ip), prefix: prefix})
+	}
+	return c, nil
+}
+
+// SetCredentials sets the credentials used to authenticate to the proxy.
+// creds is of the form "user:pass", optionally followed by a newline.
+func (c *Config) SetCredentials(creds string) error {
+	creds = strings.TrimSuffix(strings.TrimSuffix(creds, "\n"), "\r")
+	username, password, ok := strings.Cut(creds, ":")
+	if !ok || username == "" {
+		return fmt.Errorf("proxy credentials must be of the form user:pass")
+	}
+	if c.kind == SOCKS5 && (len(username) > 255 || len(password) > 255) {
+		return fmt.Errorf("SOCKS5 username and password must be at most 255 bytes")
+	}
+	c.username = username
+	c.password = password
+	return nil
+}
+
+// Kind returns the proxy protocol.
+func (c *Config) Kind() Kind {
+	return c.kind
+}
+
+// Addr returns the address of the proxy.
+func (c *Config) Addr() tcpip.FullAddress {
+	return c.addr
+}
+
+// ShouldProxy returns true if connections to dst should go through the proxy.
+// Loopback destinations, the proxy itself and bypass ranges are connected to
+// directly.
+func (c *Config) ShouldProxy(dst tcpip.FullAddress) bool {
+	if dst.Addr.Unspecified() || dst.Addr == c.addr.Addr {
+		return false
+	}
+	ip := net.IP(dst.Addr.AsSlice())
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsMulticast() {
+		return false
+	}
+	// IPv4-mapped IPv6 destinations are matched against IPv4 ranges.
+	addr := dst.Addr
+	if ip4 := ip.To4(); ip4 != nil {
+		addr = tcpip.AddrFromSlice(ip4)
+	}
+	for i := range c.bypass {
+		if c.bypass[i].contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Handshake asks the proxy on the other end of rw to connect to dst. On
+// success, rw carries the tunneled connection. Errors reported by the proxy
+// are translated to the errno connect(2) would have returned for a direct
+// connection.
+//
+// Handshake never reads past the end of the proxy's response, so that no
+// data sent by the destination is lost.
+func (c *Config) Handshake(rw io.ReadWriter, dst tcpip.FullAddress) error {
+	switch c.kind {
+	case SOCKS5:
+		return c.socks5Handshake(rw, dst)
+	case HTTPConnect:
+		return c.httpConnectHandshake(rw, dst)
+	default:
+		panic(fmt.Sprintf("unknown proxy kind %d", c.kind))
+	}
+}
+
+// SOCKS5 constants, from RFC 1928 and RFC 1929.
+const (
+	socksVersion          = 5
+	socksAuthNone         = 0
+	socksAuthUserPass     = 2
+	socksAuthNoAcceptable = 0xff
+	socksUserPassVersion  = 1
+	socksCmdConnect       = 1
+	socksAtypIPv4         = 1
+	socksAtypDomain       = 3
+	socksAtypIPv6         = 4
+)
+
+func (c *Config) socks5Handshake(rw io.ReadWriter, dst tcpip.FullAddress) error {
+	// Method negotiation.
+	methods := []byte{socksVersion, 1, socksAuthNone}
+	if c.username != "" {
+		methods = []byte{socksVersion, 2, socksAuthNone, socksAuthUserPass}
+	}
+	if _, err := rw.Write(methods); err != nil {
+		return err
+	}
+	var resp [2]byte
+	if _, err := io.ReadFull(rw, resp[:]); err != nil {
+		return proxyReadError(err)
+	}
+	if resp[0] != socksVersion {
+		return linuxerr.ECONNREFUSED
+	}
+	switch resp[1] {
+	case socksAuthNone:
+	case socksAuthUserPass:
+		if c.username == "" {
+			return linuxerr.ECONNREFUSED
+		}
+		var auth bytes.Buffer
+		auth.WriteByte(socksUserPassVersion)
+		auth.WriteByte(byte(len(c.username)))
+		auth.WriteString(c.username)
+		auth.WriteByte(byte(len(c.password)))
+		auth.WriteString(c.password)
+		if _, err := rw.Write(auth.Bytes()); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(rw, resp[:]); err != nil {
+			return proxyReadError(err)
+		}
+		if resp[1] != 0 {
+			return linuxerr.EACCES
+		}
+	default:
+		return linuxerr.ECONNREFUSED
+	}
+
+	// Connect request.
+	var req bytes.Buffer
+	req.Write([]byte{socksVersion, socksCmdConnect, 0})
+	if ip := net.IP(dst.Addr.AsSlice()).To4(); ip != nil {
+		req.WriteByte(socksAtypIPv4)
+		req.Write(ip)
+	} else {
+		req.WriteByte(socksAtypIPv6)
+		req.Write(dst.Addr.AsSlice())
+	}
+	binary.Write(&req, binary.BigEndian, dst.Port)
+	if _, err := rw.Write(req.Bytes()); err != nil {
+		return err
+	}
+
+	// Reply: VER, REP, RSV, ATYP, BND.ADDR, BND.PORT.
+	var hdr [4]byte
+	if _, err := io.ReadFull(rw, hdr[:]); err != nil {
+		return proxyReadError(err)
+	}
+	if hdr[0] != socksVersion {
+		return linuxerr.ECONNREFUSED
+	}
+	var addrLen int
+	switch hdr[3] {
+	case socksAtypIPv4:
+		addrLen = 4
+	case socksAtypIPv6:
+		addrLen = 16
+	case socksAtypDomain:
+		var l [1]byte
+		if _, err := io.ReadFull(rw, l[:]); err != nil {
+			return proxyReadError(err)
+		}
+		addrLen = int(l[0])
+	default:
+		return linuxerr.ECONNREFUSED
+	}
+	bound := make([]byte, addrLen+2)
+	if _, err := io.ReadFull(rw, bound); err != nil {
+		return proxyReadError(err)
+	}
+	return socksReplyError(hdr[1])
+}
+
+// socksReplyError maps a SOCKS5 reply code to an errno.
+func socksReplyError(rep byte) error {
+	switch rep {
+	case 0:
+		return nil
+	case 2: // Connection not allowed by ruleset.
+		return linuxerr.EACCES
+	case 3: // Network unreachable.
+		return linuxerr.ENETUNREACH
+	case 4: // Host unreachable.
+		return linuxerr.EHOSTUNREACH
+	case 6: // TTL expired.
+		return linuxerr.ETIMEDOUT
+	default: // General failure, connection refused, unsupported.
+		return linuxerr.ECONNREFUSED
+	}
+}
+
+func (c *Config) httpConnectHandshake(rw io.ReadWriter, dst tcpip.FullAddress) error {
+	hostPort := net.JoinHostPort(net.IP(dst.Addr.AsSlice()).String(), strconv.Itoa(int(dst.Port)))
+	var req strings.Builder
+	fmt.Fprintf(&req, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n", hostPort, hostPort)
+	if c.username != "" {
+		creds := base64.StdEncoding.EncodeToString([]byte(c.username + ":" + c.password))
+		fmt.Fprintf(&req, "Proxy-Authorization: Basic %s\r\n", creds)
+	}
+	req.WriteString("\r\n")
+	if _, err := io.WriteString(rw, req.String()); err != nil {
+		return err
+	}
+
+	// Read the response one byte at a time, so as not to consume any data
+	// following the header.
+	var hdr []byte
+	var b [1]byte
+	for !bytes.HasSuffix(hdr, []byte("\r\n\r\n")) {
+		if len(hdr) >= maxResponseHeader {
+			return linuxerr.ECONNREFUSED
+		}
+		if _, err := io.ReadFull(rw, b[:]); err != nil {
+			return proxyReadError(err)
+		}
+		hdr = append(hdr, b[0])
+	}
+
+	// Status line: HTTP/1.x SP status-code SP reason.
+	status := strings.SplitN(string(hdr[:bytes.IndexByte(hdr, '\n')]), " ", 3)
+	if len(status) < 2 || !strings.HasPrefix(status[0], "HTTP/1.") {
+		return linuxerr.ECONNREFUSED
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(status[1]))
+	if err != nil {
+		return linuxerr.ECONNREFUSED
+	}
+	switch {
+	case code >= 200 && code < 300:
+		return nil
+	case code == 403 || code == 407:
+		return linuxerr.EACCES
+	case code == 504:
+		return linuxerr.ETIMEDOUT
+	default:
+		return linuxerr.ECONNREFUSED
+	}
+}
+
+// proxyReadError translates an error while reading the proxy's response.
+func proxyReadError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// The proxy hung up on us.
+		return linuxerr.ECONNREFUSED
+	}
+	return err
+}
@@ -29,6 +29,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/sockfs"
 	"gvisor.dev/gvisor/pkg/sentry/hostfd"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
@@ -116,6 +117,10 @@ type Socket struct {
 	protocol int            // Read-only.
 	queue    waiter.Queue
 
+	// namespace is the network namespace the socket was created in. It
+	// holds a reference on the namespace.
+	namespace *inet.Namespace
+
 	// fd is the host socket fd. It must have O_NONBLOCK, so that operations
 	// will return EWOULDBLOCK instead of blocking on the host. This allows us to
 	// handle blocking behavior independently in the sentry.
@@ -128,7 +133,7 @@ type Socket struct {
 
 var _ = socket.Socket(&Socket{})
 
-func newSocket(t *kernel.Task, family int, stype linux.SockType, protocol int, fd int, flags uint32) (*vfs.FileDescription, *syserr.Error) {
+func newSocket(t *kernel.Task, namespace *inet.Namespace, family int, stype linux.SockType, protocol int, fd int, flags uint32) (*vfs.FileDescription, *syserr.Error) {
 	mnt := t.Kernel().SocketMount()
 	d := sockfs.NewDentry(t, mnt)
 	defer d.DecRef(t)
@@ -152,6 +157,10 @@ func newSocket(t *kernel.Task, family int, stype linux.SockType, protocol int, f
 		fdnotifier.RemoveFD(int32(s.fd))
 		return nil, syserr.FromError(err)
 	}
+	if namespace != nil {
+		namespace.IncRef()
+		s.namespace = namespace
+	}
 	return vfsfd, nil
 }
 
@@ -160,6 +169,9 @@ func (s *Socket) Release(ctx context.Context) {
 	kernel.KernelFromContext(ctx).DeleteSocket(&s.vfsfd)
 	fdnotifier.RemoveFD(int32(s.fd))
 	_ = unix.Close(s.fd)
+	if s.namespace != nil {
+		s.namespace.DecRef(ctx)
+	}
 }
 
 // Epollable implements FileDescriptionImpl.Epollable.
@@ -268,14 +280,24 @@ func (p *socketProvider) Socket(t *kernel.Task, stypeflags linux.SockType, proto
 		return nil, nil
 	}
 
+	return NewSocket(t, p.family, stypeflags, protocol)
+}
+
+// NewSocket creates a socket of the given family on the host, regardless of
+// the network stack in use. It allows families that are always bridged to the
+// host, such as AF_VSOCK, to reuse hostinet sockets. Callers are responsible
+// for checking that the socket is permitted by the syscall filters.
+func NewSocket(t *kernel.Task, family int, stypeflags linux.SockType, protocol int) (*vfs.FileDescription, *syserr.Error) {
+	stype := stypeflags & linux.SOCK_TYPE_MASK
+
 	// Conservatively ignore all flags specified by the application and add
 	// SOCK_NONBLOCK since socketOperations requires it.
 	st := int(stype) | unix.SOCK_NONBLOCK | unix.SOCK_CLOEXEC
-	fd, err := unix.Socket(p.family, st, protocol)
+	fd, err := unix.Socket(family, st, protocol)
 	if err != nil {
 		return nil, syserr.FromError(err)
 	}
-	return newSocket(t, p.family, stype, protocol, fd, uint32(stypeflags&unix.SOCK_NONBLOCK))
+	return newSocket(t, t.NetworkNamespace(), family, stype, protocol, fd, uint32(stypeflags&unix.SOCK_NONBLOCK))
 }
 
 // Pair implements socket.Provider.Pair.
@@ -414,7 +436,9 @@ func (s *Socket) Accept(t *kernel.Task, peerRequested bool, flags int, blocking
 		kfd  int32
 		kerr error
 	)
-	f, err := newSocket(t, s.family, s.stype, s.protocol, fd, uint32(flags&unix.SOCK_NONBLOCK))
+	// Like Linux, the accepted socket belongs to the listening socket's
+	// network namespace rather than to the caller's.
+	f, err := newSocket(t, s.namespace, s.family, s.stype, s.protocol, fd, uint32(flags&unix.SOCK_NONBLOCK))
 	if err != nil {
 		_ = unix.Close(fd)
 		return 0, nil, 0, err
@@ -424,7 +448,7 @@ func (s *Socket) Accept(t *kernel.Task, peerRequested bool, flags int, blocking
 	kfd, kerr = t.NewFDFrom(0, f, kernel.FDFlags{
 		CloseOnExec: flags&unix.SOCK_CLOEXEC != 0,
 	})
-	t.Kernel().RecordSocket(f)
+	t.Kernel().RecordSocket(f, s.namespace)
 
 	return kfd, peerAddr, peerAddrlen, syserr.FromError(kerr)
 }
@@ -492,6 +516,10 @@ func (s *Socket) recvMsgFromHost(iovs []unix.Iovec, flags int, senderRequested b
 	return n, int(msg.Flags), senderAddrBuf[:msg.Namelen], controlBuf[:msg.Controllen], err
 }
 
+// maxDeterministicRecv is the maximum number of bytes received from a host
+// socket at once in deterministic mode, which buffers messages to record them.
+const maxDeterministicRecv = 1 << 20
+
 const allowedRecvMsgFlags = unix.MSG_CTRUNC |
 	unix.MSG_DONTWAIT |
 	unix.MSG_ERRQUEUE |
@@ -511,6 +539,32 @@ func (s *Socket) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, have
 	var controlBuf []byte
 	var msgFlags int
 	copyToDst := func() (int64, error) {
+		if k := t.Kernel(); k.Deterministic() {
+			// The message is an external input; copy it out from its
+			// record.
+			in := k.DeterministicRead("hostinet", func() kernel.ExternalInput {
+				buf := make([]byte, min(dst.NumBytes(), maxDeterministicRecv))
+				var iovs []unix.Iovec
+				if len(buf) > 0 {
+					iovs = []unix.Iovec{{Base: &buf[0], Len: uint64(len(buf))}}
+				}
+				n, mFlags, addr, control, err := s.recvMsgFromHost(iovs, flags, senderRequested, controlLen)
+				// With MSG_TRUNC, n may exceed len(buf).
+				in := kernel.NewExternalInput(buf[:min(n, uint64(len(buf)))], err)
+				in.Aux = [][]byte{addr, control}
+				in.Args = []int64{int64(n), int64(mFlags)}
+				return in
+			})
+			if err := in.Err(); err != nil {
+				return 0, err
+			}
+			senderAddrBuf, controlBuf, msgFlags = in.Aux[0], in.Aux[1], int(in.Args[1])
+			if _, err := dst.CopyOut(t, in.Data); err != nil {
+				return 0, err
+			}
+			return in.Args[0], nil
+		}
+
 		var n uint64
 		var err error
 		if dst.NumBytes() == 0 {
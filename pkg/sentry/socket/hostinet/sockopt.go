@@ -52,8 +52,8 @@ type SockOpt struct {
 //
 // Note the following socket options are supported but do not need syscalls to
 // the host, so do not appear on this list:
-//   - SO_TYPE, SO_PROTOCOL, SO_DOMAIN are handled at the syscall level in
-//     syscalls/sys_socket.go.
+//   - SO_TYPE, SO_PROTOCOL, SO_DOMAIN, SO_COOKIE are handled at the syscall
+//     level in syscalls/sys_socket.go.
 //   - SO_SNDTIMEOU, SO_RCVTIMEO are handled internally by setting the embedded
 //     socket.SendReceiveTimeout.
 var SockOpts = []SockOpt{
@@ -88,6 +88,7 @@ var SockOpts = []SockOpt{
 	{linux.SOL_SOCKET, linux.SO_ERROR, sizeofInt32, true, false},
 	{linux.SOL_SOCKET, linux.SO_KEEPALIVE, sizeofInt32, true, true},
 	{linux.SOL_SOCKET, linux.SO_LINGER, linux.SizeOfLinger, true, true},
+	{linux.SOL_SOCKET, linux.SO_MEMINFO, uint64(linux.SK_MEMINFO_VARS * sizeofInt32), true, false},
 	{linux.SOL_SOCKET, linux.SO_NO_CHECK, sizeofInt32, true, true},
 	{linux.SOL_SOCKET, linux.SO_OOBINLINE, sizeofInt32, true, true},
 	{linux.SOL_SOCKET, linux.SO_PASSCRED, sizeofInt32, true, true},
@@ -182,6 +183,8 @@ func (s *Socket) GetSockOpt(t *kernel.Task, level, name int, optValAddr hostarch
 			switch {
 			case level == linux.SOL_TCP && name == linux.TCP_INFO:
 				// Allow smaller buffer.
+			case level == linux.SOL_SOCKET && name == linux.SO_MEMINFO:
+				// Allow smaller buffer.
 			case level == linux.SOL_ICMPV6 && name == linux.ICMPV6_FILTER:
 				// Allow smaller buffer.
 			case level == linux.SOL_IP && name == linux.IP_TTL:
@@ -46,6 +46,14 @@ var defaultSendBufSize = inet.TCPBufferSize{
 	Max:     4194304,
 }
 
+var defaultMTUProbing = inet.TCPMTUProbing{
+	Mode:      0,
+	BaseMSS:   1024,
+	Floor:     48,
+	Threshold: 8,
+	Interval:  600,
+}
+
 // Stack implements inet.Stack for host sockets.
 type Stack struct {
 	// Stack is immutable.
@@ -54,6 +62,7 @@ type Stack struct {
 	tcpRecvBufSize inet.TCPBufferSize
 	tcpSendBufSize inet.TCPBufferSize
 	tcpSACKEnabled bool
+	tcpMTUProbing  inet.TCPMTUProbing
 	netDevFile     *os.File
 	netSNMPFile    *os.File
 	// allowedSocketTypes is the list of allowed socket types
@@ -98,6 +107,24 @@ func (s *Stack) Configure(allowRawSockets bool) error {
 		log.Warningf("Failed to read if TCP SACK if enabled, setting to true")
 	}
 
+	s.tcpMTUProbing = defaultMTUProbing
+	for name, v := range map[string]*int32{
+		"tcp_mtu_probing":     &s.tcpMTUProbing.Mode,
+		"tcp_base_mss":        &s.tcpMTUProbing.BaseMSS,
+		"tcp_mtu_probe_floor": &s.tcpMTUProbing.Floor,
+		"tcp_probe_threshold": &s.tcpMTUProbing.Threshold,
+		"tcp_probe_interval":  &s.tcpMTUProbing.Interval,
+	} {
+		contents, err := ioutil.ReadFile("/proc/sys/net/ipv4/" + name)
+		if err != nil {
+			log.Warningf("Failed to read %s, using default value %d", name, *v)
+			continue
+		}
+		if n, err := strconv.ParseInt(strings.TrimSpace(string(contents)), 10, 32); err == nil {
+			*v = int32(n)
+		}
+	}
+
 	if f, err := os.Open("/proc/net/dev"); err != nil {
 		log.Warningf("Failed to open /proc/net/dev: %v", err)
 	} else {
@@ -221,6 +248,16 @@ func (*Stack) SetTCPRecovery(inet.TCPLossRecovery) error {
 	return linuxerr.EACCES
 }
 
+// TCPMTUProbing implements inet.Stack.TCPMTUProbing.
+func (s *Stack) TCPMTUProbing() (inet.TCPMTUProbing, error) {
+	return s.tcpMTUProbing, nil
+}
+
+// SetTCPMTUProbing implements inet.Stack.SetTCPMTUProbing.
+func (*Stack) SetTCPMTUProbing(inet.TCPMTUProbing) error {
+	return linuxerr.EACCES
+}
+
 // getLine reads one line from proc file, with specified prefix.
 // The last argument, withHeader, specifies if it contains line header.
 func getLine(f *os.File, prefix string, withHeader bool) string {
@@ -354,6 +391,17 @@ func (*Stack) SetPortRange(uint16, uint16) error {
 	return linuxerr.EACCES
 }
 
+// DefaultTTL implements inet.Stack.DefaultTTL.
+func (*Stack) DefaultTTL(tcpip.NetworkProtocolNumber) (uint8, error) {
+	// Use the default Linux value per include/net/ip.h:IPDEFTTL.
+	return 64, nil
+}
+
+// SetDefaultTTL implements inet.Stack.SetDefaultTTL.
+func (*Stack) SetDefaultTTL(tcpip.NetworkProtocolNumber, uint8) error {
+	return linuxerr.EACCES
+}
+
 // GROTimeout implements inet.Stack.GROTimeout.
 func (s *Stack) GROTimeout(NICID int32) (time.Duration, error) {
 	return 0, nil
@@ -192,6 +192,8 @@ func SetEntries(mapper IDMapper, stk *stack.Stack, optVal []byte, ipv6 bool) *sy
 		table = stack.EmptyFilterTable()
 	case natTable:
 		table = stack.EmptyNATTable()
+	case mangleTable:
+		table = stack.EmptyMangleTable()
 	default:
 		nflog("unknown iptables table %q", replace.Name.String())
 		return syserr.ErrInvalidArgument
@@ -278,9 +280,10 @@ func SetEntries(mapper IDMapper, stk *stack.Stack, optVal []byte, ipv6 bool) *sy
 	}
 
 	// Since we don't support FORWARD, yet, make sure all other chains point to
-	// ACCEPT rules.
+	// ACCEPT rules. The same goes for the mangle table's INPUT and POSTROUTING
+	// chains, which netstack doesn't traverse.
 	for hook, ruleIdx := range table.BuiltinChains {
-		if hook := stack.Hook(hook); hook == stack.Forward {
+		if hook := stack.Hook(hook); hook == stack.Forward || (replace.Name.String() == mangleTable && (hook == stack.Input || hook == stack.Postrouting)) {
 			if ruleIdx == stack.HookUnset {
 				continue
 			}
@@ -291,6 +294,10 @@ func SetEntries(mapper IDMapper, stk *stack.Stack, optVal []byte, ipv6 bool) *sy
 		}
 	}
 
+	if err := checkTProxyRules(replace.Name.String(), &table); err != nil {
+		return err
+	}
+
 	// TODO(gvisor.dev/issue/6167): Check the following conditions:
 	//	- There are no loops.
 	//	- There are no chains without an unconditional final rule.
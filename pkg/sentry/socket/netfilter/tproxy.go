@@ -0,0 +1,159 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// TProxyTargetName is used to mark targets as TPROXY targets. TPROXY targets
+// should be reached only in the PREROUTING chain of the mangle table. These
+// targets divert packets to a local transparent socket without changing
+// their destination.
+const TProxyTargetName = "TPROXY"
+
+func init() {
+	registerTargetMaker(&tproxyTargetMakerR1{
+		NetworkProtocol: header.IPv4ProtocolNumber,
+	})
+	registerTargetMaker(&tproxyTargetMakerR1{
+		NetworkProtocol: header.IPv6ProtocolNumber,
+	})
+}
+
+type tproxyTarget struct {
+	stack.TProxyTarget
+
+	// markMask and markValue must be (un)marshalled when reading and writing
+	// the target to userspace, but do not affect behavior since netstack does
+	// not support packet marks.
+	markMask  uint32
+	markValue uint32
+}
+
+func (tt *tproxyTarget) id() targetID {
+	return targetID{
+		name:            TProxyTargetName,
+		networkProtocol: tt.NetworkProtocol,
+		revision:        1,
+	}
+}
+
+type tproxyTargetMakerR1 struct {
+	NetworkProtocol tcpip.NetworkProtocolNumber
+}
+
+func (tt *tproxyTargetMakerR1) id() targetID {
+	return targetID{
+		name:            TProxyTargetName,
+		networkProtocol: tt.NetworkProtocol,
+		revision:        1,
+	}
+}
+
+func (*tproxyTargetMakerR1) marshal(target target) []byte {
+	tt := target.(*tproxyTarget)
+	xt := linux.XTTProxyTargetV1{
+		Target: linux.XTEntryTarget{
+			TargetSize: linux.SizeOfXTTProxyTargetV1,
+			Revision:   1,
+		},
+		MarkMask:  tt.markMask,
+		MarkValue: tt.markValue,
+		LPort:     htons(tt.Port),
+	}
+	copy(xt.Target.Name[:], TProxyTargetName)
+	copy(xt.LAddr[:], tt.Addr.AsSlice())
+	return marshal.Marshal(&xt)
+}
+
+func (tt *tproxyTargetMakerR1) unmarshal(buf []byte, filter stack.IPHeaderFilter) (target, *syserr.Error) {
+	if size := linux.SizeOfXTTProxyTargetV1; len(buf) < size {
+		nflog("tproxyTargetMakerR1: buf has insufficient size (%d) for TPROXY target (%d)", len(buf), size)
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	// As in Linux, TPROXY rules must match on TCP or UDP.
+	if p := filter.Protocol; p != header.TCPProtocolNumber && p != header.UDPProtocolNumber {
+		nflog("tproxyTargetMakerR1: bad proto %d", p)
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	var xt linux.XTTProxyTargetV1
+	xt.UnmarshalUnsafe(buf)
+
+	target := tproxyTarget{
+		TProxyTarget: stack.TProxyTarget{
+			NetworkProtocol: filter.NetworkProtocol(),
+			Port:            ntohs(xt.LPort),
+		},
+		markMask:  xt.MarkMask,
+		markValue: xt.MarkValue,
+	}
+	switch tt.NetworkProtocol {
+	case header.IPv4ProtocolNumber:
+		target.TProxyTarget.Addr = tcpip.AddrFrom4Slice(xt.LAddr[:4])
+	case header.IPv6ProtocolNumber:
+		target.TProxyTarget.Addr = tcpip.AddrFrom16(xt.LAddr)
+	default:
+		panic(fmt.Sprintf("invalid protocol number: %d", tt.NetworkProtocol))
+	}
+
+	return &target, nil
+}
+
+// checkTProxyRules returns an error if table contains TPROXY rules outside of
+// the PREROUTING chain of the mangle table, which is where Linux restricts
+// them to. Unlike Linux, rules in user chains are rejected even if they are
+// only reachable from PREROUTING.
+func checkTProxyRules(tableName string, table *stack.Table) *syserr.Error {
+	// Chains span from their first rule to the first rule of the next chain.
+	var heads []int
+	for _, ruleIdx := range table.BuiltinChains {
+		if ruleIdx != stack.HookUnset {
+			heads = append(heads, ruleIdx)
+		}
+	}
+	for ruleIdx, rule := range table.Rules {
+		if _, ok := rule.Target.(*userChainTarget); ok {
+			heads = append(heads, ruleIdx)
+		}
+	}
+
+	prerouting := table.BuiltinChains[stack.Prerouting]
+	for ruleIdx, rule := range table.Rules {
+		if _, ok := rule.Target.(*tproxyTarget); !ok {
+			continue
+		}
+		if tableName != mangleTable || prerouting == stack.HookUnset || ruleIdx < prerouting {
+			nflog("TPROXY is only valid in the PREROUTING chain of the mangle table")
+			return syserr.ErrInvalidArgument
+		}
+		for _, head := range heads {
+			if head > prerouting && head <= ruleIdx {
+				nflog("TPROXY is only valid in the PREROUTING chain of the mangle table")
+				return syserr.ErrInvalidArgument
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package connector provides a NETLINK_CONNECTOR socket protocol.
+//
+// Only the process events connector (CN_IDX_PROC), which reports task fork,
+// exec, exit, credential, session and name changes, is supported.
+package connector
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// procGroup is the multicast group bit for CN_IDX_PROC.
+const procGroup = 1 << (linux.CN_IDX_PROC - 1)
+
+// procID is the connector callback ID of the process events connector.
+var procID = linux.CbID{Idx: linux.CN_IDX_PROC, Val: linux.CN_VAL_PROC}
+
+// Protocol implements netlink.Protocol.
+//
+// Unlike Linux, which delivers process events to every member of the
+// CN_IDX_PROC group as long as any socket has sent PROC_CN_MCAST_LISTEN, a
+// socket only receives process events if it has itself joined the group and
+// sent PROC_CN_MCAST_LISTEN.
+//
+// +stateify savable
+type Protocol struct {
+	// The following fields are protected by the owning netlink.Socket's mu,
+	// which is held by callers of SetGroups and ProcessMessage.
+
+	// sock is the socket that owns this Protocol. It is set when the socket
+	// first joins a multicast group.
+	sock *netlink.Socket
+
+	// member is true if sock is a member of the CN_IDX_PROC group.
+	member bool
+
+	// listening is true if sock has sent PROC_CN_MCAST_LISTEN and not
+	// subsequently sent PROC_CN_MCAST_IGNORE.
+	listening bool
+
+	// registered is true if p is registered as a kernel.ProcEventListener.
+	registered bool
+
+	// seq is the sequence number of the next message sent by p.
+	seq atomicbitops.Uint32
+}
+
+var _ netlink.MulticastProtocol = (*Protocol)(nil)
+var _ netlink.ControlMessageProtocol = (*Protocol)(nil)
+var _ kernel.ProcEventListener = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_CONNECTOR netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	return &Protocol{}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_CONNECTOR
+}
+
+// CanSend implements netlink.Protocol.CanSend.
+func (p *Protocol) CanSend() bool {
+	return true
+}
+
+// ProcessesControlMessages implements
+// netlink.ControlMessageProtocol.ProcessesControlMessages.
+//
+// Connector messages are conventionally sent with type NLMSG_DONE.
+func (p *Protocol) ProcessesControlMessages() {}
+
+// SetGroups implements netlink.MulticastProtocol.SetGroups.
+func (p *Protocol) SetGroups(ctx context.Context, s *netlink.Socket, groups uint32) *syserr.Error {
+	// Groups other than CN_IDX_PROC may be joined, but no other connectors
+	// exist to send messages to them.
+	p.sock = s
+	p.member = groups&procGroup != 0
+	p.updateRegistration(ctx)
+	return nil
+}
+
+// updateRegistration registers or unregisters p as a
+// kernel.ProcEventListener, as appropriate.
+func (p *Protocol) updateRegistration(ctx context.Context) {
+	want := p.member && p.listening
+	if want == p.registered {
+		return
+	}
+	k := kernel.KernelFromContext(ctx)
+	if want {
+		k.AddProcEventListener(p)
+	} else {
+		k.RemoveProcEventListener(p)
+	}
+	p.registered = want
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+//
+// Like Linux, malformed and unrecognized messages are silently dropped, and
+// errors are reported in an acknowledgement event rather than in an
+// NLMSG_ERROR message.
+func (p *Protocol) ProcessMessage(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	var cnMsg linux.CnMsg
+	data, ok := msg.GetData(&cnMsg)
+	if !ok || len(data) < int(cnMsg.Len) || cnMsg.ID != procID {
+		return nil
+	}
+	// The payload is an enum proc_cn_mcast_op.
+	if cnMsg.Len != 4 {
+		return nil
+	}
+	op := hostarch.ByteOrder.Uint32(data)
+
+	// Events are reported with respect to the root PID and user namespaces,
+	// so ignore requests from other namespaces.
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		return nil
+	}
+	k := t.Kernel()
+	creds := t.Credentials()
+	if creds.UserNamespace != k.RootUserNamespace() || t.PIDNamespace() != k.RootPIDNamespace() {
+		return nil
+	}
+
+	var errno uint32
+	switch {
+	case !creds.HasCapabilityIn(linux.CAP_NET_ADMIN, k.RootUserNamespace()):
+		errno = uint32(linuxerr.EPERM.Errno())
+	case op == linux.PROC_CN_MCAST_LISTEN:
+		p.listening = true
+	case op == linux.PROC_CN_MCAST_IGNORE:
+		p.listening = false
+	default:
+		errno = uint32(linuxerr.EINVAL.Errno())
+	}
+	p.updateRegistration(ctx)
+
+	if !p.member {
+		// The acknowledgement is sent to the CN_IDX_PROC group.
+		return nil
+	}
+	ev := linux.ProcEvent{
+		What:        linux.PROC_EVENT_NONE,
+		CPU:         uint32(t.CPU()),
+		TimestampNS: uint64(k.MonotonicClock().Now().Nanoseconds()),
+	}
+	ack := linux.ProcEventAckData{Err: errno}
+	ack.MarshalBytes(ev.EventData[:])
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.NLMSG_DONE,
+	})
+	m.Put(&linux.CnMsg{
+		ID:  procID,
+		Seq: cnMsg.Seq,
+		Ack: cnMsg.Ack + 1,
+		Len: linux.ProcEventSize,
+	})
+	m.Put(&ev)
+	return nil
+}
+
+// HandleProcEvent implements kernel.ProcEventListener.HandleProcEvent.
+func (p *Protocol) HandleProcEvent(ctx context.Context, ev *linux.ProcEvent) {
+	seq := p.seq.Add(1) - 1
+	ms := netlink.NewMessageSet(0 /* portID */, seq)
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.NLMSG_DONE,
+	})
+	m.Put(&linux.CnMsg{
+		ID:  procID,
+		Seq: seq,
+		Len: linux.ProcEventSize,
+	})
+	m.Put(ev)
+	p.sock.SendNotification(ctx, ms)
+}
+
+// init registers the NETLINK_CONNECTOR provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_CONNECTOR, NewProtocol)
+}
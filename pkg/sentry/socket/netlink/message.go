@@ -189,6 +189,31 @@ func (m *Message) PutAttrString(atype uint16, s string) {
 	m.putZeros(aligned - l)
 }
 
+// BeginNestedAttr adds the header of a nested netlink attribute to the message
+// and returns its offset. Attributes added afterwards are nested in it, until
+// EndNestedAttr is called with the offset.
+func (m *Message) BeginNestedAttr(atype uint16) int {
+	off := len(m.buf)
+	m.Put(&linux.NetlinkAttrHeader{
+		Type: atype,
+	})
+	return off
+}
+
+// EndNestedAttr sets the length of the nested attribute at offset off, which
+// was returned by BeginNestedAttr.
+//
+// Preconditions: The nested attribute fits in math.MaxUint16 bytes.
+func (m *Message) EndNestedAttr(off int) {
+	l := len(m.buf) - off
+	if l > math.MaxUint16 {
+		panic(fmt.Sprintf("attribute too large: %d", l))
+	}
+	// Length is the first field of the header. Nested attributes are already
+	// aligned.
+	hostarch.ByteOrder.PutUint16(m.buf[off:], uint16(l))
+}
+
 // MessageSet contains a series of netlink messages.
 type MessageSet struct {
 	// Multi indicates that this a multi-part message, to be terminated by
@@ -301,3 +301,30 @@ func TestAttrView(t *testing.T) {
 		}
 	}
 }
+
+func TestNestedAttr(t *testing.T) {
+	msg := netlink.NewMessage(linux.NetlinkMessageHeader{})
+	off := msg.BeginNestedAttr(1)
+	msg.PutAttr(2, primitive.AllocateUint16(0x3130))
+	msg.PutAttrString(3, "a")
+	msg.EndNestedAttr(off)
+	msg.PutAttr(4, primitive.AllocateUint32(0x33323130))
+
+	got := msg.Finalize()[linux.NetlinkMessageHeaderSize:]
+	want := []byte{
+		0x14, 0x00, // Length
+		0x01, 0x00, // Type
+		0x06, 0x00, // Nested length
+		0x02, 0x00, // Nested type
+		0x30, 0x31, 0x00, 0x00, // Nested data with 2 bytes padding
+		0x06, 0x00, // Nested length
+		0x03, 0x00, // Nested type
+		0x61, 0x00, 0x00, 0x00, // Nested string with NUL and 2 bytes padding
+		0x08, 0x00, // Length
+		0x04, 0x00, // Type
+		0x30, 0x31, 0x32, 0x33, // Data
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got attributes = %v, want = %v", got, want)
+	}
+}
@@ -46,6 +46,31 @@ type Protocol interface {
 	ProcessMessage(ctx context.Context, msg *Message, ms *MessageSet) *syserr.Error
 }
 
+// MulticastProtocol is a Protocol whose sockets may join multicast groups,
+// to receive messages that are not sent in response to a request.
+type MulticastProtocol interface {
+	Protocol
+
+	// SetGroups is called when the set of multicast groups that s is a
+	// member of changes, with groups as a bitmask of the new set (group n
+	// is bit n-1). If SetGroups returns an error, s's membership is
+	// unchanged.
+	//
+	// Preconditions: s.mu must be locked.
+	SetGroups(ctx context.Context, s *Socket, groups uint32) *syserr.Error
+}
+
+// ControlMessageProtocol is a Protocol that processes messages of all types,
+// including the standard control message types (those below NLMSG_MIN_TYPE),
+// which are otherwise ignored. This corresponds to Linux protocols that don't
+// use netlink_rcv_skb() to process input.
+type ControlMessageProtocol interface {
+	Protocol
+
+	// ProcessesControlMessages is a marker method; it is never called.
+	ProcessesControlMessages()
+}
+
 // Provider is a function that creates a new Protocol for a specific netlink
 // protocol.
 //
@@ -637,6 +637,12 @@ func (p *Protocol) ProcessMessage(ctx context.Context, msg *netlink.Message, ms
 			return p.dumpAddrs(ctx, msg, ms)
 		case linux.RTM_GETROUTE:
 			return p.dumpRoutes(ctx, msg, ms)
+		case linux.RTM_GETQDISC:
+			return p.dumpQdiscs(ctx, msg, ms)
+		case linux.RTM_GETTCLASS:
+			return p.dumpClasses(ctx, msg, ms)
+		case linux.RTM_GETTFILTER:
+			return p.dumpFilters(ctx, msg, ms)
 		default:
 			return syserr.ErrNotSupported
 		}
@@ -654,6 +660,18 @@ func (p *Protocol) ProcessMessage(ctx context.Context, msg *netlink.Message, ms
 			return p.newAddr(ctx, msg, ms)
 		case linux.RTM_DELADDR:
 			return p.delAddr(ctx, msg, ms)
+		case linux.RTM_NEWQDISC:
+			return p.newQdisc(ctx, msg, ms)
+		case linux.RTM_DELQDISC:
+			return p.delQdisc(ctx, msg, ms)
+		case linux.RTM_NEWTCLASS:
+			return p.newClass(ctx, msg, ms)
+		case linux.RTM_DELTCLASS:
+			return p.delClass(ctx, msg, ms)
+		case linux.RTM_NEWTFILTER:
+			return p.newFilter(ctx, msg, ms)
+		case linux.RTM_DELTFILTER:
+			return p.delFilter(ctx, msg, ms)
 		default:
 			return syserr.ErrNotSupported
 		}
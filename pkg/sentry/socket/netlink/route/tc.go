@@ -0,0 +1,553 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package route
+
+import (
+	"math"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// Traffic control is configured with tc(8) through RTM_*QDISC, RTM_*TCLASS
+// and RTM_*TFILTER messages. The supported subset is:
+//
+//   - "tbf" root qdiscs, which shape egress traffic.
+//   - "htb" root qdiscs with classes. Traffic is shaped by the default class
+//     at its ceil; filters can't classify traffic into other classes.
+//   - "ingress" and "clsact" qdiscs, which filters are attached to.
+//   - "matchall" filters with "police" (drop only) and egress "mirred"
+//     (mirror or redirect) actions.
+
+// trafficControl returns the traffic control of the network stack, or nil if
+// it doesn't support it.
+func trafficControl(ctx context.Context) inet.TrafficControl {
+	stack := inet.StackFromContext(ctx)
+	if stack == nil {
+		return nil
+	}
+	tc, _ := stack.(inet.TrafficControl)
+	return tc
+}
+
+// parseAttrs returns the attributes in attrs by type. Nested attributes are
+// returned unparsed.
+func parseAttrs(attrs netlink.AttrsView) (map[uint16][]byte, *syserr.Error) {
+	m := make(map[uint16][]byte)
+	for !attrs.Empty() {
+		ahdr, value, rest, ok := attrs.ParseFirst()
+		if !ok {
+			return nil, syserr.ErrInvalidArgument
+		}
+		attrs = rest
+		m[ahdr.Type&linux.NLA_TYPE_MASK] = value
+	}
+	return m, nil
+}
+
+// cString returns the NUL-terminated string in b.
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+// parseUint64Attr returns the value of a 64-bit attribute of attrs, or def if
+// it is not set.
+func parseUint64Attr(attrs map[uint16][]byte, atype uint16, def uint64) (uint64, *syserr.Error) {
+	value, ok := attrs[atype]
+	if !ok {
+		return def, nil
+	}
+	var v primitive.Uint64
+	if len(value) < v.SizeBytes() {
+		return 0, syserr.ErrInvalidArgument
+	}
+	v.UnmarshalUnsafe(value)
+	return uint64(v), nil
+}
+
+// ticksToBytes converts a burst in packet scheduler ticks, as sent by tc(8),
+// to bytes at the given rate in bytes per second.
+func ticksToBytes(rate uint64, ticks uint32) uint32 {
+	ns := float64(uint64(ticks) << linux.PSCHED_SHIFT)
+	return uint32(math.Min(float64(rate)*ns/float64(time.Second), math.MaxUint32))
+}
+
+// bytesToTicks is the inverse of ticksToBytes.
+func bytesToTicks(rate uint64, bytes uint32) uint32 {
+	if rate == 0 {
+		return 0
+	}
+	ns := float64(bytes) * float64(time.Second) / float64(rate)
+	return uint32(math.Min(ns/(1<<linux.PSCHED_SHIFT), math.MaxUint32))
+}
+
+// rateSpec returns the tc_ratespec of rate, which is truncated to 32 bits.
+// Larger rates are sent in a separate 64-bit attribute.
+func rateSpec(rate uint64) linux.TCRateSpec {
+	return linux.TCRateSpec{
+		Rate: uint32(min(rate, math.MaxUint32)),
+	}
+}
+
+// tcFlags returns the create and exclusive flags of a request.
+func tcFlags(msg *netlink.Message) (create, exclusive bool) {
+	flags := msg.Header().Flags
+	return flags&linux.NLM_F_CREATE != 0, flags&linux.NLM_F_EXCL != 0
+}
+
+// putStats adds TCA_STATS2 to m.
+func putStats(m *netlink.Message, stats inet.TCStats) {
+	off := m.BeginNestedAttr(linux.TCA_STATS2)
+	m.PutAttr(linux.TCA_STATS_BASIC, &linux.GnetStatsBasic{
+		Bytes:   stats.Bytes,
+		Packets: uint32(stats.Packets),
+	})
+	m.PutAttr(linux.TCA_STATS_QUEUE, &linux.GnetStatsQueue{
+		QLen:       stats.QLen,
+		Backlog:    stats.Backlog,
+		Drops:      uint32(stats.Drops),
+		Overlimits: uint32(stats.Overlimits),
+	})
+	m.EndNestedAttr(off)
+}
+
+// parseTCMessage parses the header and attributes of a traffic control
+// request.
+func parseTCMessage(msg *netlink.Message) (linux.TCMessage, map[uint16][]byte, *syserr.Error) {
+	var tcm linux.TCMessage
+	attrs, ok := msg.GetData(&tcm)
+	if !ok {
+		return tcm, nil, syserr.ErrInvalidArgument
+	}
+	m, err := parseAttrs(attrs)
+	return tcm, m, err
+}
+
+// newQdisc handles RTM_NEWQDISC requests.
+func (p *Protocol) newQdisc(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	tc := trafficControl(ctx)
+	if tc == nil {
+		return syserr.ErrNotSupported
+	}
+	tcm, attrs, err := parseTCMessage(msg)
+	if err != nil {
+		return err
+	}
+	q := inet.TCQdisc{
+		IfIndex: tcm.Ifindex,
+		Handle:  tcm.Handle,
+		Parent:  tcm.Parent,
+		Kind:    cString(attrs[linux.TCA_KIND]),
+	}
+	opts, err := parseAttrs(attrs[linux.TCA_OPTIONS])
+	if err != nil {
+		return err
+	}
+	switch q.Kind {
+	case "tbf":
+		value, ok := opts[linux.TCA_TBF_PARMS]
+		var qopt linux.TCTbfQopt
+		if !ok || len(value) < qopt.SizeBytes() {
+			return syserr.ErrInvalidArgument
+		}
+		qopt.UnmarshalUnsafe(value)
+		if _, ok := opts[linux.TCA_TBF_PRATE64]; ok || qopt.PeakRate.Rate != 0 {
+			return syserr.ErrNotSupported
+		}
+		if q.Rate, err = parseUint64Attr(opts, linux.TCA_TBF_RATE64, uint64(qopt.Rate.Rate)); err != nil {
+			return err
+		}
+		burst, err := parseUint64Attr(opts, linux.TCA_TBF_BURST, uint64(ticksToBytes(q.Rate, qopt.Buffer)))
+		if err != nil {
+			return err
+		}
+		q.Burst = uint32(burst)
+		q.Limit = qopt.Limit
+	case "htb":
+		if value, ok := opts[linux.TCA_HTB_INIT]; ok {
+			var glob linux.TCHtbGlob
+			if len(value) < glob.SizeBytes() {
+				return syserr.ErrInvalidArgument
+			}
+			glob.UnmarshalUnsafe(value)
+			q.DefaultClass = glob.Defcls
+		}
+	}
+	create, exclusive := tcFlags(msg)
+	return syserr.FromError(tc.SetTCQdisc(q, create, exclusive))
+}
+
+// delQdisc handles RTM_DELQDISC requests.
+func (p *Protocol) delQdisc(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	tc := trafficControl(ctx)
+	if tc == nil {
+		return syserr.ErrNotSupported
+	}
+	tcm, _, err := parseTCMessage(msg)
+	if err != nil {
+		return err
+	}
+	return syserr.FromError(tc.DelTCQdisc(tcm.Ifindex, tcm.Parent, tcm.Handle))
+}
+
+// dumpQdiscs handles RTM_GETQDISC dump requests.
+func (p *Protocol) dumpQdiscs(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	// We always send back an NLMSG_DONE.
+	ms.Multi = true
+	tc := trafficControl(ctx)
+	if tc == nil {
+		return nil
+	}
+	var tcm linux.TCMessage
+	if _, ok := msg.GetData(&tcm); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	for _, q := range tc.TCQdiscs() {
+		if tcm.Ifindex != 0 && q.IfIndex != tcm.Ifindex {
+			continue
+		}
+		m := ms.AddMessage(linux.NetlinkMessageHeader{
+			Type: linux.RTM_NEWQDISC,
+		})
+		m.Put(&linux.TCMessage{
+			Family:  linux.AF_UNSPEC,
+			Ifindex: q.IfIndex,
+			Handle:  q.Handle,
+			Parent:  q.Parent,
+			// Reference count.
+			Info: 1,
+		})
+		m.PutAttrString(linux.TCA_KIND, q.Kind)
+		off := m.BeginNestedAttr(linux.TCA_OPTIONS)
+		switch q.Kind {
+		case "tbf":
+			m.PutAttr(linux.TCA_TBF_PARMS, &linux.TCTbfQopt{
+				Rate:   rateSpec(q.Rate),
+				Limit:  q.Limit,
+				Buffer: bytesToTicks(q.Rate, q.Burst),
+			})
+			if q.Rate > math.MaxUint32 {
+				m.PutAttr(linux.TCA_TBF_RATE64, primitive.AllocateUint64(q.Rate))
+			}
+			m.PutAttr(linux.TCA_TBF_BURST, primitive.AllocateUint32(q.Burst))
+		case "htb":
+			m.PutAttr(linux.TCA_HTB_INIT, &linux.TCHtbGlob{
+				Version:      linux.TC_HTB_PROTOVER,
+				Rate2Quantum: 10,
+				Defcls:       q.DefaultClass,
+			})
+		}
+		m.EndNestedAttr(off)
+		putStats(m, q.Stats)
+	}
+	return nil
+}
+
+// newClass handles RTM_NEWTCLASS requests.
+func (p *Protocol) newClass(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	tc := trafficControl(ctx)
+	if tc == nil {
+		return syserr.ErrNotSupported
+	}
+	tcm, attrs, err := parseTCMessage(msg)
+	if err != nil {
+		return err
+	}
+	if kind, ok := attrs[linux.TCA_KIND]; ok && cString(kind) != "htb" {
+		return syserr.ErrNotSupported
+	}
+	opts, err := parseAttrs(attrs[linux.TCA_OPTIONS])
+	if err != nil {
+		return err
+	}
+	value, ok := opts[linux.TCA_HTB_PARMS]
+	var hopt linux.TCHtbOpt
+	if !ok || len(value) < hopt.SizeBytes() {
+		return syserr.ErrInvalidArgument
+	}
+	hopt.UnmarshalUnsafe(value)
+	c := inet.TCClass{
+		IfIndex: tcm.Ifindex,
+		Handle:  tcm.Handle,
+		Parent:  tcm.Parent,
+	}
+	if c.Rate, err = parseUint64Attr(opts, linux.TCA_HTB_RATE64, uint64(hopt.Rate.Rate)); err != nil {
+		return err
+	}
+	if c.Ceil, err = parseUint64Attr(opts, linux.TCA_HTB_CEIL64, uint64(hopt.Ceil.Rate)); err != nil {
+		return err
+	}
+	c.Burst = ticksToBytes(c.Rate, hopt.Buffer)
+	c.CBurst = ticksToBytes(c.Ceil, hopt.Cbuffer)
+	create, exclusive := tcFlags(msg)
+	return syserr.FromError(tc.SetTCClass(c, create, exclusive))
+}
+
+// delClass handles RTM_DELTCLASS requests.
+func (p *Protocol) delClass(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	tc := trafficControl(ctx)
+	if tc == nil {
+		return syserr.ErrNotSupported
+	}
+	tcm, _, err := parseTCMessage(msg)
+	if err != nil {
+		return err
+	}
+	return syserr.FromError(tc.DelTCClass(tcm.Ifindex, tcm.Handle))
+}
+
+// dumpClasses handles RTM_GETTCLASS dump requests.
+func (p *Protocol) dumpClasses(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	// We always send back an NLMSG_DONE.
+	ms.Multi = true
+	tc := trafficControl(ctx)
+	if tc == nil {
+		return nil
+	}
+	var tcm linux.TCMessage
+	if _, ok := msg.GetData(&tcm); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	for _, c := range tc.TCClasses() {
+		if tcm.Ifindex != 0 && c.IfIndex != tcm.Ifindex {
+			continue
+		}
+		parent := c.Parent
+		if parent == linux.TC_H_MAJ(c.Handle) {
+			// Like Linux, report classes attached to the qdisc as root
+			// classes.
+			parent = linux.TC_H_ROOT
+		}
+		m := ms.AddMessage(linux.NetlinkMessageHeader{
+			Type: linux.RTM_NEWTCLASS,
+		})
+		m.Put(&linux.TCMessage{
+			Family:  linux.AF_UNSPEC,
+			Ifindex: c.IfIndex,
+			Handle:  c.Handle,
+			Parent:  parent,
+		})
+		m.PutAttrString(linux.TCA_KIND, "htb")
+		off := m.BeginNestedAttr(linux.TCA_OPTIONS)
+		m.PutAttr(linux.TCA_HTB_PARMS, &linux.TCHtbOpt{
+			Rate:    rateSpec(c.Rate),
+			Ceil:    rateSpec(c.Ceil),
+			Buffer:  bytesToTicks(c.Rate, c.Burst),
+			Cbuffer: bytesToTicks(c.Ceil, c.CBurst),
+		})
+		if c.Rate > math.MaxUint32 {
+			m.PutAttr(linux.TCA_HTB_RATE64, primitive.AllocateUint64(c.Rate))
+		}
+		if c.Ceil > math.MaxUint32 {
+			m.PutAttr(linux.TCA_HTB_CEIL64, primitive.AllocateUint64(c.Ceil))
+		}
+		m.EndNestedAttr(off)
+		putStats(m, c.Stats)
+	}
+	return nil
+}
+
+// parseAction parses an action of a matchall filter.
+func parseAction(value []byte) (inet.TCAction, *syserr.Error) {
+	attrs, err := parseAttrs(value)
+	if err != nil {
+		return inet.TCAction{}, err
+	}
+	opts, err := parseAttrs(attrs[linux.TCA_ACT_OPTIONS])
+	if err != nil {
+		return inet.TCAction{}, err
+	}
+	a := inet.TCAction{
+		Kind: cString(attrs[linux.TCA_ACT_KIND]),
+	}
+	switch a.Kind {
+	case "police":
+		value, ok := opts[linux.TCA_POLICE_TBF]
+		var police linux.TCPolice
+		if !ok || len(value) < police.SizeBytes() {
+			return a, syserr.ErrInvalidArgument
+		}
+		police.UnmarshalUnsafe(value)
+		if police.Action != linux.TC_ACT_SHOT || police.PeakRate.Rate != 0 {
+			return a, syserr.ErrNotSupported
+		}
+		if a.Rate, err = parseUint64Attr(opts, linux.TCA_POLICE_RATE64, uint64(police.Rate.Rate)); err != nil {
+			return a, err
+		}
+		a.Burst = ticksToBytes(a.Rate, police.Burst)
+	case "mirred":
+		value, ok := opts[linux.TCA_MIRRED_PARMS]
+		var mirred linux.TCMirred
+		if !ok || len(value) < mirred.SizeBytes() {
+			return a, syserr.ErrInvalidArgument
+		}
+		mirred.UnmarshalUnsafe(value)
+		switch mirred.Eaction {
+		case linux.TCA_EGRESS_MIRROR:
+		case linux.TCA_EGRESS_REDIR:
+			a.Redirect = true
+		default:
+			return a, syserr.ErrNotSupported
+		}
+		a.TargetIfIndex = int32(mirred.Ifindex)
+	default:
+		return a, syserr.ErrNotSupported
+	}
+	return a, nil
+}
+
+// putAction adds a to m.
+func putAction(m *netlink.Message, order uint16, a inet.TCAction) {
+	off := m.BeginNestedAttr(order)
+	m.PutAttrString(linux.TCA_ACT_KIND, a.Kind)
+	optsOff := m.BeginNestedAttr(linux.TCA_ACT_OPTIONS)
+	switch a.Kind {
+	case "police":
+		m.PutAttr(linux.TCA_POLICE_TBF, &linux.TCPolice{
+			Action: linux.TC_ACT_SHOT,
+			Burst:  bytesToTicks(a.Rate, a.Burst),
+			Rate:   rateSpec(a.Rate),
+		})
+		if a.Rate > math.MaxUint32 {
+			m.PutAttr(linux.TCA_POLICE_RATE64, primitive.AllocateUint64(a.Rate))
+		}
+	case "mirred":
+		mirred := linux.TCMirred{
+			Action:  linux.TC_ACT_PIPE,
+			Eaction: linux.TCA_EGRESS_MIRROR,
+			Ifindex: uint32(a.TargetIfIndex),
+		}
+		if a.Redirect {
+			mirred.Action = linux.TC_ACT_STOLEN
+			mirred.Eaction = linux.TCA_EGRESS_REDIR
+		}
+		m.PutAttr(linux.TCA_MIRRED_PARMS, &mirred)
+	}
+	m.EndNestedAttr(optsOff)
+	m.EndNestedAttr(off)
+}
+
+// newFilter handles RTM_NEWTFILTER requests.
+func (p *Protocol) newFilter(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	tc := trafficControl(ctx)
+	if tc == nil {
+		return syserr.ErrNotSupported
+	}
+	tcm, attrs, err := parseTCMessage(msg)
+	if err != nil {
+		return err
+	}
+	f := inet.TCFilter{
+		IfIndex:  tcm.Ifindex,
+		Parent:   tcm.Parent,
+		Handle:   tcm.Handle,
+		Priority: uint16(tcm.Info >> 16),
+		Protocol: uint16(tcm.Info),
+		Kind:     cString(attrs[linux.TCA_KIND]),
+	}
+	if f.Kind != "matchall" {
+		return syserr.ErrNotSupported
+	}
+	opts, err := parseAttrs(attrs[linux.TCA_OPTIONS])
+	if err != nil {
+		return err
+	}
+	if _, ok := opts[linux.TCA_MATCHALL_CLASSID]; ok {
+		// Only the default class of htb qdiscs shapes traffic.
+		return syserr.ErrNotSupported
+	}
+	acts := netlink.AttrsView(opts[linux.TCA_MATCHALL_ACT])
+	for !acts.Empty() {
+		_, value, rest, ok := acts.ParseFirst()
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		acts = rest
+		a, err := parseAction(value)
+		if err != nil {
+			return err
+		}
+		f.Actions = append(f.Actions, a)
+	}
+	create, exclusive := tcFlags(msg)
+	return syserr.FromError(tc.SetTCFilter(f, create, exclusive))
+}
+
+// delFilter handles RTM_DELTFILTER requests.
+func (p *Protocol) delFilter(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	tc := trafficControl(ctx)
+	if tc == nil {
+		return syserr.ErrNotSupported
+	}
+	tcm, _, err := parseTCMessage(msg)
+	if err != nil {
+		return err
+	}
+	return syserr.FromError(tc.DelTCFilter(tcm.Ifindex, tcm.Parent, uint16(tcm.Info>>16), tcm.Handle))
+}
+
+// dumpFilters handles RTM_GETTFILTER dump requests.
+func (p *Protocol) dumpFilters(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	// We always send back an NLMSG_DONE.
+	ms.Multi = true
+	tc := trafficControl(ctx)
+	if tc == nil {
+		return nil
+	}
+	var tcm linux.TCMessage
+	if _, ok := msg.GetData(&tcm); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	for _, f := range tc.TCFilters() {
+		if tcm.Ifindex != 0 && f.IfIndex != tcm.Ifindex {
+			continue
+		}
+		if tcm.Parent != 0 && (linux.TC_H_MAJ(f.Parent) != linux.TC_H_MAJ(tcm.Parent) ||
+			(linux.TC_H_MIN(tcm.Parent) != 0 && f.Parent != tcm.Parent)) {
+			continue
+		}
+		m := ms.AddMessage(linux.NetlinkMessageHeader{
+			Type: linux.RTM_NEWTFILTER,
+		})
+		m.Put(&linux.TCMessage{
+			Family:  linux.AF_UNSPEC,
+			Ifindex: f.IfIndex,
+			Handle:  f.Handle,
+			Parent:  f.Parent,
+			Info:    linux.TC_H_MAKE(uint32(f.Priority)<<16, uint32(f.Protocol)),
+		})
+		m.PutAttrString(linux.TCA_KIND, f.Kind)
+		m.PutAttr(linux.TCA_CHAIN, primitive.AllocateUint32(0))
+		off := m.BeginNestedAttr(linux.TCA_OPTIONS)
+		actsOff := m.BeginNestedAttr(linux.TCA_MATCHALL_ACT)
+		for i, a := range f.Actions {
+			// Actions are numbered from 1.
+			putAction(m, uint16(i+1), a)
+		}
+		m.EndNestedAttr(actsOff)
+		m.EndNestedAttr(off)
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sockdiag provides a NETLINK_SOCK_DIAG socket protocol.
+//
+// Only inet_diag requests for TCP and UDP sockets are supported. The
+// reported inode and UID of each socket are the same as in /proc/net/tcp,
+// /proc/net/udp and /proc/[pid]/fd, so that tools like ss and nethogs can
+// attribute sockets to processes, and the reported cookie is the same as
+// returned by SO_COOKIE. Of the optional extensions, only
+// INET_DIAG_SKMEMINFO is supported.
+package sockdiag
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// Protocol implements netlink.Protocol.
+//
+// +stateify savable
+type Protocol struct{}
+
+var _ netlink.Protocol = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_SOCK_DIAG netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	return &Protocol{}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_SOCK_DIAG
+}
+
+// CanSend implements netlink.Protocol.CanSend.
+func (p *Protocol) CanSend() bool {
+	return true
+}
+
+// setAddr sets port and addr to the port and address in sa, which are both in
+// network byte order.
+func setAddr(port *uint16, addr *[16]byte, sa linux.SockAddr) {
+	switch a := sa.(type) {
+	case *linux.SockAddrInet:
+		*port = a.Port
+		copy(addr[:], a.Addr[:])
+	case *linux.SockAddrInet6:
+		*port = a.Port
+		copy(addr[:], a.Addr[:])
+	}
+}
+
+// diagMsg returns the inet_diag_msg of the socket in se, which must be
+// referenced by the caller. It returns false if the socket is not of the given
+// family or does not match isProto.
+func diagMsg(ctx context.Context, t *kernel.Task, se *kernel.SocketRecord, family uint8, isProto func(socket.Socket) bool) (linux.InetDiagMsg, bool) {
+	sops, ok := se.Sock.Impl().(socket.Socket)
+	if !ok {
+		return linux.InetDiagMsg{}, false
+	}
+	if fa, _, _ := sops.Type(); fa != int(family) || !isProto(sops) {
+		return linux.InetDiagMsg{}, false
+	}
+
+	m := linux.InetDiagMsg{
+		Family: family,
+		State:  uint8(sops.State()),
+	}
+	// The cookie is the same as returned by SO_COOKIE.
+	cookie := se.Cookie()
+	m.ID.Cookie[0] = uint32(cookie)
+	m.ID.Cookie[1] = uint32(cookie >> 32)
+	if t != nil {
+		if local, _, err := sops.GetSockName(t); err == nil {
+			setAddr(&m.ID.SPort, &m.ID.Src, local)
+		}
+		if remote, _, err := sops.GetPeerName(t); err == nil {
+			setAddr(&m.ID.DPort, &m.ID.Dst, remote)
+		}
+	}
+
+	// As in /proc/net/tcp, the UID and inode are those of the socket file,
+	// which is also what /proc/[pid]/fd/* link to.
+	stat, err := se.Sock.Stat(ctx, vfs.StatOptions{Mask: linux.STATX_UID | linux.STATX_INO})
+	if err == nil && stat.Mask&linux.STATX_UID != 0 {
+		creds := auth.CredentialsFromContext(ctx)
+		m.UID = uint32(auth.KUID(stat.UID).In(creds.UserNamespace).OrOverflow())
+	}
+	if err == nil && stat.Mask&linux.STATX_INO != 0 {
+		m.Inode = uint32(stat.Ino)
+	}
+	return m, true
+}
+
+// matches returns true if the socket described by m is the one requested by
+// id, as in Linux's inet_diag_find_one_icsk().
+func matches(m *linux.InetDiagMsg, id *linux.InetDiagSockID) bool {
+	addrLen := 16
+	if m.Family == linux.AF_INET {
+		addrLen = 4
+	}
+	if m.ID.SPort != id.SPort || m.ID.DPort != id.DPort ||
+		string(m.ID.Src[:addrLen]) != string(id.Src[:addrLen]) ||
+		string(m.ID.Dst[:addrLen]) != string(id.Dst[:addrLen]) {
+		return false
+	}
+	if id.Cookie[0] == linux.INET_DIAG_NOCOOKIE && id.Cookie[1] == linux.INET_DIAG_NOCOOKIE {
+		return true
+	}
+	return m.ID.Cookie == id.Cookie
+}
+
+// inetDiag handles SOCK_DIAG_BY_FAMILY requests for AF_INET and AF_INET6.
+func (p *Protocol) inetDiag(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	var req linux.InetDiagReqV2
+	if _, ok := msg.GetData(&req); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	var isProto func(socket.Socket) bool
+	switch req.Protocol {
+	case linux.IPPROTO_TCP:
+		isProto = socket.IsTCP
+	case linux.IPPROTO_UDP:
+		isProto = socket.IsUDP
+	default:
+		return syserr.ErrNoFileOrDir
+	}
+
+	dump := msg.Header().Flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP
+	if dump {
+		// We always send back an NLMSG_DONE.
+		ms.Multi = true
+	}
+
+	// t may be nil here if our caller is not part of a task goroutine, in which
+	// case addresses can't be retrieved.
+	t := kernel.TaskFromContext(ctx)
+	k := kernel.KernelFromContext(ctx)
+	netns := inet.NamespaceFromContext(ctx)
+	for _, se := range k.ListSockets() {
+		// Like Linux, only report sockets in the netlink socket's network
+		// namespace.
+		if !se.InNetworkNamespace(netns) {
+			continue
+		}
+		if !se.Sock.TryIncRef() {
+			// Racing with socket destruction, this is ok.
+			continue
+		}
+		m, ok := diagMsg(ctx, t, se, req.Family, isProto)
+		var memInfo linux.SKMemInfo
+		hasMemInfo := false
+		if ok && req.Ext&(1<<(linux.INET_DIAG_SKMEMINFO-1)) != 0 {
+			memInfo, hasMemInfo = socket.MemInfo(se.Sock.Impl().(socket.Socket))
+		}
+		se.Sock.DecRef(ctx)
+		if !ok {
+			continue
+		}
+		if dump {
+			if req.States&(1<<m.State) == 0 {
+				continue
+			}
+		} else if !matches(&m, &req.ID) {
+			continue
+		}
+		resp := ms.AddMessage(linux.NetlinkMessageHeader{
+			Type: linux.SOCK_DIAG_BY_FAMILY,
+		})
+		resp.Put(&m)
+		if hasMemInfo {
+			resp.PutAttr(linux.INET_DIAG_SKMEMINFO, &memInfo)
+		}
+		if !dump {
+			return nil
+		}
+	}
+	if !dump {
+		return syserr.ErrNoFileOrDir
+	}
+	return nil
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+func (p *Protocol) ProcessMessage(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	// The legacy TCPDIAG_GETSOCK and DCCPDIAG_GETSOCK requests are not
+	// supported.
+	if msg.Header().Type != linux.SOCK_DIAG_BY_FAMILY {
+		return syserr.ErrInvalidArgument
+	}
+
+	// All requests start with the family and protocol. See
+	// net/core/sock_diag.c:__sock_diag_cmd.
+	var req linux.SockDiagReq
+	if _, ok := msg.GetData(&req); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	switch req.Family {
+	case linux.AF_INET, linux.AF_INET6:
+		return p.inetDiag(ctx, msg, ms)
+	default:
+		// There is no handler for this family.
+		return syserr.ErrNoFileOrDir
+	}
+}
+
+// init registers the NETLINK_SOCK_DIAG provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_SOCK_DIAG, NewProtocol)
+}
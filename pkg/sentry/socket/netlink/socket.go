@@ -25,9 +25,11 @@ import (
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/marshal"
 	"gvisor.dev/gvisor/pkg/marshal/primitive"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
@@ -78,6 +80,12 @@ type Socket struct {
 	// protocol is the netlink protocol implementation.
 	protocol Protocol
 
+	// netns is the network namespace the socket was created in. Like in
+	// Linux, messages are processed in it rather than in the network
+	// namespace of the sender. It holds a reference on the namespace and may
+	// be nil if the creating task was exiting.
+	netns *inet.Namespace
+
 	// skType is the socket type. This is either SOCK_DGRAM or SOCK_RAW for
 	// netlink sockets.
 	skType linux.SockType
@@ -99,6 +107,10 @@ type Socket struct {
 	// portID is the port ID allocated for this socket.
 	portID int32
 
+	// groups is the set of multicast groups this socket is a member of, as a
+	// bitmask. It is only non-zero if protocol is a MulticastProtocol.
+	groups uint32
+
 	// sendBufferSize is the send buffer "size". We don't actually have a
 	// fixed buffer but only consume this many bytes.
 	sendBufferSize uint32
@@ -135,6 +147,7 @@ func New(t *kernel.Task, skType linux.SockType, protocol Protocol) (*Socket, *sy
 	fd := &Socket{
 		ports:          t.Kernel().NetlinkPorts(),
 		protocol:       protocol,
+		netns:          t.GetNetworkNamespace(),
 		skType:         skType,
 		ep:             ep,
 		connection:     connection,
@@ -148,12 +161,25 @@ func New(t *kernel.Task, skType linux.SockType, protocol Protocol) (*Socket, *sy
 func (s *Socket) Release(ctx context.Context) {
 	t := kernel.TaskFromContext(ctx)
 	t.Kernel().DeleteSocket(&s.vfsfd)
+
+	// Leave multicast groups before releasing the connection, so that no
+	// further notifications are sent to it.
+	s.mu.Lock()
+	if s.groups != 0 {
+		s.setGroupsLocked(ctx, 0)
+	}
+	s.mu.Unlock()
+
 	s.connection.Release(ctx)
 	s.ep.Close(ctx)
 
 	if s.bound {
 		s.ports.Release(s.protocol.Protocol(), s.portID)
 	}
+
+	if s.netns != nil {
+		s.netns.DecRef(ctx)
+	}
 }
 
 // Epollable implements FileDescriptionImpl.Epollable.
@@ -292,6 +318,39 @@ func (s *Socket) bindPort(t *kernel.Task, port int32) *syserr.Error {
 	return nil
 }
 
+// setGroupsLocked changes the set of multicast groups that s is a member of.
+//
+// Preconditions: s.mu is held.
+func (s *Socket) setGroupsLocked(ctx context.Context, groups uint32) *syserr.Error {
+	if groups == s.groups {
+		return nil
+	}
+	mp, ok := s.protocol.(MulticastProtocol)
+	if !ok {
+		return syserr.ErrPermissionDenied
+	}
+	if err := mp.SetGroups(ctx, s, groups); err != nil {
+		return err
+	}
+	s.groups = groups
+	return nil
+}
+
+// canJoinGroups returns an error if t may not make s join multicast groups.
+//
+// Linux only permits unprivileged receipt of multicast messages for a few
+// protocols (those with NL_CFG_F_NONROOT_RECV), none of which implement
+// MulticastProtocol here.
+func (s *Socket) canJoinGroups(t *kernel.Task) *syserr.Error {
+	if _, ok := s.protocol.(MulticastProtocol); !ok {
+		return syserr.ErrPermissionDenied
+	}
+	if !t.HasCapability(linux.CAP_NET_ADMIN) {
+		return syserr.ErrPermissionDenied
+	}
+	return nil
+}
+
 // Bind implements socket.Socket.Bind.
 func (s *Socket) Bind(t *kernel.Task, sockaddr []byte) *syserr.Error {
 	a, err := ExtractSockAddr(sockaddr)
@@ -299,15 +358,19 @@ func (s *Socket) Bind(t *kernel.Task, sockaddr []byte) *syserr.Error {
 		return err
 	}
 
-	// No support for multicast groups yet.
 	if a.Groups != 0 {
-		return syserr.ErrPermissionDenied
+		if err := s.canJoinGroups(t); err != nil {
+			return err
+		}
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.bindPort(t, int32(a.PortID))
+	if err := s.bindPort(t, int32(a.PortID)); err != nil {
+		return err
+	}
+	return s.setGroupsLocked(t, a.Groups)
 }
 
 // Connect implements socket.Socket.Connect.
@@ -405,11 +468,18 @@ func (s *Socket) GetSockOpt(t *kernel.Task, level int, name int, outPtr hostarch
 		}
 	case linux.SOL_NETLINK:
 		switch name {
+		case linux.NETLINK_LIST_MEMBERSHIPS:
+			if outLen < sizeOfInt32 {
+				return nil, syserr.ErrInvalidArgument
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return primitive.AllocateUint32(s.groups), nil
+
 		case linux.NETLINK_BROADCAST_ERROR,
 			linux.NETLINK_CAP_ACK,
 			linux.NETLINK_DUMP_STRICT_CHK,
 			linux.NETLINK_EXT_ACK,
-			linux.NETLINK_LIST_MEMBERSHIPS,
 			linux.NETLINK_NO_ENOBUFS,
 			linux.NETLINK_PKTINFO:
 			// Not supported.
@@ -516,10 +586,31 @@ func (s *Socket) SetSockOpt(t *kernel.Task, level int, name int, opt []byte) *sy
 		}
 	case linux.SOL_NETLINK:
 		switch name {
-		case linux.NETLINK_ADD_MEMBERSHIP,
-			linux.NETLINK_BROADCAST_ERROR,
+		case linux.NETLINK_ADD_MEMBERSHIP, linux.NETLINK_DROP_MEMBERSHIP:
+			if len(opt) < sizeOfInt32 {
+				return syserr.ErrInvalidArgument
+			}
+			if err := s.canJoinGroups(t); err != nil {
+				return err
+			}
+			// Groups are numbered from 1. Only the first 32 groups, which
+			// can also be joined by bind(2), are supported.
+			group := hostarch.ByteOrder.Uint32(opt)
+			if group == 0 || group > 32 {
+				return syserr.ErrInvalidArgument
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			groups := s.groups
+			if name == linux.NETLINK_ADD_MEMBERSHIP {
+				groups |= 1 << (group - 1)
+			} else {
+				groups &^= 1 << (group - 1)
+			}
+			return s.setGroupsLocked(t, groups)
+
+		case linux.NETLINK_BROADCAST_ERROR,
 			linux.NETLINK_CAP_ACK,
-			linux.NETLINK_DROP_MEMBERSHIP,
 			linux.NETLINK_DUMP_STRICT_CHK,
 			linux.NETLINK_EXT_ACK,
 			linux.NETLINK_LISTEN_ALL_NSID,
@@ -541,6 +632,7 @@ func (s *Socket) GetSockName(t *kernel.Task) (linux.SockAddr, uint32, *syserr.Er
 	sa := &linux.SockAddrNetlink{
 		Family: linux.AF_NETLINK,
 		PortID: uint32(s.portID),
+		Groups: s.groups,
 	}
 	return sa, uint32(sa.SizeBytes()), nil
 }
@@ -704,6 +796,17 @@ func (s *Socket) sendResponse(ctx context.Context, ms *MessageSet) *syserr.Error
 	return nil
 }
 
+// SendNotification sends the messages in ms to userspace. It is used by
+// protocols to send messages to sockets that are members of multicast groups.
+//
+// Unlike responses to requests, notifications that don't fit in the receive
+// buffer are dropped silently.
+func (s *Socket) SendNotification(ctx context.Context, ms *MessageSet) {
+	if err := s.sendResponse(ctx, ms); err != nil {
+		log.Debugf("Dropping netlink notification: %v", err)
+	}
+}
+
 func dumpErrorMessage(hdr linux.NetlinkMessageHeader, ms *MessageSet, err *syserr.Error) {
 	m := ms.AddMessage(linux.NetlinkMessageHeader{
 		Type: linux.NLMSG_ERROR,
@@ -727,6 +830,9 @@ func dumpAckMessage(hdr linux.NetlinkMessageHeader, ms *MessageSet) {
 // processMessages handles each message in buf, passing it to the protocol
 // handler for final handling.
 func (s *Socket) processMessages(ctx context.Context, buf []byte) *syserr.Error {
+	if s.netns != nil {
+		ctx = inet.ContextWithNamespace(ctx, s.netns)
+	}
 	for len(buf) > 0 {
 		msg, rest, ok := ParseMessage(buf)
 		if !ok {
@@ -738,7 +844,7 @@ func (s *Socket) processMessages(ctx context.Context, buf []byte) *syserr.Error
 		hdr := msg.Header()
 
 		// Ignore control messages.
-		if hdr.Type < linux.NLMSG_MIN_TYPE {
+		if _, ok := s.protocol.(ControlMessageProtocol); !ok && hdr.Type < linux.NLMSG_MIN_TYPE {
 			continue
 		}
 
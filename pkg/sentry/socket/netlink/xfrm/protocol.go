@@ -0,0 +1,498 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package xfrm provides a NETLINK_XFRM socket protocol, which configures the
+// IPsec security associations and policies of netstack.
+//
+// Only ESP security associations in transport mode using the
+// rfc4106(gcm(aes)) AEAD are supported.
+package xfrm
+
+import (
+	"math/bits"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netstack"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// Protocol implements netlink.Protocol.
+//
+// +stateify savable
+type Protocol struct{}
+
+var _ netlink.Protocol = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_XFRM netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	return &Protocol{}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_XFRM
+}
+
+// CanSend implements netlink.Protocol.CanSend.
+func (p *Protocol) CanSend() bool {
+	return true
+}
+
+// ntohl converts a 32-bit number from network byte order to host byte order.
+// Like socket.Ntohs, it assumes that the host is little endian.
+func ntohl(v uint32) uint32 {
+	return bits.ReverseBytes32(v)
+}
+
+// translateError converts an error from the XFRM databases of netstack.
+func translateError(err tcpip.Error) *syserr.Error {
+	if _, ok := err.(*tcpip.ErrNoSuchFile); ok {
+		// Linux returns ESRCH for missing states and policies.
+		return syserr.ErrNoProcess
+	}
+	return syserr.TranslateNetstackError(err)
+}
+
+func netProto(family uint16) tcpip.NetworkProtocolNumber {
+	switch family {
+	case linux.AF_INET:
+		return header.IPv4ProtocolNumber
+	case linux.AF_INET6:
+		return header.IPv6ProtocolNumber
+	default:
+		return 0
+	}
+}
+
+func family(proto tcpip.NetworkProtocolNumber) uint16 {
+	switch proto {
+	case header.IPv4ProtocolNumber:
+		return linux.AF_INET
+	case header.IPv6ProtocolNumber:
+		return linux.AF_INET6
+	default:
+		return linux.AF_UNSPEC
+	}
+}
+
+func address(family uint16, addr [16]byte) tcpip.Address {
+	switch family {
+	case linux.AF_INET:
+		return tcpip.AddrFrom4Slice(addr[:header.IPv4AddressSize])
+	case linux.AF_INET6:
+		return tcpip.AddrFrom16(addr)
+	default:
+		return tcpip.Address{}
+	}
+}
+
+func putAddress(dst *[16]byte, addr tcpip.Address) {
+	copy(dst[:], addr.AsSlice())
+}
+
+func toSelector(sel *linux.XfrmSelector) stack.XFRMSelector {
+	return stack.XFRMSelector{
+		Family:       netProto(sel.Family),
+		Src:          address(sel.Family, sel.Saddr),
+		Dst:          address(sel.Family, sel.Daddr),
+		SrcPrefixLen: sel.PrefixlenS,
+		DstPrefixLen: sel.PrefixlenD,
+		SrcPort:      socket.Ntohs(sel.Sport),
+		SrcPortMask:  socket.Ntohs(sel.SportMask),
+		DstPort:      socket.Ntohs(sel.Dport),
+		DstPortMask:  socket.Ntohs(sel.DportMask),
+		Protocol:     tcpip.TransportProtocolNumber(sel.Proto),
+	}
+}
+
+func fromSelector(s *stack.XFRMSelector) linux.XfrmSelector {
+	sel := linux.XfrmSelector{
+		Family:     family(s.Family),
+		PrefixlenS: s.SrcPrefixLen,
+		PrefixlenD: s.DstPrefixLen,
+		Sport:      socket.Htons(s.SrcPort),
+		SportMask:  socket.Htons(s.SrcPortMask),
+		Dport:      socket.Htons(s.DstPort),
+		DportMask:  socket.Htons(s.DstPortMask),
+		Proto:      uint8(s.Protocol),
+	}
+	putAddress(&sel.Saddr, s.Src)
+	putAddress(&sel.Daddr, s.Dst)
+	return sel
+}
+
+// infiniteLifetime is the lifetime configuration reported for all states and
+// policies, which never expire.
+var infiniteLifetime = linux.XfrmLifetimeCfg{
+	SoftByteLimit:   linux.XFRM_INF,
+	HardByteLimit:   linux.XFRM_INF,
+	SoftPacketLimit: linux.XFRM_INF,
+	HardPacketLimit: linux.XFRM_INF,
+}
+
+// cString returns the NUL-terminated string in b.
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+// newSA handles XFRM_MSG_NEWSA and XFRM_MSG_UPDSA requests.
+func (p *Protocol) newSA(x *stack.XFRM, msg *netlink.Message, update bool) *syserr.Error {
+	var info linux.XfrmUsersaInfo
+	attrs, ok := msg.GetData(&info)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	if info.ID.Proto != linux.IPPROTO_ESP {
+		return syserr.ErrProtocolNotSupported
+	}
+	if info.Mode != linux.XFRM_MODE_TRANSPORT {
+		return syserr.ErrNotSupported
+	}
+	if info.Family != linux.AF_INET && info.Family != linux.AF_INET6 {
+		return syserr.ErrAddressFamilyNotSupported
+	}
+	st := stack.XFRMState{
+		Dst:          address(info.Family, info.ID.Daddr),
+		SPI:          ntohl(info.ID.SPI),
+		Proto:        header.ESPProtocolNumber,
+		Src:          address(info.Family, info.Saddr),
+		Family:       netProto(info.Family),
+		Mode:         stack.XFRMModeTransport,
+		ReqID:        info.Reqid,
+		ReplayWindow: info.ReplayWindow,
+		Selector:     toSelector(&info.Sel),
+	}
+	for !attrs.Empty() {
+		ahdr, value, rest, ok := attrs.ParseFirst()
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		attrs = rest
+
+		switch ahdr.Type {
+		case linux.XFRMA_ALG_AEAD:
+			if len(value) < linux.XfrmAlgoAEADSize {
+				return syserr.ErrInvalidArgument
+			}
+			var algo linux.XfrmAlgoAEAD
+			algo.UnmarshalUnsafe(value)
+			keyLen := int(algo.KeyLen+7) / 8
+			if len(value) < linux.XfrmAlgoAEADSize+keyLen {
+				return syserr.ErrInvalidArgument
+			}
+			st.AEADName = cString(algo.Name[:])
+			st.AEADKey = value[linux.XfrmAlgoAEADSize : linux.XfrmAlgoAEADSize+keyLen]
+			st.ICVLen = int(algo.ICVLen / 8)
+		case linux.XFRMA_ALG_AUTH, linux.XFRMA_ALG_CRYPT, linux.XFRMA_ALG_COMP, linux.XFRMA_ENCAP:
+			return syserr.ErrNotSupported
+		default:
+			// Ignore other attributes, like Linux does for unknown ones.
+		}
+	}
+	if st.AEADName == "" {
+		return syserr.ErrInvalidArgument
+	}
+	return translateError(x.AddState(st, update))
+}
+
+// putSA adds a XFRM_MSG_NEWSA message describing st to ms.
+func putSA(ms *netlink.MessageSet, st *stack.XFRMStateInfo) {
+	info := linux.XfrmUsersaInfo{
+		Sel: fromSelector(&st.Selector),
+		ID: linux.XfrmID{
+			SPI:   ntohl(st.SPI),
+			Proto: uint8(st.Proto),
+		},
+		Lft: infiniteLifetime,
+		Curlft: linux.XfrmLifetimeCur{
+			Bytes:   st.Stats.Bytes,
+			Packets: st.Stats.Packets,
+		},
+		Stats: linux.XfrmStats{
+			Replay:          st.Stats.ReplayDropped,
+			IntegrityFailed: st.Stats.IntegrityFailed,
+		},
+		Reqid:        st.ReqID,
+		Family:       family(st.Family),
+		Mode:         linux.XFRM_MODE_TRANSPORT,
+		ReplayWindow: st.ReplayWindow,
+	}
+	putAddress(&info.ID.Daddr, st.Dst)
+	putAddress(&info.Saddr, st.Src)
+
+	algo := linux.XfrmAlgoAEAD{
+		KeyLen: uint32(len(st.AEADKey) * 8),
+		ICVLen: uint32(st.ICVLen * 8),
+	}
+	copy(algo.Name[:], st.AEADName)
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.XFRM_MSG_NEWSA,
+	})
+	m.Put(&info)
+	m.PutAttr(linux.XFRMA_ALG_AEAD, primitive.AsByteSlice(append(marshal.Marshal(&algo), st.AEADKey...)))
+}
+
+// getSA handles XFRM_MSG_GETSA requests.
+func (p *Protocol) getSA(x *stack.XFRM, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	if msg.Header().Flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP {
+		// We always send back an NLMSG_DONE.
+		ms.Multi = true
+		for _, st := range x.States() {
+			putSA(ms, &st)
+		}
+		return nil
+	}
+	var id linux.XfrmUsersaID
+	if _, ok := msg.GetData(&id); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	st, err := x.GetState(address(id.Family, id.Daddr), ntohl(id.SPI), tcpip.TransportProtocolNumber(id.Proto))
+	if err != nil {
+		return translateError(err)
+	}
+	putSA(ms, &st)
+	return nil
+}
+
+// delSA handles XFRM_MSG_DELSA requests.
+func (p *Protocol) delSA(x *stack.XFRM, msg *netlink.Message) *syserr.Error {
+	var id linux.XfrmUsersaID
+	if _, ok := msg.GetData(&id); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	return translateError(x.DeleteState(address(id.Family, id.Daddr), ntohl(id.SPI), tcpip.TransportProtocolNumber(id.Proto)))
+}
+
+// flushSA handles XFRM_MSG_FLUSHSA requests.
+func (p *Protocol) flushSA(x *stack.XFRM, msg *netlink.Message) *syserr.Error {
+	var flush linux.XfrmUsersaFlush
+	if _, ok := msg.GetData(&flush); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	// IPSEC_PROTO_ANY (255) flushes states of all protocols.
+	proto := tcpip.TransportProtocolNumber(flush.Proto)
+	if flush.Proto == 255 {
+		proto = 0
+	}
+	x.FlushStates(proto)
+	return nil
+}
+
+// newPolicy handles XFRM_MSG_NEWPOLICY and XFRM_MSG_UPDPOLICY requests.
+func (p *Protocol) newPolicy(x *stack.XFRM, msg *netlink.Message, update bool) *syserr.Error {
+	var info linux.XfrmUserpolicyInfo
+	attrs, ok := msg.GetData(&info)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	if info.Dir > linux.XFRM_POLICY_FWD || info.Action > linux.XFRM_POLICY_BLOCK {
+		return syserr.ErrInvalidArgument
+	}
+	pol := stack.XFRMPolicy{
+		Selector: toSelector(&info.Sel),
+		Dir:      stack.XFRMDir(info.Dir),
+		Priority: info.Priority,
+		Action:   stack.XFRMAction(info.Action),
+	}
+	for !attrs.Empty() {
+		ahdr, value, rest, ok := attrs.ParseFirst()
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		attrs = rest
+
+		if ahdr.Type != linux.XFRMA_TMPL {
+			continue
+		}
+		var tmpl linux.XfrmUserTmpl
+		if len(value)%tmpl.SizeBytes() != 0 {
+			return syserr.ErrInvalidArgument
+		}
+		for len(value) > 0 {
+			value = tmpl.UnmarshalUnsafe(value)
+			if tmpl.ID.Proto != linux.IPPROTO_ESP {
+				return syserr.ErrProtocolNotSupported
+			}
+			if tmpl.Mode != linux.XFRM_MODE_TRANSPORT {
+				return syserr.ErrNotSupported
+			}
+			fam := tmpl.Family
+			if fam == linux.AF_UNSPEC {
+				fam = info.Sel.Family
+			}
+			pol.Templates = append(pol.Templates, stack.XFRMTemplate{
+				Dst:      address(fam, tmpl.ID.Daddr),
+				SPI:      ntohl(tmpl.ID.SPI),
+				Proto:    header.ESPProtocolNumber,
+				Src:      address(fam, tmpl.Saddr),
+				Family:   netProto(fam),
+				ReqID:    tmpl.Reqid,
+				Mode:     stack.XFRMModeTransport,
+				Optional: tmpl.Optional != 0,
+			})
+		}
+	}
+	_, err := x.AddPolicy(pol, update)
+	return translateError(err)
+}
+
+// putPolicy adds a XFRM_MSG_NEWPOLICY message describing pol to ms.
+func putPolicy(ms *netlink.MessageSet, pol *stack.XFRMPolicy) {
+	info := linux.XfrmUserpolicyInfo{
+		Sel:      fromSelector(&pol.Selector),
+		Lft:      infiniteLifetime,
+		Priority: pol.Priority,
+		Index:    pol.Index,
+		Dir:      uint8(pol.Dir),
+		Action:   uint8(pol.Action),
+	}
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.XFRM_MSG_NEWPOLICY,
+	})
+	m.Put(&info)
+	if len(pol.Templates) == 0 {
+		return
+	}
+	var tmpls []byte
+	for _, t := range pol.Templates {
+		tmpl := linux.XfrmUserTmpl{
+			ID: linux.XfrmID{
+				SPI:   ntohl(t.SPI),
+				Proto: uint8(t.Proto),
+			},
+			Family: family(t.Family),
+			Reqid:  t.ReqID,
+			Mode:   linux.XFRM_MODE_TRANSPORT,
+			// Linux reports all algorithms as allowed by default.
+			Aalgos: ^uint32(0),
+			Ealgos: ^uint32(0),
+			Calgos: ^uint32(0),
+		}
+		if t.Optional {
+			tmpl.Optional = 1
+		}
+		putAddress(&tmpl.ID.Daddr, t.Dst)
+		putAddress(&tmpl.Saddr, t.Src)
+		tmpls = append(tmpls, marshal.Marshal(&tmpl)...)
+	}
+	m.PutAttr(linux.XFRMA_TMPL, primitive.AsByteSlice(tmpls))
+}
+
+// policyID returns the ID of the policy targeted by XFRM_MSG_GETPOLICY and
+// XFRM_MSG_DELPOLICY requests.
+func policyID(msg *netlink.Message) (stack.XFRMDir, stack.XFRMSelector, uint32, *syserr.Error) {
+	var id linux.XfrmUserpolicyID
+	if _, ok := msg.GetData(&id); !ok {
+		return 0, stack.XFRMSelector{}, 0, syserr.ErrInvalidArgument
+	}
+	if id.Dir > linux.XFRM_POLICY_FWD {
+		return 0, stack.XFRMSelector{}, 0, syserr.ErrInvalidArgument
+	}
+	return stack.XFRMDir(id.Dir), toSelector(&id.Sel), id.Index, nil
+}
+
+// getPolicy handles XFRM_MSG_GETPOLICY requests.
+func (p *Protocol) getPolicy(x *stack.XFRM, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	if msg.Header().Flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP {
+		// We always send back an NLMSG_DONE.
+		ms.Multi = true
+		for _, pol := range x.Policies() {
+			putPolicy(ms, &pol)
+		}
+		return nil
+	}
+	dir, sel, index, serr := policyID(msg)
+	if serr != nil {
+		return serr
+	}
+	pol, err := x.GetPolicy(dir, &sel, index)
+	if err != nil {
+		return translateError(err)
+	}
+	putPolicy(ms, &pol)
+	return nil
+}
+
+// delPolicy handles XFRM_MSG_DELPOLICY requests.
+func (p *Protocol) delPolicy(x *stack.XFRM, msg *netlink.Message) *syserr.Error {
+	dir, sel, index, serr := policyID(msg)
+	if serr != nil {
+		return serr
+	}
+	_, err := x.DeletePolicy(dir, &sel, index)
+	return translateError(err)
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+func (p *Protocol) ProcessMessage(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	// All XFRM requests, including GET requests which return keys, require
+	// CAP_NET_ADMIN.
+	creds := auth.CredentialsFromContext(ctx)
+	if !creds.HasCapability(linux.CAP_NET_ADMIN) {
+		return syserr.ErrPermissionDenied
+	}
+	s, ok := inet.StackFromContext(ctx).(*netstack.Stack)
+	if !ok {
+		// IPsec is only supported by netstack.
+		return syserr.ErrProtocolNotSupported
+	}
+	x := s.Stack.XFRM()
+
+	switch msg.Header().Type {
+	case linux.XFRM_MSG_NEWSA:
+		return p.newSA(x, msg, false /* update */)
+	case linux.XFRM_MSG_UPDSA:
+		return p.newSA(x, msg, true /* update */)
+	case linux.XFRM_MSG_DELSA:
+		return p.delSA(x, msg)
+	case linux.XFRM_MSG_GETSA:
+		return p.getSA(x, msg, ms)
+	case linux.XFRM_MSG_FLUSHSA:
+		return p.flushSA(x, msg)
+	case linux.XFRM_MSG_NEWPOLICY:
+		return p.newPolicy(x, msg, false /* update */)
+	case linux.XFRM_MSG_UPDPOLICY:
+		return p.newPolicy(x, msg, true /* update */)
+	case linux.XFRM_MSG_DELPOLICY:
+		return p.delPolicy(x, msg)
+	case linux.XFRM_MSG_GETPOLICY:
+		return p.getPolicy(x, msg, ms)
+	case linux.XFRM_MSG_FLUSHPOLICY:
+		x.FlushPolicies()
+		return nil
+	default:
+		return syserr.ErrNotSupported
+	}
+}
+
+// init registers the NETLINK_XFRM provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_XFRM, NewProtocol)
+}
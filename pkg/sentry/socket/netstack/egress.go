@@ -0,0 +1,139 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"bytes"
+	"io"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/socket/egressproxy"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// egressProxy returns the proxy that a connection from s to addr must be
+// tunneled through, or nil if s should connect to addr directly.
+func (s *sock) egressProxy(addr tcpip.FullAddress) *egressproxy.Config {
+	if s.skType != linux.SOCK_STREAM || (s.family != linux.AF_INET && s.family != linux.AF_INET6) {
+		return nil
+	}
+	stack, ok := s.namespace.Stack().(*Stack)
+	if !ok || stack.EgressProxy == nil || !stack.EgressProxy.ShouldProxy(addr) {
+		return nil
+	}
+	return stack.EgressProxy
+}
+
+// connectViaProxy connects s to proxy and has it set up a tunnel to addr. On
+// success, the socket reports addr as its peer.
+//
+// Unlike a direct connect, this blocks until the tunnel is established even
+// for non-blocking sockets: the application must not be able to write to the
+// socket before the proxy handshake is complete.
+//
+// On any failure, including interruption by a signal, the endpoint is
+// aborted: a connection to the proxy that is still being established, or
+// whose handshake is incomplete, must not be left behind for the application
+// to use.
+func (s *sock) connectViaProxy(t *kernel.Task, proxy *egressproxy.Config, addr tcpip.FullAddress) *syserr.Error {
+	err := s.connectBlocking(t, proxy.Addr())
+	if err == nil {
+		if herr := proxy.Handshake(&proxyConn{t: t, s: s}, addr); herr != nil {
+			err = syserr.FromError(herr)
+		}
+	}
+	if err != nil {
+		s.Endpoint.Abort()
+		return err
+	}
+
+	s.peerMu.Lock()
+	s.proxiedPeer = addr
+	s.proxied = true
+	s.peerMu.Unlock()
+	return nil
+}
+
+// proxyConn implements io.ReadWriter on a connected socket for the proxy
+// handshake, blocking t as needed.
+type proxyConn struct {
+	t *kernel.Task
+	s *sock
+}
+
+// Read implements io.Reader.Read.
+func (c *proxyConn) Read(p []byte) (int, error) {
+	var (
+		e  waiter.Entry
+		ch <-chan struct{}
+	)
+	for {
+		w := tcpip.SliceWriter(p)
+		c.s.readMu.Lock()
+		res, err := c.s.Endpoint.Read(&w, tcpip.ReadOptions{})
+		c.s.readMu.Unlock()
+		switch err.(type) {
+		case nil:
+			return res.Count, nil
+		case *tcpip.ErrClosedForReceive:
+			return 0, io.EOF
+		case *tcpip.ErrWouldBlock:
+		default:
+			return 0, syserr.TranslateNetstackError(err).ToError()
+		}
+		if ch == nil {
+			e, ch = waiter.NewChannelEntry(waiter.ReadableEvents)
+			c.s.EventRegister(&e)
+			defer c.s.EventUnregister(&e)
+			continue
+		}
+		if err := c.t.Block(ch); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write implements io.Writer.Write.
+func (c *proxyConn) Write(p []byte) (int, error) {
+	var (
+		e  waiter.Entry
+		ch <-chan struct{}
+	)
+	r := bytes.NewReader(p)
+	total := 0
+	for r.Len() > 0 {
+		n, err := c.s.Endpoint.Write(r, tcpip.WriteOptions{})
+		total += int(n)
+		if _, ok := err.(*tcpip.ErrWouldBlock); !ok {
+			if err != nil {
+				return total, syserr.TranslateNetstackError(err).ToError()
+			}
+			continue
+		}
+		if ch == nil {
+			e, ch = waiter.NewChannelEntry(waiter.WritableEvents)
+			c.s.EventRegister(&e)
+			defer c.s.EventUnregister(&e)
+			continue
+		}
+		if err := c.t.Block(ch); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -291,6 +291,14 @@ var Metrics = tcpip.Stats{
 		SpuriousRecovery:                   mustCreateMetric("/netstack/tcp/spurious_recovery", "Number of times the connection entered loss recovery spuriously."),
 		SpuriousRTORecovery:                mustCreateMetric("/netstack/tcp/spurious_rto_recovery", "Number of times the connection entered RTO spuriously."),
 		ForwardMaxInFlightDrop:             mustCreateMetric("/netstack/tcp/forward_max_in_flight_drop", "Number of connection requests dropped due to exceeding in-flight limit."),
+		MTUProbes:                          mustCreateMetric("/netstack/tcp/mtu_probes", "Number of path MTU probes sent."),
+		MTUProbeFailures:                   mustCreateMetric("/netstack/tcp/mtu_probe_failures", "Number of path MTU probes that were lost."),
+		MTUBlackholes:                      mustCreateMetric("/netstack/tcp/mtu_blackholes", "Number of times the MSS was reduced because retransmissions kept timing out."),
+		OutOfOrderQueued:                   mustCreateMetric("/netstack/tcp/out_of_order_queued", "Number of segments queued because they arrived out of order."),
+		OutOfOrderDropped:                  mustCreateMetric("/netstack/tcp/out_of_order_dropped", "Number of out-of-order segments dropped because they didn't fit in the out-of-order memory budget."),
+		OutOfOrderDroppedStackBudget:       mustCreateMetric("/netstack/tcp/out_of_order_dropped_stack_budget", "Number of out-of-order segments dropped because other endpoints used up the stack-wide out-of-order memory budget."),
+		OutOfOrderPruned:                   mustCreateMetric("/netstack/tcp/out_of_order_pruned", "Number of queued out-of-order segments dropped to make room for segments closer to the next expected sequence number."),
+		CurrentOutOfOrderBytes:             mustCreateGauge("/netstack/tcp/current_out_of_order_bytes", "Number of bytes held by out-of-order segments now."),
 	},
 	UDP: tcpip.UDPStats{
 		PacketsReceived:          mustCreateMetric("/netstack/udp/packets_received", "Number of UDP datagrams received via HandlePacket."),
@@ -384,12 +392,30 @@ type sock struct {
 	// TODO(b/153685824): Move this to SocketOptions.
 	// sockOptInq corresponds to TCP_INQ.
 	sockOptInq bool
+
+	// peerMu protects the fields below.
+	peerMu sync.Mutex `state:"nosave"`
+
+	// proxied is true if the socket was connected through an egress proxy,
+	// in which case proxiedPeer is the address the application connected
+	// to.
+	proxied     bool
+	proxiedPeer tcpip.FullAddress
+
+	// packet holds the state of AF_PACKET sockets that isn't held by their
+	// endpoint.
+	packet packetState
 }
 
 var _ = socket.Socket(&sock{})
 
 // New creates a new endpoint socket.
 func New(t *kernel.Task, family int, skType linux.SockType, protocol int, queue *waiter.Queue, endpoint tcpip.Endpoint) (*vfs.FileDescription, *syserr.Error) {
+	return newSock(t, t.NetworkNamespace(), family, skType, protocol, queue, endpoint)
+}
+
+// newSock is New for a socket in the network namespace namespace.
+func newSock(t *kernel.Task, namespace *inet.Namespace, family int, skType linux.SockType, protocol int, queue *waiter.Queue, endpoint tcpip.Endpoint) (*vfs.FileDescription, *syserr.Error) {
 	if skType == linux.SOCK_STREAM {
 		endpoint.SocketOptions().SetDelayOption(true)
 	}
@@ -398,7 +424,6 @@ func New(t *kernel.Task, family int, skType linux.SockType, protocol int, queue
 	d := sockfs.NewDentry(t, mnt)
 	defer d.DecRef(t)
 
-	namespace := t.NetworkNamespace()
 	s := &sock{
 		Queue:     queue,
 		family:    family,
@@ -434,20 +459,42 @@ func (s *sock) Release(ctx context.Context) {
 	if family, skType, _ := s.Type(); skType == linux.SOCK_STREAM && (family == linux.AF_INET || family == linux.AF_INET6) {
 		v := s.Endpoint.SocketOptions().GetLinger()
 		// The case for zero timeout is handled in tcp endpoint close function.
-		// Close is blocked until either:
-		// 1. The endpoint state is not in any of the states: FIN-WAIT1,
-		// CLOSING and LAST_ACK.
-		// 2. Timeout is reached.
 		if v.Enabled && v.Timeout != 0 {
-			t := kernel.TaskFromContext(ctx)
-			start := t.Kernel().MonotonicClock().Now()
-			deadline := start.Add(v.Timeout)
-			_ = t.BlockWithDeadline(ch, true, deadline)
+			if t := kernel.TaskFromContext(ctx); t != nil {
+				s.lingerClose(t, ch, v.Timeout)
+			}
 		}
 	}
+	if s.family == linux.AF_PACKET {
+		s.releasePacketRing()
+	}
 	s.namespace.DecRef(ctx)
 }
 
+// lingerClose blocks t until either:
+// 1. The endpoint state is not in any of the states: FIN-WAIT1, CLOSING and
+// LAST_ACK, i.e. our FIN has been acknowledged by the peer.
+// 2. Timeout is reached.
+// 3. t is interrupted.
+//
+// This mirrors Linux's sk_stream_wait_close().
+func (s *sock) lingerClose(t *kernel.Task, ch <-chan struct{}, timeout time.Duration) {
+	// Linux converts l_linger to an unsigned jiffies count, so negative
+	// values linger without a deadline.
+	haveDeadline := timeout > 0
+	deadline := t.Kernel().MonotonicClock().Now().Add(timeout)
+	for {
+		switch tcp.EndpointState(s.Endpoint.State()) {
+		case tcp.StateFinWait1, tcp.StateClosing, tcp.StateLastAck:
+		default:
+			return
+		}
+		if err := t.BlockWithDeadline(ch, haveDeadline, deadline); err != nil {
+			return
+		}
+	}
+}
+
 // Epollable implements FileDescriptionImpl.Epollable.
 func (s *sock) Epollable() bool {
 	return true
@@ -519,7 +566,9 @@ func (s *sock) Accept(t *kernel.Task, peerRequested bool, flags int, blocking bo
 		}
 	}
 
-	ns, err := New(t, s.family, s.skType, s.protocol, wq, ep)
+	// Like Linux, the accepted socket belongs to the listening socket's
+	// network namespace rather than to the caller's.
+	ns, err := newSock(t, s.namespace, s.family, s.skType, s.protocol, wq, ep)
 	if err != nil {
 		return 0, nil, 0, err
 	}
@@ -540,7 +589,7 @@ func (s *sock) Accept(t *kernel.Task, peerRequested bool, flags int, blocking bo
 		CloseOnExec: flags&linux.SOCK_CLOEXEC != 0,
 	})
 
-	t.Kernel().RecordSocket(ns)
+	t.Kernel().RecordSocket(ns, s.namespace)
 
 	return fd, addr, addrLen, syserr.FromError(e)
 }
@@ -577,6 +626,9 @@ func (s *sock) GetSockOpt(t *kernel.Task, level, name int, outPtr hostarch.Addr,
 		}
 		return &val, nil
 	}
+	if level == linux.SOL_PACKET {
+		return s.getSockOptPacket(t, name, outPtr, outLen)
+	}
 
 	return GetSockOpt(t, s, s.Endpoint, s.family, s.skType, level, name, outPtr, outLen)
 }
@@ -607,6 +659,9 @@ func (s *sock) SetSockOpt(t *kernel.Task, level int, name int, optVal []byte) *s
 		s.sockOptInq = hostarch.ByteOrder.Uint32(optVal) != 0
 		return nil
 	}
+	if level == linux.SOL_PACKET {
+		return s.setSockOptPacket(t, name, optVal)
+	}
 
 	return SetSockOpt(t, s, s.Endpoint, level, name, optVal)
 }
@@ -642,6 +697,9 @@ func (s *sock) isPacketBased() bool {
 
 // Readiness returns a mask of ready events for socket s.
 func (s *sock) Readiness(mask waiter.EventMask) waiter.EventMask {
+	if s.family == linux.AF_PACKET {
+		return s.packetReadiness(mask)
+	}
 	return s.Endpoint.Readiness(mask)
 }
 
@@ -697,11 +755,20 @@ func (s *sock) Connect(t *kernel.Task, sockaddr []byte, blocking bool) *syserr.E
 	}
 	addr = s.mapFamily(addr, family)
 
+	if proxy := s.egressProxy(addr); proxy != nil {
+		return s.connectViaProxy(t, proxy, addr)
+	}
+
 	// Always return right away in the non-blocking case.
 	if !blocking {
 		return syserr.TranslateNetstackError(s.Endpoint.Connect(addr))
 	}
+	return s.connectBlocking(t, addr)
+}
 
+// connectBlocking connects s to addr, blocking until the connection is
+// established or fails.
+func (s *sock) connectBlocking(t *kernel.Task, addr tcpip.FullAddress) *syserr.Error {
 	// Register for notification when the endpoint becomes writable, then
 	// initiate the connection.
 	e, ch := waiter.NewChannelEntry(waiter.WritableEvents)
@@ -1086,10 +1153,78 @@ func getSockOptSocket(t *kernel.Task, s socket.Socket, ep commonEndpoint, family
 
 		v := primitive.Int32(ep.SocketOptions().GetRcvlowat())
 		return &v, nil
+
+	case linux.SO_MEMINFO:
+		// Linux truncates the output binary to outLen.
+		info := memInfo(ep)
+		buf := t.CopyScratchBuffer(info.SizeBytes())
+		info.MarshalUnsafe(buf)
+		if len(buf) > outLen {
+			buf = buf[:outLen]
+		}
+		bufP := primitive.ByteSlice(buf)
+		return &bufP, nil
 	}
 	return nil, syserr.ErrProtocolNotAvailable
 }
 
+// memInfo returns the memory usage of ep, as reported by SO_MEMINFO.
+//
+// Netstack doesn't account memory the way Linux does, so the allocation
+// fields report the amount of data queued, and fields without an equivalent
+// are 0.
+func memInfo(ep commonEndpoint) linux.SKMemInfo {
+	var info linux.SKMemInfo
+	if v, err := ep.GetSockOptInt(tcpip.ReceiveQueueSizeOption); err == nil {
+		info[linux.SK_MEMINFO_RMEM_ALLOC] = clampUint32(int64(v))
+	}
+	info[linux.SK_MEMINFO_RCVBUF] = clampUint32(ep.SocketOptions().GetReceiveBufferSize())
+	if v, err := ep.GetSockOptInt(tcpip.SendQueueSizeOption); err == nil {
+		info[linux.SK_MEMINFO_WMEM_ALLOC] = clampUint32(int64(v))
+		info[linux.SK_MEMINFO_WMEM_QUEUED] = clampUint32(int64(v))
+	}
+	info[linux.SK_MEMINFO_SNDBUF] = clampUint32(ep.SocketOptions().GetSendBufferSize())
+	info[linux.SK_MEMINFO_DROPS] = clampUint32(int64(drops(ep)))
+	return info
+}
+
+// drops returns the number of packets that were dropped by ep after being
+// delivered to it, e.g. because its receive buffer was full.
+func drops(ep commonEndpoint) uint64 {
+	se, ok := ep.(interface{ Stats() tcpip.EndpointStats })
+	if !ok {
+		return 0
+	}
+	switch stats := se.Stats().(type) {
+	case *tcpip.TransportEndpointStats:
+		return stats.ReceiveErrors.ReceiveBufferOverflow.Value() +
+			stats.ReceiveErrors.MalformedPacketsReceived.Value() +
+			stats.ReceiveErrors.ClosedReceiver.Value() +
+			stats.ReceiveErrors.ChecksumErrors.Value()
+	case *tcp.Stats:
+		return stats.ReceiveErrors.ReceiveBufferOverflow.Value() +
+			stats.ReceiveErrors.MalformedPacketsReceived.Value() +
+			stats.ReceiveErrors.ClosedReceiver.Value() +
+			stats.ReceiveErrors.ChecksumErrors.Value() +
+			stats.ReceiveErrors.SegmentQueueDropped.Value() +
+			stats.ReceiveErrors.ListenOverflowSynDrop.Value() +
+			stats.ReceiveErrors.ListenOverflowAckDrop.Value()
+	default:
+		return 0
+	}
+}
+
+// clampUint32 returns v clamped to the range of uint32.
+func clampUint32(v int64) uint32 {
+	if v < 0 {
+		return 0
+	}
+	if v > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(v)
+}
+
 // getSockOptTCP implements GetSockOpt when level is SOL_TCP.
 func getSockOptTCP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name, outLen int) (marshal.Marshallable, *syserr.Error) {
 	if !socket.IsTCP(s) {
@@ -1465,6 +1600,22 @@ func getSockOptIPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int
 		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetReceiveOriginalDstAddress()))
 		return &v, nil
 
+	case linux.IPV6_FREEBIND:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetFreeBind()))
+		return &v, nil
+
+	case linux.IPV6_TRANSPARENT:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetTransparent()))
+		return &v, nil
+
 	case linux.IPV6_RECVPKTINFO:
 		if outLen < sizeOfInt32 {
 			return nil, syserr.ErrInvalidArgument
@@ -1678,6 +1829,22 @@ func getSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetReceiveOriginalDstAddress()))
 		return &v, nil
 
+	case linux.IP_FREEBIND:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetFreeBind()))
+		return &v, nil
+
+	case linux.IP_TRANSPARENT:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetTransparent()))
+		return &v, nil
+
 	case linux.SO_ORIGINAL_DST:
 		if outLen < sockAddrInetSize {
 			return nil, syserr.ErrInvalidArgument
@@ -1774,9 +1941,10 @@ func SetSockOpt(t *kernel.Task, s socket.Socket, ep commonEndpoint, level int, n
 		return setSockOptIP(t, s, ep, name, optVal)
 
 	case linux.SOL_PACKET:
-		// gVisor doesn't support any SOL_PACKET options just return not
-		// supported. Returning nil here will result in tcpdump thinking AF_PACKET
-		// features are supported and proceed to use them and break.
+		// SOL_PACKET options are implemented by sock, as they need state
+		// that isn't held by the endpoint. Returning nil here would result
+		// in tcpdump thinking AF_PACKET features are supported and
+		// proceeding to use them and break.
 		return syserr.ErrProtocolNotAvailable
 
 	case linux.SOL_UDP,
@@ -1970,6 +2138,14 @@ func setSockOptSocket(t *kernel.Task, s socket.Socket, ep commonEndpoint, name i
 		})
 		return nil
 
+	case linux.SO_ATTACH_FILTER:
+		// TODO(gvisor.dev/issue/1119): Only packet sockets support
+		// filtering. Other sockets accept, and ignore, filters.
+		if family, _, _ := s.Type(); family != linux.AF_PACKET {
+			return nil
+		}
+		return attachPacketFilter(t, ep, optVal)
+
 	case linux.SO_DETACH_FILTER:
 		// optval is ignored.
 		var v tcpip.SocketDetachFilterOption
@@ -2103,7 +2279,7 @@ func setSockOptTCP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 		if v < 0 {
 			v = 0
 		}
-		opt := tcpip.TCPDeferAcceptOption(time.Second * time.Duration(v))
+		opt := tcpip.TCPDeferAcceptOption(deferAcceptRetransTimeout(v))
 		return syserr.TranslateNetstackError(ep.SetSockOpt(&opt))
 
 	case linux.TCP_SYNCNT:
@@ -2129,6 +2305,35 @@ func setSockOptTCP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 	return nil
 }
 
+// deferAcceptRetransTimeout rounds a TCP_DEFER_ACCEPT value in seconds up to
+// the total time spent on the smallest number of SYN-ACK retransmissions that
+// covers it.
+//
+// Linux stores TCP_DEFER_ACCEPT as a retransmission count (see
+// net/ipv4/tcp.c:secs_to_retrans()) and converts it back on getsockopt, so
+// e.g. setting 5 reads back as 7 (1 + 2 + 4).
+func deferAcceptRetransTimeout(secs int32) time.Duration {
+	const (
+		initialTimeout = time.Second
+		maxTimeout     = 120 * time.Second
+		maxRetrans     = 255
+	)
+	want := time.Duration(secs) * time.Second
+	if want <= 0 {
+		return 0
+	}
+	timeout := initialTimeout
+	period := timeout
+	for retrans := 1; want > period && retrans < maxRetrans; retrans++ {
+		timeout *= 2
+		if timeout > maxTimeout {
+			timeout = maxTimeout
+		}
+		period += timeout
+	}
+	return period
+}
+
 func setSockOptICMPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int, optVal []byte) *syserr.Error {
 	if _, ok := ep.(tcpip.Endpoint); !ok {
 		log.Warningf("SOL_ICMPV6 options not supported on endpoints other than tcpip.Endpoint: option = %d", name)
@@ -2236,6 +2441,23 @@ func setSockOptIPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int
 		ep.SocketOptions().SetReceiveOriginalDstAddress(v != 0)
 		return nil
 
+	case linux.IPV6_FREEBIND:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := int32(hostarch.ByteOrder.Uint32(optVal))
+
+		ep.SocketOptions().SetFreeBind(v != 0)
+		return nil
+
+	case linux.IPV6_TRANSPARENT:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := int32(hostarch.ByteOrder.Uint32(optVal))
+
+		return setTransparent(t, ep, v != 0)
+
 	case linux.IPV6_RECVPKTINFO:
 		if len(optVal) < sizeOfInt32 {
 			return syserr.ErrInvalidArgument
@@ -2543,6 +2765,29 @@ func setSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 		ep.SocketOptions().SetReceiveOriginalDstAddress(v != 0)
 		return nil
 
+	case linux.IP_FREEBIND:
+		if len(optVal) == 0 {
+			return nil
+		}
+		v, err := parseIntOrChar(optVal)
+		if err != nil {
+			return err
+		}
+
+		ep.SocketOptions().SetFreeBind(v != 0)
+		return nil
+
+	case linux.IP_TRANSPARENT:
+		if len(optVal) == 0 {
+			return nil
+		}
+		v, err := parseIntOrChar(optVal)
+		if err != nil {
+			return err
+		}
+
+		return setTransparent(t, ep, v != 0)
+
 	case linux.IPT_SO_SET_REPLACE:
 		if len(optVal) < linux.SizeOfIPTReplace {
 			return syserr.ErrInvalidArgument
@@ -2569,7 +2814,6 @@ func setSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 		linux.IP_BLOCK_SOURCE,
 		linux.IP_CHECKSUM,
 		linux.IP_DROP_SOURCE_MEMBERSHIP,
-		linux.IP_FREEBIND,
 		linux.IP_IPSEC_POLICY,
 		linux.IP_MINTTL,
 		linux.IP_MSFILTER,
@@ -2581,7 +2825,6 @@ func setSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 		linux.IP_RECVFRAGSIZE,
 		linux.IP_RECVOPTS,
 		linux.IP_RETOPTS,
-		linux.IP_TRANSPARENT,
 		linux.IP_UNBLOCK_SOURCE,
 		linux.IP_UNICAST_IF,
 		linux.IP_XFRM_POLICY,
@@ -2597,6 +2840,16 @@ func setSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 	return nil
 }
 
+// setTransparent sets IP(V6)_TRANSPARENT on ep. As in Linux, enabling it
+// requires CAP_NET_RAW or CAP_NET_ADMIN.
+func setTransparent(t *kernel.Task, ep commonEndpoint, v bool) *syserr.Error {
+	if creds := auth.CredentialsFromContext(t); v && !creds.HasCapability(linux.CAP_NET_RAW) && !creds.HasCapability(linux.CAP_NET_ADMIN) {
+		return syserr.ErrNotPermitted
+	}
+	ep.SocketOptions().SetTransparent(v)
+	return nil
+}
+
 // GetSockName implements the linux syscall getsockname(2) for sockets backed by
 // tcpip.Endpoint.
 func (s *sock) GetSockName(*kernel.Task) (linux.SockAddr, uint32, *syserr.Error) {
@@ -2617,6 +2870,14 @@ func (s *sock) GetPeerName(*kernel.Task) (linux.SockAddr, uint32, *syserr.Error)
 		return nil, 0, syserr.TranslateNetstackError(err)
 	}
 
+	// Report the destination, not the proxy, for connections tunneled
+	// through an egress proxy.
+	s.peerMu.Lock()
+	if s.proxied {
+		addr = s.proxiedPeer
+	}
+	s.peerMu.Unlock()
+
 	a, l := socket.ConvertAddress(s.family, addr)
 	return a, l, nil
 }
@@ -3335,6 +3596,11 @@ func nicStateFlagsToLinux(f stack.NICStateFlags) uint32 {
 	return rv
 }
 
+// MemInfo implements socket.MemInfoSocket.MemInfo.
+func (s *sock) MemInfo() linux.SKMemInfo {
+	return memInfo(s.Endpoint)
+}
+
 // State implements socket.Socket.State. State translates the internal state
 // returned by netstack to values defined by Linux.
 func (s *sock) State() uint32 {
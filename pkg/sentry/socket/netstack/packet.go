@@ -0,0 +1,574 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"bytes"
+	"math"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/bpf"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/safemem"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// maxPacketRingSize is the largest PACKET_RX_RING that a socket may allocate.
+const maxPacketRingSize = 1 << 30
+
+// sizeOfSockFprog is the size of struct sock_fprog: a 16-bit instruction
+// count and a pointer to the instructions.
+const sizeOfSockFprog = 16
+
+// sizeOfTPacket2Hdr is the size of the TPACKET_V2 frame header, not including
+// the struct sockaddr_ll that follows it.
+var sizeOfTPacket2Hdr = uint32((*linux.TPacket2Hdr)(nil).SizeBytes())
+
+// packetState is the state of an AF_PACKET socket that isn't held by its
+// netstack endpoint: the SOL_PACKET options, and the PACKET_RX_RING through
+// which libpcap receives packets.
+//
+// +stateify savable
+type packetState struct {
+	mu sync.Mutex `state:"nosave"`
+
+	// version is the PACKET_VERSION of the ring. It is protected by mu.
+	version int32
+
+	// reserve is the PACKET_RESERVE headroom left in each frame of the ring
+	// before the packet. It is protected by mu.
+	reserve uint32
+
+	// memberships holds the PACKET_ADD_MEMBERSHIP requests that haven't been
+	// dropped. It is protected by mu.
+	//
+	// Netstack NICs deliver every frame they receive to packet endpoints, so
+	// memberships don't need to configure anything: the socket already
+	// receives all multicast, and is effectively promiscuous.
+	memberships []linux.PacketMreq
+
+	// received and drops are the endpoint's received and dropped packet
+	// counts at the last read of PACKET_STATISTICS, which resets them. They
+	// are protected by mu.
+	received uint64
+	drops    uint64
+
+	// ring is the PACKET_RX_RING, or nil if none has been set up. It is
+	// protected by mu. Once set, it isn't changed or released until the
+	// socket is released.
+	ring *packetRing
+}
+
+// packetRing is a TPACKET_V2 receive ring shared with the application. Frames
+// are owned by the sentry while their status is TP_STATUS_KERNEL; the sentry
+// fills them in order and passes them to the application by setting
+// TP_STATUS_USER, and the application returns them by resetting their status.
+//
+// +stateify savable
+type packetRing struct {
+	mfp pgalloc.MemoryFileProvider
+	fr  memmap.FileRange
+	req linux.TPacketReq
+
+	// head is the index of the next frame to be filled. It is protected by
+	// packetState.mu.
+	head uint32
+}
+
+// frame returns an internal mapping of frame i.
+func (r *packetRing) frame(i uint32) (safemem.BlockSeq, error) {
+	perBlock := r.req.BlockSize / r.req.FrameSize
+	start := r.fr.Start + uint64(i/perBlock)*uint64(r.req.BlockSize) + uint64(i%perBlock)*uint64(r.req.FrameSize)
+	return r.mfp.MemoryFile().MapInternal(memmap.FileRange{Start: start, End: start + uint64(r.req.FrameSize)}, hostarch.ReadWrite)
+}
+
+// status returns the status of frame i.
+func (r *packetRing) status(i uint32) (uint32, error) {
+	frame, err := r.frame(i)
+	if err != nil {
+		return 0, err
+	}
+	// Frames are aligned to TPACKET_ALIGNMENT, so the status word is never
+	// split between blocks.
+	return safemem.LoadUint32(frame.Head())
+}
+
+// readable returns true if the application has frames to consume. As on
+// Linux, this is the case if the most recently filled frame hasn't been
+// returned to the sentry.
+func (r *packetRing) readable() bool {
+	status, err := r.status((r.head + r.req.FrameNr - 1) % r.req.FrameNr)
+	return err == nil && status != linux.TP_STATUS_KERNEL
+}
+
+// AddMapping implements memmap.Mappable.AddMapping.
+func (r *packetRing) AddMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) error {
+	return nil
+}
+
+// RemoveMapping implements memmap.Mappable.RemoveMapping.
+func (r *packetRing) RemoveMapping(ctx context.Context, ms memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, writable bool) {
+}
+
+// CopyMapping implements memmap.Mappable.CopyMapping.
+func (r *packetRing) CopyMapping(ctx context.Context, ms memmap.MappingSpace, srcAR, dstAR hostarch.AddrRange, offset uint64, writable bool) error {
+	return nil
+}
+
+// Translate implements memmap.Mappable.Translate.
+func (r *packetRing) Translate(ctx context.Context, required, optional memmap.MappableRange, at hostarch.AccessType) ([]memmap.Translation, error) {
+	if required.End > r.fr.Length() {
+		return nil, &memmap.BusError{linuxerr.EFAULT}
+	}
+
+	if source := optional.Intersect(memmap.MappableRange{0, r.fr.Length()}); source.Length() != 0 {
+		return []memmap.Translation{
+			{
+				Source: source,
+				File:   r.mfp.MemoryFile(),
+				Offset: r.fr.Start + source.Start,
+				Perms:  at,
+			},
+		}, nil
+	}
+
+	return nil, linuxerr.EFAULT
+}
+
+// InvalidateUnsavable implements memmap.Mappable.InvalidateUnsavable.
+func (r *packetRing) InvalidateUnsavable(ctx context.Context) error {
+	return nil
+}
+
+// socketFilter is a classic BPF program attached to a packet socket with
+// SO_ATTACH_FILTER.
+//
+// +stateify savable
+type socketFilter struct {
+	program bpf.Program
+}
+
+// Filter implements tcpip.PacketFilter.Filter.
+func (f *socketFilter) Filter(pkt []byte) uint32 {
+	ret, err := bpf.Exec[bpf.BigEndian](f.program, bpf.Input(pkt))
+	if err != nil {
+		// As on Linux, packets on which the program fails, e.g. by loading
+		// past their end, are rejected.
+		return 0
+	}
+	return ret
+}
+
+// attachPacketFilter implements SO_ATTACH_FILTER for packet sockets.
+func attachPacketFilter(t *kernel.Task, ep commonEndpoint, optVal []byte) *syserr.Error {
+	if len(optVal) < sizeOfSockFprog {
+		return syserr.ErrInvalidArgument
+	}
+	n := hostarch.ByteOrder.Uint16(optVal)
+	if n == 0 || n > bpf.MaxInstructions {
+		return syserr.ErrInvalidArgument
+	}
+	insns := make([]linux.BPFInstruction, n)
+	if _, err := linux.CopyBPFInstructionSliceIn(t, hostarch.Addr(hostarch.ByteOrder.Uint64(optVal[8:])), insns); err != nil {
+		return syserr.FromError(err)
+	}
+	bpfInsns := make([]bpf.Instruction, len(insns))
+	for i, ins := range insns {
+		bpfInsns[i] = bpf.Instruction(ins)
+	}
+	program, err := bpf.Compile(bpfInsns, true /* optimize */)
+	if err != nil {
+		t.Debugf("Invalid socket filter: %v", err)
+		return syserr.ErrInvalidArgument
+	}
+	return syserr.TranslateNetstackError(ep.SetSockOpt(&tcpip.SocketAttachFilterOption{
+		Filter: &socketFilter{program: program},
+	}))
+}
+
+// getSockOptPacket implements GetSockOpt when level is SOL_PACKET.
+func (s *sock) getSockOptPacket(t *kernel.Task, name int, outPtr hostarch.Addr, outLen int) (marshal.Marshallable, *syserr.Error) {
+	if s.family != linux.AF_PACKET {
+		return nil, syserr.ErrProtocolNotAvailable
+	}
+
+	switch name {
+	case linux.PACKET_VERSION:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		s.packet.mu.Lock()
+		v := primitive.Int32(s.packet.version)
+		s.packet.mu.Unlock()
+		return &v, nil
+
+	case linux.PACKET_HDRLEN:
+		// The version to return the header length of is passed in.
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		var version primitive.Int32
+		if _, err := version.CopyIn(t, outPtr); err != nil {
+			return nil, syserr.FromError(err)
+		}
+		// Only TPACKET_V2 rings are supported. libpcap falls back to
+		// them if TPACKET_V3 isn't supported.
+		if version != linux.TPACKET_V2 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		v := primitive.Int32(sizeOfTPacket2Hdr)
+		return &v, nil
+
+	case linux.PACKET_RESERVE:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		s.packet.mu.Lock()
+		v := primitive.Int32(s.packet.reserve)
+		s.packet.mu.Unlock()
+		return &v, nil
+
+	case linux.PACKET_STATISTICS:
+		var v linux.TPacketStats
+		if outLen < v.SizeBytes() {
+			return nil, syserr.ErrInvalidArgument
+		}
+		stats := s.Endpoint.Stats().(*tcpip.TransportEndpointStats)
+		received := stats.PacketsReceived.Value()
+		drops := stats.ReceiveErrors.ReceiveBufferOverflow.Value()
+		s.packet.mu.Lock()
+		defer s.packet.mu.Unlock()
+		// As on Linux, the packet count includes dropped packets, and
+		// both counts are reset when read.
+		v.Drops = uint32(drops - s.packet.drops)
+		v.Packets = uint32(received-s.packet.received) + v.Drops
+		s.packet.received = received
+		s.packet.drops = drops
+		return &v, nil
+	}
+
+	return nil, syserr.ErrProtocolNotAvailable
+}
+
+// setSockOptPacket implements SetSockOpt when level is SOL_PACKET.
+func (s *sock) setSockOptPacket(t *kernel.Task, name int, optVal []byte) *syserr.Error {
+	if s.family != linux.AF_PACKET {
+		return syserr.ErrProtocolNotAvailable
+	}
+
+	switch name {
+	case linux.PACKET_ADD_MEMBERSHIP, linux.PACKET_DROP_MEMBERSHIP:
+		if len(optVal) < linux.SizeOfPacketMreq {
+			return syserr.ErrInvalidArgument
+		}
+		var mreq linux.PacketMreq
+		mreq.UnmarshalUnsafe(optVal)
+		if int(mreq.ALen) > len(mreq.Address) || mreq.Type > linux.PACKET_MR_UNICAST {
+			return syserr.ErrInvalidArgument
+		}
+		// Only the first ALen bytes of the address are meaningful.
+		clear(mreq.Address[mreq.ALen:])
+		stk, ok := s.namespace.Stack().(*Stack)
+		if !ok {
+			return errStackType
+		}
+		if !stk.Stack.HasNIC(tcpip.NICID(mreq.IfIndex)) {
+			return syserr.ErrNoDevice
+		}
+
+		s.packet.mu.Lock()
+		defer s.packet.mu.Unlock()
+		if name == linux.PACKET_ADD_MEMBERSHIP {
+			s.packet.memberships = append(s.packet.memberships, mreq)
+			return nil
+		}
+		for i, m := range s.packet.memberships {
+			if m == mreq {
+				s.packet.memberships = append(s.packet.memberships[:i], s.packet.memberships[i+1:]...)
+				return nil
+			}
+		}
+		return syserr.ErrAddressNotAvailable
+
+	case linux.PACKET_VERSION:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := int32(hostarch.ByteOrder.Uint32(optVal))
+		if v != linux.TPACKET_V1 && v != linux.TPACKET_V2 {
+			return syserr.ErrInvalidArgument
+		}
+		s.packet.mu.Lock()
+		defer s.packet.mu.Unlock()
+		if s.packet.ring != nil {
+			return syserr.ErrBusy
+		}
+		s.packet.version = v
+		return nil
+
+	case linux.PACKET_RESERVE:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := hostarch.ByteOrder.Uint32(optVal)
+		if v > math.MaxInt32/2 {
+			return syserr.ErrInvalidArgument
+		}
+		s.packet.mu.Lock()
+		defer s.packet.mu.Unlock()
+		if s.packet.ring != nil {
+			return syserr.ErrBusy
+		}
+		s.packet.reserve = v
+		return nil
+
+	case linux.PACKET_RX_RING:
+		if len(optVal) < linux.SizeOfTPacketReq {
+			return syserr.ErrInvalidArgument
+		}
+		var req linux.TPacketReq
+		req.UnmarshalUnsafe(optVal)
+		s.packet.mu.Lock()
+		defer s.packet.mu.Unlock()
+		return s.setPacketRingLocked(t, &req)
+	}
+
+	return syserr.ErrProtocolNotAvailable
+}
+
+// setPacketRingLocked implements PACKET_RX_RING.
+//
+// Preconditions: s.packet.mu is locked.
+func (s *sock) setPacketRingLocked(t *kernel.Task, req *linux.TPacketReq) *syserr.Error {
+	// The ring may be mapped, and it isn't possible to tell whether it
+	// still is, so it can be neither replaced nor torn down.
+	if s.packet.ring != nil {
+		return syserr.ErrBusy
+	}
+	if req.BlockNr == 0 {
+		// Tearing down a ring that doesn't exist.
+		if req.FrameNr != 0 {
+			return syserr.ErrInvalidArgument
+		}
+		return nil
+	}
+	if s.packet.version != linux.TPACKET_V2 {
+		return syserr.ErrInvalidArgument
+	}
+	if req.BlockSize == 0 || req.BlockSize%hostarch.PageSize != 0 {
+		return syserr.ErrInvalidArgument
+	}
+	if uint64(req.FrameSize) < uint64(sizeOfTPacket2Hdr)+uint64(s.packet.reserve) || req.FrameSize%linux.TPACKET_ALIGNMENT != 0 {
+		return syserr.ErrInvalidArgument
+	}
+	perBlock := req.BlockSize / req.FrameSize
+	if perBlock == 0 || uint64(perBlock)*uint64(req.BlockNr) != uint64(req.FrameNr) {
+		return syserr.ErrInvalidArgument
+	}
+	size := uint64(req.BlockSize) * uint64(req.BlockNr)
+	if size > maxPacketRingSize {
+		return syserr.ErrNoMemory
+	}
+
+	mfp := pgalloc.MemoryFileProviderFromContext(t)
+	fr, err := mfp.MemoryFile().Allocate(size, pgalloc.AllocOpts{Kind: usage.Anonymous, MemCgID: pgalloc.MemoryCgroupIDFromContext(t)})
+	if err != nil {
+		return syserr.ErrNoMemory
+	}
+	// Allocated memory is zeroed, so all frames start out as
+	// TP_STATUS_KERNEL.
+	s.packet.ring = &packetRing{
+		mfp: mfp,
+		fr:  fr,
+		req: *req,
+	}
+	return nil
+}
+
+// fillPacketRingLocked moves packets queued on the endpoint into free frames
+// of the ring, in the order in which they were received. Packets that don't
+// fit stay queued on the endpoint, and are dropped by it once its receive
+// buffer is full.
+//
+// Preconditions: s.packet.mu is locked. s.packet.ring != nil.
+func (s *sock) fillPacketRingLocked() {
+	r := s.packet.ring
+	var nics map[tcpip.NICID]stack.NICInfo
+	for {
+		frame, err := r.frame(r.head)
+		if err != nil {
+			log.Warningf("Failed to map packet ring frame %d: %v", r.head, err)
+			return
+		}
+		if status, err := safemem.LoadUint32(frame.Head()); err != nil || status != linux.TP_STATUS_KERNEL {
+			// The ring is full.
+			return
+		}
+
+		var buf bytes.Buffer
+		res, tcpipErr := s.Endpoint.Read(&buf, tcpip.ReadOptions{
+			NeedRemoteAddr:     true,
+			NeedLinkPacketInfo: true,
+		})
+		if tcpipErr != nil {
+			return
+		}
+
+		if nics == nil {
+			stk, ok := s.namespace.Stack().(*Stack)
+			if !ok {
+				return
+			}
+			nics = stk.Stack.NICInfo()
+		}
+		nic := nics[res.RemoteAddr.NIC]
+
+		// Lay out the frame as Linux does, leaving room for at least a
+		// 16 byte link header so that the network header is aligned.
+		var macOff, netOff uint32
+		if s.skType == linux.SOCK_DGRAM {
+			macOff = linux.TPacketAlign(linux.TPACKET2_HDRLEN+16) + s.packet.reserve
+			netOff = macOff
+		} else {
+			// The endpoint only reports a link address for packets with
+			// a link header, which is always an Ethernet header.
+			var macLen uint32
+			if len(res.RemoteAddr.LinkAddr) != 0 && buf.Len() >= header.EthernetMinimumSize {
+				macLen = header.EthernetMinimumSize
+			}
+			netOff = linux.TPacketAlign(linux.TPACKET2_HDRLEN+max(macLen, 16)) + s.packet.reserve
+			macOff = netOff - macLen
+		}
+		snaplen := uint32(buf.Len())
+		if macOff >= r.req.FrameSize {
+			snaplen = 0
+		} else {
+			snaplen = min(snaplen, r.req.FrameSize-macOff)
+		}
+
+		hdr := linux.TPacket2Hdr{
+			Len:     uint32(res.Total),
+			Snaplen: snaplen,
+			Mac:     uint16(macOff),
+			Net:     uint16(netOff),
+			Sec:     uint32(res.ControlMessages.Timestamp.Unix()),
+			Nsec:    uint32(res.ControlMessages.Timestamp.Nanosecond()),
+		}
+		addr := linux.SockAddrLink{
+			Family:          linux.AF_PACKET,
+			Protocol:        socket.Htons(uint16(res.LinkPacketInfo.Protocol)),
+			InterfaceIndex:  int32(res.RemoteAddr.NIC),
+			ARPHardwareType: toLinuxARPHardwareType(nic.ARPHardwareType),
+			PacketType:      toLinuxPacketType(res.LinkPacketInfo.PktType),
+			HardwareAddrLen: uint8(len(res.RemoteAddr.LinkAddr)),
+		}
+		copy(addr.HardwareAddr[:], res.RemoteAddr.LinkAddr)
+
+		// Fill in everything but the status, which passes the frame to
+		// the application and must be written last.
+		hdrBuf := make([]byte, hdr.SizeBytes())
+		hdr.MarshalUnsafe(hdrBuf)
+		addrBuf := make([]byte, addr.SizeBytes())
+		addr.MarshalUnsafe(addrBuf)
+		if err := copyToFrame(frame, macOff, buf.Bytes()[:snaplen]); err != nil {
+			log.Warningf("Failed to write packet to ring frame %d: %v", r.head, err)
+			return
+		}
+		if err := copyToFrame(frame, linux.TPacketAlign(sizeOfTPacket2Hdr), addrBuf); err != nil {
+			log.Warningf("Failed to write packet address to ring frame %d: %v", r.head, err)
+			return
+		}
+		if err := copyToFrame(frame, 4, hdrBuf[4:]); err != nil {
+			log.Warningf("Failed to write packet header to ring frame %d: %v", r.head, err)
+			return
+		}
+
+		status := uint32(linux.TP_STATUS_USER | linux.TP_STATUS_TS_SOFTWARE)
+		stats := s.Endpoint.Stats().(*tcpip.TransportEndpointStats)
+		if stats.ReceiveErrors.ReceiveBufferOverflow.Value() != s.packet.drops {
+			status |= linux.TP_STATUS_LOSING
+		}
+		if _, err := safemem.SwapUint32(frame.Head(), status); err != nil {
+			log.Warningf("Failed to write packet status to ring frame %d: %v", r.head, err)
+			return
+		}
+		r.head = (r.head + 1) % r.req.FrameNr
+	}
+}
+
+// copyToFrame copies b to frame at offset off.
+func copyToFrame(frame safemem.BlockSeq, off uint32, b []byte) error {
+	_, err := safemem.CopySeq(frame.DropFirst64(uint64(off)), safemem.BlockSeqOf(safemem.BlockFromSafeSlice(b)))
+	return err
+}
+
+// packetReadiness implements Readiness for AF_PACKET sockets.
+func (s *sock) packetReadiness(mask waiter.EventMask) waiter.EventMask {
+	s.packet.mu.Lock()
+	defer s.packet.mu.Unlock()
+	if s.packet.ring == nil {
+		return s.Endpoint.Readiness(mask)
+	}
+
+	// Packets are only moved to the ring when the application looks for
+	// them, which it does by polling the socket before reading the ring.
+	s.fillPacketRingLocked()
+	ready := s.Endpoint.Readiness(mask &^ waiter.ReadableEvents)
+	if s.packet.ring.readable() {
+		ready |= mask & waiter.ReadableEvents
+	}
+	return ready
+}
+
+// ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap. Only the
+// PACKET_RX_RING of packet sockets can be mapped.
+func (s *sock) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
+	if s.family != linux.AF_PACKET {
+		return linuxerr.ENODEV
+	}
+	s.packet.mu.Lock()
+	r := s.packet.ring
+	s.packet.mu.Unlock()
+	if r == nil || opts.Offset != 0 || opts.Length != r.fr.Length() {
+		return linuxerr.EINVAL
+	}
+	return vfs.GenericConfigureMMap(&s.vfsfd, r, opts)
+}
+
+// releasePacketRing releases the PACKET_RX_RING, if any.
+func (s *sock) releasePacketRing() {
+	s.packet.mu.Lock()
+	defer s.packet.mu.Unlock()
+	if r := s.packet.ring; r != nil {
+		r.mfp.MemoryFile().DecRef(r.fr)
+		s.packet.ring = nil
+	}
+}
@@ -23,8 +23,10 @@ import (
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/refs"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/socket/egressproxy"
 	"gvisor.dev/gvisor/pkg/syserr"
 	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/autoconf"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
@@ -37,10 +39,24 @@ import (
 // +stateify savable
 type Stack struct {
 	Stack *stack.Stack `state:"manual"`
+
+	// EgressProxy, if set, is the proxy that outbound TCP connections are
+	// tunneled through. It is immutable after the stack is created.
+	EgressProxy *egressproxy.Config
+
+	// Autoconf, if set, autoconfigures IPv6 on the stack's NICs. It is
+	// immutable after the stack is created.
+	Autoconf *autoconf.Client `state:"nosave"`
+
+	// tc holds the traffic control objects configured through netlink.
+	tc trafficControl `state:"nosave"`
 }
 
 // Destroy implements inet.Stack.Destroy.
 func (s *Stack) Destroy() {
+	if s.Autoconf != nil {
+		s.Autoconf.Stop()
+	}
 	s.Stack.Close()
 	refs.CleanupSync.Add(1)
 	go func() {
@@ -298,6 +314,33 @@ func (s *Stack) SetTCPRecovery(recovery inet.TCPLossRecovery) error {
 	return syserr.TranslateNetstackError(s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt)).ToError()
 }
 
+// TCPMTUProbing implements inet.Stack.TCPMTUProbing.
+func (s *Stack) TCPMTUProbing() (inet.TCPMTUProbing, error) {
+	var opt tcpip.TCPMTUProbingOption
+	if err := s.Stack.TransportProtocolOption(tcp.ProtocolNumber, &opt); err != nil {
+		return inet.TCPMTUProbing{}, syserr.TranslateNetstackError(err).ToError()
+	}
+	return inet.TCPMTUProbing{
+		Mode:      int32(opt.Mode),
+		BaseMSS:   int32(opt.BaseMSS),
+		Floor:     int32(opt.Floor),
+		Threshold: int32(opt.Threshold),
+		Interval:  int32(opt.Interval / time.Second),
+	}, nil
+}
+
+// SetTCPMTUProbing implements inet.Stack.SetTCPMTUProbing.
+func (s *Stack) SetTCPMTUProbing(probing inet.TCPMTUProbing) error {
+	opt := tcpip.TCPMTUProbingOption{
+		Mode:      tcpip.TCPMTUProbingMode(probing.Mode),
+		BaseMSS:   int(probing.BaseMSS),
+		Floor:     int(probing.Floor),
+		Threshold: int(probing.Threshold),
+		Interval:  time.Duration(probing.Interval) * time.Second,
+	}
+	return syserr.TranslateNetstackError(s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt)).ToError()
+}
+
 // Statistics implements inet.Stack.Statistics.
 func (s *Stack) Statistics(stat any, arg string) error {
 	switch stats := stat.(type) {
@@ -512,6 +555,21 @@ func (s *Stack) SetPortRange(start uint16, end uint16) error {
 	return syserr.TranslateNetstackError(s.Stack.SetPortRange(start, end)).ToError()
 }
 
+// DefaultTTL implements inet.Stack.DefaultTTL.
+func (s *Stack) DefaultTTL(protocol tcpip.NetworkProtocolNumber) (uint8, error) {
+	var opt tcpip.DefaultTTLOption
+	if err := s.Stack.NetworkProtocolOption(protocol, &opt); err != nil {
+		return 0, syserr.TranslateNetstackError(err).ToError()
+	}
+	return uint8(opt), nil
+}
+
+// SetDefaultTTL implements inet.Stack.SetDefaultTTL.
+func (s *Stack) SetDefaultTTL(protocol tcpip.NetworkProtocolNumber, ttl uint8) error {
+	opt := tcpip.DefaultTTLOption(ttl)
+	return syserr.TranslateNetstackError(s.Stack.SetNetworkProtocolOption(protocol, &opt)).ToError()
+}
+
 // GROTimeout implements inet.Stack.GROTimeout.
 func (s *Stack) GROTimeout(nicID int32) (time.Duration, error) {
 	timeout, err := s.Stack.GROTimeout(tcpip.NICID(nicID))
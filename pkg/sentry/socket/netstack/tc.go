@@ -0,0 +1,519 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"sort"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	// tcAutoHandle is the handle of root qdiscs created without one. It is the
+	// first handle picked by Linux.
+	tcAutoHandle = 0x80010000
+
+	// tcIngressHandle is the handle of ingress and clsact qdiscs.
+	tcIngressHandle = 0xFFFF0000
+
+	// tcAutoPriority is the priority of the first filter created without one,
+	// as in Linux. Later filters get decreasing priorities.
+	tcAutoPriority = 0xC000
+
+	// tcQueueLen is the length in packets of the queue of htb classes. It is
+	// the default txqueuelen of Linux devices.
+	tcQueueLen = 1000
+)
+
+// trafficControl holds the traffic control objects of a Stack, which are
+// translated to a stack.TrafficControl for each NIC.
+//
+// Traffic control is not saved: it must be configured again after restore.
+type trafficControl struct {
+	mu sync.Mutex
+
+	// +checklocks:mu
+	qdiscs []inet.TCQdisc
+
+	// +checklocks:mu
+	classes []inet.TCClass
+
+	// filters are sorted by priority.
+	//
+	// +checklocks:mu
+	filters []inet.TCFilter
+}
+
+var _ inet.TrafficControl = (*Stack)(nil)
+
+// TCQdiscs implements inet.TrafficControl.TCQdiscs.
+func (s *Stack) TCQdiscs() []inet.TCQdisc {
+	s.tc.mu.Lock()
+	defer s.tc.mu.Unlock()
+	qs := make([]inet.TCQdisc, 0, len(s.tc.qdiscs))
+	for _, q := range s.tc.qdiscs {
+		stats, err := s.Stack.TrafficControlStats(tcpip.NICID(q.IfIndex))
+		if err != nil {
+			// The NIC was removed.
+			continue
+		}
+		if q.Parent == linux.TC_H_INGRESS {
+			q.Stats = inet.TCStats{
+				Bytes:   stats.Ingress.Bytes,
+				Packets: stats.Ingress.Packets,
+				Drops:   stats.Ingress.Dropped,
+			}
+		} else {
+			q.Stats = shaperStats(stats)
+			q.Stats.Drops += stats.Egress.Dropped
+		}
+		qs = append(qs, q)
+	}
+	return qs
+}
+
+func shaperStats(stats stack.TCStats) inet.TCStats {
+	return inet.TCStats{
+		Bytes:      stats.Shaper.Bytes,
+		Packets:    stats.Shaper.Packets,
+		Drops:      stats.Shaper.Dropped,
+		Overlimits: stats.Shaper.Overlimits,
+		Backlog:    stats.Shaper.Backlog,
+		QLen:       stats.Shaper.QLen,
+	}
+}
+
+// SetTCQdisc implements inet.TrafficControl.SetTCQdisc.
+func (s *Stack) SetTCQdisc(q inet.TCQdisc, create, exclusive bool) error {
+	switch q.Parent {
+	case linux.TC_H_ROOT:
+		if q.Kind != "tbf" && q.Kind != "htb" {
+			return linuxerr.EOPNOTSUPP
+		}
+		if linux.TC_H_MIN(q.Handle) != 0 || q.Handle == tcIngressHandle {
+			return linuxerr.EINVAL
+		}
+	case linux.TC_H_INGRESS:
+		if q.Kind != "ingress" && q.Kind != "clsact" {
+			return linuxerr.EOPNOTSUPP
+		}
+		if q.Handle != 0 && q.Handle != tcIngressHandle {
+			return linuxerr.EINVAL
+		}
+		q.Handle = tcIngressHandle
+	default:
+		// Only root qdiscs are supported, classes can't have their own qdisc.
+		return linuxerr.EOPNOTSUPP
+	}
+	if q.Kind == "tbf" && (q.Rate == 0 || q.Burst == 0 || q.Limit == 0) {
+		return linuxerr.EINVAL
+	}
+
+	s.tc.mu.Lock()
+	defer s.tc.mu.Unlock()
+	return s.updateTCLocked(q.IfIndex, func() error {
+		i := s.tc.findQdiscLocked(q.IfIndex, q.Parent)
+		if i < 0 {
+			if !create {
+				return linuxerr.ENOENT
+			}
+			if q.Handle == 0 {
+				q.Handle = tcAutoHandle
+			}
+			s.tc.qdiscs = append(s.tc.qdiscs, q)
+			return nil
+		}
+		if exclusive {
+			return linuxerr.EEXIST
+		}
+		old := s.tc.qdiscs[i]
+		if q.Handle == 0 {
+			q.Handle = old.Handle
+		}
+		if q.Kind != old.Kind || q.Handle != old.Handle {
+			// This is a new qdisc: the classes and filters of the old one go
+			// away with it.
+			s.tc.removeChildrenLocked(old)
+		}
+		s.tc.qdiscs[i] = q
+		return nil
+	})
+}
+
+// DelTCQdisc implements inet.TrafficControl.DelTCQdisc.
+func (s *Stack) DelTCQdisc(ifIndex int32, parent, handle uint32) error {
+	s.tc.mu.Lock()
+	defer s.tc.mu.Unlock()
+	return s.updateTCLocked(ifIndex, func() error {
+		i := s.tc.findQdiscLocked(ifIndex, parent)
+		if i < 0 || (handle != 0 && handle != s.tc.qdiscs[i].Handle) {
+			return linuxerr.ENOENT
+		}
+		s.tc.removeChildrenLocked(s.tc.qdiscs[i])
+		s.tc.qdiscs = append(s.tc.qdiscs[:i], s.tc.qdiscs[i+1:]...)
+		return nil
+	})
+}
+
+// TCClasses implements inet.TrafficControl.TCClasses.
+func (s *Stack) TCClasses() []inet.TCClass {
+	s.tc.mu.Lock()
+	defer s.tc.mu.Unlock()
+	cs := make([]inet.TCClass, 0, len(s.tc.classes))
+	for _, c := range s.tc.classes {
+		stats, err := s.Stack.TrafficControlStats(tcpip.NICID(c.IfIndex))
+		if err != nil {
+			continue
+		}
+		if i := s.tc.findQdiscLocked(c.IfIndex, linux.TC_H_ROOT); i >= 0 && s.tc.isDefaultClassLocked(s.tc.qdiscs[i], c) {
+			c.Stats = shaperStats(stats)
+		}
+		cs = append(cs, c)
+	}
+	return cs
+}
+
+// SetTCClass implements inet.TrafficControl.SetTCClass.
+func (s *Stack) SetTCClass(c inet.TCClass, create, exclusive bool) error {
+	if linux.TC_H_MIN(c.Handle) == 0 || c.Rate == 0 {
+		return linuxerr.EINVAL
+	}
+	if c.Ceil == 0 {
+		c.Ceil, c.CBurst = c.Rate, c.Burst
+	}
+
+	s.tc.mu.Lock()
+	defer s.tc.mu.Unlock()
+	return s.updateTCLocked(c.IfIndex, func() error {
+		root := s.tc.findQdiscLocked(c.IfIndex, linux.TC_H_ROOT)
+		if root < 0 {
+			return linuxerr.EINVAL
+		}
+		q := s.tc.qdiscs[root]
+		if q.Kind != "htb" {
+			return linuxerr.EOPNOTSUPP
+		}
+		if linux.TC_H_MAJ(c.Handle) != q.Handle || linux.TC_H_MAJ(c.Parent) != q.Handle {
+			return linuxerr.EINVAL
+		}
+		if c.Parent != q.Handle && s.tc.findClassLocked(c.IfIndex, c.Parent) < 0 {
+			return linuxerr.ENOENT
+		}
+		i := s.tc.findClassLocked(c.IfIndex, c.Handle)
+		if i < 0 {
+			if !create {
+				return linuxerr.ENOENT
+			}
+			s.tc.classes = append(s.tc.classes, c)
+			return nil
+		}
+		if exclusive {
+			return linuxerr.EEXIST
+		}
+		s.tc.classes[i] = c
+		return nil
+	})
+}
+
+// DelTCClass implements inet.TrafficControl.DelTCClass.
+func (s *Stack) DelTCClass(ifIndex int32, handle uint32) error {
+	s.tc.mu.Lock()
+	defer s.tc.mu.Unlock()
+	return s.updateTCLocked(ifIndex, func() error {
+		i := s.tc.findClassLocked(ifIndex, handle)
+		if i < 0 {
+			return linuxerr.ENOENT
+		}
+		for _, c := range s.tc.classes {
+			if c.IfIndex == ifIndex && c.Parent == handle {
+				return linuxerr.EBUSY
+			}
+		}
+		s.tc.classes = append(s.tc.classes[:i], s.tc.classes[i+1:]...)
+		return nil
+	})
+}
+
+// TCFilters implements inet.TrafficControl.TCFilters.
+func (s *Stack) TCFilters() []inet.TCFilter {
+	s.tc.mu.Lock()
+	defer s.tc.mu.Unlock()
+	return append([]inet.TCFilter(nil), s.tc.filters...)
+}
+
+// SetTCFilter implements inet.TrafficControl.SetTCFilter.
+func (s *Stack) SetTCFilter(f inet.TCFilter, create, exclusive bool) error {
+	if f.Kind != "matchall" {
+		return linuxerr.EOPNOTSUPP
+	}
+	for _, a := range f.Actions {
+		switch a.Kind {
+		case "police":
+			if a.Rate == 0 || a.Burst == 0 {
+				return linuxerr.EINVAL
+			}
+		case "mirred":
+			if _, ok := s.Stack.NICInfo()[tcpip.NICID(a.TargetIfIndex)]; !ok {
+				return linuxerr.ENODEV
+			}
+		default:
+			return linuxerr.EOPNOTSUPP
+		}
+	}
+	if f.Handle == 0 {
+		// Like Linux's matchall classifier.
+		f.Handle = 1
+	}
+
+	s.tc.mu.Lock()
+	defer s.tc.mu.Unlock()
+	return s.updateTCLocked(f.IfIndex, func() error {
+		if _, err := s.tc.filterHookLocked(f); err != nil {
+			return err
+		}
+		if f.Priority == 0 {
+			f.Priority = tcAutoPriority
+			for _, other := range s.tc.filters {
+				if other.IfIndex == f.IfIndex && other.Parent == f.Parent && other.Priority <= f.Priority {
+					f.Priority = other.Priority - 1
+				}
+			}
+		}
+		for i, other := range s.tc.filters {
+			if other.IfIndex != f.IfIndex || other.Parent != f.Parent || other.Priority != f.Priority {
+				continue
+			}
+			if exclusive {
+				return linuxerr.EEXIST
+			}
+			if other.Handle != f.Handle {
+				// matchall supports a single filter per priority.
+				return linuxerr.EINVAL
+			}
+			s.tc.filters[i] = f
+			return nil
+		}
+		if !create {
+			return linuxerr.ENOENT
+		}
+		s.tc.filters = append(s.tc.filters, f)
+		sort.SliceStable(s.tc.filters, func(i, j int) bool {
+			return s.tc.filters[i].Priority < s.tc.filters[j].Priority
+		})
+		return nil
+	})
+}
+
+// DelTCFilter implements inet.TrafficControl.DelTCFilter.
+func (s *Stack) DelTCFilter(ifIndex int32, parent uint32, priority uint16, handle uint32) error {
+	s.tc.mu.Lock()
+	defer s.tc.mu.Unlock()
+	return s.updateTCLocked(ifIndex, func() error {
+		var kept []inet.TCFilter
+		for _, f := range s.tc.filters {
+			if f.IfIndex == ifIndex && f.Parent == parent &&
+				(priority == 0 || f.Priority == priority) &&
+				(handle == 0 || f.Handle == handle) {
+				continue
+			}
+			kept = append(kept, f)
+		}
+		if priority != 0 && len(kept) == len(s.tc.filters) {
+			return linuxerr.ENOENT
+		}
+		s.tc.filters = kept
+		return nil
+	})
+}
+
+// updateTCLocked calls update to change the traffic control objects of the
+// stack, and reconfigures the NIC with index ifIndex accordingly. Changes are
+// rolled back if update fails or if the resulting configuration is invalid.
+//
+// +checklocks:s.tc.mu
+func (s *Stack) updateTCLocked(ifIndex int32, update func() error) error {
+	nicID := tcpip.NICID(ifIndex)
+	if _, ok := s.Stack.NICInfo()[nicID]; !ok {
+		return linuxerr.ENODEV
+	}
+	qdiscs := append([]inet.TCQdisc(nil), s.tc.qdiscs...)
+	classes := append([]inet.TCClass(nil), s.tc.classes...)
+	filters := append([]inet.TCFilter(nil), s.tc.filters...)
+	err := update()
+	if err == nil {
+		err = s.applyTCLocked(nicID)
+	}
+	if err != nil {
+		s.tc.qdiscs = qdiscs
+		s.tc.classes = classes
+		s.tc.filters = filters
+	}
+	return err
+}
+
+// applyTCLocked translates the traffic control objects of the NIC to a
+// stack.TrafficControl, and applies it.
+//
+// +checklocks:s.tc.mu
+func (s *Stack) applyTCLocked(nicID tcpip.NICID) error {
+	ifIndex := int32(nicID)
+	var cfg stack.TrafficControl
+	if i := s.tc.findQdiscLocked(ifIndex, linux.TC_H_ROOT); i >= 0 {
+		q := s.tc.qdiscs[i]
+		switch q.Kind {
+		case "tbf":
+			cfg.Shaper = &stack.TCShaper{
+				TokenBucket: stack.TokenBucket{Rate: q.Rate, Burst: q.Burst},
+				Limit:       q.Limit,
+			}
+		case "htb":
+			// htb is only supported as a single shaper: traffic is shaped
+			// with the default class, at its ceil. Without a default class,
+			// Linux sends traffic unshaped.
+			for _, c := range s.tc.classes {
+				if s.tc.isDefaultClassLocked(q, c) {
+					cfg.Shaper = &stack.TCShaper{
+						TokenBucket: stack.TokenBucket{Rate: c.Ceil, Burst: c.CBurst},
+						Limit:       tcQueueLen * s.Stack.NICInfo()[nicID].MTU,
+					}
+					break
+				}
+			}
+		}
+	}
+	for _, f := range s.tc.filters {
+		if f.IfIndex != ifIndex {
+			continue
+		}
+		ingress, err := s.tc.filterHookLocked(f)
+		if err != nil {
+			return err
+		}
+		hook := &cfg.Egress
+		if ingress {
+			hook = &cfg.Ingress
+		}
+		for _, a := range f.Actions {
+			switch a.Kind {
+			case "police":
+				// Each direction supports a single policer, applied before
+				// mirrors.
+				if hook.Policer != nil {
+					return linuxerr.EOPNOTSUPP
+				}
+				hook.Policer = &stack.TokenBucket{Rate: a.Rate, Burst: a.Burst}
+			case "mirred":
+				hook.Mirrors = append(hook.Mirrors, stack.TCMirror{
+					NIC:      tcpip.NICID(a.TargetIfIndex),
+					Redirect: a.Redirect,
+				})
+			}
+		}
+	}
+	return syserr.TranslateNetstackError(s.Stack.SetTrafficControl(nicID, cfg)).ToError()
+}
+
+// findQdiscLocked returns the index of the qdisc of the interface attached to
+// parent, or -1.
+//
+// +checklocks:tc.mu
+func (tc *trafficControl) findQdiscLocked(ifIndex int32, parent uint32) int {
+	for i, q := range tc.qdiscs {
+		if q.IfIndex == ifIndex && q.Parent == parent {
+			return i
+		}
+	}
+	return -1
+}
+
+// findClassLocked returns the index of the class of the interface with the
+// given handle, or -1.
+//
+// +checklocks:tc.mu
+func (tc *trafficControl) findClassLocked(ifIndex int32, handle uint32) int {
+	for i, c := range tc.classes {
+		if c.IfIndex == ifIndex && c.Handle == handle {
+			return i
+		}
+	}
+	return -1
+}
+
+// isDefaultClassLocked returns true if c is the default class of the htb
+// qdisc q.
+//
+// +checklocks:tc.mu
+func (tc *trafficControl) isDefaultClassLocked(q inet.TCQdisc, c inet.TCClass) bool {
+	return q.Kind == "htb" && q.DefaultClass != 0 && c.IfIndex == q.IfIndex &&
+		c.Handle == linux.TC_H_MAKE(q.Handle, q.DefaultClass)
+}
+
+// removeChildrenLocked removes the classes and filters of qdisc q.
+//
+// +checklocks:tc.mu
+func (tc *trafficControl) removeChildrenLocked(q inet.TCQdisc) {
+	var classes []inet.TCClass
+	for _, c := range tc.classes {
+		if c.IfIndex != q.IfIndex || linux.TC_H_MAJ(c.Handle) != q.Handle {
+			classes = append(classes, c)
+		}
+	}
+	tc.classes = classes
+	var filters []inet.TCFilter
+	for _, f := range tc.filters {
+		if f.IfIndex != q.IfIndex || linux.TC_H_MAJ(f.Parent) != q.Handle {
+			filters = append(filters, f)
+		}
+	}
+	tc.filters = filters
+}
+
+// filterHookLocked returns true if filter f applies to received packets, and
+// false if it applies to sent packets.
+//
+// +checklocks:tc.mu
+func (tc *trafficControl) filterHookLocked(f inet.TCFilter) (bool, error) {
+	for _, q := range tc.qdiscs {
+		if q.IfIndex != f.IfIndex || q.Handle != linux.TC_H_MAJ(f.Parent) {
+			continue
+		}
+		switch q.Kind {
+		case "ingress":
+			return true, nil
+		case "clsact":
+			switch linux.TC_H_MIN(f.Parent) {
+			case linux.TC_H_MIN_INGRESS:
+				return true, nil
+			case linux.TC_H_MIN_EGRESS:
+				return false, nil
+			default:
+				return false, linuxerr.EINVAL
+			}
+		case "htb":
+			return false, nil
+		default:
+			// Like in Linux, tbf doesn't support filters.
+			return false, linuxerr.EOPNOTSUPP
+		}
+	}
+	// The parent qdisc doesn't exist.
+	return false, linuxerr.EINVAL
+}
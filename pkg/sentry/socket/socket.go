@@ -336,7 +336,7 @@ func New(t *kernel.Task, family int, stype linux.SockType, protocol int) (*vfs.F
 			return nil, err
 		}
 		if s != nil {
-			t.Kernel().RecordSocket(s)
+			t.Kernel().RecordSocket(s, t.NetworkNamespace())
 			return s, nil
 		}
 	}
@@ -359,8 +359,8 @@ func Pair(t *kernel.Task, family int, stype linux.SockType, protocol int) (*vfs.
 		}
 		if s1 != nil && s2 != nil {
 			k := t.Kernel()
-			k.RecordSocket(s1)
-			k.RecordSocket(s2)
+			k.RecordSocket(s1, t.NetworkNamespace())
+			k.RecordSocket(s2, t.NetworkNamespace())
 			return s1, s2, nil
 		}
 	}
@@ -436,6 +436,10 @@ func UnmarshalSockAddr(family int, data []byte) linux.SockAddr {
 		var addr linux.SockAddrLink
 		addr.UnmarshalUnsafe(data)
 		return &addr
+	case unix.AF_VSOCK:
+		var addr linux.SockAddrVM
+		addr.UnmarshalUnsafe(data)
+		return &addr
 	default:
 		panic(fmt.Sprintf("Unsupported socket family %v", family))
 	}
@@ -618,3 +622,22 @@ func IsRaw(s Socket) bool {
 	}
 	return typ == linux.SOCK_RAW
 }
+
+// MemInfoSocket is implemented by sockets that can report their memory usage
+// and drop count, as returned by SO_MEMINFO.
+type MemInfoSocket interface {
+	Socket
+
+	// MemInfo returns the socket's memory information.
+	MemInfo() linux.SKMemInfo
+}
+
+// MemInfo returns the memory information of s, and false if s doesn't
+// implement MemInfoSocket.
+func MemInfo(s Socket) (linux.SKMemInfo, bool) {
+	ms, ok := s.(MemInfoSocket)
+	if !ok {
+		return linux.SKMemInfo{}, false
+	}
+	return ms.MemInfo(), true
+}
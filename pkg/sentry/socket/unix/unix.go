@@ -71,14 +71,21 @@ var _ = socket.Socket(&Socket{})
 // NewSockfsFile creates a new socket file in the global sockfs mount and
 // returns a corresponding file description.
 func NewSockfsFile(t *kernel.Task, ep transport.Endpoint, stype linux.SockType) (*vfs.FileDescription, *syserr.Error) {
+	return newSockfsFile(t, t.GetNetworkNamespace(), ep, stype)
+}
+
+// newSockfsFile is NewSockfsFile for a socket in the network namespace ns. It
+// takes ownership of a reference on ns.
+func newSockfsFile(t *kernel.Task, ns *inet.Namespace, ep transport.Endpoint, stype linux.SockType) (*vfs.FileDescription, *syserr.Error) {
 	mnt := t.Kernel().SocketMount()
 	d := sockfs.NewDentry(t, mnt)
 	defer d.DecRef(t)
 
-	ns := t.GetNetworkNamespace()
 	fd, err := NewFileDescription(ep, stype, linux.O_RDWR, ns, mnt, d, &vfs.FileLocks{})
 	if err != nil {
-		ns.DecRef(t)
+		if ns != nil {
+			ns.DecRef(t)
+		}
 		return nil, syserr.FromError(err)
 	}
 	return fd, nil
@@ -179,7 +186,16 @@ func (s *Socket) Accept(t *kernel.Task, peerRequested bool, flags int, blocking
 		}
 	}
 
-	ns, err := NewSockfsFile(t, ep, s.stype)
+	// Like Linux, the accepted socket belongs to the listening socket's
+	// network namespace rather than to the caller's. Sockets imported from
+	// the host have no namespace.
+	netns := s.namespace
+	if netns != nil {
+		netns.IncRef()
+	} else {
+		netns = t.GetNetworkNamespace()
+	}
+	ns, err := newSockfsFile(t, netns, ep, s.stype)
 	if err != nil {
 		return 0, nil, 0, err
 	}
@@ -202,7 +218,7 @@ func (s *Socket) Accept(t *kernel.Task, peerRequested bool, flags int, blocking
 		return 0, nil, 0, syserr.FromError(e)
 	}
 
-	t.Kernel().RecordSocket(ns)
+	t.Kernel().RecordSocket(ns, netns)
 	return fd, addr, addrLen, nil
 }
 
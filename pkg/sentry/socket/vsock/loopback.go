@@ -0,0 +1,535 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vsock
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/sockfs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netstack"
+	"gvisor.dev/gvisor/pkg/sentry/socket/unix"
+	"gvisor.dev/gvisor/pkg/sentry/socket/unix/transport"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/usermem"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// lastReservedPort is the last port that requires CAP_NET_BIND_SERVICE to be
+// bound, from net/vmw_vsock/af_vsock.c.
+const lastReservedPort = 1023
+
+// portTable holds the ports bound by loopback sockets. AF_VSOCK isn't
+// namespaced, so there is a single table for the sandbox.
+type portTable struct {
+	mu sync.Mutex
+
+	// ports maps bound ports to their socket. It doesn't hold references on
+	// the sockets; sockets remove themselves when released.
+	ports map[uint32]*loopbackSocket
+
+	// next is the next port to try when binding to VMADDR_PORT_ANY.
+	next uint32
+}
+
+var loopbackPorts = portTable{
+	ports: make(map[uint32]*loopbackSocket),
+	next:  lastReservedPort + 1,
+}
+
+// bind binds s to port, or to a free port if port is VMADDR_PORT_ANY. It
+// returns the bound port.
+func (pt *portTable) bind(s *loopbackSocket, port uint32) (uint32, *syserr.Error) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if port != linux.VMADDR_PORT_ANY {
+		if _, ok := pt.ports[port]; ok {
+			return 0, syserr.ErrAddressInUse
+		}
+		pt.ports[port] = s
+		return port, nil
+	}
+	for i := uint32(0); i < linux.VMADDR_PORT_ANY-lastReservedPort-1; i++ {
+		port := pt.next
+		pt.next++
+		if pt.next == linux.VMADDR_PORT_ANY {
+			pt.next = lastReservedPort + 1
+		}
+		if _, ok := pt.ports[port]; !ok {
+			pt.ports[port] = s
+			return port, nil
+		}
+	}
+	return 0, syserr.ErrAddressNotAvailable
+}
+
+// remove unbinds port if it is still bound to s.
+func (pt *portTable) remove(s *loopbackSocket, port uint32) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if pt.ports[port] == s {
+		delete(pt.ports, port)
+	}
+}
+
+// connect connects ep to the socket bound to port.
+func (pt *portTable) connect(ctx context.Context, ep transport.Endpoint, port uint32) *syserr.Error {
+	// Hold mu while connecting so that the listening socket can't be released
+	// concurrently.
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	s, ok := pt.ports[port]
+	if !ok {
+		// The loopback transport of Linux resets connections to ports that
+		// nothing is bound to, rather than refusing them.
+		return syserr.ErrConnectionReset
+	}
+	bep, ok := s.ep.(transport.BoundEndpoint)
+	if !ok {
+		return syserr.ErrConnectionReset
+	}
+	switch err := ep.Connect(ctx, bep); err {
+	case syserr.ErrConnectionRefused, syserr.ErrWrongProtocolForSocket:
+		// The listening socket isn't listening or is of another type.
+		return syserr.ErrConnectionReset
+	default:
+		return err
+	}
+}
+
+// endpointAddress returns the address that a transport.Endpoint is bound to
+// for the given vsock address. Both ends of a connection learn the address of
+// the other end from their endpoints.
+func endpointAddress(cid, port uint32) transport.Address {
+	return transport.Address{Addr: fmt.Sprintf("vsock:%d:%d", cid, port)}
+}
+
+// convertAddress converts the address of a transport.Endpoint to a vsock
+// address. Endpoints that aren't bound have VMADDR_CID_ANY and
+// VMADDR_PORT_ANY as their address.
+func convertAddress(addr transport.Address) (linux.SockAddr, uint32) {
+	out := linux.SockAddrVM{
+		Family: linux.AF_VSOCK,
+		CID:    linux.VMADDR_CID_ANY,
+		Port:   linux.VMADDR_PORT_ANY,
+	}
+	if addr.Addr != "" {
+		fmt.Sscanf(addr.Addr, "vsock:%d:%d", &out.CID, &out.Port)
+	}
+	return &out, linux.SockAddrVMSize
+}
+
+// extractAddress parses a struct sockaddr_vm.
+func extractAddress(sockaddr []byte) (linux.SockAddrVM, *syserr.Error) {
+	var addr linux.SockAddrVM
+	if len(sockaddr) < linux.SockAddrVMSize {
+		return addr, syserr.ErrInvalidArgument
+	}
+	addr.UnmarshalUnsafe(sockaddr)
+	if addr.Family != linux.AF_VSOCK {
+		return addr, syserr.ErrAddressFamilyNotSupported
+	}
+	if addr.Flags&^linux.VMADDR_FLAG_TO_HOST != 0 {
+		return addr, syserr.ErrInvalidArgument
+	}
+	return addr, nil
+}
+
+// loopbackSocket is an AF_VSOCK socket provided by the loopback transport. It
+// is backed by a connection-oriented Unix domain socket endpoint, whose
+// address holds the vsock address of the socket.
+//
+// +stateify savable
+type loopbackSocket struct {
+	vfsfd vfs.FileDescription
+	vfs.FileDescriptionDefaultImpl
+	vfs.DentryMetadataFileDescriptionImpl
+	vfs.LockFD
+	socket.SendReceiveTimeout
+
+	// conn is a Unix domain socket for ep, to which reads and writes are
+	// delegated. conn owns ep.
+	conn  *vfs.FileDescription
+	ep    transport.Endpoint
+	stype linux.SockType
+
+	// cid is the context ID of the sandbox. It is immutable.
+	cid uint32
+
+	// mu protects port and bound.
+	mu sync.Mutex `state:"nosave"`
+
+	// port is the port that the socket is bound to in loopbackPorts, if bound
+	// is true. Accepted sockets have the address of their listening socket,
+	// but don't bind its port.
+	port  uint32
+	bound bool
+}
+
+var _ = socket.Socket(&loopbackSocket{})
+
+// newLoopbackSocket creates a new unbound loopback socket.
+func newLoopbackSocket(t *kernel.Task, stype linux.SockType, cid uint32) (*vfs.FileDescription, *syserr.Error) {
+	ep := transport.NewConnectioned(t, stype, t.Kernel())
+	return newLoopbackFD(t, ep, stype, cid)
+}
+
+// newLoopbackFD creates a loopback socket for ep, taking ownership of ep.
+func newLoopbackFD(t *kernel.Task, ep transport.Endpoint, stype linux.SockType, cid uint32) (*vfs.FileDescription, *syserr.Error) {
+	conn, err := unix.NewSockfsFile(t, ep, stype)
+	if err != nil {
+		ep.Close(t)
+		return nil, err
+	}
+
+	mnt := t.Kernel().SocketMount()
+	d := sockfs.NewDentry(t, mnt)
+	defer d.DecRef(t)
+
+	s := &loopbackSocket{
+		conn:  conn,
+		ep:    ep,
+		stype: stype,
+		cid:   cid,
+	}
+	s.LockFD.Init(&vfs.FileLocks{})
+	vfsfd := &s.vfsfd
+	if err := vfsfd.Init(s, linux.O_RDWR, mnt, d, &vfs.FileDescriptionOptions{
+		DenyPRead:         true,
+		DenyPWrite:        true,
+		UseDentryMetadata: true,
+	}); err != nil {
+		conn.DecRef(t)
+		return nil, syserr.FromError(err)
+	}
+	return vfsfd, nil
+}
+
+// unixSocket returns the Unix domain socket backing s.
+func (s *loopbackSocket) unixSocket() *unix.Socket {
+	return s.conn.Impl().(*unix.Socket)
+}
+
+// isLocalCID returns true if cid refers to the sandbox.
+func (s *loopbackSocket) isLocalCID(cid uint32) bool {
+	return cid == linux.VMADDR_CID_LOCAL || cid == s.cid
+}
+
+// Release implements vfs.FileDescriptionImpl.Release.
+func (s *loopbackSocket) Release(ctx context.Context) {
+	kernel.KernelFromContext(ctx).DeleteSocket(&s.vfsfd)
+	s.mu.Lock()
+	if s.bound {
+		loopbackPorts.remove(s, s.port)
+		s.bound = false
+	}
+	s.mu.Unlock()
+	s.conn.DecRef(ctx)
+}
+
+// Epollable implements vfs.FileDescriptionImpl.Epollable.
+func (s *loopbackSocket) Epollable() bool {
+	return true
+}
+
+// Ioctl implements vfs.FileDescriptionImpl.Ioctl.
+func (s *loopbackSocket) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	return netstack.Ioctl(ctx, s.ep, uio, sysno, args)
+}
+
+// PRead implements vfs.FileDescriptionImpl.PRead.
+func (s *loopbackSocket) PRead(ctx context.Context, dst usermem.IOSequence, offset int64, opts vfs.ReadOptions) (int64, error) {
+	return 0, linuxerr.ESPIPE
+}
+
+// Read implements vfs.FileDescriptionImpl.Read.
+func (s *loopbackSocket) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.ReadOptions) (int64, error) {
+	return s.conn.Impl().Read(ctx, dst, opts)
+}
+
+// PWrite implements vfs.FileDescriptionImpl.PWrite.
+func (s *loopbackSocket) PWrite(ctx context.Context, src usermem.IOSequence, offset int64, opts vfs.WriteOptions) (int64, error) {
+	return 0, linuxerr.ESPIPE
+}
+
+// Write implements vfs.FileDescriptionImpl.Write.
+func (s *loopbackSocket) Write(ctx context.Context, src usermem.IOSequence, opts vfs.WriteOptions) (int64, error) {
+	return s.conn.Impl().Write(ctx, src, opts)
+}
+
+// Readiness implements waiter.Waitable.Readiness.
+func (s *loopbackSocket) Readiness(mask waiter.EventMask) waiter.EventMask {
+	return s.ep.Readiness(mask)
+}
+
+// EventRegister implements waiter.Waitable.EventRegister.
+func (s *loopbackSocket) EventRegister(e *waiter.Entry) error {
+	return s.ep.EventRegister(e)
+}
+
+// EventUnregister implements waiter.Waitable.EventUnregister.
+func (s *loopbackSocket) EventUnregister(e *waiter.Entry) {
+	s.ep.EventUnregister(e)
+}
+
+// Bind implements socket.Socket.Bind.
+func (s *loopbackSocket) Bind(t *kernel.Task, sockaddr []byte) *syserr.Error {
+	addr, err := extractAddress(sockaddr)
+	if err != nil {
+		return syserr.ErrInvalidArgument
+	}
+	if addr.CID != linux.VMADDR_CID_ANY && !s.isLocalCID(addr.CID) {
+		return syserr.ErrAddressNotAvailable
+	}
+	if addr.Port <= lastReservedPort && !auth.CredentialsFromContext(t).HasCapability(linux.CAP_NET_BIND_SERVICE) {
+		return syserr.ErrPermissionDenied
+	}
+	return s.bind(addr.CID, addr.Port)
+}
+
+// bind binds s to the given address.
+func (s *loopbackSocket) bind(cid, port uint32) *syserr.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bound {
+		return syserr.ErrInvalidArgument
+	}
+	return s.bindLocked(cid, port)
+}
+
+// bindLocked binds s to the given address.
+//
+// Preconditions: s.mu is locked. s isn't bound.
+func (s *loopbackSocket) bindLocked(cid, port uint32) *syserr.Error {
+	port, err := loopbackPorts.bind(s, port)
+	if err != nil {
+		return err
+	}
+	if err := s.ep.Bind(endpointAddress(cid, port)); err != nil {
+		loopbackPorts.remove(s, port)
+		if err == syserr.ErrAlreadyBound {
+			// This is an accepted socket.
+			return syserr.ErrInvalidArgument
+		}
+		return err
+	}
+	s.port = port
+	s.bound = true
+	return nil
+}
+
+// Listen implements socket.Socket.Listen.
+func (s *loopbackSocket) Listen(t *kernel.Task, backlog int) *syserr.Error {
+	s.mu.Lock()
+	bound := s.bound
+	s.mu.Unlock()
+	if !bound {
+		return syserr.ErrInvalidArgument
+	}
+	return s.ep.Listen(t, backlog)
+}
+
+// Connect implements socket.Socket.Connect.
+func (s *loopbackSocket) Connect(t *kernel.Task, sockaddr []byte, blocking bool) *syserr.Error {
+	addr, err := extractAddress(sockaddr)
+	if err != nil {
+		return syserr.ErrInvalidArgument
+	}
+	if !s.isLocalCID(addr.CID) {
+		// There is no transport to reach other context IDs, including the
+		// host.
+		return syserr.ErrNoDevice
+	}
+	if s.ep.State() == linux.SS_CONNECTED {
+		return syserr.ErrAlreadyConnected
+	}
+
+	// Like Linux, bind the socket to an ephemeral port if needed so that the
+	// peer has an address to see.
+	s.mu.Lock()
+	if !s.bound {
+		if err := s.bindLocked(linux.VMADDR_CID_ANY, linux.VMADDR_PORT_ANY); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
+	s.mu.Unlock()
+	return loopbackPorts.connect(t, s.ep, addr.Port)
+}
+
+// blockingAccept implements a blocking version of accept(2), that is, if no
+// connections are ready to be accept, it will block until one becomes ready.
+func (s *loopbackSocket) blockingAccept(t *kernel.Task) (transport.Endpoint, *syserr.Error) {
+	// Register for notifications.
+	e, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	s.EventRegister(&e)
+	defer s.EventUnregister(&e)
+
+	// Try to accept the connection; if it fails, then wait until we get a
+	// notification.
+	for {
+		if ep, err := s.ep.Accept(t, nil); err != syserr.ErrWouldBlock {
+			return ep, err
+		}
+
+		if err := t.Block(ch); err != nil {
+			return nil, syserr.FromError(err)
+		}
+	}
+}
+
+// Accept implements socket.Socket.Accept.
+func (s *loopbackSocket) Accept(t *kernel.Task, peerRequested bool, flags int, blocking bool) (int32, linux.SockAddr, uint32, *syserr.Error) {
+	ep, err := s.ep.Accept(t, nil)
+	if err != nil {
+		if err != syserr.ErrWouldBlock || !blocking {
+			return 0, nil, 0, err
+		}
+
+		var err *syserr.Error
+		ep, err = s.blockingAccept(t)
+		if err != nil {
+			return 0, nil, 0, err
+		}
+	}
+
+	ns, err := newLoopbackFD(t, ep, s.stype, s.cid)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	defer ns.DecRef(t)
+
+	if flags&linux.SOCK_NONBLOCK != 0 {
+		ns.SetStatusFlags(t, t.Credentials(), linux.SOCK_NONBLOCK)
+	}
+
+	var addr linux.SockAddr
+	var addrLen uint32
+	if peerRequested {
+		addr, addrLen = s.peerAddress(ep)
+	}
+
+	fd, e := t.NewFDFrom(0, ns, kernel.FDFlags{
+		CloseOnExec: flags&linux.SOCK_CLOEXEC != 0,
+	})
+	if e != nil {
+		return 0, nil, 0, syserr.FromError(e)
+	}
+
+	t.Kernel().RecordSocket(ns, t.NetworkNamespace())
+	return fd, addr, addrLen, nil
+}
+
+// peerAddress returns the address of the peer of ep, which must be connected.
+func (s *loopbackSocket) peerAddress(ep transport.Endpoint) (linux.SockAddr, uint32) {
+	addr, err := ep.GetRemoteAddress()
+	if err != nil {
+		return convertAddress(transport.Address{})
+	}
+	a, l := convertAddress(addr)
+	if vm := a.(*linux.SockAddrVM); vm.CID == linux.VMADDR_CID_ANY {
+		// The peer isn't bound to a specific context ID, but is in the
+		// sandbox.
+		vm.CID = s.cid
+	}
+	return a, l
+}
+
+// GetSockName implements socket.Socket.GetSockName.
+func (s *loopbackSocket) GetSockName(t *kernel.Task) (linux.SockAddr, uint32, *syserr.Error) {
+	addr, err := s.ep.GetLocalAddress()
+	if err != nil {
+		return nil, 0, syserr.TranslateNetstackError(err)
+	}
+	a, l := convertAddress(addr)
+	return a, l, nil
+}
+
+// GetPeerName implements socket.Socket.GetPeerName.
+func (s *loopbackSocket) GetPeerName(t *kernel.Task) (linux.SockAddr, uint32, *syserr.Error) {
+	if !s.ep.State() == linux.SS_CONNECTED {
+		return nil, 0, syserr.ErrNotConnected
+	}
+	a, l := s.peerAddress(s.ep)
+	return a, l, nil
+}
+
+// Shutdown implements socket.Socket.Shutdown.
+func (s *loopbackSocket) Shutdown(t *kernel.Task, how int) *syserr.Error {
+	return s.unixSocket().Shutdown(t, how)
+}
+
+// GetSockOpt implements socket.Socket.GetSockOpt.
+func (s *loopbackSocket) GetSockOpt(t *kernel.Task, level, name int, outPtr hostarch.Addr, outLen int) (marshal.Marshallable, *syserr.Error) {
+	if level != linux.SOL_SOCKET {
+		return nil, syserr.ErrProtocolNotAvailable
+	}
+	return netstack.GetSockOpt(t, s, s.ep, linux.AF_VSOCK, s.stype, level, name, outPtr, outLen)
+}
+
+// SetSockOpt implements socket.Socket.SetSockOpt.
+func (s *loopbackSocket) SetSockOpt(t *kernel.Task, level int, name int, optVal []byte) *syserr.Error {
+	if level != linux.SOL_SOCKET {
+		return syserr.ErrProtocolNotAvailable
+	}
+	return netstack.SetSockOpt(t, s, s.ep, level, name, optVal)
+}
+
+// RecvMsg implements socket.Socket.RecvMsg.
+func (s *loopbackSocket) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, haveDeadline bool, deadline ktime.Time, senderRequested bool, controlDataLen uint64) (int, int, linux.SockAddr, uint32, socket.ControlMessages, *syserr.Error) {
+	// AF_VSOCK doesn't carry control messages, and doesn't return the sender
+	// of connected sockets.
+	n, msgFlags, _, _, cms, err := s.unixSocket().RecvMsg(t, dst, flags, haveDeadline, deadline, false /* senderRequested */, 0 /* controlDataLen */)
+	cms.Release(t)
+	return n, msgFlags, nil, 0, socket.ControlMessages{}, err
+}
+
+// SendMsg implements socket.Socket.SendMsg.
+func (s *loopbackSocket) SendMsg(t *kernel.Task, src usermem.IOSequence, to []byte, flags int, haveDeadline bool, deadline ktime.Time, controlMessages socket.ControlMessages) (int, *syserr.Error) {
+	if len(to) > 0 {
+		if s.ep.State() == linux.SS_CONNECTED {
+			return 0, syserr.ErrAlreadyConnected
+		}
+		return 0, syserr.ErrNotSupported
+	}
+	// AF_VSOCK doesn't carry control messages. The caller only releases them
+	// if nothing was sent.
+	n, err := s.unixSocket().SendMsg(t, src, nil, flags, haveDeadline, deadline, socket.ControlMessages{})
+	if n != 0 && err == nil {
+		controlMessages.Release(t)
+	}
+	return n, err
+}
+
+// State implements socket.Socket.State.
+func (s *loopbackSocket) State() uint32 {
+	return s.ep.State()
+}
+
+// Type implements socket.Socket.Type.
+func (s *loopbackSocket) Type() (family int, skType linux.SockType, protocol int) {
+	return linux.AF_VSOCK, s.stype, 0
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vsock provides AF_VSOCK sockets.
+//
+// Sockets are either bridged to the host's vsock transport, so that the
+// sandbox talks to the hypervisor and other VMs as the host does, or are
+// emulated by a loopback transport that only connects sockets within the
+// sandbox to each other.
+package vsock
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/socket/hostinet"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// Mode is the transport that AF_VSOCK sockets are provided by.
+type Mode int
+
+const (
+	// ModeNone disables AF_VSOCK sockets.
+	ModeNone Mode = iota
+
+	// ModeHost bridges AF_VSOCK sockets to the host, which must have a vsock
+	// transport, e.g. vhost-vsock when running in a VM.
+	ModeHost
+
+	// ModeLoopback provides AF_VSOCK sockets that can only connect to other
+	// AF_VSOCK sockets in the sandbox.
+	ModeLoopback
+)
+
+// String implements fmt.Stringer.
+func (m Mode) String() string {
+	switch m {
+	case ModeNone:
+		return "none"
+	case ModeHost:
+		return "host"
+	case ModeLoopback:
+		return "loopback"
+	default:
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+}
+
+// DefaultCID is the default context ID of the sandbox in loopback mode. It is
+// the lowest context ID that is available to guests.
+const DefaultCID = 3
+
+var (
+	// mode is the transport in use. It is set once by Init.
+	mode Mode
+
+	// localCID is the context ID of the sandbox in loopback mode. It is set
+	// once by Init.
+	localCID uint32 = DefaultCID
+)
+
+// Init enables AF_VSOCK sockets provided by the given transport. cid is the
+// context ID of the sandbox in loopback mode, and is ignored otherwise. Init
+// must be called before the sandbox creates any socket.
+func Init(m Mode, cid uint32) {
+	mode = m
+	localCID = cid
+}
+
+// provider is an AF_VSOCK socket provider.
+type provider struct{}
+
+// Socket implements socket.Provider.Socket.
+func (*provider) Socket(t *kernel.Task, stype linux.SockType, protocol int) (*vfs.FileDescription, *syserr.Error) {
+	if mode == ModeNone {
+		// Let socket(2) fail with EAFNOSUPPORT.
+		return nil, nil
+	}
+	switch stype {
+	case linux.SOCK_STREAM, linux.SOCK_SEQPACKET:
+	default:
+		return nil, syserr.ErrSocketNotSupported
+	}
+	if protocol != 0 {
+		return nil, syserr.ErrProtocolNotSupported
+	}
+
+	if mode == ModeHost {
+		return hostinet.NewSocket(t, linux.AF_VSOCK, stype, protocol)
+	}
+	return newLoopbackSocket(t, stype, localCID)
+}
+
+// Pair implements socket.Provider.Pair.
+func (*provider) Pair(t *kernel.Task, stype linux.SockType, protocol int) (*vfs.FileDescription, *vfs.FileDescription, *syserr.Error) {
+	if mode == ModeNone {
+		return nil, nil, nil
+	}
+	// Not supported by AF_VSOCK.
+	return nil, nil, syserr.ErrNotSupported
+}
+
+func init() {
+	socket.RegisterProvider(linux.AF_VSOCK, &provider{})
+}
@@ -0,0 +1,124 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vsock
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/sentry/socket/unix/transport"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+func TestPortTable(t *testing.T) {
+	pt := portTable{
+		ports: make(map[uint32]*loopbackSocket),
+		next:  linux.VMADDR_PORT_ANY - 2,
+	}
+	a, b, c := &loopbackSocket{}, &loopbackSocket{}, &loopbackSocket{}
+
+	if port, err := pt.bind(a, 5000); err != nil || port != 5000 {
+		t.Fatalf("bind(5000) = %d, %v, want 5000, nil", port, err)
+	}
+	if _, err := pt.bind(b, 5000); err != syserr.ErrAddressInUse {
+		t.Errorf("bind(5000) again got error %v, want %v", err, syserr.ErrAddressInUse)
+	}
+
+	// Ephemeral ports wrap around to the first unreserved port, skipping
+	// VMADDR_PORT_ANY.
+	want := []uint32{linux.VMADDR_PORT_ANY - 2, linux.VMADDR_PORT_ANY - 1, lastReservedPort + 1}
+	for _, w := range want {
+		port, err := pt.bind(c, linux.VMADDR_PORT_ANY)
+		if err != nil {
+			t.Fatalf("bind(VMADDR_PORT_ANY) failed: %v", err)
+		}
+		if port != w {
+			t.Errorf("bind(VMADDR_PORT_ANY) = %d, want %d", port, w)
+		}
+	}
+
+	// Removing a port that was rebound by another socket is a no-op.
+	pt.remove(b, 5000)
+	if pt.ports[5000] != a {
+		t.Errorf("remove by another socket unbound port 5000")
+	}
+	pt.remove(a, 5000)
+	if _, ok := pt.ports[5000]; ok {
+		t.Errorf("port 5000 still bound after remove")
+	}
+}
+
+func TestAddress(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		addr transport.Address
+		want linux.SockAddrVM
+	}{
+		{
+			name: "unbound",
+			want: linux.SockAddrVM{Family: linux.AF_VSOCK, CID: linux.VMADDR_CID_ANY, Port: linux.VMADDR_PORT_ANY},
+		},
+		{
+			name: "bound",
+			addr: endpointAddress(linux.VMADDR_CID_LOCAL, 1234),
+			want: linux.SockAddrVM{Family: linux.AF_VSOCK, CID: linux.VMADDR_CID_LOCAL, Port: 1234},
+		},
+		{
+			name: "any",
+			addr: endpointAddress(linux.VMADDR_CID_ANY, linux.VMADDR_PORT_ANY-1),
+			want: linux.SockAddrVM{Family: linux.AF_VSOCK, CID: linux.VMADDR_CID_ANY, Port: linux.VMADDR_PORT_ANY - 1},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, l := convertAddress(tc.addr)
+			if l != linux.SockAddrVMSize {
+				t.Errorf("convertAddress(%q) returned length %d, want %d", tc.addr.Addr, l, linux.SockAddrVMSize)
+			}
+			if *got.(*linux.SockAddrVM) != tc.want {
+				t.Errorf("convertAddress(%q) = %+v, want %+v", tc.addr.Addr, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtractAddress(t *testing.T) {
+	valid := linux.SockAddrVM{Family: linux.AF_VSOCK, CID: 3, Port: 1234}
+	wrongFamily := valid
+	wrongFamily.Family = linux.AF_UNIX
+	badFlags := valid
+	badFlags.Flags = 0x80
+
+	for _, tc := range []struct {
+		name    string
+		buf     []byte
+		wantErr *syserr.Error
+	}{
+		{name: "valid", buf: marshal.Marshal(&valid)},
+		{name: "short", buf: marshal.Marshal(&valid)[:linux.SockAddrVMSize-1], wantErr: syserr.ErrInvalidArgument},
+		{name: "wrong family", buf: marshal.Marshal(&wrongFamily), wantErr: syserr.ErrAddressFamilyNotSupported},
+		{name: "bad flags", buf: marshal.Marshal(&badFlags), wantErr: syserr.ErrInvalidArgument},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := extractAddress(tc.buf)
+			if err != tc.wantErr {
+				t.Fatalf("extractAddress() got error %v, want %v", err, tc.wantErr)
+			}
+			if err == nil && got != valid {
+				t.Errorf("extractAddress() = %+v, want %+v", got, valid)
+			}
+		})
+	}
+}
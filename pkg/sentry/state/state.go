@@ -24,6 +24,7 @@ import (
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/time"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/sentry/watchdog"
@@ -54,7 +55,19 @@ type SaveOpts struct {
 	// Metadata is save metadata.
 	Metadata map[string]string
 
-	// Callback is called prior to unpause, with any save error.
+	// Async indicates that tasks should be resumed as soon as kernel state is
+	// saved, while the contents of memory are written out in the background.
+	// Writes to memory in the meantime do not affect the saved state.
+	Async bool
+
+	// Precopied indicates that memory written out by PrecopyOpts.Precopy and
+	// not written to since is omitted from the saved state. It is
+	// incompatible with Async.
+	Precopied bool
+
+	// Callback is called prior to unpause, with any save error. If Async is
+	// true, Callback is instead called after memory has been written out,
+	// while tasks are running.
 	Callback func(err error)
 }
 
@@ -63,13 +76,18 @@ func (opts SaveOpts) Save(ctx context.Context, k *kernel.Kernel, w *watchdog.Wat
 	log.Infof("Sandbox save started, pausing all tasks.")
 	k.Pause()
 	k.ReceiveTaskStates()
-	defer func() {
+	w.Stop()
+	paused := true
+	resume := func() {
+		if !paused {
+			return
+		}
+		paused = false
+		w.Start()
 		k.Unpause()
 		log.Infof("Tasks resumed after save.")
-	}()
-
-	w.Stop()
-	defer w.Start()
+	}
+	defer resume()
 
 	// Supplement the metadata.
 	if opts.Metadata == nil {
@@ -83,7 +101,20 @@ func (opts SaveOpts) Save(ctx context.Context, k *kernel.Kernel, w *watchdog.Wat
 		err = ErrStateFile{err}
 	} else {
 		// Save the kernel.
-		err = k.SaveTo(ctx, wc)
+		if opts.Async && opts.Precopied {
+			err = fmt.Errorf("asynchronous saves cannot omit pre-copied memory")
+		} else if opts.Async {
+			var writeMemory func() error
+			writeMemory, err = k.SaveToAsync(ctx, wc)
+			if err == nil {
+				resume()
+				err = writeMemory()
+			}
+		} else if opts.Precopied {
+			err = k.SaveToPrecopied(ctx, wc)
+		} else {
+			err = k.SaveTo(ctx, wc)
+		}
 
 		// ENOSPC is a state file error. This error can only come from
 		// writing the state file, and not from fs.FileOperations.Fsync
@@ -100,6 +131,49 @@ func (opts SaveOpts) Save(ctx context.Context, k *kernel.Kernel, w *watchdog.Wat
 	return err
 }
 
+// PrecopyOpts contains options for rounds of pre-copying memory ahead of a
+// save.
+type PrecopyOpts struct {
+	// Destination is the target of the round.
+	Destination io.Writer
+
+	// Key is used for the integrity check of the round.
+	Key []byte
+
+	// Metadata is the round's metadata, including its compression level.
+	Metadata map[string]string
+}
+
+// Precopy writes out a round of application memory that has been written to
+// since the last round, without stopping tasks for longer than it takes to
+// begin the round. The written pages are read by pgalloc.ReadPrecopyRound
+// from a statefile opened with the same key. A save with
+// SaveOpts.Precopied set ends the pre-copy, as does kernel.CancelPrecopy.
+//
+// Precopy returns the number of pages written out, and the number of pages
+// written to since, which the next round would write out.
+func (opts PrecopyOpts) Precopy(k *kernel.Kernel) (uint64, uint64, error) {
+	wc, err := statefile.NewWriter(opts.Destination, opts.Key, opts.Metadata)
+	if err != nil {
+		return 0, 0, ErrStateFile{err}
+	}
+	pages, dirty, err := k.PrecopyRound(wc)
+	if closeErr := wc.Close(); err == nil && closeErr != nil {
+		err = ErrStateFile{closeErr}
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	log.Infof("Pre-copied %d pages, %d pages written to since.", pages, dirty)
+	return pages, dirty, nil
+}
+
+// PreviousMetadata returns the metadata of the state file that the kernel was
+// last loaded from, or nil if it wasn't loaded from a state file.
+func PreviousMetadata() map[string]string {
+	return previousMetadata
+}
+
 // LoadOpts contains load-related options.
 type LoadOpts struct {
 	// Destination is the load source.
@@ -107,6 +181,11 @@ type LoadOpts struct {
 
 	// Key is used for state integrity check.
 	Key []byte
+
+	// Precopied contains the memory pre-copied ahead of a save with
+	// SaveOpts.Precopied set, at its offsets in the kernel's memory file, as
+	// written by pgalloc.ReadPrecopyRound. It is required to load such saves.
+	Precopied io.ReaderAt
 }
 
 // Load loads the given kernel, setting the provided platform and stack.
@@ -119,6 +198,10 @@ func (opts LoadOpts) Load(ctx context.Context, k *kernel.Kernel, timeReady chan
 
 	previousMetadata = m
 
+	if opts.Precopied != nil {
+		ctx = context.WithValue(ctx, pgalloc.CtxPrecopied, opts.Precopied)
+	}
+
 	// Restore the Kernel object graph.
 	return k.LoadFrom(ctx, r, timeReady, n, clocks, vfsOpts)
 }
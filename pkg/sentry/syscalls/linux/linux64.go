@@ -108,7 +108,7 @@ var AMD64 = &kernel.SyscallTable{
 		53:  syscalls.SupportedPoint("socketpair", SocketPair, PointSocketpair),
 		54:  syscalls.Supported("setsockopt", SetSockOpt),
 		55:  syscalls.Supported("getsockopt", GetSockOpt),
-		56:  syscalls.PartiallySupportedPoint("clone", Clone, PointClone, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_PARENT, CLONE_NEWTIME, CLONE_CLEAR_SIGHAND, and CLONE_SYSVSEM not supported.", nil),
+		56:  syscalls.PartiallySupportedPoint("clone", Clone, PointClone, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_PARENT, CLONE_NEWTIME, and CLONE_CLEAR_SIGHAND not supported.", nil),
 		57:  syscalls.SupportedPoint("fork", Fork, PointFork),
 		58:  syscalls.SupportedPoint("vfork", Vfork, PointVfork),
 		59:  syscalls.SupportedPoint("execve", Execve, PointExecve),
@@ -187,7 +187,7 @@ var AMD64 = &kernel.SyscallTable{
 		132: syscalls.Supported("utime", Utime),
 		133: syscalls.Supported("mknod", Mknod),
 		134: syscalls.Error("uselib", linuxerr.ENOSYS, "Obsolete", nil),
-		135: syscalls.ErrorWithEvent("personality", linuxerr.EINVAL, "Unable to change personality.", nil),
+		135: syscalls.PartiallySupported("personality", Personality, "Only the PER_LINUX and PER_LINUX32 personality types, and the ADDR_NO_RANDOMIZE, ADDR_COMPAT_LAYOUT and READ_IMPLIES_EXEC flags are supported.", nil),
 		136: syscalls.ErrorWithEvent("ustat", linuxerr.ENOSYS, "Needs filesystem support.", nil),
 		137: syscalls.Supported("statfs", Statfs),
 		138: syscalls.Supported("fstatfs", Fstatfs),
@@ -211,7 +211,7 @@ var AMD64 = &kernel.SyscallTable{
 		156: syscalls.Error("sysctl", linuxerr.EPERM, "Deprecated. Use /proc/sys instead.", nil),
 		157: syscalls.PartiallySupported("prctl", Prctl, "Not all options are supported.", nil),
 		158: syscalls.PartiallySupported("arch_prctl", ArchPrctl, "Options ARCH_GET_GS, ARCH_SET_GS not supported.", nil),
-		159: syscalls.CapError("adjtimex", linux.CAP_SYS_TIME, "", nil),
+		159: syscalls.PartiallySupported("adjtimex", Adjtimex, "The clock can only be read; adjustments fail with EPERM.", nil),
 		160: syscalls.PartiallySupported("setrlimit", Setrlimit, "Not all rlimits are enforced.", nil),
 		161: syscalls.SupportedPoint("chroot", Chroot, PointChroot),
 		162: syscalls.Supported("sync", Sync),
@@ -273,7 +273,7 @@ var AMD64 = &kernel.SyscallTable{
 		218: syscalls.Supported("set_tid_address", SetTidAddress),
 		219: syscalls.Supported("restart_syscall", RestartSyscall),
 		220: syscalls.Supported("semtimedop", Semtimedop),
-		221: syscalls.PartiallySupported("fadvise64", Fadvise64, "The syscall is 'supported', but ignores all provided advice.", nil),
+		221: syscalls.PartiallySupported("fadvise64", Fadvise64, "Advice is only acted on for regular files on gofer mounts; it is ignored for other files.", nil),
 		222: syscalls.Supported("timer_create", TimerCreate),
 		223: syscalls.Supported("timer_settime", TimerSettime),
 		224: syscalls.Supported("timer_gettime", TimerGettime),
@@ -357,7 +357,7 @@ var AMD64 = &kernel.SyscallTable{
 		302: syscalls.SupportedPoint("prlimit64", Prlimit64, PointPrlimit64),
 		303: syscalls.Error("name_to_handle_at", linuxerr.EOPNOTSUPP, "Not supported by gVisor filesystems", nil),
 		304: syscalls.Error("open_by_handle_at", linuxerr.EOPNOTSUPP, "Not supported by gVisor filesystems", nil),
-		305: syscalls.CapError("clock_adjtime", linux.CAP_SYS_TIME, "", nil),
+		305: syscalls.PartiallySupported("clock_adjtime", ClockAdjtime, "Only CLOCK_REALTIME is supported, and it can only be read; adjustments fail with EPERM.", nil),
 		306: syscalls.Supported("syncfs", Syncfs),
 		307: syscalls.Supported("sendmmsg", SendMMsg),
 		308: syscalls.Supported("setns", Setns),
@@ -403,7 +403,7 @@ var AMD64 = &kernel.SyscallTable{
 		432: syscalls.ErrorWithEvent("fsmount", linuxerr.ENOSYS, "", nil),
 		433: syscalls.ErrorWithEvent("fspick", linuxerr.ENOSYS, "", nil),
 		434: syscalls.ErrorWithEvent("pidfd_open", linuxerr.ENOSYS, "", nil),
-		435: syscalls.PartiallySupported("clone3", Clone3, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_INTO_CGROUP, CLONE_NEWTIME, CLONE_CLEAR_SIGHAND, CLONE_PARENT, CLONE_SYSVSEM and, SetTid are not supported.", nil),
+		435: syscalls.PartiallySupported("clone3", Clone3, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_INTO_CGROUP, CLONE_NEWTIME, CLONE_CLEAR_SIGHAND, CLONE_PARENT and, SetTid are not supported.", nil),
 		436: syscalls.Supported("close_range", CloseRange),
 		439: syscalls.Supported("faccessat2", Faccessat2),
 		441: syscalls.Supported("epoll_pwait2", EpollPwait2),
@@ -523,7 +523,7 @@ var ARM64 = &kernel.SyscallTable{
 		89:  syscalls.CapError("acct", linux.CAP_SYS_PACCT, "", nil),
 		90:  syscalls.Supported("capget", Capget),
 		91:  syscalls.Supported("capset", Capset),
-		92:  syscalls.ErrorWithEvent("personality", linuxerr.EINVAL, "Unable to change personality.", nil),
+		92:  syscalls.PartiallySupported("personality", Personality, "Only the PER_LINUX and PER_LINUX32 personality types, and the ADDR_NO_RANDOMIZE, ADDR_COMPAT_LAYOUT and READ_IMPLIES_EXEC flags are supported.", nil),
 		93:  syscalls.Supported("exit", Exit),
 		94:  syscalls.Supported("exit_group", ExitGroup),
 		95:  syscalls.Supported("waitid", Waitid),
@@ -602,7 +602,7 @@ var ARM64 = &kernel.SyscallTable{
 		168: syscalls.Supported("getcpu", Getcpu),
 		169: syscalls.Supported("gettimeofday", Gettimeofday),
 		170: syscalls.CapError("settimeofday", linux.CAP_SYS_TIME, "", nil),
-		171: syscalls.CapError("adjtimex", linux.CAP_SYS_TIME, "", nil),
+		171: syscalls.PartiallySupported("adjtimex", Adjtimex, "The clock can only be read; adjustments fail with EPERM.", nil),
 		172: syscalls.Supported("getpid", Getpid),
 		173: syscalls.Supported("getppid", Getppid),
 		174: syscalls.Supported("getuid", Getuid),
@@ -651,10 +651,10 @@ var ARM64 = &kernel.SyscallTable{
 		217: syscalls.Error("add_key", linuxerr.EACCES, "Not available to user.", nil),
 		218: syscalls.Error("request_key", linuxerr.EACCES, "Not available to user.", nil),
 		219: syscalls.PartiallySupported("keyctl", Keyctl, "Only supports session keyrings with zero keys in them.", nil),
-		220: syscalls.PartiallySupportedPoint("clone", Clone, PointClone, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_PARENT, CLONE_NEWTIME, CLONE_CLEAR_SIGHAND, and CLONE_SYSVSEM not supported.", nil),
+		220: syscalls.PartiallySupportedPoint("clone", Clone, PointClone, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_PARENT, CLONE_NEWTIME, and CLONE_CLEAR_SIGHAND not supported.", nil),
 		221: syscalls.SupportedPoint("execve", Execve, PointExecve),
 		222: syscalls.Supported("mmap", Mmap),
-		223: syscalls.PartiallySupported("fadvise64", Fadvise64, "Not all options are supported.", nil),
+		223: syscalls.PartiallySupported("fadvise64", Fadvise64, "Advice is only acted on for regular files on gofer mounts; it is ignored for other files.", nil),
 		224: syscalls.CapError("swapon", linux.CAP_SYS_ADMIN, "", nil),
 		225: syscalls.CapError("swapoff", linux.CAP_SYS_ADMIN, "", nil),
 		226: syscalls.Supported("mprotect", Mprotect),
@@ -681,7 +681,7 @@ var ARM64 = &kernel.SyscallTable{
 		263: syscalls.ErrorWithEvent("fanotify_mark", linuxerr.ENOSYS, "Needs CONFIG_FANOTIFY", nil),
 		264: syscalls.Error("name_to_handle_at", linuxerr.EOPNOTSUPP, "Not supported by gVisor filesystems", nil),
 		265: syscalls.Error("open_by_handle_at", linuxerr.EOPNOTSUPP, "Not supported by gVisor filesystems", nil),
-		266: syscalls.CapError("clock_adjtime", linux.CAP_SYS_TIME, "", nil),
+		266: syscalls.PartiallySupported("clock_adjtime", ClockAdjtime, "Only CLOCK_REALTIME is supported, and it can only be read; adjustments fail with EPERM.", nil),
 		267: syscalls.Supported("syncfs", Syncfs),
 		268: syscalls.Supported("setns", Setns),
 		269: syscalls.Supported("sendmmsg", SendMMsg),
@@ -724,7 +724,7 @@ var ARM64 = &kernel.SyscallTable{
 		432: syscalls.ErrorWithEvent("fsmount", linuxerr.ENOSYS, "", nil),
 		433: syscalls.ErrorWithEvent("fspick", linuxerr.ENOSYS, "", nil),
 		434: syscalls.ErrorWithEvent("pidfd_open", linuxerr.ENOSYS, "", nil),
-		435: syscalls.PartiallySupported("clone3", Clone3, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_INTO_CGROUP, CLONE_NEWTIME, CLONE_CLEAR_SIGHAND, CLONE_PARENT, CLONE_SYSVSEM and clone_args.set_tid are not supported.", nil),
+		435: syscalls.PartiallySupported("clone3", Clone3, "Options CLONE_PIDFD, CLONE_NEWCGROUP, CLONE_INTO_CGROUP, CLONE_NEWTIME, CLONE_CLEAR_SIGHAND, CLONE_PARENT and clone_args.set_tid are not supported.", nil),
 		436: syscalls.Supported("close_range", CloseRange),
 		439: syscalls.Supported("faccessat2", Faccessat2),
 		441: syscalls.Supported("epoll_pwait2", EpollPwait2),
@@ -683,6 +683,22 @@ func Fcntl(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 		}
 		err := tmpfs.AddSeals(file, args[2].Uint())
 		return 0, nil, err
+	case linux.F_GET_RW_HINT:
+		hint, err := file.WriteHint()
+		if err != nil {
+			return 0, nil, err
+		}
+		_, err = primitive.CopyUint64Out(t, args[2].Pointer(), hint)
+		return 0, nil, err
+	case linux.F_SET_RW_HINT:
+		var hint uint64
+		if _, err := primitive.CopyUint64In(t, args[2].Pointer(), &hint); err != nil {
+			return 0, nil, err
+		}
+		if hint > linux.RWH_WRITE_LIFE_EXTREME {
+			return 0, nil, linuxerr.EINVAL
+		}
+		return 0, nil, file.SetWriteHint(t, hint)
 	case linux.F_SETLK:
 		return 0, nil, posixLock(t, args, file, false /* ofd */, false /* block */)
 	case linux.F_SETLKW:
@@ -881,9 +897,9 @@ func posixLock(t *kernel.Task, args arch.SyscallArguments, file *vfs.FileDescrip
 }
 
 // Fadvise64 implements fadvise64(2).
-// This implementation currently ignores the provided advice.
 func Fadvise64(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	fd := args[0].Int()
+	offset := args[1].Int64()
 	length := args[2].Int64()
 	advice := args[3].Int()
 
@@ -918,8 +934,7 @@ func Fadvise64(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintp
 		return 0, nil, linuxerr.EINVAL
 	}
 
-	// Sure, whatever.
-	return 0, nil, nil
+	return 0, nil, file.Advise(t, offset, length, advice)
 }
 
 // Mkdir implements Linux syscall mkdir(2).
@@ -255,7 +255,7 @@ func Mbind(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 
 	// Since we claim to have only a single node, all flags can be ignored
 	// (since all pages must already be on that single node).
-	err = t.MemoryManager().SetNumaPolicy(addr, length, mode, nodemaskVal)
+	err = t.MemoryManager().SetNumaPolicy(t, addr, length, mode, nodemaskVal)
 	return 0, nil, err
 }
 
@@ -80,6 +80,11 @@ func Mmap(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *
 		}
 	}()
 
+	// Compare Linux's mm/mmap.c:do_mmap().
+	rier := opts.Perms.Read && readImpliesExec(t)
+	if anon && rier {
+		opts.Perms.Execute = true
+	}
 	if !anon {
 		// Convert the passed FD to a file reference.
 		file := t.GetFile(fd)
@@ -88,6 +93,17 @@ func Mmap(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *
 		}
 		defer file.DecRef(t)
 
+		if file.Mount().Options().Flags.NoExec {
+			// Mappings of files on noexec mounts can't be made executable,
+			// even by mprotect(2).
+			if opts.Perms.Execute {
+				return 0, nil, linuxerr.EPERM
+			}
+			opts.MaxPerms.Execute = false
+		} else if rier {
+			opts.Perms.Execute = true
+		}
+
 		// mmap unconditionally requires that the FD is readable.
 		if !file.IsReadable() {
 			return 0, nil, linuxerr.EACCES
@@ -160,11 +176,11 @@ func Mremap(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 func Mprotect(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	length := args[1].Uint64()
 	prot := args[2].Int()
-	err := t.MemoryManager().MProtect(args[0].Pointer(), length, hostarch.AccessType{
+	err := t.MemoryManager().MProtect(t, args[0].Pointer(), length, hostarch.AccessType{
 		Read:    linux.PROT_READ&prot != 0,
 		Write:   linux.PROT_WRITE&prot != 0,
 		Execute: linux.PROT_EXEC&prot != 0,
-	}, linux.PROT_GROWSDOWN&prot != 0)
+	}, linux.PROT_GROWSDOWN&prot != 0, readImpliesExec(t))
 	return 0, nil, err
 }
 
@@ -193,11 +209,13 @@ func Madvise(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr
 	case linux.MADV_DONTNEED:
 		return 0, nil, t.MemoryManager().Decommit(addr, length)
 	case linux.MADV_DOFORK:
-		return 0, nil, t.MemoryManager().SetDontFork(addr, length, false)
+		return 0, nil, t.MemoryManager().SetDontFork(t, addr, length, false)
 	case linux.MADV_DONTFORK:
-		return 0, nil, t.MemoryManager().SetDontFork(addr, length, true)
+		return 0, nil, t.MemoryManager().SetDontFork(t, addr, length, true)
 	case linux.MADV_HUGEPAGE, linux.MADV_NOHUGEPAGE:
-		fallthrough
+		return 0, nil, t.MemoryManager().SetHugepageAdvice(t, addr, length, adv)
+	case linux.MADV_COLLAPSE:
+		return 0, nil, t.MemoryManager().Collapse(t, addr, length)
 	case linux.MADV_MERGEABLE, linux.MADV_UNMERGEABLE:
 		fallthrough
 	case linux.MADV_DONTDUMP, linux.MADV_DODUMP:
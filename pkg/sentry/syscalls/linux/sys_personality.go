@@ -0,0 +1,50 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+)
+
+// supportedPersonalityFlags are the personality(2) flags that take effect.
+// SHORT_INODE, WHOLE_SECONDS and STICKY_TIMEOUTS are also ignored by Linux.
+const supportedPersonalityFlags = linux.ADDR_NO_RANDOMIZE | linux.ADDR_COMPAT_LAYOUT | linux.READ_IMPLIES_EXEC | linux.SHORT_INODE | linux.WHOLE_SECONDS | linux.STICKY_TIMEOUTS
+
+// Personality implements linux syscall personality(2).
+//
+// As in Linux, any personality can be set, and is returned by later calls.
+// Execution domains other than PER_LINUX and PER_LINUX32 behave like
+// PER_LINUX, and unsupported flags have no effect.
+func Personality(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	personality := args[0].Uint()
+	old := t.Personality()
+	if personality == linux.PersonalityQuery {
+		return uintptr(old), nil, nil
+	}
+	persona := personality & linux.PER_MASK
+	if (persona != linux.PER_LINUX && persona != linux.PER_LINUX32) || personality&^(linux.PER_MASK|supportedPersonalityFlags) != 0 {
+		t.Kernel().EmitUnimplementedEvent(t, sysno)
+	}
+	t.SetPersonality(personality)
+	return uintptr(old), nil, nil
+}
+
+// readImpliesExec returns true if t's personality includes
+// READ_IMPLIES_EXEC.
+func readImpliesExec(t *kernel.Task) bool {
+	return t.Personality()&linux.READ_IMPLIES_EXEC != 0
+}
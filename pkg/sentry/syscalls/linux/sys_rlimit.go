@@ -99,9 +99,18 @@ var setableLimits = map[limits.LimitType]struct{}{
 	limits.ProcessCount: {},
 }
 
-func prlimit64(t *kernel.Task, resource limits.LimitType, newLim *limits.Limit) (limits.Limit, error) {
+// prlimit64 gets and optionally sets the resource limit of the thread group of
+// ot on behalf of t. The caller must have already checked that t is permitted
+// to access ot's limits.
+func prlimit64(t, ot *kernel.Task, resource limits.LimitType, newLim *limits.Limit) (limits.Limit, error) {
+	ls := ot.ThreadGroup().Limits()
 	if newLim == nil {
-		return t.ThreadGroup().Limits().Get(resource), nil
+		return ls.Get(resource), nil
+	}
+
+	// As in Linux, an invalid limit is reported before any EPERM.
+	if newLim.Cur > newLim.Max {
+		return limits.Limit{}, linuxerr.EINVAL
 	}
 
 	if _, ok := setableLimits[resource]; !ok {
@@ -118,15 +127,18 @@ func prlimit64(t *kernel.Task, resource limits.LimitType, newLim *limits.Limit)
 	// "A privileged process (under Linux: one with the CAP_SYS_RESOURCE
 	// capability in the initial user namespace) may make arbitrary changes
 	// to either limit value."
+	//
+	// This is a property of the caller, not of the process whose limits are
+	// being changed.
 	privileged := t.HasCapabilityIn(linux.CAP_SYS_RESOURCE, t.Kernel().RootUserNamespace())
 
-	oldLim, err := t.ThreadGroup().Limits().Set(resource, *newLim, privileged)
+	oldLim, err := ls.Set(resource, *newLim, privileged)
 	if err != nil {
 		return limits.Limit{}, err
 	}
 
 	if resource == limits.CPU {
-		t.NotifyRlimitCPUUpdated()
+		ot.NotifyRlimitCPUUpdated()
 	}
 	return oldLim, nil
 }
@@ -143,7 +155,7 @@ func Getrlimit(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintp
 	if err != nil {
 		return 0, nil, err
 	}
-	lim, err := prlimit64(t, resource, nil)
+	lim, err := prlimit64(t, t, resource, nil)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -167,7 +179,7 @@ func Setrlimit(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintp
 	if _, err := rlim.CopyIn(t, addr); err != nil {
 		return 0, nil, linuxerr.EFAULT
 	}
-	_, err = prlimit64(t, resource, rlim.toLimit())
+	_, err = prlimit64(t, t, resource, rlim.toLimit())
 	return 0, nil, err
 }
 
@@ -206,19 +218,23 @@ func Prlimit64(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintp
 	// saved set user IDs of the target process must match the real user ID of
 	// the caller and the real, effective, and saved set group IDs of the
 	// target process must match the real group ID of the caller."
-	if ot != t && !t.HasCapabilityIn(linux.CAP_SYS_RESOURCE, t.PIDNamespace().UserNamespace()) {
+	//
+	// As in Linux, the capability is checked against the target's user
+	// namespace rather than the caller's.
+	if ot != t {
 		cred, tcred := t.Credentials(), ot.Credentials()
-		if cred.RealKUID != tcred.RealKUID ||
-			cred.RealKUID != tcred.EffectiveKUID ||
-			cred.RealKUID != tcred.SavedKUID ||
-			cred.RealKGID != tcred.RealKGID ||
-			cred.RealKGID != tcred.EffectiveKGID ||
-			cred.RealKGID != tcred.SavedKGID {
+		sameIDs := cred.RealKUID == tcred.RealKUID &&
+			cred.RealKUID == tcred.EffectiveKUID &&
+			cred.RealKUID == tcred.SavedKUID &&
+			cred.RealKGID == tcred.RealKGID &&
+			cred.RealKGID == tcred.EffectiveKGID &&
+			cred.RealKGID == tcred.SavedKGID
+		if !sameIDs && !cred.HasCapabilityIn(linux.CAP_SYS_RESOURCE, tcred.UserNamespace) {
 			return 0, nil, linuxerr.EPERM
 		}
 	}
 
-	oldLim, err := prlimit64(ot, resource, newLim)
+	oldLim, err := prlimit64(t, ot, resource, newLim)
 	if err != nil {
 		return 0, nil, err
 	}
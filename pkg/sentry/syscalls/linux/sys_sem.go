@@ -26,6 +26,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/ipc"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/semaphore"
 )
 
 const opsMax = 500 // SEMOPM
@@ -117,14 +118,27 @@ func semTimedOp(t *kernel.Task, id ipc.ID, ops []linux.Sembuf, haveTimeout bool,
 	}
 	creds := auth.CredentialsFromContext(t)
 	pid := t.Kernel().GlobalInit().PIDNamespace().IDOfThreadGroup(t.ThreadGroup())
+	var undos *semaphore.UndoList
+	for _, op := range ops {
+		if op.SemFlg&linux.SEM_UNDO != 0 {
+			undos = t.SemUndoList()
+			break
+		}
+	}
 	for {
-		ch, num, err := set.ExecuteOps(t, ops, creds, int32(pid))
+		ch, num, err := set.ExecuteOps(t, ops, creds, int32(pid), undos)
 		if ch == nil || err != nil {
 			return err
 		}
-		if _, err = t.BlockWithTimeout(ch, haveTimeout, timeout); err != nil {
+		// The timeout applies to the whole call, not to each wait.
+		if timeout, err = t.BlockWithTimeout(ch, haveTimeout, timeout); err != nil {
 			set.AbortWait(num, ch)
-			return err
+			// "semop(2) is never restarted after being interrupted by a
+			// signal handler, regardless of the use of SA_RESTART." -
+			// signal(7). Nor is it restarted after being interrupted by a
+			// stop signal; see "Interruption of system calls and library
+			// functions by stop signals" in signal(7).
+			return linuxerr.ConvertIntr(err, linuxerr.EINTR)
 		}
 	}
 }
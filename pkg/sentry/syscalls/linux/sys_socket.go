@@ -64,7 +64,10 @@ const controlLenOffset = 40
 // to the Flags field.
 const flagsOffset = 48
 
-const sizeOfInt32 = 4
+const (
+	sizeOfInt32 = 4
+	sizeOfInt64 = 8
+)
 
 // messageHeader64Len is the length of a MessageHeader64 struct.
 var messageHeader64Len = uint64((*MessageHeader64)(nil).SizeBytes())
@@ -465,7 +468,7 @@ func GetSockOpt(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uint
 	}
 
 	// Call syscall implementation then copy both value and value len out.
-	v, e := getSockOpt(t, s, int(level), int(name), optValAddr, int(optLen))
+	v, e := getSockOpt(t, file, s, int(level), int(name), optValAddr, int(optLen))
 	if e != nil {
 		return 0, nil, e.ToError()
 	}
@@ -485,13 +488,17 @@ func GetSockOpt(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uint
 
 // getSockOpt tries to handle common socket options, or dispatches to a specific
 // socket implementation.
-func getSockOpt(t *kernel.Task, s socket.Socket, level, name int, optValAddr hostarch.Addr, len int) (marshal.Marshallable, *syserr.Error) {
+func getSockOpt(t *kernel.Task, file *vfs.FileDescription, s socket.Socket, level, name int, optValAddr hostarch.Addr, len int) (marshal.Marshallable, *syserr.Error) {
 	if level == linux.SOL_SOCKET {
 		switch name {
 		case linux.SO_TYPE, linux.SO_DOMAIN, linux.SO_PROTOCOL:
 			if len < sizeOfInt32 {
 				return nil, syserr.ErrInvalidArgument
 			}
+		case linux.SO_COOKIE:
+			if len < sizeOfInt64 {
+				return nil, syserr.ErrInvalidArgument
+			}
 		}
 
 		switch name {
@@ -507,6 +514,15 @@ func getSockOpt(t *kernel.Task, s socket.Socket, level, name int, optValAddr hos
 			_, _, protocol := s.Type()
 			v := primitive.Int32(protocol)
 			return &v, nil
+		case linux.SO_COOKIE:
+			// The cookie identifies the socket in the kernel's socket
+			// table, as in sock_diag.
+			cookie, ok := t.Kernel().SocketCookie(file)
+			if !ok {
+				return nil, syserr.ErrInvalidArgument
+			}
+			v := primitive.Uint64(cookie)
+			return &v, nil
 		}
 	}
 
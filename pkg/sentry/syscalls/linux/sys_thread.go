@@ -164,6 +164,7 @@ func execveat(t *kernel.Task, dirfd int32, pathnameAddr, argvAddr, envvAddr host
 		Argv:                argv,
 		Envv:                envv,
 		Features:            t.Kernel().FeatureSet(),
+		Personality:         kernel.ExecPersonality(t.Personality()),
 	}
 	if seccheck.Global.Enabled(seccheck.PointExecve) {
 		// Retain the first executable file that is opened (which may open
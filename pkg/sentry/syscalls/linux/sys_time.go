@@ -19,12 +19,14 @@ import (
 	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/marshal/primitive"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
 )
 
 // The most significant 29 bits hold either a pid or a file descriptor.
@@ -74,7 +76,16 @@ func ClockGetres(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uin
 		Nsec: 1,
 	}
 
-	if _, err := getClock(t, clockID); err != nil {
+	if isDynamicClock(clockID) {
+		fd, dc, err := getDynamicClock(t, clockID)
+		if err != nil {
+			return 0, nil, err
+		}
+		defer fd.DecRef(t)
+		if r, err = dc.ClockGetres(t); err != nil {
+			return 0, nil, err
+		}
+	} else if _, err := getClock(t, clockID); err != nil {
 		return 0, nil, linuxerr.EINVAL
 	}
 
@@ -91,6 +102,39 @@ type cpuClocker interface {
 	CPUClock() ktime.Clock
 }
 
+// dynamicClock is implemented by the file descriptions of dynamic POSIX clock
+// devices, e.g. /dev/ptp*, which are identified by clock IDs derived from file
+// descriptors (see FD_TO_CLOCKID in Linux's include/linux/posix-timers.h).
+type dynamicClock interface {
+	// ClockGettime returns the current time of the clock.
+	ClockGettime(ctx context.Context) (linux.Timespec, error)
+
+	// ClockGetres returns the resolution of the clock.
+	ClockGetres(ctx context.Context) (linux.Timespec, error)
+}
+
+// isDynamicClock returns true if c identifies a dynamic POSIX clock by file
+// descriptor.
+func isDynamicClock(c int32) bool {
+	return c < 0 && c&7 == linux.CLOCKFD
+}
+
+// getDynamicClock returns the dynamic POSIX clock identified by the file
+// descriptor in clockID. On success, the caller must DecRef the returned file
+// description once it is done with the clock.
+func getDynamicClock(t *kernel.Task, clockID int32) (*vfs.FileDescription, dynamicClock, error) {
+	fd := t.GetFile(int32(pidOfClockID(clockID)))
+	if fd == nil {
+		return nil, nil, linuxerr.EINVAL
+	}
+	dc, ok := fd.Impl().(dynamicClock)
+	if !ok {
+		fd.DecRef(t)
+		return nil, nil, linuxerr.EINVAL
+	}
+	return fd, dc, nil
+}
+
 func getClock(t *kernel.Task, clockID int32) (ktime.Clock, error) {
 	if clockID < 0 {
 		if !isValidCPUClock(clockID) {
@@ -147,6 +191,19 @@ func ClockGettime(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (ui
 	clockID := int32(args[0].Int())
 	addr := args[1].Pointer()
 
+	if isDynamicClock(clockID) {
+		fd, dc, err := getDynamicClock(t, clockID)
+		if err != nil {
+			return 0, nil, err
+		}
+		defer fd.DecRef(t)
+		ts, err := dc.ClockGettime(t)
+		if err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, copyTimespecOut(t, addr, &ts)
+	}
+
 	c, err := getClock(t, clockID)
 	if err != nil {
 		return 0, nil, err
@@ -160,6 +217,52 @@ func ClockSettime(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (ui
 	return 0, nil, linuxerr.EPERM
 }
 
+// Adjtimex implements linux syscall adjtimex(2).
+func Adjtimex(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	return adjtimex(t, args[0].Pointer())
+}
+
+// ClockAdjtime implements linux syscall clock_adjtime(2).
+func ClockAdjtime(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	clockID := int32(args[0].Int())
+	addr := args[1].Pointer()
+
+	if clockID == linux.CLOCK_REALTIME {
+		return adjtimex(t, addr)
+	}
+	if isDynamicClock(clockID) {
+		fd, _, err := getDynamicClock(t, clockID)
+		if err != nil {
+			return 0, nil, err
+		}
+		fd.DecRef(t)
+	} else if _, err := getClock(t, clockID); err != nil {
+		return 0, nil, linuxerr.EINVAL
+	}
+	// Only CLOCK_REALTIME can be disciplined.
+	return 0, nil, linuxerr.EOPNOTSUPP
+}
+
+// adjtimex implements adjtimex(2) and clock_adjtime(2) for CLOCK_REALTIME.
+//
+// The sandbox's clocks track the host's and cannot be adjusted, but the NTP
+// state can be read, which allows applications to check whether the clock
+// is synchronized and how large its error may be.
+func adjtimex(t *kernel.Task, addr hostarch.Addr) (uintptr, *kernel.SyscallControl, error) {
+	var tx linux.Timex
+	if _, err := tx.CopyIn(t, addr); err != nil {
+		return 0, nil, err
+	}
+	if tx.Modes != 0 && tx.Modes != linux.ADJ_OFFSET_SS_READ {
+		return 0, nil, linuxerr.EPERM
+	}
+	tx, state := t.Kernel().Timex()
+	if _, err := tx.CopyOut(t, addr); err != nil {
+		return 0, nil, err
+	}
+	return uintptr(state), nil, nil
+}
+
 // Time implements linux syscall time(2).
 func Time(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	addr := args[0].Pointer()
@@ -317,8 +420,13 @@ func Gettimeofday(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (ui
 	}
 
 	if tz != hostarch.Addr(0) {
-		// Ask the time package for the timezone.
-		_, offset := time.Now().Zone()
+		// Ask the time package for the timezone, which is an input from the
+		// host in deterministic mode.
+		in := t.Kernel().DeterministicRead("host timezone", func() kernel.ExternalInput {
+			_, offset := time.Now().Zone()
+			return kernel.ExternalInput{Args: []int64{int64(offset)}}
+		})
+		offset := int(in.Args[0])
 		// This int32 array mimics linux's struct timezone.
 		timezone := []int32{-int32(offset) / 60, 0}
 		_, err := primitive.CopyInt32SliceOut(t, tz, timezone)
@@ -34,11 +34,21 @@ func Uname(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 	copy(u.Release[:], version.Release)
 	copy(u.Version[:], version.Version)
 	// build tag above.
+	// Compare Linux's kernel/sys.c:override_architecture().
+	per32 := t.Personality()&linux.PER_MASK == linux.PER_LINUX32
 	switch t.SyscallTable().Arch {
 	case arch.AMD64:
-		copy(u.Machine[:], "x86_64")
+		if per32 {
+			copy(u.Machine[:], "i686")
+		} else {
+			copy(u.Machine[:], "x86_64")
+		}
 	case arch.ARM64:
-		copy(u.Machine[:], "aarch64")
+		if per32 {
+			copy(u.Machine[:], "armv8l")
+		} else {
+			copy(u.Machine[:], "aarch64")
+		}
 	default:
 		copy(u.Machine[:], "unknown")
 	}
@@ -79,6 +79,7 @@ func Error(name string, err error, note string, urls []string) kernel.Syscall {
 		Name: name,
 		Fn: func(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 			kernel.IncrementUnimplementedSyscallCounter(sysno)
+			t.RecordUnimplementedSyscall(sysno)
 			return 0, nil, err
 		},
 		SupportLevel: kernel.SupportUnimplemented,
@@ -222,6 +222,18 @@ func (c *CalibratedClock) GetTime() (int64, error) {
 	return v, nil
 }
 
+// Error returns the magnitude of the clock error estimated by the most recent
+// update, in nanoseconds. ok is false if the clock is not yet calibrated, in
+// which case time is read from the reference clock directly.
+func (c *CalibratedClock) Error() (errorNS ReferenceNS, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.ready {
+		return 0, false
+	}
+	return c.errorNS.Magnitude(), true
+}
+
 // CalibratedClocks contains calibrated monotonic and realtime clocks.
 //
 // TODO(mpratt): We know that Linux runs the monotonic and realtime clocks at
@@ -262,3 +274,16 @@ func (c *CalibratedClocks) GetTime(id ClockID) (int64, error) {
 		return 0, linuxerr.EINVAL
 	}
 }
+
+// Error returns the estimated error of the given clock, as for
+// CalibratedClock.Error.
+func (c *CalibratedClocks) Error(id ClockID) (ReferenceNS, bool) {
+	switch id {
+	case Monotonic:
+		return c.monotonic.Error()
+	case Realtime:
+		return c.realtime.Error()
+	default:
+		return 0, false
+	}
+}
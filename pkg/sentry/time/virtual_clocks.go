@@ -0,0 +1,160 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package time
+
+import (
+	"container/heap"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// VirtualClocks implements Clocks with clocks that only advance when told to,
+// independently of the host's clocks, for deterministic execution.
+//
+// VirtualClocks never report ready parameters from Update, so that the vDSO
+// falls back to system calls and every clock read is observed by the sentry.
+type VirtualClocks struct {
+	// realtimeBase is the realtime at which the monotonic clock is 0. It is
+	// immutable.
+	realtimeBase int64
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// now is the monotonic time in nanoseconds.
+	now int64
+
+	// deadlines is a min-heap of the monotonic times at which timers on the
+	// clocks expire, as noted by AddDeadline. deadlineSet holds the same
+	// times, to avoid duplicates.
+	deadlines   deadlineHeap
+	deadlineSet map[int64]struct{}
+}
+
+// NewVirtualClocks returns VirtualClocks whose monotonic clock starts at 0 and
+// whose realtime clock starts at realtimeBase nanoseconds.
+func NewVirtualClocks(realtimeBase int64) *VirtualClocks {
+	return &VirtualClocks{
+		realtimeBase: realtimeBase,
+		deadlineSet:  make(map[int64]struct{}),
+	}
+}
+
+// Update implements Clocks.Update.
+func (c *VirtualClocks) Update() (Parameters, bool, Parameters, bool) {
+	return Parameters{}, false, Parameters{}, false
+}
+
+// GetTime implements Clocks.GetTime.
+func (c *VirtualClocks) GetTime(id ClockID) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch id {
+	case Monotonic:
+		return c.now, nil
+	case Realtime:
+		return c.realtimeBase + c.now, nil
+	default:
+		return 0, linuxerr.EINVAL
+	}
+}
+
+// AddDeadline notes that a timer on clock id expires at ns nanoseconds, so
+// that Advance can report its expiration and NextDeadline can skip to it.
+func (c *VirtualClocks) AddDeadline(id ClockID, ns int64) {
+	if id == Realtime {
+		ns -= c.realtimeBase
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ns <= c.now {
+		// Already expired; the timer will see this when it checks.
+		return
+	}
+	if _, ok := c.deadlineSet[ns]; ok {
+		return
+	}
+	c.deadlineSet[ns] = struct{}{}
+	heap.Push(&c.deadlines, ns)
+}
+
+// Advance advances the clocks by d. It returns true if any deadline passed to
+// AddDeadline has been reached, in which case timers on the clocks must check
+// for expirations.
+func (c *VirtualClocks) Advance(d time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.advanceToLocked(c.now + d.Nanoseconds())
+}
+
+// AdvanceTo advances the monotonic clock to ns, if it is before ns, with the
+// same return value as Advance.
+func (c *VirtualClocks) AdvanceTo(ns int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.advanceToLocked(ns)
+}
+
+// Preconditions: c.mu must be locked.
+func (c *VirtualClocks) advanceToLocked(ns int64) bool {
+	if ns > c.now {
+		c.now = ns
+	}
+	expired := false
+	for len(c.deadlines) > 0 && c.deadlines[0] <= c.now {
+		delete(c.deadlineSet, heap.Pop(&c.deadlines).(int64))
+		expired = true
+	}
+	return expired
+}
+
+// NextDeadline returns the earliest monotonic time passed to AddDeadline that
+// hasn't been reached, or false if there is none.
+//
+// Deadlines are not removed when timers are stopped, so the deadline may no
+// longer be of interest to any timer.
+func (c *VirtualClocks) NextDeadline() (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.deadlines) == 0 {
+		return 0, false
+	}
+	return c.deadlines[0], true
+}
+
+// deadlineHeap implements heap.Interface for a min-heap of times.
+type deadlineHeap []int64
+
+// Len implements sort.Interface.Len.
+func (h deadlineHeap) Len() int { return len(h) }
+
+// Less implements sort.Interface.Less.
+func (h deadlineHeap) Less(i, j int) bool { return h[i] < h[j] }
+
+// Swap implements sort.Interface.Swap.
+func (h deadlineHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+// Push implements heap.Interface.Push.
+func (h *deadlineHeap) Push(x any) { *h = append(*h, x.(int64)) }
+
+// Pop implements heap.Interface.Pop.
+func (h *deadlineHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package time
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVirtualClocksAdvance(t *testing.T) {
+	c := NewVirtualClocks(1000)
+	if expired := c.Advance(10 * time.Nanosecond); expired {
+		t.Errorf("Advance with no deadlines got expired = true, want false")
+	}
+	if got, err := c.GetTime(Monotonic); err != nil || got != 10 {
+		t.Errorf("GetTime(Monotonic) got (%d, %v), want (10, nil)", got, err)
+	}
+	if got, err := c.GetTime(Realtime); err != nil || got != 1010 {
+		t.Errorf("GetTime(Realtime) got (%d, %v), want (1010, nil)", got, err)
+	}
+	if _, _, _, ok := c.Update(); ok {
+		t.Errorf("Update got realtimeOk = true, want false")
+	}
+}
+
+func TestVirtualClocksDeadlines(t *testing.T) {
+	c := NewVirtualClocks(1000)
+	c.AddDeadline(Monotonic, 30)
+	c.AddDeadline(Realtime, 1020)
+	c.AddDeadline(Monotonic, 20)
+
+	if got, ok := c.NextDeadline(); !ok || got != 20 {
+		t.Errorf("NextDeadline got (%d, %t), want (20, true)", got, ok)
+	}
+	if expired := c.Advance(10 * time.Nanosecond); expired {
+		t.Errorf("Advance to 10 got expired = true, want false")
+	}
+	if expired := c.Advance(10 * time.Nanosecond); !expired {
+		t.Errorf("Advance to 20 got expired = false, want true")
+	}
+	if got, ok := c.NextDeadline(); !ok || got != 30 {
+		t.Errorf("NextDeadline got (%d, %t), want (30, true)", got, ok)
+	}
+	if expired := c.AdvanceTo(30); !expired {
+		t.Errorf("AdvanceTo(30) got expired = false, want true")
+	}
+	if _, ok := c.NextDeadline(); ok {
+		t.Errorf("NextDeadline got ok = true, want false")
+	}
+
+	// Time doesn't go backwards, and past deadlines are ignored.
+	c.AdvanceTo(5)
+	if got, _ := c.GetTime(Monotonic); got != 30 {
+		t.Errorf("GetTime(Monotonic) after AdvanceTo(5) got %d, want 30", got)
+	}
+	c.AddDeadline(Monotonic, 25)
+	if _, ok := c.NextDeadline(); ok {
+		t.Errorf("NextDeadline after adding past deadline got ok = true, want false")
+	}
+}
@@ -504,6 +504,39 @@ type Dirent struct {
 	NextOff int64
 }
 
+// FileDescriptionImplSyncRangeExtension is an optional extension to
+// FileDescriptionImpl for files that can write out a byte range of their data
+// to persistent storage.
+type FileDescriptionImplSyncRangeExtension interface {
+	// SyncRange implements sync_file_range(2) for the byte range
+	// [offset, offset+nbytes), or from offset through the end of the file if
+	// nbytes is 0. flags is a combination of linux.SYNC_FILE_RANGE_* flags.
+	SyncRange(ctx context.Context, offset, nbytes int64, flags uint32) error
+}
+
+// FileDescriptionImplWriteHintExtension is an optional extension to
+// FileDescriptionImpl for files that keep track of the expected write life
+// time of their data.
+type FileDescriptionImplWriteHintExtension interface {
+	// WriteHint returns the file's write life time hint, one of
+	// linux.RWH_WRITE_LIFE_*.
+	WriteHint() uint64
+
+	// SetWriteHint sets the file's write life time hint. hint has been
+	// validated by the caller.
+	SetWriteHint(ctx context.Context, hint uint64) error
+}
+
+// FileDescriptionImplAdviseExtension is an optional extension to
+// FileDescriptionImpl for files that can act on advice about their expected
+// access pattern.
+type FileDescriptionImplAdviseExtension interface {
+	// Advise implements fadvise64(2) for the byte range [offset, offset+length),
+	// or from offset through the end of the file if length is 0. advice is one
+	// of linux.POSIX_FADV_*, and has been validated by the caller.
+	Advise(ctx context.Context, offset, length int64, advice int32) error
+}
+
 // IterDirentsCallback receives Dirents from FileDescriptionImpl.IterDirents.
 type IterDirentsCallback interface {
 	// Handle handles the given iterated Dirent. If Handle returns a non-nil
@@ -701,6 +734,50 @@ func (fd *FileDescription) Sync(ctx context.Context) error {
 	return fd.impl.Sync(ctx)
 }
 
+// SyncRange has the semantics of sync_file_range(2). Files that don't
+// implement FileDescriptionImplSyncRangeExtension are synced in full if flags
+// includes SYNC_FILE_RANGE_WAIT_AFTER. Otherwise, they have no write-out in
+// progress that SYNC_FILE_RANGE_WAIT_BEFORE could wait for, and
+// SYNC_FILE_RANGE_WRITE is safely ignored.
+func (fd *FileDescription) SyncRange(ctx context.Context, offset, nbytes int64, flags uint32) error {
+	if ext, ok := fd.impl.(FileDescriptionImplSyncRangeExtension); ok {
+		return ext.SyncRange(ctx, offset, nbytes, flags)
+	}
+	if flags&linux.SYNC_FILE_RANGE_WAIT_AFTER != 0 {
+		return fd.impl.Sync(ctx)
+	}
+	return nil
+}
+
+// WriteHint returns the write life time hint of the file represented by fd, as
+// for fcntl(2) F_GET_RW_HINT.
+func (fd *FileDescription) WriteHint() (uint64, error) {
+	ext, ok := fd.impl.(FileDescriptionImplWriteHintExtension)
+	if !ok {
+		return 0, linuxerr.EINVAL
+	}
+	return ext.WriteHint(), nil
+}
+
+// SetWriteHint sets the write life time hint of the file represented by fd,
+// as for fcntl(2) F_SET_RW_HINT.
+func (fd *FileDescription) SetWriteHint(ctx context.Context, hint uint64) error {
+	ext, ok := fd.impl.(FileDescriptionImplWriteHintExtension)
+	if !ok {
+		return linuxerr.EINVAL
+	}
+	return ext.SetWriteHint(ctx, hint)
+}
+
+// Advise has the semantics of fadvise64(2). Advice is ignored by files that
+// don't implement FileDescriptionImplAdviseExtension.
+func (fd *FileDescription) Advise(ctx context.Context, offset, length int64, advice int32) error {
+	if ext, ok := fd.impl.(FileDescriptionImplAdviseExtension); ok {
+		return ext.Advise(ctx, offset, length, advice)
+	}
+	return nil
+}
+
 // ConfigureMMap mutates opts to implement mmap(2) for the file represented by
 // fd.
 func (fd *FileDescription) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
@@ -857,6 +857,34 @@ func (vfs *VirtualFilesystem) SyncAllFilesystems(ctx context.Context) error {
 	return retErr
 }
 
+// FilesystemImplHealthExtension is an optional extension to FilesystemImpl
+// for filesystems that depend on an external server.
+type FilesystemImplHealthExtension interface {
+	// CheckHealth returns an error if the filesystem's server cannot currently
+	// serve requests. It may block for as long as the server does.
+	CheckHealth(ctx context.Context) error
+}
+
+// CheckFilesystemsHealth calls CheckHealth on all filesystems that implement
+// FilesystemImplHealthExtension, and returns the number of filesystems checked
+// and the errors they returned.
+func (vfs *VirtualFilesystem) CheckFilesystemsHealth(ctx context.Context) (int, []error) {
+	var (
+		n    int
+		errs []error
+	)
+	for fs := range vfs.getFilesystems() {
+		if ext, ok := fs.impl.(FilesystemImplHealthExtension); ok {
+			n++
+			if err := ext.CheckHealth(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		fs.DecRef(ctx)
+	}
+	return n, errs
+}
+
 func (vfs *VirtualFilesystem) getFilesystems() map[*Filesystem]struct{} {
 	fss := make(map[*Filesystem]struct{})
 	vfs.filesystemsMu.Lock()
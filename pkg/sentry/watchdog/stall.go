@@ -0,0 +1,231 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package watchdog
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/metric"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// Subsystem identifies a sentry subsystem that is monitored for stalls.
+type Subsystem string
+
+// Subsystems monitored for stalls.
+const (
+	// SubsystemGofer monitors RPCs to gofers.
+	SubsystemGofer Subsystem = "gofer"
+
+	// SubsystemNetstack monitors the dispatch of inbound packets.
+	SubsystemNetstack Subsystem = "netstack"
+
+	// SubsystemPlatform monitors contexts waiting for the platform to run
+	// them.
+	SubsystemPlatform Subsystem = "platform"
+)
+
+var (
+	stallFieldGofer    = metric.FieldValue{Value: string(SubsystemGofer)}
+	stallFieldNetstack = metric.FieldValue{Value: string(SubsystemNetstack)}
+	stallFieldPlatform = metric.FieldValue{Value: string(SubsystemPlatform)}
+
+	stallFields = map[Subsystem]*metric.FieldValue{
+		SubsystemGofer:    &stallFieldGofer,
+		SubsystemNetstack: &stallFieldNetstack,
+		SubsystemPlatform: &stallFieldPlatform,
+	}
+
+	stallMetric = metric.MustCreateNewUint64Metric("/watchdog/stalls", false /* sync */, "Number of stalls detected by the watchdog, by subsystem.", metric.NewField("subsystem", &stallFieldGofer, &stallFieldNetstack, &stallFieldPlatform))
+)
+
+// Amount of time to wait before capturing diagnostics again for the same
+// subsystem.
+var stallReportPeriod = time.Minute
+
+// Queue is a snapshot of a queue of work items of a subsystem, e.g. RPCs
+// waiting on a reply or packets waiting to be processed.
+type Queue struct {
+	// Name identifies the queue in reports.
+	Name string
+
+	// Pending is the number of work items waiting in the queue, including
+	// the ones being processed.
+	Pending int
+
+	// Done counts the work items taken off the queue. It only needs to change
+	// when progress is made, so it may wrap around. It is ignored if Since is
+	// set.
+	Done uint64
+
+	// Since is the time at which the oldest pending work item was queued, if
+	// known. Otherwise, the queue is considered stalled if Done doesn't change
+	// for StallTimeout while items are pending.
+	Since time.Time
+}
+
+// StallDetector reports the work queues of a subsystem to the watchdog.
+type StallDetector struct {
+	// Subsystem is the monitored subsystem.
+	Subsystem Subsystem
+
+	// Queues returns a snapshot of the subsystem's work queues.
+	Queues func() []Queue
+}
+
+// stallState is the state of a StallDetector across monitoring loops.
+type stallState struct {
+	StallDetector
+
+	// progress maps the names of queues with pending work items to their
+	// last observed progress.
+	progress map[string]queueProgress
+
+	// stalled is true if the last monitoring loop found stalled queues.
+	stalled bool
+
+	// lastReport is the last time diagnostics were captured.
+	lastReport time.Time
+
+	// suppressed is the number of reports skipped since lastReport.
+	suppressed int
+}
+
+type queueProgress struct {
+	done  uint64
+	since time.Time
+}
+
+// AddStallDetector makes the watchdog check d for stalls of its subsystem
+// in every monitoring loop, if Opts.StallTimeout is set.
+func (w *Watchdog) AddStallDetector(d StallDetector) {
+	w.stallMu.Lock()
+	defer w.stallMu.Unlock()
+	w.stallDetectors = append(w.stallDetectors, &stallState{
+		StallDetector: d,
+		progress:      make(map[string]queueProgress),
+	})
+}
+
+// checkStalls checks all stall detectors and reports stalled subsystems.
+func (w *Watchdog) checkStalls() {
+	if w.StallTimeout == 0 {
+		return
+	}
+	w.stallMu.Lock()
+	detectors := w.stallDetectors
+	w.stallMu.Unlock()
+
+	// Detectors look at state guarded by subsystem locks, which may be held by
+	// the stalled goroutines. Run them concurrently and report the ones that
+	// don't return in time, instead of blocking the watchdog silently.
+	queues := make([][]Queue, len(detectors))
+	var wg sync.WaitGroup
+	for i, d := range detectors {
+		wg.Add(1)
+		go func(i int, d *stallState) { // S/R-SAFE: watchdog is stopped and restarted during S/R.
+			defer wg.Done()
+			queues[i] = d.Queues()
+		}(i, d)
+	}
+	done := make(chan struct{})
+	go func() { // S/R-SAFE: watchdog is stopped and restarted during S/R.
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(w.StallTimeout):
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "Watchdog stall detectors did not return within %v", w.StallTimeout)
+		w.doAction(w.StallAction, false, &buf)
+		<-done
+	}
+
+	stalledSubsystems := 0
+	now := time.Now()
+	for i, d := range detectors {
+		if w.checkQueues(d, queues[i], now) {
+			stalledSubsystems++
+		}
+	}
+	w.setStatus(func(s *Status) { s.StalledSubsystems = stalledSubsystems })
+}
+
+// checkQueues checks whether any of the given queues of d is stalled, and
+// reports them if so. It returns true if a stall was found.
+func (w *Watchdog) checkQueues(d *stallState, queues []Queue, now time.Time) bool {
+	progress := make(map[string]queueProgress)
+	var stalled []string
+	for _, q := range queues {
+		if q.Pending == 0 {
+			continue
+		}
+		since := q.Since
+		if since.IsZero() {
+			p, ok := d.progress[q.Name]
+			if !ok || p.done != q.Done {
+				p = queueProgress{done: q.Done, since: now}
+			}
+			progress[q.Name] = p
+			since = p.since
+		}
+		if age := now.Sub(since); age > w.StallTimeout {
+			stalled = append(stalled, fmt.Sprintf("%s: %d pending, no progress for %v", q.Name, q.Pending, age.Round(time.Second)))
+		}
+	}
+	d.progress = progress
+
+	if len(stalled) == 0 {
+		d.stalled = false
+		return false
+	}
+	if !d.stalled {
+		// A new stall started.
+		d.stalled = true
+		if f, ok := stallFields[d.Subsystem]; ok {
+			stallMetric.Increment(f)
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Sentry detected a stall in %s:\n", d.Subsystem)
+	for _, s := range stalled {
+		fmt.Fprintf(&buf, "\t%s\n", s)
+	}
+	buf.WriteString("All queues:\n")
+	for _, q := range queues {
+		fmt.Fprintf(&buf, "\t%+v\n", q)
+	}
+	w.reportStall(d, &buf)
+	return true
+}
+
+// reportStall captures diagnostics for a stall of d's subsystem, unless they
+// were captured less than stallReportPeriod ago.
+func (w *Watchdog) reportStall(d *stallState, msg *bytes.Buffer) {
+	if time.Since(d.lastReport) < stallReportPeriod {
+		d.suppressed++
+		return
+	}
+	if d.suppressed > 0 {
+		fmt.Fprintf(msg, "%d reports suppressed since %v\n", d.suppressed, d.lastReport)
+	}
+	d.lastReport = time.Now()
+	d.suppressed = 0
+	w.doAction(w.StallAction, true, msg)
+}
@@ -58,6 +58,15 @@ type Opts struct {
 	// StartupTimeoutAction indicates what action to take when
 	// watchdog.Start is not called within the timeout.
 	StartupTimeoutAction Action
+
+	// StallTimeout is the amount of time a subsystem monitored with a
+	// StallDetector may have pending work without making progress before it's
+	// declared stalled. Zero disables stall detection.
+	StallTimeout time.Duration
+
+	// StallAction indicates what action to take when a stalled subsystem is
+	// detected.
+	StallAction Action
 }
 
 // DefaultOpts is a default set of options for the watchdog.
@@ -69,6 +78,10 @@ var DefaultOpts = Opts{
 	// Startup timeout.
 	StartupTimeout:       30 * time.Second,
 	StartupTimeoutAction: LogWarning,
+
+	// Stall timeout.
+	StallTimeout: time.Minute,
+	StallAction:  LogWarning,
 }
 
 // descheduleThreshold is the amount of time scheduling needs to be off before the entire wait period
@@ -158,6 +171,43 @@ type Watchdog struct {
 	// startCalled is true if Start has ever been called. It remains true
 	// even if Stop is called.
 	startCalled bool
+
+	// statusMu protects status. It is separate from mu because Stop holds mu
+	// while waiting for the loop to exit.
+	statusMu sync.Mutex
+
+	// status is the result of the last monitoring loop.
+	status Status
+
+	// stallMu protects stallDetectors.
+	stallMu sync.Mutex
+
+	// stallDetectors are the subsystems monitored for stalls.
+	stallDetectors []*stallState
+}
+
+// Status is the state of the sandbox as seen by the watchdog.
+type Status struct {
+	// Running is true if the watchdog is monitoring tasks.
+	Running bool
+
+	// StuckTasks is the number of tasks found stuck in the kernel by the last
+	// monitoring loop.
+	StuckTasks int
+
+	// Stuck is true if the watchdog itself is stuck, i.e. the last monitoring
+	// loop could not list tasks within the task timeout.
+	Stuck bool
+
+	// LastCheck is the time at which the last monitoring loop started.
+	LastCheck time.Time
+
+	// Period is how often the monitoring loop runs.
+	Period time.Duration
+
+	// StalledSubsystems is the number of subsystems found stalled by the last
+	// monitoring loop.
+	StalledSubsystems int
 }
 
 type offender struct {
@@ -203,6 +253,11 @@ func (w *Watchdog) Start() {
 	w.lastRun = w.k.MonotonicClock().Now()
 
 	log.Infof("Starting watchdog, period: %v, timeout: %v, action: %v", w.period, w.TaskTimeout, w.TaskTimeoutAction)
+	w.statusMu.Lock()
+	w.status.Running = true
+	w.status.LastCheck = time.Now()
+	w.status.Period = w.period
+	w.statusMu.Unlock()
 	go w.loop() // S/R-SAFE: watchdog is stopped during save and restarted after restore.
 	w.running = true
 }
@@ -222,9 +277,27 @@ func (w *Watchdog) Stop() {
 	w.stop <- struct{}{}
 	<-w.done
 	w.running = false
+	w.statusMu.Lock()
+	w.status.Running = false
+	w.statusMu.Unlock()
 	log.Infof("Watchdog stopped")
 }
 
+// Status returns the state of the sandbox as seen by the last monitoring
+// loop.
+func (w *Watchdog) Status() Status {
+	w.statusMu.Lock()
+	defer w.statusMu.Unlock()
+	return w.status
+}
+
+// setStatus updates the status with the outcome of a monitoring loop.
+func (w *Watchdog) setStatus(f func(s *Status)) {
+	w.statusMu.Lock()
+	defer w.statusMu.Unlock()
+	f(&w.status)
+}
+
 // waitForStart waits for Start to be called and takes action if it does not
 // happen within the startup timeout.
 func (w *Watchdog) waitForStart() {
@@ -263,6 +336,7 @@ func (w *Watchdog) runTurn() {
 	// is a deadlock affecting root's PID namespace mutex. Run it in a goroutine
 	// and report if it takes too long to return.
 	var tasks []*kernel.Task
+	w.setStatus(func(s *Status) { s.LastCheck = time.Now() })
 	done := make(chan struct{})
 	go func() { // S/R-SAFE: watchdog is stopped and restarted during S/R.
 		tasks = w.k.TaskSet().Root.Tasks()
@@ -274,8 +348,10 @@ func (w *Watchdog) runTurn() {
 	case <-time.After(w.TaskTimeout):
 		// Report if the watchdog is not making progress.
 		// No one is watching the watchdog watcher though.
+		w.setStatus(func(s *Status) { s.Stuck = true })
 		w.reportStuckWatchdog()
 		<-done
+		w.setStatus(func(s *Status) { s.Stuck = false })
 	}
 
 	newOffenders := make(map[*kernel.Task]*offender)
@@ -322,6 +398,9 @@ func (w *Watchdog) runTurn() {
 
 	// Remember which tasks have been reported.
 	w.offenders = newOffenders
+	w.setStatus(func(s *Status) { s.StuckTasks = len(newOffenders) })
+
+	w.checkStalls()
 }
 
 // report takes appropriate action when a stuck task is detected.
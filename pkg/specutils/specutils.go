@@ -0,0 +1,134 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package specutils validates OCI runtime specs against runsc without running
+// it. Orchestrators can use it to reject specs that runsc would refuse to run,
+// or that request features that the runsc flags deployed on a node don't
+// enable, before scheduling them.
+//
+// Specs are validated against the runsc version that this package is built
+// from, so it should be pinned to the version deployed on the nodes.
+package specutils
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/runsc/specutils"
+)
+
+// Code classifies the ways in which a spec can be incompatible with runsc.
+type Code = specutils.SpecErrorCode
+
+const (
+	// CodeMissing means that a mandatory field is not set.
+	CodeMissing = specutils.SpecErrorMissing
+
+	// CodeUnsupported means that runsc doesn't support the field.
+	CodeUnsupported = specutils.SpecErrorUnsupported
+
+	// CodeInvalid means that the field is set to an invalid value.
+	CodeInvalid = specutils.SpecErrorInvalid
+
+	// CodeDisabled means that the field requests a feature that runsc
+	// supports, but that is not enabled by its flags. FieldError.Flag is the
+	// flag that enables it.
+	CodeDisabled = specutils.SpecErrorDisabled
+)
+
+// FieldError describes a field of a spec that is incompatible with runsc.
+type FieldError = specutils.SpecError
+
+// Error is returned by Validate when the spec is incompatible with runsc.
+type Error struct {
+	// Errors lists all incompatible fields.
+	Errors []*FieldError
+}
+
+// Error implements error.Error.
+func (e *Error) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", fe.Field, fe))
+	}
+	return fmt.Sprintf("spec is incompatible with runsc: %s", strings.Join(msgs, "; "))
+}
+
+// Options configures Validate.
+type Options struct {
+	// Flags are the runsc flags to validate the spec against, by name without
+	// leading dashes, e.g. {"nvproxy": "true"}. As with runsc, a "config" flag
+	// loads flags that are not set explicitly from the given config file,
+	// which must exist. Flags that are not set have their default value.
+	Flags map[string]string
+}
+
+// Validate checks that runsc, run with opts.Flags, can run the given spec
+// and provides all the features that it requests. The spec is not modified.
+//
+// If the spec is incompatible, Validate returns an *Error that lists all
+// incompatible fields. Other errors mean that opts are invalid.
+func Validate(spec *specs.Spec, opts Options) error {
+	flagSet, conf, err := newConfig(opts.Flags)
+	if err != nil {
+		return fmt.Errorf("invalid runsc flags: %w", err)
+	}
+
+	errs := specutils.CheckSpec(spec)
+	if err := specutils.ApplyConfigAnnotations(spec, conf, flagSet); err != nil {
+		var fe *FieldError
+		if !errors.As(err, &fe) {
+			fe = &FieldError{Code: CodeInvalid, Field: "annotations", Err: err}
+		}
+		errs = append(errs, fe)
+	}
+	errs = append(errs, specutils.CheckFeatures(spec, conf)...)
+	if len(errs) > 0 {
+		return &Error{Errors: errs}
+	}
+	return nil
+}
+
+// newConfig returns the runsc config made of the given flags, in the same way
+// as runsc does from its command line.
+func newConfig(flags map[string]string) (*flag.FlagSet, *config.Config, error) {
+	flagSet := flag.NewFlagSet("runsc", flag.ContinueOnError)
+	config.RegisterFlags(flagSet)
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if flagSet.Lookup(name) == nil {
+			return nil, nil, fmt.Errorf("unknown flag %q", name)
+		}
+		if err := flagSet.Set(name, flags[name]); err != nil {
+			return nil, nil, fmt.Errorf("setting flag %s=%q: %w", name, flags[name], err)
+		}
+	}
+	if err := config.ApplyFile(flagSet); err != nil {
+		return nil, nil, err
+	}
+	conf, err := config.NewFromFlags(flagSet)
+	if err != nil {
+		return nil, nil, err
+	}
+	return flagSet, conf, nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package specutils
+
+import (
+	"errors"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func validSpec() *specs.Spec {
+	return &specs.Spec{
+		Root: &specs.Root{Path: "/"},
+		Process: &specs.Process{
+			Args:            []string{"/bin/true"},
+			NoNewPrivileges: true,
+		},
+	}
+}
+
+type fieldErr struct {
+	code  Code
+	field string
+	flag  string
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		spec  func(*specs.Spec)
+		flags map[string]string
+		want  []fieldErr
+	}{
+		{
+			name: "valid",
+			spec: func(*specs.Spec) {},
+		},
+		{
+			name: "all errors",
+			spec: func(s *specs.Spec) {
+				s.Process = nil
+				s.Windows = &specs.Windows{}
+				s.Mounts = []specs.Mount{
+					{Destination: "/ok"},
+					{Destination: "relative"},
+				}
+			},
+			want: []fieldErr{
+				{code: CodeMissing, field: "process"},
+				{code: CodeUnsupported, field: "windows"},
+				{code: CodeInvalid, field: "mounts[1].destination"},
+			},
+		},
+		{
+			name: "gpu disabled",
+			spec: func(s *specs.Spec) {
+				s.Linux = &specs.Linux{Devices: []specs.LinuxDevice{{Path: "/dev/nvidiactl"}}}
+			},
+			want: []fieldErr{
+				{code: CodeDisabled, field: "linux.devices[0]", flag: "nvproxy"},
+			},
+		},
+		{
+			name: "gpu enabled",
+			spec: func(s *specs.Spec) {
+				s.Linux = &specs.Linux{Devices: []specs.LinuxDevice{{Path: "/dev/nvidiactl"}}}
+			},
+			flags: map[string]string{"nvproxy": "true"},
+		},
+		{
+			name: "flag override disabled",
+			spec: func(s *specs.Spec) {
+				s.Annotations = map[string]string{"dev.gvisor.flag.nvproxy": "true"}
+				s.Linux = &specs.Linux{Devices: []specs.LinuxDevice{{Path: "/dev/nvidiactl"}}}
+			},
+			want: []fieldErr{
+				{code: CodeDisabled, field: "annotations[dev.gvisor.flag.nvproxy]", flag: "allow-flag-override"},
+				{code: CodeDisabled, field: "linux.devices[0]", flag: "nvproxy"},
+			},
+		},
+		{
+			name: "flag override enabled",
+			spec: func(s *specs.Spec) {
+				s.Annotations = map[string]string{"dev.gvisor.flag.nvproxy": "true"}
+				s.Linux = &specs.Linux{Devices: []specs.LinuxDevice{{Path: "/dev/nvidiactl"}}}
+			},
+			flags: map[string]string{"allow-flag-override": "true"},
+		},
+		{
+			name: "allowed flag override",
+			spec: func(s *specs.Spec) {
+				s.Annotations = map[string]string{"dev.gvisor.flag.debug": "true"}
+			},
+		},
+		{
+			name: "invalid flag override",
+			spec: func(s *specs.Spec) {
+				s.Annotations = map[string]string{"dev.gvisor.flag.debug": "bogus"}
+			},
+			want: []fieldErr{
+				{code: CodeInvalid, field: "annotations[dev.gvisor.flag.debug]"},
+			},
+		},
+		{
+			name: "profile without config file",
+			spec: func(s *specs.Spec) {
+				s.Annotations = map[string]string{"dev.gvisor.profile": "hardened"}
+			},
+			want: []fieldErr{
+				{code: CodeDisabled, field: "annotations[dev.gvisor.profile]", flag: "config"},
+			},
+		},
+		{
+			name: "unknown container type",
+			spec: func(s *specs.Spec) {
+				s.Annotations = map[string]string{"io.kubernetes.cri.container-type": "bogus"}
+			},
+			want: []fieldErr{
+				{code: CodeInvalid, field: "annotations[io.kubernetes.cri.container-type]"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := validSpec()
+			tc.spec(spec)
+			err := Validate(spec, Options{Flags: tc.flags})
+			if len(tc.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() failed: %v", err)
+				}
+				return
+			}
+			var verr *Error
+			if !errors.As(err, &verr) {
+				t.Fatalf("Validate() = %v, want *Error", err)
+			}
+			var got []fieldErr
+			for _, fe := range verr.Errors {
+				got = append(got, fieldErr{code: fe.Code, field: fe.Field, flag: fe.Flag})
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("Validate() = %v, want errors %+v", err, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("Validate() error %d = %+v, want %+v", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateInvalidFlags(t *testing.T) {
+	for _, flags := range []map[string]string{
+		{"bogus": "true"},
+		{"nvproxy": "bogus"},
+		{"network": "none", "egress-proxy": "socks5://1.2.3.4:1080"},
+	} {
+		err := Validate(validSpec(), Options{Flags: flags})
+		var verr *Error
+		if err == nil || errors.As(err, &verr) {
+			t.Errorf("Validate(%v) = %v, want flag error", flags, err)
+		}
+	}
+}
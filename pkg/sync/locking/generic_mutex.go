@@ -55,6 +55,17 @@ func (m *Mutex) NestedLock(i lockNameIndex) {
 	m.mu.Lock()
 }
 
+// TryLock tries to lock m. It returns true if it succeeds and false
+// otherwise. TryLock does not block.
+// +checklocksignore
+func (m *Mutex) TryLock() bool {
+	if !m.mu.TryLock() {
+		return false
+	}
+	locking.AddGLock(genericMarkIndex, -1)
+	return true
+}
+
 // Unlock unlocks m.
 // +checklocksignore
 func (m *Mutex) Unlock() {
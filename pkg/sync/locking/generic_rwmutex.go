@@ -53,6 +53,17 @@ func (m *RWMutex) NestedLock(i lockNameIndex) {
 	m.mu.Lock()
 }
 
+// TryLock tries to lock m for writing. It returns true if it succeeds and
+// false otherwise. TryLock does not block.
+// +checklocksignore
+func (m *RWMutex) TryLock() bool {
+	if !m.mu.TryLock() {
+		return false
+	}
+	locking.AddGLock(genericMarkIndex, -1)
+	return true
+}
+
 // Unlock unlocks m.
 // +checklocksignore
 func (m *RWMutex) Unlock() {
@@ -0,0 +1,398 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package autoconf configures the IPv6 addresses and routes of NICs from the
+// network they are attached to, instead of statically: with Stateless Address
+// Autoconfiguration (SLAAC) from Router Advertisements, including temporary
+// addresses for privacy as per RFC 4941, and optionally with a minimal
+// stateful DHCPv6 client as per RFC 8415.
+//
+// SLAAC itself is implemented by the ipv6 package; this package enables it on
+// the NICs that request it, and installs the routes and on-link prefixes that
+// Router Advertisements announce.
+package autoconf
+
+import (
+	"fmt"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// Mode is how a NIC is autoconfigured.
+type Mode int
+
+const (
+	// ModeNone disables autoconfiguration. The NIC is configured statically.
+	ModeNone Mode = iota
+
+	// ModeSLAAC configures addresses with SLAAC, and routes from Router
+	// Advertisements.
+	ModeSLAAC
+
+	// ModeDHCPv6 does what ModeSLAAC does, and also leases addresses with
+	// DHCPv6 while Router Advertisements have the Managed Address
+	// Configuration flag set.
+	ModeDHCPv6
+)
+
+var modeNames = [...]string{
+	ModeNone:   "none",
+	ModeSLAAC:  "slaac",
+	ModeDHCPv6: "dhcpv6",
+}
+
+// String implements fmt.Stringer.
+func (m Mode) String() string {
+	if m < 0 || int(m) >= len(modeNames) {
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+	return modeNames[m]
+}
+
+// ParseMode parses the name of a Mode, as returned by Mode.String.
+func ParseMode(s string) (Mode, error) {
+	for m, name := range modeNames {
+		if s == name {
+			return Mode(m), nil
+		}
+	}
+	return ModeNone, fmt.Errorf("invalid autoconfiguration mode %q", s)
+}
+
+// NDPConfigurations returns the NDP configurations of autoconfigured NICs: they
+// handle Router Advertisements, discover default routers and on-link prefixes,
+// and generate both stable and temporary SLAAC addresses.
+func NDPConfigurations() ipv6.NDPConfigurations {
+	c := ipv6.DefaultNDPConfigurations()
+	c.HandleRAs = ipv6.HandlingRAsEnabledWhenForwardingDisabled
+	c.DiscoverDefaultRouters = true
+	c.DiscoverMoreSpecificRoutes = true
+	c.DiscoverOnLinkPrefixes = true
+	c.AutoGenGlobalAddresses = true
+	c.AutoGenTempGlobalAddresses = true
+	return c
+}
+
+// Client autoconfigures NICs. It must be set as the NDP dispatcher of the
+// stack's IPv6 protocol, with ipv6.Options.NDPDisp, and started with Start
+// once the stack is created.
+//
+// NDP events are delivered with IPv6 endpoint locks held, so Client queues
+// them and applies them to the stack from its own goroutine.
+type Client struct {
+	// stack is the stack that NICs are configured in. It is immutable after
+	// Start.
+	stack *stack.Stack
+
+	// notify is signaled when work is queued.
+	notify chan struct{}
+
+	// done is closed by Stop.
+	done chan struct{}
+
+	mu sync.Mutex
+
+	// modes holds the mode of the NICs that are autoconfigured. NDP events for
+	// other NICs are ignored.
+	//
+	// +checklocks:mu
+	modes map[tcpip.NICID]Mode
+
+	// pending holds the work queued for the Client's goroutine.
+	//
+	// +checklocks:mu
+	pending []func()
+
+	// dhcp holds the running DHCPv6 clients, by NIC.
+	//
+	// +checklocks:mu
+	dhcp map[tcpip.NICID]*dhcpv6Client
+
+	// stopped is true after Stop.
+	//
+	// +checklocks:mu
+	stopped bool
+}
+
+var _ ipv6.NDPDispatcher = (*Client)(nil)
+
+// New returns a new Client.
+func New() *Client {
+	return &Client{
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		modes:  make(map[tcpip.NICID]Mode),
+		dhcp:   make(map[tcpip.NICID]*dhcpv6Client),
+	}
+}
+
+// Start starts applying NDP events to s.
+func (c *Client) Start(s *stack.Stack) {
+	c.stack = s
+	go c.run()
+}
+
+// Stop stops c and all DHCPv6 clients. Addresses and routes that were
+// configured are left in place.
+func (c *Client) Stop() {
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return
+	}
+	c.stopped = true
+	dhcp := c.dhcp
+	c.dhcp = nil
+	c.mu.Unlock()
+
+	close(c.done)
+	for _, d := range dhcp {
+		d.stop()
+	}
+}
+
+// Enable enables autoconfiguration of NIC id with the given mode, and enables
+// the NIC.
+//
+// Preconditions: The NIC was created disabled, with
+// stack.NICOptions.Disabled, so that it solicits routers once enabled.
+func (c *Client) Enable(id tcpip.NICID, mode Mode) error {
+	if mode == ModeNone {
+		return c.enableNIC(id)
+	}
+	ep, err := c.stack.GetNetworkEndpoint(id, ipv6.ProtocolNumber)
+	if err != nil {
+		return fmt.Errorf("GetNetworkEndpoint(%d, %d): %s", id, ipv6.ProtocolNumber, err)
+	}
+	ndpEP, ok := ep.(ipv6.NDPEndpoint)
+	if !ok {
+		return fmt.Errorf("IPv6 endpoint of NIC %d doesn't support NDP", id)
+	}
+
+	c.mu.Lock()
+	c.modes[id] = mode
+	c.mu.Unlock()
+
+	ndpEP.SetNDPConfigurations(NDPConfigurations())
+	if err := c.addLinkLocalAddress(id); err != nil {
+		return err
+	}
+	log.Infof("Enabling IPv6 autoconfiguration of NIC %d with mode %s", id, mode)
+	return c.enableNIC(id)
+}
+
+func (c *Client) enableNIC(id tcpip.NICID) error {
+	if err := c.stack.EnableNIC(id); err != nil {
+		return fmt.Errorf("EnableNIC(%d): %s", id, err)
+	}
+	return nil
+}
+
+// addLinkLocalAddress adds a link-local address derived from the link address
+// of NIC id, unless it already has one. Routers send Router Advertisements to
+// link-local addresses, and DHCPv6 clients send requests from one.
+func (c *Client) addLinkLocalAddress(id tcpip.NICID) error {
+	info, ok := c.stack.NICInfo()[id]
+	if !ok {
+		return fmt.Errorf("unknown NIC %d", id)
+	}
+	for _, addr := range info.ProtocolAddresses {
+		if addr.Protocol == ipv6.ProtocolNumber && header.IsV6LinkLocalUnicastAddress(addr.AddressWithPrefix.Address) {
+			return nil
+		}
+	}
+	if !header.IsValidUnicastEthernetAddress(info.LinkAddress) {
+		return fmt.Errorf("NIC %d has no link-local address, and no link address to derive one from", id)
+	}
+	addr := tcpip.ProtocolAddress{
+		Protocol: ipv6.ProtocolNumber,
+		AddressWithPrefix: tcpip.AddressWithPrefix{
+			Address:   header.LinkLocalAddr(info.LinkAddress),
+			PrefixLen: header.IPv6LinkLocalPrefix.PrefixLen,
+		},
+	}
+	if err := c.stack.AddProtocolAddress(id, addr, stack.AddressProperties{}); err != nil {
+		return fmt.Errorf("AddProtocolAddress(%d, %+v): %s", id, addr, err)
+	}
+	return nil
+}
+
+// run applies queued work until c is stopped.
+func (c *Client) run() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.notify:
+		}
+		c.mu.Lock()
+		pending := c.pending
+		c.pending = nil
+		c.mu.Unlock()
+		for _, f := range pending {
+			f()
+		}
+	}
+}
+
+// enqueue queues f to be run by c's goroutine, if NIC id is autoconfigured.
+func (c *Client) enqueue(id tcpip.NICID, f func()) {
+	c.mu.Lock()
+	if c.stopped || c.modes[id] == ModeNone {
+		c.mu.Unlock()
+		return
+	}
+	c.pending = append(c.pending, f)
+	c.mu.Unlock()
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// addRoute adds r to the route table, before any less specific route so that
+// the most specific route to a destination is found first.
+func (c *Client) addRoute(r tcpip.Route) {
+	log.Debugf("IPv6 autoconfiguration: adding route %s", r)
+	table := c.stack.GetRouteTable()
+	i := 0
+	for ; i < len(table); i++ {
+		if table[i] == r {
+			return
+		}
+		if table[i].Destination.Prefix() < r.Destination.Prefix() {
+			break
+		}
+	}
+	table = append(table[:i], append([]tcpip.Route{r}, table[i:]...)...)
+	c.stack.SetRouteTable(table)
+}
+
+// removeRoute removes r from the route table.
+func (c *Client) removeRoute(r tcpip.Route) {
+	log.Debugf("IPv6 autoconfiguration: removing route %s", r)
+	c.stack.RemoveRoutes(func(rt tcpip.Route) bool {
+		return rt == r
+	})
+}
+
+// OnDuplicateAddressDetectionResult implements ipv6.NDPDispatcher.
+func (c *Client) OnDuplicateAddressDetectionResult(id tcpip.NICID, addr tcpip.Address, res stack.DADResult) {
+	if _, ok := res.(*stack.DADDupAddrDetected); ok {
+		c.enqueue(id, func() {
+			log.Warningf("IPv6 autoconfiguration: duplicate address %s detected on NIC %d", addr, id)
+		})
+	}
+}
+
+// OnOffLinkRouteUpdated implements ipv6.NDPDispatcher.
+func (c *Client) OnOffLinkRouteUpdated(id tcpip.NICID, dest tcpip.Subnet, router tcpip.Address, _ header.NDPRoutePreference) {
+	c.enqueue(id, func() {
+		c.addRoute(tcpip.Route{Destination: dest, Gateway: router, NIC: id})
+	})
+}
+
+// OnOffLinkRouteInvalidated implements ipv6.NDPDispatcher.
+func (c *Client) OnOffLinkRouteInvalidated(id tcpip.NICID, dest tcpip.Subnet, router tcpip.Address) {
+	c.enqueue(id, func() {
+		c.removeRoute(tcpip.Route{Destination: dest, Gateway: router, NIC: id})
+	})
+}
+
+// OnOnLinkPrefixDiscovered implements ipv6.NDPDispatcher.
+func (c *Client) OnOnLinkPrefixDiscovered(id tcpip.NICID, prefix tcpip.Subnet) {
+	c.enqueue(id, func() {
+		c.addRoute(tcpip.Route{Destination: prefix, NIC: id})
+	})
+}
+
+// OnOnLinkPrefixInvalidated implements ipv6.NDPDispatcher.
+func (c *Client) OnOnLinkPrefixInvalidated(id tcpip.NICID, prefix tcpip.Subnet) {
+	c.enqueue(id, func() {
+		c.removeRoute(tcpip.Route{Destination: prefix, NIC: id})
+	})
+}
+
+// OnAutoGenAddress implements ipv6.NDPDispatcher.
+func (c *Client) OnAutoGenAddress(id tcpip.NICID, addr tcpip.AddressWithPrefix) stack.AddressDispatcher {
+	c.enqueue(id, func() {
+		log.Infof("IPv6 autoconfiguration: generated address %s on NIC %d", addr, id)
+	})
+	return nil
+}
+
+// OnAutoGenAddressDeprecated implements ipv6.NDPDispatcher.
+func (c *Client) OnAutoGenAddressDeprecated(tcpip.NICID, tcpip.AddressWithPrefix) {}
+
+// OnAutoGenAddressInvalidated implements ipv6.NDPDispatcher.
+func (c *Client) OnAutoGenAddressInvalidated(id tcpip.NICID, addr tcpip.AddressWithPrefix) {
+	c.enqueue(id, func() {
+		log.Infof("IPv6 autoconfiguration: address %s on NIC %d invalidated", addr, id)
+	})
+}
+
+// OnRecursiveDNSServerOption implements ipv6.NDPDispatcher.
+//
+// DNS servers are configured by the container runtime, so this is only logged.
+func (c *Client) OnRecursiveDNSServerOption(id tcpip.NICID, addrs []tcpip.Address, lifetime time.Duration) {
+	c.enqueue(id, func() {
+		log.Debugf("IPv6 autoconfiguration: ignoring DNS servers %v advertised on NIC %d", addrs, id)
+	})
+}
+
+// OnDNSSearchListOption implements ipv6.NDPDispatcher.
+func (c *Client) OnDNSSearchListOption(tcpip.NICID, []string, time.Duration) {}
+
+// OnDHCPv6Configuration implements ipv6.NDPDispatcher.
+func (c *Client) OnDHCPv6Configuration(id tcpip.NICID, conf ipv6.DHCPv6ConfigurationFromNDPRA) {
+	c.enqueue(id, func() {
+		c.mu.Lock()
+		if c.stopped || c.modes[id] != ModeDHCPv6 {
+			c.mu.Unlock()
+			return
+		}
+		d, running := c.dhcp[id]
+		switch {
+		case conf == ipv6.DHCPv6ManagedAddress && !running:
+			c.mu.Unlock()
+			d, err := startDHCPv6Client(c.stack, id)
+			if err != nil {
+				log.Warningf("IPv6 autoconfiguration: starting DHCPv6 client on NIC %d: %v", id, err)
+				return
+			}
+			c.mu.Lock()
+			if c.stopped {
+				c.mu.Unlock()
+				d.stop()
+				return
+			}
+			c.dhcp[id] = d
+			c.mu.Unlock()
+		case conf != ipv6.DHCPv6ManagedAddress && running:
+			delete(c.dhcp, id)
+			c.mu.Unlock()
+			// Stop outside of c.mu: the DHCPv6 client removes its addresses
+			// from the stack, which may be delivering NDP events to c.
+			d.stop()
+		default:
+			c.mu.Unlock()
+		}
+	})
+}
@@ -0,0 +1,318 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package autoconf
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/checksum"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/prependable"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/icmp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+)
+
+const (
+	nicID    = 1
+	linkAddr = tcpip.LinkAddress("\x02\x02\x03\x04\x05\x06")
+)
+
+var (
+	routerAddr = header.LinkLocalAddr("\x02\x0a\x0b\x0c\x0d\x0e")
+	prefix     = tcpip.AddressWithPrefix{
+		Address:   tcpip.AddrFrom16([16]byte{0x20, 0x01, 0x0d, 0xb8, 0, 1}),
+		PrefixLen: 64,
+	}
+)
+
+// newTestStack returns a stack with an autoconfigured NIC.
+func newTestStack(t *testing.T, mode Mode) (*stack.Stack, *channel.Endpoint, *Client) {
+	t.Helper()
+	c := New()
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{ipv6.NewProtocolWithOptions(ipv6.Options{
+			NDPDisp:     c,
+			TempIIDSeed: []byte("0123456789abcdef"),
+		})},
+		TransportProtocols: []stack.TransportProtocolFactory{udp.NewProtocol, icmp.NewProtocol6},
+	})
+	ep := channel.New(16, header.IPv6MinimumMTU, linkAddr)
+	if err := s.CreateNICWithOptions(nicID, ep, stack.NICOptions{Disabled: true}); err != nil {
+		t.Fatalf("CreateNICWithOptions: %s", err)
+	}
+	c.Start(s)
+	if err := c.Enable(nicID, mode); err != nil {
+		t.Fatalf("Enable(%d, %s): %v", nicID, mode, err)
+	}
+	t.Cleanup(func() {
+		c.Stop()
+		s.Close()
+		s.Wait()
+	})
+	return s, ep, c
+}
+
+// injectRA injects a Router Advertisement from routerAddr, with a Prefix
+// Information option for prefix.
+func injectRA(ep *channel.Endpoint, managed bool) {
+	var pi [30]byte
+	pi[0] = uint8(prefix.PrefixLen)
+	// On-link and autonomous address-configuration flags.
+	pi[1] = 1<<7 | 1<<6
+	binary.BigEndian.PutUint32(pi[2:], 3600)
+	binary.BigEndian.PutUint32(pi[6:], 1800)
+	copy(pi[14:], prefix.Address.AsSlice())
+	opts := header.NDPOptionsSerializer{header.NDPPrefixInformation(pi[:])}
+
+	icmpSize := header.ICMPv6HeaderSize + header.NDPRAMinimumSize + opts.Length()
+	hdr := prependable.New(header.IPv6MinimumSize + icmpSize)
+	pkt := header.ICMPv6(hdr.Prepend(icmpSize))
+	pkt.SetType(header.ICMPv6RouterAdvert)
+	ra := pkt.MessageBody()
+	// Router lifetime.
+	binary.BigEndian.PutUint16(ra[2:], 1800)
+	if managed {
+		ra[1] |= 1 << 7
+	}
+	header.NDPRouterAdvert(ra).Options().Serialize(opts)
+	pkt.SetChecksum(header.ICMPv6Checksum(header.ICMPv6ChecksumParams{
+		Header: pkt,
+		Src:    routerAddr,
+		Dst:    header.IPv6AllNodesMulticastAddress,
+	}))
+	encodeIPv6(&hdr, header.ICMPv6ProtocolNumber, header.NDPHopLimit, routerAddr, header.IPv6AllNodesMulticastAddress)
+	inject(ep, hdr)
+}
+
+func encodeIPv6(hdr *prependable.Prependable, proto tcpip.TransportProtocolNumber, hopLimit uint8, src, dst tcpip.Address) {
+	payloadLength := hdr.UsedLength()
+	header.IPv6(hdr.Prepend(header.IPv6MinimumSize)).Encode(&header.IPv6Fields{
+		PayloadLength:     uint16(payloadLength),
+		TransportProtocol: proto,
+		HopLimit:          hopLimit,
+		SrcAddr:           src,
+		DstAddr:           dst,
+	})
+}
+
+func inject(ep *channel.Endpoint, hdr prependable.Prependable) {
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Payload: buffer.MakeWithData(hdr.View()),
+	})
+	ep.InjectInbound(header.IPv6ProtocolNumber, pkt)
+	pkt.DecRef()
+}
+
+// waitFor polls cond until it returns true, or fails the test after a while.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func addressesIn(s *stack.Stack, subnet tcpip.Subnet) []tcpip.AddressWithPrefix {
+	var addrs []tcpip.AddressWithPrefix
+	for _, addr := range s.NICInfo()[nicID].ProtocolAddresses {
+		if subnet.Contains(addr.AddressWithPrefix.Address) {
+			addrs = append(addrs, addr.AddressWithPrefix)
+		}
+	}
+	return addrs
+}
+
+func hasRoute(s *stack.Stack, r tcpip.Route) bool {
+	for _, rt := range s.GetRouteTable() {
+		if rt == r {
+			return true
+		}
+	}
+	return false
+}
+
+func TestParseMode(t *testing.T) {
+	for _, m := range []Mode{ModeNone, ModeSLAAC, ModeDHCPv6} {
+		if got, err := ParseMode(m.String()); err != nil || got != m {
+			t.Errorf("ParseMode(%q) = %s, %v, want %s", m.String(), got, err, m)
+		}
+	}
+	if _, err := ParseMode("dhcp"); err == nil {
+		t.Errorf("ParseMode(dhcp) succeeded, want error")
+	}
+}
+
+func TestSLAAC(t *testing.T) {
+	s, ep, _ := newTestStack(t, ModeSLAAC)
+
+	if got := addressesIn(s, header.IPv6LinkLocalPrefix.Subnet()); len(got) != 1 || got[0].Address != header.LinkLocalAddr(linkAddr) {
+		t.Errorf("got link-local addresses %v, want %s", got, header.LinkLocalAddr(linkAddr))
+	}
+
+	injectRA(ep, false /* managed */)
+
+	// A stable address and a temporary address are generated in the prefix.
+	waitFor(t, "SLAAC addresses", func() bool {
+		return len(addressesIn(s, prefix.Subnet())) == 2
+	})
+	stable := tcpip.AddressWithPrefix{
+		Address:   header.LinkLocalAddr(linkAddr),
+		PrefixLen: prefix.PrefixLen,
+	}
+	stableBytes := stable.Address.As16()
+	copy(stableBytes[:8], prefix.Address.AsSlice()[:8])
+	stable.Address = tcpip.AddrFrom16(stableBytes)
+	found := false
+	for _, addr := range addressesIn(s, prefix.Subnet()) {
+		found = found || addr == stable
+	}
+	if !found {
+		t.Errorf("got addresses %v, want stable address %s among them", addressesIn(s, prefix.Subnet()), stable)
+	}
+
+	onLink := tcpip.Route{Destination: prefix.Subnet(), NIC: nicID}
+	defaultRoute := tcpip.Route{Destination: header.IPv6EmptySubnet, Gateway: routerAddr, NIC: nicID}
+	waitFor(t, "routes", func() bool {
+		return hasRoute(s, onLink) && hasRoute(s, defaultRoute)
+	})
+	// The on-link route is more specific, so it must be found first.
+	if table := s.GetRouteTable(); table[0] != onLink {
+		t.Errorf("got route table %v, want %s first", table, onLink)
+	}
+}
+
+func TestNoAutoconf(t *testing.T) {
+	s, ep, _ := newTestStack(t, ModeNone)
+	injectRA(ep, false /* managed */)
+	time.Sleep(100 * time.Millisecond)
+	if got := addressesIn(s, prefix.Subnet()); len(got) != 0 {
+		t.Errorf("got addresses %v, want none", got)
+	}
+	if got := s.GetRouteTable(); len(got) != 0 {
+		t.Errorf("got routes %v, want none", got)
+	}
+}
+
+// readDHCPv6 returns the next DHCPv6 message sent by the client.
+func readDHCPv6(t *testing.T, ep *channel.Endpoint) (tcpip.Address, dhcpv6Message) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for {
+		pkt := ep.ReadContext(ctx)
+		if pkt == nil {
+			t.Fatalf("timed out waiting for a DHCPv6 message")
+		}
+		v := stack.PayloadSince(pkt.NetworkHeader())
+		pkt.DecRef()
+		ip := header.IPv6(v.AsSlice())
+		if ip.TransportProtocol() != header.UDPProtocolNumber || ip.DestinationAddress() != allDHCPv6RelayAgentsAndServers {
+			v.Release()
+			continue
+		}
+		u := header.UDP(ip.Payload())
+		if u.DestinationPort() != dhcpv6ServerPort || u.SourcePort() != dhcpv6ClientPort {
+			t.Errorf("got ports %d -> %d, want %d -> %d", u.SourcePort(), u.DestinationPort(), dhcpv6ClientPort, dhcpv6ServerPort)
+		}
+		m, err := parseDHCPv6Message(u.Payload(), nicID)
+		src := ip.SourceAddress()
+		v.Release()
+		if err != nil {
+			t.Fatalf("parseDHCPv6Message: %v", err)
+		}
+		return src, m
+	}
+}
+
+// injectDHCPv6 injects a DHCPv6 message from the server to the client.
+func injectDHCPv6(ep *channel.Endpoint, dst tcpip.Address, m *dhcpv6Message) {
+	payload := m.marshal()
+	udpSize := header.UDPMinimumSize + len(payload)
+	hdr := prependable.New(header.IPv6MinimumSize + udpSize)
+	u := header.UDP(hdr.Prepend(udpSize))
+	copy(u.Payload(), payload)
+	u.Encode(&header.UDPFields{
+		SrcPort: dhcpv6ServerPort,
+		DstPort: dhcpv6ClientPort,
+		Length:  uint16(udpSize),
+	})
+	xsum := header.PseudoHeaderChecksum(header.UDPProtocolNumber, routerAddr, dst, uint16(udpSize))
+	u.SetChecksum(^u.CalculateChecksum(checksum.Checksum(payload, xsum)))
+	encodeIPv6(&hdr, header.UDPProtocolNumber, 64, routerAddr, dst)
+	inject(ep, hdr)
+}
+
+func TestDHCPv6(t *testing.T) {
+	s, ep, c := newTestStack(t, ModeDHCPv6)
+	injectRA(ep, true /* managed */)
+
+	serverID := []byte("test server")
+	leased := tcpip.AddrFrom16([16]byte{0x20, 0x01, 0x0d, 0xb8, 0, 1, 15: 0x64})
+	ia := &dhcpv6IANA{
+		iaid:  nicID,
+		t1:    1000,
+		t2:    1600,
+		addrs: []dhcpv6IAAddr{{addr: leased, preferred: 1800, valid: 3600}},
+	}
+
+	src, solicit := readDHCPv6(t, ep)
+	if solicit.typ != dhcpv6Solicit {
+		t.Fatalf("got message type %d, want Solicit", solicit.typ)
+	}
+	if want := header.LinkLocalAddr(linkAddr); src != want {
+		t.Errorf("got Solicit from %s, want %s", src, want)
+	}
+	injectDHCPv6(ep, src, &dhcpv6Message{typ: dhcpv6Advertise, xid: solicit.xid, clientID: solicit.clientID, serverID: serverID, ia: ia})
+
+	_, request := readDHCPv6(t, ep)
+	for request.typ == dhcpv6Solicit {
+		// Retransmission raced with the Advertise.
+		_, request = readDHCPv6(t, ep)
+	}
+	if request.typ != dhcpv6Request || string(request.serverID) != string(serverID) {
+		t.Fatalf("got message type %d to server %q, want Request to %q", request.typ, request.serverID, serverID)
+	}
+	injectDHCPv6(ep, src, &dhcpv6Message{typ: dhcpv6Reply, xid: request.xid, clientID: request.clientID, serverID: serverID, ia: ia})
+
+	leasedSubnet := tcpip.AddressWithPrefix{Address: leased, PrefixLen: 128}.Subnet()
+	waitFor(t, "leased address", func() bool {
+		return len(addressesIn(s, leasedSubnet)) == 1
+	})
+
+	// Stopping the client releases the address.
+	c.Stop()
+	if got := addressesIn(s, leasedSubnet); len(got) != 0 {
+		t.Errorf("got addresses %v after Stop, want none", got)
+	}
+	for {
+		_, m := readDHCPv6(t, ep)
+		if m.typ == dhcpv6Release {
+			if m.ia == nil || len(m.ia.addrs) != 1 || m.ia.addrs[0].addr != leased {
+				t.Errorf("got Release for %+v, want %s", m.ia, leased)
+			}
+			break
+		}
+	}
+}
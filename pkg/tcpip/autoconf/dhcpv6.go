@@ -0,0 +1,279 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package autoconf
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// UDP ports of DHCPv6, from RFC 8415 section 7.2.
+const (
+	dhcpv6ClientPort = 546
+	dhcpv6ServerPort = 547
+)
+
+// allDHCPv6RelayAgentsAndServers is the multicast address that DHCPv6 clients
+// send messages to, from RFC 8415 section 7.1.
+var allDHCPv6RelayAgentsAndServers = tcpip.AddrFrom16([16]byte{0xff, 0x02, 13: 0x01, 15: 0x02})
+
+// dhcpv6MessageType is the type of a DHCPv6 message, from RFC 8415 section
+// 7.3.
+type dhcpv6MessageType uint8
+
+const (
+	dhcpv6Solicit   dhcpv6MessageType = 1
+	dhcpv6Advertise dhcpv6MessageType = 2
+	dhcpv6Request   dhcpv6MessageType = 3
+	dhcpv6Renew     dhcpv6MessageType = 5
+	dhcpv6Rebind    dhcpv6MessageType = 6
+	dhcpv6Reply     dhcpv6MessageType = 7
+	dhcpv6Release   dhcpv6MessageType = 8
+)
+
+// DHCPv6 option codes, from RFC 8415 section 21.
+const (
+	dhcpv6OptClientID    = 1
+	dhcpv6OptServerID    = 2
+	dhcpv6OptIANA        = 3
+	dhcpv6OptIAAddr      = 5
+	dhcpv6OptElapsedTime = 8
+	dhcpv6OptStatusCode  = 13
+)
+
+// dhcpv6StatusSuccess is the Success status code, from RFC 8415 section
+// 21.13.
+const dhcpv6StatusSuccess = 0
+
+// dhcpv6InfiniteLifetime is the lifetime that never expires, from RFC 8415
+// section 7.7.
+const dhcpv6InfiniteLifetime = 0xffffffff
+
+// dhcpv6HeaderSize is the size of the message type and transaction ID.
+const dhcpv6HeaderSize = 4
+
+// dhcpv6Message is a DHCPv6 message exchanged between a client and a server,
+// with the subset of options that the client uses.
+type dhcpv6Message struct {
+	typ dhcpv6MessageType
+
+	// xid is the transaction ID. Only its low 24 bits are used.
+	xid uint32
+
+	clientID []byte
+	serverID []byte
+
+	// elapsed is the time since the client started the exchange, in
+	// hundredths of a second.
+	elapsed uint16
+
+	// status is the status code of the message, dhcpv6StatusSuccess if it has
+	// no Status Code option.
+	status uint16
+
+	// ia is the Identity Association for Non-temporary Addresses of the
+	// client, if any.
+	ia *dhcpv6IANA
+}
+
+// dhcpv6IANA is an IA_NA option, from RFC 8415 section 21.4.
+type dhcpv6IANA struct {
+	iaid uint32
+
+	// t1 and t2 are the times after which the client renews and rebinds its
+	// addresses, in seconds.
+	t1 uint32
+	t2 uint32
+
+	addrs []dhcpv6IAAddr
+
+	// status is the status code of the IA_NA, dhcpv6StatusSuccess if it has
+	// no Status Code option.
+	status uint16
+}
+
+// dhcpv6IAAddr is an IA Address option, from RFC 8415 section 21.6.
+type dhcpv6IAAddr struct {
+	addr tcpip.Address
+
+	// preferred and valid are the lifetimes of addr, in seconds.
+	preferred uint32
+	valid     uint32
+}
+
+func appendDHCPv6Option(b []byte, code uint16, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, code)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+// marshal returns the wire representation of m.
+func (m *dhcpv6Message) marshal() []byte {
+	b := make([]byte, 0, 128)
+	b = binary.BigEndian.AppendUint32(b, uint32(m.typ)<<24|m.xid&0xffffff)
+	if m.clientID != nil {
+		b = appendDHCPv6Option(b, dhcpv6OptClientID, m.clientID)
+	}
+	if m.serverID != nil {
+		b = appendDHCPv6Option(b, dhcpv6OptServerID, m.serverID)
+	}
+	if m.typ != dhcpv6Advertise && m.typ != dhcpv6Reply {
+		b = appendDHCPv6Option(b, dhcpv6OptElapsedTime, binary.BigEndian.AppendUint16(nil, m.elapsed))
+	}
+	if m.status != dhcpv6StatusSuccess {
+		b = appendDHCPv6Option(b, dhcpv6OptStatusCode, binary.BigEndian.AppendUint16(nil, m.status))
+	}
+	if m.ia != nil {
+		b = appendDHCPv6Option(b, dhcpv6OptIANA, m.ia.marshal())
+	}
+	return b
+}
+
+func (ia *dhcpv6IANA) marshal() []byte {
+	b := make([]byte, 0, 12+len(ia.addrs)*28)
+	b = binary.BigEndian.AppendUint32(b, ia.iaid)
+	b = binary.BigEndian.AppendUint32(b, ia.t1)
+	b = binary.BigEndian.AppendUint32(b, ia.t2)
+	for _, a := range ia.addrs {
+		data := make([]byte, 0, 24)
+		data = append(data, a.addr.AsSlice()...)
+		data = binary.BigEndian.AppendUint32(data, a.preferred)
+		data = binary.BigEndian.AppendUint32(data, a.valid)
+		b = appendDHCPv6Option(b, dhcpv6OptIAAddr, data)
+	}
+	if ia.status != dhcpv6StatusSuccess {
+		b = appendDHCPv6Option(b, dhcpv6OptStatusCode, binary.BigEndian.AppendUint16(nil, ia.status))
+	}
+	return b
+}
+
+// forEachDHCPv6Option calls f with the code and data of each option in b.
+func forEachDHCPv6Option(b []byte, f func(code uint16, data []byte) error) error {
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return fmt.Errorf("truncated option header")
+		}
+		code := binary.BigEndian.Uint16(b)
+		n := int(binary.BigEndian.Uint16(b[2:]))
+		b = b[4:]
+		if len(b) < n {
+			return fmt.Errorf("option %d: length %d exceeds remaining %d bytes", code, n, len(b))
+		}
+		if err := f(code, b[:n]); err != nil {
+			return fmt.Errorf("option %d: %w", code, err)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// parseDHCPv6Message parses a DHCPv6 message. Of the IA_NA options in the
+// message, only the one with the given IAID is kept. Unknown options are
+// ignored.
+func parseDHCPv6Message(b []byte, iaid uint32) (dhcpv6Message, error) {
+	if len(b) < dhcpv6HeaderSize {
+		return dhcpv6Message{}, fmt.Errorf("message too short: %d bytes", len(b))
+	}
+	hdr := binary.BigEndian.Uint32(b)
+	m := dhcpv6Message{
+		typ: dhcpv6MessageType(hdr >> 24),
+		xid: hdr & 0xffffff,
+	}
+	err := forEachDHCPv6Option(b[dhcpv6HeaderSize:], func(code uint16, data []byte) error {
+		switch code {
+		case dhcpv6OptClientID:
+			m.clientID = append([]byte(nil), data...)
+		case dhcpv6OptServerID:
+			m.serverID = append([]byte(nil), data...)
+		case dhcpv6OptElapsedTime:
+			if len(data) != 2 {
+				return fmt.Errorf("invalid length %d", len(data))
+			}
+			m.elapsed = binary.BigEndian.Uint16(data)
+		case dhcpv6OptStatusCode:
+			if len(data) < 2 {
+				return fmt.Errorf("invalid length %d", len(data))
+			}
+			m.status = binary.BigEndian.Uint16(data)
+		case dhcpv6OptIANA:
+			ia, err := parseDHCPv6IANA(data)
+			if err != nil {
+				return err
+			}
+			if ia.iaid == iaid {
+				m.ia = &ia
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return dhcpv6Message{}, err
+	}
+	return m, nil
+}
+
+func parseDHCPv6IANA(b []byte) (dhcpv6IANA, error) {
+	if len(b) < 12 {
+		return dhcpv6IANA{}, fmt.Errorf("invalid length %d", len(b))
+	}
+	ia := dhcpv6IANA{
+		iaid: binary.BigEndian.Uint32(b),
+		t1:   binary.BigEndian.Uint32(b[4:]),
+		t2:   binary.BigEndian.Uint32(b[8:]),
+	}
+	err := forEachDHCPv6Option(b[12:], func(code uint16, data []byte) error {
+		switch code {
+		case dhcpv6OptIAAddr:
+			if len(data) < 24 {
+				return fmt.Errorf("invalid length %d", len(data))
+			}
+			a := dhcpv6IAAddr{
+				addr:      tcpip.AddrFrom16Slice(data[:16]),
+				preferred: binary.BigEndian.Uint32(data[16:]),
+				valid:     binary.BigEndian.Uint32(data[20:]),
+			}
+			// As per RFC 8415 section 21.6, addresses whose preferred lifetime
+			// is greater than their valid lifetime are discarded.
+			if a.preferred <= a.valid {
+				ia.addrs = append(ia.addrs, a)
+			}
+		case dhcpv6OptStatusCode:
+			if len(data) < 2 {
+				return fmt.Errorf("invalid length %d", len(data))
+			}
+			ia.status = binary.BigEndian.Uint16(data)
+		}
+		return nil
+	})
+	if err != nil {
+		return dhcpv6IANA{}, err
+	}
+	return ia, nil
+}
+
+// dhcpv6DUID returns a DUID-LL for linkAddr, from RFC 8415 section 11.4.
+func dhcpv6DUID(linkAddr tcpip.LinkAddress) []byte {
+	const (
+		duidLL       = 3
+		hwTypeEther  = 1
+		duidLLHdrLen = 4
+	)
+	b := make([]byte, 0, duidLLHdrLen+len(linkAddr))
+	b = binary.BigEndian.AppendUint16(b, duidLL)
+	b = binary.BigEndian.AppendUint16(b, hwTypeEther)
+	return append(b, linkAddr...)
+}
@@ -0,0 +1,394 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package autoconf
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// Retransmission parameters, from RFC 8415 section 7.6.
+const (
+	solTimeout = time.Second
+	solMaxRT   = 3600 * time.Second
+	reqTimeout = time.Second
+	reqMaxRT   = 30 * time.Second
+	reqMaxRC   = 10
+	renTimeout = 10 * time.Second
+	renMaxRT   = 600 * time.Second
+	rebTimeout = 10 * time.Second
+	rebMaxRT   = 600 * time.Second
+)
+
+// dhcpv6Client leases addresses for a NIC with DHCPv6. It implements the
+// client side of RFC 8415 for a single IA_NA, without Rapid Commit,
+// reconfiguration or relay agents: it solicits a server, requests addresses
+// from it, adds them to the NIC, and renews or rebinds them before they
+// expire.
+type dhcpv6Client struct {
+	stack *stack.Stack
+	nicID tcpip.NICID
+	duid  []byte
+	iaid  uint32
+	conn  *gonet.UDPConn
+
+	// cancel is closed by stop.
+	cancel chan struct{}
+
+	// done is closed when the client's goroutine exits.
+	done chan struct{}
+
+	// The fields below are only accessed by the client's goroutine.
+
+	// serverID is the DUID of the server that the addresses are leased from.
+	serverID []byte
+
+	// leased holds the leased addresses that were added to the NIC.
+	leased map[tcpip.Address]struct{}
+}
+
+// startDHCPv6Client starts leasing addresses for NIC nicID.
+func startDHCPv6Client(s *stack.Stack, nicID tcpip.NICID) (*dhcpv6Client, error) {
+	info, ok := s.NICInfo()[nicID]
+	if !ok {
+		return nil, fmt.Errorf("unknown NIC %d", nicID)
+	}
+	var linkLocal tcpip.Address
+	for _, addr := range info.ProtocolAddresses {
+		if addr.Protocol == ipv6.ProtocolNumber && header.IsV6LinkLocalUnicastAddress(addr.AddressWithPrefix.Address) {
+			linkLocal = addr.AddressWithPrefix.Address
+			break
+		}
+	}
+	if linkLocal.BitLen() == 0 {
+		return nil, fmt.Errorf("NIC %d has no link-local address", nicID)
+	}
+	conn, err := gonet.DialUDP(s, &tcpip.FullAddress{NIC: nicID, Addr: linkLocal, Port: dhcpv6ClientPort}, nil, ipv6.ProtocolNumber)
+	if err != nil {
+		return nil, err
+	}
+	d := &dhcpv6Client{
+		stack:  s,
+		nicID:  nicID,
+		duid:   dhcpv6DUID(info.LinkAddress),
+		iaid:   uint32(nicID),
+		conn:   conn,
+		cancel: make(chan struct{}),
+		done:   make(chan struct{}),
+		leased: make(map[tcpip.Address]struct{}),
+	}
+	log.Infof("Starting DHCPv6 client on NIC %d", nicID)
+	go d.run()
+	return d, nil
+}
+
+// stop stops d, releases its addresses and removes them from the NIC.
+func (d *dhcpv6Client) stop() {
+	close(d.cancel)
+	// Unblock reads.
+	d.conn.Close()
+	<-d.done
+}
+
+func (d *dhcpv6Client) cancelled() bool {
+	select {
+	case <-d.cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep waits for dur, and returns false if d is stopped in the meantime.
+func (d *dhcpv6Client) sleep(dur time.Duration) bool {
+	t := time.NewTimer(dur)
+	defer t.Stop()
+	select {
+	case <-d.cancel:
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func (d *dhcpv6Client) run() {
+	defer close(d.done)
+	defer d.release()
+	for !d.cancelled() {
+		// Solicit a server, then request addresses from it. If the request
+		// fails, start over with another solicitation.
+		adv, ok := d.exchange(d.message(dhcpv6Solicit, nil), solTimeout, solMaxRT, 0, time.Time{})
+		if !ok {
+			continue
+		}
+		reply, ok := d.exchange(d.message(dhcpv6Request, adv.serverID), reqTimeout, reqMaxRT, reqMaxRC, time.Time{})
+		if !ok {
+			continue
+		}
+		d.serverID = reply.serverID
+		expiry := d.bind(reply.ia)
+		d.maintain(reply.ia, expiry)
+		if d.cancelled() {
+			// The addresses are released by the deferred release.
+			return
+		}
+		d.unbind()
+	}
+}
+
+// maintain renews and rebinds the leased addresses until they expire, or d
+// is stopped.
+func (d *dhcpv6Client) maintain(ia *dhcpv6IANA, expiry time.Time) {
+	for {
+		start := time.Now()
+		t1, t2 := d.renewalTimes(ia)
+		if t1 < 0 {
+			// The addresses never expire.
+			<-d.cancel
+			return
+		}
+		if !d.sleep(t1) {
+			return
+		}
+		// Renew with the server that leased the addresses, then with any
+		// server.
+		reply, ok := d.exchange(d.message(dhcpv6Renew, d.serverID), renTimeout, renMaxRT, 0, start.Add(t2))
+		if !ok {
+			reply, ok = d.exchange(d.message(dhcpv6Rebind, nil), rebTimeout, rebMaxRT, 0, expiry)
+		}
+		if !ok {
+			return
+		}
+		d.serverID = reply.serverID
+		ia = reply.ia
+		expiry = d.bind(ia)
+	}
+}
+
+// renewalTimes returns the times after which the addresses in ia are renewed
+// and rebound. t1 is negative if they never need renewal.
+func (d *dhcpv6Client) renewalTimes(ia *dhcpv6IANA) (t1, t2 time.Duration) {
+	if ia.t1 == dhcpv6InfiniteLifetime {
+		return -1, -1
+	}
+	// As per RFC 8415 section 21.4, the client picks T1 and T2 when the server
+	// leaves them to it, based on the shortest preferred lifetime.
+	var preferred uint32 = dhcpv6InfiniteLifetime
+	for _, a := range ia.addrs {
+		preferred = min(preferred, a.preferred)
+	}
+	t1s, t2s := ia.t1, ia.t2
+	if t1s == 0 {
+		if preferred == dhcpv6InfiniteLifetime {
+			return -1, -1
+		}
+		t1s = preferred / 2
+	}
+	if t2s == 0 || t2s < t1s {
+		t2s = t1s + t1s/2
+	}
+	return time.Duration(t1s) * time.Second, time.Duration(t2s) * time.Second
+}
+
+// message returns a new client message of the given type, for the addresses
+// currently leased, if any.
+func (d *dhcpv6Client) message(typ dhcpv6MessageType, serverID []byte) *dhcpv6Message {
+	ia := &dhcpv6IANA{iaid: d.iaid}
+	if typ != dhcpv6Solicit {
+		for addr := range d.leased {
+			ia.addrs = append(ia.addrs, dhcpv6IAAddr{addr: addr})
+		}
+	}
+	return &dhcpv6Message{
+		typ:      typ,
+		xid:      d.stack.InsecureRNG().Uint32() & 0xffffff,
+		clientID: d.duid,
+		serverID: serverID,
+		ia:       ia,
+	}
+}
+
+// exchange sends m until it gets a valid response, as per RFC 8415 section
+// 15. Retransmissions start after irt and back off to mrt; exchange gives up
+// after mrc transmissions or at deadline, unless they are zero. It returns
+// false if it gives up, or d is stopped.
+func (d *dhcpv6Client) exchange(m *dhcpv6Message, irt, mrt time.Duration, mrc int, deadline time.Time) (dhcpv6Message, bool) {
+	want := dhcpv6Reply
+	if m.typ == dhcpv6Solicit {
+		want = dhcpv6Advertise
+	}
+	dst := &net.UDPAddr{IP: net.IP(allDHCPv6RelayAgentsAndServers.AsSlice()), Port: dhcpv6ServerPort}
+	start := time.Now()
+	rt := jitter(d, irt)
+	buf := make([]byte, header.IPv6MinimumMTU)
+	for sent := 0; mrc == 0 || sent < mrc; sent++ {
+		m.elapsed = uint16(min(time.Since(start)/(10*time.Millisecond), 0xffff))
+		if _, err := d.conn.WriteTo(m.marshal(), dst); err != nil {
+			if d.cancelled() {
+				return dhcpv6Message{}, false
+			}
+			log.Debugf("DHCPv6 client on NIC %d: sending message %d: %v", d.nicID, m.typ, err)
+		}
+
+		end := time.Now().Add(rt)
+		if !deadline.IsZero() && deadline.Before(end) {
+			end = deadline
+		}
+		d.conn.SetReadDeadline(end)
+		for {
+			n, _, err := d.conn.ReadFrom(buf)
+			if d.cancelled() {
+				return dhcpv6Message{}, false
+			}
+			if err != nil {
+				// Timed out: retransmit.
+				break
+			}
+			resp, err := parseDHCPv6Message(buf[:n], d.iaid)
+			if err != nil {
+				log.Debugf("DHCPv6 client on NIC %d: ignoring invalid message: %v", d.nicID, err)
+				continue
+			}
+			if resp.typ != want || resp.xid != m.xid || string(resp.clientID) != string(d.duid) || resp.serverID == nil {
+				continue
+			}
+			if resp.status != dhcpv6StatusSuccess || resp.ia == nil || resp.ia.status != dhcpv6StatusSuccess || len(resp.ia.addrs) == 0 {
+				log.Debugf("DHCPv6 client on NIC %d: server offered no addresses (status %d)", d.nicID, resp.status)
+				continue
+			}
+			return resp, true
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return dhcpv6Message{}, false
+		}
+		rt = jitter(d, 2*rt)
+		if rt > mrt {
+			rt = jitter(d, mrt)
+		}
+	}
+	return dhcpv6Message{}, false
+}
+
+// jitter randomizes rt by +/-10%, as per RFC 8415 section 15.
+func jitter(d *dhcpv6Client, rt time.Duration) time.Duration {
+	r := d.stack.InsecureRNG().Int63n(int64(rt)/5+1) - int64(rt)/10
+	return rt + time.Duration(r)
+}
+
+// bind adds the addresses in ia to the NIC, updates the lifetimes of those
+// already added, and removes the others. It returns the time at which all
+// addresses expire, or the zero time if some never do.
+func (d *dhcpv6Client) bind(ia *dhcpv6IANA) time.Time {
+	now := time.Now()
+	monoNow := d.stack.Clock().NowMonotonic()
+	var expiry time.Time
+	never := false
+	keep := make(map[tcpip.Address]struct{})
+	for _, a := range ia.addrs {
+		if a.valid == 0 {
+			continue
+		}
+		keep[a.addr] = struct{}{}
+		lifetimes := stack.AddressLifetimes{
+			PreferredUntil: monoNow.Add(time.Duration(a.preferred) * time.Second),
+			ValidUntil:     monoNow.Add(time.Duration(a.valid) * time.Second),
+			Deprecated:     a.preferred == 0,
+		}
+		if a.valid == dhcpv6InfiniteLifetime {
+			lifetimes.PreferredUntil = tcpip.MonotonicTimeInfinite()
+			lifetimes.ValidUntil = tcpip.MonotonicTimeInfinite()
+			never = true
+		} else if exp := now.Add(time.Duration(a.valid) * time.Second); exp.After(expiry) {
+			expiry = exp
+		}
+
+		if _, ok := d.leased[a.addr]; ok {
+			if err := d.stack.SetAddressLifetimes(d.nicID, a.addr, lifetimes); err != nil {
+				log.Warningf("DHCPv6 client on NIC %d: SetAddressLifetimes(%s): %s", d.nicID, a.addr, err)
+			}
+			continue
+		}
+		protocolAddr := tcpip.ProtocolAddress{
+			Protocol: ipv6.ProtocolNumber,
+			AddressWithPrefix: tcpip.AddressWithPrefix{
+				Address: a.addr,
+				// The prefix of the link is learned from Router
+				// Advertisements, not DHCPv6.
+				PrefixLen: header.IPv6AddressSizeBits,
+			},
+		}
+		if err := d.stack.AddProtocolAddress(d.nicID, protocolAddr, stack.AddressProperties{Lifetimes: lifetimes}); err != nil {
+			log.Warningf("DHCPv6 client on NIC %d: AddProtocolAddress(%s): %s", d.nicID, protocolAddr, err)
+			continue
+		}
+		log.Infof("DHCPv6 client on NIC %d: leased address %s", d.nicID, a.addr)
+		d.leased[a.addr] = struct{}{}
+	}
+	for addr := range d.leased {
+		if _, ok := keep[addr]; !ok {
+			d.removeAddress(addr)
+		}
+	}
+	if never {
+		return time.Time{}
+	}
+	return expiry
+}
+
+// unbind removes all leased addresses from the NIC.
+func (d *dhcpv6Client) unbind() {
+	for addr := range d.leased {
+		d.removeAddress(addr)
+	}
+	d.serverID = nil
+}
+
+func (d *dhcpv6Client) removeAddress(addr tcpip.Address) {
+	log.Infof("DHCPv6 client on NIC %d: removing address %s", d.nicID, addr)
+	if err := d.stack.RemoveAddress(d.nicID, addr); err != nil {
+		log.Warningf("DHCPv6 client on NIC %d: RemoveAddress(%s): %s", d.nicID, addr, err)
+	}
+	delete(d.leased, addr)
+}
+
+// release tells the server that the leased addresses are no longer used, as
+// per RFC 8415 section 18.2.7, and removes them from the NIC. The Release
+// message is sent once, on a new socket since d.conn is closed by stop.
+func (d *dhcpv6Client) release() {
+	if len(d.leased) == 0 || d.serverID == nil {
+		d.unbind()
+		return
+	}
+	m := d.message(dhcpv6Release, d.serverID)
+	d.unbind()
+	conn, err := gonet.DialUDP(d.stack, &tcpip.FullAddress{NIC: d.nicID, Port: dhcpv6ClientPort}, nil, ipv6.ProtocolNumber)
+	if err != nil {
+		log.Debugf("DHCPv6 client on NIC %d: sending Release: %v", d.nicID, err)
+		return
+	}
+	defer conn.Close()
+	dst := &net.UDPAddr{IP: net.IP(allDHCPv6RelayAgentsAndServers.AsSlice()), Port: dhcpv6ServerPort}
+	if _, err := conn.WriteTo(m.marshal(), dst); err != nil {
+		log.Debugf("DHCPv6 client on NIC %d: sending Release: %v", d.nicID, err)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package autoconf
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+func TestDHCPv6MessageRoundTrip(t *testing.T) {
+	addr := tcpip.AddrFrom16([16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1})
+	for _, m := range []dhcpv6Message{
+		{
+			typ:      dhcpv6Solicit,
+			xid:      0x123456,
+			clientID: dhcpv6DUID("\x02\x02\x03\x04\x05\x06"),
+			elapsed:  100,
+			ia:       &dhcpv6IANA{iaid: 1},
+		},
+		{
+			typ:      dhcpv6Reply,
+			xid:      0xabcdef,
+			clientID: []byte("client"),
+			serverID: []byte("server"),
+			ia: &dhcpv6IANA{
+				iaid:  1,
+				t1:    100,
+				t2:    200,
+				addrs: []dhcpv6IAAddr{{addr: addr, preferred: 300, valid: dhcpv6InfiniteLifetime}},
+			},
+		},
+		{
+			typ:      dhcpv6Reply,
+			xid:      1,
+			serverID: []byte("server"),
+			status:   2,
+		},
+	} {
+		got, err := parseDHCPv6Message(m.marshal(), 1)
+		if err != nil {
+			t.Errorf("parseDHCPv6Message(%+v): %v", m, err)
+			continue
+		}
+		if diff := cmp.Diff(m, got, cmp.AllowUnexported(dhcpv6Message{}, dhcpv6IANA{}, dhcpv6IAAddr{}, tcpip.Address{})); diff != "" {
+			t.Errorf("parseDHCPv6Message(marshal()) mismatch (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestParseDHCPv6Message(t *testing.T) {
+	addr := tcpip.AddrFrom16([16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1})
+	m := dhcpv6Message{
+		typ: dhcpv6Advertise,
+		ia: &dhcpv6IANA{
+			iaid: 2,
+			addrs: []dhcpv6IAAddr{
+				{addr: addr, preferred: 10, valid: 20},
+				// Discarded, since its preferred lifetime exceeds its valid
+				// lifetime.
+				{addr: addr, preferred: 30, valid: 20},
+			},
+		},
+	}
+	b := m.marshal()
+	if got, err := parseDHCPv6Message(b, 1); err != nil || got.ia != nil {
+		t.Errorf("parseDHCPv6Message(iaid=1) = %+v, %v, want no IA_NA", got, err)
+	}
+	got, err := parseDHCPv6Message(b, 2)
+	if err != nil {
+		t.Fatalf("parseDHCPv6Message(iaid=2): %v", err)
+	}
+	if got.ia == nil || len(got.ia.addrs) != 1 || got.ia.addrs[0].preferred != 10 {
+		t.Errorf("parseDHCPv6Message(iaid=2) = %+v, want IA_NA with a single address", got.ia)
+	}
+
+	for _, b := range [][]byte{
+		{1, 2, 3},
+		{1, 0, 0, 0, 0, 1},
+		{1, 0, 0, 0, 0, 1, 0, 10, 'x'},
+		{1, 0, 0, 0, 0, 8, 0, 1, 0},
+	} {
+		if _, err := parseDHCPv6Message(b, 1); err == nil {
+			t.Errorf("parseDHCPv6Message(%v) succeeded, want error", b)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+const (
+	espSPI    = 0
+	espSeqNum = 4
+)
+
+const (
+	// ESPProtocolNumber is ESP's transport protocol number.
+	ESPProtocolNumber tcpip.TransportProtocolNumber = 50
+
+	// ESPMinimumSize is the size of the ESP header, excluding the IV.
+	ESPMinimumSize = 8
+
+	// ESPTrailerSize is the size of the ESP trailer fields following the
+	// padding, i.e. the pad length and next header fields.
+	ESPTrailerSize = 2
+)
+
+// ESPFields contains the fields of an ESP header. It is used to describe the
+// fields of a packet that needs to be encoded.
+type ESPFields struct {
+	// SPI is the "security parameters index" field of the ESP header.
+	SPI uint32
+
+	// SequenceNumber is the "sequence number" field of the ESP header.
+	SequenceNumber uint32
+}
+
+// ESP represents an Encapsulating Security Payload header stored in a byte
+// array, as described in RFC 4303 section 2.
+type ESP []byte
+
+// SPI returns the security parameters index of the ESP header.
+func (b ESP) SPI() uint32 {
+	return binary.BigEndian.Uint32(b[espSPI:])
+}
+
+// SequenceNumber returns the sequence number of the ESP header.
+func (b ESP) SequenceNumber() uint32 {
+	return binary.BigEndian.Uint32(b[espSeqNum:])
+}
+
+// Encode encodes all the fields of the ESP header.
+func (b ESP) Encode(i *ESPFields) {
+	binary.BigEndian.PutUint32(b[espSPI:], i.SPI)
+	binary.BigEndian.PutUint32(b[espSeqNum:], i.SequenceNumber)
+}
@@ -406,6 +406,11 @@ func (b IPv4) SetTTL(v byte) {
 	b[ttl] = v
 }
 
+// SetProtocol sets the "protocol" field of the IPv4 header.
+func (b IPv4) SetProtocol(v uint8) {
+	b[protocol] = v
+}
+
 // SetTotalLength sets the "total length" field of the IPv4 header.
 func (b IPv4) SetTotalLength(totalLength uint16) {
 	binary.BigEndian.PutUint16(b[IPv4TotalLenOffset:], totalLength)
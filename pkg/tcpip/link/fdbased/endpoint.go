@@ -105,6 +105,23 @@ func (p PacketDispatchMode) String() string {
 
 var _ stack.LinkEndpoint = (*endpoint)(nil)
 var _ stack.GSOEndpoint = (*endpoint)(nil)
+var _ Reconfigurable = (*endpoint)(nil)
+
+// Reconfigurable is implemented by the endpoints returned by New. Its methods
+// change the configuration of an endpoint while it is in use.
+type Reconfigurable interface {
+	stack.LinkEndpoint
+
+	// SetFDs replaces the FDs used by the endpoint.
+	SetFDs(fds []int) error
+
+	// SetMTU sets the endpoint's MTU.
+	SetMTU(mtu uint32)
+
+	// SetChecksumOffload sets whether the endpoint offloads TX and RX
+	// checksums.
+	SetChecksumOffload(tx, rx bool)
+}
 
 type fdInfo struct {
 	fd       int
@@ -115,10 +132,13 @@ type endpoint struct {
 	// fds is the set of file descriptors each identifying one inbound/outbound
 	// channel. The endpoint will dispatch from all inbound channels as well as
 	// hash outbound packets to specific channels based on the packet hash.
+	//
+	// fds is immutable, except for SetFDs, which replaces it with mu locked for
+	// writing.
 	fds []fdInfo
 
 	// mtu (maximum transmission unit) is the maximum size of a packet.
-	mtu uint32
+	mtu atomicbitops.Uint32
 
 	// hdrSize specifies the link-layer header size. If set to 0, no header
 	// is added/removed; otherwise an ethernet header is used.
@@ -127,15 +147,25 @@ type endpoint struct {
 	// addr is the address of the endpoint.
 	addr tcpip.LinkAddress
 
-	// caps holds the endpoint capabilities.
-	caps stack.LinkEndpointCapabilities
+	// caps holds the endpoint capabilities. It is a
+	// stack.LinkEndpointCapabilities.
+	caps atomicbitops.Uint64
 
 	// closed is a function to be called when the FD's peer (if any) closes
 	// its end of the communication pipe.
 	closed func(tcpip.Error)
 
+	// inboundDispatchers is immutable, except for SetFDs, which replaces it
+	// with mu locked for writing.
 	inboundDispatchers []linkDispatcher
 
+	// replaceMu serializes SetFDs and Attach. It is ordered before mu.
+	replaceMu sync.Mutex
+
+	// replacingFDs is true while SetFDs stops the inbound dispatchers of the
+	// FDs it replaces, so that closed isn't called for them.
+	replacingFDs atomicbitops.Bool
+
 	mu sync.RWMutex
 	// +checklocks:mu
 	dispatcher stack.NetworkDispatcher
@@ -280,8 +310,8 @@ func New(opts *Options) (stack.LinkEndpoint, error) {
 	}
 
 	e := &endpoint{
-		mtu:                   opts.MTU,
-		caps:                  caps,
+		mtu:                   atomicbitops.FromUint32(opts.MTU),
+		caps:                  atomicbitops.FromUint64(uint64(caps)),
 		closed:                opts.ClosedFunc,
 		addr:                  opts.Address,
 		hdrSize:               hdrSize,
@@ -295,40 +325,56 @@ func New(opts *Options) (stack.LinkEndpoint, error) {
 		}
 	}
 
+	fds, dispatchers, err := e.createChannels(opts.FDs)
+	if err != nil {
+		return nil, err
+	}
+	e.fds = fds
+	e.inboundDispatchers = dispatchers
+	if fds[0].isSocket && opts.GSOMaxSize != 0 {
+		if opts.GvisorGSOEnabled {
+			e.gsoKind = stack.GvisorGSOSupported
+		} else {
+			e.gsoKind = stack.HostGSOSupported
+		}
+		e.gsoMaxSize = opts.GSOMaxSize
+	}
+
+	return e, nil
+}
+
+// createChannels creates the inbound dispatchers of the given FDs.
+func (e *endpoint) createChannels(rawFDs []int) ([]fdInfo, []linkDispatcher, error) {
 	// Increment fanoutID to ensure that we don't re-use the same fanoutID
-	// for the next endpoint.
+	// for the next set of FDs.
 	fid := fanoutID.Add(1)
 
 	// Create per channel dispatchers.
-	for _, fd := range opts.FDs {
+	var (
+		fds         []fdInfo
+		dispatchers []linkDispatcher
+	)
+	for _, fd := range rawFDs {
 		if err := unix.SetNonblock(fd, true); err != nil {
-			return nil, fmt.Errorf("unix.SetNonblock(%v) failed: %v", fd, err)
+			return nil, nil, fmt.Errorf("unix.SetNonblock(%v) failed: %v", fd, err)
 		}
 
 		isSocket, err := isSocketFD(fd)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		e.fds = append(e.fds, fdInfo{fd: fd, isSocket: isSocket})
-		if isSocket {
-			if opts.GSOMaxSize != 0 {
-				if opts.GvisorGSOEnabled {
-					e.gsoKind = stack.GvisorGSOSupported
-				} else {
-					e.gsoKind = stack.HostGSOSupported
-				}
-				e.gsoMaxSize = opts.GSOMaxSize
-			}
+		if len(fds) > 0 && fds[0].isSocket != isSocket {
+			return nil, nil, fmt.Errorf("FDs must either all be sockets or none")
 		}
+		fds = append(fds, fdInfo{fd: fd, isSocket: isSocket})
 
 		inboundDispatcher, err := createInboundDispatcher(e, fd, isSocket, fid)
 		if err != nil {
-			return nil, fmt.Errorf("createInboundDispatcher(...) = %v", err)
+			return nil, nil, fmt.Errorf("createInboundDispatcher(...) = %v", err)
 		}
-		e.inboundDispatchers = append(e.inboundDispatchers, inboundDispatcher)
+		dispatchers = append(dispatchers, inboundDispatcher)
 	}
-
-	return e, nil
+	return fds, dispatchers, nil
 }
 
 func createInboundDispatcher(e *endpoint, fd int, isSocket bool, fID int32) (linkDispatcher, error) {
@@ -408,6 +454,8 @@ func isSocketFD(fd int) (bool, error) {
 //
 // Attach implements stack.LinkEndpoint.Attach.
 func (e *endpoint) Attach(dispatcher stack.NetworkDispatcher) {
+	e.replaceMu.Lock()
+	defer e.replaceMu.Unlock()
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	// nil means the NIC is being removed.
@@ -421,15 +469,100 @@ func (e *endpoint) Attach(dispatcher stack.NetworkDispatcher) {
 	}
 	if dispatcher != nil && e.dispatcher == nil {
 		e.dispatcher = dispatcher
-		// Link endpoints are not savable. When transportation endpoints are
-		// saved, they stop sending outgoing packets and all incoming packets
-		// are rejected.
-		for i := range e.inboundDispatchers {
-			e.wg.Add(1)
-			go func(i int) { // S/R-SAFE: See above.
-				e.dispatchLoop(e.inboundDispatchers[i])
-				e.wg.Done()
-			}(i)
+		e.startDispatchLoopsLocked()
+	}
+}
+
+// +checklocks:e.mu
+func (e *endpoint) startDispatchLoopsLocked() {
+	// Link endpoints are not savable. When transportation endpoints are
+	// saved, they stop sending outgoing packets and all incoming packets
+	// are rejected.
+	for i := range e.inboundDispatchers {
+		e.wg.Add(1)
+		go func(d linkDispatcher) { // S/R-SAFE: See above.
+			e.dispatchLoop(d)
+			e.wg.Done()
+		}(e.inboundDispatchers[i])
+	}
+}
+
+// SetFDs replaces the FDs used by the endpoint, e.g. to change its number of
+// channels. The new FDs must be of the same kind as the FDs the endpoint was
+// created with, e.g. AF_PACKET sockets bound to the same device. As with New,
+// the endpoint does not take ownership of the FDs; the FDs it used before are
+// no longer used when SetFDs returns successfully, and may be closed.
+func (e *endpoint) SetFDs(rawFDs []int) error {
+	if len(rawFDs) == 0 {
+		return fmt.Errorf("at least one FD must be specified")
+	}
+	e.replaceMu.Lock()
+	defer e.replaceMu.Unlock()
+
+	e.mu.RLock()
+	wasSocket := e.fds[0].isSocket
+	e.mu.RUnlock()
+	fds, dispatchers, err := e.createChannels(rawFDs)
+	if err != nil {
+		return err
+	}
+	if fds[0].isSocket != wasSocket {
+		for _, d := range dispatchers {
+			d.release()
+		}
+		return fmt.Errorf("new FDs must be of the same kind as the replaced FDs")
+	}
+
+	// Stop dispatching from the old FDs. Dispatchers take mu to deliver
+	// packets, so mu can't be held while waiting for them.
+	e.replacingFDs.Store(true)
+	e.mu.RLock()
+	old := e.inboundDispatchers
+	attached := e.dispatcher != nil
+	e.mu.RUnlock()
+	for _, d := range old {
+		d.Stop()
+	}
+	e.Wait()
+	e.replacingFDs.Store(false)
+	if !attached {
+		// Dispatch loops release their dispatcher when they stop.
+		for _, d := range old {
+			d.release()
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.fds = fds
+	e.inboundDispatchers = dispatchers
+	if e.dispatcher != nil {
+		e.startDispatchLoopsLocked()
+	}
+	return nil
+}
+
+// SetMTU sets the endpoint's MTU. Packets that are already queued may still
+// be written with the previous MTU.
+func (e *endpoint) SetMTU(mtu uint32) {
+	e.mtu.Store(mtu)
+}
+
+// SetChecksumOffload sets whether the endpoint has the
+// stack.CapabilityTXChecksumOffload and stack.CapabilityRXChecksumOffload
+// capabilities.
+func (e *endpoint) SetChecksumOffload(tx, rx bool) {
+	for {
+		old := e.caps.Load()
+		caps := stack.LinkEndpointCapabilities(old) &^ (stack.CapabilityTXChecksumOffload | stack.CapabilityRXChecksumOffload)
+		if tx {
+			caps |= stack.CapabilityTXChecksumOffload
+		}
+		if rx {
+			caps |= stack.CapabilityRXChecksumOffload
+		}
+		if e.caps.CompareAndSwap(old, uint64(caps)) {
+			return
 		}
 	}
 }
@@ -444,12 +577,12 @@ func (e *endpoint) IsAttached() bool {
 // MTU implements stack.LinkEndpoint.MTU. It returns the value initialized
 // during construction.
 func (e *endpoint) MTU() uint32 {
-	return e.mtu
+	return e.mtu.Load()
 }
 
 // Capabilities implements stack.LinkEndpoint.Capabilities.
 func (e *endpoint) Capabilities() stack.LinkEndpointCapabilities {
-	return e.caps
+	return stack.LinkEndpointCapabilities(e.caps.Load())
 }
 
 // MaxHeaderLength returns the maximum size of the link-layer header.
@@ -544,6 +677,8 @@ func (e *endpoint) ParseHeader(pkt stack.PacketBufferPtr) bool {
 
 // writePacket writes outbound packets to the file descriptor. If it is not
 // currently writable, the packet is dropped.
+//
+// +checklocksread:e.mu
 func (e *endpoint) writePacket(pkt stack.PacketBufferPtr) tcpip.Error {
 	fdInfo := e.fds[pkt.Hash%uint32(len(e.fds))]
 	fd := fdInfo.fd
@@ -594,6 +729,7 @@ func (e *endpoint) writePacket(pkt stack.PacketBufferPtr) tcpip.Error {
 	return rawfile.NonBlockingWriteIovec(fd, iovecs)
 }
 
+// +checklocksread:e.mu
 func (e *endpoint) sendBatch(batchFDInfo fdInfo, pkts []stack.PacketBufferPtr) (int, tcpip.Error) {
 	// Degrade to writePacket if underlying fd is not a socket.
 	if !batchFDInfo.isSocket {
@@ -710,6 +846,9 @@ func (e *endpoint) sendBatch(batchFDInfo fdInfo, pkts []stack.PacketBufferPtr) (
 //   - pkt.GSOOptions
 //   - pkt.NetworkProtocolNumber
 func (e *endpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
 	// Preallocate to avoid repeated reallocation as we append to batch.
 	batch := make([]stack.PacketBufferPtr, 0, BatchSize)
 	batchFDInfo := fdInfo{fd: -1, isSocket: false}
@@ -745,6 +884,8 @@ func (e *endpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error)
 
 // InjectOutbound implements stack.InjectableEndpoint.InjectOutbound.
 func (e *endpoint) InjectOutbound(dest tcpip.Address, packet *buffer.View) tcpip.Error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 	return rawfile.NonBlockingWrite(e.fds[0].fd, packet.AsSlice())
 }
 
@@ -754,7 +895,7 @@ func (e *endpoint) dispatchLoop(inboundDispatcher linkDispatcher) tcpip.Error {
 	for {
 		cont, err := inboundDispatcher.dispatch()
 		if err != nil || !cont {
-			if e.closed != nil {
+			if e.closed != nil && !e.replacingFDs.Load() {
 				e.closed(err)
 			}
 			inboundDispatcher.release()
@@ -820,8 +961,8 @@ func NewInjectable(fd int, mtu uint32, capabilities stack.LinkEndpointCapabiliti
 
 	return &InjectableEndpoint{endpoint: endpoint{
 		fds:           []fdInfo{{fd: fd, isSocket: isSocket}},
-		mtu:           mtu,
-		caps:          capabilities,
+		mtu:           atomicbitops.FromUint32(mtu),
+		caps:          atomicbitops.FromUint64(uint64(capabilities)),
 		writevMaxIovs: rawfile.MaxIovs,
 	}}, nil
 }
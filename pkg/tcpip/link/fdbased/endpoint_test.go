@@ -424,6 +424,99 @@ func TestDeliverPacket(t *testing.T) {
 	}
 }
 
+func TestSetMTUAndChecksumOffload(t *testing.T) {
+	c := newContext(t, &Options{MTU: mtu, TXChecksumOffload: true})
+	defer c.cleanup()
+	ep := c.ep.(*endpoint)
+
+	ep.SetMTU(9000)
+	if got, want := c.ep.MTU(), uint32(9000); got != want {
+		t.Errorf("MTU() = %d, want %d", got, want)
+	}
+
+	ep.SetChecksumOffload(false /* tx */, true /* rx */)
+	caps := c.ep.Capabilities()
+	if caps&stack.CapabilityTXChecksumOffload != 0 {
+		t.Errorf("Capabilities() = %#x, want no TX checksum offload", caps)
+	}
+	if caps&stack.CapabilityRXChecksumOffload == 0 {
+		t.Errorf("Capabilities() = %#x, want RX checksum offload", caps)
+	}
+}
+
+func TestSetFDs(t *testing.T) {
+	c := newContext(t, &Options{MTU: mtu})
+	defer c.cleanup()
+	ep := c.ep.(*endpoint)
+
+	var readFDs, writeFDs []int
+	for i := 0; i < 3; i++ {
+		fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET, 0)
+		if err != nil {
+			t.Fatalf("Socketpair failed: %v", err)
+		}
+		readFDs = append(readFDs, fds[0])
+		writeFDs = append(writeFDs, fds[1])
+	}
+	if err := ep.SetFDs(writeFDs); err != nil {
+		t.Fatalf("SetFDs failed: %v", err)
+	}
+	// The replaced FDs are no longer used, and the endpoint must not report
+	// them as closed.
+	for _, fd := range append(c.readFDs, c.writeFDs...) {
+		unix.Close(fd)
+	}
+	c.readFDs, c.writeFDs = readFDs, writeFDs
+	select {
+	case <-c.done:
+		t.Fatalf("ClosedFunc called for replaced FDs")
+	default:
+	}
+
+	// Packets are written to the new FDs.
+	for hash := range writeFDs {
+		pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Payload: buffer.MakeWithData([]byte{byte(hash)}),
+		})
+		pkt.Hash = uint32(hash)
+		var pkts stack.PacketBufferList
+		pkts.PushBack(pkt)
+		if _, err := c.ep.WritePackets(pkts); err != nil {
+			t.Fatalf("WritePackets failed: %s", err)
+		}
+		pkts.DecRef()
+		b := make([]byte, mtu)
+		n, err := unix.Read(readFDs[hash], b)
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		if want := []byte{byte(hash)}; !bytes.Equal(b[:n], want) {
+			t.Fatalf("Read returned %x, want %x", b[:n], want)
+		}
+	}
+
+	// Packets are received from the new FDs.
+	for _, fd := range readFDs {
+		if _, err := unix.Write(fd, []byte{0x40}); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		select {
+		case pi := <-c.ch:
+			pi.Contents.DecRef()
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Timed out waiting for packet")
+		}
+	}
+
+	// cleanup expects two dispatchers to stop.
+	if err := ep.SetFDs(writeFDs[:2]); err != nil {
+		t.Fatalf("SetFDs failed: %v", err)
+	}
+	unix.Close(readFDs[2])
+	unix.Close(writeFDs[2])
+	c.readFDs, c.writeFDs = readFDs[:2], writeFDs[:2]
+}
+
 func TestBufConfigMaxLength(t *testing.T) {
 	got := 0
 	for _, i := range BufConfig {
@@ -132,7 +132,12 @@ type packetMMapDispatcher struct {
 	ringOffset int
 }
 
-func (*packetMMapDispatcher) release() {}
+func (d *packetMMapDispatcher) release() {
+	if d.ringBuffer != nil {
+		unix.Munmap(d.ringBuffer)
+		d.ringBuffer = nil
+	}
+}
 
 func (d *packetMMapDispatcher) readMMappedPacket() (*buffer.View, bool, tcpip.Error) {
 	hdr := tPacketHdr(d.ringBuffer[d.ringOffset*tpFrameSize:])
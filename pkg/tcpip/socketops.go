@@ -230,6 +230,15 @@ type SocketOptions struct {
 	// passing is enabled for IPv6.
 	ipv6RecvErrEnabled atomicbitops.Uint32
 
+	// freeBindEnabled determines whether the socket may be bound to an address
+	// that is not assigned to the stack.
+	freeBindEnabled atomicbitops.Uint32
+
+	// transparentEnabled determines whether the socket may be bound to and
+	// send from an address that is not assigned to the stack, and receive
+	// packets diverted to it by an iptables TPROXY target.
+	transparentEnabled atomicbitops.Uint32
+
 	// errQueue is the per-socket error queue. It is protected by errQueueMu.
 	errQueueMu sync.Mutex `state:"nosave"`
 	errQueue   sockErrorList
@@ -510,6 +519,26 @@ func (so *SocketOptions) SetIPv6RecvError(v bool) {
 	}
 }
 
+// GetFreeBind gets value for IP(V6)_FREEBIND option.
+func (so *SocketOptions) GetFreeBind() bool {
+	return so.freeBindEnabled.Load() != 0
+}
+
+// SetFreeBind sets value for IP(V6)_FREEBIND option.
+func (so *SocketOptions) SetFreeBind(v bool) {
+	storeAtomicBool(&so.freeBindEnabled, v)
+}
+
+// GetTransparent gets value for IP(V6)_TRANSPARENT option.
+func (so *SocketOptions) GetTransparent() bool {
+	return so.transparentEnabled.Load() != 0
+}
+
+// SetTransparent sets value for IP(V6)_TRANSPARENT option.
+func (so *SocketOptions) SetTransparent(v bool) {
+	storeAtomicBool(&so.transparentEnabled, v)
+}
+
 // GetLastError gets value for SO_ERROR option.
 func (so *SocketOptions) GetLastError() Error {
 	return so.handler.LastError()
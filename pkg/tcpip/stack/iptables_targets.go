@@ -257,6 +257,60 @@ func (rt *RedirectTarget) Action(pkt PacketBufferPtr, hook Hook, r *Route, addre
 	return dnatAction(pkt, hook, r, rt.Port, address, true /* changePort */, true /* changeAddress */)
 }
 
+// TProxyTarget diverts packets to a local socket without changing their
+// destination, so that transparent proxies can accept connections and
+// datagrams addressed to other hosts. It is only valid in the Prerouting hook.
+//
+// Diverted packets that match a connection of a transparent socket exactly
+// are delivered to that socket. Otherwise they are delivered to the
+// transparent socket bound to Addr and Port, and dropped if there is none.
+type TProxyTarget struct {
+	// Addr is the address of the socket to divert packets to. If unspecified,
+	// the primary address of the incoming interface is used.
+	//
+	// Immutable.
+	Addr tcpip.Address
+
+	// Port is the port of the socket to divert packets to. If zero, the
+	// destination port of the packet is used.
+	//
+	// Immutable.
+	Port uint16
+
+	// NetworkProtocol is the network protocol the target is used with.
+	//
+	// Immutable.
+	NetworkProtocol tcpip.NetworkProtocolNumber
+}
+
+// Action implements Target.Action.
+func (tt *TProxyTarget) Action(pkt PacketBufferPtr, hook Hook, _ *Route, addressEP AddressableEndpoint) (RuleVerdict, int) {
+	// Sanity check.
+	if tt.NetworkProtocol != pkt.NetworkProtocolNumber {
+		panic(fmt.Sprintf(
+			"TProxyTarget.Action with NetworkProtocol %d called on packet with NetworkProtocolNumber %d",
+			tt.NetworkProtocol, pkt.NetworkProtocolNumber))
+	}
+
+	if hook != Prerouting {
+		panic("tproxy target is supported only on prerouting hook")
+	}
+
+	address := tt.Addr
+	if address.Unspecified() {
+		// addressEP is expected to be set for the prerouting hook.
+		address = addressEP.MainAddress().Address
+		if address.Unspecified() {
+			return RuleDrop, 0
+		}
+	}
+
+	pkt.tproxied = true
+	pkt.tproxyAddr = address
+	pkt.tproxyPort = tt.Port
+	return RuleAccept, 0
+}
+
 // SNATTarget modifies the source port/IP in the outgoing packets.
 type SNATTarget struct {
 	Addr tcpip.Address
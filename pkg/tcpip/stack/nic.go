@@ -19,6 +19,7 @@ import (
 	"reflect"
 
 	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 )
@@ -79,6 +80,19 @@ type nic struct {
 	qDisc QueueingDiscipline
 
 	gro groDispatcher
+
+	// tcEnabled is true when tc is set. It allows checking whether traffic
+	// control is enabled without locking tcMu.
+	tcEnabled atomicbitops.Bool
+
+	// tcMu protects tc.
+	tcMu sync.RWMutex
+
+	// tc holds the traffic control state of the NIC, or nil if traffic control
+	// is disabled.
+	//
+	// +checklocks:tcMu
+	tc *nicTC
 }
 
 // makeNICStats initializes the NIC statistics and associates them to the global
@@ -316,6 +330,9 @@ func (n *nic) remove() tcpip.Error {
 	// We must not hold n.enableDisableMu here.
 	n.linkResQueue.cancel()
 
+	// Drop packets held by traffic control.
+	n.setTC(nil)
+
 	// Prevent packets from going down to the link before shutting the link down.
 	n.qDisc.Close()
 	n.NetworkLinkEndpoint.Attach(nil)
@@ -396,6 +413,14 @@ func (n *nic) writeRawPacketWithLinkHeaderInPayload(pkt PacketBufferPtr) tcpip.E
 func (n *nic) writeRawPacket(pkt PacketBufferPtr) tcpip.Error {
 	// Always an outgoing packet.
 	pkt.PktType = tcpip.PacketOutgoing
+	if n.tcEnabled.Load() {
+		return n.tcEgress(pkt)
+	}
+	return n.writeQDiscPacket(pkt)
+}
+
+// writeQDiscPacket passes pkt to the NIC's queueing discipline.
+func (n *nic) writeQDiscPacket(pkt PacketBufferPtr) tcpip.Error {
 	if err := n.qDisc.WritePacket(pkt); err != nil {
 		if _, ok := err.(*tcpip.ErrNoBufferSpace); ok {
 			n.stats.txPacketsDroppedNoBufferSpace.Increment()
@@ -727,6 +752,10 @@ func (n *nic) DeliverNetworkPacket(protocol tcpip.NetworkProtocolNumber, pkt Pac
 	n.stats.rx.packets.Increment()
 	n.stats.rx.bytes.IncrementBy(uint64(pkt.Data().Size()))
 
+	if n.tcEnabled.Load() && !n.tcIngress(pkt) {
+		return
+	}
+
 	networkEndpoint := n.getNetworkEndpoint(protocol)
 	if networkEndpoint == nil {
 		n.stats.unknownL3ProtocolRcvdPacketCounts.Increment(uint64(protocol))
@@ -798,6 +827,12 @@ func (n *nic) DeliverLinkPacket(protocol tcpip.NetworkProtocolNumber, pkt Packet
 // DeliverTransportPacket delivers the packets to the appropriate transport
 // protocol endpoint.
 func (n *nic) DeliverTransportPacket(protocol tcpip.TransportProtocolNumber, pkt PacketBufferPtr) TransportPacketDisposition {
+	if protocol == header.ESPProtocolNumber && n.stack.xfrm.numStates.Load() != 0 {
+		if n.stack.xfrm.deliverESP(n, pkt) {
+			return TransportPacketHandled
+		}
+	}
+
 	state, ok := n.stack.transportProtocols[protocol]
 	if !ok {
 		n.stats.unknownL4ProtocolRcvdPacketCounts.Increment(uint64(protocol))
@@ -829,6 +864,12 @@ func (n *nic) DeliverTransportPacket(protocol tcpip.TransportProtocolNumber, pkt
 		RemotePort:    srcPort,
 		RemoteAddress: src,
 	}
+	if !pkt.xfrmDecapsulated {
+		// Drop packets that should have been received through IPsec.
+		if f := packetFlow(pkt.NetworkProtocolNumber, protocol, id); n.stack.xfrm.rejectsInput(&f) {
+			return TransportPacketHandled
+		}
+	}
 	if n.stack.demux.deliverPacket(protocol, pkt, id) {
 		return TransportPacketHandled
 	}
@@ -150,6 +150,18 @@ type PacketBuffer struct {
 	// iptables NAT table.
 	dnatDone bool
 
+	// tproxied indicates if the packet was diverted by an iptables TPROXY
+	// target. If set, the packet is delivered to the transparent socket bound
+	// to tproxyAddr and tproxyPort rather than forwarded, without changing its
+	// destination.
+	tproxied   bool
+	tproxyAddr tcpip.Address
+	tproxyPort uint16
+
+	// xfrmDecapsulated indicates that the packet was received through an
+	// IPsec security association.
+	xfrmDecapsulated bool
+
 	// PktType indicates the SockAddrLink.PacketType of the packet as defined in
 	// https://www.man7.org/linux/man-pages/man7/packet.7.html.
 	PktType tcpip.PacketType
@@ -377,6 +389,10 @@ func (pk PacketBufferPtr) Clone() PacketBufferPtr {
 	newPk.NetworkProtocolNumber = pk.NetworkProtocolNumber
 	newPk.dnatDone = pk.dnatDone
 	newPk.snatDone = pk.snatDone
+	newPk.tproxied = pk.tproxied
+	newPk.tproxyAddr = pk.tproxyAddr
+	newPk.tproxyPort = pk.tproxyPort
+	newPk.xfrmDecapsulated = pk.xfrmDecapsulated
 	newPk.TransportProtocolNumber = pk.TransportProtocolNumber
 	newPk.PktType = pk.PktType
 	newPk.NICID = pk.NICID
@@ -411,6 +427,13 @@ func (pk PacketBufferPtr) Network() header.Network {
 	}
 }
 
+// TransparentProxied returns whether an iptables TPROXY target diverted the
+// packet to a local socket, in which case it must be delivered locally even
+// though its destination address may not be assigned to the stack.
+func (pk PacketBufferPtr) TransparentProxied() bool {
+	return pk.tproxied
+}
+
 // CloneToInbound makes a semi-deep copy of the packet buffer (similar to
 // Clone) to be used as an inbound packet.
 //
@@ -308,11 +308,18 @@ func (r *Route) RequiresTXTransportChecksum() bool {
 	if r.local() {
 		return false
 	}
+	// Checksums can't be offloaded for packets that may be encrypted.
+	if r.outgoingNIC.stack.xfrm.protectsOutput() {
+		return true
+	}
 	return r.outgoingNIC.NetworkLinkEndpoint.Capabilities()&CapabilityTXChecksumOffload == 0
 }
 
 // HasGvisorGSOCapability returns true if the route supports gVisor GSO.
 func (r *Route) HasGvisorGSOCapability() bool {
+	if r.outgoingNIC.stack.xfrm.protectsOutput() {
+		return false
+	}
 	if gso, ok := r.outgoingNIC.NetworkLinkEndpoint.(GSOEndpoint); ok {
 		return gso.SupportedGSO() == GvisorGSOSupported
 	}
@@ -321,6 +328,9 @@ func (r *Route) HasGvisorGSOCapability() bool {
 
 // HasHostGSOCapability returns true if the route supports host GSO.
 func (r *Route) HasHostGSOCapability() bool {
+	if r.outgoingNIC.stack.xfrm.protectsOutput() {
+		return false
+	}
 	if gso, ok := r.outgoingNIC.NetworkLinkEndpoint.(GSOEndpoint); ok {
 		return gso.SupportedGSO() == HostGSOSupported
 	}
@@ -497,6 +507,9 @@ func (r *Route) WritePacket(params NetworkHeaderParams, pkt PacketBufferPtr) tcp
 		return &tcpip.ErrInvalidEndpointState{}
 	}
 
+	if x := r.outgoingNIC.stack.xfrm; x.protectsOutput() {
+		return x.writePacket(r, params, pkt)
+	}
 	return r.outgoingNIC.getNetworkEndpoint(r.NetProto()).WritePacket(r, params, pkt)
 }
 
@@ -517,7 +530,12 @@ func (r *Route) DefaultTTL() uint8 {
 
 // MTU returns the MTU of the underlying network endpoint.
 func (r *Route) MTU() uint32 {
-	return r.outgoingNIC.getNetworkEndpoint(r.NetProto()).MTU()
+	mtu := r.outgoingNIC.getNetworkEndpoint(r.NetProto()).MTU()
+	// Leave room for ESP encapsulation.
+	if r.outgoingNIC.stack.xfrm.protectsOutput() && mtu > XFRMESPOverhead {
+		mtu -= XFRMESPOverhead
+	}
+	return mtu
 }
 
 // Release decrements the reference counter of the resources associated with the
@@ -115,6 +115,9 @@ type Stack struct {
 	// TODO(gvisor.dev/issue/4595): S/R this field.
 	tables *IPTables
 
+	// xfrm holds the IPsec security associations and policies.
+	xfrm *XFRM
+
 	// resumableEndpoints is a list of endpoints that need to be resumed if the
 	// stack is being restored.
 	resumableEndpoints []ResumableEndpoint
@@ -379,6 +382,7 @@ func New(opts Options) *Stack {
 		stats:                        opts.Stats.FillIn(),
 		handleLocal:                  opts.HandleLocal,
 		tables:                       opts.IPTables,
+		xfrm:                         &XFRM{},
 		icmpRateLimiter:              NewICMPRateLimiter(clock),
 		seed:                         secureRNG.Uint32(),
 		nudConfigs:                   opts.NUDConfigs,
@@ -1480,6 +1484,39 @@ func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, n
 	return nil, &tcpip.ErrNetworkUnreachable{}
 }
 
+// FindTransparentRoute is like FindRoute, but permits localAddr to be an
+// address that is not assigned to the stack, as sockets with IP_TRANSPARENT
+// set may do. Such a route leaves through the interface FindRoute picks for an
+// unspecified local address, and holds a temporary address endpoint for
+// localAddr while it is in use.
+func (s *Stack) FindTransparentRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber, multicastLoop bool) (*Route, tcpip.Error) {
+	if localAddr.BitLen() == 0 || s.CheckLocalAddress(id, netProto, localAddr) != 0 {
+		return s.FindRoute(id, localAddr, remoteAddr, netProto, multicastLoop)
+	}
+
+	r, err := s.FindRoute(id, tcpip.Address{}, remoteAddr, netProto, multicastLoop)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Release()
+
+	addressEndpoint := r.outgoingNIC.getAddressOrCreateTempInner(netProto, localAddr, true /* createTemp */, NeverPrimaryEndpoint)
+	if addressEndpoint == nil {
+		return nil, &tcpip.ErrBadLocalAddress{}
+	}
+	return makeRoute(
+		netProto,
+		r.NextHop(), /* gateway */
+		localAddr,
+		r.RemoteAddress(),
+		r.outgoingNIC, /* outboundNIC */
+		r.outgoingNIC, /* localAddressNIC */
+		addressEndpoint,
+		s.handleLocal,
+		multicastLoop,
+	), nil
+}
+
 // CheckNetworkProtocol checks if a given network protocol is enabled in the
 // stack.
 func (s *Stack) CheckNetworkProtocol(protocol tcpip.NetworkProtocolNumber) bool {
@@ -0,0 +1,543 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"math"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// TokenBucket configures a token bucket rate limiter.
+type TokenBucket struct {
+	// Rate is the rate at which the bucket fills, in bytes per second.
+	Rate uint64
+
+	// Burst is the size of the bucket in bytes, i.e. the number of bytes that
+	// may be sent back to back after the bucket has been idle.
+	Burst uint32
+}
+
+// TCShaper configures egress shaping: packets that exceed the token bucket are
+// queued until enough tokens are available, rather than dropped. This is
+// equivalent to Linux's tbf qdisc.
+type TCShaper struct {
+	TokenBucket
+
+	// Limit is the maximum number of bytes that may be queued. Packets that
+	// would exceed it are dropped.
+	Limit uint32
+}
+
+// TCMirror configures a mirred-style action, which copies or moves packets to
+// the egress of another NIC.
+type TCMirror struct {
+	// NIC is the NIC that packets are sent out of.
+	NIC tcpip.NICID
+
+	// Redirect indicates that packets are moved to NIC rather than copied: the
+	// original packet is neither delivered nor sent.
+	Redirect bool
+}
+
+// TCHook configures the actions applied to all packets received (ingress) or
+// sent (egress) by a NIC, in order.
+type TCHook struct {
+	// Policer, if set, drops packets that exceed the token bucket.
+	Policer *TokenBucket
+
+	// Mirrors are applied to packets that pass the policer.
+	Mirrors []TCMirror
+}
+
+// TrafficControl is the traffic control configuration of a NIC, modeled after
+// the subset of Linux's tc(8) that is commonly used in containers: ingress
+// policing, egress shaping and packet mirroring. The zero value disables
+// traffic control.
+type TrafficControl struct {
+	Ingress TCHook
+	Egress  TCHook
+
+	// Shaper, if set, shapes packets sent by the NIC after the egress hook.
+	Shaper *TCShaper
+}
+
+func (tc *TrafficControl) enabled() bool {
+	return tc.Ingress.Policer != nil || len(tc.Ingress.Mirrors) != 0 ||
+		tc.Egress.Policer != nil || len(tc.Egress.Mirrors) != 0 ||
+		tc.Shaper != nil
+}
+
+// TCHookStats holds statistics for a TCHook.
+type TCHookStats struct {
+	// Packets and Bytes count the packets that entered the hook.
+	Packets uint64
+	Bytes   uint64
+
+	// Dropped counts the packets dropped by the policer.
+	Dropped uint64
+
+	// Mirrored counts the packets copied or redirected to another NIC.
+	Mirrored uint64
+}
+
+// TCShaperStats holds statistics for a TCShaper.
+type TCShaperStats struct {
+	// Packets and Bytes count the packets sent by the shaper.
+	Packets uint64
+	Bytes   uint64
+
+	// Dropped counts the packets dropped because the queue was full.
+	Dropped uint64
+
+	// Overlimits counts the packets that exceeded the token bucket, i.e. that
+	// were queued or dropped.
+	Overlimits uint64
+
+	// Backlog and QLen are the number of bytes and packets currently queued.
+	Backlog uint32
+	QLen    uint32
+}
+
+// TCStats holds the traffic control statistics of a NIC.
+type TCStats struct {
+	Ingress TCHookStats
+	Egress  TCHookStats
+	Shaper  TCShaperStats
+}
+
+// tokenBucket implements TokenBucket.
+//
+// Packets larger than the burst, e.g. GSO packets, are allowed through when
+// the bucket is full and leave it in debt, so that they are limited to the
+// configured rate instead of never conforming.
+type tokenBucket struct {
+	rate   uint64
+	burst  float64
+	tokens float64
+	last   tcpip.MonotonicTime
+}
+
+func newTokenBucket(cfg TokenBucket, now tcpip.MonotonicTime) tokenBucket {
+	return tokenBucket{
+		rate:   cfg.Rate,
+		burst:  float64(cfg.Burst),
+		tokens: float64(cfg.Burst),
+		last:   now,
+	}
+}
+
+func (b *tokenBucket) refill(now tcpip.MonotonicTime) {
+	b.tokens += now.Sub(b.last).Seconds() * float64(b.rate)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// needed returns the number of tokens that must be available for a packet of
+// size bytes to conform.
+func (b *tokenBucket) needed(size int) float64 {
+	return min(float64(size), b.burst)
+}
+
+// take takes size tokens from the bucket and returns true if the packet
+// conforms. Otherwise, it returns false and leaves the bucket unchanged.
+func (b *tokenBucket) take(now tcpip.MonotonicTime, size int) bool {
+	b.refill(now)
+	if b.tokens < b.needed(size) {
+		return false
+	}
+	b.tokens -= float64(size)
+	return true
+}
+
+// delay returns how long to wait until a packet of size bytes conforms.
+func (b *tokenBucket) delay(now tcpip.MonotonicTime, size int) time.Duration {
+	b.refill(now)
+	missing := b.needed(size) - b.tokens
+	if missing <= 0 {
+		return 0
+	}
+	// Round up, so that the packet conforms once the delay has elapsed.
+	return time.Duration(math.Ceil(missing * float64(time.Second) / float64(b.rate)))
+}
+
+// tcPolicer implements TCHook.Policer.
+type tcPolicer struct {
+	mu sync.Mutex
+
+	// +checklocks:mu
+	bucket tokenBucket
+}
+
+// conform takes size tokens from the policer's bucket and returns true if the
+// packet conforms.
+func (p *tcPolicer) conform(now tcpip.MonotonicTime, size int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.bucket.take(now, size)
+}
+
+// tcHook implements TCHook.
+type tcHook struct {
+	policer *tcPolicer
+	mirrors []tcMirror
+
+	packets  atomicbitops.Uint64
+	bytes    atomicbitops.Uint64
+	dropped  atomicbitops.Uint64
+	mirrored atomicbitops.Uint64
+}
+
+type tcMirror struct {
+	nic      *nic
+	redirect bool
+}
+
+// process applies the hook to pkt, and returns true if pkt must continue
+// through the NIC.
+func (h *tcHook) process(n *nic, pkt PacketBufferPtr) bool {
+	size := pkt.Size()
+	h.packets.Add(1)
+	h.bytes.Add(uint64(size))
+	if h.policer != nil && !h.policer.conform(n.stack.clock.NowMonotonic(), size) {
+		h.dropped.Add(1)
+		return false
+	}
+	keep := true
+	for _, m := range h.mirrors {
+		// The packet is mirrored as long as it was handed to the target NIC,
+		// even if the target NIC fails to send it.
+		h.mirrored.Add(1)
+		m.nic.writeMirroredPacket(pkt)
+		if m.redirect {
+			keep = false
+			break
+		}
+	}
+	return keep
+}
+
+func (h *tcHook) stats() TCHookStats {
+	return TCHookStats{
+		Packets:  h.packets.Load(),
+		Bytes:    h.bytes.Load(),
+		Dropped:  h.dropped.Load(),
+		Mirrored: h.mirrored.Load(),
+	}
+}
+
+// shapedPacket is a packet queued by a tcShaper.
+type shapedPacket struct {
+	pkt  PacketBufferPtr
+	size int
+}
+
+// tcShaper implements TCShaper.
+type tcShaper struct {
+	nic   *nic
+	limit uint32
+
+	mu sync.Mutex
+
+	// +checklocks:mu
+	bucket tokenBucket
+
+	// queue holds packets waiting for tokens, in order. Each packet holds a
+	// reference.
+	//
+	// +checklocks:mu
+	queue []shapedPacket
+
+	// timer, if not nil, sends queued packets once the packet at the head of
+	// the queue conforms.
+	//
+	// +checklocks:mu
+	timer tcpip.Timer
+
+	// +checklocks:mu
+	closed bool
+
+	// +checklocks:mu
+	stats TCShaperStats
+}
+
+// writePacket sends pkt if it conforms and no packets are queued, and queues
+// it otherwise.
+func (s *tcShaper) writePacket(pkt PacketBufferPtr) tcpip.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return &tcpip.ErrClosedForSend{}
+	}
+	size := pkt.Size()
+	if len(s.queue) == 0 && s.bucket.take(s.nic.stack.clock.NowMonotonic(), size) {
+		return s.sendLocked(pkt, size)
+	}
+	s.stats.Overlimits++
+	if uint64(s.stats.Backlog)+uint64(size) > uint64(s.limit) {
+		s.stats.Dropped++
+		s.nic.stats.txPacketsDroppedNoBufferSpace.Increment()
+		return &tcpip.ErrNoBufferSpace{}
+	}
+	pkt.IncRef()
+	s.queue = append(s.queue, shapedPacket{pkt: pkt, size: size})
+	s.stats.Backlog += uint32(size)
+	s.stats.QLen++
+	if len(s.queue) == 1 {
+		s.scheduleLocked()
+	}
+	// Like Linux's tbf qdisc, report success for queued packets.
+	return nil
+}
+
+// +checklocks:s.mu
+func (s *tcShaper) sendLocked(pkt PacketBufferPtr, size int) tcpip.Error {
+	if err := s.nic.writeQDiscPacket(pkt); err != nil {
+		return err
+	}
+	s.stats.Packets++
+	s.stats.Bytes += uint64(size)
+	return nil
+}
+
+// scheduleLocked arms the timer for the packet at the head of the queue.
+//
+// +checklocks:s.mu
+func (s *tcShaper) scheduleLocked() {
+	d := s.bucket.delay(s.nic.stack.clock.NowMonotonic(), s.queue[0].size)
+	if s.timer == nil {
+		s.timer = s.nic.stack.clock.AfterFunc(d, s.drain)
+	} else {
+		s.timer.Reset(d)
+	}
+}
+
+// drain sends queued packets that conform.
+func (s *tcShaper) drain() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	for len(s.queue) != 0 {
+		head := s.queue[0]
+		if !s.bucket.take(s.nic.stack.clock.NowMonotonic(), head.size) {
+			s.scheduleLocked()
+			return
+		}
+		s.queue[0] = shapedPacket{}
+		s.queue = s.queue[1:]
+		s.stats.Backlog -= uint32(head.size)
+		s.stats.QLen--
+		// Errors are accounted for by the NIC's stats; there is no one to
+		// report them to.
+		_ = s.sendLocked(head.pkt, head.size)
+		head.pkt.DecRef()
+	}
+}
+
+// close drops all queued packets. The shaper may not be used afterwards.
+func (s *tcShaper) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	for _, p := range s.queue {
+		p.pkt.DecRef()
+	}
+	s.queue = nil
+	s.stats.Backlog = 0
+	s.stats.QLen = 0
+}
+
+func (s *tcShaper) getStats() TCShaperStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// nicTC holds the traffic control state of a NIC.
+type nicTC struct {
+	ingress tcHook
+	egress  tcHook
+	shaper  *tcShaper
+}
+
+func (s *Stack) newNICTC(n *nic, cfg TrafficControl) (*nicTC, tcpip.Error) {
+	now := s.clock.NowMonotonic()
+	tc := &nicTC{}
+	for _, h := range []struct {
+		cfg  *TCHook
+		hook *tcHook
+	}{
+		{&cfg.Ingress, &tc.ingress},
+		{&cfg.Egress, &tc.egress},
+	} {
+		if p := h.cfg.Policer; p != nil {
+			if p.Rate == 0 || p.Burst == 0 {
+				return nil, &tcpip.ErrInvalidOptionValue{}
+			}
+			h.hook.policer = &tcPolicer{bucket: newTokenBucket(*p, now)}
+		}
+		for _, m := range h.cfg.Mirrors {
+			target, ok := s.nics[m.NIC]
+			if !ok {
+				return nil, &tcpip.ErrUnknownNICID{}
+			}
+			h.hook.mirrors = append(h.hook.mirrors, tcMirror{nic: target, redirect: m.Redirect})
+		}
+	}
+	if sh := cfg.Shaper; sh != nil {
+		if sh.Rate == 0 || sh.Burst == 0 || sh.Limit == 0 {
+			return nil, &tcpip.ErrInvalidOptionValue{}
+		}
+		tc.shaper = &tcShaper{
+			nic:    n,
+			limit:  sh.Limit,
+			bucket: newTokenBucket(sh.TokenBucket, now),
+		}
+	}
+	return tc, nil
+}
+
+func (tc *nicTC) close() {
+	if tc.shaper != nil {
+		tc.shaper.close()
+	}
+}
+
+func (tc *nicTC) stats() TCStats {
+	stats := TCStats{
+		Ingress: tc.ingress.stats(),
+		Egress:  tc.egress.stats(),
+	}
+	if tc.shaper != nil {
+		stats.Shaper = tc.shaper.getStats()
+	}
+	return stats
+}
+
+// SetTrafficControl replaces the traffic control configuration of the NIC.
+// Packets queued by the previous configuration's shaper are dropped, and
+// statistics are reset.
+func (s *Stack) SetTrafficControl(id tcpip.NICID, cfg TrafficControl) tcpip.Error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n, ok := s.nics[id]
+	if !ok {
+		return &tcpip.ErrUnknownNICID{}
+	}
+
+	var tc *nicTC
+	if cfg.enabled() {
+		var err tcpip.Error
+		if tc, err = s.newNICTC(n, cfg); err != nil {
+			return err
+		}
+	}
+	n.setTC(tc)
+	return nil
+}
+
+// TrafficControlStats returns the traffic control statistics of the NIC.
+func (s *Stack) TrafficControlStats(id tcpip.NICID) (TCStats, tcpip.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n, ok := s.nics[id]
+	if !ok {
+		return TCStats{}, &tcpip.ErrUnknownNICID{}
+	}
+
+	tc := n.getTC()
+	if tc == nil {
+		return TCStats{}, nil
+	}
+	return tc.stats(), nil
+}
+
+// setTC replaces n's traffic control state, and releases the previous one.
+func (n *nic) setTC(tc *nicTC) {
+	n.tcMu.Lock()
+	old := n.tc
+	n.tc = tc
+	n.tcEnabled.Store(tc != nil)
+	n.tcMu.Unlock()
+	if old != nil {
+		old.close()
+	}
+}
+
+// getTC returns n's traffic control state. Packets are processed without
+// holding tcMu, since sending a packet may deliver it to the same NIC, e.g. on
+// loopback.
+func (n *nic) getTC() *nicTC {
+	n.tcMu.RLock()
+	defer n.tcMu.RUnlock()
+	return n.tc
+}
+
+// tcIngress applies the ingress hook to pkt, and returns true if pkt must be
+// delivered.
+func (n *nic) tcIngress(pkt PacketBufferPtr) bool {
+	tc := n.getTC()
+	if tc == nil {
+		return true
+	}
+	return tc.ingress.process(n, pkt)
+}
+
+// tcEgress applies the egress hook and the shaper to pkt.
+func (n *nic) tcEgress(pkt PacketBufferPtr) tcpip.Error {
+	tc := n.getTC()
+	if tc == nil {
+		return n.writeQDiscPacket(pkt)
+	}
+	if !tc.egress.process(n, pkt) {
+		// Dropped or redirected packets are consumed, as in Linux.
+		return nil
+	}
+	if tc.shaper != nil {
+		return tc.shaper.writePacket(pkt)
+	}
+	return n.writeQDiscPacket(pkt)
+}
+
+// writeMirroredPacket sends a copy of pkt, starting at its link header, out of
+// n. The copy bypasses n's traffic control, so that mirrors can't loop.
+func (n *nic) writeMirroredPacket(pkt PacketBufferPtr) {
+	if !n.Enabled() {
+		return
+	}
+	cpy := NewPacketBuffer(PacketBufferOptions{
+		Payload: BufferSince(pkt.LinkHeader()),
+	})
+	defer cpy.DecRef()
+	cpy.NetworkProtocolNumber = pkt.NetworkProtocolNumber
+	cpy.GSOOptions = pkt.GSOOptions
+	cpy.PktType = tcpip.PacketOutgoing
+	if !n.NetworkLinkEndpoint.ParseHeader(cpy) {
+		return
+	}
+	_ = n.writeQDiscPacket(cpy)
+}
@@ -0,0 +1,262 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack_test
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	tcNIC1 tcpip.NICID = 1
+	tcNIC2 tcpip.NICID = 2
+)
+
+func newTCStack(t *testing.T) (*stack.Stack, *faketime.ManualClock, *channel.Endpoint, *channel.Endpoint) {
+	t.Helper()
+	clock := faketime.NewManualClock()
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{fakeNetFactory},
+		Clock:            clock,
+	})
+	ep1 := channel.New(10, defaultMTU, "")
+	ep2 := channel.New(10, defaultMTU, "")
+	for _, nic := range []struct {
+		id tcpip.NICID
+		ep stack.LinkEndpoint
+	}{{tcNIC1, ep1}, {tcNIC2, ep2}} {
+		if err := s.CreateNIC(nic.id, nic.ep); err != nil {
+			t.Fatalf("CreateNIC(%d) failed: %s", nic.id, err)
+		}
+	}
+	protocolAddr := tcpip.ProtocolAddress{
+		Protocol: fakeNetNumber,
+		AddressWithPrefix: tcpip.AddressWithPrefix{
+			Address:   tcpip.AddrFrom4Slice([]byte("\x01\x00\x00\x00")),
+			PrefixLen: fakeDefaultPrefixLen,
+		},
+	}
+	if err := s.AddProtocolAddress(tcNIC1, protocolAddr, stack.AddressProperties{}); err != nil {
+		t.Fatalf("AddProtocolAddress(%d, %+v, {}): %s", tcNIC1, protocolAddr, err)
+	}
+	t.Cleanup(func() {
+		s.Close()
+		s.Wait()
+	})
+	return s, clock, ep1, ep2
+}
+
+func injectTCPacket(ep *channel.Endpoint, size int) {
+	buf := make([]byte, size)
+	buf[dstAddrOffset] = 1
+	ep.InjectInbound(fakeNetNumber, stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Payload: buffer.MakeWithData(buf),
+	}))
+}
+
+func writeTCPacket(t *testing.T, s *stack.Stack, size int) tcpip.Error {
+	t.Helper()
+	return s.WriteRawPacket(tcNIC1, fakeNetNumber, buffer.MakeWithData(make([]byte, size)))
+}
+
+func tcStats(t *testing.T, s *stack.Stack) stack.TCStats {
+	t.Helper()
+	stats, err := s.TrafficControlStats(tcNIC1)
+	if err != nil {
+		t.Fatalf("TrafficControlStats(%d) failed: %s", tcNIC1, err)
+	}
+	return stats
+}
+
+func TestTrafficControlIngressPolicer(t *testing.T) {
+	s, clock, ep1, _ := newTCStack(t)
+	if err := s.SetTrafficControl(tcNIC1, stack.TrafficControl{
+		Ingress: stack.TCHook{
+			Policer: &stack.TokenBucket{Rate: 1000, Burst: 200},
+		},
+	}); err != nil {
+		t.Fatalf("SetTrafficControl failed: %s", err)
+	}
+	fakeNet := s.NetworkProtocolInstance(fakeNetNumber).(*fakeNetworkProtocol)
+
+	// The burst lets two packets through, then the bucket is empty.
+	for i := 0; i < 3; i++ {
+		injectTCPacket(ep1, 100)
+	}
+	if got, want := fakeNet.packetCount[1], 2; got != want {
+		t.Errorf("got %d packets delivered, want %d", got, want)
+	}
+
+	// The bucket refills at 1000 bytes per second.
+	clock.Advance(100 * time.Millisecond)
+	injectTCPacket(ep1, 100)
+	if got, want := fakeNet.packetCount[1], 3; got != want {
+		t.Errorf("got %d packets delivered after refill, want %d", got, want)
+	}
+
+	want := stack.TCHookStats{Packets: 4, Bytes: 400, Dropped: 1}
+	if got := tcStats(t, s).Ingress; got != want {
+		t.Errorf("got ingress stats %+v, want %+v", got, want)
+	}
+
+	// Disabling traffic control stops policing.
+	if err := s.SetTrafficControl(tcNIC1, stack.TrafficControl{}); err != nil {
+		t.Fatalf("SetTrafficControl failed: %s", err)
+	}
+	for i := 0; i < 3; i++ {
+		injectTCPacket(ep1, 100)
+	}
+	if got, want := fakeNet.packetCount[1], 6; got != want {
+		t.Errorf("got %d packets delivered with traffic control disabled, want %d", got, want)
+	}
+}
+
+func TestTrafficControlShaper(t *testing.T) {
+	s, clock, ep1, _ := newTCStack(t)
+	if err := s.SetTrafficControl(tcNIC1, stack.TrafficControl{
+		Shaper: &stack.TCShaper{
+			TokenBucket: stack.TokenBucket{Rate: 1000, Burst: 100},
+			Limit:       200,
+		},
+	}); err != nil {
+		t.Fatalf("SetTrafficControl failed: %s", err)
+	}
+
+	// The first packet is sent right away, the next two are queued and the
+	// last one exceeds the limit.
+	for i, wantErr := range []tcpip.Error{nil, nil, nil, &tcpip.ErrNoBufferSpace{}} {
+		if err := writeTCPacket(t, s, 100); err != wantErr && (err == nil || wantErr == nil || err.String() != wantErr.String()) {
+			t.Errorf("packet %d: got WriteRawPacket(_) = %v, want %v", i, err, wantErr)
+		}
+	}
+	if got, want := ep1.NumQueued(), 1; got != want {
+		t.Errorf("got %d packets sent, want %d", got, want)
+	}
+	want := stack.TCShaperStats{Packets: 1, Bytes: 100, Dropped: 1, Overlimits: 3, Backlog: 200, QLen: 2}
+	if got := tcStats(t, s).Shaper; got != want {
+		t.Errorf("got shaper stats %+v, want %+v", got, want)
+	}
+
+	// Queued packets are sent as tokens become available.
+	clock.Advance(100 * time.Millisecond)
+	if got, want := ep1.NumQueued(), 2; got != want {
+		t.Errorf("got %d packets sent after 100ms, want %d", got, want)
+	}
+	clock.Advance(100 * time.Millisecond)
+	if got, want := ep1.NumQueued(), 3; got != want {
+		t.Errorf("got %d packets sent after 200ms, want %d", got, want)
+	}
+	want = stack.TCShaperStats{Packets: 3, Bytes: 300, Dropped: 1, Overlimits: 3}
+	if got := tcStats(t, s).Shaper; got != want {
+		t.Errorf("got shaper stats %+v, want %+v", got, want)
+	}
+}
+
+func TestTrafficControlMirror(t *testing.T) {
+	for _, redirect := range []bool{false, true} {
+		name := "mirror"
+		if redirect {
+			name = "redirect"
+		}
+		t.Run(name, func(t *testing.T) {
+			s, _, ep1, ep2 := newTCStack(t)
+			mirrors := []stack.TCMirror{{NIC: tcNIC2, Redirect: redirect}}
+			if err := s.SetTrafficControl(tcNIC1, stack.TrafficControl{
+				Ingress: stack.TCHook{Mirrors: mirrors},
+				Egress:  stack.TCHook{Mirrors: mirrors},
+			}); err != nil {
+				t.Fatalf("SetTrafficControl failed: %s", err)
+			}
+			fakeNet := s.NetworkProtocolInstance(fakeNetNumber).(*fakeNetworkProtocol)
+
+			injectTCPacket(ep1, 100)
+			if err := writeTCPacket(t, s, 100); err != nil {
+				t.Fatalf("WriteRawPacket failed: %s", err)
+			}
+
+			// Both packets are sent out of NIC 2.
+			if got, want := ep2.NumQueued(), 2; got != want {
+				t.Errorf("got %d packets sent by NIC %d, want %d", got, tcNIC2, want)
+			}
+			for i := 0; i < 2; i++ {
+				pkt := ep2.Read()
+				if got, want := pkt.Size(), 100; got != want {
+					t.Errorf("got mirrored packet of %d bytes, want %d", got, want)
+				}
+				pkt.DecRef()
+			}
+			wantOriginal := 1
+			if redirect {
+				wantOriginal = 0
+			}
+			if got := fakeNet.packetCount[1]; got != wantOriginal {
+				t.Errorf("got %d packets delivered, want %d", got, wantOriginal)
+			}
+			if got := ep1.NumQueued(); got != wantOriginal {
+				t.Errorf("got %d packets sent by NIC %d, want %d", got, tcNIC1, wantOriginal)
+			}
+			stats := tcStats(t, s)
+			if stats.Ingress.Mirrored != 1 || stats.Egress.Mirrored != 1 {
+				t.Errorf("got %d ingress and %d egress packets mirrored, want 1 and 1", stats.Ingress.Mirrored, stats.Egress.Mirrored)
+			}
+		})
+	}
+}
+
+func TestTrafficControlInvalid(t *testing.T) {
+	s, _, _, _ := newTCStack(t)
+	for _, tc := range []struct {
+		name string
+		nic  tcpip.NICID
+		cfg  stack.TrafficControl
+		want tcpip.Error
+	}{
+		{
+			name: "unknown NIC",
+			nic:  3,
+			want: &tcpip.ErrUnknownNICID{},
+		},
+		{
+			name: "unknown mirror NIC",
+			nic:  tcNIC1,
+			cfg:  stack.TrafficControl{Egress: stack.TCHook{Mirrors: []stack.TCMirror{{NIC: 3}}}},
+			want: &tcpip.ErrUnknownNICID{},
+		},
+		{
+			name: "zero rate",
+			nic:  tcNIC1,
+			cfg:  stack.TrafficControl{Ingress: stack.TCHook{Policer: &stack.TokenBucket{Burst: 100}}},
+			want: &tcpip.ErrInvalidOptionValue{},
+		},
+		{
+			name: "zero limit",
+			nic:  tcNIC1,
+			cfg:  stack.TrafficControl{Shaper: &stack.TCShaper{TokenBucket: stack.TokenBucket{Rate: 100, Burst: 100}}},
+			want: &tcpip.ErrInvalidOptionValue{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := s.SetTrafficControl(tc.nic, tc.cfg); err != tc.want {
+				t.Errorf("got SetTrafficControl(%d, %+v) = %v, want %v", tc.nic, tc.cfg, err, tc.want)
+			}
+		})
+	}
+}
@@ -133,6 +133,25 @@ func (eps *transportEndpoints) findEndpointLocked(id TransportEndpointID) *endpo
 	return matchedEP
 }
 
+// findTransparentEndpointLocked returns the endpoint a packet diverted by a
+// TPROXY target to addr and port should be delivered to: the endpoint of the
+// connection that matches id exactly, if any, or otherwise the endpoint that
+// most closely matches id with its local address and port replaced by addr and
+// port. A port of zero leaves the local port of id unchanged.
+//
+// +checklocksread:eps.mu
+func (eps *transportEndpoints) findTransparentEndpointLocked(id TransportEndpointID, addr tcpip.Address, port uint16) *endpointsByNIC {
+	if ep, ok := eps.endpoints[id]; ok {
+		return ep
+	}
+	nid := id
+	nid.LocalAddress = addr
+	if port != 0 {
+		nid.LocalPort = port
+	}
+	return eps.findEndpointLocked(nid)
+}
+
 type endpointsByNIC struct {
 	// seed is a random secret for a jenkins hash.
 	seed uint32
@@ -175,6 +194,12 @@ func (epsByNIC *endpointsByNIC) handlePacket(id TransportEndpointID, pkt PacketB
 	}
 	// multiPortEndpoints are guaranteed to have at least one element.
 	transEP := mpep.selectEndpoint(id, epsByNIC.seed)
+	if pkt.tproxied && !isTransparent(transEP) {
+		// Only transparent sockets may receive packets diverted by a TPROXY
+		// target.
+		epsByNIC.mu.RUnlock()
+		return true
+	}
 	if queuedProtocol, mustQueue := mpep.demux.queuedProtocols[protocolIDs{mpep.netProto, mpep.transProto}]; mustQueue {
 		queuedProtocol.QueuePacket(transEP, id, pkt)
 		epsByNIC.mu.RUnlock()
@@ -585,6 +610,18 @@ func (d *transportDemuxer) deliverPacket(protocol tcpip.TransportProtocolNumber,
 		return true
 	}
 
+	if pkt.tproxied {
+		eps.mu.RLock()
+		ep := eps.findTransparentEndpointLocked(id, pkt.tproxyAddr, pkt.tproxyPort)
+		eps.mu.RUnlock()
+		// As in Linux, packets diverted by a TPROXY target are dropped if there
+		// is no transparent socket to deliver them to.
+		if ep != nil {
+			ep.handlePacket(id, pkt)
+		}
+		return true
+	}
+
 	eps.mu.RLock()
 	ep := eps.findEndpointLocked(id)
 	eps.mu.RUnlock()
@@ -718,6 +755,12 @@ func (d *transportDemuxer) unregisterRawEndpoint(netProto tcpip.NetworkProtocolN
 	eps.mu.Unlock()
 }
 
+// isTransparent returns whether ep is a socket with IP_TRANSPARENT set.
+func isTransparent(ep TransportEndpoint) bool {
+	so, ok := ep.(interface{ SocketOptions() *tcpip.SocketOptions })
+	return ok && so.SocketOptions().GetTransparent()
+}
+
 func isInboundMulticastOrBroadcast(pkt PacketBufferPtr, localAddr tcpip.Address) bool {
 	return pkt.NetworkPacketInfo.LocalAddressBroadcast || header.IsV4MulticastAddress(localAddr) || header.IsV6MulticastAddress(localAddr)
 }
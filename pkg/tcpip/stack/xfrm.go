@@ -0,0 +1,846 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"io"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// XFRMMode is the IPsec mode of a security association or template.
+type XFRMMode uint8
+
+const (
+	// XFRMModeTransport protects the payload of packets exchanged between
+	// the endpoints of the security association.
+	XFRMModeTransport XFRMMode = iota
+
+	// XFRMModeTunnel encapsulates whole packets. It is not supported.
+	XFRMModeTunnel
+)
+
+// XFRMDir is the direction of traffic that a security policy applies to.
+type XFRMDir uint8
+
+// The directions of security policies, as defined by Linux.
+const (
+	XFRMDirIn XFRMDir = iota
+	XFRMDirOut
+	XFRMDirFwd
+
+	numXFRMDirs
+)
+
+// XFRMAction is the action of a security policy.
+type XFRMAction uint8
+
+const (
+	// XFRMActionAllow lets matching packets through, applying the policy's
+	// templates.
+	XFRMActionAllow XFRMAction = iota
+
+	// XFRMActionBlock drops matching packets.
+	XFRMActionBlock
+)
+
+// XFRMAlgAESGCM is the name of the only supported AEAD algorithm: AES-GCM
+// for ESP as described in RFC 4106.
+const XFRMAlgAESGCM = "rfc4106(gcm(aes))"
+
+const (
+	// espIVSize is the size of the explicit IV carried in ESP packets
+	// protected with AES-GCM.
+	espIVSize = 8
+
+	// espSaltSize is the size of the salt, which is passed as the last bytes
+	// of the key.
+	espSaltSize = 4
+
+	// espMaxICVSize is the largest supported ICV size.
+	espMaxICVSize = 16
+)
+
+// XFRMESPOverhead is the maximum number of bytes that ESP encapsulation adds
+// to the payload of a packet: the ESP header, the IV, up to 3 bytes of
+// padding, the trailer and the ICV.
+const XFRMESPOverhead = header.ESPMinimumSize + espIVSize + 3 + header.ESPTrailerSize + espMaxICVSize
+
+// XFRMSelector selects the packets that a security association or policy
+// applies to. Zero fields match any packet.
+type XFRMSelector struct {
+	Family       tcpip.NetworkProtocolNumber
+	Src          tcpip.Address
+	Dst          tcpip.Address
+	SrcPrefixLen uint8
+	DstPrefixLen uint8
+	SrcPort      uint16
+	SrcPortMask  uint16
+	DstPort      uint16
+	DstPortMask  uint16
+	Protocol     tcpip.TransportProtocolNumber
+}
+
+// xfrmFlow describes a packet for matching against selectors.
+type xfrmFlow struct {
+	netProto tcpip.NetworkProtocolNumber
+	src      tcpip.Address
+	dst      tcpip.Address
+	proto    tcpip.TransportProtocolNumber
+	srcPort  uint16
+	dstPort  uint16
+}
+
+func xfrmPrefixMatches(prefix tcpip.Address, prefixLen uint8, addr tcpip.Address) bool {
+	if prefixLen == 0 {
+		return true
+	}
+	if prefix.Len() != addr.Len() {
+		return false
+	}
+	return prefix.MatchingPrefix(addr) >= prefixLen
+}
+
+func (s *XFRMSelector) matches(f *xfrmFlow) bool {
+	if s.Family != 0 && s.Family != f.netProto {
+		return false
+	}
+	if s.Protocol != 0 && s.Protocol != f.proto {
+		return false
+	}
+	if (f.srcPort^s.SrcPort)&s.SrcPortMask != 0 || (f.dstPort^s.DstPort)&s.DstPortMask != 0 {
+		return false
+	}
+	return xfrmPrefixMatches(s.Src, s.SrcPrefixLen, f.src) && xfrmPrefixMatches(s.Dst, s.DstPrefixLen, f.dst)
+}
+
+// XFRMState is an IPsec security association (SA).
+type XFRMState struct {
+	// Dst, SPI and Proto identify the SA.
+	Dst   tcpip.Address
+	SPI   uint32
+	Proto tcpip.TransportProtocolNumber
+
+	// Src is the source address of packets protected by the SA.
+	Src tcpip.Address
+
+	// Family is the network protocol of Src and Dst.
+	Family tcpip.NetworkProtocolNumber
+
+	Mode  XFRMMode
+	ReqID uint32
+
+	// ReplayWindow is the size of the anti-replay window in packets. Zero
+	// disables replay protection.
+	ReplayWindow uint8
+
+	Selector XFRMSelector
+
+	// AEADName is the name of the AEAD algorithm, which must be
+	// XFRMAlgAESGCM.
+	AEADName string
+
+	// AEADKey is the key, followed by the 4 byte salt.
+	AEADKey []byte
+
+	// ICVLen is the length of the integrity check value in bytes.
+	ICVLen int
+}
+
+// XFRMStateStats are the counters of a security association.
+type XFRMStateStats struct {
+	Bytes           uint64
+	Packets         uint64
+	ReplayDropped   uint32
+	IntegrityFailed uint32
+
+	// SeqOut is the sequence number of the last packet sent.
+	SeqOut uint32
+
+	// SeqIn is the highest sequence number received.
+	SeqIn uint32
+}
+
+// XFRMStateInfo is a security association and its counters.
+type XFRMStateInfo struct {
+	XFRMState
+	Stats XFRMStateStats
+}
+
+// XFRMTemplate describes the security association that must be applied to
+// packets matching a security policy. Zero addresses, SPI and ReqID match any
+// SA.
+type XFRMTemplate struct {
+	Dst      tcpip.Address
+	SPI      uint32
+	Proto    tcpip.TransportProtocolNumber
+	Src      tcpip.Address
+	Family   tcpip.NetworkProtocolNumber
+	ReqID    uint32
+	Mode     XFRMMode
+	Optional bool
+}
+
+// XFRMPolicy is an IPsec security policy (SP).
+type XFRMPolicy struct {
+	Selector XFRMSelector
+	Dir      XFRMDir
+
+	// Index identifies the policy. It is assigned by the stack.
+	Index uint32
+
+	// Priority orders policies; lower values take precedence.
+	Priority  uint32
+	Action    XFRMAction
+	Templates []XFRMTemplate
+}
+
+type xfrmStateKey struct {
+	dst   tcpip.Address
+	spi   uint32
+	proto tcpip.TransportProtocolNumber
+}
+
+// xfrmState is an installed security association.
+type xfrmState struct {
+	// cfg is immutable.
+	cfg  XFRMState
+	aead cipher.AEAD
+	salt [espSaltSize]byte
+
+	bytes           atomicbitops.Uint64
+	packets         atomicbitops.Uint64
+	replayDropped   atomicbitops.Uint32
+	integrityFailed atomicbitops.Uint32
+	seqOut          atomicbitops.Uint32
+
+	mu xfrmStateMutex
+
+	// seqIn is the highest sequence number received.
+	// +checklocks:mu
+	seqIn uint32
+
+	// replay has bit i set if sequence number seqIn-i was received.
+	// +checklocks:mu
+	replay uint64
+}
+
+func (st *xfrmState) info() XFRMStateInfo {
+	info := XFRMStateInfo{
+		XFRMState: st.cfg,
+		Stats: XFRMStateStats{
+			Bytes:           st.bytes.Load(),
+			Packets:         st.packets.Load(),
+			ReplayDropped:   st.replayDropped.Load(),
+			IntegrityFailed: st.integrityFailed.Load(),
+			SeqOut:          st.seqOut.Load(),
+		},
+	}
+	info.AEADKey = append([]byte(nil), st.cfg.AEADKey...)
+	st.mu.Lock()
+	info.Stats.SeqIn = st.seqIn
+	st.mu.Unlock()
+	return info
+}
+
+// XFRM holds the security association and security policy databases of a
+// stack, and applies them to packets.
+type XFRM struct {
+	// numStates and numPolicies mirror the sizes of the databases, so that
+	// packets can skip taking mu while IPsec is not configured.
+	numStates   atomicbitops.Int32
+	numPolicies [numXFRMDirs]atomicbitops.Int32
+
+	mu xfrmRWMutex
+
+	// +checklocks:mu
+	states map[xfrmStateKey]*xfrmState
+
+	// +checklocks:mu
+	policies []XFRMPolicy
+
+	// +checklocks:mu
+	nextIndex uint32
+}
+
+func (x *XFRM) updateCountsLocked() {
+	x.numStates.Store(int32(len(x.states)))
+	var n [numXFRMDirs]int32
+	for i := range x.policies {
+		n[x.policies[i].Dir]++
+	}
+	for dir := range n {
+		x.numPolicies[dir].Store(n[dir])
+	}
+}
+
+func validateXFRMState(st *XFRMState) tcpip.Error {
+	if st.Proto != header.ESPProtocolNumber || st.Mode != XFRMModeTransport {
+		return &tcpip.ErrNotSupported{}
+	}
+	if st.AEADName != XFRMAlgAESGCM {
+		return &tcpip.ErrNotSupported{}
+	}
+	switch len(st.AEADKey) - espSaltSize {
+	case 16, 24, 32:
+	default:
+		return &tcpip.ErrInvalidOptionValue{}
+	}
+	// The Go implementation of GCM does not support ICVs shorter than 12
+	// bytes.
+	if st.ICVLen < 12 || st.ICVLen > espMaxICVSize {
+		return &tcpip.ErrNotSupported{}
+	}
+	if st.Dst.Len() == 0 || st.Dst.Len() != st.Src.Len() {
+		return &tcpip.ErrInvalidOptionValue{}
+	}
+	if st.ReplayWindow > 64 {
+		st.ReplayWindow = 64
+	}
+	return nil
+}
+
+// AddState installs a security association. If update is true, it replaces
+// an existing SA with the same ID and fails if there is none; otherwise it
+// fails if there is one.
+func (x *XFRM) AddState(st XFRMState, update bool) tcpip.Error {
+	if err := validateXFRMState(&st); err != nil {
+		return err
+	}
+	st.AEADKey = append([]byte(nil), st.AEADKey...)
+	keyLen := len(st.AEADKey) - espSaltSize
+	block, err := aes.NewCipher(st.AEADKey[:keyLen])
+	if err != nil {
+		return &tcpip.ErrInvalidOptionValue{}
+	}
+	aead, err := cipher.NewGCMWithTagSize(block, st.ICVLen)
+	if err != nil {
+		return &tcpip.ErrInvalidOptionValue{}
+	}
+	s := &xfrmState{
+		cfg:  st,
+		aead: aead,
+	}
+	copy(s.salt[:], st.AEADKey[keyLen:])
+
+	key := xfrmStateKey{dst: st.Dst, spi: st.SPI, proto: st.Proto}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	_, ok := x.states[key]
+	if ok && !update {
+		return &tcpip.ErrDuplicateAddress{}
+	}
+	if !ok && update {
+		return &tcpip.ErrNoSuchFile{}
+	}
+	if x.states == nil {
+		x.states = make(map[xfrmStateKey]*xfrmState)
+	}
+	x.states[key] = s
+	x.updateCountsLocked()
+	return nil
+}
+
+// DeleteState removes a security association.
+func (x *XFRM) DeleteState(dst tcpip.Address, spi uint32, proto tcpip.TransportProtocolNumber) tcpip.Error {
+	key := xfrmStateKey{dst: dst, spi: spi, proto: proto}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if _, ok := x.states[key]; !ok {
+		return &tcpip.ErrNoSuchFile{}
+	}
+	delete(x.states, key)
+	x.updateCountsLocked()
+	return nil
+}
+
+// GetState returns a security association.
+func (x *XFRM) GetState(dst tcpip.Address, spi uint32, proto tcpip.TransportProtocolNumber) (XFRMStateInfo, tcpip.Error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	st, ok := x.states[xfrmStateKey{dst: dst, spi: spi, proto: proto}]
+	if !ok {
+		return XFRMStateInfo{}, &tcpip.ErrNoSuchFile{}
+	}
+	return st.info(), nil
+}
+
+// States returns all security associations.
+func (x *XFRM) States() []XFRMStateInfo {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	states := make([]XFRMStateInfo, 0, len(x.states))
+	for _, st := range x.states {
+		states = append(states, st.info())
+	}
+	return states
+}
+
+// FlushStates removes all security associations of the given protocol, or of
+// all protocols if proto is zero.
+func (x *XFRM) FlushStates(proto tcpip.TransportProtocolNumber) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for key := range x.states {
+		if proto == 0 || key.proto == proto {
+			delete(x.states, key)
+		}
+	}
+	x.updateCountsLocked()
+}
+
+// findPolicyLocked returns the index in x.policies of the policy with the
+// given index, or with the given direction and selector if index is zero.
+//
+// +checklocksread:x.mu
+func (x *XFRM) findPolicyLocked(dir XFRMDir, sel *XFRMSelector, index uint32) int {
+	for i := range x.policies {
+		p := &x.policies[i]
+		if index != 0 {
+			if p.Index == index {
+				return i
+			}
+			continue
+		}
+		if p.Dir == dir && p.Selector == *sel {
+			return i
+		}
+	}
+	return -1
+}
+
+// AddPolicy installs a security policy and returns it with its index set. If
+// update is true, it replaces an existing policy with the same direction and
+// selector, or adds it if there is none; otherwise it fails if there is one.
+func (x *XFRM) AddPolicy(p XFRMPolicy, update bool) (XFRMPolicy, tcpip.Error) {
+	if p.Dir >= numXFRMDirs {
+		return XFRMPolicy{}, &tcpip.ErrInvalidOptionValue{}
+	}
+	for _, t := range p.Templates {
+		if t.Proto != header.ESPProtocolNumber || t.Mode != XFRMModeTransport {
+			return XFRMPolicy{}, &tcpip.ErrNotSupported{}
+		}
+	}
+	p.Templates = append([]XFRMTemplate(nil), p.Templates...)
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if i := x.findPolicyLocked(p.Dir, &p.Selector, 0); i >= 0 {
+		if !update {
+			return XFRMPolicy{}, &tcpip.ErrDuplicateAddress{}
+		}
+		p.Index = x.policies[i].Index
+		x.policies[i] = p
+		return p, nil
+	}
+	// Like Linux, encode the direction in the low bits of the index.
+	x.nextIndex++
+	p.Index = x.nextIndex<<3 | uint32(p.Dir)
+	x.policies = append(x.policies, p)
+	x.updateCountsLocked()
+	return p, nil
+}
+
+// DeletePolicy removes the security policy with the given index, or with the
+// given direction and selector if index is zero, and returns it.
+func (x *XFRM) DeletePolicy(dir XFRMDir, sel *XFRMSelector, index uint32) (XFRMPolicy, tcpip.Error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	i := x.findPolicyLocked(dir, sel, index)
+	if i < 0 {
+		return XFRMPolicy{}, &tcpip.ErrNoSuchFile{}
+	}
+	p := x.policies[i]
+	x.policies = append(x.policies[:i], x.policies[i+1:]...)
+	x.updateCountsLocked()
+	return p, nil
+}
+
+// GetPolicy returns the security policy with the given index, or with the
+// given direction and selector if index is zero.
+func (x *XFRM) GetPolicy(dir XFRMDir, sel *XFRMSelector, index uint32) (XFRMPolicy, tcpip.Error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	i := x.findPolicyLocked(dir, sel, index)
+	if i < 0 {
+		return XFRMPolicy{}, &tcpip.ErrNoSuchFile{}
+	}
+	p := x.policies[i]
+	p.Templates = append([]XFRMTemplate(nil), p.Templates...)
+	return p, nil
+}
+
+// Policies returns all security policies.
+func (x *XFRM) Policies() []XFRMPolicy {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	policies := make([]XFRMPolicy, 0, len(x.policies))
+	for _, p := range x.policies {
+		p.Templates = append([]XFRMTemplate(nil), p.Templates...)
+		policies = append(policies, p)
+	}
+	return policies
+}
+
+// FlushPolicies removes all security policies.
+func (x *XFRM) FlushPolicies() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.policies = nil
+	x.updateCountsLocked()
+}
+
+// protectsOutput returns true if outgoing packets may need to be
+// encapsulated.
+func (x *XFRM) protectsOutput() bool {
+	return x.numPolicies[XFRMDirOut].Load() != 0
+}
+
+// lookupPolicyLocked returns the policy of the given direction with the
+// highest precedence that matches f, or nil.
+//
+// +checklocksread:x.mu
+func (x *XFRM) lookupPolicyLocked(dir XFRMDir, f *xfrmFlow) *XFRMPolicy {
+	var match *XFRMPolicy
+	for i := range x.policies {
+		p := &x.policies[i]
+		if p.Dir != dir || !p.Selector.matches(f) {
+			continue
+		}
+		if match == nil || p.Priority < match.Priority {
+			match = p
+		}
+	}
+	return match
+}
+
+// findStateLocked returns an SA satisfying template t for a packet described
+// by f, or nil.
+//
+// +checklocksread:x.mu
+func (x *XFRM) findStateLocked(t *XFRMTemplate, f *xfrmFlow) *xfrmState {
+	dst, src := t.Dst, t.Src
+	// In transport mode, the SA's endpoints are the packet's.
+	if dst.Unspecified() {
+		dst = f.dst
+	}
+	if src.Unspecified() {
+		src = f.src
+	}
+	if t.SPI != 0 {
+		st, ok := x.states[xfrmStateKey{dst: dst, spi: t.SPI, proto: t.Proto}]
+		if !ok || st.cfg.Src != src || (t.ReqID != 0 && st.cfg.ReqID != t.ReqID) {
+			return nil
+		}
+		return st
+	}
+	for key, st := range x.states {
+		if key.dst != dst || key.proto != t.Proto || st.cfg.Src != src || st.cfg.Mode != t.Mode {
+			continue
+		}
+		if t.ReqID != 0 && st.cfg.ReqID != t.ReqID {
+			continue
+		}
+		if !st.cfg.Selector.matches(f) {
+			continue
+		}
+		return st
+	}
+	return nil
+}
+
+// outputState returns the SA that must be applied to an outgoing packet
+// described by f, or nil if the packet must be sent in the clear.
+func (x *XFRM) outputState(f *xfrmFlow) (*xfrmState, tcpip.Error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	p := x.lookupPolicyLocked(XFRMDirOut, f)
+	if p == nil {
+		return nil, nil
+	}
+	if p.Action == XFRMActionBlock {
+		return nil, &tcpip.ErrNotPermitted{}
+	}
+	for i := range p.Templates {
+		t := &p.Templates[i]
+		if st := x.findStateLocked(t, f); st != nil {
+			return st, nil
+		}
+		if !t.Optional {
+			return nil, &tcpip.ErrHostUnreachable{}
+		}
+	}
+	return nil, nil
+}
+
+// rejectsInput returns true if an incoming packet described by f that was not
+// received through an SA must be dropped.
+func (x *XFRM) rejectsInput(f *xfrmFlow) bool {
+	if x.numPolicies[XFRMDirIn].Load() == 0 {
+		return false
+	}
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	p := x.lookupPolicyLocked(XFRMDirIn, f)
+	if p == nil {
+		return false
+	}
+	if p.Action == XFRMActionBlock {
+		return true
+	}
+	for i := range p.Templates {
+		if !p.Templates[i].Optional {
+			return true
+		}
+	}
+	return false
+}
+
+// encapsulate returns an ESP packet carrying payload, whose protocol is
+// nextHdr. See RFC 4303 and RFC 4106.
+func (st *xfrmState) encapsulate(rng io.Reader, payload []byte, nextHdr uint8) ([]byte, tcpip.Error) {
+	seq := st.seqOut.Add(1)
+	if seq == 0 {
+		// Extended sequence numbers are not supported, so the SA must be
+		// replaced before the sequence number wraps.
+		return nil, &tcpip.ErrHostUnreachable{}
+	}
+
+	// The ciphertext must end on a 4 byte boundary.
+	padLen := (4 - (len(payload)+header.ESPTrailerSize)%4) % 4
+	plaintext := make([]byte, 0, len(payload)+padLen+header.ESPTrailerSize)
+	plaintext = append(plaintext, payload...)
+	for i := 1; i <= padLen; i++ {
+		plaintext = append(plaintext, byte(i))
+	}
+	plaintext = append(plaintext, byte(padLen), nextHdr)
+
+	hdrLen := header.ESPMinimumSize + espIVSize
+	esp := make([]byte, hdrLen, hdrLen+len(plaintext)+st.aead.Overhead())
+	header.ESP(esp).Encode(&header.ESPFields{
+		SPI:            st.cfg.SPI,
+		SequenceNumber: seq,
+	})
+	iv := esp[header.ESPMinimumSize:hdrLen]
+	if _, err := io.ReadFull(rng, iv); err != nil {
+		return nil, &tcpip.ErrNoBufferSpace{}
+	}
+	var nonce [espSaltSize + espIVSize]byte
+	copy(nonce[:], st.salt[:])
+	copy(nonce[espSaltSize:], iv)
+	var aad [header.ESPMinimumSize]byte
+	copy(aad[:], esp)
+	esp = st.aead.Seal(esp, nonce[:], plaintext, aad[:])
+
+	st.packets.Add(1)
+	st.bytes.Add(uint64(len(payload)))
+	return esp, nil
+}
+
+// checkReplay returns true if seq was already received or is too old.
+func (st *xfrmState) checkReplay(seq uint32) bool {
+	if st.cfg.ReplayWindow == 0 {
+		return false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if seq == 0 {
+		return true
+	}
+	if seq > st.seqIn {
+		return false
+	}
+	diff := st.seqIn - seq
+	return diff >= uint32(st.cfg.ReplayWindow) || st.replay&(1<<diff) != 0
+}
+
+// advanceReplay records that seq was received.
+func (st *xfrmState) advanceReplay(seq uint32) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if seq > st.seqIn {
+		if shift := seq - st.seqIn; shift < 64 {
+			st.replay <<= shift
+		} else {
+			st.replay = 0
+		}
+		st.replay |= 1
+		st.seqIn = seq
+		return
+	}
+	if diff := st.seqIn - seq; diff < 64 {
+		st.replay |= 1 << diff
+	}
+}
+
+// decapsulate authenticates and decrypts an ESP packet, and returns its
+// payload and the protocol of the payload.
+func (st *xfrmState) decapsulate(esp []byte) ([]byte, uint8, bool) {
+	hdrLen := header.ESPMinimumSize + espIVSize
+	if len(esp) < hdrLen+header.ESPTrailerSize+st.aead.Overhead() {
+		return nil, 0, false
+	}
+	seq := header.ESP(esp).SequenceNumber()
+	if st.checkReplay(seq) {
+		st.replayDropped.Add(1)
+		return nil, 0, false
+	}
+	var nonce [espSaltSize + espIVSize]byte
+	copy(nonce[:], st.salt[:])
+	copy(nonce[espSaltSize:], esp[header.ESPMinimumSize:hdrLen])
+	plaintext, err := st.aead.Open(nil, nonce[:], esp[hdrLen:], esp[:header.ESPMinimumSize])
+	if err != nil {
+		st.integrityFailed.Add(1)
+		return nil, 0, false
+	}
+	trailer := len(plaintext) - header.ESPTrailerSize
+	padLen := int(plaintext[trailer])
+	if padLen > trailer {
+		return nil, 0, false
+	}
+	if st.cfg.ReplayWindow != 0 {
+		st.advanceReplay(seq)
+	}
+	payload := plaintext[:trailer-padLen]
+	st.packets.Add(1)
+	st.bytes.Add(uint64(len(payload)))
+	return payload, plaintext[trailer+1], true
+}
+
+// writePacket writes pkt through r, encapsulating it if an output policy
+// requires it.
+func (x *XFRM) writePacket(r *Route, params NetworkHeaderParams, pkt PacketBufferPtr) tcpip.Error {
+	netEP := r.outgoingNIC.getNetworkEndpoint(r.NetProto())
+	f := xfrmFlow{
+		netProto: r.NetProto(),
+		src:      r.LocalAddress(),
+		dst:      r.RemoteAddress(),
+		proto:    params.Protocol,
+	}
+	transHdr := pkt.TransportHeader().Slice()
+	if state, ok := r.outgoingNIC.stack.transportProtocols[params.Protocol]; ok && len(transHdr) != 0 {
+		if srcPort, dstPort, err := state.proto.ParsePorts(transHdr); err == nil {
+			f.srcPort, f.dstPort = srcPort, dstPort
+		}
+	}
+	st, err := x.outputState(&f)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		return netEP.WritePacket(r, params, pkt)
+	}
+
+	payload := make([]byte, 0, len(transHdr)+pkt.Data().Size())
+	payload = append(payload, transHdr...)
+	payload = append(payload, pkt.Data().AsRange().ToSlice()...)
+	esp, err := st.encapsulate(r.outgoingNIC.stack.secureRNG.Reader, payload, uint8(params.Protocol))
+	if err != nil {
+		return err
+	}
+	espPkt := NewPacketBuffer(PacketBufferOptions{
+		ReserveHeaderBytes: int(r.MaxHeaderLength()),
+		Payload:            buffer.MakeWithData(esp),
+	})
+	defer espPkt.DecRef()
+	espPkt.TransportProtocolNumber = header.ESPProtocolNumber
+	espPkt.Owner = pkt.Owner
+	espPkt.Hash = pkt.Hash
+	params.Protocol = header.ESPProtocolNumber
+	return netEP.WritePacket(r, params, espPkt)
+}
+
+// deliverESP decapsulates an incoming ESP packet and hands the result back to
+// the network endpoint it was received by. It returns false if there is no SA
+// for the packet.
+func (x *XFRM) deliverESP(n *nic, pkt PacketBufferPtr) bool {
+	netHdr := pkt.NetworkHeader().Slice()
+	var dst tcpip.Address
+	switch pkt.NetworkProtocolNumber {
+	case header.IPv4ProtocolNumber:
+		dst = header.IPv4(netHdr).DestinationAddress()
+	case header.IPv6ProtocolNumber:
+		dst = header.IPv6(netHdr).DestinationAddress()
+	default:
+		return false
+	}
+	hdr, ok := pkt.Data().PullUp(header.ESPMinimumSize)
+	if !ok {
+		n.stats.malformedL4RcvdPackets.Increment()
+		return true
+	}
+	x.mu.RLock()
+	st := x.states[xfrmStateKey{dst: dst, spi: header.ESP(hdr).SPI(), proto: header.ESPProtocolNumber}]
+	x.mu.RUnlock()
+	if st == nil {
+		return false
+	}
+	payload, nextHdr, ok := st.decapsulate(pkt.Data().AsRange().ToSlice())
+	if !ok {
+		return true
+	}
+
+	// Rebuild the network header as if the payload had been received in the
+	// clear.
+	switch pkt.NetworkProtocolNumber {
+	case header.IPv4ProtocolNumber:
+		h := header.IPv4(append([]byte(nil), netHdr...))
+		h.SetProtocol(nextHdr)
+		h.SetTotalLength(uint16(len(h) + len(payload)))
+		// The packet may have been reassembled.
+		h.SetFlagsFragmentOffset(h.Flags()&^header.IPv4FlagMoreFragments, 0)
+		h.SetChecksum(0)
+		h.SetChecksum(^h.CalculateChecksum())
+		netHdr = h
+	case header.IPv6ProtocolNumber:
+		h := header.IPv6(append([]byte(nil), netHdr[:header.IPv6MinimumSize]...))
+		h.SetNextHeader(nextHdr)
+		h.SetPayloadLength(uint16(len(payload)))
+		netHdr = h
+	}
+	buf := buffer.MakeWithData(netHdr)
+	buf.Append(buffer.NewViewWithData(payload))
+	newPkt := NewPacketBuffer(PacketBufferOptions{Payload: buf})
+	defer newPkt.DecRef()
+	newPkt.NICID = pkt.NICID
+	newPkt.PktType = pkt.PktType
+	// Locally generated packets may be sent without transport checksums.
+	newPkt.RXChecksumValidated = pkt.RXChecksumValidated
+	newPkt.xfrmDecapsulated = true
+	n.getNetworkEndpoint(pkt.NetworkProtocolNumber).HandlePacket(newPkt)
+	return true
+}
+
+// packetFlow returns the flow of an incoming packet.
+func packetFlow(netProto tcpip.NetworkProtocolNumber, transProto tcpip.TransportProtocolNumber, id TransportEndpointID) xfrmFlow {
+	return xfrmFlow{
+		netProto: netProto,
+		src:      id.RemoteAddress,
+		dst:      id.LocalAddress,
+		proto:    transProto,
+		srcPort:  id.RemotePort,
+		dstPort:  id.LocalPort,
+	}
+}
+
+// XFRM returns the stack's IPsec databases.
+func (s *Stack) XFRM() *XFRM {
+	return s.xfrm
+}
@@ -1336,6 +1336,69 @@ func (*TCPSynRetriesOption) isGettableTransportProtocolOption() {}
 
 func (*TCPSynRetriesOption) isSettableTransportProtocolOption() {}
 
+// TCPMTUProbingMode is the mode of TCP packetization layer path MTU
+// discovery, as in net.ipv4.tcp_mtu_probing.
+type TCPMTUProbingMode int32
+
+const (
+	// TCPMTUProbingDisabled disables path MTU probing.
+	TCPMTUProbingDisabled TCPMTUProbingMode = iota
+
+	// TCPMTUProbingBlackhole enables path MTU probing on connections that
+	// detect an ICMP blackhole, i.e. whose retransmissions keep timing out.
+	TCPMTUProbingBlackhole
+
+	// TCPMTUProbingAlways enables path MTU probing on all connections.
+	TCPMTUProbingAlways
+)
+
+// TCPMTUProbingOption is used by stack.(*Stack).TransportProtocolOption to
+// specify the stack-wide settings of TCP packetization layer path MTU
+// discovery (RFC 4821, RFC 8899).
+type TCPMTUProbingOption struct {
+	// Mode is the probing mode.
+	Mode TCPMTUProbingMode
+
+	// BaseMSS is the MSS that probing starts searching from, as in
+	// net.ipv4.tcp_base_mss.
+	BaseMSS int
+
+	// Floor is the smallest MSS that blackhole detection reduces the MSS
+	// to, as in net.ipv4.tcp_mtu_probe_floor.
+	Floor int
+
+	// Threshold is the size of the MSS search range below which the search
+	// is complete, as in net.ipv4.tcp_probe_threshold.
+	Threshold int
+
+	// Interval is the time after which a complete search is restarted to
+	// detect an increase of the path MTU, as in net.ipv4.tcp_probe_interval.
+	Interval time.Duration
+}
+
+func (*TCPMTUProbingOption) isGettableTransportProtocolOption() {}
+
+func (*TCPMTUProbingOption) isSettableTransportProtocolOption() {}
+
+// TCPOutOfOrderMemoryOption is used by stack.(*Stack).TransportProtocolOption
+// to limit the memory that TCP endpoints use to hold segments that arrived out
+// of order, while they wait for the missing data.
+type TCPOutOfOrderMemoryOption struct {
+	// Max is the number of bytes that the out-of-order segments of all TCP
+	// endpoints of the stack may use together. Zero means no limit.
+	Max int
+
+	// PerEndpoint is the number of bytes that the out-of-order segments of a
+	// single endpoint may use. An endpoint never uses more than 3/4 of its
+	// receive buffer for out-of-order segments either. Zero means no limit
+	// other than the receive buffer.
+	PerEndpoint int
+}
+
+func (*TCPOutOfOrderMemoryOption) isGettableTransportProtocolOption() {}
+
+func (*TCPOutOfOrderMemoryOption) isSettableTransportProtocolOption() {}
+
 // MulticastInterfaceOption is used by SetSockOpt/GetSockOpt to specify a
 // default interface for multicast.
 type MulticastInterfaceOption struct {
@@ -1365,6 +1428,22 @@ type RemoveMembershipOption MembershipOption
 
 func (*RemoveMembershipOption) isSettableSocketOption() {}
 
+// PacketFilter decides which received packets are delivered to an endpoint,
+// e.g. a classic BPF program attached with SO_ATTACH_FILTER.
+type PacketFilter interface {
+	// Filter returns the number of leading bytes of pkt to deliver. The
+	// packet is dropped if it returns 0.
+	Filter(pkt []byte) uint32
+}
+
+// SocketAttachFilterOption is used by SetSockOpt to attach a packet filter to
+// a given endpoint, replacing any previously attached filter.
+type SocketAttachFilterOption struct {
+	Filter PacketFilter
+}
+
+func (*SocketAttachFilterOption) isSettableSocketOption() {}
+
 // SocketDetachFilterOption is used by SetSockOpt to detach a previously attached
 // classic BPF filter on a given endpoint.
 type SocketDetachFilterOption int
@@ -1548,6 +1627,11 @@ func (s *StatCounter) Decrement() {
 	s.IncrementBy(^uint64(0))
 }
 
+// DecrementBy decrements the counter by v.
+func (s *StatCounter) DecrementBy(v uint64) {
+	s.IncrementBy(-v)
+}
+
 // Value returns the current value of the counter.
 func (s *StatCounter) Value() uint64 {
 	return s.count.Load()
@@ -2171,6 +2255,39 @@ type TCPStats struct {
 	// dropped due to exceeding the maximum number of in-flight connection
 	// requests.
 	ForwardMaxInFlightDrop *StatCounter
+
+	// MTUProbes is the number of path MTU probes sent.
+	MTUProbes *StatCounter
+
+	// MTUProbeFailures is the number of path MTU probes that were lost.
+	MTUProbeFailures *StatCounter
+
+	// MTUBlackholes is the number of times the MSS was reduced because
+	// retransmissions kept timing out.
+	MTUBlackholes *StatCounter
+
+	// OutOfOrderQueued is the number of segments queued because they arrived
+	// out of order.
+	OutOfOrderQueued *StatCounter
+
+	// OutOfOrderDropped is the number of out-of-order segments dropped
+	// because they didn't fit in the out-of-order memory budget.
+	OutOfOrderDropped *StatCounter
+
+	// OutOfOrderDroppedStackBudget is the number of out-of-order segments
+	// dropped because the stack-wide out-of-order memory budget had no room
+	// for them even without the receiving endpoint's own out-of-order
+	// segments, usually because other endpoints used it up. They are also
+	// counted in OutOfOrderDropped.
+	OutOfOrderDroppedStackBudget *StatCounter
+
+	// OutOfOrderPruned is the number of queued out-of-order segments dropped
+	// to make room for segments closer to the next expected sequence number.
+	OutOfOrderPruned *StatCounter
+
+	// CurrentOutOfOrderBytes is the number of bytes held by out-of-order
+	// segments of all endpoints now.
+	CurrentOutOfOrderBytes *StatCounter
 }
 
 // UDPStats collects UDP-specific stats.
@@ -0,0 +1,259 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xfrm_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/refs"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/testutil"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	nicID = 1
+	port  = 5000
+	spi   = 0x1234
+)
+
+var (
+	host1Addr = testutil.MustParse4("192.168.0.1")
+	host2Addr = testutil.MustParse4("192.168.0.2")
+
+	// aeadKey is a 128 bit AES key followed by a 4 byte salt.
+	aeadKey = []byte("0123456789abcdefsalt")
+)
+
+type host struct {
+	s  *stack.Stack
+	e  *channel.Endpoint
+	ep tcpip.Endpoint
+}
+
+func newHost(t *testing.T, addr tcpip.Address) *host {
+	t.Helper()
+	h := &host{
+		s: stack.New(stack.Options{
+			NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+			TransportProtocols: []stack.TransportProtocolFactory{udp.NewProtocol},
+		}),
+		e: channel.New(4, header.IPv4MinimumMTU*4, ""),
+	}
+	if err := h.s.CreateNIC(nicID, h.e); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+	}
+	protocolAddr := tcpip.ProtocolAddress{
+		Protocol:          ipv4.ProtocolNumber,
+		AddressWithPrefix: tcpip.AddressWithPrefix{Address: addr, PrefixLen: 24},
+	}
+	if err := h.s.AddProtocolAddress(nicID, protocolAddr, stack.AddressProperties{}); err != nil {
+		t.Fatalf("AddProtocolAddress(%d, %+v, {}): %s", nicID, protocolAddr, err)
+	}
+	h.s.SetRouteTable([]tcpip.Route{{Destination: header.IPv4EmptySubnet, NIC: nicID}})
+
+	var wq waiter.Queue
+	ep, err := h.s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+	if err != nil {
+		t.Fatalf("NewEndpoint: %s", err)
+	}
+	if err := ep.Bind(tcpip.FullAddress{Addr: addr, Port: port}); err != nil {
+		t.Fatalf("Bind: %s", err)
+	}
+	h.ep = ep
+	t.Cleanup(func() {
+		h.ep.Close()
+		h.s.Destroy()
+	})
+	return h
+}
+
+func (h *host) addSA(t *testing.T, src, dst tcpip.Address) {
+	t.Helper()
+	if err := h.s.XFRM().AddState(stack.XFRMState{
+		Dst:          dst,
+		SPI:          spi,
+		Proto:        header.ESPProtocolNumber,
+		Src:          src,
+		Family:       ipv4.ProtocolNumber,
+		Mode:         stack.XFRMModeTransport,
+		ReplayWindow: 32,
+		AEADName:     stack.XFRMAlgAESGCM,
+		AEADKey:      aeadKey,
+		ICVLen:       16,
+	}, false /* update */); err != nil {
+		t.Fatalf("AddState: %s", err)
+	}
+}
+
+func (h *host) addPolicy(t *testing.T, dir stack.XFRMDir, src, dst tcpip.Address) {
+	t.Helper()
+	if _, err := h.s.XFRM().AddPolicy(stack.XFRMPolicy{
+		Selector: stack.XFRMSelector{
+			Family:       ipv4.ProtocolNumber,
+			Src:          src,
+			SrcPrefixLen: 32,
+			Dst:          dst,
+			DstPrefixLen: 32,
+			Protocol:     udp.ProtocolNumber,
+		},
+		Dir: dir,
+		Templates: []stack.XFRMTemplate{{
+			Proto: header.ESPProtocolNumber,
+			Mode:  stack.XFRMModeTransport,
+		}},
+	}, false /* update */); err != nil {
+		t.Fatalf("AddPolicy: %s", err)
+	}
+}
+
+func (h *host) send(t *testing.T, to tcpip.Address, data []byte) []byte {
+	t.Helper()
+	var r bytes.Reader
+	r.Reset(data)
+	if _, err := h.ep.Write(&r, tcpip.WriteOptions{To: &tcpip.FullAddress{Addr: to, Port: port}}); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	pkt := h.e.Read()
+	if pkt.IsNil() {
+		t.Fatal("no packet sent")
+	}
+	defer pkt.DecRef()
+	v := stack.PayloadSince(pkt.NetworkHeader())
+	defer v.Release()
+	return append([]byte(nil), v.AsSlice()...)
+}
+
+func (h *host) inject(b []byte) {
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Payload: buffer.MakeWithData(b),
+	})
+	defer pkt.DecRef()
+	h.e.InjectInbound(ipv4.ProtocolNumber, pkt)
+}
+
+func (h *host) receive(t *testing.T) ([]byte, bool) {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := h.ep.Read(&buf, tcpip.ReadOptions{}); err != nil {
+		if _, ok := err.(*tcpip.ErrWouldBlock); !ok {
+			t.Fatalf("Read: %s", err)
+		}
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+func TestESPTransportMode(t *testing.T) {
+	h1 := newHost(t, host1Addr)
+	h2 := newHost(t, host2Addr)
+	h1.addSA(t, host1Addr, host2Addr)
+	h1.addPolicy(t, stack.XFRMDirOut, host1Addr, host2Addr)
+	h2.addSA(t, host1Addr, host2Addr)
+	h2.addPolicy(t, stack.XFRMDirIn, host1Addr, host2Addr)
+
+	data := []byte("attack at dawn")
+	pkt := h1.send(t, host2Addr, data)
+	ip := header.IPv4(pkt)
+	if got, want := ip.TransportProtocol(), header.ESPProtocolNumber; got != want {
+		t.Fatalf("got protocol %d, want %d", got, want)
+	}
+	esp := header.ESP(ip.Payload())
+	if got := esp.SPI(); got != spi {
+		t.Errorf("got SPI %#x, want %#x", got, spi)
+	}
+	if got := esp.SequenceNumber(); got != 1 {
+		t.Errorf("got sequence number %d, want 1", got)
+	}
+	if bytes.Contains(pkt, data) {
+		t.Errorf("packet %x contains the payload in the clear", pkt)
+	}
+
+	h2.inject(pkt)
+	got, ok := h2.receive(t)
+	if !ok {
+		t.Fatal("payload was not received")
+	}
+	if diff := cmp.Diff(data, got); diff != "" {
+		t.Errorf("payload mismatch (-want +got):\n%s", diff)
+	}
+
+	// Replayed packets are dropped.
+	h2.inject(pkt)
+	if got, ok := h2.receive(t); ok {
+		t.Errorf("received replayed payload %q", got)
+	}
+
+	// Tampered packets are dropped.
+	pkt = h1.send(t, host2Addr, data)
+	pkt[len(pkt)-1] ^= 0xff
+	h2.inject(pkt)
+	if got, ok := h2.receive(t); ok {
+		t.Errorf("received tampered payload %q", got)
+	}
+
+	info, err := h2.s.XFRM().GetState(host2Addr, spi, header.ESPProtocolNumber)
+	if err != nil {
+		t.Fatalf("GetState: %s", err)
+	}
+	if diff := cmp.Diff(stack.XFRMStateStats{
+		Bytes:           header.UDPMinimumSize + uint64(len(data)),
+		Packets:         1,
+		ReplayDropped:   1,
+		IntegrityFailed: 1,
+		SeqIn:           1,
+	}, info.Stats); diff != "" {
+		t.Errorf("stats mismatch (-want +got):\n%s", diff)
+	}
+
+	// Packets sent in the clear are dropped by the input policy.
+	h1.s.XFRM().FlushPolicies()
+	pkt = h1.send(t, host2Addr, data)
+	if got, want := header.IPv4(pkt).TransportProtocol(), udp.ProtocolNumber; got != want {
+		t.Fatalf("got protocol %d, want %d", got, want)
+	}
+	h2.inject(pkt)
+	if got, ok := h2.receive(t); ok {
+		t.Errorf("received unprotected payload %q", got)
+	}
+}
+
+func TestESPNoState(t *testing.T) {
+	h1 := newHost(t, host1Addr)
+	h1.addPolicy(t, stack.XFRMDirOut, host1Addr, host2Addr)
+
+	var r bytes.Reader
+	r.Reset([]byte("data"))
+	_, err := h1.ep.Write(&r, tcpip.WriteOptions{To: &tcpip.FullAddress{Addr: host2Addr, Port: port}})
+	if _, ok := err.(*tcpip.ErrHostUnreachable); !ok {
+		t.Errorf("got Write = %v, want %s", err, &tcpip.ErrHostUnreachable{})
+	}
+}
+
+func TestMain(m *testing.M) {
+	refs.SetLeakMode(refs.LeaksPanic)
+	code := m.Run()
+	refs.DoLeakCheck()
+	os.Exit(code)
+}
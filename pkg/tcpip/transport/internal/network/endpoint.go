@@ -274,7 +274,44 @@ func (c *WriteContext) TryNewPacketBuffer(reserveHdrBytes int, data buffer.Buffe
 	if !e.hasSendSpaceRLocked() {
 		return nil
 	}
+	return e.newPacketBufferLocked(reserveHdrBytes, data)
+}
+
+// TryNewPacketBufferFromPayloader is like TryNewPacketBuffer, but reads the
+// packet's payload from payloader. If the endpoint's send buffer is full,
+// *tcpip.ErrWouldBlock is returned and no data is read from payloader, so the
+// caller may retry the write with the same payloader once the endpoint becomes
+// writable.
+func (c *WriteContext) TryNewPacketBufferFromPayloader(reserveHdrBytes int, payloader tcpip.Payloader) (stack.PacketBufferPtr, tcpip.Error) {
+	e := c.e
+	n := payloader.Len()
+
+	// Reading from payloader may copy from application memory, which can
+	// fault and block, so reserve the packet's space in the send buffer and
+	// read the payload without holding sendBufferSizeInUseMu.
+	e.sendBufferSizeInUseMu.Lock()
+	if !e.hasSendSpaceRLocked() {
+		e.sendBufferSizeInUseMu.Unlock()
+		return nil, &tcpip.ErrWouldBlock{}
+	}
+	pktSize := int64(reserveHdrBytes) + int64(n)
+	e.sendBufferSizeInUse += pktSize
+	e.sendBufferSizeInUseMu.Unlock()
+
+	var data buffer.Buffer
+	if _, err := data.WriteFromReader(payloader, int64(n)); err != nil {
+		data.Release()
+		e.releaseSendBufferSpace(pktSize)
+		return nil, &tcpip.ErrBadBuffer{}
+	}
+	return e.newPacketBuffer(reserveHdrBytes, data, pktSize), nil
+}
 
+// newPacketBufferLocked returns a new packet buffer holding data and charges
+// its size to the endpoint's send buffer until it is released.
+//
+// +checklocks:e.sendBufferSizeInUseMu
+func (e *Endpoint) newPacketBufferLocked(reserveHdrBytes int, data buffer.Buffer) stack.PacketBufferPtr {
 	// Note that we allow oversubscription - if there is any space at all in the
 	// send buffer, we accept the full packet which may be larger than the space
 	// available. This is because if the endpoint reports that it is writable,
@@ -286,27 +323,40 @@ func (c *WriteContext) TryNewPacketBuffer(reserveHdrBytes int, data buffer.Buffe
 	pktSize := int64(reserveHdrBytes) + int64(data.Size())
 	e.sendBufferSizeInUse += pktSize
 
+	return e.newPacketBuffer(reserveHdrBytes, data, pktSize)
+}
+
+// newPacketBuffer returns a new packet buffer holding data, for which pktSize
+// bytes have been charged to the endpoint's send buffer. They are returned
+// when the packet buffer is released.
+func (e *Endpoint) newPacketBuffer(reserveHdrBytes int, data buffer.Buffer, pktSize int64) stack.PacketBufferPtr {
 	return stack.NewPacketBuffer(stack.PacketBufferOptions{
 		ReserveHeaderBytes: reserveHdrBytes,
 		Payload:            data,
 		OnRelease: func() {
-			e.sendBufferSizeInUseMu.Lock()
-			if got := e.sendBufferSizeInUse; got < pktSize {
-				e.sendBufferSizeInUseMu.Unlock()
-				panic(fmt.Sprintf("e.sendBufferSizeInUse=(%d) < pktSize(=%d)", got, pktSize))
-			}
-			e.sendBufferSizeInUse -= pktSize
-			signal := e.hasSendSpaceRLocked()
-			e.sendBufferSizeInUseMu.Unlock()
-
-			// Let waiters know if we now have space in the send buffer.
-			if signal {
-				e.waiterQueue.Notify(waiter.WritableEvents)
-			}
+			e.releaseSendBufferSpace(pktSize)
 		},
 	})
 }
 
+// releaseSendBufferSpace returns n bytes charged to the endpoint's send
+// buffer, and notifies waiters if the endpoint becomes writable.
+func (e *Endpoint) releaseSendBufferSpace(n int64) {
+	e.sendBufferSizeInUseMu.Lock()
+	if got := e.sendBufferSizeInUse; got < n {
+		e.sendBufferSizeInUseMu.Unlock()
+		panic(fmt.Sprintf("e.sendBufferSizeInUse=(%d) < pktSize(=%d)", got, n))
+	}
+	e.sendBufferSizeInUse -= n
+	signal := e.hasSendSpaceRLocked()
+	e.sendBufferSizeInUseMu.Unlock()
+
+	// Let waiters know if we now have space in the send buffer.
+	if signal {
+		e.waiterQueue.Notify(waiter.WritableEvents)
+	}
+}
+
 // WritePacket attempts to write the packet.
 func (c *WriteContext) WritePacket(pkt stack.PacketBufferPtr, headerIncluded bool) tcpip.Error {
 	c.e.mu.RLock()
@@ -583,8 +633,15 @@ func (e *Endpoint) connectRouteRLocked(nicID tcpip.NICID, localAddr tcpip.Addres
 		}
 	}
 
-	// Find a route to the desired destination.
-	r, err := e.stack.FindRoute(nicID, localAddr, addr.Addr, netProto, e.ops.GetMulticastLoop())
+	// Find a route to the desired destination. Endpoints with IP_TRANSPARENT
+	// set may send from addresses that are not assigned to the stack.
+	var r *stack.Route
+	var err tcpip.Error
+	if e.ops.GetTransparent() {
+		r, err = e.stack.FindTransparentRoute(nicID, localAddr, addr.Addr, netProto, e.ops.GetMulticastLoop())
+	} else {
+		r, err = e.stack.FindRoute(nicID, localAddr, addr.Addr, netProto, e.ops.GetMulticastLoop())
+	}
 	if err != nil {
 		return nil, 0, err
 	}
@@ -729,7 +786,12 @@ func (e *Endpoint) BindAndThen(addr tcpip.FullAddress, f func(tcpip.NetworkProto
 	if addr.Addr.BitLen() != 0 && !e.isBroadcastOrMulticast(addr.NIC, netProto, addr.Addr) {
 		nicID = e.stack.CheckLocalAddress(nicID, netProto, addr.Addr)
 		if nicID == 0 {
-			return &tcpip.ErrBadLocalAddress{}
+			// IP_FREEBIND and IP_TRANSPARENT permit binding to addresses that
+			// are not assigned to the stack.
+			if !e.ops.GetFreeBind() && !e.ops.GetTransparent() {
+				return &tcpip.ErrBadLocalAddress{}
+			}
+			nicID = addr.NIC
 		}
 	}
 
@@ -79,6 +79,11 @@ type endpoint struct {
 	rcvClosed bool
 	// +checklocks:rcvMu
 	rcvDisabled bool
+	// filter, if set, is applied to received packets before they are
+	// queued.
+	//
+	// +checklocks:rcvMu
+	filter tcpip.PacketFilter
 
 	mu sync.RWMutex `state:"nosave"`
 	// +checklocks:mu
@@ -359,12 +364,19 @@ func (ep *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 	return result
 }
 
-// SetSockOpt implements tcpip.Endpoint.SetSockOpt. Packet sockets cannot be
-// used with SetSockOpt, and this function always returns
-// *tcpip.ErrNotSupported.
+// SetSockOpt implements tcpip.Endpoint.SetSockOpt.
 func (ep *endpoint) SetSockOpt(opt tcpip.SettableSocketOption) tcpip.Error {
-	switch opt.(type) {
+	switch v := opt.(type) {
+	case *tcpip.SocketAttachFilterOption:
+		ep.rcvMu.Lock()
+		ep.filter = v.Filter
+		ep.rcvMu.Unlock()
+		return nil
+
 	case *tcpip.SocketDetachFilterOption:
+		ep.rcvMu.Lock()
+		ep.filter = nil
+		ep.rcvMu.Unlock()
 		return nil
 
 	default:
@@ -428,9 +440,32 @@ func (ep *endpoint) HandlePacket(nicID tcpip.NICID, netProto tcpip.NetworkProtoc
 		return
 	}
 
+	// Raw packet endpoints include link-headers in received packets.
+	pktBuf := pkt.ToBuffer()
+	if ep.cooked {
+		// Cooked packet endpoints don't include the link-headers in received
+		// packets.
+		pktBuf.TrimFront(int64(len(pkt.LinkHeader().Slice()) + len(pkt.VirtioNetHeader().Slice())))
+	}
+
+	// As on Linux, the filter sees the packet as it would be delivered and
+	// packets that it rejects are neither queued nor counted as dropped.
+	if ep.filter != nil {
+		n := ep.filter.Filter(pktBuf.Flatten())
+		if n == 0 {
+			ep.rcvMu.Unlock()
+			pktBuf.Release()
+			return
+		}
+		if int64(n) < pktBuf.Size() {
+			pktBuf.Truncate(int64(n))
+		}
+	}
+
 	rcvBufSize := ep.ops.GetReceiveBufferSize()
 	if ep.rcvDisabled || ep.rcvBufSize >= int(rcvBufSize) {
 		ep.rcvMu.Unlock()
+		pktBuf.Release()
 		ep.stack.Stats().DroppedPackets.Increment()
 		ep.stats.ReceiveErrors.ReceiveBufferOverflow.Increment()
 		return
@@ -454,13 +489,6 @@ func (ep *endpoint) HandlePacket(nicID tcpip.NICID, netProto tcpip.NetworkProtoc
 		rcvdPkt.senderAddr.LinkAddr = hdr.SourceAddress()
 	}
 
-	// Raw packet endpoints include link-headers in received packets.
-	pktBuf := pkt.ToBuffer()
-	if ep.cooked {
-		// Cooked packet endpoints don't include the link-headers in received
-		// packets.
-		pktBuf.TrimFront(int64(len(pkt.LinkHeader().Slice()) + len(pkt.VirtioNetHeader().Slice())))
-	}
 	rcvdPkt.data = stack.NewPacketBuffer(stack.PacketBufferOptions{Payload: pktBuf})
 
 	ep.rcvList.PushBack(&rcvdPkt)
@@ -19,11 +19,13 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/buffer"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/faketime"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
 	"gvisor.dev/gvisor/pkg/tcpip/link/ethernet"
+	"gvisor.dev/gvisor/pkg/tcpip/link/packetsocket"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/raw"
 	"gvisor.dev/gvisor/pkg/waiter"
@@ -112,3 +114,100 @@ func TestWriteRaw(t *testing.T) {
 		})
 	}
 }
+
+// truncatingFilter drops packets shorter than min and truncates the rest to
+// snaplen bytes.
+type truncatingFilter struct {
+	min     int
+	snaplen uint32
+}
+
+// Filter implements tcpip.PacketFilter.Filter.
+func (f *truncatingFilter) Filter(pkt []byte) uint32 {
+	if len(pkt) < f.min {
+		return 0
+	}
+	return f.snaplen
+}
+
+func TestAttachFilter(t *testing.T) {
+	const (
+		nicID    = 1
+		netProto = 0x1234
+	)
+
+	s := stack.New(stack.Options{
+		RawFactory: &raw.EndpointFactory{},
+		Clock:      &faketime.NullClock{},
+	})
+	defer s.Destroy()
+
+	chEP := channel.New(1, header.IPv6MinimumMTU, "")
+	if err := s.CreateNIC(nicID, packetsocket.New(chEP)); err != nil {
+		t.Fatalf("CreateNIC(%d, _) failed: %s", nicID, err)
+	}
+
+	var wq waiter.Queue
+	ep, err := s.NewPacketEndpoint(true /* cooked */, header.EthernetProtocolAll, &wq)
+	if err != nil {
+		t.Fatalf("s.NewPacketEndpoint(true, %d, _): %s", header.EthernetProtocolAll, err)
+	}
+	defer ep.Close()
+
+	inject := func(size int) {
+		t.Helper()
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Payload: buffer.MakeWithData(data),
+		})
+		defer pkt.DecRef()
+		chEP.InjectInbound(netProto, pkt)
+	}
+	read := func() []byte {
+		t.Helper()
+		var buf bytes.Buffer
+		if _, err := ep.Read(&buf, tcpip.ReadOptions{}); err != nil {
+			if _, ok := err.(*tcpip.ErrWouldBlock); ok {
+				return nil
+			}
+			t.Fatalf("ep.Read(_, {}): %s", err)
+		}
+		return buf.Bytes()
+	}
+
+	filter := tcpip.SocketAttachFilterOption{Filter: &truncatingFilter{min: 10, snaplen: 16}}
+	if err := ep.SetSockOpt(&filter); err != nil {
+		t.Fatalf("ep.SetSockOpt(%#v): %s", filter, err)
+	}
+
+	// Packets rejected by the filter are neither received nor dropped.
+	inject(5)
+	if got := read(); got != nil {
+		t.Errorf("got read() = %x, want nothing", got)
+	}
+	if got := ep.Stats().(*tcpip.TransportEndpointStats).ReceiveErrors.ReceiveBufferOverflow.Value(); got != 0 {
+		t.Errorf("got ReceiveBufferOverflow = %d, want 0", got)
+	}
+
+	// Packets accepted by the filter are truncated to its return value.
+	inject(12)
+	if got, want := len(read()), 12; got != want {
+		t.Errorf("got len(read()) = %d, want %d", got, want)
+	}
+	inject(32)
+	if got, want := len(read()), 16; got != want {
+		t.Errorf("got len(read()) = %d, want %d", got, want)
+	}
+
+	var detach tcpip.SocketDetachFilterOption
+	if err := ep.SetSockOpt(&detach); err != nil {
+		t.Fatalf("ep.SetSockOpt(%#v): %s", detach, err)
+	}
+	inject(5)
+	if got, want := len(read()), 5; got != want {
+		t.Errorf("got len(read()) after detaching the filter = %d, want %d", got, want)
+	}
+}
@@ -190,7 +190,11 @@ func (l *listenContext) createConnectingEndpoint(s *segment, rcvdSynOpts header.
 		netProto = s.pkt.NetworkProtocolNumber
 	}
 
-	route, err := l.stack.FindRoute(s.pkt.NICID, s.pkt.Network().DestinationAddress(), s.pkt.Network().SourceAddress(), s.pkt.NetworkProtocolNumber, false /* multicastLoop */)
+	// Connections accepted by a transparent listener may have been diverted
+	// to it by a TPROXY target, so their local address need not be assigned to
+	// the stack.
+	transparent := l.listenEP != nil && l.listenEP.ops.GetTransparent()
+	route, err := findRoute(l.stack, transparent, s.pkt.NICID, s.pkt.Network().DestinationAddress(), s.pkt.Network().SourceAddress(), s.pkt.NetworkProtocolNumber)
 	if err != nil {
 		return nil, err // +checklocksignore
 	}
@@ -198,6 +202,7 @@ func (l *listenContext) createConnectingEndpoint(s *segment, rcvdSynOpts header.
 	n = newEndpoint(l.stack, l.protocol, netProto, queue)
 	n.mu.Lock()
 	n.ops.SetV6Only(l.v6Only)
+	n.ops.SetTransparent(transparent)
 	n.TransportEndpointInfo.ID = s.id
 	n.boundNICID = s.pkt.NICID
 	n.route = route
@@ -499,7 +504,7 @@ func (e *endpoint) handleListenSegment(ctx *listenContext, s *segment) tcpip.Err
 		}
 
 		net := s.pkt.Network()
-		route, err := e.stack.FindRoute(s.pkt.NICID, net.DestinationAddress(), net.SourceAddress(), s.pkt.NetworkProtocolNumber, false /* multicastLoop */)
+		route, err := findRoute(e.stack, e.ops.GetTransparent(), s.pkt.NICID, net.DestinationAddress(), net.SourceAddress(), s.pkt.NetworkProtocolNumber)
 		if err != nil {
 			return err
 		}
@@ -1377,6 +1377,18 @@ func (e *endpoint) disableKeepaliveTimer() {
 	e.keepalive.Unlock()
 }
 
+// notifyLingerDone wakes up a close() that is lingering for our FIN to be
+// acknowledged. It must be called after the endpoint leaves FIN-WAIT-1 or
+// CLOSING; nobody other than a lingering close() waits on an endpoint that
+// has already been closed, so this is a no-op otherwise.
+//
+// +checklocks:e.mu
+func (e *endpoint) notifyLingerDone() {
+	if e.closed {
+		e.waiterQueue.Notify(waiter.EventHUp)
+	}
+}
+
 // finWait2TimerExpired is called when the FIN-WAIT-2 timeout is hit
 // and the peer hasn't sent us a FIN.
 func (e *endpoint) finWait2TimerExpired() {
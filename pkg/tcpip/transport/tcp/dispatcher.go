@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"math/rand"
 
+	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/sleep"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
@@ -81,6 +82,10 @@ type processor struct {
 	pauseWaker       sleep.Waker
 	pauseChan        chan struct{}
 	resumeChan       chan struct{}
+
+	// processed is the number of endpoints taken off epQ, used to detect
+	// stalled processors.
+	processed atomicbitops.Uint64
 }
 
 func (p *processor) close() {
@@ -302,6 +307,7 @@ func (p *processor) start(wg *sync.WaitGroup) {
 				if ep == nil {
 					break
 				}
+				p.processed.Add(1)
 				if ep.segmentQueue.empty() {
 					continue
 				}
@@ -392,6 +398,40 @@ func (d *dispatcher) init(rng *rand.Rand, nProcessors int) {
 	}
 }
 
+// ProcessorState is a snapshot of the queue of a TCP processor goroutine.
+type ProcessorState struct {
+	// Pending is true if endpoints are waiting to be processed.
+	Pending bool
+
+	// Processed is the number of endpoints taken off the queue so far.
+	Processed uint64
+}
+
+// processorStates returns the state of d's processors.
+func (d *dispatcher) processorStates() []ProcessorState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	states := make([]ProcessorState, len(d.processors))
+	for i := range d.processors {
+		p := &d.processors[i]
+		states[i] = ProcessorState{
+			Pending:   !p.epQ.empty(),
+			Processed: p.processed.Load(),
+		}
+	}
+	return states
+}
+
+// ProcessorStates returns the state of the processor goroutines that handle
+// inbound TCP segments in s, or nil if s doesn't support TCP.
+func ProcessorStates(s *stack.Stack) []ProcessorState {
+	p, ok := s.TransportProtocolInstance(ProtocolNumber).(*protocol)
+	if !ok {
+		return nil
+	}
+	return p.dispatcher.processorStates()
+}
+
 // close closes a dispatcher and its processors.
 func (d *dispatcher) close() {
 	d.mu.Lock()
@@ -0,0 +1,46 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"runtime"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+func TestProcessorStates(t *testing.T) {
+	s := stack.New(stack.Options{
+		TransportProtocols: []stack.TransportProtocolFactory{NewProtocol},
+	})
+	defer func() {
+		s.Close()
+		s.Wait()
+	}()
+
+	states := ProcessorStates(s)
+	if got, want := len(states), runtime.GOMAXPROCS(0); got != want {
+		t.Fatalf("got %d processors, want %d", got, want)
+	}
+	for i, st := range states {
+		if st.Pending || st.Processed != 0 {
+			t.Errorf("processor %d: got %+v, want idle processor", i, st)
+		}
+	}
+
+	if states := ProcessorStates(stack.New(stack.Options{})); states != nil {
+		t.Errorf("ProcessorStates() without TCP = %v, want nil", states)
+	}
+}
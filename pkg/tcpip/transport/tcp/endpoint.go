@@ -982,12 +982,13 @@ func (e *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 	return result
 }
 
-// Purging pending rcv segments is only necessary on RST.
+// purgePendingRcvQueue drops all out-of-order segments. Purging them is only
+// necessary on RST and when the endpoint is cleaned up.
 func (e *endpoint) purgePendingRcvQueue() {
 	if e.rcv != nil {
 		for e.rcv.pendingRcvdSegments.Len() > 0 {
 			s := heap.Pop(&e.rcv.pendingRcvdSegments).(*segment)
-			s.DecRef()
+			e.rcv.releasePending(s)
 		}
 	}
 }
@@ -1227,6 +1228,9 @@ func (e *endpoint) cleanupLocked() {
 	}
 
 	e.purgeWriteQueue()
+	// Out-of-order segments can't be delivered anymore, and count against
+	// the stack's out-of-order memory budget.
+	e.purgePendingRcvQueue()
 	// Only purge the read queue here if the socket is fully closed by the
 	// user.
 	if e.closed {
@@ -2416,7 +2420,7 @@ func (e *endpoint) connect(addr tcpip.FullAddress, handshake bool) tcpip.Error {
 	}
 
 	// Find a route to the desired destination.
-	r, err := e.stack.FindRoute(nicID, e.TransportEndpointInfo.ID.LocalAddress, addr.Addr, netProto, false /* multicastLoop */)
+	r, err := findRoute(e.stack, e.ops.GetTransparent(), nicID, e.TransportEndpointInfo.ID.LocalAddress, addr.Addr, netProto)
 	if err != nil {
 		return err
 	}
@@ -2737,11 +2741,14 @@ func (e *endpoint) bindLocked(addr tcpip.FullAddress) (err tcpip.Error) {
 
 	var nic tcpip.NICID
 	// If an address is specified, we must ensure that it's one of our
-	// local addresses.
+	// local addresses, unless IP_FREEBIND or IP_TRANSPARENT is set.
 	if addr.Addr.Len() != 0 {
 		nic = e.stack.CheckLocalAddress(addr.NIC, netProto, addr.Addr)
 		if nic == 0 {
-			return &tcpip.ErrBadLocalAddress{}
+			if !e.ops.GetFreeBind() && !e.ops.GetTransparent() {
+				return &tcpip.ErrBadLocalAddress{}
+			}
+			nic = addr.NIC
 		}
 		e.TransportEndpointInfo.ID.LocalAddress = addr.Addr
 	}
@@ -3307,3 +3314,13 @@ func (e *endpoint) computeTCPSendBufferSize() int64 {
 func (e *endpoint) GetAcceptConn() bool {
 	return EndpointState(e.State()) == StateListen
 }
+
+// findRoute is like stack.Stack.FindRoute, but permits localAddr to be an
+// address that is not assigned to the stack if transparent is set, as for
+// endpoints with IP_TRANSPARENT set.
+func findRoute(s *stack.Stack, transparent bool, nicID tcpip.NICID, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber) (*stack.Route, tcpip.Error) {
+	if transparent {
+		return s.FindTransparentRoute(nicID, localAddr, remoteAddr, netProto, false /* multicastLoop */)
+	}
+	return s.FindRoute(nicID, localAddr, remoteAddr, netProto, false /* multicastLoop */)
+}
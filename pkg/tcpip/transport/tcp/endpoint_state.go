@@ -130,6 +130,12 @@ func (e *endpoint) Resume(s *stack.Stack) {
 	}
 	e.stack = s
 	e.protocol = protocolFromStack(s)
+	if e.rcv != nil {
+		// Out-of-order segments restored with the endpoint count against the
+		// new stack's budget.
+		e.protocol.outOfOrderBytes.Add(int64(e.rcv.PendingBufUsed))
+		e.stack.Stats().TCP.CurrentOutOfOrderBytes.IncrementBy(uint64(e.rcv.PendingBufUsed))
+	}
 	e.ops.InitHandler(e, e.stack, GetTCPSendBufferLimits, GetTCPReceiveBufferLimits)
 	e.segmentQueue.thaw()
 
@@ -238,7 +244,7 @@ func (e *endpoint) Resume(s *stack.Stack) {
 		e.mu.Lock()
 		defer e.mu.Unlock()
 		e.setEndpointState(epState)
-		r, err := e.stack.FindRoute(e.boundNICID, e.TransportEndpointInfo.ID.LocalAddress, e.TransportEndpointInfo.ID.RemoteAddress, e.effectiveNetProtos[0], false /* multicastLoop */)
+		r, err := findRoute(e.stack, e.ops.GetTransparent(), e.boundNICID, e.TransportEndpointInfo.ID.LocalAddress, e.TransportEndpointInfo.ID.RemoteAddress, e.effectiveNetProtos[0])
 		if err != nil {
 			panic(fmt.Sprintf("FindRoute failed when restoring endpoint w/ ID: %+v", e.ID))
 		}
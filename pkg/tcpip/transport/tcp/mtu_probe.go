@@ -0,0 +1,271 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/seqnum"
+)
+
+const (
+	// mtuProbeRetries is the number of retransmission timeouts of a segment
+	// after which the path is assumed to be an ICMP blackhole. Linux
+	// default TCP_RETR1, net.ipv4.tcp_retries1.
+	mtuProbeRetries = 3
+
+	// mtuProbeMinCwnd is the smallest congestion window, in packets, with
+	// which a probe is sent, so that losing it is cheap. Same as Linux.
+	mtuProbeMinCwnd = 11
+)
+
+// mtuProbe holds the state of packetization layer path MTU discovery
+// (RFC 4821, RFC 8899) for a sender. It binary searches for the largest
+// payload size that reaches the peer by sending probe segments larger than
+// the current MSS, and reduces the MSS when retransmissions keep timing out
+// because large segments are silently dropped (an ICMP blackhole).
+//
+// Sizes are maximum payload sizes, like sender.MaxPayloadSize.
+//
+// +stateify savable
+type mtuProbe struct {
+	// mode, baseMSS, floor, threshold and interval are the stack-wide
+	// settings when the connection was established. See
+	// tcpip.TCPMTUProbingOption.
+	mode      tcpip.TCPMTUProbingMode
+	baseMSS   int
+	floor     int
+	threshold int
+	interval  time.Duration
+
+	// enabled is set if probing is in use on this connection.
+	enabled bool
+
+	// mssClamp is the largest payload size allowed by the peer's MSS and
+	// the route MTU.
+	mssClamp int
+
+	// searchLow is the largest payload size known to reach the peer.
+	searchLow int
+
+	// searchHigh is the largest payload size that may reach the peer.
+	searchHigh int
+
+	// probeSize is the payload size of the outstanding probe, or 0 if
+	// there is none.
+	probeSize int
+
+	// probeSeq is the sequence number of the outstanding probe.
+	probeSeq seqnum.Value
+
+	// searchStart is the time at which the current search started.
+	searchStart tcpip.MonotonicTime
+}
+
+// initMTUProbe initializes path MTU probing with the given settings, and
+// reduces the MSS to the base MSS if probing is always enabled.
+//
+// +checklocks:s.ep.mu
+func (s *sender) initMTUProbe(opts tcpip.TCPMTUProbingOption) {
+	p := &s.mtup
+	*p = mtuProbe{
+		mode:       opts.Mode,
+		baseMSS:    opts.BaseMSS - s.ep.maxOptionSize(),
+		floor:      opts.Floor,
+		threshold:  opts.Threshold,
+		interval:   opts.Interval,
+		mssClamp:   s.MaxPayloadSize,
+		searchHigh: s.MaxPayloadSize,
+	}
+	p.searchLow = min(max(p.baseMSS, 1), p.searchHigh)
+	if p.mode == tcpip.TCPMTUProbingAlways {
+		p.enabled = true
+		p.searchStart = s.ep.stack.Clock().NowMonotonic()
+		s.MaxPayloadSize = p.searchLow
+	}
+}
+
+// limit restricts the search for the path MTU to payloads of at
+// most m bytes, e.g. after receiving an ICMP packet too big.
+func (p *mtuProbe) limit(m int) {
+	p.mssClamp = min(p.mssClamp, m)
+	p.searchHigh = min(p.searchHigh, m)
+	p.searchLow = min(p.searchLow, m)
+	if p.probeSize > m {
+		p.probeSize = 0
+	}
+}
+
+// setMaxPayloadSize sets the maximum payload size to m, which unlike
+// updateMaxPayloadSize may increase it, and accounts for the new number of
+// packets in the segments that are in flight.
+//
+// +checklocks:s.ep.mu
+func (s *sender) setMaxPayloadSize(m int) {
+	oldMSS := s.MaxPayloadSize
+	if m == oldMSS {
+		return
+	}
+	s.MaxPayloadSize = m
+	if s.gso {
+		s.ep.gso.MSS = uint16(m)
+	}
+	s.ep.scoreboard.smss = uint16(m)
+
+	for seg := s.writeList.Front(); seg != nil && seg != s.writeNext; seg = seg.Next() {
+		delta := s.pCount(seg, m) - s.pCount(seg, oldMSS)
+		if s.ep.SACKPermitted && s.ep.scoreboard.IsSACKED(seg.sackBlock()) {
+			s.SackedOut += delta
+		} else {
+			s.Outstanding += delta
+		}
+	}
+	s.Outstanding = max(s.Outstanding, 0)
+}
+
+// mtuProbeBlackhole is called when retransmissions of a segment keep timing
+// out. As in Linux, it enables probing if it is enabled on blackhole
+// detection, and otherwise halves the MSS down to the probe floor.
+//
+// +checklocks:s.ep.mu
+func (s *sender) mtuProbeBlackhole() {
+	p := &s.mtup
+	if p.mode == tcpip.TCPMTUProbingDisabled {
+		return
+	}
+	if !p.enabled {
+		p.enabled = true
+		p.searchStart = s.ep.stack.Clock().NowMonotonic()
+	} else {
+		mss := min(p.searchLow/2, p.baseMSS)
+		p.searchLow = min(max(mss, p.floor, 1), p.searchHigh)
+	}
+	s.ep.stack.Stats().TCP.MTUBlackholes.Increment()
+	p.probeSize = 0
+	s.setMaxPayloadSize(min(s.MaxPayloadSize, p.searchLow))
+}
+
+// mtuProbeLost is called when the first unacknowledged segment is deemed
+// lost. If it is the outstanding probe, its size is assumed to exceed the
+// path MTU.
+//
+// +checklocks:s.ep.mu
+func (s *sender) mtuProbeLost() {
+	p := &s.mtup
+	if p.probeSize == 0 {
+		return
+	}
+	if s.SndUna == p.probeSeq {
+		p.searchHigh = p.probeSize - 1
+		s.ep.stack.Stats().TCP.MTUProbeFailures.Increment()
+	}
+	// Otherwise an earlier segment was lost and the fate of the probe is
+	// unknown. Either way, retry later.
+	p.probeSize = 0
+}
+
+// mtuProbeAcked is called after processing an acknowledgement. If the
+// outstanding probe was acknowledged, the MSS is increased to its size.
+//
+// +checklocks:s.ep.mu
+func (s *sender) mtuProbeAcked() {
+	p := &s.mtup
+	if p.probeSize == 0 || s.SndUna.LessThan(p.probeSeq.Add(seqnum.Size(p.probeSize))) {
+		return
+	}
+	size := p.probeSize
+	p.probeSize = 0
+	p.searchLow = size
+	// Keep the congestion window constant in bytes, as Linux does.
+	s.SndCwnd = max(s.SndCwnd*s.MaxPayloadSize/size, 1)
+	s.setMaxPayloadSize(size)
+}
+
+// maybeSendMTUProbe sends the next unsent data as a probe larger than the
+// current MSS, if a search for the path MTU is ongoing and the connection
+// is in a state to do so. It returns true if a probe was sent.
+//
+// +checklocks:s.ep.mu
+func (s *sender) maybeSendMTUProbe(end seqnum.Value) bool {
+	p := &s.mtup
+	if !p.enabled || p.probeSize != 0 || s.state != tcpip.Open || s.zeroWindowProbing {
+		return false
+	}
+
+	now := s.ep.stack.Clock().NowMonotonic()
+	if p.searchHigh-p.searchLow < p.threshold {
+		// The search is complete. Restart it after the probe interval in
+		// case the path MTU increased.
+		if now.Sub(p.searchStart) < p.interval {
+			return false
+		}
+		p.searchHigh = p.mssClamp
+		p.searchLow = s.MaxPayloadSize
+		p.searchStart = now
+		if p.searchHigh-p.searchLow < p.threshold {
+			return false
+		}
+	}
+	size := (p.searchLow + p.searchHigh + 1) / 2
+	if size <= s.MaxPayloadSize {
+		return false
+	}
+
+	// Only probe when losing the probe is cheap and it does not need to
+	// wait for the congestion or receive window.
+	if s.SndCwnd < mtuProbeMinCwnd || s.Outstanding+2 > s.SndCwnd || end.LessThan(s.SndNxt.Add(seqnum.Size(size))) {
+		return false
+	}
+	seg := s.writeNext
+	if seg == nil || s.isAssignedSequenceNumber(seg) {
+		return false
+	}
+	queued := 0
+	for n := seg; n != nil && n.payloadSize() != 0 && queued < size; n = n.Next() {
+		queued += n.payloadSize()
+	}
+	if queued < size {
+		return false
+	}
+
+	for seg.payloadSize() < size {
+		nSeg := seg.Next()
+		seg.merge(nSeg)
+		s.writeList.Remove(nSeg)
+		nSeg.DecRef()
+	}
+	seg.sequenceNumber = s.SndNxt
+	seg.flags = header.TCPFlagAck | header.TCPFlagPsh
+	s.splitSeg(seg, size)
+
+	if s.gso {
+		// Don't let segmentation offload split the probe.
+		s.ep.gso.MSS = uint16(size)
+	}
+	s.sendSegment(seg)
+	if s.gso {
+		s.ep.gso.MSS = uint16(s.MaxPayloadSize)
+	}
+
+	p.probeSize = size
+	p.probeSeq = seg.sequenceNumber
+	s.SndNxt = seg.sequenceNumber.Add(seqnum.Size(size))
+	s.Outstanding += s.pCount(seg, s.MaxPayloadSize)
+	s.updateWriteNext(seg.Next())
+	s.ep.stack.Stats().TCP.MTUProbes.Increment()
+	return true
+}
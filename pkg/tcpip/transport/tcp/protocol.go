@@ -23,6 +23,7 @@ import (
 	"strings"
 	"time"
 
+	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
@@ -79,6 +80,29 @@ const (
 	// DefaultKeepaliveCount is the number of keep-alive probes that are sent
 	// before declaring the connection dead.
 	DefaultKeepaliveCount = 9
+
+	// DefaultBaseMSS is the default MSS that path MTU probing starts
+	// searching from. Linux default TCP_BASE_MSS, net.ipv4.tcp_base_mss.
+	DefaultBaseMSS = 1024
+
+	// DefaultMTUProbeFloor is the default smallest MSS that blackhole
+	// detection reduces the MSS to. Linux default TCP_MIN_SND_MSS,
+	// net.ipv4.tcp_mtu_probe_floor.
+	DefaultMTUProbeFloor = 48
+
+	// DefaultMTUProbeThreshold is the default size of the MSS search range
+	// below which path MTU probing stops. Linux default
+	// TCP_PROBE_THRESHOLD, net.ipv4.tcp_probe_threshold.
+	DefaultMTUProbeThreshold = 8
+
+	// DefaultMTUProbeInterval is the default time after which path MTU
+	// probing restarts its search. Linux default TCP_PROBE_INTERVAL,
+	// net.ipv4.tcp_probe_interval.
+	DefaultMTUProbeInterval = 600 * time.Second
+
+	// DefaultOutOfOrderMemory is the default number of bytes that the
+	// out-of-order segments of all endpoints of a stack may use together.
+	DefaultOutOfOrderMemory = 64 << 20 // 64MB
 )
 
 const (
@@ -106,8 +130,14 @@ type protocol struct {
 	maxRTO                     time.Duration
 	maxRetries                 uint32
 	synRetries                 uint8
+	mtuProbing                 tcpip.TCPMTUProbingOption
+	outOfOrderMemory           tcpip.TCPOutOfOrderMemoryOption
 	dispatcher                 dispatcher
 
+	// outOfOrderBytes is the number of bytes held by the out-of-order
+	// segments of all endpoints. It is limited by outOfOrderMemory.Max.
+	outOfOrderBytes atomicbitops.Int64
+
 	// The following secrets are initialized once and stay unchanged after.
 	seqnumSecret   [16]byte
 	tsOffsetSecret [16]byte
@@ -371,6 +401,24 @@ func (p *protocol) SetOption(option tcpip.SettableTransportProtocolOption) tcpip
 		p.mu.Unlock()
 		return nil
 
+	case *tcpip.TCPMTUProbingOption:
+		if v.Mode < tcpip.TCPMTUProbingDisabled || v.Mode > tcpip.TCPMTUProbingAlways || v.BaseMSS <= 0 || v.Floor <= 0 || v.Threshold < 0 || v.Interval < 0 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		p.mu.Lock()
+		p.mtuProbing = *v
+		p.mu.Unlock()
+		return nil
+
+	case *tcpip.TCPOutOfOrderMemoryOption:
+		if v.Max < 0 || v.PerEndpoint < 0 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		p.mu.Lock()
+		p.outOfOrderMemory = *v
+		p.mu.Unlock()
+		return nil
+
 	default:
 		return &tcpip.ErrUnknownProtocolOption{}
 	}
@@ -475,6 +523,18 @@ func (p *protocol) Option(option tcpip.GettableTransportProtocolOption) tcpip.Er
 		p.mu.RUnlock()
 		return nil
 
+	case *tcpip.TCPMTUProbingOption:
+		p.mu.RLock()
+		*v = p.mtuProbing
+		p.mu.RUnlock()
+		return nil
+
+	case *tcpip.TCPOutOfOrderMemoryOption:
+		p.mu.RLock()
+		*v = p.outOfOrderMemory
+		p.mu.RUnlock()
+		return nil
+
 	default:
 		return &tcpip.ErrUnknownProtocolOption{}
 	}
@@ -528,6 +588,16 @@ func NewProtocol(s *stack.Stack) stack.TransportProtocol {
 			Default: DefaultReceiveBufferSize,
 			Max:     MaxBufferSize,
 		},
+		mtuProbing: tcpip.TCPMTUProbingOption{
+			Mode:      tcpip.TCPMTUProbingDisabled,
+			BaseMSS:   DefaultBaseMSS,
+			Floor:     DefaultMTUProbeFloor,
+			Threshold: DefaultMTUProbeThreshold,
+			Interval:  DefaultMTUProbeInterval,
+		},
+		outOfOrderMemory: tcpip.TCPOutOfOrderMemoryOption{
+			Max: DefaultOutOfOrderMemory,
+		},
 		congestionControl:          ccReno,
 		availableCongestionControl: []string{ccReno, ccCubic},
 		moderateReceiveBuffer:      true,
@@ -17,6 +17,7 @@ package tcp
 import (
 	"container/heap"
 	"math"
+	"sort"
 
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
@@ -268,6 +269,7 @@ func (r *receiver) consumeSegment(s *segment, segSeq seqnum.Value, segLen seqnum
 			if s.flags.Contains(header.TCPFlagAck) && s.ackNumber == r.ep.snd.SndNxt {
 				// FIN-ACK, transition to TIME-WAIT.
 				r.ep.setEndpointState(StateTimeWait)
+				r.ep.notifyLingerDone()
 			} else {
 				// Simultaneous close, expecting a final ACK.
 				r.ep.setEndpointState(StateClosing)
@@ -285,8 +287,7 @@ func (r *receiver) consumeSegment(s *segment, segSeq seqnum.Value, segLen seqnum
 		}
 
 		for i := first; i < len(r.pendingRcvdSegments); i++ {
-			r.PendingBufUsed -= r.pendingRcvdSegments[i].segMemSize()
-			r.pendingRcvdSegments[i].DecRef()
+			r.releasePending(r.pendingRcvdSegments[i])
 			// Note that slice truncation does not allow garbage
 			// collection of truncated items, thus truncated items
 			// must be set to nil to avoid memory leaks.
@@ -309,9 +310,11 @@ func (r *receiver) consumeSegment(s *segment, segSeq seqnum.Value, segLen seqnum
 				// FIN-WAIT-2 so start the FIN-WAIT-2 timer.
 				e.finWait2Timer = e.stack.Clock().AfterFunc(e.tcpLingerTimeout, e.finWait2TimerExpired)
 			}
+			r.ep.notifyLingerDone()
 
 		case StateClosing:
 			r.ep.setEndpointState(StateTimeWait)
+			r.ep.notifyLingerDone()
 		case StateLastAck:
 			r.ep.transitionToStateCloseLocked()
 		}
@@ -500,12 +503,11 @@ func (r *receiver) handleRcvdSegment(s *segment) (drop bool, err tcpip.Error) {
 			// An ideal solution is to ensure that there are at
 			// least N bytes free when N bytes are missing, but we
 			// don't have that computed at this point in the stack.
-			if rcvBufSize := r.ep.ops.GetReceiveBufferSize(); rcvBufSize > 0 && (r.PendingBufUsed+int(segLen)) < int(rcvBufSize-rcvBufSize/4) {
-				r.ep.rcvQueueMu.Lock()
-				r.PendingBufUsed += s.segMemSize()
-				r.ep.rcvQueueMu.Unlock()
-				s.IncRef()
-				heap.Push(&r.pendingRcvdSegments, s)
+			//
+			// The stack-wide out-of-order memory budget and the
+			// per-endpoint one, if set, apply on top of that.
+			if r.makeOutOfOrderRoom(s, segSeq, segLen) {
+				r.pushPending(s)
 				UpdateSACKBlocks(&r.ep.sack, segSeq, segSeq.Add(segLen), r.RcvNxt)
 			}
 
@@ -537,14 +539,116 @@ func (r *receiver) handleRcvdSegment(s *segment) (drop bool, err tcpip.Error) {
 		}
 
 		heap.Pop(&r.pendingRcvdSegments)
-		r.ep.rcvQueueMu.Lock()
-		r.PendingBufUsed -= s.segMemSize()
-		r.ep.rcvQueueMu.Unlock()
-		s.DecRef()
+		r.releasePending(s)
 	}
 	return false, nil
 }
 
+// pushPending queues s, which arrived out of order, in pendingRcvdSegments.
+// +checklocks:r.ep.mu
+func (r *receiver) pushPending(s *segment) {
+	size := s.segMemSize()
+	r.ep.rcvQueueMu.Lock()
+	r.PendingBufUsed += size
+	r.ep.rcvQueueMu.Unlock()
+	r.ep.protocol.outOfOrderBytes.Add(int64(size))
+	stats := r.ep.stack.Stats().TCP
+	stats.CurrentOutOfOrderBytes.IncrementBy(uint64(size))
+	stats.OutOfOrderQueued.Increment()
+	s.IncRef()
+	heap.Push(&r.pendingRcvdSegments, s)
+}
+
+// releasePending releases the memory of s, which the caller removed from
+// pendingRcvdSegments.
+func (r *receiver) releasePending(s *segment) {
+	size := s.segMemSize()
+	r.ep.rcvQueueMu.Lock()
+	r.PendingBufUsed -= size
+	r.ep.rcvQueueMu.Unlock()
+	r.ep.protocol.outOfOrderBytes.Add(-int64(size))
+	r.ep.stack.Stats().TCP.CurrentOutOfOrderBytes.DecrementBy(uint64(size))
+	s.DecRef()
+}
+
+// makeOutOfOrderRoom returns whether s, which arrived out of order, fits in
+// the endpoint's and the stack's out-of-order memory budgets. If it doesn't,
+// queued segments further from RcvNxt than s are dropped to make room for it,
+// since s will be needed first. Like Linux's tcp_prune_ofo_queue(), it frees
+// at least 1/8 of the receive buffer when it prunes, so that a stream of
+// out-of-order segments doesn't prune on every segment.
+//
+// An endpoint only prunes its own segments. If other endpoints use up the
+// stack-wide budget, s is dropped even if the endpoint holds no out-of-order
+// segments; such drops are also counted in OutOfOrderDroppedStackBudget.
+// +checklocks:r.ep.mu
+func (r *receiver) makeOutOfOrderRoom(s *segment, segSeq seqnum.Value, segLen seqnum.Size) bool {
+	rcvBufSize := r.ep.ops.GetReceiveBufferSize()
+	if rcvBufSize <= 0 {
+		return false
+	}
+	var opt tcpip.TCPOutOfOrderMemoryOption
+	r.ep.protocol.mu.RLock()
+	opt = r.ep.protocol.outOfOrderMemory
+	r.ep.protocol.mu.RUnlock()
+
+	limit := int(rcvBufSize - rcvBufSize/4)
+	if opt.PerEndpoint > 0 {
+		limit = min(limit, opt.PerEndpoint)
+	}
+	size := s.segMemSize()
+	fits := func() bool {
+		if r.PendingBufUsed+int(segLen) >= limit {
+			return false
+		}
+		return opt.Max == 0 || r.ep.protocol.outOfOrderBytes.Load()+int64(size) <= int64(opt.Max)
+	}
+	if fits() {
+		return true
+	}
+
+	stats := r.ep.stack.Stats().TCP
+	goal := int(rcvBufSize >> 3)
+	pruned := false
+	// Sort the queued segments once so that the ones furthest from RcvNxt
+	// can be dropped from the end. A sorted slice is still a valid heap, and
+	// so is any prefix of it.
+	sort.Sort(&r.pendingRcvdSegments)
+	for n := r.pendingRcvdSegments.Len(); n > 0; n-- {
+		p := r.pendingRcvdSegments[n-1]
+		if !segSeq.LessThan(p.sequenceNumber) {
+			// All queued segments are needed before s.
+			break
+		}
+		// Note that slice truncation does not allow garbage collection of
+		// truncated items, thus truncated items must be set to nil to avoid
+		// memory leaks.
+		r.pendingRcvdSegments[n-1] = nil
+		r.pendingRcvdSegments = r.pendingRcvdSegments[:n-1]
+		goal -= p.segMemSize()
+		r.releasePending(p)
+		stats.OutOfOrderPruned.Increment()
+		pruned = true
+		if goal <= 0 && fits() {
+			break
+		}
+	}
+	if pruned {
+		// The SACK blocks may cover pruned data, which the peer must now
+		// retransmit. Like Linux, forget them; they are rebuilt as
+		// out-of-order segments are queued again.
+		r.ep.sack.NumBlocks = 0
+	}
+	if !fits() {
+		stats.OutOfOrderDropped.Increment()
+		if others := r.ep.protocol.outOfOrderBytes.Load() - int64(r.PendingBufUsed); opt.Max != 0 && others+int64(size) > int64(opt.Max) {
+			stats.OutOfOrderDroppedStackBudget.Increment()
+		}
+		return false
+	}
+	return true
+}
+
 // handleTimeWaitSegment handles inbound segments received when the endpoint
 // has entered the TIME_WAIT state.
 // +checklocks:r.ep.mu
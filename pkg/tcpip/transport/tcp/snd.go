@@ -109,6 +109,9 @@ type sender struct {
 	writeList   segmentList
 	resendTimer timer `state:"nosave"`
 
+	// mtup is the state of path MTU probing.
+	mtup mtuProbe
+
 	// rtt.TCPRTTState.SRTT and rtt.TCPRTTState.RTTVar are the "smoothed
 	// round-trip time", and "round-trip time variation", as defined in
 	// section 2 of RFC 6298.
@@ -211,6 +214,12 @@ func newSender(ep *endpoint, iss, irs seqnum.Value, sndWnd seqnum.Size, mss uint
 
 	s.ep.AssertLockHeld(ep)
 	s.updateMaxPayloadSize(int(ep.route.MTU()), 0)
+
+	var mtuProbing tcpip.TCPMTUProbingOption
+	if err := ep.stack.TransportProtocolOption(ProtocolNumber, &mtuProbing); err != nil {
+		panic(fmt.Sprintf("unable to get MTU probing settings from stack: %s", err))
+	}
+	s.initMTUProbe(mtuProbing)
 	// Initialize SACK Scoreboard after updating max payload size as we use
 	// the maxPayloadSize as the smss when determining if a segment is lost
 	// etc.
@@ -275,16 +284,19 @@ func (s *sender) updateMaxPayloadSize(mtu, count int) {
 
 	m -= s.ep.maxOptionSize()
 
-	// We don't adjust up for now.
-	if m >= s.MaxPayloadSize {
-		return
-	}
-
 	// Make sure we can transmit at least one byte.
 	if m <= 0 {
 		m = 1
 	}
 
+	// Path MTU probing must not search above the new MTU either.
+	s.mtup.limit(m)
+
+	// We don't adjust up for now.
+	if m >= s.MaxPayloadSize {
+		return
+	}
+
 	oldMSS := s.MaxPayloadSize
 	s.MaxPayloadSize = m
 	if s.gso {
@@ -550,6 +562,14 @@ func (s *sender) retransmitTimerExpired() tcpip.Error {
 	s.ep.scoreboard.Reset()
 	s.updateWriteNext(s.writeList.Front())
 
+	// RFC 4821 section 7.7: a lost probe indicates that it exceeds the path
+	// MTU. Segments whose retransmissions keep timing out may be dropped
+	// because they exceed it too, without any ICMP error reaching us.
+	s.mtuProbeLost()
+	if s.writeList.Front().xmitCount > mtuProbeRetries {
+		s.mtuProbeBlackhole()
+	}
+
 	// RFC 1122 4.2.2.17: Start sending zero window probes when we still see a
 	// zero receive window after retransmission interval and we have data to
 	// send.
@@ -967,7 +987,7 @@ func (s *sender) sendData() {
 		}
 	}
 
-	var dataSent bool
+	dataSent := s.maybeSendMTUProbe(end)
 	for seg := s.writeNext; seg != nil && s.Outstanding < s.SndCwnd; seg = seg.Next() {
 		cwndLimit := (s.SndCwnd - s.Outstanding) * s.MaxPayloadSize
 		if cwndLimit < limit {
@@ -1012,6 +1032,7 @@ func (s *sender) enterRecovery() {
 	s.FastRecovery.MaxCwnd = s.SndCwnd + s.Outstanding
 	s.FastRecovery.HighRxt = s.SndUna
 	s.FastRecovery.RescueRxt = s.SndUna
+	s.mtuProbeLost()
 
 	// Record retransmitTS if the sender is not in recovery as per:
 	// https://datatracker.ietf.org/doc/html/rfc3522#section-3.2 Step 2
@@ -1543,6 +1564,7 @@ func (s *sender) handleRcvdSegment(rcvdSeg *segment) {
 
 		// Clear SACK information for all acked data.
 		s.ep.scoreboard.Delete(s.SndUna)
+		s.mtuProbeAcked()
 
 		// Detect if the sender entered recovery spuriously.
 		if s.inRecovery() {
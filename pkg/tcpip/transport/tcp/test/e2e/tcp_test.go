@@ -2170,6 +2170,94 @@ func TestOutOfOrderFlood(t *testing.T) {
 	)
 }
 
+func TestOutOfOrderMemoryBudget(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	c.CreateConnected(context.TestInitialSequenceNumber, 30000, math.MaxUint16)
+
+	iss := seqnum.Value(context.TestInitialSequenceNumber).Add(1)
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	send := func(seq seqnum.Value, payload []byte, wantAck seqnum.Value) {
+		t.Helper()
+		c.SendPacket(payload, &context.Headers{
+			SrcPort: context.TestPort,
+			DstPort: c.Port,
+			Flags:   header.TCPFlagAck,
+			SeqNum:  seq,
+			AckNum:  c.IRS.Add(1),
+			RcvWnd:  30000,
+		})
+		v := c.GetPacket()
+		defer v.Release()
+		checker.IPv4(t, v, checker.TCP(
+			checker.DstPort(context.TestPort),
+			checker.TCPSeqNum(uint32(c.IRS)+1),
+			checker.TCPAckNum(uint32(wantAck)),
+			checker.TCPFlags(header.TCPFlagAck),
+		))
+	}
+
+	// Queue one out-of-order segment to learn how much memory it uses, then
+	// limit the stack to two such segments.
+	stats := c.Stack().Stats().TCP
+	send(iss.Add(1000), data, iss)
+	segMem := stats.CurrentOutOfOrderBytes.Value()
+	if segMem == 0 {
+		t.Fatalf("got CurrentOutOfOrderBytes = 0 after queueing an out-of-order segment")
+	}
+	opt := tcpip.TCPOutOfOrderMemoryOption{Max: int(segMem*2 + segMem/2)}
+	if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &opt); err != nil {
+		t.Fatalf("SetTransportProtocolOption(%d, &%#v): %s", tcp.ProtocolNumber, opt, err)
+	}
+	send(iss.Add(2000), data, iss)
+
+	// The budget is exhausted and all queued segments are needed before this
+	// one, so it is dropped.
+	send(iss.Add(3000), data, iss)
+	if got := stats.OutOfOrderDropped.Value(); got != 1 {
+		t.Errorf("got OutOfOrderDropped = %d, want = 1", got)
+	}
+	if got := stats.OutOfOrderDroppedStackBudget.Value(); got != 0 {
+		t.Errorf("got OutOfOrderDroppedStackBudget = %d, want = 0", got)
+	}
+
+	// This segment is needed before the queued ones, which are pruned to make
+	// room for it.
+	send(iss.Add(500), data, iss)
+	if got := stats.OutOfOrderPruned.Value(); got != 2 {
+		t.Errorf("got OutOfOrderPruned = %d, want = 2", got)
+	}
+	if got := stats.CurrentOutOfOrderBytes.Value(); got != segMem {
+		t.Errorf("got CurrentOutOfOrderBytes = %d, want = %d", got, segMem)
+	}
+
+	// Filling the gap delivers the segment that was kept, but not the pruned
+	// ones.
+	send(iss, make([]byte, 500), iss.Add(500+seqnum.Size(len(data))))
+	if got := stats.CurrentOutOfOrderBytes.Value(); got != 0 {
+		t.Errorf("got CurrentOutOfOrderBytes = %d, want = 0", got)
+	}
+	if got, want := stats.OutOfOrderQueued.Value(), uint64(3); got != want {
+		t.Errorf("got OutOfOrderQueued = %d, want = %d", got, want)
+	}
+
+	// A stack-wide budget that has no room for a segment even though the
+	// endpoint holds no out-of-order segments is counted separately.
+	opt.Max = int(segMem / 2)
+	if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &opt); err != nil {
+		t.Fatalf("SetTransportProtocolOption(%d, &%#v): %s", tcp.ProtocolNumber, opt, err)
+	}
+	rcvNxt := iss.Add(500 + seqnum.Size(len(data)))
+	send(rcvNxt.Add(1000), data, rcvNxt)
+	if got := stats.OutOfOrderDropped.Value(); got != 2 {
+		t.Errorf("got OutOfOrderDropped = %d, want = 2", got)
+	}
+	if got := stats.OutOfOrderDroppedStackBudget.Value(); got != 1 {
+		t.Errorf("got OutOfOrderDroppedStackBudget = %d, want = 1", got)
+	}
+}
+
 func TestRstOnCloseWithUnreadData(t *testing.T) {
 	c := context.New(t, e2e.DefaultMTU)
 	defer c.Cleanup()
@@ -5768,6 +5856,80 @@ func TestPathMTUDiscovery(t *testing.T) {
 	receivePackets(c, sizes, -1, uint32(c.IRS)+1)
 }
 
+func TestMTUProbingBlackhole(t *testing.T) {
+	// This test verifies that the stack reduces the MSS to the base MSS when
+	// retransmissions of a full sized segment keep timing out without any
+	// ICMP packet indicating that the path MTU has been exceeded.
+	c := context.New(t, 1500)
+	defer c.Cleanup()
+
+	const baseMSS = 1024
+	opt := tcpip.TCPMTUProbingOption{
+		Mode:      tcpip.TCPMTUProbingBlackhole,
+		BaseMSS:   baseMSS,
+		Floor:     tcp.DefaultMTUProbeFloor,
+		Threshold: tcp.DefaultMTUProbeThreshold,
+		Interval:  tcp.DefaultMTUProbeInterval,
+	}
+	if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &opt); err != nil {
+		t.Fatalf("SetTransportProtocolOption(%d, &%T(%+v)): %s", tcp.ProtocolNumber, opt, opt, err)
+	}
+	// The test context raises the minimum RTO above the maximum RTO set
+	// below, so lower it first.
+	minRTOOpt := tcpip.TCPMinRTOOption(time.Second)
+	if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &minRTOOpt); err != nil {
+		t.Fatalf("SetTransportProtocolOption(%d, &%T(%d)): %s", tcp.ProtocolNumber, minRTOOpt, minRTOOpt, err)
+	}
+	maxRTOOpt := tcpip.TCPMaxRTOOption(time.Second)
+	if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &maxRTOOpt); err != nil {
+		t.Fatalf("SetTransportProtocolOption(%d, &%T(%d)): %s", tcp.ProtocolNumber, maxRTOOpt, maxRTOOpt, err)
+	}
+
+	// Create new connection with MSS of 1460.
+	const maxPayload = 1500 - header.TCPMinimumSize - header.IPv4MinimumSize
+	c.CreateConnectedWithRawOptions(context.TestInitialSequenceNumber, 30000, -1 /* epRcvBuf */, []byte{
+		header.TCPOptionMSS, 4, byte(maxPayload / 256), byte(maxPayload % 256),
+	})
+
+	const writeSize = 1400
+	var r bytes.Reader
+	r.Reset(make([]byte, writeSize))
+	if _, err := c.EP.Write(&r, tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+
+	iss := seqnum.Value(context.TestInitialSequenceNumber).Add(1)
+	seqNum := uint32(c.IRS) + 1
+	receivePacket := func(size int, seqNum uint32) {
+		t.Helper()
+		v := c.GetPacket()
+		defer v.Release()
+		checker.IPv4(t, v,
+			checker.PayloadLen(size+header.TCPMinimumSize),
+			checker.TCP(
+				checker.DstPort(context.TestPort),
+				checker.TCPSeqNum(seqNum),
+				checker.TCPAckNum(uint32(iss)),
+			),
+		)
+	}
+
+	// Drop the first transmission and the retransmissions that are made
+	// before the path is assumed to be a blackhole.
+	for i := 0; i < 4; i++ {
+		receivePacket(writeSize, seqNum)
+	}
+
+	// The next retransmission is limited to the base MSS.
+	receivePacket(baseMSS, seqNum)
+	c.SendAck(iss, baseMSS)
+	receivePacket(writeSize-baseMSS, seqNum+baseMSS)
+
+	if got := c.Stack().Stats().TCP.MTUBlackholes.Value(); got != 1 {
+		t.Errorf("got stats.TCP.MTUBlackholes.Value() = %d, want = 1", got)
+	}
+}
+
 func TestTCPEndpointProbe(t *testing.T) {
 	c := context.New(t, 1500)
 	defer c.Cleanup()
@@ -17,6 +17,7 @@ package udp_test
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math"
@@ -2293,6 +2294,121 @@ func TestWritePayloadSizeTooBig(t *testing.T) {
 	}
 }
 
+// TestWriteBlocksWhenSendBufferFull verifies that writes fail with
+// ErrWouldBlock without consuming the payload while the send buffer is full,
+// and that the endpoint becomes writable again once in-flight packets are
+// released.
+func TestWriteBlocksWhenSendBufferFull(t *testing.T) {
+	c := context.New(t, []stack.TransportProtocolFactory{udp.NewProtocol, icmp.NewProtocol6, icmp.NewProtocol4})
+	defer c.Cleanup()
+
+	c.CreateEndpoint(ipv6.ProtocolNumber, udp.ProtocolNumber)
+
+	if err := c.EP.Connect(tcpip.FullAddress{Addr: context.TestV6Addr, Port: context.TestPort}); err != nil {
+		c.T.Fatalf("Connect failed: %s", err)
+	}
+
+	// Packets held by the link endpoint's queue are charged to the send
+	// buffer until they are read, so a single packet fills a 1-byte buffer.
+	c.EP.SocketOptions().SetSendBufferSize(1, false /* notify */)
+
+	payload := newRandomPayload(arbitraryPayloadSize)
+	var r bytes.Reader
+	r.Reset(payload)
+	if n, err := c.EP.Write(&r, tcpip.WriteOptions{}); err != nil || n != int64(len(payload)) {
+		t.Fatalf("got c.EP.Write(_, _) = (%d, %s), want = (%d, nil)", n, err, len(payload))
+	}
+	if got := c.EP.Readiness(waiter.WritableEvents); got != 0 {
+		t.Fatalf("got c.EP.Readiness(%#x) = %#x, want = 0", waiter.WritableEvents, got)
+	}
+
+	r.Reset(payload)
+	n, err := c.EP.Write(&r, tcpip.WriteOptions{})
+	if _, ok := err.(*tcpip.ErrWouldBlock); !ok || n != 0 {
+		t.Fatalf("got c.EP.Write(_, _) = (%d, %s), want = (0, %s)", n, err, &tcpip.ErrWouldBlock{})
+	}
+	if got := r.Len(); got != len(payload) {
+		t.Fatalf("got r.Len() = %d after blocked write, want = %d", got, len(payload))
+	}
+
+	we, ch := waiter.NewChannelEntry(waiter.WritableEvents)
+	c.WQ.EventRegister(&we)
+	defer c.WQ.EventUnregister(&we)
+
+	if got := c.LinkEP.Drain(); got != 1 {
+		t.Fatalf("got c.LinkEP.Drain() = %d, want = 1", got)
+	}
+	select {
+	case <-ch:
+	default:
+		t.Fatal("endpoint was not notified of writability after the send buffer was drained")
+	}
+
+	if n, err := c.EP.Write(&r, tcpip.WriteOptions{}); err != nil || n != int64(len(payload)) {
+		t.Fatalf("got c.EP.Write(_, _) = (%d, %s), want = (%d, nil)", n, err, len(payload))
+	}
+	p := c.LinkEP.Read()
+	if p.IsNil() {
+		t.Fatal("packet wasn't written out")
+	}
+	defer p.DecRef()
+	v := p.ToView()
+	defer v.Release()
+	if got := header.UDP(header.IPv6(v.AsSlice()).Payload()).Payload(); !bytes.Equal(got, payload) {
+		t.Fatalf("got payload = %x, want = %x", got, payload)
+	}
+}
+
+// faultingPayloader is a tcpip.Payloader whose reads fail, as copying from
+// unmapped application memory does.
+type faultingPayloader struct {
+	len int
+}
+
+// Read implements io.Reader.Read.
+func (faultingPayloader) Read([]byte) (int, error) {
+	return 0, errors.New("bad address")
+}
+
+// Len implements tcpip.Payloader.Len.
+func (p faultingPayloader) Len() int {
+	return p.len
+}
+
+// TestWriteReleasesSendBufferOnBadPayload verifies that the send buffer space
+// reserved by a write is released if its payload can't be read.
+func TestWriteReleasesSendBufferOnBadPayload(t *testing.T) {
+	c := context.New(t, []stack.TransportProtocolFactory{udp.NewProtocol, icmp.NewProtocol6, icmp.NewProtocol4})
+	defer c.Cleanup()
+
+	c.CreateEndpoint(ipv6.ProtocolNumber, udp.ProtocolNumber)
+
+	if err := c.EP.Connect(tcpip.FullAddress{Addr: context.TestV6Addr, Port: context.TestPort}); err != nil {
+		c.T.Fatalf("Connect failed: %s", err)
+	}
+
+	// A single reservation fills a 1-byte buffer.
+	c.EP.SocketOptions().SetSendBufferSize(1, false /* notify */)
+
+	n, err := c.EP.Write(faultingPayloader{len: arbitraryPayloadSize}, tcpip.WriteOptions{})
+	if _, ok := err.(*tcpip.ErrBadBuffer); !ok || n != 0 {
+		t.Fatalf("got c.EP.Write(_, _) = (%d, %s), want = (0, %s)", n, err, &tcpip.ErrBadBuffer{})
+	}
+	if got := c.EP.Readiness(waiter.WritableEvents); got != waiter.WritableEvents {
+		t.Fatalf("got c.EP.Readiness(%#x) = %#x after failed write, want = %#x", waiter.WritableEvents, got, waiter.WritableEvents)
+	}
+
+	payload := newRandomPayload(arbitraryPayloadSize)
+	var r bytes.Reader
+	r.Reset(payload)
+	if n, err := c.EP.Write(&r, tcpip.WriteOptions{}); err != nil || n != int64(len(payload)) {
+		t.Fatalf("got c.EP.Write(_, _) = (%d, %s), want = (%d, nil)", n, err, len(payload))
+	}
+	if got := c.LinkEP.Drain(); got != 1 {
+		t.Fatalf("got c.LinkEP.Drain() = %d, want = 1", got)
+	}
+}
+
 func TestMain(m *testing.M) {
 	refs.SetLeakMode(refs.LeaksPanic)
 	code := m.Run()
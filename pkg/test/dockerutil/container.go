@@ -55,6 +55,15 @@ type Container struct {
 	copyErr  error
 	cleanups []func()
 
+	// cgroupParent is the cgroup under which the container is created, if
+	// set. See SetCgroupParent.
+	cgroupParent string
+
+	// remote indicates that the container runs on a remote Docker daemon.
+	// Remote containers are never profiled, since profiling relies on
+	// invoking the runtime binary locally.
+	remote bool
+
 	// profile is the profiling hook associated with this container.
 	profile *profile
 }
@@ -68,6 +77,10 @@ type RunOpts struct {
 	// Memory is the memory limit in bytes.
 	Memory int
 
+	// ShmSize is the size of /dev/shm in bytes. If zero, the docker default
+	// is used.
+	ShmSize int64
+
 	// Cpus in which to allow execution. ("0", "1", "0-2").
 	CpusetCpus string
 
@@ -113,13 +126,26 @@ type RunOpts struct {
 	DeviceRequests []container.DeviceRequest
 
 	Devices []container.DeviceMapping
+
+	// Annotations are passed to the runtime in the OCI spec of the container.
+	Annotations map[string]string
 }
 
 func makeContainer(ctx context.Context, logger testutil.Logger, runtime string) *Container {
+	return makeContainerOnHost(ctx, logger, runtime, "")
+}
+
+// makeContainerOnHost makes a container using the Docker daemon at host. If
+// host is empty, the daemon is determined from the environment.
+func makeContainerOnHost(ctx context.Context, logger testutil.Logger, runtime, host string) *Container {
 	// Slashes are not allowed in container names.
 	name := testutil.RandomID(logger.Name())
 	name = strings.ReplaceAll(name, "/", "-")
-	client, err := client.NewClientWithOpts(client.FromEnv)
+	opts := []client.Opt{client.FromEnv}
+	if host != "" {
+		opts = append(opts, client.WithHost(host))
+	}
+	client, err := client.NewClientWithOpts(opts...)
 	if err != nil {
 		return nil
 	}
@@ -129,6 +155,7 @@ func makeContainer(ctx context.Context, logger testutil.Logger, runtime string)
 		Name:    name,
 		runtime: runtime,
 		client:  client,
+		remote:  host != "",
 	}
 }
 
@@ -160,6 +187,25 @@ func MakeNativeContainer(ctx context.Context, logger testutil.Logger) *Container
 	return makeContainer(ctx, logger, unsandboxedRuntime)
 }
 
+// MakeContainerOnHost is like MakeContainer, but the container is created by
+// the Docker daemon listening at host (e.g. "tcp://10.0.0.2:2375").
+//
+// The runtime is determined by the runtime flag, and must be installed on the
+// remote daemon under the same name. Remote containers aren't profiled.
+func MakeContainerOnHost(ctx context.Context, logger testutil.Logger, host string) *Container {
+	return makeContainerOnHost(ctx, logger, *runtime, host)
+}
+
+// MakeNativeContainerOnHost is like MakeNativeContainer, but the container is
+// created by the Docker daemon listening at host.
+func MakeNativeContainerOnHost(ctx context.Context, logger testutil.Logger, host string) *Container {
+	unsandboxedRuntime := "runc"
+	if override, found := os.LookupEnv("UNSANDBOXED_RUNTIME"); found {
+		unsandboxedRuntime = override
+	}
+	return makeContainerOnHost(ctx, logger, unsandboxedRuntime, host)
+}
+
 // Spawn is analogous to 'docker run -d'.
 func (c *Container) Spawn(ctx context.Context, r RunOpts, args ...string) error {
 	if err := c.create(ctx, r.Image, c.config(r, args), c.hostConfig(r), nil); err != nil {
@@ -239,7 +285,7 @@ func (c *Container) Create(ctx context.Context, r RunOpts, args ...string) error
 }
 
 func (c *Container) create(ctx context.Context, profileImage string, conf *container.Config, hostconf *container.HostConfig, netconf *network.NetworkingConfig) error {
-	if c.runtime != "" && c.runtime != "runc" {
+	if c.runtime != "" && c.runtime != "runc" && !c.remote {
 		// Use the image name as provided here; which normally represents the
 		// unmodified "basic/alpine" image name. This should be easy to grok.
 		c.profileInit(profileImage)
@@ -284,7 +330,10 @@ func (c *Container) hostConfig(r RunOpts) *container.HostConfig {
 		Privileged:      r.Privileged,
 		ReadonlyRootfs:  r.ReadOnly,
 		NetworkMode:     container.NetworkMode(r.NetworkMode),
+		ShmSize:         r.ShmSize,
+		Annotations:     r.Annotations,
 		Resources: container.Resources{
+			CgroupParent:   c.cgroupParent,
 			Memory:         int64(r.Memory), // In bytes.
 			CpusetCpus:     r.CpusetCpus,
 			DeviceRequests: r.DeviceRequests,
@@ -293,6 +342,14 @@ func (c *Container) hostConfig(r RunOpts) *container.HostConfig {
 	}
 }
 
+// SetCgroupParent sets the cgroup under which the container is created. The
+// format of parent depends on the Docker daemon's cgroup driver: a cgroup path
+// for cgroupfs, or a slice name (e.g. "foo.slice") for systemd. It must be
+// called before the container is created.
+func (c *Container) SetCgroupParent(parent string) {
+	c.cgroupParent = parent
+}
+
 // Start is analogous to 'docker start'.
 func (c *Container) Start(ctx context.Context) error {
 	if err := c.client.ContainerStart(ctx, c.id, types.ContainerStartOptions{}); err != nil {
@@ -539,12 +596,18 @@ func (c *Container) WaitForOutput(ctx context.Context, pattern string, timeout t
 // WaitForOutputSubmatch searches container logs for the given
 // pattern or times out. It returns any regexp submatches as well.
 func (c *Container) WaitForOutputSubmatch(ctx context.Context, pattern string, timeout time.Duration) ([]string, error) {
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 	re := regexp.MustCompile(pattern)
 	for {
-		logs, err := c.Logs(ctx)
+		logs, err := c.Logs(waitCtx)
 		if err != nil {
+			if waitCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+				// The logs fetched with the expired context are empty, so
+				// fetch them again to make the failure debuggable.
+				logs, _ = c.Logs(ctx)
+				return nil, fmt.Errorf("timed out after %v waiting for pattern %q, logs: %s", timeout, pattern, logs)
+			}
 			return nil, fmt.Errorf("failed to get logs: %v logs: %s", err, logs)
 		}
 		if matches := re.FindStringSubmatch(logs); matches != nil {
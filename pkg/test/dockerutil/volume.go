@@ -0,0 +1,140 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dockerutil
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/moby/moby/client"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+// cacheVolumeLabel marks volumes created by CacheVolume.
+const cacheVolumeLabel = "dev.gvisor.test.cache"
+
+// cachePopulatedFile is created in a cache volume once it has been populated.
+// Volume labels can't be changed after creation, so a file is used instead.
+const cachePopulatedFile = ".gvisor-cache-populated"
+
+// Volume is a named docker volume.
+//
+// Unlike the container filesystem, a volume outlives the containers using it,
+// so it can hold large inputs (e.g. model weights) that would otherwise be
+// downloaded or copied by every container.
+type Volume struct {
+	client *client.Client
+
+	// Name is the name of the volume.
+	Name string
+}
+
+// CacheVolume returns the docker volume with the given name. If the volume
+// does not exist yet, or a previous call did not finish populating it, it is
+// (re)created and populate is called to fill it, e.g. by running a container
+// that downloads a model into it. If populate fails, the volume is removed so
+// that the next call starts over.
+//
+// The volume is not removed when the test ends; call Remove to drop the
+// cache.
+func CacheVolume(ctx context.Context, name string, populate func(context.Context, *Volume) error) (*Volume, error) {
+	cl, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		return nil, fmt.Errorf("create client failed: %v", err)
+	}
+	cl.NegotiateAPIVersion(ctx)
+
+	v := &Volume{client: cl, Name: name}
+	_, err = cl.VolumeInspect(ctx, name)
+	switch {
+	case err == nil:
+		populated, err := v.populated(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check volume %q: %v", name, err)
+		}
+		if populated {
+			return v, nil
+		}
+		// Populating the volume was interrupted.
+		if err := v.Remove(ctx); err != nil {
+			return nil, fmt.Errorf("failed to remove partially populated volume %q: %v", name, err)
+		}
+	case !client.IsErrNotFound(err):
+		return nil, fmt.Errorf("failed to inspect volume %q: %v", name, err)
+	}
+
+	if _, err := cl.VolumeCreate(ctx, volume.CreateOptions{
+		Name:   name,
+		Labels: map[string]string{cacheVolumeLabel: "true"},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create volume %q: %v", name, err)
+	}
+	err = populate(ctx, v)
+	if err == nil {
+		err = v.markPopulated(ctx)
+	}
+	if err != nil {
+		if rerr := v.Remove(ctx); rerr != nil {
+			return nil, fmt.Errorf("failed to populate volume %q: %v (and removing it failed: %v)", name, err, rerr)
+		}
+		return nil, fmt.Errorf("failed to populate volume %q: %v", name, err)
+	}
+	return v, nil
+}
+
+// populated returns true if the volume has been marked as populated.
+func (v *Volume) populated(ctx context.Context) (bool, error) {
+	out, err := v.run(ctx, true /* readOnly */, fmt.Sprintf("if [ -e /cache/%s ]; then echo yes; else echo no; fi", cachePopulatedFile))
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out) == "yes", nil
+}
+
+// markPopulated marks the volume as populated.
+func (v *Volume) markPopulated(ctx context.Context) error {
+	_, err := v.run(ctx, false /* readOnly */, fmt.Sprintf("touch /cache/%s", cachePopulatedFile))
+	return err
+}
+
+// run runs a shell command in a native container with the volume mounted at
+// /cache.
+func (v *Volume) run(ctx context.Context, readOnly bool, cmd string) (string, error) {
+	c := MakeNativeContainer(ctx, testutil.DefaultLogger("cache-volume"))
+	defer c.CleanUp(ctx)
+	return c.Run(ctx, RunOpts{
+		Image:  "basic/alpine",
+		Mounts: []mount.Mount{v.Mount("/cache", readOnly)},
+	}, "sh", "-c", cmd)
+}
+
+// Mount returns a mount of the volume at target, suitable for
+// RunOpts.Mounts.
+func (v *Volume) Mount(target string, readOnly bool) mount.Mount {
+	return mount.Mount{
+		Type:     mount.TypeVolume,
+		Source:   v.Name,
+		Target:   target,
+		ReadOnly: readOnly,
+	}
+}
+
+// Remove is analogous to 'docker volume rm'.
+func (v *Volume) Remove(ctx context.Context) error {
+	return v.client.VolumeRemove(ctx, v.Name, true /* force */)
+}
@@ -15,6 +15,7 @@
 package boot
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 
@@ -23,6 +24,7 @@ import (
 	"gvisor.dev/gvisor/pkg/eventchannel"
 	"gvisor.dev/gvisor/pkg/log"
 	rpb "gvisor.dev/gvisor/pkg/sentry/arch/registers_go_proto"
+	"gvisor.dev/gvisor/pkg/sentry/control"
 	"gvisor.dev/gvisor/pkg/sentry/strace"
 	spb "gvisor.dev/gvisor/pkg/sentry/unimpl/unimplemented_syscall_go_proto"
 	"gvisor.dev/gvisor/pkg/sync"
@@ -190,3 +192,16 @@ func (a *argsTracker) onReported(regs *rpb.Registers) {
 	a.count++
 	a.reported[a.key(regs)] = struct{}{}
 }
+
+// WriteCompatReport writes the compatibility report of the sandbox to the
+// file passed in Args.CompatReportFD, if any.
+func (l *Loader) WriteCompatReport() error {
+	if l.compatReportFile == nil {
+		return nil
+	}
+	defer l.compatReportFile.Close()
+
+	encoder := json.NewEncoder(l.compatReportFile)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(control.CompatReport{Items: l.k.CompatReport()})
+}
@@ -42,6 +42,10 @@ import (
 )
 
 const (
+	// ContMgrCancelPrecopy ends a pre-copy of a container's memory without
+	// checkpointing it.
+	ContMgrCancelPrecopy = "containerManager.CancelPrecopy"
+
 	// ContMgrCheckpoint checkpoints a container.
 	ContMgrCheckpoint = "containerManager.Checkpoint"
 
@@ -61,6 +65,10 @@ const (
 	// ContMgrPortForward starts port forwarding with the sandbox.
 	ContMgrPortForward = "containerManager.PortForward"
 
+	// ContMgrPrecopy writes out a round of a container's memory ahead of a
+	// checkpoint, while the container keeps running.
+	ContMgrPrecopy = "containerManager.Precopy"
+
 	// ContMgrProcesses lists processes running in a container.
 	ContMgrProcesses = "containerManager.Processes"
 
@@ -104,8 +112,25 @@ const (
 	// NetworkCreateLinksAndRoutes creates links and routes in a network stack.
 	NetworkCreateLinksAndRoutes = "Network.CreateLinksAndRoutes"
 
+	// NetworkLinks returns the configuration of fd-based links.
+	NetworkLinks = "Network.Links"
+
+	// NetworkUpdateLink changes the configuration of an fd-based link.
+	NetworkUpdateLink = "Network.UpdateLink"
+
+	// NetworkRestoredLinks returns the configuration of fd-based links saved
+	// in the checkpoint that the sandbox was restored from.
+	NetworkRestoredLinks = "Network.RestoredLinks"
+
+	// NetworkCreateVFLinks creates links for SR-IOV virtual functions in a
+	// network stack.
+	NetworkCreateVFLinks = "Network.CreateVFLinks"
+
 	// DebugStacks collects sandbox stacks for debugging.
 	DebugStacks = "debug.Stacks"
+
+	// HealthCheck runs the sandbox health checks (see health.go).
+	HealthCheck = "health.Check"
 )
 
 // Profiling related commands (see pprof.go for more details).
@@ -134,6 +159,21 @@ const (
 	UsageUsageFD = "Usage.UsageFD"
 )
 
+// Compatibility report related commands (see compat.go for more details).
+const (
+	CompatReport = "Compat.Report"
+)
+
+// Crash report related commands.
+const (
+	CrashReports = "Crashes.Reports"
+)
+
+// Time synchronization related commands.
+const (
+	TimeSyncState = "TimeSync.State"
+)
+
 // Metrics related commands (see metrics.go).
 const (
 	MetricsGetRegistered = "Metrics.GetRegisteredMetrics"
@@ -154,6 +194,10 @@ type controller struct {
 
 	// manager holds the containerManager methods.
 	manager *containerManager
+
+	// network holds the Network methods. It is nil if the sandbox doesn't use
+	// netstack.
+	network *Network
 }
 
 // newController creates a new controller. The caller must call
@@ -174,19 +218,25 @@ func newController(fd int, l *Loader) (*controller, error) {
 	}
 	ctrl.srv.Register(ctrl.manager)
 	ctrl.srv.Register(&control.Cgroups{Kernel: l.k})
+	ctrl.srv.Register(&control.Compat{Kernel: l.k})
+	ctrl.srv.Register(&control.Crashes{Kernel: l.k})
 	ctrl.srv.Register(&control.Lifecycle{Kernel: l.k})
 	ctrl.srv.Register(&control.Logging{})
 	ctrl.srv.Register(&control.Proc{Kernel: l.k})
 	ctrl.srv.Register(&control.State{Kernel: l.k})
+	ctrl.srv.Register(&control.TimeSync{Kernel: l.k})
 	ctrl.srv.Register(&control.Usage{Kernel: l.k})
 	ctrl.srv.Register(&control.Metrics{})
 	ctrl.srv.Register(&debug{})
+	ctrl.srv.Register(&health{l: l})
 
 	if eps, ok := l.k.RootNetworkNamespace().Stack().(*netstack.Stack); ok {
-		ctrl.srv.Register(&Network{
-			Stack:  eps.Stack,
-			Kernel: l.k,
-		})
+		ctrl.network = &Network{
+			Stack:    eps.Stack,
+			Kernel:   l.k,
+			Autoconf: eps.Autoconf,
+		}
+		ctrl.srv.Register(ctrl.network)
 	}
 	if l.root.conf.ProfileEnable {
 		ctrl.srv.Register(control.NewProfile(l.k))
@@ -407,10 +457,21 @@ func (cm *containerManager) ExecuteAsync(args *control.ExecArgs, pid *int32) err
 func (cm *containerManager) Checkpoint(o *control.SaveOpts, _ *struct{}) error {
 	log.Debugf("containerManager.Checkpoint")
 	// TODO(gvisor.dev/issues/6243): save/restore not supported w/ hostinet
-	if cm.l.root.conf.Network == config.NetworkHost {
+	if cm.l.root.conf.Network.UsesHostNetwork() {
 		return errors.New("checkpoint not supported when using hostinet")
 	}
 
+	// Save the configuration of links that may have been changed at runtime,
+	// so that it can be applied again on restore.
+	if n := cm.l.ctrl.network; n != nil {
+		if o.Metadata == nil {
+			o.Metadata = make(map[string]string)
+		}
+		if err := n.saveLinks(o.Metadata); err != nil {
+			return fmt.Errorf("saving network links: %w", err)
+		}
+	}
+
 	state := control.State{
 		Kernel:   cm.l.k,
 		Watchdog: cm.l.watchdog,
@@ -418,6 +479,30 @@ func (cm *containerManager) Checkpoint(o *control.SaveOpts, _ *struct{}) error {
 	return state.Save(o, nil)
 }
 
+// Precopy writes out a round of memory that has been written to since the
+// last round, ahead of a checkpoint that omits it.
+func (cm *containerManager) Precopy(o *control.PrecopyOpts, res *control.PrecopyResult) error {
+	log.Debugf("containerManager.Precopy")
+	if cm.l.root.conf.Network.UsesHostNetwork() {
+		return errors.New("checkpoint not supported when using hostinet")
+	}
+	state := control.State{
+		Kernel:   cm.l.k,
+		Watchdog: cm.l.watchdog,
+	}
+	return state.Precopy(o, res)
+}
+
+// CancelPrecopy ends the pre-copy started by Precopy without checkpointing.
+func (cm *containerManager) CancelPrecopy(_, _ *struct{}) error {
+	log.Debugf("containerManager.CancelPrecopy")
+	state := control.State{
+		Kernel:   cm.l.k,
+		Watchdog: cm.l.watchdog,
+	}
+	return state.CancelPrecopy(nil, nil)
+}
+
 // PortForwardOpts contains options for port forwarding to a port in a
 // container.
 type PortForwardOpts struct {
@@ -444,11 +529,20 @@ func (cm *containerManager) PortForward(opts *PortForwardOpts, _ *struct{}) erro
 // RestoreOpts contains options related to restoring a container's file system.
 type RestoreOpts struct {
 	// FilePayload contains the state file to be restored, followed by the
-	// platform device file if necessary.
+	// pre-copied memory file if Precopied is set, followed by the platform
+	// device file if necessary.
 	urpc.FilePayload
 
 	// SandboxID contains the ID of the sandbox.
 	SandboxID string
+
+	// Key is used for state integrity check.
+	Key []byte
+
+	// Precopied indicates that memory omitted from the state file was
+	// pre-copied to the file that follows it, as written by
+	// pgalloc.ReadPrecopyRound.
+	Precopied bool
 }
 
 // Restore loads a container from a statefile.
@@ -458,29 +552,38 @@ type RestoreOpts struct {
 func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	log.Debugf("containerManager.Restore")
 
-	r := restorer{container: &cm.l.root}
-	switch numFiles := len(o.Files); numFiles {
+	r := restorer{container: &cm.l.root, key: o.Key}
+	files := o.Files
+	if o.Precopied {
+		if len(files) < 2 {
+			return fmt.Errorf("the state file and pre-copied memory file must be passed to Restore")
+		}
+		r.precopied = files[1]
+		files = append([]*os.File{files[0]}, files[2:]...)
+	}
+	switch numFiles := len(files); numFiles {
 	case 2:
 		// The device file is donated to the platform.
 		// Can't take ownership away from os.File. dup them to get a new FD.
-		fd, err := unix.Dup(int(o.Files[1].Fd()))
+		fd, err := unix.Dup(int(files[1].Fd()))
 		if err != nil {
 			return fmt.Errorf("failed to dup file: %v", err)
 		}
 		r.deviceFile = os.NewFile(uintptr(fd), "platform device")
 		fallthrough
 	case 1:
-		r.stateFile = o.Files[0]
+		r.stateFile = files[0]
+		// The state may also be streamed, e.g. from a socket during migration.
 		if info, err := r.stateFile.Stat(); err != nil {
 			return err
-		} else if info.Size() == 0 {
+		} else if info.Mode().IsRegular() && info.Size() == 0 {
 			return fmt.Errorf("file cannot be empty")
 		}
 
 	case 0:
 		return fmt.Errorf("at least one file must be passed to Restore")
 	default:
-		return fmt.Errorf("at most two files may be passed to Restore")
+		return fmt.Errorf("too many files passed to Restore")
 	}
 
 	// Pause the kernel while we build a new one.
@@ -0,0 +1,145 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/rand"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/link/nested"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// deterministicConfig holds the inputs of a deterministic execution, see
+// config.Config.Deterministic.
+type deterministicConfig struct {
+	// realtimeNS is the initial value of CLOCK_REALTIME.
+	realtimeNS int64
+
+	// opts are passed to the kernel.
+	opts kernel.DeterministicOptions
+
+	// netstacks is the number of network stacks created so far.
+	netstacks atomicbitops.Uint64
+}
+
+// newDeterministicConfig sets up deterministic mode if it is enabled, reading
+// the schedule log to replay and writing the header of the schedule log to
+// record, if any. It returns nil if deterministic mode is disabled.
+func newDeterministicConfig(args Args) (*deterministicConfig, error) {
+	if !args.Conf.Deterministic {
+		return nil, nil
+	}
+	h := kernel.ScheduleLogHeader{
+		Seed:       args.Conf.DeterministicSeed,
+		RealtimeNS: time.Now().UnixNano(),
+	}
+	var det deterministicConfig
+	if args.DeterministicReplayFD > 0 {
+		f := os.NewFile(uintptr(args.DeterministicReplayFD), "deterministic replay file")
+		defer f.Close()
+		var err error
+		h, det.opts.Replay, err = kernel.ReadScheduleLog(f)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("Deterministic: replaying %d schedule events with seed %d", len(det.opts.Replay), h.Seed)
+	} else if h.Seed == 0 {
+		h.Seed = rand.Uint64()
+		log.Infof("Deterministic: using seed %d", h.Seed)
+	}
+	if args.DeterministicRecordFD > 0 {
+		// The file is written to until the sandbox exits.
+		f := os.NewFile(uintptr(args.DeterministicRecordFD), "deterministic record file")
+		if err := kernel.WriteScheduleLogHeader(f, h); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("writing schedule log: %w", err)
+		}
+		det.opts.Record = f
+	}
+	det.realtimeNS = h.RealtimeNS
+	det.opts.Seed = h.Seed
+	return &det, nil
+}
+
+// netstackRNG returns the source of randomness for a new network stack, or nil
+// to use the default. In deterministic mode, each network stack uses its own
+// stream of the seeded generator; the kernel uses stream 0, see
+// kernel.DeterministicOptions.Seed. Network stacks are created by the
+// application in a reproducible order, except for the root network
+// namespace's, which is created first.
+func (det *deterministicConfig) netstackRNG() io.Reader {
+	if det == nil {
+		return nil
+	}
+	return rand.NewDeterministicReader(det.opts.Seed, det.netstacks.Add(1))
+}
+
+// kernelOptions returns kernel.InitKernelArgs.Deterministic for det, which may
+// be nil.
+func (det *deterministicConfig) kernelOptions() *kernel.DeterministicOptions {
+	if det == nil {
+		return nil
+	}
+	return &det.opts
+}
+
+// detLinkEndpoint is a link endpoint whose inbound packets are external inputs
+// in deterministic mode, see kernel.Kernel.DeterministicSource.
+type detLinkEndpoint struct {
+	nested.Endpoint
+
+	// input records or discards an inbound packet. It is immutable.
+	input func(kernel.ExternalInput)
+}
+
+// newDetLinkEndpoint returns a detLinkEndpoint wrapping child, the endpoint
+// of the link with the given name.
+func newDetLinkEndpoint(k *kernel.Kernel, name string, child stack.LinkEndpoint) *detLinkEndpoint {
+	e := &detLinkEndpoint{}
+	e.Endpoint.Init(child, e)
+	e.input = k.DeterministicSource("network "+name, e.deliver)
+	return e
+}
+
+// DeliverNetworkPacket implements stack.NetworkDispatcher.DeliverNetworkPacket.
+func (e *detLinkEndpoint) DeliverNetworkPacket(protocol tcpip.NetworkProtocolNumber, pkt *stack.PacketBuffer) {
+	v := pkt.ToView()
+	defer v.Release()
+	e.input(kernel.ExternalInput{
+		Data: append([]byte(nil), v.AsSlice()...),
+		Args: []int64{int64(protocol), int64(len(pkt.LinkHeader().Slice()))},
+	})
+}
+
+// deliver delivers a packet that was passed to DeliverNetworkPacket.
+func (e *detLinkEndpoint) deliver(in kernel.ExternalInput) {
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Payload: buffer.MakeWithData(in.Data),
+	})
+	defer pkt.DecRef()
+	if _, ok := pkt.LinkHeader().Consume(int(in.Args[1])); !ok {
+		return
+	}
+	e.Endpoint.DeliverNetworkPacket(tcpip.NetworkProtocolNumber(in.Args[0]), pkt)
+}
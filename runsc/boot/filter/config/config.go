@@ -26,9 +26,13 @@ import (
 	"gvisor.dev/gvisor/pkg/seccomp"
 	"gvisor.dev/gvisor/pkg/seccomp/precompiledseccomp"
 	"gvisor.dev/gvisor/pkg/sentry/devices/accel"
+	"gvisor.dev/gvisor/pkg/sentry/devices/drmproxy"
 	"gvisor.dev/gvisor/pkg/sentry/devices/nvproxy"
+	"gvisor.dev/gvisor/pkg/sentry/devices/ptpproxy"
 	"gvisor.dev/gvisor/pkg/sentry/devices/tpuproxy"
+	"gvisor.dev/gvisor/pkg/sentry/devices/vfioproxy"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
+	goferfilter "gvisor.dev/gvisor/runsc/fsgofer/filter"
 )
 
 // Options are seccomp filter related options.
@@ -36,10 +40,16 @@ type Options struct {
 	Platform              platform.SeccompInfo
 	HostNetwork           bool
 	HostNetworkRawSockets bool
+	HostVsock             bool
 	HostFilesystem        bool
+	InProcessGofer        bool
 	ProfileEnable         bool
 	NVProxy               bool
 	TPUProxy              bool
+	VFIOProxy             bool
+	DRMProxy              bool
+	PTPProxy              bool
+	HostTimeSync          bool
 	ControllerFD          uint32
 }
 
@@ -61,11 +71,17 @@ func (opt Options) ConfigKey() string {
 	sb.WriteString(fmt.Sprintf("Platform=%q ", opt.Platform.ConfigKey()))
 	sb.WriteString(fmt.Sprintf("HostNetwork=%t ", opt.HostNetwork))
 	sb.WriteString(fmt.Sprintf("HostNetworkRawSockets=%t ", opt.HostNetworkRawSockets))
+	sb.WriteString(fmt.Sprintf("HostVsock=%t ", opt.HostVsock))
 	sb.WriteString(fmt.Sprintf("HostFilesystem=%t ", opt.HostFilesystem))
+	sb.WriteString(fmt.Sprintf("InProcessGofer=%t ", opt.InProcessGofer))
 	sb.WriteString(fmt.Sprintf("ProfileEnable=%t ", opt.ProfileEnable))
 	sb.WriteString(fmt.Sprintf("Instrumentation=%t ", isInstrumentationEnabled()))
 	sb.WriteString(fmt.Sprintf("NVProxy=%t ", opt.NVProxy))
 	sb.WriteString(fmt.Sprintf("TPUProxy=%t ", opt.TPUProxy))
+	sb.WriteString(fmt.Sprintf("VFIOProxy=%t ", opt.VFIOProxy))
+	sb.WriteString(fmt.Sprintf("DRMProxy=%t ", opt.DRMProxy))
+	sb.WriteString(fmt.Sprintf("PTPProxy=%t ", opt.PTPProxy))
+	sb.WriteString(fmt.Sprintf("HostTimeSync=%t ", opt.HostTimeSync))
 	return strings.TrimSpace(sb.String())
 }
 
@@ -80,12 +96,18 @@ func Warnings(opt Options) []string {
 			warnings = append(warnings, "host networking enabled: syscall filters less restrictive!")
 		}
 	}
+	if opt.HostVsock {
+		warnings = append(warnings, "host vsock enabled: syscall filters less restrictive!")
+	}
 	if opt.ProfileEnable {
 		warnings = append(warnings, "profile enabled: syscall filters less restrictive!")
 	}
 	if opt.HostFilesystem {
 		warnings = append(warnings, "host filesystem enabled: syscall filters less restrictive!")
 	}
+	if opt.InProcessGofer {
+		warnings = append(warnings, "in-process gofer enabled: syscall filters less restrictive!")
+	}
 	if isInstrumentationEnabled() {
 		warnings = append(warnings, "instrumentation enabled: syscall filters less restrictive!")
 	}
@@ -95,6 +117,18 @@ func Warnings(opt Options) []string {
 	if opt.TPUProxy {
 		warnings = append(warnings, "TPU device proxy enabled: syscall filters less restrictive!")
 	}
+	if opt.VFIOProxy {
+		warnings = append(warnings, "VFIO device proxy enabled: syscall filters less restrictive!")
+	}
+	if opt.DRMProxy {
+		warnings = append(warnings, "DRM device proxy enabled: syscall filters less restrictive!")
+	}
+	if opt.PTPProxy {
+		warnings = append(warnings, "PTP clock proxy enabled: syscall filters less restrictive!")
+	}
+	if opt.HostTimeSync {
+		warnings = append(warnings, "host time sync state enabled: syscall filters less restrictive!")
+	}
 	return warnings
 }
 
@@ -130,12 +164,22 @@ func rules(opt Options, vars precompiledseccomp.Values) (seccomp.SyscallRules, s
 	if opt.HostNetwork {
 		s.Merge(hostInetFilters(opt.HostNetworkRawSockets))
 	}
+	if opt.HostVsock {
+		s.Merge(hostVsockFilters())
+	}
 	if opt.ProfileEnable {
 		s.Merge(profileFilters())
 	}
 	if opt.HostFilesystem {
 		s.Merge(hostFilesystemFilters())
 	}
+	if opt.InProcessGofer {
+		// The gofer's goroutines share the sandbox's filters, which must
+		// allow serving writable mounts.
+		s.Merge(goferfilter.Rules(goferfilter.Options{
+			Mounts: []goferfilter.MountPolicy{goferfilter.MountReadWrite},
+		}))
+	}
 	if opt.NVProxy {
 		s.Merge(nvproxy.Filters())
 	}
@@ -143,6 +187,18 @@ func rules(opt Options, vars precompiledseccomp.Values) (seccomp.SyscallRules, s
 		s.Merge(accel.Filters())
 		s.Merge(tpuproxy.Filters())
 	}
+	if opt.VFIOProxy {
+		s.Merge(vfioproxy.Filters())
+	}
+	if opt.DRMProxy {
+		s.Merge(drmproxy.Filters())
+	}
+	if opt.PTPProxy {
+		s.Merge(ptpproxy.Filters())
+	}
+	if opt.HostTimeSync {
+		s.Merge(hostTimeSyncFilters())
+	}
 
 	s.Merge(opt.Platform.SyscallFilters(vars))
 	return s, seccomp.DenyNewExecMappings
@@ -61,6 +61,11 @@ var allowedSyscalls = seccomp.MakeSyscallRules(map[uintptr]seccomp.SyscallRule{
 			seccomp.AnyValue{},
 			seccomp.EqualTo(unix.F_GETFD),
 		},
+		// Used to forward write life time hints to host FDs.
+		seccomp.PerArg{
+			seccomp.AnyValue{},
+			seccomp.EqualTo(unix.F_SET_RW_HINT),
+		},
 	},
 	unix.SYS_FSTAT:     seccomp.MatchAll{},
 	unix.SYS_FSYNC:     seccomp.MatchAll{},
@@ -152,9 +157,33 @@ var allowedSyscalls = seccomp.MakeSyscallRules(map[uintptr]seccomp.SyscallRule{
 			seccomp.EqualTo(linux.SIOCGIFTXQLEN),
 			seccomp.AnyValue{}, /* ifreq struct */
 		},
+		// These commands are needed for fs-verity support of gofer mounts.
+		seccomp.PerArg{
+			seccomp.NonNegativeFD{}, /* fd */
+			seccomp.EqualTo(linux.FS_IOC_ENABLE_VERITY),
+			seccomp.AnyValue{}, /* fsverity_enable_arg struct */
+		},
+		seccomp.PerArg{
+			seccomp.NonNegativeFD{}, /* fd */
+			seccomp.EqualTo(linux.FS_IOC_MEASURE_VERITY),
+			seccomp.AnyValue{}, /* fsverity_digest struct */
+		},
+		seccomp.PerArg{
+			seccomp.NonNegativeFD{}, /* fd */
+			seccomp.EqualTo(linux.FS_IOC_READ_VERITY_METADATA),
+			seccomp.AnyValue{}, /* fsverity_read_metadata_arg struct */
+		},
 	},
 	unix.SYS_LSEEK:   seccomp.MatchAll{},
 	unix.SYS_MADVISE: seccomp.MatchAll{},
+	unix.SYS_MBIND: seccomp.PerArg{
+		seccomp.AnyValue{},
+		seccomp.AnyValue{},
+		seccomp.AnyValue{},
+		seccomp.AnyValue{},
+		seccomp.AnyValue{},
+		seccomp.EqualTo(0),
+	},
 	unix.SYS_MEMBARRIER: seccomp.PerArg{
 		seccomp.EqualTo(linux.MEMBARRIER_CMD_GLOBAL),
 		seccomp.EqualTo(0),
@@ -80,6 +80,12 @@ func optionsToPrecompile() ([]Options, error) {
 			return []Options{opt}, nil
 		},
 
+		// Only precompile options with host vsock disabled.
+		func(opt Options) ([]Options, error) {
+			opt.HostVsock = false
+			return []Options{opt}, nil
+		},
+
 		// Only precompile options with DirectFS enabled.
 		func(opt Options) ([]Options, error) {
 			opt.HostFilesystem = true
@@ -103,6 +109,19 @@ func optionsToPrecompile() ([]Options, error) {
 			tpuProxyNo.TPUProxy = false
 			return []Options{tpuProxyYes, tpuProxyNo}, nil
 		},
+
+		// Expand VFIOProxy vs not.
+		func(opt Options) ([]Options, error) {
+			if opt.TPUProxy {
+				// VFIOProxy and TPUProxy are mutually exclusive.
+				return []Options{opt}, nil
+			}
+			vfioProxyYes := opt
+			vfioProxyYes.VFIOProxy = true
+			vfioProxyNo := opt
+			vfioProxyNo.VFIOProxy = false
+			return []Options{vfioProxyYes, vfioProxyNo}, nil
+		},
 	} {
 		var newOpts []Options
 		for _, opt := range opts {
@@ -45,6 +45,10 @@ func TestIoctlFirstArgumentIsNonNegativeFD(t *testing.T) {
 			Platform:    (&systrap.Systrap{}).SeccompInfo(),
 			HostNetwork: true,
 		},
+		"host vsock": Options{
+			Platform:  (&systrap.Systrap{}).SeccompInfo(),
+			HostVsock: true,
+		},
 		"host network with raw sockets": Options{
 			Platform:              (&systrap.Systrap{}).SeccompInfo(),
 			HostNetwork:           true,
@@ -99,6 +103,7 @@ func TestOptionsConfigKey(t *testing.T) {
 		},
 		"HostNetwork":           func(opt *Options) { opt.HostNetwork = !opt.HostNetwork },
 		"HostNetworkRawSockets": func(opt *Options) { opt.HostNetworkRawSockets = !opt.HostNetworkRawSockets },
+		"HostVsock":             func(opt *Options) { opt.HostVsock = !opt.HostVsock },
 		"HostFilesystem":        func(opt *Options) { opt.HostFilesystem = !opt.HostFilesystem },
 		"ProfileEnable":         func(opt *Options) { opt.ProfileEnable = !opt.ProfileEnable },
 		"NVProxy":               func(opt *Options) { opt.NVProxy = !opt.NVProxy },
@@ -140,6 +140,13 @@ func hostInetFilters(allowRawSockets bool) seccomp.SyscallRules {
 		socketRules = append(socketRules, rule)
 	}
 	rules.Set(unix.SYS_SOCKET, socketRules)
+	return rules.Merge(hostInetSockOptFilters())
+}
+
+// hostInetSockOptFilters contains the getsockopt and setsockopt syscalls that
+// are needed by sentry/socket/hostinet.
+func hostInetSockOptFilters() seccomp.SyscallRules {
+	rules := seccomp.NewSyscallRules()
 
 	// Generate rules for socket options based on hostinet's supported
 	// socket options.
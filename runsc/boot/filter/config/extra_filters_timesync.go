@@ -0,0 +1,32 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/seccomp"
+)
+
+// hostTimeSyncFilters contains syscalls that are needed to read the host's
+// NTP synchronization state.
+//
+// adjtimex(2) can also adjust the host's clock, which the sentry never does;
+// seccomp cannot inspect the struct timex that determines whether it does,
+// so this relies on the sandbox lacking CAP_SYS_TIME on the host.
+func hostTimeSyncFilters() seccomp.SyscallRules {
+	return seccomp.MakeSyscallRules(map[uintptr]seccomp.SyscallRule{
+		unix.SYS_ADJTIMEX: seccomp.MatchAll{},
+	})
+}
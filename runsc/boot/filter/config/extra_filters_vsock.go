@@ -0,0 +1,82 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/seccomp"
+)
+
+// hostVsockFilters contains syscalls that are needed by AF_VSOCK sockets that
+// are bridged to the host by sentry/socket/vsock.
+func hostVsockFilters() seccomp.SyscallRules {
+	rules := seccomp.MakeSyscallRules(map[uintptr]seccomp.SyscallRule{
+		unix.SYS_ACCEPT4: seccomp.PerArg{
+			seccomp.AnyValue{},
+			seccomp.AnyValue{},
+			seccomp.AnyValue{},
+			seccomp.EqualTo(unix.SOCK_NONBLOCK | unix.SOCK_CLOEXEC),
+		},
+		unix.SYS_BIND:        seccomp.MatchAll{},
+		unix.SYS_CONNECT:     seccomp.MatchAll{},
+		unix.SYS_GETPEERNAME: seccomp.MatchAll{},
+		unix.SYS_GETSOCKNAME: seccomp.MatchAll{},
+		unix.SYS_IOCTL: seccomp.Or{
+			seccomp.PerArg{
+				seccomp.NonNegativeFD{},
+				seccomp.EqualTo(unix.TIOCOUTQ),
+			},
+			seccomp.PerArg{
+				seccomp.NonNegativeFD{},
+				seccomp.EqualTo(unix.TIOCINQ),
+			},
+		},
+		unix.SYS_LISTEN:   seccomp.MatchAll{},
+		unix.SYS_READV:    seccomp.MatchAll{},
+		unix.SYS_RECVFROM: seccomp.MatchAll{},
+		unix.SYS_RECVMSG:  seccomp.MatchAll{},
+		unix.SYS_SENDMSG:  seccomp.MatchAll{},
+		unix.SYS_SENDTO:   seccomp.MatchAll{},
+		unix.SYS_SHUTDOWN: seccomp.Or{
+			seccomp.PerArg{
+				seccomp.AnyValue{},
+				seccomp.EqualTo(unix.SHUT_RD),
+			},
+			seccomp.PerArg{
+				seccomp.AnyValue{},
+				seccomp.EqualTo(unix.SHUT_WR),
+			},
+			seccomp.PerArg{
+				seccomp.AnyValue{},
+				seccomp.EqualTo(unix.SHUT_RDWR),
+			},
+		},
+		unix.SYS_SOCKET: seccomp.Or{
+			seccomp.PerArg{
+				seccomp.EqualTo(unix.AF_VSOCK),
+				// We always set SOCK_NONBLOCK and SOCK_CLOEXEC.
+				seccomp.EqualTo(unix.SOCK_STREAM | unix.SOCK_NONBLOCK | unix.SOCK_CLOEXEC),
+				seccomp.EqualTo(0),
+			},
+			seccomp.PerArg{
+				seccomp.EqualTo(unix.AF_VSOCK),
+				seccomp.EqualTo(unix.SOCK_SEQPACKET | unix.SOCK_NONBLOCK | unix.SOCK_CLOEXEC),
+				seccomp.EqualTo(0),
+			},
+		},
+		unix.SYS_WRITEV: seccomp.MatchAll{},
+	})
+	return rules.Merge(hostInetSockOptFilters())
+}
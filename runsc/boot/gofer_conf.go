@@ -41,6 +41,11 @@ const (
 	// tmpfs backed by a host file in an anonymous directory.
 	AnonOverlay
 
+	// HostOverlay indicates that the gofer overlays this gofer mount with the
+	// host's overlayfs and serves the merged view. The sentry does not apply an
+	// overlay of its own in this case. Only lisafs lower layers support this.
+	HostOverlay
+
 	// UpperMax indicates the number of the valid upper layer types.
 	UpperMax
 )
@@ -56,6 +61,8 @@ func (u GoferMountConfUpperType) String() string {
 		return "self"
 	case AnonOverlay:
 		return "anon"
+	case HostOverlay:
+		return "host"
 	}
 	panic(fmt.Sprintf("Invalid gofer mount config upper layer type: %d", u))
 }
@@ -71,6 +78,8 @@ func (u *GoferMountConfUpperType) Set(v string) error {
 		*u = SelfOverlay
 	case "anon":
 		*u = AnonOverlay
+	case "host":
+		*u = HostOverlay
 	default:
 		return fmt.Errorf("invalid gofer mount config upper layer type: %s", v)
 	}
@@ -163,7 +172,13 @@ func (g GoferMountConf) IsSelfBacked() bool {
 
 // ShouldUseOverlayfs returns true if an overlayfs should be applied.
 func (g GoferMountConf) ShouldUseOverlayfs() bool {
-	return g.Lower != NoneLower && g.Upper != NoOverlay
+	return g.Lower != NoneLower && g.Upper != NoOverlay && g.Upper != HostOverlay
+}
+
+// ShouldUseHostOverlayfs returns true if the gofer should overlay this mount
+// with the host's overlayfs.
+func (g GoferMountConf) ShouldUseHostOverlayfs() bool {
+	return g.Upper == HostOverlay
 }
 
 // ShouldUseTmpfs returns true if a tmpfs should be applied.
@@ -184,6 +199,9 @@ func (g GoferMountConf) ShouldUseErofs() bool {
 
 // valid returns true if this is a valid gofer mount config.
 func (g GoferMountConf) valid() bool {
+	if g.Upper == HostOverlay && g.Lower != Lisafs {
+		return false
+	}
 	return g.Lower < LowerMax && g.Upper < UpperMax && (g.Lower != NoneLower || g.Upper != NoOverlay)
 }
 
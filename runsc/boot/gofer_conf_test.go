@@ -26,6 +26,7 @@ func TestGoferConf(t *testing.T) {
 		wantLisafs   bool
 		wantTmpfs    bool
 		wantErofs    bool
+		wantHostOvl  bool
 		wantValid    bool
 	}{{
 		cfg: GoferMountConf{Lower: NoneLower, Upper: NoOverlay},
@@ -87,6 +88,23 @@ func TestGoferConf(t *testing.T) {
 		wantTmpfs:    false,
 		wantErofs:    false,
 		wantValid:    true,
+	}, {
+		cfg:          GoferMountConf{Lower: Lisafs, Upper: HostOverlay},
+		wantOverlay:  false,
+		wantHostFile: false,
+		wantLisafs:   true,
+		wantTmpfs:    false,
+		wantErofs:    false,
+		wantHostOvl:  true,
+		wantValid:    true,
+	}, {
+		cfg: GoferMountConf{Lower: NoneLower, Upper: HostOverlay},
+		// The host overlay needs a lisafs lower layer.
+		wantValid: false,
+	}, {
+		cfg: GoferMountConf{Lower: Erofs, Upper: HostOverlay},
+		// The host overlay needs a lisafs lower layer.
+		wantValid: false,
 	}, {
 		cfg:          GoferMountConf{Lower: Erofs, Upper: NoOverlay},
 		wantOverlay:  false,
@@ -147,6 +165,9 @@ func TestGoferConf(t *testing.T) {
 		if got := tc.cfg.ShouldUseErofs(); got != tc.wantErofs {
 			t.Errorf("gofer conf = %+v, ShouldUseErofs() = %t, want = %t", tc.cfg, got, tc.wantErofs)
 		}
+		if got := tc.cfg.ShouldUseHostOverlayfs(); got != tc.wantHostOvl {
+			t.Errorf("gofer conf = %+v, ShouldUseHostOverlayfs() = %t, want = %t", tc.cfg, got, tc.wantHostOvl)
+		}
 	}
 }
 
@@ -159,6 +180,7 @@ func TestGoferConfFlags(t *testing.T) {
 		{Lower: Lisafs, Upper: MemoryOverlay},
 		{Lower: Lisafs, Upper: SelfOverlay},
 		{Lower: Lisafs, Upper: AnonOverlay},
+		{Lower: Lisafs, Upper: HostOverlay},
 		{Lower: Erofs, Upper: NoOverlay},
 		{Lower: Erofs, Upper: MemoryOverlay},
 		{Lower: Erofs, Upper: SelfOverlay},
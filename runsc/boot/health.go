@@ -0,0 +1,227 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netstack"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// DefaultHealthTimeout is the time after which a health check that did not
+// complete is reported as unhealthy.
+const DefaultHealthTimeout = 5 * time.Second
+
+// Names of the health checks.
+const (
+	HealthCheckWatchdog = "watchdog"
+	HealthCheckGofer    = "gofer"
+	HealthCheckPlatform = "platform"
+	HealthCheckNetstack = "netstack"
+)
+
+// HealthArgs are the arguments to the health check.
+type HealthArgs struct {
+	// Timeout is the time after which a check that did not complete is
+	// reported as unhealthy. If zero, DefaultHealthTimeout is used.
+	Timeout time.Duration
+}
+
+// HealthCheckResult is the outcome of a single health check.
+type HealthCheckResult struct {
+	// Name is the name of the check, one of the HealthCheck* constants.
+	Name string `json:"name"`
+
+	// Healthy is true if the check passed.
+	Healthy bool `json:"healthy"`
+
+	// Message describes the outcome of the check.
+	Message string `json:"message,omitempty"`
+}
+
+// HealthReport is the outcome of all health checks of a sandbox.
+type HealthReport struct {
+	// Healthy is true if all checks passed.
+	Healthy bool `json:"healthy"`
+
+	// Checks are the outcomes of the individual checks.
+	Checks []HealthCheckResult `json:"checks"`
+}
+
+// health implements the health check RPC. Each check runs in its own
+// goroutine, so that a wedged subsystem is reported as such instead of
+// wedging the caller.
+type health struct {
+	l *Loader
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// nicTx holds the transmit counters of each NIC at the last check.
+	nicTx map[tcpip.NICID]nicTxStats
+}
+
+// nicTxStats are the transmit counters of a NIC.
+type nicTxStats struct {
+	packets uint64
+	dropped uint64
+}
+
+// Check runs all health checks and reports their outcome.
+func (h *health) Check(args *HealthArgs, out *HealthReport) error {
+	timeout := args.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHealthTimeout
+	}
+	checks := []struct {
+		name string
+		fn   func() (string, error)
+	}{
+		{HealthCheckWatchdog, h.checkWatchdog},
+		{HealthCheckGofer, h.checkGofer},
+		{HealthCheckPlatform, h.checkPlatform},
+		{HealthCheckNetstack, h.checkNetstack},
+	}
+
+	results := make([]chan HealthCheckResult, len(checks))
+	for i, c := range checks {
+		results[i] = make(chan HealthCheckResult, 1)
+		go func(name string, fn func() (string, error), result chan<- HealthCheckResult) {
+			msg, err := fn()
+			r := HealthCheckResult{Name: name, Healthy: err == nil, Message: msg}
+			if err != nil {
+				r.Message = err.Error()
+			}
+			result <- r
+		}(c.name, c.fn, results[i])
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	timedOut := false
+	out.Healthy = true
+	for i, c := range checks {
+		var ok bool
+		r := HealthCheckResult{Name: c.name, Message: fmt.Sprintf("timed out after %v", timeout)}
+		if !timedOut {
+			select {
+			case r = <-results[i]:
+				ok = true
+			case <-timer.C:
+				timedOut = true
+			}
+		}
+		if !ok {
+			// The check is likely stuck and its goroutine is left behind,
+			// unless it completed in the meantime.
+			select {
+			case r = <-results[i]:
+			default:
+			}
+		}
+		if !r.Healthy {
+			log.Warningf("Health check %q failed: %s", r.Name, r.Message)
+			out.Healthy = false
+		}
+		out.Checks = append(out.Checks, r)
+	}
+	return nil
+}
+
+// checkWatchdog reports tasks and subsystems that the watchdog found stuck,
+// and whether the watchdog itself is making progress.
+func (h *health) checkWatchdog() (string, error) {
+	s := h.l.watchdog.Status()
+	if !s.Running {
+		return "watchdog is not running", nil
+	}
+	if s.Stuck {
+		return "", fmt.Errorf("watchdog is stuck listing tasks")
+	}
+	// The monitoring loop runs every period, and may take up to the task
+	// timeout, which is four periods, to list tasks.
+	if since := time.Since(s.LastCheck); since > 6*s.Period {
+		return "", fmt.Errorf("watchdog has not run for %v", since.Round(time.Second))
+	}
+	if s.StuckTasks > 0 {
+		return "", fmt.Errorf("%d task(s) stuck in the kernel", s.StuckTasks)
+	}
+	if s.StalledSubsystems > 0 {
+		return "", fmt.Errorf("%d subsystem(s) stalled", s.StalledSubsystems)
+	}
+	return "", nil
+}
+
+// checkGofer makes an RPC to the gofer of every gofer mount.
+func (h *health) checkGofer() (string, error) {
+	n, errs := h.l.k.VFS().CheckFilesystemsHealth(h.l.k.SupervisorContext())
+	if len(errs) > 0 {
+		msgs := make([]string, 0, len(errs))
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		return "", fmt.Errorf("%d of %d gofer mount(s) unhealthy: %s", len(errs), n, strings.Join(msgs, "; "))
+	}
+	return fmt.Sprintf("%d gofer mount(s) healthy", n), nil
+}
+
+// checkPlatform creates and releases an address space, which requires the
+// platform's stub processes or vCPUs to be functional.
+func (h *health) checkPlatform() (string, error) {
+	as, _, err := h.l.k.NewAddressSpace(nil)
+	if err != nil {
+		return "", fmt.Errorf("creating address space: %w", err)
+	}
+	if as == nil {
+		// All address spaces are in use; this is not a failure.
+		return "no address space available", nil
+	}
+	as.Release()
+	return "", nil
+}
+
+// checkNetstack reports NICs whose transmit queue is stalled, i.e. which
+// dropped packets because their queue was full without having transmitted
+// any since the last check.
+func (h *health) checkNetstack() (string, error) {
+	eps, ok := h.l.k.RootNetworkNamespace().Stack().(*netstack.Stack)
+	if !ok {
+		return "netstack is not in use", nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	nicTx := make(map[tcpip.NICID]nicTxStats)
+	var stalled []string
+	for id, info := range eps.Stack.NICInfo() {
+		cur := nicTxStats{
+			packets: info.Stats.Tx.Packets.Value(),
+			dropped: info.Stats.TxPacketsDroppedNoBufferSpace.Value(),
+		}
+		nicTx[id] = cur
+		if last, ok := h.nicTx[id]; ok && cur.dropped > last.dropped && cur.packets == last.packets {
+			stalled = append(stalled, fmt.Sprintf("%s (%d dropped)", info.Name, cur.dropped-last.dropped))
+		}
+	}
+	h.nicTx = nicTx
+	if len(stalled) > 0 {
+		return "", fmt.Errorf("transmit queue stalled on %s", strings.Join(stalled, ", "))
+	}
+	return fmt.Sprintf("%d NIC(s) healthy", len(nicTx)), nil
+}
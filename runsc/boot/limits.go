@@ -41,6 +41,7 @@ type defs struct {
 	err error
 }
 
+// get returns a copy of the default limit set. Callers are free to modify it.
 func (d *defs) get() (*limits.LimitSet, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -54,7 +55,7 @@ func (d *defs) get() (*limits.LimitSet, error) {
 			return nil, err
 		}
 	}
-	return d.set, nil
+	return d.set.GetCopy(), nil
 }
 
 func (d *defs) initDefaults() error {
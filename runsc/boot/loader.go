@@ -18,6 +18,7 @@ package boot
 import (
 	"errors"
 	"fmt"
+	"io"
 	mrand "math/rand"
 	"os"
 	"runtime"
@@ -47,11 +48,13 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/limits"
 	"gvisor.dev/gvisor/pkg/sentry/loader"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 	"gvisor.dev/gvisor/pkg/sentry/seccheck"
 	pb "gvisor.dev/gvisor/pkg/sentry/seccheck/points/points_go_proto"
+	"gvisor.dev/gvisor/pkg/sentry/socket/egressproxy"
 	"gvisor.dev/gvisor/pkg/sentry/socket/netfilter"
 	"gvisor.dev/gvisor/pkg/sentry/time"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
@@ -60,6 +63,8 @@ import (
 	"gvisor.dev/gvisor/pkg/sighandling"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/autoconf"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/tcpip/link/ethernet"
 	"gvisor.dev/gvisor/pkg/tcpip/link/loopback"
 	"gvisor.dev/gvisor/pkg/tcpip/link/packetsocket"
@@ -87,9 +92,13 @@ import (
 
 	// Include other supported socket providers.
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/connector"
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/route"
+	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/sockdiag"
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/uevent"
+	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/xfrm"
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/unix"
+	"gvisor.dev/gvisor/pkg/sentry/socket/vsock"
 )
 
 type containerInfo struct {
@@ -176,6 +185,10 @@ type Loader struct {
 	// /sys/devices/virtual/dmi/id/product_name.
 	productName string
 
+	// mfOpts are the options of the kernel's MemoryFile, reused when the
+	// MemoryFile is recreated on restore.
+	mfOpts pgalloc.MemoryFileOpts
+
 	// mu guards the fields below.
 	mu sync.Mutex
 
@@ -194,6 +207,10 @@ type Loader struct {
 	//
 	// portForwardProxies is guarded by mu.
 	portForwardProxies []*pf.Proxy
+
+	// compatReportFile is the file to write the compatibility report to when
+	// the sandbox exits, or nil if no report was requested.
+	compatReportFile *os.File
 }
 
 // execID uniquely identifies a sentry process that is executed in a container.
@@ -217,6 +234,11 @@ type execProcess struct {
 	// TTY file is passed during container create and must be saved until
 	// container start.
 	hostTTY *fd.FD
+
+	// limits is the resource limit set derived from the container's spec. It
+	// is only set for container init processes. Processes exec'd into the
+	// container start with a copy of it.
+	limits *limits.LimitSet
 }
 
 // fdMapping maps guest to host file descriptors. Guest file descriptors are
@@ -283,12 +305,24 @@ type Args struct {
 	TotalHostMem uint64
 	// UserLogFD is the file descriptor to write user logs to.
 	UserLogFD int
+	// CompatReportFD is the file descriptor to write the compatibility report
+	// to when the sandbox exits, or 0 for no report.
+	CompatReportFD int
+	// DeterministicRecordFD is the file descriptor to write the schedule log
+	// to in deterministic mode, or 0 for no recording.
+	DeterministicRecordFD int
+	// DeterministicReplayFD is the file descriptor to read the schedule log
+	// to replay from in deterministic mode, or 0 for no replay.
+	DeterministicReplayFD int
 	// ProductName is the value to show in
 	// /sys/devices/virtual/dmi/id/product_name.
 	ProductName string
 	// PodInitConfigFD is the file descriptor to a file passed in the
 	//	--pod-init-config flag
 	PodInitConfigFD int
+	// EgressProxyCredentialsFD is the file descriptor to a file passed in the
+	// --egress-proxy-credentials-file flag, or -1.
+	EgressProxyCredentialsFD int
 	// SinkFDs is an ordered array of file descriptors to be used by seccheck
 	// sinks configured from the --pod-init-config file.
 	SinkFDs []int
@@ -297,6 +331,9 @@ type Args struct {
 	ProfileOpts profile.Opts
 	// NvidiaDriverVersion is the Nvidia driver version on the host.
 	NvidiaDriverVersion string
+	// NUMANodes are the host NUMA nodes that the sandbox may run on, used by
+	// the "local" memory NUMA policy.
+	NUMANodes []int
 }
 
 // make sure stdioFDs are always the same on initial start and on restore
@@ -315,6 +352,12 @@ func New(args Args) (*Loader, error) {
 	if err := rand.Init(); err != nil {
 		return nil, fmt.Errorf("setting up rand: %w", err)
 	}
+	// Deterministic mode must be set up before the clocks and the network
+	// stack are created.
+	det, err := newDeterministicConfig(args)
+	if err != nil {
+		return nil, fmt.Errorf("setting up deterministic mode: %w", err)
+	}
 
 	if err := usage.Init(); err != nil {
 		return nil, fmt.Errorf("setting up memory usage: %w", err)
@@ -389,7 +432,17 @@ func New(args Args) (*Loader, error) {
 	}
 
 	// Create memory file.
-	mf, err := createMemoryFile()
+	mfOpts, err := memoryFileOpts(args.Conf, args.NUMANodes)
+	if err != nil {
+		return nil, fmt.Errorf("creating memory file: %w", err)
+	}
+	if args.Conf.Cgroupless && args.TotalMem > 0 && args.TotalMem < args.TotalHostMem {
+		// There is no host memory cgroup, so the sentry enforces the
+		// container's memory limit, which the sandbox passed as TotalMem.
+		mfOpts.AllocationLimit = args.TotalMem
+		log.Infof("Limiting memory allocations to %d bytes", args.TotalMem)
+	}
+	mf, err := createMemoryFile(mfOpts)
 	if err != nil {
 		return nil, fmt.Errorf("creating memory file: %w", err)
 	}
@@ -405,7 +458,11 @@ func New(args Args) (*Loader, error) {
 
 	// Create timekeeper.
 	tk := kernel.NewTimekeeper(k, vdso.ParamPage.FileRange())
-	tk.SetClocks(time.NewCalibratedClocks())
+	if det != nil {
+		tk.SetClocks(time.NewVirtualClocks(det.realtimeNS))
+	} else {
+		tk.SetClocks(time.NewCalibratedClocks())
+	}
 
 	if err := enableStrace(args.Conf); err != nil {
 		return nil, fmt.Errorf("enabling strace: %w", err)
@@ -432,10 +489,20 @@ func New(args Args) (*Loader, error) {
 		auth.NewRootUserNamespace())
 
 	// Create root network namespace/stack.
-	netns, err := newRootNetworkNamespace(args.Conf, tk, k, creds.UserNamespace)
+	proxyCreds, err := readEgressProxyCredentials(args.EgressProxyCredentialsFD)
+	if err != nil {
+		return nil, fmt.Errorf("reading egress proxy credentials: %w", err)
+	}
+	netns, err := newRootNetworkNamespace(args.Conf, proxyCreds, tk, k, det.netstackRNG, creds.UserNamespace)
 	if err != nil {
 		return nil, fmt.Errorf("creating network: %w", err)
 	}
+	switch args.Conf.Vsock {
+	case config.VsockHost:
+		vsock.Init(vsock.ModeHost, 0)
+	case config.VsockLoopback:
+		vsock.Init(vsock.ModeLoopback, uint32(args.Conf.VsockCID))
+	}
 
 	if args.NumCPU == 0 {
 		args.NumCPU = runtime.NumCPU()
@@ -483,6 +550,10 @@ func New(args Args) (*Loader, error) {
 		RootIPCNamespace:     kernel.NewIPCNamespace(creds.UserNamespace),
 		PIDNamespace:         kernel.NewRootPIDNamespace(creds.UserNamespace),
 		MaxFDLimit:           maxFDLimit,
+		RecoverSyscallPanics: args.Conf.RecoverSyscallPanics,
+		HugepageCollapse:     hugepageCollapseMode(args.Conf),
+		HostTimeSync:         args.Conf.HostTimeSync,
+		Deterministic:        det.kernelOptions(),
 	}); err != nil {
 		return nil, fmt.Errorf("initializing kernel: %w", err)
 	}
@@ -503,7 +574,10 @@ func New(args Args) (*Loader, error) {
 	// Create a watchdog.
 	dogOpts := watchdog.DefaultOpts
 	dogOpts.TaskTimeoutAction = args.Conf.WatchdogAction
+	dogOpts.StallTimeout = args.Conf.WatchdogStallTimeout
+	dogOpts.StallAction = args.Conf.WatchdogAction
 	dog := watchdog.New(k, dogOpts)
+	addStallDetectors(dog, k)
 
 	procArgs, err := createProcessArgs(args.ID, args.Spec, creds, k, k.RootPIDNamespace())
 	if err != nil {
@@ -514,6 +588,14 @@ func New(args Args) (*Loader, error) {
 	if err := initCompatLogs(args.UserLogFD); err != nil {
 		return nil, fmt.Errorf("initializing compat logs: %w", err)
 	}
+	var compatReportFile *os.File
+	if args.CompatReportFD > 0 {
+		compatReportFile = os.NewFile(uintptr(args.CompatReportFD), "compat report file")
+		kernel.EnableCompatReportPartial()
+	}
+	if args.Conf.SyscallMetrics {
+		kernel.EnableSyscallMetrics()
+	}
 
 	mountHints, err := NewPodMountHints(args.Spec)
 	if err != nil {
@@ -539,12 +621,15 @@ func New(args Args) (*Loader, error) {
 		k:             k,
 		watchdog:      dog,
 		sandboxID:     args.ID,
-		processes:     map[execID]*execProcess{eid: {}},
+		processes:     map[execID]*execProcess{eid: {limits: procArgs.Limits.GetCopy()}},
 		mountHints:    mountHints,
 		sharedMounts:  make(map[string]*vfs.Mount),
 		root:          info,
 		stopProfiling: stopProfiling,
 		productName:   args.ProductName,
+		mfOpts:        mfOpts,
+
+		compatReportFile: compatReportFile,
 	}
 
 	// We don't care about child signals; some platforms can generate a
@@ -673,17 +758,14 @@ func createPlatform(conf *config.Config, deviceFile *os.File) (platform.Platform
 	return p.New(deviceFile)
 }
 
-func createMemoryFile() (*pgalloc.MemoryFile, error) {
+func createMemoryFile(opts pgalloc.MemoryFileOpts) (*pgalloc.MemoryFile, error) {
 	const memfileName = "runsc-memory"
 	memfd, err := memutil.CreateMemFD(memfileName, 0)
 	if err != nil {
 		return nil, fmt.Errorf("error creating memfd: %w", err)
 	}
 	memfile := os.NewFile(uintptr(memfd), memfileName)
-	// We can't enable pgalloc.MemoryFileOpts.UseHostMemcgPressure even if
-	// there are memory cgroups specified, because at this point we're already
-	// in a mount namespace in which the relevant cgroupfs is not visible.
-	mf, err := pgalloc.NewMemoryFile(memfile, pgalloc.MemoryFileOpts{})
+	mf, err := pgalloc.NewMemoryFile(memfile, opts)
 	if err != nil {
 		_ = memfile.Close()
 		return nil, fmt.Errorf("error creating pgalloc.MemoryFile: %w", err)
@@ -699,15 +781,21 @@ func (l *Loader) installSeccompFilters() error {
 	if l.root.conf.DisableSeccomp {
 		log.Warningf("*** SECCOMP WARNING: syscall filter is DISABLED. Running in less secure mode.")
 	} else {
-		hostnet := l.root.conf.Network == config.NetworkHost
+		hostnet := l.root.conf.Network.UsesHostNetwork()
 		opts := filter.Options{
 			Platform:              l.k.Platform.SeccompInfo(),
 			HostNetwork:           hostnet,
 			HostNetworkRawSockets: hostnet && l.root.conf.EnableRaw,
+			HostVsock:             l.root.conf.Vsock == config.VsockHost,
 			HostFilesystem:        l.root.conf.DirectFS,
+			InProcessGofer:        l.root.conf.UnsafeSingleProcess,
 			ProfileEnable:         l.root.conf.ProfileEnable,
 			NVProxy:               specutils.NVProxyEnabled(l.root.spec, l.root.conf),
 			TPUProxy:              specutils.TPUProxyIsEnabled(l.root.spec, l.root.conf),
+			VFIOProxy:             specutils.VFIOProxyEnabled(l.root.conf),
+			DRMProxy:              specutils.DRMProxyEnabled(l.root.conf),
+			PTPProxy:              specutils.PTPProxyEnabled(l.root.conf),
+			HostTimeSync:          l.root.conf.HostTimeSync,
 			ControllerFD:          uint32(l.ctrl.srv.FD()),
 		}
 		if err := filter.Install(opts); err != nil {
@@ -733,7 +821,7 @@ func (l *Loader) Run() error {
 }
 
 func (l *Loader) run() error {
-	if l.root.conf.Network == config.NetworkHost {
+	if l.root.conf.Network.UsesHostNetwork() {
 		// Delay host network configuration to this point because network namespace
 		// is configured after the loader is created and before Run() is called.
 		log.Debugf("Configuring host network")
@@ -912,6 +1000,7 @@ func (l *Loader) startSubcontainer(spec *specs.Spec, conf *config.Config, cid st
 	if err != nil {
 		return fmt.Errorf("creating new process: %w", err)
 	}
+	ep.limits = info.procArgs.Limits.GetCopy()
 
 	// Use stdios or TTY depending on the spec configuration.
 	if spec.Process.Terminal {
@@ -1049,6 +1138,9 @@ func (l *Loader) createContainerProcess(info *containerInfo) (*kernel.ThreadGrou
 	// Install seccomp filters with the new task if there are any.
 	if info.conf.OCISeccomp {
 		if info.spec.Linux != nil && info.spec.Linux.Seccomp != nil {
+			for _, d := range seccomp.Report(info.spec.Linux.Seccomp) {
+				log.Warningf("OCI seccomp profile differs under gVisor: %v", d)
+			}
 			program, err := seccomp.BuildProgram(info.spec.Linux.Seccomp)
 			if err != nil {
 				return nil, nil, fmt.Errorf("building seccomp program: %w", err)
@@ -1067,7 +1159,7 @@ func (l *Loader) createContainerProcess(info *containerInfo) (*kernel.ThreadGrou
 		}
 	} else {
 		if info.spec.Linux != nil && info.spec.Linux.Seccomp != nil {
-			log.Warningf("Seccomp spec is being ignored")
+			log.Warningf("Seccomp spec is being ignored, use --oci-seccomp to apply it")
 		}
 	}
 
@@ -1205,9 +1297,15 @@ func (l *Loader) executeAsync(args *control.ExecArgs) (kernel.ThreadID, error) {
 	}
 	args.PIDNamespace = tg.PIDNamespace()
 
-	args.Limits, err = createLimitSet(l.root.spec)
-	if err != nil {
-		return 0, fmt.Errorf("creating limits: %w", err)
+	// Exec'd processes get the limits from the spec of the container they are
+	// joining, not the ones its init process may have set since.
+	if ep, ok := l.processes[execID{cid: args.ContainerID}]; ok && ep.limits != nil {
+		args.Limits = ep.limits.GetCopy()
+	} else {
+		args.Limits, err = createLimitSet(l.root.spec)
+		if err != nil {
+			return 0, fmt.Errorf("creating limits: %w", err)
+		}
 	}
 
 	// Start the process.
@@ -1308,31 +1406,76 @@ func (l *Loader) WaitExit() linux.WaitStatus {
 	return l.k.GlobalInit().ExitStatus()
 }
 
-func newRootNetworkNamespace(conf *config.Config, clock tcpip.Clock, uniqueID stack.UniqueID, userns *auth.UserNamespace) (*inet.Namespace, error) {
+// readEgressProxyCredentials reads the egress proxy credentials from fd and
+// closes it. It returns an empty string if fd is -1.
+func readEgressProxyCredentials(fd int) (string, error) {
+	if fd < 0 {
+		return "", nil
+	}
+	f := os.NewFile(uintptr(fd), "egress proxy credentials")
+	defer f.Close()
+	creds, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	return string(creds), nil
+}
+
+// newRootNetworkNamespace creates the root network namespace. newRNG returns
+// the source of randomness of each network stack, see
+// deterministicConfig.netstackRNG.
+func newRootNetworkNamespace(conf *config.Config, proxyCreds string, clock tcpip.Clock, uniqueID stack.UniqueID, newRNG func() io.Reader, userns *auth.UserNamespace) (*inet.Namespace, error) {
 	// Create an empty network stack because the network namespace may be empty at
 	// this point. Netns is configured before Run() is called. Netstack is
 	// configured using a control uRPC message. Host network is configured inside
 	// Run().
 	switch conf.Network {
-	case config.NetworkHost:
+	case config.NetworkHost, config.NetworkHybrid:
 		// If configured for raw socket support with host network
 		// stack, make sure that we have CAP_NET_RAW the host,
 		// otherwise we can't make raw sockets.
 		if conf.EnableRaw && !specutils.HasCapabilities(capability.CAP_NET_RAW) {
-			return nil, fmt.Errorf("configuring network=host with raw sockets requires CAP_NET_RAW capability")
+			return nil, fmt.Errorf("configuring network=%v with raw sockets requires CAP_NET_RAW capability", conf.Network)
 		}
-		// No network namespacing support for hostinet yet, hence creator is nil.
-		return inet.NewRootNamespace(hostinet.NewStack(), nil, userns), nil
+		s := hostinet.NewStack()
+		if conf.Network == config.NetworkHost {
+			// No network namespacing support for hostinet yet, hence
+			// creator is nil.
+			return inet.NewRootNamespace(s, nil, userns), nil
+		}
+		// In hybrid mode, network namespaces created by the application
+		// are isolated from the host and get their own netstack, with
+		// only a loopback interface, like in sandbox mode.
+		creator := &sandboxNetstackCreator{
+			clock:                    clock,
+			uniqueID:                 uniqueID,
+			allowPacketEndpointWrite: conf.AllowPacketEndpointWrite,
+			newRNG:                   newRNG,
+		}
+		return inet.NewRootNamespace(s, creator, userns), nil
 
 	case config.NetworkNone, config.NetworkSandbox:
-		s, err := newEmptySandboxNetworkStack(clock, uniqueID, conf.AllowPacketEndpointWrite)
+		s, err := newEmptySandboxNetworkStack(clock, uniqueID, conf.AllowPacketEndpointWrite, newRNG())
 		if err != nil {
 			return nil, err
 		}
+		if conf.EgressProxy != "" {
+			proxy, err := egressproxy.Parse(conf.EgressProxy, conf.GetEgressProxyBypass())
+			if err != nil {
+				return nil, fmt.Errorf("invalid egress proxy: %w", err)
+			}
+			if proxyCreds != "" {
+				if err := proxy.SetCredentials(proxyCreds); err != nil {
+					return nil, fmt.Errorf("invalid egress proxy credentials: %w", err)
+				}
+			}
+			s.(*netstack.Stack).EgressProxy = proxy
+		}
 		creator := &sandboxNetstackCreator{
 			clock:                    clock,
 			uniqueID:                 uniqueID,
 			allowPacketEndpointWrite: conf.AllowPacketEndpointWrite,
+			newRNG:                   newRNG,
 		}
 		return inet.NewRootNamespace(s, creator, userns), nil
 
@@ -1342,8 +1485,27 @@ func newRootNetworkNamespace(conf *config.Config, clock tcpip.Clock, uniqueID st
 
 }
 
-func newEmptySandboxNetworkStack(clock tcpip.Clock, uniqueID stack.UniqueID, allowPacketEndpointWrite bool) (inet.Stack, error) {
-	netProtos := []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol, arp.NewProtocol}
+// newEmptySandboxNetworkStack creates a netstack with no interfaces. rng, if
+// not nil, is the stack's source of randomness.
+func newEmptySandboxNetworkStack(clock tcpip.Clock, uniqueID stack.UniqueID, allowPacketEndpointWrite bool, rng io.Reader) (inet.Stack, error) {
+	if rng == nil {
+		rng = rand.Reader
+	}
+	// Seed used to generate SLAAC temporary addresses, see
+	// ipv6.Options.TempIIDSeed.
+	tempIIDSeed := make([]byte, header.IIDSize)
+	if _, err := io.ReadFull(rng, tempIIDSeed); err != nil {
+		return nil, fmt.Errorf("generating temporary address seed: %w", err)
+	}
+	ac := autoconf.New()
+	netProtos := []stack.NetworkProtocolFactory{
+		ipv4.NewProtocol,
+		ipv6.NewProtocolWithOptions(ipv6.Options{
+			NDPDisp:     ac,
+			TempIIDSeed: tempIIDSeed,
+		}),
+		arp.NewProtocol,
+	}
 	transProtos := []stack.TransportProtocolFactory{
 		tcp.NewProtocol,
 		udp.NewProtocol,
@@ -1362,7 +1524,10 @@ func newEmptySandboxNetworkStack(clock tcpip.Clock, uniqueID stack.UniqueID, all
 		AllowPacketEndpointWrite: allowPacketEndpointWrite,
 		UniqueID:                 uniqueID,
 		DefaultIPTables:          netfilter.DefaultLinuxTables,
+		SecureRNG:                rng,
 	})}
+	ac.Start(s.Stack)
+	s.Autoconf = ac
 
 	// Enable SACK Recovery.
 	{
@@ -1401,11 +1566,19 @@ type sandboxNetstackCreator struct {
 	clock                    tcpip.Clock
 	uniqueID                 stack.UniqueID
 	allowPacketEndpointWrite bool
+
+	// newRNG is newRootNetworkNamespace's newRNG. It isn't saved, since
+	// deterministic mode doesn't support save/restore.
+	newRNG func() io.Reader `state:"nosave"`
 }
 
 // CreateStack implements kernel.NetworkStackCreator.CreateStack.
 func (f *sandboxNetstackCreator) CreateStack() (inet.Stack, error) {
-	s, err := newEmptySandboxNetworkStack(f.clock, f.uniqueID, f.allowPacketEndpointWrite)
+	var rng io.Reader
+	if f.newRNG != nil {
+		rng = f.newRNG()
+	}
+	s, err := newEmptySandboxNetworkStack(f.clock, f.uniqueID, f.allowPacketEndpointWrite, rng)
 	if err != nil {
 		return nil, err
 	}
@@ -1645,7 +1818,7 @@ func (l *Loader) portForward(opts *PortForwardOpts) error {
 			return fmt.Errorf("creating netstack port forward connection: %w", err)
 		}
 		pair.From = nsConn
-	case config.NetworkHost:
+	case config.NetworkHost, config.NetworkHybrid:
 		hConn, err := pf.NewHostInetConn(opts.Port)
 		if err != nil {
 			return fmt.Errorf("creating hostinet port forward connection: %w", err)
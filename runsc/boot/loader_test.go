@@ -144,6 +144,8 @@ func createLoader(conf *config.Config, spec *specs.Spec) (*Loader, func(), error
 		GoferMountConfs: []GoferMountConf{{Lower: Lisafs, Upper: NoOverlay}},
 		PodInitConfigFD: -1,
 		ExecFD:          -1,
+
+		EgressProxyCredentialsFD: -1,
 	}
 	l, err := New(args)
 	if err != nil {
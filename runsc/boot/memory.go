@@ -0,0 +1,125 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
+	"gvisor.dev/gvisor/runsc/config"
+)
+
+// hostNodesDir is where the host's NUMA nodes are listed.
+const hostNodesDir = "/sys/devices/system/node"
+
+// LocalNUMANodes returns the host NUMA nodes of the CPUs that the calling
+// thread may run on, sorted. It returns no nodes if the host doesn't report
+// NUMA topology. It must be called before the sandbox is chrooted, since it
+// reads sysfs.
+func LocalNUMANodes() ([]int, error) {
+	var cpus unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &cpus); err != nil {
+		return nil, fmt.Errorf("sched_getaffinity: %w", err)
+	}
+	dirs, err := filepath.Glob(filepath.Join(hostNodesDir, "node[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+	var nodes []int
+	for _, dir := range dirs {
+		node, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "node"))
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "cpulist"))
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(string(data)) == "" {
+			// Memory-only node.
+			continue
+		}
+		nodeCPUs, err := config.ParseNodeList(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", dir, err)
+		}
+		for _, cpu := range nodeCPUs {
+			if cpus.IsSet(cpu) {
+				nodes = append(nodes, node)
+				break
+			}
+		}
+	}
+	sort.Ints(nodes)
+	return nodes, nil
+}
+
+// memoryFileOpts returns the options of the sandbox's main MemoryFile.
+// localNodes are the nodes used by config.NUMAPolicyLocal, see
+// LocalNUMANodes.
+func memoryFileOpts(conf *config.Config, localNodes []int) (pgalloc.MemoryFileOpts, error) {
+	// We can't enable pgalloc.MemoryFileOpts.UseHostMemcgPressure even if
+	// there are memory cgroups specified, because at this point we're already
+	// in a mount namespace in which the relevant cgroupfs is not visible.
+	opts := pgalloc.MemoryFileOpts{
+		AdviseHugepage: conf.MemoryHugepages,
+	}
+	mode, nodes, err := conf.GetMemoryNUMAPolicy()
+	if err != nil {
+		return pgalloc.MemoryFileOpts{}, err
+	}
+	switch mode {
+	case "":
+		return opts, nil
+	case config.NUMAPolicyLocal:
+		if len(localNodes) == 0 {
+			log.Warningf("memory-numa-policy=%s: host NUMA nodes are unknown, using the host's default policy", mode)
+			return opts, nil
+		}
+		opts.NUMAPolicy = pgalloc.NUMAPolicy{Mode: linux.MPOL_BIND, Nodes: localNodes}
+	case config.NUMAPolicyPreferred:
+		opts.NUMAPolicy = pgalloc.NUMAPolicy{Mode: linux.MPOL_PREFERRED, Nodes: nodes}
+	case config.NUMAPolicyBind:
+		opts.NUMAPolicy = pgalloc.NUMAPolicy{Mode: linux.MPOL_BIND, Nodes: nodes}
+	case config.NUMAPolicyInterleave:
+		opts.NUMAPolicy = pgalloc.NUMAPolicy{Mode: linux.MPOL_INTERLEAVE, Nodes: nodes}
+	default:
+		panic(fmt.Sprintf("unknown NUMA policy mode %q", mode))
+	}
+	log.Infof("Memory NUMA policy: %s, nodes: %v", mode, opts.NUMAPolicy.Nodes)
+	return opts, nil
+}
+
+// hugepageCollapseMode returns the background huge page collapse mode
+// configured by conf.
+func hugepageCollapseMode(conf *config.Config) mm.HugepageCollapseMode {
+	switch conf.MemoryHugepageCollapse {
+	case config.HugepageCollapseMadvise:
+		return mm.HugepageCollapseMadvise
+	case config.HugepageCollapseAlways:
+		return mm.HugepageCollapseAlways
+	default:
+		return mm.HugepageCollapseNever
+	}
+}
@@ -15,11 +15,13 @@
 package boot
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 
@@ -28,7 +30,10 @@ import (
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/socket/netfilter"
+	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/autoconf"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
 	"gvisor.dev/gvisor/pkg/tcpip/link/ethernet"
 	"gvisor.dev/gvisor/pkg/tcpip/link/fdbased"
 	"gvisor.dev/gvisor/pkg/tcpip/link/loopback"
@@ -73,6 +78,31 @@ var (
 type Network struct {
 	Stack  *stack.Stack
 	Kernel *kernel.Kernel
+
+	// Autoconf autoconfigures IPv6 on links that request it. It may be nil
+	// if the stack doesn't support IPv6 autoconfiguration.
+	Autoconf *autoconf.Client
+
+	mu sync.Mutex
+
+	// links holds the fd-based links created by CreateLinksAndRoutes, by name.
+	//
+	// +checklocks:mu
+	links map[string]*fdLink
+
+	// restoredLinks holds the configuration of the fd-based links saved in
+	// the checkpoint that the sandbox was restored from, if any.
+	//
+	// +checklocks:mu
+	restoredLinks []LinkConfig
+}
+
+// fdLink is an fd-based link whose configuration can be changed by
+// UpdateLink.
+type fdLink struct {
+	ep     fdbased.Reconfigurable
+	fds    []int
+	config LinkConfig
 }
 
 // Route represents a route in the network stack.
@@ -111,6 +141,10 @@ type FDBasedLink struct {
 	// NumChannels controls how many underlying FDs are to be used to
 	// create this endpoint.
 	NumChannels int
+
+	// IPv6Autoconf is the IPv6 autoconfiguration mode of the link, one of
+	// the config.IPv6Autoconf* values. Empty means config.IPv6AutoconfNone.
+	IPv6Autoconf string
 }
 
 // BindOpt indicates whether the sentry or runsc process is responsible for
@@ -153,6 +187,40 @@ type LoopbackLink struct {
 	GvisorGROTimeout time.Duration
 }
 
+// VFLink describes an SR-IOV virtual function that is passed through to the
+// sandbox with vfioproxy. Packets on the VF are handled by a userspace driver
+// in the sandbox, not by netstack, so the link is only created for visibility
+// in netlink and is never brought up.
+type VFLink struct {
+	Name        string
+	LinkAddress net.HardwareAddr
+	MTU         int
+}
+
+// CreateVFLinksArgs are arguments to CreateVFLinks.
+type CreateVFLinksArgs struct {
+	Links []VFLink
+}
+
+// LinkConfig is the configuration of an fd-based link that can be changed
+// while the sandbox is running.
+type LinkConfig struct {
+	Name              string
+	MTU               int
+	NumChannels       int
+	TXChecksumOffload bool
+	RXChecksumOffload bool
+}
+
+// UpdateLinkArgs are arguments to UpdateLink.
+type UpdateLinkArgs struct {
+	// FilePayload contains the new FDs of the link, one per channel, if the
+	// number of channels changes. Otherwise, it is empty.
+	urpc.FilePayload
+
+	LinkConfig
+}
+
 // CreateLinksAndRoutesArgs are arguments to CreateLinkAndRoutes.
 type CreateLinksAndRoutesArgs struct {
 	// FilePayload contains the fds associated with the FDBasedLinks. The
@@ -241,6 +309,9 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 	var nicID tcpip.NICID
 	nicids := make(map[string]tcpip.NICID)
 
+	// NICs to autoconfigure once routes are set, by NIC ID.
+	autoconfModes := make(map[tcpip.NICID]autoconf.Mode)
+
 	// Collect routes from all links.
 	var routes []tcpip.Route
 
@@ -319,6 +390,8 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 				return err
 			}
 
+			inEP := n.wrapInbound(link.Name, linkEP)
+
 			// Wrap linkEP in a sniffer to enable packet logging.
 			var sniffEP stack.LinkEndpoint
 			if args.PCAP {
@@ -327,13 +400,13 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 					return fmt.Errorf("failed to dup pcap FD: %v", err)
 				}
 				const packetTruncateSize = 4096
-				sniffEP, err = sniffer.NewWithWriter(packetsocket.New(linkEP), os.NewFile(uintptr(newFD), "pcap-file"), packetTruncateSize)
+				sniffEP, err = sniffer.NewWithWriter(packetsocket.New(inEP), os.NewFile(uintptr(newFD), "pcap-file"), packetTruncateSize)
 				if err != nil {
 					return fmt.Errorf("failed to create PCAP logger: %v", err)
 				}
 				fdOffset++
 			} else {
-				sniffEP = sniffer.New(packetsocket.New(linkEP))
+				sniffEP = sniffer.New(packetsocket.New(inEP))
 			}
 
 			var qDisc stack.QueueingDiscipline
@@ -350,9 +423,23 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 				QDisc:      qDisc,
 				GROTimeout: link.GvisorGROTimeout,
 			}
+			if link.IPv6Autoconf != "" && link.IPv6Autoconf != config.IPv6AutoconfNone {
+				mode, err := autoconf.ParseMode(link.IPv6Autoconf)
+				if err != nil {
+					return fmt.Errorf("interface %q: %w", link.Name, err)
+				}
+				if n.Autoconf == nil {
+					return fmt.Errorf("interface %q: IPv6 autoconfiguration is not supported by the network stack", link.Name)
+				}
+				// The NIC is enabled by the autoconfiguration client, so that
+				// it solicits routers with autoconfiguration in place.
+				opts.Disabled = true
+				autoconfModes[nicID] = mode
+			}
 			if err := n.createNICWithAddrs(nicID, sniffEP, opts, link.Addresses); err != nil {
 				return err
 			}
+			n.addLink(link, linkEP.(fdbased.Reconfigurable), FDs)
 
 			// Collect the routes from this link.
 			for _, r := range link.Routes {
@@ -411,6 +498,8 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 			return err
 		}
 
+		inEP := n.wrapInbound(link.Name, linkEP)
+
 		// Wrap linkEP in a sniffer to enable packet logging.
 		var sniffEP stack.LinkEndpoint
 		if args.PCAP {
@@ -419,13 +508,13 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 				return fmt.Errorf("failed to dup pcap FD: %v", err)
 			}
 			const packetTruncateSize = 4096
-			sniffEP, err = sniffer.NewWithWriter(packetsocket.New(linkEP), os.NewFile(uintptr(newFD), "pcap-file"), packetTruncateSize)
+			sniffEP, err = sniffer.NewWithWriter(packetsocket.New(inEP), os.NewFile(uintptr(newFD), "pcap-file"), packetTruncateSize)
 			if err != nil {
 				return fmt.Errorf("failed to create PCAP logger: %v", err)
 			}
 			fdOffset++
 		} else {
-			sniffEP = sniffer.New(packetsocket.New(linkEP))
+			sniffEP = sniffer.New(packetsocket.New(inEP))
 		}
 
 		var qDisc stack.QueueingDiscipline
@@ -488,6 +577,12 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 	log.Infof("Setting routes %+v", routes)
 	n.Stack.SetRouteTable(routes)
 
+	for nicID, mode := range autoconfModes {
+		if err := n.Autoconf.Enable(nicID, mode); err != nil {
+			return fmt.Errorf("enabling IPv6 autoconfiguration of NIC %d: %w", nicID, err)
+		}
+	}
+
 	// Set NAT table rules if necessary.
 	if args.NATBlob {
 		log.Infof("Replacing NAT table")
@@ -504,6 +599,179 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 	return nil
 }
 
+// wrapInbound wraps linkEP, the endpoint of the link with the given name, to
+// record or replay its inbound packets as external inputs in deterministic
+// mode.
+func (n *Network) wrapInbound(name string, linkEP stack.LinkEndpoint) stack.LinkEndpoint {
+	if n.Kernel == nil || !n.Kernel.Deterministic() {
+		return linkEP
+	}
+	return newDetLinkEndpoint(n.Kernel, name, linkEP)
+}
+
+// addLink records an fd-based link, so that its configuration can be changed
+// by UpdateLink.
+func (n *Network) addLink(link FDBasedLink, ep fdbased.Reconfigurable, fds []int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.links == nil {
+		n.links = make(map[string]*fdLink)
+	}
+	n.links[link.Name] = &fdLink{
+		ep:  ep,
+		fds: fds,
+		config: LinkConfig{
+			Name:              link.Name,
+			MTU:               link.MTU,
+			NumChannels:       link.NumChannels,
+			TXChecksumOffload: link.TXChecksumOffload,
+			RXChecksumOffload: link.RXChecksumOffload,
+		},
+	}
+}
+
+// Links returns the current configuration of the fd-based links, sorted by
+// name.
+func (n *Network) Links(_ *struct{}, links *[]LinkConfig) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	*links = n.linksLocked()
+	return nil
+}
+
+// +checklocks:n.mu
+func (n *Network) linksLocked() []LinkConfig {
+	links := make([]LinkConfig, 0, len(n.links))
+	for _, link := range n.links {
+		links = append(links, link.config)
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].Name < links[j].Name })
+	return links
+}
+
+// UpdateLink changes the configuration of an fd-based link. Packets that are
+// in flight may be dropped while the number of channels changes.
+func (n *Network) UpdateLink(args *UpdateLinkArgs, _ *struct{}) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	link, ok := n.links[args.Name]
+	if !ok {
+		return fmt.Errorf("fd-based link %q not found", args.Name)
+	}
+	if args.MTU <= 0 {
+		return fmt.Errorf("invalid MTU %d", args.MTU)
+	}
+	if args.NumChannels <= 0 {
+		return fmt.Errorf("invalid number of channels %d", args.NumChannels)
+	}
+
+	if len(args.FilePayload.Files) != 0 {
+		if got := len(args.FilePayload.Files); got != args.NumChannels {
+			return fmt.Errorf("args.FilePayload.Files has %d FDs but the link has %d channels", got, args.NumChannels)
+		}
+		fds := make([]int, 0, args.NumChannels)
+		closeFDs := func(fds []int) {
+			for _, fd := range fds {
+				unix.Close(fd)
+			}
+		}
+		for _, f := range args.FilePayload.Files {
+			fd, err := unix.Dup(int(f.Fd()))
+			if err != nil {
+				closeFDs(fds)
+				return fmt.Errorf("failed to dup FD %v: %v", f.Fd(), err)
+			}
+			fds = append(fds, fd)
+		}
+		if err := link.ep.SetFDs(fds); err != nil {
+			closeFDs(fds)
+			return fmt.Errorf("replacing FDs of link %q: %w", args.Name, err)
+		}
+		closeFDs(link.fds)
+		link.fds = fds
+	} else if args.NumChannels != link.config.NumChannels {
+		return fmt.Errorf("changing the number of channels of link %q from %d to %d requires new FDs", args.Name, link.config.NumChannels, args.NumChannels)
+	}
+	link.ep.SetMTU(uint32(args.MTU))
+	link.ep.SetChecksumOffload(args.TXChecksumOffload, args.RXChecksumOffload)
+
+	log.Infof("Updated interface %q from %+v to %+v", args.Name, link.config, args.LinkConfig)
+	link.config = args.LinkConfig
+	return nil
+}
+
+// RestoredLinks returns the configuration of the fd-based links saved in the
+// checkpoint that the sandbox was restored from. The links created when the
+// sandbox was restored may be configured differently, e.g. if their
+// configuration was changed by UpdateLink before the checkpoint.
+func (n *Network) RestoredLinks(_ *struct{}, links *[]LinkConfig) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	*links = n.restoredLinks
+	return nil
+}
+
+// linksMetadataKey is the checkpoint metadata key for the configuration of
+// fd-based links.
+const linksMetadataKey = "network_links"
+
+// saveLinks adds the configuration of the fd-based links to the checkpoint
+// metadata.
+func (n *Network) saveLinks(metadata map[string]string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.links) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(n.linksLocked())
+	if err != nil {
+		return err
+	}
+	metadata[linksMetadataKey] = string(b)
+	return nil
+}
+
+// loadLinks reads the configuration of the fd-based links from the metadata
+// of the checkpoint that the sandbox was restored from.
+func (n *Network) loadLinks(metadata map[string]string) error {
+	val, ok := metadata[linksMetadataKey]
+	if !ok {
+		return nil
+	}
+	var links []LinkConfig
+	if err := json.Unmarshal([]byte(val), &links); err != nil {
+		return fmt.Errorf("parsing %s metadata: %w", linksMetadataKey, err)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.restoredLinks = links
+	return nil
+}
+
+// CreateVFLinks creates links for SR-IOV virtual functions, after the links
+// created by CreateLinksAndRoutes.
+func (n *Network) CreateVFLinks(args *CreateVFLinksArgs, _ *struct{}) error {
+	var nicID tcpip.NICID
+	for id := range n.Stack.NICInfo() {
+		nicID = max(nicID, id)
+	}
+	for _, link := range args.Links {
+		nicID++
+		mac := tcpip.LinkAddress(link.LinkAddress)
+		linkEP := packetsocket.New(ethernet.New(channel.New(0, uint32(link.MTU), mac)))
+
+		log.Infof("Creating interface %q with id %d (%v), managed by a userspace driver", link.Name, nicID, mac)
+		opts := stack.NICOptions{
+			Name:     link.Name,
+			Disabled: true,
+		}
+		if err := n.Stack.CreateNICWithOptions(nicID, linkEP, opts); err != nil {
+			return fmt.Errorf("CreateNICWithOptions(%d, _, %+v) failed: %v", nicID, opts, err)
+		}
+	}
+	return nil
+}
+
 // createNICWithAddrs creates a NIC in the network stack and adds the given
 // addresses.
 func (n *Network) createNICWithAddrs(id tcpip.NICID, ep stack.LinkEndpoint, opts stack.NICOptions, addrs []IPWithPrefix) error {
@@ -32,6 +32,13 @@ type restorer struct {
 	container  *containerInfo
 	stateFile  *os.File
 	deviceFile *os.File
+
+	// key is used for the state file's integrity check.
+	key []byte
+
+	// precopied, if not nil, contains the memory pre-copied ahead of the
+	// save of the state file.
+	precopied *os.File
 }
 
 func (r *restorer) restore(l *Loader) error {
@@ -50,7 +57,7 @@ func (r *restorer) restore(l *Loader) error {
 		Platform: p,
 	}
 
-	mf, err := createMemoryFile()
+	mf, err := createMemoryFile(l.mfOpts)
 	if err != nil {
 		return fmt.Errorf("creating memory file: %v", err)
 	}
@@ -78,15 +85,26 @@ func (r *restorer) restore(l *Loader) error {
 	}
 
 	// Load the state.
-	loadOpts := state.LoadOpts{Source: r.stateFile}
+	loadOpts := state.LoadOpts{Source: r.stateFile, Key: r.key}
+	if r.precopied != nil {
+		loadOpts.Precopied = r.precopied
+	}
 	if err := loadOpts.Load(ctx, l.k, nil, curNetwork, time.NewCalibratedClocks(), &vfs.CompleteRestoreOptions{}); err != nil {
 		return err
 	}
+	if n := l.ctrl.network; n != nil {
+		if err := n.loadLinks(state.PreviousMetadata()); err != nil {
+			return err
+		}
+	}
 
 	// Since we have a new kernel we also must make a new watchdog.
 	dogOpts := watchdog.DefaultOpts
 	dogOpts.TaskTimeoutAction = l.root.conf.WatchdogAction
+	dogOpts.StallTimeout = l.root.conf.WatchdogStallTimeout
+	dogOpts.StallAction = l.root.conf.WatchdogAction
 	dog := watchdog.New(l.k, dogOpts)
+	addStallDetectors(dog, l.k)
 
 	// Change the loader fields to reflect the changes made when restoring.
 	l.watchdog = dog
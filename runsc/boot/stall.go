@@ -0,0 +1,99 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/lisafs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/platform"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netstack"
+	"gvisor.dev/gvisor/pkg/sentry/watchdog"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+)
+
+// addStallDetectors makes dog monitor gofer RPCs, netstack packet dispatch and
+// platform context queues for stalls.
+func addStallDetectors(dog *watchdog.Watchdog, k *kernel.Kernel) {
+	dog.AddStallDetector(watchdog.StallDetector{
+		Subsystem: watchdog.SubsystemGofer,
+		Queues:    goferQueues,
+	})
+	dog.AddStallDetector(watchdog.StallDetector{
+		Subsystem: watchdog.SubsystemNetstack,
+		Queues: func() []watchdog.Queue {
+			return netstackQueues(k)
+		},
+	})
+	if r, ok := k.Platform.(platform.ContextQueueReporter); ok {
+		dog.AddStallDetector(watchdog.StallDetector{
+			Subsystem: watchdog.SubsystemPlatform,
+			Queues: func() []watchdog.Queue {
+				return platformQueues(r)
+			},
+		})
+	}
+}
+
+// goferQueues reports every RPC waiting on a gofer as its own queue.
+func goferQueues() []watchdog.Queue {
+	rpcs := lisafs.InflightRPCs()
+	queues := make([]watchdog.Queue, 0, len(rpcs))
+	for _, rpc := range rpcs {
+		queues = append(queues, watchdog.Queue{
+			Name:    fmt.Sprintf("%s (%v)", rpc.Comm, rpc.MID),
+			Pending: 1,
+			Since:   rpc.Start,
+		})
+	}
+	return queues
+}
+
+// netstackQueues reports the queues of the TCP packet processors of the root
+// network namespace, if it uses netstack.
+func netstackQueues(k *kernel.Kernel) []watchdog.Queue {
+	s, ok := k.RootNetworkNamespace().Stack().(*netstack.Stack)
+	if !ok {
+		return nil
+	}
+	states := tcp.ProcessorStates(s.Stack)
+	queues := make([]watchdog.Queue, 0, len(states))
+	for i, state := range states {
+		q := watchdog.Queue{
+			Name: fmt.Sprintf("tcp processor %d", i),
+			Done: state.Processed,
+		}
+		if state.Pending {
+			q.Pending = 1
+		}
+		queues = append(queues, q)
+	}
+	return queues
+}
+
+// platformQueues reports the platform's context queues.
+func platformQueues(r platform.ContextQueueReporter) []watchdog.Queue {
+	states := r.ContextQueues()
+	queues := make([]watchdog.Queue, 0, len(states))
+	for _, state := range states {
+		queues = append(queues, watchdog.Queue{
+			Name:    state.Name,
+			Pending: state.Queued,
+			Done:    state.Dequeued,
+		})
+	}
+	return queues
+}
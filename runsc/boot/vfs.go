@@ -36,11 +36,14 @@ import (
 	"gvisor.dev/gvisor/pkg/fspath"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/devices/accel"
+	"gvisor.dev/gvisor/pkg/sentry/devices/drmproxy"
 	"gvisor.dev/gvisor/pkg/sentry/devices/memdev"
 	"gvisor.dev/gvisor/pkg/sentry/devices/nvproxy"
+	"gvisor.dev/gvisor/pkg/sentry/devices/ptpproxy"
 	"gvisor.dev/gvisor/pkg/sentry/devices/tpuproxy"
 	"gvisor.dev/gvisor/pkg/sentry/devices/ttydev"
 	"gvisor.dev/gvisor/pkg/sentry/devices/tundev"
+	"gvisor.dev/gvisor/pkg/sentry/devices/vfioproxy"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/cgroupfs"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/dev"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/devpts"
@@ -169,6 +172,18 @@ func registerFilesystems(k *kernel.Kernel, info *containerInfo) error {
 		return err
 	}
 
+	if err := vfioProxyRegisterDevices(info, vfsObj); err != nil {
+		return err
+	}
+
+	if err := drmProxyRegisterDevices(info, vfsObj); err != nil {
+		return err
+	}
+
+	if err := ptpProxyRegisterDevices(info, vfsObj); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -202,6 +217,20 @@ func setupContainerVFS(ctx context.Context, info *containerInfo, mntr *container
 				procArgs.InitialCgroups = make(map[kernel.Cgroup]struct{}, len(kernel.CgroupCtrls))
 			}
 			procArgs.InitialCgroups[cg] = struct{}{}
+			if ctrl == kernel.CgroupControllerMisc {
+				if err := setGPUMemoryLimit(ctx, info.spec, cg); err != nil {
+					return err
+				}
+			}
+			if ctrl == kernel.CgroupControllerPIDs && info.conf.Cgroupless {
+				if err := setPIDsLimit(ctx, info.spec, cg); err != nil {
+					return err
+				}
+			}
+		}
+	} else if info.conf.Cgroupless {
+		if err := mntr.setupPIDsCgroup(rootCtx, rootCreds, info.spec, procArgs); err != nil {
+			return err
 		}
 	}
 
@@ -225,6 +254,76 @@ func setupContainerVFS(ctx context.Context, info *containerInfo, mntr *container
 	return nil
 }
 
+// setGPUMemoryLimit limits the GPU memory that the container can allocate
+// through nvproxy, if requested by the spec, by setting the limit of its misc
+// cgroup.
+func setGPUMemoryLimit(ctx context.Context, spec *specs.Spec, cg kernel.Cgroup) error {
+	limit, ok, err := specutils.GPUMemoryLimit(spec)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	if err := cg.WriteControl(ctx, "misc.max", fmt.Sprintf("gpu_mem %d", limit)); err != nil {
+		return fmt.Errorf("setting GPU memory limit to %d: %w", limit, err)
+	}
+	log.Infof("Limited GPU memory of cgroup %q to %d bytes", cg.Path(), limit)
+	return nil
+}
+
+// pidsLimit returns the PIDs limit in spec, if any.
+func pidsLimit(spec *specs.Spec) (int64, bool) {
+	if spec.Linux == nil || spec.Linux.Resources == nil || spec.Linux.Resources.Pids == nil || spec.Linux.Resources.Pids.Limit <= 0 {
+		return 0, false
+	}
+	return spec.Linux.Resources.Pids.Limit, true
+}
+
+// setPIDsLimit limits the number of tasks in the pids cgroup cg to the PIDs
+// limit in spec. It's used with --cgroupless, where no host cgroup enforces
+// the limit.
+func setPIDsLimit(ctx context.Context, spec *specs.Spec, cg kernel.Cgroup) error {
+	limit, ok := pidsLimit(spec)
+	if !ok {
+		return nil
+	}
+	if err := cg.WriteControl(ctx, "pids.max", strconv.FormatInt(limit, 10)); err != nil {
+		return fmt.Errorf("setting PIDs limit to %d: %w", limit, err)
+	}
+	log.Infof("Limited PIDs of cgroup %q to %d", cg.Path(), limit)
+	return nil
+}
+
+// setupPIDsCgroup creates the container's pids cgroup, which is otherwise
+// only created if the container mounts cgroupfs, limits it with
+// setPIDsLimit, and places the container's initial process in it.
+func (c *containerMounter) setupPIDsCgroup(ctx context.Context, creds *auth.Credentials, spec *specs.Spec, procArgs *kernel.CreateProcessArgs) error {
+	if _, ok := pidsLimit(spec); !ok {
+		return nil
+	}
+	ctrlName := string(kernel.CgroupControllerPIDs)
+	cgroupMnt, ok := c.cgroupMounts[ctrlName]
+	if !ok {
+		return fmt.Errorf("cgroup mount for controller %s not found", ctrlName)
+	}
+	cgroupMntVD := vfs.MakeVirtualDentry(cgroupMnt.mount, cgroupMnt.root)
+	pop := vfs.PathOperation{
+		Root:  cgroupMntVD,
+		Start: cgroupMntVD,
+		Path:  fspath.Parse(c.containerID),
+	}
+	if err := c.k.VFS().MkdirAt(ctx, creds, &pop, &vfs.MkdirOptions{Mode: 0755}); err != nil {
+		return fmt.Errorf("creating cgroup for controller %s: %w", ctrlName, err)
+	}
+	cg, err := c.k.CgroupRegistry().FindCgroup(ctx, kernel.CgroupControllerPIDs, "/"+c.containerID)
+	if err != nil {
+		return fmt.Errorf("cgroup for controller %s not found: %w", ctrlName, err)
+	}
+	procArgs.InitialCgroups = map[kernel.Cgroup]struct{}{cg: {}}
+	return setPIDsLimit(ctx, spec, cg)
+}
+
 // compileMounts returns the supported mounts from the mount spec, adding any
 // mandatory mounts that are required by the OCI specification.
 //
@@ -313,6 +412,12 @@ func goferMountData(fd int, fa config.FileAccessType, conf *config.Config) []str
 	if !conf.HostFifo.AllowOpen() {
 		opts = append(opts, "disable_fifo_open")
 	}
+	if conf.VerifyVerity {
+		opts = append(opts, "verity")
+	}
+	if conf.GoferChannels > 0 {
+		opts = append(opts, "channels="+strconv.Itoa(conf.GoferChannels))
+	}
 	return opts
 }
 
@@ -513,6 +618,9 @@ func (c *containerMounter) createMountNamespace(ctx context.Context, conf *confi
 		// Configure the gofer dentry cache size.
 		gofer.SetDentryCacheSize(conf.DCache)
 
+		// Configure the gofer host FD cache size.
+		gofer.SetHostFDCacheSize(conf.HostFDCache)
+
 		opts = &vfs.MountOptions{
 			ReadOnly: c.root.Readonly,
 			GetFilesystemOptions: vfs.GetFilesystemOptions{
@@ -887,7 +995,7 @@ func getMountNameAndOptions(spec *specs.Spec, conf *config.Config, m *mountInfo,
 		fsName = sys.Name
 
 	case sys.Name:
-		sysData := &sys.InternalData{EnableTPUProxyPaths: specutils.TPUProxyIsEnabled(spec, conf)}
+		sysData := &sys.InternalData{EnableTPUProxyPaths: specutils.TPUProxyIsEnabled(spec, conf) || specutils.VFIOFunctionalityRequested(spec, conf)}
 		if len(productName) > 0 {
 			sysData.ProductName = productName
 		}
@@ -1345,6 +1453,21 @@ func createDeviceFiles(ctx context.Context, creds *auth.Credentials, info *conta
 			}
 		}
 	}
+	if specutils.VFIOFunctionalityRequested(info.spec, info.conf) {
+		// The VFIO container device is required to use VFIO groups, but may
+		// not be in the spec.
+		hasContainerDev := false
+		for _, dev := range info.spec.Linux.Devices {
+			hasContainerDev = hasContainerDev || dev.Path == specutils.VFIOContainerDevicePath
+		}
+		if !hasContainerDev {
+			mode := os.FileMode(0666)
+			containerDev := specs.LinuxDevice{Path: specutils.VFIOContainerDevicePath, Type: "c", Major: linux.MISC_MAJOR, Minor: linux.VFIO_MINOR, FileMode: &mode}
+			if err := createDeviceFile(ctx, creds, info, vfsObj, root, containerDev); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -1433,6 +1556,66 @@ func tpuProxyRegisterDevices(info *containerInfo, vfsObj *vfs.VirtualFilesystem)
 	return nil
 }
 
+func vfioProxyRegisterDevices(info *containerInfo, vfsObj *vfs.VirtualFilesystem) error {
+	if !specutils.VFIOProxyEnabled(info.conf) {
+		return nil
+	}
+	// VFIO group major device numbers are dynamically assigned on the host;
+	// use the same numbers as the device files created from the spec.
+	var groups []vfioproxy.Group
+	for _, dev := range specutils.VFIOGroupDevices(info.spec) {
+		name, _ := specutils.VFIOGroupName(dev.Path)
+		groups = append(groups, vfioproxy.Group{
+			Name:  name,
+			Major: uint32(dev.Major),
+			Minor: uint32(dev.Minor),
+		})
+	}
+	if err := vfioproxy.Register(vfsObj, groups); err != nil {
+		return fmt.Errorf("registering vfioproxy driver: %w", err)
+	}
+	return nil
+}
+
+func drmProxyRegisterDevices(info *containerInfo, vfsObj *vfs.VirtualFilesystem) error {
+	if !specutils.DRMProxyEnabled(info.conf) {
+		return nil
+	}
+	var nodes []drmproxy.RenderNode
+	for _, dev := range specutils.DRMRenderNodeDevices(info.spec) {
+		name, _ := specutils.DRMRenderNodeName(dev.Path)
+		nodes = append(nodes, drmproxy.RenderNode{
+			Name:  name,
+			Minor: uint32(dev.Minor),
+		})
+	}
+	if err := drmproxy.Register(vfsObj, nodes); err != nil {
+		return fmt.Errorf("registering drmproxy driver: %w", err)
+	}
+	return nil
+}
+
+func ptpProxyRegisterDevices(info *containerInfo, vfsObj *vfs.VirtualFilesystem) error {
+	if !specutils.PTPProxyEnabled(info.conf) {
+		return nil
+	}
+	// PTP clock major device numbers are dynamically assigned on the host;
+	// use the same numbers as the device files created from the spec.
+	var clocks []ptpproxy.Clock
+	for _, dev := range specutils.PTPClockDevices(info.spec) {
+		name, _ := specutils.PTPClockName(dev.Path)
+		clocks = append(clocks, ptpproxy.Clock{
+			Name:  name,
+			Major: uint32(dev.Major),
+			Minor: uint32(dev.Minor),
+		})
+	}
+	if err := ptpproxy.Register(vfsObj, clocks); err != nil {
+		return fmt.Errorf("registering ptpproxy driver: %w", err)
+	}
+	return nil
+}
+
 func nvproxyRegisterDevices(info *containerInfo, vfsObj *vfs.VirtualFilesystem) error {
 	if !specutils.NVProxyEnabled(info.spec, info.conf) {
 		return nil
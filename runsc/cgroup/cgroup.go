@@ -209,6 +209,44 @@ func countCpuset(cpuset string) (int, error) {
 	return count, nil
 }
 
+// defaultCPUPeriod is the CFS period, in microseconds, used when a spec sets a
+// CPU quota without a period.
+const defaultCPUPeriod = 100000
+
+// NumCPUFromResources returns the number of CPUs in the cpuset of res, or 0 if
+// res doesn't restrict the cpuset. It's the equivalent of Cgroup.NumCPU for
+// containers that don't have host cgroups.
+func NumCPUFromResources(res *specs.LinuxResources) (int, error) {
+	if res == nil || res.CPU == nil || res.CPU.Cpus == "" {
+		return 0, nil
+	}
+	return countCpuset(res.CPU.Cpus)
+}
+
+// CPUQuotaFromResources returns the CFS CPU quota set in res, or -1 if res
+// doesn't limit CPU bandwidth. It's the equivalent of Cgroup.CPUQuota for
+// containers that don't have host cgroups.
+func CPUQuotaFromResources(res *specs.LinuxResources) float64 {
+	if res == nil || res.CPU == nil || res.CPU.Quota == nil || *res.CPU.Quota <= 0 {
+		return -1
+	}
+	period := uint64(defaultCPUPeriod)
+	if res.CPU.Period != nil && *res.CPU.Period > 0 {
+		period = *res.CPU.Period
+	}
+	return float64(*res.CPU.Quota) / float64(period)
+}
+
+// MemoryLimitFromResources returns the memory limit set in res, or 0 if res
+// doesn't limit memory. It's the equivalent of Cgroup.MemoryLimit for
+// containers that don't have host cgroups.
+func MemoryLimitFromResources(res *specs.LinuxResources) uint64 {
+	if res == nil || res.Memory == nil || res.Memory.Limit == nil || *res.Memory.Limit <= 0 {
+		return 0
+	}
+	return uint64(*res.Memory.Limit)
+}
+
 // loadPaths loads cgroup paths for given 'pid', may be set to 'self'.
 func loadPaths(pid string) (map[string]string, error) {
 	procCgroup, err := os.Open(filepath.Join(procRoot, pid, "cgroup"))
@@ -110,6 +110,71 @@ func TestCountCpuset(t *testing.T) {
 	}
 }
 
+func TestFromResources(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		res    *specs.LinuxResources
+		numCPU int
+		quota  float64
+		memory uint64
+	}{
+		{
+			name:  "nil",
+			quota: -1,
+		},
+		{
+			name:  "empty",
+			res:   &specs.LinuxResources{CPU: &specs.LinuxCPU{}, Memory: &specs.LinuxMemory{}},
+			quota: -1,
+		},
+		{
+			name: "all",
+			res: &specs.LinuxResources{
+				CPU: &specs.LinuxCPU{
+					Cpus:   "0-3,8",
+					Quota:  int64Ptr(150000),
+					Period: uint64Ptr(50000),
+				},
+				Memory: &specs.LinuxMemory{Limit: int64Ptr(1 << 30)},
+			},
+			numCPU: 5,
+			quota:  3,
+			memory: 1 << 30,
+		},
+		{
+			name: "default period",
+			res: &specs.LinuxResources{
+				CPU: &specs.LinuxCPU{Quota: int64Ptr(50000)},
+			},
+			quota: 0.5,
+		},
+		{
+			name: "unlimited",
+			res: &specs.LinuxResources{
+				CPU:    &specs.LinuxCPU{Quota: int64Ptr(-1)},
+				Memory: &specs.LinuxMemory{Limit: int64Ptr(-1)},
+			},
+			quota: -1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			numCPU, err := NumCPUFromResources(tc.res)
+			if err != nil {
+				t.Fatalf("NumCPUFromResources(): %v", err)
+			}
+			if numCPU != tc.numCPU {
+				t.Errorf("NumCPUFromResources() = %d, want: %d", numCPU, tc.numCPU)
+			}
+			if quota := CPUQuotaFromResources(tc.res); quota != tc.quota {
+				t.Errorf("CPUQuotaFromResources() = %v, want: %v", quota, tc.quota)
+			}
+			if memory := MemoryLimitFromResources(tc.res); memory != tc.memory {
+				t.Errorf("MemoryLimitFromResources() = %d, want: %d", memory, tc.memory)
+			}
+		})
+	}
+}
+
 func uint16Ptr(v uint16) *uint16 {
 	return &v
 }
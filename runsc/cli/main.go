@@ -86,6 +86,11 @@ func Main() {
 		os.Exit(0)
 	}
 
+	// Apply the config file, if any, to flags not set on the command line.
+	if err := config.ApplyFile(flag.CommandLine); err != nil {
+		util.Fatalf(err.Error())
+	}
+
 	// Create a new Config from the flags.
 	conf, err := config.NewFromFlags(flag.CommandLine)
 	if err != nil {
@@ -253,7 +258,9 @@ func forEachCmd(cb func(cmd subcommands.Command, group string)) {
 	cb(new(cmd.Events), "")
 	cb(new(cmd.Exec), "")
 	cb(new(cmd.Kill), "")
+	cb(new(cmd.Link), "")
 	cb(new(cmd.List), "")
+	cb(new(cmd.Migrate), "")
 	cb(new(cmd.PS), "")
 	cb(new(cmd.Pause), "")
 	cb(new(cmd.PortForward), "")
@@ -263,6 +270,7 @@ func forEachCmd(cb func(cmd subcommands.Command, group string)) {
 	cb(new(cmd.Spec), "")
 	cb(new(cmd.Start), "")
 	cb(new(cmd.State), "")
+	cb(new(cmd.Upgrade), "")
 	cb(new(cmd.Wait), "")
 
 	// Helpers.
@@ -274,7 +282,11 @@ func forEachCmd(cb func(cmd subcommands.Command, group string)) {
 	cb(new(trace.Trace), helperGroup)
 
 	const debugGroup = "debug"
+	cb(new(cmd.Compat), debugGroup)
+	cb(new(cmd.Config), debugGroup)
 	cb(new(cmd.Debug), debugGroup)
+	cb(new(cmd.Health), debugGroup)
+	cb(new(cmd.SeccompReport), debugGroup)
 	cb(new(cmd.Statefile), debugGroup)
 	cb(new(cmd.Symbolize), debugGroup)
 	cb(new(cmd.Usage), debugGroup)
@@ -290,6 +302,7 @@ func forEachCmd(cb func(cmd subcommands.Command, group string)) {
 	const internalGroup = "internal use only"
 	cb(new(cmd.Boot), internalGroup)
 	cb(new(cmd.Gofer), internalGroup)
+	cb(new(cmd.StdioLog), internalGroup)
 	cb(new(cmd.Umount), internalGroup)
 }
 
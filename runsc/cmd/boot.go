@@ -40,6 +40,7 @@ import (
 	"gvisor.dev/gvisor/runsc/cmd/util"
 	"gvisor.dev/gvisor/runsc/config"
 	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/runsc/fsgofer"
 	"gvisor.dev/gvisor/runsc/profile"
 	"gvisor.dev/gvisor/runsc/specutils"
 )
@@ -84,6 +85,10 @@ type Boot struct {
 	// devIoFD is the FD to connect to dev gofer.
 	devIoFD int
 
+	// mountPointFDs is the list of host FDs for the gofer mount points served
+	// by this process in single-process mode, in the same order as ioFDs.
+	mountPointFDs intFlags
+
 	// goferFilestoreFDs are FDs to the regular files that will back the tmpfs or
 	// overlayfs mount for certain gofer mounts.
 	goferFilestoreFDs intFlags
@@ -123,6 +128,18 @@ type Boot struct {
 	// userLogFD is the file descriptor to write user logs to.
 	userLogFD int
 
+	// compatReportFD is the file descriptor to write the compatibility
+	// report to when the sandbox exits.
+	compatReportFD int
+
+	// deterministicRecordFD is the file descriptor to write the schedule log
+	// of a deterministic execution to.
+	deterministicRecordFD int
+
+	// deterministicReplayFD is the file descriptor to read the schedule log
+	// to replay from.
+	deterministicReplayFD int
+
 	// startSyncFD is the file descriptor to synchronize runsc and sandbox.
 	startSyncFD int
 
@@ -135,6 +152,10 @@ type Boot struct {
 
 	podInitConfigFD int
 
+	// egressProxyCredentialsFD is the file descriptor to read the egress proxy
+	// credentials from.
+	egressProxyCredentialsFD int
+
 	sinkFDs intFlags
 
 	// pidns is set if the sandbox is in its own pid namespace.
@@ -163,6 +184,9 @@ type Boot struct {
 
 	// nvidiaDriverVersion is the Nvidia driver version on the host.
 	nvidiaDriverVersion string
+
+	// numaNodes are the host NUMA nodes that the sandbox may run on.
+	numaNodes intFlags
 }
 
 // Name implements subcommands.Command.Name.
@@ -194,6 +218,7 @@ func (b *Boot) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&b.attached, "attached", false, "if attached is true, kills the sandbox process when the parent process terminates")
 	f.StringVar(&b.productName, "product-name", "", "value to show in /sys/devices/virtual/dmi/id/product_name")
 	f.StringVar(&b.nvidiaDriverVersion, "nvidia-driver-version", "", "Nvidia driver version on the host")
+	f.Var(&b.numaNodes, "numa-nodes", "host NUMA nodes that the sandbox may run on")
 
 	// Open FDs that are donated to the sandbox.
 	f.IntVar(&b.specFD, "spec-fd", -1, "required fd with the container spec")
@@ -201,15 +226,20 @@ func (b *Boot) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&b.deviceFD, "device-fd", -1, "FD for the platform device file")
 	f.Var(&b.ioFDs, "io-fds", "list of image FDs and/or socket FDs to connect gofer clients. They must follow this order: root first, then mounts as defined in the spec")
 	f.IntVar(&b.devIoFD, "dev-io-fd", -1, "FD to connect dev gofer client")
+	f.Var(&b.mountPointFDs, "mount-point-fds", "list of FDs for the gofer mount points to serve in-process with --EXPERIMENTAL-unsafe-single-process, in the same order as io-fds")
 	f.Var(&b.stdioFDs, "stdio-fds", "list of FDs containing sandbox stdin, stdout, and stderr in that order")
 	f.Var(&b.passFDs, "pass-fd", "mapping of host to guest FDs. They must be in M:N format. M is the host and N the guest descriptor.")
 	f.IntVar(&b.execFD, "exec-fd", -1, "host file descriptor used for program execution.")
 	f.Var(&b.goferFilestoreFDs, "gofer-filestore-fds", "FDs to the regular files that will back the overlayfs or tmpfs mount if a gofer mount is to be overlaid.")
 	f.Var(&b.goferMountConfs, "gofer-mount-confs", "information about how the gofer mounts have been configured.")
 	f.IntVar(&b.userLogFD, "user-log-fd", 0, "file descriptor to write user logs to. 0 means no logging.")
+	f.IntVar(&b.compatReportFD, "compat-report-fd", 0, "file descriptor to write the compatibility report to. 0 means no report.")
+	f.IntVar(&b.deterministicRecordFD, "deterministic-record-fd", 0, "file descriptor to write the deterministic schedule log to. 0 means no recording.")
+	f.IntVar(&b.deterministicReplayFD, "deterministic-replay-fd", 0, "file descriptor to read the deterministic schedule log to replay from. 0 means no replay.")
 	f.IntVar(&b.startSyncFD, "start-sync-fd", -1, "required FD to used to synchronize sandbox startup")
 	f.IntVar(&b.mountsFD, "mounts-fd", -1, "mountsFD is an optional file descriptor to read list of mounts after they have been resolved (direct paths, no symlinks).")
 	f.IntVar(&b.podInitConfigFD, "pod-init-config-fd", -1, "file descriptor to the pod init configuration file.")
+	f.IntVar(&b.egressProxyCredentialsFD, "egress-proxy-credentials-fd", -1, "file descriptor to read the egress proxy credentials from.")
 	f.Var(&b.sinkFDs, "sink-fds", "ordered list of file descriptors to be used by the sinks defined in --pod-init-config.")
 
 	// Profiling flags.
@@ -246,6 +276,15 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomma
 			argOverride["product-name"] = b.productName
 		}
 	}
+	if conf.MemoryNUMAPolicy == config.NUMAPolicyLocal && len(b.numaNodes) == 0 {
+		// Same as above, sysfs is needed to find the nodes.
+		if nodes, err := boot.LocalNUMANodes(); err != nil {
+			log.Warningf("Failed to find local NUMA nodes: %v", err)
+		} else if len(nodes) > 0 {
+			b.numaNodes = nodes
+			argOverride["numa-nodes"] = b.numaNodes.String()
+		}
+	}
 
 	if b.attached {
 		// Ensure this process is killed after parent process terminates when
@@ -403,6 +442,20 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomma
 		unix.Umask(0)
 	}
 
+	if conf.UnsafeSingleProcess {
+		log.Warningf("Serving gofer mounts in the sandbox process: the gofer is not isolated from the sentry")
+		ioFDs, err := serveGoferMounts(spec, conf, b.goferMountConfs.GetArray(), b.mountPointFDs.GetArray())
+		if err != nil {
+			util.Fatalf("serving gofer mounts: %v", err)
+		}
+		b.ioFDs = intFlags(ioFDs)
+		if b.procMountSyncFD == -1 {
+			if err := fsgofer.OpenProcSelfFD(); err != nil {
+				util.Fatalf("failed to open /proc/self/fd: %v", err)
+			}
+		}
+	}
+
 	if conf.EnableCoreTags {
 		if err := coretag.Enable(); err != nil {
 			util.Fatalf("Failed to core tag sentry: %v", err)
@@ -422,27 +475,33 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomma
 
 	// Create the loader.
 	bootArgs := boot.Args{
-		ID:                  f.Arg(0),
-		Spec:                spec,
-		Conf:                conf,
-		ControllerFD:        b.controllerFD,
-		Device:              os.NewFile(uintptr(b.deviceFD), "platform device"),
-		GoferFDs:            b.ioFDs.GetArray(),
-		DevGoferFD:          b.devIoFD,
-		StdioFDs:            b.stdioFDs.GetArray(),
-		PassFDs:             b.passFDs.GetArray(),
-		ExecFD:              b.execFD,
-		GoferFilestoreFDs:   b.goferFilestoreFDs.GetArray(),
-		GoferMountConfs:     b.goferMountConfs.GetArray(),
-		NumCPU:              b.cpuNum,
-		TotalMem:            b.totalMem,
-		TotalHostMem:        b.totalHostMem,
-		UserLogFD:           b.userLogFD,
-		ProductName:         b.productName,
-		PodInitConfigFD:     b.podInitConfigFD,
-		SinkFDs:             b.sinkFDs.GetArray(),
-		ProfileOpts:         b.profileFDs.ToOpts(),
-		NvidiaDriverVersion: b.nvidiaDriverVersion,
+		ID:                    f.Arg(0),
+		Spec:                  spec,
+		Conf:                  conf,
+		ControllerFD:          b.controllerFD,
+		Device:                os.NewFile(uintptr(b.deviceFD), "platform device"),
+		GoferFDs:              b.ioFDs.GetArray(),
+		DevGoferFD:            b.devIoFD,
+		StdioFDs:              b.stdioFDs.GetArray(),
+		PassFDs:               b.passFDs.GetArray(),
+		ExecFD:                b.execFD,
+		GoferFilestoreFDs:     b.goferFilestoreFDs.GetArray(),
+		GoferMountConfs:       b.goferMountConfs.GetArray(),
+		NumCPU:                b.cpuNum,
+		TotalMem:              b.totalMem,
+		TotalHostMem:          b.totalHostMem,
+		UserLogFD:             b.userLogFD,
+		CompatReportFD:        b.compatReportFD,
+		DeterministicRecordFD: b.deterministicRecordFD,
+		DeterministicReplayFD: b.deterministicReplayFD,
+		ProductName:           b.productName,
+		PodInitConfigFD:       b.podInitConfigFD,
+		SinkFDs:               b.sinkFDs.GetArray(),
+		ProfileOpts:           b.profileFDs.ToOpts(),
+		NvidiaDriverVersion:   b.nvidiaDriverVersion,
+		NUMANodes:             b.numaNodes.GetArray(),
+
+		EgressProxyCredentialsFD: b.egressProxyCredentialsFD,
 	}
 	l, err := boot.New(bootArgs)
 	if err != nil {
@@ -455,7 +514,14 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomma
 	if b.procMountSyncFD != -1 {
 		l.PreSeccompCallback = func() {
 			// Call validateOpenFDs() before umounting /proc.
-			validateOpenFDs(bootArgs.PassFDs)
+			validateOpenFDs(bootArgs.PassFDs, b.mountPointFDs.GetArray())
+			if conf.UnsafeSingleProcess {
+				// The in-process gofer needs /proc/self/fd to reopen files. Open it
+				// after validateOpenFDs(), since it is a directory.
+				if err := fsgofer.OpenProcSelfFD(); err != nil {
+					util.Fatalf("failed to open /proc/self/fd: %v", err)
+				}
+			}
 			// Umount /proc right before installing seccomp filters.
 			umountProc(b.procMountSyncFD)
 		}
@@ -496,6 +562,9 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomma
 
 	ws := l.WaitExit()
 	log.Infof("application exiting with %+v", ws)
+	if err := l.WriteCompatReport(); err != nil {
+		log.Warningf("Failed to write compatibility report: %v", err)
+	}
 	waitStatus := args[1].(*unix.WaitStatus)
 	*waitStatus = unix.WaitStatus(ws)
 	l.Destroy()
@@ -581,12 +650,16 @@ func umountProc(syncFD int) {
 }
 
 // validateOpenFDs checks that the sandbox process does not have any open
-// directory FDs.
-func validateOpenFDs(passFDs []boot.FDMapping) {
+// directory FDs other than passed FDs and gofer mount points.
+func validateOpenFDs(passFDs []boot.FDMapping, mountPointFDs []int) {
 	passHostFDs := make(map[int]struct{})
 	for _, passFD := range passFDs {
 		passHostFDs[passFD.Host] = struct{}{}
 	}
+	mountPointHostFDs := make(map[int]struct{})
+	for _, fd := range mountPointFDs {
+		mountPointHostFDs[fd] = struct{}{}
+	}
 	const selfFDDir = "/proc/self/fd"
 	if err := filepath.WalkDir(selfFDDir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
@@ -621,6 +694,11 @@ func validateOpenFDs(passFDs []boot.FDMapping) {
 			log.Warningf("Sandbox has access to FD %d, which is a directory for %s", fdNo, dirLink)
 			return nil
 		}
+		if _, ok := mountPointHostFDs[fdNo]; ok {
+			// Gofer mount points served in-process with
+			// --EXPERIMENTAL-unsafe-single-process.
+			return nil
+		}
 		return fmt.Errorf("FD %d is a directory for %s", fdNo, dirLink)
 	}); err != nil {
 		util.Fatalf("WalkDir(%s) failed: %v", selfFDDir, err)
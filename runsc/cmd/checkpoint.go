@@ -38,6 +38,7 @@ const checkpointFileName = "checkpoint.img"
 type Checkpoint struct {
 	imagePath    string
 	leaveRunning bool
+	async        bool
 	compression  CheckpointCompression
 }
 
@@ -61,6 +62,7 @@ func (*Checkpoint) Usage() string {
 func (c *Checkpoint) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&c.imagePath, "image-path", "", "directory path to saved container image")
 	f.BoolVar(&c.leaveRunning, "leave-running", false, "restart the container after checkpointing")
+	f.BoolVar(&c.async, "async", false, "keep the container running while its memory is written to the image, pausing it only while kernel state is saved. Requires --leave-running.")
 	f.Var(newCheckpointCompressionValue(statefile.CompressionLevelFlateBestSpeed, &c.compression), "compression", "compress checkpoint image on disk. Values: none|flate-best-speed.")
 
 	// Unimplemented flags necessary for compatibility with docker.
@@ -87,6 +89,9 @@ func (c *Checkpoint) Execute(_ context.Context, f *flag.FlagSet, args ...any) su
 	if c.imagePath == "" {
 		util.Fatalf("image-path flag must be provided")
 	}
+	if c.async && !c.leaveRunning {
+		util.Fatalf("--async requires --leave-running")
+	}
 
 	if err := os.MkdirAll(c.imagePath, 0755); err != nil {
 		util.Fatalf("making directories at path provided: %v", err)
@@ -101,11 +106,12 @@ func (c *Checkpoint) Execute(_ context.Context, f *flag.FlagSet, args ...any) su
 	}
 	defer file.Close()
 
-	if err := cont.Checkpoint(file, statefile.Options{Compression: c.compression.Level()}); err != nil {
+	if err := cont.Checkpoint(file, statefile.Options{Compression: c.compression.Level()}, c.async); err != nil {
 		util.Fatalf("checkpoint failed: %v", err)
 	}
 
-	if !c.leaveRunning {
+	// An asynchronous checkpoint leaves the container running in place.
+	if !c.leaveRunning || c.async {
 		return subcommands.ExitSuccess
 	}
 
@@ -20,6 +20,7 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
@@ -123,6 +124,10 @@ func setUpChroot(pidns bool, spec *specs.Spec, conf *config.Config) error {
 		return fmt.Errorf("error configuring chroot for TPU devices: %w", err)
 	}
 
+	if err := vfioProxyUpdateChroot(chroot, spec, conf); err != nil {
+		return fmt.Errorf("error configuring chroot for VFIO devices: %w", err)
+	}
+
 	if err := specutils.SafeMount("", chroot, "", unix.MS_REMOUNT|unix.MS_RDONLY|unix.MS_BIND, "", "/proc"); err != nil {
 		return fmt.Errorf("error remounting chroot in read-only: %v", err)
 	}
@@ -214,3 +219,37 @@ func tpuProxyUpdateChroot(chroot string, spec *specs.Spec, conf *config.Config)
 	}
 	return nil
 }
+
+// vfioProxyUpdateChroot bind mounts the IOMMU group and PCI device directories
+// of the VFIO groups in the spec, from which the sentry mirrors the sysfs
+// entries that userspace drivers use to discover devices.
+func vfioProxyUpdateChroot(chroot string, spec *specs.Spec, conf *config.Config) error {
+	if !specutils.VFIOFunctionalityRequested(spec, conf) {
+		return nil
+	}
+	for _, dev := range specutils.VFIOGroupDevices(spec) {
+		group, _ := specutils.VFIOGroupName(dev.Path)
+		groupPath := path.Join("/sys/kernel/iommu_groups", group)
+		if err := mountInChroot(chroot, groupPath, groupPath, "bind", unix.MS_BIND|unix.MS_RDONLY); err != nil {
+			return fmt.Errorf("error mounting IOMMU group %q in chroot: %w", group, err)
+		}
+		// Each entry in devices is a link to a PCI device directory.
+		devLinks, err := filepath.Glob(path.Join(groupPath, "devices", "*"))
+		if err != nil {
+			return fmt.Errorf("enumerating devices in IOMMU group %q: %w", group, err)
+		}
+		for _, devLink := range devLinks {
+			devPath, err := filepath.EvalSymlinks(devLink)
+			if err != nil {
+				return fmt.Errorf("error resolving %q: %w", devLink, err)
+			}
+			if !strings.HasPrefix(devPath, "/sys/devices/pci") {
+				return fmt.Errorf("unexpected link %q -> %q", devLink, devPath)
+			}
+			if err := mountInChroot(chroot, devPath, devPath, "bind", unix.MS_BIND|unix.MS_RDONLY); err != nil {
+				return fmt.Errorf("error mounting %q in chroot: %w", devPath, err)
+			}
+		}
+	}
+	return nil
+}
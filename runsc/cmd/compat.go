@@ -0,0 +1,107 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/pkg/sentry/control"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// Compat implements subcommands.Command for the "compat" command.
+type Compat struct {
+	format string
+}
+
+// Name implements subcommands.Command.Name.
+func (*Compat) Name() string {
+	return "compat"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Compat) Synopsis() string {
+	return "list the unsupported syscalls, ioctls, procfs files and sysctls used by a container"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Compat) Usage() string {
+	return `compat [flags] <container id> - print the compatibility report of a sandbox.
+
+The report lists every unimplemented or partially implemented syscall, ioctl,
+procfs file and sysctl that the application used, how often, and sample
+threads and stacks that used them. Partially implemented syscalls are only
+reported when the sandbox was started with --compat-report.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (c *Compat) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.format, "format", "text", "output format: 'text' (default) or 'json'")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (c *Compat) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*config.Config)
+
+	cont, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{SkipCheck: true})
+	if err != nil {
+		util.Fatalf("loading container: %v", err)
+	}
+	report, err := cont.Sandbox.CompatReport()
+	if err != nil {
+		util.Fatalf("%v", err)
+	}
+	if err := writeCompatReport(&util.Writer{}, report, c.format); err != nil {
+		util.Fatalf("%v", err)
+	}
+	return subcommands.ExitSuccess
+}
+
+// writeCompatReport writes report to w in the given format.
+func writeCompatReport(w io.Writer, report *control.CompatReport, format string) error {
+	switch format {
+	case "text":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprint(tw, "KIND\tNAME\tSUPPORT\tCOUNT\n")
+		for _, item := range report.Items {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", item.Kind, item.Name, item.Support, item.Count)
+		}
+		return tw.Flush()
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("encoding compatibility report: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown compat format %q", format)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// Config implements subcommands.Command for the "config" command.
+type Config struct {
+	all      bool
+	validate bool
+}
+
+// Name implements subcommands.Command.Name.
+func (*Config) Name() string {
+	return "config"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Config) Synopsis() string {
+	return "print the effective config of a sandbox, or validate the config file"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Config) Usage() string {
+	return `config [flags] <container id> - print the effective config of the sandbox running a container.
+config -validate - validate the config file given with --config.
+
+The effective config is printed in the config file format, after the config
+file, the profile selected by the pod, bundles and flag annotations have been
+applied. By default, only flags that differ from their default value are
+printed.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (c *Config) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&c.all, "all", false, "also print flags that are set to their default value")
+	f.BoolVar(&c.validate, "validate", false, "validate the config file given with --config and all its profiles, and exit")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (c *Config) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	conf := args[0].(*config.Config)
+
+	if c.validate {
+		if f.NArg() != 0 {
+			f.Usage()
+			return subcommands.ExitUsageError
+		}
+		if conf.ConfigFile == "" {
+			util.Fatalf("no config file set, use --config to set one")
+		}
+		file, err := config.LoadFile(conf.ConfigFile)
+		if err != nil {
+			return util.Errorf("%v", err)
+		}
+		fmt.Fprintf(os.Stdout, "Config file %q is valid. Profiles: %s\n", conf.ConfigFile, strings.Join(file.ProfileNames(), ", "))
+		return subcommands.ExitSuccess
+	}
+
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	id := f.Arg(0)
+
+	cont, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{SkipCheck: true})
+	if err != nil {
+		util.Fatalf("loading container: %v", err)
+	}
+	if cont.Sandbox == nil {
+		return util.Errorf("container %q has no sandbox", id)
+	}
+	if cont.Sandbox.Config == nil {
+		return util.Errorf("sandbox %q was created by a runsc version that doesn't record its config", cont.Sandbox.ID)
+	}
+	if err := writeConfig(os.Stdout, cont.Sandbox.ID, cont.Sandbox.Profile, cont.Sandbox.Config, c.all); err != nil {
+		util.Fatalf("%v", err)
+	}
+	return subcommands.ExitSuccess
+}
+
+// writeConfig writes the flags in b to w in the config file format. Flags set
+// to their default value are skipped unless all is set.
+func writeConfig(w io.Writer, sandboxID, profile string, b config.Bundle, all bool) error {
+	defaults := flag.NewFlagSet("tmp", flag.ContinueOnError)
+	config.RegisterFlags(defaults)
+
+	flags := make(config.Bundle)
+	for name, val := range b {
+		if fl := defaults.Lookup(name); !all && fl != nil && fl.DefValue == val {
+			continue
+		}
+		flags[name] = val
+	}
+
+	fmt.Fprintf(w, "# Effective config of sandbox %q", sandboxID)
+	if profile != "" {
+		fmt.Fprintf(w, ", with profile %q", profile)
+	}
+	fmt.Fprint(w, ".\n")
+	return toml.NewEncoder(w).Encode(map[string]config.Bundle{"flags": flags})
+}
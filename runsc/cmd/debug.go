@@ -16,6 +16,7 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"os/signal"
 	"strconv"
@@ -50,6 +51,8 @@ type Debug struct {
 	duration     time.Duration
 	ps           bool
 	mount        string
+	crashes      bool
+	timeSync     bool
 }
 
 // Name implements subcommands.Command.
@@ -84,6 +87,8 @@ func (d *Debug) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&d.logPackets, "log-packets", "", "A boolean value to enable or disable packet logging: true or false.")
 	f.BoolVar(&d.ps, "ps", false, "lists processes")
 	f.StringVar(&d.mount, "mount", "", "Mount a filesystem (-mount fstype:source:destination).")
+	f.BoolVar(&d.crashes, "crashes", false, "prints the crash reports of sentry panics that the sandbox survived, see --recover-syscall-panics")
+	f.BoolVar(&d.timeSync, "time-sync", false, "prints the clock error bounds and entropy state of the sandbox, see --host-time-sync")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -158,6 +163,30 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 		}
 		util.Infof("     *** Stack dump ***\n%s", stacks)
 	}
+	if d.crashes {
+		util.Infof("Retrieving crash reports")
+		reports, err := c.Sandbox.CrashReports()
+		if err != nil {
+			return util.Errorf("retrieving crash reports: %v", err)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(reports); err != nil {
+			return util.Errorf("encoding crash reports: %v", err)
+		}
+	}
+	if d.timeSync {
+		util.Infof("Retrieving time sync state")
+		state, err := c.Sandbox.TimeSyncState()
+		if err != nil {
+			return util.Errorf("retrieving time sync state: %v", err)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(state); err != nil {
+			return util.Errorf("encoding time sync state: %v", err)
+		}
+	}
 	if d.strace != "" || len(d.logLevel) != 0 || len(d.logPackets) != 0 {
 		args := control.LoggingArgs{}
 		switch strings.ToLower(d.strace) {
@@ -17,6 +17,7 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -24,6 +25,7 @@ import (
 	"regexp"
 	"runtime"
 	"runtime/debug"
+	"strconv"
 	"strings"
 
 	"github.com/google/subcommands"
@@ -50,6 +52,10 @@ var caps = []string{
 	"CAP_SYS_CHROOT",
 }
 
+// hostOverlayDir holds the upper and work directories of the host overlay. It
+// is relative to the gofer's root once setupRootFS() made /proc the root.
+const hostOverlayDir = "/overlay"
+
 // goferCaps is the minimal set of capabilities needed by the Gofer to operate
 // on files.
 var goferCaps = &specs.LinuxCapabilities{
@@ -88,11 +94,16 @@ type Gofer struct {
 	setUpRoot  bool
 	mountConfs boot.GoferMountConfFlags
 
-	specFD        int
-	mountsFD      int
-	profileFDs    profile.FDArgs
-	syncFDs       goferSyncFDs
-	stopProfiling func()
+	specFD          int
+	mountsFD        int
+	overlayExportFD int
+	profileFDs      profile.FDArgs
+	syncFDs         goferSyncFDs
+	stopProfiling   func()
+
+	// overlayExport serves the upper layer of the host overlay on
+	// overlayExportFD, if set.
+	overlayExport *fsgofer.FUSEExport
 }
 
 // Name implements subcommands.Command.
@@ -122,6 +133,7 @@ func (g *Gofer) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&g.devIoFD, "dev-io-fd", -1, "optional FD to connect /dev gofer server")
 	f.IntVar(&g.specFD, "spec-fd", -1, "required fd with the container spec")
 	f.IntVar(&g.mountsFD, "mounts-fd", -1, "mountsFD is the file descriptor to write list of mounts after they have been resolved (direct paths, no symlinks).")
+	f.IntVar(&g.overlayExportFD, "overlay-export-fd", -1, "optional FUSE FD on which to export the upper layer of the host overlay")
 
 	// Add synchronization FD flags.
 	g.syncFDs.setFlags(f)
@@ -226,6 +238,13 @@ func (g *Gofer) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 	// procfs isn't needed anymore.
 	g.syncFDs.unmountProcfs()
 
+	if g.overlayExportFD >= 0 {
+		// The upper layer isn't reachable after chroot.
+		if err := g.openOverlayExport(); err != nil {
+			util.Fatalf("exporting host overlay: %v", err)
+		}
+	}
+
 	if err := unix.Chroot(root); err != nil {
 		util.Fatalf("failed to chroot to %q: %v", root, err)
 	}
@@ -234,17 +253,15 @@ func (g *Gofer) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 	}
 	log.Infof("Process chroot'd to %q", root)
 
-	// Initialize filters.
-	opts := filter.Options{
-		UDSOpenEnabled:   conf.GetHostUDS().AllowOpen(),
-		UDSCreateEnabled: conf.GetHostUDS().AllowCreate(),
-		ProfileEnabled:   len(profileOpts) > 0,
-	}
-	if err := filter.Install(opts); err != nil {
-		util.Fatalf("installing seccomp filters: %v", err)
-	}
+	return g.serve(spec, conf, root, len(profileOpts) > 0)
+}
 
-	return g.serve(spec, conf, root)
+// mountPolicy returns the seccomp policy of a mount served over lisafs.
+func mountPolicy(readonly bool) filter.MountPolicy {
+	if readonly {
+		return filter.MountReadOnly
+	}
+	return filter.MountReadWrite
 }
 
 func newSocket(ioFD int) *unet.Socket {
@@ -255,29 +272,36 @@ func newSocket(ioFD int) *unet.Socket {
 	return socket
 }
 
-func (g *Gofer) serve(spec *specs.Spec, conf *config.Config, root string) subcommands.ExitStatus {
+// serve installs seccomp filters and serves the container's lisafs mounts
+// until the sandbox disconnects.
+func (g *Gofer) serve(spec *specs.Spec, conf *config.Config, root string, profileEnabled bool) subcommands.ExitStatus {
 	type connectionConfig struct {
 		sock      *unet.Socket
 		mountPath string
 		readonly  bool
+		policy    filter.MountPolicy
 	}
 	cfgs := make([]connectionConfig, 0, len(spec.Mounts)+1)
 	server := fsgofer.NewLisafsServer(fsgofer.Config{
 		// These are global options. Ignore readonly configuration, that is set on
 		// a per connection basis.
-		HostUDS:            conf.GetHostUDS(),
-		HostFifo:           conf.HostFifo,
-		DonateMountPointFD: conf.DirectFS,
+		HostUDS:               conf.GetHostUDS(),
+		HostFifo:              conf.HostFifo,
+		DonateMountPointFD:    conf.DirectFS,
+		MaxChannels:           conf.GoferChannels,
+		MaxConcurrentRequests: conf.GoferMaxConcurrentRequests,
 	})
 
 	ioFDs := g.ioFDs
 	rootfsConf := g.mountConfs[0]
 	if rootfsConf.ShouldUseLisafs() {
 		// Start with root mount, then add any other additional mount as needed.
+		readonly := spec.Root.Readonly || rootfsConf.ShouldUseOverlayfs()
 		cfgs = append(cfgs, connectionConfig{
 			sock:      newSocket(ioFDs[0]),
 			mountPath: "/", // fsgofer process is always chroot()ed. So serve root.
-			readonly:  spec.Root.Readonly || rootfsConf.ShouldUseOverlayfs(),
+			readonly:  readonly,
+			policy:    mountPolicy(readonly),
 		})
 		log.Infof("Serving %q mapped to %q on FD %d (ro: %t)", "/", root, ioFDs[0], cfgs[0].readonly)
 		ioFDs = ioFDs[1:]
@@ -307,6 +331,7 @@ func (g *Gofer) serve(spec *specs.Spec, conf *config.Config, root string) subcom
 			sock:      newSocket(ioFD),
 			mountPath: m.Destination,
 			readonly:  readonly,
+			policy:    mountPolicy(readonly),
 		})
 		log.Infof("Serving %q mapped on FD %d (ro: %t)", m.Destination, ioFD, readonly)
 	}
@@ -319,10 +344,35 @@ func (g *Gofer) serve(spec *specs.Spec, conf *config.Config, root string) subcom
 		cfgs = append(cfgs, connectionConfig{
 			sock:      newSocket(g.devIoFD),
 			mountPath: "/dev",
+			// Devices are opened for writing, but /dev is otherwise
+			// never modified.
+			policy: filter.MountDevices,
 		})
 		log.Infof("Serving /dev mapped on FD %d (ro: false)", g.devIoFD)
 	}
 
+	// Initialize filters. The policy depends on the mounts being served.
+	opts := filter.Options{
+		UDSOpenEnabled:   conf.GetHostUDS().AllowOpen(),
+		UDSCreateEnabled: conf.GetHostUDS().AllowCreate(),
+		ProfileEnabled:   profileEnabled,
+		Audit:            conf.GoferSeccompAudit,
+	}
+	for _, cfg := range cfgs {
+		opts.Mounts = append(opts.Mounts, cfg.policy)
+	}
+	if err := filter.Install(opts); err != nil {
+		util.Fatalf("installing seccomp filters: %v", err)
+	}
+
+	if g.overlayExport != nil {
+		go func() {
+			if err := g.overlayExport.Serve(); err != nil {
+				log.Warningf("Overlay export failed: %v", err)
+			}
+		}()
+	}
+
 	for _, cfg := range cfgs {
 		conn, err := server.CreateConnection(cfg.sock, cfg.mountPath, cfg.readonly)
 		if err != nil {
@@ -339,6 +389,65 @@ func (g *Gofer) serve(spec *specs.Spec, conf *config.Config, root string) subcom
 	return subcommands.ExitSuccess
 }
 
+// serveGoferMounts serves the container's lisafs mounts from the current
+// process, for single-process mode. Each mount is served from its
+// corresponding FD in mountPointFDs over a socket pair, and is backed by a
+// separate server since the mount points don't share a common root as they do
+// in the gofer process. It returns the client ends of the socket pairs, in the
+// same order as the gofer process's IO FDs would be.
+//
+// Unlike Gofer.Execute, this doesn't chroot or install seccomp filters; the
+// server runs under the sandbox's chroot and filters.
+func serveGoferMounts(spec *specs.Spec, conf *config.Config, mountConfs []boot.GoferMountConf, mountPointFDs []int) ([]int, error) {
+	mountPaths := make([]string, 0, len(mountConfs))
+	readonly := make([]bool, 0, len(mountConfs))
+	if mountConfs[0].ShouldUseLisafs() {
+		mountPaths = append(mountPaths, "/")
+		readonly = append(readonly, spec.Root.Readonly || mountConfs[0].ShouldUseOverlayfs())
+	}
+	mountIdx := 1 // First index is for rootfs.
+	for _, m := range spec.Mounts {
+		if !specutils.IsGoferMount(m) {
+			continue
+		}
+		mountConf := mountConfs[mountIdx]
+		mountIdx++
+		if !mountConf.ShouldUseLisafs() {
+			continue
+		}
+		mountPaths = append(mountPaths, m.Destination)
+		readonly = append(readonly, specutils.IsReadonlyMount(m.Options) || mountConf.ShouldUseOverlayfs())
+	}
+	if len(mountPaths) != len(mountPointFDs) {
+		return nil, fmt.Errorf("got %d mount point FDs for %d mounts", len(mountPointFDs), len(mountPaths))
+	}
+
+	ioFDs := make([]int, 0, len(mountPaths))
+	for i, mountPath := range mountPaths {
+		fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+		if err != nil {
+			return nil, err
+		}
+		server := fsgofer.NewLisafsServer(fsgofer.Config{
+			HostFifo:              conf.HostFifo,
+			DonateMountPointFD:    conf.DirectFS,
+			MaxChannels:           conf.GoferChannels,
+			MaxConcurrentRequests: conf.GoferMaxConcurrentRequests,
+			MountPointFDs:         map[string]int{mountPath: mountPointFDs[i]},
+		})
+		conn, err := server.CreateConnection(newSocket(fds[1]), mountPath, readonly[i])
+		if err != nil {
+			_ = unix.Close(fds[0])
+			_ = unix.Close(fds[1])
+			return nil, fmt.Errorf("starting connection for mount %q: %w", mountPath, err)
+		}
+		server.StartConnection(conn)
+		log.Infof("Serving %q in-process from FD %d on FD %d (ro: %t)", mountPath, mountPointFDs[i], fds[0], readonly[i])
+		ioFDs = append(ioFDs, fds[0])
+	}
+	return ioFDs, nil
+}
+
 func (g *Gofer) writeMounts(mounts []specs.Mount) error {
 	bytes, err := json.Marshal(mounts)
 	if err != nil {
@@ -409,9 +518,21 @@ func (g *Gofer) setupRootFS(spec *specs.Spec, conf *config.Config) error {
 
 	rootfsConf := g.mountConfs[0]
 	if rootfsConf.ShouldUseLisafs() {
-		// Mount root path followed by submounts.
-		if err := specutils.SafeMount(spec.Root.Path, root, "bind", unix.MS_BIND|unix.MS_REC, "", procPath); err != nil {
-			return fmt.Errorf("mounting root on root (%q) err: %v", root, err)
+		if err := checkHostPath(conf, spec.Root.Path); err != nil {
+			return err
+		}
+		if rootfsConf.ShouldUseHostOverlayfs() {
+			if conf.TestOnlyAllowRunAsCurrentUserWithoutChroot {
+				return fmt.Errorf("host overlay requires the gofer to chroot")
+			}
+			if err := mountHostOverlay(spec.Root.Path, root, "/proc"+hostOverlayDir, hostOverlaySize(spec, conf), procPath); err != nil {
+				return fmt.Errorf("mounting host overlay of %q on root (%q) err: %v", spec.Root.Path, root, err)
+			}
+		} else {
+			// Mount root path followed by submounts.
+			if err := specutils.SafeMount(spec.Root.Path, root, "bind", unix.MS_BIND|unix.MS_REC, "", procPath); err != nil {
+				return fmt.Errorf("mounting root on root (%q) err: %v", root, err)
+			}
 		}
 
 		flags := uint32(unix.MS_SLAVE | unix.MS_REC)
@@ -471,6 +592,100 @@ func (g *Gofer) setupRootFS(spec *specs.Spec, conf *config.Config) error {
 	return nil
 }
 
+// openOverlayExport prepares the export of the upper layer of the host
+// overlay on g.overlayExportFD.
+func (g *Gofer) openOverlayExport() error {
+	if !g.mountConfs[0].ShouldUseHostOverlayfs() {
+		return fmt.Errorf("root mount doesn't use the host overlay")
+	}
+	upper := filepath.Join(hostOverlayDir, "upper")
+	rootFD, err := unix.Open(upper, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("opening %q: %w", upper, err)
+	}
+	g.overlayExport, err = fsgofer.NewFUSEExport(g.overlayExportFD, rootFD)
+	if err != nil {
+		_ = unix.Close(rootFD)
+		return err
+	}
+	log.Infof("Exporting %q on FD %d", upper, g.overlayExportFD)
+	return nil
+}
+
+// hostOverlaySize returns the size limit of the host overlay's upper layer,
+// as a tmpfs size option value.
+func hostOverlaySize(spec *specs.Spec, conf *config.Config) string {
+	if conf.HostOverlaySize != "" {
+		return conf.HostOverlaySize
+	}
+	// Like the sentry overlay, which is backed by sandbox memory, the upper
+	// layer is bounded by the container's memory limit.
+	if spec.Linux != nil && spec.Linux.Resources != nil {
+		if mem := spec.Linux.Resources.Memory; mem != nil && mem.Limit != nil && *mem.Limit > 0 {
+			return strconv.FormatInt(*mem.Limit, 10)
+		}
+	}
+	// The tmpfs default.
+	return "50%"
+}
+
+// mountHostOverlay mounts the host's overlayfs on root, with lower as its
+// lower layer. The upper and work directories are created in a tmpfs of the
+// given size mounted on dir, which must be on the gofer's tmpfs outside of
+// root: writes only reach the upper layer through the merged view, and are
+// discarded with the gofer's mounts.
+func mountHostOverlay(lower, root, dir, size, procPath string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// The upper layer is kept in memory, so it gets a tmpfs of its own to
+	// limit its size.
+	flags := uintptr(unix.MS_NOSUID | unix.MS_NODEV)
+	if err := specutils.SafeMount("runsc-overlay-upper", dir, "tmpfs", flags, "mode=0755,size="+size, procPath); err != nil {
+		return fmt.Errorf("mounting tmpfs of size %q on %q: %w", size, dir, err)
+	}
+	upper := filepath.Join(dir, "upper")
+	work := filepath.Join(dir, "work")
+	for _, d := range []string{upper, work} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return err
+		}
+	}
+	// The root directory of the merged view takes its attributes from the
+	// upper layer, so match them with the lower root.
+	var stat unix.Stat_t
+	if err := unix.Stat(lower, &stat); err != nil {
+		return fmt.Errorf("stat(%q): %w", lower, err)
+	}
+	if err := unix.Chmod(upper, stat.Mode&^unix.S_IFMT); err != nil {
+		return fmt.Errorf("chmod(%q): %w", upper, err)
+	}
+	if err := unix.Chown(upper, int(stat.Uid), int(stat.Gid)); err != nil {
+		return fmt.Errorf("chown(%q): %w", upper, err)
+	}
+
+	data := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", escapeOverlayPath(lower), upper, work)
+	err := specutils.SafeMount("runsc-overlay", root, "overlay", 0, data, procPath)
+	if errors.Is(err, unix.EPERM) || errors.Is(err, unix.EINVAL) {
+		// Overlayfs keeps its metadata in trusted.* xattrs, which can only be set
+		// from the initial user namespace. Retry with user.* xattrs in case the
+		// gofer runs in a user namespace.
+		log.Infof("Mounting host overlay failed (%v), retrying with userxattr", err)
+		err = specutils.SafeMount("runsc-overlay", root, "overlay", 0, data+",userxattr", procPath)
+	}
+	if err != nil {
+		return err
+	}
+	log.Infof("Mounted host overlay of %q on %q", lower, root)
+	return nil
+}
+
+// escapeOverlayPath escapes the characters of path that overlayfs would
+// otherwise take as option or layer separators.
+func escapeOverlayPath(path string) string {
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`, ":", `\:`).Replace(path)
+}
+
 // setupMounts bind mounts all mounts specified in the spec in their correct
 // location inside root. It will resolve relative paths and symlinks. It also
 // creates directories as needed.
@@ -485,6 +700,9 @@ func (g *Gofer) setupMounts(conf *config.Config, mounts []specs.Mount, root, pro
 		if !mountConf.ShouldUseLisafs() {
 			continue
 		}
+		if err := checkHostPath(conf, m.Source); err != nil {
+			return err
+		}
 
 		dst, err := resolveSymlinks(root, m.Destination)
 		if err != nil {
@@ -513,6 +731,36 @@ func (g *Gofer) setupMounts(conf *config.Config, mounts []specs.Mount, root, pro
 	return nil
 }
 
+// checkHostPath returns an error if the gofer may not serve the host path src
+// according to --gofer-host-paths.
+func checkHostPath(conf *config.Config, src string) error {
+	allowed := conf.GetGoferHostPaths()
+	if len(allowed) == 0 {
+		return nil
+	}
+	// Resolve symlinks, since the mount follows them.
+	resolved, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return fmt.Errorf("resolving host path %q: %v", src, err)
+	}
+	if !hostPathAllowed(allowed, resolved) {
+		return fmt.Errorf("host path %q (resolved to %q) is not in --gofer-host-paths", src, resolved)
+	}
+	return nil
+}
+
+// hostPathAllowed returns true if path is one of the directories in allowed,
+// or is inside one of them.
+func hostPathAllowed(allowed []string, path string) bool {
+	for _, dir := range allowed {
+		rel, err := filepath.Rel(filepath.Clean(dir), path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return true
+		}
+	}
+	return false
+}
+
 // shouldExposeNvidiaDevice returns true if path refers to an Nvidia device
 // which should be exposed to the container.
 //
@@ -537,6 +785,33 @@ func shouldExposeTpuDevice(path string) bool {
 	return valid
 }
 
+// shouldExposeVFIODevice returns true if path refers to a VFIO device which
+// should be exposed to the container.
+//
+// Precondition: vfioproxy is enabled.
+func shouldExposeVFIODevice(path string) bool {
+	_, isGroup := specutils.VFIOGroupName(path)
+	return isGroup || path == specutils.VFIOContainerDevicePath
+}
+
+// shouldExposeDRMDevice returns true if path refers to a DRM render node which
+// should be exposed to the container.
+//
+// Precondition: drmproxy is enabled.
+func shouldExposeDRMDevice(path string) bool {
+	_, isRenderNode := specutils.DRMRenderNodeName(path)
+	return isRenderNode
+}
+
+// shouldExposePTPDevice returns true if path refers to a PTP hardware clock
+// which should be exposed to the container.
+//
+// Precondition: ptpproxy is enabled.
+func shouldExposePTPDevice(path string) bool {
+	_, isClock := specutils.PTPClockName(path)
+	return isClock
+}
+
 func (g *Gofer) setupDev(spec *specs.Spec, conf *config.Config, root, procPath string) error {
 	if err := os.MkdirAll(filepath.Join(root, "dev"), 0777); err != nil {
 		return fmt.Errorf("creating dev directory: %v", err)
@@ -547,16 +822,31 @@ func (g *Gofer) setupDev(spec *specs.Spec, conf *config.Config, root, procPath s
 	}
 	nvproxyEnabled := specutils.NVProxyEnabled(spec, conf)
 	tpuproxyEnabled := specutils.TPUProxyIsEnabled(spec, conf)
+	vfioproxyEnabled := specutils.VFIOProxyEnabled(conf)
+	drmproxyEnabled := specutils.DRMProxyEnabled(conf)
+	ptpproxyEnabled := specutils.PTPProxyEnabled(conf)
+	devPaths := make(map[string]struct{})
 	for _, dev := range spec.Linux.Devices {
 		shouldMount := (nvproxyEnabled && shouldExposeNvidiaDevice(dev.Path)) ||
-			(tpuproxyEnabled && shouldExposeTpuDevice(dev.Path))
+			(tpuproxyEnabled && shouldExposeTpuDevice(dev.Path)) ||
+			(vfioproxyEnabled && shouldExposeVFIODevice(dev.Path)) ||
+			(drmproxyEnabled && shouldExposeDRMDevice(dev.Path)) ||
+			(ptpproxyEnabled && shouldExposePTPDevice(dev.Path))
 		if !shouldMount {
 			continue
 		}
-		dst := filepath.Join(root, dev.Path)
-		log.Infof("Mounting device %q as bind mount at %q", dev.Path, dst)
-		if err := specutils.SafeSetupAndMount(dev.Path, dst, "bind", unix.MS_BIND, procPath); err != nil {
-			return fmt.Errorf("mounting %q: %v", dev.Path, err)
+		devPaths[dev.Path] = struct{}{}
+	}
+	if specutils.VFIOFunctionalityRequested(spec, conf) {
+		// The VFIO container device is required to use VFIO groups, but may
+		// not be in the spec.
+		devPaths[specutils.VFIOContainerDevicePath] = struct{}{}
+	}
+	for devPath := range devPaths {
+		dst := filepath.Join(root, devPath)
+		log.Infof("Mounting device %q as bind mount at %q", devPath, dst)
+		if err := specutils.SafeSetupAndMount(devPath, dst, "bind", unix.MS_BIND, procPath); err != nil {
+			return fmt.Errorf("mounting %q: %v", devPath, err)
 		}
 	}
 	return nil
@@ -21,6 +21,9 @@ import (
 	"path"
 	"path/filepath"
 	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/runsc/config"
 )
 
 func tmpDir() string {
@@ -161,3 +164,52 @@ func TestResolveSymlinksLoop(t *testing.T) {
 		t.Errorf("resolveSymlinks() should have failed")
 	}
 }
+
+func TestHostPathAllowed(t *testing.T) {
+	allowed := []string{"/srv/containers", "/data/"}
+	for _, tst := range []struct {
+		path string
+		want bool
+	}{
+		{path: "/srv/containers", want: true},
+		{path: "/srv/containers/abc/rootfs", want: true},
+		{path: "/data/volume", want: true},
+		{path: "/srv", want: false},
+		{path: "/srv/containers2", want: false},
+		{path: "/srv/other/..data", want: false},
+		{path: "/", want: false},
+		{path: "/etc", want: false},
+	} {
+		if got := hostPathAllowed(allowed, tst.path); got != tst.want {
+			t.Errorf("hostPathAllowed(%q, %q) = %t, want %t", allowed, tst.path, got, tst.want)
+		}
+	}
+}
+
+func TestHostOverlaySize(t *testing.T) {
+	limit := int64(256 << 20)
+	withLimit := &specs.Spec{
+		Linux: &specs.Linux{
+			Resources: &specs.LinuxResources{
+				Memory: &specs.LinuxMemory{Limit: &limit},
+			},
+		},
+	}
+	for _, tst := range []struct {
+		name string
+		spec *specs.Spec
+		size string
+		want string
+	}{
+		{name: "default", spec: &specs.Spec{}, want: "50%"},
+		{name: "memory-limit", spec: withLimit, want: "268435456"},
+		{name: "flag", spec: withLimit, size: "1g", want: "1g"},
+	} {
+		t.Run(tst.name, func(t *testing.T) {
+			conf := &config.Config{HostOverlaySize: tst.size}
+			if got := hostOverlaySize(tst.spec, conf); got != tst.want {
+				t.Errorf("hostOverlaySize() = %q, want %q", got, tst.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// Health implements subcommands.Command for the "health" command.
+type Health struct {
+	timeout time.Duration
+	format  string
+}
+
+// Name implements subcommands.Command.Name.
+func (*Health) Name() string {
+	return "health"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Health) Synopsis() string {
+	return "check the health of a sandbox"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Health) Usage() string {
+	return `health [flags] <container id> - check the health of the sandbox running a container.
+
+The sentry checks that no task is stuck in the kernel according to the
+watchdog, that all gofers respond, that the platform can create address spaces
+and that no network interface has a stalled transmit queue. The command exits
+with status 1 if the sandbox is not running or any check fails.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (h *Health) SetFlags(f *flag.FlagSet) {
+	f.DurationVar(&h.timeout, "timeout", boot.DefaultHealthTimeout, "time after which a check that did not complete is reported as unhealthy")
+	f.StringVar(&h.format, "format", "text", "output format: 'text' (default) or 'json'")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (h *Health) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*config.Config)
+
+	cont, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{SkipCheck: true})
+	if err != nil {
+		util.Fatalf("loading container: %v", err)
+	}
+	if cont.Sandbox == nil || !cont.Sandbox.IsRunning() {
+		return util.Errorf("sandbox of container %q is not running", id)
+	}
+	report, err := cont.Sandbox.Health(h.timeout)
+	if err != nil {
+		return util.Errorf("%v", err)
+	}
+	if err := writeHealthReport(&util.Writer{}, report, h.format); err != nil {
+		util.Fatalf("%v", err)
+	}
+	if !report.Healthy {
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// writeHealthReport writes report to w in the given format.
+func writeHealthReport(w io.Writer, report *boot.HealthReport, format string) error {
+	switch format {
+	case "text":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprint(tw, "CHECK\tSTATUS\tMESSAGE\n")
+		for _, c := range report.Checks {
+			status := "ok"
+			if !c.Healthy {
+				status = "FAIL"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, status, c.Message)
+		}
+		return tw.Flush()
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("encoding health report: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown health format %q", format)
+	}
+}
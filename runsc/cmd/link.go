@@ -0,0 +1,130 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// Link implements subcommands.Command for the "link" command.
+type Link struct {
+	mtu        int
+	channels   int
+	txChecksum string
+	rxChecksum string
+}
+
+// Name implements subcommands.Command.Name.
+func (*Link) Name() string {
+	return "link"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Link) Synopsis() string {
+	return "print or change the configuration of a sandbox's network links"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Link) Usage() string {
+	return `link <container id> - print the configuration of the network links of the sandbox running a container.
+link [flags] <container id> <link name> - change the configuration of a network link.
+
+Only links that use the sandbox network stack with AF_PACKET sockets can be
+reconfigured. Changes are preserved across checkpoint and restore.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (l *Link) SetFlags(f *flag.FlagSet) {
+	f.IntVar(&l.mtu, "mtu", 0, "sets the MTU of the link. The MTU of the device in the sandbox network namespace is changed as well.")
+	f.IntVar(&l.channels, "channels", 0, "sets the number of channels (FDs) used by the link.")
+	f.StringVar(&l.txChecksum, "tx-checksum-offload", "", "enables or disables TX checksum offload: true or false.")
+	f.StringVar(&l.rxChecksum, "rx-checksum-offload", "", "enables or disables RX checksum offload: true or false.")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (l *Link) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 1 && f.NArg() != 2 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	conf := args[0].(*config.Config)
+	id := f.Arg(0)
+
+	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		util.Fatalf("loading container: %v", err)
+	}
+	if !c.IsSandboxRunning() {
+		return util.Errorf("sandbox of container %q is not running", id)
+	}
+	links, err := c.Sandbox.Links()
+	if err != nil {
+		return util.Errorf("%v", err)
+	}
+
+	if f.NArg() == 1 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprint(w, "NAME\tMTU\tCHANNELS\tTX-CSUM-OFFLOAD\tRX-CSUM-OFFLOAD\n")
+		for _, link := range links {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%t\t%t\n", link.Name, link.MTU, link.NumChannels, link.TXChecksumOffload, link.RXChecksumOffload)
+		}
+		w.Flush()
+		return subcommands.ExitSuccess
+	}
+
+	name := f.Arg(1)
+	found := false
+	for _, link := range links {
+		if link.Name != name {
+			continue
+		}
+		found = true
+		if l.mtu != 0 {
+			link.MTU = l.mtu
+		}
+		if l.channels != 0 {
+			link.NumChannels = l.channels
+		}
+		if l.txChecksum != "" {
+			if link.TXChecksumOffload, err = strconv.ParseBool(l.txChecksum); err != nil {
+				return util.Errorf("invalid value for tx-checksum-offload %q", l.txChecksum)
+			}
+		}
+		if l.rxChecksum != "" {
+			if link.RXChecksumOffload, err = strconv.ParseBool(l.rxChecksum); err != nil {
+				return util.Errorf("invalid value for rx-checksum-offload %q", l.rxChecksum)
+			}
+		}
+		if err := c.Sandbox.UpdateLink(conf, link); err != nil {
+			return util.Errorf("%v", err)
+		}
+		util.Infof("Network link %q updated: %+v", name, link)
+	}
+	if !found {
+		return util.Errorf("network link %q not found in sandbox of container %q", name, id)
+	}
+	return subcommands.ExitSuccess
+}
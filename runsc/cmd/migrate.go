@@ -0,0 +1,805 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/google/subcommands"
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/cleanup"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/memutil"
+	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
+	"gvisor.dev/gvisor/pkg/state/statefile"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/runsc/sandbox"
+	"gvisor.dev/gvisor/runsc/specutils"
+)
+
+// migrateVersion is the version of the migration protocol spoken between the
+// sending and the receiving runsc. Both must use the same version.
+const migrateVersion = 2
+
+// maxMigrateMsgSize is the maximum size of a migration protocol message,
+// excluding the container state.
+const maxMigrateMsgSize = 64 << 10
+
+// migrateAuthTimeout is the time limit for a peer to authenticate.
+const migrateAuthTimeout = 30 * time.Second
+
+// migrateNonceSize is the size of the random nonces exchanged by peers when
+// they authenticate.
+const migrateNonceSize = 32
+
+// migratePrecopyTarget is the amount of memory written to during a pre-copy
+// round below which the container is stopped and checkpointed, since the
+// checkpoint then takes about as long as another round would.
+const migratePrecopyTarget = 64 << 20
+
+// migrateHello is sent by the sending runsc once it is authenticated, and is
+// followed by the container state once the receiving runsc accepts it.
+type migrateHello struct {
+	Version     int    `json:"version"`
+	ContainerID string `json:"container_id"`
+}
+
+// migrateStep is sent by the sending runsc before each part of the container
+// state.
+type migrateStep struct {
+	// Precopy is set if the part is a pre-copy round of the container's
+	// memory, written by writeMigrateChunks, while the container keeps
+	// running. Otherwise, the part is the checkpoint of the container, which
+	// extends to the end of the stream.
+	Precopy bool `json:"precopy"`
+}
+
+// migrateResult is sent by the receiving runsc, once in reply to migrateHello
+// and once after restoring the container.
+type migrateResult struct {
+	// Error is set if the migration failed.
+	Error string `json:"error,omitempty"`
+
+	// HookError is set if the container was restored, but the acquire hook
+	// failed.
+	HookError string `json:"hook_error,omitempty"`
+}
+
+// writeMigrateMsg writes v as a length-prefixed JSON message.
+func writeMigrateMsg(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxMigrateMsgSize {
+		return fmt.Errorf("message too large: %d bytes", len(data))
+	}
+	msg := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(msg, uint32(len(data)))
+	_, err = w.Write(append(msg, data...))
+	return err
+}
+
+// readMigrateMsg reads a message written by writeMigrateMsg into v. It doesn't
+// read past the end of the message, so that the container state following it
+// is left in r.
+func readMigrateMsg(r io.Reader, v any) error {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return err
+	}
+	size := binary.BigEndian.Uint32(hdr[:])
+	if size > maxMigrateMsgSize {
+		return fmt.Errorf("message too large: %d bytes", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// migrateMAC returns the HMAC-SHA256 of label and parts with key.
+func migrateMAC(key []byte, label string, parts ...[]byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(label))
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+// migrateAuth authenticates the peer connected to rw as knowing token, and
+// proves that this runsc knows it too, without revealing it. It returns the
+// session key, which is unique to the connection. The sending runsc proves
+// itself first, so that the receiving runsc doesn't answer peers that don't
+// know the token.
+func migrateAuth(rw io.ReadWriter, token []byte, sender bool) ([]byte, error) {
+	nonce := make([]byte, migrateNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	peerNonce := make([]byte, migrateNonceSize)
+	var senderNonce, receiverNonce []byte
+	if sender {
+		if _, err := rw.Write(nonce); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(rw, peerNonce); err != nil {
+			return nil, err
+		}
+		senderNonce, receiverNonce = nonce, peerNonce
+	} else {
+		if _, err := io.ReadFull(rw, peerNonce); err != nil {
+			return nil, err
+		}
+		if _, err := rw.Write(nonce); err != nil {
+			return nil, err
+		}
+		senderNonce, receiverNonce = peerNonce, nonce
+	}
+
+	senderProof := migrateMAC(token, "runsc migrate sender", senderNonce, receiverNonce)
+	receiverProof := migrateMAC(token, "runsc migrate receiver", senderNonce, receiverNonce)
+	peerProof := make([]byte, sha256.Size)
+	if sender {
+		if _, err := rw.Write(senderProof); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(rw, peerProof); err != nil {
+			return nil, fmt.Errorf("reading proof of the receiver, which may have rejected the token: %w", err)
+		}
+		if !hmac.Equal(peerProof, receiverProof) {
+			return nil, errors.New("the receiver doesn't know the token")
+		}
+	} else {
+		if _, err := io.ReadFull(rw, peerProof); err != nil {
+			return nil, err
+		}
+		if !hmac.Equal(peerProof, senderProof) {
+			return nil, errors.New("the sender doesn't know the token")
+		}
+		if _, err := rw.Write(receiverProof); err != nil {
+			return nil, err
+		}
+	}
+	return migrateMAC(token, "runsc migrate key", senderNonce, receiverNonce), nil
+}
+
+// migrateRoundKey returns the key of the statefile stream of the n-th
+// pre-copy round, so that rounds can't be replayed or reordered.
+func migrateRoundKey(key []byte, n uint64) []byte {
+	var nb [8]byte
+	binary.BigEndian.PutUint64(nb[:], n)
+	return migrateMAC(key, "runsc migrate round", nb[:])
+}
+
+// migrateCheckpointKey returns the key of the statefile stream of the
+// checkpoint.
+func migrateCheckpointKey(key []byte) []byte {
+	return migrateMAC(key, "runsc migrate checkpoint")
+}
+
+// migrateSealedMsg is a message sent over an authenticated connection.
+type migrateSealedMsg struct {
+	Data json.RawMessage `json:"data"`
+	MAC  []byte          `json:"mac"`
+}
+
+// migrateSession exchanges messages with an authenticated peer, such that
+// messages that are altered, replayed or reordered are rejected.
+type migrateSession struct {
+	rw  io.ReadWriter
+	key []byte
+
+	// sendLabel and recvLabel distinguish the messages sent by each peer.
+	sendLabel string
+	recvLabel string
+
+	// sent and received are the number of messages sent and received.
+	sent     uint64
+	received uint64
+}
+
+// newMigrateSession returns a session with the peer connected to rw, keyed
+// with the key returned by migrateAuth.
+func newMigrateSession(rw io.ReadWriter, key []byte, sender bool) *migrateSession {
+	s := &migrateSession{rw: rw, key: key, sendLabel: "sender", recvLabel: "receiver"}
+	if !sender {
+		s.sendLabel, s.recvLabel = s.recvLabel, s.sendLabel
+	}
+	return s
+}
+
+// mac returns the MAC of the n-th message with data sent by label.
+func (s *migrateSession) mac(label string, n uint64, data []byte) []byte {
+	var nb [8]byte
+	binary.BigEndian.PutUint64(nb[:], n)
+	return migrateMAC(s.key, "runsc migrate message "+label, nb[:], data)
+}
+
+// write sends v to the peer.
+func (s *migrateSession) write(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	msg := migrateSealedMsg{Data: data, MAC: s.mac(s.sendLabel, s.sent, data)}
+	s.sent++
+	return writeMigrateMsg(s.rw, &msg)
+}
+
+// read receives a message sent by the peer's write into v.
+func (s *migrateSession) read(v any) error {
+	var msg migrateSealedMsg
+	if err := readMigrateMsg(s.rw, &msg); err != nil {
+		return err
+	}
+	if !hmac.Equal(msg.MAC, s.mac(s.recvLabel, s.received, msg.Data)) {
+		return errors.New("message failed authentication")
+	}
+	s.received++
+	return json.Unmarshal(msg.Data, v)
+}
+
+// migrateChunkSize is the maximum size of chunks written by
+// writeMigrateChunks.
+const migrateChunkSize = 1 << 20
+
+// writeMigrateChunks copies r to w in length-prefixed chunks, followed by an
+// empty chunk, so that the receiver can find the end of the data without
+// closing the connection.
+func writeMigrateChunks(w io.Writer, r io.Reader) error {
+	buf := make([]byte, 4+migrateChunkSize)
+	for {
+		n, err := r.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err := w.Write(buf[:4+n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	var end [4]byte
+	_, err := w.Write(end[:])
+	return err
+}
+
+// migrateChunkReader reads the data written by writeMigrateChunks, and
+// returns io.EOF at the empty chunk that ends it. It doesn't read past the
+// empty chunk.
+type migrateChunkReader struct {
+	r io.Reader
+
+	// left is the number of bytes left in the current chunk.
+	left uint32
+
+	// done is set once the empty chunk has been read.
+	done bool
+}
+
+// Read implements io.Reader.Read.
+func (c *migrateChunkReader) Read(p []byte) (int, error) {
+	if c.done {
+		return 0, io.EOF
+	}
+	if c.left == 0 {
+		var hdr [4]byte
+		if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		c.left = binary.BigEndian.Uint32(hdr[:])
+		if c.left > migrateChunkSize {
+			return 0, fmt.Errorf("chunk too large: %d bytes", c.left)
+		}
+		if c.left == 0 {
+			c.done = true
+			return 0, io.EOF
+		}
+	}
+	if uint32(len(p)) > c.left {
+		p = p[:c.left]
+	}
+	n, err := c.r.Read(p)
+	c.left -= uint32(n)
+	if n > 0 {
+		return n, nil
+	}
+	return 0, unexpectedEOF(err)
+}
+
+// unexpectedEOF returns io.ErrUnexpectedEOF if err is io.EOF, and err
+// otherwise.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readMigrateToken reads the shared token from path.
+func readMigrateToken(path string) ([]byte, error) {
+	if path == "" {
+		return nil, errors.New("--token-file is required")
+	}
+	token, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading token: %w", err)
+	}
+	token = bytes.TrimSpace(token)
+	if len(token) == 0 {
+		return nil, fmt.Errorf("token file %q is empty", path)
+	}
+	return token, nil
+}
+
+// runMigrateHook runs hook, if set, to move the network identity of container
+// id to or from peer.
+func runMigrateHook(hook, action, id, peer string) error {
+	if hook == "" {
+		return nil
+	}
+	log.Infof("Running migration hook %q %s for container %q", hook, action, id)
+	cmd := exec.Command(hook, action)
+	cmd.Env = append(os.Environ(),
+		"RUNSC_MIGRATE_CONTAINER_ID="+id,
+		"RUNSC_MIGRATE_PEER="+peer,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s %s: %v: %s", hook, action, err, out)
+	}
+	return nil
+}
+
+// Migrate implements subcommands.Command for the "migrate" command.
+type Migrate struct {
+	// Migrate flags on the receiving host are a super-set of those for Create.
+	Create
+
+	// to is the address of the receiving runsc, on the sending host.
+	to string
+
+	// listen is the address to wait for the container on, on the receiving
+	// host.
+	listen string
+
+	// tokenFile is the path of a file with the token shared by the sending
+	// and the receiving runsc.
+	tokenFile string
+
+	// precopyRounds is the maximum number of rounds of pre-copying memory
+	// before the container is stopped.
+	precopyRounds int
+
+	// hook is run to hand over the network identity of the container.
+	hook string
+
+	// compression is the compression of the transferred state.
+	compression CheckpointCompression
+
+	// detach indicates that runsc has to exit once the container is restored,
+	// without waiting for it.
+	detach bool
+}
+
+// Name implements subcommands.Command.Name.
+func (*Migrate) Name() string {
+	return "migrate"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Migrate) Synopsis() string {
+	return "move a container to another host (experimental)"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Migrate) Usage() string {
+	return `migrate [flags] <container id> - move a container to another host.
+
+The container's memory is copied to the receiving host in rounds while it keeps
+running, each of which copies the memory written to since the previous one.
+Once little memory is written to between rounds, the container is checkpointed
+and the rest of its state is streamed to the receiving host, which restores it
+without writing an image to disk. The container is stopped from the start of
+the checkpoint until it is restored.
+
+Both hosts must be given the same secret token, which the sending and the
+receiving runsc use to authenticate each other before any state is sent, and
+to protect the integrity of the state. The state is not encrypted, so the
+hosts must be connected by a trusted network or an encrypted tunnel.
+
+On the receiving host, wait for the container with its bundle:
+
+	# runsc migrate --listen :7000 --token-file /path/to/token --bundle /path/to/bundle <container id>
+
+On the sending host, move the container:
+
+	# runsc migrate --to receiver:7000 --token-file /path/to/token <container id>
+
+If --hook is set, it is run with "release" on the sending host once the
+container is stopped, and with "acquire" on the receiving host once the
+container is restored, to move addresses and routes along with the container.
+The hook gets the container ID and the address of the other host in the
+RUNSC_MIGRATE_CONTAINER_ID and RUNSC_MIGRATE_PEER environment variables.
+
+OPTIONS:
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (m *Migrate) SetFlags(f *flag.FlagSet) {
+	m.Create.SetFlags(f)
+	f.StringVar(&m.to, "to", "", "address of the receiving runsc, on the sending host")
+	f.StringVar(&m.listen, "listen", "", "address to wait for the container on, on the receiving host")
+	f.StringVar(&m.tokenFile, "token-file", "", "file containing a secret token shared by the sending and the receiving host (required)")
+	f.IntVar(&m.precopyRounds, "precopy-rounds", 5, "on the sending host, maximum number of rounds of copying memory before stopping the container")
+	f.StringVar(&m.hook, "hook", "", "program run to release or acquire the network identity of the container")
+	f.Var(newCheckpointCompressionValue(statefile.CompressionLevelFlateBestSpeed, &m.compression), "compression", "compress the transferred state. Values: none|flate-best-speed.")
+	f.BoolVar(&m.detach, "detach", false, "on the receiving host, detach from the container's process once restored")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (m *Migrate) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 1 || (m.to == "") == (m.listen == "") || m.precopyRounds < 0 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*config.Config)
+	waitStatus := args[1].(*unix.WaitStatus)
+
+	token, err := readMigrateToken(m.tokenFile)
+	if err != nil {
+		return util.Errorf("%v", err)
+	}
+	if m.to != "" {
+		return m.send(conf, id, token)
+	}
+	return m.receive(conf, id, token, waitStatus)
+}
+
+// send checkpoints container id into a connection to the receiving runsc.
+func (m *Migrate) send(conf *config.Config, id string, token []byte) subcommands.ExitStatus {
+	cont, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		return util.Errorf("loading container: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", m.to)
+	if err != nil {
+		return util.Errorf("connecting to %s: %v", m.to, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(migrateAuthTimeout))
+	key, err := migrateAuth(conn, token, true /* sender */)
+	if err != nil {
+		return util.Errorf("authenticating with %s: %v", m.to, err)
+	}
+	conn.SetDeadline(time.Time{})
+	s := newMigrateSession(conn, key, true /* sender */)
+
+	if err := s.write(&migrateHello{Version: migrateVersion, ContainerID: id}); err != nil {
+		return util.Errorf("sending migration request: %v", err)
+	}
+	var res migrateResult
+	if err := s.read(&res); err != nil {
+		return util.Errorf("reading reply to migration request: %v", err)
+	}
+	if res.Error != "" {
+		return util.Errorf("%s refused the migration: %s", m.to, res.Error)
+	}
+
+	// The container keeps running if it isn't checkpointed.
+	cancelPrecopy := cleanup.Make(func() {
+		if err := cont.CancelPrecopy(); err != nil {
+			log.Warningf("Cancelling pre-copy of container %q: %v", id, err)
+		}
+	})
+	defer cancelPrecopy.Clean()
+	opts := statefile.Options{Compression: m.compression.Level()}
+	log.Infof("Migrating container %q to %s", id, m.to)
+	if err := m.precopy(cont, s, key, opts); err != nil {
+		return util.Errorf("pre-copying memory: %v", err)
+	}
+
+	// The sandbox writes the state to the connection directly, and exits once
+	// it's done.
+	if err := s.write(&migrateStep{}); err != nil {
+		return util.Errorf("sending checkpoint: %v", err)
+	}
+	tcpConn := conn.(*net.TCPConn)
+	file, err := tcpConn.File()
+	if err != nil {
+		return util.Errorf("getting connection file: %v", err)
+	}
+	cancelPrecopy.Release()
+	stoppedAt := time.Now()
+	err = cont.CheckpointPrecopied(file, opts, migrateCheckpointKey(key))
+	file.Close()
+	if err != nil {
+		return util.Errorf("checkpoint failed: %v", err)
+	}
+	if err := tcpConn.CloseWrite(); err != nil {
+		return util.Errorf("finishing state transfer: %v", err)
+	}
+	hookErr := runMigrateHook(m.hook, "release", id, m.to)
+
+	if err := s.read(&res); err != nil {
+		return util.Errorf("reading migration result: %v", err)
+	}
+	if res.Error != "" {
+		return util.Errorf("restoring container on %s failed: %s", m.to, res.Error)
+	}
+	if err := cont.Destroy(); err != nil {
+		return util.Errorf("destroying migrated container: %v", err)
+	}
+	if hookErr != nil {
+		return util.Errorf("container migrated, but release hook failed: %v", hookErr)
+	}
+	if res.HookError != "" {
+		return util.Errorf("container migrated, but acquire hook on %s failed: %s", m.to, res.HookError)
+	}
+	log.Infof("Container %q migrated to %s, it was stopped for %v", id, m.to, time.Since(stoppedAt))
+	return subcommands.ExitSuccess
+}
+
+// precopy sends rounds of cont's memory over s until little memory is written
+// to between rounds, memory written to stops decreasing, or m.precopyRounds
+// rounds are sent.
+func (m *Migrate) precopy(cont *container.Container, s *migrateSession, key []byte, opts statefile.Options) error {
+	var lastDirty uint64
+	for round := 0; round < m.precopyRounds; round++ {
+		if err := s.write(&migrateStep{Precopy: true}); err != nil {
+			return err
+		}
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		type precopyResult struct {
+			pages, dirty uint64
+			err          error
+		}
+		done := make(chan precopyResult, 1)
+		roundKey := migrateRoundKey(key, uint64(round))
+		go func() {
+			res, err := cont.Precopy(pw, opts, roundKey)
+			pw.Close()
+			done <- precopyResult{res.Pages, res.DirtyPages, err}
+		}()
+		err = writeMigrateChunks(s.rw, pr)
+		pr.Close()
+		res := <-done
+		if res.err != nil {
+			return res.err
+		}
+		if err != nil {
+			return err
+		}
+		log.Infof("Pre-copy round %d sent %d pages, %d pages written to since", round, res.pages, res.dirty)
+		if res.dirty*hostarch.PageSize <= migratePrecopyTarget || (round > 0 && res.dirty >= lastDirty) {
+			break
+		}
+		lastDirty = res.dirty
+	}
+	return nil
+}
+
+// acceptMigration accepts connections on ln until a peer authenticates with
+// token, and returns the connection and the session key. Connections from
+// peers that fail to authenticate are closed.
+func acceptMigration(ln net.Listener, token []byte) (net.Conn, []byte, error) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return nil, nil, err
+		}
+		conn.SetDeadline(time.Now().Add(migrateAuthTimeout))
+		key, err := migrateAuth(conn, token, false /* sender */)
+		if err != nil {
+			log.Warningf("Rejecting migration from %s: %v", conn.RemoteAddr(), err)
+			conn.Close()
+			continue
+		}
+		conn.SetDeadline(time.Time{})
+		return conn, key, nil
+	}
+}
+
+// receive waits for the state of a container from the sending runsc, and
+// restores it as container id.
+func (m *Migrate) receive(conf *config.Config, id string, token []byte, waitStatus *unix.WaitStatus) subcommands.ExitStatus {
+	if conf.Rootless {
+		return util.Errorf("Rootless mode not supported with %q", m.Name())
+	}
+	bundleDir := m.bundleDir
+	if bundleDir == "" {
+		bundleDir = getwdOrDie()
+	}
+	spec, err := specutils.ReadSpec(bundleDir, conf)
+	if err != nil {
+		return util.Errorf("reading spec: %v", err)
+	}
+	specutils.LogSpecDebug(spec, conf.OCISeccomp)
+
+	ln, err := net.Listen("tcp", m.listen)
+	if err != nil {
+		return util.Errorf("listening on %s: %v", m.listen, err)
+	}
+	log.Infof("Waiting for container %q on %s", id, ln.Addr())
+	conn, key, err := acceptMigration(ln, token)
+	ln.Close()
+	if err != nil {
+		return util.Errorf("accepting migration: %v", err)
+	}
+	defer conn.Close()
+	peer := conn.RemoteAddr().String()
+	s := newMigrateSession(conn, key, false /* sender */)
+
+	var hello migrateHello
+	if err := s.read(&hello); err != nil {
+		return util.Errorf("reading migration request: %v", err)
+	}
+	if hello.Version != migrateVersion {
+		err := fmt.Errorf("unsupported migration protocol version %d, want %d", hello.Version, migrateVersion)
+		s.write(&migrateResult{Error: err.Error()})
+		return util.Errorf("%v", err)
+	}
+	log.Infof("Receiving container %q from %s as %q", hello.ContainerID, peer, id)
+
+	// Create the container before accepting the request, so that the sending
+	// host doesn't stop the container if it can't be restored here.
+	var cu cleanup.Cleanup
+	defer cu.Clean()
+	runArgs := container.Args{
+		ID:            id,
+		Spec:          spec,
+		BundleDir:     bundleDir,
+		ConsoleSocket: m.consoleSocket,
+		PIDFile:       m.pidFile,
+		UserLog:       m.userLog,
+		Attached:      !m.detach,
+	}
+	c, err := container.New(conf, runArgs)
+	if err != nil {
+		s.write(&migrateResult{Error: err.Error()})
+		return util.Errorf("creating container: %v", err)
+	}
+	cu.Add(func() {
+		c.Destroy()
+	})
+	if err := s.write(&migrateResult{}); err != nil {
+		return util.Errorf("accepting migration request: %v", err)
+	}
+
+	precopied, err := receivePrecopy(s, key)
+	if precopied != nil {
+		defer precopied.Close()
+	}
+	if err != nil {
+		return util.Errorf("receiving pre-copied memory: %v", err)
+	}
+
+	file, err := conn.(*net.TCPConn).File()
+	if err != nil {
+		s.write(&migrateResult{Error: err.Error()})
+		return util.Errorf("getting connection file: %v", err)
+	}
+	defer file.Close()
+	restoreOpts := sandbox.RestoreOpts{
+		Key:       migrateCheckpointKey(key),
+		Precopied: precopied,
+	}
+	if err := c.RestoreFromFile(conf, file, restoreOpts); err != nil {
+		s.write(&migrateResult{Error: err.Error()})
+		return util.Errorf("restoring container: %v", err)
+	}
+	cu.Release()
+
+	// The container is running from here on, so a failing hook is reported
+	// without destroying it.
+	var res migrateResult
+	hookErr := runMigrateHook(m.hook, "acquire", id, peer)
+	if hookErr != nil {
+		res.HookError = hookErr.Error()
+	}
+	if err := s.write(&res); err != nil {
+		log.Warningf("Failed to send migration result to %s: %v", peer, err)
+	}
+	if hookErr != nil {
+		return util.Errorf("container restored, but acquire hook failed: %v", hookErr)
+	}
+	log.Infof("Container %q restored from %s", id, peer)
+
+	// If we allocate a terminal, forward signals to the sandbox process.
+	// Otherwise, Ctrl+C will terminate this process and its children,
+	// including the terminal.
+	if c.Spec.Process.Terminal {
+		stopForwarding := c.ForwardSignals(0, true /* fgProcess */)
+		defer stopForwarding()
+	}
+	if runArgs.Attached {
+		ws, err := c.Wait()
+		if err != nil {
+			return util.Errorf("running container: %v", err)
+		}
+		*waitStatus = ws
+	}
+	return subcommands.ExitSuccess
+}
+
+// receivePrecopy receives the pre-copy rounds sent by the sending runsc's
+// precopy, until it announces the checkpoint. It returns a file containing
+// the pre-copied memory, or nil if no rounds were sent.
+func receivePrecopy(s *migrateSession, key []byte) (*os.File, error) {
+	var precopied *os.File
+	for round := uint64(0); ; round++ {
+		var step migrateStep
+		if err := s.read(&step); err != nil {
+			return precopied, err
+		}
+		if !step.Precopy {
+			return precopied, nil
+		}
+		if precopied == nil {
+			fd, err := memutil.CreateMemFD("runsc-migrate", 0)
+			if err != nil {
+				return nil, err
+			}
+			precopied = os.NewFile(uintptr(fd), "pre-copied memory")
+		}
+		chunks := &migrateChunkReader{r: s.rw}
+		r, _, err := statefile.NewReader(chunks, migrateRoundKey(key, round))
+		if err != nil {
+			return precopied, fmt.Errorf("round %d: %w", round, err)
+		}
+		pages, err := pgalloc.ReadPrecopyRound(r, precopied)
+		if err != nil {
+			return precopied, fmt.Errorf("round %d: %w", round, err)
+		}
+		// Read the rest of the round, which also checks its integrity.
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return precopied, fmt.Errorf("round %d: %w", round, err)
+		}
+		if _, err := io.Copy(io.Discard, chunks); err != nil {
+			return precopied, fmt.Errorf("round %d: %w", round, err)
+		}
+		log.Infof("Received pre-copy round %d with %d pages", round, pages)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestMigrateMsg(t *testing.T) {
+	var buf bytes.Buffer
+	want := migrateHello{Version: migrateVersion, ContainerID: "foo"}
+	if err := writeMigrateMsg(&buf, &want); err != nil {
+		t.Fatalf("writeMigrateMsg: %v", err)
+	}
+	const state = "container state"
+	buf.WriteString(state)
+
+	var got migrateHello
+	if err := readMigrateMsg(&buf, &got); err != nil {
+		t.Fatalf("readMigrateMsg: %v", err)
+	}
+	if got != want {
+		t.Errorf("readMigrateMsg got %+v, want %+v", got, want)
+	}
+	// The state following the message must be left untouched.
+	rest, err := io.ReadAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != state {
+		t.Errorf("got %q after the message, want %q", rest, state)
+	}
+}
+
+func TestMigrateMsgErrors(t *testing.T) {
+	var tooLarge [4]byte
+	binary.BigEndian.PutUint32(tooLarge[:], maxMigrateMsgSize+1)
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{name: "Empty"},
+		{name: "ShortHeader", data: []byte{0, 0}},
+		{name: "ShortMessage", data: []byte{0, 0, 0, 10, '{', '}'}},
+		{name: "TooLarge", data: tooLarge[:]},
+		{name: "NotJSON", data: []byte{0, 0, 0, 1, 'x'}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var res migrateResult
+			if err := readMigrateMsg(bytes.NewReader(tc.data), &res); err == nil {
+				t.Errorf("readMigrateMsg(%v) succeeded, want error", tc.data)
+			}
+		})
+	}
+}
+
+// authPair runs migrateAuth between a sender with senderToken and a receiver
+// with receiverToken, and returns their session keys and errors.
+func authPair(senderToken, receiverToken string) (senderKey, receiverKey []byte, senderErr, receiverErr error) {
+	sc, rc := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer rc.Close()
+		receiverKey, receiverErr = migrateAuth(rc, []byte(receiverToken), false /* sender */)
+	}()
+	senderKey, senderErr = migrateAuth(sc, []byte(senderToken), true /* sender */)
+	sc.Close()
+	<-done
+	return
+}
+
+func TestMigrateAuth(t *testing.T) {
+	senderKey, receiverKey, senderErr, receiverErr := authPair("secret", "secret")
+	if senderErr != nil || receiverErr != nil {
+		t.Fatalf("migrateAuth failed: sender: %v, receiver: %v", senderErr, receiverErr)
+	}
+	if !bytes.Equal(senderKey, receiverKey) {
+		t.Errorf("sender key %x doesn't match receiver key %x", senderKey, receiverKey)
+	}
+	otherKey, _, err, _ := authPair("secret", "secret")
+	if err != nil {
+		t.Fatalf("migrateAuth failed: %v", err)
+	}
+	if bytes.Equal(senderKey, otherKey) {
+		t.Errorf("session keys of different connections are equal")
+	}
+}
+
+func TestMigrateAuthWrongToken(t *testing.T) {
+	_, _, senderErr, receiverErr := authPair("secret", "other")
+	if senderErr == nil {
+		t.Errorf("sender authenticated the receiver with the wrong token")
+	}
+	if receiverErr == nil {
+		t.Errorf("receiver authenticated the sender with the wrong token")
+	}
+}
+
+func TestMigrateSession(t *testing.T) {
+	key := []byte("key")
+	var buf bytes.Buffer
+	sender := newMigrateSession(&buf, key, true /* sender */)
+	receiver := newMigrateSession(&buf, key, false /* sender */)
+	for _, want := range []migrateStep{{Precopy: true}, {}} {
+		if err := sender.write(&want); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		var got migrateStep
+		if err := receiver.read(&got); err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if got != want {
+			t.Errorf("read got %+v, want %+v", got, want)
+		}
+	}
+
+	// Replayed messages are rejected.
+	var first bytes.Buffer
+	replayed := newMigrateSession(&first, key, true /* sender */)
+	if err := replayed.write(&migrateStep{Precopy: true}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	receiver.rw = &first
+	if err := receiver.read(&migrateStep{}); err == nil {
+		t.Errorf("read of a replayed message succeeded")
+	}
+
+	// Messages sent by the receiver are not accepted as sent by the sender.
+	buf.Reset()
+	receiver = newMigrateSession(&buf, key, false /* sender */)
+	if err := receiver.write(&migrateResult{}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := newMigrateSession(&buf, key, false /* sender */).read(&migrateResult{}); err == nil {
+		t.Errorf("read of a reflected message succeeded")
+	}
+
+	// Messages with a different key are rejected.
+	buf.Reset()
+	if err := newMigrateSession(&buf, []byte("other"), true /* sender */).write(&migrateStep{}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := newMigrateSession(&buf, key, false /* sender */).read(&migrateStep{}); err == nil {
+		t.Errorf("read of a message with a different key succeeded")
+	}
+}
+
+func TestMigrateChunks(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), migrateChunkSize/4)
+	var buf bytes.Buffer
+	if err := writeMigrateChunks(&buf, bytes.NewReader(data)); err != nil {
+		t.Fatalf("writeMigrateChunks failed: %v", err)
+	}
+	const next = "next message"
+	buf.WriteString(next)
+
+	got, err := io.ReadAll(&migrateChunkReader{r: &buf})
+	if err != nil {
+		t.Fatalf("reading chunks failed: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("read %d bytes, want the %d bytes written", len(got), len(data))
+	}
+	// What follows the chunks must be left untouched.
+	if rest := buf.String(); rest != next {
+		t.Errorf("got %q after the chunks, want %q", rest, next)
+	}
+
+	// Truncated chunks are an error.
+	buf.Reset()
+	if err := writeMigrateChunks(&buf, bytes.NewReader(data)); err != nil {
+		t.Fatalf("writeMigrateChunks failed: %v", err)
+	}
+	truncated := buf.Bytes()[:buf.Len()-4]
+	if _, err := io.ReadAll(&migrateChunkReader{r: bytes.NewReader(truncated)}); err != io.ErrUnexpectedEOF {
+		t.Errorf("reading truncated chunks got error %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
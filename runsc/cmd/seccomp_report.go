@@ -0,0 +1,138 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/google/subcommands"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/runsc/specutils"
+	"gvisor.dev/gvisor/runsc/specutils/seccomp"
+)
+
+// SeccompReport implements subcommands.Command for the "seccomp-report"
+// command.
+type SeccompReport struct {
+	bundleDir string
+	format    string
+}
+
+// seccompReport is the output of the "seccomp-report" command.
+type seccompReport struct {
+	// Applied is true if the profile is applied in the sandbox with the
+	// current configuration.
+	Applied bool `json:"applied"`
+
+	// Differences are the parts of the profile that behave differently
+	// under gVisor.
+	Differences []seccomp.Difference `json:"differences"`
+}
+
+// Name implements subcommands.Command.Name.
+func (*SeccompReport) Name() string {
+	return "seccomp-report"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*SeccompReport) Synopsis() string {
+	return "report how the OCI seccomp profile of a bundle is applied"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*SeccompReport) Usage() string {
+	return `seccomp-report [flags] - report how the OCI seccomp profile of a bundle is applied.
+
+The profile is only applied inside the sandbox with --oci-seccomp. The report
+lists the rules that are ignored, redundant or unsupported under gVisor. The
+command exits with status 1 if the profile can't be applied.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (s *SeccompReport) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&s.bundleDir, "bundle", ".", "path to the root of the OCI bundle")
+	f.StringVar(&s.format, "format", "text", "output format: 'text' (default) or 'json'")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (s *SeccompReport) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 0 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	conf := args[0].(*config.Config)
+
+	// Read the spec as is, since specutils.ReadSpec removes profiles that are
+	// redundant with the sandbox's own filters.
+	specFile, err := specutils.OpenSpec(s.bundleDir)
+	if err != nil {
+		util.Fatalf("opening spec: %v", err)
+	}
+	defer specFile.Close()
+	var spec specs.Spec
+	if err := json.NewDecoder(specFile).Decode(&spec); err != nil {
+		util.Fatalf("reading spec: %v", err)
+	}
+	if spec.Linux == nil || spec.Linux.Seccomp == nil {
+		return util.Errorf("spec has no seccomp profile")
+	}
+
+	report := &seccompReport{
+		Applied:     conf.OCISeccomp,
+		Differences: seccomp.Report(spec.Linux.Seccomp),
+	}
+	if err := writeSeccompReport(&util.Writer{}, report, s.format); err != nil {
+		util.Fatalf("%v", err)
+	}
+	if _, err := seccomp.BuildProgram(spec.Linux.Seccomp); err != nil {
+		return util.Errorf("profile can't be applied: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
+
+// writeSeccompReport writes report to w in the given format.
+func writeSeccompReport(w io.Writer, report *seccompReport, format string) error {
+	switch format {
+	case "text":
+		if report.Applied {
+			fmt.Fprint(w, "Profile is applied inside the sandbox.\n")
+		} else {
+			fmt.Fprint(w, "Profile is ignored, use --oci-seccomp to apply it inside the sandbox.\n")
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprint(tw, "KIND\tSYSCALL\tDETAIL\n")
+		for _, d := range report.Differences {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", d.Kind, d.Syscall, d.Detail)
+		}
+		return tw.Flush()
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("encoding seccomp report: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown seccomp report format %q", format)
+	}
+}
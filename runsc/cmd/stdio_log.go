@@ -0,0 +1,120 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/runsc/stdiolog"
+)
+
+// StdioLog implements subcommands.Command for the "stdio-log" command.
+type StdioLog struct {
+	containerID string
+	stdoutFD    int
+	stderrFD    int
+}
+
+// Name implements subcommands.Command.Name.
+func (*StdioLog) Name() string {
+	return "stdio-log"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*StdioLog) Synopsis() string {
+	return "log a container's stdout and stderr as JSON records, as configured by --stdio-log"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*StdioLog) Usage() string {
+	return `stdio-log --container-id=ID --stdout-fd=FD --stderr-fd=FD`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (s *StdioLog) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&s.containerID, "container-id", "", "ID of the container whose output is logged")
+	f.IntVar(&s.stdoutFD, "stdout-fd", -1, "read end of the container's stdout")
+	f.IntVar(&s.stderrFD, "stderr-fd", -1, "read end of the container's stderr")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (s *StdioLog) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 0 || s.stdoutFD < 0 || s.stderrFD < 0 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	conf := args[0].(*config.Config)
+
+	opts := stdiolog.Options{
+		ContainerID: s.containerID,
+		Rate:        conf.StdioLogRate,
+		MaxSize:     conf.StdioLogMaxSize,
+	}
+	if conf.StdioLogRedact {
+		opts.Rules = stdiolog.DefaultRules()
+	}
+	if conf.StdioLogRedactPatterns != "" {
+		rules, err := stdiolog.LoadRules(conf.StdioLogRedactPatterns)
+		if err != nil {
+			util.Fatalf("loading stdio-log-redact-patterns: %v", err)
+		}
+		opts.Rules = append(opts.Rules, rules...)
+	}
+
+	// Records go to the container's stdout and stderr, which the caller passes
+	// as ours, or both go to the log file.
+	var stdout, stderr io.Writer = os.Stdout, os.Stderr
+	if conf.StdioLog != config.StdioLogStdio {
+		file, err := os.OpenFile(conf.StdioLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			util.Fatalf("opening stdio-log file: %v", err)
+		}
+		defer file.Close()
+		stdout, stderr = file, file
+	}
+
+	l := stdiolog.New(opts)
+	var wg sync.WaitGroup
+	for _, stream := range []struct {
+		name string
+		fd   int
+		w    io.Writer
+	}{
+		{stdiolog.Stdout, s.stdoutFD, stdout},
+		{stdiolog.Stderr, s.stderrFD, stderr},
+	} {
+		r := os.NewFile(uintptr(stream.fd), stream.name)
+		wg.Add(1)
+		go func(name string, w io.Writer, r *os.File) {
+			defer wg.Done()
+			defer r.Close()
+			if err := l.Copy(w, name, r); err != nil {
+				log.Warningf("Logging container %s: %v", name, err)
+			}
+		}(stream.name, stream.w, r)
+	}
+	// The pipes reach EOF once every process in the container that holds
+	// them, and the sandbox, have exited.
+	wg.Wait()
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,398 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/google/subcommands"
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/state/statefile"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/container"
+	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/runsc/sandbox"
+	"gvisor.dev/gvisor/runsc/specutils"
+)
+
+// upgradeEnv is the environment variable through which runsc hands the
+// container over to the new runsc binary across exec. It holds a JSON-encoded
+// upgradeHandoff.
+const upgradeEnv = "RUNSC_UPGRADE"
+
+// upgradeHandoff is passed from the runsc that checkpointed the container to
+// the runsc that restores it.
+type upgradeHandoff struct {
+	// StateFD is the FD of the in-memory file holding the container state.
+	StateFD int `json:"state_fd"`
+
+	// Bundle is the bundle directory of the container.
+	Bundle string `json:"bundle"`
+
+	// Fallback, if set, is the path of the previous runsc binary, which is
+	// exec'd to restore the container if the new binary fails to.
+	Fallback string `json:"fallback,omitempty"`
+
+	// StoppedAt is the time at which the container was stopped, to report
+	// how long it was paused.
+	StoppedAt time.Time `json:"stopped_at"`
+
+	// StdioFDs are the FDs of the stdin, stdout and stderr of the original
+	// sandbox, which are reused by the restored one.
+	StdioFDs [3]int `json:"stdio_fds"`
+
+	// Original is the JSON-encoded container.Container that is being
+	// replaced. It was detached with container.Container.Detach, and is
+	// either reattached or replaced once the container has been restored.
+	Original json.RawMessage `json:"original"`
+}
+
+// upgradeEnviron returns environ with the handoff h set in it.
+func upgradeEnviron(environ []string, h *upgradeHandoff) ([]string, error) {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	env := make([]string, 0, len(environ)+1)
+	for _, kv := range environ {
+		if !strings.HasPrefix(kv, upgradeEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	return append(env, upgradeEnv+"="+string(data)), nil
+}
+
+// parseUpgradeHandoff parses the value of upgradeEnv.
+func parseUpgradeHandoff(val string) (*upgradeHandoff, error) {
+	var h upgradeHandoff
+	if err := json.Unmarshal([]byte(val), &h); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", upgradeEnv, err)
+	}
+	if h.StateFD < 0 || h.Bundle == "" || len(h.Original) == 0 {
+		return nil, fmt.Errorf("invalid %s: %q", upgradeEnv, val)
+	}
+	return &h, nil
+}
+
+// Upgrade implements subcommands.Command for the "upgrade" command.
+type Upgrade struct {
+	// binary is the path of the runsc binary to upgrade to.
+	binary string
+
+	// pidFile is the file to write the PID of the new sandbox process to.
+	pidFile string
+
+	// userLog is the file to write user-visible logs of the new sandbox to.
+	userLog string
+}
+
+// Name implements subcommands.Command.Name.
+func (*Upgrade) Name() string {
+	return "upgrade"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Upgrade) Synopsis() string {
+	return "replace the runsc binary of a running container (experimental)"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Upgrade) Usage() string {
+	return `upgrade [flags] <container id> - replace the runsc binary of a running container.
+
+The container is checkpointed into memory, its sandbox and gofer are stopped,
+and runsc execs the binary given by --binary, which restores the container in
+a new sandbox and gofer with the same ID and stdio. The container's state never
+touches the disk, and it is stopped from the start of the checkpoint until it
+is restored. If the new binary fails to restore the container, the previous
+binary restores it instead, and if that fails as well, the original sandbox
+is resumed. The original sandbox and gofer are only killed once the container
+has been restored.
+
+Only sandboxes running a single container without a terminal, self-backed
+overlay filestores or an overlay export can be upgraded. The sandbox process
+is replaced, so tools tracking its PID need to reload the container state;
+--pid-file may be used to record the new PID.
+
+OPTIONS:
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (u *Upgrade) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&u.binary, "binary", "", "path of the runsc binary to upgrade to. Defaults to the path this runsc was started from, which picks up a binary replaced in place.")
+	f.StringVar(&u.pidFile, "pid-file", "", "filename that the new sandbox pid will be written to")
+	f.StringVar(&u.userLog, "user-log", "", "filename to send user-visible logs of the new sandbox to")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (u *Upgrade) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*config.Config)
+	if conf.Rootless {
+		return util.Errorf("Rootless mode not supported with %q", u.Name())
+	}
+
+	if val, ok := os.LookupEnv(upgradeEnv); ok {
+		// We were exec'd to restore the container.
+		h, err := parseUpgradeHandoff(val)
+		if err != nil {
+			return util.Errorf("%v", err)
+		}
+		return u.restore(conf, id, h)
+	}
+	return u.checkpoint(conf, id)
+}
+
+// checkpoint checkpoints container id into memory, detaches it and execs the
+// new runsc binary to restore it.
+func (u *Upgrade) checkpoint(conf *config.Config, id string) subcommands.ExitStatus {
+	cont, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		return util.Errorf("loading container: %v", err)
+	}
+	if !cont.IsSandboxRoot() {
+		return util.Errorf("container %q is not the root container of its sandbox", id)
+	}
+	conts, err := container.LoadSandbox(conf.RootDir, cont.Sandbox.ID, container.LoadOpts{})
+	if err != nil {
+		return util.Errorf("loading sandbox: %v", err)
+	}
+	if len(conts) != 1 {
+		return util.Errorf("sandboxes with multiple containers can't be upgraded")
+	}
+	if cont.Spec.Process.Terminal {
+		return util.Errorf("containers with a terminal can't be upgraded")
+	}
+	if cont.BundleDir == "" {
+		return util.Errorf("container %q has no bundle directory", id)
+	}
+
+	binary := u.binary
+	if binary == "" {
+		// Use the path runsc was started from rather than /proc/self/exe,
+		// which refers to the running binary even once it has been replaced.
+		if binary, err = exec.LookPath(os.Args[0]); err != nil {
+			return util.Errorf("finding runsc binary: %v", err)
+		}
+	}
+	// Make sure that the new binary runs at all before stopping the
+	// container.
+	out, err := exec.Command(binary, "-version").Output()
+	if err != nil {
+		return util.Errorf("running %s: %v", binary, err)
+	}
+	log.Infof("Upgrading container %q to %s", id, strings.SplitN(string(out), "\n", 2)[0])
+
+	// Keep the previous binary open, so that it can restore the container if
+	// the new one fails to, even if it has been replaced on disk. None of the
+	// FDs handed over is close-on-exec.
+	fallbackFD, err := unix.Open("/proc/self/exe", unix.O_RDONLY, 0)
+	if err != nil {
+		return util.Errorf("opening runsc binary: %v", err)
+	}
+	stateFD, err := unix.MemfdCreate("runsc-upgrade-state", 0)
+	if err != nil {
+		return util.Errorf("creating state file: %v", err)
+	}
+	stateFile := os.NewFile(uintptr(stateFD), "upgrade state")
+	stdioFDs, err := sandboxStdioFDs(cont.SandboxPid())
+	if err != nil {
+		return util.Errorf("getting stdio of the sandbox: %v", err)
+	}
+	h := &upgradeHandoff{
+		StateFD:   stateFD,
+		Bundle:    cont.BundleDir,
+		Fallback:  fmt.Sprintf("/proc/self/fd/%d", fallbackFD),
+		StoppedAt: time.Now(),
+		StdioFDs:  stdioFDs,
+	}
+
+	// The sandbox must survive the checkpoint, so that it can be resumed if
+	// the container can't be restored. Since the kernel remains paused by
+	// Pause, an asynchronous checkpoint saves its state without killing it.
+	if err := cont.Pause(); err != nil {
+		return util.Errorf("pausing container: %v", err)
+	}
+	// The state is only held in memory, so skip compression.
+	if err := cont.Checkpoint(stateFile, statefile.Options{Compression: statefile.CompressionLevelNone}, true /* async */); err != nil {
+		_ = cont.Resume()
+		return util.Errorf("checkpoint failed: %v", err)
+	}
+	log.Infof("Container %q checkpointed in %v", id, time.Since(h.StoppedAt))
+	if h.Original, err = json.Marshal(cont); err != nil {
+		_ = cont.Resume()
+		return util.Errorf("encoding container: %v", err)
+	}
+	if err := cont.Detach(); err != nil {
+		_ = cont.Resume()
+		return util.Errorf("detaching container: %v", err)
+	}
+
+	env, err := upgradeEnviron(os.Environ(), h)
+	if err != nil {
+		if rerr := cont.Reattach(); rerr != nil {
+			return util.Errorf("encoding upgrade state: %v; resuming container: %v", err, rerr)
+		}
+		return util.Errorf("encoding upgrade state: %v", err)
+	}
+	argv := append([]string{binary}, os.Args[1:]...)
+	err = unix.Exec(binary, argv, env)
+	// Exec only returns on failure, in which case the current binary restores
+	// the container.
+	log.Warningf("Failed to exec %s, restoring container with the current binary: %v", binary, err)
+	h.Fallback = ""
+	return u.restore(conf, id, h)
+}
+
+// restore restores container id from the state handed over in h.
+func (u *Upgrade) restore(conf *config.Config, id string, h *upgradeHandoff) subcommands.ExitStatus {
+	var orig container.Container
+	if err := json.Unmarshal(h.Original, &orig); err != nil {
+		return util.Errorf("decoding original container: %v", err)
+	}
+	// The state file is inherited by the fallback binary, if it is exec'd
+	// below.
+	stateFile := os.NewFile(uintptr(h.StateFD), "upgrade state")
+	defer stateFile.Close()
+
+	c, err := u.restoreFromFile(conf, id, h, stateFile)
+	if err == nil {
+		if err := c.Replace(&orig); err != nil {
+			return util.Errorf("replacing original container: %v", err)
+		}
+		log.Infof("Container %q upgraded, it was stopped for %v", id, time.Since(h.StoppedAt))
+		return subcommands.ExitSuccess
+	}
+	if h.Fallback == "" {
+		if rerr := orig.Reattach(); rerr != nil {
+			return util.Errorf("restoring container: %v; resuming original container: %v", err, rerr)
+		}
+		return util.Errorf("restoring container: %v; resumed the original container", err)
+	}
+
+	log.Warningf("Failed to restore container %q, restoring it with the previous binary: %v", id, err)
+	fallback := h.Fallback
+	h.Fallback = ""
+	env, err := upgradeEnviron(os.Environ(), h)
+	if err != nil {
+		return util.Errorf("%v", err)
+	}
+	argv := append([]string{fallback}, os.Args[1:]...)
+	err = unix.Exec(fallback, argv, env)
+	if rerr := orig.Reattach(); rerr != nil {
+		return util.Errorf("exec %s: %v; resuming original container: %v", fallback, err, rerr)
+	}
+	return util.Errorf("exec %s: %v; resumed the original container", fallback, err)
+}
+
+// restoreFromFile creates container id from h.Bundle with the stdio of the
+// original sandbox, and restores it from stateFile. stateFile is not closed.
+func (u *Upgrade) restoreFromFile(conf *config.Config, id string, h *upgradeHandoff, stateFile *os.File) (*container.Container, error) {
+	if _, err := stateFile.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("rewinding state file: %w", err)
+	}
+	spec, err := specutils.ReadSpec(h.Bundle, conf)
+	if err != nil {
+		return nil, fmt.Errorf("reading spec: %w", err)
+	}
+	specutils.LogSpecDebug(spec, conf.OCISeccomp)
+
+	var c *container.Container
+	// The sandbox inherits its stdio from this process.
+	if err := withStdio(h.StdioFDs, func() error {
+		var err error
+		c, err = container.New(conf, container.Args{
+			ID:        id,
+			Spec:      spec,
+			BundleDir: h.Bundle,
+			PIDFile:   u.pidFile,
+			UserLog:   u.userLog,
+		})
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("creating container: %w", err)
+	}
+	if err := c.RestoreFromFile(conf, stateFile, sandbox.RestoreOpts{}); err != nil {
+		c.Destroy()
+		return nil, err
+	}
+	return c, nil
+}
+
+// sandboxStdioFDs returns duplicates of the stdin, stdout and stderr of the
+// sandbox process pid, which are not close-on-exec.
+func sandboxStdioFDs(pid int) ([3]int, error) {
+	var fds [3]int
+	pidfd, err := unix.PidfdOpen(pid, 0)
+	if err != nil {
+		return fds, fmt.Errorf("pidfd_open(%d): %w", pid, err)
+	}
+	defer unix.Close(pidfd)
+	for i := range fds {
+		fd, err := unix.PidfdGetfd(pidfd, i, 0)
+		if err != nil {
+			for _, fd := range fds[:i] {
+				unix.Close(fd)
+			}
+			return fds, fmt.Errorf("pidfd_getfd(%d): %w", i, err)
+		}
+		// pidfd_getfd(2) sets close-on-exec.
+		if _, err := unix.FcntlInt(uintptr(fd), unix.F_SETFD, 0); err != nil {
+			unix.Close(fd)
+			for _, fd := range fds[:i] {
+				unix.Close(fd)
+			}
+			return fds, fmt.Errorf("clearing close-on-exec: %w", err)
+		}
+		fds[i] = fd
+	}
+	return fds, nil
+}
+
+// withStdio calls fn with the stdin, stdout and stderr of this process
+// replaced by fds.
+func withStdio(fds [3]int, fn func() error) error {
+	for i := range fds {
+		fd, err := unix.FcntlInt(uintptr(i), unix.F_DUPFD_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("saving stdio: %w", err)
+		}
+		defer func(i, fd int) {
+			_ = unix.Dup3(fd, i, 0)
+			_ = unix.Close(fd)
+		}(i, fd)
+	}
+	for i, fd := range fds {
+		if err := unix.Dup3(fd, i, 0); err != nil {
+			return fmt.Errorf("replacing stdio: %w", err)
+		}
+	}
+	return fn()
+}
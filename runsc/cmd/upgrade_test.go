@@ -0,0 +1,72 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpgradeHandoff(t *testing.T) {
+	want := upgradeHandoff{
+		StateFD:   5,
+		Bundle:    "/bundle",
+		Fallback:  "/proc/self/fd/4",
+		StoppedAt: time.Unix(1000, 0).UTC(),
+		StdioFDs:  [3]int{6, 7, 8},
+		Original:  []byte(`{"id":"container"}`),
+	}
+	environ := []string{"PATH=/bin", upgradeEnv + `={"state_fd":3}`}
+	env, err := upgradeEnviron(environ, &want)
+	if err != nil {
+		t.Fatalf("upgradeEnviron: %v", err)
+	}
+
+	var vals []string
+	for _, kv := range env {
+		if val, ok := strings.CutPrefix(kv, upgradeEnv+"="); ok {
+			vals = append(vals, val)
+		}
+	}
+	if len(vals) != 1 {
+		t.Fatalf("upgradeEnviron returned %d %s variables, want 1: %v", len(vals), upgradeEnv, env)
+	}
+	if len(env) != 2 || env[0] != "PATH=/bin" {
+		t.Errorf("upgradeEnviron didn't preserve the environment: %v", env)
+	}
+	got, err := parseUpgradeHandoff(vals[0])
+	if err != nil {
+		t.Fatalf("parseUpgradeHandoff: %v", err)
+	}
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("parseUpgradeHandoff got %+v, want %+v", *got, want)
+	}
+}
+
+func TestParseUpgradeHandoffErrors(t *testing.T) {
+	for _, val := range []string{
+		"",
+		"{",
+		`{"state_fd":-1,"bundle":"/bundle","original":{}}`,
+		`{"state_fd":3,"original":{}}`,
+		`{"state_fd":3,"bundle":"/bundle"}`,
+	} {
+		if h, err := parseUpgradeHandoff(val); err == nil {
+			t.Errorf("parseUpgradeHandoff(%q) = %+v, want error", val, h)
+		}
+	}
+}
@@ -19,9 +19,12 @@ package config
 
 import (
 	"fmt"
+	"math"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -47,6 +50,10 @@ type Config struct {
 	// RootDir is the runtime root directory.
 	RootDir string `flag:"root"`
 
+	// ConfigFile is the path to the config file with default flag values and
+	// named profiles. See File.
+	ConfigFile string `flag:"config"`
+
 	// Traceback changes the Go runtime's traceback level.
 	Traceback string `flag:"traceback"`
 
@@ -98,6 +105,28 @@ type Config struct {
 	// DO NOT call it directly, use GetOverlay2() instead.
 	Overlay2 Overlay2 `flag:"overlay2"`
 
+	// HostOverlay makes the gofer overlay the root mount with the host's
+	// overlayfs and serve the merged view, instead of the sentry overlaying it.
+	// It only applies when the root mount is overlaid, and falls back to the
+	// sentry overlay when the host kernel lacks overlayfs support for the
+	// gofer. Failures to mount the overlay in the gofer are not retried with
+	// the sentry overlay: the container fails to start.
+	HostOverlay bool `flag:"host-overlay"`
+
+	// HostOverlaySize limits the size of the upper layer of the host overlay,
+	// which is kept in the gofer's memory, in tmpfs size syntax: a number of
+	// bytes with an optional k, m or g suffix, or a percentage of host memory.
+	// If empty, the container's memory limit is used, or half of host memory
+	// if it has none.
+	HostOverlaySize string `flag:"host-overlay-size"`
+
+	// OverlayExport is a host directory in which the gofer exports the upper
+	// layer of each container's host overlay read-only over FUSE, in a
+	// subdirectory named after the container ID. It lets operators inspect
+	// files written by the workload without entering the sandbox. It requires
+	// HostOverlay.
+	OverlayExport string `flag:"overlay-export"`
+
 	// FSGoferHostUDS is deprecated: use host-uds=all.
 	FSGoferHostUDS bool `flag:"fsgofer-host-uds"`
 
@@ -180,6 +209,10 @@ type Config struct {
 	// profiling metrics will be snapshotted.
 	ProfilingMetricsRate int `flag:"profiling-metrics-rate-us"`
 
+	// SyscallMetrics counts the syscalls made by the application in the
+	// /syscalls metric, broken down by syscall number.
+	SyscallMetrics bool `flag:"syscall-metrics"`
+
 	// Strace indicates that strace should be enabled.
 	Strace bool `flag:"strace"`
 
@@ -209,10 +242,21 @@ type Config struct {
 	// WatchdogAction sets what action the watchdog takes when triggered.
 	WatchdogAction watchdog.Action `flag:"watchdog-action"`
 
+	// WatchdogStallTimeout is the amount of time gofer RPCs, netstack packet
+	// dispatch and platform context queues may go without making progress
+	// before the watchdog reports them as stalled. Zero disables stall
+	// detection.
+	WatchdogStallTimeout time.Duration `flag:"watchdog-stall-timeout"`
+
 	// PanicSignal registers signal handling that panics. Usually set to
 	// SIGUSR2(12) to troubleshoot hangs. -1 disables it.
 	PanicSignal int `flag:"panic-signal"`
 
+	// RecoverSyscallPanics makes sentry panics during syscall handling kill
+	// the offending task with SIGSYS instead of the whole sandbox. Crash
+	// reports are logged and available with "runsc debug --crashes".
+	RecoverSyscallPanics bool `flag:"recover-syscall-panics"`
+
 	// ProfileEnable is set to prepare the sandbox to be profiled.
 	ProfileEnable bool `flag:"profile"`
 
@@ -236,6 +280,12 @@ type Config struct {
 	// for the duration of the container execution.
 	TraceFile string `flag:"trace"`
 
+	// CompatReport writes a report of the unsupported syscalls, ioctls,
+	// procfs files and sysctls used by the application to the passed file
+	// when the sandbox exits. It also enables reporting of partially
+	// supported syscalls, which has a small cost on each of them.
+	CompatReport string `flag:"compat-report"`
+
 	// RestoreFile is the path to the saved container image.
 	RestoreFile string
 
@@ -272,6 +322,11 @@ type Config struct {
 	// Don't configure cgroups.
 	IgnoreCgroups bool `flag:"ignore-cgroups"`
 
+	// Cgroupless doesn't configure host cgroups, like IgnoreCgroups, and
+	// enforces the container's CPU, memory and PIDs limits inside the sandbox
+	// instead. It's meant for hosts that don't allow cgroup management.
+	Cgroupless bool `flag:"cgroupless"`
+
 	// Use systemd to configure cgroups.
 	SystemdCgroup bool `flag:"systemd-cgroup"`
 
@@ -279,6 +334,42 @@ type Config struct {
 	// take during pod creation.
 	PodInitConfig string `flag:"pod-init-config"`
 
+	// StdioLog enables logging of the workload's stdout and stderr as JSON
+	// records. It is empty to pass stdio through unchanged, StdioLogStdio to
+	// write records to the container's stdout and stderr, or the absolute path
+	// of a file to append records to.
+	StdioLog string `flag:"stdio-log"`
+
+	// StdioLogRate is the maximum rate of workload output logged with
+	// StdioLog, in bytes per second. Zero means no limit.
+	StdioLogRate uint64 `flag:"stdio-log-rate"`
+
+	// StdioLogMaxSize is the maximum amount of workload output logged with
+	// StdioLog per container, in bytes. Zero means no limit.
+	StdioLogMaxSize uint64 `flag:"stdio-log-max-size"`
+
+	// StdioLogRedact enables redaction of common secrets from output logged
+	// with StdioLog.
+	StdioLogRedact bool `flag:"stdio-log-redact"`
+
+	// StdioLogRedactPatterns is the path to a file with additional regular
+	// expressions to redact from output logged with StdioLog, one per line.
+	StdioLogRedactPatterns string `flag:"stdio-log-redact-patterns"`
+
+	// MemoryHugepages advises the host to back sandbox memory that benefits
+	// from it with transparent huge pages.
+	MemoryHugepages bool `flag:"memory-hugepages"`
+
+	// MemoryHugepageCollapse controls which application memory is collapsed
+	// into huge pages in the background: one of the HugepageCollapse*
+	// constants.
+	MemoryHugepageCollapse string `flag:"memory-hugepage-collapse"`
+
+	// MemoryNUMAPolicy is the host NUMA policy applied to sandbox memory: empty
+	// for the host default, "local", or "<mode>:<nodes>". See
+	// GetMemoryNUMAPolicy.
+	MemoryNUMAPolicy string `flag:"memory-numa-policy"`
+
 	// Use pools to manage buffer memory instead of heap.
 	BufferPooling bool `flag:"buffer-pooling"`
 
@@ -298,6 +389,12 @@ type Config struct {
 	// used.
 	DCache int `flag:"dcache"`
 
+	// HostFDCache sets the maximum number of handles held open for regular
+	// files by gofer mounts that don't set the host_fd_limit mount option.
+	// If zero, handles are only closed when the sandbox runs out of host FDs.
+	// If negative, half of the sandbox's RLIMIT_NOFILE is used.
+	HostFDCache int `flag:"host-fd-cache"`
+
 	// IOUring enables support for the IO_URING API calls to perform
 	// asynchronous I/O operations.
 	IOUring bool `flag:"iouring"`
@@ -307,6 +404,42 @@ type Config struct {
 	// exists, but is mostly idle. Not supported in rootless mode.
 	DirectFS bool `flag:"directfs"`
 
+	// UnsafeSingleProcess serves the root container's gofer mounts from
+	// goroutines of the sandbox process, connected to the sentry over socket
+	// pairs, instead of from a separate gofer process. The gofer code is not
+	// isolated from the sentry in any way: it shares the sentry's threads,
+	// address space and seccomp filters, which are widened by all of the
+	// gofer's rules, and runsc create opens the mount sources on the host on
+	// its behalf. A compromised sentry therefore gains the gofer's access to
+	// the container's host filesystems. This is a weaker mode than a sandboxed
+	// in-process gofer, and is gated behind an EXPERIMENTAL flag. Requires
+	// DirectFS, which already grants the sentry most of that access.
+	UnsafeSingleProcess bool `flag:"EXPERIMENTAL-unsafe-single-process"`
+
+	// VerifyVerity makes the sentry verify reads of files with fs-verity
+	// enabled on the host against their Merkle tree, in gofer mounts.
+	VerifyVerity bool `flag:"verify-verity"`
+
+	// GoferChannels is the number of channels per gofer mount over which the
+	// sentry makes RPCs, each of which is served by a separate thread in the
+	// gofer. If zero, a default based on the number of CPUs is used.
+	GoferChannels int `flag:"gofer-channels"`
+
+	// GoferMaxConcurrentRequests limits the number of RPCs that the gofer
+	// handles concurrently per mount. If zero, it is only limited by
+	// GoferChannels.
+	GoferMaxConcurrentRequests int `flag:"gofer-max-concurrent-requests"`
+
+	// GoferSeccompAudit makes the host kernel log syscalls made by the gofer
+	// that violate its seccomp filters, and allow them, instead of killing
+	// the gofer.
+	GoferSeccompAudit bool `flag:"gofer-seccomp-audit"`
+
+	// GoferHostPaths is a comma-separated list of host directories. If set,
+	// the gofer refuses to serve a root filesystem or mount whose source
+	// isn't in one of them.
+	GoferHostPaths string `flag:"gofer-host-paths"`
+
 	// NVProxy enables support for Nvidia GPUs.
 	NVProxy bool `flag:"nvproxy"`
 
@@ -318,6 +451,39 @@ type Config struct {
 	// TPUProxy enables support for TPUs.
 	TPUProxy bool `flag:"tpuproxy"`
 
+	// VFIOProxy enables support for VFIO devices, such as SR-IOV virtual
+	// functions, to be driven by userspace drivers in the sandbox.
+	VFIOProxy bool `flag:"vfioproxy"`
+
+	// DRMProxy enables support for DRM render nodes backed by the host's
+	// virtio-gpu driver.
+	DRMProxy bool `flag:"drmproxy"`
+
+	// PTPProxy enables read-only support for the host's PTP hardware clocks.
+	PTPProxy bool `flag:"ptpproxy"`
+
+	// HostTimeSync allows the sandbox to read the host's NTP synchronization
+	// state, e.g. with adjtimex(2).
+	HostTimeSync bool `flag:"host-time-sync"`
+
+	// Deterministic runs the sandbox's tasks one at a time in a reproducible
+	// order, on virtual clocks and with a seeded random number generator, to
+	// reproduce application bugs that depend on timing.
+	Deterministic bool `flag:"deterministic"`
+
+	// DeterministicSeed seeds the randomness visible to the application in
+	// deterministic mode. If 0, a random seed is chosen and logged.
+	DeterministicSeed uint64 `flag:"deterministic-seed"`
+
+	// DeterministicRecord writes the schedule log of a deterministic
+	// execution, which includes its inputs from the host and the network, to
+	// the passed file, so that it can be replayed with DeterministicReplay.
+	DeterministicRecord string `flag:"deterministic-record"`
+
+	// DeterministicReplay replays the schedule log written by
+	// DeterministicRecord. It overrides DeterministicSeed.
+	DeterministicReplay string `flag:"deterministic-replay"`
+
 	// TestOnlyAllowRunAsCurrentUserWithoutChroot should only be used in
 	// tests. It allows runsc to start the sandbox process as the current
 	// user, and without chrooting the sandbox process. This can be
@@ -348,8 +514,43 @@ type Config struct {
 	// ReproduceNftables attempts to scrape nftables routing rules if
 	// present, and reproduce them in the sandbox.
 	ReproduceNftables bool `flag:"reproduce-nftables"`
+
+	// EgressProxy is the URL of a SOCKS5 ("socks5://ip:port") or HTTP CONNECT
+	// ("http://ip:port") proxy that outbound TCP connections from the sandbox
+	// are transparently tunneled through. Only applies to network=sandbox.
+	EgressProxy string `flag:"egress-proxy"`
+
+	// EgressProxyCredentialsFile is the path to a file containing the
+	// "user:pass" credentials for EgressProxy. Credentials are not accepted as
+	// part of the EgressProxy URL, since flags are visible to other processes
+	// and are logged.
+	EgressProxyCredentialsFile string `flag:"egress-proxy-credentials-file"`
+
+	// EgressProxyBypass is a comma-separated list of CIDR ranges that are
+	// connected to directly rather than through EgressProxy.
+	EgressProxyBypass string `flag:"egress-proxy-bypass"`
+
+	// IPv6Autoconf selects how sandbox interfaces are autoconfigured from
+	// Router Advertisements: "none", "slaac" or "dhcpv6". It is either a
+	// single mode applied to all interfaces, or a comma-separated list of
+	// "interface:mode" pairs. Interfaces that are not listed are not
+	// autoconfigured. Only applies to network=sandbox.
+	IPv6Autoconf string `flag:"ipv6-autoconf"`
+
+	// Vsock selects how AF_VSOCK sockets are provided to the sandbox: "none"
+	// to not support them, "host" to bridge them to the vsock transport of
+	// the host, or "loopback" to only connect them to each other within the
+	// sandbox.
+	Vsock string `flag:"vsock"`
+
+	// VsockCID is the context ID of the sandbox with vsock=loopback.
+	VsockCID uint `flag:"vsock-cid"`
 }
 
+// hostOverlaySizeRE matches the tmpfs size values accepted for
+// HostOverlaySize.
+var hostOverlaySizeRE = regexp.MustCompile(`^([1-9][0-9]*[kKmMgG]?|([1-9][0-9]?|100)%)$`)
+
 func (c *Config) validate() error {
 	if c.Overlay && c.Overlay2.Enabled() {
 		// Deprecated flag was used together with flag that replaced it.
@@ -358,9 +559,40 @@ func (c *Config) validate() error {
 	if overlay2 := c.GetOverlay2(); c.FileAccess == FileAccessShared && overlay2.Enabled() {
 		return fmt.Errorf("overlay flag is incompatible with shared file access for rootfs")
 	}
+	if c.HostOverlaySize != "" {
+		if !c.HostOverlay {
+			return fmt.Errorf("host-overlay-size requires host-overlay")
+		}
+		if !hostOverlaySizeRE.MatchString(c.HostOverlaySize) {
+			return fmt.Errorf("invalid host-overlay-size %q, want a number of bytes with an optional k, m or g suffix, or a percentage", c.HostOverlaySize)
+		}
+	}
+	if c.OverlayExport != "" {
+		if !c.HostOverlay {
+			return fmt.Errorf("overlay-export requires host-overlay")
+		}
+		if !filepath.IsAbs(c.OverlayExport) {
+			return fmt.Errorf("overlay-export must be an absolute path, got: %q", c.OverlayExport)
+		}
+	}
+	if c.Cgroupless && c.SystemdCgroup {
+		return fmt.Errorf("cgroupless flag is incompatible with systemd-cgroup")
+	}
 	if c.NumNetworkChannels <= 0 {
 		return fmt.Errorf("num_network_channels must be > 0, got: %d", c.NumNetworkChannels)
 	}
+	if c.GoferChannels < 0 || c.GoferChannels > 64 {
+		return fmt.Errorf("gofer-channels must be between 0 and 64, got: %d", c.GoferChannels)
+	}
+	if c.GoferMaxConcurrentRequests < 0 {
+		return fmt.Errorf("gofer-max-concurrent-requests must be >= 0, got: %d", c.GoferMaxConcurrentRequests)
+	}
+	if c.UnsafeSingleProcess && !c.DirectFS {
+		return fmt.Errorf("EXPERIMENTAL-unsafe-single-process requires directfs")
+	}
+	if c.UnsafeSingleProcess && c.GetHostUDS() != HostUDSNone {
+		return fmt.Errorf("EXPERIMENTAL-unsafe-single-process is incompatible with host-uds")
+	}
 	// Require profile flags to explicitly opt-in to profiling with
 	// -profile rather than implying it since these options have security
 	// implications.
@@ -383,9 +615,235 @@ func (c *Config) validate() error {
 	if len(c.ProfilingMetrics) > 0 && len(c.ProfilingMetricsLog) == 0 {
 		return fmt.Errorf("profiling-metrics flag requires defining a profiling-metrics-log for output")
 	}
+	if c.EgressProxy != "" && c.Network != NetworkSandbox {
+		return fmt.Errorf("egress-proxy flag requires network=sandbox")
+	}
+	if c.EgressProxyBypass != "" && c.EgressProxy == "" {
+		return fmt.Errorf("egress-proxy-bypass flag requires egress-proxy to be set")
+	}
+	if c.EgressProxyCredentialsFile != "" && c.EgressProxy == "" {
+		return fmt.Errorf("egress-proxy-credentials-file flag requires egress-proxy to be set")
+	}
+	if c.IPv6Autoconf != "" && c.Network != NetworkSandbox {
+		return fmt.Errorf("ipv6-autoconf flag requires network=sandbox")
+	}
+	if _, err := c.ipv6AutoconfModes(); err != nil {
+		return err
+	}
+	if _, _, err := c.GetMemoryNUMAPolicy(); err != nil {
+		return err
+	}
+	for _, p := range c.GetGoferHostPaths() {
+		if !filepath.IsAbs(p) {
+			return fmt.Errorf("gofer-host-paths must only contain absolute paths, got %q", p)
+		}
+	}
+	if (c.DeterministicSeed != 0 || c.DeterministicRecord != "" || c.DeterministicReplay != "") && !c.Deterministic {
+		return fmt.Errorf("deterministic-seed, deterministic-record and deterministic-replay flags require deterministic")
+	}
+	if c.Deterministic && c.Network == NetworkHost {
+		return fmt.Errorf("deterministic flag is incompatible with network=host")
+	}
+	switch c.MemoryHugepageCollapse {
+	case HugepageCollapseNever, HugepageCollapseMadvise, HugepageCollapseAlways:
+	default:
+		return fmt.Errorf("memory-hugepage-collapse must be one of %q, %q or %q, got: %q", HugepageCollapseNever, HugepageCollapseMadvise, HugepageCollapseAlways, c.MemoryHugepageCollapse)
+	}
+	if c.StdioLog != "" && c.StdioLog != StdioLogStdio && !filepath.IsAbs(c.StdioLog) {
+		return fmt.Errorf("stdio-log must be empty, %q or an absolute path, got: %q", StdioLogStdio, c.StdioLog)
+	}
+	if c.StdioLog == "" && (c.StdioLogRate != 0 || c.StdioLogMaxSize != 0 || c.StdioLogRedact || c.StdioLogRedactPatterns != "") {
+		return fmt.Errorf("stdio-log-* flags require stdio-log to be set")
+	}
+	switch c.Vsock {
+	case VsockNone, VsockHost, VsockLoopback:
+	default:
+		return fmt.Errorf("vsock must be one of %q, %q or %q, got: %q", VsockNone, VsockHost, VsockLoopback, c.Vsock)
+	}
+	// Context IDs up to 2 are reserved, and -1U is VMADDR_CID_ANY.
+	if c.VsockCID <= 2 || c.VsockCID >= math.MaxUint32 {
+		return fmt.Errorf("vsock-cid must be between 3 and %d, got: %d", uint(math.MaxUint32-1), c.VsockCID)
+	}
+	if c.VFIOProxy && c.TPUProxy {
+		// Both proxy /dev/vfio/$GROUP, for different purposes.
+		return fmt.Errorf("vfioproxy flag is incompatible with tpuproxy flag")
+	}
 	return nil
 }
 
+// AF_VSOCK transports, for the vsock flag.
+const (
+	VsockNone     = "none"
+	VsockHost     = "host"
+	VsockLoopback = "loopback"
+)
+
+// StdioLogStdio is the value of the stdio-log flag that writes records to the
+// container's own stdout and stderr, e.g. to be collected by containerd.
+const StdioLogStdio = "stdio"
+
+// GetEgressProxyBypass returns the list of CIDR ranges in EgressProxyBypass.
+func (c *Config) GetEgressProxyBypass() []string {
+	if c.EgressProxyBypass == "" {
+		return nil
+	}
+	return strings.Split(c.EgressProxyBypass, ",")
+}
+
+// GetGoferHostPaths returns the list of host directories in GoferHostPaths.
+func (c *Config) GetGoferHostPaths() []string {
+	if c.GoferHostPaths == "" {
+		return nil
+	}
+	return strings.Split(c.GoferHostPaths, ",")
+}
+
+// IPv6 autoconfiguration modes, for the ipv6-autoconf flag.
+const (
+	IPv6AutoconfNone   = "none"
+	IPv6AutoconfSLAAC  = "slaac"
+	IPv6AutoconfDHCPv6 = "dhcpv6"
+)
+
+// ipv6AutoconfModes parses IPv6Autoconf into a map from interface name to
+// mode. The mode applied to all interfaces, if any, has an empty key.
+func (c *Config) ipv6AutoconfModes() (map[string]string, error) {
+	if c.IPv6Autoconf == "" {
+		return nil, nil
+	}
+	modes := make(map[string]string)
+	for _, entry := range strings.Split(c.IPv6Autoconf, ",") {
+		iface, mode, ok := strings.Cut(entry, ":")
+		if !ok {
+			iface, mode = "", entry
+		} else if iface == "" {
+			return nil, fmt.Errorf("ipv6-autoconf: missing interface name in %q", entry)
+		}
+		switch mode {
+		case IPv6AutoconfNone, IPv6AutoconfSLAAC, IPv6AutoconfDHCPv6:
+		default:
+			return nil, fmt.Errorf("ipv6-autoconf: invalid mode %q, must be one of %q, %q or %q", mode, IPv6AutoconfNone, IPv6AutoconfSLAAC, IPv6AutoconfDHCPv6)
+		}
+		if _, ok := modes[iface]; ok {
+			return nil, fmt.Errorf("ipv6-autoconf: interface %q is set more than once", iface)
+		}
+		modes[iface] = mode
+	}
+	if _, ok := modes[""]; ok && len(modes) > 1 {
+		return nil, fmt.Errorf("ipv6-autoconf: a mode for all interfaces can't be combined with per-interface modes")
+	}
+	return modes, nil
+}
+
+// GetIPv6Autoconf returns the IPv6 autoconfiguration mode of the given
+// interface, IPv6AutoconfNone if it is not autoconfigured.
+func (c *Config) GetIPv6Autoconf(iface string) string {
+	modes, err := c.ipv6AutoconfModes()
+	if err != nil {
+		panic(fmt.Sprintf("invalid ipv6-autoconf flag: %v", err))
+	}
+	if mode, ok := modes[iface]; ok {
+		return mode
+	}
+	if mode, ok := modes[""]; ok {
+		return mode
+	}
+	return IPv6AutoconfNone
+}
+
+// Background huge page collapse modes, for the memory-hugepage-collapse flag.
+// They have the same meaning as in Linux's
+// /sys/kernel/mm/transparent_hugepage/enabled.
+const (
+	// HugepageCollapseNever disables background collapse.
+	HugepageCollapseNever = "never"
+
+	// HugepageCollapseMadvise collapses memory advised with MADV_HUGEPAGE.
+	HugepageCollapseMadvise = "madvise"
+
+	// HugepageCollapseAlways collapses all anonymous memory, except memory
+	// advised with MADV_NOHUGEPAGE.
+	HugepageCollapseAlways = "always"
+)
+
+// NUMA policy modes, for the memory-numa-policy flag.
+const (
+	// NUMAPolicyLocal binds memory to the host NUMA nodes of the CPUs that the
+	// sandbox may run on.
+	NUMAPolicyLocal = "local"
+
+	// NUMAPolicyPreferred prefers allocating memory on a single node.
+	NUMAPolicyPreferred = "preferred"
+
+	// NUMAPolicyBind restricts memory to a set of nodes.
+	NUMAPolicyBind = "bind"
+
+	// NUMAPolicyInterleave interleaves memory across a set of nodes.
+	NUMAPolicyInterleave = "interleave"
+)
+
+// GetMemoryNUMAPolicy parses MemoryNUMAPolicy into a mode and a list of host
+// NUMA nodes. mode is empty if no policy is set. nodes is empty for
+// NUMAPolicyLocal, since the nodes are only known once the sandbox is
+// started.
+func (c *Config) GetMemoryNUMAPolicy() (mode string, nodes []int, err error) {
+	switch c.MemoryNUMAPolicy {
+	case "":
+		return "", nil, nil
+	case NUMAPolicyLocal:
+		return NUMAPolicyLocal, nil, nil
+	}
+	mode, list, ok := strings.Cut(c.MemoryNUMAPolicy, ":")
+	switch mode {
+	case NUMAPolicyPreferred, NUMAPolicyBind, NUMAPolicyInterleave:
+	default:
+		return "", nil, fmt.Errorf("memory-numa-policy: invalid mode %q, must be one of %q, %q, %q or %q", mode, NUMAPolicyLocal, NUMAPolicyPreferred, NUMAPolicyBind, NUMAPolicyInterleave)
+	}
+	if !ok {
+		return "", nil, fmt.Errorf("memory-numa-policy: mode %q requires a list of nodes, e.g. %s:0", mode, mode)
+	}
+	nodes, err = ParseNodeList(list)
+	if err != nil {
+		return "", nil, fmt.Errorf("memory-numa-policy: %w", err)
+	}
+	if mode == NUMAPolicyPreferred && len(nodes) != 1 {
+		return "", nil, fmt.Errorf("memory-numa-policy: mode %q requires a single node, got %q", mode, list)
+	}
+	return mode, nodes, nil
+}
+
+// ParseNodeList parses a list of non-negative integers in the Linux list
+// format used for NUMA nodes and CPUs, e.g. "0-2,5". The returned list is
+// sorted and has no duplicates.
+func ParseNodeList(list string) ([]int, error) {
+	var nodes []int
+	seen := make(map[int]struct{})
+	for _, r := range strings.Split(strings.TrimSpace(list), ",") {
+		first, last, isRange := strings.Cut(r, "-")
+		start, err := strconv.ParseUint(first, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node list %q: %w", list, err)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.ParseUint(last, 10, 16); err != nil {
+				return nil, fmt.Errorf("invalid node list %q: %w", list, err)
+			}
+			if end < start {
+				return nil, fmt.Errorf("invalid node list %q: range %q is reversed", list, r)
+			}
+		}
+		for n := int(start); n <= int(end); n++ {
+			if _, ok := seen[n]; !ok {
+				seen[n] = struct{}{}
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	sort.Ints(nodes)
+	return nodes, nil
+}
+
 // Log logs important aspects of the configuration to the given log function.
 func (c *Config) Log() {
 	log.Infof("Platform: %v", c.Platform)
@@ -566,6 +1024,12 @@ const (
 
 	// NetworkNone sets up just loopback using netstack.
 	NetworkNone
+
+	// NetworkHybrid redirects IPv4 and IPv6 sockets of the root network
+	// namespace to the host network, like NetworkHost, while network
+	// namespaces created by the application get their own netstack. Netlink
+	// and UNIX domain sockets are always served by the sentry.
+	NetworkHybrid
 )
 
 func networkTypePtr(v NetworkType) *NetworkType {
@@ -581,6 +1045,8 @@ func (n *NetworkType) Set(v string) error {
 		*n = NetworkHost
 	case "none":
 		*n = NetworkNone
+	case "hybrid":
+		*n = NetworkHybrid
 	default:
 		return fmt.Errorf("invalid network type %q", v)
 	}
@@ -601,10 +1067,18 @@ func (n NetworkType) String() string {
 		return "host"
 	case NetworkNone:
 		return "none"
+	case NetworkHybrid:
+		return "hybrid"
 	}
 	panic(fmt.Sprintf("Invalid network type %d", n))
 }
 
+// UsesHostNetwork returns true if sockets of the root network namespace are
+// redirected to the host network.
+func (n NetworkType) UsesHostNetwork() bool {
+	return n == NetworkHost || n == NetworkHybrid
+}
+
 // QueueingDiscipline is used to specify the kind of Queueing Discipline to
 // apply for a give FDBasedLink.
 type QueueingDiscipline int
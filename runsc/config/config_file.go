@@ -0,0 +1,269 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+// ProfileAnnotation is the annotation used by pods to select one of the
+// profiles defined in the config file.
+const ProfileAnnotation = "dev.gvisor.profile"
+
+// File is a runsc config file, set with --config. It is written in TOML:
+//
+//	# Flags applied to every sandbox. Flags set on the command line take
+//	# precedence.
+//	[flags]
+//	platform = "systrap"
+//	overlay2 = "root:self"
+//
+//	# Profiles selected per pod with the dev.gvisor.profile annotation.
+//	[profiles.gpu-ml]
+//	nvproxy = true
+//
+//	[profiles.hardened]
+//	directfs = false
+//	host-uds = "none"
+//
+// Values may be TOML strings, booleans or numbers; they are parsed with the
+// same rules as the corresponding command-line flag.
+type File struct {
+	// Flags are flag values applied to all sandboxes, unless the same flag is
+	// set on the command line.
+	Flags Bundle
+
+	// Profiles are named sets of flag values. A profile is applied on top of
+	// Flags and the command line when a pod selects it with the
+	// ProfileAnnotation annotation.
+	Profiles map[string]Bundle
+}
+
+// fileTOML is the on-disk representation of File.
+type fileTOML struct {
+	Flags    map[string]any            `toml:"flags"`
+	Profiles map[string]map[string]any `toml:"profiles"`
+}
+
+// LoadFile reads and validates the config file at path.
+func LoadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	f, err := ParseFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("config file %q: %w", path, err)
+	}
+	return f, nil
+}
+
+// ParseFile parses and validates a config file.
+func ParseFile(data []byte) (*File, error) {
+	var raw fileTOML
+	md, err := toml.Decode(string(data), &raw)
+	if err != nil {
+		return nil, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, 0, len(undecoded))
+		for _, key := range undecoded {
+			keys = append(keys, key.String())
+		}
+		return nil, fmt.Errorf("unknown keys: %s", strings.Join(keys, ", "))
+	}
+
+	f := &File{
+		Profiles: make(map[string]Bundle, len(raw.Profiles)),
+	}
+	if f.Flags, err = toBundle(raw.Flags); err != nil {
+		return nil, fmt.Errorf("[flags]: %w", err)
+	}
+	for name, values := range raw.Profiles {
+		if f.Profiles[name], err = toBundle(values); err != nil {
+			return nil, fmt.Errorf("[profiles.%s]: %w", name, err)
+		}
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// toBundle converts TOML values to their flag string representation.
+func toBundle(values map[string]any) (Bundle, error) {
+	b := make(Bundle, len(values))
+	for name, val := range values {
+		switch v := val.(type) {
+		case string:
+			b[name] = v
+		case bool, int64, float64:
+			b[name] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("flag %q: unsupported value type %T", name, val)
+		}
+	}
+	return b, nil
+}
+
+// Validate checks that all flags in the file exist and have valid values, and
+// that the flags combined with each profile make a valid configuration.
+func (f *File) Validate() error {
+	if err := validateFileBundle(f.Flags); err != nil {
+		return fmt.Errorf("[flags]: %w", err)
+	}
+	if _, err := f.newConfig(""); err != nil {
+		return fmt.Errorf("[flags]: %w", err)
+	}
+	for _, name := range f.ProfileNames() {
+		if err := validateFileBundle(f.Profiles[name]); err != nil {
+			return fmt.Errorf("[profiles.%s]: %w", name, err)
+		}
+		if _, err := f.newConfig(name); err != nil {
+			return fmt.Errorf("[profiles.%s]: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func validateFileBundle(b Bundle) error {
+	if _, ok := b["config"]; ok {
+		return fmt.Errorf("flag %q cannot be set in a config file", "config")
+	}
+	return b.Validate()
+}
+
+// newConfig returns the configuration made of the file's flags and the given
+// profile, if not empty, on top of the default flag values.
+func (f *File) newConfig(profile string) (*Config, error) {
+	flagSet := flag.NewFlagSet("tmp", flag.ContinueOnError)
+	RegisterFlags(flagSet)
+	conf, err := NewFromFlags(flagSet)
+	if err != nil {
+		return nil, err
+	}
+	if err := conf.setAll(flagSet, f.Flags); err != nil {
+		return nil, err
+	}
+	if profile != "" {
+		if err := conf.setAll(flagSet, f.Profiles[profile]); err != nil {
+			return nil, err
+		}
+	}
+	return conf, conf.validate()
+}
+
+// ProfileNames returns the names of all profiles in the file, sorted.
+func (f *File) ProfileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyFile loads the config file named by the "config" flag, if any, and
+// sets the flags in it that were not explicitly set in flagSet. It must be
+// called before NewFromFlags.
+//
+// Flags set from the file are considered explicitly set afterwards, so they
+// are passed along to child processes together with the command-line flags.
+func ApplyFile(flagSet *flag.FlagSet) error {
+	path := flagSet.Lookup("config").Value.String()
+	if path == "" {
+		return nil
+	}
+	f, err := LoadFile(path)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(f.Flags))
+	for name := range f.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if isFlagExplicitlySet(flagSet, name) {
+			continue
+		}
+		if err := flagSet.Set(name, f.Flags[name]); err != nil {
+			return fmt.Errorf("config file %q: setting flag %s=%q: %w", path, name, f.Flags[name], err)
+		}
+	}
+	return nil
+}
+
+// ApplyProfile applies the named profile from the config file. Profile values
+// take precedence over the config file's flags and over command-line flags,
+// since they are defined by the administrator for pods that request them.
+func (c *Config) ApplyProfile(flagSet *flag.FlagSet, name string) error {
+	if c.ConfigFile == "" {
+		return fmt.Errorf("profile %q requested, but no config file is set with --config", name)
+	}
+	f, err := LoadFile(c.ConfigFile)
+	if err != nil {
+		return err
+	}
+	profile, ok := f.Profiles[name]
+	if !ok {
+		return fmt.Errorf("profile %q is not defined in config file %q (available: %s)", name, c.ConfigFile, strings.Join(f.ProfileNames(), ", "))
+	}
+	log.Infof("Applying profile %q from config file %q", name, c.ConfigFile)
+	if err := c.setAll(flagSet, profile); err != nil {
+		return fmt.Errorf("applying profile %q: %w", name, err)
+	}
+	return c.validate()
+}
+
+// setAll sets all flags in b, without validating the config in between, so
+// that the order in which flags are set doesn't matter.
+func (c *Config) setAll(flagSet *flag.FlagSet, b Bundle) error {
+	names := make([]string, 0, len(b))
+	for name := range b {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := c.set(flagSet, name, b[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ToBundle returns the value of every flag in the config, including the ones
+// left at their default value.
+func (c *Config) ToBundle() Bundle {
+	b := make(Bundle)
+	obj := reflect.ValueOf(c).Elem()
+	st := obj.Type()
+	for i := 0; i < st.NumField(); i++ {
+		name, ok := st.Field(i).Tag.Lookup("flag")
+		if !ok {
+			continue
+		}
+		b[name] = getVal(obj.Field(i))
+	}
+	return b
+}
@@ -0,0 +1,216 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+const testConfigFile = `
+[flags]
+platform = "ptrace"
+debug = true
+num-network-channels = 2
+
+[profiles.io-heavy]
+overlay2 = "root:self"
+gofer-channels = 8
+
+[profiles.hardened]
+directfs = false
+network = "none"
+profile-cpu = "/tmp/cpu"
+profile = true
+`
+
+func TestParseFile(t *testing.T) {
+	f, err := ParseFile([]byte(testConfigFile))
+	if err != nil {
+		t.Fatalf("ParseFile() failed: %v", err)
+	}
+	want := &File{
+		Flags: Bundle{
+			"platform":             "ptrace",
+			"debug":                "true",
+			"num-network-channels": "2",
+		},
+		Profiles: map[string]Bundle{
+			"io-heavy": {
+				"overlay2":       "root:self",
+				"gofer-channels": "8",
+			},
+			"hardened": {
+				"directfs":    "false",
+				"network":     "none",
+				"profile-cpu": "/tmp/cpu",
+				"profile":     "true",
+			},
+		},
+	}
+	if diff := cmp.Diff(want, f); diff != "" {
+		t.Errorf("ParseFile() returned unexpected file (-want +got):\n%s", diff)
+	}
+	if got, want := f.ProfileNames(), []string{"hardened", "io-heavy"}; !cmp.Equal(got, want) {
+		t.Errorf("ProfileNames() = %v, want %v", got, want)
+	}
+}
+
+func TestParseFileInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data string
+		err  string
+	}{
+		{
+			name: "syntax",
+			data: "[flags\n",
+			err:  "expected",
+		},
+		{
+			name: "unknown table",
+			data: "[flag]\ndebug = true\n",
+			err:  "unknown keys: flag",
+		},
+		{
+			name: "unknown flag",
+			data: "[flags]\nfoobar = true\n",
+			err:  `[flags]: unknown flag "foobar"`,
+		},
+		{
+			name: "invalid value",
+			data: "[profiles.p]\nnetwork = \"bogus\"\n",
+			err:  "[profiles.p]:",
+		},
+		{
+			name: "unsupported type",
+			data: "[flags]\nstrace-syscalls = [\"read\"]\n",
+			err:  "unsupported value type",
+		},
+		{
+			name: "config",
+			data: "[flags]\nconfig = \"/other.toml\"\n",
+			err:  "cannot be set in a config file",
+		},
+		{
+			name: "invalid combination",
+			data: "[flags]\nnetwork = \"none\"\n[profiles.proxy]\negress-proxy = \"socks5://1.2.3.4:1080\"\n",
+			err:  "[profiles.proxy]: egress-proxy flag requires network=sandbox",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseFile([]byte(tc.data))
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("ParseFile() = %v, want error containing %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func writeTestConfigFile(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(testConfigFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestApplyFile(t *testing.T) {
+	path := writeTestConfigFile(t)
+	testFlags := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterFlags(testFlags)
+	if err := testFlags.Parse([]string{"--config=" + path, "--platform=systrap"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyFile(testFlags); err != nil {
+		t.Fatalf("ApplyFile() failed: %v", err)
+	}
+	conf, err := NewFromFlags(testFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Flags set on the command line take precedence over the file.
+	if want := "systrap"; conf.Platform != want {
+		t.Errorf("Platform = %q, want %q", conf.Platform, want)
+	}
+	if !conf.Debug {
+		t.Errorf("Debug = false, want true")
+	}
+	if want := 2; conf.NumNetworkChannels != want {
+		t.Errorf("NumNetworkChannels = %d, want %d", conf.NumNetworkChannels, want)
+	}
+
+	// Flags from the file must be passed along to child processes.
+	flags := conf.ToFlags()
+	for _, want := range []string{"--config=" + path, "--debug=true", "--num-network-channels=2", "--platform=systrap"} {
+		found := false
+		for _, fl := range flags {
+			found = found || fl == want
+		}
+		if !found {
+			t.Errorf("ToFlags() = %v, missing %q", flags, want)
+		}
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	path := writeTestConfigFile(t)
+	testFlags := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterFlags(testFlags)
+	if err := testFlags.Parse([]string{"--config=" + path, "--directfs=true"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyFile(testFlags); err != nil {
+		t.Fatalf("ApplyFile() failed: %v", err)
+	}
+	conf, err := NewFromFlags(testFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flags are set in an order that would fail validation in between:
+	// profile-cpu requires profile.
+	if err := conf.ApplyProfile(testFlags, "hardened"); err != nil {
+		t.Fatalf("ApplyProfile() failed: %v", err)
+	}
+	// Profiles take precedence over flags set on the command line.
+	if conf.DirectFS {
+		t.Errorf("DirectFS = true, want false")
+	}
+	if want := NetworkNone; conf.Network != want {
+		t.Errorf("Network = %v, want %v", conf.Network, want)
+	}
+	// Flags from the file that the profile doesn't set are kept.
+	if want := "ptrace"; conf.Platform != want {
+		t.Errorf("Platform = %q, want %q", conf.Platform, want)
+	}
+	if got := conf.ToBundle(); got["directfs"] != "false" || got["platform"] != "ptrace" || got["fdlimit"] != "-1" {
+		t.Errorf("ToBundle() = %v, want directfs=false, platform=ptrace and fdlimit=-1", got)
+	}
+
+	if err := conf.ApplyProfile(testFlags, "bogus"); err == nil || !strings.Contains(err.Error(), "available: hardened, io-heavy") {
+		t.Errorf("ApplyProfile(bogus) = %v, want error listing available profiles", err)
+	}
+	conf.ConfigFile = ""
+	if err := conf.ApplyProfile(testFlags, "hardened"); err == nil {
+		t.Errorf("ApplyProfile() without config file succeeded, want error")
+	}
+}
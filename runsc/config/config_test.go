@@ -303,6 +303,88 @@ func TestValidationFail(t *testing.T) {
 			},
 			error: "overlay flag has been replaced with overlay2 flag",
 		},
+		{
+			name: "vfioproxy+tpuproxy",
+			flags: map[string]string{
+				"vfioproxy": "true",
+				"tpuproxy":  "true",
+			},
+			error: "vfioproxy flag is incompatible with tpuproxy flag",
+		},
+		{
+			name: "stdio-log:relative",
+			flags: map[string]string{
+				"stdio-log": "logs/stdio.json",
+			},
+			error: "stdio-log must be empty",
+		},
+		{
+			name: "stdio-log-rate",
+			flags: map[string]string{
+				"stdio-log-rate": "1024",
+			},
+			error: "stdio-log-* flags require stdio-log to be set",
+		},
+		{
+			name: "ipv6-autoconf:mode",
+			flags: map[string]string{
+				"ipv6-autoconf": "eth0:dhcp",
+			},
+			error: `invalid mode "dhcp"`,
+		},
+		{
+			name: "ipv6-autoconf:mixed",
+			flags: map[string]string{
+				"ipv6-autoconf": "slaac,eth1:dhcpv6",
+			},
+			error: "can't be combined with per-interface modes",
+		},
+		{
+			name: "ipv6-autoconf:network",
+			flags: map[string]string{
+				"ipv6-autoconf": "slaac",
+				"network":       "host",
+			},
+			error: "ipv6-autoconf flag requires network=sandbox",
+		},
+		{
+			name: "host-overlay-size",
+			flags: map[string]string{
+				"host-overlay-size": "1g",
+			},
+			error: "host-overlay-size requires host-overlay",
+		},
+		{
+			name: "host-overlay-size:invalid",
+			flags: map[string]string{
+				"host-overlay-size": "1g,nr_inodes=0",
+				"host-overlay":      "true",
+			},
+			error: "invalid host-overlay-size",
+		},
+		{
+			name: "overlay-export",
+			flags: map[string]string{
+				"overlay-export": "/run/runsc/overlay",
+			},
+			error: "overlay-export requires host-overlay",
+		},
+		{
+			name: "overlay-export:relative",
+			flags: map[string]string{
+				"overlay-export": "overlay",
+				"host-overlay":   "true",
+			},
+			error: "overlay-export must be an absolute path",
+		},
+		{
+			name: "cgroupless:systemd-cgroup",
+			flags: map[string]string{
+				"cgroupless":     "true",
+				"systemd-cgroup": "true",
+			},
+			error: "cgroupless flag is incompatible with systemd-cgroup",
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			testFlags := flag.NewFlagSet("test", flag.ContinueOnError)
@@ -778,3 +860,99 @@ root = "%s"
 	}
 
 }
+
+func TestGetIPv6Autoconf(t *testing.T) {
+	for _, tc := range []struct {
+		flag string
+		want map[string]string
+	}{
+		{
+			flag: "",
+			want: map[string]string{"eth0": IPv6AutoconfNone},
+		},
+		{
+			flag: "slaac",
+			want: map[string]string{"eth0": IPv6AutoconfSLAAC, "eth1": IPv6AutoconfSLAAC},
+		},
+		{
+			flag: "eth0:dhcpv6,eth1:none",
+			want: map[string]string{"eth0": IPv6AutoconfDHCPv6, "eth1": IPv6AutoconfNone, "eth2": IPv6AutoconfNone},
+		},
+	} {
+		t.Run(tc.flag, func(t *testing.T) {
+			c := &Config{IPv6Autoconf: tc.flag}
+			for iface, want := range tc.want {
+				if got := c.GetIPv6Autoconf(iface); got != want {
+					t.Errorf("GetIPv6Autoconf(%q) = %q, want %q", iface, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetMemoryNUMAPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		flag      string
+		wantMode  string
+		wantNodes []int
+		wantErr   bool
+	}{
+		{flag: ""},
+		{flag: "local", wantMode: NUMAPolicyLocal},
+		{flag: "preferred:1", wantMode: NUMAPolicyPreferred, wantNodes: []int{1}},
+		{flag: "bind:3,0-1", wantMode: NUMAPolicyBind, wantNodes: []int{0, 1, 3}},
+		{flag: "interleave:0-2,1", wantMode: NUMAPolicyInterleave, wantNodes: []int{0, 1, 2}},
+		{flag: "bind", wantErr: true},
+		{flag: "bind:", wantErr: true},
+		{flag: "bind:2-1", wantErr: true},
+		{flag: "bind:-1", wantErr: true},
+		{flag: "preferred:0-1", wantErr: true},
+		{flag: "remote:0", wantErr: true},
+	} {
+		t.Run(tc.flag, func(t *testing.T) {
+			c := &Config{MemoryNUMAPolicy: tc.flag}
+			mode, nodes, err := c.GetMemoryNUMAPolicy()
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("GetMemoryNUMAPolicy() = %q, %v, want error", mode, nodes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetMemoryNUMAPolicy() failed: %v", err)
+			}
+			if mode != tc.wantMode || !reflect.DeepEqual(nodes, tc.wantNodes) {
+				t.Errorf("GetMemoryNUMAPolicy() = %q, %v, want %q, %v", mode, nodes, tc.wantMode, tc.wantNodes)
+			}
+		})
+	}
+}
+
+func TestNetworkType(t *testing.T) {
+	for _, tc := range []struct {
+		flag        string
+		want        NetworkType
+		hostNetwork bool
+	}{
+		{flag: "sandbox", want: NetworkSandbox},
+		{flag: "host", want: NetworkHost, hostNetwork: true},
+		{flag: "none", want: NetworkNone},
+		{flag: "hybrid", want: NetworkHybrid, hostNetwork: true},
+	} {
+		t.Run(tc.flag, func(t *testing.T) {
+			var n NetworkType
+			if err := n.Set(tc.flag); err != nil {
+				t.Fatalf("Set(%q) failed: %v", tc.flag, err)
+			}
+			if n != tc.want {
+				t.Errorf("Set(%q) = %v, want %v", tc.flag, n, tc.want)
+			}
+			if got := n.String(); got != tc.flag {
+				t.Errorf("String() = %q, want %q", got, tc.flag)
+			}
+			if got := n.UsesHostNetwork(); got != tc.hostNetwork {
+				t.Errorf("UsesHostNetwork() = %t, want %t", got, tc.hostNetwork)
+			}
+		})
+	}
+}
@@ -16,6 +16,7 @@ package config
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -57,6 +58,7 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	if flagSet.Lookup("alsologtostderr") == nil {
 		flagSet.Bool("alsologtostderr", false, "send log messages to stderr.")
 	}
+	flagSet.String("config", "", "path to a TOML config file that sets default flag values and defines named profiles, which pods select with the dev.gvisor.profile annotation. Flags set on the command line take precedence over the file's flags, but not over profiles.")
 	flagSet.Bool("allow-flag-override", false, "allow OCI annotations (dev.gvisor.flag.<name>) to override flags for debugging.")
 	flagSet.String("traceback", "system", "golang runtime's traceback level")
 
@@ -65,6 +67,7 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.String("profiling-metrics", "", "comma separated list of metric names which are going to be written to the profiling-metrics-log file from within the sentry in CSV format. profiling-metrics will be snapshotted at a rate specified by profiling-metrics-rate-us. Requires profiling-metrics-log to be set. (DO NOT USE IN PRODUCTION).")
 	flagSet.String("profiling-metrics-log", "", "file name to use for profiling-metrics output. (DO NOT USE IN PRODUCTION)")
 	flagSet.Int("profiling-metrics-rate-us", 1000, "the target rate (in microseconds) at which profiling metrics will be snapshotted.")
+	flagSet.Bool("syscall-metrics", false, "count the syscalls made by the application in the /syscalls metric, broken down by syscall number. This adds an atomic increment to every syscall.")
 
 	// Debugging flags: strace related
 	flagSet.Bool("strace", false, "enable strace.")
@@ -76,25 +79,39 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.String("platform", "systrap", "specifies which platform to use: systrap (default), ptrace, kvm.")
 	flagSet.String("platform_device_path", "", "path to a platform-specific device file (e.g. /dev/kvm for KVM platform). If unset, will use a sane platform-specific default.")
 	flagSet.Var(watchdogActionPtr(watchdog.LogWarning), "watchdog-action", "sets what action the watchdog takes when triggered: log (default), panic.")
+	flagSet.Duration("watchdog-stall-timeout", watchdog.DefaultOpts.StallTimeout, "time after which the watchdog reports gofer RPCs, netstack packet dispatch and platform context queues that make no progress as stalled, capturing a goroutine dump to the debug log. 0 disables stall detection.")
 	flagSet.Int("panic-signal", -1, "register signal handling that panics. Usually set to SIGUSR2(12) to troubleshoot hangs. -1 disables it.")
+	flagSet.Bool("recover-syscall-panics", false, "EXPERIMENTAL: kill the offending task with SIGSYS instead of the whole sandbox when the sentry panics while handling one of its syscalls. Crash reports are available with 'runsc debug --crashes'.")
 	flagSet.Bool("profile", false, "prepares the sandbox to use Golang profiler. Note that enabling profiler loosens the seccomp protection added to the sandbox (DO NOT USE IN PRODUCTION).")
 	flagSet.String("profile-block", "", "collects a block profile to this file path for the duration of the container execution. Requires -profile=true.")
 	flagSet.String("profile-cpu", "", "collects a CPU profile to this file path for the duration of the container execution. Requires -profile=true.")
 	flagSet.String("profile-heap", "", "collects a heap profile to this file path for the duration of the container execution. Requires -profile=true.")
 	flagSet.String("profile-mutex", "", "collects a mutex profile to this file path for the duration of the container execution. Requires -profile=true.")
 	flagSet.String("trace", "", "collects a Go runtime execution trace to this file path for the duration of the container execution.")
+	flagSet.String("compat-report", "", "writes a JSON report of the unsupported syscalls, ioctls, procfs files and sysctls used by the application to this file path when the sandbox exits.")
 	flagSet.Bool("rootless", false, "it allows the sandbox to be started with a user that is not root. Sandbox and Gofer processes may run with same privileges as current user.")
 	flagSet.Var(leakModePtr(refs.NoLeakChecking), "ref-leak-mode", "sets reference leak check mode: disabled (default), log-names, log-traces.")
 	flagSet.Bool("cpu-num-from-quota", false, "set cpu number to cpu quota (least integer greater or equal to quota value, but not less than 2)")
 	flagSet.Bool("oci-seccomp", false, "Enables loading OCI seccomp filters inside the sandbox.")
 	flagSet.Bool("enable-core-tags", false, "enables core tagging. Requires host linux kernel >= 5.14.")
 	flagSet.String("pod-init-config", "", "path to configuration file with additional steps to take during pod creation.")
+	flagSet.String("stdio-log", "", "log the workload's stdout and stderr as JSON records: \"stdio\" writes them to the container's stdout and stderr, an absolute path appends them to that file. Empty passes stdio through unchanged. Not applied to containers with a terminal.")
+	flagSet.Uint64("stdio-log-rate", 0, "maximum rate of workload output logged with --stdio-log, in bytes per second. Output in excess is dropped. 0 means no limit.")
+	flagSet.Uint64("stdio-log-max-size", 0, "maximum amount of workload output logged with --stdio-log per container, in bytes. Output past it is dropped. 0 means no limit.")
+	flagSet.Bool("stdio-log-redact", false, "redact common secrets, such as access tokens and passwords, from output logged with --stdio-log.")
+	flagSet.String("stdio-log-redact-patterns", "", "path to a file with additional regular expressions to redact from output logged with --stdio-log, one per line.")
+	flagSet.Bool("memory-hugepages", false, "advise the host to back sandbox memory that benefits from it, such as application anonymous memory, with transparent huge pages. Other memory is kept apart from it and advised against huge pages.")
+	flagSet.String("memory-hugepage-collapse", HugepageCollapseNever, "which application anonymous memory to collapse into huge pages in the background, like Linux's khugepaged: never, madvise (memory advised with MADV_HUGEPAGE) or always (all memory not advised with MADV_NOHUGEPAGE). Collapsed memory is only backed by host huge pages with --memory-hugepages. madvise(MADV_COLLAPSE) works regardless.")
+	flagSet.String("memory-numa-policy", "", "host NUMA policy for sandbox memory: local (the nodes of the CPUs that the sandbox may run on), preferred:<node>, bind:<nodes> or interleave:<nodes>, where <nodes> is a list such as 0-1,3. Empty uses the host's default policy.")
 
 	// Flags that control sandbox runtime behavior: FS related.
 	flagSet.Var(fileAccessTypePtr(FileAccessExclusive), "file-access", "specifies which filesystem validation to use for the root mount: exclusive (default), shared.")
 	flagSet.Var(fileAccessTypePtr(FileAccessShared), "file-access-mounts", "specifies which filesystem validation to use for volumes other than the root mount: shared (default), exclusive.")
 	flagSet.Bool("overlay", false, "DEPRECATED: use --overlay2=all:memory to achieve the same effect")
 	flagSet.Var(defaultOverlay2(), "overlay2", "wrap mounts with overlayfs. Format is {mount}:{medium}, where 'mount' can be 'root' or 'all' and medium can be 'memory', 'self' or 'dir=/abs/dir/path' in which filestore will be created. 'none' will turn overlay mode off.")
+	flagSet.Bool("host-overlay", false, "overlay the root mount with the host's overlayfs in the gofer instead of in the sentry. Only applies when the root mount is overlaid. Falls back to the sentry overlay if the host kernel lacks overlayfs support; if the gofer then fails to mount it, the container fails to start.")
+	flagSet.String("host-overlay-size", "", "maximum size of the upper layer of the host overlay, which is kept in the gofer's memory, e.g. 512m or 10%. Defaults to the container's memory limit, or half of host memory if it has none. Requires --host-overlay.")
+	flagSet.String("overlay-export", "", "host directory in which to mount the upper layer of each container's host overlay read-only over FUSE, for debugging. Each container is mounted in a subdirectory named after its ID. Requires --host-overlay.")
 	flagSet.Bool("fsgofer-host-uds", false, "DEPRECATED: use host-uds=all")
 	flagSet.Var(hostUDSPtr(HostUDSNone), "host-uds", "controls permission to access host Unix-domain sockets. Values: none|open|create|all, default: none")
 	flagSet.Var(hostFifoPtr(HostFifoNone), "host-fifo", "controls permission to access host FIFOs (or named pipes). Values: none|open, default: none")
@@ -104,13 +121,21 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.Bool("lisafs", true, "DEPRECATED: this flag has no effect.")
 	flagSet.Bool("cgroupfs", false, "Automatically mount cgroupfs.")
 	flagSet.Bool("ignore-cgroups", false, "don't configure cgroups.")
+	flagSet.Bool("cgroupless", false, "don't configure host cgroups and enforce the container's CPU, memory and PIDs limits inside the sandbox instead. Enforcement is less precise than with host cgroups.")
 	flagSet.Int("fdlimit", -1, "Specifies a limit on the number of host file descriptors that can be open. Applies separately to the sentry and gofer. Note: each file in the sandbox holds more than one host FD open.")
 	flagSet.Int("dcache", -1, "Set the global dentry cache size. This acts as a coarse-grained control on the number of host FDs simultaneously open by the sentry. If negative, per-mount caches are used.")
+	flagSet.Int("host-fd-cache", -1, "Set the maximum number of host FDs held open for files in gofer mounts. Files over the limit are closed in least recently used order and reopened on use. If zero, files are only closed when the sandbox runs out of FDs. If negative, half of the sandbox's file descriptor limit is used.")
 	flagSet.Bool("iouring", false, "TEST ONLY; Enables io_uring syscalls in the sentry. Support is experimental and very limited.")
 	flagSet.Bool("directfs", true, "directly access the container filesystems from the sentry. Sentry runs with higher privileges.")
+	flagSet.Bool("EXPERIMENTAL-unsafe-single-process", false, "EXPERIMENTAL: serve the root container's filesystems from goroutines of the sandbox process instead of a separate gofer process. Saves a process per sandbox, but the gofer is not isolated from the sentry: it runs under the sentry's widened syscall filters, and a sentry compromise gains direct access to the container's host filesystems. Requires --directfs.")
+	flagSet.Int("gofer-channels", 0, "number of channels per gofer mount over which RPCs are made concurrently, each served by a separate gofer thread, up to 64. 0 means a default based on the number of CPUs.")
+	flagSet.Int("gofer-max-concurrent-requests", 0, "maximum number of RPCs handled concurrently by the gofer per mount; further RPCs wait. 0 means no limit other than gofer-channels.")
+	flagSet.Bool("gofer-seccomp-audit", false, "log syscalls made by the gofer that violate its seccomp filters to the host kernel's audit log, and allow them, instead of killing the gofer. Use to find the syscalls a workload needs; not for production.")
+	flagSet.String("gofer-host-paths", "", "comma-separated list of host directories that the gofer may serve. If set, containers whose root filesystem or mounts are outside of them fail to start. Empty allows any path.")
+	flagSet.Bool("verify-verity", false, "verify reads of files with fs-verity enabled against their Merkle tree in the sentry, in addition to the host kernel.")
 
 	// Flags that control sandbox runtime behavior: network related.
-	flagSet.Var(networkTypePtr(NetworkSandbox), "network", "specifies which network to use: sandbox (default), host, none. Using network inside the sandbox is more secure because it's isolated from the host network.")
+	flagSet.Var(networkTypePtr(NetworkSandbox), "network", "specifies which network to use: sandbox (default), host, hybrid, none. Using network inside the sandbox is more secure because it's isolated from the host network.")
 	flagSet.Bool("net-raw", false, "enable raw sockets. When false, raw sockets are disabled by removing CAP_NET_RAW from containers (`runsc exec` will still be able to utilize raw sockets). Raw sockets allow malicious containers to craft packets and potentially attack the network.")
 	flagSet.Bool("gso", true, "enable host segmentation offload if it is supported by a network device.")
 	flagSet.Bool("software-gso", true, "enable gVisor segmentation offload when host offload can't be enabled.")
@@ -124,11 +149,25 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.Bool("EXPERIMENTAL-xdp-need-wakeup", true, "EXPERIMENTAL. Use XDP_USE_NEED_WAKEUP with XDP sockets.") // TODO(b/240191988): Figure out whether this helps and remove it as a flag.
 	flagSet.Bool("reproduce-nat", false, "Scrape the host netns NAT table and reproduce it in the sandbox.")
 	flagSet.Bool("reproduce-nftables", false, "Attempt to scrape and reproduce nftable rules inside the sandbox. Overrides reproduce-nat when true.")
+	flagSet.String("egress-proxy", "", "URL of a SOCKS5 (socks5://ip:port) or HTTP CONNECT (http://ip:port) proxy to transparently tunnel outbound TCP connections through. Requires network=sandbox.")
+	flagSet.String("egress-proxy-credentials-file", "", "path to a file containing user:pass credentials for --egress-proxy.")
+	flagSet.String("egress-proxy-bypass", "", "comma-separated list of CIDR ranges that are connected to directly instead of through --egress-proxy. Loopback and link-local addresses are never proxied.")
+	flagSet.String("ipv6-autoconf", "", "autoconfigure IPv6 addresses and routes of sandbox interfaces from Router Advertisements: none, slaac (with privacy addresses) or dhcpv6. Either a single mode for all interfaces, or a comma-separated list of interface:mode pairs. Requires network=sandbox.")
+	flagSet.String("vsock", "none", "how AF_VSOCK sockets are provided: none (default), host to bridge them to the host's vsock transport (e.g. vhost-vsock when runsc runs in a VM), or loopback to only connect sockets within the sandbox to each other.")
+	flagSet.Uint("vsock-cid", 3, "context ID of the sandbox with --vsock=loopback.")
+	flagSet.Bool("host-time-sync", false, "allow the sandbox to read the host's NTP synchronization state, which is reported by adjtimex(2) and `runsc debug --time-sync`.")
+	flagSet.Bool("deterministic", false, "EXPERIMENTAL: run tasks one at a time in a reproducible order, on virtual clocks and with a seeded random number generator, to reproduce timing-dependent bugs. Applications that spin without making syscalls will hang.")
+	flagSet.Uint64("deterministic-seed", 0, "seed of the randomness visible to the application with --deterministic. 0 means a random seed, which is logged.")
+	flagSet.String("deterministic-record", "", "writes the schedule log of a --deterministic execution, including its inputs from the host and the network, to this file path, for use with --deterministic-replay.")
+	flagSet.String("deterministic-replay", "", "replays the schedule log written by --deterministic-record. Overrides --deterministic-seed.")
 
 	// Flags that control sandbox runtime behavior: accelerator related.
 	flagSet.Bool("nvproxy", false, "EXPERIMENTAL: enable support for Nvidia GPUs")
 	flagSet.Bool("nvproxy-docker", false, "Expose GPUs to containers based on NVIDIA_VISIBLE_DEVICES, as requested by the container or set by `docker --gpus`. Allows containers to self-serve GPU access and thus disabled by default for security. libnvidia-container must be installed on the host. No effect unless --nvproxy is enabled.")
 	flagSet.Bool("tpuproxy", false, "EXPERIMENTAL: enable support for TPU device passthrough.")
+	flagSet.Bool("vfioproxy", false, "EXPERIMENTAL: enable support for VFIO device passthrough, e.g. of SR-IOV virtual functions to DPDK applications.")
+	flagSet.Bool("drmproxy", false, "EXPERIMENTAL: enable support for DRM render nodes of virtio-gpu devices, for headless rendering with Mesa's virgl and venus drivers.")
+	flagSet.Bool("ptpproxy", false, "EXPERIMENTAL: enable read-only support for PTP hardware clocks (/dev/ptp*), e.g. for chrony PHC reference clocks.")
 
 	// Test flags, not to be used outside tests, ever.
 	flagSet.Bool("TESTONLY-unsafe-nonroot", false, "TEST ONLY; do not ever use! This skips many security measures that isolate the host from the sandbox.")
@@ -364,24 +403,14 @@ func (c *Config) Override(flagSet *flag.FlagSet, name string, value string, forc
 			// Not a flag field, or flag name doesn't match.
 			continue
 		}
-		fl := flagSet.Lookup(name)
-		if fl == nil {
-			// Flag must exist if there is a field match above.
-			panic(fmt.Sprintf("Flag %q not found", name))
-		}
 		if !force {
 			if err := c.isOverrideAllowed(name, value); err != nil {
 				return fmt.Errorf("error setting flag %s=%q: %w", name, value, err)
 			}
 		}
-
-		// Use flag to convert the string value to the underlying flag type, using
-		// the same rules as the command-line for consistency.
-		if err := fl.Value.Set(value); err != nil {
-			return fmt.Errorf("error setting flag %s=%q: %w", name, value, err)
+		if err := c.setField(flagSet, obj.Field(i), name, value); err != nil {
+			return err
 		}
-		x := reflect.ValueOf(flag.Get(fl.Value))
-		obj.Field(i).Set(x)
 
 		// Validates the config again to ensure it's left in a consistent state.
 		return c.validate()
@@ -389,6 +418,38 @@ func (c *Config) Override(flagSet *flag.FlagSet, name string, value string, forc
 	return fmt.Errorf("flag %q not found. Cannot set it to %q", name, value)
 }
 
+// set writes a new value to a flag without validating the resulting config.
+func (c *Config) set(flagSet *flag.FlagSet, name string, value string) error {
+	obj := reflect.ValueOf(c).Elem()
+	st := obj.Type()
+	for i := 0; i < st.NumField(); i++ {
+		if fieldName, ok := st.Field(i).Tag.Lookup("flag"); ok && fieldName == name {
+			return c.setField(flagSet, obj.Field(i), name, value)
+		}
+	}
+	return fmt.Errorf("flag %q not found. Cannot set it to %q", name, value)
+}
+
+// setField writes a new value to the field backing the given flag.
+func (c *Config) setField(flagSet *flag.FlagSet, field reflect.Value, name string, value string) error {
+	fl := flagSet.Lookup(name)
+	if fl == nil {
+		// Flag must exist if there is a field match.
+		panic(fmt.Sprintf("Flag %q not found", name))
+	}
+	// Use flag to convert the string value to the underlying flag type, using
+	// the same rules as the command-line for consistency.
+	if err := fl.Value.Set(value); err != nil {
+		return fmt.Errorf("error setting flag %s=%q: %w", name, value, err)
+	}
+	field.Set(reflect.ValueOf(flag.Get(fl.Value)))
+	return nil
+}
+
+// ErrFlagOverrideDisabled is returned by Override when a flag that is not safe
+// to override is set without --allow-flag-override.
+var ErrFlagOverrideDisabled = errors.New("flag override disabled, use --allow-flag-override to enable it")
+
 func (c *Config) isOverrideAllowed(name string, value string) error {
 	if c.AllowFlagOverride {
 		return nil
@@ -403,7 +464,7 @@ func (c *Config) isOverrideAllowed(name string, value string) error {
 		}
 		return nil
 	}
-	return fmt.Errorf("flag override disabled, use --allow-flag-override to enable it")
+	return ErrFlagOverrideDisabled
 }
 
 // ApplyBundles applies the given bundles by name.
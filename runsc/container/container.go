@@ -141,6 +141,10 @@ type Container struct {
 	// following entries are for bind mounts in Spec.Mounts (in the same order).
 	GoferMountConfs boot.GoferMountConfFlags `json:"goferMountConfs"`
 
+	// OverlayExport is the host path at which the gofer exports the upper
+	// layer of the container's host overlay, or empty if it isn't exported.
+	OverlayExport string `json:"overlayExport"`
+
 	//
 	// Fields below this line are not saved in the state file and will not
 	// be preserved across commands.
@@ -267,7 +271,7 @@ func New(conf *config.Config, args Args) (*Container, error) {
 			args.Spec.Linux.CgroupsPath = "/" + args.ID
 		}
 		var subCgroup, parentCgroup, containerCgroup cgroup.Cgroup
-		if !conf.IgnoreCgroups {
+		if !conf.IgnoreCgroups && !conf.Cgroupless {
 			var err error
 
 			// Create and join cgroup before processes are created to ensure they are
@@ -293,7 +297,7 @@ func New(conf *config.Config, args Args) (*Container, error) {
 		if err != nil {
 			return nil, fmt.Errorf("error creating rootfs hint: %w", err)
 		}
-		goferFilestores, goferConfs, err := c.createGoferFilestores(conf.GetOverlay2(), mountHints, rootfsHint)
+		goferFilestores, goferConfs, err := c.createGoferFilestores(conf, mountHints, rootfsHint)
 		if err != nil {
 			return nil, err
 		}
@@ -305,9 +309,22 @@ func New(conf *config.Config, args Args) (*Container, error) {
 			return nil, err
 		}
 		if err := runInCgroup(containerCgroup, func() error {
-			ioFiles, devIOFile, specFile, err := c.createGoferProcess(args.Spec, conf, args.BundleDir, args.Attached, rootfsHint)
-			if err != nil {
-				return fmt.Errorf("cannot create gofer process: %w", err)
+			var (
+				ioFiles, mountPointFiles []*os.File
+				devIOFile, specFile      *os.File
+				err                      error
+			)
+			if conf.UnsafeSingleProcess {
+				// The sandbox serves the gofer mounts itself.
+				mountPointFiles, err = openGoferMountPoints(args.Spec, conf, goferConfs)
+				if err != nil {
+					return fmt.Errorf("cannot open gofer mount points: %w", err)
+				}
+			} else {
+				ioFiles, devIOFile, specFile, err = c.createGoferProcess(args.Spec, conf, args.BundleDir, args.Attached, rootfsHint)
+				if err != nil {
+					return fmt.Errorf("cannot create gofer process: %w", err)
+				}
 			}
 
 			// Start a new sandbox for this container. Any errors after this point
@@ -319,6 +336,7 @@ func New(conf *config.Config, args Args) (*Container, error) {
 				ConsoleSocket:       args.ConsoleSocket,
 				UserLog:             args.UserLog,
 				IOFiles:             ioFiles,
+				MountPointFiles:     mountPointFiles,
 				DevIOFile:           devIOFile,
 				MountsFile:          specFile,
 				Cgroup:              containerCgroup,
@@ -438,7 +456,7 @@ func (c *Container) Start(conf *config.Config) error {
 	}
 
 	if isRoot(c.Spec) {
-		if err := c.Sandbox.StartRoot(conf); err != nil {
+		if err := c.Sandbox.StartRoot(c.Spec, conf); err != nil {
 			return err
 		}
 	} else {
@@ -446,7 +464,7 @@ func (c *Container) Start(conf *config.Config) error {
 		if err != nil {
 			return fmt.Errorf("error creating rootfs hint: %w", err)
 		}
-		goferFilestores, goferConfs, err := c.createGoferFilestores(conf.GetOverlay2(), c.Sandbox.MountHints, rootfsHint)
+		goferFilestores, goferConfs, err := c.createGoferFilestores(conf, c.Sandbox.MountHints, rootfsHint)
 		if err != nil {
 			return err
 		}
@@ -523,6 +541,19 @@ func (c *Container) Start(conf *config.Config) error {
 // Restore takes a container and replaces its kernel and file system
 // to restore a container from its state file.
 func (c *Container) Restore(conf *config.Config, restoreFile string) error {
+	rf, err := os.Open(restoreFile)
+	if err != nil {
+		return fmt.Errorf("opening restore file %q failed: %v", restoreFile, err)
+	}
+	defer rf.Close()
+	return c.RestoreFromFile(conf, rf, sandbox.RestoreOpts{})
+}
+
+// RestoreFromFile is like Restore, but reads the container's state from rf,
+// which may be a stream such as a socket. The caller retains ownership of rf
+// and of the files in opts, and must close them whether or not
+// RestoreFromFile succeeds.
+func (c *Container) RestoreFromFile(conf *config.Config, rf *os.File, opts sandbox.RestoreOpts) error {
 	log.Debugf("Restore container, cid: %s", c.ID)
 	if err := c.Saver.lock(BlockAcquire); err != nil {
 		return err
@@ -539,7 +570,7 @@ func (c *Container) Restore(conf *config.Config, restoreFile string) error {
 		log.Warningf("StartContainer hook skipped because running inside container namespace is not supported")
 	}
 
-	if err := c.Sandbox.Restore(conf, c.ID, restoreFile); err != nil {
+	if err := c.Sandbox.Restore(c.Spec, conf, c.ID, rf, opts); err != nil {
 		return err
 	}
 	c.changeStatus(Running)
@@ -718,12 +749,47 @@ func (c *Container) ForwardSignals(pid int32, fgProcess bool) func() {
 
 // Checkpoint sends the checkpoint call to the container.
 // The statefile will be written to f, the file at the specified image-path.
-func (c *Container) Checkpoint(f *os.File, options statefile.Options) error {
-	log.Debugf("Checkpoint container, cid: %s", c.ID)
+// If async is true, the container keeps running after it is checkpointed,
+// and is only paused while its kernel state is saved.
+func (c *Container) Checkpoint(f *os.File, options statefile.Options, async bool) error {
+	log.Debugf("Checkpoint container, cid: %s, async: %t", c.ID, async)
 	if err := c.requireStatus("checkpoint", Created, Running, Paused); err != nil {
 		return err
 	}
-	return c.Sandbox.Checkpoint(c.ID, f, options)
+	return c.Sandbox.Checkpoint(c.ID, f, options, async)
+}
+
+// Precopy writes a round of the container's memory that has been written to
+// since the last round to f, while the container keeps running. See
+// sandbox.Sandbox.Precopy.
+func (c *Container) Precopy(f *os.File, options statefile.Options, key []byte) (control.PrecopyResult, error) {
+	log.Debugf("Precopy container, cid: %s", c.ID)
+	if err := c.requireStatus("pre-copy", Running); err != nil {
+		return control.PrecopyResult{}, err
+	}
+	return c.Sandbox.Precopy(c.ID, f, options, key)
+}
+
+// CancelPrecopy ends the pre-copy started by Precopy without checkpointing
+// the container.
+func (c *Container) CancelPrecopy() error {
+	log.Debugf("CancelPrecopy container, cid: %s", c.ID)
+	if err := c.requireStatus("cancel pre-copy of", Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.CancelPrecopy(c.ID)
+}
+
+// CheckpointPrecopied is equivalent to Checkpoint, except that memory
+// written out by Precopy and not written to since is omitted from the
+// checkpoint, which is keyed with key. The container is stopped once it is
+// checkpointed.
+func (c *Container) CheckpointPrecopied(f *os.File, options statefile.Options, key []byte) error {
+	log.Debugf("Checkpoint container after pre-copy, cid: %s", c.ID)
+	if err := c.requireStatus("checkpoint", Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.CheckpointPrecopied(c.ID, f, options, key)
 }
 
 // Pause suspends the container and its kernel.
@@ -765,6 +831,105 @@ func (c *Container) Resume() error {
 	return c.saveLocked()
 }
 
+// Detach stops the sandbox and gofer processes of c and deletes c's metadata,
+// without destroying c, so that a new container with the same ID can be
+// created to replace it. Afterwards, either c is resumed with Reattach, or
+// the replacement container is completed with Replace. c must be paused and
+// the only container of its sandbox.
+func (c *Container) Detach() error {
+	log.Debugf("Detaching container, cid: %s", c.ID)
+	if err := c.Saver.lock(BlockAcquire); err != nil {
+		return err
+	}
+	defer c.Saver.UnlockOrDie()
+
+	if err := c.requireStatus("detach", Paused); err != nil {
+		return err
+	}
+	// The replacement container would conflict with the host paths created
+	// for these.
+	hasSelfMount := false
+	c.forEachSelfMount(func(string) {
+		hasSelfMount = true
+	})
+	if hasSelfMount {
+		return fmt.Errorf("cannot detach container %q with self-backed filestores", c.ID)
+	}
+	if c.OverlayExport != "" {
+		return fmt.Errorf("cannot detach container %q with an overlay export", c.ID)
+	}
+
+	// Paused sandboxes still serve their network stack and control server;
+	// stop them entirely so that they don't interfere with the replacement.
+	if err := c.signalDetachedProcesses(unix.SIGSTOP); err != nil {
+		return err
+	}
+	if err := c.Saver.Destroy(); err != nil {
+		_ = c.signalDetachedProcesses(unix.SIGCONT)
+		return fmt.Errorf("deleting container state files: %v", err)
+	}
+	return nil
+}
+
+// Reattach restores the metadata of c, which was detached by Detach, and
+// resumes it. It is used if c couldn't be replaced.
+func (c *Container) Reattach() error {
+	log.Debugf("Reattaching container, cid: %s", c.ID)
+	if err := c.Saver.LockForNew(); err != nil {
+		return err
+	}
+	defer c.Saver.UnlockOrDie()
+
+	if err := c.saveLocked(); err != nil {
+		return err
+	}
+	if err := c.signalDetachedProcesses(unix.SIGCONT); err != nil {
+		return err
+	}
+	if err := c.Sandbox.Resume(c.ID); err != nil {
+		return fmt.Errorf("resuming container: %v", err)
+	}
+	c.changeStatus(Running)
+	return c.saveLocked()
+}
+
+// Replace completes the replacement of old, which was detached by Detach, by
+// c, which was created with the same ID and spec. It kills the processes of
+// old, and transfers ownership of the cgroups created for old, which c
+// shares, to c.
+func (c *Container) Replace(old *Container) error {
+	log.Debugf("Replacing container, cid: %s, sandbox PID: %d", c.ID, old.Sandbox.Getpid())
+	if err := c.Saver.lock(BlockAcquire); err != nil {
+		return err
+	}
+	defer c.Saver.UnlockOrDie()
+
+	if err := old.signalDetachedProcesses(unix.SIGKILL); err != nil {
+		return err
+	}
+	if path := old.Sandbox.ControlSocketPath; path != c.Sandbox.ControlSocketPath {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Warningf("Failed to remove control socket %q: %v", path, err)
+		}
+	}
+	c.Sandbox.CgroupJSON = old.Sandbox.CgroupJSON
+	c.CompatCgroup = old.CompatCgroup
+	return c.saveLocked()
+}
+
+// signalDetachedProcesses sends sig to the sandbox and gofer processes of c.
+func (c *Container) signalDetachedProcesses(sig unix.Signal) error {
+	for _, pid := range []int{c.Sandbox.Getpid(), c.GoferPid} {
+		if pid == 0 {
+			continue
+		}
+		if err := unix.Kill(pid, sig); err != nil && err != unix.ESRCH {
+			return fmt.Errorf("sending signal %v to PID %d: %w", sig, pid, err)
+		}
+	}
+	return nil
+}
+
 // State returns the metadata of the container.
 func (c *Container) State() specs.State {
 	return specs.State{
@@ -840,6 +1005,15 @@ func (c *Container) Destroy() error {
 			errs = append(errs, err.Error())
 		}
 	})
+	if c.OverlayExport != "" {
+		// The gofer is gone, so the export only needs to be detached.
+		if err := unmountOverlayExport(c.OverlayExport); err != nil {
+			err = fmt.Errorf("failed to remove overlay export %q: %v", c.OverlayExport, err)
+			log.Warningf("%v", err)
+			errs = append(errs, err.Error())
+		}
+		c.OverlayExport = ""
+	}
 	if sb != nil && sb.IsRootContainer(c.ID) {
 		// When the root container is being destroyed, we can clean up filestores
 		// used by shared mounts.
@@ -918,11 +1092,12 @@ func (c *Container) forEachSelfMount(fn func(mountSrc string)) {
 // createGoferFilestores creates the regular files that will back the
 // tmpfs/overlayfs mounts that will overlay some gofer mounts. It also returns
 // information about how each gofer mount is configured.
-func (c *Container) createGoferFilestores(ovlConf config.Overlay2, mountHints *boot.PodMountHints, rootfsHint *boot.RootfsHint) ([]*os.File, []boot.GoferMountConf, error) {
+func (c *Container) createGoferFilestores(conf *config.Config, mountHints *boot.PodMountHints, rootfsHint *boot.RootfsHint) ([]*os.File, []boot.GoferMountConf, error) {
 	var goferFilestores []*os.File
 	var goferConfs []boot.GoferMountConf
 
 	// Handle root mount first.
+	ovlConf := conf.GetOverlay2()
 	overlayMedium := ovlConf.RootOverlayMedium()
 	mountType := boot.Bind
 	if rootfsHint != nil {
@@ -934,14 +1109,20 @@ func (c *Container) createGoferFilestores(ovlConf config.Overlay2, mountHints *b
 	if c.Spec.Root.Readonly {
 		overlayMedium = config.NoOverlay
 	}
-	filestore, goferConf, err := c.createGoferFilestore(overlayMedium, c.Spec.Root.Path, mountType, false /* isShared */)
-	if err != nil {
-		return nil, nil, err
-	}
-	if filestore != nil {
-		goferFilestores = append(goferFilestores, filestore)
+	if overlayMedium != config.NoOverlay && mountType == boot.Bind && useHostOverlay(conf) {
+		// The gofer overlays the root with the host's overlayfs, so there is no
+		// filestore to create.
+		goferConfs = append(goferConfs, boot.GoferMountConf{Lower: boot.Lisafs, Upper: boot.HostOverlay})
+	} else {
+		filestore, goferConf, err := c.createGoferFilestore(overlayMedium, c.Spec.Root.Path, mountType, false /* isShared */)
+		if err != nil {
+			return nil, nil, err
+		}
+		if filestore != nil {
+			goferFilestores = append(goferFilestores, filestore)
+		}
+		goferConfs = append(goferConfs, goferConf)
 	}
-	goferConfs = append(goferConfs, goferConf)
 
 	// Handle bind mounts.
 	for i := range c.Spec.Mounts {
@@ -980,6 +1161,65 @@ func (c *Container) createGoferFilestores(ovlConf config.Overlay2, mountHints *b
 	return goferFilestores, goferConfs, nil
 }
 
+// useHostOverlay returns true if the gofer should overlay the root mount with
+// the host's overlayfs. Otherwise, the root mount is overlaid in the sentry.
+func useHostOverlay(conf *config.Config) bool {
+	if !conf.HostOverlay {
+		return false
+	}
+	if conf.TestOnlyAllowRunAsCurrentUserWithoutChroot {
+		// The gofer needs its own root to hold the upper layer.
+		log.Infof("Host overlay is not supported without chroot, using the sentry overlay")
+		return false
+	}
+	if !specutils.HostOverlaySupported() {
+		log.Infof("Host kernel doesn't support overlayfs for the gofer, using the sentry overlay")
+		return false
+	}
+	return true
+}
+
+// mountOverlayExport mounts a FUSE filesystem at a subdirectory of dir named
+// after the container, which the gofer serves with the upper layer of the host
+// overlay. It returns the mount point and the FUSE connection, which must be
+// donated to the gofer.
+func (c *Container) mountOverlayExport(dir string) (string, *os.File, error) {
+	mnt := path.Join(dir, c.ID)
+	if err := os.MkdirAll(mnt, 0700); err != nil {
+		return "", nil, err
+	}
+	// Don't use os.OpenFile, which would make the FD non-blocking.
+	fd, err := unix.Open("/dev/fuse", unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		_ = os.Remove(mnt)
+		return "", nil, fmt.Errorf("opening /dev/fuse: %w", err)
+	}
+	dev := os.NewFile(uintptr(fd), "overlay export FUSE FD")
+	// Only the user that created the container can access the export, and
+	// file permissions are checked against the attributes of the upper layer.
+	data := fmt.Sprintf("fd=%d,rootmode=%o,user_id=%d,group_id=%d,default_permissions", fd, unix.S_IFDIR, os.Geteuid(), os.Getegid())
+	flags := uintptr(unix.MS_RDONLY | unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC)
+	if err := unix.Mount("runsc-overlay-export", mnt, "fuse", flags, data); err != nil {
+		_ = dev.Close()
+		_ = os.Remove(mnt)
+		return "", nil, fmt.Errorf("mounting FUSE at %q: %w", mnt, err)
+	}
+	log.Infof("Exporting upper layer of container %q at %q", c.ID, mnt)
+	return mnt, dev, nil
+}
+
+// unmountOverlayExport detaches the overlay export at mnt and removes the
+// mount point.
+func unmountOverlayExport(mnt string) error {
+	if err := unix.Unmount(mnt, unix.MNT_DETACH); err != nil && err != unix.EINVAL && err != unix.ENOENT {
+		return err
+	}
+	if err := os.Remove(mnt); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 func (c *Container) createGoferFilestore(overlayMedium config.OverlayMedium, mountSrc string, mountType string, isShared bool) (*os.File, boot.GoferMountConf, error) {
 	var lower boot.GoferMountConfLowerType
 	switch mountType {
@@ -1164,7 +1404,7 @@ func (c *Container) waitForStopped() error {
 // shouldCreateDeviceGofer indicates whether a device gofer connection should
 // be created.
 func shouldCreateDeviceGofer(spec *specs.Spec, conf *config.Config) bool {
-	return specutils.GPUFunctionalityRequested(spec, conf) || specutils.TPUFunctionalityRequested(spec, conf)
+	return specutils.GPUFunctionalityRequested(spec, conf) || specutils.TPUFunctionalityRequested(spec, conf) || specutils.VFIOFunctionalityRequested(spec, conf) || specutils.DRMFunctionalityRequested(spec, conf)
 }
 
 // shouldSpawnGofer indicates whether the gofer process should be spawned.
@@ -1179,6 +1419,49 @@ func shouldSpawnGofer(spec *specs.Spec, conf *config.Config, goferConfs []boot.G
 	return shouldCreateDeviceGofer(spec, conf)
 }
 
+// openGoferMountPoints opens the host directories and files backing the
+// root container's lisafs mounts, in the order in which the sandbox serves
+// them, for single-process mode. Unlike the gofer process, the sandbox doesn't
+// set up bind mounts for them, so mount options are only enforced by the
+// sentry.
+func openGoferMountPoints(spec *specs.Spec, conf *config.Config, goferConfs []boot.GoferMountConf) ([]*os.File, error) {
+	if shouldCreateDeviceGofer(spec, conf) {
+		return nil, fmt.Errorf("device gofer is not supported in single-process mode")
+	}
+	var sources []string
+	if goferConfs[0].ShouldUseLisafs() {
+		if goferConfs[0].ShouldUseHostOverlayfs() {
+			return nil, fmt.Errorf("host overlay is not supported in single-process mode")
+		}
+		sources = append(sources, spec.Root.Path)
+	} else if goferConfs[0].ShouldUseErofs() {
+		return nil, fmt.Errorf("EROFS rootfs is not supported in single-process mode")
+	}
+	mountIdx := 1 // First index is for rootfs.
+	for _, m := range spec.Mounts {
+		if !specutils.IsGoferMount(m) {
+			continue
+		}
+		if goferConfs[mountIdx].ShouldUseLisafs() {
+			sources = append(sources, m.Source)
+		}
+		mountIdx++
+	}
+
+	files := make([]*os.File, 0, len(sources))
+	for _, src := range sources {
+		fd, err := unix.Open(src, unix.O_PATH|unix.O_CLOEXEC, 0)
+		if err != nil {
+			for _, f := range files {
+				_ = f.Close()
+			}
+			return nil, fmt.Errorf("opening %q: %w", src, err)
+		}
+		files = append(files, os.NewFile(uintptr(fd), src))
+	}
+	return files, nil
+}
+
 // createGoferProcess returns an IO file list and a mounts file on success.
 // The IO file list consists of image files and/or socket files to connect to
 // a gofer endpoint for the mount points using Gofers. The mounts file is the
@@ -1243,6 +1526,19 @@ func (c *Container) createGoferProcess(spec *specs.Spec, conf *config.Config, bu
 	}
 	donations.DonateAndClose("spec-fd", specFile)
 
+	if conf.OverlayExport != "" {
+		if c.GoferMountConfs[0].ShouldUseHostOverlayfs() {
+			mnt, dev, err := c.mountOverlayExport(conf.OverlayExport)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("exporting overlay: %w", err)
+			}
+			c.OverlayExport = mnt
+			donations.DonateAndClose("overlay-export-fd", dev)
+		} else {
+			log.Warningf("Not exporting overlay of container %q: it doesn't use the host overlay", c.ID)
+		}
+	}
+
 	// Donate any profile FDs to the gofer.
 	if err := c.donateGoferProfileFDs(conf, &donations); err != nil {
 		return nil, nil, nil, fmt.Errorf("donating gofer profile fds: %w", err)
@@ -1666,6 +1962,9 @@ func (c *Container) setupCgroupForRoot(conf *config.Config, spec *specs.Spec) (c
 // host have no effect on them. However, some tools (e.g. cAdvisor) uses cgroups
 // paths to discover new containers and report stats for them.
 func (c *Container) setupCgroupForSubcontainer(conf *config.Config, spec *specs.Spec) (cgroup.Cgroup, error) {
+	if conf.Cgroupless {
+		return nil, nil
+	}
 	if isRoot(spec) {
 		if _, ok := spec.Annotations[cgroupParentAnnotation]; !ok {
 			return nil, nil
@@ -1741,7 +2040,7 @@ func modifySpecForDirectfs(conf *config.Config, spec *specs.Spec) error {
 	if !conf.DirectFS || conf.TestOnlyAllowRunAsCurrentUserWithoutChroot {
 		return nil
 	}
-	if conf.Network == config.NetworkHost {
+	if conf.Network.UsesHostNetwork() {
 		// Hostnet feature requires the sandbox to run in the current user
 		// namespace, in which the network namespace is configured.
 		return nil
@@ -1079,7 +1079,7 @@ func testCheckpointRestore(t *testing.T, conf *config.Config, newSpecWithScript
 	}
 
 	// Checkpoint running container; save state into new file.
-	if err := cont.Checkpoint(file, statefile.Options{Compression: statefile.CompressionLevelFlateBestSpeed}); err != nil {
+	if err := cont.Checkpoint(file, statefile.Options{Compression: statefile.CompressionLevelFlateBestSpeed}, false /* async */); err != nil {
 		t.Fatalf("error checkpointing container to empty file: %v", err)
 	}
 	defer os.RemoveAll(imagePath)
@@ -1189,6 +1189,127 @@ func TestCheckpointRestore(t *testing.T) {
 	}
 }
 
+// TestCheckpointAsync checks that a container keeps running after an
+// asynchronous checkpoint, and that the checkpoint holds the state of the
+// container at the time it was taken.
+func TestCheckpointAsync(t *testing.T) {
+	// Skip overlay because test requires writing to host file.
+	for name, conf := range configs(t, true /* noOverlay */) {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir(testutil.TmpDir(), "checkpoint-async-test")
+			if err != nil {
+				t.Fatalf("ioutil.TempDir failed: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			if err := os.Chmod(dir, 0777); err != nil {
+				t.Fatalf("error chmoding file: %q, %v", dir, err)
+			}
+
+			outputPath := filepath.Join(dir, "output")
+			outputFile, err := createWriteableOutputFile(outputPath)
+			if err != nil {
+				t.Fatalf("error creating output file: %v", err)
+			}
+			defer outputFile.Close()
+
+			script := fmt.Sprintf("i=0; while true; do echo $i >> %q; sleep 0.1; i=$((i+1)); done", outputPath)
+			spec := testutil.NewSpecWithArgs("bash", "-c", script)
+			_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+			if err != nil {
+				t.Fatalf("error setting up container: %v", err)
+			}
+			defer cleanup()
+
+			args := Args{
+				ID:        testutil.RandomContainerID(),
+				Spec:      spec,
+				BundleDir: bundleDir,
+			}
+			cont, err := New(conf, args)
+			if err != nil {
+				t.Fatalf("error creating container: %v", err)
+			}
+			defer cont.Destroy()
+			if err := cont.Start(conf); err != nil {
+				t.Fatalf("error starting container: %v", err)
+			}
+			if err := waitForFileNotEmpty(outputFile); err != nil {
+				t.Fatalf("Failed to wait for output file: %v", err)
+			}
+
+			imagePath := filepath.Join(dir, "test-image-file")
+			file, err := os.OpenFile(imagePath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+			if err != nil {
+				t.Fatalf("error opening new file at imagePath: %v", err)
+			}
+			defer file.Close()
+			if err := cont.Checkpoint(file, statefile.Options{Compression: statefile.CompressionLevelFlateBestSpeed}, true /* async */); err != nil {
+				t.Fatalf("error checkpointing container: %v", err)
+			}
+			checkpointNum, err := readOutputNum(outputPath, -1)
+			if err != nil {
+				t.Fatalf("error with outputFile: %v", err)
+			}
+
+			// The container must keep running after the checkpoint.
+			if err := testutil.Poll(func() error {
+				n, err := readOutputNum(outputPath, -1)
+				if err != nil {
+					return err
+				}
+				if n <= checkpointNum {
+					return fmt.Errorf("container has not progressed past %d", checkpointNum)
+				}
+				return nil
+			}, 30*time.Second); err != nil {
+				t.Fatalf("container stopped after checkpoint: %v", err)
+			}
+			if cont.Status != Running {
+				t.Errorf("container status after checkpoint: got %v, want %v", cont.Status, Running)
+			}
+
+			// Both containers would write to the same file.
+			cont.Destroy()
+			if err := os.Remove(outputPath); err != nil {
+				t.Fatalf("error removing file")
+			}
+			outputFile2, err := createWriteableOutputFile(outputPath)
+			if err != nil {
+				t.Fatalf("error creating output file: %v", err)
+			}
+			defer outputFile2.Close()
+
+			args2 := Args{
+				ID:        testutil.RandomContainerID(),
+				Spec:      spec,
+				BundleDir: bundleDir,
+			}
+			cont2, err := New(conf, args2)
+			if err != nil {
+				t.Fatalf("error creating container: %v", err)
+			}
+			defer cont2.Destroy()
+			if err := cont2.Restore(conf, imagePath); err != nil {
+				t.Fatalf("error restoring container: %v", err)
+			}
+			if err := waitForFileNotEmpty(outputFile2); err != nil {
+				t.Fatalf("Failed to wait for output file: %v", err)
+			}
+
+			// The restored container must pick up from where the container was
+			// when it was checkpointed, not from where it was when the
+			// checkpoint completed.
+			firstNum, err := readOutputNum(outputPath, 0)
+			if err != nil {
+				t.Fatalf("error with outputFile: %v", err)
+			}
+			if firstNum > checkpointNum+1 {
+				t.Errorf("restored container started at %d, after the checkpoint at %d", firstNum, checkpointNum)
+			}
+		})
+	}
+}
+
 // TestUnixDomainSockets checks that Checkpoint/Restore works in cases
 // with filesystem Unix Domain Socket use.
 func TestUnixDomainSockets(t *testing.T) {
@@ -1268,7 +1389,7 @@ func TestUnixDomainSockets(t *testing.T) {
 			}
 
 			// Checkpoint running container; save state into new file.
-			if err := cont.Checkpoint(file, statefile.Options{Compression: statefile.CompressionLevelFlateBestSpeed}); err != nil {
+			if err := cont.Checkpoint(file, statefile.Options{Compression: statefile.CompressionLevelFlateBestSpeed}, false /* async */); err != nil {
 				t.Fatalf("error checkpointing container to empty file: %v", err)
 			}
 
@@ -1621,6 +1742,68 @@ func TestMountNewDir(t *testing.T) {
 	}
 }
 
+// TestSingleProcess checks that gofer mounts work when they are served by the
+// sandbox process itself.
+func TestSingleProcess(t *testing.T) {
+	dir, err := ioutil.TempDir(testutil.TmpDir(), "single-process")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatalf("os.Chmod(%q) failed: %v", dir, err)
+	}
+
+	const mountDir = "/single-process"
+	spec := testutil.NewSpecWithArgs("/bin/sh", "-c", fmt.Sprintf("ls / > /dev/null && echo hello > %s/file", mountDir))
+	spec.Mounts = append(spec.Mounts, specs.Mount{
+		Destination: mountDir,
+		Source:      dir,
+		Type:        "bind",
+	})
+	conf := testutil.TestConfig(t)
+	conf.DirectFS = true
+	conf.UnsafeSingleProcess = true
+
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	c, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer c.Destroy()
+	if c.GoferPid != 0 {
+		t.Errorf("gofer process started in single-process mode, PID: %d", c.GoferPid)
+	}
+	if err := c.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+	ws, err := c.Wait()
+	if err != nil {
+		t.Fatalf("error waiting on container: %v", err)
+	}
+	if !ws.Exited() || ws.ExitStatus() != 0 {
+		t.Fatalf("container failed, waitStatus: %v", ws)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "file"))
+	if err != nil {
+		t.Fatalf("reading file written by the container: %v", err)
+	}
+	if want := "hello\n"; string(got) != want {
+		t.Errorf("got file contents %q, want %q", got, want)
+	}
+}
+
 func TestReadonlyRoot(t *testing.T) {
 	for name, conf := range configs(t, false /* noOverlay */) {
 		t.Run(name, func(t *testing.T) {
@@ -2584,6 +2767,45 @@ func TestUsage(t *testing.T) {
 	}
 }
 
+// TestHealth checks that a running sandbox passes its health checks.
+func TestHealth(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("Creating container: %v", err)
+	}
+	defer cont.Destroy()
+
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("starting container: %v", err)
+	}
+
+	// Run twice, since the netstack check compares with the previous one.
+	for i := 0; i < 2; i++ {
+		report, err := cont.Sandbox.Health(boot.DefaultHealthTimeout)
+		if err != nil {
+			t.Fatalf("checking health: %v", err)
+		}
+		if !report.Healthy {
+			t.Errorf("sandbox is unhealthy: %+v", report.Checks)
+		}
+		if got, want := len(report.Checks), 4; got != want {
+			t.Errorf("got %d checks, want %d: %+v", got, want, report.Checks)
+		}
+	}
+}
+
 // TestUsageFD checks that usagefd generates the expected memory usage.
 func TestUsageFD(t *testing.T) {
 	spec, conf := sleepSpecConf(t)
@@ -2728,6 +2728,7 @@ func TestMultiContainerCgroups(t *testing.T) {
 				"cpuset":  "cpuset.cpus",
 				"devices": "devices.allow",
 				"memory":  "memory.usage_in_bytes",
+				"misc":    "misc.current",
 				"pids":    "pids.current",
 			}
 			for ctrl, f := range ctrlFileMap {
@@ -42,13 +42,6 @@ var allowedSyscalls = seccomp.MakeSyscallRules(map[uintptr]seccomp.SyscallRule{
 	},
 	unix.SYS_EXIT:       seccomp.MatchAll{},
 	unix.SYS_EXIT_GROUP: seccomp.MatchAll{},
-	unix.SYS_FALLOCATE: seccomp.PerArg{
-		seccomp.AnyValue{},
-		seccomp.EqualTo(0),
-	},
-	unix.SYS_FCHMOD:   seccomp.MatchAll{},
-	unix.SYS_FCHMODAT: seccomp.MatchAll{},
-	unix.SYS_FCHOWNAT: seccomp.MatchAll{},
 	unix.SYS_FCNTL: seccomp.Or{
 		seccomp.PerArg{
 			seccomp.AnyValue{},
@@ -67,11 +60,15 @@ var allowedSyscalls = seccomp.MakeSyscallRules(map[uintptr]seccomp.SyscallRule{
 			seccomp.AnyValue{},
 			seccomp.EqualTo(unix.F_ADD_SEALS),
 		},
+		// Used to forward write life time hints set by the sandbox.
+		seccomp.PerArg{
+			seccomp.AnyValue{},
+			seccomp.EqualTo(unix.F_SET_RW_HINT),
+		},
 	},
-	unix.SYS_FSTAT:     seccomp.MatchAll{},
-	unix.SYS_FSTATFS:   seccomp.MatchAll{},
-	unix.SYS_FSYNC:     seccomp.MatchAll{},
-	unix.SYS_FTRUNCATE: seccomp.MatchAll{},
+	unix.SYS_FSTAT:   seccomp.MatchAll{},
+	unix.SYS_FSTATFS: seccomp.MatchAll{},
+	unix.SYS_FSYNC:   seccomp.MatchAll{},
 	unix.SYS_FUTEX: seccomp.Or{
 		seccomp.PerArg{
 			seccomp.AnyValue{},
@@ -113,12 +110,9 @@ var allowedSyscalls = seccomp.MakeSyscallRules(map[uintptr]seccomp.SyscallRule{
 	unix.SYS_GETRANDOM:    seccomp.MatchAll{},
 	unix.SYS_GETTID:       seccomp.MatchAll{},
 	unix.SYS_GETTIMEOFDAY: seccomp.MatchAll{},
-	unix.SYS_LINKAT:       seccomp.MatchAll{},
 	unix.SYS_LSEEK:        seccomp.MatchAll{},
 	unix.SYS_MADVISE:      seccomp.MatchAll{},
 	unix.SYS_MEMFD_CREATE: seccomp.MatchAll{}, // Used by flipcall.PacketWindowAllocator.Init().
-	unix.SYS_MKDIRAT:      seccomp.MatchAll{},
-	unix.SYS_MKNODAT:      seccomp.MatchAll{},
 	unix.SYS_MMAP: seccomp.Or{
 		seccomp.PerArg{
 			seccomp.AnyValue{},
@@ -139,13 +133,18 @@ var allowedSyscalls = seccomp.MakeSyscallRules(map[uintptr]seccomp.SyscallRule{
 			seccomp.EqualTo(unix.MAP_PRIVATE | unix.MAP_ANONYMOUS | unix.MAP_FIXED),
 		},
 	},
-	unix.SYS_MPROTECT:   seccomp.MatchAll{},
-	unix.SYS_MUNMAP:     seccomp.MatchAll{},
-	unix.SYS_NANOSLEEP:  seccomp.MatchAll{},
-	unix.SYS_OPENAT:     seccomp.MatchAll{},
+	unix.SYS_MPROTECT:  seccomp.MatchAll{},
+	unix.SYS_MUNMAP:    seccomp.MatchAll{},
+	unix.SYS_NANOSLEEP: seccomp.MatchAll{},
+	unix.SYS_OPENAT: seccomp.PerArg{
+		seccomp.AnyValue{},
+		seccomp.AnyValue{},
+		// Files may only be opened for writing if deviceSyscalls or
+		// writeSyscalls are allowed.
+		seccomp.MaskedEqual(unix.O_ACCMODE|unix.O_CREAT|unix.O_TRUNC, unix.O_RDONLY),
+	},
 	unix.SYS_PPOLL:      seccomp.MatchAll{},
 	unix.SYS_PREAD64:    seccomp.MatchAll{},
-	unix.SYS_PWRITE64:   seccomp.MatchAll{},
 	unix.SYS_READ:       seccomp.MatchAll{},
 	unix.SYS_READLINKAT: seccomp.MatchAll{},
 	unix.SYS_RECVMSG: seccomp.Or{
@@ -160,7 +159,6 @@ var allowedSyscalls = seccomp.MakeSyscallRules(map[uintptr]seccomp.SyscallRule{
 			seccomp.EqualTo(unix.MSG_DONTWAIT | unix.MSG_TRUNC | unix.MSG_PEEK),
 		},
 	},
-	unix.SYS_RENAMEAT:        seccomp.MatchAll{},
 	unix.SYS_RESTART_SYSCALL: seccomp.MatchAll{},
 	// May be used by the runtime during panic().
 	unix.SYS_RT_SIGACTION:   seccomp.MatchAll{},
@@ -192,13 +190,43 @@ var allowedSyscalls = seccomp.MakeSyscallRules(map[uintptr]seccomp.SyscallRule{
 		seccomp.EqualTo(unix.SOCK_SEQPACKET | unix.SOCK_CLOEXEC),
 		seccomp.EqualTo(0),
 	},
-	unix.SYS_SYMLINKAT: seccomp.MatchAll{},
+	unix.SYS_SYNC_FILE_RANGE: seccomp.MatchAll{},
 	unix.SYS_TGKILL: seccomp.PerArg{
 		seccomp.EqualTo(uint64(os.Getpid())),
 	},
+	unix.SYS_WRITE: seccomp.MatchAll{},
+})
+
+// deviceSyscalls is the set of syscalls executed by the gofer to open
+// existing device files for writing, which mounts of devices require.
+var deviceSyscalls = seccomp.MakeSyscallRules(map[uintptr]seccomp.SyscallRule{
+	unix.SYS_OPENAT: seccomp.PerArg{
+		seccomp.AnyValue{},
+		seccomp.AnyValue{},
+		seccomp.MaskedEqual(unix.O_CREAT|unix.O_TRUNC, 0),
+	},
+})
+
+// writeSyscalls is the set of syscalls executed by the gofer only to modify
+// files. They are only allowed if a mount served by the gofer is writable.
+var writeSyscalls = seccomp.MakeSyscallRules(map[uintptr]seccomp.SyscallRule{
+	unix.SYS_FALLOCATE: seccomp.PerArg{
+		seccomp.AnyValue{},
+		seccomp.EqualTo(0),
+	},
+	unix.SYS_FCHMOD:    seccomp.MatchAll{},
+	unix.SYS_FCHMODAT:  seccomp.MatchAll{},
+	unix.SYS_FCHOWNAT:  seccomp.MatchAll{},
+	unix.SYS_FTRUNCATE: seccomp.MatchAll{},
+	unix.SYS_LINKAT:    seccomp.MatchAll{},
+	unix.SYS_MKDIRAT:   seccomp.MatchAll{},
+	unix.SYS_MKNODAT:   seccomp.MatchAll{},
+	unix.SYS_OPENAT:    seccomp.MatchAll{},
+	unix.SYS_PWRITE64:  seccomp.MatchAll{},
+	unix.SYS_RENAMEAT:  seccomp.MatchAll{},
+	unix.SYS_SYMLINKAT: seccomp.MatchAll{},
 	unix.SYS_UNLINKAT:  seccomp.MatchAll{},
 	unix.SYS_UTIMENSAT: seccomp.MatchAll{},
-	unix.SYS_WRITE:     seccomp.MatchAll{},
 })
 
 var udsCommonSyscalls = seccomp.MakeSyscallRules(map[uintptr]seccomp.SyscallRule{
@@ -18,28 +18,113 @@
 package filter
 
 import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/seccomp"
 )
 
+// MountPolicy is the access to files that the gofer needs for a mount it
+// serves.
+type MountPolicy int
+
+const (
+	// MountReadOnly is the policy of read-only mounts, whose files are only
+	// read.
+	MountReadOnly MountPolicy = iota
+
+	// MountDevices is the policy of mounts of device files, which may be
+	// opened for writing but are never created, modified or removed.
+	MountDevices
+
+	// MountReadWrite is the policy of writable mounts.
+	MountReadWrite
+)
+
+// String implements fmt.Stringer.
+func (p MountPolicy) String() string {
+	switch p {
+	case MountReadOnly:
+		return "read-only"
+	case MountDevices:
+		return "devices"
+	case MountReadWrite:
+		return "read-write"
+	default:
+		return fmt.Sprintf("MountPolicy(%d)", int(p))
+	}
+}
+
 // Options are seccomp filter related options.
 type Options struct {
 	UDSOpenEnabled   bool
 	UDSCreateEnabled bool
 	ProfileEnabled   bool
+
+	// Mounts holds the policy of each mount served by the gofer. Seccomp
+	// filters apply to the whole process, so the filters allow the syscalls
+	// of the least restrictive policy, and the lisafs server enforces
+	// read-only mounts for each connection.
+	Mounts []MountPolicy
+
+	// Audit makes the host kernel log syscalls that violate the filters,
+	// and allow them, rather than killing the gofer. It is intended for
+	// finding the syscalls required by a workload before enforcing the
+	// filters.
+	Audit bool
 }
 
 // Install installs seccomp filters.
 func Install(opt Options) error {
-	s := allowedSyscalls
-
 	if opt.ProfileEnabled {
 		report("profile enabled: syscall filters less restrictive!")
+	}
+	if opt.UDSOpenEnabled || opt.UDSCreateEnabled {
+		report("host UDS enabled: syscall filters less restrictive!")
+	}
+	log.Infof("Gofer mounts require the %s syscall policy", opt.mountPolicy())
+	if opt.Audit {
+		report("audit mode enabled: syscall filter violations are logged by the host kernel but allowed!")
+	}
+	return seccomp.Install(Rules(opt), seccomp.DenyNewExecMappings, ProgramOptions(opt))
+}
+
+// mountPolicy returns the least restrictive policy in opt.Mounts.
+func (opt *Options) mountPolicy() MountPolicy {
+	policy := MountReadOnly
+	for _, p := range opt.Mounts {
+		policy = max(policy, p)
+	}
+	return policy
+}
+
+// ProgramOptions returns the seccomp program options for the gofer with the
+// given options.
+func ProgramOptions(opt Options) seccomp.ProgramOptions {
+	seccompOpts := seccomp.DefaultProgramOptions()
+	if opt.Audit {
+		seccompOpts.DefaultAction = linux.SECCOMP_RET_LOG
+	}
+	return seccompOpts
+}
+
+// Rules returns the seccomp rules for the gofer with the given options.
+func Rules(opt Options) seccomp.SyscallRules {
+	s := allowedSyscalls.Copy()
+
+	switch opt.mountPolicy() {
+	case MountDevices:
+		s.Merge(deviceSyscalls)
+	case MountReadWrite:
+		s.Merge(writeSyscalls)
+	}
+
+	if opt.ProfileEnabled {
 		s.Merge(profileFilters)
 	}
 
 	if opt.UDSOpenEnabled || opt.UDSCreateEnabled {
-		report("host UDS enabled: syscall filters less restrictive!")
 		s.Merge(udsCommonSyscalls)
 		if opt.UDSOpenEnabled {
 			s.Merge(udsOpenSyscalls)
@@ -53,7 +138,7 @@ func Install(opt Options) error {
 	// when not enabled.
 	s.Merge(instrumentationFilters())
 
-	return seccomp.Install(s, seccomp.DenyNewExecMappings, seccomp.DefaultProgramOptions())
+	return s
 }
 
 // report writes a warning message to the log.
@@ -0,0 +1,133 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/bpf"
+	"gvisor.dev/gvisor/pkg/seccomp"
+)
+
+// syscallAction returns the action of the gofer's filters with the given
+// options for a syscall.
+func syscallAction(t *testing.T, opt Options, sysno uintptr, args ...uint64) linux.BPFAction {
+	t.Helper()
+	programOpts := ProgramOptions(opt)
+	instrs, _, err := seccomp.BuildProgram([]seccomp.RuleSet{
+		{
+			Rules:  Rules(opt),
+			Action: linux.SECCOMP_RET_ALLOW,
+		},
+	}, programOpts)
+	if err != nil {
+		t.Fatalf("BuildProgram() got error: %v", err)
+	}
+	p, err := bpf.Compile(instrs, programOpts.Optimize)
+	if err != nil {
+		t.Fatalf("bpf.Compile got error: %v", err)
+	}
+	data := linux.SeccompData{
+		Nr:   int32(sysno),
+		Arch: seccomp.LINUX_AUDIT_ARCH,
+	}
+	copy(data.Args[:], args)
+	buf := make([]byte, data.SizeBytes())
+	got, err := bpf.Exec[bpf.NativeEndian](p, seccomp.DataAsBPFInput(&data, buf))
+	if err != nil {
+		t.Fatalf("bpf.Exec got error: %v", err)
+	}
+	return linux.BPFAction(got)
+}
+
+// TestReadOnlyExcludesWriteSyscalls checks that syscalls that modify files
+// are only allowed if a mount is writable.
+func TestReadOnlyExcludesWriteSyscalls(t *testing.T) {
+	for _, mounts := range [][]MountPolicy{
+		nil,
+		{MountReadOnly},
+		{MountReadOnly, MountDevices},
+	} {
+		rules := Rules(Options{Mounts: mounts})
+		for _, sysno := range []uintptr{
+			unix.SYS_FALLOCATE,
+			unix.SYS_FCHMOD,
+			unix.SYS_FCHMODAT,
+			unix.SYS_FCHOWNAT,
+			unix.SYS_FTRUNCATE,
+			unix.SYS_LINKAT,
+			unix.SYS_MKDIRAT,
+			unix.SYS_MKNODAT,
+			unix.SYS_PWRITE64,
+			unix.SYS_RENAMEAT,
+			unix.SYS_SYMLINKAT,
+			unix.SYS_UNLINKAT,
+			unix.SYS_UTIMENSAT,
+		} {
+			if rules.Has(sysno) {
+				t.Errorf("mounts %v: syscall %d is allowed", mounts, sysno)
+			}
+		}
+	}
+	rules := Rules(Options{Mounts: []MountPolicy{MountReadOnly, MountReadWrite}})
+	if !rules.Has(unix.SYS_MKDIRAT) {
+		t.Errorf("mkdirat isn't allowed with a writable mount")
+	}
+}
+
+// TestOpenFlags checks which flags each policy allows files to be opened
+// with.
+func TestOpenFlags(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		policy MountPolicy
+		flags  uint64
+		allow  bool
+	}{
+		{"ReadOnly", MountReadOnly, unix.O_RDONLY, true},
+		{"ReadOnlyRDWR", MountReadOnly, unix.O_RDWR, false},
+		{"ReadOnlyCreate", MountReadOnly, unix.O_RDONLY | unix.O_CREAT, false},
+		{"DevicesRDWR", MountDevices, unix.O_RDWR, true},
+		{"DevicesCreate", MountDevices, unix.O_RDWR | unix.O_CREAT, false},
+		{"DevicesTrunc", MountDevices, unix.O_WRONLY | unix.O_TRUNC, false},
+		{"ReadWriteCreate", MountReadWrite, unix.O_RDWR | unix.O_CREAT | unix.O_TRUNC, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			opt := Options{Mounts: []MountPolicy{test.policy}}
+			got := syscallAction(t, opt, unix.SYS_OPENAT, uint64(unix.AT_FDCWD), 0, test.flags)
+			if allowed := got == linux.SECCOMP_RET_ALLOW; allowed != test.allow {
+				t.Errorf("openat(%#x): got action %v, want allowed = %t", test.flags, got, test.allow)
+			}
+		})
+	}
+}
+
+// TestAudit checks that audit mode logs violations rather than enforcing
+// the filters.
+func TestAudit(t *testing.T) {
+	opt := Options{Mounts: []MountPolicy{MountReadOnly}}
+	if got := syscallAction(t, opt, unix.SYS_MKDIRAT); got == linux.SECCOMP_RET_ALLOW || got == linux.SECCOMP_RET_LOG {
+		t.Errorf("mkdirat: got action %v without audit mode", got)
+	}
+	opt.Audit = true
+	if got := syscallAction(t, opt, unix.SYS_MKDIRAT); got != linux.SECCOMP_RET_LOG {
+		t.Errorf("mkdirat: got action %v, want %v", got, linux.SECCOMP_RET_LOG)
+	}
+	if got := syscallAction(t, opt, unix.SYS_READ); got != linux.SECCOMP_RET_ALLOW {
+		t.Errorf("read: got action %v, want %v", got, linux.SECCOMP_RET_ALLOW)
+	}
+}
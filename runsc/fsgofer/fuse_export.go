@@ -0,0 +1,546 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsgofer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/fsutil"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/marshal"
+)
+
+const (
+	// fuseExportMaxRead is the maximum size of a FUSE_READ reply. It matches
+	// the kernel's default of 32 pages per request.
+	fuseExportMaxRead = 128 << 10
+
+	// fuseExportCacheSeconds is how long the host kernel may cache entries and
+	// attributes of the export. The exported directory changes as the
+	// workload runs, so it is kept short.
+	fuseExportCacheSeconds = 1
+)
+
+// FUSEExport serves a directory read-only over a FUSE connection, so that the
+// host can mount it and inspect the files in it without entering the sandbox.
+// Requests are served one at a time.
+type FUSEExport struct {
+	// devFD is the FUSE connection, opened from /dev/fuse.
+	devFD int
+
+	// nodes maps node IDs to the files looked up by the kernel, and inodes
+	// maps the host inodes of these files to their node IDs, so that a file
+	// has a single node ID no matter how it was reached.
+	nodes      map[uint64]*fuseExportNode
+	inodes     map[fuseExportInode]uint64
+	nextNodeID uint64
+
+	// handles maps file handles to open files and directories.
+	handles    map[uint64]*fuseExportHandle
+	nextHandle uint64
+}
+
+type fuseExportInode struct {
+	dev uint64
+	ino uint64
+}
+
+type fuseExportNode struct {
+	// fd is an O_PATH file descriptor for the file.
+	fd    int
+	inode fuseExportInode
+
+	// lookups is the number of lookups of the node that the kernel hasn't
+	// forgotten yet.
+	lookups uint64
+}
+
+type fuseExportHandle struct {
+	// fd is the open file, or -1 for directories.
+	fd int
+
+	// dirents holds the directory entries, read when the directory was
+	// opened.
+	dirents []fuseExportDirent
+}
+
+type fuseExportDirent struct {
+	ino   uint64
+	ftype uint8
+	name  string
+}
+
+// NewFUSEExport returns a FUSEExport that serves the directory rootFD on the
+// FUSE connection devFD. It takes ownership of both FDs.
+func NewFUSEExport(devFD, rootFD int) (*FUSEExport, error) {
+	var stat unix.Stat_t
+	if err := unix.Fstat(rootFD, &stat); err != nil {
+		return nil, fmt.Errorf("fstat(%d): %w", rootFD, err)
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFDIR {
+		return nil, fmt.Errorf("FD %d is not a directory", rootFD)
+	}
+	root := &fuseExportNode{
+		fd:    rootFD,
+		inode: fuseExportInode{dev: uint64(stat.Dev), ino: stat.Ino},
+	}
+	return &FUSEExport{
+		devFD:      devFD,
+		nodes:      map[uint64]*fuseExportNode{linux.FUSE_ROOT_ID: root},
+		inodes:     map[fuseExportInode]uint64{root.inode: linux.FUSE_ROOT_ID},
+		nextNodeID: linux.FUSE_ROOT_ID + 1,
+		handles:    make(map[uint64]*fuseExportHandle),
+		nextHandle: 1,
+	}, nil
+}
+
+// Serve serves requests until the export is unmounted or the connection is
+// aborted. All FDs are closed when it returns.
+func (e *FUSEExport) Serve() error {
+	defer e.release()
+
+	buf := make([]byte, fuseExportMaxRead+linux.FUSE_PAGE_SIZE)
+	for {
+		n, err := unix.Read(e.devFD, buf)
+		switch err {
+		case nil:
+		case unix.EINTR, unix.ENOENT:
+			// ENOENT means that the request was interrupted before it was read.
+			continue
+		case unix.ENODEV:
+			// The export was unmounted.
+			return nil
+		default:
+			return fmt.Errorf("reading FUSE request: %w", err)
+		}
+		if n == 0 {
+			// The other end of the connection was closed.
+			return nil
+		}
+		if e.serveRequest(buf[:n]) {
+			return nil
+		}
+	}
+}
+
+// release closes all FDs held by the export.
+func (e *FUSEExport) release() {
+	for _, h := range e.handles {
+		if h.fd >= 0 {
+			_ = unix.Close(h.fd)
+		}
+	}
+	for _, n := range e.nodes {
+		_ = unix.Close(n.fd)
+	}
+	_ = unix.Close(e.devFD)
+	e.handles = nil
+	e.nodes = nil
+	e.inodes = nil
+}
+
+// serveRequest serves a single request. It returns true if the connection was
+// destroyed.
+func (e *FUSEExport) serveRequest(req []byte) bool {
+	var hdr linux.FUSEHeaderIn
+	if len(req) < hdr.SizeBytes() {
+		log.Warningf("Short FUSE request: %d bytes", len(req))
+		return false
+	}
+	payload := hdr.UnmarshalBytes(req)
+
+	var (
+		out []byte
+		err error
+	)
+	switch hdr.Opcode {
+	case linux.FUSE_INIT:
+		out, err = e.init(payload)
+	case linux.FUSE_DESTROY:
+		e.reply(hdr.Unique, nil, nil)
+		return true
+	case linux.FUSE_INTERRUPT:
+		// Requests are served synchronously, so there is nothing to
+		// interrupt. Interrupts don't have replies.
+		return false
+	case linux.FUSE_FORGET:
+		if len(payload) >= 8 {
+			e.forget(hdr.NodeID, hostarch.ByteOrder.Uint64(payload))
+		}
+		// Forgets don't have replies.
+		return false
+	case linux.FUSE_BATCH_FORGET:
+		e.batchForget(payload)
+		return false
+	case linux.FUSE_LOOKUP:
+		out, err = e.lookup(hdr.NodeID, payload)
+	case linux.FUSE_GETATTR:
+		out, err = e.getAttr(hdr.NodeID)
+	case linux.FUSE_READLINK:
+		out, err = e.readlink(hdr.NodeID)
+	case linux.FUSE_OPEN:
+		out, err = e.open(hdr.NodeID, payload)
+	case linux.FUSE_READ:
+		out, err = e.read(payload)
+	case linux.FUSE_OPENDIR:
+		out, err = e.openDir(hdr.NodeID)
+	case linux.FUSE_READDIR:
+		out, err = e.readDir(payload)
+	case linux.FUSE_RELEASE, linux.FUSE_RELEASEDIR:
+		err = e.releaseHandle(payload)
+	case linux.FUSE_FLUSH:
+		// Nothing is ever written.
+	case linux.FUSE_STATFS:
+		out, err = e.statfs()
+	case linux.FUSE_SETATTR, linux.FUSE_SYMLINK, linux.FUSE_MKNOD, linux.FUSE_MKDIR,
+		linux.FUSE_UNLINK, linux.FUSE_RMDIR, linux.FUSE_RENAME, linux.FUSE_LINK,
+		linux.FUSE_WRITE, linux.FUSE_SETXATTR, linux.FUSE_REMOVEXATTR,
+		linux.FUSE_CREATE, linux.FUSE_FALLOCATE:
+		err = unix.EROFS
+	default:
+		// This includes xattrs and FUSE_ACCESS, which the kernel stops sending
+		// after the first ENOSYS.
+		err = unix.ENOSYS
+	}
+	e.reply(hdr.Unique, out, err)
+	return false
+}
+
+// reply sends the reply to request unique.
+func (e *FUSEExport) reply(unique linux.FUSEOpID, out []byte, err error) {
+	hdr := linux.FUSEHeaderOut{Unique: unique}
+	if err != nil {
+		errno := unix.EIO
+		if !errors.As(err, &errno) {
+			log.Warningf("FUSE export request %d failed: %v", unique, err)
+		}
+		hdr.Error = -int32(errno)
+		out = nil
+	}
+	hdr.Len = uint32(hdr.SizeBytes() + len(out))
+	buf := make([]byte, hdr.Len)
+	copy(hdr.MarshalBytes(buf), out)
+	if _, err := unix.Write(e.devFD, buf); err != nil && err != unix.ENOENT {
+		// ENOENT means that the request was interrupted and no longer
+		// expects a reply.
+		log.Warningf("Writing FUSE reply to request %d: %v", unique, err)
+	}
+}
+
+// unmarshalIn unmarshals the request payload into in. Payloads shorter than
+// in, e.g. from older kernels, are padded with zeroes.
+func unmarshalIn(payload []byte, in marshal.Marshallable) {
+	buf := make([]byte, in.SizeBytes())
+	copy(buf, payload)
+	in.UnmarshalBytes(buf)
+}
+
+func (e *FUSEExport) init(payload []byte) ([]byte, error) {
+	var in linux.FUSEInitIn
+	unmarshalIn(payload, &in)
+	if in.Major < linux.FUSE_KERNEL_VERSION {
+		return nil, unix.EPROTO
+	}
+	out := linux.FUSEInitOut{
+		Major:        linux.FUSE_KERNEL_VERSION,
+		Minor:        linux.FUSE_KERNEL_MINOR_VERSION,
+		MaxReadahead: in.MaxReadahead,
+		// Nothing is ever written, but the kernel requires a minimum.
+		MaxWrite: fuseExportMaxRead,
+		TimeGran: 1,
+	}
+	log.Infof("FUSE export initialized, kernel protocol %d.%d", in.Major, in.Minor)
+	return marshal.Marshal(&out), nil
+}
+
+func (e *FUSEExport) node(id uint64) (*fuseExportNode, error) {
+	n, ok := e.nodes[id]
+	if !ok {
+		return nil, unix.ESTALE
+	}
+	return n, nil
+}
+
+func (e *FUSEExport) lookup(parentID uint64, payload []byte) ([]byte, error) {
+	parent, err := e.node(parentID)
+	if err != nil {
+		return nil, err
+	}
+	name := payload
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	if len(name) == 0 || string(name) == "." || string(name) == ".." || bytes.IndexByte(name, '/') >= 0 {
+		return nil, unix.ENOENT
+	}
+	// Symlinks are never followed, as they may point outside of the exported
+	// directory.
+	fd, err := unix.Openat(parent.fd, string(name), unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	var stat unix.Stat_t
+	if err := unix.Fstat(fd, &stat); err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+
+	inode := fuseExportInode{dev: uint64(stat.Dev), ino: stat.Ino}
+	id, ok := e.inodes[inode]
+	if ok {
+		_ = unix.Close(fd)
+	} else {
+		id = e.nextNodeID
+		e.nextNodeID++
+		e.nodes[id] = &fuseExportNode{fd: fd, inode: inode}
+		e.inodes[inode] = id
+	}
+	e.nodes[id].lookups++
+
+	out := linux.FUSEEntryOut{
+		NodeID:     id,
+		EntryValid: fuseExportCacheSeconds,
+		AttrValid:  fuseExportCacheSeconds,
+		Attr:       fuseExportAttr(&stat),
+	}
+	return marshal.Marshal(&out), nil
+}
+
+func (e *FUSEExport) forget(id, lookups uint64) {
+	n, ok := e.nodes[id]
+	if !ok || id == linux.FUSE_ROOT_ID {
+		return
+	}
+	if n.lookups > lookups {
+		n.lookups -= lookups
+		return
+	}
+	_ = unix.Close(n.fd)
+	delete(e.nodes, id)
+	delete(e.inodes, n.inode)
+}
+
+// batchForget handles FUSE_BATCH_FORGET, whose payload is a struct
+// fuse_batch_forget_in followed by its count of struct fuse_forget_one.
+func (e *FUSEExport) batchForget(payload []byte) {
+	if len(payload) < 8 {
+		return
+	}
+	count := hostarch.ByteOrder.Uint32(payload)
+	payload = payload[8:]
+	for ; count > 0 && len(payload) >= 16; count-- {
+		e.forget(hostarch.ByteOrder.Uint64(payload), hostarch.ByteOrder.Uint64(payload[8:]))
+		payload = payload[16:]
+	}
+}
+
+func (e *FUSEExport) getAttr(id uint64) ([]byte, error) {
+	n, err := e.node(id)
+	if err != nil {
+		return nil, err
+	}
+	var stat unix.Stat_t
+	if err := unix.Fstat(n.fd, &stat); err != nil {
+		return nil, err
+	}
+	out := linux.FUSEAttrOut{
+		AttrValid: fuseExportCacheSeconds,
+		Attr:      fuseExportAttr(&stat),
+	}
+	return marshal.Marshal(&out), nil
+}
+
+func fuseExportAttr(stat *unix.Stat_t) linux.FUSEAttr {
+	return linux.FUSEAttr{
+		Ino:       stat.Ino,
+		Size:      uint64(stat.Size),
+		Blocks:    uint64(stat.Blocks),
+		Atime:     uint64(stat.Atim.Sec),
+		Mtime:     uint64(stat.Mtim.Sec),
+		Ctime:     uint64(stat.Ctim.Sec),
+		AtimeNsec: uint32(stat.Atim.Nsec),
+		MtimeNsec: uint32(stat.Mtim.Nsec),
+		CtimeNsec: uint32(stat.Ctim.Nsec),
+		Mode:      stat.Mode,
+		Nlink:     uint32(stat.Nlink),
+		UID:       stat.Uid,
+		GID:       stat.Gid,
+		Rdev:      uint32(stat.Rdev),
+		BlkSize:   uint32(stat.Blksize),
+	}
+}
+
+func (e *FUSEExport) readlink(id uint64) ([]byte, error) {
+	n, err := e.node(id)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, linux.PATH_MAX)
+	size, err := unix.Readlinkat(n.fd, "", buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
+
+// reopen opens the file behind the O_PATH FD of n.
+func (n *fuseExportNode) reopen(flags int) (int, error) {
+	return unix.Openat(int(procSelfFD.FD()), strconv.Itoa(n.fd), flags|unix.O_CLOEXEC|unix.O_NOCTTY, 0)
+}
+
+func (e *FUSEExport) newHandle(h *fuseExportHandle) []byte {
+	fh := e.nextHandle
+	e.nextHandle++
+	e.handles[fh] = h
+	return marshal.Marshal(&linux.FUSEOpenOut{Fh: fh})
+}
+
+func (e *FUSEExport) fileHandle(fh uint64) (*fuseExportHandle, error) {
+	h, ok := e.handles[fh]
+	if !ok {
+		return nil, unix.EBADF
+	}
+	return h, nil
+}
+
+func (e *FUSEExport) open(id uint64, payload []byte) ([]byte, error) {
+	n, err := e.node(id)
+	if err != nil {
+		return nil, err
+	}
+	var in linux.FUSEOpenIn
+	unmarshalIn(payload, &in)
+	if in.Flags&(unix.O_ACCMODE|unix.O_CREAT|unix.O_TRUNC) != unix.O_RDONLY {
+		return nil, unix.EROFS
+	}
+	fd, err := n.reopen(unix.O_RDONLY | unix.O_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	return e.newHandle(&fuseExportHandle{fd: fd}), nil
+}
+
+func (e *FUSEExport) read(payload []byte) ([]byte, error) {
+	var in linux.FUSEReadIn
+	unmarshalIn(payload, &in)
+	h, err := e.fileHandle(in.Fh)
+	if err != nil {
+		return nil, err
+	}
+	if h.fd < 0 {
+		return nil, unix.EISDIR
+	}
+	buf := make([]byte, min(in.Size, fuseExportMaxRead))
+	n, err := unix.Pread(h.fd, buf, int64(in.Offset))
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func (e *FUSEExport) openDir(id uint64) ([]byte, error) {
+	n, err := e.node(id)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := n.reopen(unix.O_RDONLY | unix.O_DIRECTORY)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(fd)
+
+	h := &fuseExportHandle{fd: -1}
+	err = fsutil.ForEachDirent(fd, func(ino uint64, _ int64, ftype uint8, name string, _ uint16) {
+		h.dirents = append(h.dirents, fuseExportDirent{ino: ino, ftype: ftype, name: name})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e.newHandle(h), nil
+}
+
+// readDir returns the directory entries following the offset in the request.
+// The offset of an entry is its index in the directory plus one.
+func (e *FUSEExport) readDir(payload []byte) ([]byte, error) {
+	var in linux.FUSEReadIn
+	unmarshalIn(payload, &in)
+	h, err := e.fileHandle(in.Fh)
+	if err != nil {
+		return nil, err
+	}
+	if h.fd >= 0 {
+		return nil, unix.ENOTDIR
+	}
+	var (
+		out  []byte
+		meta linux.FUSEDirentMeta
+	)
+	for i := in.Offset; i < uint64(len(h.dirents)); i++ {
+		d := h.dirents[i]
+		size := meta.SizeBytes() + len(d.name)
+		size = (size + linux.FUSE_DIRENT_ALIGN - 1) &^ (linux.FUSE_DIRENT_ALIGN - 1)
+		if len(out)+size > int(in.Size) {
+			break
+		}
+		meta = linux.FUSEDirentMeta{
+			Ino:     d.ino,
+			Off:     i + 1,
+			NameLen: uint32(len(d.name)),
+			Type:    uint32(d.ftype),
+		}
+		buf := make([]byte, size)
+		copy(meta.MarshalBytes(buf), d.name)
+		out = append(out, buf...)
+	}
+	return out, nil
+}
+
+func (e *FUSEExport) releaseHandle(payload []byte) error {
+	var in linux.FUSEReleaseIn
+	unmarshalIn(payload, &in)
+	h, err := e.fileHandle(in.Fh)
+	if err != nil {
+		return err
+	}
+	if h.fd >= 0 {
+		_ = unix.Close(h.fd)
+	}
+	delete(e.handles, in.Fh)
+	return nil
+}
+
+func (e *FUSEExport) statfs() ([]byte, error) {
+	var st unix.Statfs_t
+	if err := unix.Fstatfs(e.nodes[linux.FUSE_ROOT_ID].fd, &st); err != nil {
+		return nil, err
+	}
+	out := linux.FUSEStatfsOut{
+		Blocks:          st.Blocks,
+		BlocksFree:      st.Bfree,
+		BlocksAvailable: st.Bavail,
+		Files:           st.Files,
+		FilesFree:       st.Ffree,
+		BlockSize:       uint32(st.Bsize),
+		NameLength:      uint32(st.Namelen),
+		FragmentSize:    uint32(st.Frsize),
+	}
+	return marshal.Marshal(&out), nil
+}
@@ -0,0 +1,223 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsgofer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+)
+
+// fuseExportClient sends requests to a FUSEExport in place of the kernel.
+type fuseExportClient struct {
+	t      *testing.T
+	fd     int
+	unique linux.FUSEOpID
+}
+
+// call sends a request and returns the reply payload and error.
+func (c *fuseExportClient) call(opcode linux.FUSEOpcode, nodeID uint64, in marshal.Marshallable) ([]byte, unix.Errno) {
+	c.t.Helper()
+	c.unique++
+	hdr := linux.FUSEHeaderIn{
+		Opcode: opcode,
+		Unique: c.unique,
+		NodeID: nodeID,
+	}
+	size := hdr.SizeBytes()
+	if in != nil {
+		size += in.SizeBytes()
+	}
+	hdr.Len = uint32(size)
+	req := make([]byte, size)
+	rest := hdr.MarshalBytes(req)
+	if in != nil {
+		in.MarshalBytes(rest)
+	}
+	if _, err := unix.Write(c.fd, req); err != nil {
+		c.t.Fatalf("writing request: %v", err)
+	}
+	if opcode == linux.FUSE_FORGET {
+		return nil, 0
+	}
+
+	buf := make([]byte, 2*fuseExportMaxRead)
+	n, err := unix.Read(c.fd, buf)
+	if err != nil {
+		c.t.Fatalf("reading reply: %v", err)
+	}
+	var out linux.FUSEHeaderOut
+	payload := out.UnmarshalBytes(buf[:n])
+	if out.Unique != c.unique || int(out.Len) != n {
+		c.t.Fatalf("got reply header %+v for request %d of %d bytes", out, c.unique, n)
+	}
+	return payload, unix.Errno(-out.Error)
+}
+
+func (c *fuseExportClient) lookup(parent uint64, name string) (linux.FUSEEntryOut, unix.Errno) {
+	c.t.Helper()
+	cname := linux.CString(name)
+	payload, errno := c.call(linux.FUSE_LOOKUP, parent, &cname)
+	var out linux.FUSEEntryOut
+	if errno == 0 {
+		out.UnmarshalBytes(payload)
+	}
+	return out, errno
+}
+
+func (c *fuseExportClient) open(opcode linux.FUSEOpcode, nodeID uint64) uint64 {
+	c.t.Helper()
+	payload, errno := c.call(opcode, nodeID, &linux.FUSEOpenIn{Flags: unix.O_RDONLY})
+	if errno != 0 {
+		c.t.Fatalf("opcode %d on node %d: %v", opcode, nodeID, errno)
+	}
+	var out linux.FUSEOpenOut
+	out.UnmarshalBytes(payload)
+	return out.Fh
+}
+
+func TestFUSEExport(t *testing.T) {
+	if err := OpenProcSelfFD(); err != nil {
+		t.Fatalf("OpenProcSelfFD(): %v", err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("written by the sandbox"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc/passwd", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	rootFD, err := unix.Open(dir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(fds[0])
+	e, err := NewFUSEExport(fds[1], rootFD)
+	if err != nil {
+		t.Fatalf("NewFUSEExport(): %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- e.Serve() }()
+	c := &fuseExportClient{t: t, fd: fds[0]}
+
+	payload, errno := c.call(linux.FUSE_INIT, 0, &linux.FUSEInitIn{Major: 7, Minor: 31, MaxReadahead: 4096})
+	if errno != 0 {
+		t.Fatalf("FUSE_INIT: %v", errno)
+	}
+	var initOut linux.FUSEInitOut
+	initOut.UnmarshalBytes(payload)
+	if initOut.Major != linux.FUSE_KERNEL_VERSION || initOut.MaxReadahead != 4096 {
+		t.Errorf("FUSE_INIT reply: %+v", initOut)
+	}
+
+	// Read a file.
+	file, errno := c.lookup(linux.FUSE_ROOT_ID, "file")
+	if errno != 0 {
+		t.Fatalf("lookup(file): %v", errno)
+	}
+	if file.Attr.Mode != unix.S_IFREG|0644 || file.Attr.Size != 22 {
+		t.Errorf("lookup(file) attributes: %+v", file.Attr)
+	}
+	if again, _ := c.lookup(linux.FUSE_ROOT_ID, "file"); again.NodeID != file.NodeID {
+		t.Errorf("second lookup(file) got node %d, want %d", again.NodeID, file.NodeID)
+	}
+	fh := c.open(linux.FUSE_OPEN, file.NodeID)
+	payload, errno = c.call(linux.FUSE_READ, 0, &linux.FUSEReadIn{Fh: fh, Offset: 11, Size: 100})
+	if errno != 0 || string(payload) != "the sandbox" {
+		t.Errorf("FUSE_READ = %q, %v, want %q", payload, errno, "the sandbox")
+	}
+	if _, errno := c.call(linux.FUSE_RELEASE, file.NodeID, &linux.FUSEReleaseIn{Fh: fh}); errno != 0 {
+		t.Errorf("FUSE_RELEASE: %v", errno)
+	}
+	if _, errno := c.call(linux.FUSE_READ, 0, &linux.FUSEReadIn{Fh: fh, Size: 100}); errno != unix.EBADF {
+		t.Errorf("FUSE_READ after release: %v, want EBADF", errno)
+	}
+
+	// Symlinks are read, not followed.
+	link, errno := c.lookup(linux.FUSE_ROOT_ID, "link")
+	if errno != 0 || link.Attr.Mode&unix.S_IFMT != unix.S_IFLNK {
+		t.Fatalf("lookup(link) = %+v, %v", link.Attr, errno)
+	}
+	if payload, errno := c.call(linux.FUSE_READLINK, link.NodeID, nil); errno != 0 || string(payload) != "/etc/passwd" {
+		t.Errorf("FUSE_READLINK = %q, %v", payload, errno)
+	}
+
+	// List the root directory.
+	dh := c.open(linux.FUSE_OPENDIR, linux.FUSE_ROOT_ID)
+	var names []string
+	for off := uint64(0); ; {
+		payload, errno := c.call(linux.FUSE_READDIR, linux.FUSE_ROOT_ID, &linux.FUSEReadIn{Fh: dh, Offset: off, Size: 64})
+		if errno != 0 {
+			t.Fatalf("FUSE_READDIR: %v", errno)
+		}
+		if len(payload) == 0 {
+			break
+		}
+		var dirents linux.FUSEDirents
+		dirents.UnmarshalBytes(payload)
+		for _, d := range dirents.Dirents {
+			names = append(names, d.Name)
+			off = d.Meta.Off
+		}
+	}
+	slices.Sort(names)
+	if got, want := names, []string{"dir", "file", "link"}; !slices.Equal(got, want) {
+		t.Errorf("FUSE_READDIR names = %v, want %v", got, want)
+	}
+	c.call(linux.FUSE_RELEASEDIR, linux.FUSE_ROOT_ID, &linux.FUSEReleaseIn{Fh: dh})
+
+	// Nothing escapes the root or modifies it.
+	if _, errno := c.lookup(linux.FUSE_ROOT_ID, ".."); errno != unix.ENOENT {
+		t.Errorf("lookup(..): %v, want ENOENT", errno)
+	}
+	if _, errno := c.lookup(linux.FUSE_ROOT_ID, "dir/../../"); errno != unix.ENOENT {
+		t.Errorf("lookup(dir/../../): %v, want ENOENT", errno)
+	}
+	if _, errno := c.call(linux.FUSE_OPEN, file.NodeID, &linux.FUSEOpenIn{Flags: unix.O_RDWR}); errno != unix.EROFS {
+		t.Errorf("FUSE_OPEN(O_RDWR): %v, want EROFS", errno)
+	}
+	if _, errno := c.call(linux.FUSE_UNLINK, linux.FUSE_ROOT_ID, nil); errno != unix.EROFS {
+		t.Errorf("FUSE_UNLINK: %v, want EROFS", errno)
+	}
+
+	// Nodes are released once all lookups are forgotten.
+	nlookup := primitive.Uint64(2)
+	c.call(linux.FUSE_FORGET, file.NodeID, &nlookup)
+	if _, errno := c.call(linux.FUSE_GETATTR, file.NodeID, &linux.FUSEGetAttrIn{}); errno != unix.ESTALE {
+		t.Errorf("FUSE_GETATTR after forget: %v, want ESTALE", errno)
+	}
+	if _, errno := c.call(linux.FUSE_GETATTR, linux.FUSE_ROOT_ID, &linux.FUSEGetAttrIn{}); errno != 0 {
+		t.Errorf("FUSE_GETATTR(root): %v", errno)
+	}
+
+	c.call(linux.FUSE_DESTROY, 0, nil)
+	if err := <-done; err != nil {
+		t.Errorf("Serve(): %v", err)
+	}
+}
@@ -63,6 +63,21 @@ type Config struct {
 	// DonateMountPointFD indicates whether a host FD to the mount point should
 	// be donated to the client on Mount RPC.
 	DonateMountPointFD bool
+
+	// MaxChannels is the maximum number of channels per mount, each of which
+	// is served by a separate goroutine. If zero, a default is used.
+	MaxChannels int
+
+	// MaxConcurrentRequests is the maximum number of RPCs handled
+	// concurrently per mount. If zero, it is not limited.
+	MaxConcurrentRequests int
+
+	// MountPointFDs optionally maps mount paths to host FDs for the mount
+	// points. If a mount path is present, the Mount RPC reopens its FD instead
+	// of opening the mount path, which allows serving mounts that aren't
+	// reachable from the server's root. The server doesn't take ownership of
+	// the FDs.
+	MountPointFDs map[string]int
 }
 
 var procSelfFD *rwfd.FD
@@ -90,9 +105,11 @@ var _ lisafs.ServerImpl = (*LisafsServer)(nil)
 func NewLisafsServer(config Config) *LisafsServer {
 	s := &LisafsServer{config: config}
 	s.Server.Init(s, lisafs.ServerOpts{
-		WalkStatSupported: true,
-		SetAttrOnDeleted:  true,
-		AllocateOnDeleted: true,
+		WalkStatSupported:     true,
+		SetAttrOnDeleted:      true,
+		AllocateOnDeleted:     true,
+		MaxChannels:           config.MaxChannels,
+		MaxConcurrentRequests: config.MaxConcurrentRequests,
 	})
 	return s
 }
@@ -101,6 +118,9 @@ func NewLisafsServer(config Config) *LisafsServer {
 func (s *LisafsServer) Mount(c *lisafs.Connection, mountNode *lisafs.Node) (*lisafs.ControlFD, linux.Statx, int, error) {
 	mountPath := mountNode.FilePath()
 	rootHostFD, err := tryOpen(func(flags int) (int, error) {
+		if fd, ok := s.config.MountPointFDs[mountPath]; ok {
+			return unix.Openat(int(procSelfFD.FD()), strconv.Itoa(fd), flags&^unix.O_NOFOLLOW, 0)
+		}
 		return unix.Open(mountPath, flags, 0)
 	})
 	if err != nil {
@@ -177,6 +197,9 @@ func (s *LisafsServer) SupportedMessages() []lisafs.MID {
 		lisafs.BindAt,
 		lisafs.Listen,
 		lisafs.Accept,
+		lisafs.FSyncRange,
+		lisafs.FSetWriteHint,
+		lisafs.ReadDirFiles,
 	}
 }
 
@@ -919,6 +942,81 @@ func (fd *controlFDLisa) RemoveXattr(name string) error {
 	return unix.EOPNOTSUPP
 }
 
+// ReadDirFiles implements lisafs.ControlFDImpl.ReadDirFiles.
+func (fd *controlFDLisa) ReadDirFiles(maxFileSize uint32, recordFile func(lisafs.PackedFile) bool) error {
+	// Use a new directory FD, so that ReadDirFiles doesn't race with other
+	// users of fd.hostFD's file offset.
+	dirFD, err := unix.Openat(int(procSelfFD.FD()), strconv.Itoa(fd.hostFD), unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(dirFD)
+
+	var direntsBuf [8192]byte
+	for {
+		n, err := unix.Getdents(dirFD, direntsBuf[:])
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			return nil
+		}
+		full := false
+		fsutil.ParseDirents(direntsBuf[:n], func(ino uint64, off int64, ftype uint8, name string, reclen uint16) {
+			if full || (ftype != unix.DT_REG && ftype != unix.DT_UNKNOWN) {
+				return
+			}
+			f, ok := readSmallFile(dirFD, name, maxFileSize)
+			if !ok {
+				return
+			}
+			full = !recordFile(f)
+		})
+		if full {
+			return nil
+		}
+	}
+}
+
+// readSmallFile reads the regular file name in dirFD if it is at most
+// maxFileSize bytes long.
+func readSmallFile(dirFD int, name string, maxFileSize uint32) (lisafs.PackedFile, bool) {
+	fileFD, err := unix.Openat(dirFD, name, unix.O_RDONLY|unix.O_NONBLOCK|openFlags, 0)
+	if err != nil {
+		return lisafs.PackedFile{}, false
+	}
+	defer unix.Close(fileFD)
+	stat, err := fstatTo(fileFD)
+	if err != nil || stat.Mode&unix.S_IFMT != unix.S_IFREG || stat.Size > uint64(maxFileSize) {
+		return lisafs.PackedFile{}, false
+	}
+	// Read one more byte than expected to detect files that grew after fstat.
+	data := make([]byte, stat.Size+1)
+	var read int
+	for read < len(data) {
+		n, err := unix.Pread(fileFD, data[read:], int64(read))
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return lisafs.PackedFile{}, false
+		}
+		if n == 0 {
+			break
+		}
+		read += n
+	}
+	if uint64(read) != stat.Size {
+		// The file changed while being read.
+		return lisafs.PackedFile{}, false
+	}
+	return lisafs.PackedFile{
+		Stat: stat,
+		Name: lisafs.SizedString(name),
+		Data: data[:read],
+	}, true
+}
+
 // openFDLisa implements lisafs.OpenFDImpl.
 type openFDLisa struct {
 	lisafs.OpenFD
@@ -985,6 +1083,16 @@ func (fd *openFDLisa) Allocate(mode, off, length uint64) error {
 	return unix.Fallocate(fd.hostFD, uint32(mode), int64(off), int64(length))
 }
 
+// SyncRange implements lisafs.OpenFDImpl.SyncRange.
+func (fd *openFDLisa) SyncRange(off, length uint64, flags uint32) error {
+	return unix.SyncFileRange(fd.hostFD, int64(off), int64(length), int(flags))
+}
+
+// SetWriteHint implements lisafs.OpenFDImpl.SetWriteHint.
+func (fd *openFDLisa) SetWriteHint(hint uint64) error {
+	return fsutil.SetWriteHint(fd.hostFD, hint)
+}
+
 // Flush implements lisafs.OpenFDImpl.Flush.
 func (fd *openFDLisa) Flush() error {
 	return nil
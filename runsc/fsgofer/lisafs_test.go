@@ -15,11 +15,16 @@
 package lisafs_test
 
 import (
+	"fmt"
 	"testing"
 
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/lisafs"
 	"gvisor.dev/gvisor/pkg/lisafs/testsuite"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/unet"
 	"gvisor.dev/gvisor/runsc/config"
 	"gvisor.dev/gvisor/runsc/fsgofer"
 )
@@ -55,3 +60,87 @@ func (tester) SetUserGroupIDSupported() bool {
 func TestFSGofer(t *testing.T) {
 	testsuite.RunAllLocalFSTests(t, tester{})
 }
+
+// BenchmarkParallelRead measures the throughput of 4KiB reads of a file
+// through the gofer from an increasing number of concurrent streams, with the
+// default number of channels and with one channel per stream.
+func BenchmarkParallelRead(b *testing.B) {
+	const (
+		readSize = 4096
+		fileSize = 1 << 20
+	)
+	// Don't log every RPC.
+	log.SetLevel(log.Info)
+	defer log.SetLevel(log.Debug)
+
+	for _, channels := range []int{0, 32} {
+		for _, streams := range []int{1, 2, 4, 8, 16, 32} {
+			b.Run(fmt.Sprintf("channels.%d/streams.%d", channels, streams), func(b *testing.B) {
+				serverSocket, clientSocket, err := unet.SocketPair(false)
+				if err != nil {
+					b.Fatalf("socketpair failed: %v", err)
+				}
+				server := fsgofer.NewLisafsServer(fsgofer.Config{
+					HostUDS:     config.HostUDSCreate,
+					MaxChannels: channels,
+				})
+				conn, err := server.CreateConnection(serverSocket, b.TempDir(), false /* readonly */)
+				if err != nil {
+					b.Fatalf("CreateConnection failed: %v", err)
+				}
+				server.StartConnection(conn)
+				defer func() {
+					server.Wait()
+					server.Destroy()
+				}()
+
+				c, root, _, err := lisafs.NewClient(clientSocket)
+				if err != nil {
+					b.Fatalf("NewClient failed: %v", err)
+				}
+				defer c.Close()
+				if err := c.StartChannels(channels); err != nil {
+					b.Fatalf("StartChannels failed: %v", err)
+				}
+
+				ctx := context.Background()
+				rootFD := c.NewFD(root.ControlFD)
+				defer rootFD.Close(ctx, true /* flush */)
+				child, openFDID, hostFD, err := rootFD.OpenCreateAt(ctx, "file", unix.O_RDWR, 0644, lisafs.UID(unix.Getuid()), lisafs.GID(unix.Getgid()))
+				if err != nil {
+					b.Fatalf("OpenCreateAt failed: %v", err)
+				}
+				if hostFD >= 0 {
+					unix.Close(hostFD)
+				}
+				controlFD := c.NewFD(child.ControlFD)
+				defer controlFD.Close(ctx, true /* flush */)
+				fd := c.NewFD(openFDID)
+				defer fd.Close(ctx, true /* flush */)
+				if _, err := fd.Write(ctx, make([]byte, fileSize), 0); err != nil {
+					b.Fatalf("Write failed: %v", err)
+				}
+
+				b.SetBytes(readSize)
+				b.ResetTimer()
+				var wg sync.WaitGroup
+				for i := 0; i < streams; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						buf := make([]byte, readSize)
+						for j := i; j < b.N; j += streams {
+							off := uint64(j*readSize) % fileSize
+							if _, err := fd.Read(ctx, buf, off); err != nil {
+								b.Errorf("Read failed: %v", err)
+								return
+							}
+						}
+					}(i)
+				}
+				wg.Wait()
+				b.StopTimer()
+			})
+		}
+	}
+}
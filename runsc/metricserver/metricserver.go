@@ -903,6 +903,7 @@ func (s *Server) Run(ctx context.Context) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/runsc-metrics/healthcheck", logRequest(m.serveHealthCheck))
 	mux.HandleFunc("/runsc-metrics/pid", logRequest(m.servePID))
+	mux.HandleFunc("/runsc-metrics/sandbox-health", logRequest(m.serveSandboxHealth))
 	if m.exposeProfileEndpoints {
 		log.Warningf("Profiling HTTP endpoints are exposed; this should only be used for development!")
 		mux.HandleFunc("/runsc-metrics/profile-cpu", logRequest(m.profileCPU))
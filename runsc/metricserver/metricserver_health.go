@@ -0,0 +1,153 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metricserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/runsc/boot"
+	"gvisor.dev/gvisor/runsc/sandbox"
+)
+
+// healthRPCSlack is the time on top of the sentry-side health check timeout
+// that we wait for a sandbox to answer a health check.
+const healthRPCSlack = 2 * time.Second
+
+// sandboxHealth is the health of a single sandbox, as served over HTTP.
+type sandboxHealth struct {
+	// ID is the sandbox ID.
+	ID string `json:"id"`
+
+	// Healthy is true if the sandbox is running and all its health checks
+	// passed.
+	Healthy bool `json:"healthy"`
+
+	// Error is set if the health checks could not be run.
+	Error string `json:"error,omitempty"`
+
+	// Checks are the outcomes of the sandbox's health checks.
+	Checks []boot.HealthCheckResult `json:"checks,omitempty"`
+}
+
+// querySandboxHealth runs the health checks of a sandbox, giving up once ctx
+// is done.
+func querySandboxHealth(ctx context.Context, sand *sandbox.Sandbox) (*boot.HealthReport, error) {
+	type result struct {
+		report *boot.HealthReport
+		err    error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		report, err := sand.Health(boot.DefaultHealthTimeout)
+		ch <- result{report, err}
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-ch:
+		return r.report, r.err
+	}
+}
+
+// serveSandboxHealth serves the health of all sandboxes, or of the one whose
+// ID is passed as the "sandbox" query parameter, as JSON. It returns HTTP 503
+// if any of them is unhealthy, so that node agents can detect wedged sandboxes
+// without parsing the response.
+func (m *metricServer) serveSandboxHealth(w http.ResponseWriter, req *http.Request) httpResult {
+	ctx, ctxCancel := context.WithTimeout(req.Context(), metricsExportTimeout)
+	defer ctxCancel()
+	sandboxID := req.URL.Query().Get("sandbox")
+
+	m.mu.Lock()
+	if m.shuttingDown {
+		m.mu.Unlock()
+		return httpResult{http.StatusServiceUnavailable, errors.New("server is shutting down")}
+	}
+	var loadedSandboxes []sandboxLoadResult
+	for _, s := range m.loadSandboxesLocked(ctx) {
+		if sandboxID == "" || s.served.rootContainerID.SandboxID == sandboxID {
+			loadedSandboxes = append(loadedSandboxes, s)
+		}
+	}
+	m.mu.Unlock()
+	if sandboxID != "" && len(loadedSandboxes) == 0 {
+		return httpResult{http.StatusNotFound, fmt.Errorf("sandbox %q not found", sandboxID)}
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	results := make([]sandboxHealth, 0, len(loadedSandboxes))
+	ch := make(chan sandboxLoadResult, len(loadedSandboxes))
+	for _, s := range loadedSandboxes {
+		ch <- s
+	}
+	close(ch)
+	numGoroutines := min(exportParallelGoroutines, len(loadedSandboxes))
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			for s := range ch {
+				h := sandboxHealth{ID: s.served.rootContainerID.SandboxID}
+				switch {
+				case s.err != nil:
+					h.Error = s.err.Error()
+				case !s.sandbox.IsRunning():
+					h.Error = "sandbox is not running"
+				default:
+					queryCtx, queryCtxCancel := context.WithTimeout(ctx, boot.DefaultHealthTimeout+healthRPCSlack)
+					report, err := querySandboxHealth(queryCtx, s.sandbox)
+					queryCtxCancel()
+					if err != nil {
+						h.Error = err.Error()
+					} else {
+						h.Healthy = report.Healthy
+						h.Checks = report.Checks
+					}
+				}
+				mu.Lock()
+				results = append(results, h)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].ID < results[j].ID })
+	code := http.StatusOK
+	for _, h := range results {
+		if !h.Healthy {
+			code = http.StatusServiceUnavailable
+			break
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	// We cannot return an error here, because we've already sent the HTTP
+	// status.
+	encoder.Encode(results)
+	return httpOK
+}
@@ -22,6 +22,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/vishvananda/netlink"
@@ -51,7 +52,7 @@ import (
 // Run the following container to test it:
 //
 //	docker run -di --runtime=runsc -p 8080:80 -v $PWD:/usr/local/apache2/htdocs/ httpd:2.4
-func setupNetwork(conn *urpc.Client, pid int, conf *config.Config) error {
+func setupNetwork(conn *urpc.Client, pid int, spec *specs.Spec, conf *config.Config) error {
 	log.Infof("Setting up network")
 
 	switch conf.Network {
@@ -67,11 +68,17 @@ func setupNetwork(conn *urpc.Client, pid int, conf *config.Config) error {
 		if err := createInterfacesAndRoutesFromNS(conn, nsPath, conf); err != nil {
 			return fmt.Errorf("creating interfaces from net namespace %q: %v", nsPath, err)
 		}
-	case config.NetworkHost:
+	case config.NetworkHost, config.NetworkHybrid:
 		// Nothing to do here.
+		return nil
 	default:
 		return fmt.Errorf("invalid network type: %v", conf.Network)
 	}
+	if specutils.VFIOFunctionalityRequested(spec, conf) {
+		if err := createVFLinks(conn, spec); err != nil {
+			return fmt.Errorf("creating SR-IOV virtual function links: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -86,6 +93,178 @@ func createDefaultLoopbackInterface(conf *config.Config, conn *urpc.Client) erro
 	return nil
 }
 
+// createVFLinks creates links for the SR-IOV virtual functions that are passed
+// through to the sandbox with vfioproxy, so that they are visible in netlink.
+// Virtual functions are bound to vfio-pci and have no network device on the
+// host, so their MAC address is taken from their physical function.
+func createVFLinks(conn *urpc.Client, spec *specs.Spec) error {
+	var args boot.CreateVFLinksArgs
+	for _, dev := range specutils.VFIOGroupDevices(spec) {
+		group, _ := specutils.VFIOGroupName(dev.Path)
+		links, err := vfLinks(group)
+		if err != nil {
+			// The virtual functions are still usable through vfio.
+			log.Warningf("Failed to find SR-IOV virtual functions in IOMMU group %s: %v", group, err)
+			continue
+		}
+		args.Links = append(args.Links, links...)
+	}
+	if len(args.Links) == 0 {
+		return nil
+	}
+	log.Infof("Creating SR-IOV virtual function links: %+v", args.Links)
+	return conn.Call(boot.NetworkCreateVFLinks, &args, nil)
+}
+
+// vfLinks returns the links of the SR-IOV virtual functions of network devices
+// in the given IOMMU group. Other devices in the group are skipped.
+func vfLinks(group string) ([]boot.VFLink, error) {
+	devsPath := filepath.Join("/sys/kernel/iommu_groups", group, "devices")
+	devs, err := os.ReadDir(devsPath)
+	if err != nil {
+		return nil, err
+	}
+	var links []boot.VFLink
+	for _, dev := range devs {
+		devPath, err := filepath.EvalSymlinks(filepath.Join(devsPath, dev.Name()))
+		if err != nil {
+			return nil, err
+		}
+		pfPath, err := filepath.EvalSymlinks(filepath.Join(devPath, "physfn"))
+		if os.IsNotExist(err) {
+			// Not a virtual function.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		pfNets, err := os.ReadDir(filepath.Join(pfPath, "net"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if len(pfNets) == 0 {
+			// Not a network device.
+			continue
+		}
+		pf, err := netlink.LinkByName(pfNets[0].Name())
+		if err != nil {
+			return nil, fmt.Errorf("getting physical function link %q: %w", pfNets[0].Name(), err)
+		}
+		vf, err := vfIndex(pfPath, devPath)
+		if err != nil {
+			return nil, err
+		}
+		link := boot.VFLink{
+			Name: fmt.Sprintf("%sv%d", pf.Attrs().Name, vf),
+			MTU:  pf.Attrs().MTU,
+		}
+		for _, info := range pf.Attrs().Vfs {
+			if info.ID == vf {
+				link.LinkAddress = info.Mac
+			}
+		}
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+// vfIndex returns the index of the virtual function at devPath among the
+// virtual functions of the physical function at pfPath.
+func vfIndex(pfPath, devPath string) (int, error) {
+	virtfns, err := filepath.Glob(filepath.Join(pfPath, "virtfn*"))
+	if err != nil {
+		return 0, err
+	}
+	for _, virtfn := range virtfns {
+		if p, err := filepath.EvalSymlinks(virtfn); err != nil || p != devPath {
+			continue
+		}
+		return strconv.Atoi(strings.TrimPrefix(filepath.Base(virtfn), "virtfn"))
+	}
+	return 0, fmt.Errorf("virtual function %q not found in physical function %q", devPath, pfPath)
+}
+
+// updateLink changes the configuration of a link in the sandbox from cur to
+// want. If the number of channels changes, new sockets are created for the
+// link in the net namespace of the sandbox process. The MTU of the device that
+// the link is backed by is changed as well.
+func updateLink(conn *urpc.Client, pid int, conf *config.Config, cur, want boot.LinkConfig) error {
+	args := boot.UpdateLinkArgs{LinkConfig: want}
+	if want.MTU != cur.MTU || want.NumChannels != cur.NumChannels {
+		nsPath := filepath.Join("/proc", strconv.Itoa(pid), "ns/net")
+		restoreNS, err := joinNetNS(nsPath)
+		if err != nil {
+			return err
+		}
+		defer restoreNS()
+
+		iface, err := net.InterfaceByName(want.Name)
+		if err != nil {
+			return fmt.Errorf("getting interface %q: %w", want.Name, err)
+		}
+		ifaceLink, err := netlink.LinkByName(want.Name)
+		if err != nil {
+			return fmt.Errorf("getting link for interface %q: %w", want.Name, err)
+		}
+		if want.MTU != cur.MTU {
+			if err := netlink.LinkSetMTU(ifaceLink, want.MTU); err != nil {
+				return fmt.Errorf("setting MTU of interface %q: %w", want.Name, err)
+			}
+		}
+		if want.NumChannels != cur.NumChannels {
+			for i := 0; i < want.NumChannels; i++ {
+				socketEntry, err := createSocket(*iface, ifaceLink, conf.HostGSO)
+				if err != nil {
+					return fmt.Errorf("failed to createSocket for %s : %w", want.Name, err)
+				}
+				defer socketEntry.deviceFile.Close()
+				args.FilePayload.Files = append(args.FilePayload.Files, socketEntry.deviceFile)
+			}
+		}
+	}
+	if err := conn.Call(boot.NetworkUpdateLink, &args, nil); err != nil {
+		return fmt.Errorf("updating link %q: %w", want.Name, err)
+	}
+	return nil
+}
+
+// restoreLinks applies the link configuration saved in the checkpoint that
+// the sandbox was restored from to the links created for the restored sandbox.
+// Links that no longer exist are skipped.
+func restoreLinks(conn *urpc.Client, pid int, conf *config.Config) error {
+	if conf.Network != config.NetworkSandbox || conf.XDP.Mode != config.XDPModeOff {
+		return nil
+	}
+	var restored, links []boot.LinkConfig
+	if err := conn.Call(boot.NetworkRestoredLinks, nil, &restored); err != nil {
+		return err
+	}
+	if len(restored) == 0 {
+		return nil
+	}
+	if err := conn.Call(boot.NetworkLinks, nil, &links); err != nil {
+		return err
+	}
+	cur := make(map[string]boot.LinkConfig, len(links))
+	for _, link := range links {
+		cur[link.Name] = link
+	}
+	for _, want := range restored {
+		link, ok := cur[want.Name]
+		if !ok {
+			log.Warningf("Network link %q from the checkpoint doesn't exist, skipping", want.Name)
+			continue
+		}
+		if link == want {
+			continue
+		}
+		log.Infof("Restoring network link %q configuration to %+v", want.Name, want)
+		if err := updateLink(conn, pid, conf, link, want); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func joinNetNS(nsPath string) (func(), error) {
 	runtime.LockOSThread()
 	restoreNS, err := specutils.ApplyNS(specs.LinuxNamespace{
@@ -189,10 +368,16 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 			}
 			ipAddrs = append(ipAddrs, ipNet)
 		}
-		if len(ipAddrs) == 0 {
+		ipv6Autoconf := conf.GetIPv6Autoconf(iface.Name)
+		if len(ipAddrs) == 0 && ipv6Autoconf == config.IPv6AutoconfNone {
 			log.Warningf("No usable IP addresses found for interface %q, skipping", iface.Name)
 			continue
 		}
+		if ipv6Autoconf != config.IPv6AutoconfNone {
+			// The sandbox autoconfigures the interface from now on, so the
+			// host must stop adding addresses and routes to it.
+			disableAcceptRA(iface.Name)
+		}
 
 		// Collect data from the ARP table.
 		dump, err := netlink.NeighList(iface.Index, 0)
@@ -291,6 +476,7 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 				Neighbors:         neighbors,
 				LinkAddress:       linkAddress,
 				Addresses:         addresses,
+				IPv6Autoconf:      ipv6Autoconf,
 			}
 
 			log.Debugf("Setting up network channels")
@@ -365,6 +551,16 @@ type socketEntry struct {
 // createSocket creates an underlying AF_PACKET socket and configures it for
 // use by the sentry and returns an *os.File that wraps the underlying socket
 // fd.
+// disableAcceptRA stops the host from processing Router Advertisements
+// received on the named interface. Errors are only logged, since the host may
+// not have IPv6 enabled.
+func disableAcceptRA(name string) {
+	path := filepath.Join("/proc/sys/net/ipv6/conf", name, "accept_ra")
+	if err := os.WriteFile(path, []byte("0"), 0); err != nil {
+		log.Warningf("Failed to disable accept_ra on interface %q: %v", name, err)
+	}
+}
+
 func createSocket(iface net.Interface, ifaceLink netlink.Link, enableGSO bool) (*socketEntry, error) {
 	// Create the socket.
 	const protocol = 0x0300                                  // htons(ETH_P_ALL)
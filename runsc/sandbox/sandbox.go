@@ -25,6 +25,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"syscall"
@@ -46,6 +47,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/control"
 	"gvisor.dev/gvisor/pkg/sentry/devices/nvproxy"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/erofs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 	"gvisor.dev/gvisor/pkg/sentry/seccheck"
 	"gvisor.dev/gvisor/pkg/state/statefile"
@@ -171,6 +173,13 @@ type Sandbox struct {
 	// configuration information about the sandbox.
 	MetricMetadata map[string]string `json:"metricMetadata"`
 
+	// Config is the value of every runsc flag the sandbox was started with,
+	// after applying the config file, profile, bundles and flag annotations.
+	Config config.Bundle `json:"config"`
+
+	// Profile is the config file profile selected by the pod, if any.
+	Profile string `json:"profile"`
+
 	// MetricServerAddress is the address of the metric server that this sandbox
 	// intends to export metrics for.
 	// Only populated if exporting metrics was requested when the sandbox was
@@ -229,6 +238,11 @@ type Args struct {
 	// same order as mounts appear in the spec.
 	IOFiles []*os.File
 
+	// MountPointFiles are the host files for the mount points served by the
+	// sandbox itself in single-process mode. They must be in the same order as
+	// IOFiles would be.
+	MountPointFiles []*os.File
+
 	// File that connects to a gofer endpoint for a device mount point at /dev.
 	DevIOFile *os.File
 
@@ -280,12 +294,14 @@ func New(conf *config.Config, args *Args) (*Sandbox, error) {
 		UID:                 -1, // prevent usage before it's set.
 		GID:                 -1, // prevent usage before it's set.
 		MetricMetadata:      conf.MetricMetadata(),
+		Config:              conf.ToBundle(),
 		MetricServerAddress: conf.MetricServer,
 		MountHints:          args.MountHints,
 	}
 	if args.Spec != nil && args.Spec.Annotations != nil {
 		s.PodName = args.Spec.Annotations[podNameAnnotation]
 		s.Namespace = args.Spec.Annotations[namespaceAnnotation]
+		s.Profile = args.Spec.Annotations[config.ProfileAnnotation]
 	}
 
 	// The Cleanup object cleans up partially created sandboxes when an error
@@ -380,7 +396,7 @@ func (s *Sandbox) CreateSubcontainer(conf *config.Config, cid string, tty *os.Fi
 }
 
 // StartRoot starts running the root container process inside the sandbox.
-func (s *Sandbox) StartRoot(conf *config.Config) error {
+func (s *Sandbox) StartRoot(spec *specs.Spec, conf *config.Config) error {
 	pid := s.Pid.load()
 	log.Debugf("Start root sandbox %q, PID: %d", s.ID, pid)
 	conn, err := s.sandboxConnect()
@@ -390,7 +406,7 @@ func (s *Sandbox) StartRoot(conf *config.Config) error {
 	defer conn.Close()
 
 	// Configure the network.
-	if err := setupNetwork(conn, pid, conf); err != nil {
+	if err := setupNetwork(conn, pid, spec, conf); err != nil {
 		return fmt.Errorf("setting up network: %w", err)
 	}
 
@@ -406,6 +422,15 @@ func (s *Sandbox) StartRoot(conf *config.Config) error {
 func (s *Sandbox) StartSubcontainer(spec *specs.Spec, conf *config.Config, cid string, stdios, goferFiles, goferFilestores []*os.File, devIOFile *os.File, goferConfs []boot.GoferMountConf) error {
 	log.Debugf("Start sub-container %q in sandbox %q, PID: %d", cid, s.ID, s.Pid.load())
 
+	if conf.StdioLog != "" && len(stdios) == 3 {
+		stdout, stderr, err := startStdioLogger(conf, cid, stdios[1], stdios[2])
+		if err != nil {
+			return err
+		}
+		defer stdout.Close()
+		defer stderr.Close()
+		stdios = []*os.File{stdios[0], stdout, stderr}
+	}
 	if err := s.configureStdios(conf, stdios); err != nil {
 		return err
 	}
@@ -440,21 +465,33 @@ func (s *Sandbox) StartSubcontainer(spec *specs.Spec, conf *config.Config, cid s
 	return nil
 }
 
-// Restore sends the restore call for a container in the sandbox.
-func (s *Sandbox) Restore(conf *config.Config, cid string, filename string) error {
-	log.Debugf("Restore sandbox %q", s.ID)
+// RestoreOpts contains optional arguments of Restore.
+type RestoreOpts struct {
+	// Key is used for the state file's integrity check.
+	Key []byte
 
-	rf, err := os.Open(filename)
-	if err != nil {
-		return fmt.Errorf("opening restore file %q failed: %v", filename, err)
-	}
-	defer rf.Close()
+	// Precopied, if not nil, contains the memory pre-copied ahead of a
+	// checkpoint taken by CheckpointPrecopied, as written by
+	// pgalloc.ReadPrecopyRound.
+	Precopied *os.File
+}
+
+// Restore sends the restore call for a container in the sandbox. The caller
+// retains ownership of rf and of the files in opts, and must close them
+// whether or not Restore succeeds.
+func (s *Sandbox) Restore(spec *specs.Spec, conf *config.Config, cid string, rf *os.File, opts RestoreOpts) error {
+	log.Debugf("Restore sandbox %q", s.ID)
 
 	opt := boot.RestoreOpts{
 		FilePayload: urpc.FilePayload{
 			Files: []*os.File{rf},
 		},
 		SandboxID: s.ID,
+		Key:       opts.Key,
+	}
+	if opts.Precopied != nil {
+		opt.Precopied = true
+		opt.FilePayload.Files = append(opt.FilePayload.Files, opts.Precopied)
 	}
 
 	// If the platform needs a device FD we must pass it in.
@@ -472,7 +509,7 @@ func (s *Sandbox) Restore(conf *config.Config, cid string, filename string) erro
 	defer conn.Close()
 
 	// Configure the network.
-	if err := setupNetwork(conn, s.Pid.load(), conf); err != nil {
+	if err := setupNetwork(conn, s.Pid.load(), spec, conf); err != nil {
 		return fmt.Errorf("setting up network: %v", err)
 	}
 
@@ -481,9 +518,47 @@ func (s *Sandbox) Restore(conf *config.Config, cid string, filename string) erro
 		return fmt.Errorf("restoring container %q: %v", cid, err)
 	}
 
+	// Apply the link configuration from the checkpoint, which may have been
+	// changed at runtime.
+	if err := restoreLinks(conn, s.Pid.load(), conf); err != nil {
+		return fmt.Errorf("restoring network links: %v", err)
+	}
+
 	return nil
 }
 
+// Links returns the configuration of the sandbox's fd-based network links.
+func (s *Sandbox) Links() ([]boot.LinkConfig, error) {
+	log.Debugf("Getting network links of sandbox %q", s.ID)
+	var links []boot.LinkConfig
+	if err := s.call(boot.NetworkLinks, nil, &links); err != nil {
+		return nil, fmt.Errorf("getting network links of sandbox %q: %w", s.ID, err)
+	}
+	return links, nil
+}
+
+// UpdateLink changes the configuration of one of the sandbox's fd-based
+// network links.
+func (s *Sandbox) UpdateLink(conf *config.Config, link boot.LinkConfig) error {
+	log.Debugf("Updating network link %q of sandbox %q", link.Name, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var links []boot.LinkConfig
+	if err := conn.Call(boot.NetworkLinks, nil, &links); err != nil {
+		return fmt.Errorf("getting network links of sandbox %q: %w", s.ID, err)
+	}
+	for _, cur := range links {
+		if cur.Name == link.Name {
+			return updateLink(conn, s.Pid.load(), conf, cur, link)
+		}
+	}
+	return fmt.Errorf("network link %q not found in sandbox %q", link.Name, s.ID)
+}
+
 // Processes retrieves the list of processes and associated metadata for a
 // given container in this sandbox.
 func (s *Sandbox) Processes(cid string) ([]*control.Process, error) {
@@ -644,6 +719,25 @@ func (s *Sandbox) connError(err error) error {
 	return fmt.Errorf("connecting to control server at PID %d: %v", s.Pid.load(), err)
 }
 
+// cpuNumFromQuota lowers cpuNum to the CPU quota rounded up, if any.
+func cpuNumFromQuota(cpuNum int, quota float64) int {
+	// Dropping below 2 CPUs can trigger application to disable
+	// locks that can lead do hard to debug errors, so just
+	// leaving two cores as reasonable default.
+	const minCPUs = 2
+
+	if n := int(math.Ceil(quota)); n > 0 {
+		if n < minCPUs {
+			n = minCPUs
+		}
+		if n < cpuNum {
+			// Only lower the cpu number.
+			cpuNum = n
+		}
+	}
+	return cpuNum
+}
+
 // createSandboxProcess starts the sandbox as a subprocess by running the "boot"
 // command, passing in the bundle dir.
 func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyncFile *os.File) error {
@@ -738,6 +832,7 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 
 	// If there is a gofer, sends all socket ends to the sandbox.
 	donations.DonateAndClose("io-fds", args.IOFiles...)
+	donations.DonateAndClose("mount-point-fds", args.MountPointFiles...)
 	donations.DonateAndClose("dev-io-fd", args.DevIOFile)
 	donations.DonateAndClose("gofer-filestore-fds", args.GoferFilestoreFiles...)
 	donations.DonateAndClose("mounts-fd", args.MountsFile)
@@ -761,6 +856,15 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 	if err := donations.OpenAndDonate("trace-fd", conf.TraceFile, profFlags); err != nil {
 		return err
 	}
+	if err := donations.OpenAndDonate("compat-report-fd", conf.CompatReport, os.O_CREATE|os.O_WRONLY|os.O_TRUNC); err != nil {
+		return err
+	}
+	if err := donations.OpenAndDonate("deterministic-record-fd", conf.DeterministicRecord, os.O_CREATE|os.O_WRONLY|os.O_TRUNC); err != nil {
+		return err
+	}
+	if err := donations.OpenAndDonate("deterministic-replay-fd", conf.DeterministicReplay, os.O_RDONLY); err != nil {
+		return err
+	}
 
 	// Pass gofer mount configs.
 	cmd.Args = append(cmd.Args, "--gofer-mount-confs="+args.GoferMountConfs.String())
@@ -783,6 +887,9 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 	if err := donations.OpenAndDonate("pod-init-config-fd", conf.PodInitConfig, os.O_RDONLY); err != nil {
 		return err
 	}
+	if err := donations.OpenAndDonate("egress-proxy-credentials-fd", conf.EgressProxyCredentialsFile, os.O_RDONLY); err != nil {
+		return err
+	}
 	donations.DonateAndClose("sink-fds", args.SinkFiles...)
 
 	gPlatform, err := platform.Lookup(conf.Platform)
@@ -837,7 +944,7 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 	if ns, ok := specutils.GetNS(specs.NetworkNamespace, args.Spec); ok && conf.Network != config.NetworkNone {
 		log.Infof("Sandbox will be started in the container's network namespace: %+v", ns)
 		nss = append(nss, ns)
-	} else if conf.Network == config.NetworkHost {
+	} else if conf.Network.UsesHostNetwork() {
 		log.Infof("Sandbox will be started in the host network namespace")
 	} else {
 		log.Infof("Sandbox will be started in new network namespace")
@@ -855,7 +962,7 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 	// configured.
 	rootlessEUID := unix.Geteuid() != 0
 	setUserMappings := false
-	if conf.Network == config.NetworkHost || conf.DirectFS {
+	if conf.Network.UsesHostNetwork() || conf.DirectFS {
 		if userns, ok := specutils.GetNS(specs.UserNamespace, args.Spec); ok {
 			log.Infof("Sandbox will be started in container's user namespace: %+v", userns)
 			nss = append(nss, userns)
@@ -993,6 +1100,16 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 		stdios[0] = os.Stdin
 		stdios[1] = os.Stdout
 		stdios[2] = os.Stderr
+		if conf.StdioLog != "" {
+			stdout, stderr, err := startStdioLogger(conf, s.ID, os.Stdout, os.Stderr)
+			if err != nil {
+				return err
+			}
+			defer stdout.Close()
+			defer stderr.Close()
+			stdios[1] = stdout
+			stdios[2] = stderr
+		}
 
 		if conf.Debug {
 			// If debugging, send the boot process stdio to the
@@ -1022,24 +1139,11 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 			return fmt.Errorf("getting cpu count from cgroups: %v", err)
 		}
 		if conf.CPUNumFromQuota {
-			// Dropping below 2 CPUs can trigger application to disable
-			// locks that can lead do hard to debug errors, so just
-			// leaving two cores as reasonable default.
-			const minCPUs = 2
-
 			quota, err := s.CgroupJSON.Cgroup.CPUQuota()
 			if err != nil {
 				return fmt.Errorf("getting cpu quota from cgroups: %v", err)
 			}
-			if n := int(math.Ceil(quota)); n > 0 {
-				if n < minCPUs {
-					n = minCPUs
-				}
-				if n < cpuNum {
-					// Only lower the cpu number.
-					cpuNum = n
-				}
-			}
+			cpuNum = cpuNumFromQuota(cpuNum, quota)
 		}
 		cmd.Args = append(cmd.Args, "--cpu-num", strconv.Itoa(cpuNum))
 
@@ -1050,6 +1154,27 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 		if memLimit < mem {
 			mem = memLimit
 		}
+	} else if conf.Cgroupless {
+		// There are no host cgroups to enforce the limits in the spec. The CPU
+		// quota can only be enforced by limiting the number of CPUs, so it
+		// always applies. The sentry enforces the memory limit.
+		var res *specs.LinuxResources
+		if args.Spec.Linux != nil {
+			res = args.Spec.Linux.Resources
+		}
+		cpuNum, err := cgroup.NumCPUFromResources(res)
+		if err != nil {
+			return fmt.Errorf("getting cpu count from spec: %v", err)
+		}
+		if cpuNum == 0 {
+			cpuNum = runtime.NumCPU()
+		}
+		cpuNum = cpuNumFromQuota(cpuNum, cgroup.CPUQuotaFromResources(res))
+		cmd.Args = append(cmd.Args, "--cpu-num", strconv.Itoa(cpuNum))
+
+		if memLimit := cgroup.MemoryLimitFromResources(res); memLimit != 0 && memLimit < mem {
+			mem = memLimit
+		}
 	}
 	cmd.Args = append(cmd.Args, "--total-memory", strconv.FormatUint(mem, 10))
 
@@ -1250,11 +1375,13 @@ func (s *Sandbox) SignalProcess(cid string, pid int32, sig unix.Signal, fgProces
 }
 
 // Checkpoint sends the checkpoint call for a container in the sandbox.
-// The statefile will be written to f.
-func (s *Sandbox) Checkpoint(cid string, f *os.File, options statefile.Options) error {
-	log.Debugf("Checkpoint sandbox %q, options %+v", s.ID, options)
+// The statefile will be written to f. If async is true, the sandbox keeps
+// running and is only paused while its kernel state is saved.
+func (s *Sandbox) Checkpoint(cid string, f *os.File, options statefile.Options, async bool) error {
+	log.Debugf("Checkpoint sandbox %q, options %+v, async %t", s.ID, options, async)
 	opt := control.SaveOpts{
 		Metadata: options.WriteToMetadata(map[string]string{}),
+		Async:    async,
 		FilePayload: urpc.FilePayload{
 			Files: []*os.File{f},
 		},
@@ -1266,6 +1393,54 @@ func (s *Sandbox) Checkpoint(cid string, f *os.File, options statefile.Options)
 	return nil
 }
 
+// Precopy writes a round of the sandbox's memory that has been written to
+// since the last round to f, while the sandbox keeps running. The round is
+// read by pgalloc.ReadPrecopyRound from a statefile opened with key.
+func (s *Sandbox) Precopy(cid string, f *os.File, options statefile.Options, key []byte) (control.PrecopyResult, error) {
+	log.Debugf("Precopy sandbox %q, options %+v", s.ID, options)
+	opt := control.PrecopyOpts{
+		Key:      key,
+		Metadata: options.WriteToMetadata(map[string]string{}),
+		FilePayload: urpc.FilePayload{
+			Files: []*os.File{f},
+		},
+	}
+	var res control.PrecopyResult
+	if err := s.call(boot.ContMgrPrecopy, &opt, &res); err != nil {
+		return control.PrecopyResult{}, fmt.Errorf("pre-copying container %q: %w", cid, err)
+	}
+	return res, nil
+}
+
+// CancelPrecopy ends the pre-copy started by Precopy without checkpointing
+// the sandbox.
+func (s *Sandbox) CancelPrecopy(cid string) error {
+	log.Debugf("CancelPrecopy sandbox %q", s.ID)
+	if err := s.call(boot.ContMgrCancelPrecopy, nil, nil); err != nil {
+		return fmt.Errorf("cancelling pre-copy of container %q: %w", cid, err)
+	}
+	return nil
+}
+
+// CheckpointPrecopied is equivalent to Checkpoint, except that memory written
+// out by Precopy and not written to since is omitted from the checkpoint,
+// which is keyed with key. It ends the pre-copy.
+func (s *Sandbox) CheckpointPrecopied(cid string, f *os.File, options statefile.Options, key []byte) error {
+	log.Debugf("Checkpoint sandbox %q after pre-copy, options %+v", s.ID, options)
+	opt := control.SaveOpts{
+		Key:       key,
+		Metadata:  options.WriteToMetadata(map[string]string{}),
+		Precopied: true,
+		FilePayload: urpc.FilePayload{
+			Files: []*os.File{f},
+		},
+	}
+	if err := s.call(boot.ContMgrCheckpoint, &opt, nil); err != nil {
+		return fmt.Errorf("checkpointing container %q: %w", cid, err)
+	}
+	return nil
+}
+
 // Pause sends the pause call for a container in the sandbox.
 func (s *Sandbox) Pause(cid string) error {
 	log.Debugf("Pause sandbox %q", s.ID)
@@ -1295,6 +1470,47 @@ func (s *Sandbox) Usage(Full bool) (control.MemoryUsage, error) {
 	return m, nil
 }
 
+// CompatReport returns the compatibility report of the sandbox.
+func (s *Sandbox) CompatReport() (*control.CompatReport, error) {
+	log.Debugf("CompatReport sandbox %q", s.ID)
+	var r control.CompatReport
+	if err := s.call(boot.CompatReport, nil, &r); err != nil {
+		return nil, fmt.Errorf("collecting compatibility report: %w", err)
+	}
+	return &r, nil
+}
+
+// Health runs the health checks of the sandbox.
+func (s *Sandbox) Health(timeout time.Duration) (*boot.HealthReport, error) {
+	log.Debugf("Health sandbox %q", s.ID)
+	var r boot.HealthReport
+	if err := s.call(boot.HealthCheck, &boot.HealthArgs{Timeout: timeout}, &r); err != nil {
+		return nil, fmt.Errorf("checking sandbox health: %w", err)
+	}
+	return &r, nil
+}
+
+// CrashReports returns the crash reports of the sandbox.
+func (s *Sandbox) CrashReports() (*control.CrashReports, error) {
+	log.Debugf("CrashReports sandbox %q", s.ID)
+	var r control.CrashReports
+	if err := s.call(boot.CrashReports, nil, &r); err != nil {
+		return nil, fmt.Errorf("collecting crash reports: %w", err)
+	}
+	return &r, nil
+}
+
+// TimeSyncState returns the time synchronization and entropy state of the
+// sandbox.
+func (s *Sandbox) TimeSyncState() (*kernel.TimeSyncState, error) {
+	log.Debugf("TimeSyncState sandbox %q", s.ID)
+	var r kernel.TimeSyncState
+	if err := s.call(boot.TimeSyncState, nil, &r); err != nil {
+		return nil, fmt.Errorf("retrieving time sync state: %w", err)
+	}
+	return &r, nil
+}
+
 // UsageFD sends the usagefd call for a container in the sandbox.
 func (s *Sandbox) UsageFD() (*control.MemoryUsageRecord, error) {
 	log.Debugf("Usage sandbox %q", s.ID)
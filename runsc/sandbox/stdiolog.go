@@ -0,0 +1,79 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/cleanup"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/donation"
+	"gvisor.dev/gvisor/runsc/specutils"
+)
+
+// startStdioLogger starts a "runsc stdio-log" process that logs the output of
+// container cid as configured by conf.StdioLog. Records that go to the
+// container's stdio are written to stdout and stderr.
+//
+// It returns the files to pass to the container as its stdout and stderr
+// instead. The caller must close them once they have been passed to the
+// sandbox, so that the logger exits when the container's processes do.
+func startStdioLogger(conf *config.Config, cid string, stdout, stderr *os.File) (*os.File, *os.File, error) {
+	donations := donation.Agency{}
+	defer donations.Close()
+
+	cu := cleanup.Cleanup{}
+	defer cu.Clean()
+	var ws [2]*os.File
+	for i, name := range []string{"stdout-fd", "stderr-fd"} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, nil, fmt.Errorf("creating %s pipe: %w", name, err)
+		}
+		cu.Add(func() { _ = w.Close() })
+		donations.DonateAndClose(name, r)
+		ws[i] = w
+	}
+
+	// Start with the general config flags.
+	cmd := exec.Command(specutils.ExePath, conf.ToFlags()...)
+	cmd.SysProcAttr = &unix.SysProcAttr{
+		// Detach from session, as for the gofer.
+		Setsid: true,
+	}
+	// Set Args[0] to make easier to spot the logger process.
+	cmd.Args[0] = "runsc-stdio-log"
+	cmd.Args = append(cmd.Args, "stdio-log", "--container-id="+cid)
+	donations.Transfer(cmd, 3)
+	if conf.StdioLog == config.StdioLogStdio {
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+	}
+
+	log.Debugf("Starting stdio logger for container %q: %s", cid, cmd.Args)
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("starting stdio logger: %w", err)
+	}
+	// The logger outlives this process: it exits once the container's output
+	// reaches EOF, and is reaped by whoever inherits it.
+	_ = cmd.Process.Release()
+
+	cu.Release()
+	return ws[0], ws[1], nil
+}
@@ -0,0 +1,254 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package specutils
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/config"
+	"gvisor.dev/gvisor/runsc/flag"
+)
+
+const annotationConfigBundlePrefix = "dev.gvisor.bundle."
+
+// SpecErrorCode classifies the ways in which a spec can be incompatible with
+// runsc.
+type SpecErrorCode string
+
+const (
+	// SpecErrorMissing means that a mandatory field is not set.
+	SpecErrorMissing SpecErrorCode = "missing"
+
+	// SpecErrorUnsupported means that runsc doesn't support the field.
+	SpecErrorUnsupported SpecErrorCode = "unsupported"
+
+	// SpecErrorInvalid means that the field is set to an invalid value.
+	SpecErrorInvalid SpecErrorCode = "invalid"
+
+	// SpecErrorDisabled means that the field requests a feature that runsc
+	// supports, but that is not enabled by its flags.
+	SpecErrorDisabled SpecErrorCode = "disabled"
+)
+
+// SpecError describes a field of a spec that is incompatible with runsc.
+type SpecError struct {
+	// Code classifies the error.
+	Code SpecErrorCode
+
+	// Field is the path to the offending field in the spec's JSON
+	// representation, e.g. "mounts[1].options" or
+	// "annotations[dev.gvisor.flag.debug]".
+	Field string
+
+	// Flag is the runsc flag that enables the feature requested by the field,
+	// for SpecErrorDisabled errors.
+	Flag string
+
+	// Err describes the error.
+	Err error
+}
+
+// Error implements error.Error.
+func (e *SpecError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *SpecError) Unwrap() error {
+	return e.Err
+}
+
+func specErrorf(code SpecErrorCode, field, format string, args ...any) *SpecError {
+	return &SpecError{Code: code, Field: field, Err: fmt.Errorf(format, args...)}
+}
+
+func annotationField(name string) string {
+	return fmt.Sprintf("annotations[%s]", name)
+}
+
+// CheckSpec returns all the errors that make the spec incompatible with runsc,
+// whatever runsc's flags are. Unlike ValidateSpec, it doesn't stop at the
+// first error.
+func CheckSpec(spec *specs.Spec) []*SpecError {
+	var errs []*SpecError
+
+	// Mandatory fields.
+	if spec.Process == nil {
+		errs = append(errs, specErrorf(SpecErrorMissing, "process", "Spec.Process must be defined"))
+	} else if len(spec.Process.Args) == 0 {
+		errs = append(errs, specErrorf(SpecErrorMissing, "process.args", "Spec.Process.Arg must be defined"))
+	}
+	if spec.Root == nil {
+		errs = append(errs, specErrorf(SpecErrorMissing, "root", "Spec.Root must be defined"))
+	} else if len(spec.Root.Path) == 0 {
+		errs = append(errs, specErrorf(SpecErrorMissing, "root.path", "Spec.Root.Path must be defined"))
+	}
+
+	// Unsupported fields.
+	if spec.Solaris != nil {
+		errs = append(errs, specErrorf(SpecErrorUnsupported, "solaris", "Spec.Solaris is not supported"))
+	}
+	if spec.Windows != nil {
+		errs = append(errs, specErrorf(SpecErrorUnsupported, "windows", "Spec.Windows is not supported"))
+	}
+	if spec.Process != nil && len(spec.Process.SelinuxLabel) != 0 {
+		errs = append(errs, specErrorf(SpecErrorUnsupported, "process.selinuxLabel", "SELinux is not supported: %s", spec.Process.SelinuxLabel))
+	}
+
+	if spec.Linux != nil && spec.Linux.RootfsPropagation != "" {
+		if err := validateRootfsPropagation(spec.Linux.RootfsPropagation); err != nil {
+			errs = append(errs, &SpecError{Code: SpecErrorInvalid, Field: "linux.rootfsPropagation", Err: err})
+		}
+	}
+	for i := range spec.Mounts {
+		m := &spec.Mounts[i]
+		if !path.IsAbs(m.Destination) {
+			errs = append(errs, specErrorf(SpecErrorInvalid, fmt.Sprintf("mounts[%d].destination", i), "Mount.Destination must be an absolute path: %v", m))
+			continue
+		}
+		if m.Type == "bind" {
+			if err := ValidateMountOptions(m.Options); err != nil {
+				errs = append(errs, &SpecError{Code: SpecErrorInvalid, Field: fmt.Sprintf("mounts[%d].options", i), Err: err})
+			}
+		}
+	}
+
+	// CRI specifies whether a container should start a new sandbox, or run
+	// another container in an existing sandbox.
+	switch SpecContainerType(spec) {
+	case ContainerTypeContainer:
+		// When starting a container in an existing sandbox, the
+		// sandbox ID must be set.
+		if _, ok := SandboxID(spec); !ok {
+			errs = append(errs, specErrorf(SpecErrorMissing, annotationField(ContainerdSandboxIDAnnotation), "spec has container-type of container, but no sandbox ID set"))
+		}
+	case ContainerTypeUnknown:
+		errs = append(errs, specErrorf(SpecErrorInvalid, annotationField(ContainerdContainerTypeAnnotation), "unknown container-type"))
+	default:
+	}
+
+	return errs
+}
+
+// ApplyConfigAnnotations applies the config bundles, config file profile and
+// flag overrides selected by the spec's annotations to conf. Errors are
+// returned as *SpecError.
+func ApplyConfigAnnotations(spec *specs.Spec, conf *config.Config, flagSet *flag.FlagSet) error {
+	// Iterate in a stable order, so that the same error is reported for the
+	// same spec.
+	names := make([]string, 0, len(spec.Annotations))
+	for name := range spec.Annotations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Look for config bundle annotations and verify that they exist.
+	var bundles []config.BundleName
+	for _, annotation := range names {
+		if !strings.HasPrefix(annotation, annotationConfigBundlePrefix) {
+			continue
+		}
+		val := spec.Annotations[annotation]
+		if val != "true" {
+			return specErrorf(SpecErrorInvalid, annotationField(annotation), "invalid value %q for annotation %q (must be set to 'true' or removed entirely)", val, annotation)
+		}
+		bundleName := config.BundleName(annotation[len(annotationConfigBundlePrefix):])
+		if _, exists := config.Bundles[bundleName]; !exists {
+			log.Warningf("Bundle name %q (from annotation %q=%q) does not exist; this bundle may have been deprecated. Skipping.", bundleName, annotation, val)
+			continue
+		}
+		bundles = append(bundles, bundleName)
+	}
+
+	// Apply config bundles, if any.
+	if len(bundles) > 0 {
+		log.Infof("Applying config bundles: %v", bundles)
+		if err := conf.ApplyBundles(flagSet, bundles...); err != nil {
+			return &SpecError{Code: SpecErrorInvalid, Field: "annotations", Err: err}
+		}
+	}
+
+	// Apply the config file profile selected by the pod, if any.
+	if profile, ok := spec.Annotations[config.ProfileAnnotation]; ok {
+		if err := conf.ApplyProfile(flagSet, profile); err != nil {
+			e := &SpecError{Code: SpecErrorInvalid, Field: annotationField(config.ProfileAnnotation), Err: err}
+			if conf.ConfigFile == "" {
+				e.Code = SpecErrorDisabled
+				e.Flag = "config"
+			}
+			return e
+		}
+	}
+
+	for _, annotation := range names {
+		if !strings.HasPrefix(annotation, annotationFlagPrefix) {
+			continue
+		}
+		// Override flags using annotation to allow customization per sandbox
+		// instance.
+		name := annotation[len(annotationFlagPrefix):]
+		val := spec.Annotations[annotation]
+		log.Infof("Overriding flag from flag annotation: --%s=%q", name, val)
+		if err := conf.Override(flagSet, name, val /* force= */, false); err != nil {
+			e := &SpecError{Code: SpecErrorInvalid, Field: annotationField(annotation), Err: err}
+			if errors.Is(err, config.ErrFlagOverrideDisabled) {
+				e.Code = SpecErrorDisabled
+				e.Flag = "allow-flag-override"
+			}
+			return e
+		}
+	}
+	return nil
+}
+
+// CheckFeatures returns errors for the fields of the spec that request
+// features that conf doesn't enable, and that runsc would otherwise ignore, or
+// that are invalid for these features. Config annotations must have been
+// applied to conf.
+func CheckFeatures(spec *specs.Spec, conf *config.Config) []*SpecError {
+	var errs []*SpecError
+	if spec.Linux != nil {
+		for i, dev := range spec.Linux.Devices {
+			field := fmt.Sprintf("linux.devices[%d]", i)
+			if dev.Path == "/dev/nvidiactl" && !NVProxyEnabled(spec, conf) {
+				errs = append(errs, &SpecError{Code: SpecErrorDisabled, Field: field, Flag: "nvproxy", Err: fmt.Errorf("GPU device %q requires nvproxy", dev.Path)})
+			}
+			if strings.HasPrefix(dev.Path, "/dev/accel") && !TPUProxyIsEnabled(spec, conf) {
+				errs = append(errs, &SpecError{Code: SpecErrorDisabled, Field: field, Flag: "tpuproxy", Err: fmt.Errorf("TPU device %q requires tpuproxy", dev.Path)})
+			}
+			if _, ok := VFIOGroupName(dev.Path); ok && !VFIOProxyEnabled(conf) {
+				errs = append(errs, &SpecError{Code: SpecErrorDisabled, Field: field, Flag: "vfioproxy", Err: fmt.Errorf("VFIO group device %q requires vfioproxy", dev.Path)})
+			}
+			if _, ok := PTPClockName(dev.Path); ok && !PTPProxyEnabled(conf) {
+				errs = append(errs, &SpecError{Code: SpecErrorDisabled, Field: field, Flag: "ptpproxy", Err: fmt.Errorf("PTP clock device %q requires ptpproxy", dev.Path)})
+			}
+		}
+	}
+	if _, _, err := GPUMemoryLimit(spec); err != nil {
+		errs = append(errs, &SpecError{Code: SpecErrorInvalid, Field: annotationField(annotationGPUMemoryLimit), Err: err})
+	}
+	if spec.Process != nil && conf.NVProxyDocker && GPUFunctionalityRequested(spec, conf) {
+		if _, err := ParseNvidiaVisibleDevices(spec); err != nil {
+			errs = append(errs, &SpecError{Code: SpecErrorInvalid, Field: "process.env", Err: err})
+		}
+	}
+	return errs
+}
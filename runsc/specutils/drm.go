@@ -0,0 +1,60 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package specutils
+
+import (
+	"regexp"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/runsc/config"
+)
+
+// drmRenderNodeRegex matches the paths of DRM render nodes.
+var drmRenderNodeRegex = regexp.MustCompile(`^/dev/dri/(renderD\d+)$`)
+
+// DRMProxyEnabled checks if drmproxy is enabled in the config.
+func DRMProxyEnabled(conf *config.Config) bool {
+	return conf.DRMProxy
+}
+
+// DRMRenderNodeName returns the file name of the DRM render node at path, or
+// false if path isn't a DRM render node.
+func DRMRenderNodeName(path string) (string, bool) {
+	ms := drmRenderNodeRegex.FindStringSubmatch(path)
+	if ms == nil {
+		return "", false
+	}
+	return ms[1], true
+}
+
+// DRMRenderNodeDevices returns the DRM render node devices in the spec.
+func DRMRenderNodeDevices(spec *specs.Spec) []specs.LinuxDevice {
+	if spec.Linux == nil {
+		return nil
+	}
+	var devs []specs.LinuxDevice
+	for _, dev := range spec.Linux.Devices {
+		if _, ok := DRMRenderNodeName(dev.Path); ok {
+			devs = append(devs, dev)
+		}
+	}
+	return devs
+}
+
+// DRMFunctionalityRequested returns true if the container should have access
+// to DRM render nodes.
+func DRMFunctionalityRequested(spec *specs.Spec, conf *config.Config) bool {
+	return DRMProxyEnabled(conf) && len(DRMRenderNodeDevices(spec)) > 0
+}
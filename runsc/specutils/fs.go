@@ -17,11 +17,11 @@ package specutils
 import (
 	"fmt"
 	"math/bits"
-	"path"
+	"os"
 	"strings"
 
-	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/hostos"
 	"gvisor.dev/gvisor/pkg/log"
 )
 
@@ -120,17 +120,6 @@ func IsReadonlyMount(opts []string) bool {
 	return false
 }
 
-// validateMount validates that spec mounts are correct.
-func validateMount(mnt *specs.Mount) error {
-	if !path.IsAbs(mnt.Destination) {
-		return fmt.Errorf("Mount.Destination must be an absolute path: %v", mnt)
-	}
-	if mnt.Type == "bind" {
-		return ValidateMountOptions(mnt.Options)
-	}
-	return nil
-}
-
 func moptKey(opt string) string {
 	if len(opt) == 0 {
 		return opt
@@ -192,3 +181,29 @@ func validatePropagation(opt string) error {
 	}
 	return nil
 }
+
+// HostOverlaySupported returns true if the gofer can mount the host's
+// overlayfs. Overlayfs must be registered with the host kernel, and mounting
+// it from a user namespace requires Linux 5.11 or newer.
+func HostOverlaySupported() bool {
+	version, err := hostos.KernelVersion()
+	if err != nil {
+		log.Warningf("Failed to get host kernel version: %v", err)
+		return false
+	}
+	if !version.AtLeast(5, 11) {
+		return false
+	}
+	filesystems, err := os.ReadFile("/proc/filesystems")
+	if err != nil {
+		log.Warningf("Failed to read /proc/filesystems: %v", err)
+		return false
+	}
+	for _, line := range strings.Split(string(filesystems), "\n") {
+		// Lines are "[nodev]\t<name>".
+		if fields := strings.Fields(line); len(fields) > 0 && fields[len(fields)-1] == "overlay" {
+			return true
+		}
+	}
+	return false
+}
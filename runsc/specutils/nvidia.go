@@ -29,6 +29,11 @@ const nvdEnvVar = "NVIDIA_VISIBLE_DEVICES"
 // annotationNVProxy enables nvproxy.
 const annotationNVProxy = "dev.gvisor.internal.nvproxy"
 
+// annotationGPUMemoryLimit limits the GPU memory, in bytes, that a container
+// can allocate through nvproxy. It is enforced by the container's misc cgroup,
+// and so requires cgroupfs to be mounted in the container.
+const annotationGPUMemoryLimit = "dev.gvisor.spec.nvproxy.gpu-memory-limit"
+
 // NVProxyEnabled checks both the nvproxy annotation and conf.NVProxy to see if nvproxy is enabled.
 func NVProxyEnabled(spec *specs.Spec, conf *config.Config) bool {
 	if conf.NVProxy {
@@ -103,3 +108,17 @@ func ParseNvidiaVisibleDevices(spec *specs.Spec) (string, error) {
 	}
 	return nvd, nil
 }
+
+// GPUMemoryLimit returns the GPU memory limit in bytes requested by the
+// annotationGPUMemoryLimit annotation, if any.
+func GPUMemoryLimit(spec *specs.Spec) (int64, bool, error) {
+	val, ok := spec.Annotations[annotationGPUMemoryLimit]
+	if !ok {
+		return 0, false, nil
+	}
+	limit, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || limit < 0 {
+		return 0, false, fmt.Errorf("invalid %s annotation value %q", annotationGPUMemoryLimit, val)
+	}
+	return limit, true, nil
+}
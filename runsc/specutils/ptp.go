@@ -0,0 +1,54 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package specutils
+
+import (
+	"regexp"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/runsc/config"
+)
+
+// ptpClockRegex matches the paths of PTP hardware clocks.
+var ptpClockRegex = regexp.MustCompile(`^/dev/(ptp\d+)$`)
+
+// PTPProxyEnabled checks if ptpproxy is enabled in the config.
+func PTPProxyEnabled(conf *config.Config) bool {
+	return conf.PTPProxy
+}
+
+// PTPClockName returns the file name of the PTP hardware clock at path, or
+// false if path isn't a PTP hardware clock.
+func PTPClockName(path string) (string, bool) {
+	ms := ptpClockRegex.FindStringSubmatch(path)
+	if ms == nil {
+		return "", false
+	}
+	return ms[1], true
+}
+
+// PTPClockDevices returns the PTP hardware clock devices in the spec.
+func PTPClockDevices(spec *specs.Spec) []specs.LinuxDevice {
+	if spec.Linux == nil {
+		return nil
+	}
+	var devs []specs.LinuxDevice
+	for _, dev := range spec.Linux.Devices {
+		if _, ok := PTPClockName(dev.Path); ok {
+			devs = append(devs, dev)
+		}
+	}
+	return devs
+}
@@ -23,4 +23,8 @@ import (
 
 const (
 	nativeArchAuditNo = linux.AUDIT_ARCH_X86_64
+
+	// nativeArchName is the name of the native architecture in OCI seccomp
+	// profiles.
+	nativeArchName = "SCMP_ARCH_X86_64"
 )
@@ -0,0 +1,139 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seccomp
+
+import (
+	"fmt"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+)
+
+// DifferenceKind classifies how a part of an OCI seccomp profile behaves
+// differently under gVisor than under a native runtime.
+type DifferenceKind string
+
+const (
+	// UnknownSyscall is a syscall name that gVisor doesn't know on the native
+	// architecture. Rules for it are ignored, as runc does.
+	UnknownSyscall DifferenceKind = "unknown-syscall"
+
+	// UnimplementedSyscall is a syscall that gVisor doesn't implement. Rules
+	// for it are applied but redundant: the syscall fails regardless of
+	// whether the profile allows it.
+	UnimplementedSyscall DifferenceKind = "unimplemented-syscall"
+
+	// IgnoredArchitecture is an additional architecture in the profile.
+	// gVisor only supports the native architecture's syscalls.
+	IgnoredArchitecture DifferenceKind = "ignored-architecture"
+
+	// IgnoredFlag is a seccomp filter flag, which is ignored.
+	IgnoredFlag DifferenceKind = "ignored-flag"
+
+	// UnsupportedAction is an action that gVisor can't apply. Profiles using
+	// it fail to load.
+	UnsupportedAction DifferenceKind = "unsupported-action"
+
+	// UnsupportedListener is a seccomp user notification listener, which is
+	// not supported.
+	UnsupportedListener DifferenceKind = "unsupported-listener"
+)
+
+// Difference describes a part of an OCI seccomp profile that behaves
+// differently under gVisor than under a native runtime.
+type Difference struct {
+	// Kind classifies the difference.
+	Kind DifferenceKind `json:"kind"`
+
+	// Syscall is the syscall that the difference applies to, if any.
+	Syscall string `json:"syscall,omitempty"`
+
+	// Detail describes the difference.
+	Detail string `json:"detail"`
+}
+
+// String implements fmt.Stringer.
+func (d Difference) String() string {
+	if d.Syscall != "" {
+		return fmt.Sprintf("%s: %s: %s", d.Kind, d.Syscall, d.Detail)
+	}
+	return fmt.Sprintf("%s: %s", d.Kind, d.Detail)
+}
+
+// Report returns the differences in behavior of the given OCI seccomp profile
+// under gVisor, in the order in which they appear in the profile.
+func Report(s *specs.LinuxSeccomp) []Difference {
+	var diffs []Difference
+	nativeArch := specs.Arch(nativeArchName)
+	for _, arch := range s.Architectures {
+		if arch != nativeArch {
+			diffs = append(diffs, Difference{
+				Kind:   IgnoredArchitecture,
+				Detail: fmt.Sprintf("syscalls of %s are not supported", arch),
+			})
+		}
+	}
+	for _, flag := range s.Flags {
+		diffs = append(diffs, Difference{
+			Kind:   IgnoredFlag,
+			Detail: fmt.Sprintf("%s is not applied", flag),
+		})
+	}
+	if s.ListenerPath != "" {
+		diffs = append(diffs, Difference{
+			Kind:   UnsupportedListener,
+			Detail: fmt.Sprintf("listener %q is never notified", s.ListenerPath),
+		})
+	}
+	if s.DefaultAction == specs.ActNotify {
+		diffs = append(diffs, Difference{
+			Kind:   UnsupportedAction,
+			Detail: fmt.Sprintf("default action %s is not supported", s.DefaultAction),
+		})
+	}
+
+	table := syscallTable(nativeArchAuditNo)
+	for _, syscall := range s.Syscalls {
+		if syscall.Action == specs.ActNotify {
+			for _, name := range syscall.Names {
+				diffs = append(diffs, Difference{
+					Kind:    UnsupportedAction,
+					Syscall: name,
+					Detail:  fmt.Sprintf("action %s is not supported", syscall.Action),
+				})
+			}
+			continue
+		}
+		for _, name := range syscall.Names {
+			sysno, err := table.LookupNo(name)
+			if err != nil {
+				diffs = append(diffs, Difference{
+					Kind:    UnknownSyscall,
+					Syscall: name,
+					Detail:  fmt.Sprintf("not a syscall on %s, rule with action %s is ignored", nativeArch, syscall.Action),
+				})
+				continue
+			}
+			if table.Table[sysno].SupportLevel == kernel.SupportUnimplemented {
+				diffs = append(diffs, Difference{
+					Kind:    UnimplementedSyscall,
+					Syscall: name,
+					Detail:  fmt.Sprintf("not implemented by gVisor, rule with action %s is redundant", syscall.Action),
+				})
+			}
+		}
+	}
+	return diffs
+}
@@ -30,19 +30,21 @@ import (
 )
 
 var (
-	killThreadAction = linux.SECCOMP_RET_KILL_THREAD
-	trapAction       = linux.SECCOMP_RET_TRAP
-	// runc always returns EPERM as the errorcode for SECCOMP_RET_ERRNO
+	killProcessAction = linux.SECCOMP_RET_KILL_PROCESS
+	killThreadAction  = linux.SECCOMP_RET_KILL_THREAD
+	trapAction        = linux.SECCOMP_RET_TRAP
+	// Like runc, SECCOMP_RET_ERRNO and SECCOMP_RET_TRACE return EPERM unless
+	// the profile specifies another errno.
 	errnoAction = linux.SECCOMP_RET_ERRNO.WithReturnCode(uint16(unix.EPERM))
-	// runc always returns EPERM as the errorcode for SECCOMP_RET_TRACE
 	traceAction = linux.SECCOMP_RET_TRACE.WithReturnCode(uint16(unix.EPERM))
+	logAction   = linux.SECCOMP_RET_LOG
 	allowAction = linux.SECCOMP_RET_ALLOW
 )
 
 // BuildProgram generates a bpf program based on the given OCI seccomp
 // config.
 func BuildProgram(s *specs.LinuxSeccomp) (bpf.Program, error) {
-	defaultAction, err := convertAction(s.DefaultAction)
+	defaultAction, err := convertAction(s.DefaultAction, s.DefaultErrnoRet)
 	if err != nil {
 		return bpf.Program{}, fmt.Errorf("secomp default action: %w", err)
 	}
@@ -67,16 +69,22 @@ func BuildProgram(s *specs.LinuxSeccomp) (bpf.Program, error) {
 	return program, nil
 }
 
-// lookupSyscallNo gets the syscall number for the syscall with the given name
-// for the given architecture.
-func lookupSyscallNo(arch uint32, name string) (uint32, error) {
-	var table *kernel.SyscallTable
+// syscallTable returns the syscall table of the given architecture, or nil if
+// the architecture is not supported.
+func syscallTable(arch uint32) *kernel.SyscallTable {
 	switch arch {
 	case linux.AUDIT_ARCH_X86_64:
-		table = slinux.AMD64
+		return slinux.AMD64
 	case linux.AUDIT_ARCH_AARCH64:
-		table = slinux.ARM64
+		return slinux.ARM64
 	}
+	return nil
+}
+
+// lookupSyscallNo gets the syscall number for the syscall with the given name
+// for the given architecture.
+func lookupSyscallNo(arch uint32, name string) (uint32, error) {
+	table := syscallTable(arch)
 	if table == nil {
 		return 0, fmt.Errorf("unsupported architecture: %d", arch)
 	}
@@ -87,20 +95,32 @@ func lookupSyscallNo(arch uint32, name string) (uint32, error) {
 	return uint32(n), nil
 }
 
-// convertAction converts a LinuxSeccompAction to BPFAction
-func convertAction(act specs.LinuxSeccompAction) (linux.BPFAction, error) {
-	// TODO(gvisor.dev/issue/3124): Update specs package to include ActLog and ActKillProcess.
+// convertAction converts a LinuxSeccompAction to BPFAction. errnoRet is the
+// errno returned by ActErrno and ActTrace, if set.
+func convertAction(act specs.LinuxSeccompAction, errnoRet *uint) (linux.BPFAction, error) {
 	switch act {
-	case specs.ActKill:
+	case specs.ActKill, specs.ActKillThread:
 		return killThreadAction, nil
+	case specs.ActKillProcess:
+		return killProcessAction, nil
 	case specs.ActTrap:
 		return trapAction, nil
 	case specs.ActErrno:
+		if errnoRet != nil {
+			return linux.SECCOMP_RET_ERRNO.WithReturnCode(uint16(*errnoRet)), nil
+		}
 		return errnoAction, nil
 	case specs.ActTrace:
+		if errnoRet != nil {
+			return linux.SECCOMP_RET_TRACE.WithReturnCode(uint16(*errnoRet)), nil
+		}
 		return traceAction, nil
+	case specs.ActLog:
+		return logAction, nil
 	case specs.ActAllow:
 		return allowAction, nil
+	case specs.ActNotify:
+		return 0, fmt.Errorf("unsupported action: %v", act)
 	default:
 		return 0, fmt.Errorf("invalid action: %v", act)
 	}
@@ -118,7 +138,7 @@ func convertRules(s *specs.LinuxSeccomp) ([]seccomp.RuleSet, error) {
 	for _, syscall := range s.Syscalls {
 		sysRules := seccomp.NewSyscallRules()
 
-		action, err := convertAction(syscall.Action)
+		action, err := convertAction(syscall.Action, syscall.ErrnoRet)
 		if err != nil {
 			return nil, err
 		}
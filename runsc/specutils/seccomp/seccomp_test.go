@@ -73,6 +73,43 @@ var (
 			input:    testInput(nativeArchAuditNo, "read", nil),
 			expected: uint32(errnoAction),
 		},
+		{
+			name: "default_errno_ret",
+			config: specs.LinuxSeccomp{
+				DefaultAction:   specs.ActErrno,
+				DefaultErrnoRet: func() *uint { errno := uint(unix.ENOSYS); return &errno }(),
+			},
+			input:    testInput(nativeArchAuditNo, "read", nil),
+			expected: uint32(linux.SECCOMP_RET_ERRNO.WithReturnCode(uint16(unix.ENOSYS))),
+		},
+		{
+			name: "match_name_kill_process",
+			config: specs.LinuxSeccomp{
+				DefaultAction: specs.ActAllow,
+				Syscalls: []specs.LinuxSyscall{
+					{
+						Names:  []string{"getcwd"},
+						Action: specs.ActKillProcess,
+					},
+				},
+			},
+			input:    testInput(nativeArchAuditNo, "getcwd", nil),
+			expected: uint32(killProcessAction),
+		},
+		{
+			name: "match_name_log",
+			config: specs.LinuxSeccomp{
+				DefaultAction: specs.ActErrno,
+				Syscalls: []specs.LinuxSyscall{
+					{
+						Names:  []string{"getcwd"},
+						Action: specs.ActLog,
+					},
+				},
+			},
+			input:    testInput(nativeArchAuditNo, "getcwd", nil),
+			expected: uint32(logAction),
+		},
 		{
 			name: "deny_arch",
 			config: specs.LinuxSeccomp{
@@ -403,3 +440,47 @@ func checkProgram(p bpf.Program, in bpf.Input, expected uint32) error {
 
 	return nil
 }
+
+func TestReport(t *testing.T) {
+	profile := specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Architectures: []specs.Arch{nativeArchName, "SCMP_ARCH_X86"},
+		Flags:         []specs.LinuxSeccompFlag{specs.LinuxSeccompFlagLog},
+		Syscalls: []specs.LinuxSyscall{
+			{
+				Names:  []string{"read", "not_a_syscall"},
+				Action: specs.ActAllow,
+			},
+			{
+				Names:  []string{"kexec_load"},
+				Action: specs.ActErrno,
+			},
+			{
+				Names:  []string{"write"},
+				Action: specs.ActNotify,
+			},
+		},
+	}
+	var got []string
+	for _, d := range Report(&profile) {
+		got = append(got, fmt.Sprintf("%s %s", d.Kind, d.Syscall))
+	}
+	want := []string{
+		"ignored-architecture ",
+		"ignored-flag ",
+		"unknown-syscall not_a_syscall",
+		"unimplemented-syscall kexec_load",
+		"unsupported-action write",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Report() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Report()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+	if _, err := BuildProgram(&profile); err == nil {
+		t.Errorf("BuildProgram() succeeded for profile with unsupported action %s", specs.ActNotify)
+	}
+}
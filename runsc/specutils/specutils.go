@@ -86,31 +86,11 @@ func LogSpecDebug(orig *specs.Spec, logSeccomp bool) {
 	log.Debugf("Spec:\n%s", out)
 }
 
-// ValidateSpec validates that the spec is compatible with runsc.
+// ValidateSpec validates that the spec is compatible with runsc. It returns
+// the first error found by CheckSpec, if any.
 func ValidateSpec(spec *specs.Spec) error {
-	// Mandatory fields.
-	if spec.Process == nil {
-		return fmt.Errorf("Spec.Process must be defined: %+v", spec)
-	}
-	if len(spec.Process.Args) == 0 {
-		return fmt.Errorf("Spec.Process.Arg must be defined: %+v", spec.Process)
-	}
-	if spec.Root == nil {
-		return fmt.Errorf("Spec.Root must be defined: %+v", spec)
-	}
-	if len(spec.Root.Path) == 0 {
-		return fmt.Errorf("Spec.Root.Path must be defined: %+v", spec.Root)
-	}
-
-	// Unsupported fields.
-	if spec.Solaris != nil {
-		return fmt.Errorf("Spec.Solaris is not supported: %+v", spec)
-	}
-	if spec.Windows != nil {
-		return fmt.Errorf("Spec.Windows is not supported: %+v", spec)
-	}
-	if len(spec.Process.SelinuxLabel) != 0 {
-		return fmt.Errorf("SELinux is not supported: %s", spec.Process.SelinuxLabel)
+	if errs := CheckSpec(spec); len(errs) > 0 {
+		return errs[0]
 	}
 
 	// Docker uses AppArmor by default, so just log that it's being ignored.
@@ -123,32 +103,6 @@ func ValidateSpec(spec *specs.Spec) error {
 	if !spec.Process.NoNewPrivileges {
 		log.Warningf("noNewPrivileges ignored. PR_SET_NO_NEW_PRIVS is assumed to always be set.")
 	}
-
-	if spec.Linux != nil && spec.Linux.RootfsPropagation != "" {
-		if err := validateRootfsPropagation(spec.Linux.RootfsPropagation); err != nil {
-			return err
-		}
-	}
-	for _, m := range spec.Mounts {
-		if err := validateMount(&m); err != nil {
-			return err
-		}
-	}
-
-	// CRI specifies whether a container should start a new sandbox, or run
-	// another container in an existing sandbox.
-	switch SpecContainerType(spec) {
-	case ContainerTypeContainer:
-		// When starting a container in an existing sandbox, the
-		// sandbox ID must be set.
-		if _, ok := SandboxID(spec); !ok {
-			return fmt.Errorf("spec has container-type of container, but no sandbox ID set")
-		}
-	case ContainerTypeUnknown:
-		return fmt.Errorf("unknown container-type")
-	default:
-	}
-
 	return nil
 }
 
@@ -215,30 +169,8 @@ func fixSpec(spec *specs.Spec, bundleDir string, conf *config.Config) error {
 			m.Source = absPath(bundleDir, m.Source)
 		}
 	}
-	// Look for config bundle annotations and verify that they exist.
-	const configBundlePrefix = "dev.gvisor.bundle."
-	var bundles []config.BundleName
-	for annotation, val := range spec.Annotations {
-		if !strings.HasPrefix(annotation, configBundlePrefix) {
-			continue
-		}
-		if val != "true" {
-			return fmt.Errorf("invalid value %q for annotation %q (must be set to 'true' or removed entirely)", val, annotation)
-		}
-		bundleName := config.BundleName(annotation[len(configBundlePrefix):])
-		if _, exists := config.Bundles[bundleName]; !exists {
-			log.Warningf("Bundle name %q (from annotation %q=%q) does not exist; this bundle may have been deprecated. Skipping.", bundleName, annotation, val)
-			continue
-		}
-		bundles = append(bundles, bundleName)
-	}
-
-	// Apply config bundles, if any.
-	if len(bundles) > 0 {
-		log.Infof("Applying config bundles: %v", bundles)
-		if err := conf.ApplyBundles(flag.CommandLine, bundles...); err != nil {
-			return err
-		}
+	if err := ApplyConfigAnnotations(spec, conf, flag.CommandLine); err != nil {
+		return err
 	}
 
 	// Check annotation to see if container name is available.
@@ -250,25 +182,15 @@ func fixSpec(spec *specs.Spec, bundleDir string, conf *config.Config) error {
 			break
 		}
 	}
-	for annotation, val := range spec.Annotations {
-		if strings.HasPrefix(annotation, annotationFlagPrefix) {
-			// Override flags using annotation to allow customization per sandbox
-			// instance.
-			name := annotation[len(annotationFlagPrefix):]
-			log.Infof("Overriding flag from flag annotation: --%s=%q", name, val)
-			if err := conf.Override(flag.CommandLine, name, val /* force= */, false); err != nil {
-				return err
-			}
-		} else if len(containerName) > 0 {
-			// If we know the container name, then check to see if seccomp
-			// instructions were given to the the container.
-			if annotation == annotationSeccomp+containerName && val == annotationSeccompRuntimeDefault {
-				// Container seccomp rules are redundant when using gVisor, so remove
-				// them when seccomp is set to RuntimeDefault.
-				if spec.Linux != nil && spec.Linux.Seccomp != nil {
-					log.Debugf("Seccomp is being ignored because annotation %q is set to default.", annotationSeccomp)
-					spec.Linux.Seccomp = nil
-				}
+	if len(containerName) > 0 {
+		// If we know the container name, then check to see if seccomp
+		// instructions were given to the the container.
+		if val := spec.Annotations[annotationSeccomp+containerName]; val == annotationSeccompRuntimeDefault {
+			// Container seccomp rules are redundant when using gVisor, so remove
+			// them when seccomp is set to RuntimeDefault.
+			if spec.Linux != nil && spec.Linux.Seccomp != nil {
+				log.Debugf("Seccomp is being ignored because annotation %q is set to default.", annotationSeccomp)
+				spec.Linux.Seccomp = nil
 			}
 		}
 	}
@@ -17,6 +17,7 @@ package specutils
 import (
 	"fmt"
 	"os/exec"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -379,3 +380,87 @@ func TestSeccomp(t *testing.T) {
 		})
 	}
 }
+
+func TestGPUMemoryLimit(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		value     string
+		set       bool
+		wantLimit int64
+		wantOK    bool
+		wantErr   bool
+	}{
+		{name: "unset"},
+		{name: "valid", value: "1073741824", set: true, wantLimit: 1 << 30, wantOK: true},
+		{name: "zero", value: "0", set: true, wantOK: true},
+		{name: "negative", value: "-1", set: true, wantErr: true},
+		{name: "invalid", value: "1G", set: true, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := &specs.Spec{Annotations: map[string]string{}}
+			if tc.set {
+				spec.Annotations[annotationGPUMemoryLimit] = tc.value
+			}
+			limit, ok, err := GPUMemoryLimit(spec)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("GPUMemoryLimit() got error %v, want error: %t", err, tc.wantErr)
+			}
+			if limit != tc.wantLimit || ok != tc.wantOK {
+				t.Errorf("GPUMemoryLimit() = (%d, %t), want (%d, %t)", limit, ok, tc.wantLimit, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestVFIOGroupDevices(t *testing.T) {
+	spec := &specs.Spec{
+		Linux: &specs.Linux{
+			Devices: []specs.LinuxDevice{
+				{Path: "/dev/vfio/vfio"},
+				{Path: "/dev/vfio/12"},
+				{Path: "/dev/nvidiactl"},
+				{Path: "/dev/vfio/devices/vfio0"},
+				{Path: "/dev/vfio/3"},
+			},
+		},
+	}
+	var got []string
+	for _, dev := range VFIOGroupDevices(spec) {
+		name, ok := VFIOGroupName(dev.Path)
+		if !ok {
+			t.Errorf("VFIOGroupName(%q) failed", dev.Path)
+		}
+		got = append(got, name)
+	}
+	if want := []string{"12", "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("VFIOGroupDevices() returned groups %v, want %v", got, want)
+	}
+	if got := VFIOGroupDevices(&specs.Spec{}); len(got) != 0 {
+		t.Errorf("VFIOGroupDevices() = %v for spec without devices, want none", got)
+	}
+}
+
+func TestDRMRenderNodeDevices(t *testing.T) {
+	spec := &specs.Spec{
+		Linux: &specs.Linux{
+			Devices: []specs.LinuxDevice{
+				{Path: "/dev/dri/card0"},
+				{Path: "/dev/dri/renderD128"},
+				{Path: "/dev/dri/by-path/pci-0000:00:02.0-render"},
+				{Path: "/dev/renderD129"},
+				{Path: "/dev/dri/renderD129"},
+			},
+		},
+	}
+	var got []string
+	for _, dev := range DRMRenderNodeDevices(spec) {
+		name, ok := DRMRenderNodeName(dev.Path)
+		if !ok {
+			t.Errorf("DRMRenderNodeName(%q) failed", dev.Path)
+		}
+		got = append(got, name)
+	}
+	if want := []string{"renderD128", "renderD129"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DRMRenderNodeDevices() returned render nodes %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package specutils
+
+import (
+	"regexp"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/runsc/config"
+)
+
+// VFIOContainerDevicePath is the path of the VFIO container device.
+const VFIOContainerDevicePath = "/dev/vfio/vfio"
+
+// vfioGroupDeviceRegex matches the paths of VFIO group devices, whose names
+// are IOMMU group numbers.
+var vfioGroupDeviceRegex = regexp.MustCompile(`^/dev/vfio/(\d+)$`)
+
+// VFIOProxyEnabled checks if vfioproxy is enabled in the config.
+func VFIOProxyEnabled(conf *config.Config) bool {
+	return conf.VFIOProxy
+}
+
+// VFIOGroupName returns the IOMMU group number of the VFIO group device at
+// path, or false if path isn't a VFIO group device.
+func VFIOGroupName(path string) (string, bool) {
+	ms := vfioGroupDeviceRegex.FindStringSubmatch(path)
+	if ms == nil {
+		return "", false
+	}
+	return ms[1], true
+}
+
+// VFIOGroupDevices returns the VFIO group devices in the spec.
+func VFIOGroupDevices(spec *specs.Spec) []specs.LinuxDevice {
+	if spec.Linux == nil {
+		return nil
+	}
+	var devs []specs.LinuxDevice
+	for _, dev := range spec.Linux.Devices {
+		if _, ok := VFIOGroupName(dev.Path); ok {
+			devs = append(devs, dev)
+		}
+	}
+	return devs
+}
+
+// VFIOFunctionalityRequested returns true if the container should have access
+// to VFIO devices.
+func VFIOFunctionalityRequested(spec *specs.Spec, conf *config.Config) bool {
+	return VFIOProxyEnabled(conf) && len(VFIOGroupDevices(spec)) > 0
+}
@@ -0,0 +1,108 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stdiolog
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secrets in redacted output.
+const Redacted = "[REDACTED]"
+
+// Rule redacts the matches of a regular expression in output.
+type Rule struct {
+	// Pattern is the regular expression to redact.
+	Pattern *regexp.Regexp
+
+	// Replacement replaces each match of Pattern. It may refer to submatches
+	// of Pattern, as in regexp.Regexp.ReplaceAllString.
+	Replacement string
+}
+
+// DefaultRules returns rules that redact common kinds of secrets: cloud
+// provider and source forge access tokens, bearer tokens, JSON Web Tokens, and
+// values assigned to keys that look like passwords, secrets, tokens or API
+// keys.
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			// AWS access key IDs.
+			Pattern:     regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+			Replacement: Redacted,
+		},
+		{
+			// GitHub tokens.
+			Pattern:     regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+			Replacement: Redacted,
+		},
+		{
+			// JSON Web Tokens.
+			Pattern:     regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+			Replacement: Redacted,
+		},
+		{
+			// Bearer tokens, e.g. in HTTP Authorization headers.
+			Pattern:     regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9._~+/-]+=*`),
+			Replacement: "${1}" + Redacted,
+		},
+		{
+			// Secrets assigned to keys, e.g. password=foo or "api_key": "foo".
+			Pattern:     regexp.MustCompile(`(?i)\b((?:password|passwd|secret|token|api[_-]?key|access[_-]?key)"?\s*[=:]\s*)("[^"]*"|[^\s,;&]+)`),
+			Replacement: "${1}" + Redacted,
+		},
+	}
+}
+
+// LoadRules reads rules from the file at path, which contains a regular
+// expression in RE2 syntax per line. The matches of each regular expression
+// are replaced by Redacted. Empty lines and lines starting with '#' are
+// ignored.
+func LoadRules(path string) ([]Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []Rule
+	s := bufio.NewScanner(f)
+	for lineNo := 1; s.Scan(); lineNo++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		re, err := regexp.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		rules = append(rules, Rule{Pattern: re, Replacement: Redacted})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Redact applies rules to s in order, and returns the result.
+func Redact(rules []Rule, s string) string {
+	for _, r := range rules {
+		s = r.Pattern.ReplaceAllString(s, r.Replacement)
+	}
+	return s
+}
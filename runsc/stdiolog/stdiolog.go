@@ -0,0 +1,208 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stdiolog frames the stdout and stderr of a container's workload as
+// JSON records, redacting secrets and enforcing rate and size limits, so that
+// platforms can collect workload output without trusting its contents or
+// volume.
+package stdiolog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// maxLineSize is the maximum number of bytes of output in a record. Longer
+// lines are split into several records, all but the last of which are
+// partial.
+const maxLineSize = 16 << 10
+
+// Stream names used in records.
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+// Record is a line of workload output, encoded as a single line of JSON.
+type Record struct {
+	// Time is when the line was read.
+	Time time.Time `json:"time"`
+
+	// Container is the ID of the container the workload runs in.
+	Container string `json:"container,omitempty"`
+
+	// Stream is the stream the line was written to, Stdout or Stderr.
+	Stream string `json:"stream"`
+
+	// Log is the line, without its trailing newline, after redaction.
+	Log string `json:"log"`
+
+	// Partial is true if the line continues in the next record of the same
+	// stream.
+	Partial bool `json:"partial,omitempty"`
+
+	// Dropped is the number of bytes of output that were dropped since the
+	// previous record because they exceeded the rate limit.
+	Dropped uint64 `json:"dropped,omitempty"`
+
+	// Truncated is true if the output exceeded the size limit. It is set on
+	// the last record; the output that follows is dropped.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Options configures a Logger.
+type Options struct {
+	// ContainerID is recorded in every record.
+	ContainerID string
+
+	// Rate is the maximum sustained rate of output in bytes per second.
+	// Output in excess of the rate is dropped. Zero means no limit.
+	Rate uint64
+
+	// MaxSize is the maximum number of bytes of output that is logged. Output
+	// after that is dropped. Zero means no limit.
+	MaxSize uint64
+
+	// Rules are applied to every line of output, in order.
+	Rules []Rule
+}
+
+// Logger writes records for the output of a container's workload. It is
+// shared by the container's streams, which share its rate and size limits.
+type Logger struct {
+	opts Options
+
+	// limiter enforces opts.Rate. It is nil if opts.Rate is zero.
+	limiter *rate.Limiter
+
+	// now returns the current time. It is replaced in tests.
+	now func() time.Time
+
+	// mu serializes writes of records, and protects the fields below.
+	mu sync.Mutex
+
+	// written is the number of bytes of output that were logged.
+	//
+	// +checklocks:mu
+	written uint64
+
+	// dropped is the number of bytes of output that were dropped since the
+	// last record.
+	//
+	// +checklocks:mu
+	dropped uint64
+
+	// truncated is true once the output exceeded opts.MaxSize.
+	//
+	// +checklocks:mu
+	truncated bool
+}
+
+// New returns a new Logger.
+func New(opts Options) *Logger {
+	l := &Logger{
+		opts: opts,
+		now:  time.Now,
+	}
+	if opts.Rate != 0 {
+		// Allow a whole line to be logged at once, even if it is larger than
+		// a second worth of output.
+		burst := uint64(maxLineSize)
+		if opts.Rate > burst {
+			burst = opts.Rate
+		}
+		if burst > math.MaxInt32 {
+			burst = math.MaxInt32
+		}
+		l.limiter = rate.NewLimiter(rate.Limit(opts.Rate), int(burst))
+	}
+	return l
+}
+
+// Copy reads the output of the given stream from r until EOF, and writes
+// records for it to w. r is read to EOF even if its output is dropped or w
+// fails, so that the workload never blocks writing to it. Copy returns the
+// first error returned by w, if any.
+func (l *Logger) Copy(w io.Writer, stream string, r io.Reader) error {
+	br := bufio.NewReaderSize(r, maxLineSize)
+	var werr error
+	for {
+		line, err := br.ReadSlice('\n')
+		partial := false
+		switch {
+		case err == nil:
+			line = line[:len(line)-1]
+		case errors.Is(err, bufio.ErrBufferFull):
+			partial = true
+		case len(line) == 0:
+			if errors.Is(err, io.EOF) {
+				return werr
+			}
+			return err
+		}
+		if err := l.log(w, stream, line, partial); err != nil && werr == nil {
+			werr = err
+		}
+	}
+}
+
+// log writes a record for line to w, unless the rate or size limit drops it.
+func (l *Logger) log(w io.Writer, stream string, line []byte, partial bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.truncated {
+		return nil
+	}
+	n := uint64(len(line))
+	if l.opts.MaxSize != 0 && l.written+n > l.opts.MaxSize {
+		l.truncated = true
+		return l.writeLocked(w, Record{
+			Stream:    stream,
+			Dropped:   l.dropped,
+			Truncated: true,
+		})
+	}
+	if l.limiter != nil && !l.limiter.AllowN(l.now(), len(line)) {
+		l.dropped += n
+		return nil
+	}
+	l.written += n
+	rec := Record{
+		Stream:  stream,
+		Log:     Redact(l.opts.Rules, string(line)),
+		Partial: partial,
+		Dropped: l.dropped,
+	}
+	l.dropped = 0
+	return l.writeLocked(w, rec)
+}
+
+// +checklocks:l.mu
+func (l *Logger) writeLocked(w io.Writer, rec Record) error {
+	rec.Time = l.now()
+	rec.Container = l.opts.ContainerID
+	buf, err := json.Marshal(&rec)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(buf, '\n'))
+	return err
+}
@@ -0,0 +1,49 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package accel holds benchmarks of crypto and compression workloads whose
+// performance depends on the CPU features exposed to the container, such as
+// AES-NI, SHA-NI, AVX2, AVX-512 and BMI2. Comparing results between runc and
+// each runsc platform shows when CPUID filtering or platform traps disable
+// hardware acceleration.
+package accel
+
+import (
+	"context"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+)
+
+// image holds openssl and zstd.
+const image = "benchmarks/accel"
+
+// run runs cmd in a new container on the runtime under test, and returns its
+// output. Only the command itself is timed.
+func run(ctx context.Context, b *testing.B, machine harness.Machine, cmd []string) string {
+	b.Helper()
+	container := machine.GetContainer(ctx, b)
+	defer container.CleanUp(ctx)
+
+	b.ResetTimer()
+	out, err := container.Run(ctx, dockerutil.RunOpts{
+		Image: image,
+	}, cmd...)
+	if err != nil {
+		b.Fatalf("failed to run %v: %v: logs: %s", cmd, err, out)
+	}
+	b.StopTimer()
+	return out
+}
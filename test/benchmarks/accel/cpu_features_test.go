@@ -0,0 +1,71 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accel
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+	"gvisor.dev/gvisor/test/benchmarks/tools"
+)
+
+// BenchmarkCPUFeatures reports which of the CPU features used by crypto and
+// compression libraries are exposed by the runtime under test, and how many
+// of the features exposed to native containers it hides. It doesn't measure
+// performance, but explains differences in the other benchmarks.
+func BenchmarkCPUFeatures(b *testing.B) {
+	machine, err := harness.GetMachine(b)
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer machine.CleanUp()
+
+	ctx := context.Background()
+	got := cpuFeatures(ctx, b, machine.GetContainer(ctx, b))
+	native := cpuFeatures(ctx, b, machine.GetNativeContainer(ctx, b))
+
+	hidden := 0
+	for _, feature := range tools.AccelCPUFeatures[runtime.GOARCH] {
+		present := 0.0
+		if got.Has(feature) {
+			present = 1
+		} else if native.Has(feature) {
+			b.Logf("CPU feature %q is exposed to native containers, but not by the runtime under test", feature)
+			hidden++
+		}
+		tools.ReportCustomMetric(b, present, "cpu_feature_"+feature /*metric name*/, "present" /*unit*/)
+	}
+	tools.ReportCustomMetric(b, float64(hidden), "hidden_cpu_features" /*metric name*/, "count" /*unit*/)
+}
+
+// cpuFeatures returns the CPU features listed in /proc/cpuinfo in container.
+func cpuFeatures(ctx context.Context, b *testing.B, container *dockerutil.Container) tools.CPUFeatures {
+	b.Helper()
+	defer container.CleanUp(ctx)
+	out, err := container.Run(ctx, dockerutil.RunOpts{
+		Image: image,
+	}, "cat", "/proc/cpuinfo")
+	if err != nil {
+		b.Fatalf("failed to read /proc/cpuinfo: %v: logs: %s", err, out)
+	}
+	features, err := tools.ParseCPUFeatures(out)
+	if err != nil {
+		b.Fatalf("failed to parse /proc/cpuinfo: %v", err)
+	}
+	return features
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accel
+
+import (
+	"context"
+	"testing"
+
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+	"gvisor.dev/gvisor/test/benchmarks/tools"
+)
+
+// BenchmarkOpenSSL runs 'openssl speed' on algorithms that have hardware
+// accelerated implementations.
+func BenchmarkOpenSSL(b *testing.B) {
+	machine, err := harness.GetMachine(b)
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer machine.CleanUp()
+
+	for _, algorithm := range []string{
+		// SHA-NI on x86, SHA2 instructions on arm64.
+		"sha256",
+		// AVX2 on x86, SHA512 instructions on arm64.
+		"sha512",
+		// AES-NI and PCLMULQDQ, or VAES and VPCLMULQDQ with AVX-512 on
+		// x86. AES and PMULL instructions on arm64.
+		"aes-128-gcm",
+		"aes-256-gcm",
+		// AVX2 or AVX-512 on x86, NEON on arm64.
+		"chacha20-poly1305",
+	} {
+		name, err := tools.ParametersToName(tools.Parameter{
+			Name:  "algorithm",
+			Value: algorithm,
+		})
+		if err != nil {
+			b.Fatalf("Failed to parse params: %v", err)
+		}
+		b.Run(name, func(b *testing.B) {
+			openssl := &tools.OpenSSLSpeed{
+				Algorithm: algorithm,
+				BlockSize: 16384,
+				Seconds:   harness.SmokeOr(5, 1),
+			}
+			out := run(context.Background(), b, machine, openssl.MakeCmd())
+			openssl.Report(b, out)
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accel
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+	"gvisor.dev/gvisor/test/benchmarks/tools"
+)
+
+// BenchmarkZstd runs zstd's built-in compression benchmark.
+func BenchmarkZstd(b *testing.B) {
+	machine, err := harness.GetMachine(b)
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer machine.CleanUp()
+
+	for _, tc := range []struct {
+		level   int
+		threads int
+	}{
+		{level: 1},
+		{level: 3},
+		{level: 9},
+		{level: 3, threads: 4},
+	} {
+		params := []tools.Parameter{{
+			Name:  "level",
+			Value: fmt.Sprintf("%d", tc.level),
+		}}
+		if tc.threads != 0 {
+			params = append(params, tools.Parameter{
+				Name:  "threads",
+				Value: fmt.Sprintf("%d", tc.threads),
+			})
+		}
+		name, err := tools.ParametersToName(params...)
+		if err != nil {
+			b.Fatalf("Failed to parse params: %v", err)
+		}
+		b.Run(name, func(b *testing.B) {
+			zstd := &tools.Zstd{
+				Level:   tc.level,
+				Threads: tc.threads,
+				Seconds: harness.SmokeOr(5, 1),
+			}
+			out := run(context.Background(), b, machine, zstd.MakeCmd())
+			zstd.Report(b, out)
+		})
+	}
+}
@@ -37,7 +37,7 @@ func BenchmarkHackbench(b *testing.B) {
 		},
 	}
 
-	machine, err := harness.GetMachine()
+	machine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine: %v", err)
 	}
@@ -29,7 +29,7 @@ import (
 // BenchmarkSizeEmpty creates N empty containers and reads memory usage from
 // /proc/meminfo.
 func BenchmarkSizeEmpty(b *testing.B) {
-	machine, err := harness.GetMachine()
+	machine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine: %v", err)
 	}
@@ -79,7 +79,7 @@ func BenchmarkSizeEmpty(b *testing.B) {
 // BenchmarkSizeNginx starts N containers running Nginx, checks that they're
 // serving, and checks memory used based on /proc/meminfo.
 func BenchmarkSizeNginx(b *testing.B) {
-	machine, err := harness.GetMachine()
+	machine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine with: %v", err)
 	}
@@ -124,7 +124,7 @@ func BenchmarkSizeNginx(b *testing.B) {
 // BenchmarkSizeNode starts N containers running a Node app, checks that
 // they're serving, and checks memory used based on /proc/meminfo.
 func BenchmarkSizeNode(b *testing.B) {
-	machine, err := harness.GetMachine()
+	machine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine with: %v", err)
 	}
@@ -27,7 +27,7 @@ import (
 
 // BenchmarkStartEmpty times startup time for an empty container.
 func BenchmarkStartupEmpty(b *testing.B) {
-	machine, err := harness.GetMachine()
+	machine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine: %v", err)
 	}
@@ -55,7 +55,7 @@ func BenchmarkStartupEmpty(b *testing.B) {
 // Time is measured from start until the first request is served.
 func BenchmarkStartupNginx(b *testing.B) {
 	// The machine to hold Nginx and the Node Server.
-	machine, err := harness.GetMachine()
+	machine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine with: %v", err)
 	}
@@ -78,7 +78,7 @@ func BenchmarkStartupNginx(b *testing.B) {
 // Time is measured from start until the first request is served.
 // Note that the Node app connects to a Redis instance before serving.
 func BenchmarkStartupNode(b *testing.B) {
-	machine, err := harness.GetMachine()
+	machine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine with: %v", err)
 	}
@@ -17,6 +17,7 @@ package sysbench_test
 import (
 	"context"
 	"fmt"
+	"os"
 	"testing"
 
 	"gvisor.dev/gvisor/pkg/test/dockerutil"
@@ -77,7 +78,7 @@ func BenchmarkSysbench(b *testing.B) {
 		},
 	}
 
-	machine, err := harness.GetMachine()
+	machine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine: %v", err)
 	}
@@ -122,3 +123,9 @@ func BenchmarkSysbench(b *testing.B) {
 		})
 	}
 }
+
+// TestMain is the main method for this package.
+func TestMain(m *testing.M) {
+	harness.Init()
+	os.Exit(m.Run())
+}
@@ -17,6 +17,7 @@ package syscallbench_test
 import (
 	"context"
 	"fmt"
+	"os"
 	"testing"
 
 	"gvisor.dev/gvisor/pkg/test/dockerutil"
@@ -27,7 +28,7 @@ import (
 // BenchmarSyscallbench runs a syscall b.N times on the runtime.
 func BenchmarkSyscallbench(b *testing.B) {
 	ctx := context.Background()
-	machine, err := harness.GetMachine()
+	machine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine: %v", err)
 	}
@@ -83,7 +84,7 @@ func BenchmarkSyscallbench(b *testing.B) {
 // enabled for it.
 func BenchmarkSyscallUnderSeccomp(b *testing.B) {
 	ctx := context.Background()
-	machine, err := harness.GetMachine()
+	machine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine: %v", err)
 	}
@@ -130,3 +131,9 @@ func BenchmarkSyscallUnderSeccomp(b *testing.B) {
 		}()
 	}
 }
+
+// TestMain is the main method for this package.
+func TestMain(m *testing.M) {
+	harness.Init()
+	os.Exit(m.Run())
+}
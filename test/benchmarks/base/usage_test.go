@@ -31,7 +31,7 @@ import (
 // BenchmarkSizeEmpty creates N alpine containers and reads memory usage using `docker stats`.
 func BenchmarkSizeEmpty(b *testing.B) {
 	ctx := context.Background()
-	machine, err := harness.GetMachine()
+	machine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine: %v", err)
 	}
@@ -68,7 +68,7 @@ func BenchmarkSizeEmpty(b *testing.B) {
 // serving, and checks memory usage from `docker stats`.
 func BenchmarkSizeNginx(b *testing.B) {
 	ctx := context.Background()
-	machine, err := harness.GetMachine()
+	machine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine with: %v", err)
 	}
@@ -108,7 +108,7 @@ func BenchmarkSizeNginx(b *testing.B) {
 // they're serving, and checks memory used based on /proc/meminfo.
 func BenchmarkSizeNode(b *testing.B) {
 	ctx := context.Background()
-	machine, err := harness.GetMachine()
+	machine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine with: %v", err)
 	}
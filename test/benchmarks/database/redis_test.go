@@ -16,7 +16,9 @@ package database
 
 import (
 	"context"
+	"net"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -60,13 +62,13 @@ func BenchmarkRedis(b *testing.B) {
 }
 
 func doBenchmarkRedis(b *testing.B, ops []string) {
-	clientMachine, err := harness.GetMachine()
+	clientMachine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine: %v", err)
 	}
 	defer clientMachine.CleanUp()
 
-	serverMachine, err := harness.GetMachine()
+	serverMachine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine: %v", err)
 	}
@@ -148,6 +150,76 @@ func doBenchmarkRedis(b *testing.B, ops []string) {
 	}
 }
 
+// BenchmarkRedisTailLatency measures latency percentiles of GET and SET at
+// fixed offered loads, using an open-loop client running in the benchmark
+// binary.
+func BenchmarkRedisTailLatency(b *testing.B) {
+	serverMachine, err := harness.GetMachine(b)
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer serverMachine.CleanUp()
+
+	port := 6379
+	ctx := context.Background()
+	server := serverMachine.GetContainer(ctx, b)
+	defer server.CleanUp(ctx)
+	if err := server.Spawn(ctx, dockerutil.RunOpts{
+		Image: "benchmarks/redis",
+		Ports: []int{port},
+	}); err != nil {
+		b.Fatalf("failed to start redis server with: %v", err)
+	}
+	if out, err := server.WaitForOutput(ctx, "Ready to accept connections", 3*time.Second); err != nil {
+		b.Fatalf("failed to start redis server: %v %s", err, out)
+	}
+	ip, err := serverMachine.IPAddress()
+	if err != nil {
+		b.Fatalf("failed to get server address: %v", err)
+	}
+	hostPort, err := server.FindPort(ctx, port)
+	if err != nil {
+		b.Fatalf("failed to find server port: %v", err)
+	}
+	addr := net.JoinHostPort(ip.String(), strconv.Itoa(hostPort))
+
+	commands := map[string][]string{
+		"SET": {"SET", "key", "value"},
+		"GET": {"GET", "key"},
+	}
+	for _, operation := range []string{"SET", "GET"} {
+		for _, rate := range []int{1000, 10000, 50000} {
+			name, err := tools.ParametersToName(tools.Parameter{
+				Name:  "operation",
+				Value: operation,
+			}, tools.Parameter{
+				Name:  "rate",
+				Value: strconv.Itoa(rate),
+			})
+			if err != nil {
+				b.Fatalf("Failed to parse parameters: %v", err)
+			}
+			b.Run(name, func(b *testing.B) {
+				req := &tools.RedisRequest{
+					Addr: addr,
+					Args: commands[operation],
+				}
+				loop := &tools.OpenLoop{
+					Rate:     float64(rate),
+					Requests: b.N,
+				}
+				b.ResetTimer()
+				res, err := loop.RunRequester(ctx, req)
+				if err != nil {
+					b.Fatalf("open-loop client failed: %v", err)
+				}
+				b.StopTimer()
+				res.Report(b)
+			})
+		}
+	}
+}
+
 func TestMain(m *testing.M) {
 	harness.Init()
 	os.Exit(m.Run())
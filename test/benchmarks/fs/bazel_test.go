@@ -26,20 +26,40 @@ import (
 
 // Note: CleanCache versions of this test require running with root permissions.
 func BenchmarkBuildABSL(b *testing.B) {
-	runBuildBenchmark(b, "benchmarks/absl", "/abseil-cpp", "absl/base/...")
+	runBuildBenchmark(b, "benchmarks/absl", "/abseil-cpp", harness.SmokeOr("absl/base/...", "absl/base:config"))
 }
 
 // Note: CleanCache versions of this test require running with root permissions.
 // Note: This test takes on the order of 6m per permutation for runsc on kvm.
 func BenchmarkBuildGRPC(b *testing.B) {
-	runBuildBenchmark(b, "benchmarks/build-grpc", "/grpc", ":grpc")
+	runBuildBenchmark(b, "benchmarks/build-grpc", "/grpc", harness.SmokeOr(":grpc", ":gpr"))
+}
+
+// BenchmarkSymlinkTreeABSL measures path resolution through the symlink
+// forest that bazel creates for its output tree and runfiles. The build itself
+// happens during setup and is not timed.
+func BenchmarkSymlinkTreeABSL(b *testing.B) {
+	ctx := context.Background()
+	machine, err := harness.GetMachine(b)
+	if err != nil {
+		b.Fatalf("Failed to get machine: %v", err)
+	}
+	defer machine.CleanUp()
+	fsbench.RunWithDifferentFilesystems(ctx, b, machine, fsbench.FSBenchmark{
+		Image:    "benchmarks/absl",
+		WorkDir:  "/abseil-cpp",
+		SetupCmd: []string{"bazel", "build", "-c", "opt", harness.SmokeOr("absl/base/...", "absl/base:config")},
+		// find -L stats every file reachable through bazel-bin and bazel-out,
+		// following all symlinks along the way.
+		RunCmd: []string{"find", "-L", "bazel-bin/", "bazel-out/", "-type", "f"},
+	})
 }
 
 func runBuildBenchmark(b *testing.B, image, workDir, target string) {
 	b.Helper()
 	ctx := context.Background()
 	// Get a machine from the Harness on which to run.
-	machine, err := harness.GetMachine()
+	machine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("Failed to get machine: %v", err)
 	}
@@ -172,7 +172,7 @@ func BenchmarkFioRandRead(b *testing.B) {
 }
 
 func doFioBenchmark(b *testing.B, testCases []tools.Fio) {
-	machine, err := harness.GetMachine()
+	machine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine with: %v", err)
 	}
@@ -252,13 +252,17 @@ func doFioBenchmark(b *testing.B, testCases []tools.Fio) {
 				}
 
 				// Run fio.
+				metrics := harness.NewRunscMetrics(container)
+				metrics.Start(ctx, b)
 				b.StartTimer()
 				data, err := container.Exec(ctx, dockerutil.ExecOpts{}, cmd...)
 				if err != nil {
 					b.Fatalf("failed to run cmd %v: %v", cmd, err)
 				}
 				b.StopTimer()
+				metrics.Stop(ctx, b)
 				tc.Report(b, data)
+				metrics.Report(b)
 			})
 		}
 	}
@@ -36,6 +36,9 @@ type FSBenchmark struct {
 	// The commands below are run from a directory that has the same file as what the container image
 	// has at this directory.
 	WorkDir string
+	// SetupCmd, if set, is run once before the benchmark starts, from the
+	// same directory as RunCmd. It is not timed.
+	SetupCmd []string
 	// RunCmd is the command to run to execute the benchmark.
 	RunCmd []string
 	// WantOutput, if set, is verified to be a substring of the output of RunCmd.
@@ -148,6 +151,15 @@ func RunWithDifferentFilesystems(ctx context.Context, b *testing.B, machine harn
 				b.Fatalf("failed to copy directory: %v (%s)", err, out)
 			}
 
+			if len(bm.SetupCmd) != 0 {
+				if out, err := container.Exec(ctx, dockerutil.ExecOpts{
+					WorkDir: prefix + bm.WorkDir,
+				}, bm.SetupCmd...); err != nil {
+					b.Fatalf("Setup command %v failed with: %v logs: %s", bm.SetupCmd, err, out)
+				}
+			}
+
+			metrics := harness.NewRunscMetrics(container)
 			b.ResetTimer()
 			b.StopTimer()
 
@@ -161,6 +173,7 @@ func RunWithDifferentFilesystems(ctx context.Context, b *testing.B, machine harn
 					}
 				}
 
+				metrics.Start(ctx, b)
 				b.StartTimer()
 				got, err := container.Exec(ctx, dockerutil.ExecOpts{
 					WorkDir: prefix + bm.WorkDir,
@@ -169,6 +182,7 @@ func RunWithDifferentFilesystems(ctx context.Context, b *testing.B, machine harn
 					b.Fatalf("Command %v failed with: %v logs: %s", bm.RunCmd, err, got)
 				}
 				b.StopTimer()
+				metrics.Stop(ctx, b)
 
 				if bm.WantOutput != "" && !strings.Contains(got, bm.WantOutput) {
 					b.Fatalf("string %s not in: %s", bm.WantOutput, got)
@@ -187,6 +201,7 @@ func RunWithDifferentFilesystems(ctx context.Context, b *testing.B, machine harn
 					}
 				}
 			}
+			metrics.Report(b)
 		})
 	}
 }
@@ -0,0 +1,108 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gpu
+
+import (
+	"context"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+	"gvisor.dev/gvisor/test/benchmarks/tools"
+)
+
+// BenchmarkCUDAMemcpy measures host-device copy bandwidth and latency under
+// the runtime being tested and natively, for pinned and pageable host memory
+// of various sizes. Small copies are dominated by per-call overhead (e.g.
+// nvproxy's ioctl forwarding) while large ones are dominated by the copy
+// itself, so comparing the two isolates where nvproxy adds overhead.
+func BenchmarkCUDAMemcpy(b *testing.B) {
+	sizes := []struct {
+		name       string
+		size       int
+		iterations int
+	}{
+		{name: "4KiB", size: 4 << 10, iterations: 1000},
+		{name: "1MiB", size: 1 << 20, iterations: 500},
+		{name: "64MiB", size: 64 << 20, iterations: 50},
+	}
+
+	machine, err := harness.GetMachine(b)
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer machine.CleanUp()
+
+	runtimes := []struct {
+		name         string
+		getContainer func(context.Context, testutil.Logger) *dockerutil.Container
+	}{
+		{name: "sandbox", getContainer: machine.GetContainer},
+		{name: "native", getContainer: machine.GetNativeContainer},
+	}
+
+	for _, rt := range runtimes {
+		for _, direction := range []string{"h2d", "d2h"} {
+			for _, memory := range []string{"pinned", "pageable"} {
+				for _, s := range sizes {
+					runName, err := tools.ParametersToName(tools.Parameter{
+						Name:  "runtime",
+						Value: rt.name,
+					}, tools.Parameter{
+						Name:  "direction",
+						Value: direction,
+					}, tools.Parameter{
+						Name:  "memory",
+						Value: memory,
+					}, tools.Parameter{
+						Name:  "size",
+						Value: s.name,
+					})
+					if err != nil {
+						b.Fatalf("Failed to parse param: %v", err)
+					}
+
+					b.Run(runName, func(b *testing.B) {
+						ctx := context.Background()
+						memcpy := tools.CUDAMemcpy{
+							Direction:  direction,
+							Memory:     memory,
+							Size:       s.size,
+							Iterations: harness.SmokeOr(s.iterations, 1),
+						}
+
+						harness.RunWithRetries(ctx, b, func(a *harness.Attempt) error {
+							container := a.Track(rt.getContainer(ctx, b))
+
+							opts := dockerutil.GPURunOpts()
+							opts.Image = "gpu/cuda-memcpy"
+							var out string
+							if err := a.Measure(harness.ClientRun, func(ctx context.Context) error {
+								var err error
+								out, err = container.Run(ctx, opts, memcpy.MakeCmd()...)
+								return err
+							}); err != nil {
+								return err
+							}
+							memcpy.Report(b, out)
+							return nil
+						})
+					})
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gvisor.dev/gvisor/test/benchmarks/tools"
+)
+
+var (
+	gpuSamplesDir = flag.String("gpu_samples_dir", "", "if set, GPU time series recorded by GPUSampler are written as CSV files to this directory")
+)
+
+// GPUSampler records a time series of GPU utilization, memory and PCIe
+// throughput using 'nvidia-smi dmon' on a machine, alongside benchmark
+// containers. This captures signals that the sandbox's own metrics cannot,
+// e.g. GPU starvation caused by the runtime.
+type GPUSampler struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+
+	// mu protects the fields below.
+	mu      sync.Mutex
+	samples []tools.GPUSample
+	err     error
+}
+
+// StartGPUSampler starts sampling GPU metrics of machine at the given
+// interval.
+func StartGPUSampler(machine Machine, interval time.Duration) (*GPUSampler, error) {
+	dmon := &tools.NvidiaSMIDmon{Interval: interval}
+	args := dmon.MakeCmd()
+	cmd, err := machine.Command(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %q: %v", strings.Join(args, " "), err)
+	}
+
+	s := &GPUSampler{
+		cmd:  cmd,
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		var parser tools.DmonParser
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			sample, ok, err := parser.ParseLine(scanner.Text(), time.Now())
+			s.mu.Lock()
+			s.setErrLocked(err)
+			if ok {
+				s.samples = append(s.samples, sample)
+			}
+			s.mu.Unlock()
+		}
+		if err := scanner.Err(); err != nil {
+			s.mu.Lock()
+			s.setErrLocked(fmt.Errorf("failed to read nvidia-smi output: %v", err))
+			s.mu.Unlock()
+		}
+	}()
+	return s, nil
+}
+
+// setErrLocked records err if it is the first error.
+//
+// Preconditions: s.mu is locked.
+func (s *GPUSampler) setErrLocked(err error) {
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+// Stop stops sampling and returns all samples. If --gpu_samples_dir is set,
+// the samples are also written to a CSV file named after name, which may be
+// e.g. a benchmark name.
+//
+// An error is returned if nvidia-smi failed or its output could not be
+// parsed, along with the samples recorded until then.
+func (s *GPUSampler) Stop(name string) ([]tools.GPUSample, error) {
+	var killed bool
+	if err := s.cmd.Process.Kill(); err == nil {
+		killed = true
+	} else if !errors.Is(err, os.ErrProcessDone) {
+		return nil, fmt.Errorf("failed to kill nvidia-smi: %v", err)
+	}
+	<-s.done
+	waitErr := s.cmd.Wait()
+
+	s.mu.Lock()
+	samples, err := s.samples, s.err
+	s.mu.Unlock()
+	if err != nil {
+		return samples, err
+	}
+	if waitErr != nil && !(killed && isKilled(waitErr)) {
+		// nvidia-smi exited on its own before being stopped.
+		return samples, fmt.Errorf("nvidia-smi failed: %v", waitErr)
+	}
+	if *gpuSamplesDir != "" {
+		if err := writeGPUSamples(filepath.Join(*gpuSamplesDir, sanitizeFileName(name)+".csv"), samples); err != nil {
+			return samples, err
+		}
+	}
+	return samples, nil
+}
+
+// isKilled returns true if err reports that a command was killed by SIGKILL.
+func isKilled(err error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && status.Signal() == syscall.SIGKILL
+}
+
+// writeGPUSamples writes samples to path as CSV, one row per sample.
+func writeGPUSamples(path string, samples []tools.GPUSample) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"timestamp_ms", "gpu", "sm_percent", "mem_percent", "fb_mb", "rxpci_mbps", "txpci_mbps"})
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	for _, s := range samples {
+		w.Write([]string{
+			strconv.FormatInt(s.Time.UnixMilli(), 10),
+			strconv.Itoa(s.GPU),
+			format(s.SMUtilization),
+			format(s.MemoryUtilization),
+			format(s.MemoryUsedMB),
+			format(s.PCIeRxMBps),
+			format(s.PCIeTxMBps),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// sanitizeFileName replaces characters that are unsuitable in file names,
+// such as the slashes in sub-benchmark names.
+func sanitizeFileName(name string) string {
+	return strings.NewReplacer("/", "_", " ", "_").Replace(name)
+}
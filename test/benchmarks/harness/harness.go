@@ -19,6 +19,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"sync"
+	"testing"
 
 	"gvisor.dev/gvisor/pkg/test/dockerutil"
 )
@@ -26,8 +28,32 @@ import (
 var (
 	help  = flag.Bool("help", false, "print this usage message")
 	debug = flag.Bool("debug", false, "turns on debug messages for individual benchmarks")
+
+	// The following flags configure a separate physical host, typically used
+	// for benchmark clients so that they don't compete with the server.
+	clientHost           = flag.String("client_host", "", "SSH destination (user@host) of a separate machine to be returned by GetMachine, e.g. for benchmark clients")
+	clientDockerEndpoint = flag.String("client_docker_endpoint", "", "Docker daemon endpoint of the separate machine (e.g. tcp://host:2375); defaults to port 2375 on --client_host")
+
+	// isolatedMachines carves the local host into several machines, so that
+	// e.g. benchmark clients and servers get disjoint CPUs and memory.
+	isolatedMachines = flag.Int("isolated_machines", 0, "if at least 2, GetMachine splits this host into this many machines with disjoint CPUs and memory, using cgroups; requires root")
 )
 
+// machines tracks which machines have been handed out by GetMachine.
+var machines struct {
+	mu sync.Mutex
+
+	// localInUse is true if the local machine has been handed out.
+	localInUse bool
+
+	// remoteInUse is true if the remote machine has been handed out.
+	remoteInUse bool
+
+	// isolatedInUse[i] is true if the i'th isolated machine has been handed
+	// out.
+	isolatedInUse []bool
+}
+
 // Init performs any harness initilialization before runs.
 func Init() error {
 	flag.Usage = func() {
@@ -39,6 +65,9 @@ func Init() error {
 		flag.Usage()
 		os.Exit(0)
 	}
+	if *smoke {
+		SetFixedBenchmarks()
+	}
 	dockerutil.EnsureSupportedDockerVersion()
 	return nil
 }
@@ -51,7 +80,78 @@ func SetFixedBenchmarks() {
 	flag.Set("test.benchtime", "1ns")
 }
 
-// GetMachine returns this run's implementation of machine.
-func GetMachine() (Machine, error) {
+// GetMachine returns this run's implementation of machine for use by tb.
+//
+// If a remote machine is configured via --client_host or
+// --client_docker_endpoint, the first outstanding call returns the local
+// machine and the second returns the remote machine. Benchmarks that need a
+// client and a server should therefore get the server machine first. Calling
+// CleanUp on a machine returns it to the pool. When all machines are in use,
+// the local machine is shared, which is logged to tb.
+//
+// If --isolated_machines is set, outstanding calls instead return successive
+// slices of the local host, each confined to its own CPUs and memory.
+func GetMachine(tb testing.TB) (Machine, error) {
+	endpoint := remoteEndpoint()
+	machines.mu.Lock()
+	defer machines.mu.Unlock()
+	if *isolatedMachines > 1 {
+		if endpoint != "" {
+			return nil, fmt.Errorf("--isolated_machines cannot be combined with --client_host or --client_docker_endpoint")
+		}
+		return getIsolatedMachineLocked(tb)
+	}
+	if endpoint == "" || !machines.localInUse {
+		machines.localInUse = true
+		return &localMachine{release: releaseLocal}, nil
+	}
+	if !machines.remoteInUse {
+		machines.remoteInUse = true
+		return &remoteMachine{
+			sshHost:        *clientHost,
+			dockerEndpoint: endpoint,
+			release:        releaseRemote,
+		}, nil
+	}
+	tb.Logf("Both the local and remote machines are in use, sharing the local machine")
 	return &localMachine{}, nil
 }
+
+// getIsolatedMachineLocked returns the first isolated machine not in use.
+//
+// Preconditions: machines.mu is locked.
+func getIsolatedMachineLocked(tb testing.TB) (Machine, error) {
+	if machines.isolatedInUse == nil {
+		machines.isolatedInUse = make([]bool, *isolatedMachines)
+	}
+	for i, inUse := range machines.isolatedInUse {
+		if inUse {
+			continue
+		}
+		m, err := newIsolatedMachine(tb, i, len(machines.isolatedInUse), func() {
+			machines.mu.Lock()
+			defer machines.mu.Unlock()
+			machines.isolatedInUse[i] = false
+		})
+		if err != nil {
+			return nil, err
+		}
+		machines.isolatedInUse[i] = true
+		return m, nil
+	}
+	// Unlike the local machine, an isolated machine can't be shared without
+	// losing the isolation that the benchmark asked for.
+	return nil, fmt.Errorf("all %d isolated machines are in use; increase --isolated_machines", len(machines.isolatedInUse))
+}
+
+func releaseLocal() {
+	machines.mu.Lock()
+	defer machines.mu.Unlock()
+	machines.localInUse = false
+}
+
+func releaseRemote() {
+	machines.mu.Lock()
+	defer machines.mu.Unlock()
+	machines.remoteInUse = false
+}
@@ -0,0 +1,344 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+	"gvisor.dev/gvisor/runsc/cgroup"
+)
+
+// isolatedMachine is a slice of the local host, with its own CPUs and share
+// of memory. All containers of the machine are created under a cgroup that
+// holds these limits, so that containers of different isolated machines do
+// not compete for CPU or memory.
+type isolatedMachine struct {
+	localMachine
+
+	// cpus and mems are the cpuset of the machine.
+	cpus string
+	mems string
+
+	// memory is the memory limit of the machine in bytes.
+	memory int64
+
+	// parent is the cgroup parent of the machine's containers, in the format
+	// expected by the Docker daemon.
+	parent string
+
+	// uninstall removes the machine's cgroup.
+	uninstall func() error
+
+	// containers are the containers handed out by the machine, which must be
+	// removed before its cgroup.
+	containers []*dockerutil.Container
+
+	// tb is the benchmark that got the machine. Failures to remove the cgroup
+	// fail it.
+	tb testing.TB
+}
+
+// newIsolatedMachine returns the index'th of count isolated machines carved
+// out of the local host, for use by tb.
+func newIsolatedMachine(tb testing.TB, index, count int, release func()) (*isolatedMachine, error) {
+	topo, err := hostTopology()
+	if err != nil {
+		return nil, err
+	}
+	cpus, mems, err := topo.isolatedCPUs(index, count)
+	if err != nil {
+		return nil, err
+	}
+	total, err := memTotal()
+	if err != nil {
+		return nil, err
+	}
+	m := &isolatedMachine{
+		localMachine: localMachine{release: release},
+		cpus:         cpus,
+		mems:         mems,
+		memory:       total / int64(count),
+		tb:           tb,
+	}
+
+	useSystemd, err := dockerutil.UsingSystemdCgroup()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine Docker cgroup driver: %v", err)
+	}
+	if useSystemd {
+		err = m.installSlice(fmt.Sprintf("gvisor_benchmark_machine%d.slice", index))
+	} else {
+		err = m.installCgroup(fmt.Sprintf("/gvisor-benchmark/machine%d", index))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up isolated machine %d (cpus %q, mems %q): %v", index, cpus, mems, err)
+	}
+	return m, nil
+}
+
+// installCgroup creates the machine's cgroup at path, for Docker's cgroupfs
+// driver.
+func (m *isolatedMachine) installCgroup(path string) error {
+	cg, err := cgroup.NewFromPath(path, false /* useSystemd */)
+	if err != nil {
+		return err
+	}
+	if err := cg.Install(&specs.LinuxResources{
+		CPU: &specs.LinuxCPU{
+			Cpus: m.cpus,
+			Mems: m.mems,
+		},
+		Memory: &specs.LinuxMemory{
+			Limit: &m.memory,
+		},
+	}); err != nil {
+		return err
+	}
+	m.parent = path
+	m.uninstall = cg.Uninstall
+	return nil
+}
+
+// installSlice creates the machine's slice, for Docker's systemd driver. This
+// requires cgroup v2.
+func (m *isolatedMachine) installSlice(slice string) error {
+	if out, err := exec.Command("systemctl", "start", slice).CombinedOutput(); err != nil {
+		return fmt.Errorf("systemctl start %s: %v: %s", slice, err, out)
+	}
+	props := []string{
+		"AllowedCPUs=" + m.cpus,
+		"AllowedMemoryNodes=" + m.mems,
+		"MemoryMax=" + strconv.FormatInt(m.memory, 10),
+	}
+	args := append([]string{"set-property", "--runtime", slice}, props...)
+	if out, err := exec.Command("systemctl", args...).CombinedOutput(); err != nil {
+		exec.Command("systemctl", "stop", slice).Run()
+		return fmt.Errorf("systemctl %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	m.parent = slice
+	m.uninstall = func() error {
+		if out, err := exec.Command("systemctl", "stop", slice).CombinedOutput(); err != nil {
+			return fmt.Errorf("systemctl stop %s: %v: %s", slice, err, out)
+		}
+		return nil
+	}
+	return nil
+}
+
+// GetContainer implements Machine.GetContainer for isolatedMachine.
+func (m *isolatedMachine) GetContainer(ctx context.Context, logger testutil.Logger) *dockerutil.Container {
+	return m.track(m.localMachine.GetContainer(ctx, logger))
+}
+
+// GetNativeContainer implements Machine.GetNativeContainer for
+// isolatedMachine.
+func (m *isolatedMachine) GetNativeContainer(ctx context.Context, logger testutil.Logger) *dockerutil.Container {
+	return m.track(m.localMachine.GetNativeContainer(ctx, logger))
+}
+
+// track confines c to the machine's cgroup and records it for CleanUp.
+func (m *isolatedMachine) track(c *dockerutil.Container) *dockerutil.Container {
+	c.SetCgroupParent(m.parent)
+	m.containers = append(m.containers, c)
+	return c
+}
+
+// RunCommand implements Machine.RunCommand for isolatedMachine. The command
+// runs on the machine's CPUs.
+func (m *isolatedMachine) RunCommand(cmd string, args ...string) (string, error) {
+	return m.localMachine.RunCommand("taskset", append([]string{"-c", m.cpus, cmd}, args...)...)
+}
+
+// Command implements Machine.Command for isolatedMachine. The command runs on
+// the machine's CPUs.
+func (m *isolatedMachine) Command(cmd string, args ...string) (*exec.Cmd, error) {
+	return m.localMachine.Command("taskset", append([]string{"-c", m.cpus, cmd}, args...)...)
+}
+
+// CleanUp implements Machine.CleanUp. It removes any containers of the
+// machine that are still around, including those of a Server, then removes
+// the machine's cgroup and returns the machine to the pool. Failing to remove
+// the cgroup fails the benchmark, since it would leave CPUs and memory
+// reserved for the rest of the run.
+func (m *isolatedMachine) CleanUp() {
+	ctx := context.Background()
+	for _, c := range m.containers {
+		// Containers already removed by their owner have no status.
+		if _, err := c.Status(ctx); err == nil {
+			c.CleanUp(ctx)
+		}
+	}
+	m.containers = nil
+	if m.uninstall != nil {
+		if err := m.uninstall(); err != nil {
+			m.tb.Errorf("failed to remove cgroup %q of isolated machine: %v", m.parent, err)
+		}
+		m.uninstall = nil
+	}
+	m.localMachine.CleanUp()
+}
+
+// topology describes the CPUs and NUMA nodes of a host.
+type topology struct {
+	// online are the online CPUs.
+	online []int
+
+	// nodes are the online NUMA nodes.
+	nodes []int
+
+	// nodeCPUs maps each node in nodes to its CPUs.
+	nodeCPUs map[int][]int
+}
+
+// hostTopology returns the topology of the local host.
+func hostTopology() (topology, error) {
+	var t topology
+	var err error
+	if t.online, err = readCPUList("/sys/devices/system/cpu/online"); err != nil {
+		return t, err
+	}
+	t.nodes, err = readCPUList("/sys/devices/system/node/online")
+	if os.IsNotExist(err) {
+		// No NUMA support; all CPUs are on node 0.
+		t.nodes = []int{0}
+		t.nodeCPUs = map[int][]int{0: t.online}
+		return t, nil
+	}
+	if err != nil {
+		return t, err
+	}
+	t.nodeCPUs = make(map[int][]int)
+	for _, node := range t.nodes {
+		if t.nodeCPUs[node], err = readCPUList(fmt.Sprintf("/sys/devices/system/node/node%d/cpulist", node)); err != nil {
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+// isolatedCPUs returns the cpuset of the index'th of count isolated machines.
+//
+// If the host has at least count NUMA nodes, each machine gets whole nodes
+// and their CPUs. Otherwise, the online CPUs are split evenly and all
+// machines share the memory nodes.
+func (t topology) isolatedCPUs(index, count int) (cpus, mems string, err error) {
+	if len(t.nodes) >= count {
+		nodes := t.nodes[index*len(t.nodes)/count : (index+1)*len(t.nodes)/count]
+		var ids []int
+		for _, node := range nodes {
+			ids = append(ids, t.nodeCPUs[node]...)
+		}
+		if len(ids) == 0 {
+			return "", "", fmt.Errorf("no CPUs on NUMA nodes %v", nodes)
+		}
+		return formatCPUList(ids), formatCPUList(nodes), nil
+	}
+	if len(t.online) < count {
+		return "", "", fmt.Errorf("cannot split %d CPUs into %d machines", len(t.online), count)
+	}
+	ids := t.online[index*len(t.online)/count : (index+1)*len(t.online)/count]
+	return formatCPUList(ids), formatCPUList(t.nodes), nil
+}
+
+// readCPUList reads a file in the kernel's list format.
+func readCPUList(path string) ([]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := parseCPUList(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return ids, nil
+}
+
+// parseCPUList parses a list in the kernel's list format (e.g. "0-3,8").
+func parseCPUList(list string) ([]int, error) {
+	var ids []int
+	for _, r := range strings.Split(strings.TrimSpace(list), ",") {
+		if r == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(r, "-")
+		start, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("invalid list %q", list)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(last); err != nil || end < start {
+				return nil, fmt.Errorf("invalid list %q", list)
+			}
+		}
+		for id := start; id <= end; id++ {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// formatCPUList formats ids, which must be sorted, in the kernel's list
+// format.
+func formatCPUList(ids []int) string {
+	var ranges []string
+	for i := 0; i < len(ids); {
+		j := i + 1
+		for j < len(ids) && ids[j] == ids[j-1]+1 {
+			j++
+		}
+		if j-i == 1 {
+			ranges = append(ranges, strconv.Itoa(ids[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", ids[i], ids[j-1]))
+		}
+		i = j
+	}
+	return strings.Join(ranges, ",")
+}
+
+// memTotal returns the total memory of the host in bytes.
+func memTotal() (int64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "MemTotal:" && fields[2] == "kB" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid MemTotal %q: %v", fields[1], err)
+			}
+			return kb * 1024, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("MemTotal not found in /proc/meminfo")
+}
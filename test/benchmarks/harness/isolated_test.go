@@ -0,0 +1,117 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCPUList(t *testing.T) {
+	for _, tc := range []struct {
+		list    string
+		want    []int
+		wantErr bool
+	}{
+		{list: "", want: nil},
+		{list: "0\n", want: []int{0}},
+		{list: "0-3", want: []int{0, 1, 2, 3}},
+		{list: "0-1,4,6-7\n", want: []int{0, 1, 4, 6, 7}},
+		{list: "x", wantErr: true},
+		{list: "0-", wantErr: true},
+		{list: "3-1", wantErr: true},
+	} {
+		t.Run(tc.list, func(t *testing.T) {
+			got, err := parseCPUList(tc.list)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("parseCPUList(%q) = %v, want error", tc.list, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCPUList(%q) failed: %v", tc.list, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseCPUList(%q) = %v, want %v", tc.list, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFormatCPUList(t *testing.T) {
+	for _, tc := range []struct {
+		ids  []int
+		want string
+	}{
+		{ids: nil, want: ""},
+		{ids: []int{2}, want: "2"},
+		{ids: []int{0, 1, 2, 3}, want: "0-3"},
+		{ids: []int{0, 2, 4}, want: "0,2,4"},
+		{ids: []int{0, 1, 4, 6, 7}, want: "0-1,4,6-7"},
+	} {
+		if got := formatCPUList(tc.ids); got != tc.want {
+			t.Errorf("formatCPUList(%v) = %q, want %q", tc.ids, got, tc.want)
+		}
+	}
+}
+
+func TestIsolatedCPUs(t *testing.T) {
+	singleNode := topology{
+		online:   []int{0, 1, 2, 3, 4, 5, 6, 7},
+		nodes:    []int{0},
+		nodeCPUs: map[int][]int{0: {0, 1, 2, 3, 4, 5, 6, 7}},
+	}
+	twoNodes := topology{
+		online: []int{0, 1, 2, 3, 4, 5, 6, 7},
+		nodes:  []int{0, 1},
+		// Interleaved, as on many two-socket hosts.
+		nodeCPUs: map[int][]int{0: {0, 2, 4, 6}, 1: {1, 3, 5, 7}},
+	}
+	for _, tc := range []struct {
+		name     string
+		topo     topology
+		index    int
+		count    int
+		wantCPUs string
+		wantMems string
+		wantErr  bool
+	}{
+		{name: "split first", topo: singleNode, index: 0, count: 2, wantCPUs: "0-3", wantMems: "0"},
+		{name: "split second", topo: singleNode, index: 1, count: 2, wantCPUs: "4-7", wantMems: "0"},
+		{name: "split uneven", topo: singleNode, index: 2, count: 3, wantCPUs: "5-7", wantMems: "0"},
+		{name: "node first", topo: twoNodes, index: 0, count: 2, wantCPUs: "0,2,4,6", wantMems: "0"},
+		{name: "node second", topo: twoNodes, index: 1, count: 2, wantCPUs: "1,3,5,7", wantMems: "1"},
+		{name: "more machines than nodes", topo: twoNodes, index: 3, count: 4, wantCPUs: "6-7", wantMems: "0-1"},
+		{name: "too many machines", topo: singleNode, index: 0, count: 9, wantErr: true},
+		{name: "cpuless node", topo: topology{online: []int{0}, nodes: []int{0, 1}, nodeCPUs: map[int][]int{0: {0}}}, index: 1, count: 2, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cpus, mems, err := tc.topo.isolatedCPUs(tc.index, tc.count)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("isolatedCPUs(%d, %d) = %q, %q, want error", tc.index, tc.count, cpus, mems)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("isolatedCPUs(%d, %d) failed: %v", tc.index, tc.count, err)
+			}
+			if cpus != tc.wantCPUs || mems != tc.wantMems {
+				t.Errorf("isolatedCPUs(%d, %d) = %q, %q, want %q, %q", tc.index, tc.count, cpus, mems, tc.wantCPUs, tc.wantMems)
+			}
+		})
+	}
+}
@@ -37,6 +37,10 @@ type Machine interface {
 	// RunCommand runs cmd on this machine.
 	RunCommand(cmd string, args ...string) (string, error)
 
+	// Command returns an unstarted command that runs cmd on this machine,
+	// for commands whose output must be streamed.
+	Command(cmd string, args ...string) (*exec.Cmd, error)
+
 	// Returns IP Address for the machine.
 	IPAddress() (net.IP, error)
 
@@ -46,6 +50,8 @@ type Machine interface {
 
 // localMachine describes this machine.
 type localMachine struct {
+	// release returns the machine to the pool, if set.
+	release func()
 }
 
 // GetContainer implements Machine.GetContainer for localMachine.
@@ -65,6 +71,11 @@ func (l *localMachine) RunCommand(cmd string, args ...string) (string, error) {
 	return string(out), err
 }
 
+// Command implements Machine.Command for localMachine.
+func (l *localMachine) Command(cmd string, args ...string) (*exec.Cmd, error) {
+	return exec.Command(cmd, args...), nil
+}
+
 // IPAddress implements Machine.IPAddress.
 func (l *localMachine) IPAddress() (net.IP, error) {
 	addrs, err := net.InterfaceAddrs()
@@ -82,6 +93,10 @@ func (l *localMachine) IPAddress() (net.IP, error) {
 	return nil, errors.New("no IPAddress available")
 }
 
-// CleanUp implements Machine.CleanUp and does nothing for localMachine.
-func (*localMachine) CleanUp() {
+// CleanUp implements Machine.CleanUp and returns the machine to the pool.
+func (l *localMachine) CleanUp() {
+	if l.release != nil {
+		l.release()
+		l.release = nil
+	}
 }
@@ -0,0 +1,190 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/tools"
+)
+
+var (
+	runscMetrics       = flag.Bool("runsc_metrics", false, "report the change of runsc's internal counters (gofer RPCs, syscalls, netstack) over the timed window of benchmarks that support it; run the runtime with --syscall-metrics to get syscall counts")
+	runscMetricsFilter = flag.String("runsc_metrics_filter", `^(gofer_.*|syscalls|netstack_.*)$`, "regular expression selecting the runsc metrics reported by --runsc_metrics, matched against Prometheus metric names")
+)
+
+// ignoredMetricLabels are labels added by "runsc export-metrics" that are the
+// same for all samples of a sandbox, and so are dropped from metric names.
+var ignoredMetricLabels = map[string]bool{
+	"iteration":      true,
+	"namespace_name": true,
+	"pod_name":       true,
+	"sandbox":        true,
+}
+
+// RunscMetrics measures the change of runsc's internal counters in a
+// container over the timed window of a benchmark, so that benchmarks also
+// track the resources (e.g. gofer RPCs or syscalls) used by the workload. It
+// does nothing unless --runsc_metrics is set.
+//
+// Start and Stop may be called several times, e.g. once per iteration, and
+// the changes are accumulated.
+type RunscMetrics struct {
+	container *dockerutil.Container
+	before    map[string]float64
+	deltas    map[string]float64
+}
+
+// NewRunscMetrics returns a RunscMetrics for container, which must be
+// running when Start and Stop are called.
+func NewRunscMetrics(container *dockerutil.Container) *RunscMetrics {
+	return &RunscMetrics{
+		container: container,
+		deltas:    make(map[string]float64),
+	}
+}
+
+// Start takes a snapshot of the counters at the beginning of a timed window.
+// The benchmark timer should be stopped while it is called.
+func (m *RunscMetrics) Start(ctx context.Context, b *testing.B) {
+	b.Helper()
+	if !*runscMetrics {
+		return
+	}
+	before, err := m.snapshot(ctx)
+	if err != nil {
+		b.Fatalf("failed to snapshot runsc metrics: %v", err)
+	}
+	m.before = before
+}
+
+// Stop takes a snapshot of the counters at the end of a timed window, and
+// accumulates their change since Start. The benchmark timer should be
+// stopped while it is called.
+func (m *RunscMetrics) Stop(ctx context.Context, b *testing.B) {
+	b.Helper()
+	if !*runscMetrics {
+		return
+	}
+	if m.before == nil {
+		b.Fatalf("RunscMetrics.Stop called without Start")
+	}
+	after, err := m.snapshot(ctx)
+	if err != nil {
+		b.Fatalf("failed to snapshot runsc metrics: %v", err)
+	}
+	for name, val := range diffMetrics(m.before, after) {
+		m.deltas[name] += val
+	}
+	m.before = nil
+}
+
+// Report reports the accumulated change of every counter that changed, per
+// benchmark iteration.
+func (m *RunscMetrics) Report(b *testing.B) {
+	b.Helper()
+	names := make([]string, 0, len(m.deltas))
+	for name := range m.deltas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tools.ReportCustomMetric(b, m.deltas[name]/float64(b.N), "runsc_"+name /*metric name*/, "count" /*unit*/)
+	}
+}
+
+// snapshot returns the current value of the selected runsc metrics.
+func (m *RunscMetrics) snapshot(ctx context.Context) (map[string]float64, error) {
+	path, err := dockerutil.RuntimePath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get runtime path: %v", err)
+	}
+	rootDir, err := m.container.RootDirectory()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get root directory: %v", err)
+	}
+	cmd := exec.CommandContext(ctx, path, fmt.Sprintf("--root=%s", rootDir), "export-metrics", "--exporter-prefix=", fmt.Sprintf("--sandbox-metrics-filter=%s", *runscMetricsFilter), m.container.ID())
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v failed: %v", cmd.Args, err)
+	}
+	return parseMetrics(string(out))
+}
+
+// metricSample matches a sample line in the Prometheus text format, e.g.
+// `gofer_rpcs{rpc="PRead",sandbox="abc"} 12 1700000000000`.
+var metricSample = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(?:\{(.*)\})?\s+(\S+)(?:\s+\S+)?$`)
+
+// metricLabel matches a label of a Prometheus sample.
+var metricLabel = regexp.MustCompile(`([a-zA-Z_][a-zA-Z0-9_]*)="((?:[^"\\]|\\.)*)"`)
+
+// parseMetrics parses metrics in the Prometheus text format, as printed by
+// "runsc export-metrics". Samples are keyed by metric name followed by the
+// values of their labels, other than ignoredMetricLabels, e.g.
+// "gofer_rpcs_PRead". Characters that can't be used in benchmark metric
+// names are replaced by underscores.
+func parseMetrics(data string) (map[string]float64, error) {
+	metrics := make(map[string]float64)
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		match := metricSample.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("malformed metric sample: %q", line)
+		}
+		val, err := strconv.ParseFloat(match[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed value in metric sample %q: %v", line, err)
+		}
+		name := match[1]
+		for _, label := range metricLabel.FindAllStringSubmatch(match[2], -1) {
+			if ignoredMetricLabels[label[1]] {
+				continue
+			}
+			name += "_" + label[2]
+		}
+		metrics[illegalChars.ReplaceAllString(name, "_")] = val
+	}
+	return metrics, scanner.Err()
+}
+
+// illegalChars matches characters that can't be used in the names of metrics
+// reported with tools.ReportCustomMetric.
+var illegalChars = regexp.MustCompile(`[^a-zA-Z0-9_\-]`)
+
+// diffMetrics returns the non-zero changes of metrics from before to after.
+// Metrics missing from before are counted from zero.
+func diffMetrics(before, after map[string]float64) map[string]float64 {
+	deltas := make(map[string]float64)
+	for name, val := range after {
+		if d := val - before[name]; d != 0 {
+			deltas[name] = d
+		}
+	}
+	return deltas
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testMetrics = `# Command-line export for sandbox abc (filtered using regular expression: "^(gofer_.*|syscalls|netstack_.*)$")
+
+# HELP gofer_rpcs Number of lisafs RPCs made to gofers, broken down by message type.
+# TYPE gofer_rpcs counter
+gofer_rpcs{iteration="1a2b",rpc="PRead",sandbox="abc"} 12 1700000000000
+gofer_rpcs{iteration="1a2b",rpc="Walk",sandbox="abc"} 3 1700000000000
+
+# HELP syscalls Number of times the application called each syscall.
+# TYPE syscalls counter
+syscalls{sandbox="abc",sysno="0"} 100 1700000000000
+syscalls{sandbox="abc",sysno="-1"} 1 1700000000000
+
+# HELP netstack_dropped_packets Number of packets dropped at the transport layer.
+# TYPE netstack_dropped_packets counter
+netstack_dropped_packets{pod_name="p",namespace_name="ns",sandbox="abc"} 7
+`
+
+func TestParseMetrics(t *testing.T) {
+	got, err := parseMetrics(testMetrics)
+	if err != nil {
+		t.Fatalf("parseMetrics() failed: %v", err)
+	}
+	want := map[string]float64{
+		"gofer_rpcs_PRead":         12,
+		"gofer_rpcs_Walk":          3,
+		"syscalls_0":               100,
+		"syscalls_-1":              1,
+		"netstack_dropped_packets": 7,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMetrics() = %v, want %v", got, want)
+	}
+
+	if _, err := parseMetrics("gofer_rpcs{rpc=\"PRead\"} twelve\n"); err == nil {
+		t.Errorf("parseMetrics() with malformed value succeeded, want error")
+	}
+}
+
+func TestDiffMetrics(t *testing.T) {
+	before := map[string]float64{
+		"gofer_rpcs_PRead": 12,
+		"gofer_rpcs_Walk":  3,
+	}
+	after := map[string]float64{
+		"gofer_rpcs_PRead": 20,
+		"gofer_rpcs_Walk":  3,
+		"syscalls_0":       5,
+	}
+	want := map[string]float64{
+		"gofer_rpcs_PRead": 8,
+		"syscalls_0":       5,
+	}
+	if got := diffMetrics(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffMetrics() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os/exec"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+// remoteMachine describes a separate physical host, reachable via SSH for
+// commands and via a TCP Docker endpoint for containers.
+type remoteMachine struct {
+	// sshHost is the SSH destination (e.g. "user@host"). May be empty, in
+	// which case RunCommand is unsupported.
+	sshHost string
+
+	// dockerEndpoint is the Docker daemon endpoint (e.g. "tcp://host:2375").
+	dockerEndpoint string
+
+	// release returns the machine to the pool.
+	release func()
+}
+
+// GetContainer implements Machine.GetContainer for remoteMachine.
+func (r *remoteMachine) GetContainer(ctx context.Context, logger testutil.Logger) *dockerutil.Container {
+	return dockerutil.MakeContainerOnHost(ctx, logger, r.dockerEndpoint)
+}
+
+// GetNativeContainer implements Machine.GetNativeContainer for remoteMachine.
+func (r *remoteMachine) GetNativeContainer(ctx context.Context, logger testutil.Logger) *dockerutil.Container {
+	return dockerutil.MakeNativeContainerOnHost(ctx, logger, r.dockerEndpoint)
+}
+
+// RunCommand implements Machine.RunCommand for remoteMachine.
+//
+// The command is run via ssh, and each argument is quoted for the remote
+// shell.
+func (r *remoteMachine) RunCommand(cmd string, args ...string) (string, error) {
+	c, err := r.Command(cmd, args...)
+	if err != nil {
+		return "", err
+	}
+	out, err := c.CombinedOutput()
+	return string(out), err
+}
+
+// Command implements Machine.Command for remoteMachine. Killing the returned
+// command only kills the local ssh client; the remote command exits once it
+// next writes its output.
+func (r *remoteMachine) Command(cmd string, args ...string) (*exec.Cmd, error) {
+	if r.sshHost == "" {
+		return nil, fmt.Errorf("cannot run %q: no SSH host configured for remote machine (set --client_host)", cmd)
+	}
+	quoted := make([]string, 0, len(args)+1)
+	quoted = append(quoted, shellQuote(cmd))
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return exec.Command("ssh", "-o", "BatchMode=yes", r.sshHost, strings.Join(quoted, " ")), nil
+}
+
+// IPAddress implements Machine.IPAddress for remoteMachine.
+func (r *remoteMachine) IPAddress() (net.IP, error) {
+	host := r.hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, nil
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve remote machine %q: %v", host, err)
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip, nil
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no IP address for remote machine %q", host)
+	}
+	return ips[0], nil
+}
+
+// CleanUp implements Machine.CleanUp. It returns the machine to the pool.
+func (r *remoteMachine) CleanUp() {
+	if r.release != nil {
+		r.release()
+		r.release = nil
+	}
+}
+
+// hostname returns the network name of the remote machine, preferring the
+// Docker endpoint host over the SSH destination.
+func (r *remoteMachine) hostname() string {
+	if u, err := url.Parse(r.dockerEndpoint); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	host := r.sshHost
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+	return host
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// remoteEndpoint returns the Docker endpoint to use for the remote machine
+// given the configured flags, or the empty string if no remote machine is
+// configured.
+func remoteEndpoint() string {
+	switch {
+	case *clientDockerEndpoint != "":
+		return *clientDockerEndpoint
+	case *clientHost != "":
+		host := *clientHost
+		if i := strings.LastIndex(host, "@"); i >= 0 {
+			host = host[i+1:]
+		}
+		return fmt.Sprintf("tcp://%s", net.JoinHostPort(host, "2375"))
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+)
+
+var (
+	maxAttempts        = flag.Int("max_attempts", 1, "number of times a benchmark run with harness.RunWithRetries is attempted before it is marked as failed")
+	serverStartTimeout = flag.Duration("server_start_timeout", 10*time.Minute, "timeout for starting a benchmark server and waiting for it to be ready")
+	clientRunTimeout   = flag.Duration("client_run_timeout", 30*time.Minute, "timeout for running a benchmark client")
+)
+
+// logCollectionTimeout bounds how long collecting logs of a failed attempt
+// may take.
+const logCollectionTimeout = time.Minute
+
+// Phase is a part of a benchmark run with its own timeout.
+type Phase int
+
+const (
+	// ServerStart is starting a server and waiting until it is ready.
+	ServerStart Phase = iota
+
+	// ClientRun is running the benchmark client.
+	ClientRun
+)
+
+// String implements fmt.Stringer.
+func (p Phase) String() string {
+	switch p {
+	case ServerStart:
+		return "server start"
+	case ClientRun:
+		return "client run"
+	default:
+		return fmt.Sprintf("Phase(%d)", int(p))
+	}
+}
+
+func (p Phase) timeout() time.Duration {
+	switch p {
+	case ServerStart:
+		return *serverStartTimeout
+	case ClientRun:
+		return *clientRunTimeout
+	default:
+		panic(fmt.Sprintf("unknown phase %d", int(p)))
+	}
+}
+
+// Attempt is a single attempt at running a benchmark, see RunWithRetries.
+type Attempt struct {
+	ctx        context.Context
+	containers []*dockerutil.Container
+
+	// measured is the time spent in Measure.
+	measured time.Duration
+}
+
+// Track registers c with the attempt. If the attempt fails, the logs of c are
+// attached to the failure. c is cleaned up when the attempt ends.
+func (a *Attempt) Track(c *dockerutil.Container) *dockerutil.Container {
+	a.containers = append(a.containers, c)
+	return c
+}
+
+// Run runs fn with a context that expires after the timeout configured for
+// phase. Errors are annotated with the phase that failed.
+func (a *Attempt) Run(phase Phase, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(a.ctx, phase.timeout())
+	defer cancel()
+	if err := fn(ctx); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%v timed out after %v: %w", phase, phase.timeout(), err)
+		}
+		return fmt.Errorf("%v failed: %w", phase, err)
+	}
+	return nil
+}
+
+// Measure is like Run, but fn is the measured work of the benchmark: if the
+// attempt succeeds, the time spent in fn is what RunWithRetries reports.
+func (a *Attempt) Measure(phase Phase, fn func(ctx context.Context) error) error {
+	start := time.Now()
+	err := a.Run(phase, fn)
+	a.measured += time.Since(start)
+	return err
+}
+
+// logs returns the logs of all tracked containers.
+func (a *Attempt) logs() string {
+	ctx, cancel := context.WithTimeout(context.Background(), logCollectionTimeout)
+	defer cancel()
+	var sb strings.Builder
+	for _, c := range a.containers {
+		out, err := c.Logs(ctx)
+		if err != nil {
+			fmt.Fprintf(&sb, "--- container %s: failed to get logs: %v\n", c.Name, err)
+			continue
+		}
+		fmt.Fprintf(&sb, "--- container %s logs:\n%s\n", c.Name, out)
+	}
+	return sb.String()
+}
+
+// cleanUp cleans up all tracked containers.
+func (a *Attempt) cleanUp() {
+	ctx, cancel := context.WithTimeout(context.Background(), logCollectionTimeout)
+	defer cancel()
+	for _, c := range a.containers {
+		c.CleanUp(ctx)
+	}
+}
+
+// RunWithRetries runs b.N iterations of a benchmark. Each iteration is
+// attempted up to --max_attempts times, until an attempt succeeds. fn should
+// do its measured work inside Attempt.Measure.
+//
+// The benchmark timer is stopped, and the reported ns/op only includes the
+// time spent in Attempt.Measure by successful attempts, so that failed
+// attempts do not skew results.
+//
+// If all attempts of an iteration fail, only the calling benchmark is marked
+// as failed, with the last error and the logs of the containers tracked by the
+// last attempt. Other benchmarks in the binary keep running.
+func RunWithRetries(ctx context.Context, b *testing.B, fn func(a *Attempt) error) {
+	b.Helper()
+	b.StopTimer()
+	var measured time.Duration
+	for i := 0; i < b.N; i++ {
+		d, err := runAttempts(ctx, b, *maxAttempts, fn)
+		if err != nil {
+			b.Fatal(err)
+		}
+		measured += d
+	}
+	b.ReportMetric(float64(measured.Nanoseconds())/float64(b.N), "ns/op")
+}
+
+// runAttempts runs fn up to attempts times, until an attempt succeeds, and
+// returns the measured time of the successful attempt. If all attempts fail,
+// it returns the last error along with the logs of the last attempt.
+func runAttempts(ctx context.Context, logger testutil.Logger, attempts int, fn func(a *Attempt) error) (time.Duration, error) {
+	for i := 1; ; i++ {
+		a := &Attempt{ctx: ctx}
+		err := fn(a)
+		if err == nil {
+			a.cleanUp()
+			return a.measured, nil
+		}
+		logs := a.logs()
+		a.cleanUp()
+		if i >= attempts {
+			return 0, fmt.Errorf("failed after %d attempt(s): %w\n%s", i, err, logs)
+		}
+		logger.Logf("attempt %d/%d failed, retrying: %v", i, attempts, err)
+		if *debug {
+			logger.Logf("logs of failed attempt:\n%s", logs)
+		}
+	}
+}
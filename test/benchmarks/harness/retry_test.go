@@ -0,0 +1,94 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAttemptRunTimeout(t *testing.T) {
+	defer func(old time.Duration) { *clientRunTimeout = old }(*clientRunTimeout)
+	*clientRunTimeout = 10 * time.Millisecond
+
+	a := &Attempt{ctx: context.Background()}
+	err := a.Run(ClientRun, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err == nil || !strings.Contains(err.Error(), "client run timed out") {
+		t.Errorf("Run returned %v, want client run timeout", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run returned %v, want it to wrap %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRunAttempts(t *testing.T) {
+	errFailed := errors.New("failed")
+	for _, tc := range []struct {
+		name string
+		// failures is the number of attempts that fail before one succeeds.
+		failures int
+		attempts int
+		wantErr  bool
+	}{
+		{name: "FirstAttempt", failures: 0, attempts: 1},
+		{name: "Retry", failures: 2, attempts: 3},
+		{name: "GiveUp", failures: 2, attempts: 2, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			measured, err := runAttempts(context.Background(), t, tc.attempts, func(a *Attempt) error {
+				calls++
+				failed := calls <= tc.failures
+				d := time.Millisecond
+				if failed {
+					// Failed attempts take much longer, and must not be
+					// counted.
+					d = time.Second
+				}
+				return a.Measure(ClientRun, func(context.Context) error {
+					time.Sleep(d)
+					if failed {
+						return errFailed
+					}
+					return nil
+				})
+			})
+			if tc.wantErr {
+				if !errors.Is(err, errFailed) {
+					t.Errorf("runAttempts returned %v, want %v", err, errFailed)
+				}
+				if calls != tc.attempts {
+					t.Errorf("got %d attempts, want %d", calls, tc.attempts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("runAttempts failed: %v", err)
+			}
+			if calls != tc.failures+1 {
+				t.Errorf("got %d attempts, want %d", calls, tc.failures+1)
+			}
+			if measured < time.Millisecond || measured >= time.Second {
+				t.Errorf("got measured time %v, want only the successful attempt", measured)
+			}
+		})
+	}
+}
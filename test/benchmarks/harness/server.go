@@ -0,0 +1,160 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/tools"
+)
+
+var (
+	sandboxModes = flag.String("sandbox_modes", string(FreshSandbox), "comma-separated list of sandbox modes to run benchmarks that support them in: \"fresh\" starts a new sandbox for every iteration, \"reused\" starts a single sandbox that is reused by all iterations")
+)
+
+// SandboxMode determines whether the iterations of a benchmark run in fresh
+// sandboxes or in a reused one.
+type SandboxMode string
+
+const (
+	// FreshSandbox runs every iteration in a freshly started sandbox, so that
+	// cold start costs (e.g. loading a model, or filling caches) are included
+	// in every iteration.
+	FreshSandbox SandboxMode = "fresh"
+
+	// ReusedSandbox runs all iterations in the same sandbox, so that effects
+	// that only show up in long-lived sandboxes, such as cache growth, are
+	// measured.
+	ReusedSandbox SandboxMode = "reused"
+)
+
+// parseSandboxModes parses a comma-separated list of sandbox modes.
+func parseSandboxModes(s string) ([]SandboxMode, error) {
+	var modes []SandboxMode
+	seen := make(map[SandboxMode]bool)
+	for _, m := range strings.Split(s, ",") {
+		mode := SandboxMode(strings.TrimSpace(m))
+		switch mode {
+		case FreshSandbox, ReusedSandbox:
+		default:
+			return nil, fmt.Errorf("invalid sandbox mode %q, must be %q or %q", m, FreshSandbox, ReusedSandbox)
+		}
+		if !seen[mode] {
+			seen[mode] = true
+			modes = append(modes, mode)
+		}
+	}
+	return modes, nil
+}
+
+// RunSandboxModes runs fn as a sub-benchmark for each mode given with
+// --sandbox_modes. Sub-benchmarks are labeled with a "sandbox" parameter, e.g.
+// BenchmarkFoo/sandbox.reused, so that results of both modes can be told
+// apart.
+func RunSandboxModes(b *testing.B, fn func(b *testing.B, mode SandboxMode)) {
+	b.Helper()
+	modes, err := parseSandboxModes(*sandboxModes)
+	if err != nil {
+		b.Fatalf("--sandbox_modes: %v", err)
+	}
+	for _, mode := range modes {
+		name, err := tools.ParametersToName(tools.Parameter{
+			Name:  "sandbox",
+			Value: string(mode),
+		})
+		if err != nil {
+			b.Fatalf("Failed to parse parameters: %v", err)
+		}
+		b.Run(name, func(b *testing.B) {
+			fn(b, mode)
+		})
+	}
+}
+
+// Server is a server container used by a benchmark.
+//
+// In FreshSandbox mode, each iteration gets a freshly started server, so that
+// startup cost (e.g. loading a model) is included in every iteration. In
+// ReusedSandbox mode, the server is started once and reused by all
+// iterations, so that throughput and latency are measured against a warm,
+// long-lived server. Either way, the time taken by the first start is
+// reported as the cold_start metric.
+type Server struct {
+	machine Machine
+	mode    SandboxMode
+	start   func(context.Context, *dockerutil.Container) error
+
+	container *dockerutil.Container
+	coldStart time.Duration
+}
+
+// NewServer returns a Server that runs on machine in the given mode, usually
+// the one passed by RunSandboxModes. start must start the server in the given
+// container and return only once it is ready to serve.
+func NewServer(machine Machine, mode SandboxMode, start func(context.Context, *dockerutil.Container) error) *Server {
+	return &Server{
+		machine: machine,
+		mode:    mode,
+		start:   start,
+	}
+}
+
+// Get returns a running server container, starting one if needed. Calls to
+// Get must be paired with calls to Put, and the benchmark timer should be
+// stopped around both.
+func (s *Server) Get(ctx context.Context, b *testing.B) (*dockerutil.Container, error) {
+	b.Helper()
+	if s.container == nil {
+		c := s.machine.GetContainer(ctx, b)
+		began := time.Now()
+		startCtx, cancel := context.WithTimeout(ctx, ServerStart.timeout())
+		err := s.start(startCtx, c)
+		cancel()
+		if err != nil {
+			logs, _ := c.Logs(ctx)
+			c.CleanUp(ctx)
+			return nil, fmt.Errorf("failed to start server within %v: %v, logs: %s", ServerStart.timeout(), err, logs)
+		}
+		if s.coldStart == 0 {
+			s.coldStart = time.Since(began)
+		}
+		s.container = c
+	}
+	tools.ReportCustomMetric(b, s.coldStart.Seconds(), "cold_start" /*metric name*/, "s" /*unit*/)
+	return s.container, nil
+}
+
+// Put releases the container returned by Get at the end of an iteration. In
+// FreshSandbox mode, the container is stopped and the next call to Get starts
+// a new one.
+func (s *Server) Put(ctx context.Context) {
+	if s.mode != ReusedSandbox {
+		s.CleanUp(ctx)
+	}
+}
+
+// CleanUp stops the server container, if any.
+func (s *Server) CleanUp(ctx context.Context) {
+	if s.container != nil {
+		s.container.CleanUp(ctx)
+		s.container = nil
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSandboxModes(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    []SandboxMode
+		wantErr bool
+	}{
+		{in: "fresh", want: []SandboxMode{FreshSandbox}},
+		{in: "reused", want: []SandboxMode{ReusedSandbox}},
+		{in: "reused, fresh", want: []SandboxMode{ReusedSandbox, FreshSandbox}},
+		{in: "fresh,fresh", want: []SandboxMode{FreshSandbox}},
+		{in: "", wantErr: true},
+		{in: "warm", wantErr: true},
+	} {
+		got, err := parseSandboxModes(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseSandboxModes(%q) = %v, want error", tc.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSandboxModes(%q) failed: %v", tc.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseSandboxModes(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import "flag"
+
+var smoke = flag.Bool("smoke", false, "run every benchmark for a single tiny iteration to check that the harness, images and output parsers work, e.g. in presubmit; results are meaningless as measurements; overrides --test.benchtime")
+
+// Smoke returns true if benchmarks run in smoke mode (--smoke).
+//
+// In smoke mode, Init causes every benchmark to run once with b.N == 1.
+// Benchmarks whose cost doesn't scale with b.N (e.g. fixed durations,
+// step counts or input sizes) should shrink it to the smallest amount that
+// still produces parseable output, typically with SmokeOr.
+func Smoke() bool {
+	return *smoke
+}
+
+// SmokeOr returns smokeValue in smoke mode, and value otherwise.
+func SmokeOr[T any](value, smokeValue T) T {
+	if *smoke {
+		return smokeValue
+	}
+	return value
+}
@@ -17,6 +17,8 @@ package harness
 import (
 	"context"
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -31,18 +33,68 @@ import (
 // WaitUntilContainerServing grabs a container from `machine` and waits for a server on
 // the given container and port.
 func WaitUntilContainerServing(ctx context.Context, machine Machine, container *dockerutil.Container, port int) error {
+	return WaitUntilServing(ctx, machine, machine, container, port)
+}
+
+// WaitUntilServing grabs a container from clientMachine and waits for a
+// server on the given container, running on serverMachine, and port.
+func WaitUntilServing(ctx context.Context, serverMachine, clientMachine Machine, container *dockerutil.Container, port int) error {
 	var logger testutil.DefaultLogger = "util"
-	netcat := machine.GetNativeContainer(ctx, logger)
+	netcat := clientMachine.GetNativeContainer(ctx, logger)
 	defer netcat.CleanUp(ctx)
 
-	cmd := fmt.Sprintf("while ! wget -q --spider http://%s:%d; do true; done", "server", port)
-	_, err := netcat.Run(ctx, dockerutil.RunOpts{
+	host, hostPort, links, err := ServerAddress(ctx, serverMachine, clientMachine, container, "server", port)
+	if err != nil {
+		return err
+	}
+	cmd := fmt.Sprintf("while ! wget -q --spider http://%s; do true; done", net.JoinHostPort(host, strconv.Itoa(hostPort)))
+	_, err = netcat.Run(ctx, dockerutil.RunOpts{
 		Image: "benchmarks/util",
-		Links: []string{container.MakeLink("server")},
+		Links: links,
 	}, "sh", "-c", cmd)
 	return err
 }
 
+// ServerAddress returns the host and port at which a client container on
+// clientMachine can reach the given port of server, which runs on
+// serverMachine, along with any links that must be added to the client's
+// RunOpts.
+//
+// If both machines are the same host, the server is reached through a
+// container link named alias. Otherwise, the server is reached through the
+// server machine's IP address and the host port published for port.
+func ServerAddress(ctx context.Context, serverMachine, clientMachine Machine, server *dockerutil.Container, alias string, port int) (string, int, []string, error) {
+	if sameHost(serverMachine, clientMachine) {
+		return alias, port, []string{server.MakeLink(alias)}, nil
+	}
+	ip, err := serverMachine.IPAddress()
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("failed to get server machine address: %v", err)
+	}
+	hostPort, err := server.FindPort(ctx, port)
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("failed to find published port for %d: %v", port, err)
+	}
+	return ip.String(), hostPort, nil, nil
+}
+
+// sameHost returns true if a and b are the same physical host.
+func sameHost(a, b Machine) bool {
+	switch a := a.(type) {
+	case *localMachine, *isolatedMachine:
+		switch b.(type) {
+		case *localMachine, *isolatedMachine:
+			return true
+		}
+		return false
+	case *remoteMachine:
+		rb, ok := b.(*remoteMachine)
+		return ok && rb.dockerEndpoint == a.dockerEndpoint
+	default:
+		return a == b
+	}
+}
+
 // DropCaches drops caches on the provided machine. Requires root.
 func DropCaches(machine Machine) error {
 	if out, err := machine.RunCommand("/bin/sh", "-c", "sync && sysctl vm.drop_caches=3"); err != nil {
@@ -14,3 +14,104 @@
 
 // Package ml holds benchmarks around machine learning performance.
 package ml
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+	"gvisor.dev/gvisor/test/benchmarks/tools"
+)
+
+// inferenceServerTimeout bounds the time a model server may take to load its
+// model and start serving.
+const inferenceServerTimeout = 5 * time.Minute
+
+// inferenceServer describes an HTTP model server and the inference request
+// used to benchmark it.
+type inferenceServer struct {
+	// opts and cmd are used to start the server.
+	opts dockerutil.RunOpts
+	cmd  []string
+
+	// port is the port on which the server accepts HTTP requests.
+	port int
+
+	// path is the URL path of inference requests, and body their JSON body.
+	path string
+	body string
+}
+
+// runInferenceServer starts s and issues inference requests to it at the
+// offered rate with an open-loop client, reporting the achieved rate and
+// latency percentiles. The client runs in the benchmark binary and reaches
+// the server through its published port.
+func runInferenceServer(b *testing.B, s *inferenceServer, rate float64) {
+	ctx := context.Background()
+
+	machine, err := harness.GetMachine(b)
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer machine.CleanUp()
+
+	server := machine.GetContainer(ctx, b)
+	defer server.CleanUp(ctx)
+	if err := server.Spawn(ctx, s.opts, s.cmd...); err != nil {
+		b.Fatalf("failed to start server: %v", err)
+	}
+
+	ip, err := machine.IPAddress()
+	if err != nil {
+		b.Fatalf("failed to get server address: %v", err)
+	}
+	hostPort, err := server.FindPort(ctx, s.port)
+	if err != nil {
+		b.Fatalf("failed to find server port: %v", err)
+	}
+	req := &tools.HTTPRequest{
+		Method:      "POST",
+		URL:         fmt.Sprintf("http://%s/%s", net.JoinHostPort(ip.String(), strconv.Itoa(hostPort)), s.path),
+		Body:        s.body,
+		ContentType: "application/json",
+	}
+	if err := waitForInference(ctx, req); err != nil {
+		logs, _ := server.Logs(ctx)
+		b.Fatalf("server is not serving: %v, logs: %s", err, logs)
+	}
+
+	loop := &tools.OpenLoop{
+		Rate:     rate,
+		Requests: b.N,
+	}
+	b.ResetTimer()
+	res, err := loop.RunRequester(ctx, req)
+	if err != nil {
+		b.Fatalf("open-loop client failed: %v", err)
+	}
+	b.StopTimer()
+	res.Report(b)
+}
+
+// waitForInference issues req until it succeeds, which also serves to warm up
+// the server before it is measured.
+func waitForInference(ctx context.Context, req *tools.HTTPRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, inferenceServerTimeout)
+	defer cancel()
+	for {
+		err := req.Do(ctx)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/tools"
+)
+
+// onnxInputSize is the input size of the model served by
+// //images/benchmarks/onnxruntime.
+const onnxInputSize = 64
+
+// onnxRequest returns the body of an inference request for a batch of
+// batchSize inputs.
+func onnxRequest(batchSize int) string {
+	var sb strings.Builder
+	sb.WriteString(`{"instances": [`)
+	for i := 0; i < batchSize; i++ {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("[")
+		for j := 0; j < onnxInputSize; j++ {
+			if j > 0 {
+				sb.WriteString(", ")
+			}
+			fmt.Fprintf(&sb, "%.2f", float64((i+j)%100)/100)
+		}
+		sb.WriteString("]")
+	}
+	sb.WriteString("]}")
+	return sb.String()
+}
+
+// BenchmarkONNXRuntime measures the latency of CPU inference requests to a
+// small multilayer perceptron served by ONNX Runtime at fixed offered loads.
+// Each request is handled by its own server thread, while ONNX Runtime runs
+// the model on its intra-op thread pool.
+func BenchmarkONNXRuntime(b *testing.B) {
+	for _, threads := range []int{1, 4} {
+		for _, batchSize := range []int{1, 32} {
+			for _, rate := range []int{50, 200, 500} {
+				name, err := tools.ParametersToName(tools.Parameter{
+					Name:  "threads",
+					Value: strconv.Itoa(threads),
+				}, tools.Parameter{
+					Name:  "batch",
+					Value: strconv.Itoa(batchSize),
+				}, tools.Parameter{
+					Name:  "rate",
+					Value: strconv.Itoa(rate),
+				})
+				if err != nil {
+					b.Fatalf("Failed to parse parameters: %v", err)
+				}
+				b.Run(name, func(b *testing.B) {
+					runInferenceServer(b, &inferenceServer{
+						opts: dockerutil.RunOpts{
+							Image: "benchmarks/onnxruntime",
+							Ports: []int{8080},
+							Env:   []string{"ORT_INTRA_OP_THREADS=" + strconv.Itoa(threads)},
+						},
+						port: 8080,
+						path: "predict",
+						body: onnxRequest(batchSize),
+					}, float64(rate))
+				})
+			}
+		}
+	}
+}
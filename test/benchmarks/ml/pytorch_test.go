@@ -0,0 +1,116 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ml
+
+import (
+	"context"
+	"flag"
+	"strconv"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+	"gvisor.dev/gvisor/test/benchmarks/tools"
+)
+
+var (
+	trainingGPUs  = flag.Int("training_gpus", 1, "number of GPUs (and DDP processes) to train on")
+	trainingSteps = flag.Int("training_steps", 200, "number of measured training steps")
+)
+
+// BenchmarkPyTorchTraining runs a DistributedDataParallel training job on
+// synthetic data. Unlike the serving benchmarks, this exercises NCCL
+// collectives and large checkpoint writes.
+func BenchmarkPyTorchTraining(b *testing.B) {
+	workloads := []struct {
+		model     string
+		batchSize int
+	}{
+		{model: "resnet50", batchSize: 64},
+		{model: "transformer", batchSize: 16},
+	}
+
+	machine, err := harness.GetMachine(b)
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer machine.CleanUp()
+
+	for _, w := range workloads {
+		runName, err := tools.ParametersToName(tools.Parameter{
+			Name:  "model",
+			Value: w.model,
+		}, tools.Parameter{
+			Name:  "gpus",
+			Value: strconv.Itoa(*trainingGPUs),
+		})
+		if err != nil {
+			b.Fatalf("Failed to parse param: %v", err)
+		}
+
+		b.Run(runName, func(b *testing.B) {
+			ctx := context.Background()
+			training := tools.PyTorchTraining{
+				Model:     w.model,
+				GPUs:      *trainingGPUs,
+				BatchSize: w.batchSize,
+				// In smoke mode, a single step suffices to check that
+				// training and checkpointing work and their output parses.
+				WarmupSteps: harness.SmokeOr(0, 1),
+				Steps:       harness.SmokeOr(*trainingSteps, 1),
+				// Checkpoint a few times per run, as a training job would
+				// at the end of an epoch.
+				CheckpointEvery: harness.SmokeOr(max(*trainingSteps/4, 1), 1),
+				CheckpointDir:   "/tmp",
+			}
+
+			harness.RunWithRetries(ctx, b, func(a *harness.Attempt) error {
+				container := a.Track(machine.GetContainer(ctx, b))
+
+				opts := dockerutil.GPURunOpts()
+				opts.Image = "gpu/pytorch"
+				// NCCL uses /dev/shm to exchange data between processes
+				// on the same host, and the docker default of 64MiB is
+				// too small.
+				opts.ShmSize = 1 << 30
+
+				sampler, err := harness.StartGPUSampler(machine, time.Second)
+				if err != nil {
+					b.Logf("GPU metrics will not be reported: %v", err)
+				}
+				var out string
+				err = a.Measure(harness.ClientRun, func(ctx context.Context) error {
+					var err error
+					out, err = container.Run(ctx, opts, training.MakeCmd()...)
+					return err
+				})
+				var samples []tools.GPUSample
+				if sampler != nil {
+					var serr error
+					if samples, serr = sampler.Stop(b.Name()); serr != nil {
+						b.Logf("failed to sample GPU metrics: %v", serr)
+					}
+				}
+				if err != nil {
+					return err
+				}
+				training.Report(b, out)
+				tools.ReportGPUSamples(b, samples)
+				return nil
+			})
+		})
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ml
+
+import (
+	"strconv"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/test/benchmarks/tools"
+)
+
+// BenchmarkTensorflowServing measures the latency of CPU inference requests
+// to TF-Serving at fixed offered loads. The model is deliberately trivial, so
+// that the benchmark measures the serving stack: its gRPC/REST threads,
+// inter-op thread pool and mmap'd model loading.
+func BenchmarkTensorflowServing(b *testing.B) {
+	for _, threads := range []int{1, 4} {
+		for _, rate := range []int{100, 500, 1000} {
+			name, err := tools.ParametersToName(tools.Parameter{
+				Name:  "threads",
+				Value: strconv.Itoa(threads),
+			}, tools.Parameter{
+				Name:  "rate",
+				Value: strconv.Itoa(rate),
+			})
+			if err != nil {
+				b.Fatalf("Failed to parse parameters: %v", err)
+			}
+			b.Run(name, func(b *testing.B) {
+				runInferenceServer(b, &inferenceServer{
+					opts: dockerutil.RunOpts{
+						Image: "benchmarks/tensorflow-serving",
+						Ports: []int{8501},
+					},
+					// Arguments are appended to the image's tensorflow_model_server
+					// command line.
+					cmd: []string{
+						"--tensorflow_intra_op_parallelism=" + strconv.Itoa(threads),
+						"--tensorflow_inter_op_parallelism=" + strconv.Itoa(threads),
+					},
+					port: 8501,
+					path: "v1/models/half_plus_two:predict",
+					body: `{"instances": [1.0, 2.0, 5.0]}`,
+				}, float64(rate))
+			})
+		}
+	}
+}
@@ -15,7 +15,6 @@ package ml
 
 import (
 	"context"
-	"os"
 	"testing"
 
 	"gvisor.dev/gvisor/pkg/test/dockerutil"
@@ -49,7 +48,7 @@ func BenchmarkTensorflow(b *testing.B) {
 }
 
 func doTensorflowTest(b *testing.B, workloads map[string]string) {
-	machine, err := harness.GetMachine()
+	machine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine: %v", err)
 	}
@@ -91,9 +90,3 @@ func doTensorflowTest(b *testing.B, workloads map[string]string) {
 		})
 	}
 }
-
-func TestMain(m *testing.M) {
-	harness.Init()
-	harness.SetFixedBenchmarks()
-	os.Exit(m.Run())
-}
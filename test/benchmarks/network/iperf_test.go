@@ -27,13 +27,13 @@ import (
 )
 
 func BenchmarkIperf(b *testing.B) {
-	clientMachine, err := harness.GetMachine()
+	clientMachine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine: %v", err)
 	}
 	defer clientMachine.CleanUp()
 
-	serverMachine, err := harness.GetMachine()
+	serverMachine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine: %v", err)
 	}
@@ -107,13 +107,13 @@ func BenchmarkIperf(b *testing.B) {
 }
 
 func BenchmarkIperfParameterized(b *testing.B) {
-	clientMachine, err := harness.GetMachine()
+	clientMachine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine: %v", err)
 	}
 	defer clientMachine.CleanUp()
 
-	serverMachine, err := harness.GetMachine()
+	serverMachine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine: %v", err)
 	}
@@ -17,6 +17,9 @@ package network
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"strconv"
 	"testing"
 
 	"gvisor.dev/gvisor/pkg/test/dockerutil"
@@ -28,18 +31,20 @@ import (
 func runStaticServer(b *testing.B, serverOpts dockerutil.RunOpts, serverCmd []string, port int, hey *tools.Hey) {
 	ctx := context.Background()
 
-	// Get two machines: a client and server.
-	clientMachine, err := harness.GetMachine()
+	// Get two machines: a server and client. The server is requested first
+	// so that, if a separate client host is configured, the server stays on
+	// the local machine under test.
+	serverMachine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine: %v", err)
 	}
-	defer clientMachine.CleanUp()
+	defer serverMachine.CleanUp()
 
-	serverMachine, err := harness.GetMachine()
+	clientMachine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine: %v", err)
 	}
-	defer serverMachine.CleanUp()
+	defer clientMachine.CleanUp()
 
 	// Make the containers.
 	client := clientMachine.GetNativeContainer(ctx, b)
@@ -53,17 +58,77 @@ func runStaticServer(b *testing.B, serverOpts dockerutil.RunOpts, serverCmd []st
 	}
 
 	// Make sure the server is serving.
-	harness.WaitUntilContainerServing(ctx, clientMachine, server, port)
+	harness.WaitUntilServing(ctx, serverMachine, clientMachine, server, port)
+
+	host, hostPort, links, err := harness.ServerAddress(ctx, serverMachine, clientMachine, server, "server", port)
+	if err != nil {
+		b.Fatalf("failed to get server address: %v", err)
+	}
 
 	// Run the client.
+	metrics := harness.NewRunscMetrics(server)
+	metrics.Start(ctx, b)
 	b.ResetTimer()
 	out, err := client.Run(ctx, dockerutil.RunOpts{
 		Image: "benchmarks/hey",
-		Links: []string{server.MakeLink("server")},
-	}, hey.MakeCmd("server", port)...)
+		Links: links,
+	}, hey.MakeCmd(host, hostPort)...)
 	if err != nil {
 		b.Fatalf("run failed with: %v", err)
 	}
 	b.StopTimer()
+	metrics.Stop(ctx, b)
 	hey.Report(b, out)
+	metrics.Report(b)
+}
+
+// runOpenLoopStaticServer runs static serving workloads (httpd, nginx) with an
+// open-loop client issuing requests for doc at the offered rate. The client
+// runs in the benchmark binary and reaches the server through its published
+// port.
+func runOpenLoopStaticServer(b *testing.B, serverOpts dockerutil.RunOpts, serverCmd []string, port int, doc string, rate float64) {
+	ctx := context.Background()
+
+	serverMachine, err := harness.GetMachine(b)
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer serverMachine.CleanUp()
+
+	server := serverMachine.GetContainer(ctx, b)
+	defer server.CleanUp(ctx)
+	if err := server.Spawn(ctx, serverOpts, serverCmd...); err != nil {
+		b.Fatalf("failed to start server: %v", err)
+	}
+	if err := harness.WaitUntilContainerServing(ctx, serverMachine, server, port); err != nil {
+		b.Fatalf("failed to wait for server: %v", err)
+	}
+
+	ip, err := serverMachine.IPAddress()
+	if err != nil {
+		b.Fatalf("failed to get server address: %v", err)
+	}
+	hostPort, err := server.FindPort(ctx, port)
+	if err != nil {
+		b.Fatalf("failed to find server port: %v", err)
+	}
+	req := &tools.HTTPRequest{
+		URL: fmt.Sprintf("http://%s/%s", net.JoinHostPort(ip.String(), strconv.Itoa(hostPort)), doc),
+	}
+	loop := &tools.OpenLoop{
+		Rate:     rate,
+		Requests: b.N,
+	}
+
+	metrics := harness.NewRunscMetrics(server)
+	metrics.Start(ctx, b)
+	b.ResetTimer()
+	res, err := loop.RunRequester(ctx, req)
+	if err != nil {
+		b.Fatalf("open-loop client failed: %v", err)
+	}
+	b.StopTimer()
+	metrics.Stop(ctx, b)
+	res.Report(b)
+	metrics.Report(b)
 }
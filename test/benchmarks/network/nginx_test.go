@@ -14,10 +14,12 @@
 package network
 
 import (
+	"context"
 	"os"
 	"strconv"
 	"testing"
 
+	"github.com/docker/docker/api/types/mount"
 	"gvisor.dev/gvisor/pkg/test/dockerutil"
 	"gvisor.dev/gvisor/test/benchmarks/harness"
 	"gvisor.dev/gvisor/test/benchmarks/tools"
@@ -48,6 +50,110 @@ func BenchmarkContinuousNginx(b *testing.B) {
 	benchmarkNginxContinuous(b, threads, sizes)
 }
 
+// BenchmarkNginxTailLatency measures latency percentiles at fixed offered
+// loads. Unlike the closed-loop benchmarks above, the offered load does not
+// drop when the server slows down, so queuing shows up in p99 and p999.
+func BenchmarkNginxTailLatency(b *testing.B) {
+	for _, rate := range []int{100, 1000, 5000} {
+		for _, size := range []string{"1Kb", "100Kb"} {
+			name, err := tools.ParametersToName(tools.Parameter{
+				Name:  "rate",
+				Value: strconv.Itoa(rate),
+			}, tools.Parameter{
+				Name:  "filesize",
+				Value: size,
+			})
+			if err != nil {
+				b.Fatalf("Failed to parse parameters: %v", err)
+			}
+			b.Run(name, func(b *testing.B) {
+				runOpenLoopStaticServer(b, dockerutil.RunOpts{
+					Image: "benchmarks/nginx",
+					Ports: []int{80},
+				}, []string{"sh", "-c", "mkdir -p /tmp/html && cp -a /local/* /tmp/html && nginx -c /etc/nginx/nginx.conf"}, 80, nginxDocs[size], float64(rate))
+			})
+		}
+	}
+}
+
+// BenchmarkNginxCachedFile serves a large file from a cache volume, which is
+// only generated the first time the benchmark runs on a host. It runs in each
+// mode given with --sandbox_modes.
+func BenchmarkNginxCachedFile(b *testing.B) {
+	harness.RunSandboxModes(b, runNginxCachedFile)
+}
+
+func runNginxCachedFile(b *testing.B, mode harness.SandboxMode) {
+	ctx := context.Background()
+	const port = 80
+	vol, err := dockerutil.CacheVolume(ctx, "gvisor-benchmark-nginx-cached-file", func(ctx context.Context, v *dockerutil.Volume) error {
+		c := dockerutil.MakeNativeContainer(ctx, b)
+		defer c.CleanUp(ctx)
+		_, err := c.Run(ctx, dockerutil.RunOpts{
+			Image:  "basic/alpine",
+			Mounts: []mount.Mount{v.Mount("/cache", false /* readOnly */)},
+		}, "dd", "if=/dev/urandom", "of=/cache/large.bin", "bs=1M", "count=64")
+		return err
+	})
+	if err != nil {
+		b.Fatalf("failed to get cache volume: %v", err)
+	}
+
+	serverMachine, err := harness.GetMachine(b)
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer serverMachine.CleanUp()
+	clientMachine, err := harness.GetMachine(b)
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer clientMachine.CleanUp()
+
+	server := harness.NewServer(serverMachine, mode, func(ctx context.Context, c *dockerutil.Container) error {
+		if err := c.Spawn(ctx, dockerutil.RunOpts{
+			Image:  "benchmarks/nginx",
+			Ports:  []int{port},
+			Mounts: []mount.Mount{vol.Mount("/local/cache", true /* readOnly */)},
+		}, "nginx", "-c", "/etc/nginx/nginx_gofer.conf"); err != nil {
+			return err
+		}
+		return harness.WaitUntilServing(ctx, serverMachine, clientMachine, c, port)
+	})
+	defer server.CleanUp(ctx)
+
+	hey := &tools.Hey{
+		Requests:    100,
+		Concurrency: 10,
+		Doc:         "cache/large.bin",
+	}
+	b.StopTimer()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c, err := server.Get(ctx, b)
+		if err != nil {
+			b.Fatalf("failed to get server: %v", err)
+		}
+		host, hostPort, links, err := harness.ServerAddress(ctx, serverMachine, clientMachine, c, "server", port)
+		if err != nil {
+			b.Fatalf("failed to get server address: %v", err)
+		}
+		client := clientMachine.GetNativeContainer(ctx, b)
+		b.StartTimer()
+		out, err := client.Run(ctx, dockerutil.RunOpts{
+			Image: "benchmarks/hey",
+			Links: links,
+		}, hey.MakeCmd(host, hostPort)...)
+		b.StopTimer()
+		client.CleanUp(ctx)
+		if err != nil {
+			b.Fatalf("run failed with: %v", err)
+		}
+		hey.Report(b, out)
+		server.Put(ctx)
+	}
+}
+
 // benchmarkNginxDocSize iterates through all doc sizes, running subbenchmarks
 // for each size.
 func benchmarkNginxDocSize(b *testing.B, tmpfs bool) {
@@ -55,14 +55,14 @@ func runNode(b *testing.B, hey *tools.Hey) {
 	b.Helper()
 
 	// The machine to hold Redis and the Node Server.
-	serverMachine, err := harness.GetMachine()
+	serverMachine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine with: %v", err)
 	}
 	defer serverMachine.CleanUp()
 
 	// The machine to run 'hey'.
-	clientMachine, err := harness.GetMachine()
+	clientMachine, err := harness.GetMachine(b)
 	if err != nil {
 		b.Fatalf("failed to get machine with: %v", err)
 	}
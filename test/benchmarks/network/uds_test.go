@@ -0,0 +1,225 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	"gvisor.dev/gvisor/pkg/test/dockerutil"
+	"gvisor.dev/gvisor/pkg/test/testutil"
+	"gvisor.dev/gvisor/test/benchmarks/harness"
+	"gvisor.dev/gvisor/test/benchmarks/tools"
+)
+
+// Annotations that make runsc start a container in the sandbox of another
+// one, as containerd does for the containers of a pod.
+const (
+	containerTypeAnnotation = "io.kubernetes.cri.container-type"
+	sandboxIDAnnotation     = "io.kubernetes.cri.sandbox-id"
+)
+
+// udsCase is a UDSBench configuration.
+type udsCase struct {
+	name string
+	uds  tools.UDSBench
+}
+
+// udsCases returns the UDSBench configurations for the given socket types:
+// latency and throughput with small and large messages, with and without FD
+// passing.
+func udsCases(b *testing.B, types ...string) []udsCase {
+	var cases []udsCase
+	for _, typ := range types {
+		for _, size := range []int{64, 64 << 10} {
+			for _, latency := range []bool{true, false} {
+				for _, fds := range []bool{false, true} {
+					mode := "throughput"
+					if latency {
+						mode = "latency"
+					}
+					name, err := tools.ParametersToName(tools.Parameter{
+						Name:  "type",
+						Value: typ,
+					}, tools.Parameter{
+						Name:  "size",
+						Value: strconv.Itoa(size),
+					}, tools.Parameter{
+						Name:  "mode",
+						Value: mode,
+					}, tools.Parameter{
+						Name:  "fds",
+						Value: strconv.FormatBool(fds),
+					})
+					if err != nil {
+						b.Fatalf("Failed to parse parameters: %v", err)
+					}
+					cases = append(cases, udsCase{
+						name: name,
+						uds: tools.UDSBench{
+							Type:    typ,
+							Size:    size,
+							Latency: latency,
+							FDs:     fds,
+						},
+					})
+				}
+			}
+		}
+	}
+	return cases
+}
+
+// runUDSBench starts a udsbench server on addr in server and runs a client
+// sending b.N messages in client.
+func runUDSBench(ctx context.Context, b *testing.B, uds tools.UDSBench, addr string, server *dockerutil.Container, serverOpts dockerutil.RunOpts, client *dockerutil.Container, clientOpts func() dockerutil.RunOpts) {
+	if err := server.Spawn(ctx, serverOpts, uds.MakeServerCmd(addr)...); err != nil {
+		b.Fatalf("failed to start server: %v", err)
+	}
+	if out, err := server.WaitForOutput(ctx, "listening", 10*time.Second); err != nil {
+		b.Fatalf("failed to wait for server: %v %s", err, out)
+	}
+
+	uds.Count = b.N
+	// Client options may depend on the server container, which only has an
+	// ID once it is started.
+	opts := clientOpts()
+	b.ResetTimer()
+	out, err := client.Run(ctx, opts, uds.MakeClientCmd(addr)...)
+	if err != nil {
+		b.Fatalf("failed to run client: %v: %s", err, out)
+	}
+	b.StopTimer()
+	uds.Report(b, out)
+}
+
+// BenchmarkUDSPod measures UNIX domain sockets between two containers of the
+// same pod, which share the sandbox and talk over an abstract socket. With
+// runc, the containers share the network namespace, and so the abstract socket
+// namespace.
+func BenchmarkUDSPod(b *testing.B) {
+	machine, err := harness.GetMachine(b)
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer machine.CleanUp()
+
+	ctx := context.Background()
+	for _, bm := range udsCases(b, "stream", "dgram", "seqpacket") {
+		b.Run(bm.name, func(b *testing.B) {
+			server := machine.GetContainer(ctx, b)
+			defer server.CleanUp(ctx)
+			client := machine.GetContainer(ctx, b)
+			defer client.CleanUp(ctx)
+
+			serverOpts := dockerutil.RunOpts{
+				Image: "benchmarks/udsbench",
+				Annotations: map[string]string{
+					containerTypeAnnotation: "sandbox",
+				},
+			}
+			clientOpts := func() dockerutil.RunOpts {
+				return dockerutil.RunOpts{
+					Image:       "benchmarks/udsbench",
+					NetworkMode: "container:" + server.ID(),
+					Annotations: map[string]string{
+						containerTypeAnnotation: "container",
+						sandboxIDAnnotation:     server.ID(),
+					},
+				}
+			}
+			runUDSBench(ctx, b, bm.uds, "@udsbench", server, serverOpts, client, clientOpts)
+		})
+	}
+}
+
+// BenchmarkUDSHost measures UNIX domain sockets between a sandbox and a host
+// process, here a runc container, over a socket in a bind-mounted directory.
+// The runtime under test must allow host sockets: --host-uds=open for the
+// client in the sandbox, and --host-uds=create for the server.
+func BenchmarkUDSHost(b *testing.B) {
+	machine, err := harness.GetMachine(b)
+	if err != nil {
+		b.Fatalf("failed to get machine: %v", err)
+	}
+	defer machine.CleanUp()
+
+	ctx := context.Background()
+	for _, dir := range []struct {
+		name       string
+		clientFunc func(context.Context, testutil.Logger) *dockerutil.Container
+		serverFunc func(context.Context, testutil.Logger) *dockerutil.Container
+	}{
+		{
+			name:       "SandboxClient",
+			clientFunc: machine.GetContainer,
+			serverFunc: machine.GetNativeContainer,
+		},
+		{
+			name:       "SandboxServer",
+			clientFunc: machine.GetNativeContainer,
+			serverFunc: machine.GetContainer,
+		},
+	} {
+		// Datagram clients bind a socket for replies, which the server in
+		// the other container can't reach through the host.
+		for _, bm := range udsCases(b, "stream", "seqpacket") {
+			b.Run(fmt.Sprintf("%s/%s", dir.name, bm.name), func(b *testing.B) {
+				sockDir, err := os.MkdirTemp("", "udsbench")
+				if err != nil {
+					b.Fatalf("failed to create socket directory: %v", err)
+				}
+				defer os.RemoveAll(sockDir)
+				if err := os.Chmod(sockDir, 0777); err != nil {
+					b.Fatalf("failed to change socket directory mode: %v", err)
+				}
+				mounts := []mount.Mount{{
+					Type:   mount.TypeBind,
+					Source: sockDir,
+					Target: "/uds",
+				}}
+
+				server := dir.serverFunc(ctx, b)
+				defer server.CleanUp(ctx)
+				client := dir.clientFunc(ctx, b)
+				defer client.CleanUp(ctx)
+
+				serverOpts := dockerutil.RunOpts{
+					Image:  "benchmarks/udsbench",
+					Mounts: mounts,
+				}
+				clientOpts := func() dockerutil.RunOpts {
+					return dockerutil.RunOpts{
+						Image:  "benchmarks/udsbench",
+						Mounts: mounts,
+					}
+				}
+				runUDSBench(ctx, b, bm.uds, filepath.Join("/uds", "sock"), server, serverOpts, client, clientOpts)
+			})
+		}
+	}
+}
+
+// TestMain is the main method for this package.
+func TestMain(m *testing.M) {
+	harness.Init()
+	os.Exit(m.Run())
+}
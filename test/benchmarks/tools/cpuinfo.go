@@ -0,0 +1,57 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AccelCPUFeatures lists, for each architecture, the CPU features used by
+// crypto and compression libraries to accelerate their hot paths, as named in
+// /proc/cpuinfo.
+var AccelCPUFeatures = map[string][]string{
+	"amd64": {"aes", "pclmulqdq", "sha_ni", "avx", "avx2", "bmi2", "adx", "avx512f", "avx512bw", "avx512vl", "vaes", "vpclmulqdq", "gfni"},
+	"arm64": {"aes", "pmull", "sha1", "sha2", "sha512", "asimd", "sve"},
+}
+
+// CPUFeatures is a set of CPU feature flags.
+type CPUFeatures map[string]struct{}
+
+// Has returns true if the feature is in the set.
+func (f CPUFeatures) Has(feature string) bool {
+	_, ok := f[feature]
+	return ok
+}
+
+// ParseCPUFeatures parses the feature flags of the first CPU listed in
+// /proc/cpuinfo: the "flags" line on x86 and the "Features" line on arm64.
+func ParseCPUFeatures(cpuinfo string) (CPUFeatures, error) {
+	for _, line := range strings.Split(cpuinfo, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		if key = strings.TrimSpace(key); key != "flags" && key != "Features" {
+			continue
+		}
+		features := make(CPUFeatures)
+		for _, feature := range strings.Fields(value) {
+			features[feature] = struct{}{}
+		}
+		return features, nil
+	}
+	return nil, fmt.Errorf("could not find CPU features: %s", cpuinfo)
+}
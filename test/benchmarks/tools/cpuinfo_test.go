@@ -0,0 +1,74 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import "testing"
+
+// TestParseCPUFeatures tests the parser on sample /proc/cpuinfo contents.
+func TestParseCPUFeatures(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		data   string
+		has    []string
+		hasNot []string
+	}{
+		{
+			name: "amd64",
+			data: `processor	: 0
+vendor_id	: GenuineIntel
+cpu family	: 6
+model name	: Intel(R) Xeon(R) CPU @ 2.60GHz
+flags		: fpu vme de pse sse2 pclmulqdq aes avx avx2 bmi2 avx512f sha_ni
+bogomips	: 5200.00
+
+processor	: 1
+flags		: fpu vme de pse sse2 vaes
+`,
+			has:    []string{"aes", "avx512f", "sha_ni"},
+			hasNot: []string{"vaes", "avx512_vnni"},
+		},
+		{
+			name: "arm64",
+			data: `processor	: 0
+BogoMIPS	: 243.75
+Features	: fp asimd evtstrm aes pmull sha1 sha2 crc32 atomics
+CPU implementer	: 0x41
+`,
+			has:    []string{"aes", "pmull", "sha2"},
+			hasNot: []string{"sha512", "sve"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			features, err := ParseCPUFeatures(tc.data)
+			if err != nil {
+				t.Fatalf("ParseCPUFeatures failed: %v", err)
+			}
+			for _, feature := range tc.has {
+				if !features.Has(feature) {
+					t.Errorf("feature %q not found in %v", feature, features)
+				}
+			}
+			for _, feature := range tc.hasNot {
+				if features.Has(feature) {
+					t.Errorf("unexpected feature %q found", feature)
+				}
+			}
+		})
+	}
+
+	if _, err := ParseCPUFeatures("processor\t: 0\n"); err == nil {
+		t.Errorf("ParseCPUFeatures succeeded on cpuinfo without features")
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// CUDAMemcpy is a run of the memcpy_bandwidth program in the gpu/cuda-memcpy
+// image, which times synchronous cudaMemcpy calls between host and device
+// memory.
+type CUDAMemcpy struct {
+	// Direction is the direction of the copies: "h2d" (host to device) or
+	// "d2h" (device to host).
+	Direction string
+	// Memory is the kind of host memory copied to or from: "pinned",
+	// allocated with cudaMallocHost, or "pageable", allocated with malloc.
+	Memory string
+	// Size is the size of each copy in bytes.
+	Size int
+	// Iterations is the number of measured copies.
+	Iterations int
+}
+
+// MakeCmd makes a memcpy_bandwidth command.
+func (c *CUDAMemcpy) MakeCmd() []string {
+	return []string{
+		"memcpy_bandwidth",
+		c.Direction,
+		c.Memory,
+		strconv.Itoa(c.Size),
+		strconv.Itoa(c.Iterations),
+	}
+}
+
+// Report parses and reports metrics from memcpy_bandwidth output.
+func (c *CUDAMemcpy) Report(b *testing.B, output string) {
+	b.Helper()
+	bandwidth, err := c.parseMetric(output, "bandwidth_bytes_per_sec")
+	if err != nil {
+		b.Fatalf("failed to parse bandwidth: %v", err)
+	}
+	ReportCustomMetric(b, bandwidth, "bandwidth" /*metric name*/, "bytes_per_second" /*unit*/)
+
+	median, err := c.parseMetric(output, "latency_median_us")
+	if err != nil {
+		b.Fatalf("failed to parse median latency: %v", err)
+	}
+	ReportCustomMetric(b, median/1e6, "latency_median" /*metric name*/, "s" /*unit*/)
+
+	p99, err := c.parseMetric(output, "latency_p99_us")
+	if err != nil {
+		b.Fatalf("failed to parse p99 latency: %v", err)
+	}
+	ReportCustomMetric(b, p99/1e6, "latency_p99" /*metric name*/, "s" /*unit*/)
+
+	if c.Memory == "pinned" {
+		alloc, err := c.parseMetric(output, "host_alloc_us")
+		if err != nil {
+			b.Fatalf("failed to parse host allocation time: %v", err)
+		}
+		ReportCustomMetric(b, alloc/1e6, "host_alloc_time" /*metric name*/, "s" /*unit*/)
+	}
+}
+
+var cudaMemcpyMetricRE = regexp.MustCompile(`(?m)^(\w+): (\d+(?:\.\d+)?)\r?$`)
+
+// parseMetric parses the named metric from memcpy_bandwidth output.
+func (c *CUDAMemcpy) parseMetric(data, name string) (float64, error) {
+	for _, match := range cudaMemcpyMetricRE.FindAllStringSubmatch(data, -1) {
+		if match[1] == name {
+			return strconv.ParseFloat(match[2], 64)
+		}
+	}
+	return 0, fmt.Errorf("metric %q not found in output: %s", name, data)
+}
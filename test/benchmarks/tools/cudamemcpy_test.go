@@ -0,0 +1,48 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import "testing"
+
+// TestCUDAMemcpy tests the parser on sample memcpy_bandwidth output.
+func TestCUDAMemcpy(t *testing.T) {
+	sampleData := `
+==========
+== CUDA ==
+==========
+bandwidth_bytes_per_sec: 12582912000.000000
+latency_median_us: 5321.250000
+latency_p99_us: 5702.5
+host_alloc_us: 20432.125000
+`
+	c := CUDAMemcpy{}
+	for name, want := range map[string]float64{
+		"bandwidth_bytes_per_sec": 12582912000,
+		"latency_median_us":       5321.25,
+		"latency_p99_us":          5702.5,
+		"host_alloc_us":           20432.125,
+	} {
+		got, err := c.parseMetric(sampleData, name)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", name, err)
+		}
+		if got != want {
+			t.Errorf("%s: got %f want %f", name, got, want)
+		}
+	}
+	if _, err := c.parseMetric(sampleData, "latency_mean_us"); err == nil {
+		t.Errorf("parsing missing metric succeeded")
+	}
+}
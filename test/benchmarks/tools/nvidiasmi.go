@@ -0,0 +1,147 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// GPUSample is a single sample of per-GPU metrics.
+type GPUSample struct {
+	// Time is the time at which the sample was taken.
+	Time time.Time
+
+	// GPU is the index of the GPU.
+	GPU int
+
+	// SMUtilization is the streaming multiprocessor utilization in percent.
+	SMUtilization float64
+
+	// MemoryUtilization is the memory controller utilization in percent.
+	MemoryUtilization float64
+
+	// MemoryUsedMB is the frame buffer memory in use, in MB.
+	MemoryUsedMB float64
+
+	// PCIeRxMBps and PCIeTxMBps are the PCIe throughput from the GPU's point
+	// of view, in MB/s.
+	PCIeRxMBps float64
+	PCIeTxMBps float64
+}
+
+// NvidiaSMIDmon is for the 'nvidia-smi dmon' GPU monitor.
+type NvidiaSMIDmon struct {
+	// Interval is the sampling interval. It is rounded to seconds, with a
+	// minimum of one second.
+	Interval time.Duration
+}
+
+// MakeCmd returns a 'nvidia-smi dmon' command that streams utilization (u),
+// memory (m) and PCIe throughput (t) samples.
+func (n *NvidiaSMIDmon) MakeCmd() []string {
+	secs := int(n.Interval.Round(time.Second) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return []string{"nvidia-smi", "dmon", "-s", "umt", "-d", strconv.Itoa(secs)}
+}
+
+// DmonParser parses 'nvidia-smi dmon' output line by line. The set and order
+// of columns differs between driver versions, so columns are found by name
+// from the header line.
+type DmonParser struct {
+	// columns maps column names to their position.
+	columns map[string]int
+}
+
+// ParseLine parses a single line of output. It returns false if the line is
+// a header or otherwise contains no sample.
+func (p *DmonParser) ParseLine(line string, t time.Time) (GPUSample, bool, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return GPUSample{}, false, nil
+	}
+	if strings.HasPrefix(line, "#") {
+		fields := strings.Fields(strings.TrimPrefix(line, "#"))
+		// The second header line holds units (e.g. "Idx %").
+		if len(fields) > 0 && fields[0] == "gpu" {
+			p.columns = make(map[string]int)
+			for i, f := range fields {
+				p.columns[f] = i
+			}
+		}
+		return GPUSample{}, false, nil
+	}
+	if p.columns == nil {
+		return GPUSample{}, false, fmt.Errorf("sample before header: %q", line)
+	}
+
+	fields := strings.Fields(line)
+	value := func(name string) (float64, error) {
+		i, ok := p.columns[name]
+		if !ok || i >= len(fields) || fields[i] == "-" {
+			return 0, nil
+		}
+		return strconv.ParseFloat(fields[i], 64)
+	}
+	gpu, err := value("gpu")
+	if err != nil {
+		return GPUSample{}, false, fmt.Errorf("failed to parse gpu in %q: %v", line, err)
+	}
+	s := GPUSample{Time: t, GPU: int(gpu)}
+	for name, dst := range map[string]*float64{
+		"sm":    &s.SMUtilization,
+		"mem":   &s.MemoryUtilization,
+		"fb":    &s.MemoryUsedMB,
+		"rxpci": &s.PCIeRxMBps,
+		"txpci": &s.PCIeTxMBps,
+	} {
+		if *dst, err = value(name); err != nil {
+			return GPUSample{}, false, fmt.Errorf("failed to parse %s in %q: %v", name, line, err)
+		}
+	}
+	return s, true, nil
+}
+
+// ReportGPUSamples reports summary metrics over all samples.
+func ReportGPUSamples(b *testing.B, samples []GPUSample) {
+	b.Helper()
+	if len(samples) == 0 {
+		b.Logf("no GPU samples to report")
+		return
+	}
+	var smSum, rxSum, txSum, smMax, memMax float64
+	for _, s := range samples {
+		smSum += s.SMUtilization
+		rxSum += s.PCIeRxMBps
+		txSum += s.PCIeTxMBps
+		if s.SMUtilization > smMax {
+			smMax = s.SMUtilization
+		}
+		if s.MemoryUsedMB > memMax {
+			memMax = s.MemoryUsedMB
+		}
+	}
+	n := float64(len(samples))
+	ReportCustomMetric(b, smSum/n, "gpu_sm_utilization_mean" /*metric name*/, "percent" /*unit*/)
+	ReportCustomMetric(b, smMax, "gpu_sm_utilization_max" /*metric name*/, "percent" /*unit*/)
+	ReportCustomMetric(b, memMax, "gpu_memory_used_max" /*metric name*/, "MB" /*unit*/)
+	ReportCustomMetric(b, rxSum/n, "gpu_pcie_rx_mean" /*metric name*/, "MBps" /*unit*/)
+	ReportCustomMetric(b, txSum/n, "gpu_pcie_tx_mean" /*metric name*/, "MBps" /*unit*/)
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDmonParser checks the 'nvidia-smi dmon' parser on sample output.
+func TestDmonParser(t *testing.T) {
+	sampleData := `
+# gpu     sm    mem    enc    dec    jpg    ofa     fb   bar1   ccpm  rxpci  txpci
+# Idx      %      %      %      %      %      %     MB     MB     MB   MB/s   MB/s
+    0     87     42      0      0      -      -  15210      5      0   1830    210
+    1      0      0      0      0      -      -      0      2      0      -      -
+`
+	var p DmonParser
+	var samples []GPUSample
+	now := time.Now()
+	for _, line := range strings.Split(sampleData, "\n") {
+		s, ok, err := p.ParseLine(line, now)
+		if err != nil {
+			t.Fatalf("ParseLine(%q) failed: %v", line, err)
+		}
+		if ok {
+			samples = append(samples, s)
+		}
+	}
+	want := []GPUSample{
+		{Time: now, GPU: 0, SMUtilization: 87, MemoryUtilization: 42, MemoryUsedMB: 15210, PCIeRxMBps: 1830, PCIeTxMBps: 210},
+		{Time: now, GPU: 1},
+	}
+	if len(samples) != len(want) {
+		t.Fatalf("got %d samples, want %d: %+v", len(samples), len(want), samples)
+	}
+	for i := range want {
+		if samples[i] != want[i] {
+			t.Errorf("sample %d got: %+v, want: %+v", i, samples[i], want[i])
+		}
+	}
+}
+
+// TestDmonParserNoHeader checks that samples before a header are rejected.
+func TestDmonParserNoHeader(t *testing.T) {
+	var p DmonParser
+	if _, _, err := p.ParseLine("    0     87     42", time.Now()); err == nil {
+		t.Errorf("ParseLine succeeded without a header")
+	}
+}
@@ -0,0 +1,378 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// defaultMaxInFlight is the default bound on outstanding requests for
+// OpenLoop.
+const defaultMaxInFlight = 4096
+
+// OpenLoop is an open-loop load generator.
+//
+// Unlike closed-loop clients such as 'hey' or 'redis-benchmark', which only
+// issue a request once a previous one completes, OpenLoop issues requests at
+// a constant arrival rate regardless of how long requests take. Latency is
+// measured from the time each request was scheduled to be sent, so queuing
+// delay in the server under test shows up in the tail latency instead of
+// silently lowering the offered load.
+type OpenLoop struct {
+	// Rate is the offered load in requests per second.
+	Rate float64
+
+	// Requests is the number of requests to issue. Benchmarks should
+	// typically set this to b.N, and be run with a fixed count (e.g.
+	// --test.benchtime=10000x) so that percentiles are computed over enough
+	// samples.
+	Requests int
+
+	// MaxInFlight bounds the number of outstanding requests. Requests that
+	// would exceed it are counted as dropped rather than sent late. If zero,
+	// defaultMaxInFlight is used.
+	MaxInFlight int
+}
+
+// OpenLoopResult holds the results of an OpenLoop run.
+type OpenLoopResult struct {
+	// Offered is the offered load in requests per second.
+	Offered float64
+
+	// Latencies holds the latencies of all successful requests, sorted.
+	Latencies []time.Duration
+
+	// Errors is the number of failed requests.
+	Errors int
+
+	// Dropped is the number of requests that were never sent because too
+	// many requests were outstanding.
+	Dropped int
+
+	// Elapsed is the time between the first request being scheduled and the
+	// last request completing.
+	Elapsed time.Duration
+}
+
+// Run issues o.Requests calls to do at the configured rate, and waits for
+// all of them to complete.
+func (o *OpenLoop) Run(ctx context.Context, do func(context.Context) error) (*OpenLoopResult, error) {
+	if o.Rate <= 0 {
+		return nil, fmt.Errorf("invalid rate: %f", o.Rate)
+	}
+	maxInFlight := o.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = defaultMaxInFlight
+	}
+
+	res := &OpenLoopResult{
+		Offered:   o.Rate,
+		Latencies: make([]time.Duration, 0, o.Requests),
+	}
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		inFlight = make(chan struct{}, maxInFlight)
+		interval = time.Duration(float64(time.Second) / o.Rate)
+		start    = time.Now()
+	)
+	for i := 0; i < o.Requests && ctx.Err() == nil; i++ {
+		scheduled := start.Add(time.Duration(i) * interval)
+		if d := time.Until(scheduled); d > 0 {
+			time.Sleep(d)
+		}
+		select {
+		case inFlight <- struct{}{}:
+		default:
+			mu.Lock()
+			res.Dropped++
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(scheduled time.Time) {
+			defer wg.Done()
+			err := do(ctx)
+			latency := time.Since(scheduled)
+			<-inFlight
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				res.Errors++
+				return
+			}
+			res.Latencies = append(res.Latencies, latency)
+		}(scheduled)
+	}
+	wg.Wait()
+	res.Elapsed = time.Since(start)
+	sort.Slice(res.Latencies, func(i, j int) bool { return res.Latencies[i] < res.Latencies[j] })
+	return res, ctx.Err()
+}
+
+// Requester issues the requests of an OpenLoop run.
+type Requester interface {
+	// Do issues a single request. It is called concurrently.
+	Do(ctx context.Context) error
+
+	// Close releases any resources, such as connections, held by the
+	// Requester. It is called once all requests have completed.
+	Close()
+}
+
+// RunRequester is like Run, but issues requests with r and closes it once
+// all of them have completed.
+func (o *OpenLoop) RunRequester(ctx context.Context, r Requester) (*OpenLoopResult, error) {
+	defer r.Close()
+	return o.Run(ctx, r.Do)
+}
+
+// Percentile returns the latency at percentile p (0 < p <= 100) using the
+// nearest-rank method. It returns 0 if there are no latencies.
+func (r *OpenLoopResult) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(r.Latencies))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(r.Latencies) {
+		rank = len(r.Latencies) - 1
+	}
+	return r.Latencies[rank]
+}
+
+// Achieved returns the achieved throughput of successful requests in
+// requests per second.
+func (r *OpenLoopResult) Achieved() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(len(r.Latencies)) / r.Elapsed.Seconds()
+}
+
+// Report reports the results as custom metrics.
+func (r *OpenLoopResult) Report(b *testing.B) {
+	b.Helper()
+	ReportCustomMetric(b, r.Offered, "offered_rate" /*metric name*/, "QPS" /*unit*/)
+	ReportCustomMetric(b, r.Achieved(), "achieved_rate" /*metric name*/, "QPS" /*unit*/)
+	ReportCustomMetric(b, r.Percentile(50).Seconds(), "p50_latency" /*metric name*/, "s" /*unit*/)
+	ReportCustomMetric(b, r.Percentile(99).Seconds(), "p99_latency" /*metric name*/, "s" /*unit*/)
+	ReportCustomMetric(b, r.Percentile(99.9).Seconds(), "p999_latency" /*metric name*/, "s" /*unit*/)
+	ReportCustomMetric(b, float64(r.Errors), "errors" /*metric name*/, "requests" /*unit*/)
+	ReportCustomMetric(b, float64(r.Dropped), "dropped" /*metric name*/, "requests" /*unit*/)
+}
+
+// HTTPRequest describes a request made by an OpenLoop HTTP client. It
+// implements Requester.
+type HTTPRequest struct {
+	// Method is the HTTP method. If empty, GET is used.
+	Method string
+
+	// URL is the URL to request.
+	URL string
+
+	// Body is the request body, if any.
+	Body string
+
+	// ContentType is the Content-Type of Body.
+	ContentType string
+
+	// init initializes transport.
+	init      sync.Once
+	transport *http.Transport
+	client    *http.Client
+}
+
+// Do implements Requester.Do. Responses with a 5xx status code are counted as
+// errors.
+func (h *HTTPRequest) Do(ctx context.Context) error {
+	h.init.Do(func() {
+		h.transport = &http.Transport{
+			MaxIdleConns:        defaultMaxInFlight,
+			MaxIdleConnsPerHost: defaultMaxInFlight,
+		}
+		h.client = &http.Client{Transport: h.transport}
+	})
+	method := h.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if h.Body != "" {
+		body = strings.NewReader(h.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, h.URL, body)
+	if err != nil {
+		return err
+	}
+	if h.ContentType != "" {
+		req.Header.Set("Content-Type", h.ContentType)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return err
+	}
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("server error: %s", resp.Status)
+	}
+	return nil
+}
+
+// Close implements Requester.Close.
+func (h *HTTPRequest) Close() {
+	if h.transport != nil {
+		h.transport.CloseIdleConnections()
+	}
+}
+
+// RedisRequest describes a command issued by an OpenLoop redis client. It
+// implements Requester.
+//
+// Connections are pooled, so that the number of connections grows with the
+// number of outstanding requests.
+type RedisRequest struct {
+	// Addr is the address of the redis server.
+	Addr string
+
+	// Args is the command and its arguments (e.g. "SET", "key", "value").
+	Args []string
+
+	// init initializes req and pool.
+	init sync.Once
+	req  []byte
+	pool chan *redisConn
+}
+
+// redisConn is a pooled connection to a redis server.
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// Do implements Requester.Do. It returns once ctx is done, even if the server
+// doesn't reply.
+func (rr *RedisRequest) Do(ctx context.Context) error {
+	rr.init.Do(func() {
+		var cmd strings.Builder
+		fmt.Fprintf(&cmd, "*%d\r\n", len(rr.Args))
+		for _, arg := range rr.Args {
+			fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+		rr.req = []byte(cmd.String())
+		rr.pool = make(chan *redisConn, defaultMaxInFlight)
+	})
+
+	var c *redisConn
+	select {
+	case c = <-rr.pool:
+	default:
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", rr.Addr)
+		if err != nil {
+			return err
+		}
+		c = &redisConn{conn: conn, r: bufio.NewReader(conn)}
+	}
+	// A zero deadline clears the one left by a previous request.
+	deadline, _ := ctx.Deadline()
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		c.conn.Close()
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { c.conn.Close() })
+	err := rr.roundTrip(c)
+	if !stop() {
+		// The connection was closed by ctx being done.
+		return ctx.Err()
+	}
+	if err != nil {
+		c.conn.Close()
+		return err
+	}
+	select {
+	case rr.pool <- c:
+	default:
+		c.conn.Close()
+	}
+	return nil
+}
+
+// roundTrip sends the command on c and reads its reply.
+func (rr *RedisRequest) roundTrip(c *redisConn) error {
+	if _, err := c.conn.Write(rr.req); err != nil {
+		return err
+	}
+	return readRedisReply(c.r)
+}
+
+// Close implements Requester.Close. It closes all pooled connections.
+func (rr *RedisRequest) Close() {
+	for {
+		select {
+		case c := <-rr.pool:
+			c.conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// readRedisReply reads and discards a single non-aggregate RESP reply.
+func readRedisReply(r *bufio.Reader) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return fmt.Errorf("empty redis reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return nil
+	case '-':
+		return fmt.Errorf("redis error: %s", line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return fmt.Errorf("bad bulk length %q: %v", line, err)
+		}
+		if n < 0 {
+			return nil // Null bulk string.
+		}
+		_, err = r.Discard(n + 2) // Including trailing CRLF.
+		return err
+	default:
+		return fmt.Errorf("unsupported redis reply: %q", line)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestOpenLoopPercentile checks the nearest-rank percentile computation.
+func TestOpenLoopPercentile(t *testing.T) {
+	res := &OpenLoopResult{}
+	for i := 1; i <= 1000; i++ {
+		res.Latencies = append(res.Latencies, time.Duration(i)*time.Millisecond)
+	}
+	for _, tc := range []struct {
+		p    float64
+		want time.Duration
+	}{
+		{p: 50, want: 500 * time.Millisecond},
+		{p: 99, want: 990 * time.Millisecond},
+		{p: 99.9, want: 999 * time.Millisecond},
+		{p: 100, want: 1000 * time.Millisecond},
+	} {
+		if got := res.Percentile(tc.p); got != tc.want {
+			t.Errorf("Percentile(%v) got: %v, want: %v", tc.p, got, tc.want)
+		}
+	}
+	if got := (&OpenLoopResult{}).Percentile(99); got != 0 {
+		t.Errorf("Percentile(99) on empty result got: %v, want: 0", got)
+	}
+}
+
+// TestOpenLoopRun checks that all requests are issued and accounted for.
+func TestOpenLoopRun(t *testing.T) {
+	o := &OpenLoop{Rate: 10000, Requests: 100}
+	var count atomic.Int32
+	res, err := o.Run(context.Background(), func(context.Context) error {
+		if count.Add(1)%10 == 0 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if got := len(res.Latencies) + res.Errors + res.Dropped; got != o.Requests {
+		t.Errorf("got %d requests accounted for, want: %d", got, o.Requests)
+	}
+	for i := 1; i < len(res.Latencies); i++ {
+		if res.Latencies[i] < res.Latencies[i-1] {
+			t.Fatalf("latencies are not sorted: %v", res.Latencies)
+		}
+	}
+}
+
+// TestOpenLoopDropped checks that requests beyond MaxInFlight are dropped
+// rather than delayed.
+func TestOpenLoopDropped(t *testing.T) {
+	block := make(chan struct{})
+	o := &OpenLoop{Rate: 10000, Requests: 10, MaxInFlight: 1}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(block)
+	}()
+	res, err := o.Run(context.Background(), func(context.Context) error {
+		<-block
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if res.Dropped == 0 {
+		t.Errorf("got no dropped requests, want > 0: %+v", res)
+	}
+}
+
+// TestRedisRequestClose checks that RunRequester closes pooled connections.
+func TestRedisRequestClose(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer l.Close()
+	closed := make(chan struct{})
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			// Each command is "*1\r\n$4\r\nPING\r\n".
+			for i := 0; i < 3; i++ {
+				if _, err := r.ReadString('\n'); err != nil {
+					close(closed)
+					return
+				}
+			}
+			if _, err := conn.Write([]byte("+PONG\r\n")); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Requests are issued one at a time, so a single connection is used.
+	o := &OpenLoop{Rate: 1000, Requests: 10, MaxInFlight: 1}
+	req := &RedisRequest{Addr: l.Addr().String(), Args: []string{"PING"}}
+	res, err := o.RunRequester(context.Background(), req)
+	if err != nil {
+		t.Fatalf("RunRequester failed: %v", err)
+	}
+	if res.Errors != 0 {
+		t.Errorf("got %d errors, want 0", res.Errors)
+	}
+	select {
+	case <-closed:
+	case <-time.After(10 * time.Second):
+		t.Errorf("pooled connection was not closed")
+	}
+}
+
+// TestRedisRequestCancel checks that requests to a server that doesn't reply
+// return once their context is done.
+func TestRedisRequestCancel(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// Never reply.
+			defer conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	o := &OpenLoop{Rate: 1000, Requests: 10}
+	req := &RedisRequest{Addr: l.Addr().String(), Args: []string{"PING"}}
+	done := make(chan *OpenLoopResult)
+	go func() {
+		res, _ := o.RunRequester(ctx, req)
+		done <- res
+	}()
+	select {
+	case res := <-done:
+		if res.Errors != 10 {
+			t.Errorf("got %d errors, want 10", res.Errors)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("RunRequester didn't return once its context was done")
+	}
+}
+
+// TestReadRedisReply checks parsing of RESP replies.
+func TestReadRedisReply(t *testing.T) {
+	for _, tc := range []struct {
+		reply   string
+		wantErr bool
+	}{
+		{reply: "+OK\r\n"},
+		{reply: ":42\r\n"},
+		{reply: "$5\r\nhello\r\n"},
+		{reply: "$-1\r\n"},
+		{reply: "-ERR unknown command\r\n", wantErr: true},
+		{reply: "*1\r\n$1\r\na\r\n", wantErr: true},
+	} {
+		r := bufio.NewReader(strings.NewReader(tc.reply))
+		if err := readRedisReply(r); (err != nil) != tc.wantErr {
+			t.Errorf("readRedisReply(%q) got err: %v, wantErr: %t", tc.reply, err, tc.wantErr)
+		}
+		if !tc.wantErr && r.Buffered() != 0 {
+			t.Errorf("readRedisReply(%q) left %d bytes unread", tc.reply, r.Buffered())
+		}
+	}
+}
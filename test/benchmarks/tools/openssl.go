@@ -0,0 +1,75 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// OpenSSLSpeed is for 'openssl speed' and measures the throughput of a single
+// algorithm through the EVP interface, which picks hardware accelerated
+// implementations (AES-NI, SHA-NI, AVX2, AVX-512...) when the CPU exposes
+// them.
+type OpenSSLSpeed struct {
+	// Algorithm is the EVP cipher or digest to run, e.g. "sha256".
+	Algorithm string
+
+	// BlockSize is the size of the buffers processed, in bytes.
+	BlockSize int
+
+	// Seconds is the duration of the run.
+	Seconds int
+}
+
+// MakeCmd makes the 'openssl speed' command. -elapsed makes openssl measure
+// wall-clock time rather than the CPU time reported by the kernel, so that
+// results don't depend on how the runtime accounts CPU time.
+func (s *OpenSSLSpeed) MakeCmd() []string {
+	return []string{
+		"openssl", "speed", "-mr", "-elapsed",
+		"-seconds", strconv.Itoa(s.Seconds),
+		"-bytes", strconv.Itoa(s.BlockSize),
+		"-evp", s.Algorithm,
+	}
+}
+
+// Report reports the throughput of the algorithm.
+func (s *OpenSSLSpeed) Report(b *testing.B, output string) {
+	b.Helper()
+	result, err := s.parseThroughput(output)
+	if err != nil {
+		b.Fatalf("parsing throughput from %s failed: %v", output, err)
+	}
+	ReportCustomMetric(b, result, "throughput" /*metric name*/, "bytes_per_second" /*unit*/)
+}
+
+// openSSLResultRE matches the machine readable result line of 'openssl speed',
+// which holds the throughput in bytes per second for each block size, e.g.
+// "+F:22:sha256:1234.56:7890.12".
+var openSSLResultRE = regexp.MustCompile(`(?m)^\+F:\d+:[^:\n]+((?::\d+\.?\d*)+)`)
+
+// parseThroughput parses the throughput of the last block size.
+func (s *OpenSSLSpeed) parseThroughput(data string) (float64, error) {
+	match := openSSLResultRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, fmt.Errorf("could not find throughput: %s", data)
+	}
+	values := strings.Split(strings.TrimPrefix(match[1], ":"), ":")
+	return strconv.ParseFloat(values[len(values)-1], 64)
+}
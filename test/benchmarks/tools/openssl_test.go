@@ -0,0 +1,53 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import "testing"
+
+// TestOpenSSLSpeed tests the parser on sample 'openssl speed -mr' output.
+func TestOpenSSLSpeed(t *testing.T) {
+	sampleData := `+DT:sha256:3:16384
++R:126397:sha256:3.000125
+version: 3.0.2
+built on: Wed Feb  5 13:19:48 2025 UTC
+options: bn(64,64)
+compiler: gcc -fPIC -pthread -m64 -Wa,--noexecstack -Wall -O3
+CPUINFO: OPENSSL_ia32cap=0x7ffaf3ffffebffff:0x29c67af
++H:16384
++F:22:sha256:690301968.51
+`
+	openssl := OpenSSLSpeed{}
+	want := 690301968.51
+	if got, err := openssl.parseThroughput(sampleData); err != nil {
+		t.Fatalf("parse throughput failed: %v", err)
+	} else if got != want {
+		t.Fatalf("got: %f want: %f", got, want)
+	}
+}
+
+// TestOpenSSLSpeedBlockSizes tests the parser on output for several block
+// sizes.
+func TestOpenSSLSpeedBlockSizes(t *testing.T) {
+	sampleData := `+H:16:64:256:1024:8192:16384
++F:22:AES-256-GCM:512341234.12:1402312312.54:3012312312.00:4812312312.99:5412312312.10:5502312312.75
+`
+	openssl := OpenSSLSpeed{}
+	want := 5502312312.75
+	if got, err := openssl.parseThroughput(sampleData); err != nil {
+		t.Fatalf("parse throughput failed: %v", err)
+	} else if got != want {
+		t.Fatalf("got: %f want: %f", got, want)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// PyTorchTraining is a DistributedDataParallel training run of the
+// /ddp_train.py script in the gpu/pytorch image.
+type PyTorchTraining struct {
+	// Model is the model to train: "resnet50" or "transformer".
+	Model string
+	// GPUs is the number of training processes, one per GPU.
+	GPUs int
+	// BatchSize is the per-process batch size.
+	BatchSize int
+	// WarmupSteps is the number of unmeasured training steps run before the
+	// measured ones. Zero uses the script's default.
+	WarmupSteps int
+	// Steps is the number of measured training steps.
+	Steps int
+	// CheckpointEvery is the number of steps between checkpoint writes. Zero
+	// disables checkpointing.
+	CheckpointEvery int
+	// CheckpointDir is the directory checkpoints are written to.
+	CheckpointDir string
+}
+
+// MakeCmd makes a torchrun command.
+func (p *PyTorchTraining) MakeCmd() []string {
+	cmd := []string{
+		"torchrun", "--standalone", fmt.Sprintf("--nproc_per_node=%d", p.GPUs),
+		"/ddp_train.py",
+		fmt.Sprintf("--model=%s", p.Model),
+		fmt.Sprintf("--batch-size=%d", p.BatchSize),
+		fmt.Sprintf("--steps=%d", p.Steps),
+	}
+	if p.WarmupSteps > 0 {
+		cmd = append(cmd, fmt.Sprintf("--warmup-steps=%d", p.WarmupSteps))
+	}
+	if p.CheckpointEvery > 0 {
+		cmd = append(cmd,
+			fmt.Sprintf("--checkpoint-every=%d", p.CheckpointEvery),
+			fmt.Sprintf("--checkpoint-dir=%s", p.CheckpointDir))
+	}
+	return cmd
+}
+
+// Report parses and reports metrics from the training run output.
+func (p *PyTorchTraining) Report(b *testing.B, output string) {
+	b.Helper()
+	samples, err := p.parseMetric(output, "samples_per_sec")
+	if err != nil {
+		b.Fatalf("failed to parse samples per second: %v", err)
+	}
+	ReportCustomMetric(b, samples, "samples_per_second" /*metric name*/, "samples_per_second" /*unit*/)
+
+	stepTime, err := p.parseMetric(output, "step_time_ms")
+	if err != nil {
+		b.Fatalf("failed to parse step time: %v", err)
+	}
+	ReportCustomMetric(b, stepTime/1000, "step_time" /*metric name*/, "s" /*unit*/)
+
+	if p.CheckpointEvery > 0 {
+		checkpoint, err := p.parseMetric(output, "checkpoint_write_bytes_per_sec")
+		if err != nil {
+			b.Fatalf("failed to parse checkpoint write throughput: %v", err)
+		}
+		ReportCustomMetric(b, checkpoint, "checkpoint_write_throughput" /*metric name*/, "bytes_per_second" /*unit*/)
+	}
+}
+
+var pytorchMetricRE = regexp.MustCompile(`(?m)^(\w+): (\d+(?:\.\d+)?)\r?$`)
+
+// parseMetric parses the named metric from the training run output.
+func (p *PyTorchTraining) parseMetric(data, name string) (float64, error) {
+	for _, match := range pytorchMetricRE.FindAllStringSubmatch(data, -1) {
+		if match[1] == name {
+			return strconv.ParseFloat(match[2], 64)
+		}
+	}
+	return 0, fmt.Errorf("metric %q not found in output: %s", name, data)
+}
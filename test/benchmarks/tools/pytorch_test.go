@@ -0,0 +1,72 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestPyTorchTraining tests the parser on sample ddp_train.py output.
+func TestPyTorchTraining(t *testing.T) {
+	sampleData := `
+[2024-03-01 10:00:00,000] torch.distributed.run: [WARNING] Setting OMP_NUM_THREADS environment variable for each process to be 1 in default.
+step_time_ms: 182.503011
+samples_per_sec: 701.358442
+checkpoint_write_bytes_per_sec: 1234567.5
+`
+	p := PyTorchTraining{}
+	for name, want := range map[string]float64{
+		"step_time_ms":                   182.503011,
+		"samples_per_sec":                701.358442,
+		"checkpoint_write_bytes_per_sec": 1234567.5,
+	} {
+		got, err := p.parseMetric(sampleData, name)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", name, err)
+		}
+		if got != want {
+			t.Errorf("%s: got %f want %f", name, got, want)
+		}
+	}
+	if _, err := p.parseMetric(sampleData, "loss"); err == nil {
+		t.Errorf("parsing missing metric succeeded")
+	}
+}
+
+// TestPyTorchTrainingCmd tests that optional arguments are only passed when
+// set.
+func TestPyTorchTrainingCmd(t *testing.T) {
+	p := PyTorchTraining{
+		Model:     "resnet50",
+		GPUs:      1,
+		BatchSize: 64,
+		Steps:     200,
+	}
+	if cmd := p.MakeCmd(); slices.ContainsFunc(cmd, func(arg string) bool {
+		return arg == "--warmup-steps=0" || arg == "--checkpoint-every=0"
+	}) {
+		t.Errorf("MakeCmd() = %v, want no unset optional arguments", cmd)
+	}
+	p.WarmupSteps = 1
+	p.CheckpointEvery = 1
+	p.CheckpointDir = "/tmp"
+	cmd := p.MakeCmd()
+	for _, want := range []string{"--warmup-steps=1", "--checkpoint-every=1", "--checkpoint-dir=/tmp"} {
+		if !slices.Contains(cmd, want) {
+			t.Errorf("MakeCmd() = %v, want it to contain %q", cmd, want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// UDSBench makes `udsbench` commands and parses their output. udsbench
+// measures UNIX domain socket latency and throughput between a server and a
+// client, which may run in different containers.
+type UDSBench struct {
+	Type    string // Socket type: stream, dgram or seqpacket.
+	Size    int    // Size of each message in bytes.
+	Count   int    // Number of messages the client sends.
+	Latency bool   // Wait for each message to be echoed before sending the next.
+	FDs     bool   // Pass a file descriptor with each message.
+}
+
+// MakeServerCmd returns a udsbench server command listening on addr. Addresses
+// starting with '@' are in the abstract namespace. The server prints
+// "listening" once clients can connect.
+func (u *UDSBench) MakeServerCmd(addr string) []string {
+	return []string{"udsbench", "server", "--addr=" + addr, "--type=" + u.Type}
+}
+
+// MakeClientCmd returns a udsbench client command connecting to addr.
+func (u *UDSBench) MakeClientCmd(addr string) []string {
+	cmd := []string{
+		"udsbench", "client",
+		"--addr=" + addr,
+		"--type=" + u.Type,
+		fmt.Sprintf("--size=%d", u.Size),
+		fmt.Sprintf("--count=%d", u.Count),
+	}
+	if u.Latency {
+		cmd = append(cmd, "--latency")
+	}
+	if u.FDs {
+		cmd = append(cmd, "--fds")
+	}
+	return cmd
+}
+
+// Report parses the output of a udsbench client and reports the round trip
+// latency in latency mode, and the bandwidth and message rate otherwise.
+func (u *UDSBench) Report(b *testing.B, output string) {
+	b.Helper()
+	messages, elapsed, err := u.parseResult(output)
+	if err != nil {
+		b.Fatalf("parsing result from %s failed: %v", output, err)
+	}
+	if u.Latency {
+		ReportCustomMetric(b, float64(elapsed.Nanoseconds())/float64(messages), "round_trip_latency" /*metric name*/, "ns" /*unit*/)
+		return
+	}
+	b.SetBytes(int64(u.Size))
+	ReportCustomMetric(b, float64(messages*u.Size)/elapsed.Seconds(), "bandwidth" /*metric name*/, "bytes_per_second" /*unit*/)
+	ReportCustomMetric(b, float64(messages)/elapsed.Seconds(), "message_rate" /*metric name*/, "messages_per_second" /*unit*/)
+}
+
+var (
+	udsBenchMessagesRE = regexp.MustCompile(`messages: (\d+)`)
+	udsBenchElapsedRE  = regexp.MustCompile(`elapsed_ns: (\d+)`)
+)
+
+// parseResult returns the number of messages sent by the client and the time
+// it took.
+func (u *UDSBench) parseResult(data string) (int, time.Duration, error) {
+	match := udsBenchMessagesRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, 0, fmt.Errorf("could not find messages: %s", data)
+	}
+	messages, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	match = udsBenchElapsedRE.FindStringSubmatch(data)
+	if len(match) < 2 {
+		return 0, 0, fmt.Errorf("could not find elapsed_ns: %s", data)
+	}
+	elapsed, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if messages == 0 || elapsed <= 0 {
+		return 0, 0, fmt.Errorf("invalid result: %d messages in %dns", messages, elapsed)
+	}
+	return messages, time.Duration(elapsed), nil
+}
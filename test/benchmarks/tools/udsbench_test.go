@@ -0,0 +1,40 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+// TestUDSBench checks the UDSBench parser on sample output.
+func TestUDSBench(t *testing.T) {
+	sampleData := `
+messages: 2000
+bytes: 131072000
+elapsed_ns: 42734722
+`
+	u := UDSBench{}
+	messages, elapsed, err := u.parseResult(sampleData)
+	if err != nil {
+		t.Fatalf("parseResult failed: %v", err)
+	}
+	if messages != 2000 || elapsed != 42734722*time.Nanosecond {
+		t.Errorf("parseResult = %d, %v, want 2000, 42.734722ms", messages, elapsed)
+	}
+	if _, _, err := u.parseResult("connect: Connection refused\n"); err == nil {
+		t.Errorf("parseResult succeeded on output without results")
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// Zstd is for 'zstd -b', zstd's built-in benchmark mode, which compresses and
+// decompresses synthetic data in memory. zstd picks BMI2 code paths when the
+// CPU exposes them.
+type Zstd struct {
+	// Level is the compression level.
+	Level int
+
+	// Threads is the number of compression threads. 0 means single-threaded.
+	Threads int
+
+	// Seconds is the minimum duration of each of the compression and
+	// decompression runs.
+	Seconds int
+}
+
+// MakeCmd makes the 'zstd -b' command.
+func (z *Zstd) MakeCmd() []string {
+	cmd := []string{"zstd", fmt.Sprintf("-b%d", z.Level), fmt.Sprintf("-i%d", z.Seconds)}
+	if z.Threads > 0 {
+		cmd = append(cmd, fmt.Sprintf("-T%d", z.Threads))
+	}
+	return cmd
+}
+
+// Report reports the compression and decompression speeds.
+func (z *Zstd) Report(b *testing.B, output string) {
+	b.Helper()
+	compress, decompress, err := z.parseSpeeds(output)
+	if err != nil {
+		b.Fatalf("parsing speeds from %s failed: %v", output, err)
+	}
+	ReportCustomMetric(b, compress, "compression_speed" /*metric name*/, "bytes_per_second" /*unit*/)
+	ReportCustomMetric(b, decompress, "decompression_speed" /*metric name*/, "bytes_per_second" /*unit*/)
+}
+
+// zstdSpeedsRE matches the speeds on a result line of 'zstd -b', e.g.
+// " 3#Synthetic 50%     :  10000000 ->   3139094 (x3.186),  338.1 MB/s, 1285.7 MB/s".
+// Older versions print the ratio without the "x" prefix.
+var zstdSpeedsRE = regexp.MustCompile(`\(x?\d+\.?\d*\),\s*(\d+\.?\d*) MB/s\s*,\s*(\d+\.?\d*) MB/s`)
+
+// parseSpeeds parses the compression and decompression speeds in bytes per
+// second. zstd updates its result line in place while it runs, so the last
+// result is the final one.
+func (z *Zstd) parseSpeeds(data string) (float64, float64, error) {
+	matches := zstdSpeedsRE.FindAllStringSubmatch(data, -1)
+	if len(matches) == 0 {
+		return 0, 0, fmt.Errorf("could not find speeds: %s", data)
+	}
+	match := matches[len(matches)-1]
+	compress, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	decompress, err := strconv.ParseFloat(match[2], 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	// zstd's MB is 10^6 bytes.
+	return compress * 1e6, decompress * 1e6, nil
+}
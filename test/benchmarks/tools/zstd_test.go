@@ -0,0 +1,51 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tools
+
+import "testing"
+
+// TestZstd tests the parser on sample 'zstd -b' output.
+func TestZstd(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		data       string
+		compress   float64
+		decompress float64
+	}{
+		{
+			name:       "v1.4",
+			data:       " 3#Synthetic 50%     :  10000000 ->   3139094 (3.186),  31.2 MB/s , 101.5 MB/s \r 3#Synthetic 50%     :  10000000 ->   3139094 (3.186), 338.1 MB/s ,1285.7 MB/s \n",
+			compress:   338.1e6,
+			decompress: 1285.7e6,
+		},
+		{
+			name:       "v1.5",
+			data:       " 3#Synthetic 50%     :  10000000 ->   3140263 (x3.184),  292.6 MB/s, 1195.3 MB/s\n",
+			compress:   292.6e6,
+			decompress: 1195.3e6,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			zstd := Zstd{}
+			compress, decompress, err := zstd.parseSpeeds(tc.data)
+			if err != nil {
+				t.Fatalf("parse speeds failed: %v", err)
+			}
+			if compress != tc.compress || decompress != tc.decompress {
+				t.Fatalf("got: %f, %f want: %f, %f", compress, decompress, tc.compress, tc.decompress)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary conformance runs gVisor's conformance checks against a node with
+// Docker or a Kubernetes cluster where runsc is installed, and reports the
+// results. See //test/conformance.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/subcommands"
+	"gvisor.dev/gvisor/runsc/cmd/util"
+	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/test/conformance"
+	"gvisor.dev/gvisor/tools/gvisor_k8s_tool/provider/clusterflag"
+)
+
+func main() {
+	subcommands.Register(subcommands.HelpCommand(), "")
+	subcommands.Register(subcommands.FlagsCommand(), "")
+	subcommands.Register(new(runCommand), "")
+	subcommands.Register(new(listCommand), "")
+
+	flag.Parse()
+	os.Exit(int(subcommands.Execute(context.Background())))
+}
+
+// checkFlags are the flags that select checks, shared by all commands.
+type checkFlags struct {
+	images       string
+	syscallImage string
+	syscallTests string
+	platform     string
+	filter       string
+}
+
+func (c *checkFlags) setFlags(f *flag.FlagSet) {
+	f.StringVar(&c.images, "images", "", "comma-separated list of key=image pairs overriding the images used by the checks, e.g. to use a registry mirror. See the list command for the keys.")
+	f.StringVar(&c.syscallImage, "syscall-image", "", "image containing syscall test binaries built from //test/syscalls/linux. If empty, syscall tests are not run.")
+	f.StringVar(&c.syscallTests, "syscall-tests", "", "comma-separated list of paths of syscall test binaries in --syscall-image.")
+	f.StringVar(&c.platform, "platform", "systrap", "runsc platform configured in the deployment, used by syscall tests to skip unsupported test cases.")
+	f.StringVar(&c.filter, "filter", "", "regular expression selecting the checks to run by suite/name.")
+}
+
+// checks returns the selected checks and the filter to apply to them.
+func (c *checkFlags) checks() ([]conformance.Check, *regexp.Regexp, error) {
+	conf := conformance.Config{
+		Images:       make(map[string]string),
+		SyscallImage: c.syscallImage,
+		SyscallTests: splitList(c.syscallTests),
+		Platform:     c.platform,
+	}
+	for _, kv := range splitList(c.images) {
+		key, image, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid --images entry %q, want key=image", kv)
+		}
+		if _, ok := conformance.DefaultImages[key]; !ok {
+			return nil, nil, fmt.Errorf("unknown image key %q in --images", key)
+		}
+		conf.Images[key] = image
+	}
+	if c.syscallImage != "" && len(conf.SyscallTests) == 0 {
+		return nil, nil, fmt.Errorf("--syscall-image requires --syscall-tests")
+	}
+	var filter *regexp.Regexp
+	if c.filter != "" {
+		var err error
+		if filter, err = regexp.Compile(c.filter); err != nil {
+			return nil, nil, fmt.Errorf("invalid --filter: %w", err)
+		}
+	}
+	return conformance.Checks(conf), filter, nil
+}
+
+// splitList splits a comma-separated list, ignoring empty entries.
+func splitList(s string) []string {
+	var l []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			l = append(l, e)
+		}
+	}
+	return l
+}
+
+// runCommand implements subcommands.Command for the "run" command.
+type runCommand struct {
+	checkFlags
+
+	runtime      string
+	dockerHost   string
+	cluster      clusterflag.Flag
+	namespace    string
+	runtimeClass string
+	nodeSelector string
+
+	timeout     time.Duration
+	parallelism int
+	format      string
+	output      string
+}
+
+// Name implements subcommands.Command.Name.
+func (*runCommand) Name() string {
+	return "run"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*runCommand) Synopsis() string {
+	return "run conformance checks against a deployment of runsc"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*runCommand) Usage() string {
+	return `run [flags]
+
+Runs the conformance checks in containers and writes a report. By default,
+containers are run with the local docker CLI and --runtime. With --cluster,
+they are run as pods in a Kubernetes cluster with --runtime-class instead.
+
+--cluster can take the form of:
+  * --cluster=kube:<context_name>
+      ... where "<context_name>" is the name of a context in the
+      kubectl config file at $KUBECONFIG.
+  * --cluster=gke:projects/<project>/locations/<location>/clusters/<cluster>
+
+The exit status is 0 if all checks passed or were skipped, and 1 otherwise.
+
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (r *runCommand) SetFlags(f *flag.FlagSet) {
+	r.checkFlags.setFlags(f)
+	f.StringVar(&r.runtime, "runtime", "runsc", "name of the runsc runtime in the Docker daemon's configuration.")
+	f.StringVar(&r.dockerHost, "docker-host", "", "Docker daemon to connect to, e.g. ssh://user@node. Defaults to the docker CLI's default.")
+	f.Var(&r.cluster, "cluster", "Kubernetes cluster to run checks in, instead of Docker.")
+	f.StringVar(&r.namespace, "namespace", "", "namespace of the pods run in --cluster.")
+	f.StringVar(&r.runtimeClass, "runtime-class", conformance.DefaultRuntimeClass, "RuntimeClass of the pods run in --cluster.")
+	f.StringVar(&r.nodeSelector, "node-selector", "", "comma-separated list of label=value pairs restricting the nodes that pods run on in --cluster.")
+	f.DurationVar(&r.timeout, "timeout", conformance.DefaultTimeout, "time limit of each check.")
+	f.IntVar(&r.parallelism, "parallelism", 1, "number of checks to run concurrently.")
+	f.StringVar(&r.format, "format", "text", "report format: text or json.")
+	f.StringVar(&r.output, "output", "", "file to write the report to. Defaults to stdout.")
+}
+
+// target returns the target selected by the flags.
+func (r *runCommand) target(ctx context.Context) (conformance.Target, error) {
+	if r.cluster.StringVal == "" {
+		return &conformance.DockerTarget{Runtime: r.runtime, Host: r.dockerHost}, nil
+	}
+	c, err := r.cluster.Cluster(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialize cluster client: %w", err)
+	}
+	t := &conformance.KubernetesTarget{
+		Cluster:      c,
+		Description:  r.cluster.StringVal,
+		Namespace:    r.namespace,
+		RuntimeClass: r.runtimeClass,
+	}
+	for _, kv := range splitList(r.nodeSelector) {
+		label, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid --node-selector entry %q, want label=value", kv)
+		}
+		if t.NodeSelector == nil {
+			t.NodeSelector = make(map[string]string)
+		}
+		t.NodeSelector[label] = value
+	}
+	return t, nil
+}
+
+// Execute implements subcommands.Command.Execute.
+func (r *runCommand) Execute(ctx context.Context, f *flag.FlagSet, _ ...any) subcommands.ExitStatus {
+	checks, filter, err := r.checks()
+	if err != nil {
+		return util.Errorf("%v", err)
+	}
+	if r.format != "text" && r.format != "json" {
+		return util.Errorf("invalid --format %q, want text or json", r.format)
+	}
+	target, err := r.target(ctx)
+	if err != nil {
+		return util.Errorf("%v", err)
+	}
+
+	report := conformance.Run(ctx, target, checks, conformance.Options{
+		Filter:      filter,
+		Timeout:     r.timeout,
+		Parallelism: r.parallelism,
+	})
+
+	var w io.Writer = os.Stdout
+	if r.output != "" {
+		out, err := os.Create(r.output)
+		if err != nil {
+			return util.Errorf("creating report file: %v", err)
+		}
+		defer out.Close()
+		w = out
+	}
+	if r.format == "json" {
+		err = report.WriteJSON(w)
+	} else {
+		err = report.WriteText(w)
+	}
+	if err != nil {
+		return util.Errorf("writing report: %v", err)
+	}
+	if !report.Passed() {
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// listCommand implements subcommands.Command for the "list" command.
+type listCommand struct {
+	checkFlags
+}
+
+// Name implements subcommands.Command.Name.
+func (*listCommand) Name() string {
+	return "list"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*listCommand) Synopsis() string {
+	return "list conformance checks and the images they use"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*listCommand) Usage() string {
+	return "list [flags]\n"
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (l *listCommand) SetFlags(f *flag.FlagSet) {
+	l.checkFlags.setFlags(f)
+}
+
+// Execute implements subcommands.Command.Execute.
+func (l *listCommand) Execute(ctx context.Context, f *flag.FlagSet, _ ...any) subcommands.ExitStatus {
+	checks, filter, err := l.checks()
+	if err != nil {
+		return util.Errorf("%v", err)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "CHECK\tDESCRIPTION\n")
+	for _, c := range checks {
+		if filter == nil || filter.MatchString(c.FullName()) {
+			fmt.Fprintf(tw, "%s\t%s\n", c.FullName(), c.Description)
+		}
+	}
+	fmt.Fprintf(tw, "\nIMAGE KEY\tDEFAULT IMAGE\n")
+	keys := make([]string, 0, len(conformance.DefaultImages))
+	for key := range conformance.DefaultImages {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		fmt.Fprintf(tw, "%s\t%s\n", key, conformance.DefaultImages[key])
+	}
+	if err := tw.Flush(); err != nil {
+		return util.Errorf("%v", err)
+	}
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,240 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package conformance runs checks derived from gVisor's syscall, image and
+// integration tests against a deployment of runsc, such as a node with Docker
+// or a Kubernetes cluster, and produces a conformance report.
+//
+// Unlike the tests it is derived from, which assume a machine set up by the
+// test scripts, the checks only rely on the deployment being able to run
+// containers from public images with the gVisor runtime, so that platform
+// operators can validate their own configuration.
+package conformance
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+)
+
+// ContainerSpec describes a container run by a check.
+type ContainerSpec struct {
+	// Name is a unique name for the container, which targets may use to name
+	// the objects they create.
+	Name string
+
+	// Image is the container image.
+	Image string
+
+	// Args overrides the image's command, if not empty.
+	Args []string
+
+	// Env are additional environment variables, in "KEY=value" form.
+	Env []string
+}
+
+// Output is the result of running a container to completion.
+type Output struct {
+	// Logs is the container's combined stdout and stderr.
+	Logs string
+
+	// ExitCode is the exit code of the container's init process.
+	ExitCode int
+}
+
+// Target runs containers on a deployment under test.
+type Target interface {
+	// Name describes the deployment in reports.
+	Name() string
+
+	// Run runs a container to completion. It returns an error only if the
+	// container could not be run, and not if it exits with a non-zero code.
+	Run(ctx context.Context, spec ContainerSpec) (Output, error)
+}
+
+// Check is a single conformance check.
+type Check struct {
+	// Suite is the name of the suite the check belongs to, e.g. "syscalls".
+	Suite string
+
+	// Name is the name of the check, unique within its suite.
+	Name string
+
+	// Description describes what the check verifies.
+	Description string
+
+	// Run runs the check against target. It returns nil if the check passed,
+	// an error wrapping ErrSkipped if it doesn't apply to target, and any
+	// other error if it failed.
+	Run func(ctx context.Context, target Target) error
+}
+
+// FullName returns the name of the check including its suite.
+func (c *Check) FullName() string {
+	return c.Suite + "/" + c.Name
+}
+
+// ErrSkipped is wrapped by errors returned by Check.Run for checks that don't
+// apply to a target.
+var ErrSkipped = errors.New("skipped")
+
+// Skipf returns an error for Check.Run that skips the check.
+func Skipf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrSkipped, fmt.Sprintf(format, args...))
+}
+
+// runError is returned by Check.Run when the target failed to run a
+// container, as opposed to the container not behaving as expected.
+type runError struct {
+	err error
+}
+
+// Error implements error.Error.
+func (e *runError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the target's error.
+func (e *runError) Unwrap() error {
+	return e.err
+}
+
+// RunContainer runs spec on target, naming the container after c if spec has
+// no name. Errors from target are reported as StatusError rather than
+// StatusFailed.
+func (c *Check) RunContainer(ctx context.Context, target Target, spec ContainerSpec) (Output, error) {
+	if spec.Name == "" {
+		spec.Name = containerName(c)
+	}
+	out, err := target.Run(ctx, spec)
+	if err != nil {
+		return out, &runError{fmt.Errorf("running container %q with image %q: %w", spec.Name, spec.Image, err)}
+	}
+	return out, nil
+}
+
+// invalidNameChars matches characters that are not allowed in container and
+// pod names.
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// containerName returns a unique container name for c, which is valid for both
+// Docker and Kubernetes.
+func containerName(c *Check) string {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("rand.Read failed: %v", err))
+	}
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(fmt.Sprintf("conformance-%s-%s", c.Suite, c.Name)), "-")
+	const maxPrefixLen = 63 - 1 - 2*len(b)
+	if len(name) > maxPrefixLen {
+		name = name[:maxPrefixLen]
+	}
+	return name + "-" + hex.EncodeToString(b[:])
+}
+
+// DefaultTimeout is the default time limit of each check.
+const DefaultTimeout = 5 * time.Minute
+
+// Options configures Run.
+type Options struct {
+	// Filter, if not nil, selects the checks to run by their full name.
+	Filter *regexp.Regexp
+
+	// Timeout is the time limit of each check. If 0, DefaultTimeout is used.
+	Timeout time.Duration
+
+	// Parallelism is the number of checks to run concurrently. If 0, checks
+	// run one at a time.
+	Parallelism int
+}
+
+// Run runs checks against target and returns a report of their results, in the
+// same order as checks.
+func Run(ctx context.Context, target Target, checks []Check, opts Options) *Report {
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Parallelism <= 0 {
+		opts.Parallelism = 1
+	}
+	var selected []*Check
+	for i := range checks {
+		if opts.Filter == nil || opts.Filter.MatchString(checks[i].FullName()) {
+			selected = append(selected, &checks[i])
+		}
+	}
+
+	r := &Report{
+		Target:  target.Name(),
+		Started: time.Now(),
+		Results: make([]Result, len(selected)),
+	}
+	sem := make(chan struct{}, opts.Parallelism)
+	var wg sync.WaitGroup
+	for i, c := range selected {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, c *Check) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			r.Results[i] = runCheck(ctx, target, c, opts.Timeout)
+		}(i, c)
+	}
+	wg.Wait()
+	r.Duration = time.Since(r.Started)
+	return r
+}
+
+// runCheck runs c against target and returns its result.
+func runCheck(ctx context.Context, target Target, c *Check, timeout time.Duration) Result {
+	log.Infof("Running %s...", c.FullName())
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	err := c.Run(ctx, target)
+	res := Result{
+		Suite:    c.Suite,
+		Name:     c.Name,
+		Duration: time.Since(start),
+	}
+	var rerr *runError
+	switch {
+	case err == nil:
+		res.Status = StatusPassed
+	case errors.Is(err, ErrSkipped):
+		res.Status = StatusSkipped
+	case errors.As(err, &rerr):
+		res.Status = StatusError
+	case ctx.Err() != nil:
+		res.Status = StatusError
+		err = fmt.Errorf("timed out after %v: %w", timeout, err)
+	default:
+		res.Status = StatusFailed
+	}
+	if err != nil {
+		res.Message = err.Error()
+	}
+	log.Infof("%s: %s (%v)", c.FullName(), res.Status, res.Duration.Round(time.Millisecond))
+	return res
+}
@@ -0,0 +1,225 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTarget runs containers by calling run with their image.
+type fakeTarget struct {
+	run func(spec ContainerSpec) (Output, error)
+}
+
+func (f *fakeTarget) Name() string {
+	return "fake"
+}
+
+func (f *fakeTarget) Run(ctx context.Context, spec ContainerSpec) (Output, error) {
+	return f.run(spec)
+}
+
+func containerChecks() []Check {
+	cc := containerCheck{
+		name:       "Echo",
+		image:      "alpine",
+		args:       []string{"echo", "ok"},
+		wantOutput: regexp.MustCompile(`^ok$`),
+	}
+	return []Check{cc.check("test", &Config{})}
+}
+
+func TestContainerCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		out     Output
+		err     error
+		want    Status
+		wantMsg string
+	}{
+		{
+			name: "passed",
+			out:  Output{Logs: "ok"},
+			want: StatusPassed,
+		},
+		{
+			name:    "exit code",
+			out:     Output{Logs: "ok", ExitCode: 1},
+			want:    StatusFailed,
+			wantMsg: "got exit code 1, want 0",
+		},
+		{
+			name:    "output",
+			out:     Output{Logs: "not ok"},
+			want:    StatusFailed,
+			wantMsg: "output doesn't match",
+		},
+		{
+			name:    "run error",
+			err:     errors.New("no such runtime"),
+			want:    StatusError,
+			wantMsg: "no such runtime",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got ContainerSpec
+			target := &fakeTarget{run: func(spec ContainerSpec) (Output, error) {
+				got = spec
+				return tc.out, tc.err
+			}}
+			r := Run(context.Background(), target, containerChecks(), Options{})
+			if len(r.Results) != 1 {
+				t.Fatalf("got %d results, want 1", len(r.Results))
+			}
+			res := r.Results[0]
+			if res.Status != tc.want {
+				t.Errorf("got status %s, want %s (message: %q)", res.Status, tc.want, res.Message)
+			}
+			if !strings.Contains(res.Message, tc.wantMsg) {
+				t.Errorf("got message %q, want it to contain %q", res.Message, tc.wantMsg)
+			}
+			if got.Image != DefaultImages["alpine"] {
+				t.Errorf("got image %q, want %q", got.Image, DefaultImages["alpine"])
+			}
+			if !strings.HasPrefix(got.Name, "conformance-test-echo-") {
+				t.Errorf("got container name %q, want prefix %q", got.Name, "conformance-test-echo-")
+			}
+		})
+	}
+}
+
+func TestRunFilterAndOrder(t *testing.T) {
+	var checks []Check
+	for i := 0; i < 10; i++ {
+		i := i
+		checks = append(checks, Check{
+			Suite: "test",
+			Name:  fmt.Sprintf("Check%d", i),
+			Run: func(ctx context.Context, target Target) error {
+				// Finish out of order.
+				time.Sleep(time.Duration(10-i) * time.Millisecond)
+				switch i % 3 {
+				case 0:
+					return nil
+				case 1:
+					return Skipf("not applicable")
+				default:
+					return errors.New("failed")
+				}
+			},
+		})
+	}
+	r := Run(context.Background(), &fakeTarget{}, checks, Options{
+		Filter:      regexp.MustCompile(`Check[0-5]$`),
+		Parallelism: 4,
+	})
+	var names []string
+	for _, res := range r.Results {
+		names = append(names, res.Name)
+	}
+	if got, want := strings.Join(names, ","), "Check0,Check1,Check2,Check3,Check4,Check5"; got != want {
+		t.Errorf("got results %s, want %s", got, want)
+	}
+	counts := r.Counts()
+	if counts[StatusPassed] != 2 || counts[StatusSkipped] != 2 || counts[StatusFailed] != 2 {
+		t.Errorf("got counts %v, want 2 of each", counts)
+	}
+	if r.Passed() {
+		t.Errorf("Passed() = true with failed checks")
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	if want := "2 passed, 2 failed, 0 errors, 2 skipped"; !strings.Contains(buf.String(), want) {
+		t.Errorf("text report doesn't contain %q:\n%s", want, buf.String())
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	checks := []Check{{
+		Suite: "test",
+		Name:  "Hang",
+		Run: func(ctx context.Context, target Target) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}}
+	r := Run(context.Background(), &fakeTarget{}, checks, Options{Timeout: time.Millisecond})
+	if got := r.Results[0].Status; got != StatusError {
+		t.Errorf("got status %s, want %s", got, StatusError)
+	}
+}
+
+func TestSyscallChecks(t *testing.T) {
+	const logs = `[==========] Running 3 tests from 1 test suite.
+[ RUN      ] OpenTest.A
+[       OK ] OpenTest.A (0 ms)
+[ RUN      ] OpenTest.B
+[  FAILED  ] OpenTest.B (1 ms)
+[ RUN      ] AllTests/ParamTest.C/0
+[  FAILED  ] AllTests/ParamTest.C/0, where GetParam() = 0 (1 ms)
+[==========] 3 tests from 1 test suite ran. (2 ms total)
+[  PASSED  ] 1 test.
+[  FAILED  ] 2 tests, listed below:
+[  FAILED  ] OpenTest.B
+[  FAILED  ] AllTests/ParamTest.C/0, where GetParam() = 0
+`
+	checks := SyscallChecks(Config{
+		SyscallImage: "syscalls",
+		SyscallTests: []string{"/tests/open_test"},
+		Platform:     "systrap",
+	})
+	if len(checks) != 1 || checks[0].Name != "open_test" {
+		t.Fatalf("got checks %+v, want a single open_test check", checks)
+	}
+	target := &fakeTarget{run: func(spec ContainerSpec) (Output, error) {
+		if spec.Image != "syscalls" || spec.Args[0] != "/tests/open_test" {
+			return Output{}, fmt.Errorf("unexpected spec %+v", spec)
+		}
+		return Output{Logs: logs, ExitCode: 1}, nil
+	}}
+	r := Run(context.Background(), target, checks, Options{})
+	want := "2 test cases failed:\nOpenTest.B\nAllTests/ParamTest.C/0"
+	if got := r.Results[0]; got.Status != StatusFailed || got.Message != want {
+		t.Errorf("got %s %q, want %s %q", got.Status, got.Message, StatusFailed, want)
+	}
+}
+
+func TestBuiltinChecksUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, c := range Checks(Config{}) {
+		if seen[c.FullName()] {
+			t.Errorf("duplicate check %s", c.FullName())
+		}
+		seen[c.FullName()] = true
+		if c.Description == "" {
+			t.Errorf("check %s has no description", c.FullName())
+		}
+	}
+	for key := range DefaultImages {
+		if (&Config{Images: map[string]string{key: "mirror/" + key}}).image(key) != "mirror/"+key {
+			t.Errorf("image %q can't be overridden", key)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+)
+
+// dockerRunErrorCode is the exit code of "docker run" when it fails to create
+// or start the container.
+const dockerRunErrorCode = 125
+
+// DockerTarget runs containers with the docker CLI, on the local node or on
+// the daemon at Host.
+type DockerTarget struct {
+	// Runtime is the name of the runsc runtime in the daemon's
+	// configuration, as installed by "runsc install".
+	Runtime string
+
+	// Host is the daemon to connect to, as passed to "docker --host". If
+	// empty, the docker CLI's default is used.
+	Host string
+}
+
+// Name implements Target.Name.
+func (d *DockerTarget) Name() string {
+	if d.Host == "" {
+		return fmt.Sprintf("docker (runtime %q)", d.Runtime)
+	}
+	return fmt.Sprintf("docker at %s (runtime %q)", d.Host, d.Runtime)
+}
+
+// docker returns a docker CLI command.
+func (d *DockerTarget) docker(ctx context.Context, args ...string) *exec.Cmd {
+	if d.Host != "" {
+		args = append([]string{"--host", d.Host}, args...)
+	}
+	return exec.CommandContext(ctx, "docker", args...)
+}
+
+// Run implements Target.Run.
+func (d *DockerTarget) Run(ctx context.Context, spec ContainerSpec) (Output, error) {
+	args := []string{"run", "--rm", "--quiet", "--pull=missing", "--name", spec.Name, "--runtime", d.Runtime}
+	for _, env := range spec.Env {
+		args = append(args, "--env", env)
+	}
+	args = append(args, spec.Image)
+	args = append(args, spec.Args...)
+
+	out, err := d.docker(ctx, args...).CombinedOutput()
+	if ctx.Err() != nil {
+		// Killing the CLI doesn't stop the container.
+		rmCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if rmOut, err := d.docker(rmCtx, "rm", "--force", spec.Name).CombinedOutput(); err != nil {
+			log.Warningf("Failed to remove container %q: %v: %s", spec.Name, err, rmOut)
+		}
+		return Output{Logs: string(out)}, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return Output{Logs: string(out)}, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() != dockerRunErrorCode:
+		return Output{Logs: string(out), ExitCode: exitErr.ExitCode()}, nil
+	default:
+		return Output{Logs: string(out)}, fmt.Errorf("docker run failed: %w: %s", err, out)
+	}
+}
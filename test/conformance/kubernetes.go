@@ -0,0 +1,127 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/tools/gvisor_k8s_tool/cluster"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// DefaultRuntimeClass is the name of gVisor's RuntimeClass on GKE and in
+	// gVisor's installation instructions.
+	DefaultRuntimeClass = "gvisor"
+
+	// podContainerName is the name of the container in check pods.
+	podContainerName = "check"
+)
+
+// KubernetesTarget runs containers as pods in a Kubernetes cluster.
+type KubernetesTarget struct {
+	// Cluster is the cluster to run pods in.
+	Cluster *cluster.Cluster
+
+	// Description describes the cluster in reports.
+	Description string
+
+	// Namespace is the namespace of the pods. If empty,
+	// cluster.NamespaceDefault is used.
+	Namespace string
+
+	// RuntimeClass is the RuntimeClass of the pods. If empty,
+	// DefaultRuntimeClass is used.
+	RuntimeClass string
+
+	// NodeSelector, if not empty, restricts pods to matching nodes, e.g. to
+	// validate a single node pool.
+	NodeSelector map[string]string
+}
+
+// Name implements Target.Name.
+func (k *KubernetesTarget) Name() string {
+	return fmt.Sprintf("kubernetes cluster %s (runtime class %q)", k.Description, k.runtimeClass())
+}
+
+func (k *KubernetesTarget) runtimeClass() string {
+	if k.RuntimeClass == "" {
+		return DefaultRuntimeClass
+	}
+	return k.RuntimeClass
+}
+
+// Run implements Target.Run.
+func (k *KubernetesTarget) Run(ctx context.Context, spec ContainerSpec) (Output, error) {
+	var env []corev1.EnvVar
+	for _, kv := range spec.Env {
+		name, value, _ := strings.Cut(kv, "=")
+		env = append(env, corev1.EnvVar{Name: name, Value: value})
+	}
+	runtimeClass := k.runtimeClass()
+	pod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      spec.Name,
+			Namespace: k.Namespace,
+			Labels:    map[string]string{"app.kubernetes.io/name": "gvisor-conformance"},
+		},
+		Spec: corev1.PodSpec{
+			RuntimeClassName: &runtimeClass,
+			RestartPolicy:    corev1.RestartPolicyNever,
+			NodeSelector:     k.NodeSelector,
+			Containers: []corev1.Container{
+				{
+					Name:  podContainerName,
+					Image: spec.Image,
+					// Like "docker run", only override the image's command.
+					Args: spec.Args,
+					Env:  env,
+				},
+			},
+		},
+	}
+	pod, err := k.Cluster.CreatePod(ctx, pod)
+	if err != nil {
+		return Output{}, fmt.Errorf("failed to create Pod %q: %w", spec.Name, err)
+	}
+	defer func() {
+		// Delete the pod even if ctx has expired.
+		delCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := k.Cluster.DeletePod(delCtx, pod); err != nil {
+			log.Warningf("Failed to delete Pod %q in namespace %q: %v", pod.GetName(), pod.GetNamespace(), err)
+		}
+	}()
+
+	done, err := k.Cluster.WaitForPodCompletion(ctx, pod)
+	if err != nil {
+		return Output{}, err
+	}
+	logs, err := k.Cluster.PodLogs(ctx, done, podContainerName)
+	if err != nil {
+		return Output{}, err
+	}
+	for _, cs := range done.Status.ContainerStatuses {
+		if cs.Name == podContainerName && cs.State.Terminated != nil {
+			return Output{Logs: logs, ExitCode: int(cs.State.Terminated.ExitCode)}, nil
+		}
+	}
+	return Output{Logs: logs}, fmt.Errorf("Pod %q completed in phase %s without a terminated container: %s", pod.GetName(), done.Status.Phase, done.Status.Message)
+}
@@ -0,0 +1,113 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	// StatusPassed means the check passed.
+	StatusPassed Status = "PASSED"
+
+	// StatusFailed means the deployment didn't behave as expected.
+	StatusFailed Status = "FAILED"
+
+	// StatusError means the check could not run, e.g. because the target
+	// failed to run a container or the check timed out.
+	StatusError Status = "ERROR"
+
+	// StatusSkipped means the check doesn't apply to the deployment.
+	StatusSkipped Status = "SKIPPED"
+)
+
+// Result is the result of a check.
+type Result struct {
+	Suite    string        `json:"suite"`
+	Name     string        `json:"name"`
+	Status   Status        `json:"status"`
+	Duration time.Duration `json:"duration"`
+
+	// Message explains why the check didn't pass, and is empty otherwise.
+	Message string `json:"message,omitempty"`
+}
+
+// Report is a conformance report.
+type Report struct {
+	// Target is the name of the deployment the checks ran against.
+	Target   string        `json:"target"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	Results  []Result      `json:"results"`
+}
+
+// Counts returns the number of results with each status.
+func (r *Report) Counts() map[Status]int {
+	counts := make(map[Status]int)
+	for _, res := range r.Results {
+		counts[res.Status]++
+	}
+	return counts
+}
+
+// Passed returns true if no check failed or errored.
+func (r *Report) Passed() bool {
+	counts := r.Counts()
+	return counts[StatusFailed] == 0 && counts[StatusError] == 0
+}
+
+// WriteJSON writes r to w as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes r to w as a human-readable table, followed by the messages
+// of the checks that didn't pass.
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Conformance report for %s (%s)\n\n", r.Target, r.Started.Format(time.RFC3339))
+	fmt.Fprintf(tw, "CHECK\tSTATUS\tDURATION\n")
+	for _, res := range r.Results {
+		fmt.Fprintf(tw, "%s/%s\t%s\t%v\n", res.Suite, res.Name, res.Status, res.Duration.Round(time.Millisecond))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, res := range r.Results {
+		if res.Status == StatusPassed || res.Message == "" {
+			continue
+		}
+		fmt.Fprintf(w, "\n--- %s %s/%s:\n", res.Status, res.Suite, res.Name)
+		for _, line := range strings.Split(strings.TrimRight(res.Message, "\n"), "\n") {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+	}
+
+	counts := r.Counts()
+	_, err := fmt.Fprintf(w, "\n%d passed, %d failed, %d errors, %d skipped in %v\n",
+		counts[StatusPassed], counts[StatusFailed], counts[StatusError], counts[StatusSkipped], r.Duration.Round(time.Millisecond))
+	return err
+}
@@ -0,0 +1,369 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Names of the built-in suites.
+const (
+	// SuiteIntegration checks the runtime's behavior with the same kind of
+	// scenarios as test/e2e.
+	SuiteIntegration = "integration"
+
+	// SuiteImage runs popular images, like test/image.
+	SuiteImage = "image"
+
+	// SuiteSyscalls runs syscall test binaries from test/syscalls.
+	SuiteSyscalls = "syscalls"
+)
+
+// DefaultImages are the images used by the built-in checks, by key. All of
+// them are public.
+var DefaultImages = map[string]string{
+	"alpine": "alpine:3.20",
+	"golang": "golang:1.22-alpine",
+	"nginx":  "nginx:1.27-alpine",
+	"node":   "node:22-alpine",
+	"python": "python:3.12-alpine",
+	"redis":  "redis:7.4-alpine",
+	"ruby":   "ruby:3.3-alpine",
+}
+
+// Config configures the built-in checks.
+type Config struct {
+	// Images overrides DefaultImages, e.g. to use a registry mirror.
+	Images map[string]string
+
+	// SyscallImage is an image containing syscall test binaries, built from
+	// //test/syscalls/linux. If empty, the syscalls suite has no checks.
+	SyscallImage string
+
+	// SyscallTests are the paths of the syscall test binaries in
+	// SyscallImage. Each of them is a check.
+	SyscallTests []string
+
+	// Platform is the runsc platform of the deployment, e.g. "systrap",
+	// which syscall tests use to skip unsupported test cases.
+	Platform string
+}
+
+// image returns the image to use for key.
+func (c *Config) image(key string) string {
+	if img, ok := c.Images[key]; ok {
+		return img
+	}
+	return DefaultImages[key]
+}
+
+// Checks returns the checks of all built-in suites.
+func Checks(conf Config) []Check {
+	var checks []Check
+	checks = append(checks, IntegrationChecks(conf)...)
+	checks = append(checks, ImageChecks(conf)...)
+	checks = append(checks, SyscallChecks(conf)...)
+	return checks
+}
+
+// containerCheck is a check that runs a single container and verifies its
+// exit code and output.
+type containerCheck struct {
+	name        string
+	description string
+
+	// image is a key of DefaultImages.
+	image string
+	args  []string
+	env   []string
+
+	wantExitCode int
+	wantOutput   *regexp.Regexp
+}
+
+// check returns the Check for cc in suite.
+func (cc *containerCheck) check(suite string, conf *Config) Check {
+	c := Check{
+		Suite:       suite,
+		Name:        cc.name,
+		Description: cc.description,
+	}
+	spec := ContainerSpec{
+		Image: conf.image(cc.image),
+		Args:  cc.args,
+		Env:   cc.env,
+	}
+	c.Run = func(ctx context.Context, target Target) error {
+		out, err := c.RunContainer(ctx, target, spec)
+		if err != nil {
+			return err
+		}
+		if out.ExitCode != cc.wantExitCode {
+			return fmt.Errorf("got exit code %d, want %d; output:\n%s", out.ExitCode, cc.wantExitCode, tail(out.Logs, outputTailLines))
+		}
+		if cc.wantOutput != nil && !cc.wantOutput.MatchString(out.Logs) {
+			return fmt.Errorf("output doesn't match %q:\n%s", cc.wantOutput, tail(out.Logs, outputTailLines))
+		}
+		return nil
+	}
+	return c
+}
+
+// outputTailLines is the number of lines of output included in messages.
+const outputTailLines = 20
+
+// tail returns the last n lines of s.
+func tail(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = append([]string{"..."}, lines[len(lines)-n:]...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+var integrationChecks = []containerCheck{
+	{
+		name:        "Sandboxed",
+		description: "containers run in gVisor, as reported by dmesg",
+		image:       "alpine",
+		args:        []string{"dmesg"},
+		wantOutput:  regexp.MustCompile(`Starting gVisor`),
+	},
+	{
+		name:        "HelloWorld",
+		description: "a container runs a command and its output is collected",
+		image:       "alpine",
+		args:        []string{"echo", "Hello world!"},
+		wantOutput:  regexp.MustCompile(`Hello world!`),
+	},
+	{
+		name:         "ExitCode",
+		description:  "the exit code of the container is reported",
+		image:        "alpine",
+		args:         []string{"sh", "-c", "exit 42"},
+		wantExitCode: 42,
+	},
+	{
+		name:        "Env",
+		description: "environment variables are passed to the container",
+		image:       "alpine",
+		args:        []string{"sh", "-c", "echo value=$CONFORMANCE_VAR"},
+		env:         []string{"CONFORMANCE_VAR=gvisor"},
+		wantOutput:  regexp.MustCompile(`value=gvisor`),
+	},
+	{
+		name:        "Procfs",
+		description: "procfs reports the container's processes",
+		image:       "alpine",
+		args:        []string{"sh", "-c", "cat /proc/self/status && ls /proc/1/fd"},
+		wantOutput:  regexp.MustCompile(`(?m)^Name:\s+cat$`),
+	},
+	{
+		name:        "TmpFile",
+		description: "files written to /tmp are read back intact",
+		image:       "alpine",
+		args: []string{"sh", "-c", `dd if=/dev/urandom of=/tmp/a bs=1M count=16 2>/dev/null &&
+cp /tmp/a /tmp/b &&
+[ "$(sha256sum < /tmp/a)" = "$(sha256sum < /tmp/b)" ] && echo match`},
+		wantOutput: regexp.MustCompile(`match`),
+	},
+	{
+		name:        "ForkExec",
+		description: "processes are created and reaped",
+		image:       "alpine",
+		args:        []string{"sh", "-c", `i=0; while [ $i -lt 200 ]; do /bin/true || exit 1; i=$((i+1)); done; echo done`},
+		wantOutput:  regexp.MustCompile(`done`),
+	},
+	{
+		name:        "Signals",
+		description: "signals are delivered and reflected in the exit status",
+		image:       "alpine",
+		args:        []string{"sh", "-c", `sleep 100 & pid=$!; kill -TERM $pid; wait $pid; echo status=$?`},
+		wantOutput:  regexp.MustCompile(`status=143`),
+	},
+	{
+		name:        "Loopback",
+		description: "TCP connections over loopback",
+		image:       "python",
+		args: []string{"python3", "-c", `
+import socket, threading
+srv = socket.create_server(("127.0.0.1", 0))
+def serve():
+    c, _ = srv.accept()
+    c.sendall(c.recv(64).upper())
+    c.close()
+threading.Thread(target=serve).start()
+cli = socket.create_connection(srv.getsockname())
+cli.sendall(b"ping")
+print(cli.recv(64).decode())
+`},
+		wantOutput: regexp.MustCompile(`PING`),
+	},
+	{
+		name:        "Threads",
+		description: "multi-threaded processes synchronize correctly",
+		image:       "python",
+		args: []string{"python3", "-c", `
+import threading
+n, lock = 0, threading.Lock()
+def work():
+    global n
+    for _ in range(10000):
+        with lock:
+            n += 1
+ts = [threading.Thread(target=work) for _ in range(8)]
+for t in ts: t.start()
+for t in ts: t.join()
+print("count=%d" % n)
+`},
+		wantOutput: regexp.MustCompile(`count=80000`),
+	},
+}
+
+// IntegrationChecks returns the checks of the integration suite.
+func IntegrationChecks(conf Config) []Check {
+	checks := make([]Check, 0, len(integrationChecks))
+	for i := range integrationChecks {
+		checks = append(checks, integrationChecks[i].check(SuiteIntegration, &conf))
+	}
+	return checks
+}
+
+var imageChecks = []containerCheck{
+	{
+		name:        "Python",
+		description: "python runs and loads its native modules",
+		image:       "python",
+		args:        []string{"python3", "-c", "import hashlib, json, sqlite3, ssl, zlib; print(hashlib.sha256(b'gvisor').hexdigest()[:8])"},
+		wantOutput:  regexp.MustCompile(`1f6d3250`),
+	},
+	{
+		name:        "Node",
+		description: "node runs its JIT and event loop",
+		image:       "node",
+		args:        []string{"node", "-e", "setTimeout(() => console.log([1, 2, 3].map(x => x * 2).join(',')), 10)"},
+		wantOutput:  regexp.MustCompile(`2,4,6`),
+	},
+	{
+		name:        "Ruby",
+		description: "ruby runs",
+		image:       "ruby",
+		args:        []string{"ruby", "-e", "puts (1..10).reduce(:+)"},
+		wantOutput:  regexp.MustCompile(`55`),
+	},
+	{
+		name:        "Go",
+		description: "the Go toolchain compiles and runs a program",
+		image:       "golang",
+		args: []string{"sh", "-c", `cd /tmp && cat > main.go <<EOF
+package main
+
+import "fmt"
+
+func main() { fmt.Println("hello from go") }
+EOF
+go run main.go`},
+		env:        []string{"GOCACHE=/tmp/gocache", "GOTOOLCHAIN=local"},
+		wantOutput: regexp.MustCompile(`hello from go`),
+	},
+	{
+		name:        "Nginx",
+		description: "nginx serves requests over loopback",
+		image:       "nginx",
+		args:        []string{"sh", "-c", "nginx && wget -qO- http://127.0.0.1/"},
+		wantOutput:  regexp.MustCompile(`Welcome to nginx`),
+	},
+	{
+		name:        "Redis",
+		description: "redis serves requests over loopback",
+		image:       "redis",
+		args:        []string{"sh", "-c", "redis-server --daemonize yes >/dev/null && sleep 1 && redis-cli set k v >/dev/null && redis-cli get k"},
+		wantOutput:  regexp.MustCompile(`(?m)^v$`),
+	},
+}
+
+// ImageChecks returns the checks of the image suite.
+func ImageChecks(conf Config) []Check {
+	checks := make([]Check, 0, len(imageChecks))
+	for i := range imageChecks {
+		checks = append(checks, imageChecks[i].check(SuiteImage, &conf))
+	}
+	return checks
+}
+
+// SyscallChecks returns the checks of the syscalls suite, one per binary in
+// conf.SyscallTests.
+func SyscallChecks(conf Config) []Check {
+	if conf.SyscallImage == "" {
+		return nil
+	}
+	checks := make([]Check, 0, len(conf.SyscallTests))
+	for _, bin := range conf.SyscallTests {
+		c := Check{
+			Suite:       SuiteSyscalls,
+			Name:        path.Base(bin),
+			Description: fmt.Sprintf("syscall test binary %s passes", bin),
+		}
+		spec := ContainerSpec{
+			Image: conf.SyscallImage,
+			Args:  []string{bin},
+			// See test/runner for how these are set in CI.
+			Env: []string{
+				"TEST_ON_GVISOR=" + conf.Platform,
+				"GVISOR_NETWORK=sandbox",
+				"TEST_TMPDIR=/tmp",
+			},
+		}
+		c.Run = func(ctx context.Context, target Target) error {
+			out, err := c.RunContainer(ctx, target, spec)
+			if err != nil {
+				return err
+			}
+			if out.ExitCode == 0 {
+				return nil
+			}
+			if failed := failedTestCases(out.Logs); len(failed) > 0 {
+				return fmt.Errorf("%d test cases failed:\n%s", len(failed), strings.Join(failed, "\n"))
+			}
+			return fmt.Errorf("got exit code %d; output:\n%s", out.ExitCode, tail(out.Logs, outputTailLines))
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+// gtestFailedRegexp matches the lines of gtest output for failed test cases.
+var gtestFailedRegexp = regexp.MustCompile(`(?m)^\[  FAILED  \] ([^\s,]+\.[^\s,]+)`)
+
+// failedTestCases returns the names of the failed test cases in the output of
+// a gtest binary.
+func failedTestCases(logs string) []string {
+	var failed []string
+	seen := make(map[string]struct{})
+	for _, m := range gtestFailedRegexp.FindAllStringSubmatch(logs, -1) {
+		// Failed test cases are listed both as they complete and in the
+		// summary.
+		if _, ok := seen[m[1]]; ok {
+			continue
+		}
+		seen[m[1]] = struct{}{}
+		failed = append(failed, m[1])
+	}
+	return failed
+}
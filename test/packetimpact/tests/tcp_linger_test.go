@@ -263,3 +263,101 @@ func TestTCPLingerNonEstablished(t *testing.T) {
 		t.Errorf("expected close to take at most %s, but took %s", expectedMaximum, elapsed)
 	}
 }
+
+// TestTCPLingerReturnsOnFinAck tests that a lingering close returns as soon as
+// the peer acknowledges the DUT's FIN rather than waiting for the whole
+// timeout, as on Linux.
+func TestTCPLingerReturnsOnFinAck(t *testing.T) {
+	// Create a socket, listen, TCP connect, and accept.
+	dut := testbench.NewDUT(t)
+	acceptFD, listenFD, conn := createSocket(t, dut)
+	defer closeAll(t, dut, listenFD, conn)
+
+	dut.SetSockLingerOption(t, acceptFD, lingerDuration, true)
+
+	done := make(chan time.Duration)
+	go func() {
+		start := time.Now()
+		dut.CloseWithErrno(context.Background(), t, acceptFD)
+		done <- time.Since(start)
+	}()
+
+	if _, err := conn.Expect(t, testbench.TCP{Flags: testbench.TCPFlags(header.TCPFlagFin | header.TCPFlagAck)}, time.Second); err != nil {
+		t.Fatalf("expected FIN-ACK packet within a second but got none: %s", err)
+	}
+	// Acknowledge the FIN, this moves the DUT to FIN-WAIT-2.
+	conn.Send(t, testbench.TCP{Flags: testbench.TCPFlags(header.TCPFlagAck)})
+
+	if elapsed := <-done; elapsed >= lingerDuration {
+		t.Errorf("expected close to return once the FIN was acknowledged, but took %s", elapsed)
+	}
+}
+
+// TestTCPLingerShutdownWriteCloseWithUnreadData tests that closing a
+// half-closed socket with data still in its receive queue aborts the
+// connection with a RST, even though the FIN was already sent.
+func TestTCPLingerShutdownWriteCloseWithUnreadData(t *testing.T) {
+	// Create a socket, listen, TCP connect, and accept.
+	dut := testbench.NewDUT(t)
+	acceptFD, listenFD, conn := createSocket(t, dut)
+	defer closeAll(t, dut, listenFD, conn)
+
+	dut.SetSockLingerOption(t, acceptFD, lingerDuration, true)
+	dut.Shutdown(t, acceptFD, unix.SHUT_WR)
+	if _, err := conn.Expect(t, testbench.TCP{Flags: testbench.TCPFlags(header.TCPFlagFin | header.TCPFlagAck)}, time.Second); err != nil {
+		t.Fatalf("expected FIN-ACK packet within a second but got none: %s", err)
+	}
+
+	// The DUT can still receive data after shutdown(SHUT_WR).
+	sampleData := []byte("Sample Data")
+	conn.Send(t, testbench.TCP{Flags: testbench.TCPFlags(header.TCPFlagAck | header.TCPFlagPsh)}, &testbench.Payload{Bytes: sampleData})
+	if _, err := conn.Expect(t, testbench.TCP{Flags: testbench.TCPFlags(header.TCPFlagAck)}, time.Second); err != nil {
+		t.Fatalf("expected ACK for the sent data within a second but got none: %s", err)
+	}
+
+	// Closing with unread data must not linger and must send a RST.
+	start := time.Now()
+	dut.CloseWithErrno(context.Background(), t, acceptFD)
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("expected close to take at most %s, but took %s", time.Second, elapsed)
+	}
+	if _, err := conn.Expect(t, testbench.TCP{Flags: testbench.TCPFlags(header.TCPFlagRst | header.TCPFlagAck)}, time.Second); err != nil {
+		t.Errorf("expected RST-ACK packet within a second but got none: %s", err)
+	}
+}
+
+// TestTCPLingerNegativeTimeout tests that a negative SO_LINGER timeout keeps
+// close() lingering until the FIN is acknowledged, as Linux treats it as an
+// unbounded timeout.
+func TestTCPLingerNegativeTimeout(t *testing.T) {
+	// Create a socket, listen, TCP connect, and accept.
+	dut := testbench.NewDUT(t)
+	acceptFD, listenFD, conn := createSocket(t, dut)
+	defer closeAll(t, dut, listenFD, conn)
+
+	dut.SetSockLingerOption(t, acceptFD, -time.Second, true)
+
+	done := make(chan time.Duration)
+	go func() {
+		start := time.Now()
+		dut.CloseWithErrno(context.Background(), t, acceptFD)
+		done <- time.Since(start)
+	}()
+
+	if _, err := conn.Expect(t, testbench.TCP{Flags: testbench.TCPFlags(header.TCPFlagFin | header.TCPFlagAck)}, time.Second); err != nil {
+		t.Fatalf("expected FIN-ACK packet within a second but got none: %s", err)
+	}
+
+	select {
+	case elapsed := <-done:
+		t.Fatalf("expected close to linger until the FIN is acknowledged, but it returned after %s", elapsed)
+	case <-time.After(lingerDuration):
+	}
+
+	conn.Send(t, testbench.TCP{Flags: testbench.TCPFlags(header.TCPFlagAck)})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("expected close to return within a second of the FIN being acknowledged")
+	}
+}
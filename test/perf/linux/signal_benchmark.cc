@@ -12,13 +12,21 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+#include <sched.h>
 #include <signal.h>
 #include <string.h>
+#include <sys/syscall.h>
+#include <unistd.h>
+
+#include <atomic>
+#include <vector>
 
 #include "gtest/gtest.h"
 #include "benchmark/benchmark.h"
 #include "test/util/logging.h"
+#include "test/util/signal_util.h"
 #include "test/util/test_util.h"
+#include "test/util/thread_util.h"
 
 namespace gvisor {
 namespace testing {
@@ -59,6 +67,81 @@ BENCHMARK(BM_FaultSignalFixup)->UseRealTime();
 
 #endif  // __x86_64__
 
+std::atomic<uint64_t> handled;
+
+void CountingHandler(int sig, siginfo_t* si, void* void_ctx) {
+  handled.fetch_add(1, std::memory_order_relaxed);
+}
+
+// Installs CountingHandler for SIGURG, running on an alternate signal stack of
+// the calling thread like the Go runtime does for its preemption signals.
+void InstallCountingHandler(std::vector<char>* altstack) {
+  altstack->resize(SIGSTKSZ);
+  stack_t ss = {};
+  ss.ss_sp = altstack->data();
+  ss.ss_size = altstack->size();
+  TEST_PCHECK(sigaltstack(&ss, nullptr) == 0);
+
+  struct sigaction sa = {};
+  sigemptyset(&sa.sa_mask);
+  sa.sa_sigaction = CountingHandler;
+  sa.sa_flags = SA_SIGINFO | SA_ONSTACK | SA_RESTART;
+  TEST_PCHECK(sigaction(SIGURG, &sa, nullptr) == 0);
+}
+
+// Signals the calling thread itself, as timers and raise() do.
+void BM_SignalSelf(benchmark::State& state) {
+  std::vector<char> altstack;
+  InstallCountingHandler(&altstack);
+  const pid_t pid = getpid();
+  const pid_t tid = syscall(SYS_gettid);
+
+  for (auto _ : state) {
+    TEST_PCHECK(tgkill(pid, tid, SIGURG) == 0);
+  }
+}
+
+BENCHMARK(BM_SignalSelf)->UseRealTime();
+
+// Sends bursts of signals to a thread running application code, as the Go
+// runtime does to preempt goroutines. Each iteration waits for the signals of
+// its burst to be handled, which may be coalesced into fewer deliveries.
+void BM_AsyncSignalBurst(benchmark::State& state) {
+  const int burst = state.range(0);
+  const pid_t pid = getpid();
+  std::atomic<pid_t> target_tid(0);
+  std::atomic<bool> done(false);
+
+  ScopedThread target([&] {
+    std::vector<char> altstack;
+    InstallCountingHandler(&altstack);
+    target_tid.store(syscall(SYS_gettid));
+    while (!done.load(std::memory_order_relaxed)) {
+      // Spin in application code.
+    }
+  });
+  pid_t tid;
+  while ((tid = target_tid.load()) == 0) {
+    sched_yield();
+  }
+
+  for (auto _ : state) {
+    const uint64_t before = handled.load();
+    for (int i = 0; i < burst; i++) {
+      TEST_PCHECK(tgkill(pid, tid, SIGURG) == 0);
+    }
+    while (handled.load() == before) {
+      // Wait for the burst to be handled.
+    }
+  }
+
+  done.store(true);
+  target.Join();
+  state.SetItemsProcessed(state.iterations() * burst);
+}
+
+BENCHMARK(BM_AsyncSignalBurst)->Range(1, 64)->UseRealTime();
+
 }  // namespace
 
 }  // namespace testing
@@ -122,8 +122,8 @@ def _syscall_test(
         # Containerize in the following cases:
         #  - "container" is explicitly specified as a tag
         #  - Running tests natively
-        #  - Running tests with host networking
-        container = "container" in tags or network == "host"
+        #  - Running tests with host or hybrid networking
+        container = "container" in tags or network in ("host", "hybrid")
 
     if platform == "native":
         # The "native" platform supports everything.
@@ -183,6 +183,7 @@ def syscall_test(
         add_host_connector = False,
         add_host_fifo = False,
         add_hostinet = False,
+        add_hybridnet = False,
         add_directfs = True,
         one_sandbox = True,
         iouring = False,
@@ -203,6 +204,7 @@ def syscall_test(
       add_host_connector: setup host threads to connect to bound UDS created by sandbox.
       add_host_fifo: setup FIFO files on the host.
       add_hostinet: add a hostinet test.
+      add_hybridnet: add a test with hybrid networking.
       add_directfs: add a directfs test.
       one_sandbox: runs each unit test in a new sandbox instance.
       iouring: enable IO_URING support.
@@ -285,6 +287,23 @@ def syscall_test(
             leak_check = leak_check,
             **kwargs
         )
+    if add_hybridnet:
+        _syscall_test(
+            test = test,
+            platform = default_platform,
+            use_tmpfs = use_tmpfs,
+            network = "hybrid",
+            add_host_uds = add_host_uds,
+            add_host_connector = add_host_connector,
+            add_host_fifo = add_host_fifo,
+            tags = platforms.get(default_platform, []) + tags,
+            debug = debug,
+            iouring = iouring,
+            container = container,
+            one_sandbox = one_sandbox,
+            leak_check = leak_check,
+            **kwargs
+        )
     if not use_tmpfs:
         # Also test shared gofer access.
         _syscall_test(
@@ -50,7 +50,7 @@ var (
 	strace             = flag.Bool("strace", false, "enable strace logs")
 	platform           = flag.String("platform", "ptrace", "platform to run on")
 	platformSupport    = flag.String("platform-support", "", "String passed to the test as GVISOR_PLATFORM_SUPPORT environment variable. Used to determine which syscall tests are expected to work with the current platform.")
-	network            = flag.String("network", "none", "network stack to run on (sandbox, host, none)")
+	network            = flag.String("network", "none", "network stack to run on (sandbox, host, hybrid, none)")
 	useTmpfs           = flag.Bool("use-tmpfs", false, "mounts tmpfs for /tmp")
 	fusefs             = flag.Bool("fusefs", false, "mounts a fusefs for /tmp")
 	fileAccess         = flag.String("file-access", "exclusive", "mounts root in exclusive or shared mode")
@@ -85,6 +85,12 @@ func getSetupContainerPath() string {
 	return setupContainer
 }
 
+// usesHostNetwork returns true if the sandbox sends at least some sockets to
+// the host's network stack.
+func usesHostNetwork() bool {
+	return *network == "host" || *network == "hybrid"
+}
+
 // runTestCaseNative runs the test case directly on the host machine.
 func runTestCaseNative(testBin string, tc *gtest.TestCase, args []string, t *testing.T) {
 	// These tests might be running in parallel, so make sure they have a
@@ -235,8 +241,8 @@ func runRunsc(tc *gtest.TestCase, spec *specs.Spec) error {
 		"-gvisor-gro=200000ns",
 	}
 
-	if *network == "host" && !testutil.TestEnvSupportsNetAdmin {
-		log.Warningf("Testing with network=host but test environment does not support net admin or raw sockets. Raw sockets will not be enabled.")
+	if usesHostNetwork() && !testutil.TestEnvSupportsNetAdmin {
+		log.Warningf("Testing with network=%s but test environment does not support net admin or raw sockets. Raw sockets will not be enabled.", *network)
 	} else {
 		args = append(args, "-net-raw")
 	}
@@ -360,7 +366,7 @@ func runRunsc(tc *gtest.TestCase, spec *specs.Spec) error {
 	}
 	cmd := exec.Command(specutils.ExePath, cmdArgs...)
 	cmd.SysProcAttr = sysProcAttr
-	if *container || *network == "host" || (cmd.SysProcAttr.Cloneflags&unix.CLONE_NEWNET != 0) {
+	if *container || usesHostNetwork() || (cmd.SysProcAttr.Cloneflags&unix.CLONE_NEWNET != 0) {
 		cmd.SysProcAttr.Cloneflags |= unix.CLONE_NEWNET
 		cmd.Path = getSetupContainerPath()
 		cmd.Args = append([]string{cmd.Path}, cmd.Args...)
@@ -661,8 +667,8 @@ func runTestCaseRunsc(testBin string, tc *gtest.TestCase, args []string, t *test
 			Type:        "tmpfs",
 		})
 	}
-	if *network == "host" && !testutil.TestEnvSupportsNetAdmin {
-		log.Warningf("Testing with network=host but test environment does not support net admin or raw sockets. Dropping CAP_NET_ADMIN and CAP_NET_RAW.")
+	if usesHostNetwork() && !testutil.TestEnvSupportsNetAdmin {
+		log.Warningf("Testing with network=%s but test environment does not support net admin or raw sockets. Dropping CAP_NET_ADMIN and CAP_NET_RAW.", *network)
 		specutils.DropCapability(spec.Process.Capabilities, "CAP_NET_ADMIN")
 		specutils.DropCapability(spec.Process.Capabilities, "CAP_NET_RAW")
 	}
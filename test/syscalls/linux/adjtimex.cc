@@ -0,0 +1,131 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <fcntl.h>
+#include <sys/time.h>
+#include <sys/timex.h>
+#include <time.h>
+
+#include <cstdlib>
+#include <memory>
+
+#include "gmock/gmock.h"
+#include "gtest/gtest.h"
+#include "test/util/capability_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+// FdToClockID is FD_TO_CLOCKID from Linux's include/linux/posix-timers.h.
+clockid_t FdToClockID(int fd) {
+  return static_cast<clockid_t>((~static_cast<unsigned int>(fd) << 3) | 3);
+}
+
+// Adjusting the clock must fail. Natively, this requires dropping
+// CAP_SYS_TIME, but the sandbox's clock can't be adjusted regardless.
+void MaybeDropCapSysTime(std::unique_ptr<AutoCapability>* cap) {
+  if (!IsRunningOnGvisor()) {
+    *cap = std::make_unique<AutoCapability>(CAP_SYS_TIME, false);
+  }
+}
+
+TEST(AdjtimexTest, ReadOnly) {
+  struct timex tx = {};
+  int state;
+  ASSERT_THAT(state = adjtimex(&tx), SyscallSucceeds());
+  EXPECT_GE(state, TIME_OK);
+  EXPECT_LE(state, TIME_ERROR);
+
+  // The returned time is the current time.
+  struct timeval now;
+  ASSERT_THAT(gettimeofday(&now, nullptr), SyscallSucceeds());
+  EXPECT_LE(std::abs(now.tv_sec - tx.time.tv_sec), 1);
+
+  // An unsynchronized clock is reported as such.
+  if (tx.status & STA_UNSYNC) {
+    EXPECT_EQ(state, TIME_ERROR);
+  }
+  EXPECT_GE(tx.maxerror, tx.esterror);
+}
+
+TEST(AdjtimexTest, OffsetSingleShotRead) {
+  struct timex tx = {};
+  tx.modes = ADJ_OFFSET_SS_READ;
+  EXPECT_THAT(adjtimex(&tx), SyscallSucceeds());
+}
+
+TEST(AdjtimexTest, AdjustFailsWithEPERM) {
+  std::unique_ptr<AutoCapability> cap;
+  MaybeDropCapSysTime(&cap);
+
+  for (unsigned int modes :
+       {ADJ_OFFSET, ADJ_FREQUENCY, ADJ_MAXERROR, ADJ_ESTERROR, ADJ_STATUS,
+        ADJ_TIMECONST, ADJ_TICK, ADJ_OFFSET_SINGLESHOT, ADJ_SETOFFSET}) {
+    SCOPED_TRACE(modes);
+    // Read the current state so that a failure to reject the adjustment
+    // doesn't change the clock.
+    struct timex tx = {};
+    ASSERT_THAT(adjtimex(&tx), SyscallSucceeds());
+    tx.modes = modes;
+    tx.offset = 0;
+    tx.time = {};
+    EXPECT_THAT(adjtimex(&tx), SyscallFailsWithErrno(EPERM));
+  }
+}
+
+TEST(AdjtimexTest, BadAddress) {
+  EXPECT_THAT(adjtimex(nullptr), SyscallFailsWithErrno(EFAULT));
+}
+
+TEST(ClockAdjtimeTest, RealtimeReadOnly) {
+  struct timex tx = {};
+  int state;
+  ASSERT_THAT(state = clock_adjtime(CLOCK_REALTIME, &tx), SyscallSucceeds());
+  EXPECT_GE(state, TIME_OK);
+  EXPECT_LE(state, TIME_ERROR);
+}
+
+TEST(ClockAdjtimeTest, RealtimeAdjustFailsWithEPERM) {
+  std::unique_ptr<AutoCapability> cap;
+  MaybeDropCapSysTime(&cap);
+
+  struct timex tx = {};
+  ASSERT_THAT(clock_adjtime(CLOCK_REALTIME, &tx), SyscallSucceeds());
+  tx.modes = ADJ_FREQUENCY;
+  EXPECT_THAT(clock_adjtime(CLOCK_REALTIME, &tx),
+              SyscallFailsWithErrno(EPERM));
+}
+
+TEST(ClockAdjtimeTest, MonotonicNotSupported) {
+  struct timex tx = {};
+  EXPECT_THAT(clock_adjtime(CLOCK_MONOTONIC, &tx),
+              SyscallFailsWithErrno(EOPNOTSUPP));
+}
+
+TEST(ClockAdjtimeTest, NonClockFD) {
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/null", O_RDONLY));
+  struct timex tx = {};
+  EXPECT_THAT(clock_adjtime(FdToClockID(fd.get()), &tx),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -54,7 +54,7 @@ using ::testing::Key;
 using ::testing::Not;
 
 std::vector<std::string> known_controllers = {
-    "cpu", "cpuset", "cpuacct", "devices", "job", "memory", "pids",
+    "cpu", "cpuset", "cpuacct", "devices", "job", "memory", "misc", "pids",
 };
 
 bool CgroupsAvailable() {
@@ -988,6 +988,48 @@ TEST(PIDsCgroup, CanLowerLimitBelowCurrentCharge) {
   EXPECT_NO_ERRNO(child.WriteIntegerControlFile("pids.max", 0));
 }
 
+TEST(MiscCgroup, ControlFilesExist) {
+  SKIP_IF(!CgroupsAvailable());
+
+  Cgroup c = Cgroup::RootCgroup("/sys/fs/cgroup/misc");
+  EXPECT_THAT(c.ReadControlFile("misc.current"),
+              IsPosixErrorOkAndHolds("gpu_mem 0\n"));
+  // Limits aren't available in the root cgroup.
+  EXPECT_THAT(c.ReadControlFile("misc.max"), PosixErrorIs(ENOENT, _));
+
+  Cgroup child = ASSERT_NO_ERRNO_AND_VALUE(c.CreateChild("child"));
+  EXPECT_THAT(child.ReadControlFile("misc.current"),
+              IsPosixErrorOkAndHolds("gpu_mem 0\n"));
+  EXPECT_THAT(child.ReadControlFile("misc.max"),
+              IsPosixErrorOkAndHolds("gpu_mem max\n"));
+  EXPECT_THAT(child.ReadControlFile("misc.events"),
+              IsPosixErrorOkAndHolds("gpu_mem.max 0\n"));
+}
+
+TEST(MiscCgroup, SetLimit) {
+  SKIP_IF(!CgroupsAvailable());
+
+  Cgroup c = Cgroup::RootCgroup("/sys/fs/cgroup/misc");
+  Cgroup child = ASSERT_NO_ERRNO_AND_VALUE(c.CreateChild("child"));
+
+  ASSERT_NO_ERRNO(child.WriteControlFile("misc.max", "gpu_mem 1048576"));
+  EXPECT_THAT(child.ReadControlFile("misc.max"),
+              IsPosixErrorOkAndHolds("gpu_mem 1048576\n"));
+
+  EXPECT_THAT(child.WriteControlFile("misc.max", "gpu_mem"),
+              PosixErrorIs(EINVAL, _));
+  EXPECT_THAT(child.WriteControlFile("misc.max", "gpu_mem -1"),
+              PosixErrorIs(EINVAL, _));
+  EXPECT_THAT(child.WriteControlFile("misc.max", "unknown 1"),
+              PosixErrorIs(EINVAL, _));
+  EXPECT_THAT(child.ReadControlFile("misc.max"),
+              IsPosixErrorOkAndHolds("gpu_mem 1048576\n"));
+
+  ASSERT_NO_ERRNO(child.WriteControlFile("misc.max", "gpu_mem max"));
+  EXPECT_THAT(child.ReadControlFile("misc.max"),
+              IsPosixErrorOkAndHolds("gpu_mem max\n"));
+}
+
 TEST(DevicesCgroup, ControlFilesExist) {
   SKIP_IF(!CgroupsAvailable());
 
@@ -12,8 +12,12 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+#include <fcntl.h>
+#include <linux/ptp_clock.h>
 #include <pthread.h>
+#include <sys/ioctl.h>
 #include <sys/time.h>
+#include <sys/timex.h>
 
 #include <cerrno>
 #include <cstdint>
@@ -21,11 +25,13 @@
 #include <list>
 #include <memory>
 #include <string>
+#include <utility>
 
 #include "gmock/gmock.h"
 #include "gtest/gtest.h"
 #include "absl/time/clock.h"
 #include "absl/time/time.h"
+#include "test/util/file_descriptor.h"
 #include "test/util/test_util.h"
 #include "test/util/thread_util.h"
 
@@ -157,6 +163,77 @@ TEST(ClockGettime, InvalidClockIDReturnsEINVAL) {
   EXPECT_THAT(clock_gettime(-1, &tp), SyscallFailsWithErrno(EINVAL));
 }
 
+// FdToClockID is FD_TO_CLOCKID from Linux's include/linux/posix-timers.h.
+clockid_t FdToClockID(int fd) {
+  return static_cast<clockid_t>((~static_cast<unsigned int>(fd) << 3) | 3);
+}
+
+TEST(ClockGettime, NonClockFDReturnsEINVAL) {
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/null", O_RDONLY));
+  struct timespec tp;
+  EXPECT_THAT(clock_gettime(FdToClockID(fd.get()), &tp),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(clock_getres(FdToClockID(fd.get()), &tp),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(ClockGettime, ClosedFDReturnsEINVAL) {
+  int raw_fd;
+  {
+    const FileDescriptor fd =
+        ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/null", O_RDONLY));
+    raw_fd = fd.get();
+  }
+  struct timespec tp;
+  EXPECT_THAT(clock_gettime(FdToClockID(raw_fd), &tp),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(clock_getres(FdToClockID(raw_fd), &tp),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+// PTP hardware clocks are only available if the host has one and the sandbox
+// is configured to pass it through.
+TEST(ClockGettime, PTPClock) {
+  auto ret = Open("/dev/ptp0", O_RDONLY);
+  SKIP_IF(!ret.ok());
+  const FileDescriptor fd = std::move(ret).ValueOrDie();
+
+  struct timespec tp;
+  EXPECT_THAT(clock_gettime(FdToClockID(fd.get()), &tp), SyscallSucceeds());
+  EXPECT_THAT(clock_getres(FdToClockID(fd.get()), &tp), SyscallSucceeds());
+
+  struct ptp_clock_caps caps = {};
+  EXPECT_THAT(ioctl(fd.get(), PTP_CLOCK_GETCAPS, &caps), SyscallSucceeds());
+
+  struct ptp_sys_offset offset = {};
+  offset.n_samples = 3;
+  ASSERT_THAT(ioctl(fd.get(), PTP_SYS_OFFSET, &offset), SyscallSucceeds());
+  // The system timestamps bracket the PTP clock timestamps, and are taken
+  // from CLOCK_REALTIME.
+  struct timespec now;
+  ASSERT_THAT(clock_gettime(CLOCK_REALTIME, &now), SyscallSucceeds());
+  EXPECT_LE(offset.ts[0].sec, now.tv_sec);
+  EXPECT_GE(offset.ts[2 * offset.n_samples].sec, now.tv_sec - 1);
+}
+
+// Ioctls that configure PTP clocks are not supported in the sandbox.
+TEST(ClockGettime, PTPClockConfigurationNotSupported) {
+  SKIP_IF(!IsRunningOnGvisor());
+  auto ret = Open("/dev/ptp0", O_RDONLY);
+  SKIP_IF(!ret.ok());
+  const FileDescriptor fd = std::move(ret).ValueOrDie();
+
+  EXPECT_THAT(ioctl(fd.get(), PTP_ENABLE_PPS, 1),
+              SyscallFailsWithErrno(ENOTTY));
+  struct ptp_pin_desc desc = {};
+  EXPECT_THAT(ioctl(fd.get(), PTP_PIN_SETFUNC, &desc),
+              SyscallFailsWithErrno(ENOTTY));
+  struct timex tx = {};
+  EXPECT_THAT(clock_adjtime(FdToClockID(fd.get()), &tx),
+              SyscallFailsWithErrno(EOPNOTSUPP));
+}
+
 }  // namespace
 
 }  // namespace testing
@@ -13,12 +13,18 @@
 // limitations under the License.
 
 #include <errno.h>
+#include <string.h>
+#include <sys/mman.h>
 #include <syscall.h>
 #include <unistd.h>
 
+#include <string>
+
 #include "gmock/gmock.h"
 #include "gtest/gtest.h"
+#include "absl/strings/str_cat.h"
 #include "test/util/file_descriptor.h"
+#include "test/util/memory_util.h"
 #include "test/util/temp_path.h"
 #include "test/util/test_util.h"
 
@@ -30,7 +36,6 @@ TEST(FAdvise64Test, Basic) {
   auto file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
   const auto fd = ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDONLY));
 
-  // fadvise64 is noop in gVisor, so just test that it succeeds.
   ASSERT_THAT(syscall(__NR_fadvise64, fd.get(), 0, 10, POSIX_FADV_NORMAL),
               SyscallSucceeds());
   ASSERT_THAT(syscall(__NR_fadvise64, fd.get(), 0, 10, POSIX_FADV_RANDOM),
@@ -45,6 +50,52 @@ TEST(FAdvise64Test, Basic) {
               SyscallSucceeds());
 }
 
+// Advice must not change the contents of the file, whether or not they are
+// cached.
+TEST(FAdvise64Test, DataIntact) {
+  const std::string contents(3 * kPageSize + 100, 'a');
+  auto file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  const auto fd = ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDWR));
+  ASSERT_THAT(pwrite(fd.get(), contents.data(), contents.size(), 0),
+              SyscallSucceedsWithValue(contents.size()));
+
+  for (int advice : {POSIX_FADV_RANDOM, POSIX_FADV_SEQUENTIAL,
+                     POSIX_FADV_WILLNEED, POSIX_FADV_DONTNEED,
+                     POSIX_FADV_NORMAL}) {
+    SCOPED_TRACE(absl::StrCat("advice ", advice));
+    ASSERT_THAT(syscall(__NR_fadvise64, fd.get(), 0, 0, advice),
+                SyscallSucceeds());
+    std::string buf(contents.size(), '\0');
+    ASSERT_THAT(pread(fd.get(), buf.data(), buf.size(), 0),
+                SyscallSucceedsWithValue(contents.size()));
+    EXPECT_EQ(buf, contents);
+  }
+}
+
+// POSIX_FADV_DONTNEED must not drop data written through a shared mapping,
+// or data written after the advised range was written back.
+TEST(FAdvise64Test, DontNeedKeepsDirtyData) {
+  auto file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  const auto fd = ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDWR));
+  ASSERT_THAT(ftruncate(fd.get(), 2 * kPageSize), SyscallSucceeds());
+
+  const Mapping m = ASSERT_NO_ERRNO_AND_VALUE(
+      Mmap(nullptr, kPageSize, PROT_READ | PROT_WRITE, MAP_SHARED, fd.get(), 0));
+  memset(m.ptr(), 'b', kPageSize);
+  const std::string contents(kPageSize, 'c');
+  ASSERT_THAT(pwrite(fd.get(), contents.data(), contents.size(), kPageSize),
+              SyscallSucceedsWithValue(contents.size()));
+
+  ASSERT_THAT(syscall(__NR_fadvise64, fd.get(), 0, 0, POSIX_FADV_DONTNEED),
+              SyscallSucceeds());
+
+  std::string buf(2 * kPageSize, '\0');
+  ASSERT_THAT(pread(fd.get(), buf.data(), buf.size(), 0),
+              SyscallSucceedsWithValue(buf.size()));
+  EXPECT_EQ(buf, std::string(kPageSize, 'b') + contents);
+  EXPECT_EQ(*static_cast<char*>(m.ptr()), 'b');
+}
+
 TEST(FAdvise64Test, FAdvise64WithOpath) {
   auto file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
   const auto fd = ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_PATH));
@@ -370,6 +370,34 @@ TEST(FcntlTest, SetFlags) {
   EXPECT_EQ(rflags, expected);
 }
 
+TEST(FcntlTest, SetGetWriteHint) {
+  TempPath path = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(path.path(), O_RDWR));
+
+  uint64_t hint = RWH_WRITE_LIFE_SHORT;
+  ASSERT_THAT(fcntl(fd.get(), F_SET_RW_HINT, &hint), SyscallSucceeds());
+  hint = RWH_WRITE_LIFE_NOT_SET;
+  ASSERT_THAT(fcntl(fd.get(), F_GET_RW_HINT, &hint), SyscallSucceeds());
+  EXPECT_EQ(hint, RWH_WRITE_LIFE_SHORT);
+
+  // The hint belongs to the file, not to the file description.
+  FileDescriptor fd2 = ASSERT_NO_ERRNO_AND_VALUE(Open(path.path(), O_RDONLY));
+  hint = RWH_WRITE_LIFE_NOT_SET;
+  ASSERT_THAT(fcntl(fd2.get(), F_GET_RW_HINT, &hint), SyscallSucceeds());
+  EXPECT_EQ(hint, RWH_WRITE_LIFE_SHORT);
+}
+
+TEST(FcntlTest, SetInvalidWriteHint) {
+  TempPath path = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open(path.path(), O_RDWR));
+
+  uint64_t hint = RWH_WRITE_LIFE_EXTREME + 1;
+  EXPECT_THAT(fcntl(fd.get(), F_SET_RW_HINT, &hint),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(fcntl(fd.get(), F_SET_RW_HINT, nullptr),
+              SyscallFailsWithErrno(EFAULT));
+}
+
 void TestLock(int fd, short lock_type = F_RDLCK) {  // NOLINT, type in flock
   struct flock fl;
   fl.l_type = lock_type;
@@ -12,10 +12,16 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+#include <linux/netlink.h>
 #include <sys/mount.h>
 
+#include <string>
+#include <vector>
+
 #include "gtest/gtest.h"
 #include "test/syscalls/linux/ip_socket_test_util.h"
+#include "test/syscalls/linux/socket_netlink_route_util.h"
+#include "test/syscalls/linux/socket_netlink_util.h"
 #include "test/util/capability_util.h"
 #include "test/util/file_descriptor.h"
 #include "test/util/temp_path.h"
@@ -90,6 +96,41 @@ TEST(NetworkNamespaceTest, BindMount) {
   ASSERT_NE(ASSERT_NO_ERRNO_AND_VALUE(GetLoopbackIndex()), 0);
 }
 
+// LinkNames returns the index and name of each link, e.g. "1:lo".
+std::vector<std::string> LinkNames(const std::vector<Link>& links) {
+  std::vector<std::string> names;
+  for (const Link& link : links) {
+    names.push_back(std::to_string(link.index) + ":" + link.name);
+  }
+  return names;
+}
+
+// Netlink sockets report the network namespace they were created in, even
+// after their creator moved to another one.
+TEST(NetworkNamespaceTest, NetlinkSocketKeepsNamespace) {
+  // TODO(b/267210840): Fix this tests for hostinet.
+  SKIP_IF(IsRunningWithHostinet());
+
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_ROUTE));
+  const std::vector<std::string> want =
+      LinkNames(ASSERT_NO_ERRNO_AND_VALUE(DumpLinks(fd)));
+
+  ScopedThread t([&] {
+    ASSERT_THAT(unshare(CLONE_NEWNET), SyscallSucceedsWithValue(0));
+
+    EXPECT_EQ(LinkNames(ASSERT_NO_ERRNO_AND_VALUE(DumpLinks(fd))), want);
+
+    // A new namespace only has a loopback interface.
+    const std::vector<Link> links = ASSERT_NO_ERRNO_AND_VALUE(DumpLinks());
+    ASSERT_EQ(links.size(), 1);
+    EXPECT_EQ(links[0].name, "lo");
+  });
+}
+
 }  // namespace
 }  // namespace testing
 }  // namespace gvisor
@@ -12,10 +12,13 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+#include <linux/filter.h>
+#include <linux/if_packet.h>
 #include <net/if.h>
 #include <netinet/if_ether.h>
 #include <netpacket/packet.h>
 #include <poll.h>
+#include <sys/mman.h>
 #include <sys/socket.h>
 #include <sys/types.h>
 
@@ -23,10 +26,13 @@
 
 #include "gmock/gmock.h"
 #include "gtest/gtest.h"
+#include "absl/base/macros.h"
 #include "test/syscalls/linux/ip_socket_test_util.h"
 #include "test/util/capability_util.h"
 #include "test/util/file_descriptor.h"
+#include "test/util/memory_util.h"
 #include "test/util/socket_util.h"
+#include "test/util/test_util.h"
 
 namespace gvisor {
 namespace testing {
@@ -396,6 +402,168 @@ TEST_P(PacketSocketTest, ReceiveSentBoundToProtocolAll) {
   ASSERT_EQ(src_addr.sll_pkttype, PACKET_HOST);
 }
 
+// Binds a UDP socket to loopback and sends a message to it, returning the
+// socket's address.
+PosixErrorOr<sockaddr_in> SendToLoopbackUDP(const FileDescriptor& udp_sock,
+                                            uint64_t contents) {
+  sockaddr_in addr = {
+      .sin_family = AF_INET,
+      .sin_addr = {.s_addr = htonl(INADDR_LOOPBACK)},
+  };
+  RETURN_ERROR_IF_SYSCALL_FAIL(bind(
+      udp_sock.get(), reinterpret_cast<const sockaddr*>(&addr), sizeof(addr)));
+  socklen_t addrlen = sizeof(addr);
+  RETURN_ERROR_IF_SYSCALL_FAIL(getsockname(
+      udp_sock.get(), reinterpret_cast<sockaddr*>(&addr), &addrlen));
+  RETURN_ERROR_IF_SYSCALL_FAIL(
+      sendto(udp_sock.get(), &contents, sizeof(contents), 0,
+             reinterpret_cast<const sockaddr*>(&addr), sizeof(addr)));
+  return addr;
+}
+
+// Binds the packet socket to the loopback interface with ETH_P_ALL.
+void BindToLoopback(const FileDescriptor& socket) {
+  const sockaddr_ll bind_addr = {
+      .sll_family = AF_PACKET,
+      .sll_protocol = htons(ETH_P_ALL),
+      .sll_ifindex = ASSERT_NO_ERRNO_AND_VALUE(GetLoopbackIndex()),
+      .sll_halen = ETH_ALEN,
+  };
+  ASSERT_THAT(bind(socket.get(), reinterpret_cast<const sockaddr*>(&bind_addr),
+                   sizeof(bind_addr)),
+              SyscallSucceeds());
+}
+
+// Packets accepted by an attached filter are truncated to its return value.
+TEST_P(PacketSocketTest, AttachFilterTruncates) {
+  constexpr int kSnaplen = 20;
+  sock_filter code[] = {BPF_STMT(BPF_RET | BPF_K, kSnaplen)};
+  const sock_fprog prog = {
+      .len = ABSL_ARRAYSIZE(code),
+      .filter = code,
+  };
+  ASSERT_THAT(setsockopt(socket_.get(), SOL_SOCKET, SO_ATTACH_FILTER, &prog,
+                         sizeof(prog)),
+              SyscallSucceeds());
+  ASSERT_NO_FATAL_FAILURE(BindToLoopback(socket_));
+
+  FileDescriptor udp_sock =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET, SOCK_DGRAM, 0));
+  ASSERT_NO_ERRNO(SendToLoopbackUDP(udp_sock, 0xAAAAAAAAAAAAAAAA));
+
+  char buf[100];
+  iovec iov = {
+      .iov_base = buf,
+      .iov_len = sizeof(buf),
+  };
+  msghdr msg = {
+      .msg_iov = &iov,
+      .msg_iovlen = 1,
+  };
+  ASSERT_THAT(RecvMsgTimeout(socket_.get(), &msg, 1),
+              IsPosixErrorOkAndHolds(kSnaplen));
+}
+
+// Packets can be received through a TPACKET_V2 receive ring, as libpcap does.
+TEST_P(PacketSocketTest, ReceiveRing) {
+  int version = TPACKET_V2;
+  ASSERT_THAT(setsockopt(socket_.get(), SOL_PACKET, PACKET_VERSION, &version,
+                         sizeof(version)),
+              SyscallSucceeds());
+  int hdrlen = TPACKET_V2;
+  socklen_t optlen = sizeof(hdrlen);
+  ASSERT_THAT(getsockopt(socket_.get(), SOL_PACKET, PACKET_HDRLEN, &hdrlen,
+                         &optlen),
+              SyscallSucceeds());
+  EXPECT_EQ(hdrlen, static_cast<int>(sizeof(tpacket2_hdr)));
+
+  const tpacket_req req = {
+      .tp_block_size = static_cast<unsigned int>(kPageSize),
+      .tp_block_nr = 2,
+      .tp_frame_size = static_cast<unsigned int>(kPageSize / 2),
+      .tp_frame_nr = 4,
+  };
+  ASSERT_THAT(
+      setsockopt(socket_.get(), SOL_PACKET, PACKET_RX_RING, &req, sizeof(req)),
+      SyscallSucceeds());
+  // The version can't be changed once the ring is set up.
+  ASSERT_THAT(setsockopt(socket_.get(), SOL_PACKET, PACKET_VERSION, &version,
+                         sizeof(version)),
+              SyscallFailsWithErrno(EBUSY));
+  const Mapping ring = ASSERT_NO_ERRNO_AND_VALUE(
+      Mmap(nullptr, req.tp_block_size * req.tp_block_nr,
+           PROT_READ | PROT_WRITE, MAP_SHARED, socket_.get(), 0));
+  ASSERT_NO_FATAL_FAILURE(BindToLoopback(socket_));
+
+  FileDescriptor udp_sock =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET, SOCK_DGRAM, 0));
+  constexpr uint64_t kContents = 0xAAAAAAAAAAAAAAAA;
+  ASSERT_NO_ERRNO(SendToLoopbackUDP(udp_sock, kContents));
+
+  // The frame is sent once on sending and again on reception.
+  for (const int pkttype : {PACKET_OUTGOING, PACKET_HOST}) {
+    pollfd pfd = {
+        .fd = socket_.get(),
+        .events = POLLIN,
+    };
+    ASSERT_THAT(RetryEINTR(poll)(&pfd, 1, 1000), SyscallSucceedsWithValue(1));
+
+    const int i = pkttype == PACKET_OUTGOING ? 0 : 1;
+    char* frame = static_cast<char*>(ring.ptr()) + i * req.tp_frame_size;
+    auto* hdr = reinterpret_cast<tpacket2_hdr*>(frame);
+    ASSERT_TRUE(__atomic_load_n(&hdr->tp_status, __ATOMIC_ACQUIRE) &
+                TP_STATUS_USER);
+    const size_t len = (GetParam() == SOCK_RAW ? sizeof(ethhdr) : 0) +
+                       sizeof(iphdr) + sizeof(udphdr) + sizeof(kContents);
+    EXPECT_EQ(hdr->tp_len, len);
+    EXPECT_EQ(hdr->tp_snaplen, len);
+    uint64_t contents;
+    memcpy(&contents, frame + hdr->tp_mac + len - sizeof(contents),
+           sizeof(contents));
+    EXPECT_EQ(contents, kContents);
+
+    auto* addr =
+        reinterpret_cast<sockaddr_ll*>(frame + TPACKET_ALIGN(sizeof(*hdr)));
+    EXPECT_EQ(addr->sll_family, AF_PACKET);
+    EXPECT_EQ(addr->sll_ifindex, ASSERT_NO_ERRNO_AND_VALUE(GetLoopbackIndex()));
+    EXPECT_EQ(ntohs(addr->sll_protocol), ETH_P_IP);
+    EXPECT_EQ(addr->sll_pkttype, pkttype);
+
+    // Return the frame.
+    __atomic_store_n(&hdr->tp_status, TP_STATUS_KERNEL, __ATOMIC_RELEASE);
+  }
+
+  // Both frames are counted, and reading the statistics resets them.
+  tpacket_stats stats;
+  optlen = sizeof(stats);
+  ASSERT_THAT(getsockopt(socket_.get(), SOL_PACKET, PACKET_STATISTICS, &stats,
+                         &optlen),
+              SyscallSucceeds());
+  EXPECT_EQ(stats.tp_packets, 2u);
+  EXPECT_EQ(stats.tp_drops, 0u);
+  ASSERT_THAT(getsockopt(socket_.get(), SOL_PACKET, PACKET_STATISTICS, &stats,
+                         &optlen),
+              SyscallSucceeds());
+  EXPECT_EQ(stats.tp_packets, 0u);
+}
+
+// Promiscuous mode can be enabled on the interface the socket is bound to.
+TEST_P(PacketSocketTest, PromiscuousMembership) {
+  packet_mreq mreq = {
+      .mr_ifindex = ASSERT_NO_ERRNO_AND_VALUE(GetLoopbackIndex()),
+      .mr_type = PACKET_MR_PROMISC,
+  };
+  ASSERT_THAT(setsockopt(socket_.get(), SOL_PACKET, PACKET_ADD_MEMBERSHIP,
+                         &mreq, sizeof(mreq)),
+              SyscallSucceeds());
+  ASSERT_THAT(setsockopt(socket_.get(), SOL_PACKET, PACKET_DROP_MEMBERSHIP,
+                         &mreq, sizeof(mreq)),
+              SyscallSucceeds());
+  EXPECT_THAT(setsockopt(socket_.get(), SOL_PACKET, PACKET_DROP_MEMBERSHIP,
+                         &mreq, sizeof(mreq)),
+              SyscallFailsWithErrno(EADDRNOTAVAIL));
+}
+
 INSTANTIATE_TEST_SUITE_P(AllPacketSocketTests, PacketSocketTest,
                          Values(SOCK_DGRAM, SOCK_RAW));
 
@@ -0,0 +1,245 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+#include <fcntl.h>
+#include <linux/capability.h>
+#include <sys/mman.h>
+#include <sys/mount.h>
+#include <sys/personality.h>
+#include <sys/utsname.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include <cstdint>
+#include <cstdio>
+#include <string>
+
+#include "gtest/gtest.h"
+#include "absl/flags/flag.h"
+#include "absl/strings/str_cat.h"
+#include "test/util/capability_util.h"
+#include "test/util/cleanup.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/fs_util.h"
+#include "test/util/memory_util.h"
+#include "test/util/mount_util.h"
+#include "test/util/multiprocess_util.h"
+#include "test/util/posix_error.h"
+#include "test/util/proc_util.h"
+#include "test/util/temp_path.h"
+#include "test/util/test_util.h"
+
+ABSL_FLAG(bool, personality_test_child, false,
+          "If true, print the personality, the address of a stack variable and "
+          "of a new anonymous mapping, and exit.");
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+constexpr unsigned int kQuery = 0xffffffff;
+
+// SetPersonality sets the personality of the calling thread, and returns a
+// Cleanup that restores it.
+PosixErrorOr<Cleanup> SetPersonality(unsigned int persona) {
+  int old = personality(persona);
+  if (old < 0) {
+    return PosixError(errno, absl::StrCat("personality(", persona, ")"));
+  }
+  return Cleanup([old] { personality(old); });
+}
+
+// RunChild executes this binary in child mode with the given personality, and
+// returns what it printed.
+PosixErrorOr<std::string> RunChild(unsigned int persona) {
+  int fds[2];
+  if (pipe(fds) < 0) {
+    return PosixError(errno, "pipe");
+  }
+  FileDescriptor rfd(fds[0]);
+  FileDescriptor wfd(fds[1]);
+
+  pid_t child_pid = -1;
+  int execve_errno = 0;
+  auto fn = [&] {
+    TEST_PCHECK(dup2(wfd.get(), STDOUT_FILENO) >= 0);
+    TEST_PCHECK(personality(persona) >= 0);
+  };
+  ASSIGN_OR_RETURN_ERRNO(
+      auto kill, ForkAndExec("/proc/self/exe",
+                             {"/proc/self/exe", "--personality_test_child"},
+                             {}, fn, &child_pid, &execve_errno));
+  if (execve_errno != 0) {
+    return PosixError(execve_errno, "execve");
+  }
+  wfd.reset();
+  ASSIGN_OR_RETURN_ERRNO(std::string output, ReadAllFd(rfd.get()));
+
+  int status;
+  if (RetryEINTR(waitpid)(child_pid, &status, 0) < 0) {
+    return PosixError(errno, "waitpid");
+  }
+  kill.Release();
+  if (!WIFEXITED(status) || WEXITSTATUS(status) != 0) {
+    return PosixError(EINVAL, absl::StrCat("child exited with status ",
+                                           status));
+  }
+  return output;
+}
+
+TEST(PersonalityTest, SetAndQuery) {
+  const int old = personality(kQuery);
+  ASSERT_THAT(old, SyscallSucceeds());
+
+  auto cleanup =
+      ASSERT_NO_ERRNO_AND_VALUE(SetPersonality(PER_LINUX | ADDR_NO_RANDOMIZE));
+  EXPECT_THAT(personality(kQuery),
+              SyscallSucceedsWithValue(PER_LINUX | ADDR_NO_RANDOMIZE));
+  EXPECT_THAT(personality(old),
+              SyscallSucceedsWithValue(PER_LINUX | ADDR_NO_RANDOMIZE));
+  EXPECT_THAT(personality(kQuery), SyscallSucceedsWithValue(old));
+}
+
+TEST(PersonalityTest, UnsupportedPersonaAndFlags) {
+  // Like Linux, accept personalities with no effect.
+  constexpr unsigned int kPersona = PER_BSD | FDPIC_FUNCPTRS;
+  auto cleanup = ASSERT_NO_ERRNO_AND_VALUE(SetPersonality(kPersona));
+  EXPECT_THAT(personality(kQuery), SyscallSucceedsWithValue(kPersona));
+}
+
+TEST(PersonalityTest, InheritedByFork) {
+  auto cleanup =
+      ASSERT_NO_ERRNO_AND_VALUE(SetPersonality(PER_LINUX | ADDR_NO_RANDOMIZE));
+  EXPECT_THAT(InForkedProcess([] {
+                TEST_CHECK(personality(kQuery) ==
+                           (PER_LINUX | ADDR_NO_RANDOMIZE));
+              }),
+              IsPosixErrorOkAndHolds(0));
+}
+
+TEST(PersonalityTest, ExecKeepsFlagsButReadImpliesExec) {
+  const std::string output = ASSERT_NO_ERRNO_AND_VALUE(RunChild(
+      PER_LINUX | ADDR_NO_RANDOMIZE | ADDR_COMPAT_LAYOUT | READ_IMPLIES_EXEC));
+  unsigned int persona;
+  ASSERT_EQ(sscanf(output.c_str(), "%x", &persona), 1) << output;
+  EXPECT_EQ(persona, PER_LINUX | ADDR_NO_RANDOMIZE | ADDR_COMPAT_LAYOUT);
+}
+
+TEST(PersonalityTest, AddrNoRandomize) {
+  // Without randomization, the stack and mappings of two executions of the
+  // same binary are at the same addresses.
+  const std::string output1 = ASSERT_NO_ERRNO_AND_VALUE(
+      RunChild(PER_LINUX | ADDR_NO_RANDOMIZE));
+  const std::string output2 = ASSERT_NO_ERRNO_AND_VALUE(
+      RunChild(PER_LINUX | ADDR_NO_RANDOMIZE));
+  EXPECT_EQ(output1, output2);
+}
+
+TEST(PersonalityTest, ReadImpliesExec) {
+  auto cleanup =
+      ASSERT_NO_ERRNO_AND_VALUE(SetPersonality(PER_LINUX | READ_IMPLIES_EXEC));
+  const Mapping m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPageSize, PROT_READ, MAP_PRIVATE));
+  ASSERT_THAT(mprotect(m.ptr(), kPageSize, PROT_NONE), SyscallSucceeds());
+  ASSERT_THAT(mprotect(m.ptr(), kPageSize, PROT_READ | PROT_WRITE),
+              SyscallSucceeds());
+
+  const std::string contents =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/self/maps"));
+  const auto entries = ASSERT_NO_ERRNO_AND_VALUE(ParseProcMaps(contents));
+  bool found = false;
+  for (const auto& entry : entries) {
+    if (entry.start == m.addr()) {
+      found = true;
+      EXPECT_TRUE(entry.readable);
+      EXPECT_TRUE(entry.writable);
+      EXPECT_TRUE(entry.executable);
+    }
+  }
+  EXPECT_TRUE(found) << contents;
+}
+
+// ExecutableAt returns true if /proc/self/maps shows the mapping at addr as
+// executable.
+PosixErrorOr<bool> ExecutableAt(uintptr_t addr) {
+  ASSIGN_OR_RETURN_ERRNO(std::string contents, GetContents("/proc/self/maps"));
+  ASSIGN_OR_RETURN_ERRNO(auto entries, ParseProcMaps(contents));
+  for (const auto& entry : entries) {
+    if (entry.start == addr) {
+      return entry.executable;
+    }
+  }
+  return PosixError(ENOENT, absl::StrCat("no mapping at ", addr));
+}
+
+TEST(PersonalityTest, ReadImpliesExecNoExecMount) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+
+  auto const dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  auto const mount = ASSERT_NO_ERRNO_AND_VALUE(
+      Mount("", dir.path(), "tmpfs", MS_NOEXEC, "mode=0777", 0));
+  auto const file = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileWith(
+      dir.path(), std::string(kPageSize, 'a'), 0666));
+  const FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open(file.path(), O_RDONLY));
+
+  auto cleanup =
+      ASSERT_NO_ERRNO_AND_VALUE(SetPersonality(PER_LINUX | READ_IMPLIES_EXEC));
+  EXPECT_THAT(
+      reinterpret_cast<intptr_t>(mmap(nullptr, kPageSize, PROT_READ | PROT_EXEC,
+                                      MAP_PRIVATE, fd.get(), 0)),
+      SyscallFailsWithErrno(EPERM));
+
+  // Read permission doesn't imply execute permission for mappings that can't
+  // be executable, so mprotect(PROT_READ) succeeds.
+  const Mapping m = ASSERT_NO_ERRNO_AND_VALUE(
+      Mmap(nullptr, kPageSize, PROT_READ, MAP_PRIVATE, fd.get(), 0));
+  EXPECT_FALSE(ASSERT_NO_ERRNO_AND_VALUE(ExecutableAt(m.addr())));
+  ASSERT_THAT(mprotect(m.ptr(), kPageSize, PROT_NONE), SyscallSucceeds());
+  ASSERT_THAT(mprotect(m.ptr(), kPageSize, PROT_READ), SyscallSucceeds());
+  EXPECT_FALSE(ASSERT_NO_ERRNO_AND_VALUE(ExecutableAt(m.addr())));
+}
+
+TEST(PersonalityTest, Linux32Uname) {
+  auto cleanup = ASSERT_NO_ERRNO_AND_VALUE(SetPersonality(PER_LINUX32));
+  struct utsname buf;
+  ASSERT_THAT(uname(&buf), SyscallSucceeds());
+#if defined(__x86_64__)
+  EXPECT_STREQ(buf.machine, "i686");
+#elif defined(__aarch64__)
+  EXPECT_STREQ(buf.machine, "armv8l");
+#endif
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
+
+int main(int argc, char** argv) {
+  gvisor::testing::TestInit(&argc, &argv);
+
+  if (absl::GetFlag(FLAGS_personality_test_child)) {
+    int stack_var;
+    void* addr = mmap(nullptr, gvisor::testing::kPageSize, PROT_READ,
+                      MAP_PRIVATE | MAP_ANONYMOUS, -1, 0);
+    printf("%x %p %p\n", personality(0xffffffff),
+           static_cast<void*>(&stack_var), addr);
+    exit(addr == MAP_FAILED ? 1 : 0);
+  }
+
+  return gvisor::testing::RunAllTests();
+}
@@ -2621,6 +2621,81 @@ TEST(ProcSysVmOvercommitMemory, HasNumericValue) {
       << overcommit_memory;
 }
 
+// Sets the sysctl at path to value, and returns a Cleanup that restores its
+// previous value. Skips the test if the sysctl isn't writable.
+PosixErrorOr<Cleanup> SetSysctl(const std::string& path,
+                                const std::string& value) {
+  ASSIGN_OR_RETURN_ERRNO(std::string old, GetContents(path));
+  RETURN_IF_ERRNO(SetContents(path, value));
+  return Cleanup([path, old] { EXPECT_NO_ERRNO(SetContents(path, old)); });
+}
+
+bool SysctlWritable(const char* path) {
+  int fd = open(path, O_WRONLY);
+  if (fd < 0) {
+    return false;
+  }
+  close(fd);
+  return true;
+}
+
+TEST(ProcSysVm, WritableKnobs) {
+  SKIP_IF(!SysctlWritable("/proc/sys/vm/swappiness"));
+
+  for (const char* path : {"/proc/sys/vm/max_map_count",
+                           "/proc/sys/vm/overcommit_memory",
+                           "/proc/sys/vm/swappiness"}) {
+    const std::string old = ASSERT_NO_ERRNO_AND_VALUE(GetContents(path));
+    EXPECT_NO_ERRNO(SetContents(path, old)) << path;
+  }
+
+  {
+    auto restore = ASSERT_NO_ERRNO_AND_VALUE(
+        SetSysctl("/proc/sys/vm/overcommit_memory", "1"));
+    EXPECT_THAT(GetContents("/proc/sys/vm/overcommit_memory"),
+                IsPosixErrorOkAndHolds("1\n"));
+    EXPECT_THAT(SetContents("/proc/sys/vm/overcommit_memory", "3"),
+                PosixErrorIs(EINVAL));
+  }
+  {
+    auto restore = ASSERT_NO_ERRNO_AND_VALUE(
+        SetSysctl("/proc/sys/vm/swappiness", "10"));
+    EXPECT_THAT(GetContents("/proc/sys/vm/swappiness"),
+                IsPosixErrorOkAndHolds("10\n"));
+    EXPECT_THAT(SetContents("/proc/sys/vm/swappiness", "-1"),
+                PosixErrorIs(EINVAL));
+  }
+}
+
+TEST(ProcSysVmMaxMapCount, LimitsMmap) {
+  SKIP_IF(!SysctlWritable("/proc/sys/vm/max_map_count"));
+
+  // Leave room for a few mappings beyond the current ones.
+  const std::string maps =
+      ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/self/maps"));
+  const int count = std::count(maps.begin(), maps.end(), '\n');
+  constexpr int kRoom = 8;
+  auto restore = ASSERT_NO_ERRNO_AND_VALUE(
+      SetSysctl("/proc/sys/vm/max_map_count", absl::StrCat(count + kRoom)));
+
+  // Alternate protections so that the mappings aren't merged. mmap fails with
+  // ENOMEM once the limit is exceeded.
+  std::vector<Mapping> mappings;
+  int prot = PROT_READ;
+  for (int i = 0; i < 4 * kRoom; i++) {
+    void* addr =
+        mmap(nullptr, kPageSize, prot, MAP_PRIVATE | MAP_ANONYMOUS, -1, 0);
+    if (addr == MAP_FAILED) {
+      EXPECT_EQ(errno, ENOMEM);
+      break;
+    }
+    mappings.emplace_back(addr, kPageSize);
+    prot = prot == PROT_READ ? PROT_NONE : PROT_READ;
+  }
+  EXPECT_FALSE(mappings.empty());
+  EXPECT_LT(mappings.size(), static_cast<size_t>(4 * kRoom));
+}
+
 // Check that link for proc fd entries point the target node, not the
 // symlink itself. Regression test for b/31155070.
 TEST(ProcTaskFd, FstatatFollowsSymlink) {
@@ -0,0 +1,308 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <fcntl.h>
+#include <inttypes.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <string.h>
+#include <sys/mman.h>
+#include <unistd.h>
+
+#include <string>
+#include <utility>
+#include <vector>
+
+#include "gtest/gtest.h"
+#include "test/util/capability_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/fs_util.h"
+#include "test/util/memory_util.h"
+#include "test/util/posix_error.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+using ::testing::_;
+
+constexpr uint64_t kPagemapPresent = 1ULL << 63;
+constexpr uint64_t kPagemapSoftDirty = 1ULL << 55;
+constexpr uint64_t kPagemapPFNMask = (1ULL << 55) - 1;
+
+constexpr char kPageIdleBitmap[] = "/sys/kernel/mm/page_idle/bitmap";
+
+constexpr int kPages = 4;
+
+// Returns the /proc/self/pagemap entries for the kPages pages of m.
+PosixErrorOr<std::vector<uint64_t>> ReadPagemap(const Mapping& m) {
+  ASSIGN_OR_RETURN_ERRNO(FileDescriptor fd,
+                         Open("/proc/self/pagemap", O_RDONLY));
+  std::vector<uint64_t> entries(kPages);
+  const off_t offset = m.addr() / kPageSize * sizeof(uint64_t);
+  const size_t size = entries.size() * sizeof(uint64_t);
+  int ret = pread(fd.get(), entries.data(), size, offset);
+  if (ret < 0) {
+    return PosixError(errno, "pread");
+  }
+  if (static_cast<size_t>(ret) != size) {
+    return PosixError(EIO, "short read");
+  }
+  return entries;
+}
+
+PosixError ClearRefs(const std::string& value) {
+  return SetContents("/proc/self/clear_refs", value);
+}
+
+// Maps kPages anonymous pages between two inaccessible guard pages, so that
+// the pages are a VMA of their own in /proc/self/smaps. Returns the mapping
+// including the guard pages; the usable pages start one page in.
+PosixErrorOr<Mapping> MmapIsolated() {
+  ASSIGN_OR_RETURN_ERRNO(Mapping m, MmapAnon((kPages + 2) * kPageSize,
+                                             PROT_NONE, MAP_PRIVATE));
+  RETURN_ERROR_IF_SYSCALL_FAIL(
+      mprotect(reinterpret_cast<char*>(m.ptr()) + kPageSize,
+               kPages * kPageSize, PROT_READ | PROT_WRITE));
+  return m;
+}
+
+// Returns the Referenced field of the /proc/self/smaps entry for the VMA
+// starting at addr, in kB.
+PosixErrorOr<uint64_t> ReadReferencedKB(uintptr_t addr) {
+  ASSIGN_OR_RETURN_ERRNO(std::string smaps, GetContents("/proc/self/smaps"));
+  char header[32];
+  snprintf(header, sizeof(header), "%lx-", addr);
+  size_t pos = 0;
+  while (smaps.compare(pos, strlen(header), header) != 0) {
+    pos = smaps.find('\n', pos);
+    if (pos == std::string::npos) {
+      return PosixError(ENOENT, "mapping not found in smaps");
+    }
+    pos++;
+  }
+  pos = smaps.find("\nReferenced:", pos);
+  if (pos == std::string::npos) {
+    return PosixError(ENOENT, "Referenced not found in smaps");
+  }
+  uint64_t kb;
+  if (sscanf(smaps.c_str() + pos, "\nReferenced: %" SCNu64 " kB", &kb) != 1) {
+    return PosixError(EINVAL, "malformed Referenced in smaps");
+  }
+  return kb;
+}
+
+// Reads the word of the idle page bitmap that contains pfn, and returns
+// whether pfn is idle.
+PosixErrorOr<bool> PageIdle(const FileDescriptor& bitmap, uint64_t pfn) {
+  uint64_t word;
+  const off_t offset = pfn / 64 * sizeof(word);
+  int ret = pread(bitmap.get(), &word, sizeof(word), offset);
+  if (ret < 0) {
+    return PosixError(errno, "pread");
+  }
+  if (ret != sizeof(word)) {
+    return PosixError(EIO, "short read");
+  }
+  return (word >> (pfn % 64)) & 1;
+}
+
+// Marks pfn idle.
+PosixError SetPageIdle(const FileDescriptor& bitmap, uint64_t pfn) {
+  const uint64_t word = 1ULL << (pfn % 64);
+  const off_t offset = pfn / 64 * sizeof(word);
+  int ret = pwrite(bitmap.get(), &word, sizeof(word), offset);
+  if (ret < 0) {
+    return PosixError(errno, "pwrite");
+  }
+  if (ret != sizeof(word)) {
+    return PosixError(EIO, "short write");
+  }
+  return NoError();
+}
+
+TEST(ProcPidPagemapTest, Present) {
+  Mapping m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPages * kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  auto entries = ASSERT_NO_ERRNO_AND_VALUE(ReadPagemap(m));
+  for (int i = 0; i < kPages; i++) {
+    EXPECT_FALSE(entries[i] & kPagemapPresent) << "page " << i;
+  }
+
+  // Untouched neighbors may be populated along with touched pages, so only
+  // check the latter.
+  char* p = reinterpret_cast<char*>(m.ptr());
+  p[0] = 1;
+  p[2 * kPageSize] = 1;
+  entries = ASSERT_NO_ERRNO_AND_VALUE(ReadPagemap(m));
+  EXPECT_TRUE(entries[0] & kPagemapPresent);
+  EXPECT_TRUE(entries[2] & kPagemapPresent);
+}
+
+TEST(ProcPidPagemapTest, SoftDirty) {
+  Mapping m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPages * kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  char* p = reinterpret_cast<char*>(m.ptr());
+  for (int i = 0; i < kPages; i++) {
+    p[i * kPageSize] = 1;
+  }
+
+  auto entries = ASSERT_NO_ERRNO_AND_VALUE(ReadPagemap(m));
+  for (int i = 0; i < kPages; i++) {
+    EXPECT_TRUE(entries[i] & kPagemapSoftDirty) << "page " << i;
+  }
+
+  ASSERT_NO_ERRNO(ClearRefs("4"));
+  entries = ASSERT_NO_ERRNO_AND_VALUE(ReadPagemap(m));
+  for (int i = 0; i < kPages; i++) {
+    EXPECT_TRUE(entries[i] & kPagemapPresent) << "page " << i;
+    EXPECT_FALSE(entries[i] & kPagemapSoftDirty) << "page " << i;
+  }
+
+  // Reads don't make pages soft-dirty; writes do.
+  EXPECT_EQ(p[0], 1);
+  p[kPageSize] = 2;
+  entries = ASSERT_NO_ERRNO_AND_VALUE(ReadPagemap(m));
+  EXPECT_FALSE(entries[0] & kPagemapSoftDirty);
+  EXPECT_TRUE(entries[1] & kPagemapSoftDirty);
+  EXPECT_FALSE(entries[2] & kPagemapSoftDirty);
+  EXPECT_FALSE(entries[3] & kPagemapSoftDirty);
+  EXPECT_EQ(p[kPageSize], 2);
+}
+
+TEST(ProcPidPagemapTest, SoftDirtySyscallWrite) {
+  Mapping m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPages * kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  char* p = reinterpret_cast<char*>(m.ptr());
+  for (int i = 0; i < kPages; i++) {
+    p[i * kPageSize] = 1;
+  }
+  ASSERT_NO_ERRNO(ClearRefs("4"));
+
+  // Writes by the kernel on the application's behalf also count.
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(Open("/dev/zero", O_RDONLY));
+  ASSERT_THAT(read(fd.get(), p + 3 * kPageSize, 1),
+              SyscallSucceedsWithValue(1));
+
+  auto entries = ASSERT_NO_ERRNO_AND_VALUE(ReadPagemap(m));
+  EXPECT_FALSE(entries[0] & kPagemapSoftDirty);
+  EXPECT_TRUE(entries[3] & kPagemapSoftDirty);
+  EXPECT_EQ(p[3 * kPageSize], 0);
+}
+
+TEST(ProcPidPagemapTest, UnalignedRead) {
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/proc/self/pagemap", O_RDONLY));
+  uint64_t entry;
+  EXPECT_THAT(pread(fd.get(), &entry, sizeof(entry), 1),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(pread(fd.get(), &entry, sizeof(entry) - 1, 0),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(ProcPidPagemapTest, PageIdleBitmap) {
+  // Page frame numbers are only reported to CAP_SYS_ADMIN.
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto bitmap_or = Open(kPageIdleBitmap, O_RDWR);
+  SKIP_IF(!IsRunningOnGvisor() && !bitmap_or.ok() &&
+          bitmap_or.error().errno_value() == ENOENT);
+  FileDescriptor bitmap = ASSERT_NO_ERRNO_AND_VALUE(std::move(bitmap_or));
+
+  Mapping m = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(kPages * kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  volatile char* p = reinterpret_cast<char*>(m.ptr());
+  p[0] = 1;
+  auto entries = ASSERT_NO_ERRNO_AND_VALUE(ReadPagemap(m));
+  ASSERT_TRUE(entries[0] & kPagemapPresent);
+  const uint64_t pfn = entries[0] & kPagemapPFNMask;
+  ASSERT_NE(pfn, 0);
+
+  ASSERT_NO_ERRNO(SetPageIdle(bitmap, pfn));
+  EXPECT_TRUE(ASSERT_NO_ERRNO_AND_VALUE(PageIdle(bitmap, pfn)));
+
+  // Any access, including a read, makes the page non-idle.
+  EXPECT_EQ(p[0], 1);
+  EXPECT_FALSE(ASSERT_NO_ERRNO_AND_VALUE(PageIdle(bitmap, pfn)));
+}
+
+TEST(ProcPidPagemapTest, PageIdleBitmapUnaligned) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_SYS_ADMIN)));
+  auto bitmap_or = Open(kPageIdleBitmap, O_RDWR);
+  SKIP_IF(!IsRunningOnGvisor() && !bitmap_or.ok() &&
+          bitmap_or.error().errno_value() == ENOENT);
+  FileDescriptor bitmap = ASSERT_NO_ERRNO_AND_VALUE(std::move(bitmap_or));
+
+  uint64_t word = 0;
+  EXPECT_THAT(pread(bitmap.get(), &word, sizeof(word), 1),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(pread(bitmap.get(), &word, sizeof(word) - 1, 0),
+              SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(pwrite(bitmap.get(), &word, sizeof(word) - 1, 0),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+// ClearRefsReferencedTest tests the effect of clear_refs on the Referenced
+// field of smaps for an anonymous mapping.
+struct ClearRefsReferencedParam {
+  // value is written to clear_refs.
+  const char* value;
+
+  // resets_anon is true if value clears references to anonymous pages.
+  bool resets_anon;
+};
+
+class ClearRefsReferencedTest
+    : public ::testing::TestWithParam<ClearRefsReferencedParam> {};
+
+TEST_P(ClearRefsReferencedTest, AnonMapping) {
+  Mapping m = ASSERT_NO_ERRNO_AND_VALUE(MmapIsolated());
+  const uintptr_t addr = m.addr() + kPageSize;
+  volatile char* p = reinterpret_cast<char*>(addr);
+  for (int i = 0; i < kPages; i++) {
+    p[i * kPageSize] = 1;
+  }
+  constexpr uint64_t kPageKB = kPageSize / 1024;
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(ReadReferencedKB(addr)),
+            kPages * kPageKB);
+
+  ASSERT_NO_ERRNO(ClearRefs(GetParam().value));
+  if (!GetParam().resets_anon) {
+    EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(ReadReferencedKB(addr)),
+              kPages * kPageKB);
+    return;
+  }
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(ReadReferencedKB(addr)), 0);
+
+  // Only the accessed page is referenced again, and its contents are intact.
+  EXPECT_EQ(p[kPageSize], 1);
+  EXPECT_EQ(ASSERT_NO_ERRNO_AND_VALUE(ReadReferencedKB(addr)), kPageKB);
+}
+
+INSTANTIATE_TEST_SUITE_P(
+    All, ClearRefsReferencedTest,
+    ::testing::Values(ClearRefsReferencedParam{"1", true},
+                      ClearRefsReferencedParam{"2", true},
+                      ClearRefsReferencedParam{"3", false}));
+
+TEST(ProcPidClearRefsTest, InvalidValue) {
+  EXPECT_THAT(ClearRefs("0"), PosixErrorIs(EINVAL, _));
+  EXPECT_THAT(ClearRefs("42"), PosixErrorIs(EINVAL, _));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
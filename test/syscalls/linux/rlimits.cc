@@ -13,6 +13,7 @@
 // limitations under the License.
 
 #include <errno.h>
+#include <signal.h>
 #include <stdlib.h>
 #include <sys/resource.h>
 #include <sys/time.h>
@@ -29,6 +30,7 @@
 #include "absl/strings/numbers.h"
 #include "absl/strings/str_split.h"
 #include "test/util/capability_util.h"
+#include "test/util/cleanup.h"
 #include "test/util/proc_util.h"
 #include "test/util/test_util.h"
 #include "test/util/thread_util.h"
@@ -90,6 +92,11 @@ TEST(RlimitTest, UnprivilegedSetRlimit) {
 
   rl.rlim_max = 100000;
   EXPECT_THAT(setrlimit(RLIMIT_NOFILE, &rl), SyscallFailsWithErrno(EPERM));
+
+  // A soft limit above the hard limit is invalid even if the hard limit
+  // can't be raised either.
+  rl.rlim_cur = rl.rlim_max + 1;
+  EXPECT_THAT(setrlimit(RLIMIT_NOFILE, &rl), SyscallFailsWithErrno(EINVAL));
 }
 
 TEST(RlimitTest, SetSoftRlimitAboveHard) {
@@ -155,6 +162,57 @@ TEST(RlimitTest, RlimitNProc) {
   }).Join();
 }
 
+TEST(RlimitTest, PrlimitOtherProcess) {
+  pid_t child = fork();
+  if (child == 0) {
+    while (1) {
+      pause();
+    }
+    _exit(1);
+  }
+  ASSERT_THAT(child, SyscallSucceeds());
+  auto cleanup = Cleanup([child] {
+    EXPECT_THAT(kill(child, SIGKILL), SyscallSucceeds());
+    EXPECT_THAT(waitpid(child, nullptr, 0), SyscallSucceeds());
+  });
+
+  struct rlimit self = {};
+  ASSERT_THAT(getrlimit(RLIMIT_NOFILE, &self), SyscallSucceeds());
+  struct rlimit orig = {};
+  ASSERT_THAT(prlimit(child, RLIMIT_NOFILE, nullptr, &orig),
+              SyscallSucceeds());
+
+  // Lower the child's hard limit.
+  struct rlimit rl = {};
+  rl.rlim_max = orig.rlim_max - 1;
+  rl.rlim_cur = std::min(orig.rlim_cur, rl.rlim_max);
+  struct rlimit old = {};
+  ASSERT_THAT(prlimit(child, RLIMIT_NOFILE, &rl, &old), SyscallSucceeds());
+  EXPECT_EQ(old.rlim_cur, orig.rlim_cur);
+  EXPECT_EQ(old.rlim_max, orig.rlim_max);
+
+  // The change must be visible in the child, but not in the caller.
+  struct rlimit got = {};
+  ASSERT_THAT(prlimit(child, RLIMIT_NOFILE, nullptr, &got), SyscallSucceeds());
+  EXPECT_EQ(got.rlim_cur, rl.rlim_cur);
+  EXPECT_EQ(got.rlim_max, rl.rlim_max);
+  ASSERT_THAT(getrlimit(RLIMIT_NOFILE, &got), SyscallSucceeds());
+  EXPECT_EQ(got.rlim_cur, self.rlim_cur);
+  EXPECT_EQ(got.rlim_max, self.rlim_max);
+
+  struct rlimit invalid = rl;
+  invalid.rlim_cur = invalid.rlim_max + 1;
+  EXPECT_THAT(prlimit(child, RLIMIT_NOFILE, &invalid, nullptr),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Raising the hard limit depends on the capabilities of the caller, not
+  // those of the target.
+  AutoCapability cap(CAP_SYS_RESOURCE, false);
+  rl.rlim_max = orig.rlim_max;
+  EXPECT_THAT(prlimit(child, RLIMIT_NOFILE, &rl, nullptr),
+              SyscallFailsWithErrno(EPERM));
+}
+
 TEST(RlimitTest, ParseProcPidLimits) {
   auto proc_self_limits =
       ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/self/limits"));
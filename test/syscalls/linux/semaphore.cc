@@ -12,14 +12,19 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+#include <sched.h>
 #include <signal.h>
 #include <sys/ipc.h>
 #include <sys/sem.h>
+#include <sys/syscall.h>
 #include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
 
 #include <atomic>
 #include <cerrno>
 #include <ctime>
+#include <functional>
 #include <memory>
 #include <set>
 
@@ -1020,6 +1025,85 @@ TEST(SemaphoreTest, SemInfo) {
   EXPECT_EQ(info.semvmx, kSemVmx);
 }
 
+// Runs fn in a child created by clone(2) with flags, and waits for it to exit
+// successfully.
+void RunInChild(int flags, const std::function<void()>& fn) {
+  const pid_t child_pid = syscall(SYS_clone, flags | SIGCHLD, 0, 0, 0, 0);
+  if (child_pid == 0) {
+    fn();
+    _exit(0);
+  }
+  ASSERT_THAT(child_pid, SyscallSucceeds());
+
+  int status;
+  ASSERT_THAT(RetryEINTR(waitpid)(child_pid, &status, 0),
+              SyscallSucceedsWithValue(child_pid));
+  EXPECT_TRUE(WIFEXITED(status) && WEXITSTATUS(status) == 0)
+      << " status " << status;
+}
+
+TEST(SemaphoreTest, SemUndoAppliedOnExit) {
+  AutoSem sem(semget(IPC_PRIVATE, 2, 0600 | IPC_CREAT));
+  ASSERT_THAT(sem.get(), SyscallSucceeds());
+  ASSERT_THAT(semctl(sem.get(), 1, SETVAL, 3), SyscallSucceeds());
+
+  RunInChild(0, [&] {
+    struct sembuf bufs[] = {{0, 2, SEM_UNDO}, {1, -1, SEM_UNDO}};
+    TEST_PCHECK(semop(sem.get(), bufs, ABSL_ARRAYSIZE(bufs)) == 0);
+    TEST_PCHECK(semctl(sem.get(), 0, GETVAL) == 2);
+    TEST_PCHECK(semctl(sem.get(), 1, GETVAL) == 2);
+  });
+  EXPECT_THAT(semctl(sem.get(), 0, GETVAL), SyscallSucceedsWithValue(0));
+  EXPECT_THAT(semctl(sem.get(), 1, GETVAL), SyscallSucceedsWithValue(3));
+
+  // Operations without SEM_UNDO are not reverted.
+  RunInChild(0, [&] {
+    struct sembuf buf = {0, 1, 0};
+    TEST_PCHECK(semop(sem.get(), &buf, 1) == 0);
+  });
+  EXPECT_THAT(semctl(sem.get(), 0, GETVAL), SyscallSucceedsWithValue(1));
+}
+
+TEST(SemaphoreTest, SemUndoClampedOnExit) {
+  AutoSem sem(semget(IPC_PRIVATE, 1, 0600 | IPC_CREAT));
+  ASSERT_THAT(sem.get(), SyscallSucceeds());
+
+  RunInChild(0, [&] {
+    struct sembuf buf = {0, 2, SEM_UNDO};
+    TEST_PCHECK(semop(sem.get(), &buf, 1) == 0);
+    // Consume the value without SEM_UNDO, so that reverting the first
+    // operation would make it negative.
+    buf = {0, -2, 0};
+    TEST_PCHECK(semop(sem.get(), &buf, 1) == 0);
+  });
+  EXPECT_THAT(semctl(sem.get(), 0, GETVAL), SyscallSucceedsWithValue(0));
+}
+
+TEST(SemaphoreTest, SemUndoSharedWithCloneSysvsem) {
+  AutoSem sem(semget(IPC_PRIVATE, 1, 0600 | IPC_CREAT));
+  ASSERT_THAT(sem.get(), SyscallSucceeds());
+
+  // The child shares our adjustments, so they are not applied when it exits.
+  RunInChild(CLONE_SYSVSEM, [&] {
+    struct sembuf buf = {0, 1, SEM_UNDO};
+    TEST_PCHECK(semop(sem.get(), &buf, 1) == 0);
+  });
+  EXPECT_THAT(semctl(sem.get(), 0, GETVAL), SyscallSucceedsWithValue(1));
+
+  // Cancel the shared adjustment, which would otherwise be applied when the
+  // test process exits.
+  struct sembuf buf = {0, -1, SEM_UNDO};
+  ASSERT_THAT(semop(sem.get(), &buf, 1), SyscallSucceeds());
+  EXPECT_THAT(semctl(sem.get(), 0, GETVAL), SyscallSucceedsWithValue(0));
+
+  // Without CLONE_SYSVSEM, the child gets its own adjustments.
+  RunInChild(0, [&] {
+    struct sembuf buf = {0, 1, SEM_UNDO};
+    TEST_PCHECK(semop(sem.get(), &buf, 1) == 0);
+  });
+  EXPECT_THAT(semctl(sem.get(), 0, GETVAL), SyscallSucceedsWithValue(0));
+}
+
 TEST(SempahoreTest, RemoveNonExistentSemaphore) {
   EXPECT_THAT(semctl(-1, 0, IPC_RMID), SyscallFailsWithErrno(EINVAL));
 }
@@ -16,6 +16,7 @@
 
 #ifdef __linux__
 #include <linux/capability.h>
+#include <linux/sock_diag.h>
 #endif  // __linux__
 #include <stdio.h>
 #include <sys/ioctl.h>
@@ -896,6 +897,62 @@ TEST_P(AllSocketPairTest, GetSockoptProtocol) {
   }
 }
 
+TEST_P(AllSocketPairTest, GetSockoptCookie) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+  uint64_t cookies[2];
+  for (int i = 0; i < 2; i++) {
+    const int fd = i == 0 ? sockets->first_fd() : sockets->second_fd();
+    socklen_t optlen = sizeof(cookies[i]);
+    ASSERT_THAT(getsockopt(fd, SOL_SOCKET, SO_COOKIE, &cookies[i], &optlen),
+                SyscallSucceeds());
+    EXPECT_EQ(optlen, sizeof(cookies[i]));
+    EXPECT_NE(cookies[i], 0);
+
+    // The cookie is stable.
+    uint64_t cookie;
+    ASSERT_THAT(getsockopt(fd, SOL_SOCKET, SO_COOKIE, &cookie, &optlen),
+                SyscallSucceeds());
+    EXPECT_EQ(cookie, cookies[i]);
+  }
+  EXPECT_NE(cookies[0], cookies[1]);
+}
+
+TEST_P(AllSocketPairTest, GetSockoptCookieShortOptlen) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+  uint32_t cookie;
+  socklen_t optlen = sizeof(cookie);
+  EXPECT_THAT(getsockopt(sockets->first_fd(), SOL_SOCKET, SO_COOKIE, &cookie,
+                         &optlen),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_P(AllSocketPairTest, GetSockoptMeminfo) {
+  auto sockets = ASSERT_NO_ERRNO_AND_VALUE(NewSocketPair());
+  int rcvbuf;
+  socklen_t optlen = sizeof(rcvbuf);
+  ASSERT_THAT(getsockopt(sockets->first_fd(), SOL_SOCKET, SO_RCVBUF, &rcvbuf,
+                         &optlen),
+              SyscallSucceeds());
+
+  uint32_t meminfo[SK_MEMINFO_VARS] = {};
+  optlen = sizeof(meminfo);
+  ASSERT_THAT(getsockopt(sockets->first_fd(), SOL_SOCKET, SO_MEMINFO, meminfo,
+                         &optlen),
+              SyscallSucceeds());
+  EXPECT_EQ(optlen, sizeof(meminfo));
+  EXPECT_EQ(meminfo[SK_MEMINFO_RCVBUF], rcvbuf);
+  EXPECT_EQ(meminfo[SK_MEMINFO_DROPS], 0);
+
+  // The output is truncated to optlen.
+  uint32_t short_meminfo[2] = {};
+  optlen = sizeof(short_meminfo);
+  ASSERT_THAT(getsockopt(sockets->first_fd(), SOL_SOCKET, SO_MEMINFO,
+                         short_meminfo, &optlen),
+              SyscallSucceeds());
+  EXPECT_EQ(optlen, sizeof(short_meminfo));
+  EXPECT_EQ(short_meminfo[SK_MEMINFO_RCVBUF], rcvbuf);
+}
+
 TEST_P(AllSocketPairTest, SetAndGetBooleanSocketOptions) {
   int sock_opts[] = {SO_BROADCAST, SO_PASSCRED,  SO_NO_CHECK,
                      SO_REUSEADDR, SO_REUSEPORT, SO_KEEPALIVE};
@@ -0,0 +1,186 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <arpa/inet.h>
+#include <netinet/in.h>
+#include <sys/socket.h>
+#include <sys/types.h>
+
+#include <cstring>
+
+#include "gtest/gtest.h"
+#include "test/syscalls/linux/ip_socket_test_util.h"
+#include "test/util/capability_util.h"
+#include "test/util/socket_util.h"
+#include "test/util/test_util.h"
+
+#ifndef IPV6_TRANSPARENT
+#define IPV6_TRANSPARENT 75
+#endif
+
+#ifndef IPV6_FREEBIND
+#define IPV6_FREEBIND 78
+#endif
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+int Level(int domain) {
+  return domain == AF_INET6 ? IPPROTO_IPV6 : IPPROTO_IP;
+}
+
+int FreeBindOpt(int domain) {
+  return domain == AF_INET6 ? IPV6_FREEBIND : IP_FREEBIND;
+}
+
+int TransparentOpt(int domain) {
+  return domain == AF_INET6 ? IPV6_TRANSPARENT : IP_TRANSPARENT;
+}
+
+// NonLocalAddress returns an address from a documentation range, which is
+// never assigned to an interface in the sandbox.
+TestAddress NonLocalAddress(int domain) {
+  if (domain == AF_INET6) {
+    TestAddress t("V6NonLocal");
+    t.addr.ss_family = AF_INET6;
+    t.addr_len = sizeof(sockaddr_in6);
+    auto* in6 = reinterpret_cast<sockaddr_in6*>(&t.addr);
+    inet_pton(AF_INET6, "2001:db8::1", &in6->sin6_addr);
+    return t;
+  }
+  TestAddress t("V4NonLocal");
+  t.addr.ss_family = AF_INET;
+  t.addr_len = sizeof(sockaddr_in);
+  auto* in = reinterpret_cast<sockaddr_in*>(&t.addr);
+  inet_pton(AF_INET, "192.0.2.1", &in->sin_addr);
+  return t;
+}
+
+bool CanSetTransparent() {
+  return ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)) ||
+         ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_RAW));
+}
+
+}  // namespace
+
+using IPTransparentSocketTest = SimpleSocketTest;
+
+TEST_P(IPTransparentSocketTest, FreeBindDefault) {
+  auto sock = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+  const int domain = GetParam().domain;
+
+  int get = -1;
+  socklen_t get_len = sizeof(get);
+  ASSERT_THAT(getsockopt(sock->get(), Level(domain), FreeBindOpt(domain),
+                         &get, &get_len),
+              SyscallSucceeds());
+  EXPECT_EQ(get_len, sizeof(get));
+  EXPECT_EQ(get, 0);
+}
+
+TEST_P(IPTransparentSocketTest, FreeBindRoundTrip) {
+  auto sock = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+  const int domain = GetParam().domain;
+
+  ASSERT_THAT(setsockopt(sock->get(), Level(domain), FreeBindOpt(domain),
+                         &kSockOptOn, sizeof(kSockOptOn)),
+              SyscallSucceeds());
+
+  int get = -1;
+  socklen_t get_len = sizeof(get);
+  ASSERT_THAT(getsockopt(sock->get(), Level(domain), FreeBindOpt(domain),
+                         &get, &get_len),
+              SyscallSucceeds());
+  EXPECT_EQ(get_len, sizeof(get));
+  EXPECT_EQ(get, kSockOptOn);
+}
+
+TEST_P(IPTransparentSocketTest, BindNonLocalAddress) {
+  auto sock = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+  TestAddress addr = NonLocalAddress(GetParam().domain);
+
+  EXPECT_THAT(bind(sock->get(), AsSockAddr(&addr.addr), addr.addr_len),
+              SyscallFailsWithErrno(EADDRNOTAVAIL));
+}
+
+TEST_P(IPTransparentSocketTest, FreeBindAllowsNonLocalAddress) {
+  auto sock = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+  const int domain = GetParam().domain;
+  TestAddress addr = NonLocalAddress(domain);
+
+  ASSERT_THAT(setsockopt(sock->get(), Level(domain), FreeBindOpt(domain),
+                         &kSockOptOn, sizeof(kSockOptOn)),
+              SyscallSucceeds());
+  ASSERT_THAT(bind(sock->get(), AsSockAddr(&addr.addr), addr.addr_len),
+              SyscallSucceeds());
+
+  sockaddr_storage got = {};
+  socklen_t got_len = sizeof(got);
+  ASSERT_THAT(getsockname(sock->get(), AsSockAddr(&got), &got_len),
+              SyscallSucceeds());
+  ASSERT_EQ(got_len, addr.addr_len);
+  if (domain == AF_INET6) {
+    EXPECT_EQ(memcmp(&reinterpret_cast<sockaddr_in6*>(&got)->sin6_addr,
+                     &reinterpret_cast<sockaddr_in6*>(&addr.addr)->sin6_addr,
+                     sizeof(in6_addr)),
+              0);
+  } else {
+    EXPECT_EQ(reinterpret_cast<sockaddr_in*>(&got)->sin_addr.s_addr,
+              reinterpret_cast<sockaddr_in*>(&addr.addr)->sin_addr.s_addr);
+  }
+}
+
+TEST_P(IPTransparentSocketTest, TransparentRequiresCapability) {
+  SKIP_IF(CanSetTransparent());
+
+  auto sock = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+  const int domain = GetParam().domain;
+
+  EXPECT_THAT(setsockopt(sock->get(), Level(domain), TransparentOpt(domain),
+                         &kSockOptOn, sizeof(kSockOptOn)),
+              SyscallFailsWithErrno(EPERM));
+}
+
+TEST_P(IPTransparentSocketTest, TransparentAllowsNonLocalAddress) {
+  SKIP_IF(!CanSetTransparent());
+
+  auto sock = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+  const int domain = GetParam().domain;
+  TestAddress addr = NonLocalAddress(domain);
+
+  ASSERT_THAT(setsockopt(sock->get(), Level(domain), TransparentOpt(domain),
+                         &kSockOptOn, sizeof(kSockOptOn)),
+              SyscallSucceeds());
+
+  int get = -1;
+  socklen_t get_len = sizeof(get);
+  ASSERT_THAT(getsockopt(sock->get(), Level(domain), TransparentOpt(domain),
+                         &get, &get_len),
+              SyscallSucceeds());
+  EXPECT_EQ(get, kSockOptOn);
+
+  EXPECT_THAT(bind(sock->get(), AsSockAddr(&addr.addr), addr.addr_len),
+              SyscallSucceeds());
+}
+
+INSTANTIATE_TEST_SUITE_P(
+    IPTransparentSockets, IPTransparentSocketTest,
+    ::testing::ValuesIn(std::vector<SocketKind>{
+        IPv4UDPUnboundSocket(0), IPv4TCPUnboundSocket(0),
+        IPv6UDPUnboundSocket(0), IPv6TCPUnboundSocket(0)}));
+
+}  // namespace testing
+}  // namespace gvisor
@@ -0,0 +1,193 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <linux/cn_proc.h>
+#include <linux/connector.h>
+#include <linux/netlink.h>
+#include <sys/socket.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include <cstring>
+
+#include "gtest/gtest.h"
+#include "absl/time/clock.h"
+#include "absl/time/time.h"
+#include "test/util/capability_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/socket_util.h"
+#include "test/util/test_util.h"
+
+// Tests for the NETLINK_CONNECTOR process events connector.
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+// ProcConnectorMessage is a netlink message carrying a connector message with
+// a proc_cn_mcast_op payload.
+struct ProcConnectorMessage {
+  struct nlmsghdr hdr;
+  struct cn_msg msg;
+  enum proc_cn_mcast_op op;
+} __attribute__((packed));
+
+// Returns a NETLINK_CONNECTOR socket bound to the CN_IDX_PROC group.
+PosixErrorOr<FileDescriptor> ProcConnectorSocket() {
+  ASSIGN_OR_RETURN_ERRNO(
+      FileDescriptor fd,
+      Socket(AF_NETLINK, SOCK_DGRAM | SOCK_CLOEXEC, NETLINK_CONNECTOR));
+
+  struct sockaddr_nl addr = {};
+  addr.nl_family = AF_NETLINK;
+  addr.nl_groups = CN_IDX_PROC;
+  RETURN_ERROR_IF_SYSCALL_FAIL(
+      bind(fd.get(), reinterpret_cast<struct sockaddr*>(&addr), sizeof(addr)));
+
+  struct timeval tv = absl::ToTimeval(absl::Seconds(5));
+  RETURN_ERROR_IF_SYSCALL_FAIL(
+      setsockopt(fd.get(), SOL_SOCKET, SO_RCVTIMEO, &tv, sizeof(tv)));
+  return fd;
+}
+
+// Sends op to the process events connector.
+PosixError SendProcConnectorOp(const FileDescriptor& fd,
+                               enum proc_cn_mcast_op op) {
+  ProcConnectorMessage req = {};
+  req.hdr.nlmsg_len = sizeof(req);
+  req.hdr.nlmsg_type = NLMSG_DONE;
+  req.hdr.nlmsg_pid = getpid();
+  req.msg.id.idx = CN_IDX_PROC;
+  req.msg.id.val = CN_VAL_PROC;
+  req.msg.len = sizeof(req.op);
+  req.op = op;
+  RETURN_ERROR_IF_SYSCALL_FAIL(send(fd.get(), &req, sizeof(req), 0));
+  return NoError();
+}
+
+// Receives process events from fd until fn returns true.
+PosixError RecvProcEventsUntil(
+    const FileDescriptor& fd,
+    const std::function<bool(const struct proc_event* ev)>& fn) {
+  char buf[4096];
+  while (true) {
+    int len;
+    RETURN_ERROR_IF_SYSCALL_FAIL(len = recv(fd.get(), buf, sizeof(buf), 0));
+    for (struct nlmsghdr* hdr = reinterpret_cast<struct nlmsghdr*>(buf);
+         NLMSG_OK(hdr, len); hdr = NLMSG_NEXT(hdr, len)) {
+      if (hdr->nlmsg_len <
+          NLMSG_LENGTH(sizeof(struct cn_msg) + sizeof(struct proc_event))) {
+        continue;
+      }
+      const struct cn_msg* msg =
+          reinterpret_cast<const struct cn_msg*>(NLMSG_DATA(hdr));
+      if (msg->id.idx != CN_IDX_PROC || msg->id.val != CN_VAL_PROC) {
+        continue;
+      }
+      if (fn(reinterpret_cast<const struct proc_event*>(msg->data))) {
+        return NoError();
+      }
+    }
+  }
+}
+
+TEST(NetlinkConnectorTest, RequiresCapability) {
+  SKIP_IF(ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(
+      Socket(AF_NETLINK, SOCK_DGRAM, NETLINK_CONNECTOR));
+  struct sockaddr_nl addr = {};
+  addr.nl_family = AF_NETLINK;
+  addr.nl_groups = CN_IDX_PROC;
+  EXPECT_THAT(
+      bind(fd.get(), reinterpret_cast<struct sockaddr*>(&addr), sizeof(addr)),
+      SyscallFailsWithErrno(EPERM));
+}
+
+TEST(NetlinkConnectorTest, ListMemberships) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(ProcConnectorSocket());
+
+  uint32_t groups = 0;
+  socklen_t len = sizeof(groups);
+  ASSERT_THAT(getsockopt(fd.get(), SOL_NETLINK, NETLINK_LIST_MEMBERSHIPS,
+                         &groups, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(groups, 1 << (CN_IDX_PROC - 1));
+
+  int group = CN_IDX_PROC;
+  ASSERT_THAT(setsockopt(fd.get(), SOL_NETLINK, NETLINK_DROP_MEMBERSHIP,
+                         &group, sizeof(group)),
+              SyscallSucceeds());
+  len = sizeof(groups);
+  ASSERT_THAT(getsockopt(fd.get(), SOL_NETLINK, NETLINK_LIST_MEMBERSHIPS,
+                         &groups, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(groups, 0);
+}
+
+TEST(NetlinkConnectorTest, ForkExitEvents) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(ProcConnectorSocket());
+
+  ASSERT_NO_ERRNO(SendProcConnectorOp(fd, PROC_CN_MCAST_LISTEN));
+  ASSERT_NO_ERRNO(RecvProcEventsUntil(fd, [](const struct proc_event* ev) {
+    if (ev->what != PROC_EVENT_NONE) {
+      return false;
+    }
+    EXPECT_EQ(ev->event_data.ack.err, 0);
+    return true;
+  }));
+
+  pid_t child = fork();
+  if (child == 0) {
+    _exit(42);
+  }
+  ASSERT_THAT(child, SyscallSucceeds());
+  int status;
+  ASSERT_THAT(RetryEINTR(waitpid)(child, &status, 0),
+              SyscallSucceedsWithValue(child));
+
+  bool forked = false;
+  ASSERT_NO_ERRNO(RecvProcEventsUntil(fd, [&](const struct proc_event* ev) {
+    switch (ev->what) {
+      case PROC_EVENT_FORK:
+        if (ev->event_data.fork.child_pid == child) {
+          EXPECT_EQ(ev->event_data.fork.child_tgid, child);
+          EXPECT_EQ(ev->event_data.fork.parent_tgid, getpid());
+          forked = true;
+        }
+        return false;
+      case PROC_EVENT_EXIT:
+        if (ev->event_data.exit.process_pid != child) {
+          return false;
+        }
+        EXPECT_TRUE(forked);
+        EXPECT_EQ(ev->event_data.exit.exit_code, 42 << 8);
+        EXPECT_EQ(ev->event_data.exit.exit_signal, SIGCHLD);
+        return true;
+      default:
+        return false;
+    }
+  }));
+
+  ASSERT_NO_ERRNO(SendProcConnectorOp(fd, PROC_CN_MCAST_IGNORE));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -36,6 +36,9 @@ PosixError DumpLinks(const FileDescriptor& fd, uint32_t seq,
 
 PosixErrorOr<std::vector<Link>> DumpLinks();
 
+// Returns the links reported by the NETLINK_ROUTE socket fd.
+PosixErrorOr<std::vector<Link>> DumpLinks(const FileDescriptor& fd);
+
 // Returns the loopback link on the system. ENOENT if not found.
 PosixErrorOr<Link> LoopbackLink();
 
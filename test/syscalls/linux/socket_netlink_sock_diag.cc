@@ -0,0 +1,236 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <arpa/inet.h>
+#include <linux/inet_diag.h>
+#include <linux/netlink.h>
+#include <linux/sock_diag.h>
+#include <netinet/in.h>
+#include <netinet/tcp.h>
+#include <sys/socket.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <unistd.h>
+
+#include <cstring>
+#include <string>
+
+#include "gtest/gtest.h"
+#include "absl/strings/match.h"
+#include "absl/strings/str_cat.h"
+#include "test/syscalls/linux/socket_netlink_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/fs_util.h"
+#include "test/util/socket_util.h"
+#include "test/util/test_util.h"
+
+// Tests for NETLINK_SOCK_DIAG sockets, as used by ss(8).
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+struct InetDiagRequest {
+  struct nlmsghdr hdr;
+  struct inet_diag_req_v2 req;
+};
+
+InetDiagRequest NewRequest(uint8_t family, uint8_t protocol, uint16_t flags) {
+  InetDiagRequest r = {};
+  r.hdr.nlmsg_len = sizeof(r);
+  r.hdr.nlmsg_type = SOCK_DIAG_BY_FAMILY;
+  r.hdr.nlmsg_flags = NLM_F_REQUEST | flags;
+  r.hdr.nlmsg_seq = 1;
+  r.req.sdiag_family = family;
+  r.req.sdiag_protocol = protocol;
+  r.req.idiag_states = ~0U;
+  return r;
+}
+
+// TCPConnection is a connected pair of loopback TCP sockets.
+struct TCPConnection {
+  FileDescriptor listener;
+  FileDescriptor client;
+  FileDescriptor server;
+  struct sockaddr_in client_addr;
+  struct sockaddr_in server_addr;
+};
+
+PosixErrorOr<TCPConnection> NewTCPConnection() {
+  TCPConnection c;
+  ASSIGN_OR_RETURN_ERRNO(c.listener, Socket(AF_INET, SOCK_STREAM, 0));
+  struct sockaddr_in addr = {};
+  addr.sin_family = AF_INET;
+  addr.sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+  RETURN_ERROR_IF_SYSCALL_FAIL(bind(
+      c.listener.get(), reinterpret_cast<struct sockaddr*>(&addr), sizeof(addr)));
+  RETURN_ERROR_IF_SYSCALL_FAIL(listen(c.listener.get(), 1));
+  socklen_t addrlen = sizeof(c.server_addr);
+  RETURN_ERROR_IF_SYSCALL_FAIL(
+      getsockname(c.listener.get(),
+                  reinterpret_cast<struct sockaddr*>(&c.server_addr), &addrlen));
+
+  ASSIGN_OR_RETURN_ERRNO(c.client, Socket(AF_INET, SOCK_STREAM, 0));
+  RETURN_ERROR_IF_SYSCALL_FAIL(
+      connect(c.client.get(), reinterpret_cast<struct sockaddr*>(&c.server_addr),
+              sizeof(c.server_addr)));
+  addrlen = sizeof(c.client_addr);
+  RETURN_ERROR_IF_SYSCALL_FAIL(
+      getsockname(c.client.get(),
+                  reinterpret_cast<struct sockaddr*>(&c.client_addr), &addrlen));
+  ASSIGN_OR_RETURN_ERRNO(c.server, Accept(c.listener.get(), nullptr, nullptr));
+  return std::move(c);
+}
+
+TEST(NetlinkSockDiagTest, DumpTCP) {
+  TCPConnection c = ASSERT_NO_ERRNO_AND_VALUE(NewTCPConnection());
+  struct stat st = ASSERT_NO_ERRNO_AND_VALUE(Fstat(c.client.get()));
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+  InetDiagRequest req = NewRequest(AF_INET, IPPROTO_TCP, NLM_F_DUMP);
+
+  bool found = false;
+  ASSERT_NO_ERRNO(NetlinkRequestResponse(
+      fd, &req, sizeof(req),
+      [&](const struct nlmsghdr* hdr) {
+        ASSERT_EQ(hdr->nlmsg_type, SOCK_DIAG_BY_FAMILY);
+        ASSERT_GE(hdr->nlmsg_len, NLMSG_LENGTH(sizeof(struct inet_diag_msg)));
+        const struct inet_diag_msg* msg =
+            reinterpret_cast<const struct inet_diag_msg*>(NLMSG_DATA(hdr));
+        EXPECT_EQ(msg->idiag_family, AF_INET);
+        if (msg->idiag_inode != st.st_ino) {
+          return;
+        }
+        found = true;
+        EXPECT_EQ(msg->idiag_state, TCP_ESTABLISHED);
+        EXPECT_EQ(msg->idiag_uid, geteuid());
+        EXPECT_EQ(msg->id.idiag_sport, c.client_addr.sin_port);
+        EXPECT_EQ(msg->id.idiag_dport, c.server_addr.sin_port);
+        EXPECT_EQ(msg->id.idiag_src[0], htonl(INADDR_LOOPBACK));
+        EXPECT_EQ(msg->id.idiag_dst[0], htonl(INADDR_LOOPBACK));
+      },
+      false));
+  EXPECT_TRUE(found);
+}
+
+TEST(NetlinkSockDiagTest, DumpTCPStates) {
+  TCPConnection c = ASSERT_NO_ERRNO_AND_VALUE(NewTCPConnection());
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+  InetDiagRequest req = NewRequest(AF_INET, IPPROTO_TCP, NLM_F_DUMP);
+  req.req.idiag_states = 1 << TCP_LISTEN;
+
+  bool found = false;
+  ASSERT_NO_ERRNO(NetlinkRequestResponse(
+      fd, &req, sizeof(req),
+      [&](const struct nlmsghdr* hdr) {
+        const struct inet_diag_msg* msg =
+            reinterpret_cast<const struct inet_diag_msg*>(NLMSG_DATA(hdr));
+        EXPECT_EQ(msg->idiag_state, TCP_LISTEN);
+        if (msg->id.idiag_sport == c.server_addr.sin_port) {
+          found = true;
+        }
+      },
+      false));
+  EXPECT_TRUE(found);
+}
+
+TEST(NetlinkSockDiagTest, LookupTCP) {
+  TCPConnection c = ASSERT_NO_ERRNO_AND_VALUE(NewTCPConnection());
+  struct stat st = ASSERT_NO_ERRNO_AND_VALUE(Fstat(c.client.get()));
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+  InetDiagRequest req = NewRequest(AF_INET, IPPROTO_TCP, 0);
+  req.req.id.idiag_sport = c.client_addr.sin_port;
+  req.req.id.idiag_dport = c.server_addr.sin_port;
+  req.req.id.idiag_src[0] = c.client_addr.sin_addr.s_addr;
+  req.req.id.idiag_dst[0] = c.server_addr.sin_addr.s_addr;
+  req.req.id.idiag_cookie[0] = INET_DIAG_NOCOOKIE;
+  req.req.id.idiag_cookie[1] = INET_DIAG_NOCOOKIE;
+
+  bool found = false;
+  ASSERT_NO_ERRNO(NetlinkRequestResponseSingle(
+      fd, &req, sizeof(req), [&](const struct nlmsghdr* hdr) {
+        ASSERT_EQ(hdr->nlmsg_type, SOCK_DIAG_BY_FAMILY);
+        const struct inet_diag_msg* msg =
+            reinterpret_cast<const struct inet_diag_msg*>(NLMSG_DATA(hdr));
+        EXPECT_EQ(msg->idiag_inode, st.st_ino);
+        found = true;
+      }));
+  EXPECT_TRUE(found);
+}
+
+// The inode reported by sock_diag matches /proc/net/tcp and the link in
+// /proc/self/fd.
+TEST(NetlinkSockDiagTest, InodeMatchesProc) {
+  TCPConnection c = ASSERT_NO_ERRNO_AND_VALUE(NewTCPConnection());
+  struct stat st = ASSERT_NO_ERRNO_AND_VALUE(Fstat(c.client.get()));
+
+  std::string link = ASSERT_NO_ERRNO_AND_VALUE(
+      ReadLink(absl::StrCat("/proc/self/fd/", c.client.get())));
+  EXPECT_EQ(link, absl::StrCat("socket:[", st.st_ino, "]"));
+
+  std::string tcp = ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/net/tcp"));
+  EXPECT_TRUE(absl::StrContains(tcp, absl::StrCat(" ", st.st_ino, " ")));
+}
+
+TEST(NetlinkSockDiagTest, UDP6InProc) {
+  auto s = Socket(AF_INET6, SOCK_DGRAM, 0);
+  SKIP_IF(!s.ok() && s.error().errno_value() == EAFNOSUPPORT);
+  FileDescriptor sock = std::move(s).ValueOrDie();
+  struct sockaddr_in6 addr = {};
+  addr.sin6_family = AF_INET6;
+  addr.sin6_addr = in6addr_loopback;
+  ASSERT_THAT(
+      bind(sock.get(), reinterpret_cast<struct sockaddr*>(&addr), sizeof(addr)),
+      SyscallSucceeds());
+  struct stat st = ASSERT_NO_ERRNO_AND_VALUE(Fstat(sock.get()));
+
+  std::string udp6 = ASSERT_NO_ERRNO_AND_VALUE(GetContents("/proc/net/udp6"));
+  EXPECT_TRUE(absl::StrContains(udp6, absl::StrCat(" ", st.st_ino, " ")));
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+  InetDiagRequest req = NewRequest(AF_INET6, IPPROTO_UDP, NLM_F_DUMP);
+  bool found = false;
+  ASSERT_NO_ERRNO(NetlinkRequestResponse(
+      fd, &req, sizeof(req),
+      [&](const struct nlmsghdr* hdr) {
+        const struct inet_diag_msg* msg =
+            reinterpret_cast<const struct inet_diag_msg*>(NLMSG_DATA(hdr));
+        EXPECT_EQ(msg->idiag_family, AF_INET6);
+        if (msg->idiag_inode == st.st_ino) {
+          found = true;
+        }
+      },
+      false));
+  EXPECT_TRUE(found);
+}
+
+TEST(NetlinkSockDiagTest, UnsupportedProtocol) {
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+  InetDiagRequest req = NewRequest(AF_INET, IPPROTO_SCTP, NLM_F_DUMP);
+  EXPECT_THAT(NetlinkRequestAckOrError(fd, req.hdr.nlmsg_seq, &req, sizeof(req)),
+              PosixErrorIs(ENOENT, ::testing::_));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -0,0 +1,155 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <arpa/inet.h>
+#include <linux/netlink.h>
+#include <linux/xfrm.h>
+#include <netinet/in.h>
+#include <sys/socket.h>
+
+#include <cstring>
+
+#include "gtest/gtest.h"
+#include "test/syscalls/linux/socket_netlink_util.h"
+#include "test/util/capability_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/socket_util.h"
+#include "test/util/test_util.h"
+
+// Tests for NETLINK_XFRM sockets, as used by ip-xfrm(8).
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+constexpr uint32_t kSPI = 0x1234;
+constexpr char kAEAD[] = "rfc4106(gcm(aes))";
+// A 128 bit key followed by a 32 bit salt.
+constexpr char kKey[] = "0123456789abcdefsalt";
+constexpr int kKeyLen = sizeof(kKey) - 1;
+
+struct NewSARequest {
+  struct nlmsghdr hdr;
+  struct xfrm_usersa_info info;
+  struct nlattr attr;
+  struct xfrm_algo_aead aead;
+  char key[kKeyLen];
+};
+
+struct SAIDRequest {
+  struct nlmsghdr hdr;
+  struct xfrm_usersa_id id;
+};
+
+NewSARequest NewSA(uint32_t seq) {
+  NewSARequest r = {};
+  r.hdr.nlmsg_len = sizeof(r);
+  r.hdr.nlmsg_type = XFRM_MSG_NEWSA;
+  r.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_ACK;
+  r.hdr.nlmsg_seq = seq;
+  r.info.id.daddr.a4 = htonl(INADDR_LOOPBACK);
+  r.info.id.spi = htonl(kSPI);
+  r.info.id.proto = IPPROTO_ESP;
+  r.info.saddr.a4 = htonl(INADDR_LOOPBACK);
+  r.info.family = AF_INET;
+  r.info.mode = XFRM_MODE_TRANSPORT;
+  r.info.replay_window = 32;
+  r.info.lft.soft_byte_limit = XFRM_INF;
+  r.info.lft.hard_byte_limit = XFRM_INF;
+  r.info.lft.soft_packet_limit = XFRM_INF;
+  r.info.lft.hard_packet_limit = XFRM_INF;
+  r.attr.nla_len = sizeof(r.attr) + sizeof(r.aead) + sizeof(r.key);
+  r.attr.nla_type = XFRMA_ALG_AEAD;
+  strncpy(r.aead.alg_name, kAEAD, sizeof(r.aead.alg_name));
+  r.aead.alg_key_len = kKeyLen * 8;
+  r.aead.alg_icv_len = 128;
+  memcpy(r.key, kKey, kKeyLen);
+  return r;
+}
+
+SAIDRequest SAID(uint16_t type, uint32_t seq) {
+  SAIDRequest r = {};
+  r.hdr.nlmsg_len = sizeof(r);
+  r.hdr.nlmsg_type = type;
+  r.hdr.nlmsg_flags = NLM_F_REQUEST;
+  if (type == XFRM_MSG_DELSA) {
+    r.hdr.nlmsg_flags |= NLM_F_ACK;
+  }
+  r.hdr.nlmsg_seq = seq;
+  r.id.daddr.a4 = htonl(INADDR_LOOPBACK);
+  r.id.spi = htonl(kSPI);
+  r.id.family = AF_INET;
+  r.id.proto = IPPROTO_ESP;
+  return r;
+}
+
+TEST(NetlinkXFRMTest, AddGetDeleteSA) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+  auto fd_or = NetlinkBoundSocket(NETLINK_XFRM);
+  SKIP_IF(!fd_or.ok() && fd_or.error().errno_value() == EPROTONOSUPPORT);
+  FileDescriptor fd = std::move(fd_or).ValueOrDie();
+
+  NewSARequest add = NewSA(1);
+  ASSERT_NO_ERRNO(
+      NetlinkRequestAckOrError(fd, add.hdr.nlmsg_seq, &add, sizeof(add)));
+  // Adding the same SA again fails.
+  add.hdr.nlmsg_seq = 2;
+  EXPECT_THAT(
+      NetlinkRequestAckOrError(fd, add.hdr.nlmsg_seq, &add, sizeof(add)),
+      PosixErrorIs(EEXIST, ::testing::_));
+
+  SAIDRequest get = SAID(XFRM_MSG_GETSA, 3);
+  bool found = false;
+  ASSERT_NO_ERRNO(NetlinkRequestResponseSingle(
+      fd, &get, sizeof(get), [&](const struct nlmsghdr* hdr) {
+        ASSERT_EQ(hdr->nlmsg_type, XFRM_MSG_NEWSA);
+        ASSERT_GE(hdr->nlmsg_len,
+                  NLMSG_LENGTH(sizeof(struct xfrm_usersa_info)));
+        const struct xfrm_usersa_info* info =
+            reinterpret_cast<const struct xfrm_usersa_info*>(NLMSG_DATA(hdr));
+        EXPECT_EQ(info->id.spi, htonl(kSPI));
+        EXPECT_EQ(info->id.proto, IPPROTO_ESP);
+        EXPECT_EQ(info->family, AF_INET);
+        EXPECT_EQ(info->mode, XFRM_MODE_TRANSPORT);
+        EXPECT_EQ(info->saddr.a4, htonl(INADDR_LOOPBACK));
+        found = true;
+      }));
+  EXPECT_TRUE(found);
+
+  SAIDRequest del = SAID(XFRM_MSG_DELSA, 4);
+  ASSERT_NO_ERRNO(
+      NetlinkRequestAckOrError(fd, del.hdr.nlmsg_seq, &del, sizeof(del)));
+  del.hdr.nlmsg_seq = 5;
+  EXPECT_THAT(
+      NetlinkRequestAckOrError(fd, del.hdr.nlmsg_seq, &del, sizeof(del)),
+      PosixErrorIs(ESRCH, ::testing::_));
+}
+
+TEST(NetlinkXFRMTest, RequiresCapability) {
+  SKIP_IF(ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+  auto fd_or = NetlinkBoundSocket(NETLINK_XFRM);
+  SKIP_IF(!fd_or.ok() && fd_or.error().errno_value() == EPROTONOSUPPORT);
+  FileDescriptor fd = std::move(fd_or).ValueOrDie();
+
+  NewSARequest add = NewSA(1);
+  EXPECT_THAT(
+      NetlinkRequestAckOrError(fd, add.hdr.nlmsg_seq, &add, sizeof(add)),
+      PosixErrorIs(EPERM, ::testing::_));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -374,6 +374,71 @@ TEST(SymlinkTest, AbsoluteSymlinkDouble) {
               SyscallFailsWithErrno(EEXIST));
 }
 
+// Test that path resolution through cached symlinks observes symlinks being
+// replaced.
+TEST(SymlinkTest, ReplacedSymlinkIsReresolved) {
+  const auto dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  const std::string a = JoinPath(dir.path(), "a");
+  const std::string b = JoinPath(dir.path(), "b");
+  ASSERT_THAT(mkdir(a.c_str(), 0777), SyscallSucceeds());
+  ASSERT_THAT(mkdir(b.c_str(), 0777), SyscallSucceeds());
+  const auto file_a =
+      ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileWith(a, "a", 0666));
+  const auto file_b =
+      ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileWith(b, "b", 0666));
+  const std::string file_a_name = std::string(Basename(file_a.path()));
+  const std::string file_b_name = std::string(Basename(file_b.path()));
+
+  // Build a chain of relative symlinks: link2 -> link1 -> a.
+  const std::string link1 = JoinPath(dir.path(), "link1");
+  const std::string link2 = JoinPath(dir.path(), "link2");
+  ASSERT_THAT(symlink("a", link1.c_str()), SyscallSucceeds());
+  ASSERT_THAT(symlink("link1", link2.c_str()), SyscallSucceeds());
+
+  // Resolve the chain repeatedly so that it is cached.
+  struct stat st;
+  for (int i = 0; i < 3; i++) {
+    ASSERT_THAT(stat(JoinPath(link2, file_a_name).c_str(), &st),
+                SyscallSucceeds());
+  }
+
+  // Point link1 at b instead.
+  ASSERT_THAT(unlink(link1.c_str()), SyscallSucceeds());
+  ASSERT_THAT(symlink("b", link1.c_str()), SyscallSucceeds());
+  EXPECT_THAT(stat(JoinPath(link2, file_a_name).c_str(), &st),
+              SyscallFailsWithErrno(ENOENT));
+  EXPECT_THAT(stat(JoinPath(link2, file_b_name).c_str(), &st),
+              SyscallSucceeds());
+}
+
+// Test that path resolution through cached symlinks observes directories on
+// the resolved path being renamed.
+TEST(SymlinkTest, RenamedDirThroughSymlinkIsReresolved) {
+  const auto dir = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateDir());
+  const std::string a = JoinPath(dir.path(), "a");
+  const std::string c = JoinPath(dir.path(), "c");
+  ASSERT_THAT(mkdir(a.c_str(), 0777), SyscallSucceeds());
+  const auto file =
+      ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFileWith(a, "a", 0666));
+  const std::string file_name = std::string(Basename(file.path()));
+  const std::string link = JoinPath(dir.path(), "link");
+  ASSERT_THAT(symlink("a", link.c_str()), SyscallSucceeds());
+
+  struct stat st;
+  for (int i = 0; i < 3; i++) {
+    ASSERT_THAT(stat(JoinPath(link, file_name).c_str(), &st),
+                SyscallSucceeds());
+  }
+
+  ASSERT_THAT(rename(a.c_str(), c.c_str()), SyscallSucceeds());
+  EXPECT_THAT(stat(JoinPath(link, file_name).c_str(), &st),
+              SyscallFailsWithErrno(ENOENT));
+
+  // Move it back so that TempPath cleanup succeeds.
+  ASSERT_THAT(rename(c.c_str(), a.c_str()), SyscallSucceeds());
+  EXPECT_THAT(stat(JoinPath(link, file_name).c_str(), &st), SyscallSucceeds());
+}
+
 class ParamSymlinkTest : public ::testing::TestWithParam<std::string> {};
 
 // Test that creating an existing symlink with creat will create the target.
@@ -85,11 +85,12 @@ TEST(SyncFileRangeTest, BadArgs) {
 
   EXPECT_THAT(sync_file_range(fd, -1, 0, 0), SyscallFailsWithErrno(EINVAL));
   EXPECT_THAT(sync_file_range(fd, 0, -1, 0), SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(sync_file_range(fd, 4096, -1, 0), SyscallFailsWithErrno(EINVAL));
   EXPECT_THAT(sync_file_range(fd, 8912, INT64_MAX - 4096, 0),
               SyscallFailsWithErrno(EINVAL));
 }
 
-TEST(SyncFileRangeTest, CannotSyncFileRangeWithWaitBefore) {
+TEST(SyncFileRangeTest, WaitBeforeSucceeds) {
   auto tmpfile = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
   auto f = ASSERT_NO_ERRNO_AND_VALUE(Open(tmpfile.path(), O_RDWR));
   constexpr char data[] = "some data to sync";
@@ -97,14 +98,32 @@ TEST(SyncFileRangeTest, CannotSyncFileRangeWithWaitBefore) {
 
   EXPECT_THAT(write(fd, data, sizeof(data)),
               SyscallSucceedsWithValue(sizeof(data)));
-  if (IsRunningOnGvisor()) {
-    EXPECT_THAT(sync_file_range(fd, 0, 0, SYNC_FILE_RANGE_WAIT_BEFORE),
-                SyscallFailsWithErrno(ENOSYS));
-    EXPECT_THAT(
-        sync_file_range(fd, 0, 0,
-                        SYNC_FILE_RANGE_WAIT_BEFORE | SYNC_FILE_RANGE_WRITE),
-        SyscallFailsWithErrno(ENOSYS));
-  }
+  EXPECT_THAT(sync_file_range(fd, 0, 0, SYNC_FILE_RANGE_WAIT_BEFORE),
+              SyscallSucceeds());
+  EXPECT_THAT(
+      sync_file_range(fd, 0, 0,
+                      SYNC_FILE_RANGE_WAIT_BEFORE | SYNC_FILE_RANGE_WRITE),
+      SyscallSucceeds());
+}
+
+TEST(SyncFileRangeTest, PartialRangeKeepsData) {
+  auto tmpfile = ASSERT_NO_ERRNO_AND_VALUE(TempPath::CreateFile());
+  auto f = ASSERT_NO_ERRNO_AND_VALUE(Open(tmpfile.path(), O_RDWR));
+  std::string data(3 * kPageSize, 'a');
+  int fd = f.get();
+
+  EXPECT_THAT(write(fd, data.data(), data.size()),
+              SyscallSucceedsWithValue(data.size()));
+  EXPECT_THAT(sync_file_range(fd, kPageSize, kPageSize,
+                              SYNC_FILE_RANGE_WAIT_BEFORE |
+                                  SYNC_FILE_RANGE_WRITE |
+                                  SYNC_FILE_RANGE_WAIT_AFTER),
+              SyscallSucceeds());
+
+  std::string got(data.size(), '\0');
+  EXPECT_THAT(pread(fd, got.data(), got.size(), 0),
+              SyscallSucceedsWithValue(data.size()));
+  EXPECT_EQ(got, data);
 }
 
 }  // namespace
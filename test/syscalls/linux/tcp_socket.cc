@@ -2004,6 +2004,26 @@ TEST_P(SimpleTcpSocketTest, SetTCPDeferAcceptGreaterThanZero) {
   EXPECT_EQ(get, kTCPDeferAccept);
 }
 
+TEST_P(SimpleTcpSocketTest, SetTCPDeferAcceptRoundsUpToRetransmission) {
+  FileDescriptor s =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(GetParam(), SOCK_STREAM, IPPROTO_TCP));
+
+  // Linux stores TCP_DEFER_ACCEPT as a number of SYN-ACK retransmissions with
+  // an initial timeout of 1s that doubles every retransmission. 5 seconds
+  // requires 3 retransmissions, which read back as 1 + 2 + 4 = 7 seconds.
+  constexpr int kTCPDeferAccept = 5;
+  ASSERT_THAT(setsockopt(s.get(), IPPROTO_TCP, TCP_DEFER_ACCEPT,
+                         &kTCPDeferAccept, sizeof(kTCPDeferAccept)),
+              SyscallSucceeds());
+  int get = -1;
+  socklen_t get_len = sizeof(get);
+  ASSERT_THAT(
+      getsockopt(s.get(), IPPROTO_TCP, TCP_DEFER_ACCEPT, &get, &get_len),
+      SyscallSucceeds());
+  EXPECT_EQ(get_len, sizeof(get));
+  EXPECT_EQ(get, 7);
+}
+
 TEST_P(SimpleTcpSocketTest, RecvOnClosedSocket) {
   auto s =
       ASSERT_NO_ERRNO_AND_VALUE(Socket(GetParam(), SOCK_STREAM, IPPROTO_TCP));
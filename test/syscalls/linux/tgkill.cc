@@ -13,12 +13,18 @@
 // limitations under the License.
 
 #include <errno.h>
+#include <signal.h>
 #include <sys/syscall.h>
 #include <sys/types.h>
 #include <unistd.h>
 
+#include <atomic>
+
 #include "gmock/gmock.h"
 #include "gtest/gtest.h"
+#include "absl/time/clock.h"
+#include "absl/time/time.h"
+#include "test/util/logging.h"
 #include "test/util/signal_util.h"
 #include "test/util/test_util.h"
 #include "test/util/thread_util.h"
@@ -42,6 +48,66 @@ TEST(TgkillTest, ValidInput) {
   EXPECT_THAT(tgkill(getpid(), gettid(), 0), SyscallSucceeds());
 }
 
+std::atomic<int> usr1_count;
+std::atomic<int> usr2_count;
+
+void CountingHandler(int sig) {
+  if (sig == SIGUSR1) {
+    usr1_count.fetch_add(1);
+  } else if (sig == SIGUSR2) {
+    usr2_count.fetch_add(1);
+  }
+}
+
+// A signal that a thread sends to itself is delivered before tgkill returns.
+TEST(TgkillTest, SelfSignalDeliveredBeforeReturn) {
+  struct sigaction sa = {};
+  sa.sa_handler = CountingHandler;
+  auto const cleanup_sa =
+      ASSERT_NO_ERRNO_AND_VALUE(ScopedSigaction(SIGUSR1, sa));
+
+  usr1_count.store(0);
+  for (int i = 1; i <= 100; i++) {
+    ASSERT_THAT(tgkill(getpid(), gettid(), SIGUSR1), SyscallSucceeds());
+    ASSERT_EQ(usr1_count.load(), i);
+  }
+}
+
+// Signals sent to a thread running application code, including a signal
+// that arrives while the thread has yet to handle an earlier one, are all
+// delivered without the thread making a system call.
+TEST(TgkillTest, BackToBackSignalsDeliveredWithoutSyscall) {
+  struct sigaction sa = {};
+  sa.sa_handler = CountingHandler;
+  auto const cleanup_usr1 =
+      ASSERT_NO_ERRNO_AND_VALUE(ScopedSigaction(SIGUSR1, sa));
+  auto const cleanup_usr2 =
+      ASSERT_NO_ERRNO_AND_VALUE(ScopedSigaction(SIGUSR2, sa));
+
+  constexpr int kRounds = 100;
+  const pid_t tid = gettid();
+  for (int i = 1; i <= kRounds; i++) {
+    usr1_count.store(0);
+    usr2_count.store(0);
+    std::atomic<bool> started(false);
+    ScopedThread sender([&] {
+      while (!started.load()) {
+      }
+      TEST_PCHECK(tgkill(getpid(), tid, SIGUSR1) == 0);
+      TEST_PCHECK(tgkill(getpid(), tid, SIGUSR2) == 0);
+    });
+
+    // Spin without making system calls; absl::Now uses the vDSO.
+    started.store(true);
+    const absl::Time deadline = absl::Now() + absl::Seconds(30);
+    while ((usr1_count.load() == 0 || usr2_count.load() == 0) &&
+           absl::Now() < deadline) {
+    }
+    ASSERT_EQ(usr1_count.load(), 1) << "round " << i;
+    ASSERT_EQ(usr2_count.load(), 1) << "round " << i;
+  }
+}
+
 }  // namespace
 
 }  // namespace testing
@@ -0,0 +1,322 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package benchbaseline records native (runc) benchmark results as baselines
+// keyed by a fingerprint of the machine they ran on, and compares later runs
+// against them.
+//
+// This allows runsc to be benchmarked on its own, with overheads reported
+// against the stored baseline, rather than running the full runtime matrix
+// every time.
+package benchbaseline
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gvisor.dev/gvisor/tools/benchutil"
+	"gvisor.dev/gvisor/tools/parsers"
+)
+
+// Fingerprint identifies a machine for the purpose of comparing benchmark
+// results. Results are only comparable between runs with equal fingerprints.
+type Fingerprint struct {
+	// CPUModel is the model name of the first CPU in /proc/cpuinfo.
+	CPUModel string `json:"cpu_model"`
+
+	// NumCPU is the number of CPUs usable by the benchmark.
+	NumCPU int `json:"num_cpu"`
+
+	// MemoryGB is the total memory, rounded down to a whole number of GiB so
+	// that memory reserved by the kernel doesn't change the fingerprint.
+	MemoryGB uint64 `json:"memory_gb"`
+
+	// Kernel is the host kernel release.
+	Kernel string `json:"kernel"`
+}
+
+// Key returns a short string that identifies f, suitable for use as a file
+// name.
+func (f *Fingerprint) Key() string {
+	b, err := json.Marshal(f)
+	if err != nil {
+		panic(fmt.Sprintf("json.Marshal(%+v): %v", f, err))
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// String implements fmt.Stringer.String.
+func (f *Fingerprint) String() string {
+	return fmt.Sprintf("%s, %d CPUs, %d GiB, kernel %s", f.CPUModel, f.NumCPU, f.MemoryGB, f.Kernel)
+}
+
+// HostFingerprint returns the fingerprint of the current machine.
+func HostFingerprint() (*Fingerprint, error) {
+	f := &Fingerprint{NumCPU: runtime.NumCPU()}
+	var err error
+	if f.CPUModel, err = procField("/proc/cpuinfo", "model name"); err != nil {
+		return nil, err
+	}
+	mem, err := procField("/proc/meminfo", "MemTotal")
+	if err != nil {
+		return nil, err
+	}
+	// The value is formatted as "<n> kB".
+	kb, err := strconv.ParseUint(strings.TrimSuffix(mem, " kB"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parsing MemTotal %q: %w", mem, err)
+	}
+	f.MemoryGB = kb >> 20
+	release, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return nil, err
+	}
+	f.Kernel = strings.TrimSpace(string(release))
+	return f, nil
+}
+
+// procField returns the value of the first "key: value" line in file with
+// the given key.
+func procField(file, key string) (string, error) {
+	fd, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	s := bufio.NewScanner(fd)
+	for s.Scan() {
+		k, v, ok := strings.Cut(s.Text(), ":")
+		if ok && strings.TrimSpace(k) == key {
+			return strings.TrimSpace(v), nil
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	// Some architectures don't report a model name.
+	if key == "model name" {
+		return runtime.GOARCH, nil
+	}
+	return "", fmt.Errorf("%s not found in %s", key, file)
+}
+
+// Results maps a benchmark name, including its parameters, to the median of
+// each of its metrics.
+type Results map[string]map[string]float64
+
+// ParseResults parses Go benchmark output. If a benchmark was run several
+// times, e.g. with -test.count, the median of each metric is used.
+func ParseResults(output string) (Results, error) {
+	suite, err := parsers.ParseOutput(output, "" /* name */, false /* official */)
+	if err != nil {
+		return nil, err
+	}
+	samples := make(map[string]map[string][]float64)
+	for _, bm := range suite.Benchmarks {
+		// Conditions are the number of iterations, GOMAXPROCS and the
+		// sub-benchmark parameters. The number of iterations varies between
+		// runs, so it is not part of the name.
+		name := bm.Name
+		for _, c := range bm.Condition {
+			if c.Name == "iterations" {
+				continue
+			}
+			name += "/" + c.Name + "." + c.Value
+		}
+		if samples[name] == nil {
+			samples[name] = make(map[string][]float64)
+		}
+		for _, m := range bm.Metric {
+			metric := m.Name
+			if m.Unit != m.Name {
+				metric += "." + m.Unit
+			}
+			samples[name][metric] = append(samples[name][metric], m.Sample)
+		}
+	}
+	r := make(Results)
+	for name, metrics := range samples {
+		r[name] = make(map[string]float64)
+		for metric, s := range metrics {
+			r[name][metric] = benchutil.Median(s)
+		}
+	}
+	return r, nil
+}
+
+// Baseline is a set of native benchmark results recorded on one machine.
+type Baseline struct {
+	Fingerprint Fingerprint `json:"fingerprint"`
+
+	// Runtime is the runtime the results were recorded with, e.g. "runc".
+	Runtime string `json:"runtime"`
+
+	// Recorded is the time at which the results were last updated.
+	Recorded time.Time `json:"recorded"`
+
+	Results Results `json:"results"`
+}
+
+// path returns the path of the baseline for f in dir.
+func path(dir string, f *Fingerprint) string {
+	return filepath.Join(dir, f.Key()+".json")
+}
+
+// Load loads the baseline for f from dir. It returns an error satisfying
+// errors.Is(err, os.ErrNotExist) if no baseline has been recorded for f.
+func Load(dir string, f *Fingerprint) (*Baseline, error) {
+	data, err := os.ReadFile(path(dir, f))
+	if err != nil {
+		return nil, err
+	}
+	var b Baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path(dir, f), err)
+	}
+	if b.Fingerprint != *f {
+		return nil, fmt.Errorf("%s was recorded on a different machine (%s)", path(dir, f), &b.Fingerprint)
+	}
+	return &b, nil
+}
+
+// Record merges r into the baseline for f in dir, creating it if necessary.
+// Results for benchmarks that are already in the baseline are replaced, and
+// other benchmarks are kept, so that a baseline can be built up from runs of
+// different benchmark targets.
+func Record(dir string, f *Fingerprint, rt string, r Results, now time.Time) (*Baseline, error) {
+	b, err := Load(dir, f)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		b = &Baseline{Fingerprint: *f, Results: make(Results)}
+	case err != nil:
+		return nil, err
+	}
+	if b.Runtime != "" && b.Runtime != rt {
+		return nil, fmt.Errorf("baseline %s was recorded with runtime %q, not %q", path(dir, f), b.Runtime, rt)
+	}
+	b.Runtime = rt
+	b.Recorded = now
+	for name, metrics := range r {
+		b.Results[name] = metrics
+	}
+
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	// Write atomically, so that a concurrent or interrupted run doesn't
+	// leave a corrupt baseline behind.
+	tmp, err := os.CreateTemp(dir, ".baseline")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), path(dir, f)); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// HigherIsBetter returns true if larger values of metric are better. Metrics
+// are as formatted by ParseResults, e.g. "ns/op" or
+// "requests_per_second.QPS". Rates, such as throughput, are better when
+// higher, and all other metrics, such as latencies and sizes, are assumed to
+// be better when lower.
+func HigherIsBetter(metric string) bool {
+	unit := metric
+	if i := strings.LastIndex(metric, "."); i >= 0 {
+		unit = metric[i+1:]
+	}
+	return unit == "QPS" || unit == "MBps" || strings.HasSuffix(unit, "_per_second") || strings.HasSuffix(unit, "/s")
+}
+
+// Comparison compares one metric of one benchmark against the baseline.
+type Comparison struct {
+	Benchmark string
+	Metric    string
+	Baseline  float64
+	Value     float64
+
+	// Overhead is the relative cost of the measured runtime over the
+	// baseline, e.g. 0.25 if it is 25% slower. For metrics where higher is
+	// better, this is Baseline/Value-1, so that it is comparable with
+	// Value/Baseline-1 for other metrics. It is negative if the measured
+	// runtime did better than the baseline.
+	Overhead float64
+}
+
+// Compare compares r against the baseline b. Benchmarks and metrics that are
+// missing from either are returned in missing, by name.
+func Compare(b *Baseline, r Results) (cs []Comparison, missing []string) {
+	for name, metrics := range r {
+		base, ok := b.Results[name]
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		for metric, v := range metrics {
+			bv, ok := base[metric]
+			if !ok {
+				missing = append(missing, name+" "+metric)
+				continue
+			}
+			c := Comparison{
+				Benchmark: name,
+				Metric:    metric,
+				Baseline:  bv,
+				Value:     v,
+			}
+			switch {
+			case HigherIsBetter(metric) && v != 0:
+				c.Overhead = bv/v - 1
+			case !HigherIsBetter(metric) && bv != 0:
+				c.Overhead = v/bv - 1
+			default:
+				// Zero values can't be compared meaningfully.
+				continue
+			}
+			cs = append(cs, c)
+		}
+	}
+	slices.SortFunc(cs, func(a, b Comparison) int {
+		if c := strings.Compare(a.Benchmark, b.Benchmark); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Metric, b.Metric)
+	})
+	slices.Sort(missing)
+	return cs, missing
+}
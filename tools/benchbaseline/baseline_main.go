@@ -0,0 +1,169 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary baseline records native benchmark results as a baseline for the
+// current machine, and reports the overhead of later runs against it.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/tools/benchbaseline"
+)
+
+const (
+	recordString       = "record"
+	recordDescription  = "records the given benchmark output as the baseline for this machine."
+	compareString      = "compare"
+	compareDescription = "reports the overhead of the given benchmark output against the baseline for this machine."
+)
+
+var (
+	// The record command merges the results in `file` into the baseline
+	// for this machine.
+	recordCmd     = flag.NewFlagSet(recordString, flag.ContinueOnError)
+	recordDir     = recordCmd.String("dir", "", "directory in which baselines are stored.")
+	recordFile    = recordCmd.String("file", "", "file holding Go benchmark output of the native runtime.")
+	recordRuntime = recordCmd.String("runtime", "runc", "runtime used to run the benchmark.")
+
+	// The compare command compares the results in `file` with the
+	// baseline for this machine.
+	compareCmd       = flag.NewFlagSet(compareString, flag.ContinueOnError)
+	compareDir       = compareCmd.String("dir", "", "directory in which baselines are stored.")
+	compareFile      = compareCmd.String("file", "", "file holding Go benchmark output to compare.")
+	compareRuntime   = compareCmd.String("runtime", "runsc", "runtime used to run the benchmark.")
+	compareThreshold = compareCmd.Float64("threshold", 0, "if positive, fail if any overhead exceeds this fraction, e.g. 0.5 for 50%.")
+)
+
+// readResults parses the benchmark output in file.
+func readResults(file string) (benchbaseline.Results, error) {
+	if file == "" {
+		return nil, fmt.Errorf("--file is required")
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	r, err := benchbaseline.ParseResults(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", file, err)
+	}
+	if len(r) == 0 {
+		return nil, fmt.Errorf("no benchmarks found in %s", file)
+	}
+	return r, nil
+}
+
+func record() error {
+	if *recordDir == "" {
+		return fmt.Errorf("--dir is required")
+	}
+	r, err := readResults(*recordFile)
+	if err != nil {
+		return err
+	}
+	f, err := benchbaseline.HostFingerprint()
+	if err != nil {
+		return err
+	}
+	b, err := benchbaseline.Record(*recordDir, f, *recordRuntime, r, time.Now())
+	if err != nil {
+		return err
+	}
+	log.Printf("Recorded %d benchmarks for %s (%s); the baseline now holds %d benchmarks", len(r), f.Key(), f, len(b.Results))
+	return nil
+}
+
+func compare() error {
+	if *compareDir == "" {
+		return fmt.Errorf("--dir is required")
+	}
+	r, err := readResults(*compareFile)
+	if err != nil {
+		return err
+	}
+	f, err := benchbaseline.HostFingerprint()
+	if err != nil {
+		return err
+	}
+	b, err := benchbaseline.Load(*compareDir, f)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no baseline recorded for this machine (%s: %s); record one by running the benchmarks with runc", f.Key(), f)
+	} else if err != nil {
+		return err
+	}
+
+	cs, missing := benchbaseline.Compare(b, r)
+	fmt.Printf("Overhead of %s against %s baseline recorded at %s on %s:\n\n", *compareRuntime, b.Runtime, b.Recorded.Format(time.RFC3339), f)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "BENCHMARK\tMETRIC\t%s\t%s\tOVERHEAD\n", b.Runtime, *compareRuntime)
+	var exceeded int
+	for _, c := range cs {
+		mark := ""
+		if *compareThreshold > 0 && c.Overhead > *compareThreshold {
+			mark = " !"
+			exceeded++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%g\t%g\t%+.1f%%%s\n", c.Benchmark, c.Metric, c.Baseline, c.Value, 100*c.Overhead, mark)
+	}
+	w.Flush()
+	for _, m := range missing {
+		fmt.Printf("WARNING: %s is not in the baseline; record it by running it with runc.\n", m)
+	}
+	if exceeded > 0 {
+		return fmt.Errorf("%d metrics exceed the overhead threshold of %.1f%%", exceeded, 100**compareThreshold)
+	}
+	return nil
+}
+
+func main() {
+	var err error
+	switch {
+	// the "record" command.
+	case len(os.Args) >= 2 && os.Args[1] == recordString:
+		if err := recordCmd.Parse(os.Args[2:]); err != nil {
+			log.Fatalf("Failed parse flags: %v\n", err)
+		}
+		err = record()
+	// the "compare" command.
+	case len(os.Args) >= 2 && os.Args[1] == compareString:
+		if err := compareCmd.Parse(os.Args[2:]); err != nil {
+			log.Fatalf("Failed parse flags: %v\n", err)
+		}
+		err = compare()
+	default:
+		printUsage()
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatalf("%s failed: %v", os.Args[1], err)
+	}
+}
+
+// printUsage prints the top level usage string.
+func printUsage() {
+	usage := `Usage: baseline <command> <flags> ...
+
+Available commands:
+  %s     %s
+  %s    %s
+`
+	log.Printf(usage, recordCmd.Name(), recordDescription, compareCmd.Name(), compareDescription)
+}
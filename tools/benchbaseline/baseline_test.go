@@ -0,0 +1,134 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package benchbaseline
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+const output = `goos: linux
+BenchmarkNginx/concurrency.64-8   1   1000 ns/op   300 requests_per_second.QPS
+BenchmarkNginx/concurrency.64-8   1   3000 ns/op   100 requests_per_second.QPS
+BenchmarkNginx/concurrency.64-8   1   2000 ns/op   200 requests_per_second.QPS
+BenchmarkStartup-8                1   5000 ns/op
+PASS
+`
+
+func TestParseResults(t *testing.T) {
+	r, err := ParseResults(output)
+	if err != nil {
+		t.Fatalf("ParseResults failed: %v", err)
+	}
+	want := Results{
+		"BenchmarkNginx/GOMAXPROCS.8/concurrency.64": {
+			"ns/op":                   2000,
+			"requests_per_second.QPS": 200,
+		},
+		"BenchmarkStartup/GOMAXPROCS.8": {
+			"ns/op": 5000,
+		},
+	}
+	if diff := cmp.Diff(want, r); diff != "" {
+		t.Errorf("ParseResults returned unexpected results (-want +got):\n%s", diff)
+	}
+}
+
+func TestRecordLoad(t *testing.T) {
+	dir := t.TempDir()
+	f := &Fingerprint{CPUModel: "cpu", NumCPU: 8, MemoryGB: 32, Kernel: "6.1"}
+	if _, err := Load(dir, f); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Load of missing baseline returned %v, want os.ErrNotExist", err)
+	}
+
+	now := time.Unix(1000, 0).UTC()
+	if _, err := Record(dir, f, "runc", Results{"A": {"ns/op": 1}, "B": {"ns/op": 2}}, now); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	// A second run replaces B and adds C, but keeps A.
+	if _, err := Record(dir, f, "runc", Results{"B": {"ns/op": 3}, "C": {"ns/op": 4}}, now); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if _, err := Record(dir, f, "runsc", Results{"A": {"ns/op": 5}}, now); err == nil {
+		t.Errorf("Record with a different runtime succeeded")
+	}
+
+	b, err := Load(dir, f)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	want := &Baseline{
+		Fingerprint: *f,
+		Runtime:     "runc",
+		Recorded:    now,
+		Results:     Results{"A": {"ns/op": 1}, "B": {"ns/op": 3}, "C": {"ns/op": 4}},
+	}
+	if diff := cmp.Diff(want, b); diff != "" {
+		t.Errorf("Load returned unexpected baseline (-want +got):\n%s", diff)
+	}
+
+	// A different machine has no baseline.
+	other := *f
+	other.NumCPU = 4
+	if _, err := Load(dir, &other); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Load for another machine returned %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	b := &Baseline{
+		Results: Results{
+			"A": {"ns/op": 100, "requests_per_second.QPS": 200},
+			"B": {"ns/op": 100},
+		},
+	}
+	cs, missing := Compare(b, Results{
+		"A": {"ns/op": 150, "requests_per_second.QPS": 100, "latency.s": 1},
+		"B": {"ns/op": 80},
+		"C": {"ns/op": 1},
+	})
+	want := []Comparison{
+		{Benchmark: "A", Metric: "ns/op", Baseline: 100, Value: 150, Overhead: 0.5},
+		{Benchmark: "A", Metric: "requests_per_second.QPS", Baseline: 200, Value: 100, Overhead: 1},
+		{Benchmark: "B", Metric: "ns/op", Baseline: 100, Value: 80, Overhead: -0.2},
+	}
+	if diff := cmp.Diff(want, cs, cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+		t.Errorf("Compare returned unexpected comparisons (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"A latency.s", "C"}, missing); diff != "" {
+		t.Errorf("Compare returned unexpected missing benchmarks (-want +got):\n%s", diff)
+	}
+}
+
+func TestHigherIsBetter(t *testing.T) {
+	for metric, want := range map[string]bool{
+		"ns/op":                        false,
+		"latency_p99.s":                false,
+		"requests_per_second.QPS":      true,
+		"bandwidth.bytes_per_second":   true,
+		"gpu_pcie_rx_mean.MBps":        true,
+		"average_container_size.bytes": false,
+		"transfer_rate_b/s":            true,
+	} {
+		if got := HigherIsBetter(metric); got != want {
+			t.Errorf("HigherIsBetter(%q) = %t, want %t", metric, got, want)
+		}
+	}
+}
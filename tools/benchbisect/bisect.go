@@ -0,0 +1,276 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package benchbisect finds the commit that introduced a benchmark
+// regression by bisecting over a range of commits.
+package benchbisect
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"gvisor.dev/gvisor/tools/benchutil"
+)
+
+// Measurer measures a benchmark at a commit.
+type Measurer interface {
+	// Measure builds the given commit, runs the benchmark and returns one
+	// sample of the metric per run.
+	Measure(ctx context.Context, commit string) ([]float64, error)
+}
+
+// Options controls a bisection.
+type Options struct {
+	// Threshold is the smallest relative regression between the good and
+	// bad commits that is bisected, e.g. 0.05 for 5%.
+	Threshold float64
+
+	// HigherIsBetter is set if larger values of the metric are better, as
+	// for throughput. Otherwise smaller values are better, as for latency.
+	HigherIsBetter bool
+
+	// Logf, if set, is used to report progress.
+	Logf func(format string, args ...any)
+}
+
+func (o *Options) logf(format string, args ...any) {
+	if o.Logf != nil {
+		o.Logf(format, args...)
+	}
+}
+
+// Result is the outcome of a bisection.
+type Result struct {
+	// Culprit is the first bad commit.
+	Culprit string
+
+	// LastGood is the commit before Culprit.
+	LastGood string
+
+	// Good and Bad are the medians of the metric at the good and bad
+	// commits passed to Bisect.
+	Good float64
+	Bad  float64
+
+	// Measurements holds the median of the metric at each measured commit.
+	Measurements map[string]float64
+
+	// Steps is the number of commits measured.
+	Steps int
+
+	// Confirmed is set if measuring LastGood and Culprit again classified
+	// them the same way, so that the result is unlikely to be due to noise.
+	Confirmed bool
+}
+
+// bisector holds the state of a bisection.
+type bisector struct {
+	m    Measurer
+	opts Options
+	res  Result
+}
+
+// measure returns the median of the metric at commit.
+func (b *bisector) measure(ctx context.Context, commit string) (float64, error) {
+	samples, err := b.m.Measure(ctx, commit)
+	if err != nil {
+		return 0, fmt.Errorf("measuring %s: %w", commit, err)
+	}
+	if len(samples) == 0 {
+		return 0, fmt.Errorf("measuring %s: no samples", commit)
+	}
+	v := benchutil.Median(samples)
+	b.res.Measurements[commit] = v
+	b.res.Steps++
+	b.opts.logf("%s: median %g of %d samples", commit, v, len(samples))
+	return v, nil
+}
+
+// regression returns the relative regression of v from the good median. It
+// is positive if v is worse.
+func (b *bisector) regression(v float64) float64 {
+	r := (v - b.res.Good) / b.res.Good
+	if b.opts.HigherIsBetter {
+		r = -r
+	}
+	return r
+}
+
+// isBad returns true if v is closer to the bad median than to the good one.
+func (b *bisector) isBad(v float64) bool {
+	return b.regression(v) >= b.regression(b.res.Bad)/2
+}
+
+// Bisect finds the first commit in commits at which the benchmark measured
+// by m regressed. commits must be ordered from oldest to newest; the first
+// commit is assumed to be good and the last one bad. Both are measured first,
+// and Bisect fails if they differ by less than opts.Threshold.
+//
+// Each commit is classified by the median of its samples, as good or bad
+// depending on which of the medians at the ends it is closer to. Once the
+// culprit is found, it and its parent are measured again to confirm the
+// result.
+func Bisect(ctx context.Context, m Measurer, commits []string, opts Options) (*Result, error) {
+	if len(commits) < 2 {
+		return nil, fmt.Errorf("need at least two commits, got %d", len(commits))
+	}
+	if opts.Threshold <= 0 {
+		return nil, fmt.Errorf("threshold must be positive, got %g", opts.Threshold)
+	}
+	b := &bisector{
+		m:    m,
+		opts: opts,
+		res:  Result{Measurements: make(map[string]float64)},
+	}
+
+	good, bad := 0, len(commits)-1
+	var err error
+	if b.res.Good, err = b.measure(ctx, commits[good]); err != nil {
+		return nil, err
+	}
+	if b.res.Good == 0 {
+		return nil, fmt.Errorf("metric at good commit %s is zero", commits[good])
+	}
+	if b.res.Bad, err = b.measure(ctx, commits[bad]); err != nil {
+		return nil, err
+	}
+	if r := b.regression(b.res.Bad); r < opts.Threshold {
+		return nil, fmt.Errorf("no regression between %s (%g) and %s (%g): %.2f%% is below the threshold of %.2f%%", commits[good], b.res.Good, commits[bad], b.res.Bad, 100*r, 100*opts.Threshold)
+	}
+
+	for bad-good > 1 {
+		mid := good + (bad-good)/2
+		v, err := b.measure(ctx, commits[mid])
+		if err != nil {
+			return nil, err
+		}
+		if b.isBad(v) {
+			opts.logf("%s is bad", commits[mid])
+			bad = mid
+		} else {
+			opts.logf("%s is good", commits[mid])
+			good = mid
+		}
+	}
+	b.res.LastGood = commits[good]
+	b.res.Culprit = commits[bad]
+
+	// Guard against a single noisy measurement having sent the search the
+	// wrong way.
+	g, err := b.measure(ctx, b.res.LastGood)
+	if err != nil {
+		return nil, err
+	}
+	c, err := b.measure(ctx, b.res.Culprit)
+	if err != nil {
+		return nil, err
+	}
+	b.res.Confirmed = !b.isBad(g) && b.isBad(c)
+	return &b.res, nil
+}
+
+// CommandMeasurer is a Measurer that checks out each commit in a git
+// worktree and runs shell commands to build it and run the benchmark.
+//
+// Noise is reduced by discarding warmup runs, pausing between runs and
+// taking the median over several runs.
+type CommandMeasurer struct {
+	// Dir is the git worktree in which commits are checked out and the
+	// commands are run.
+	Dir string
+
+	// BuildCmd builds and installs the runtime. It is run once per commit.
+	BuildCmd string
+
+	// RunCmd runs the benchmark and prints Go benchmark output.
+	RunCmd string
+
+	// Benchmark is the name of the benchmark, without sub-benchmarks.
+	Benchmark string
+
+	// Metric is the name of the metric, as in the benchmark output, e.g.
+	// "ns/op" or "requests_per_second".
+	Metric string
+
+	// Warmup is the number of runs whose results are discarded.
+	Warmup int
+
+	// Runs is the number of runs whose results are used.
+	Runs int
+
+	// Cooldown is the time to wait before each run.
+	Cooldown time.Duration
+
+	// Logf, if set, is used to report progress.
+	Logf func(format string, args ...any)
+}
+
+func (c *CommandMeasurer) logf(format string, args ...any) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+	}
+}
+
+// run runs the shell command cmd in c.Dir, with COMMIT set to commit in its
+// environment, and returns its standard output.
+func (c *CommandMeasurer) run(ctx context.Context, commit, cmd string) (string, error) {
+	sh := exec.CommandContext(ctx, "sh", "-c", cmd)
+	sh.Dir = c.Dir
+	sh.Env = append(os.Environ(), "COMMIT="+commit)
+	sh.Stderr = os.Stderr
+	out, err := sh.Output()
+	if err != nil {
+		return string(out), fmt.Errorf("%q: %w", cmd, err)
+	}
+	return string(out), nil
+}
+
+// Measure implements Measurer.Measure.
+func (c *CommandMeasurer) Measure(ctx context.Context, commit string) ([]float64, error) {
+	if _, err := c.run(ctx, commit, "git checkout --quiet --detach \"$COMMIT\""); err != nil {
+		return nil, err
+	}
+	c.logf("%s: building", commit)
+	if _, err := c.run(ctx, commit, c.BuildCmd); err != nil {
+		return nil, err
+	}
+
+	var samples []float64
+	for i := 0; i < c.Warmup+c.Runs; i++ {
+		if c.Cooldown > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(c.Cooldown):
+			}
+		}
+		c.logf("%s: run %d of %d", commit, i+1, c.Warmup+c.Runs)
+		out, err := c.run(ctx, commit, c.RunCmd)
+		if err != nil {
+			return nil, err
+		}
+		if i < c.Warmup {
+			continue
+		}
+		s, err := benchutil.Samples(out, c.Benchmark, c.Metric)
+		if err != nil {
+			return nil, fmt.Errorf("run %d: %w", i+1, err)
+		}
+		samples = append(samples, s...)
+	}
+	return samples, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary benchbisect finds the commit that introduced a benchmark
+// regression. At each step it checks out a commit, builds and installs
+// runsc, runs the benchmark several times and compares the median against
+// the good and bad commits.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/tools/benchbisect"
+	"gvisor.dev/gvisor/tools/benchutil"
+)
+
+var (
+	repo           = flag.String("repo", ".", "path to the gVisor git repository.")
+	good           = flag.String("good", "", "known good commit.")
+	bad            = flag.String("bad", "HEAD", "known bad commit.")
+	target         = flag.String("target", "", "bazel target of the benchmark, e.g. //test/benchmarks/network:nginx_test.")
+	benchmark      = flag.String("benchmark", "", "benchmark to run, passed to -test.bench, e.g. BenchmarkNginxConcurrency/Concurrency.1.")
+	metric         = flag.String("metric", "ns/op", "metric to compare, as in the benchmark output.")
+	threshold      = flag.Float64("threshold", 0.05, "smallest relative regression to bisect, e.g. 0.05 for 5%.")
+	higherIsBetter = flag.Bool("higher_is_better", false, "larger values of the metric are better, e.g. for throughput.")
+	runs           = flag.Int("runs", 5, "number of runs per commit; the median is used.")
+	warmup         = flag.Int("warmup", 1, "number of runs per commit whose results are discarded.")
+	cooldown       = flag.Duration("cooldown", 0, "time to wait before each run.")
+	benchtime      = flag.String("benchtime", "10s", "value of -test.benchtime.")
+	runtime        = flag.String("runtime", "runsc", "runtime to install and benchmark.")
+	buildCmd       = flag.String("build_cmd", "", "shell command that builds and installs the runtime; defaults to make dev.")
+	runCmd         = flag.String("run_cmd", "", "shell command that runs the benchmark; defaults to make run-benchmark.")
+	workdir        = flag.String("workdir", "", "existing git worktree in which to check out commits; a temporary one is created if unset.")
+)
+
+// git runs git in the repository and returns its trimmed output.
+func git(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", *repo}, args...)...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// commitRange returns good followed by the commits on the first-parent
+// history from good to bad, oldest first.
+func commitRange(ctx context.Context) ([]string, error) {
+	g, err := git(ctx, "rev-parse", "--verify", *good+"^{commit}")
+	if err != nil {
+		return nil, err
+	}
+	out, err := git(ctx, "rev-list", "--first-parent", "--reverse", g+".."+*bad)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{g}, strings.Fields(out)...), nil
+}
+
+func run(ctx context.Context) error {
+	if *good == "" || *target == "" || *benchmark == "" {
+		return fmt.Errorf("--good, --target and --benchmark are required")
+	}
+	commits, err := commitRange(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("Bisecting %d commits", len(commits)-1)
+
+	dir := *workdir
+	if dir == "" {
+		if dir, err = os.MkdirTemp("", "benchbisect"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		if _, err := git(ctx, "worktree", "add", "--detach", dir, commits[0]); err != nil {
+			return err
+		}
+		defer git(context.Background(), "worktree", "remove", "--force", dir)
+	}
+
+	build := *buildCmd
+	if build == "" {
+		build = fmt.Sprintf("make dev RUNTIME=%s", benchutil.ShellQuote(*runtime))
+	}
+	bench := *runCmd
+	if bench == "" {
+		// Profiling and runc would only add time and noise.
+		bench = fmt.Sprintf("make run-benchmark RUNTIME=%s BENCHMARKS_TARGETS=%s BENCHMARKS_FILTER=%s BENCHMARKS_OPTIONS=%s BENCHMARKS_PROFILE= BENCHMARKS_RUNC=false",
+			benchutil.ShellQuote(*runtime), benchutil.ShellQuote(*target), benchutil.ShellQuote(*benchmark), benchutil.ShellQuote("-test.benchtime="+*benchtime))
+	}
+	m := &benchbisect.CommandMeasurer{
+		Dir:       dir,
+		BuildCmd:  build,
+		RunCmd:    bench,
+		Benchmark: strings.SplitN(*benchmark, "/", 2)[0],
+		Metric:    *metric,
+		Warmup:    *warmup,
+		Runs:      *runs,
+		Cooldown:  *cooldown,
+		Logf:      log.Printf,
+	}
+	res, err := benchbisect.Bisect(ctx, m, commits, benchbisect.Options{
+		Threshold:      *threshold,
+		HigherIsBetter: *higherIsBetter,
+		Logf:           log.Printf,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Culprit:   %s (%s: %g)\n", res.Culprit, *metric, res.Measurements[res.Culprit])
+	fmt.Printf("Last good: %s (%s: %g)\n", res.LastGood, *metric, res.Measurements[res.LastGood])
+	fmt.Printf("Range:     %g -> %g in %d steps\n", res.Good, res.Bad, res.Steps)
+	if !res.Confirmed {
+		fmt.Printf("WARNING: re-measuring did not reproduce the regression at the culprit; the benchmark may be too noisy, consider more --runs.\n")
+	}
+	return nil
+}
+
+func main() {
+	flag.Parse()
+	if err := run(context.Background()); err != nil {
+		log.Fatalf("Bisection failed: %v", err)
+	}
+}
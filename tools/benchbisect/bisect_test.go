@@ -0,0 +1,125 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package benchbisect
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// fakeMeasurer returns samples from a table, and counts how often each
+// commit was measured.
+type fakeMeasurer struct {
+	samples map[string][][]float64
+	counts  map[string]int
+}
+
+func (f *fakeMeasurer) Measure(ctx context.Context, commit string) ([]float64, error) {
+	s, ok := f.samples[commit]
+	if !ok {
+		return nil, fmt.Errorf("unknown commit %s", commit)
+	}
+	i := min(f.counts[commit], len(s)-1)
+	f.counts[commit]++
+	return s[i], nil
+}
+
+// commits returns n commit names, and a fakeMeasurer whose samples are
+// around good before commit culprit and around bad from it on.
+func commits(n, culprit int, good, bad float64) ([]string, *fakeMeasurer) {
+	var cs []string
+	f := &fakeMeasurer{
+		samples: make(map[string][][]float64),
+		counts:  make(map[string]int),
+	}
+	for i := 0; i < n; i++ {
+		c := fmt.Sprintf("c%d", i)
+		cs = append(cs, c)
+		v := good
+		if i >= culprit {
+			v = bad
+		}
+		// An outlier must not affect the median.
+		f.samples[c] = [][]float64{{v * 0.99, v * 3, v, v * 1.01, v * 0.5}}
+	}
+	return cs, f
+}
+
+func TestBisect(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		n, culprit     int
+		good, bad      float64
+		higherIsBetter bool
+	}{
+		{name: "latency", n: 20, culprit: 13, good: 100, bad: 120},
+		{name: "throughput", n: 20, culprit: 7, good: 100, bad: 80, higherIsBetter: true},
+		{name: "first", n: 9, culprit: 1, good: 100, bad: 200},
+		{name: "last", n: 9, culprit: 8, good: 100, bad: 200},
+		{name: "adjacent", n: 2, culprit: 1, good: 100, bad: 200},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cs, f := commits(tc.n, tc.culprit, tc.good, tc.bad)
+			res, err := Bisect(context.Background(), f, cs, Options{
+				Threshold:      0.1,
+				HigherIsBetter: tc.higherIsBetter,
+			})
+			if err != nil {
+				t.Fatalf("Bisect failed: %v", err)
+			}
+			if want := cs[tc.culprit]; res.Culprit != want {
+				t.Errorf("got culprit %s, want %s", res.Culprit, want)
+			}
+			if want := cs[tc.culprit-1]; res.LastGood != want {
+				t.Errorf("got last good %s, want %s", res.LastGood, want)
+			}
+			if !res.Confirmed {
+				t.Errorf("result not confirmed")
+			}
+			if res.Good != tc.good || res.Bad != tc.bad {
+				t.Errorf("got range %g -> %g, want %g -> %g", res.Good, res.Bad, tc.good, tc.bad)
+			}
+		})
+	}
+}
+
+func TestBisectBelowThreshold(t *testing.T) {
+	cs, f := commits(10, 5, 100, 104)
+	if _, err := Bisect(context.Background(), f, cs, Options{Threshold: 0.05}); err == nil {
+		t.Errorf("Bisect succeeded with a regression below the threshold")
+	}
+	// An improvement is not a regression.
+	cs, f = commits(10, 5, 100, 50)
+	if _, err := Bisect(context.Background(), f, cs, Options{Threshold: 0.05}); err == nil {
+		t.Errorf("Bisect succeeded with an improvement")
+	}
+}
+
+func TestBisectUnconfirmed(t *testing.T) {
+	cs, f := commits(3, 2, 100, 200)
+	// c1 first looks bad, but is good when measured again.
+	f.samples["c1"] = [][]float64{{200}, {100}}
+	res, err := Bisect(context.Background(), f, cs, Options{Threshold: 0.1})
+	if err != nil {
+		t.Fatalf("Bisect failed: %v", err)
+	}
+	if res.Culprit != "c1" {
+		t.Errorf("got culprit %s, want c1", res.Culprit)
+	}
+	if res.Confirmed {
+		t.Errorf("noisy result was confirmed")
+	}
+}
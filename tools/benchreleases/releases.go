@@ -0,0 +1,464 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package benchreleases runs a benchmark against historical runsc releases
+// and reports how its results changed from release to release.
+package benchreleases
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gvisor.dev/gvisor/tools/benchutil"
+)
+
+// DefaultBaseURL is where runsc releases are published, with one directory
+// per release.
+const DefaultBaseURL = "https://storage.googleapis.com/gvisor/releases/release"
+
+// releaseRE matches release names: a date, optionally followed by a point
+// release number.
+var releaseRE = regexp.MustCompile(`^[0-9]{8}(\.[0-9]+)?$`)
+
+// ParseRelease returns the name of the release identified by tag, which may
+// be a GitHub release tag such as "release-20240513.0", or a release name
+// such as "20240513.0" or "20240513". A release without a point release
+// number refers to the latest point release of that date.
+func ParseRelease(tag string) (string, error) {
+	name := strings.TrimPrefix(tag, "release-")
+	if !releaseRE.MatchString(name) {
+		return "", fmt.Errorf("invalid release tag %q, want release-YYYYMMDD.N, YYYYMMDD.N or YYYYMMDD", tag)
+	}
+	return name, nil
+}
+
+// RuntimeName returns the name of the Docker runtime that release is
+// installed as.
+func RuntimeName(release string) string {
+	return "runsc-" + strings.ReplaceAll(release, ".", "-")
+}
+
+// Arch returns the release architecture name, as in uname -m, for a Go
+// architecture name.
+func Arch(goarch string) string {
+	switch goarch {
+	case "amd64":
+		return "x86_64"
+	case "arm64":
+		return "aarch64"
+	default:
+		return goarch
+	}
+}
+
+// Downloader downloads runsc release binaries.
+type Downloader struct {
+	// BaseURL is the URL of the directory holding one directory per release.
+	BaseURL string
+
+	// Arch is the release architecture, e.g. x86_64.
+	Arch string
+
+	// Dir is the directory where binaries are stored, in one subdirectory per
+	// release. Binaries that are already present and match their checksum
+	// are not downloaded again.
+	Dir string
+
+	// Client is used for downloads. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Download downloads the runsc binary of release, verifies it against the
+// published SHA-512 checksum, and returns its path.
+func (d *Downloader) Download(ctx context.Context, release string) (string, error) {
+	url := fmt.Sprintf("%s/%s/%s/runsc", strings.TrimSuffix(d.BaseURL, "/"), release, d.Arch)
+	sum, err := d.get(ctx, url+".sha512")
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(sum))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("%s.sha512: empty checksum file", url)
+	}
+	want := strings.ToLower(fields[0])
+
+	path := filepath.Join(d.Dir, release, "runsc")
+	if data, err := os.ReadFile(path); err == nil && checksum(data) == want {
+		return path, nil
+	}
+	data, err := d.get(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	if got := checksum(data); got != want {
+		return "", fmt.Errorf("%s: checksum mismatch: got %s, want %s", url, got, want)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	// The binary must be readable and executable by the Docker daemon.
+	if err := os.WriteFile(path, data, 0755); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func checksum(data []byte) string {
+	sum := sha512.Sum512(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns the body of url.
+func (d *Downloader) get(ctx context.Context, url string) ([]byte, error) {
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Measurer measures a benchmark with a release.
+type Measurer interface {
+	// Measure installs the given release, runs the benchmark and returns one
+	// sample of the metric per run.
+	Measure(ctx context.Context, release string) ([]float64, error)
+}
+
+// CommandMeasurer is a Measurer that downloads each release and runs shell
+// commands to install it as a Docker runtime, run the benchmark and
+// uninstall it.
+//
+// The commands run with RUNSC set to the path of the release's binary,
+// RUNTIME to the name of its Docker runtime (see RuntimeName) and RELEASE to
+// the release name in their environment.
+type CommandMeasurer struct {
+	// Downloader downloads release binaries.
+	Downloader *Downloader
+
+	// Dir is the directory in which the commands are run.
+	Dir string
+
+	// InstallCmd installs the release as a Docker runtime.
+	InstallCmd string
+
+	// RunCmd runs the benchmark and prints Go benchmark output.
+	RunCmd string
+
+	// UninstallCmd, if set, removes the Docker runtime once the release has
+	// been measured.
+	UninstallCmd string
+
+	// Benchmark is the name of the benchmark, without sub-benchmarks.
+	Benchmark string
+
+	// Metric is the name of the metric, as in the benchmark output, e.g.
+	// "ns/op" or "requests_per_second".
+	Metric string
+
+	// Warmup is the number of runs whose results are discarded.
+	Warmup int
+
+	// Runs is the number of runs whose results are used.
+	Runs int
+
+	// Cooldown is the time to wait before each run.
+	Cooldown time.Duration
+
+	// Logf, if set, is used to report progress.
+	Logf func(format string, args ...any)
+}
+
+func (c *CommandMeasurer) logf(format string, args ...any) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+	}
+}
+
+// run runs the shell command cmd in c.Dir with env added to its environment,
+// and returns its standard output.
+func (c *CommandMeasurer) run(ctx context.Context, env []string, cmd string) (string, error) {
+	sh := exec.CommandContext(ctx, "sh", "-c", cmd)
+	sh.Dir = c.Dir
+	sh.Env = append(os.Environ(), env...)
+	sh.Stderr = os.Stderr
+	out, err := sh.Output()
+	if err != nil {
+		return string(out), fmt.Errorf("%q: %w", cmd, err)
+	}
+	return string(out), nil
+}
+
+// Measure implements Measurer.Measure.
+func (c *CommandMeasurer) Measure(ctx context.Context, release string) (samples []float64, retErr error) {
+	c.logf("%s: downloading", release)
+	bin, err := c.Downloader.Download(ctx, release)
+	if err != nil {
+		return nil, err
+	}
+	env := []string{"RUNSC=" + bin, "RUNTIME=" + RuntimeName(release), "RELEASE=" + release}
+	c.logf("%s: installing runtime %s", release, RuntimeName(release))
+	if _, err := c.run(ctx, env, c.InstallCmd); err != nil {
+		return nil, err
+	}
+	if c.UninstallCmd != "" {
+		defer func() {
+			if _, err := c.run(context.Background(), env, c.UninstallCmd); err != nil && retErr == nil {
+				retErr = err
+			}
+		}()
+	}
+
+	for i := 0; i < c.Warmup+c.Runs; i++ {
+		if c.Cooldown > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(c.Cooldown):
+			}
+		}
+		c.logf("%s: run %d of %d", release, i+1, c.Warmup+c.Runs)
+		out, err := c.run(ctx, env, c.RunCmd)
+		if err != nil {
+			return nil, err
+		}
+		if i < c.Warmup {
+			continue
+		}
+		s, err := benchutil.Samples(out, c.Benchmark, c.Metric)
+		if err != nil {
+			return nil, fmt.Errorf("run %d: %w", i+1, err)
+		}
+		samples = append(samples, s...)
+	}
+	return samples, nil
+}
+
+// Options controls a run across releases.
+type Options struct {
+	// Metric is the name of the measured metric, used in reports.
+	Metric string
+
+	// HigherIsBetter is set if larger values of the metric are better, as
+	// for throughput. Otherwise smaller values are better, as for latency.
+	HigherIsBetter bool
+
+	// Logf, if set, is used to report progress.
+	Logf func(format string, args ...any)
+}
+
+func (o *Options) logf(format string, args ...any) {
+	if o.Logf != nil {
+		o.Logf(format, args...)
+	}
+}
+
+// Result is the measurement of a single release.
+type Result struct {
+	// Release is the release name.
+	Release string `json:"release"`
+
+	// Samples holds the samples of the metric.
+	Samples []float64 `json:"samples,omitempty"`
+
+	// Median is the median of Samples.
+	Median float64 `json:"median"`
+
+	// Change is the relative change of Median from the previous measured
+	// release, e.g. 0.1 for 10% higher. It is zero for the first one.
+	Change float64 `json:"change"`
+
+	// Total is the relative change of Median from the first measured
+	// release.
+	Total float64 `json:"total"`
+
+	// Improved is set if Change is an improvement, according to
+	// Options.HigherIsBetter.
+	Improved bool `json:"improved"`
+
+	// Err is set if the release couldn't be measured, e.g. because it
+	// doesn't support a feature that the benchmark requires.
+	Err string `json:"error,omitempty"`
+}
+
+// Report holds the results of a run across releases.
+type Report struct {
+	// Metric is the name of the measured metric.
+	Metric string `json:"metric"`
+
+	// HigherIsBetter is set if larger values of the metric are better.
+	HigherIsBetter bool `json:"higher_is_better"`
+
+	// Results holds one result per release, in the order the releases were
+	// given.
+	Results []Result `json:"results"`
+}
+
+// Run measures the benchmark with each release in turn, oldest first, and
+// returns the trend of its median. A release that fails to be measured is
+// recorded in the report and skipped, so that a single release that can't
+// run the benchmark doesn't spoil the rest of the run. Run only fails if no
+// release could be measured.
+func Run(ctx context.Context, m Measurer, releases []string, opts Options) (*Report, error) {
+	if len(releases) == 0 {
+		return nil, fmt.Errorf("no releases")
+	}
+	r := &Report{
+		Metric:         opts.Metric,
+		HigherIsBetter: opts.HigherIsBetter,
+	}
+	var first, prev float64
+	measured := false
+	for _, release := range releases {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		res := Result{Release: release}
+		samples, err := m.Measure(ctx, release)
+		if err == nil && len(samples) == 0 {
+			err = fmt.Errorf("no samples")
+		}
+		if err != nil {
+			opts.logf("%s: %v", release, err)
+			res.Err = err.Error()
+			r.Results = append(r.Results, res)
+			continue
+		}
+		res.Samples = samples
+		res.Median = benchutil.Median(samples)
+		if measured {
+			res.Change = relative(res.Median, prev)
+			res.Total = relative(res.Median, first)
+			res.Improved = res.Change != 0 && (res.Change > 0) == opts.HigherIsBetter
+		} else {
+			first = res.Median
+			measured = true
+		}
+		prev = res.Median
+		opts.logf("%s: median %g of %d samples", release, res.Median, len(samples))
+		r.Results = append(r.Results, res)
+	}
+	if !measured {
+		return nil, fmt.Errorf("no release could be measured")
+	}
+	return r, nil
+}
+
+// relative returns the relative change from old to v.
+func relative(v, old float64) float64 {
+	if old == 0 {
+		return 0
+	}
+	return (v - old) / old
+}
+
+// Formats supported by Report.Write.
+const (
+	FormatText = "text"
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// Write writes the report to w in the given format.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatText:
+		return r.writeText(w)
+	case FormatCSV:
+		return r.writeCSV(w)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	default:
+		return fmt.Errorf("unknown format %q, want %q, %q or %q", format, FormatText, FormatCSV, FormatJSON)
+	}
+}
+
+// percent formats a relative change as a signed percentage.
+func percent(v float64) string {
+	return fmt.Sprintf("%+.1f%%", 100*v)
+}
+
+func (r *Report) writeText(w io.Writer) error {
+	better := "lower is better"
+	if r.HigherIsBetter {
+		better = "higher is better"
+	}
+	fmt.Fprintf(w, "Metric: %s (%s)\n", r.Metric, better)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RELEASE\tMEDIAN\tSAMPLES\tVS PREVIOUS\tVS FIRST\t")
+	measured := 0
+	for _, res := range r.Results {
+		if res.Err != "" {
+			fmt.Fprintf(tw, "%s\tFAILED: %s\t\t\t\t\n", res.Release, res.Err)
+			continue
+		}
+		change, total := "-", "-"
+		if measured > 0 {
+			change, total = percent(res.Change), percent(res.Total)
+			if res.Improved {
+				change += " (better)"
+			} else if res.Change != 0 {
+				change += " (worse)"
+			}
+		}
+		measured++
+		fmt.Fprintf(tw, "%s\t%g\t%d\t%s\t%s\t\n", res.Release, res.Median, len(res.Samples), change, total)
+	}
+	return tw.Flush()
+}
+
+func (r *Report) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"release", "metric", "median", "samples", "change", "total", "error"})
+	for _, res := range r.Results {
+		cw.Write([]string{
+			res.Release,
+			r.Metric,
+			strconv.FormatFloat(res.Median, 'g', -1, 64),
+			strconv.Itoa(len(res.Samples)),
+			strconv.FormatFloat(res.Change, 'g', -1, 64),
+			strconv.FormatFloat(res.Total, 'g', -1, 64),
+			res.Err,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary benchreleases runs a benchmark against a list of runsc releases and
+// reports how its results changed across them. Each release is downloaded,
+// installed as a Docker runtime, benchmarked several times and uninstalled.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+
+	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/tools/benchreleases"
+	"gvisor.dev/gvisor/tools/benchutil"
+)
+
+var (
+	repo           = flag.String("repo", ".", "path to the gVisor repository in which the benchmark is run.")
+	releases       = flag.String("releases", "", "comma-separated list of releases to benchmark, oldest first, e.g. release-20240513.0,release-20240610.0.")
+	target         = flag.String("target", "", "bazel target of the benchmark, e.g. //test/benchmarks/network:nginx_test.")
+	benchmark      = flag.String("benchmark", "", "benchmark to run, passed to -test.bench, e.g. BenchmarkNginxConcurrency/Concurrency.1.")
+	metric         = flag.String("metric", "ns/op", "metric to report, as in the benchmark output.")
+	higherIsBetter = flag.Bool("higher_is_better", false, "larger values of the metric are better, e.g. for throughput.")
+	runs           = flag.Int("runs", 5, "number of runs per release; the median is reported.")
+	warmup         = flag.Int("warmup", 1, "number of runs per release whose results are discarded.")
+	cooldown       = flag.Duration("cooldown", 0, "time to wait before each run.")
+	benchtime      = flag.String("benchtime", "10s", "value of -test.benchtime.")
+	runtimeArgs    = flag.String("runtime_args", "", "flags passed to each release when it is installed, e.g. --platform=systrap.")
+	baseURL        = flag.String("base_url", benchreleases.DefaultBaseURL, "URL of the directory holding one directory per release.")
+	arch           = flag.String("arch", benchreleases.Arch(runtime.GOARCH), "release architecture to download.")
+	cacheDir       = flag.String("cache_dir", "", "directory in which release binaries are kept across runs; a temporary one is used if unset.")
+	reloadCmd      = flag.String("reload_cmd", "sudo systemctl reload docker", "shell command that reloads Docker after its configuration changed.")
+	installCmd     = flag.String("install_cmd", "", "shell command that installs $RUNSC as Docker runtime $RUNTIME; defaults to runsc install and --reload_cmd.")
+	runCmd         = flag.String("run_cmd", "", "shell command that runs the benchmark with Docker runtime $RUNTIME; defaults to make run-benchmark.")
+	keepRuntimes   = flag.Bool("keep_runtimes", false, "leave releases installed as Docker runtimes.")
+	format         = flag.String("format", benchreleases.FormatText, "report format: text, csv or json.")
+	output         = flag.String("output", "", "file to write the report to; standard output if unset.")
+)
+
+func run(ctx context.Context) error {
+	if *releases == "" || *target == "" || *benchmark == "" {
+		return fmt.Errorf("--releases, --target and --benchmark are required")
+	}
+	var names []string
+	for _, tag := range strings.Split(*releases, ",") {
+		name, err := benchreleases.ParseRelease(strings.TrimSpace(tag))
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+
+	dir := *cacheDir
+	if dir == "" {
+		var err error
+		if dir, err = os.MkdirTemp("", "benchreleases"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+	}
+
+	install := *installCmd
+	if install == "" {
+		install = fmt.Sprintf(`sudo "$RUNSC" install --experimental=true --runtime="$RUNTIME" -- %s && %s`, *runtimeArgs, *reloadCmd)
+	}
+	uninstall := ""
+	if !*keepRuntimes {
+		uninstall = fmt.Sprintf(`sudo "$RUNSC" uninstall --runtime="$RUNTIME" && %s`, *reloadCmd)
+	}
+	bench := *runCmd
+	if bench == "" {
+		// Profiling and runc would only add time and noise.
+		bench = fmt.Sprintf(`make run-benchmark RUNTIME="$RUNTIME" BENCHMARKS_TARGETS=%s BENCHMARKS_FILTER=%s BENCHMARKS_OPTIONS=%s BENCHMARKS_PROFILE= BENCHMARKS_RUNC=false`,
+			benchutil.ShellQuote(*target), benchutil.ShellQuote(*benchmark), benchutil.ShellQuote("-test.benchtime="+*benchtime))
+	}
+	m := &benchreleases.CommandMeasurer{
+		Downloader: &benchreleases.Downloader{
+			BaseURL: *baseURL,
+			Arch:    *arch,
+			Dir:     dir,
+		},
+		Dir:          *repo,
+		InstallCmd:   install,
+		RunCmd:       bench,
+		UninstallCmd: uninstall,
+		Benchmark:    strings.SplitN(*benchmark, "/", 2)[0],
+		Metric:       *metric,
+		Warmup:       *warmup,
+		Runs:         *runs,
+		Cooldown:     *cooldown,
+		Logf:         log.Printf,
+	}
+	report, err := benchreleases.Run(ctx, m, names, benchreleases.Options{
+		Metric:         *metric,
+		HigherIsBetter: *higherIsBetter,
+		Logf:           log.Printf,
+	})
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	return report.Write(out, *format)
+}
+
+func main() {
+	flag.Parse()
+	if err := run(context.Background()); err != nil {
+		log.Fatalf("Benchmarking releases failed: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package benchreleases
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseRelease(t *testing.T) {
+	for _, tc := range []struct {
+		tag     string
+		want    string
+		wantErr bool
+	}{
+		{tag: "release-20240513.0", want: "20240513.0"},
+		{tag: "20240513.1", want: "20240513.1"},
+		{tag: "20240513", want: "20240513"},
+		{tag: "release-2024051", wantErr: true},
+		{tag: "latest", wantErr: true},
+		{tag: "20240513.0/../x", wantErr: true},
+	} {
+		got, err := ParseRelease(tc.tag)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseRelease(%q) = %q, want error", tc.tag, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("ParseRelease(%q) = %q, %v, want %q", tc.tag, got, err, tc.want)
+		}
+	}
+	if got, want := RuntimeName("20240513.0"), "runsc-20240513-0"; got != want {
+		t.Errorf("RuntimeName() = %q, want %q", got, want)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	binary := []byte("runsc binary")
+	sum := sha512.Sum512(binary)
+	downloads := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/20240513.0/x86_64/runsc":
+			downloads++
+			w.Write(binary)
+		case "/20240513.0/x86_64/runsc.sha512":
+			fmt.Fprintf(w, "%s  runsc\n", hex.EncodeToString(sum[:]))
+		case "/20240610.0/x86_64/runsc":
+			w.Write([]byte("corrupted"))
+		case "/20240610.0/x86_64/runsc.sha512":
+			fmt.Fprintf(w, "%s  runsc\n", hex.EncodeToString(sum[:]))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	d := &Downloader{
+		BaseURL: srv.URL,
+		Arch:    "x86_64",
+		Dir:     t.TempDir(),
+	}
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		path, err := d.Download(ctx, "20240513.0")
+		if err != nil {
+			t.Fatalf("Download() failed: %v", err)
+		}
+		if want := filepath.Join(d.Dir, "20240513.0", "runsc"); path != want {
+			t.Errorf("Download() = %q, want %q", path, want)
+		}
+		if data, err := os.ReadFile(path); err != nil || !bytes.Equal(data, binary) {
+			t.Errorf("downloaded binary = %q, %v, want %q", data, err, binary)
+		}
+	}
+	// The binary is only downloaded again if it doesn't match its checksum.
+	if downloads != 1 {
+		t.Errorf("binary downloaded %d times, want 1", downloads)
+	}
+
+	if _, err := d.Download(ctx, "20240610.0"); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Download(corrupted) = %v, want checksum mismatch", err)
+	}
+	if _, err := d.Download(ctx, "20240701.0"); err == nil {
+		t.Errorf("Download(missing) succeeded, want error")
+	}
+}
+
+// fakeMeasurer returns samples from a table.
+type fakeMeasurer map[string][]float64
+
+func (f fakeMeasurer) Measure(ctx context.Context, release string) ([]float64, error) {
+	s, ok := f[release]
+	if !ok {
+		return nil, fmt.Errorf("unsupported flag")
+	}
+	return s, nil
+}
+
+func TestRun(t *testing.T) {
+	m := fakeMeasurer{
+		"r1": {110, 100, 90},
+		"r3": {80, 80, 1000},
+		"r4": {88},
+	}
+	report, err := Run(context.Background(), m, []string{"r1", "r2", "r3", "r4"}, Options{
+		Metric:         "requests_per_second",
+		HigherIsBetter: true,
+	})
+	if err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	want := &Report{
+		Metric:         "requests_per_second",
+		HigherIsBetter: true,
+		Results: []Result{
+			{Release: "r1", Samples: []float64{110, 100, 90}, Median: 100},
+			{Release: "r2", Err: "unsupported flag"},
+			{Release: "r3", Samples: []float64{80, 80, 1000}, Median: 80, Change: -0.2, Total: -0.2},
+			{Release: "r4", Samples: []float64{88}, Median: 88, Change: 0.1, Total: -0.12, Improved: true},
+		},
+	}
+	approx := cmp.Comparer(func(a, b float64) bool {
+		d := a - b
+		return d < 1e-9 && d > -1e-9
+	})
+	if diff := cmp.Diff(want, report, approx); diff != "" {
+		t.Errorf("Run() returned unexpected report (-want +got):\n%s", diff)
+	}
+
+	var buf bytes.Buffer
+	if err := report.Write(&buf, FormatText); err != nil {
+		t.Fatalf("Write(text) failed: %v", err)
+	}
+	for _, s := range []string{"higher is better", "FAILED: unsupported flag", "-20.0% (worse)", "+10.0% (better)", "-12.0%"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("text report doesn't contain %q:\n%s", s, buf.String())
+		}
+	}
+	buf.Reset()
+	if err := report.Write(&buf, FormatCSV); err != nil {
+		t.Fatalf("Write(csv) failed: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 5 || lines[4] != "r4,requests_per_second,88,1,0.1,-0.12," {
+		t.Errorf("CSV report = %q, want 5 lines ending in r4's result", lines)
+	}
+	if err := report.Write(&buf, "xml"); err == nil {
+		t.Errorf("Write(xml) succeeded, want error")
+	}
+
+	if _, err := Run(context.Background(), m, []string{"r2"}, Options{}); err == nil {
+		t.Errorf("Run() with no measurable release succeeded, want error")
+	}
+}
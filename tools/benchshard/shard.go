@@ -0,0 +1,417 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package benchshard distributes benchmarks across a pool of machines, runs
+// them in parallel and merges their results into a single report.
+package benchshard
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Job is a benchmark to be run on one machine.
+type Job struct {
+	// Name identifies the job in reports. It defaults to Target, followed by
+	// Filter if set.
+	Name string `json:"name,omitempty"`
+
+	// Target is the bazel target of the benchmark, e.g.
+	// //test/benchmarks/network:nginx_test.
+	Target string `json:"target"`
+
+	// Filter is passed to -test.bench. If empty, all benchmarks of Target
+	// are run.
+	Filter string `json:"filter,omitempty"`
+
+	// Requires lists the features, e.g. "gpu", that a machine must have to
+	// run the job.
+	Requires []string `json:"requires,omitempty"`
+
+	// Exclusive is set if the job must be the only one running on its
+	// machine, e.g. because it measures whole-machine throughput.
+	Exclusive bool `json:"exclusive,omitempty"`
+}
+
+// String returns the name of the job.
+func (j *Job) String() string {
+	if j.Name != "" {
+		return j.Name
+	}
+	if j.Filter != "" {
+		return j.Target + ":" + j.Filter
+	}
+	return j.Target
+}
+
+// Machine is a machine of the pool on which jobs are run.
+type Machine struct {
+	// Name identifies the machine in reports and is passed to the run
+	// command.
+	Name string `json:"name"`
+
+	// Features lists the features of the machine, e.g. "gpu".
+	Features []string `json:"features,omitempty"`
+
+	// Slots is the number of non-exclusive jobs that may run concurrently on
+	// the machine. Zero means 1.
+	Slots int `json:"slots,omitempty"`
+
+	// Env is added to the environment of the run command for jobs on this
+	// machine, e.g. DOCKER_HOST=tcp://host:2375.
+	Env []string `json:"env,omitempty"`
+}
+
+// slots returns the number of jobs that may run concurrently on m.
+func (m *Machine) slots() int {
+	if m.Slots <= 0 {
+		return 1
+	}
+	return m.Slots
+}
+
+// canRun returns true if m has all features required by j.
+func (m *Machine) canRun(j *Job) bool {
+	for _, f := range j.Requires {
+		if !slices.Contains(m.Features, f) {
+			return false
+		}
+	}
+	return true
+}
+
+// Plan is the set of jobs to run and the machines to run them on.
+type Plan struct {
+	Jobs     []Job     `json:"jobs"`
+	Machines []Machine `json:"machines"`
+}
+
+// ReadPlan reads a JSON-encoded plan from path.
+func ReadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if len(p.Jobs) == 0 {
+		return nil, fmt.Errorf("%s: no jobs", path)
+	}
+	if len(p.Machines) == 0 {
+		return nil, fmt.Errorf("%s: no machines", path)
+	}
+	return &p, nil
+}
+
+// Runner runs a job on a machine.
+type Runner interface {
+	// Run runs j on m and returns its Go benchmark output.
+	Run(ctx context.Context, m *Machine, j *Job) (string, error)
+}
+
+// CommandRunner is a Runner that runs a shell command for each job.
+//
+// The command runs with MACHINE set to the machine name, TARGET to the job's
+// target and FILTER to its filter (or "." if it has none) in its environment,
+// in addition to the machine's Env.
+type CommandRunner struct {
+	// Dir is the directory in which the command is run.
+	Dir string
+
+	// Cmd is the shell command, which prints Go benchmark output.
+	Cmd string
+}
+
+// Run implements Runner.Run.
+func (c *CommandRunner) Run(ctx context.Context, m *Machine, j *Job) (string, error) {
+	filter := j.Filter
+	if filter == "" {
+		filter = "."
+	}
+	sh := exec.CommandContext(ctx, "sh", "-c", c.Cmd)
+	sh.Dir = c.Dir
+	sh.Env = append(os.Environ(), "MACHINE="+m.Name, "TARGET="+j.Target, "FILTER="+filter)
+	sh.Env = append(sh.Env, m.Env...)
+	sh.Stderr = os.Stderr
+	out, err := sh.Output()
+	if err != nil {
+		return string(out), fmt.Errorf("%q: %w", c.Cmd, err)
+	}
+	return string(out), nil
+}
+
+// Options controls a sharded run.
+type Options struct {
+	// Logf, if set, is used to report progress.
+	Logf func(format string, args ...any)
+}
+
+func (o *Options) logf(format string, args ...any) {
+	if o.Logf != nil {
+		o.Logf(format, args...)
+	}
+}
+
+// Result is the outcome of a single job.
+type Result struct {
+	// Job is the name of the job.
+	Job string `json:"job"`
+
+	// Machine is the name of the machine the job ran on. It is empty if no
+	// machine could run the job.
+	Machine string `json:"machine,omitempty"`
+
+	// Duration is the time the job took.
+	Duration time.Duration `json:"duration"`
+
+	// Benchmarks holds the benchmark result lines of the job's output.
+	Benchmarks []string `json:"benchmarks,omitempty"`
+
+	// Err is set if the job failed.
+	Err string `json:"error,omitempty"`
+}
+
+// Report holds the results of a sharded run.
+type Report struct {
+	// Results holds one result per job, in the order of the plan.
+	Results []Result `json:"results"`
+}
+
+// Failed returns the number of failed jobs.
+func (r *Report) Failed() int {
+	failed := 0
+	for _, res := range r.Results {
+		if res.Err != "" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// benchmarkLines returns the result lines of Go benchmark output out.
+func benchmarkLines(out string) []string {
+	var lines []string
+	s := bufio.NewScanner(strings.NewReader(out))
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		// Result lines hold the name, the number of iterations and at least
+		// one metric; lines such as "BenchmarkFoo" printed by -test.v don't.
+		if strings.HasPrefix(line, "Benchmark") && len(strings.Fields(line)) >= 4 {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// scheduler tracks which jobs run where.
+type scheduler struct {
+	mu sync.Mutex
+
+	// cond is signaled when a job completes.
+	cond *sync.Cond
+
+	// used[i] is the number of slots in use on machine i. An exclusive job
+	// uses all of them.
+	used []int
+}
+
+// pick returns the index of a machine that is not reserved and can run j
+// now, or -1. If possible is true, a machine exists that could run j at some
+// point.
+//
+// Preconditions: s.mu is locked.
+func (s *scheduler) pick(machines []Machine, reserved []bool, j *Job) (idx int, possible bool) {
+	idx = -1
+	for i := range machines {
+		m := &machines[i]
+		if !m.canRun(j) {
+			continue
+		}
+		possible = true
+		if idx >= 0 || reserved[i] {
+			continue
+		}
+		need := 1
+		if j.Exclusive {
+			need = m.slots()
+		}
+		if s.used[i]+need <= m.slots() {
+			idx = i
+		}
+	}
+	return idx, possible
+}
+
+// Run runs the jobs on the machines of p and returns their merged results.
+//
+// Jobs are considered in the order of the plan, and each is started on the
+// first machine that has the features it requires and enough free slots. An
+// exclusive job needs all slots of its machine. A job that has to wait
+// reserves the machines it could run on, so that later jobs can't starve it
+// by keeping them busy. A job that fails, or that no machine can run, is
+// recorded in the report without stopping the rest of the run.
+func Run(ctx context.Context, r Runner, p *Plan, opts Options) (*Report, error) {
+	if len(p.Jobs) == 0 {
+		return nil, fmt.Errorf("no jobs")
+	}
+	s := &scheduler{used: make([]int, len(p.Machines))}
+	s.cond = sync.NewCond(&s.mu)
+	report := &Report{Results: make([]Result, len(p.Jobs))}
+	var wg sync.WaitGroup
+
+	s.mu.Lock()
+	pending := make([]int, len(p.Jobs))
+	for i := range pending {
+		pending[i] = i
+	}
+	for len(pending) > 0 {
+		if err := ctx.Err(); err != nil {
+			s.mu.Unlock()
+			wg.Wait()
+			return nil, err
+		}
+		reserved := make([]bool, len(p.Machines))
+		var waiting []int
+		for _, ji := range pending {
+			j := &p.Jobs[ji]
+			mi, ok := s.pick(p.Machines, reserved, j)
+			switch {
+			case !ok:
+				err := fmt.Sprintf("no machine has features %v", j.Requires)
+				opts.logf("%s: %s", j, err)
+				report.Results[ji] = Result{Job: j.String(), Err: err}
+			case mi < 0:
+				waiting = append(waiting, ji)
+				for i := range p.Machines {
+					if p.Machines[i].canRun(j) {
+						reserved[i] = true
+					}
+				}
+			default:
+				need := 1
+				if j.Exclusive {
+					need = p.Machines[mi].slots()
+				}
+				s.used[mi] += need
+				wg.Add(1)
+				go func(ji int) {
+					defer wg.Done()
+					res := runJob(ctx, r, &p.Machines[mi], j, &opts)
+					s.mu.Lock()
+					defer s.mu.Unlock()
+					report.Results[ji] = res
+					s.used[mi] -= need
+					s.cond.Broadcast()
+				}(ji)
+			}
+		}
+		pending = waiting
+		if len(pending) > 0 {
+			// Nothing else can start until a running job completes.
+			s.cond.Wait()
+		}
+	}
+	s.mu.Unlock()
+	wg.Wait()
+	return report, nil
+}
+
+// runJob runs j on m.
+func runJob(ctx context.Context, r Runner, m *Machine, j *Job, opts *Options) Result {
+	opts.logf("%s: running on %s", j, m.Name)
+	start := time.Now()
+	out, err := r.Run(ctx, m, j)
+	res := Result{
+		Job:        j.String(),
+		Machine:    m.Name,
+		Duration:   time.Since(start),
+		Benchmarks: benchmarkLines(out),
+	}
+	if err == nil && len(res.Benchmarks) == 0 {
+		err = fmt.Errorf("no benchmark results in output")
+	}
+	if err != nil {
+		opts.logf("%s: failed on %s: %v", j, m.Name, err)
+		res.Err = err.Error()
+	} else {
+		opts.logf("%s: done on %s in %s", j, m.Name, res.Duration.Round(time.Second))
+	}
+	return res
+}
+
+// Formats supported by Report.Write.
+const (
+	// FormatText is a summary of the jobs.
+	FormatText = "text"
+
+	// FormatJSON is the JSON encoding of the report.
+	FormatJSON = "json"
+
+	// FormatGo is the merged Go benchmark output of all jobs, suitable as
+	// input to //tools/parsers:parser or benchstat.
+	FormatGo = "go"
+)
+
+// Write writes the report to w in the given format.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatText:
+		return r.writeText(w)
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case FormatGo:
+		for _, res := range r.Results {
+			for _, line := range res.Benchmarks {
+				if _, err := fmt.Fprintln(w, line); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q, want %q, %q or %q", format, FormatText, FormatJSON, FormatGo)
+	}
+}
+
+func (r *Report) writeText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "JOB\tMACHINE\tDURATION\tRESULTS\t")
+	for _, res := range r.Results {
+		machine := res.Machine
+		if machine == "" {
+			machine = "-"
+		}
+		results := fmt.Sprintf("%d", len(res.Benchmarks))
+		if res.Err != "" {
+			results = "FAILED: " + res.Err
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\n", res.Job, machine, res.Duration.Round(time.Second), results)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,112 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary shard runs the benchmarks of a plan in parallel across a pool of
+// machines and merges their results into one report.
+//
+// A plan is a JSON file such as:
+//
+//	{
+//	  "jobs": [
+//	    {"target": "//test/benchmarks/network:nginx_test", "exclusive": true},
+//	    {"target": "//test/benchmarks/gpu:pytorch_test", "requires": ["gpu"]},
+//	    {"target": "//test/benchmarks/base:startup_test"}
+//	  ],
+//	  "machines": [
+//	    {"name": "bench-1", "slots": 2, "env": ["DOCKER_HOST=tcp://bench-1:2375"]},
+//	    {"name": "gpu-1", "features": ["gpu"], "env": ["DOCKER_HOST=tcp://gpu-1:2375"]}
+//	  ]
+//	}
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"gvisor.dev/gvisor/runsc/flag"
+	"gvisor.dev/gvisor/tools/benchshard"
+	"gvisor.dev/gvisor/tools/benchutil"
+)
+
+var (
+	repo          = flag.String("repo", ".", "path to the gVisor repository in which the benchmarks are run.")
+	plan          = flag.String("plan", "", "JSON file listing the jobs to run and the machines to run them on.")
+	dockerRuntime = flag.String("runtime", "runsc", "Docker runtime to benchmark.")
+	options       = flag.String("options", "-test.benchtime=10s", "options passed to each benchmark.")
+	runCmd        = flag.String("run_cmd", "", "shell command that runs the benchmark $TARGET with filter $FILTER on machine $MACHINE; defaults to make run-benchmark.")
+	format        = flag.String("format", benchshard.FormatText, "report format: text, json or go.")
+	output        = flag.String("output", "", "file to write the report to; standard output if unset.")
+	goOutput      = flag.String("go_output", "", "if set, file to write the merged Go benchmark output of all jobs to, e.g. for //tools/parsers:parser.")
+	allowFail     = flag.Bool("allow_failures", false, "exit successfully even if some jobs failed.")
+)
+
+// writeReport writes report to path, or standard output if path is empty.
+func writeReport(report *benchshard.Report, path, format string) error {
+	if path == "" {
+		return report.Write(os.Stdout, format)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := report.Write(f, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func run(ctx context.Context) error {
+	if *plan == "" {
+		return fmt.Errorf("--plan is required")
+	}
+	p, err := benchshard.ReadPlan(*plan)
+	if err != nil {
+		return err
+	}
+	cmd := *runCmd
+	if cmd == "" {
+		// The machine's Env (e.g. DOCKER_HOST) selects where containers
+		// run. Profiling and runc would only add time and noise.
+		cmd = fmt.Sprintf(`make run-benchmark RUNTIME=%s BENCHMARKS_TARGETS="$TARGET" BENCHMARKS_FILTER="$FILTER" BENCHMARKS_OPTIONS=%s BENCHMARKS_PROFILE= BENCHMARKS_RUNC=false`,
+			benchutil.ShellQuote(*dockerRuntime), benchutil.ShellQuote(*options))
+	}
+	report, err := benchshard.Run(ctx, &benchshard.CommandRunner{Dir: *repo, Cmd: cmd}, p, benchshard.Options{
+		Logf: log.Printf,
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeReport(report, *output, *format); err != nil {
+		return err
+	}
+	if *goOutput != "" {
+		if err := writeReport(report, *goOutput, benchshard.FormatGo); err != nil {
+			return err
+		}
+	}
+	if failed := report.Failed(); failed > 0 && !*allowFail {
+		return fmt.Errorf("%d of %d jobs failed", failed, len(report.Results))
+	}
+	return nil
+}
+
+func main() {
+	flag.Parse()
+	if err := run(context.Background()); err != nil {
+		log.Fatalf("Sharded benchmark run failed: %v", err)
+	}
+}
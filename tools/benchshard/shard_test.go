@@ -0,0 +1,163 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package benchshard
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeRunner records where jobs run and how many run concurrently on each
+// machine.
+type fakeRunner struct {
+	mu sync.Mutex
+
+	// running is the number of jobs running per machine, and exclusive is
+	// set for machines running an exclusive job.
+	running   map[string]int
+	exclusive map[string]bool
+
+	// violations lists exclusivity or slot violations that were observed.
+	violations []string
+
+	// slots is the number of slots per machine.
+	slots map[string]int
+
+	// fail lists jobs that fail.
+	fail map[string]bool
+}
+
+func newFakeRunner(p *Plan) *fakeRunner {
+	f := &fakeRunner{
+		running:   make(map[string]int),
+		exclusive: make(map[string]bool),
+		slots:     make(map[string]int),
+		fail:      make(map[string]bool),
+	}
+	for i := range p.Machines {
+		f.slots[p.Machines[i].Name] = p.Machines[i].slots()
+	}
+	return f
+}
+
+// Run implements Runner.Run.
+func (f *fakeRunner) Run(ctx context.Context, m *Machine, j *Job) (string, error) {
+	f.mu.Lock()
+	f.running[m.Name]++
+	if f.running[m.Name] > f.slots[m.Name] {
+		f.violations = append(f.violations, fmt.Sprintf("%s: %d jobs on %d slots", m.Name, f.running[m.Name], f.slots[m.Name]))
+	}
+	if f.exclusive[m.Name] || (j.Exclusive && f.running[m.Name] > 1) {
+		f.violations = append(f.violations, fmt.Sprintf("%s: %s shares machine with an exclusive job", m.Name, j))
+	}
+	if j.Exclusive {
+		f.exclusive[m.Name] = true
+	}
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.running[m.Name]--
+		if j.Exclusive {
+			f.exclusive[m.Name] = false
+		}
+	}()
+	if f.fail[j.String()] {
+		return "", fmt.Errorf("failed")
+	}
+	return fmt.Sprintf("goos: linux\nBenchmark%s\nBenchmark%s-8 \t 1 \t 100 ns/op\nPASS\n", j.Name, j.Name), nil
+}
+
+func TestRun(t *testing.T) {
+	p := &Plan{
+		Jobs: []Job{
+			{Name: "A"},
+			{Name: "B", Exclusive: true},
+			{Name: "C"},
+			{Name: "GPU", Requires: []string{"gpu"}},
+			{Name: "D"},
+			{Name: "TPU", Requires: []string{"tpu"}},
+			{Name: "E", Exclusive: true},
+			{Name: "Fail"},
+		},
+		Machines: []Machine{
+			{Name: "m1", Slots: 2},
+			{Name: "m2"},
+			{Name: "gpu", Features: []string{"gpu"}},
+		},
+	}
+	r := newFakeRunner(p)
+	r.fail["Fail"] = true
+	report, err := Run(context.Background(), r, p, Options{Logf: t.Logf})
+	if err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	if len(r.violations) != 0 {
+		t.Errorf("scheduling violations: %v", r.violations)
+	}
+	for i, res := range report.Results {
+		switch res.Job {
+		case "GPU":
+			if res.Machine != "gpu" {
+				t.Errorf("GPU job ran on %q, want gpu", res.Machine)
+			}
+		case "TPU":
+			if res.Machine != "" || res.Err == "" {
+				t.Errorf("TPU job = %+v, want error without machine", res)
+			}
+			continue
+		case "Fail":
+			if res.Err == "" {
+				t.Errorf("Fail job = %+v, want error", res)
+			}
+			continue
+		}
+		if res.Job != p.Jobs[i].Name {
+			t.Errorf("result %d is for job %q, want %q", i, res.Job, p.Jobs[i].Name)
+		}
+		if res.Err != "" {
+			t.Errorf("job %s failed: %s", res.Job, res.Err)
+		}
+		if want := []string{fmt.Sprintf("Benchmark%s-8 \t 1 \t 100 ns/op", res.Job)}; !cmp.Equal(res.Benchmarks, want) {
+			t.Errorf("job %s benchmarks = %q, want %q", res.Job, res.Benchmarks, want)
+		}
+	}
+	if got, want := report.Failed(), 2; got != want {
+		t.Errorf("Failed() = %d, want %d", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := report.Write(&buf, FormatGo); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	want := "BenchmarkA-8 \t 1 \t 100 ns/op\nBenchmarkB-8 \t 1 \t 100 ns/op\nBenchmarkC-8 \t 1 \t 100 ns/op\nBenchmarkGPU-8 \t 1 \t 100 ns/op\nBenchmarkD-8 \t 1 \t 100 ns/op\nBenchmarkE-8 \t 1 \t 100 ns/op\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("merged output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBenchmarkLines(t *testing.T) {
+	out := "goos: linux\n=== RUN BenchmarkFoo\nBenchmarkFoo\nBenchmarkFoo/bar-8   \t 10\t 123 ns/op\t 4 B/op\n    BenchmarkFoo/baz-8 \t 1 \t 5 ns/op\nPASS\n"
+	want := []string{"BenchmarkFoo/bar-8   \t 10\t 123 ns/op\t 4 B/op", "BenchmarkFoo/baz-8 \t 1 \t 5 ns/op"}
+	if got := benchmarkLines(out); !cmp.Equal(got, want) {
+		t.Errorf("benchmarkLines() = %q, want %q", got, want)
+	}
+}
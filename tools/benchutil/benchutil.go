@@ -0,0 +1,67 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package benchutil provides helpers shared by the tools that run benchmarks
+// and compare their results.
+package benchutil
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gvisor.dev/gvisor/tools/parsers"
+)
+
+// Samples returns the samples of metric for benchmark in the Go benchmark
+// output out. benchmark is the name of the benchmark, without
+// sub-benchmarks, and metric the name of the metric as in the output, e.g.
+// "ns/op" or "requests_per_second". Samples of all sub-benchmarks are
+// returned. It fails if there are none.
+func Samples(out, benchmark, metric string) ([]float64, error) {
+	suite, err := parsers.ParseOutput(out, benchmark, false /* official */)
+	if err != nil {
+		return nil, err
+	}
+	var samples []float64
+	for _, bm := range suite.Benchmarks {
+		if bm.Name != benchmark {
+			continue
+		}
+		for _, m := range bm.Metric {
+			if m.Name == metric {
+				samples = append(samples, m.Sample)
+			}
+		}
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no %q samples of %s in output", metric, benchmark)
+	}
+	return samples, nil
+}
+
+// Median returns the median of samples, which must not be empty.
+func Median(samples []float64) float64 {
+	s := slices.Clone(samples)
+	slices.Sort(s)
+	if len(s)%2 == 1 {
+		return s[len(s)/2]
+	}
+	return (s[len(s)/2-1] + s[len(s)/2]) / 2
+}
+
+// ShellQuote quotes s for use as a single shell word.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package benchutil
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSamples(t *testing.T) {
+	const out = `
+goos: linux
+BenchmarkRuby/server_threads.1-6 1	1397875880 ns/op 140 requests_per_second.QPS
+BenchmarkRuby/server_threads.5-6 1	1000000000 ns/op 200 requests_per_second.QPS
+BenchmarkOther-6 1	5 ns/op
+PASS
+`
+	got, err := Samples(out, "BenchmarkRuby", "requests_per_second")
+	if err != nil {
+		t.Fatalf("Samples failed: %v", err)
+	}
+	if want := []float64{140, 200}; !cmp.Equal(got, want) {
+		t.Errorf("got samples %v, want %v", got, want)
+	}
+
+	if _, err := Samples(out, "BenchmarkRuby", "allocs/op"); err == nil {
+		t.Errorf("Samples succeeded without samples of the metric")
+	}
+}
+
+func TestMedian(t *testing.T) {
+	for _, test := range []struct {
+		samples []float64
+		want    float64
+	}{
+		{[]float64{3}, 3},
+		{[]float64{3, 1, 2}, 2},
+		{[]float64{4, 1, 3, 2}, 2.5},
+		{[]float64{1, 1, 100}, 1},
+	} {
+		samples := append([]float64(nil), test.samples...)
+		if got := Median(samples); got != test.want {
+			t.Errorf("Median(%v) = %v, want %v", test.samples, got, test.want)
+		}
+		if !cmp.Equal(samples, test.samples) {
+			t.Errorf("Median(%v) modified its argument to %v", test.samples, samples)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, s := range []string{"", "a b", "it's", `"$HOME"`, "a\nb"} {
+		out, err := exec.Command("sh", "-c", "printf %s "+ShellQuote(s)).Output()
+		if err != nil {
+			t.Fatalf("sh failed for %q: %v", s, err)
+		}
+		if got := string(out); got != s {
+			t.Errorf("ShellQuote(%q) evaluated to %q", s, got)
+		}
+	}
+}
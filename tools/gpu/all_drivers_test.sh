@@ -16,15 +16,34 @@
 
 # Script to easily run gpu tests on all supported driver versions. This should
 # be run from the gVisor repo root directory.
+#
+# DRIVER_VERSIONS selects the drivers to test: all (the default), latest,
+# latest-per-branch, or a comma-separated list of versions. Downloaded drivers
+# are kept in DRIVER_CACHE_DIR, so that switching between them is fast.
 set -ueo pipefail
 
 tmp_file=$(mktemp)
 trap "rm -f ${tmp_file}" EXIT
 
-make sudo TARGETS=tools/gpu:main ARGS="list --outfile=${tmp_file}"
+driver_versions="${DRIVER_VERSIONS:-all}"
+cache_dir="${DRIVER_CACHE_DIR:-/tmp/nvidia-drivers}"
+
+make sudo TARGETS=tools/gpu:main ARGS="list --versions=${driver_versions} --outfile=${tmp_file}"
 read -r -a versions <<< "$(cat "${tmp_file}")"
 
+failed=()
 for driver in "${versions[@]}"; do
-  make sudo TARGETS=tools/gpu:main ARGS="install --version ${driver}"
-  make gpu-smoke-tests
+  if ! make sudo TARGETS=tools/gpu:main ARGS="install --version ${driver} --cache_dir=${cache_dir}"; then
+    failed+=("${driver} (install)")
+    continue
+  fi
+  if ! make gpu-smoke-tests; then
+    failed+=("${driver}")
+  fi
 done
+
+if [[ "${#failed[@]}" -ne 0 ]]; then
+  echo "Failed drivers: ${failed[*]}" >&2
+  exit 1
+fi
+echo "All drivers passed: ${versions[*]}"
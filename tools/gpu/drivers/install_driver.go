@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 
 	"gvisor.dev/gvisor/pkg/log"
@@ -42,6 +43,9 @@ func init() {
 // Installer handles the logic to install drivers.
 type Installer struct {
 	requestedVersion nvproxy.DriverVersion
+	// cacheDir, if set, is the directory in which downloaded driver installers
+	// are kept, so that switching back to a driver doesn't download it again.
+	cacheDir string
 	// include functions so they can be mocked in tests.
 	expectedChecksumFunc func(nvproxy.DriverVersion) (string, bool)
 	getCurrentDriverFunc func() (nvproxy.DriverVersion, error)
@@ -71,6 +75,12 @@ func NewInstaller(requestedVersion string, latest bool) (*Installer, error) {
 	return ret, nil
 }
 
+// SetCacheDir sets the directory in which downloaded driver installers are
+// kept. The directory is created if it doesn't exist.
+func (i *Installer) SetCacheDir(dir string) {
+	i.cacheDir = dir
+}
+
 // MaybeInstall installs a driver if 1) no driver is present on the system already or 2) the
 // driver currently installed does not match the requested version.
 func (i *Installer) MaybeInstall(ctx context.Context) error {
@@ -96,34 +106,78 @@ func (i *Installer) MaybeInstall(ctx context.Context) error {
 		log.Infof("Driver uninstalled: %s", i.requestedVersion)
 	}
 
+	driverPath, err := i.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	if i.cacheDir == "" {
+		defer os.Remove(driverPath)
+	}
+	log.Infof("Installing driver: %s", i.requestedVersion)
+	if err := i.installFunc(driverPath); err != nil {
+		return fmt.Errorf("failed to install driver: %w", err)
+	}
+	log.Infof("Installation Complete!")
+	return nil
+}
+
+// fetch returns the path of the installer of the requested driver. The
+// installer is taken from the cache directory if it holds a valid copy, and
+// is downloaded otherwise. Without a cache directory, the caller must remove
+// the installer once done with it.
+func (i *Installer) fetch(ctx context.Context) (string, error) {
+	var cachePath string
+	if i.cacheDir != "" {
+		if err := os.MkdirAll(i.cacheDir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create cache directory: %w", err)
+		}
+		cachePath = filepath.Join(i.cacheDir, runfileName(i.requestedVersion.String()))
+		if f, err := os.Open(cachePath); err == nil {
+			err := i.writeAndCheck(io.Discard, f)
+			f.Close()
+			if err == nil {
+				log.Infof("Using cached driver: %s", cachePath)
+				return cachePath, nil
+			}
+			log.Warningf("Ignoring cached driver %q: %v", cachePath, err)
+		}
+	}
+
 	log.Infof("Downloading driver: %s", i.requestedVersion)
 	reader, err := i.downloadFunc(ctx, i.requestedVersion.String())
 	if err != nil {
-		return fmt.Errorf("failed to download driver: %w", err)
+		return "", fmt.Errorf("failed to download driver: %w", err)
 	}
+	defer reader.Close()
 
-	f, err := os.CreateTemp("", "")
+	f, err := os.CreateTemp(i.cacheDir, "")
 	if err != nil {
-		return fmt.Errorf("failed to open driver file: %w", err)
+		return "", fmt.Errorf("failed to open driver file: %w", err)
 	}
-	defer os.Remove(f.Name())
 	if err := i.writeAndCheck(f, reader); err != nil {
 		f.Close()
-		return fmt.Errorf("writeAndCheck: %w", err)
+		os.Remove(f.Name())
+		return "", fmt.Errorf("writeAndCheck: %w", err)
 	}
 	if err := f.Chmod(0755); err != nil {
-		return fmt.Errorf("failed to chmod: %w", err)
+		f.Close()
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to chmod: %w", err)
 	}
 	if err := f.Close(); err != nil {
-		return fmt.Errorf("failed to close driver file: %w", err)
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to close driver file: %w", err)
 	}
 	log.Infof("Driver downloaded: %s", i.requestedVersion)
-	log.Infof("Installing driver: %s", i.requestedVersion)
-	if err := i.installFunc(f.Name()); err != nil {
-		return fmt.Errorf("failed to install driver: %w", err)
+	if cachePath == "" {
+		return f.Name(), nil
 	}
-	log.Infof("Installation Complete!")
-	return nil
+	// Only move complete and verified installers into place.
+	if err := os.Rename(f.Name(), cachePath); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to cache driver: %w", err)
+	}
+	return cachePath, nil
 }
 
 func (i *Installer) uninstallDriver(ctx context.Context, driverVersion string) error {
@@ -137,7 +191,7 @@ func (i *Installer) uninstallDriver(ctx context.Context, driverVersion string) e
 	return nil
 }
 
-func (i *Installer) writeAndCheck(f *os.File, reader io.ReadCloser) error {
+func (i *Installer) writeAndCheck(f io.Writer, reader io.Reader) error {
 	checksum := sha256.New()
 	buf := make([]byte, 1024*1024)
 	for {
@@ -183,9 +237,14 @@ func getCurrentDriver() (nvproxy.DriverVersion, error) {
 	return nvproxy.DriverVersionFrom(strings.TrimSpace(string(out)))
 }
 
-// ListSupportedDrivers prints the driver to stderr in a format that can be
-// consumed by the Makefile to iterate tests across drivers.
-func ListSupportedDrivers(outfile string) error {
+// ListSupportedDrivers prints the drivers selected by sel (see
+// SelectVersions) in a format that can be consumed by the Makefile to iterate
+// tests across drivers.
+func ListSupportedDrivers(sel, outfile string) error {
+	versions, err := SelectVersions(sel)
+	if err != nil {
+		return err
+	}
 	out := os.Stdout
 	if outfile != "" {
 		f, err := os.OpenFile(outfile, os.O_WRONLY, 0644)
@@ -197,9 +256,9 @@ func ListSupportedDrivers(outfile string) error {
 	}
 
 	var list []string
-	nvproxy.ForEachSupportDriver(func(version nvproxy.DriverVersion, checksum string) {
+	for _, version := range versions {
 		list = append(list, version.String())
-	})
+	}
 	if _, err := out.WriteString(strings.Join(list, " ") + "\n"); err != nil {
 		return fmt.Errorf("failed to write to outfile: %w", err)
 	}
@@ -228,7 +287,7 @@ func ChecksumDriver(ctx context.Context, driverVersion string) (string, error) {
 // DownloadDriver downloads the requested driver and returns the binary as a []byte so it can be
 // checked before written to disk.
 func DownloadDriver(ctx context.Context, driverVersion string) (io.ReadCloser, error) {
-	url := fmt.Sprintf("%s%s/NVIDIA-Linux-x86_64-%s.run", nvidiaBaseURL, driverVersion, driverVersion)
+	url := fmt.Sprintf("%s%s/%s", nvidiaBaseURL, driverVersion, runfileName(driverVersion))
 	resp, err := http.Get(url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to download driver: %w", err)
@@ -239,6 +298,11 @@ func DownloadDriver(ctx context.Context, driverVersion string) (io.ReadCloser, e
 	return resp.Body, nil
 }
 
+// runfileName returns the name of the installer of the given driver version.
+func runfileName(driverVersion string) string {
+	return fmt.Sprintf("NVIDIA-Linux-x86_64-%s.run", driverVersion)
+}
+
 func installDriver(driverPath string) error {
 	// Certain VMs can be broken if we attempt to install drivers on them. Do a simple check of the
 	// PCI device to ensure we have a GPU attached.
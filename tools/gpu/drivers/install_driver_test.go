@@ -126,3 +126,46 @@ func TestDriverInstalls(t *testing.T) {
 		t.Fatalf("Installation failed: %v", err)
 	}
 }
+
+// TestDriverCached tests that a cached driver is installed without downloading
+// it again.
+func TestDriverCached(t *testing.T) {
+	ctx := context.Background()
+	content := []byte("some content")
+	checksum := fmt.Sprintf("%x", sha256.Sum256(content))
+	version := nvproxy.NewDriverVersion(1, 2, 3)
+	downloads := 0
+	var installed []string
+	installer := &Installer{
+		requestedVersion: version,
+		cacheDir:         t.TempDir(),
+		getCurrentDriverFunc: func() (nvproxy.DriverVersion, error) {
+			return nvproxy.DriverVersion{}, nil
+		},
+		expectedChecksumFunc: func(v nvproxy.DriverVersion) (string, bool) {
+			if v == version {
+				return checksum, true
+			}
+			return "", false
+		},
+		downloadFunc: func(context.Context, string) (io.ReadCloser, error) {
+			downloads++
+			return io.NopCloser(bytes.NewReader(content)), nil
+		},
+		installFunc: func(path string) error {
+			installed = append(installed, path)
+			return nil
+		},
+	}
+	for i := 0; i < 2; i++ {
+		if err := installer.MaybeInstall(ctx); err != nil {
+			t.Fatalf("Installation %d failed: %v", i, err)
+		}
+	}
+	if downloads != 1 {
+		t.Errorf("Driver downloaded %d times, want 1", downloads)
+	}
+	if len(installed) != 2 || installed[0] != installed[1] {
+		t.Errorf("Installed drivers %v, want the same cached driver twice", installed)
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/devices/nvproxy"
+)
+
+// Driver selections accepted by SelectVersions, in addition to a
+// comma-separated list of versions.
+const (
+	// SelectAll selects all supported drivers.
+	SelectAll = "all"
+
+	// SelectLatest selects the latest supported driver.
+	SelectLatest = "latest"
+
+	// SelectLatestPerBranch selects the latest supported driver of each major
+	// version, which covers every ABI branch with one driver each.
+	SelectLatestPerBranch = "latest-per-branch"
+)
+
+// supportedDrivers returns all supported drivers.
+func supportedDrivers() []nvproxy.DriverVersion {
+	var versions []nvproxy.DriverVersion
+	nvproxy.ForEachSupportDriver(func(version nvproxy.DriverVersion, checksum string) {
+		versions = append(versions, version)
+	})
+	return versions
+}
+
+// versionParts returns the major, minor and patch numbers of v.
+func versionParts(v nvproxy.DriverVersion) [3]int {
+	var p [3]int
+	fmt.Sscanf(v.String(), "%d.%d.%d", &p[0], &p[1], &p[2])
+	return p
+}
+
+// sortVersions sorts versions from oldest to newest.
+func sortVersions(versions []nvproxy.DriverVersion) {
+	sort.Slice(versions, func(i, j int) bool {
+		a, b := versionParts(versions[i]), versionParts(versions[j])
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+}
+
+// SelectVersions returns the supported drivers selected by sel, sorted from
+// oldest to newest.
+func SelectVersions(sel string) ([]nvproxy.DriverVersion, error) {
+	return selectVersions(supportedDrivers(), sel)
+}
+
+func selectVersions(supported []nvproxy.DriverVersion, sel string) ([]nvproxy.DriverVersion, error) {
+	supported = append([]nvproxy.DriverVersion(nil), supported...)
+	sortVersions(supported)
+	if len(supported) == 0 {
+		return nil, fmt.Errorf("no supported drivers")
+	}
+	switch sel {
+	case SelectAll:
+		return supported, nil
+	case SelectLatest:
+		return supported[len(supported)-1:], nil
+	case SelectLatestPerBranch:
+		var versions []nvproxy.DriverVersion
+		for i, v := range supported {
+			if i+1 == len(supported) || versionParts(supported[i+1])[0] != versionParts(v)[0] {
+				versions = append(versions, v)
+			}
+		}
+		return versions, nil
+	}
+
+	var versions []nvproxy.DriverVersion
+	for _, s := range strings.Split(sel, ",") {
+		v, err := nvproxy.DriverVersionFrom(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid driver selection %q: %w", sel, err)
+		}
+		supportedVersion := false
+		for _, sv := range supported {
+			if sv.Equals(v) {
+				supportedVersion = true
+				break
+			}
+		}
+		if !supportedVersion {
+			return nil, fmt.Errorf("driver %q is not supported", v)
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+// Suite is run by a Matrix with each driver installed.
+type Suite func(ctx context.Context, version nvproxy.DriverVersion) error
+
+// Matrix runs a suite against several drivers, installing each in turn on the
+// host.
+type Matrix struct {
+	// Versions are the drivers to run the suite against, in order.
+	Versions []nvproxy.DriverVersion
+
+	// CacheDir, if set, is the directory in which downloaded driver
+	// installers are kept across switches and runs.
+	CacheDir string
+
+	// include functions so they can be mocked in tests.
+	installFunc          func(context.Context, nvproxy.DriverVersion, string) error
+	getCurrentDriverFunc func() (nvproxy.DriverVersion, error)
+}
+
+// MatrixResult is the outcome of running a suite against one driver.
+type MatrixResult struct {
+	// Version is the driver the suite ran against.
+	Version nvproxy.DriverVersion
+
+	// Duration is the time taken to install the driver and run the suite.
+	Duration time.Duration
+
+	// InstallErr is set if the driver couldn't be installed, in which case
+	// the suite wasn't run.
+	InstallErr error
+
+	// Err is the error returned by the suite.
+	Err error
+}
+
+// Failed returns true if the driver couldn't be installed or the suite failed.
+func (r *MatrixResult) Failed() bool {
+	return r.InstallErr != nil || r.Err != nil
+}
+
+// installVersion installs version on the host using an Installer.
+func installVersion(ctx context.Context, version nvproxy.DriverVersion, cacheDir string) error {
+	installer, err := NewInstaller(version.String(), false /* latest */)
+	if err != nil {
+		return err
+	}
+	installer.SetCacheDir(cacheDir)
+	return installer.MaybeInstall(ctx)
+}
+
+// Run installs each driver of m and runs suite against it. A driver that
+// fails to install or fails the suite doesn't stop the run; the outcome for
+// each driver is returned in the order of m.Versions. Run only returns early
+// if ctx is canceled.
+func (m *Matrix) Run(ctx context.Context, suite Suite) []MatrixResult {
+	install := m.installFunc
+	if install == nil {
+		install = installVersion
+	}
+	currentDriver := m.getCurrentDriverFunc
+	if currentDriver == nil {
+		currentDriver = getCurrentDriver
+	}
+
+	var results []MatrixResult
+	for _, version := range m.Versions {
+		if ctx.Err() != nil {
+			break
+		}
+		start := time.Now()
+		res := MatrixResult{Version: version}
+		log.Infof("Switching to driver %s", version)
+		if err := install(ctx, version, m.CacheDir); err != nil {
+			res.InstallErr = err
+		} else if current, err := currentDriver(); err != nil {
+			res.InstallErr = fmt.Errorf("failed to get installed driver: %w", err)
+		} else if !current.Equals(version) {
+			res.InstallErr = fmt.Errorf("driver %s is loaded after installing %s, the host may need a reboot", current, version)
+		} else {
+			log.Infof("Running suite with driver %s", version)
+			res.Err = suite(ctx, version)
+		}
+		res.Duration = time.Since(start)
+		if res.Failed() {
+			log.Warningf("Driver %s failed: install: %v, suite: %v", version, res.InstallErr, res.Err)
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// WriteSummary writes a table of results to w.
+func WriteSummary(w io.Writer, results []MatrixResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DRIVER\tDURATION\tRESULT\t")
+	for _, res := range results {
+		result := "PASS"
+		switch {
+		case res.InstallErr != nil:
+			result = "INSTALL FAILED: " + res.InstallErr.Error()
+		case res.Err != nil:
+			result = "FAILED: " + res.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t\n", res.Version, res.Duration.Round(time.Second), result)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/sentry/devices/nvproxy"
+)
+
+func versionStrings(versions []nvproxy.DriverVersion) string {
+	var s []string
+	for _, v := range versions {
+		s = append(s, v.String())
+	}
+	return strings.Join(s, " ")
+}
+
+// TestSelectVersions tests driver selection.
+func TestSelectVersions(t *testing.T) {
+	supported := []nvproxy.DriverVersion{
+		nvproxy.NewDriverVersion(550, 54, 15),
+		nvproxy.NewDriverVersion(535, 104, 5),
+		nvproxy.NewDriverVersion(535, 161, 7),
+		nvproxy.NewDriverVersion(525, 60, 13),
+		nvproxy.NewDriverVersion(535, 54, 3),
+	}
+	for _, tc := range []struct {
+		sel     string
+		want    string
+		wantErr bool
+	}{
+		{sel: SelectAll, want: "525.60.13 535.54.03 535.104.05 535.161.07 550.54.15"},
+		{sel: SelectLatest, want: "550.54.15"},
+		{sel: SelectLatestPerBranch, want: "525.60.13 535.161.07 550.54.15"},
+		{sel: "535.104.05, 525.60.13", want: "535.104.05 525.60.13"},
+		{sel: "535.104.06", wantErr: true},
+		{sel: "foo", wantErr: true},
+	} {
+		t.Run(tc.sel, func(t *testing.T) {
+			got, err := selectVersions(supported, tc.sel)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("selectVersions(%q) = %s, want error", tc.sel, versionStrings(got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectVersions(%q) failed: %v", tc.sel, err)
+			}
+			if versionStrings(got) != tc.want {
+				t.Errorf("selectVersions(%q) = %s, want %s", tc.sel, versionStrings(got), tc.want)
+			}
+		})
+	}
+}
+
+// TestMatrixRun tests that a matrix runs the suite against each installed
+// driver and carries on past failures.
+func TestMatrixRun(t *testing.T) {
+	ctx := context.Background()
+	good := nvproxy.NewDriverVersion(1, 2, 3)
+	badInstall := nvproxy.NewDriverVersion(1, 2, 4)
+	stale := nvproxy.NewDriverVersion(1, 2, 5)
+	badSuite := nvproxy.NewDriverVersion(1, 2, 6)
+
+	var installed nvproxy.DriverVersion
+	m := &Matrix{
+		Versions: []nvproxy.DriverVersion{good, badInstall, stale, badSuite},
+		CacheDir: "/cache",
+		installFunc: func(_ context.Context, v nvproxy.DriverVersion, cacheDir string) error {
+			if cacheDir != "/cache" {
+				t.Errorf("install got cache dir %q, want %q", cacheDir, "/cache")
+			}
+			switch {
+			case v.Equals(badInstall):
+				return fmt.Errorf("install failed")
+			case v.Equals(stale):
+				// The previous driver remains loaded.
+			default:
+				installed = v
+			}
+			return nil
+		},
+		getCurrentDriverFunc: func() (nvproxy.DriverVersion, error) {
+			return installed, nil
+		},
+	}
+	var ran []nvproxy.DriverVersion
+	results := m.Run(ctx, func(_ context.Context, v nvproxy.DriverVersion) error {
+		ran = append(ran, v)
+		if v.Equals(badSuite) {
+			return fmt.Errorf("suite failed")
+		}
+		return nil
+	})
+
+	if got, want := versionStrings(ran), versionStrings([]nvproxy.DriverVersion{good, badSuite}); got != want {
+		t.Errorf("suite ran against %s, want %s", got, want)
+	}
+	if len(results) != len(m.Versions) {
+		t.Fatalf("got %d results, want %d", len(results), len(m.Versions))
+	}
+	for i, want := range []struct {
+		installErr bool
+		err        bool
+	}{
+		{},
+		{installErr: true},
+		{installErr: true},
+		{err: true},
+	} {
+		res := &results[i]
+		if !res.Version.Equals(m.Versions[i]) {
+			t.Errorf("result %d is for driver %s, want %s", i, res.Version, m.Versions[i])
+		}
+		if (res.InstallErr != nil) != want.installErr || (res.Err != nil) != want.err {
+			t.Errorf("driver %s got install error %v and suite error %v, want install error: %t, suite error: %t", res.Version, res.InstallErr, res.Err, want.installErr, want.err)
+		}
+	}
+
+	var summary strings.Builder
+	if err := WriteSummary(&summary, results); err != nil {
+		t.Fatalf("WriteSummary failed: %v", err)
+	}
+	if got := strings.Count(summary.String(), "FAILED"); got != 3 {
+		t.Errorf("summary has %d failures, want 3:\n%s", got, summary.String())
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/exec"
 
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/devices/nvproxy"
@@ -35,6 +36,8 @@ const (
 	validateChecksumDescription = "validates the checksum of all supported drivers"
 	listCmdStr                  = "list"
 	listDescription             = "lists the supported drivers"
+	matrixCmdStr                = "matrix"
+	matrixDescription           = "installs each selected driver in turn and runs a command against it"
 )
 
 var (
@@ -42,6 +45,7 @@ var (
 	installCmd = flag.NewFlagSet(installCmdStr, flag.ContinueOnError)
 	latest     = installCmd.Bool("latest", false, "install the latest supported driver")
 	version    = installCmd.String("version", "", "version of the driver")
+	cacheDir   = installCmd.String("cache_dir", "", "if set, keep downloaded drivers in this directory to switch between them without downloading them again")
 
 	// Computes the sha256 checksum for a given driver's .run file from the nvidia site.
 	checksumCmd     = flag.NewFlagSet(checksumCmdStr, flag.ContinueOnError)
@@ -53,12 +57,21 @@ var (
 	// The list command returns the list of supported drivers from this tool.
 	listCmd = flag.NewFlagSet(listCmdStr, flag.ContinueOnError)
 	outfile = listCmd.String("outfile", "", "if set, write the list output to this file")
+	listSel = listCmd.String("versions", drivers.SelectAll, "drivers to list: all, latest, latest-per-branch, or a comma-separated list of versions")
+
+	// The matrix command runs a command against each selected driver.
+	matrixCmd      = flag.NewFlagSet(matrixCmdStr, flag.ContinueOnError)
+	matrixSel      = matrixCmd.String("versions", drivers.SelectAll, "drivers to run against: all, latest, latest-per-branch, or a comma-separated list of versions")
+	matrixCacheDir = matrixCmd.String("cache_dir", "", "if set, keep downloaded drivers in this directory to switch between them without downloading them again")
+	matrixRunCmd   = matrixCmd.String("cmd", "", "shell command run with each driver installed, with the driver version in NVIDIA_DRIVER_VERSION")
+	matrixDir      = matrixCmd.String("dir", os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "directory to run the command in")
 
 	commandSet = map[*flag.FlagSet]string{
 		installCmd:          installDescription,
 		checksumCmd:         checksumDescription,
 		validateChecksumCmd: validateChecksumDescription,
 		listCmd:             listDescription,
+		matrixCmd:           matrixDescription,
 	}
 )
 
@@ -68,7 +81,7 @@ func printUsage() {
 
 Available commands:`
 	fmt.Println(usage)
-	for _, f := range []*flag.FlagSet{installCmd, checksumCmd, validateChecksumCmd, listCmd} {
+	for _, f := range []*flag.FlagSet{installCmd, checksumCmd, validateChecksumCmd, listCmd, matrixCmd} {
 		fmt.Printf("%s	%s\n", f.Name(), commandSet[f])
 		f.PrintDefaults()
 	}
@@ -92,6 +105,7 @@ func main() {
 			log.Warningf("Failed to create installer: %v", err.Error())
 			os.Exit(1)
 		}
+		installer.SetCacheDir(*cacheDir)
 		if err := installer.MaybeInstall(ctx); err != nil {
 			log.Warningf("Failed to install driver: %v", err.Error())
 			os.Exit(1)
@@ -131,10 +145,42 @@ func main() {
 			log.Warningf("%s failed with: %v", listCmdStr, err)
 			os.Exit(1)
 		}
-		if err := drivers.ListSupportedDrivers(*outfile); err != nil {
+		if err := drivers.ListSupportedDrivers(*listSel, *outfile); err != nil {
 			log.Warningf("Failed to list drivers: %v", err)
 			os.Exit(1)
 		}
+	case matrixCmdStr:
+		if err := matrixCmd.Parse(os.Args[2:]); err != nil {
+			log.Warningf("%s failed with: %v", matrixCmdStr, err)
+			os.Exit(1)
+		}
+		if *matrixRunCmd == "" {
+			log.Warningf("%s requires --cmd", matrixCmdStr)
+			os.Exit(1)
+		}
+		versions, err := drivers.SelectVersions(*matrixSel)
+		if err != nil {
+			log.Warningf("Failed to select drivers: %v", err)
+			os.Exit(1)
+		}
+		m := drivers.Matrix{
+			Versions: versions,
+			CacheDir: *matrixCacheDir,
+		}
+		results := m.Run(ctx, func(ctx context.Context, version nvproxy.DriverVersion) error {
+			cmd := exec.CommandContext(ctx, "sh", "-c", *matrixRunCmd)
+			cmd.Dir = *matrixDir
+			cmd.Env = append(os.Environ(), "NVIDIA_DRIVER_VERSION="+version.String())
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			return cmd.Run()
+		})
+		drivers.WriteSummary(os.Stdout, results)
+		for _, res := range results {
+			if res.Failed() {
+				os.Exit(1)
+			}
+		}
 	default:
 		printUsage()
 		os.Exit(1)
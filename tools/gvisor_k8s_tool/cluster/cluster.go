@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/kubernetes"
@@ -83,3 +84,55 @@ func (c *Cluster) WaitForDaemonset(ctx context.Context, ds *appsv1.DaemonSet) er
 		}
 	}
 }
+
+// CreatePod creates a pod with default options.
+func (c *Cluster) CreatePod(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error) {
+	if pod.GetObjectMeta().GetNamespace() == "" {
+		pod.SetNamespace(NamespaceDefault)
+	}
+	return c.client.CoreV1().Pods(pod.GetNamespace()).Create(ctx, pod, v1.CreateOptions{})
+}
+
+// DeletePod deletes a pod from this cluster.
+func (c *Cluster) DeletePod(ctx context.Context, pod *corev1.Pod) error {
+	return c.client.CoreV1().Pods(pod.GetNamespace()).Delete(ctx, pod.GetName(), v1.DeleteOptions{})
+}
+
+// WaitForPodCompletion waits until a pod has succeeded or failed, and returns
+// its final state.
+func (c *Cluster) WaitForPodCompletion(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error) {
+	w, err := c.client.CoreV1().Pods(pod.GetNamespace()).Watch(ctx, v1.ListOptions{
+		FieldSelector: fields.SelectorFromSet(fields.Set{v1.ObjectNameField: pod.ObjectMeta.Name}).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch Pod: %w", err)
+	}
+	defer w.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("context canceled before Pod completed: %w", ctx.Err())
+		case e, ok := <-w.ResultChan():
+			if !ok {
+				return nil, fmt.Errorf("watch of Pod %q closed before it completed", pod.GetName())
+			}
+			p, ok := e.Object.(*corev1.Pod)
+			if !ok {
+				return nil, fmt.Errorf("invalid object type: %T", e.Object)
+			}
+			switch p.Status.Phase {
+			case corev1.PodSucceeded, corev1.PodFailed:
+				return p, nil
+			}
+		}
+	}
+}
+
+// PodLogs returns the logs of a container of a pod.
+func (c *Cluster) PodLogs(ctx context.Context, pod *corev1.Pod, container string) (string, error) {
+	b, err := c.client.CoreV1().Pods(pod.GetNamespace()).GetLogs(pod.GetName(), &corev1.PodLogOptions{Container: container}).DoRaw(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get logs of Pod %q: %w", pod.GetName(), err)
+	}
+	return string(b), nil
+}